@@ -23,22 +23,43 @@ var (
 	homePath         string
 	overlayPath      []string
 	scratchPath      []string
+	writablePaths    []string
 	workdirPath      string
+	sessionDirPath   string
+	sessionDirSize   int
+	shmSize          string
+	squashThreads    int
 	cwdPath          string
 	shellPath        string
 	hostname         string
+	domainname       string
 	network          string
 	networkArgs      []string
+	networkArgsFile  string
+	publish          []string
 	dns              string
+	dnsSearch        string
+	dnsOptions       string
+	timezone         string
+	timeOffsets      string
+	fakeTime         string
 	security         []string
+	credentials      []string
 	cgroupsTOMLFile  string
+	cgroupsMode      string
 	containLibsPath  []string
 	fuseMount        []string
 	apptainerEnv     map[string]string
 	apptainerEnvFile string
+	preserveEnv      []string
+	unsetEnv         []string
 	noMount          []string
 	dmtcpLaunch      string
 	dmtcpRestart     string
+	joinSockets      string
+	fakerootDB       string
+	umask            string
+	groups           string
 
 	isBoot          bool
 	isFakeroot      bool
@@ -46,14 +67,21 @@ var (
 	isCompat        bool
 	isContained     bool
 	isContainAll    bool
+	keepLocale      bool
 	isWritable      bool
 	isWritableTmpfs bool
+	readOnlyRoot    bool
 	nvidia          bool
 	nvCCLI          bool
+	gpus            string
+	nvCaps          string
 	rocm            bool
 	noEval          bool
 	noHome          bool
 	noInit          bool
+	usePty          bool
+	noPty           bool
+	noLoopback      bool
 	noNvidia        bool
 	noRocm          bool
 	noUmask         bool
@@ -88,6 +116,11 @@ var (
 	ignoreFakerootCmd bool
 	ignoreUserns      bool
 
+	noNestingAutodetect bool
+
+	dryRun     bool
+	dryRunJSON bool
+
 	underlay bool // whether using underlay instead of overlay
 )
 
@@ -108,7 +141,7 @@ var actionBindFlag = cmdline.Flag{
 	DefaultValue: cmdline.StringArray{}, // to allow commas in bind path
 	Name:         "bind",
 	ShortHand:    "B",
-	Usage:        "a user-bind path specification.  spec has the format src[:dest[:opts]], where src and dest are outside and inside paths.  If dest is not given, it is set equal to src.  Mount options ('opts') may be specified as 'ro' (read-only) or 'rw' (read/write, which is the default). Multiple bind paths can be given by a comma separated list.",
+	Usage:        "a user-bind path specification.  spec has the format src[:dest[:opts]], where src and dest are outside and inside paths.  If dest is not given, it is set equal to src.  Mount options ('opts') may be specified as 'ro' (read-only) or 'rw' (read/write, which is the default), 'idmap' to map the user to itself on disk with an ID-mapped mount, requiring root or a setuid installation, and a mount propagation 'private', 'rprivate', 'shared', 'rshared', 'slave' or 'rslave', e.g. 'rslave' to see the host mounts done under src after the container started. Multiple bind paths can be given by a comma separated list.",
 	EnvKeys:      []string{"BIND", "BINDPATH"},
 	Tag:          "<spec>",
 	EnvHandler:   cmdline.EnvAppendValue,
@@ -120,7 +153,7 @@ var actionMountFlag = cmdline.Flag{
 	Value:        &mounts,
 	DefaultValue: cmdline.StringArray{},
 	Name:         "mount",
-	Usage:        "a mount specification e.g. 'type=bind,source=/opt,destination=/hostopt'.",
+	Usage:        "a mount specification e.g. 'type=bind,source=/opt,destination=/hostopt' or 'type=tmpfs,destination=/scratch,size=1g', the mount propagation is set with the 'bind-propagation' key.",
 	EnvKeys:      []string{"MOUNT"},
 	Tag:          "<spec>",
 	EnvHandler:   cmdline.EnvAppendValue,
@@ -145,7 +178,7 @@ var actionOverlayFlag = cmdline.Flag{
 	DefaultValue: []string{},
 	Name:         "overlay",
 	ShortHand:    "o",
-	Usage:        "use an overlayFS image for persistent data storage or as read-only layer of container",
+	Usage:        "use an overlayFS image for persistent data storage or as read-only layer of container, append ':ro' for a read-only layer or ':idmap' for an ID-mapped writable overlay directory",
 	EnvKeys:      []string{"OVERLAY", "OVERLAYIMAGE"},
 	Tag:          "<path>",
 }
@@ -174,6 +207,39 @@ var actionWorkdirFlag = cmdline.Flag{
 	Tag:          "<path>",
 }
 
+// --sessiondir
+var actionSessionDirFlag = cmdline.Flag{
+	ID:           "actionSessionDirFlag",
+	Value:        &sessionDirPath,
+	DefaultValue: "",
+	Name:         "sessiondir",
+	Usage:        "host directory where a disk backed session directory is created instead of a memory filesystem, directories left by killed containers are removed by the next container using it",
+	EnvKeys:      []string{"SESSIONDIR_PATH"},
+	Tag:          "<path>",
+}
+
+// --sessiondir-size
+var actionSessionDirSizeFlag = cmdline.Flag{
+	ID:           "actionSessionDirSizeFlag",
+	Value:        &sessionDirSize,
+	DefaultValue: 0,
+	Name:         "sessiondir-size",
+	Usage:        "size in MiB of the session directory memory filesystem, bounded by 'sessiondir max size' for non-root users",
+	EnvKeys:      []string{"SESSIONDIR_SIZE"},
+	Tag:          "<MiB>",
+}
+
+// --shm-size
+var actionShmSizeFlag = cmdline.Flag{
+	ID:           "actionShmSizeFlag",
+	Value:        &shmSize,
+	DefaultValue: "",
+	Name:         "shm-size",
+	Usage:        "mount a private /dev/shm tmpfs of this size (e.g. 8g), bounded by 'max tmpfs size' for non-root users",
+	EnvKeys:      []string{"SHM_SIZE"},
+	Tag:          "<size>",
+}
+
 // --disable-cache
 var actionDisableCacheFlag = cmdline.Flag{
 	ID:           "actionDisableCacheFlag",
@@ -230,6 +296,17 @@ var actionHostnameFlag = cmdline.Flag{
 	Tag:          "<name>",
 }
 
+// --domainname
+var actionDomainnameFlag = cmdline.Flag{
+	ID:           "actionDomainnameFlag",
+	Value:        &domainname,
+	DefaultValue: "",
+	Name:         "domainname",
+	Usage:        "set container domainname, qualifying the hostname in /etc/hosts",
+	EnvKeys:      []string{"DOMAINNAME"},
+	Tag:          "<name>",
+}
+
 // --network
 var actionNetworkFlag = cmdline.Flag{
 	ID:           "actionNetworkFlag",
@@ -252,6 +329,28 @@ var actionNetworkArgsFlag = cmdline.Flag{
 	Tag:          "<args>",
 }
 
+// --network-args-file
+var actionNetworkArgsFileFlag = cmdline.Flag{
+	ID:           "actionNetworkArgsFileFlag",
+	Value:        &networkArgsFile,
+	DefaultValue: "",
+	Name:         "network-args-file",
+	Usage:        "specify a JSON file with the capability arguments to pass to CNI plugins, per network",
+	EnvKeys:      []string{"NETWORK_ARGS_FILE"},
+	Tag:          "<file>",
+}
+
+// --publish
+var actionPublishFlag = cmdline.Flag{
+	ID:           "actionPublishFlag",
+	Value:        &publish,
+	DefaultValue: []string{},
+	Name:         "publish",
+	Usage:        "publish a container port on the host, as hostPort:containerPort[/protocol] (implies --net)",
+	EnvKeys:      []string{"PUBLISH"},
+	Tag:          "<port>",
+}
+
 // --dns
 var actionDNSFlag = cmdline.Flag{
 	ID:           "actionDnsFlag",
@@ -262,6 +361,80 @@ var actionDNSFlag = cmdline.Flag{
 	EnvKeys:      []string{"DNS"},
 }
 
+// --dns-search
+var actionDNSSearchFlag = cmdline.Flag{
+	ID:           "actionDnsSearchFlag",
+	Value:        &dnsSearch,
+	DefaultValue: "",
+	Name:         "dns-search",
+	Usage:        "list of DNS search domains separated by commas to add in resolv.conf",
+	EnvKeys:      []string{"DNS_SEARCH"},
+}
+
+// --dns-option
+var actionDNSOptionFlag = cmdline.Flag{
+	ID:           "actionDnsOptionFlag",
+	Value:        &dnsOptions,
+	DefaultValue: "",
+	Name:         "dns-option",
+	Usage:        "list of resolver options separated by commas to add in resolv.conf, e.g. ndots:2",
+	EnvKeys:      []string{"DNS_OPTION"},
+}
+
+// --tz
+var actionTimezoneFlag = cmdline.Flag{
+	ID:           "actionTimezoneFlag",
+	Value:        &timezone,
+	DefaultValue: "",
+	Name:         "tz",
+	Usage:        "set the container timezone, either from the host or an Area/City zone name",
+	EnvKeys:      []string{"TZ"},
+	Tag:          "<Area/City|host>",
+}
+
+// --time-offset
+var actionTimeOffsetFlag = cmdline.Flag{
+	ID:           "actionTimeOffsetFlag",
+	Value:        &timeOffsets,
+	DefaultValue: "",
+	Name:         "time-offset",
+	Usage:        "create a time namespace with offsets of the monotonic and/or boottime clocks, in seconds or as a duration, e.g. monotonic=+3600,boottime=+24h (requires Linux 5.6 or later)",
+	EnvKeys:      []string{"TIME_OFFSET"},
+	Tag:          "<clock=offset,...>",
+}
+
+// --faketime
+var actionFakeTimeFlag = cmdline.Flag{
+	ID:           "actionFakeTimeFlag",
+	Value:        &fakeTime,
+	DefaultValue: "",
+	Name:         "faketime",
+	Usage:        "start the realtime clock of the container at the given RFC3339 date, through libfaketime which must be installed in the image",
+	EnvKeys:      []string{"FAKETIME"},
+	Tag:          "<date>",
+}
+
+// --no-loopback
+var actionNoLoopbackFlag = cmdline.Flag{
+	ID:           "actionNoLoopbackFlag",
+	Value:        &noLoopback,
+	DefaultValue: false,
+	Name:         "no-loopback",
+	Usage:        "do not bring up the loopback interface in a new network namespace",
+	EnvKeys:      []string{"NO_LOOPBACK"},
+}
+
+// --join-sockets
+var actionJoinSocketsFlag = cmdline.Flag{
+	ID:           "actionJoinSocketsFlag",
+	Value:        &joinSockets,
+	DefaultValue: "",
+	Name:         "join-sockets",
+	Usage:        "bind read-write the sockets directory of a running instance, at the path where the instance has it",
+	Tag:          "<instance>",
+	EnvKeys:      []string{"JOIN_SOCKETS"},
+}
+
 // --security
 var actionSecurityFlag = cmdline.Flag{
 	ID:           "actionSecurityFlag",
@@ -272,6 +445,16 @@ var actionSecurityFlag = cmdline.Flag{
 	EnvKeys:      []string{"SECURITY"},
 }
 
+// --security-credentials
+var actionSecurityCredentialsFlag = cmdline.Flag{
+	ID:           "actionSecurityCredentialsFlag",
+	Value:        &credentials,
+	DefaultValue: []string{},
+	Name:         "security-credentials",
+	Usage:        "bind host credentials in the container: krb5, munge, ssh-agent or none (default from apptainer.conf)",
+	EnvKeys:      []string{"SECURITY_CREDENTIALS"},
+}
+
 // --apply-cgroups
 var actionApplyCgroupsFlag = cmdline.Flag{
 	ID:           "actionApplyCgroupsFlag",
@@ -282,6 +465,16 @@ var actionApplyCgroupsFlag = cmdline.Flag{
 	EnvKeys:      []string{"APPLY_CGROUPS"},
 }
 
+// --cgroups
+var actionCgroupsModeFlag = cmdline.Flag{
+	ID:           "actionCgroupsModeFlag",
+	Value:        &cgroupsMode,
+	DefaultValue: "",
+	Name:         "cgroups",
+	Usage:        "where the container cgroup is set up: create, join-job (beneath the cgroup of the calling job) or none (default from apptainer.conf)",
+	EnvKeys:      []string{"CGROUPS"},
+}
+
 // hidden flag to handle APPTAINER_CONTAINLIBS environment variable
 var actionContainLibsFlag = cmdline.Flag{
 	ID:           "actionContainLibsFlag",
@@ -334,6 +527,16 @@ var actionFakerootFlag = cmdline.Flag{
 	EnvKeys:      []string{"FAKEROOT"},
 }
 
+// --fakeroot-db
+var actionFakerootDBFlag = cmdline.Flag{
+	ID:           "actionFakerootDBFlag",
+	Value:        &fakerootDB,
+	DefaultValue: "",
+	Name:         "fakeroot-db",
+	Usage:        "with --fakeroot using the fakeroot command and a sandbox image, keep the ownership and permissions set in the container in this database file across runs (a convenience, it doesn't protect the files)",
+	EnvKeys:      []string{"FAKEROOT_DB"},
+}
+
 // -e|--cleanenv
 var actionCleanEnvFlag = cmdline.Flag{
 	ID:           "actionCleanEnvFlag",
@@ -345,6 +548,16 @@ var actionCleanEnvFlag = cmdline.Flag{
 	EnvKeys:      []string{"CLEANENV"},
 }
 
+// --keep-locale
+var actionKeepLocaleFlag = cmdline.Flag{
+	ID:           "actionKeepLocaleFlag",
+	Value:        &keepLocale,
+	DefaultValue: false,
+	Name:         "keep-locale",
+	Usage:        "keep the host LANG, LANGUAGE and LC_* environment variables with --cleanenv",
+	EnvKeys:      []string{"KEEP_LOCALE"},
+}
+
 // --compat
 var actionCompatFlag = cmdline.Flag{
 	ID:           "actionCompatFlag",
@@ -397,6 +610,26 @@ var actionNvCCLIFlag = cmdline.Flag{
 	EnvKeys:      []string{"NVCCLI"},
 }
 
+// --gpus
+var actionGPUsFlag = cmdline.Flag{
+	ID:           "actionGPUsFlag",
+	Value:        &gpus,
+	DefaultValue: "",
+	Name:         "gpus",
+	Usage:        "select the Nvidia GPUs to make available, as all, none, or a list of indexes, UUIDs and mig:<gpu>:<instance> MIG devices",
+	EnvKeys:      []string{"GPUS"},
+}
+
+// --nv-caps
+var actionNvCapsFlag = cmdline.Flag{
+	ID:           "actionNvCapsFlag",
+	Value:        &nvCaps,
+	DefaultValue: "",
+	Name:         "nv-caps",
+	Usage:        "select the Nvidia driver capabilities set up by nvidia-container-cli, e.g. compute,video",
+	EnvKeys:      []string{"NV_CAPS"},
+}
+
 // --rocm flag to automatically bind
 var actionRocmFlag = cmdline.Flag{
 	ID:           "actionRocmFlag",
@@ -428,6 +661,27 @@ var actionWritableTmpfsFlag = cmdline.Flag{
 	EnvKeys:      []string{"WRITABLE_TMPFS"},
 }
 
+// --read-only-root
+var actionReadOnlyRootFlag = cmdline.Flag{
+	ID:           "actionReadOnlyRootFlag",
+	Value:        &readOnlyRoot,
+	DefaultValue: false,
+	Name:         "read-only-root",
+	Usage:        "keep the container root file system read-only, even with a writable overlay, except for --writable-path destinations",
+	EnvKeys:      []string{"READ_ONLY_ROOT"},
+}
+
+// --writable-path
+var actionWritablePathFlag = cmdline.Flag{
+	ID:           "actionWritablePathFlag",
+	Value:        &writablePaths,
+	DefaultValue: []string{},
+	Name:         "writable-path",
+	Usage:        "container path remaining writable through the writable overlay with --read-only-root (can be specified multiple times)",
+	EnvKeys:      []string{"WRITABLE_PATH"},
+	Tag:          "<path>",
+}
+
 // --no-home
 var actionNoHomeFlag = cmdline.Flag{
 	ID:           "actionNoHomeFlag",
@@ -458,6 +712,26 @@ var actionNoInitFlag = cmdline.Flag{
 	EnvKeys:      []string{"NOSHIMINIT"},
 }
 
+// --pty
+var actionPtyFlag = cmdline.Flag{
+	ID:           "actionPtyFlag",
+	Value:        &usePty,
+	DefaultValue: false,
+	Name:         "pty",
+	Usage:        "allocate a pseudo-terminal for the container process (default when standard input and output are terminals)",
+	EnvKeys:      []string{"PTY"},
+}
+
+// --no-pty
+var actionNoPtyFlag = cmdline.Flag{
+	ID:           "actionNoPtyFlag",
+	Value:        &noPty,
+	DefaultValue: false,
+	Name:         "no-pty",
+	Usage:        "do NOT allocate a pseudo-terminal for the container process",
+	EnvKeys:      []string{"NO_PTY"},
+}
+
 // hidden flag to disable nvidia bindings when 'always use nv = yes'
 var actionNoNvidiaFlag = cmdline.Flag{
 	ID:           "actionNoNvidiaFlag",
@@ -601,6 +875,28 @@ var actionEnvFileFlag = cmdline.Flag{
 	EnvKeys:      []string{"ENV_FILE"},
 }
 
+// --preserve-env
+var actionPreserveEnvFlag = cmdline.Flag{
+	ID:           "actionPreserveEnvFlag",
+	Value:        &preserveEnv,
+	DefaultValue: []string{},
+	Name:         "preserve-env",
+	Usage:        "keep host environment variables matching a comma separated list of names or glob patterns with --cleanenv",
+	EnvKeys:      []string{"PRESERVE_ENV"},
+	Tag:          "<name>",
+}
+
+// --unset-env
+var actionUnsetEnvFlag = cmdline.Flag{
+	ID:           "actionUnsetEnvFlag",
+	Value:        &unsetEnv,
+	DefaultValue: []string{},
+	Name:         "unset-env",
+	Usage:        "remove environment variables matching a name or glob pattern from the container, after all other environment sources",
+	EnvKeys:      []string{"UNSET_ENV"},
+	Tag:          "<name>",
+}
+
 // --no-umask
 var actionNoUmaskFlag = cmdline.Flag{
 	ID:           "actionNoUmask",
@@ -611,6 +907,28 @@ var actionNoUmaskFlag = cmdline.Flag{
 	EnvKeys:      []string{"NO_UMASK"},
 }
 
+// --umask
+var actionUmaskFlag = cmdline.Flag{
+	ID:           "actionUmaskFlag",
+	Value:        &umask,
+	DefaultValue: "",
+	Name:         "umask",
+	Usage:        "set the umask of the container process, in octal (default from 'container umask' in apptainer.conf, or the current umask)",
+	EnvKeys:      []string{"UMASK"},
+	Tag:          "<mask>",
+}
+
+// --groups
+var actionGroupsFlag = cmdline.Flag{
+	ID:           "actionGroupsFlag",
+	Value:        &groups,
+	DefaultValue: "",
+	Name:         "groups",
+	Usage:        "supplementary groups of the container process: keep, none, or a comma separated list of group names or IDs (default from 'container groups' in apptainer.conf)",
+	EnvKeys:      []string{"GROUPS"},
+	Tag:          "<keep|none|g1,g2>",
+}
+
 // --no-eval
 var actionNoEvalFlag = cmdline.Flag{
 	ID:           "actionNoEval",
@@ -772,6 +1090,46 @@ var actionIgnoreSubuidFlag = cmdline.Flag{
 	Hidden:       true,
 }
 
+// --no-nesting-autodetect
+var actionNoNestingAutodetectFlag = cmdline.Flag{
+	ID:           "actionNoNestingAutodetectFlag",
+	Value:        &noNestingAutodetect,
+	DefaultValue: false,
+	Name:         "no-nesting-autodetect",
+	Usage:        "do not adapt options when running inside another container",
+	EnvKeys:      []string{"NO_NESTING_AUTODETECT"},
+}
+
+// --dry-run
+var actionDryRunFlag = cmdline.Flag{
+	ID:           "actionDryRunFlag",
+	Value:        &dryRun,
+	DefaultValue: false,
+	Name:         "dry-run",
+	Usage:        "print the planned container configuration (mounts, namespaces, environment, cgroups, security) without running the container",
+	EnvKeys:      []string{"DRY_RUN"},
+}
+
+// --squashfuse-threads
+var actionSquashfuseThreadsFlag = cmdline.Flag{
+	ID:           "actionSquashfuseThreadsFlag",
+	Value:        &squashThreads,
+	DefaultValue: 0,
+	Name:         "squashfuse-threads",
+	Usage:        "number of threads used by squashfuse to mount images, 1 selects the single-threaded mode (default from 'squashfuse threads' in apptainer.conf)",
+	EnvKeys:      []string{"SQUASHFUSE_THREADS"},
+	Tag:          "<N>",
+}
+
+// --json
+var actionDryRunJSONFlag = cmdline.Flag{
+	ID:           "actionDryRunJSONFlag",
+	Value:        &dryRunJSON,
+	DefaultValue: false,
+	Name:         "json",
+	Usage:        "print the --dry-run configuration in JSON format",
+}
+
 // --ignore-fakeroot-command
 var actionIgnoreFakerootCommand = cmdline.Flag{
 	ID:           "actionIgnoreFakerootCommandFlag",
@@ -816,8 +1174,8 @@ func init() {
 		actionsCmd := cmdManager.GetCmdGroup("actions")
 
 		if instanceStartCmd != nil {
-			cmdManager.SetCmdGroup("actions_instance", ExecCmd, ShellCmd, RunCmd, TestCmd, instanceStartCmd, instanceRunCmd)
-			cmdManager.RegisterFlagForCmd(&actionBootFlag, instanceStartCmd, instanceRunCmd)
+			cmdManager.SetCmdGroup("actions_instance", ExecCmd, ShellCmd, RunCmd, TestCmd, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+			cmdManager.RegisterFlagForCmd(&actionBootFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
 		} else {
 			cmdManager.SetCmdGroup("actions_instance", actionsCmd...)
 		}
@@ -827,6 +1185,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionAllowSetuidFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionAppFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionApplyCgroupsFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionCgroupsModeFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionBindFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionCleanEnvFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionCompatFlag, actionsInstanceCmd...)
@@ -835,25 +1194,36 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionContainLibsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionDisableCacheFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionDNSFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionDNSSearchFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionDNSOptionFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionDropCapsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionFakerootFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionFuseMountFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionHomeFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionHostnameFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionDomainnameFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionIpcNamespaceFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionKeepLocaleFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionPreserveEnvFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionUnsetEnvFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionJoinSocketsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionKeepPrivsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionMountFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNetNamespaceFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNetworkArgsFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionNetworkArgsFileFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNetworkFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNoHomeFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNoMountFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNoInitFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionNoLoopbackFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNoNvidiaFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNoRocmFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNoPrivsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNvidiaFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNvCCLIFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionGPUsFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionNvCapsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionRocmFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionOverlayFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&commonPromptForPassphraseFlag, actionsInstanceCmd...)
@@ -861,24 +1231,43 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionPidNamespaceFlag, actionsCmd...)
 		cmdManager.RegisterFlagForCmd(&actionCwdFlag, actionsCmd...)
 		cmdManager.RegisterFlagForCmd(&actionPwdFlag, actionsCmd...)
+		cmdManager.RegisterFlagForCmd(&actionPtyFlag, actionsCmd...)
+		cmdManager.RegisterFlagForCmd(&actionNoPtyFlag, actionsCmd...)
 		cmdManager.RegisterFlagForCmd(&actionScratchFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionSecurityFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionSecurityCredentialsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionShellFlag, ShellCmd)
 		cmdManager.RegisterFlagForCmd(&actionTmpDirFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionTimezoneFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionTimeOffsetFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionFakeTimeFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionUserNamespaceFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionUtsNamespaceFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionWorkdirFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionSessionDirFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionSessionDirSizeFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionShmSizeFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionSquashfuseThreadsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionWritableFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionWritableTmpfsFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionPublishFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionReadOnlyRootFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionWritablePathFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&commonOldNoHTTPSFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&dockerLoginFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&netLoginFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&netUsernameFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&netPasswordFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&netTokenFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&dockerHostFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionEnvFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionEnvFileFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNoUmaskFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionUmaskFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionGroupsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNoEvalFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionBlkioWeightFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionBlkioWeightDeviceFlag, actionsInstanceCmd...)
@@ -893,7 +1282,11 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionPidsLimitFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionUnsquashFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionIgnoreSubuidFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionNoNestingAutodetectFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionDryRunFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionDryRunJSONFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionIgnoreFakerootCommand, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionFakerootDBFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionIgnoreUsernsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionUnderlayFlag, actionsInstanceCmd...)
 	})
@@ -24,10 +24,14 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/client/oci"
 	"github.com/apptainer/apptainer/internal/pkg/client/oras"
 	"github.com/apptainer/apptainer/internal/pkg/client/shub"
+	"github.com/apptainer/apptainer/internal/pkg/client/urihandler"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/launch"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/internal/pkg/util/uri"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 )
 
@@ -40,6 +44,8 @@ func getCacheHandle(cfg cache.Config) *cache.Handle {
 	h, err := cache.New(cache.Config{
 		ParentDir: env.GetenvLegacy(envKey, envKey),
 		Disable:   cfg.Disable,
+		MaxSize:   getCacheMaxSize(),
+		Offline:   offline,
 	})
 	if err != nil {
 		sylog.Fatalf("Failed to create an image cache handle: %s", err)
@@ -48,6 +54,47 @@ func getCacheHandle(cfg cache.Config) *cache.Handle {
 	return h
 }
 
+// getCacheMaxSize returns the maximum size of the cache in bytes, set by
+// the environment or else by the 'cache max size' directive.
+func getCacheMaxSize() int64 {
+	envKey := env.TrimApptainerKey(cache.MaxSizeEnv)
+	if v := env.GetenvLegacy(envKey, envKey); v != "" {
+		size, err := units.RAMInBytes(v)
+		if err != nil || size < 0 {
+			sylog.Fatalf("Invalid %s value %q", cache.MaxSizeEnv, v)
+		}
+		return size
+	}
+	if conf := apptainerconf.GetCurrentConfig(); conf != nil {
+		return int64(conf.CacheMaxSize) * 1024 * 1024
+	}
+	return 0
+}
+
+// gpuCacheDir returns the directory caching the host GPU files resolved
+// for --nv and --rocm, an empty string if they aren't used or the cache is
+// disabled.
+func gpuCacheDir() string {
+	useGPU := nvidia || nvCCLI || rocm
+	if conf := apptainerconf.GetCurrentConfig(); conf != nil {
+		useGPU = useGPU || (conf.AlwaysUseNv && !noNvidia) || (conf.AlwaysUseRocm && !noRocm)
+	}
+	if !useGPU {
+		return ""
+	}
+	return getCacheHandle(cache.Config{Disable: disableCache}).GPUCacheDir()
+}
+
+// rootfsCacheDir returns the directory caching the root filesystems
+// extracted from tar archives, an empty string if the image isn't a file
+// or the cache is disabled.
+func rootfsCacheDir(image string) string {
+	if !fs.IsFile(image) {
+		return ""
+	}
+	return getCacheHandle(cache.Config{Disable: disableCache}).RootfsCacheDir()
+}
+
 // actionPreRun will run replaceURIWithImage and will also do the proper path unsetting
 func actionPreRun(cmd *cobra.Command, args []string) {
 	// For compatibility - we still set USER_PATH so it will be visible in the
@@ -58,7 +105,12 @@ func actionPreRun(cmd *cobra.Command, args []string) {
 
 	os.Setenv("IMAGE_ARG", args[0])
 
-	replaceURIWithImage(cmd.Context(), cmd, args)
+	if args[0] == stdinImageArg {
+		args[0] = handleStdinImage(cmd, tmpDir)
+	} else {
+		adoptStdinImage(args[0])
+		replaceURIWithImage(cmd.Context(), cmd, args)
+	}
 
 	// --compat infers other options that give increased OCI / Docker compatibility
 	// Excludes uts/user/net namespaces as these are restrictive for many Apptainer
@@ -78,11 +130,18 @@ func handleOCI(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command,
 		sylog.Fatalf("While creating Docker credentials: %v", err)
 	}
 
+	certDir, cleanup, err := getRegistryCertDir(pullFrom)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
 	pullOpts := oci.PullOptions{
 		TmpDir:     tmpDir,
 		OciAuth:    ociAuth,
 		DockerHost: dockerHost,
 		NoHTTPS:    noHTTPS,
+		CertDir:    certDir,
 	}
 
 	return oci.Pull(ctx, imgCache, pullFrom, pullOpts)
@@ -93,7 +152,12 @@ func handleOras(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command,
 	if err != nil {
 		return "", fmt.Errorf("while creating docker credentials: %v", err)
 	}
-	return oras.Pull(ctx, imgCache, pullFrom, tmpDir, ociAuth, noHTTPS)
+	certDir, cleanup, err := getRegistryCertDir(pullFrom)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	return oras.Pull(ctx, imgCache, pullFrom, tmpDir, ociAuth, noHTTPS, certDir)
 }
 
 func handleLibrary(ctx context.Context, imgCache *cache.Handle, pullFrom string) (string, error) {
@@ -123,8 +187,24 @@ func handleShub(ctx context.Context, imgCache *cache.Handle, pullFrom string) (s
 	return shub.Pull(ctx, imgCache, pullFrom, tmpDir, noHTTPS)
 }
 
-func handleNet(ctx context.Context, imgCache *cache.Handle, pullFrom string) (string, error) {
-	return net.Pull(ctx, imgCache, pullFrom, tmpDir)
+func handleNet(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command, pullFrom string) (string, error) {
+	auth, err := makeNetCredentials(cmd)
+	if err != nil {
+		return "", fmt.Errorf("while reading credentials: %v", err)
+	}
+	return net.Pull(ctx, imgCache, pullFrom, tmpDir, net.Options{Auth: auth})
+}
+
+// handlePlugin pulls an image with the handler registered by a plugin
+// for the URI scheme t.
+func handlePlugin(ctx context.Context, imgCache *cache.Handle, t, pullFrom string) (string, error) {
+	h, err := urihandler.Get(t)
+	if err != nil {
+		return "", err
+	} else if h == nil {
+		sylog.Fatalf("Unsupported transport type: %s", t)
+	}
+	return urihandler.Pull(ctx, imgCache, h, pullFrom, tmpDir)
 }
 
 func replaceURIWithImage(ctx context.Context, cmd *cobra.Command, args []string) {
@@ -152,16 +232,14 @@ func replaceURIWithImage(ctx context.Context, cmd *cobra.Command, args []string)
 		image, err = handleShub(ctx, imgCache, args[0])
 	case oci.IsSupported(t):
 		image, err = handleOCI(ctx, imgCache, cmd, args[0])
-	case uri.HTTP:
-		image, err = handleNet(ctx, imgCache, args[0])
-	case uri.HTTPS:
-		image, err = handleNet(ctx, imgCache, args[0])
+	case uri.HTTP, uri.HTTPS, uri.FTP, uri.SFTP:
+		image, err = handleNet(ctx, imgCache, cmd, args[0])
 	default:
-		sylog.Fatalf("Unsupported transport type: %s", t)
+		image, err = handlePlugin(ctx, imgCache, t, args[0])
 	}
 
 	if err != nil {
-		sylog.Fatalf("Unable to handle %s uri: %v", args[0], err)
+		fatalError(err, "Unable to handle %s uri: %v", args[0], err)
 	}
 
 	args[0] = image
@@ -176,7 +254,7 @@ var ExecCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		a := append([]string{"/.singularity.d/actions/exec"}, args[1:]...)
 		if err := launchContainer(cmd, args[0], a, ""); err != nil {
-			sylog.Fatalf("%s", err)
+			fatalError(err, "%s", err)
 		}
 	},
 
@@ -199,7 +277,7 @@ var ShellCmd = &cobra.Command{
 
 		a := []string{"/.singularity.d/actions/shell"}
 		if err := launchContainer(cmd, args[0], a, ""); err != nil {
-			sylog.Fatalf("%s", err)
+			fatalError(err, "%s", err)
 		}
 	},
 
@@ -218,7 +296,7 @@ var RunCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		a := append([]string{"/.singularity.d/actions/run"}, args[1:]...)
 		if err := launchContainer(cmd, args[0], a, ""); err != nil {
-			sylog.Fatalf("%s", err)
+			fatalError(err, "%s", err)
 		}
 	},
 
@@ -237,7 +315,7 @@ var TestCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		a := append([]string{"/.singularity.d/actions/test"}, args[1:]...)
 		if err := launchContainer(cmd, args[0], a, ""); err != nil {
-			sylog.Fatalf("%s", err)
+			fatalError(err, "%s", err)
 		}
 	},
 
@@ -248,6 +326,10 @@ var TestCmd = &cobra.Command{
 }
 
 func launchContainer(cmd *cobra.Command, image string, args []string, instanceName string) error {
+	// the image read from stdin is removed by the engine once the
+	// container is started
+	defer removeStdinImage()
+
 	ns := launch.Namespaces{
 		User: userNamespace,
 		UTS:  utsNamespace,
@@ -273,53 +355,87 @@ func launchContainer(cmd *cobra.Command, image string, args []string, instanceNa
 	opts := []launch.Option{
 		launch.OptWritable(isWritable),
 		launch.OptWritableTmpfs(isWritableTmpfs),
+		launch.OptReadOnlyRoot(readOnlyRoot, writablePaths),
 		launch.OptOverlayPaths(overlayPath),
 		launch.OptScratchDirs(scratchPath),
 		launch.OptWorkDir(workdirPath),
+		launch.OptSessionDir(sessionDirPath, sessionDirSize),
 		launch.OptHome(
 			homePath,
 			cmd.Flag(actionHomeFlag.Name).Changed,
 			noHome,
 		),
 		launch.OptMounts(bindPaths, mounts, fuseMount),
+		launch.OptShmSize(shmSize),
 		launch.OptNoMount(noMount),
 		launch.OptNvidia(nvidia, nvCCLI),
+		launch.OptGPUs(gpus, nvCaps),
 		launch.OptNoNvidia(noNvidia),
 		launch.OptRocm(rocm),
 		launch.OptNoRocm(noRocm),
 		launch.OptContainLibs(containLibsPath),
 		launch.OptEnv(apptainerEnv, apptainerEnvFile, isCleanEnv),
+		launch.OptKeepLocale(keepLocale),
+		launch.OptPreserveEnv(preserveEnv),
+		launch.OptUnsetEnv(unsetEnv),
 		launch.OptNoEval(noEval),
 		launch.OptNamespaces(ns),
 		launch.OptNetwork(network, networkArgs),
+		launch.OptNetworkArgsFile(networkArgsFile),
+		launch.OptPublish(publish),
 		launch.OptHostname(hostname),
+		launch.OptDomainname(domainname),
 		launch.OptDNS(dns),
+		launch.OptDNSSearch(dnsSearch, dnsOptions),
+		launch.OptTimezone(timezone),
+		launch.OptTimeOffsets(timeOffsets),
+		launch.OptFakeTime(fakeTime),
+		launch.OptNoLoopback(noLoopback),
 		launch.OptCaps(addCaps, dropCaps),
 		launch.OptAllowSUID(allowSUID),
 		launch.OptKeepPrivs(keepPrivs),
 		launch.OptNoPrivs(noPrivs),
 		launch.OptSecurity(security),
+		launch.OptSecurityCredentials(credentials),
 		launch.OptNoUmask(noUmask),
+		launch.OptUmask(umask),
+		launch.OptGroups(groups),
 		launch.OptCgroupsJSON(cgJSON),
+		launch.OptCgroupsMode(cgroupsMode),
 		launch.OptConfigFile(configurationFile),
 		launch.OptShellPath(shellPath),
 		launch.OptCwdPath(cwdPath),
 		launch.OptFakeroot(isFakeroot),
 		launch.OptBoot(isBoot),
+		launch.OptInstanceScript(instanceScript),
+		launch.OptInstanceLogRotation(instanceLogMaxBytes, instanceLogMaxFiles),
+		launch.OptInstanceAddress(instanceIP, instanceMAC),
+		launch.OptNotifyDir(instanceNotifyDir),
+		launch.OptSocketsPath(instanceSocketsPath),
+		launch.OptJoinSockets(joinSockets),
 		launch.OptNoInit(noInit),
+		launch.OptPty(usePty, noPty),
 		launch.OptContain(isContained),
 		launch.OptContainAll(isContainAll),
 		launch.OptAppName(appName),
 		launch.OptKeyInfo(ki),
 		launch.OptCacheDisabled(disableCache),
+		launch.OptGPUCacheDir(gpuCacheDir()),
+		launch.OptRootfsCacheDir(rootfsCacheDir(image)),
+		launch.OptDeleteImageDir(stdinImageDir),
 		launch.OptDMTCPLaunch(dmtcpLaunch),
 		launch.OptDMTCPRestart(dmtcpRestart),
 		launch.OptUnsquash(unsquash),
+		launch.OptSquashfuseThreads(squashThreads),
 		launch.OptIgnoreSubuid(ignoreSubuid),
 		launch.OptIgnoreFakerootCmd(ignoreFakerootCmd),
+		launch.OptFakerootDB(fakerootDB),
 		launch.OptIgnoreUserns(ignoreUserns),
+		launch.OptNoNestingAutodetect(noNestingAutodetect),
+		launch.OptDryRun(dryRun, dryRunJSON),
 		launch.OptUseBuildConfig(useBuildConfig),
 		launch.OptTmpDir(tmpDir),
+		launch.OptTmpDirCandidates(tmpDirCandidates(cmd)),
 		launch.OptUnderlay(underlay),
 	}
 
@@ -0,0 +1,234 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/inspect"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// -j|--json
+var appsJSON bool
+
+var appsJSONFlag = cmdline.Flag{
+	ID:           "appsJSONFlag",
+	Value:        &appsJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the apps with their labels, environment and size in json format",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(AppsCmd)
+		cmdManager.RegisterFlagForCmd(&appsJSONFlag, AppsCmd)
+	})
+}
+
+// appInfo is the description of a SCIF app listed by the apps command.
+type appInfo struct {
+	Name        string            `json:"name"`
+	Summary     string            `json:"summary"`
+	Labels      map[string]string `json:"labels"`
+	Environment map[string]string `json:"environment"`
+	// Size is the disk usage in bytes of the app directory, null if it
+	// could not be determined
+	Size *int64 `json:"size"`
+}
+
+// appSummary returns the first line of the help of an app, or the value
+// of a summary or description label if it has no help.
+func appSummary(app *inspect.AppAttributes) string {
+	for _, line := range strings.Split(app.Helpfile, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	keys := make([]string, 0, len(app.Labels))
+	for k := range app.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, suffix := range []string{"summary", "description"} {
+		for _, k := range keys {
+			l := strings.ToLower(k)
+			if l == suffix || strings.HasSuffix(l, "."+suffix) {
+				return strings.TrimSpace(app.Labels[k])
+			}
+		}
+	}
+	return ""
+}
+
+// imageApps returns the apps of the image src sorted by name, along with
+// their size if withSize is true.
+func imageApps(src string, withSize bool) ([]appInfo, error) {
+	if isOCIURI(src) {
+		// OCI images have no SCIF apps
+		return []appInfo{}, nil
+	}
+
+	img, err := image.Init(src, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %s", src, err)
+	}
+	defer img.File.Close()
+
+	c := newCommand(true, "", img)
+	c.addLabelsCommand()
+	c.addHelpCommand()
+	c.addEnvironmentCommand()
+	metadata, err := c.getMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	var sizes map[string]int64
+	if withSize {
+		if sizes, err = appSizes(img); err != nil {
+			sylog.Warningf("Could not determine the size of apps: %s", err)
+		}
+	}
+
+	names := c.appNames()
+	apps := make([]appInfo, 0, len(names))
+	for _, name := range names {
+		attrs := metadata.Attributes.Apps[name]
+		if attrs == nil {
+			attrs = &inspect.AppAttributes{}
+		}
+		app := appInfo{
+			Name:        name,
+			Summary:     appSummary(attrs),
+			Labels:      attrs.Labels,
+			Environment: attrs.Environment,
+		}
+		if size, ok := sizes[name]; ok {
+			app.Size = &size
+		}
+		apps = append(apps, app)
+	}
+	return apps, nil
+}
+
+// appSizes returns the disk usage in bytes of the app directories of the
+// image, computed directly for a sandbox or with du in the container.
+func appSizes(img *image.Image) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+
+	if img.Type == image.SANDBOX {
+		dirs, err := filepath.Glob(filepath.Join(img.Path, "scif", "apps", "*", "scif"))
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			root := filepath.Dir(dir)
+			var size int64
+			err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				fi, err := d.Info()
+				if err != nil {
+					return err
+				}
+				if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+					size += st.Blocks * 512
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			sizes[filepath.Base(root)] = size
+		}
+		return sizes, nil
+	}
+
+	script := `for app in /scif/apps/*; do if [ -d "$app/scif" ]; then du -sk "$app"; fi; done`
+	out, err := apptainerExec(img.Path, []string{"/bin/sh", "-c", script})
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes[filepath.Base(fields[1])] = kb * 1024
+	}
+	return sizes, nil
+}
+
+// writeApps writes the apps as a table of names and summaries, or in
+// JSON format.
+func writeApps(w io.Writer, apps []appInfo, formatJSON bool) error {
+	if formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(apps)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "APP\tSUMMARY"); err != nil {
+		return err
+	}
+	for _, app := range apps {
+		summary := app.Summary
+		if summary == "" {
+			summary = "-"
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\n", app.Name, summary); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// AppsCmd represents the apps command.
+var AppsCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+
+	Use:     docs.AppsUse,
+	Short:   docs.AppsShort,
+	Long:    docs.AppsLong,
+	Example: docs.AppsExample,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		apps, err := imageApps(args[0], appsJSON)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		if err := writeApps(os.Stdout, apps, appsJSON); err != nil {
+			sylog.Fatalf("Could not write apps: %s", err)
+		}
+	},
+}
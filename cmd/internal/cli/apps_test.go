@@ -0,0 +1,214 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/apptainer/pkg/inspect"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+)
+
+// makeAppsSandbox creates a sandbox image with apps sharing a name
+// prefix, and apps with missing metadata sections.
+func makeAppsSandbox(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		".singularity.d/labels.json":                 `{"org.label": "sandbox"}`,
+		"scif/apps/tool/scif/labels.json":            `{"org.label": "tool"}`,
+		"scif/apps/tool/scif/runscript":              "#!/bin/sh\necho tool",
+		"scif/apps/tool/scif/runscript.help":         "\n  Run the tool\nwith more details",
+		"scif/apps/tool/scif/env/90-environment.sh":  "#!/bin/sh\nexport TOOL=1",
+		"scif/apps/tool/bin/tool":                    strings.Repeat("x", 8192),
+		"scif/apps/tool2/scif/labels.json":           `{"org.opencontainers.image.description": "Second tool"}`,
+		"scif/apps/tool2/scif/env/90-environment.sh": "#!/bin/sh\nexport TOOL=2",
+		"scif/apps/tools/scif/runscript.help":        "",
+		"scif/apps/tools/scif/labels.json":           `{"Summary": "All the tools"}`,
+		"scif/apps/empty/scif/.keep":                 "",
+		"scif/apps/notanapp/bin/script":              "#!/bin/sh",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestImageApps(t *testing.T) {
+	useragent.InitValue("apptainer", "3.0.0")
+	sandbox := makeAppsSandbox(t)
+
+	apps, err := imageApps(sandbox, true)
+	if err != nil {
+		t.Fatalf("while listing apps: %s", err)
+	}
+
+	var names []string
+	summaries := make(map[string]string)
+	for _, app := range apps {
+		names = append(names, app.Name)
+		summaries[app.Name] = app.Summary
+		if app.Size == nil {
+			t.Errorf("no size for app %s", app.Name)
+		}
+	}
+	if want := []string{"empty", "tool", "tool2", "tools"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got apps %v, want %v", names, want)
+	}
+	wantSummaries := map[string]string{
+		"empty": "",
+		"tool":  "Run the tool",
+		"tool2": "Second tool",
+		"tools": "All the tools",
+	}
+	if !reflect.DeepEqual(summaries, wantSummaries) {
+		t.Errorf("got summaries %v, want %v", summaries, wantSummaries)
+	}
+
+	// the metadata of apps sharing a name prefix must not be mixed
+	tool, tool2 := apps[1], apps[2]
+	if tool.Labels["org.label"] != "tool" || len(tool.Labels) != 1 {
+		t.Errorf("unexpected labels %v for app tool", tool.Labels)
+	}
+	if len(tool.Environment) != 1 || len(tool2.Environment) != 1 {
+		t.Errorf("unexpected environment %v for app tool and %v for app tool2", tool.Environment, tool2.Environment)
+	}
+	if *tool.Size < 8192 || *tool.Size <= *apps[0].Size {
+		t.Errorf("unexpected size %d for app tool", *tool.Size)
+	}
+
+	var out bytes.Buffer
+	if err := writeApps(&out, apps, false); err != nil {
+		t.Fatalf("while writing apps: %s", err)
+	}
+	want := "APP      SUMMARY\n" +
+		"empty    -\n" +
+		"tool     Run the tool\n" +
+		"tool2    Second tool\n" +
+		"tools    All the tools\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestInspectApp(t *testing.T) {
+	useragent.InitValue("apptainer", "3.0.0")
+	sandbox := makeAppsSandbox(t)
+
+	tests := []struct {
+		name    string
+		app     string
+		labels  map[string]string
+		wantErr string
+	}{
+		{
+			name:   "PrefixOfOtherApps",
+			app:    "tool",
+			labels: map[string]string{"org.label": "tool"},
+		},
+		{
+			name:   "SharedPrefix",
+			app:    "tool2",
+			labels: map[string]string{"org.opencontainers.image.description": "Second tool"},
+		},
+		{
+			name:   "MissingSections",
+			app:    "empty",
+			labels: map[string]string{},
+		},
+		{
+			name:    "MissingApp",
+			app:     "tool3",
+			wantErr: `no app "tool3": available apps are empty, tool, tool2, tools`,
+		},
+		{
+			name:    "NotAnApp",
+			app:     "notanapp",
+			wantErr: `no app "notanapp"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setInspectFlags(t, func() { appName, labels, environment = tt.app, true, true })
+
+			metadata, err := inspectImage(context.Background(), sandbox)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("while inspecting app %s: %s", tt.app, err)
+			}
+			if len(metadata.Attributes.Apps) != 1 {
+				t.Fatalf("unexpected apps %v", metadata.Attributes.Apps)
+			}
+			app := metadata.Attributes.Apps[tt.app]
+			if app == nil {
+				t.Fatalf("app %s not inspected", tt.app)
+			}
+			if !reflect.DeepEqual(app.Labels, tt.labels) {
+				t.Errorf("got labels %v, want %v", app.Labels, tt.labels)
+			}
+		})
+	}
+
+	setInspectFlags(t, func() { appName = "tool" })
+	if _, err := inspectImage(context.Background(), "oci:"+t.TempDir()); err == nil || !strings.Contains(err.Error(), "the image has no apps") {
+		t.Errorf("unexpected error for an app of an OCI image: %v", err)
+	}
+}
+
+func TestAppSummary(t *testing.T) {
+	tests := []struct {
+		name string
+		app  inspect.AppAttributes
+		want string
+	}{
+		{
+			name: "Empty",
+		},
+		{
+			name: "Help",
+			app:  inspect.AppAttributes{Helpfile: "\n\n  First line  \nSecond line", Labels: map[string]string{"summary": "label"}},
+			want: "First line",
+		},
+		{
+			name: "SummaryBeforeDescription",
+			app:  inspect.AppAttributes{Labels: map[string]string{"a.description": "description", "b.summary": "summary"}},
+			want: "summary",
+		},
+		{
+			name: "UnrelatedLabels",
+			app:  inspect.AppAttributes{Labels: map[string]string{"nodescription": "no", "author": "me"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := appSummary(&tt.app); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
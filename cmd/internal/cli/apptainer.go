@@ -13,6 +13,7 @@ package cli
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -26,12 +27,15 @@ import (
 	"text/template"
 
 	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/client/net"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	"github.com/apptainer/apptainer/internal/pkg/remote"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	clicallback "github.com/apptainer/apptainer/pkg/plugin/callback/cli"
 	"github.com/apptainer/apptainer/pkg/syfs"
@@ -49,6 +53,10 @@ import (
 // for commands/flags registration.
 var cmdInits = make([]func(*cmdline.CommandManager), 0)
 
+// preRunHooks holds the functions called with the command to
+// execute once the configuration is initialized.
+var preRunHooks = make([]func(*cobra.Command), 0)
+
 // CurrentUser holds the current user account information
 var CurrentUser = getCurrentUser()
 
@@ -60,6 +68,9 @@ var (
 	dockerLogin      bool
 	dockerHost       string
 
+	netAuth  net.Auth
+	netLogin bool
+
 	encryptionPEMPath   string
 	promptForPassphrase bool
 	forceOverwrite      bool
@@ -75,6 +86,11 @@ var (
 	silent  bool
 	verbose bool
 	quiet   bool
+	offline bool
+
+	noPlugins bool
+
+	jsonErrors bool
 
 	configurationFile string
 )
@@ -122,6 +138,36 @@ var singQuietFlag = cmdline.Flag{
 	EnvKeys:      []string{"QUIET"},
 }
 
+// --offline
+var singOfflineFlag = cmdline.Flag{
+	ID:           "singOfflineFlag",
+	Value:        &offline,
+	DefaultValue: false,
+	Name:         "offline",
+	Usage:        "disable network access, images are only taken from the cache",
+	EnvKeys:      []string{"OFFLINE"},
+}
+
+// --no-plugins
+var singNoPluginsFlag = cmdline.Flag{
+	ID:           "singNoPluginsFlag",
+	Value:        &noPlugins,
+	DefaultValue: false,
+	Name:         "no-plugins",
+	Usage:        "disable the loading of all plugins, for debugging",
+	EnvKeys:      []string{"NO_PLUGINS"},
+}
+
+// --json-errors
+var singJSONErrorsFlag = cmdline.Flag{
+	ID:           "singJSONErrorsFlag",
+	Value:        &jsonErrors,
+	DefaultValue: false,
+	Name:         "json-errors",
+	Usage:        "print container startup failures as JSON error records",
+	EnvKeys:      []string{"JSON_ERRORS"},
+}
+
 // -v|--verbose
 var singVerboseFlag = cmdline.Flag{
 	ID:           "singVerboseFlag",
@@ -167,6 +213,49 @@ var dockerLoginFlag = cmdline.Flag{
 	EnvKeys:      []string{"DOCKER_LOGIN"},
 }
 
+// --net-username
+var netUsernameFlag = cmdline.Flag{
+	ID:           "netUsernameFlag",
+	Value:        &netAuth.Username,
+	DefaultValue: "",
+	Name:         "net-username",
+	Usage:        "specify a username for http(s), ftp and sftp image downloads",
+	Hidden:       true,
+	EnvKeys:      []string{"NET_USERNAME"},
+}
+
+// --net-password
+var netPasswordFlag = cmdline.Flag{
+	ID:           "netPasswordFlag",
+	Value:        &netAuth.Password,
+	DefaultValue: "",
+	Name:         "net-password",
+	Usage:        "specify a password for http(s), ftp and sftp image downloads",
+	Hidden:       true,
+	EnvKeys:      []string{"NET_PASSWORD"},
+}
+
+// --net-token
+var netTokenFlag = cmdline.Flag{
+	ID:           "netTokenFlag",
+	Value:        &netAuth.BearerToken,
+	DefaultValue: "",
+	Name:         "net-token",
+	Usage:        "specify a bearer token for http(s) image downloads",
+	Hidden:       true,
+	EnvKeys:      []string{"NET_TOKEN"},
+}
+
+// --net-login
+var netLoginFlag = cmdline.Flag{
+	ID:           "netLoginFlag",
+	Value:        &netLogin,
+	DefaultValue: false,
+	Name:         "net-login",
+	Usage:        "login interactively for http(s), ftp and sftp image downloads",
+	EnvKeys:      []string{"NET_LOGIN"},
+}
+
 // --docker-host
 var dockerHostFlag = cmdline.Flag{
 	ID:            "dockerHostFlag",
@@ -258,6 +347,18 @@ var singBuildConfigFlag = cmdline.Flag{
 	Usage:        "use configuration needed for building containers",
 }
 
+// -j|--json
+var versionJSON bool
+
+var versionJSONFlag = cmdline.Flag{
+	ID:           "versionJSONFlag",
+	Value:        &versionJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the version with the build configuration and supported features in json format",
+}
+
 func getCurrentUser() *user.User {
 	usr, err := user.Current()
 	if err != nil {
@@ -270,6 +371,10 @@ func addCmdInit(cmdInit func(*cmdline.CommandManager)) {
 	cmdInits = append(cmdInits, cmdInit)
 }
 
+func addPreRunHook(hook func(*cobra.Command)) {
+	preRunHooks = append(preRunHooks, hook)
+}
+
 func setSylogMessageLevel() {
 	var level int
 
@@ -485,6 +590,12 @@ func persistentPreRun(cmd *cobra.Command, args []string) error {
 	setSylogMessageLevel()
 	sylog.Debugf("Apptainer version: %s", buildcfg.PACKAGE_VERSION)
 
+	if offline {
+		setOffline()
+	}
+
+	starter.SetJSONErrors(jsonErrors)
+
 	if cmd.CalledAs() == "confgen" {
 		// This command generates the configuration so it may
 		// not yet be there
@@ -573,6 +684,12 @@ func Init(loadPlugins bool) {
 		if err := persistentPreRun(cmd, args); err != nil {
 			sylog.Fatalf("While initializing: %s", err)
 		}
+		for _, hook := range preRunHooks {
+			hook(cmd)
+		}
+		if loadPlugins {
+			runCommandPreRunCallbacks(cmd, args)
+		}
 		return nil
 	}
 
@@ -581,10 +698,14 @@ func Init(loadPlugins bool) {
 	cmdManager.RegisterFlagForCmd(&singSilentFlag, apptainerCmd)
 	cmdManager.RegisterFlagForCmd(&singQuietFlag, apptainerCmd)
 	cmdManager.RegisterFlagForCmd(&singVerboseFlag, apptainerCmd)
+	cmdManager.RegisterFlagForCmd(&singOfflineFlag, apptainerCmd)
+	cmdManager.RegisterFlagForCmd(&singNoPluginsFlag, apptainerCmd)
+	cmdManager.RegisterFlagForCmd(&singJSONErrorsFlag, apptainerCmd)
 	cmdManager.RegisterFlagForCmd(&singConfigFileFlag, apptainerCmd)
 	cmdManager.RegisterFlagForCmd(&singBuildConfigFlag, apptainerCmd)
 
 	cmdManager.RegisterCmd(VersionCmd)
+	cmdManager.RegisterFlagForCmd(&versionJSONFlag, VersionCmd)
 
 	// register all others commands/flags
 	for _, cmdInit := range cmdInits {
@@ -603,6 +724,8 @@ func Init(loadPlugins bool) {
 		}
 	}
 
+	registerCompletions(apptainerCmd)
+
 	// any error reported by command manager is considered as fatal
 	cliErrors := len(cmdManager.GetError())
 	if cliErrors > 0 {
@@ -613,6 +736,42 @@ func Init(loadPlugins bool) {
 	}
 }
 
+// runCommandPreRunCallbacks executes the plugin callbacks acting on the
+// command cmd about to be executed, any plugin error being fatal.
+func runCommandPreRunCallbacks(cmd *cobra.Command, args []string) {
+	callbackType := (clicallback.CommandPreRun)(nil)
+	entries, err := plugin.LoadCallbackEntries(callbackType)
+	if err != nil {
+		sylog.Fatalf("Failed to load plugins callbacks '%T': %s", callbackType, err)
+	}
+	for _, e := range entries {
+		if err := e.Callback.(clicallback.CommandPreRun)(cmd, args); err != nil {
+			sylog.Fatalf("Plugin %s: %s", e.Plugin, err)
+		}
+	}
+}
+
+// noPluginsRequested returns whether the loading of plugins is disabled
+// with the global --no-plugins flag or the APPTAINER_NO_PLUGINS environment
+// variable.
+func noPluginsRequested(args []string) bool {
+	if v, err := strconv.ParseBool(env.GetenvLegacy("NO_PLUGINS", "NO_PLUGINS")); err == nil && v {
+		return true
+	}
+	// only the global flags preceding the command are considered
+	for i := 1; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--no-plugins" || arg == "--no-plugins=true":
+			return true
+		case arg == "-c" || arg == "--config":
+			i++
+		case !strings.HasPrefix(arg, "-"):
+			return false
+		}
+	}
+	return false
+}
+
 // apptainerCmd is the base command when called without any subcommands
 var apptainerCmd = &cobra.Command{
 	TraverseChildren:      true,
@@ -648,6 +807,15 @@ func ExecuteApptainer() {
 		loadPlugins = !strings.HasPrefix(args[1], "plugin")
 	}
 
+	// plugins register commands and flags, --no-plugins must be
+	// handled before the command line is parsed
+	if noPluginsRequested(args) {
+		loadPlugins = false
+		plugin.DisableLoading()
+	}
+	plugin.UseUserState(syfs.PluginState())
+	plugin.UseUserConfig(syfs.PluginConf())
+
 	Init(loadPlugins)
 
 	// Setup a cancellable context that will trap Ctrl-C / SIGINT
@@ -716,6 +884,12 @@ func TraverseParentsUses(cmd *cobra.Command) string {
 var VersionCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	Run: func(cmd *cobra.Command, args []string) {
+		if versionJSON {
+			if err := apptainer.PrintVersionJSON(os.Stdout); err != nil {
+				sylog.Fatalf("Could not write version: %s", err)
+			}
+			return
+		}
 		fmt.Println(buildcfg.PACKAGE_VERSION)
 	},
 
@@ -740,6 +914,19 @@ func loadRemoteConf(filepath string) (*remote.Config, error) {
 
 // getRemote returns the remote in use or an error
 func getRemote() (*endpoint.Config, error) {
+	return getNamedRemote("")
+}
+
+// getNamedRemote returns the remote name, or the remote in use if name is
+// empty, or an error
+func getNamedRemote(name string) (*endpoint.Config, error) {
+	_, ep, err := resolveRemote(name)
+	return ep, err
+}
+
+// resolveRemote returns the name and the configuration of the remote name,
+// or of the remote in use if name is empty, or an error
+func resolveRemote(name string) (string, *endpoint.Config, error) {
 	var c *remote.Config
 
 	// try to load both remotes, check for errors, sync if both exist,
@@ -747,7 +934,10 @@ func getRemote() (*endpoint.Config, error) {
 	cSys, sysErr := loadRemoteConf(remote.SystemConfigPath)
 	cUsr, usrErr := loadRemoteConf(syfs.RemoteConf())
 	if sysErr != nil && usrErr != nil {
-		return endpoint.DefaultEndpointConfig, nil
+		if name != "" {
+			return "", nil, fmt.Errorf("%s is not a remote", name)
+		}
+		return remote.DefaultRemoteName, endpoint.DefaultEndpointConfig, nil
 	} else if sysErr != nil {
 		c = cUsr
 	} else if usrErr != nil {
@@ -755,18 +945,26 @@ func getRemote() (*endpoint.Config, error) {
 	} else {
 		// sync cUsr with system config cSys
 		if err := cUsr.SyncFrom(cSys); err != nil {
-			return nil, err
+			return "", nil, err
 		}
 		c = cUsr
 	}
 
+	if name != "" {
+		ep, err := c.GetRemote(name)
+		if err != nil {
+			return "", nil, err
+		}
+		return name, ep, refreshOIDCToken(ep, name)
+	}
+
 	ep, err := c.GetDefault()
 	if err == remote.ErrNoDefault {
 		// all remotes have been deleted, fix that by returning
 		// the default remote endpoint to avoid side effects when
 		// pulling from library
 		if len(c.Remotes) == 0 {
-			return endpoint.DefaultEndpointConfig, nil
+			return remote.DefaultRemoteName, endpoint.DefaultEndpointConfig, nil
 		}
 		// otherwise notify users about available endpoints and
 		// invite them to select one of them
@@ -776,10 +974,34 @@ func getRemote() (*endpoint.Config, error) {
 			endpoints = append(endpoints, name)
 		}
 		help += strings.Join(endpoints, ", ")
-		return nil, fmt.Errorf("no default endpoint set: %s", help)
+		return "", nil, fmt.Errorf("no default endpoint set: %s", help)
 	}
 
-	return ep, err
+	if err == nil {
+		if err := refreshOIDCToken(ep, c.DefaultRemote); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return c.DefaultRemote, ep, err
+}
+
+// refreshOIDCToken refreshes the access token of the remote ep named name,
+// if it has been obtained with an OIDC login and expired.
+func refreshOIDCToken(ep *endpoint.Config, name string) error {
+	if !ep.NeedsOIDCRefresh() {
+		return nil
+	}
+	// the OIDC tokens are only stored in the user configuration
+	token, err := apptainer.RefreshRemoteOIDCToken(syfs.RemoteConf(), name)
+	if errors.Is(err, endpoint.ErrOIDCLoginRequired) {
+		return err
+	} else if err != nil {
+		sylog.Warningf("Could not refresh the access token of remote %s: %v", name, err)
+	} else {
+		ep.Token = token
+	}
+	return nil
 }
 
 func apptainerExec(image string, args []string) (string, error) {
@@ -880,3 +1102,19 @@ func getLibraryClientConfig(uri string) (*libClient.Config, error) {
 	}
 	return libClientConfig, nil
 }
+
+// getRegistryCertDir returns the certificate directory of the current
+// remote endpoint for the registry of the image reference ref, and a
+// function removing it. The path is empty if the registry isn't associated
+// with the current endpoint.
+func getRegistryCertDir(ref string) (string, func(), error) {
+	if currentRemoteEndpoint == nil {
+		var err error
+
+		currentRemoteEndpoint, err = getRemote()
+		if err != nil {
+			return "", func() {}, fmt.Errorf("unable to load remote configuration: %v", err)
+		}
+	}
+	return currentRemoteEndpoint.RegistryCertDir(ref)
+}
@@ -13,6 +13,7 @@ import (
 	"math/rand"
 	"os"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -21,6 +22,14 @@ import (
 
 const messageLevelEnv = "APPTAINER_MESSAGELEVEL"
 
+var initOnce sync.Once
+
+// initCLI registers the commands once for all the tests, as they can't be
+// registered twice.
+func initCLI() {
+	initOnce.Do(func() { Init(false) })
+}
+
 func TestCreateConfDir(t *testing.T) {
 	// create a random name for a directory
 	// TODO - go 1.20 initializes seed randomly by default, so can drop this
@@ -48,7 +57,7 @@ func TestCreateConfDir(t *testing.T) {
 }
 
 func TestLogEnvSuite(t *testing.T) {
-	Init(false)
+	initCLI()
 
 	t.Run("TestMessageLevelEnv", func(t *testing.T) {
 		tests := []struct {
@@ -34,6 +34,7 @@ var buildArgs struct {
 	libraryURL          string
 	keyServerURL        string
 	webURL              string
+	arch                string
 	encrypt             bool
 	fakeroot            bool
 	fixPerms            bool
@@ -50,12 +51,23 @@ var buildArgs struct {
 	ignoreSubuid        bool     // Ignore /etc/subuid entries (hidden)
 	ignoreFakerootCmd   bool     // Ignore fakeroot command (hidden)
 	ignoreUserns        bool     // Ignore user namespace(hidden)
+	noNestingAutodetect bool     // Don't adapt options when running inside a container
 	remote              bool     // Remote flag(hidden, only for helpful error message)
 	buildVarArgs        []string // Variables passed to build procedure.
 	buildVarArgFile     string   // Variables file passed to build procedure.
 	buildArgsUnusedWarn bool     // Variables passed to build procedure to turn fatal error to warn.
 }
 
+// --arch
+var buildArchFlag = cmdline.Flag{
+	ID:           "buildArchFlag",
+	Value:        &buildArgs.arch,
+	DefaultValue: "",
+	Name:         "arch",
+	Usage:        "architecture of the image to build (e.g. arm64), the %post and %test sections run with binfmt_misc emulation",
+	EnvKeys:      []string{"BUILD_ARCH"},
+}
+
 // -s|--sandbox
 var buildSandboxFlag = cmdline.Flag{
 	ID:           "buildSandboxFlag",
@@ -256,6 +268,16 @@ var buildIgnoreSubuidFlag = cmdline.Flag{
 	Hidden:       true,
 }
 
+// --no-nesting-autodetect
+var buildNoNestingAutodetectFlag = cmdline.Flag{
+	ID:           "buildNoNestingAutodetectFlag",
+	Value:        &buildArgs.noNestingAutodetect,
+	DefaultValue: false,
+	Name:         "no-nesting-autodetect",
+	Usage:        "do not adapt options when running inside another container",
+	EnvKeys:      []string{"NO_NESTING_AUTODETECT"},
+}
+
 // --ignore-fakeroot-command
 var buildIgnoreFakerootCommand = cmdline.Flag{
 	ID:           "buildIgnoreFakerootCommandFlag",
@@ -319,6 +341,7 @@ func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(buildCmd)
 
+		cmdManager.RegisterFlagForCmd(&buildArchFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildDisableCacheFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildEncryptFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildFakerootFlag, buildCmd)
@@ -353,6 +376,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&buildIgnoreSubuidFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildIgnoreFakerootCommand, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildIgnoreUsernsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildNoNestingAutodetectFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildRemoteFlag, buildCmd)
 
 		cmdManager.RegisterFlagForCmd(&buildVarArgsFlag, buildCmd)
@@ -16,21 +16,27 @@ import (
 	"fmt"
 	"os"
 	osExec "os/exec"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
 
 	"github.com/apptainer/apptainer/internal/pkg/build"
 	"github.com/apptainer/apptainer/internal/pkg/build/args"
+	build_oci "github.com/apptainer/apptainer/internal/pkg/build/oci"
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/client/urihandler"
 	"github.com/apptainer/apptainer/internal/pkg/fakeroot"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	fakerootConfig "github.com/apptainer/apptainer/internal/pkg/runtime/engine/fakeroot/config"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/internal/pkg/util/interactive"
+	"github.com/apptainer/apptainer/internal/pkg/util/machine"
+	"github.com/apptainer/apptainer/internal/pkg/util/nesting"
 	"github.com/apptainer/apptainer/internal/pkg/util/starter"
+	"github.com/apptainer/apptainer/internal/pkg/util/uri"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
 	"github.com/apptainer/apptainer/pkg/build/types"
 	"github.com/apptainer/apptainer/pkg/image"
@@ -42,7 +48,35 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// adaptBuildToNesting selects fakeroot options compatible with running
+// inside another container, where neither the setuid starter nor the
+// subuid mappings can be used.
+func adaptBuildToNesting(env *nesting.Environment) {
+	if !env.Nested() {
+		return
+	}
+
+	var adaptations []string
+
+	if os.Getuid() != 0 {
+		if (env.UserNS || env.NoSuid) && buildcfg.APPTAINER_SUID_INSTALL == 1 && !buildArgs.userns {
+			buildArgs.userns = true
+			adaptations = append(adaptations, "using a user namespace as the setuid starter is unusable")
+		}
+		if env.UserNS && !buildArgs.ignoreSubuid {
+			buildArgs.ignoreSubuid = true
+			adaptations = append(adaptations, "using a root-mapped namespace or the fakeroot command as subuid mappings are unusable")
+		}
+	}
+
+	env.Report(adaptations)
+}
+
 func fakerootExec(isDeffile, unprivEncrypt bool) {
+	if !buildArgs.noNestingAutodetect {
+		adaptBuildToNesting(nesting.Detect())
+	}
+
 	useSuid := buildcfg.APPTAINER_SUID_INSTALL == 1 && !buildArgs.userns
 
 	// First remove fakeroot option from args and environment if present
@@ -85,8 +119,22 @@ func fakerootExec(isDeffile, unprivEncrypt bool) {
 	// https://github.com/containers/image/blob/master/internal/rootless/rootless.go
 	os.Setenv("_CONTAINERS_ROOTLESS_UID", strconv.FormatUint(uint64(uid), 10))
 
-	if uid != 0 && (!fakeroot.IsUIDMapped(uid) || buildArgs.ignoreSubuid) {
+	useRootMapped := !fakeroot.UseSubuid(uid, buildArgs.ignoreSubuid)
+	if fakeroot.IsNestedRoot() {
+		if err := fakeroot.CheckNested(); err != nil {
+			sylog.Infof("Could not use a nested user namespace (%v), trying root-mapped namespace", err)
+			useRootMapped = true
+		} else {
+			// The fakeroot engine maps the ids available in the
+			// current user namespace to themselves in a nested one
+			sylog.Infof("Running as root in a user namespace, using a nested user namespace")
+			useSuid = false
+		}
+	} else if useRootMapped {
 		sylog.Infof("User not listed in %v, trying root-mapped namespace", fakeroot.SubUIDFile)
+	}
+
+	if useRootMapped {
 		os.Setenv("_APPTAINER_FAKEFAKEROOT", "1")
 		if buildArgs.ignoreUserns {
 			err = errors.New("could not start root-mapped namespace because --ignore-userns is set")
@@ -166,11 +214,7 @@ func runBuild(cmd *cobra.Command, args []string) {
 		// Try fakeroot command
 		os.Unsetenv("_APPTAINER_FAKEFAKEROOT")
 		buildArgs.fakeroot = false
-		if buildArgs.ignoreFakerootCmd {
-			err = errors.New("fakeroot command is ignored because of --ignore-fakeroot-command")
-		} else {
-			fakerootPath, err = fakeroot.FindFake()
-		}
+		fakerootPath, err = fakeroot.FindFakeCommand(buildArgs.ignoreFakerootCmd)
 		if err != nil {
 			sylog.Infof("fakeroot command not found")
 			if uid != 0 {
@@ -268,10 +312,35 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fa
 	if err != nil {
 		sylog.Fatalf("While processing the definition file: %v", err)
 	}
+	// the images of the URI schemes handled by plugins are pulled
+	// first, and built from as local images
+	if t, _ := uri.Split(spec); t != "" {
+		if ok, _ := uri.IsValid(spec); !ok {
+			if image := pullPluginImage(ctx, imgCache, t, spec); image != "" {
+				spec = image
+			}
+		}
+	}
 	defs, unusedArgs, err := build.MakeAllDefs(spec, buildArgsMap)
 	if err != nil {
 		sylog.Fatalf("Unable to build from %s: %v", spec, err)
 	}
+	for _, d := range defs {
+		t := d.Header["bootstrap"]
+		if ok, _ := uri.IsValid(t + ":"); ok || t == "" || t == "localimage" {
+			continue
+		}
+		ref := t + "://" + strings.TrimPrefix(d.Header["from"], "//")
+		if image := pullPluginImage(ctx, imgCache, t, ref); image != "" {
+			d.Header["bootstrap"] = "localimage"
+			d.Header["from"] = image
+		}
+	}
+
+	buildArch, err := checkBuildArch(defs)
+	if err != nil {
+		sylog.Fatalf("Unable to build for architecture %s: %v", buildArgs.arch, err)
+	}
 
 	if len(unusedArgs) > 0 {
 		if buildArgs.buildArgsUnusedWarn {
@@ -333,6 +402,10 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fa
 		buildFormat = "sandbox"
 		sandboxTarget = true
 
+	} else {
+		// the root filesystem of a SIF image is built in the temporary
+		// directory, check that it has enough space before fetching
+		selectTmpDir(cmd, buildTmpSpace(ctx, defs))
 	}
 
 	b, err := build.New(
@@ -360,6 +433,7 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fa
 				FixPerms:          buildArgs.fixPerms,
 				SandboxTarget:     sandboxTarget,
 				Unprivilege:       unprivilege,
+				Arch:              buildArch,
 			},
 		})
 	if err != nil {
@@ -367,8 +441,75 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fa
 	}
 
 	if err = b.Full(ctx); err != nil {
-		sylog.Fatalf("While performing build: %v", err)
+		fatalError(err, "While performing build: %v", err)
+	}
+}
+
+// pullPluginImage pulls the image ref with the handler registered by a
+// plugin for the URI scheme t, and returns its path, or an empty string
+// if no plugin handles t.
+func pullPluginImage(ctx context.Context, imgCache *cache.Handle, t, ref string) string {
+	h, err := urihandler.Get(t)
+	if err != nil {
+		sylog.Fatalf("%v", err)
+	} else if h == nil {
+		return ""
+	}
+	image, err := urihandler.Pull(ctx, imgCache, h, ref, tmpDir)
+	if err != nil {
+		fatalError(err, "Unable to handle %s uri: %v", ref, err)
+	}
+	return image
+}
+
+// crossArchBootstraps are the bootstrap agents able to fetch the image of
+// another architecture than the host's one.
+var crossArchBootstraps = map[string]bool{
+	"docker":         true,
+	"docker-archive": true,
+	"docker-daemon":  true,
+	"oci":            true,
+	"oci-archive":    true,
+	"library":        true,
+	"localimage":     true,
+	"oras":           true,
+	"shub":           true,
+	"scratch":        true,
+}
+
+// checkBuildArch checks that the definitions defs can be built for the
+// architecture requested with --arch, and returns the corresponding OCI
+// architecture, or an empty string to build for the host's architecture.
+// The %post and %test sections of an image of another architecture run
+// with binfmt_misc emulation, which must be available.
+func checkBuildArch(defs []types.Definition) (string, error) {
+	if buildArgs.arch == "" || buildArgs.arch == runtime.GOARCH {
+		return "", nil
+	}
+	arch, err := build_oci.ConvertArch(buildArgs.arch, "")
+	if err != nil {
+		return "", err
+	}
+
+	runScripts := false
+	for _, d := range defs {
+		if t := d.Header["bootstrap"]; !crossArchBootstraps[t] {
+			return "", fmt.Errorf("the %s bootstrap agent only builds images for the host's architecture (%s)", t, runtime.GOARCH)
+		}
+		if d.BuildData.Post.Script != "" || (d.BuildData.Test.Script != "" && !buildArgs.noTest) {
+			runScripts = true
+		}
+	}
+	if !runScripts {
+		return arch, nil
+	}
+
+	if machine.Emulated(buildArgs.arch) {
+		sylog.Verbosef("Running the %%post and %%test sections for %s with binfmt_misc emulation", buildArgs.arch)
+	} else if !machine.CompatibleWith(buildArgs.arch) {
+		return "", fmt.Errorf("no emulation available to run the %%post and %%test sections on this %s host, %s", runtime.GOARCH, machine.EmulationHint)
 	}
+	return arch, nil
 }
 
 func checkSections() error {
@@ -13,13 +13,16 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/app/apptainer"
 	"github.com/apptainer/apptainer/internal/pkg/cache"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 )
 
@@ -27,16 +30,22 @@ func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterFlagForCmd(&cacheCleanTypesFlag, cacheCleanCmd)
 		cmdManager.RegisterFlagForCmd(&cacheCleanDaysFlag, cacheCleanCmd)
+		cmdManager.RegisterFlagForCmd(&cacheCleanAgeFlag, cacheCleanCmd)
+		cmdManager.RegisterFlagForCmd(&cacheCleanLargerThanFlag, cacheCleanCmd)
+		cmdManager.RegisterFlagForCmd(&cacheCleanNameFlag, cacheCleanCmd)
 		cmdManager.RegisterFlagForCmd(&cacheCleanDryFlag, cacheCleanCmd)
 		cmdManager.RegisterFlagForCmd(&cacheCleanForceFlag, cacheCleanCmd)
 	})
 }
 
 var (
-	cacheCleanTypes []string
-	cacheCleanDays  int
-	cacheCleanDry   bool
-	cacheCleanForce bool
+	cacheCleanTypes      []string
+	cacheCleanDays       int
+	cacheCleanAge        string
+	cacheCleanLargerThan string
+	cacheCleanName       string
+	cacheCleanDry        bool
+	cacheCleanForce      bool
 
 	// -T|--type
 	cacheCleanTypesFlag = cmdline.Flag{
@@ -45,7 +54,7 @@ var (
 		DefaultValue: []string{"all"},
 		Name:         "type",
 		ShortHand:    "T",
-		Usage:        "a list of cache types to clean (possible values: library, oci, shub, blob, net, oras, all)",
+		Usage:        "a list of cache types to clean (possible values: library, oci, shub, blob, net, oras, plugin, inspect, rootfs, all)",
 	}
 
 	// -D|--days
@@ -58,6 +67,33 @@ var (
 		Usage:        "remove all cache entries older than specified number of days",
 	}
 
+	// --age
+	cacheCleanAgeFlag = cmdline.Flag{
+		ID:           "cacheCleanAgeFlag",
+		Value:        &cacheCleanAge,
+		DefaultValue: "",
+		Name:         "age",
+		Usage:        "remove only cache entries not used for this duration (e.g. 30d, 2w, 12h)",
+	}
+
+	// --larger-than
+	cacheCleanLargerThanFlag = cmdline.Flag{
+		ID:           "cacheCleanLargerThanFlag",
+		Value:        &cacheCleanLargerThan,
+		DefaultValue: "",
+		Name:         "larger-than",
+		Usage:        "remove only cache entries larger than this size (e.g. 500M, 1G)",
+	}
+
+	// --name
+	cacheCleanNameFlag = cmdline.Flag{
+		ID:           "cacheCleanNameFlag",
+		Value:        &cacheCleanName,
+		DefaultValue: "",
+		Name:         "name",
+		Usage:        "remove only cache entries pulled from a source matching this glob pattern (e.g. 'docker://*alpine*')",
+	}
+
 	// -n|--dry-run
 	cacheCleanDryFlag = cmdline.Flag{
 		ID:           "cacheCleanDryFlag",
@@ -65,7 +101,7 @@ var (
 		DefaultValue: false,
 		Name:         "dry-run",
 		ShortHand:    "n",
-		Usage:        "operate in dry run mode and do not actually clean the cache",
+		Usage:        "operate in dry run mode, only print the cache entries which would be removed",
 	}
 
 	// -f|--force
@@ -95,11 +131,17 @@ var (
 )
 
 func cleanCache() error {
+	filter, err := cleanCacheFilter()
+	if err != nil {
+		return err
+	}
+
 	if cacheCleanDry {
 		fmt.Println("User requested a dry run. Not actually deleting any data!")
 	}
 	if !cacheCleanForce && !cacheCleanDry {
-		ok, err := cleanCachePrompt()
+		filtered := filter.Age > 0 || filter.LargerThan > 0 || filter.Name != ""
+		ok, err := cleanCachePrompt(filtered)
 		if err != nil {
 			return fmt.Errorf("could not prompt user: %v", err)
 		}
@@ -111,17 +153,64 @@ func cleanCache() error {
 
 	// create a handle to access the current image cache
 	imgCache := getCacheHandle(cache.Config{})
-	err := apptainer.CleanApptainerCache(imgCache, cacheCleanDry, cacheCleanTypes, cacheCleanDays)
+	err = apptainer.CleanApptainerCache(imgCache, cacheCleanDry, cacheCleanTypes, filter)
 	if err != nil {
 		return fmt.Errorf("could not clean cache: %v", err)
 	}
 	return nil
 }
 
-func cleanCachePrompt() (bool, error) {
-	fmt.Print(`This will delete everything in your cache (containers from all sources and OCI blobs).
+// cleanCacheFilter returns the filter selecting the removed entries from
+// the command line options.
+func cleanCacheFilter() (cache.CleanFilter, error) {
+	filter := cache.CleanFilter{
+		Days: cacheCleanDays,
+		Name: cacheCleanName,
+	}
+	if cacheCleanAge != "" {
+		age, err := parseCacheAge(cacheCleanAge)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --age value %q: %v", cacheCleanAge, err)
+		}
+		filter.Age = age
+	}
+	if cacheCleanLargerThan != "" {
+		size, err := units.RAMInBytes(cacheCleanLargerThan)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --larger-than value %q: %v", cacheCleanLargerThan, err)
+		}
+		filter.LargerThan = size
+	}
+	return filter, nil
+}
+
+// parseCacheAge parses a duration accepting days (d) and weeks (w) units
+// in addition to the units of time.ParseDuration.
+func parseCacheAge(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number of days or weeks")
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func cleanCachePrompt(filtered bool) (bool, error) {
+	what := "everything in your cache (containers from all sources and OCI blobs)"
+	if filtered {
+		what = "the entries of your cache selected by --age, --larger-than or --name"
+	}
+	fmt.Printf(`This will delete %s.
 Hint: You can see exactly what would be deleted by canceling and using the --dry-run option.
-Do you want to continue? [y/N] `)
+Do you want to continue? [y/N] `, what)
 
 	r := bufio.NewReader(os.Stdin)
 	input, err := r.ReadString('\n')
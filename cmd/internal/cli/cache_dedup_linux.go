@@ -0,0 +1,57 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var cacheDedupDry bool
+
+// -n|--dry-run
+var cacheDedupDryFlag = cmdline.Flag{
+	ID:           "cacheDedupDryFlag",
+	Value:        &cacheDedupDry,
+	DefaultValue: false,
+	Name:         "dry-run",
+	ShortHand:    "n",
+	Usage:        "operate in dry run mode, only report the duplicate files and the estimated savings",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&cacheDedupDryFlag, CacheDedupCmd)
+	})
+}
+
+// CacheDedupCmd is 'apptainer cache dedup' and will reflink the identical
+// files of the local apptainer cache
+var CacheDedupCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		imgCache := getCacheHandle(cache.Config{})
+		if imgCache == nil {
+			sylog.Fatalf("failed to create image cache handle")
+		}
+		if err := apptainer.DedupApptainerCache(imgCache, cacheDedupDry); err != nil {
+			sylog.Fatalf("An error occurred while deduplicating cache: %v", err)
+		}
+	},
+
+	Use:     docs.CacheDedupUse,
+	Short:   docs.CacheDedupShort,
+	Long:    docs.CacheDedupLong,
+	Example: docs.CacheDedupExample,
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var cacheExportTypes []string
+
+// -T|--type
+var cacheExportTypesFlag = cmdline.Flag{
+	ID:           "cacheExportTypes",
+	Value:        &cacheExportTypes,
+	DefaultValue: []string{"all"},
+	Name:         "type",
+	ShortHand:    "T",
+	Usage:        "a list of cache types to export, possible entries: library, oci-tmp, shub, oras, net, plugin, inspect, oci-blob, all",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&cacheExportTypesFlag, CacheExportCmd)
+	})
+}
+
+// CacheExportCmd is 'apptainer cache export' and will export the local
+// apptainer cache to an archive
+var CacheExportCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		imgCache := getCacheHandle(cache.Config{})
+		if imgCache == nil {
+			sylog.Fatalf("failed to create image cache handle")
+		}
+		if err := apptainer.ExportApptainerCache(imgCache, cacheExportTypes, args[0]); err != nil {
+			sylog.Fatalf("An error occurred while exporting cache: %v", err)
+		}
+	},
+
+	Use:     docs.CacheExportUse,
+	Short:   docs.CacheExportShort,
+	Long:    docs.CacheExportLong,
+	Example: docs.CacheExportExample,
+}
+
+// CacheImportCmd is 'apptainer cache import' and will import an archive
+// into the local apptainer cache
+var CacheImportCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		imgCache := getCacheHandle(cache.Config{})
+		if imgCache == nil {
+			sylog.Fatalf("failed to create image cache handle")
+		}
+		if err := apptainer.ImportApptainerCache(imgCache, args[0]); err != nil {
+			sylog.Fatalf("An error occurred while importing cache: %v", err)
+		}
+	},
+
+	Use:     docs.CacheImportUse,
+	Short:   docs.CacheImportShort,
+	Long:    docs.CacheImportLong,
+	Example: docs.CacheImportExample,
+}
@@ -22,6 +22,10 @@ func init() {
 		cmdManager.RegisterCmd(CacheCmd)
 		cmdManager.RegisterSubCmd(CacheCmd, cacheCleanCmd)
 		cmdManager.RegisterSubCmd(CacheCmd, CacheListCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, CacheExportCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, CacheImportCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, CacheVerifyCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, CacheDedupCmd)
 	})
 }
 
@@ -23,6 +23,7 @@ import (
 var (
 	cacheListTypes   []string
 	cacheListVerbose bool
+	cacheListJSON    bool
 )
 
 // -T|--type
@@ -32,7 +33,7 @@ var cacheListTypesFlag = cmdline.Flag{
 	DefaultValue: []string{"all"},
 	Name:         "type",
 	ShortHand:    "T",
-	Usage:        "a list of cache types to display, possible entries: library, oci, shub, blob(s), all",
+	Usage:        "a list of cache types to display, possible entries: library, oci, shub, blob(s), rootfs, all",
 }
 
 // -s|--summary
@@ -45,10 +46,21 @@ var cacheListVerboseFlag = cmdline.Flag{
 	Usage:        "include cache entries in the output",
 }
 
+// -j|--json
+var cacheListJSONFlag = cmdline.Flag{
+	ID:           "cacheListJSON",
+	Value:        &cacheListJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the cache entries with their provenance as a JSON array",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterFlagForCmd(&cacheListTypesFlag, CacheListCmd)
 		cmdManager.RegisterFlagForCmd(&cacheListVerboseFlag, CacheListCmd)
+		cmdManager.RegisterFlagForCmd(&cacheListJSONFlag, CacheListCmd)
 	})
 }
 
@@ -74,7 +86,7 @@ func cacheListCmd() error {
 		sylog.Fatalf("failed to create image cache handle")
 	}
 
-	err := apptainer.ListApptainerCache(imgCache, cacheListTypes, cacheListVerbose)
+	err := apptainer.ListApptainerCache(imgCache, cacheListTypes, cacheListVerbose, cacheListJSON)
 	if err != nil {
 		sylog.Fatalf("An error occurred while listing cache: %v", err)
 		return err
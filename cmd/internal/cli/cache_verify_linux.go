@@ -0,0 +1,83 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cacheVerifyTypes         []string
+	cacheVerifyDeleteCorrupt bool
+	cacheVerifyJSON          bool
+)
+
+// -T|--type
+var cacheVerifyTypesFlag = cmdline.Flag{
+	ID:           "cacheVerifyTypes",
+	Value:        &cacheVerifyTypes,
+	DefaultValue: []string{"all"},
+	Name:         "type",
+	ShortHand:    "T",
+	Usage:        "a list of cache types to verify, possible entries: library, oci-tmp, shub, oras, net, plugin, inspect, oci-blob, all",
+}
+
+// --delete-corrupt
+var cacheVerifyDeleteCorruptFlag = cmdline.Flag{
+	ID:           "cacheVerifyDeleteCorrupt",
+	Value:        &cacheVerifyDeleteCorrupt,
+	DefaultValue: false,
+	Name:         "delete-corrupt",
+	Usage:        "remove the corrupted entries, so that they are pulled again",
+}
+
+// -j|--json
+var cacheVerifyJSONFlag = cmdline.Flag{
+	ID:           "cacheVerifyJSON",
+	Value:        &cacheVerifyJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the verification results of the entries as a JSON array",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&cacheVerifyTypesFlag, CacheVerifyCmd)
+		cmdManager.RegisterFlagForCmd(&cacheVerifyDeleteCorruptFlag, CacheVerifyCmd)
+		cmdManager.RegisterFlagForCmd(&cacheVerifyJSONFlag, CacheVerifyCmd)
+	})
+}
+
+// CacheVerifyCmd is 'apptainer cache verify' and will verify the integrity
+// of the local apptainer cache
+var CacheVerifyCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		imgCache := getCacheHandle(cache.Config{})
+		if imgCache == nil {
+			sylog.Fatalf("failed to create image cache handle")
+		}
+		err := apptainer.VerifyApptainerCache(imgCache, cacheVerifyTypes, cacheVerifyDeleteCorrupt, cacheVerifyJSON)
+		if err != nil {
+			sylog.Fatalf("An error occurred while verifying cache: %v", err)
+		}
+	},
+
+	Use:     docs.CacheVerifyUse,
+	Short:   docs.CacheVerifyShort,
+	Long:    docs.CacheVerifyLong,
+	Example: docs.CacheVerifyExample,
+}
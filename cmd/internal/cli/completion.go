@@ -0,0 +1,356 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/spf13/cobra"
+)
+
+// The completion functions below only read local state (instance files,
+// image cache, remote configuration and network configurations), they
+// never access the network so that completion stays fast.
+
+// imageExtensions are the extensions of the image files completed for
+// image arguments and --overlay.
+var imageExtensions = []string{".sif", ".img", ".sqfs", ".squashfs", ".ext3"}
+
+// instanceURIPrefix is the prefix of the image arguments referring to a
+// running instance.
+const instanceURIPrefix = "instance://"
+
+// filterPrefix returns the candidates starting with prefix.
+func filterPrefix(candidates []string, prefix string) []string {
+	matches := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// instanceNames returns the names of the running instances of the user
+// stored in subDir.
+func instanceNames(subDir string) []string {
+	ii, err := instance.List("", "*", subDir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(ii))
+	for _, i := range ii {
+		names = append(names, i.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cachedReferences returns the references of the library and oras images
+// stored in the image cache.
+func cachedReferences() []string {
+	envKey := env.TrimApptainerKey(cache.DirEnv)
+	h, err := cache.New(cache.Config{ParentDir: env.GetenvLegacy(envKey, envKey)})
+	if err != nil {
+		return nil
+	}
+	var refs []string
+	for _, cacheType := range []string{cache.LibraryCacheType, cache.OrasCacheType} {
+		entries, err := h.ListEntries(cacheType)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.Source != "" {
+				refs = append(refs, e.Source)
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// imageFiles returns the directories and the image files matching the path
+// being completed, directories are suffixed with a slash.
+func imageFiles(toComplete string) []string {
+	dir, base := filepath.Split(toComplete)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		isDir := e.IsDir()
+		if e.Type()&os.ModeSymlink != 0 {
+			fi, err := os.Stat(filepath.Join(readDir, name))
+			if err != nil {
+				continue
+			}
+			isDir = fi.IsDir()
+		}
+		if isDir {
+			files = append(files, dir+name+"/")
+			continue
+		}
+		for _, ext := range imageExtensions {
+			if strings.HasSuffix(name, ext) {
+				files = append(files, dir+name)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// fileDirective returns the directive for the completion of paths, no
+// space is appended when the single candidate is a directory to let the
+// user complete the files it holds.
+func fileDirective(candidates []string) cobra.ShellCompDirective {
+	directive := cobra.ShellCompDirectiveNoFileComp
+	if len(candidates) == 1 && strings.HasSuffix(candidates[0], "/") {
+		directive |= cobra.ShellCompDirectiveNoSpace
+	}
+	return directive
+}
+
+// completeImage completes the image argument of a command with image files,
+// cached library and oras references, and running instances. The arguments
+// following the image are completed with files.
+func completeImage(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	if strings.HasPrefix(toComplete, instanceURIPrefix) {
+		var candidates []string
+		for _, name := range instanceNames(instance.AppSubDir) {
+			candidates = append(candidates, instanceURIPrefix+name)
+		}
+		return filterPrefix(candidates, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+	if strings.Contains(toComplete, "://") {
+		return filterPrefix(cachedReferences(), toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+
+	candidates := imageFiles(toComplete)
+	directive := fileDirective(candidates)
+	candidates = append(candidates, filterPrefix(cachedReferences(), toComplete)...)
+	if toComplete != "" && strings.HasPrefix(instanceURIPrefix, toComplete) {
+		candidates = append(candidates, instanceURIPrefix)
+		directive |= cobra.ShellCompDirectiveNoSpace
+	}
+	return candidates, directive
+}
+
+// completeInstanceImage completes the image argument of instance start and
+// instance run, the instance name following it isn't completed.
+func completeInstanceImage(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeImage(cmd, args, toComplete)
+}
+
+// completeInstance completes the first argument with the names of the
+// running instances.
+func completeInstance(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return filterPrefix(instanceNames(instance.AppSubDir), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeOciContainer completes the first argument with the IDs of the
+// OCI containers.
+func completeOciContainer(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	return filterPrefix(instanceNames(instance.OciSubDir), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completionRemoteConfig returns the remote configuration file of the
+// user, set with --config for the remote commands.
+func completionRemoteConfig() string {
+	if remoteConfig != "" {
+		return remoteConfig
+	}
+	return remoteConfigUser
+}
+
+// remoteNames returns the names of the remote endpoints.
+func remoteNames() []string {
+	names, err := apptainer.RemoteNames(completionRemoteConfig())
+	if err != nil {
+		return nil
+	}
+	return names
+}
+
+// keyserverURIs returns the URIs of the configured keyservers.
+func keyserverURIs() []string {
+	uris, err := apptainer.KeyserverURIs(completionRemoteConfig())
+	if err != nil {
+		return nil
+	}
+	return uris
+}
+
+// completeRemote completes the first argument with the names of the remote
+// endpoints.
+func completeRemote(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return filterPrefix(remoteNames(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRemoteKeyserver completes the optional remote name followed by
+// a keyserver URI of keyserver remove and remote remove-keyserver.
+func completeRemoteKeyserver(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		candidates := append(remoteNames(), keyserverURIs()...)
+		return filterPrefix(candidates, toComplete), cobra.ShellCompDirectiveNoFileComp
+	case 1:
+		return filterPrefix(keyserverURIs(), toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeKeyserver completes the first argument with the URIs of the
+// configured keyservers.
+func completeKeyserver(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return filterPrefix(keyserverURIs(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeNetwork completes the first argument with the network names.
+func completeNetwork(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return filterPrefix(apptainer.NetworkNames(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeNetworkFlag completes the last network of the comma separated
+// list of --network.
+func completeNetworkFlag(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	prefix := ""
+	current := toComplete
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix = toComplete[:i+1]
+		current = toComplete[i+1:]
+	}
+	names := append([]string{"none"}, apptainer.NetworkNames()...)
+	candidates := make([]string, 0, len(names))
+	for _, name := range filterPrefix(names, current) {
+		candidates = append(candidates, prefix+name)
+	}
+	return candidates, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeOverlayFlag completes --overlay with overlay images and
+// directories.
+func completeOverlayFlag(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	candidates := imageFiles(toComplete)
+	return candidates, fileDirective(candidates)
+}
+
+// registerCompletions sets the dynamic completion of the arguments and
+// flags of the commands, once all the commands are registered.
+func registerCompletions(root *cobra.Command) {
+	argCompletions := []struct {
+		fn   func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective)
+		cmds []*cobra.Command
+	}{
+		{
+			fn:   completeImage,
+			cmds: []*cobra.Command{ExecCmd, RunCmd, ShellCmd, TestCmd, InspectCmd, SignCmd, VerifyCmd, PushCmd, instanceGenerateUnitCmd},
+		},
+		{
+			fn:   completeInstanceImage,
+			cmds: []*cobra.Command{instanceStartCmd, instanceRunCmd},
+		},
+		{
+			fn: completeInstance,
+			cmds: []*cobra.Command{
+				instanceStopCmd, instanceStatsCmd, instanceEventsCmd, instanceInspectCmd, instanceLogsCmd,
+				instanceRestartCmd, instanceUpdateCmd, instanceEnableCmd, CheckpointInstanceCmd,
+			},
+		},
+		{
+			fn: completeOciContainer,
+			cmds: []*cobra.Command{
+				OciStartCmd, OciDeleteCmd, OciKillCmd, OciStateCmd, OciAttachCmd, OciExecCmd,
+				OciUpdateCmd, OciPauseCmd, OciResumeCmd, OciEventsCmd,
+			},
+		},
+		{
+			fn: completeRemote,
+			cmds: []*cobra.Command{
+				RemoteRemoveCmd, RemoteUseCmd, RemoteLoginCmd, RemoteLogoutCmd, RemoteStatusCmd,
+				RemoteAddKeyserverCmd, KeyserverAddCmd, KeyserverListCmd,
+			},
+		},
+		{
+			fn:   completeRemoteKeyserver,
+			cmds: []*cobra.Command{RemoteRemoveKeyserverCmd, KeyserverRemoveCmd},
+		},
+		{
+			fn:   completeKeyserver,
+			cmds: []*cobra.Command{KeyserverLoginCmd, KeyserverLogoutCmd},
+		},
+		{
+			fn:   completeNetwork,
+			cmds: []*cobra.Command{NetworkInspectCmd, NetworkRemoveCmd},
+		},
+	}
+	for _, c := range argCompletions {
+		for _, cmd := range c.cmds {
+			if cmd.ValidArgsFunction == nil {
+				cmd.ValidArgsFunction = c.fn
+			}
+		}
+	}
+
+	flagCompletions := map[string]func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective){
+		"overlay": completeOverlayFlag,
+		"network": completeNetworkFlag,
+	}
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		for name, fn := range flagCompletions {
+			if cmd.Flags().Lookup(name) != nil {
+				// an already registered completion is kept
+				_ = cmd.RegisterFlagCompletionFunc(name, fn)
+			}
+		}
+		for _, sub := range cmd.Commands() {
+			walk(sub)
+		}
+	}
+	walk(root)
+}
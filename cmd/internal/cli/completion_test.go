@@ -0,0 +1,159 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+)
+
+// complete runs the hidden __complete command with args and returns the
+// completion candidates.
+func complete(t *testing.T, args ...string) []string {
+	t.Helper()
+
+	initCLI()
+
+	var out bytes.Buffer
+	apptainerCmd.SetOut(&out)
+	apptainerCmd.SetArgs(append([]string{"__complete"}, args...))
+	defer func() {
+		apptainerCmd.SetOut(nil)
+		apptainerCmd.SetArgs(nil)
+	}()
+
+	start := time.Now()
+	if err := apptainerCmd.Execute(); err != nil {
+		t.Fatalf("completion of %v failed: %s", args, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("completion of %v took %s", args, d)
+	}
+
+	var candidates []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
+		candidates = append(candidates, line)
+	}
+	return candidates
+}
+
+func checkCandidates(t *testing.T, got, want []string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got candidates %q, want %q", got, want)
+	}
+}
+
+func TestCompleteImage(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"alpine.sif", "data.img", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sandbox"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheDir := t.TempDir()
+	t.Setenv(cache.DirEnv, cacheDir)
+	h, err := cache.New(cache.Config{ParentDir: cacheDir})
+	if err != nil {
+		t.Fatalf("while creating cache: %s", err)
+	}
+	e, err := h.GetEntry(cache.LibraryCacheType, "0123456789abcdef")
+	if err != nil {
+		t.Fatalf("while creating cache entry: %s", err)
+	}
+	e.Source = "library://alpine:3.18"
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("while finalizing cache entry: %s", err)
+	}
+
+	checkCandidates(t, complete(t, "exec", dir+"/"), []string{
+		dir + "/alpine.sif",
+		dir + "/data.img",
+		dir + "/sandbox/",
+	})
+	checkCandidates(t, complete(t, "run", dir+"/sa"), []string{dir + "/sandbox/"})
+	checkCandidates(t, complete(t, "shell", "library://al"), []string{"library://alpine:3.18"})
+	checkCandidates(t, complete(t, "exec", "--overlay", dir+"/d"), []string{dir + "/data.img"})
+	checkCandidates(t, complete(t, "instance", "start", "alpine.sif", ""), nil)
+}
+
+func TestCompleteInstance(t *testing.T) {
+	name := fmt.Sprintf("completion%d", os.Getpid())
+
+	// fake instance parent process
+	cmd := &exec.Cmd{
+		Path: "/bin/sleep",
+		Args: []string{fmt.Sprintf("%s: test [%s]", instance.ProgPrefix, name), "60"},
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("could not start fake instance process: %s", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	file, err := instance.Add(name, instance.AppSubDir)
+	if err != nil {
+		t.Fatalf("while adding instance: %s", err)
+	}
+	defer file.Delete()
+	file.Name = name
+	file.PPid = cmd.Process.Pid
+	file.Pid = cmd.Process.Pid
+	if err := file.Update(); err != nil {
+		t.Fatalf("while writing instance file: %s", err)
+	}
+
+	checkCandidates(t, complete(t, "instance", "stop", name[:4]), []string{name})
+	checkCandidates(t, complete(t, "instance", "stats", name), []string{name})
+	checkCandidates(t, complete(t, "instance", "stop", name, ""), nil)
+	checkCandidates(t, complete(t, "exec", "instance://"+name), []string{"instance://" + name})
+}
+
+func TestCompleteRemote(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), "remote.yaml")
+	data := `Active: mine
+Remotes:
+  mine:
+    URI: cloud.example.com
+    Keyservers:
+    - URI: https://keys.example.com
+  other:
+    URI: other.example.com
+`
+	if err := os.WriteFile(conf, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	checkCandidates(t, complete(t, "remote", "--config", conf, "use", ""), []string{"mine", "other"})
+	checkCandidates(t, complete(t, "remote", "--config", conf, "status", "o"), []string{"other"})
+	checkCandidates(t, complete(t, "remote", "--config", conf, "remove-keyserver", "mine", ""), []string{"https://keys.example.com"})
+}
+
+func TestCompleteNetworkFlag(t *testing.T) {
+	checkCandidates(t, complete(t, "run", "--network", "no"), []string{"none"})
+	checkCandidates(t, complete(t, "exec", "--network", "bridge,no"), []string{"bridge,none"})
+}
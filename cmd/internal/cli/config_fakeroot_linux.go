@@ -11,6 +11,7 @@ package cli
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/app/apptainer"
@@ -67,16 +68,89 @@ var fakerootConfigDisableFlag = cmdline.Flag{
 	Usage:        "disable a user fakeroot mapping entry preventing him to use the fakeroot feature (the user mapping must be present)",
 }
 
+// --add-file
+var fakerootConfigAddFile string
+
+var fakerootConfigAddFileFlag = cmdline.Flag{
+	ID:           "fakerootConfigAddFileFlag",
+	Value:        &fakerootConfigAddFile,
+	DefaultValue: "",
+	Name:         "add-file",
+	Usage:        "add fakeroot mapping entries for the users listed in a file, one username per line",
+}
+
+// --add-group
+var fakerootConfigAddGroup string
+
+var fakerootConfigAddGroupFlag = cmdline.Flag{
+	ID:           "fakerootConfigAddGroupFlag",
+	Value:        &fakerootConfigAddGroup,
+	DefaultValue: "",
+	Name:         "add-group",
+	Usage:        "add fakeroot mapping entries for the members of a group",
+}
+
+// --validate
+var fakerootConfigValidate bool
+
+var fakerootConfigValidateFlag = cmdline.Flag{
+	ID:           "fakerootConfigValidateFlag",
+	Value:        &fakerootConfigValidate,
+	DefaultValue: false,
+	Name:         "validate",
+	Usage:        "audit the fakeroot mapping entries for invalid, duplicate and overlapping ranges, and ranges including existing ids",
+}
+
+// --dry-run
+var fakerootConfigDryRun bool
+
+var fakerootConfigDryRunFlag = cmdline.Flag{
+	ID:           "fakerootConfigDryRunFlag",
+	Value:        &fakerootConfigDryRun,
+	DefaultValue: false,
+	Name:         "dry-run",
+	Usage:        "show the changes of the fakeroot mapping entries as a diff without applying them",
+}
+
 // configFakerootCmd apptainer config fakeroot
 var configFakerootCmd = &cobra.Command{
-	Args:                  cobra.ExactArgs(1),
+	Args:                  cobra.MaximumNArgs(1),
 	DisableFlagsInUseLine: true,
 	PreRun:                CheckRoot,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		username := args[0]
 		var op apptainer.FakerootConfigOp
+		usernames := args
+
+		if fakerootConfigValidate {
+			if len(args) > 0 {
+				return fmt.Errorf("--validate doesn't take a user argument")
+			}
+			if err := apptainer.FakerootValidate(os.Stdout); err != nil {
+				sylog.Fatalf("%s", err)
+			}
+			return nil
+		}
 
-		if fakerootConfigAdd {
+		if fakerootConfigAddFile != "" || fakerootConfigAddGroup != "" {
+			if len(args) > 0 {
+				return fmt.Errorf("--add-file and --add-group don't take a user argument")
+			}
+			var err error
+			if fakerootConfigAddFile != "" {
+				usernames, err = apptainer.FakerootUsersFromFile(fakerootConfigAddFile)
+			} else {
+				usernames, err = apptainer.FakerootUsersFromGroup(fakerootConfigAddGroup)
+			}
+			if err != nil {
+				sylog.Fatalf("%s", err)
+			}
+			if len(usernames) == 0 {
+				sylog.Fatalf("No user found to add")
+			}
+			op = apptainer.FakerootAddUser
+		} else if len(args) == 0 {
+			return fmt.Errorf("you must specify a user")
+		} else if fakerootConfigAdd {
 			op = apptainer.FakerootAddUser
 		} else if fakerootConfigRemove {
 			op = apptainer.FakerootRemoveUser
@@ -88,7 +162,7 @@ var configFakerootCmd = &cobra.Command{
 			return fmt.Errorf("you must specify an option (eg: --add/--remove)")
 		}
 
-		if err := apptainer.FakerootConfig(username, op); err != nil {
+		if err := apptainer.FakerootConfig(usernames, op, fakerootConfigDryRun, os.Stdout); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 
@@ -107,5 +181,9 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&fakerootConfigRemoveFlag, configFakerootCmd)
 		cmdManager.RegisterFlagForCmd(&fakerootConfigEnableFlag, configFakerootCmd)
 		cmdManager.RegisterFlagForCmd(&fakerootConfigDisableFlag, configFakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootConfigAddFileFlag, configFakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootConfigAddGroupFlag, configFakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootConfigValidateFlag, configFakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootConfigDryRunFlag, configFakerootCmd)
 	})
 }
@@ -0,0 +1,73 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// Basic Design
+// apptainer doctor [--for exec|build|instance|fakeroot] [--json]
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(DoctorCmd)
+		cmdManager.RegisterFlagForCmd(&doctorForFlag, DoctorCmd)
+		cmdManager.RegisterFlagForCmd(&doctorJSONFlag, DoctorCmd)
+		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, DoctorCmd)
+	})
+}
+
+// --for
+var doctorFor []string
+
+var doctorForFlag = cmdline.Flag{
+	ID:           "doctorForFlag",
+	Value:        &doctorFor,
+	DefaultValue: []string{},
+	Name:         "for",
+	Usage:        "only run the checks of a flow: exec, build, instance or fakeroot",
+	Tag:          "<flow>",
+}
+
+// -j|--json
+var doctorJSON bool
+
+var doctorJSONFlag = cmdline.Flag{
+	ID:           "doctorJSONFlag",
+	Value:        &doctorJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the checks in json format",
+}
+
+// DoctorCmd apptainer doctor
+var DoctorCmd = &cobra.Command{
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		imgCache := getCacheHandle(cache.Config{})
+		if err := apptainer.PrintDoctor(os.Stdout, doctorFor, tmpDir, imgCache, doctorJSON); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+
+	Use:     docs.DoctorUse,
+	Short:   docs.DoctorShort,
+	Long:    docs.DoctorLong,
+	Example: docs.DoctorExample,
+}
@@ -0,0 +1,49 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/apptainer/apptainer/internal/pkg/client"
+	"github.com/apptainer/apptainer/internal/pkg/util/starter"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// errorClass returns the class of the failure err, telling apart the
+// missing images, the rejected credentials and the site policy denials, or
+// an empty class for the other failures.
+func errorClass(err error) starter.Class {
+	switch {
+	case client.IsNotFound(err):
+		return starter.ClassNotFound
+	case client.IsUnauthorized(err):
+		return starter.ClassUnauthorized
+	case errors.Is(err, starter.ErrPolicyDenied):
+		return starter.ClassPolicy
+	}
+	return ""
+}
+
+// fatalError prints the message of the failure err like sylog.Fatalf, and
+// exits with the exit code of its class, or 255. With --json-errors, the
+// error record of the failure is printed first, with its class and exit
+// code.
+func fatalError(err error, format string, a ...interface{}) {
+	r := starter.Record{
+		Class:   errorClass(err),
+		Message: err.Error(),
+	}
+	if jsonErrors {
+		fmt.Fprintln(os.Stderr, r.Output(true))
+	}
+	sylog.Exitf(r.ExitCode(), format, a...)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// Basic Design
+// apptainer fakeroot --check [--json]
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(FakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootCheckFlag, FakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootJSONFlag, FakerootCmd)
+	})
+}
+
+// --check
+var fakerootCheck bool
+
+var fakerootCheckFlag = cmdline.Flag{
+	ID:           "fakerootCheckFlag",
+	Value:        &fakerootCheck,
+	DefaultValue: false,
+	Name:         "check",
+	Usage:        "check the requirements of the --fakeroot mechanisms and report the one selected",
+}
+
+// -j|--json
+var fakerootJSON bool
+
+var fakerootJSONFlag = cmdline.Flag{
+	ID:           "fakerootJSONFlag",
+	Value:        &fakerootJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the diagnostics in json format",
+}
+
+// FakerootCmd apptainer fakeroot
+var FakerootCmd = &cobra.Command{
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !fakerootCheck {
+			return errors.New("invalid command, use --check")
+		}
+		if err := apptainer.PrintFakerootCheck(os.Stdout, fakerootJSON); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		return nil
+	},
+
+	Use:     docs.FakerootUse,
+	Short:   docs.FakerootShort,
+	Long:    docs.FakerootLong,
+	Example: docs.FakerootExample,
+}
@@ -11,6 +11,7 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,14 +22,20 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"text/template"
 
 	"github.com/apptainer/apptainer/docs"
+	build_oci "github.com/apptainer/apptainer/internal/pkg/build/oci"
+	"github.com/apptainer/apptainer/internal/pkg/build/sources"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/image"
 	"github.com/apptainer/apptainer/pkg/inspect"
+	"github.com/apptainer/apptainer/pkg/syfs"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
 	"github.com/apptainer/sif/v2/pkg/sif"
+	ocitypes "github.com/containers/image/v5/types"
 	"github.com/spf13/cobra"
 )
 
@@ -38,16 +45,22 @@ var (
 )
 
 var (
-	allData     bool
-	runscript   bool
-	startscript bool
-	testfile    bool
-	environment bool
-	helpfile    bool
-	listApps    bool
-	labels      bool
-	deffile     bool
-	jsonfmt     bool
+	allData       bool
+	runscript     bool
+	startscript   bool
+	testfile      bool
+	environment   bool
+	helpfile      bool
+	listApps      bool
+	labels        bool
+	deffile       bool
+	ociConfig     bool
+	imageFormat   bool
+	jsonfmt       bool
+	inspectFormat string
+
+	inspectRemote        bool
+	inspectCacheMetadata bool
 )
 
 // -l|--labels
@@ -149,6 +162,33 @@ var inspectHelpfileFlag = cmdline.Flag{
 	Usage:        "inspect the runscript helpfile, if it exists",
 }
 
+// --oci-config
+var inspectOCIConfigFlag = cmdline.Flag{
+	ID:           "inspectOCIConfigFlag",
+	Value:        &ociConfig,
+	DefaultValue: false,
+	Name:         "oci-config",
+	Usage:        "show the configuration of the OCI image the container was built from",
+}
+
+// --image-format
+var inspectImageFormatFlag = cmdline.Flag{
+	ID:           "inspectImageFormatFlag",
+	Value:        &imageFormat,
+	DefaultValue: false,
+	Name:         "image-format",
+	Usage:        "show the format of the image: sif, sandbox, squashfs, ext3, tar, tar.gz, tar.zst or oci",
+}
+
+// --format
+var inspectFormatFlag = cmdline.Flag{
+	ID:           "inspectFormatFlag",
+	Value:        &inspectFormat,
+	DefaultValue: "",
+	Name:         "format",
+	Usage:        "format the inspected data with a Go template over the JSON attributes (imply --all option)",
+}
+
 // --all
 var inspectAllFlag = cmdline.Flag{
 	ID:           "inspectAllFlag",
@@ -158,6 +198,24 @@ var inspectAllFlag = cmdline.Flag{
 	Usage:        "show all available data (imply --json option)",
 }
 
+// --remote
+var inspectRemoteFlag = cmdline.Flag{
+	ID:           "inspectRemoteFlag",
+	Value:        &inspectRemote,
+	DefaultValue: false,
+	Name:         "remote",
+	Usage:        "show the metadata of a docker://, oras:// or library:// image from its registry or library, without pulling it",
+}
+
+// --cache-metadata
+var inspectCacheMetadataFlag = cmdline.Flag{
+	ID:           "inspectCacheMetadataFlag",
+	Value:        &inspectCacheMetadata,
+	DefaultValue: false,
+	Name:         "cache-metadata",
+	Usage:        "record the metadata of a remote image in the cache, for use in offline mode",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(InspectCmd)
@@ -173,6 +231,11 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&inspectTestFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectAppsListFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectAllFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectOCIConfigFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectImageFormatFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectFormatFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectRemoteFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectCacheMetadataFlag, InspectCmd)
 	})
 }
 
@@ -274,6 +337,9 @@ func (c *command) setAttribute(section, value, file string) error {
 		fmt.Sscanf(file, "/scif/apps/%s", &app)
 		if app != "" {
 			app = strings.Split(app, "/")[0]
+			// the app may have no scif directory reported by the apps
+			// section
+			c.metadata.AddApp(app)
 		}
 	}
 
@@ -416,6 +482,35 @@ func (c *command) getMetadata() (*inspect.Metadata, error) {
 	return c.metadata, nil
 }
 
+// appNames returns the sorted names of the apps of the inspected image,
+// getMetadata must have been called before.
+func (c *command) appNames() []string {
+	apps := c.metadata.Attributes.Apps
+	if c.sifMetadata != nil {
+		apps = c.sifMetadata.Attributes.Apps
+	}
+	names := make([]string, 0, len(apps))
+	for name := range apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkAppName returns an error listing the available apps if there is
+// no app name in apps.
+func checkAppName(name string, apps []string) error {
+	for _, app := range apps {
+		if app == name {
+			return nil
+		}
+	}
+	if len(apps) == 0 {
+		return fmt.Errorf("no app %q: the image has no apps", name)
+	}
+	return fmt.Errorf("no app %q: available apps are %s", name, strings.Join(apps, ", "))
+}
+
 func (c *command) addSingleFileCommand(file string, label string) {
 	snippet := `
 	for prefix in ${ALL_PATH}; do
@@ -555,6 +650,26 @@ func (c *command) addDefinitionCommand() {
 	}
 }
 
+func (c *command) addOCIConfigCommand() {
+	if c.img.Type != image.SIF {
+		return
+	}
+	r, err := image.NewSectionReader(c.img, image.SIFDescOCIConfigJSON, -1)
+	if err == image.ErrNoSection {
+		sylog.Debugf("No %s SIF descriptor found", image.SIFDescOCIConfigJSON)
+		return
+	} else if err != nil {
+		sylog.Warningf("Unable to read %s SIF descriptor: %s", image.SIFDescOCIConfigJSON, err)
+		return
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		sylog.Warningf("Unable to read %s SIF descriptor: %s", image.SIFDescOCIConfigJSON, err)
+		return
+	}
+	c.metadata.Attributes.OCIConfig = b
+}
+
 func getInspectMetadataFromSIF(img *image.Image) (*inspect.Metadata, error) {
 	r, err := image.NewSectionReader(img, metadataJSON, -1)
 	if err != nil {
@@ -625,96 +740,368 @@ func printSortedMap(m map[string]string, fn func(key string)) {
 
 // returns true if flags for other forms of information are unset.
 func defaultToLabels() bool {
-	return !(helpfile || deffile || runscript || startscript || testfile || environment || listApps)
+	return !(helpfile || deffile || runscript || startscript || testfile || environment || ociConfig || imageFormat || listApps)
 }
 
-// InspectCmd represents the 'inspect' command.
-// TODO: This should be in its own package, not cli.
-var InspectCmd = &cobra.Command{
-	DisableFlagsInUseLine: true,
-	Args:                  cobra.ExactArgs(1),
-
-	Use:     docs.InspectUse,
-	Short:   docs.InspectShort,
-	Long:    docs.InspectLong,
-	Example: docs.InspectExample,
+// ociTransports are the prefixes of the OCI image URIs inspected from
+// their image configuration.
+var ociTransports = []string{"docker://", "docker-daemon:", "docker-archive:", "oci:", "oci-archive:"}
 
-	Run: func(cmd *cobra.Command, args []string) {
-		img, err := image.Init(args[0], false)
-		if err != nil {
-			sylog.Fatalf("Failed to open image %s: %s", args[0], err)
+// isOCIURI returns whether src is an OCI image URI.
+func isOCIURI(src string) bool {
+	for _, t := range ociTransports {
+		if strings.HasPrefix(src, t) {
+			return true
 		}
+	}
+	return false
+}
 
-		if allData {
-			// display all data in JSON format only
-			jsonfmt = true
-			appName = ""
-		}
+// inspectOCIImage returns the metadata of the container which would be
+// built from the OCI image uri, found from its image configuration. The
+// image layers are not fetched.
+func inspectOCIImage(ctx context.Context, uri string) (*inspect.Metadata, error) {
+	sysCtx := &ocitypes.SystemContext{
+		AuthFilePath:            syfs.DockerConf(),
+		DockerRegistryUserAgent: useragent.Value(),
+	}
+	img, err := build_oci.ImageConfig(ctx, uri, sysCtx)
+	if err != nil {
+		return nil, fmt.Errorf("while fetching the image configuration of %s: %w", uri, err)
+	}
 
-		inspectCmd := newCommand(allData, appName, img)
+	metadata := inspect.NewMetadata()
+	for k, v := range img.Config.Labels {
+		metadata.Attributes.Labels[k] = v
+	}
+	metadata.Attributes.Environment["/.singularity.d/env/10-docker2singularity.sh"] = strings.TrimRight(sources.OCIEnvironment(img.Config), "\n")
+	runscript, err := sources.OCIRunscript(img.Config)
+	if err != nil {
+		return nil, err
+	}
+	metadata.Attributes.Runscript = strings.TrimRight(runscript, "\n")
+	metadata.Attributes.ImageFormat = "oci"
+	if metadata.Attributes.OCIConfig, err = json.Marshal(img.Config); err != nil {
+		return nil, fmt.Errorf("while encoding the image configuration: %w", err)
+	}
+	return metadata, nil
+}
+
+// appSelectors are the attributes which are scoped to an app with --app,
+// the other attributes are the ones of the image.
+var appSelectors = map[string]bool{
+	"environment": true,
+	"helpfile":    true,
+	"labels":      true,
+	"runscript":   true,
+	"startscript": true,
+	"test":        true,
+}
 
-		// Try to inspect the label partition, if not, then exec/shell
-		// the container to get the data.
-		if labels || defaultToLabels() || allData {
-			// If '--app' is specified, then we need to shell/exec the
-			// container.
-			sylog.Debugf("Inspection of labels selected.")
-			inspectCmd.addLabelsCommand()
+// inspectSelectors returns the JSON names of the selected attributes.
+func inspectSelectors() []string {
+	if allData {
+		return []string{"deffile", "environment", "helpfile", "imageFormat", "labels", "ociConfig", "runscript", "startscript", "test"}
+	}
+	var selectors []string
+	for _, s := range []struct {
+		name     string
+		selected bool
+	}{
+		{"deffile", deffile},
+		{"environment", environment},
+		{"helpfile", helpfile},
+		{"imageFormat", imageFormat},
+		{"labels", labels || defaultToLabels()},
+		{"ociConfig", ociConfig},
+		{"runscript", runscript},
+		{"startscript", startscript},
+		{"test", testfile},
+	} {
+		if s.selected {
+			selectors = append(selectors, s.name)
 		}
+	}
+	return selectors
+}
 
-		// Inspect the deffile.
-		if deffile || allData {
-			sylog.Debugf("Inspection of deffile selected.")
-			inspectCmd.addDefinitionCommand()
+// attributeValue returns the value of the attribute name, nil if the
+// attribute is not set.
+func attributeValue(attrs *inspect.Attributes, name string) interface{} {
+	switch name {
+	case "deffile":
+		if attrs.Deffile != "" {
+			return attrs.Deffile
+		}
+	case "environment":
+		if len(attrs.Environment) > 0 {
+			return attrs.Environment
+		}
+	case "helpfile":
+		if attrs.Helpfile != "" {
+			return attrs.Helpfile
+		}
+	case "imageFormat":
+		if attrs.ImageFormat != "" {
+			return attrs.ImageFormat
+		}
+	case "labels":
+		if len(attrs.Labels) > 0 {
+			return attrs.Labels
+		}
+	case "ociConfig":
+		if len(attrs.OCIConfig) > 0 {
+			return attrs.OCIConfig
+		}
+	case "runscript":
+		if attrs.Runscript != "" {
+			return attrs.Runscript
+		}
+	case "startscript":
+		if attrs.Startscript != "" {
+			return attrs.Startscript
 		}
+	case "test":
+		if attrs.Test != "" {
+			return attrs.Test
+		}
+	}
+	return nil
+}
 
-		if helpfile || allData {
-			sylog.Debugf("Inspection of helpfile selected.")
-			inspectCmd.addHelpCommand()
+// appAttributes returns the attributes of the app as image attributes.
+func appAttributes(app *inspect.AppAttributes) *inspect.Attributes {
+	if app == nil {
+		return &inspect.Attributes{}
+	}
+	return &inspect.Attributes{
+		Environment: app.Environment,
+		Labels:      app.Labels,
+		Runscript:   app.Runscript,
+		Startscript: app.Startscript,
+		Test:        app.Test,
+		Helpfile:    app.Helpfile,
+	}
+}
+
+// inspectAttributes returns the selected attributes of the inspected
+// metadata, the attributes scoped to an app with --app being reported
+// in the apps attribute. An attribute missing from the image is reported
+// as null.
+func inspectAttributes(metadata *inspect.Metadata) map[string]interface{} {
+	attrs := make(map[string]interface{})
+
+	var app map[string]interface{}
+	if appName != "" && !allData {
+		app = make(map[string]interface{})
+		attrs["apps"] = map[string]interface{}{appName: app}
+	}
+	for _, name := range inspectSelectors() {
+		if app != nil && appSelectors[name] {
+			app[name] = attributeValue(appAttributes(metadata.Attributes.Apps[appName]), name)
+		} else {
+			attrs[name] = attributeValue(&metadata.Attributes, name)
 		}
+	}
+	if listApps || allData {
+		attrs["apps"] = nil
+		if len(metadata.Attributes.Apps) > 0 {
+			attrs["apps"] = metadata.Attributes.Apps
+		}
+	}
+	return attrs
+}
+
+// inspectOutput is the JSON output of inspect.
+type inspectOutput struct {
+	Data struct {
+		Attributes map[string]interface{} `json:"attributes"`
+	} `json:"data"`
+	Type string `json:"type"`
+}
+
+// writeInspectJSON writes the selected attributes of the inspected metadata
+// as JSON.
+func writeInspectJSON(w io.Writer, metadata *inspect.Metadata) error {
+	var out inspectOutput
+	out.Data.Attributes = inspectAttributes(metadata)
+	out.Type = inspect.ContainerType
+
+	b, err := json.MarshalIndent(out, "", "\t")
+	if err != nil {
+		return fmt.Errorf("could not format inspected data as JSON: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// writeInspectFormat writes the selected attributes of the inspected
+// metadata formatted with the Go template tmpl, which is applied to the
+// attributes of the JSON output.
+func writeInspectFormat(w io.Writer, metadata *inspect.Metadata, tmpl string) error {
+	t, err := template.New("format").Parse(tmpl)
+	if err != nil {
+		return fmt.Errorf("while parsing format template: %w", err)
+	}
 
-		if runscript || allData {
-			sylog.Debugf("Inspection of runscript selected.")
-			inspectCmd.addRunscriptCommand()
+	// use the JSON attribute names and values in the template
+	b, err := json.Marshal(inspectAttributes(metadata))
+	if err != nil {
+		return fmt.Errorf("could not format inspected data as JSON: %w", err)
+	}
+	var attrs map[string]interface{}
+	if err := json.Unmarshal(b, &attrs); err != nil {
+		return fmt.Errorf("could not decode inspected data: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := t.Execute(&out, attrs); err != nil {
+		return fmt.Errorf("while executing format template: %w", err)
+	}
+	_, err = fmt.Fprintln(w, out.String())
+	return err
+}
+
+// inspectImage returns the metadata of the image src selected by the
+// inspect flags.
+func inspectImage(ctx context.Context, src string) (*inspect.Metadata, error) {
+	if isOCIURI(src) {
+		if appName != "" && !allData {
+			// OCI images have no SCIF apps
+			return nil, checkAppName(appName, nil)
 		}
+		return inspectOCIImage(ctx, src)
+	}
+
+	img, err := image.Init(src, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %s", src, err)
+	}
+
+	inspectCmd := newCommand(allData, appName, img)
+
+	// Try to inspect the label partition, if not, then exec/shell
+	// the container to get the data.
+	if labels || defaultToLabels() || allData {
+		// If '--app' is specified, then we need to shell/exec the
+		// container.
+		sylog.Debugf("Inspection of labels selected.")
+		inspectCmd.addLabelsCommand()
+	}
+
+	// Inspect the deffile.
+	if deffile || allData {
+		sylog.Debugf("Inspection of deffile selected.")
+		inspectCmd.addDefinitionCommand()
+	}
+
+	if helpfile || allData {
+		sylog.Debugf("Inspection of helpfile selected.")
+		inspectCmd.addHelpCommand()
+	}
+
+	if runscript || allData {
+		sylog.Debugf("Inspection of runscript selected.")
+		inspectCmd.addRunscriptCommand()
+	}
+
+	if startscript || allData {
+		sylog.Debugf("Inspection of startscript selected.")
+		inspectCmd.addStartscriptCommand()
+	}
 
-		if startscript || allData {
-			sylog.Debugf("Inspection of startscript selected.")
-			inspectCmd.addStartscriptCommand()
+	if testfile || allData {
+		sylog.Debugf("Inspection of test selected.")
+		inspectCmd.addTestCommand()
+	}
+
+	if environment || allData {
+		sylog.Debugf("Inspection of environment selected.")
+		inspectCmd.addEnvironmentCommand()
+	}
+
+	if ociConfig || allData {
+		sylog.Debugf("Inspection of OCI configuration selected.")
+		inspectCmd.addOCIConfigCommand()
+	}
+
+	if listApps || allData {
+		sylog.Debugf("Listing all apps in container")
+	}
+
+	inspectData, err := inspectCmd.getMetadata()
+	if err != nil {
+		return nil, err
+	}
+	inspectData.Attributes.ImageFormat = img.FormatName()
+	if appName != "" && !allData {
+		if err := checkAppName(appName, inspectCmd.appNames()); err != nil {
+			return nil, err
 		}
+	}
 
-		if testfile || allData {
-			sylog.Debugf("Inspection of test selected.")
-			inspectCmd.addTestCommand()
+	for app := range inspectData.Data.Attributes.Apps {
+		if !listApps && !allData && appName != app {
+			delete(inspectData.Data.Attributes.Apps, app)
 		}
+	}
+	return inspectData, nil
+}
+
+// InspectCmd represents the 'inspect' command.
+// TODO: This should be in its own package, not cli.
+var InspectCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
 
-		if environment || allData {
-			sylog.Debugf("Inspection of environment selected.")
-			inspectCmd.addEnvironmentCommand()
+	Use:     docs.InspectUse,
+	Short:   docs.InspectShort,
+	Long:    docs.InspectLong,
+	Example: docs.InspectExample,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		src := args[0]
+		if inspectRemote || isRemoteSIFURI(src) {
+			path, err := inspectRemoteImage(cmd.Context(), os.Stdout, src)
+			if err != nil {
+				sylog.Fatalf("%s", err)
+			}
+			if path == "" {
+				return
+			}
+			src = path
 		}
 
-		if listApps || allData {
-			sylog.Debugf("Listing all apps in container")
+		if src == stdinImageArg {
+			src = handleStdinImage(cmd, envTmpDir())
+			defer removeStdinImage()
+		}
+		fatalf := func(format string, a ...interface{}) {
+			removeStdinImage()
+			sylog.Fatalf(format, a...)
 		}
 
-		inspectData, err := inspectCmd.getMetadata()
-		if err != nil {
-			sylog.Fatalf("%s", err)
+		if allData || inspectFormat != "" {
+			// display all data in JSON format only
+			allData = true
+			jsonfmt = true
+			appName = ""
 		}
 
-		for app := range inspectData.Data.Attributes.Apps {
-			if !listApps && !allData && appName != app {
-				delete(inspectData.Data.Attributes.Apps, app)
-			}
+		inspectData, err := inspectImage(cmd.Context(), src)
+		if err != nil {
+			fatalf("%s", err)
 		}
 
 		// Output the inspection results (use JSON if requested).
-		if jsonfmt {
-			jsonObj, err := json.MarshalIndent(inspectData, "", "\t")
-			if err != nil {
-				sylog.Fatalf("Could not format inspected data as JSON")
+		if inspectFormat != "" {
+			if err := writeInspectFormat(os.Stdout, inspectData, inspectFormat); err != nil {
+				fatalf("%s", err)
+			}
+		} else if jsonfmt {
+			if err := writeInspectJSON(os.Stdout, inspectData); err != nil {
+				fatalf("%s", err)
 			}
-			fmt.Printf("%s\n", string(jsonObj))
 		} else {
 			appAttr := inspectData.Data.Attributes.Apps[appName]
 
@@ -722,6 +1109,10 @@ var InspectCmd = &cobra.Command{
 				printSortedApp(inspectData.Data.Attributes.Apps)
 			}
 
+			if imageFormat {
+				fmt.Printf("%s\n", inspectData.Data.Attributes.ImageFormat)
+			}
+
 			if inspectData.Data.Attributes.Deffile != "" {
 				fmt.Printf("%s\n", inspectData.Data.Attributes.Deffile)
 			}
@@ -754,6 +1145,12 @@ var InspectCmd = &cobra.Command{
 					fmt.Printf("=== %s ===\n%s\n\n", k, appAttr.Environment[k])
 				})
 			}
+			if len(inspectData.Data.Attributes.OCIConfig) > 0 {
+				var out bytes.Buffer
+				if err := json.Indent(&out, inspectData.Data.Attributes.OCIConfig, "", "\t"); err == nil {
+					fmt.Printf("%s\n", out.String())
+				}
+			}
 			if len(inspectData.Data.Attributes.Labels) > 0 {
 				printSortedMap(inspectData.Data.Attributes.Labels, func(k string) {
 					fmt.Printf("%s: %s\n", k, inspectData.Data.Attributes.Labels[k])
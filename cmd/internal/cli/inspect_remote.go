@@ -0,0 +1,299 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	build_oci "github.com/apptainer/apptainer/internal/pkg/build/oci"
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/client"
+	"github.com/apptainer/apptainer/internal/pkg/client/library"
+	"github.com/apptainer/apptainer/internal/pkg/client/oras"
+	"github.com/apptainer/apptainer/pkg/inspect"
+	"github.com/apptainer/apptainer/pkg/syfs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+	ocitypes "github.com/containers/image/v5/types"
+	"github.com/docker/go-units"
+)
+
+// isRemoteSIFURI returns whether src is the URI of a SIF image stored in a
+// registry or a library, which is inspected from its remote metadata when
+// it isn't cached.
+func isRemoteSIFURI(src string) bool {
+	return strings.HasPrefix(src, OrasProtocol+"://") || strings.HasPrefix(src, LibraryProtocol+"://")
+}
+
+// isRemoteURI returns whether src is the URI of an image which can be
+// inspected with --remote.
+func isRemoteURI(src string) bool {
+	return strings.HasPrefix(src, "docker://") || isRemoteSIFURI(src)
+}
+
+// inspectSelectionFlags returns whether flags selecting the attributes of
+// an image, which a remote inspection doesn't report, are set.
+func inspectSelectionFlags() bool {
+	return allData || inspectFormat != "" || appName != "" || !defaultToLabels()
+}
+
+// fetchRemoteMetadata returns the metadata of the image src read from its
+// registry or library, without pulling the image. In offline mode the
+// metadata recorded in the cache with --cache-metadata is returned.
+func fetchRemoteMetadata(ctx context.Context, src string) (*inspect.RemoteAttributes, error) {
+	if offline {
+		return cachedRemoteMetadata(src)
+	}
+
+	var attrs *inspect.RemoteAttributes
+	var err error
+
+	switch {
+	case strings.HasPrefix(src, "docker://"):
+		certDir, cleanup, cerr := getRegistryCertDir(src)
+		if cerr != nil {
+			return nil, cerr
+		}
+		defer cleanup()
+		sysCtx := &ocitypes.SystemContext{
+			AuthFilePath:            syfs.DockerConf(),
+			DockerRegistryUserAgent: useragent.Value(),
+			DockerCertPath:          certDir,
+		}
+		attrs, err = build_oci.RemoteMetadata(ctx, src, sysCtx)
+	case strings.HasPrefix(src, OrasProtocol+"://"):
+		certDir, cleanup, cerr := getRegistryCertDir(src)
+		if cerr != nil {
+			return nil, cerr
+		}
+		defer cleanup()
+		attrs, err = oras.RemoteMetadata(ctx, src, nil, false, certDir)
+	case strings.HasPrefix(src, LibraryProtocol+"://"):
+		ref, rerr := library.NormalizeLibraryRef(src)
+		if rerr != nil {
+			return nil, fmt.Errorf("malformed library reference: %v", rerr)
+		}
+		var libraryURI string
+		if ref.Host != "" {
+			libraryURI = "https://" + ref.Host
+		}
+		lc, lerr := getLibraryClientConfig(libraryURI)
+		if lerr != nil {
+			return nil, fmt.Errorf("unable to get library client configuration: %v", lerr)
+		}
+		attrs, err = library.RemoteMetadata(ctx, ref, runtime.GOARCH, lc)
+	default:
+		return nil, fmt.Errorf("%s can't be inspected remotely: only docker://, oras:// and library:// URIs are supported", src)
+	}
+
+	if client.IsUnauthorized(err) {
+		return nil, fmt.Errorf("not authorized to fetch the metadata of %s, check your credentials with 'apptainer registry login' or 'apptainer remote login': %w", src, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("while fetching the remote metadata of %s: %w", src, err)
+	}
+
+	if inspectCacheMetadata {
+		if err := storeRemoteMetadata(attrs); err != nil {
+			sylog.Warningf("Could not record the metadata of %s in the cache: %v", src, err)
+		}
+	}
+	return attrs, nil
+}
+
+// cachedRemoteMetadata returns the metadata of the image src recorded in
+// the cache with --cache-metadata.
+func cachedRemoteMetadata(src string) (*inspect.RemoteAttributes, error) {
+	path, err := getCacheHandle(cache.Config{}).OfflineEntry(cache.InspectCacheType, remoteCacheSource(src))
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	attrs := new(inspect.RemoteAttributes)
+	if err := json.Unmarshal(b, attrs); err != nil {
+		return nil, fmt.Errorf("while decoding the cached metadata of %s: %w", src, err)
+	}
+	return attrs, nil
+}
+
+// storeRemoteMetadata records the metadata of a remote image in the
+// inspect cache, the entry being named by the image digest.
+func storeRemoteMetadata(attrs *inspect.RemoteAttributes) error {
+	imgCache := getCacheHandle(cache.Config{})
+	if imgCache.IsDisabled() {
+		return fmt.Errorf("the cache is disabled")
+	}
+	b, err := json.MarshalIndent(attrs, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	e, err := imgCache.GetEntry(cache.InspectCacheType, attrs.Digest)
+	if err != nil {
+		return err
+	}
+	defer e.CleanTmp()
+	if err := os.WriteFile(e.TmpPath, b, 0o600); err != nil {
+		return err
+	}
+	e.Source = attrs.Source
+	e.Digest = attrs.Digest
+	return e.Finalize()
+}
+
+// remoteSIFCacheType returns the cache type of the SIF images pulled from
+// the oras:// or library:// URI src.
+func remoteSIFCacheType(src string) string {
+	if strings.HasPrefix(src, LibraryProtocol+"://") {
+		return cache.LibraryCacheType
+	}
+	return cache.OrasCacheType
+}
+
+// cachedRemoteImage returns the path of the cached SIF image pulled from
+// the oras:// or library:// URI src, described by attrs, and whether it
+// is cached. The cache is not modified.
+func cachedRemoteImage(src string, attrs *inspect.RemoteAttributes) (string, bool) {
+	return getCacheHandle(cache.Config{}).LookupEntry(remoteSIFCacheType(src), attrs.Digest)
+}
+
+// remoteCacheSource returns the source recorded with the cache entries
+// pulled from src, library references being normalized.
+func remoteCacheSource(src string) string {
+	if strings.HasPrefix(src, LibraryProtocol+"://") {
+		if ref, err := library.NormalizeLibraryRef(src); err == nil {
+			return ref.String()
+		}
+	}
+	return src
+}
+
+// offlineRemoteImage returns the path of the most recently used SIF image
+// pulled from the oras:// or library:// URI src, and whether it is cached.
+func offlineRemoteImage(src string) (string, bool) {
+	path, err := getCacheHandle(cache.Config{}).OfflineEntry(remoteSIFCacheType(src), remoteCacheSource(src))
+	return path, err == nil
+}
+
+// writeRemoteMetadata writes the metadata of a remote image, in JSON
+// format if formatJSON is true.
+func writeRemoteMetadata(w io.Writer, attrs *inspect.RemoteAttributes, formatJSON bool) error {
+	if formatJSON {
+		b, err := json.MarshalIndent(inspect.NewRemoteMetadata(attrs), "", "\t")
+		if err != nil {
+			return fmt.Errorf("could not format remote metadata as JSON: %w", err)
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Remote metadata of %s (the image was not pulled)\n", attrs.Source)
+	fmt.Fprintf(tw, "Digest:\t%s\n", attrs.Digest)
+	fmt.Fprintf(tw, "Size:\t%s\n", units.BytesSize(float64(attrs.Size)))
+	if attrs.Architecture != "" {
+		fmt.Fprintf(tw, "Architecture:\t%s\n", attrs.Architecture)
+	}
+	fmt.Fprintf(tw, "Layers:\t%d\n", len(attrs.Layers))
+	for _, l := range attrs.Layers {
+		fmt.Fprintf(tw, "  %s\t%s\n", l.Digest, units.BytesSize(float64(l.Size)))
+	}
+	if len(attrs.Entrypoint) > 0 {
+		fmt.Fprintf(tw, "Entrypoint:\t%s\n", strings.Join(attrs.Entrypoint, " "))
+	}
+	if len(attrs.Cmd) > 0 {
+		fmt.Fprintf(tw, "Cmd:\t%s\n", strings.Join(attrs.Cmd, " "))
+	}
+	if len(attrs.Env) > 0 {
+		fmt.Fprintf(tw, "Env:\n")
+		for _, e := range attrs.Env {
+			fmt.Fprintf(tw, "  %s\n", e)
+		}
+	}
+	if len(attrs.Labels) > 0 {
+		fmt.Fprintf(tw, "Labels:\n")
+		printSortedMap(attrs.Labels, func(k string) {
+			fmt.Fprintf(tw, "  %s:\t%s\n", k, attrs.Labels[k])
+		})
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(attrs.Objects) > 0 {
+		tw = tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+		fmt.Fprintln(tw, "Objects:")
+		fmt.Fprintln(tw, "  ID\tTYPE\tNAME\tSIZE\tARCH")
+		for _, o := range attrs.Objects {
+			name, arch := o.Name, o.Arch
+			if name == "" {
+				name = "-"
+			}
+			if arch == "" {
+				arch = "-"
+			}
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\t%s\n", o.ID, o.Type, name, units.BytesSize(float64(o.Size)), arch)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if attrs.Runscript != "" {
+		fmt.Fprintf(w, "Runscript:\n%s\n", attrs.Runscript)
+	}
+	if len(attrs.Environment) > 0 {
+		printSortedMap(attrs.Environment, func(k string) {
+			fmt.Fprintf(w, "=== %s ===\n%s\n\n", k, attrs.Environment[k])
+		})
+	}
+	return nil
+}
+
+// inspectRemoteImage shows the metadata of the image src fetched from its
+// registry or library. Without --remote, an oras:// or library:// image
+// found in the cache is inspected from the cached image instead, and the
+// returned path is the one of the cached image.
+func inspectRemoteImage(ctx context.Context, w io.Writer, src string) (string, error) {
+	if inspectRemote && !isRemoteURI(src) {
+		return "", fmt.Errorf("--remote requires a docker://, oras:// or library:// URI")
+	}
+	if inspectRemote && inspectSelectionFlags() {
+		return "", fmt.Errorf("--remote can only be combined with --json")
+	}
+
+	if offline && !inspectRemote {
+		if path, ok := offlineRemoteImage(src); ok {
+			return path, nil
+		}
+	}
+
+	attrs, err := fetchRemoteMetadata(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	if !inspectRemote {
+		if path, ok := cachedRemoteImage(src, attrs); ok {
+			sylog.Debugf("Inspecting cached image %s of %s", path, src)
+			return path, nil
+		}
+		if inspectSelectionFlags() {
+			sylog.Warningf("%s is not in the cache, only its remote metadata is shown", src)
+		}
+	}
+	return "", writeRemoteMetadata(w, attrs, jsonfmt)
+}
@@ -0,0 +1,364 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/apptainer/apptainer/pkg/inspect"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+	"gotest.tools/v3/golden"
+)
+
+const busyboxSIF = "../../../e2e/testdata/busybox_" + runtime.GOARCH + ".sif"
+
+// setInspectFlags resets the inspect flags before calling set to select
+// the inspected data.
+func setInspectFlags(t *testing.T, set func()) {
+	t.Helper()
+	reset := func() {
+		allData, runscript, startscript, testfile = false, false, false, false
+		environment, helpfile, listApps, labels = false, false, false, false
+		deffile, ociConfig, imageFormat, jsonfmt = false, false, false, false
+		appName, inspectFormat = "", ""
+		inspectRemote, inspectCacheMetadata = false, false
+	}
+	reset()
+	t.Cleanup(reset)
+	set()
+}
+
+// writeBlob writes data in the blobs of the OCI layout dir and returns
+// its descriptor.
+func writeBlob(t *testing.T, dir, mediaType string, data []byte) map[string]interface{} {
+	t.Helper()
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+	if err := os.WriteFile(filepath.Join(dir, "blobs", "sha256", sum), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{
+		"mediaType": mediaType,
+		"digest":    "sha256:" + sum,
+		"size":      len(data),
+	}
+}
+
+// makeOCILayout creates an OCI layout holding an image without layers,
+// with the image configuration config.
+func makeOCILayout(t *testing.T, config string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	image := fmt.Sprintf(`{"architecture":%q,"os":"linux","config":%s,"rootfs":{"type":"layers","diff_ids":[]}}`, runtime.GOARCH, config)
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config":        writeBlob(t, dir, "application/vnd.oci.image.config.v1+json", []byte(image)),
+		"layers":        []interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests": []interface{}{
+			writeBlob(t, dir, "application/vnd.oci.image.manifest.v1+json", manifest),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), index, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// makeSandbox creates a sandbox image with a labelled app.
+func makeSandbox(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		".singularity.d/labels.json":                 `{"org.label": "sandbox"}`,
+		".singularity.d/runscript":                   "#!/bin/sh\necho sandbox",
+		".singularity.d/env/90-environment.sh":       "#!/bin/sh\nexport FOO=bar",
+		"scif/apps/tool/scif/labels.json":            `{"org.label": "tool"}`,
+		"scif/apps/tool/scif/runscript":              "#!/bin/sh\necho tool",
+		"scif/apps/tool/scif/runscript.help":         "Run the tool",
+		"scif/apps/tool/scif/env/90-environment.sh":  "#!/bin/sh\nexport TOOL=yes",
+		"scif/apps/other/scif/labels.json":           `{"org.label": "other"}`,
+		"scif/apps/other/scif/env/90-environment.sh": "#!/bin/sh",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestInspectJSON(t *testing.T) {
+	useragent.InitValue("apptainer", "3.0.0")
+
+	ociDir := makeOCILayout(t, `{"Env":["PATH=/usr/bin:/bin","FOO=bar"],"Entrypoint":["/entrypoint.sh"],"Cmd":["serve"],"Labels":{"org.label":"oci"}}`)
+	sandbox := makeSandbox(t)
+
+	tests := []struct {
+		name   string
+		src    string
+		set    func()
+		golden string
+	}{
+		{
+			name:   "SIFDeffileOCIConfig",
+			src:    busyboxSIF,
+			set:    func() { deffile, ociConfig = true, true },
+			golden: "inspect_sif_deffile_ociconfig.json.golden",
+		},
+		{
+			name:   "OCILayoutAll",
+			src:    "oci:" + ociDir,
+			set:    func() { allData = true },
+			golden: "inspect_oci_all.json.golden",
+		},
+		{
+			name:   "SandboxMissing",
+			src:    sandbox,
+			set:    func() { runscript, startscript, testfile, helpfile = true, true, true, true },
+			golden: "inspect_sandbox_missing.json.golden",
+		},
+		{
+			name: "SandboxApp",
+			src:  sandbox,
+			set: func() {
+				appName, labels, runscript, helpfile, environment, deffile = "tool", true, true, true, true, true
+			},
+			golden: "inspect_sandbox_app.json.golden",
+		},
+		{
+			name:   "SandboxListApps",
+			src:    sandbox,
+			set:    func() { listApps = true },
+			golden: "inspect_sandbox_list_apps.json.golden",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.src == busyboxSIF && runtime.GOARCH != "amd64" {
+				t.Skipf("golden file recorded for the amd64 fixture")
+			}
+			setInspectFlags(t, tt.set)
+
+			metadata, err := inspectImage(context.Background(), tt.src)
+			if err != nil {
+				t.Fatalf("while inspecting %s: %s", tt.src, err)
+			}
+			var out bytes.Buffer
+			if err := writeInspectJSON(&out, metadata); err != nil {
+				t.Fatalf("while writing JSON: %s", err)
+			}
+			golden.Assert(t, out.String(), tt.golden)
+		})
+	}
+}
+
+func TestInspectFormat(t *testing.T) {
+	useragent.InitValue("apptainer", "3.0.0")
+
+	ociDir := makeOCILayout(t, `{"Env":["FOO=bar"],"Labels":{"org_label":"oci","org.label":"dotted"}}`)
+	sandbox := makeSandbox(t)
+
+	tests := []struct {
+		name    string
+		src     string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "Label",
+			src:    "oci:" + ociDir,
+			format: "{{ .labels.org_label }}",
+			want:   "oci\n",
+		},
+		{
+			name:   "IndexLabel",
+			src:    "oci:" + ociDir,
+			format: `{{ index .labels "org.label" }}`,
+			want:   "dotted\n",
+		},
+		{
+			name:   "OCIConfig",
+			src:    "oci:" + ociDir,
+			format: "{{ range .ociConfig.Env }}{{ . }}{{ end }}",
+			want:   "FOO=bar\n",
+		},
+		{
+			name:   "Null",
+			src:    "oci:" + ociDir,
+			format: "{{ .deffile }}",
+			want:   "<no value>\n",
+		},
+		{
+			name:   "App",
+			src:    sandbox,
+			format: `{{ index .apps.tool.labels "org.label" }}`,
+			want:   "tool\n",
+		},
+		{
+			name:   "ImageFormat",
+			src:    sandbox,
+			format: "{{ .imageFormat }}",
+			want:   "sandbox\n",
+		},
+		{
+			name:    "BadTemplate",
+			src:     sandbox,
+			format:  "{{ .labels",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setInspectFlags(t, func() { allData = true })
+
+			metadata, err := inspectImage(context.Background(), tt.src)
+			if err != nil {
+				t.Fatalf("while inspecting %s: %s", tt.src, err)
+			}
+			var out bytes.Buffer
+			err = writeInspectFormat(&out, metadata, tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success with format %q", tt.format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("while formatting: %s", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteRemoteMetadata(t *testing.T) {
+	attrs := &inspect.RemoteAttributes{
+		Source:       "docker://alpine",
+		Digest:       "sha256:manifest",
+		Size:         3072,
+		Architecture: "arm64/v8",
+		Layers: []inspect.RemoteLayer{
+			{Digest: "sha256:layer1", Size: 1024},
+			{Digest: "sha256:layer2", Size: 2048},
+		},
+		Labels:     map[string]string{"org.label": "remote"},
+		Env:        []string{"PATH=/bin"},
+		Entrypoint: []string{"/entrypoint.sh"},
+		Cmd:        []string{"sh", "-c", "true"},
+	}
+
+	var out bytes.Buffer
+	if err := writeRemoteMetadata(&out, attrs, false); err != nil {
+		t.Fatalf("while writing remote metadata: %s", err)
+	}
+	want := "Remote metadata of docker://alpine (the image was not pulled)\n" +
+		"Digest:          sha256:manifest\n" +
+		"Size:            3KiB\n" +
+		"Architecture:    arm64/v8\n" +
+		"Layers:          2\n" +
+		"  sha256:layer1  1KiB\n" +
+		"  sha256:layer2  2KiB\n" +
+		"Entrypoint:      /entrypoint.sh\n" +
+		"Cmd:             sh -c true\n" +
+		"Env:\n" +
+		"  PATH=/bin\n" +
+		"Labels:\n" +
+		"  org.label:  remote\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := writeRemoteMetadata(&out, attrs, true); err != nil {
+		t.Fatalf("while writing remote metadata: %s", err)
+	}
+	var m inspect.RemoteMetadata
+	if err := json.Unmarshal(out.Bytes(), &m); err != nil {
+		t.Fatalf("while decoding %s: %s", out.String(), err)
+	}
+	if m.Type != inspect.RemoteType || len(m.Attributes.Layers) != 2 || m.Attributes.Digest != attrs.Digest {
+		t.Errorf("unexpected JSON output %s", out.String())
+	}
+}
+
+func TestInspectRemoteFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		set     func()
+		wantErr string
+	}{
+		{
+			name:    "LocalImage",
+			src:     busyboxSIF,
+			wantErr: "--remote requires a docker://, oras:// or library:// URI",
+		},
+		{
+			name:    "Runscript",
+			src:     "docker://alpine",
+			set:     func() { runscript = true },
+			wantErr: "--remote can only be combined with --json",
+		},
+		{
+			name:    "All",
+			src:     "oras://registry/image",
+			set:     func() { allData, jsonfmt = true, true },
+			wantErr: "--remote can only be combined with --json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setInspectFlags(t, func() {
+				inspectRemote = true
+				if tt.set != nil {
+					tt.set()
+				}
+			})
+			_, err := inspectRemoteImage(context.Background(), io.Discard, tt.src)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -10,18 +10,42 @@
 package cli
 
 import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
-		cmdManager.RegisterFlagForCmd(&instanceStartPidFileFlag, instanceStartCmd, instanceRunCmd)
-		cmdManager.RegisterFlagForCmd(&actionDMTCPLaunchFlag, instanceStartCmd, instanceRunCmd)
-		cmdManager.RegisterFlagForCmd(&actionDMTCPRestartFlag, instanceStartCmd, instanceRunCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStartPidFileFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&actionDMTCPLaunchFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&actionDMTCPRestartFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStartRestartFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogMaxSizeFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogMaxFilesFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStartReadyTimeoutFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceHealthCmdFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceHealthIntervalFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceHealthTimeoutFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceHealthRetriesFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceHealthStartPeriodFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceOnUnhealthyFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceSocketsPathFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceIPFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceMACFlag, instanceStartCmd, instanceRunCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStartUserFlag, instanceStartCmd, instanceRunCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStartEnabledFlag, instanceStartCmd)
 	})
 }
 
@@ -37,23 +61,349 @@ var instanceStartPidFileFlag = cmdline.Flag{
 	EnvKeys:      []string{"PID_FILE"},
 }
 
+// --user
+var instanceStartUser string
+
+var instanceStartUserFlag = cmdline.Flag{
+	ID:           "instanceStartUserFlag",
+	Value:        &instanceStartUser,
+	DefaultValue: "",
+	Name:         "user",
+	Usage:        "if running as root with a setuid installation, start the instance on behalf of user",
+	Tag:          "<username>",
+}
+
+// --enabled
+var instanceStartEnabled bool
+
+var instanceStartEnabledFlag = cmdline.Flag{
+	ID:           "instanceStartEnabledFlag",
+	Value:        &instanceStartEnabled,
+	DefaultValue: false,
+	Name:         "enabled",
+	Usage:        "start all the instances enabled with 'instance enable' which are not running, as root at boot",
+}
+
+// --ready-timeout
+var instanceStartReadyTimeout int
+
+var instanceStartReadyTimeoutFlag = cmdline.Flag{
+	ID:           "instanceStartReadyTimeoutFlag",
+	Value:        &instanceStartReadyTimeout,
+	DefaultValue: 0,
+	Name:         "ready-timeout",
+	Usage:        "wait up to N seconds for the instance to write READY=1 to $NOTIFY_SOCKET, 0 disables readiness notification",
+	Tag:          "<N>",
+	EnvKeys:      []string{"READY_TIMEOUT"},
+}
+
+// --sockets-path
+var instanceSocketsPath string
+
+var instanceSocketsPathFlag = cmdline.Flag{
+	ID:           "instanceSocketsPathFlag",
+	Value:        &instanceSocketsPath,
+	DefaultValue: instance.SocketsMountDir,
+	Name:         "sockets-path",
+	Usage:        "container path where the instance sockets directory, shared with the containers started with --join-sockets, is bound",
+	Tag:          "<path>",
+	EnvKeys:      []string{"SOCKETS_PATH"},
+}
+
+// --ip
+var instanceIP string
+
+var instanceIPFlag = cmdline.Flag{
+	ID:           "instanceIPFlag",
+	Value:        &instanceIP,
+	DefaultValue: "",
+	Name:         "ip",
+	Usage:        "IP address of the instance on its first network, kept for the next starts of the instance until released with 'instance stop --release-ip' (implies --net)",
+	Tag:          "<address>",
+	EnvKeys:      []string{"IP"},
+}
+
+// --mac
+var instanceMAC string
+
+var instanceMACFlag = cmdline.Flag{
+	ID:           "instanceMACFlag",
+	Value:        &instanceMAC,
+	DefaultValue: "",
+	Name:         "mac",
+	Usage:        "hardware address of the instance interface on its first network (implies --net)",
+	Tag:          "<address>",
+	EnvKeys:      []string{"MAC"},
+}
+
+// --restart
+var instanceStartRestart string
+
+var instanceStartRestartFlag = cmdline.Flag{
+	ID:           "instanceStartRestartFlag",
+	Value:        &instanceStartRestart,
+	DefaultValue: instance.RestartNo,
+	Name:         "restart",
+	Usage:        "restart policy of the instance when it exits (no, on-failure[:max], always)",
+	Tag:          "<policy>",
+	EnvKeys:      []string{"RESTART"},
+}
+
+// --health-cmd
+var instanceHealthCmd string
+
+var instanceHealthCmdFlag = cmdline.Flag{
+	ID:           "instanceHealthCmdFlag",
+	Value:        &instanceHealthCmd,
+	DefaultValue: "",
+	Name:         "health-cmd",
+	Usage:        "shell command run periodically in the instance to check its health, a zero exit status means healthy",
+	Tag:          "<command>",
+	EnvKeys:      []string{"HEALTH_CMD"},
+}
+
+// --health-interval
+var instanceHealthInterval string
+
+var instanceHealthIntervalFlag = cmdline.Flag{
+	ID:           "instanceHealthIntervalFlag",
+	Value:        &instanceHealthInterval,
+	DefaultValue: "30s",
+	Name:         "health-interval",
+	Usage:        "time between two health checks",
+	Tag:          "<duration>",
+	EnvKeys:      []string{"HEALTH_INTERVAL"},
+}
+
+// --health-timeout
+var instanceHealthTimeout string
+
+var instanceHealthTimeoutFlag = cmdline.Flag{
+	ID:           "instanceHealthTimeoutFlag",
+	Value:        &instanceHealthTimeout,
+	DefaultValue: "30s",
+	Name:         "health-timeout",
+	Usage:        "time after which a health check is killed and considered failed",
+	Tag:          "<duration>",
+	EnvKeys:      []string{"HEALTH_TIMEOUT"},
+}
+
+// --health-retries
+var instanceHealthRetries int
+
+var instanceHealthRetriesFlag = cmdline.Flag{
+	ID:           "instanceHealthRetriesFlag",
+	Value:        &instanceHealthRetries,
+	DefaultValue: 3,
+	Name:         "health-retries",
+	Usage:        "number of consecutive failed health checks after which the instance is unhealthy",
+	Tag:          "<N>",
+	EnvKeys:      []string{"HEALTH_RETRIES"},
+}
+
+// --health-start-period
+var instanceHealthStartPeriod string
+
+var instanceHealthStartPeriodFlag = cmdline.Flag{
+	ID:           "instanceHealthStartPeriodFlag",
+	Value:        &instanceHealthStartPeriod,
+	DefaultValue: "0s",
+	Name:         "health-start-period",
+	Usage:        "time after the instance start during which failed health checks are not counted",
+	Tag:          "<duration>",
+	EnvKeys:      []string{"HEALTH_START_PERIOD"},
+}
+
+// --on-unhealthy
+var instanceOnUnhealthy string
+
+var instanceOnUnhealthyFlag = cmdline.Flag{
+	ID:           "instanceOnUnhealthyFlag",
+	Value:        &instanceOnUnhealthy,
+	DefaultValue: instance.UnhealthyNone,
+	Name:         "on-unhealthy",
+	Usage:        "action taken when the instance becomes unhealthy (none, restart, stop)",
+	Tag:          "<action>",
+	EnvKeys:      []string{"ON_UNHEALTHY"},
+}
+
+// --log-max-size
+var instanceLogMaxSize string
+
+var instanceLogMaxSizeFlag = cmdline.Flag{
+	ID:           "instanceLogMaxSizeFlag",
+	Value:        &instanceLogMaxSize,
+	DefaultValue: "",
+	Name:         "log-max-size",
+	Usage:        "rotate instance log files when they reach this size (e.g. 10M), 0 disables the rotation (default from apptainer.conf)",
+	Tag:          "<size>",
+	EnvKeys:      []string{"LOG_MAX_SIZE"},
+}
+
+// --log-max-files
+var instanceLogMaxFiles int
+
+var instanceLogMaxFilesFlag = cmdline.Flag{
+	ID:           "instanceLogMaxFilesFlag",
+	Value:        &instanceLogMaxFiles,
+	DefaultValue: 5,
+	Name:         "log-max-files",
+	Usage:        "number of rotated instance log files kept",
+	Tag:          "<N>",
+	EnvKeys:      []string{"LOG_MAX_FILES"},
+}
+
+// instanceLogMaxBytes is the parsed --log-max-size value, -1 to use the
+// 'instance log max size' directive.
+var instanceLogMaxBytes int64 = -1
+
+// instanceNotifyDir is the host directory holding the readiness
+// notification socket of the instance.
+var instanceNotifyDir string
+
+// instanceScript is the container script executed by the instance
+// start or run command.
+var instanceScript string
+
+// instanceHealthCheck returns the health check configuration set by the
+// --health-* flags, or nil if no health check command is set.
+func instanceHealthCheck() (*instance.HealthCheck, error) {
+	if instanceHealthCmd == "" {
+		return nil, nil
+	}
+
+	hc := &instance.HealthCheck{
+		Cmd:         instanceHealthCmd,
+		Retries:     instanceHealthRetries,
+		OnUnhealthy: instanceOnUnhealthy,
+	}
+	durations := []struct {
+		name  string
+		value string
+		d     *time.Duration
+	}{
+		{"health-interval", instanceHealthInterval, &hc.Interval},
+		{"health-timeout", instanceHealthTimeout, &hc.Timeout},
+		{"health-start-period", instanceHealthStartPeriod, &hc.StartPeriod},
+	}
+	for _, d := range durations {
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s value %q: %w", d.name, d.value, err)
+		}
+		*d.d = v
+	}
+
+	return hc, hc.Validate()
+}
+
+// instancePreRun runs the instance start or run command on behalf of the
+// user set with --user, or prepares its execution for the current user.
+func instancePreRun(cmd *cobra.Command, args []string) {
+	if instanceStartEnabled {
+		return
+	}
+	if instanceStartUser != "" {
+		u, err := user.GetPwNam(instanceStartUser)
+		if err != nil {
+			sylog.Fatalf("Could not find user %s: %s", instanceStartUser, err)
+		}
+		// the delegated command runs as the user, with --user set
+		if int(u.UID) != os.Getuid() {
+			if os.Getuid() != 0 {
+				sylog.Fatalf("Only root user can start instances on behalf of another user")
+			}
+			if buildcfg.APPTAINER_SUID_INSTALL == 0 {
+				sylog.Fatalf("Starting instances on behalf of another user requires a setuid installation")
+			}
+			apptainer.AuditInstanceDelegation(cmd.Name(), args[1], u.Name)
+			code, err := apptainer.RunAsUser(u.Name)
+			if err != nil {
+				sylog.Fatalf("While starting instance %s as user %s: %s", args[1], u.Name, err)
+			}
+			os.Exit(code)
+		}
+	}
+	actionPreRun(cmd, args)
+}
+
 // execute either the instance start or run command
 func instanceAction(cmd *cobra.Command, args []string) {
+	if instanceStartEnabled {
+		instanceStartEnabledAction()
+		return
+	}
+
 	image := args[0]
 	name := args[1]
 	cmdName := cmd.Name()
-	script := "start"
+	instanceScript = "start"
 	killCont := ""
 
 	if cmdName == "run" {
-		script = "run"
+		instanceScript = "run"
 		killCont = "kill -CONT 1; "
 	}
-	a := append([]string{killCont + "/.singularity.d/actions/" + script}, args[2:]...)
+	policy, err := instance.ParseRestartPolicy(instanceStartRestart)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if instanceLogMaxSize != "" {
+		instanceLogMaxBytes, err = units.RAMInBytes(instanceLogMaxSize)
+		if err != nil || instanceLogMaxBytes < 0 {
+			sylog.Fatalf("Invalid instance log max size %q", instanceLogMaxSize)
+		}
+	}
+
+	healthCheck, err := instanceHealthCheck()
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if instanceStartReadyTimeout < 0 {
+		sylog.Fatalf("Invalid instance ready timeout %d", instanceStartReadyTimeout)
+	}
+
+	var notify *instance.NotifySocket
+	if instanceStartReadyTimeout > 0 {
+		notify, err = instance.NewNotifySocket()
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		instanceNotifyDir = notify.Dir()
+	}
+
+	a := append([]string{killCont + "/.singularity.d/actions/" + instanceScript}, args[2:]...)
 	if err := launchContainer(cmd, image, a, name); err != nil {
+		if notify != nil {
+			notify.Close()
+		}
 		sylog.Fatalf("%s", err)
 	}
 
+	if notify != nil {
+		timeout := time.Duration(instanceStartReadyTimeout) * time.Second
+		err := notify.Wait(timeout, func() bool {
+			_, err := instance.Get(name, instance.AppSubDir)
+			return err == nil
+		})
+		notify.Close()
+		if err != nil {
+			if err := apptainer.StopInstance(name, "", nil, syscall.SIGKILL, 10*time.Second); err != nil {
+				sylog.Warningf("Failed to stop instance %s: %v", name, err)
+			}
+			sylog.Fatalf("Instance %s not ready: %s", name, err)
+		}
+		sylog.Verbosef("Instance %s is ready", name)
+	}
+
+	if err := apptainer.RecordInstanceLaunch(name, policy, healthCheck); err != nil {
+		sylog.Warningf("Failed to record instance launch configuration: %v", err)
+	} else if policy.Mode != instance.RestartNo || healthCheck != nil {
+		if err := apptainer.StartInstanceSupervisor(name); err != nil {
+			sylog.Warningf("Failed to start instance supervisor, the instance won't be restarted or checked: %v", err)
+		}
+	}
+
 	if instanceStartPidFile != "" {
 		err := apptainer.WriteInstancePidFile(name, instanceStartPidFile)
 		if err != nil {
@@ -62,10 +412,26 @@ func instanceAction(cmd *cobra.Command, args []string) {
 	}
 }
 
+// instanceStartEnabledAction starts the enabled instances, or lists
+// those which would be started with --dry-run.
+func instanceStartEnabledAction() {
+	if os.Getuid() != 0 {
+		sylog.Fatalf("Only root user can start enabled instances")
+	}
+	if err := apptainer.StartEnabledInstances(os.Stdout, dryRun); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+}
+
 // apptainer instance start
 var instanceStartCmd = &cobra.Command{
-	Args:                  cobra.MinimumNArgs(2),
-	PreRun:                actionPreRun,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if instanceStartEnabled {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.MinimumNArgs(2)(cmd, args)
+	},
+	PreRun:                instancePreRun,
 	DisableFlagsInUseLine: true,
 	Run:                   instanceAction,
 	Use:                   docs.InstanceStartUse,
@@ -77,7 +443,7 @@ var instanceStartCmd = &cobra.Command{
 // apptainer instance run
 var instanceRunCmd = &cobra.Command{
 	Args:                  cobra.MinimumNArgs(2),
-	PreRun:                actionPreRun,
+	PreRun:                instancePreRun,
 	DisableFlagsInUseLine: true,
 	Run:                   instanceAction,
 	Use:                   docs.InstanceRunUse,
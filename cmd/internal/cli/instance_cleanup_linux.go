@@ -0,0 +1,101 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// Basic Design
+// apptainer instance cleanup [--dry-run] [--all-users] [name glob]
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceCleanupDryRunFlag, instanceCleanupCmd)
+		cmdManager.RegisterFlagForCmd(&instanceCleanupAllUsersFlag, instanceCleanupCmd)
+	})
+	addPreRunHook(cleanupStaleInstances)
+}
+
+// --dry-run
+var instanceCleanupDryRun bool
+
+var instanceCleanupDryRunFlag = cmdline.Flag{
+	ID:           "instanceCleanupDryRunFlag",
+	Value:        &instanceCleanupDryRun,
+	DefaultValue: false,
+	Name:         "dry-run",
+	Usage:        "only list the stale instances and the resources which would be released",
+	EnvKeys:      []string{"DRY_RUN"},
+}
+
+// --all-users
+var instanceCleanupAllUsers bool
+
+var instanceCleanupAllUsersFlag = cmdline.Flag{
+	ID:           "instanceCleanupAllUsersFlag",
+	Value:        &instanceCleanupAllUsers,
+	DefaultValue: false,
+	Name:         "all-users",
+	Usage:        "clean up the stale instances of all users (root only)",
+}
+
+// apptainer instance cleanup
+var instanceCleanupCmd = &cobra.Command{
+	Args:                  cobra.MaximumNArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if instanceCleanupAllUsers && os.Getuid() != 0 {
+			sylog.Fatalf("Only the root user can clean up the instances of all users")
+		}
+		name := "*"
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		var err error
+		if instanceCleanupAllUsers {
+			_, err = apptainer.CleanupAllUsersInstances(name, instanceCleanupDryRun)
+		} else {
+			_, err = apptainer.CleanupInstances("", name, instanceCleanupDryRun)
+		}
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		return nil
+	},
+
+	Use:     docs.InstanceCleanupUse,
+	Short:   docs.InstanceCleanupShort,
+	Long:    docs.InstanceCleanupLong,
+	Example: docs.InstanceCleanupExample,
+}
+
+// cleanupStaleInstances releases the resources of the stale instances of
+// the current user before running an instance command. The stop command
+// cleans up the instances it matches itself to report their exit status,
+// and the supervisor must not race with the instance it restarts.
+func cleanupStaleInstances(cmd *cobra.Command) {
+	if cmd.Parent() != instanceCmd {
+		return
+	}
+	switch cmd {
+	case instanceCleanupCmd, instanceStopCmd, instanceSuperviseCmd:
+		return
+	}
+	if _, err := apptainer.CleanupInstances("", "*", false); err != nil {
+		sylog.Debugf("Could not clean up stale instances: %s", err)
+	}
+}
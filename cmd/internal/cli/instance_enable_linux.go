@@ -0,0 +1,79 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceEnableUserFlag, instanceEnableCmd, instanceDisableCmd)
+	})
+}
+
+// -u|--user
+var instanceEnableUser string
+
+var instanceEnableUserFlag = cmdline.Flag{
+	ID:           "instanceEnableUserFlag",
+	Value:        &instanceEnableUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        "enable or disable an instance belonging to user",
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// apptainer instance enable
+var instanceEnableCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if os.Getuid() != 0 {
+			sylog.Fatalf("Only root user can enable instances")
+		}
+		e, err := apptainer.EnableInstance(args[0], instanceEnableUser)
+		if err != nil {
+			sylog.Fatalf("Could not enable instance: %s", err)
+		}
+		sylog.Infof("Instance %s of user %s enabled", e.Name, e.User)
+	},
+
+	Use:     docs.InstanceEnableUse,
+	Short:   docs.InstanceEnableShort,
+	Long:    docs.InstanceEnableLong,
+	Example: docs.InstanceEnableExample,
+}
+
+// apptainer instance disable
+var instanceDisableCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if os.Getuid() != 0 {
+			sylog.Fatalf("Only root user can disable instances")
+		}
+		if err := apptainer.DisableInstance(args[0], instanceEnableUser); err != nil {
+			sylog.Fatalf("Could not disable instance: %s", err)
+		}
+	},
+
+	Use:     docs.InstanceDisableUse,
+	Short:   docs.InstanceDisableShort,
+	Long:    docs.InstanceDisableLong,
+	Example: docs.InstanceDisableExample,
+}
@@ -0,0 +1,88 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// Basic Design
+// apptainer instance events <name>
+// apptainer instance events --follow [--json] <name>
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceEventsUserFlag, instanceEventsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceEventsJSONFlag, instanceEventsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceEventsFollowFlag, instanceEventsCmd)
+	})
+}
+
+// -u|--user
+var instanceEventsUser string
+
+var instanceEventsUserFlag = cmdline.Flag{
+	ID:           "instanceEventsUserFlag",
+	Value:        &instanceEventsUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        "view events for an instance belonging to a user (root only)",
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// -j|--json
+var instanceEventsJSON bool
+
+var instanceEventsJSONFlag = cmdline.Flag{
+	ID:           "instanceEventsJSONFlag",
+	Value:        &instanceEventsJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "output events as json lines",
+}
+
+// -f|--follow
+var instanceEventsFollow bool
+
+var instanceEventsFollowFlag = cmdline.Flag{
+	ID:           "instanceEventsFollowFlag",
+	Value:        &instanceEventsFollow,
+	DefaultValue: false,
+	Name:         "follow",
+	ShortHand:    "f",
+	Usage:        "print a new record each time events occur, until the instance exits",
+}
+
+// apptainer instance events
+var instanceEventsCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Root is required to look at events for another user
+		if instanceEventsUser != "" && os.Getuid() != 0 {
+			sylog.Fatalf("Only the root user can look at events of a user's instance")
+		}
+
+		return apptainer.InstanceEvents(cmd.Context(), args[0], instanceEventsUser, instanceEventsJSON, instanceEventsFollow)
+	},
+
+	Use:     docs.InstanceEventsUse,
+	Short:   docs.InstanceEventsShort,
+	Long:    docs.InstanceEventsLong,
+	Example: docs.InstanceEventsExample,
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// Basic Design
+// apptainer instance inspect [--json] <name>
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceInspectUserFlag, instanceInspectCmd)
+		cmdManager.RegisterFlagForCmd(&instanceInspectJSONFlag, instanceInspectCmd)
+	})
+}
+
+// -u|--user
+var instanceInspectUser string
+
+var instanceInspectUserFlag = cmdline.Flag{
+	ID:           "instanceInspectUserFlag",
+	Value:        &instanceInspectUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        "inspect an instance belonging to a user (root only)",
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// -j|--json
+var instanceInspectJSON bool
+
+var instanceInspectJSONFlag = cmdline.Flag{
+	ID:           "instanceInspectJSONFlag",
+	Value:        &instanceInspectJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the instance configuration in json format",
+}
+
+// apptainer instance inspect
+var instanceInspectCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Root is required to inspect an instance of another user
+		if instanceInspectUser != "" && os.Getuid() != 0 {
+			sylog.Fatalf("Only the root user can inspect a user's instance")
+		}
+		if err := apptainer.InspectInstance(os.Stdout, args[0], instanceInspectUser, instanceInspectJSON); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		return nil
+	},
+
+	Use:     docs.InstanceInspectUse,
+	Short:   docs.InstanceInspectShort,
+	Long:    docs.InstanceInspectLong,
+	Example: docs.InstanceInspectExample,
+}
@@ -25,6 +25,16 @@ func init() {
 		cmdManager.RegisterSubCmd(instanceCmd, instanceStopCmd)
 		cmdManager.RegisterSubCmd(instanceCmd, instanceListCmd)
 		cmdManager.RegisterSubCmd(instanceCmd, instanceStatsCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceEventsCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceLogsCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceRestartCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceSuperviseCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceGenerateUnitCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceEnableCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceDisableCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceUpdateCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceInspectCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceCleanupCmd)
 	})
 }
 
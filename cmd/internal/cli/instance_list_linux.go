@@ -24,6 +24,10 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&instanceListUserFlag, instanceListCmd)
 		cmdManager.RegisterFlagForCmd(&instanceListJSONFlag, instanceListCmd)
 		cmdManager.RegisterFlagForCmd(&instanceListLogsFlag, instanceListCmd)
+		cmdManager.RegisterFlagForCmd(&instanceListEnabledFlag, instanceListCmd)
+		cmdManager.RegisterFlagForCmd(&instanceListFilterFlag, instanceListCmd)
+		cmdManager.RegisterFlagForCmd(&instanceListFormatFlag, instanceListCmd)
+		cmdManager.RegisterFlagForCmd(&instanceListQuietFlag, instanceListCmd)
 	})
 }
 
@@ -67,6 +71,73 @@ var instanceListLogsFlag = cmdline.Flag{
 	EnvKeys:      []string{"LOGS"},
 }
 
+// --enabled
+var instanceListEnabled bool
+
+var instanceListEnabledFlag = cmdline.Flag{
+	ID:           "instanceListEnabledFlag",
+	Value:        &instanceListEnabled,
+	DefaultValue: false,
+	Name:         "enabled",
+	Usage:        "list the instances enabled to start at boot instead of the running ones",
+}
+
+// --filter
+var instanceListFilter []string
+
+var instanceListFilterFlag = cmdline.Flag{
+	ID:           "instanceListFilterFlag",
+	Value:        &instanceListFilter,
+	DefaultValue: []string{},
+	Name:         "filter",
+	Usage:        "only list the instances matching a filter: name=<glob>, image=<glob>, older-than=<duration>, newer-than=<duration> or user=<username> (root only)",
+	Tag:          "<key=value>",
+}
+
+// --format
+var instanceListFormat string
+
+var instanceListFormatFlag = cmdline.Flag{
+	ID:           "instanceListFormatFlag",
+	Value:        &instanceListFormat,
+	DefaultValue: "",
+	Name:         "format",
+	Usage:        "print each instance with a Go template, see the help for the available fields",
+	Tag:          "<template>",
+}
+
+// -q|--quiet
+var instanceListQuiet bool
+
+var instanceListQuietFlag = cmdline.Flag{
+	ID:           "instanceListQuietFlag",
+	Value:        &instanceListQuiet,
+	DefaultValue: false,
+	Name:         "quiet",
+	ShortHand:    "q",
+	Usage:        "only print the instance names",
+}
+
+// instanceFilterUser parses the instance filters and returns them along
+// with the user whose instances are selected, a user filter being
+// equivalent to the --user flag.
+func instanceFilterUser(filters []string, user string) (*apptainer.InstanceFilter, string) {
+	filter, err := apptainer.ParseInstanceFilters(filters)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if filter == nil || filter.User == "" {
+		return filter, user
+	}
+	if os.Getuid() != 0 {
+		sylog.Fatalf("Only root user can filter instances by user")
+	}
+	if user != "" && user != filter.User {
+		sylog.Fatalf("The user filter %q conflicts with the user %q", filter.User, user)
+	}
+	return filter, filter.User
+}
+
 // apptainer instance list
 var instanceListCmd = &cobra.Command{
 	Args: cobra.RangeArgs(0, 1),
@@ -80,8 +151,29 @@ var instanceListCmd = &cobra.Command{
 		if instanceListUser != "" && uid != 0 {
 			sylog.Fatalf("Only root user can list user's instances")
 		}
+		filter, user := instanceFilterUser(instanceListFilter, instanceListUser)
 
-		err := apptainer.PrintInstanceList(os.Stdout, name, instanceListUser, instanceListJSON, instanceListLogs)
+		if instanceListEnabled {
+			if uid != 0 {
+				sylog.Fatalf("Only root user can list enabled instances")
+			}
+			if filter != nil {
+				sylog.Fatalf("Enabled instances can't be filtered")
+			}
+			if err := apptainer.PrintEnabledInstanceList(os.Stdout, name, user); err != nil {
+				sylog.Fatalf("Could not list enabled instances: %v", err)
+			}
+			return
+		}
+
+		opts := apptainer.InstanceListOptions{
+			JSON:   instanceListJSON,
+			Logs:   instanceListLogs,
+			Quiet:  instanceListQuiet,
+			Format: instanceListFormat,
+			Filter: filter,
+		}
+		err := apptainer.PrintInstanceList(os.Stdout, name, user, opts)
 		if err != nil {
 			sylog.Fatalf("Could not list instances: %v", err)
 		}
@@ -0,0 +1,136 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// Basic Design
+// apptainer instance logs <name>
+// apptainer instance logs --follow [--tail N] [--stdout|--stderr] [--timestamps] <name>
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceLogsUserFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsFollowFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsTailFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsStdoutFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsStderrFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsTimestampsFlag, instanceLogsCmd)
+	})
+}
+
+// -u|--user
+var instanceLogsUser string
+
+var instanceLogsUserFlag = cmdline.Flag{
+	ID:           "instanceLogsUserFlag",
+	Value:        &instanceLogsUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        "view logs of an instance belonging to a user (root only)",
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// -f|--follow
+var instanceLogsFollow bool
+
+var instanceLogsFollowFlag = cmdline.Flag{
+	ID:           "instanceLogsFollowFlag",
+	Value:        &instanceLogsFollow,
+	DefaultValue: false,
+	Name:         "follow",
+	ShortHand:    "f",
+	Usage:        "keep printing new log lines until interrupted",
+}
+
+// -n|--tail
+var instanceLogsTail int
+
+var instanceLogsTailFlag = cmdline.Flag{
+	ID:           "instanceLogsTailFlag",
+	Value:        &instanceLogsTail,
+	DefaultValue: -1,
+	Name:         "tail",
+	ShortHand:    "n",
+	Usage:        "print only the last N lines of each log file",
+	Tag:          "<N>",
+}
+
+// --stdout
+var instanceLogsStdout bool
+
+var instanceLogsStdoutFlag = cmdline.Flag{
+	ID:           "instanceLogsStdoutFlag",
+	Value:        &instanceLogsStdout,
+	DefaultValue: false,
+	Name:         "stdout",
+	Usage:        "print only the standard output log",
+}
+
+// --stderr
+var instanceLogsStderr bool
+
+var instanceLogsStderrFlag = cmdline.Flag{
+	ID:           "instanceLogsStderrFlag",
+	Value:        &instanceLogsStderr,
+	DefaultValue: false,
+	Name:         "stderr",
+	Usage:        "print only the standard error log",
+}
+
+// -t|--timestamps
+var instanceLogsTimestamps bool
+
+var instanceLogsTimestampsFlag = cmdline.Flag{
+	ID:           "instanceLogsTimestampsFlag",
+	Value:        &instanceLogsTimestamps,
+	DefaultValue: false,
+	Name:         "timestamps",
+	ShortHand:    "t",
+	Usage:        "prefix log lines with the time they were read",
+}
+
+// apptainer instance logs
+var instanceLogsCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Root is required to look at logs of another user
+		if instanceLogsUser != "" && os.Getuid() != 0 {
+			sylog.Fatalf("Only the root user can look at logs of a user's instance")
+		}
+		if instanceLogsStdout && instanceLogsStderr {
+			sylog.Fatalf("--stdout and --stderr are mutually exclusive")
+		}
+
+		opts := apptainer.InstanceLogsOptions{
+			Follow:     instanceLogsFollow,
+			Tail:       instanceLogsTail,
+			Stdout:     !instanceLogsStderr,
+			Stderr:     !instanceLogsStdout,
+			Timestamps: instanceLogsTimestamps,
+		}
+		return apptainer.InstanceLogs(cmd.Context(), args[0], instanceLogsUser, opts)
+	},
+
+	Use:     docs.InstanceLogsUse,
+	Short:   docs.InstanceLogsShort,
+	Long:    docs.InstanceLogsLong,
+	Example: docs.InstanceLogsExample,
+}
@@ -0,0 +1,68 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceRestartTimeoutFlag, instanceRestartCmd)
+	})
+}
+
+// -t|--timeout
+var instanceRestartTimeout int
+
+var instanceRestartTimeoutFlag = cmdline.Flag{
+	ID:           "instanceRestartTimeoutFlag",
+	Value:        &instanceRestartTimeout,
+	DefaultValue: 10,
+	Name:         "timeout",
+	ShortHand:    "t",
+	Usage:        "force kill the instance if not stopped after X seconds",
+}
+
+// apptainer instance restart
+var instanceRestartCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		timeout := time.Duration(instanceRestartTimeout) * time.Second
+		return apptainer.RestartInstance(args[0], timeout)
+	},
+
+	Use:     docs.InstanceRestartUse,
+	Short:   docs.InstanceRestartShort,
+	Long:    docs.InstanceRestartLong,
+	Example: docs.InstanceRestartExample,
+}
+
+// apptainer instance supervise, started by instance start/run with
+// a restart policy
+var instanceSuperviseCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Hidden:                true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, syscall.SIGINT)
+		defer stop()
+		return apptainer.InstanceSupervise(ctx, args[0])
+	},
+
+	Use: "supervise <instance name>",
+}
@@ -22,12 +22,15 @@ import (
 // Basic Design
 // apptainer instance stats <name>
 // apptainer instance stats --json <name>
+// apptainer instance stats --prometheus [--listen :9807]
 
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterFlagForCmd(&instanceStatsUserFlag, instanceStatsCmd)
 		cmdManager.RegisterFlagForCmd(&instanceStatsJSONFlag, instanceStatsCmd)
 		cmdManager.RegisterFlagForCmd(&instanceStatsNoStreamFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsPrometheusFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsListenFlag, instanceStatsCmd)
 	})
 }
 
@@ -69,9 +72,32 @@ var instanceStatsNoStreamFlag = cmdline.Flag{
 	Usage:        "disable streaming (live update) of instance stats",
 }
 
+// --prometheus
+var instanceStatsPrometheus bool
+
+var instanceStatsPrometheusFlag = cmdline.Flag{
+	ID:           "instanceStatsPrometheusFlag",
+	Value:        &instanceStatsPrometheus,
+	DefaultValue: false,
+	Name:         "prometheus",
+	Usage:        "serve stats of all instances in Prometheus text format",
+}
+
+// --listen
+var instanceStatsListen string
+
+var instanceStatsListenFlag = cmdline.Flag{
+	ID:           "instanceStatsListenFlag",
+	Value:        &instanceStatsListen,
+	DefaultValue: ":9807",
+	Name:         "listen",
+	Usage:        "address to serve Prometheus metrics on (with --prometheus)",
+	Tag:          "<address>",
+}
+
 // apptainer instance stats
 var instanceStatsCmd = &cobra.Command{
-	Args:                  cobra.ExactArgs(1),
+	Args:                  cobra.RangeArgs(0, 1),
 	DisableFlagsInUseLine: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		uid := os.Getuid()
@@ -81,6 +107,19 @@ var instanceStatsCmd = &cobra.Command{
 			sylog.Fatalf("Only the root user can look at stats of a user's instance")
 		}
 
+		if instanceStatsPrometheus {
+			if len(args) > 0 {
+				sylog.Fatalf("--prometheus serves the stats of all instances and doesn't accept an instance name")
+			}
+			return apptainer.InstanceStatsPrometheus(cmd.Context(), instanceStatsUser, instanceStatsListen)
+		}
+		if cmd.Flags().Changed("listen") {
+			sylog.Fatalf("--listen requires --prometheus")
+		}
+		if len(args) != 1 {
+			sylog.Fatalf("An instance name is required")
+		}
+
 		// Instance name is the only arg
 		name := args[0]
 		return apptainer.InstanceStats(cmd.Context(), name, instanceStatsUser, instanceStatsJSON, instanceStatsNoStream)
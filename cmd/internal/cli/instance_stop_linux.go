@@ -11,6 +11,7 @@ package cli
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"syscall"
 	"time"
@@ -30,6 +31,8 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&instanceStopForceFlag, instanceStopCmd)
 		cmdManager.RegisterFlagForCmd(&instanceStopSignalFlag, instanceStopCmd)
 		cmdManager.RegisterFlagForCmd(&instanceStopTimeoutFlag, instanceStopCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStopReleaseIPFlag, instanceStopCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStopFilterFlag, instanceStopCmd)
 	})
 }
 
@@ -56,7 +59,7 @@ var instanceStopAllFlag = cmdline.Flag{
 	DefaultValue: false,
 	Name:         "all",
 	ShortHand:    "a",
-	Usage:        "stop all user's instances",
+	Usage:        "stop all user's instances, or all those matching the instance name glob",
 	EnvKeys:      []string{"ALL"},
 }
 
@@ -69,7 +72,7 @@ var instanceStopForceFlag = cmdline.Flag{
 	DefaultValue: false,
 	Name:         "force",
 	ShortHand:    "F",
-	Usage:        "force kill instance",
+	Usage:        "kill instances immediately with SIGKILL",
 	EnvKeys:      []string{"FORCE"},
 }
 
@@ -82,7 +85,7 @@ var instanceStopSignalFlag = cmdline.Flag{
 	DefaultValue: "",
 	Name:         "signal",
 	ShortHand:    "s",
-	Usage:        "signal sent to the instance",
+	Usage:        "signal sent to the instance (default SIGINT)",
 	Tag:          "<signal>",
 	EnvKeys:      []string{"SIGNAL"},
 }
@@ -96,12 +99,37 @@ var instanceStopTimeoutFlag = cmdline.Flag{
 	DefaultValue: 10,
 	Name:         "timeout",
 	ShortHand:    "t",
-	Usage:        "force kill non stopped instances after X seconds",
+	Usage:        "grace period in seconds before instances still running are killed",
+	Tag:          "<seconds>",
+}
+
+// --release-ip
+var instanceStopReleaseIP bool
+
+var instanceStopReleaseIPFlag = cmdline.Flag{
+	ID:           "instanceStopReleaseIPFlag",
+	Value:        &instanceStopReleaseIP,
+	DefaultValue: false,
+	Name:         "release-ip",
+	Usage:        "release the network addresses kept for the instances",
+	EnvKeys:      []string{"RELEASE_IP"},
+}
+
+// --filter
+var instanceStopFilter []string
+
+var instanceStopFilterFlag = cmdline.Flag{
+	ID:           "instanceStopFilterFlag",
+	Value:        &instanceStopFilter,
+	DefaultValue: []string{},
+	Name:         "filter",
+	Usage:        "only stop the instances matching a filter: name=<glob>, image=<glob>, older-than=<duration>, newer-than=<duration> or user=<username> (root only)",
+	Tag:          "<key=value>",
 }
 
 // apptainer instance stop
 var instanceStopCmd = &cobra.Command{
-	Args:                  cobra.RangeArgs(0, 1),
+	Args:                  cobra.ArbitraryArgs,
 	DisableFlagsInUseLine: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 && !instanceStopAll {
@@ -112,6 +140,10 @@ var instanceStopCmd = &cobra.Command{
 		if instanceStopUser != "" && uid != 0 {
 			sylog.Fatalf("Only root user can stop user's instances")
 		}
+		filter, user := instanceFilterUser(instanceStopFilter, instanceStopUser)
+		if filter != nil && instanceStopReleaseIP {
+			sylog.Fatalf("--release-ip can't be used with --filter")
+		}
 
 		sig := syscall.SIGINT
 		if instanceStopSignal != "" {
@@ -125,13 +157,25 @@ var instanceStopCmd = &cobra.Command{
 			sig = syscall.SIGKILL
 		}
 
-		name := "*"
-		if len(args) > 0 {
-			name = args[0]
+		names := args
+		if len(names) == 0 {
+			names = []string{"*"}
 		}
 
-		timeout := time.Duration(instanceStopTimeout) * time.Second
-		return apptainer.StopInstance(name, instanceStopUser, sig, timeout)
+		failed := 0
+		for _, name := range names {
+			if err := stopInstance(name, user, filter, sig); err != nil {
+				if len(names) == 1 {
+					sylog.Fatalf("%s", err)
+				}
+				sylog.Errorf("%s: %s", name, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			sylog.Fatalf("Could not stop %d of %d instances", failed, len(names))
+		}
+		return nil
 	},
 
 	Use:     docs.InstanceStopUse,
@@ -139,3 +183,25 @@ var instanceStopCmd = &cobra.Command{
 	Long:    docs.InstanceStopLong,
 	Example: docs.InstanceStopExample,
 }
+
+// stopInstance stops the instances matching the name glob and releases
+// their network addresses if requested.
+func stopInstance(name, user string, filter *apptainer.InstanceFilter, sig syscall.Signal) error {
+	if user != "" {
+		apptainer.AuditInstanceDelegation("stop", name, user)
+	}
+
+	timeout := time.Duration(instanceStopTimeout) * time.Second
+	err := apptainer.StopInstance(name, user, filter, sig, timeout)
+	if instanceStopReleaseIP {
+		released, rerr := apptainer.ReleaseInstanceIPs(name, user)
+		if rerr != nil {
+			return fmt.Errorf("could not release the network addresses: %s", rerr)
+		}
+		// the addresses of stopped instances can be released
+		if len(released) > 0 && errors.Is(err, apptainer.ErrNoInstance) {
+			err = nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,216 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Basic Design
+// apptainer instance generate-unit [start options...] <image> <name> [startscript args...]
+// apptainer instance generate-unit --install [--user|--system] [--now] [start options...] <image> <name>
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceUnitInstallFlag, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceUnitUserFlag, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceUnitSystemFlag, instanceGenerateUnitCmd)
+		cmdManager.RegisterFlagForCmd(&instanceUnitNowFlag, instanceGenerateUnitCmd)
+	})
+}
+
+// --install
+var instanceUnitInstall bool
+
+var instanceUnitInstallFlag = cmdline.Flag{
+	ID:           "instanceUnitInstallFlag",
+	Value:        &instanceUnitInstall,
+	DefaultValue: false,
+	Name:         "install",
+	Usage:        "install the unit and reload the systemd service manager instead of printing it",
+}
+
+// --user
+var instanceUnitUser bool
+
+var instanceUnitUserFlag = cmdline.Flag{
+	ID:           "instanceUnitUserFlag",
+	Value:        &instanceUnitUser,
+	DefaultValue: false,
+	Name:         "user",
+	Usage:        "generate a user unit (default for non-root users)",
+}
+
+// --system
+var instanceUnitSystem bool
+
+var instanceUnitSystemFlag = cmdline.Flag{
+	ID:           "instanceUnitSystemFlag",
+	Value:        &instanceUnitSystem,
+	DefaultValue: false,
+	Name:         "system",
+	Usage:        "generate a system unit (default for root)",
+}
+
+// --now
+var instanceUnitNow bool
+
+var instanceUnitNowFlag = cmdline.Flag{
+	ID:           "instanceUnitNowFlag",
+	Value:        &instanceUnitNow,
+	DefaultValue: false,
+	Name:         "now",
+	Usage:        "enable and start the unit once installed",
+}
+
+// instanceUnitSkipFlags are the flags not passed to instance start by
+// the generated unit.
+var instanceUnitSkipFlags = map[string]bool{
+	"help":     true,
+	"install":  true,
+	"user":     true,
+	"system":   true,
+	"now":      true,
+	"pid-file": true,
+	"restart":  true,
+}
+
+// instanceUnitFlagArgs returns the instance start options for the flags
+// set on the command line.
+func instanceUnitFlagArgs(flags *pflag.FlagSet) []string {
+	var args []string
+
+	flags.Visit(func(f *pflag.Flag) {
+		if instanceUnitSkipFlags[f.Name] {
+			return
+		}
+		switch v := f.Value.(type) {
+		case pflag.SliceValue:
+			for _, s := range v.GetSlice() {
+				args = append(args, fmt.Sprintf("--%s=%s", f.Name, s))
+			}
+		default:
+			if f.Value.Type() == "bool" && f.Value.String() == "true" {
+				args = append(args, "--"+f.Name)
+			} else {
+				args = append(args, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+			}
+		}
+	})
+
+	return args
+}
+
+// instanceUnitEnv returns the Apptainer environment variables passed to
+// the generated unit.
+func instanceUnitEnv() []string {
+	var unitEnv []string
+	prefixes := append(append([]string{}, env.ApptainerPrefixes...), env.ApptainerEnvPrefixes...)
+
+	for _, e := range os.Environ() {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(e, prefix) {
+				unitEnv = append(unitEnv, e)
+				break
+			}
+		}
+	}
+	return unitEnv
+}
+
+// generate a systemd unit starting an instance
+func instanceGenerateUnit(cmd *cobra.Command, args []string) {
+	image := args[0]
+	name := args[1]
+
+	if instanceUnitUser && instanceUnitSystem {
+		sylog.Fatalf("--user and --system are mutually exclusive")
+	}
+	if instanceUnitNow && !instanceUnitInstall {
+		sylog.Fatalf("--now requires --install")
+	}
+	policy, err := instance.ParseRestartPolicy(instanceStartRestart)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		sylog.Fatalf("Could not determine apptainer path: %v", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		sylog.Fatalf("Could not get current working directory: %v", err)
+	}
+
+	// the unit may run from another directory, resolve local images
+	if _, err := os.Stat(image); err == nil {
+		image, err = filepath.Abs(image)
+		if err != nil {
+			sylog.Fatalf("Could not resolve image path: %v", err)
+		}
+	}
+
+	system := instanceUnitSystem || (!instanceUnitUser && os.Geteuid() == 0)
+	pidFile := "%t/apptainer-instance-" + name + ".pid"
+	if instanceStartPidFile != "" {
+		pidFile, err = filepath.Abs(instanceStartPidFile)
+		if err != nil {
+			sylog.Fatalf("Could not resolve pid file path: %v", err)
+		}
+	}
+
+	startArgs := instanceUnitFlagArgs(cmd.Flags())
+	startArgs = append(startArgs, image, name)
+	startArgs = append(startArgs, args[2:]...)
+
+	u := &instance.Unit{
+		Name:       name,
+		Apptainer:  self,
+		Args:       startArgs,
+		PidFile:    pidFile,
+		Restart:    policy,
+		Env:        instanceUnitEnv(),
+		WorkingDir: cwd,
+		System:     system,
+	}
+
+	if !instanceUnitInstall {
+		if err := u.Write(os.Stdout); err != nil {
+			sylog.Fatalf("Could not write systemd unit: %v", err)
+		}
+		return
+	}
+	if err := apptainer.InstallInstanceUnit(u, instanceUnitNow); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+}
+
+// apptainer instance generate-unit
+var instanceGenerateUnitCmd = &cobra.Command{
+	Args:                  cobra.MinimumNArgs(2),
+	DisableFlagsInUseLine: true,
+	Run:                   instanceGenerateUnit,
+	Use:                   docs.InstanceGenerateUnitUse,
+	Short:                 docs.InstanceGenerateUnitShort,
+	Long:                  docs.InstanceGenerateUnitLong,
+	Example:               docs.InstanceGenerateUnitExample,
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/syfs"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/sypgp"
 	"github.com/spf13/cobra"
 )
 
@@ -32,6 +33,7 @@ var (
 	keyRemovePrivate    bool   //--private option to remove only private keys
 	keyRemoveBoth       bool   //--both option to remove both public and private keys
 	keyLocalDir         string //--keysdir option for local key dir path
+	keyRemoteName       string //--remote option for the keyring of a remote
 )
 
 // -u|--url
@@ -115,6 +117,15 @@ var keyLocalDirKeyFlag = cmdline.Flag{
 	Usage:        "set local keyring dir path, an alternative way is to set environment variable 'APPTAINER_KEYSDIR'",
 }
 
+// --remote
+var keyRemoteFlag = cmdline.Flag{
+	ID:           "keyRemoteFlag",
+	Value:        &keyRemoteName,
+	DefaultValue: "",
+	Name:         "remote",
+	Usage:        "manage the public keys retrieved from the keyserver of this remote (legacy for the keys predating remote keyrings)",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(KeyCmd)
@@ -125,6 +136,13 @@ func init() {
 		cmdManager.RegisterFlagForCmd(keyNewPairCommentFlag, KeyNewPairCmd)
 		cmdManager.RegisterFlagForCmd(keyNewPairPasswordFlag, KeyNewPairCmd)
 		cmdManager.RegisterFlagForCmd(keyNewPairPushFlag, KeyNewPairCmd)
+		cmdManager.RegisterFlagForCmd(keyNewPairNoPushFlag, KeyNewPairCmd)
+		cmdManager.RegisterFlagForCmd(keyNewPairBatchFlag, KeyNewPairCmd)
+		cmdManager.RegisterFlagForCmd(keyNewPairPassphraseFileFlag, KeyNewPairCmd)
+		cmdManager.RegisterFlagForCmd(keyNewPairNoPassphraseFlag, KeyNewPairCmd)
+		cmdManager.RegisterFlagForCmd(keyNewPairAlgorithmFlag, KeyNewPairCmd)
+		cmdManager.RegisterFlagForCmd(keyNewPairExpiryFlag, KeyNewPairCmd)
+		cmdManager.RegisterFlagForCmd(keyNewPairJSONFlag, KeyNewPairCmd)
 
 		cmdManager.RegisterSubCmd(KeyCmd, KeyListCmd)
 		cmdManager.RegisterSubCmd(KeyCmd, KeySearchCmd)
@@ -138,6 +156,8 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&keySearchLongListFlag, KeySearchCmd)
 		cmdManager.RegisterFlagForCmd(&keyNewpairBitLengthFlag, KeyNewPairCmd)
 		cmdManager.RegisterFlagForCmd(&keyImportWithNewPasswordFlag, KeyImportCmd)
+		cmdManager.RegisterFlagForCmd(&keyImportGPGFlag, KeyImportCmd)
+		cmdManager.RegisterFlagForCmd(&keyImportSecretFlag, KeyImportCmd)
 
 		cmdManager.SetCmdGroup("key_group_cmd", KeyImportCmd, KeyExportCmd, KeyListCmd, KeyPullCmd, KeyPushCmd, KeyRemoveCmd)
 
@@ -151,6 +171,8 @@ func init() {
 			append(cmdManager.GetCmdGroup("key_group_cmd"), KeyNewPairCmd)...,
 		)
 
+		cmdManager.RegisterFlagForCmd(&keyRemoteFlag, KeyListCmd, KeyRemoveCmd)
+
 		// register public/private/both flags for KeyRemoveCmd only
 		cmdManager.RegisterFlagForCmd(&keyRemovePublicKeyFlag, KeyRemoveCmd)
 		cmdManager.RegisterFlagForCmd(&keyRemovePrivateKeyFlag, KeyRemoveCmd)
@@ -158,6 +180,30 @@ func init() {
 	})
 }
 
+// migrateKeyring moves the public keys of the keyring of path predating the
+// keyrings of the remotes to the legacy remote keyring.
+func migrateKeyring(path string) {
+	if err := sypgp.NewHandle(path).MigrateLegacyKeyring(); err != nil {
+		sylog.Warningf("Could not move public keys to the %s remote keyring: %v", sypgp.LegacyRemote, err)
+	}
+}
+
+// remoteKeyring returns the keyring of the remote keyRemoteName of the
+// local keyring of path.
+func remoteKeyring(path string) (*sypgp.Handle, error) {
+	if keyGlobalPubKey {
+		return nil, fmt.Errorf("--%s and --%s are mutually exclusive", keyRemoteFlag.Name, keyGlobalPubKeyFlag.Name)
+	}
+	keyring, err := sypgp.NewHandle(path).RemoteHandle(keyRemoteName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(keyring.PublicPath()); err != nil {
+		return nil, fmt.Errorf("no keyring for remote %s", keyRemoteName)
+	}
+	return keyring, nil
+}
+
 func checkGlobal(cmd *cobra.Command, args []string) {
 	if !keyGlobalPubKey || os.Geteuid() == 0 || buildcfg.APPTAINER_SUID_INSTALL == 0 {
 		return
@@ -24,6 +24,7 @@ import (
 var (
 	secretExport bool
 	armor        bool
+	gpgExport    bool
 )
 
 // -s|--secret
@@ -46,10 +47,20 @@ var keyExportArmorFlag = cmdline.Flag{
 	Usage:        "ascii armored format",
 }
 
+// --gpg
+var keyExportGPGFlag = cmdline.Flag{
+	ID:           "keyExportGPGFlag",
+	Value:        &gpgExport,
+	DefaultValue: false,
+	Name:         "gpg",
+	Usage:        "export the key with this fingerprint to the GnuPG keyring",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterFlagForCmd(&keyExportSecretFlag, KeyExportCmd)
 		cmdManager.RegisterFlagForCmd(&keyExportArmorFlag, KeyExportCmd)
+		cmdManager.RegisterFlagForCmd(&keyExportGPGFlag, KeyExportCmd)
 	})
 }
 
@@ -76,6 +87,13 @@ func exportRun(cmd *cobra.Command, args []string) {
 	}
 
 	keyring := sypgp.NewHandle(path, opts...)
+	if gpgExport {
+		if err := keyring.ExportGPGKey(args[0], secretExport); err != nil {
+			sylog.Errorf("key export command failed: %s", err)
+			os.Exit(10)
+		}
+		return
+	}
 	if secretExport {
 		err := keyring.ExportPrivateKey(args[0], armor)
 		if err != nil {
@@ -43,6 +43,25 @@ var (
 		Name:         "new-password",
 		Usage:        `set a new password to the private key`,
 	}
+
+	keyImportGPG     bool
+	keyImportGPGFlag = cmdline.Flag{
+		ID:           "keyImportGPGFlag",
+		Value:        &keyImportGPG,
+		DefaultValue: false,
+		Name:         "gpg",
+		Usage:        `import the key with this ID from the GnuPG keyring`,
+	}
+
+	keyImportSecret     bool
+	keyImportSecretFlag = cmdline.Flag{
+		ID:           "keyImportSecretFlag",
+		Value:        &keyImportSecret,
+		DefaultValue: false,
+		Name:         "secret",
+		ShortHand:    "s",
+		Usage:        `import the secret key too, with --gpg`,
+	}
 )
 
 func importRun(cmd *cobra.Command, args []string) {
@@ -55,6 +74,16 @@ func importRun(cmd *cobra.Command, args []string) {
 	}
 
 	keyring := sypgp.NewHandle(path, opts...)
+	if !keyGlobalPubKey {
+		migrateKeyring(path)
+	}
+	if keyImportGPG {
+		if err := keyring.ImportGPGKey(args[0], keyImportSecret, keyImportWithNewPassword); err != nil {
+			sylog.Errorf("key import command failed: %s", err)
+			os.Exit(2)
+		}
+		return
+	}
 	if err := keyring.ImportKey(args[0], keyImportWithNewPassword); err != nil {
 		sylog.Errorf("key import command failed: %s", err)
 		os.Exit(2)
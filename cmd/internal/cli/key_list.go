@@ -66,6 +66,20 @@ func doKeyListCmd(secret bool) error {
 	}
 
 	keyring := sypgp.NewHandle(path, opts...)
+	if !keyGlobalPubKey {
+		migrateKeyring(path)
+	}
+	if keyRemoteName != "" {
+		if secret {
+			return fmt.Errorf("remote keyrings only hold public keys")
+		}
+		rk, err := remoteKeyring(path)
+		if err != nil {
+			return err
+		}
+		keyring = rk
+	}
+
 	if !secret {
 		fmt.Printf("Public key listing (%s):\n\n", keyring.PublicPath())
 		if err := keyring.PrintPubKeyring(); err != nil {
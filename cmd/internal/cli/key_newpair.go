@@ -11,9 +11,12 @@
 package cli
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
@@ -75,6 +78,70 @@ var (
 		Usage:        "specify to push the public key to the remote keystore",
 	}
 
+	keyNewPairNoPush     bool
+	keyNewPairNoPushFlag = &cmdline.Flag{
+		ID:           "KeyNewPairNoPushFlag",
+		Value:        &keyNewPairNoPush,
+		DefaultValue: false,
+		Name:         "no-push",
+		Usage:        "specify to not push the public key to the remote keystore",
+	}
+
+	keyNewPairBatch     bool
+	keyNewPairBatchFlag = &cmdline.Flag{
+		ID:           "KeyNewPairBatchFlag",
+		Value:        &keyNewPairBatch,
+		DefaultValue: false,
+		Name:         "batch",
+		Usage:        "never prompt, fail if name, email or passphrase are not provided",
+	}
+
+	keyNewPairPassphraseFile     string
+	keyNewPairPassphraseFileFlag = &cmdline.Flag{
+		ID:           "KeyNewPairPassphraseFileFlag",
+		Value:        &keyNewPairPassphraseFile,
+		DefaultValue: "",
+		Name:         "passphrase-file",
+		Usage:        "read the key passphrase from the first line of this file",
+	}
+
+	keyNewPairNoPassphrase     bool
+	keyNewPairNoPassphraseFlag = &cmdline.Flag{
+		ID:           "KeyNewPairNoPassphraseFlag",
+		Value:        &keyNewPairNoPassphrase,
+		DefaultValue: false,
+		Name:         "no-passphrase",
+		Usage:        "generate a key without passphrase (insecure)",
+	}
+
+	keyNewPairAlgorithm     string
+	keyNewPairAlgorithmFlag = &cmdline.Flag{
+		ID:           "KeyNewPairAlgorithmFlag",
+		Value:        &keyNewPairAlgorithm,
+		DefaultValue: "rsa",
+		Name:         "algorithm",
+		Usage:        "key algorithm: rsa, ed25519, nistp256 or nistp384",
+	}
+
+	keyNewPairExpiry     string
+	keyNewPairExpiryFlag = &cmdline.Flag{
+		ID:           "KeyNewPairExpiryFlag",
+		Value:        &keyNewPairExpiry,
+		DefaultValue: "never",
+		Name:         "expiry",
+		Usage:        "key validity period in days, weeks, months or years (e.g. 30d, 2y), or never",
+	}
+
+	keyNewPairJSON     bool
+	keyNewPairJSONFlag = &cmdline.Flag{
+		ID:           "KeyNewPairJSONFlag",
+		Value:        &keyNewPairJSON,
+		DefaultValue: false,
+		Name:         "json",
+		ShortHand:    "j",
+		Usage:        "print the fingerprint, key ID and expiry of the new key in JSON format",
+	}
+
 	// KeyNewPairCmd is 'apptainer key newpair' and generate a new OpenPGP key pair
 	KeyNewPairCmd = &cobra.Command{
 		Args:                  cobra.ExactArgs(0),
@@ -92,9 +159,17 @@ type keyNewPairOptions struct {
 	PushToKeyStore bool
 }
 
+// newPairOutput is the JSON output of the generated key.
+type newPairOutput struct {
+	Fingerprint string `json:"fingerprint"`
+	KeyID       string `json:"keyid"`
+	Expiry      string `json:"expiry,omitempty"`
+}
+
 func runNewPairCmd(cmd *cobra.Command, args []string) {
 	path := keyLocalDir
 	keyring := sypgp.NewHandle(path)
+	migrateKeyring(path)
 
 	opts, err := collectInput(cmd)
 	if err != nil {
@@ -103,13 +178,36 @@ func runNewPairCmd(cmd *cobra.Command, args []string) {
 	}
 	opts.KeyLength = keyNewpairBitLength
 
-	fmt.Printf("Generating Entity and OpenPGP Key Pair... ")
+	// the standard output only holds the fingerprint in batch mode
+	out := os.Stdout
+	if keyNewPairBatch || keyNewPairJSON {
+		out = os.Stderr
+	}
+
+	fmt.Fprintf(out, "Generating Entity and OpenPGP Key Pair... ")
 	key, err := keyring.GenKeyPair(opts.GenKeyPairOptions)
 	if err != nil {
 		sylog.Errorf("creating newpair failed: %v", err)
 		os.Exit(2)
 	}
-	fmt.Printf("done\n")
+	fmt.Fprintf(out, "done\n")
+
+	if keyNewPairJSON {
+		o := newPairOutput{
+			Fingerprint: fmt.Sprintf("%X", key.PrimaryKey.Fingerprint),
+			KeyID:       key.PrimaryKey.KeyIdString(),
+		}
+		if expiry := sypgp.KeyExpiry(key); !expiry.IsZero() {
+			o.Expiry = expiry.UTC().Format(time.RFC3339)
+		}
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(o); err != nil {
+			sylog.Fatalf("Could not write JSON output: %v", err)
+		}
+	} else {
+		fmt.Printf("%X\n", key.PrimaryKey.Fingerprint)
+	}
 
 	if !opts.PushToKeyStore {
 		return
@@ -122,16 +220,64 @@ func runNewPairCmd(cmd *cobra.Command, args []string) {
 	}
 
 	if err := sypgp.PushPubkey(cmd.Context(), key, co...); err != nil {
-		fmt.Printf("Failed to push newly created key to keystore: %s\n", err)
+		fmt.Fprintf(out, "Failed to push newly created key to keystore: %s\n", err)
 	} else {
-		fmt.Println("Key successfully pushed to keystore")
+		fmt.Fprintln(out, "Key successfully pushed to keystore")
+	}
+}
+
+// readPassphraseFile returns the passphrase on the first line of path.
+func readPassphraseFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read passphrase file: %v", err)
+	}
+	p, _, _ := strings.Cut(string(b), "\n")
+	p = strings.TrimSuffix(p, "\r")
+	if p == "" {
+		return "", fmt.Errorf("empty passphrase in %s, use --%s to generate a key without passphrase", path, keyNewPairNoPassphraseFlag.Name)
 	}
+	return p, nil
 }
 
 // collectInput collects passed flags, for missed parameters will ask user input.
 func collectInput(cmd *cobra.Command) (*keyNewPairOptions, error) {
 	var genOpts keyNewPairOptions
 
+	if cmd.Flags().Changed(keyNewPairPushFlag.Name) && cmd.Flags().Changed(keyNewPairNoPushFlag.Name) {
+		return nil, fmt.Errorf("--%s and --%s are mutually exclusive", keyNewPairPushFlag.Name, keyNewPairNoPushFlag.Name)
+	}
+	passFlags := 0
+	for _, f := range []*cmdline.Flag{keyNewPairPasswordFlag, keyNewPairPassphraseFileFlag, keyNewPairNoPassphraseFlag} {
+		if cmd.Flags().Changed(f.Name) {
+			passFlags++
+		}
+	}
+	if passFlags > 1 {
+		return nil, fmt.Errorf("only one of --%s, --%s and --%s can be used",
+			keyNewPairPasswordFlag.Name, keyNewPairPassphraseFileFlag.Name, keyNewPairNoPassphraseFlag.Name)
+	}
+
+	if keyNewPairBatch {
+		for _, f := range []*cmdline.Flag{keyNewPairNameFlag, keyNewPairEmailFlag} {
+			if !cmd.Flags().Changed(f.Name) {
+				return nil, fmt.Errorf("--%s is required in batch mode", f.Name)
+			}
+		}
+		if passFlags == 0 {
+			return nil, fmt.Errorf("--%s or --%s is required in batch mode", keyNewPairPassphraseFileFlag.Name, keyNewPairNoPassphraseFlag.Name)
+		}
+	}
+
+	if cmd.Flags().Changed(keyNewPairAlgorithmFlag.Name) {
+		genOpts.Algorithm = keyNewPairAlgorithm
+	}
+	lifetime, err := sypgp.ParseKeyLifetime(keyNewPairExpiry)
+	if err != nil {
+		return nil, err
+	}
+	genOpts.Lifetime = lifetime
+
 	// check flags
 	if cmd.Flags().Changed(keyNewPairNameFlag.Name) {
 		genOpts.Name = keyNewPairName
@@ -154,7 +300,7 @@ func collectInput(cmd *cobra.Command) (*keyNewPairOptions, error) {
 		genOpts.Email = e
 	}
 
-	if cmd.Flags().Changed(keyNewPairCommentFlag.Name) {
+	if cmd.Flags().Changed(keyNewPairCommentFlag.Name) || keyNewPairBatch {
 		genOpts.Comment = keyNewPairComment
 	} else {
 		c, err := interactive.AskQuestion("Enter optional comment (e.g., development keys) : ")
@@ -164,9 +310,18 @@ func collectInput(cmd *cobra.Command) (*keyNewPairOptions, error) {
 		genOpts.Comment = c
 	}
 
-	if cmd.Flags().Changed(keyNewPairPasswordFlag.Name) {
+	switch {
+	case cmd.Flags().Changed(keyNewPairPasswordFlag.Name):
 		genOpts.Password = keyNewPairPassword
-	} else {
+	case cmd.Flags().Changed(keyNewPairPassphraseFileFlag.Name):
+		p, err := readPassphraseFile(keyNewPairPassphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		genOpts.Password = p
+	case keyNewPairNoPassphrase:
+		sylog.Warningf("Generating a key WITHOUT PASSPHRASE: anyone able to read your keyring can sign with this key!")
+	default:
 		// get a password
 		p, err := interactive.GetPassphrase("Enter a passphrase : ", 3)
 		if err != nil {
@@ -60,8 +60,12 @@ func doKeyPullCmd(ctx context.Context, fingerprint string, co ...client.Option)
 	}
 
 	keyring := sypgp.NewHandle(path, opts...)
+	if !keyGlobalPubKey {
+		migrateKeyring(path)
+	}
 
-	// get matching keyring
+	// get matching keyring, recording which keyserver it comes from
+	ctx, source := endpoint.WithKeyserverSource(ctx)
 	el, err := sypgp.FetchPubkey(ctx, fingerprint, false, co...)
 	if err != nil {
 		return fmt.Errorf("unable to pull key from server: %v", err)
@@ -91,6 +95,9 @@ func doKeyPullCmd(ctx context.Context, fingerprint string, co ...client.Option)
 			if err = e.Serialize(fp); err != nil {
 				return fmt.Errorf("unable to serialize key: %v", err)
 			}
+			if err := keyring.SetKeySource(e.PrimaryKey.Fingerprint, source()); err != nil {
+				sylog.Warningf("Could not record the keyserver of the key: %v", err)
+			}
 			count++
 		}
 	}
@@ -33,6 +33,19 @@ var KeyRemoveCmd = &cobra.Command{
 		}
 
 		keyring := sypgp.NewHandle(path, opts...)
+		if !keyGlobalPubKey {
+			migrateKeyring(path)
+		}
+		if keyRemoteName != "" {
+			if keyRemovePrivate || keyRemoveBoth {
+				sylog.Fatalf("Remote keyrings only hold public keys")
+			}
+			rk, err := remoteKeyring(path)
+			if err != nil {
+				sylog.Fatalf("Unable to remove public key: %s", err)
+			}
+			keyring = rk
+		}
 
 		if (keyRemovePrivate && keyRemovePublic) || keyRemoveBoth {
 			pubErr := keyring.RemovePubKey(args[0])
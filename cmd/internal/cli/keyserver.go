@@ -15,6 +15,7 @@ import (
 
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/spf13/cobra"
@@ -23,6 +24,10 @@ import (
 var (
 	keyserverInsecure bool
 	keyserverOrder    uint32
+	keyserverNoPush   bool
+	keyserverNoSearch bool
+	keyserverNoVerify bool
+	keyserverStatus   bool
 )
 
 // -i|--insecure
@@ -45,6 +50,43 @@ var keyserverOrderFlag = cmdline.Flag{
 	Usage:        "define the keyserver order",
 }
 
+// --no-push
+var keyserverNoPushFlag = cmdline.Flag{
+	ID:           "keyserverNoPushFlag",
+	Value:        &keyserverNoPush,
+	DefaultValue: false,
+	Name:         "no-push",
+	Usage:        "don't use the keyserver to push keys",
+}
+
+// --no-search
+var keyserverNoSearchFlag = cmdline.Flag{
+	ID:           "keyserverNoSearchFlag",
+	Value:        &keyserverNoSearch,
+	DefaultValue: false,
+	Name:         "no-search",
+	Usage:        "don't use the keyserver to search and pull keys",
+}
+
+// --no-verify
+var keyserverNoVerifyFlag = cmdline.Flag{
+	ID:           "keyserverNoVerifyFlag",
+	Value:        &keyserverNoVerify,
+	DefaultValue: false,
+	Name:         "no-verify",
+	Usage:        "don't query the keyserver for keys during verification",
+}
+
+// -s|--status
+var keyserverStatusFlag = cmdline.Flag{
+	ID:           "keyserverStatusFlag",
+	Value:        &keyserverStatus,
+	DefaultValue: false,
+	Name:         "status",
+	ShortHand:    "s",
+	Usage:        "query the keyservers and show their reachability and response time",
+}
+
 // -u|--username
 var keyserverLoginUsernameFlag = cmdline.Flag{
 	ID:           "keyserverLoginUsernameFlag",
@@ -87,6 +129,11 @@ func init() {
 
 		cmdManager.RegisterFlagForCmd(&keyserverOrderFlag, KeyserverAddCmd)
 		cmdManager.RegisterFlagForCmd(&keyserverInsecureFlag, KeyserverAddCmd)
+		cmdManager.RegisterFlagForCmd(&keyserverNoPushFlag, KeyserverAddCmd)
+		cmdManager.RegisterFlagForCmd(&keyserverNoSearchFlag, KeyserverAddCmd)
+		cmdManager.RegisterFlagForCmd(&keyserverNoVerifyFlag, KeyserverAddCmd)
+
+		cmdManager.RegisterFlagForCmd(&keyserverStatusFlag, KeyserverListCmd)
 
 		cmdManager.RegisterFlagForCmd(&keyserverLoginUsernameFlag, KeyserverLoginCmd)
 		cmdManager.RegisterFlagForCmd(&keyserverLoginPasswordFlag, KeyserverLoginCmd)
@@ -122,7 +169,18 @@ var KeyserverAddCmd = &cobra.Command{
 			sylog.Fatalf("order must be > 0")
 		}
 
-		if err := apptainer.KeyserverAdd(name, uri, keyserverOrder, keyserverInsecure); err != nil {
+		var disabledOps []endpoint.KeyserverOp
+		if keyserverNoPush {
+			disabledOps = append(disabledOps, endpoint.KeyserverPushOp)
+		}
+		if keyserverNoSearch {
+			disabledOps = append(disabledOps, endpoint.KeyserverSearchOp)
+		}
+		if keyserverNoVerify {
+			disabledOps = append(disabledOps, endpoint.KeyserverVerifyOp)
+		}
+
+		if err := apptainer.KeyserverAdd(name, uri, keyserverOrder, keyserverInsecure, disabledOps...); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 	},
@@ -215,7 +273,7 @@ var KeyserverListCmd = &cobra.Command{
 		if len(args) > 0 {
 			remoteName = args[0]
 		}
-		if err := apptainer.KeyserverList(remoteName, remoteConfig); err != nil {
+		if err := apptainer.KeyserverList(remoteName, remoteConfig, keyserverStatus); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 	},
@@ -0,0 +1,124 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/spf13/cobra"
+)
+
+// networkCreateConfig holds the flags of the network create command.
+var networkCreateConfig apptainer.NetworkCreateConfig
+
+// --driver
+var networkDriverFlag = cmdline.Flag{
+	ID:           "networkDriverFlag",
+	Value:        &networkCreateConfig.Driver,
+	DefaultValue: "bridge",
+	Name:         "driver",
+	Usage:        "driver of the network, only bridge is supported",
+}
+
+// --subnet
+var networkSubnetFlag = cmdline.Flag{
+	ID:           "networkSubnetFlag",
+	Value:        &networkCreateConfig.Subnet,
+	DefaultValue: "",
+	Name:         "subnet",
+	Usage:        "IPv4 subnet of the network, e.g. 10.88.1.0/24",
+	Tag:          "<cidr>",
+}
+
+// --gateway
+var networkGatewayFlag = cmdline.Flag{
+	ID:           "networkGatewayFlag",
+	Value:        &networkCreateConfig.Gateway,
+	DefaultValue: "",
+	Name:         "gateway",
+	Usage:        "IPv4 gateway of the network (default: first address of the subnet)",
+	Tag:          "<ip>",
+}
+
+// --internal
+var networkInternalFlag = cmdline.Flag{
+	ID:           "networkInternalFlag",
+	Value:        &networkCreateConfig.Internal,
+	DefaultValue: false,
+	Name:         "internal",
+	Usage:        "only connect the containers of the network to each other, without external access",
+}
+
+// --ipv6
+var networkIPv6Flag = cmdline.Flag{
+	ID:           "networkIPv6Flag",
+	Value:        &networkCreateConfig.IPv6Subnet,
+	DefaultValue: "",
+	Name:         "ipv6",
+	Usage:        "IPv6 subnet of the network, e.g. fd00:10:88:1::/64",
+	Tag:          "<cidr>",
+}
+
+// --ipv6-gateway
+var networkIPv6GatewayFlag = cmdline.Flag{
+	ID:           "networkIPv6GatewayFlag",
+	Value:        &networkCreateConfig.IPv6Gateway,
+	DefaultValue: "",
+	Name:         "ipv6-gateway",
+	Usage:        "IPv6 gateway of the network (default: first address of the IPv6 subnet)",
+	Tag:          "<ip>",
+}
+
+// -j|--json
+var networkListJSON bool
+
+var networkListJSONFlag = cmdline.Flag{
+	ID:           "networkListJSONFlag",
+	Value:        &networkListJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the networks as a JSON array",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(NetworkCmd)
+		cmdManager.RegisterSubCmd(NetworkCmd, NetworkCreateCmd)
+		cmdManager.RegisterSubCmd(NetworkCmd, NetworkListCmd)
+		cmdManager.RegisterSubCmd(NetworkCmd, NetworkInspectCmd)
+		cmdManager.RegisterSubCmd(NetworkCmd, NetworkRemoveCmd)
+
+		cmdManager.RegisterFlagForCmd(&networkDriverFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkSubnetFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkGatewayFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkInternalFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkIPv6Flag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkIPv6GatewayFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkListJSONFlag, NetworkListCmd)
+	})
+}
+
+// NetworkCmd is the root command of the network commands.
+//
+// apptainer network [...]
+var NetworkCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.NetworkUse,
+	Short:   docs.NetworkShort,
+	Long:    docs.NetworkLong,
+	Example: docs.NetworkExample,
+}
@@ -0,0 +1,34 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// NetworkListCmd lists the CNI networks of the system and of the user.
+var NetworkListCmd = &cobra.Command{
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apptainer.NetworkList(os.Stdout, networkListJSON); err != nil {
+			sylog.Fatalf("Could not list networks: %s", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.NetworkListUse,
+	Short:   docs.NetworkListShort,
+	Long:    docs.NetworkListLong,
+	Example: docs.NetworkListExample,
+}
@@ -10,6 +10,9 @@
 package cli
 
 import (
+	"os"
+	"time"
+
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/app/apptainer"
 	"github.com/apptainer/apptainer/pkg/cmdline"
@@ -132,6 +135,58 @@ var ociUpdateFromFileFlag = cmdline.Flag{
 	EnvKeys:      []string{"FROM_FILE"},
 }
 
+// -t|--tty
+var ociExecTtyFlag = cmdline.Flag{
+	ID:           "ociExecTtyFlag",
+	Value:        &ociArgs.Tty,
+	DefaultValue: false,
+	Name:         "tty",
+	ShortHand:    "t",
+	Usage:        "allocate a terminal for the command",
+}
+
+// -e|--env
+var ociExecEnvFlag = cmdline.Flag{
+	ID:           "ociExecEnvFlag",
+	Value:        &ociArgs.Env,
+	DefaultValue: []string{},
+	Name:         "env",
+	ShortHand:    "e",
+	Usage:        "set an environment variable for the command",
+	Tag:          "<NAME=VALUE>",
+}
+
+// --cwd
+var ociExecCwdFlag = cmdline.Flag{
+	ID:           "ociExecCwdFlag",
+	Value:        &ociArgs.Cwd,
+	DefaultValue: "",
+	Name:         "cwd",
+	Usage:        "absolute path of the working directory of the command",
+	Tag:          "<path>",
+}
+
+// --interval
+var ociEventsInterval string
+
+var ociEventsIntervalFlag = cmdline.Flag{
+	ID:           "ociEventsIntervalFlag",
+	Value:        &ociEventsInterval,
+	DefaultValue: "5s",
+	Name:         "interval",
+	Usage:        "interval between the stats of the container",
+	Tag:          "<duration>",
+}
+
+// --stats
+var ociEventsStatsFlag = cmdline.Flag{
+	ID:           "ociEventsStatsFlag",
+	Value:        &ociArgs.EventsStats,
+	DefaultValue: false,
+	Name:         "stats",
+	Usage:        "display the stats of the container once and exit",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(OciCmd)
@@ -148,6 +203,7 @@ func init() {
 		cmdManager.RegisterSubCmd(OciCmd, OciResumeCmd)
 		cmdManager.RegisterSubCmd(OciCmd, OciMountCmd)
 		cmdManager.RegisterSubCmd(OciCmd, OciUmountCmd)
+		cmdManager.RegisterSubCmd(OciCmd, OciEventsCmd)
 
 		cmdManager.SetCmdGroup("create_run", OciCreateCmd, OciRunCmd)
 		createRunCmd := cmdManager.GetCmdGroup("create_run")
@@ -163,6 +219,11 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&ociKillTimeoutFlag, OciKillCmd)
 		cmdManager.RegisterFlagForCmd(&ociUpdateFromFileFlag, OciUpdateCmd)
 		cmdManager.RegisterFlagForCmd(&ociSyncSocketFlag, OciStateCmd)
+		cmdManager.RegisterFlagForCmd(&ociExecTtyFlag, OciExecCmd)
+		cmdManager.RegisterFlagForCmd(&ociExecEnvFlag, OciExecCmd)
+		cmdManager.RegisterFlagForCmd(&ociExecCwdFlag, OciExecCmd)
+		cmdManager.RegisterFlagForCmd(&ociEventsIntervalFlag, OciEventsCmd)
+		cmdManager.RegisterFlagForCmd(&ociEventsStatsFlag, OciEventsCmd)
 	})
 }
 
@@ -294,7 +355,7 @@ var OciExecCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	PreRun:                CheckRoot,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := apptainer.OciExec(args[0], args[1:]); err != nil { //nolint:staticcheck
+		if err := apptainer.OciExec(args[0], args[1:], &ociArgs); err != nil { //nolint:staticcheck
 			sylog.Fatalf("%s", err)
 		}
 	},
@@ -352,6 +413,27 @@ var OciResumeCmd = &cobra.Command{
 	Example: docs.OciResumeExample,
 }
 
+// OciEventsCmd represents oci events command.
+var OciEventsCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	PreRun:                CheckRoot,
+	Run: func(cmd *cobra.Command, args []string) {
+		interval, err := time.ParseDuration(ociEventsInterval)
+		if err != nil {
+			sylog.Fatalf("Invalid --interval value %q: %s", ociEventsInterval, err)
+		}
+		ociArgs.EventsInterval = interval
+		if err := apptainer.OciEvents(args[0], &ociArgs, os.Stdout); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+	Use:     docs.OciEventsUse,
+	Short:   docs.OciEventsShort,
+	Long:    docs.OciEventsLong,
+	Example: docs.OciEventsExample,
+}
+
 // OciMountCmd represents oci mount command.
 var OciMountCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(2),
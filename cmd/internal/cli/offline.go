@@ -0,0 +1,33 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// offlineTransport is the HTTP transport used with --offline, failing all
+// the requests which would go through the default transport.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("network access to %s is disabled by --offline", req.URL.Host)
+}
+
+// setOffline disables network access for this process and the apptainer
+// processes it runs, the images being only taken from the cache.
+func setOffline() {
+	sylog.Debugf("Network access disabled, images are only taken from the cache")
+	os.Setenv("APPTAINER_OFFLINE", "1")
+	http.DefaultTransport = offlineTransport{}
+}
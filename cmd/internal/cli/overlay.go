@@ -20,6 +20,8 @@ func init() {
 
 		cmdManager.RegisterFlagForCmd(&overlaySizeFlag, OverlayCreateCmd)
 		cmdManager.RegisterFlagForCmd(&overlayCreateDirFlag, OverlayCreateCmd)
+		cmdManager.RegisterFlagForCmd(&overlayCreateDirsFlag, OverlayCreateCmd)
+		cmdManager.RegisterFlagForCmd(&overlaySIFFlag, OverlayCreateCmd)
 		cmdManager.RegisterFlagForCmd(&overlayFakerootFlag, OverlayCreateCmd)
 		cmdManager.RegisterFlagForCmd(&overlaySparseFlag, OverlayCreateCmd)
 	})
@@ -6,6 +6,8 @@
 package cli
 
 import (
+	"fmt"
+
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/app/apptainer"
 	"github.com/apptainer/apptainer/pkg/cmdline"
@@ -16,8 +18,10 @@ import (
 var (
 	overlaySize       int
 	overlayDirs       []string
+	overlayDirsList   []string
 	isOverlayFakeroot bool
 	overlaySparse     bool
+	overlaySIF        string
 )
 
 // -s|--size
@@ -50,6 +54,24 @@ var overlayCreateDirFlag = cmdline.Flag{
 	Usage:        "directory to create as part of the overlay layout",
 }
 
+// --create-dirs
+var overlayCreateDirsFlag = cmdline.Flag{
+	ID:           "overlayCreateDirsFlag",
+	Value:        &overlayDirsList,
+	DefaultValue: []string{},
+	Name:         "create-dirs",
+	Usage:        "comma-separated list of directories to create as part of the overlay layout",
+}
+
+// --sif
+var overlaySIFFlag = cmdline.Flag{
+	ID:           "overlaySIFFlag",
+	Value:        &overlaySIF,
+	DefaultValue: "",
+	Name:         "sif",
+	Usage:        "add the overlay to this existing SIF image instead of creating an overlay image",
+}
+
 // --fakeroot
 var overlayFakerootFlag = cmdline.Flag{
 	ID:           "overlayFakerootFlag",
@@ -63,9 +85,18 @@ var overlayFakerootFlag = cmdline.Flag{
 
 // OverlayCreateCmd is the 'overlay create' command that allows to create writable overlay.
 var OverlayCreateCmd = &cobra.Command{
-	Args: cobra.ExactArgs(1),
+	Args: cobra.RangeArgs(0, 1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := apptainer.OverlayCreate(overlaySize, args[0], overlaySparse, isOverlayFakeroot, overlayDirs...); err != nil {
+		imgPath := overlaySIF
+		if imgPath == "" && len(args) == 0 {
+			return fmt.Errorf("an image path or --sif is required")
+		} else if imgPath != "" && len(args) > 0 {
+			return fmt.Errorf("--sif can't be used with an image path argument")
+		} else if imgPath == "" {
+			imgPath = args[0]
+		}
+		dirs := append(overlayDirs, overlayDirsList...)
+		if err := apptainer.OverlayCreate(overlaySize, imgPath, overlaySIF != "", overlaySparse, isOverlayFakeroot, dirs...); err != nil {
 			sylog.Fatalf(err.Error())
 		}
 		return nil
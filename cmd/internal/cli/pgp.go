@@ -148,18 +148,41 @@ func isGlobal(e *openpgp.Entity) bool {
 	return len(keys) > 0
 }
 
+// keyringOf returns the keyring holding the signing entity e: global,
+// local, legacy, remote followed by the name of the remote whose keyring
+// holds it, or keyserver if it was not stored locally.
+func keyringOf(e *openpgp.Entity) string {
+	if isGlobal(e) {
+		return "global"
+	}
+	switch name := sypgp.KeyringOf(verifyKeyringRemote, e.PrimaryKey.KeyId); name {
+	case "":
+		return "keyserver"
+	case "local", sypgp.LegacyRemote:
+		return name
+	default:
+		return "remote " + name
+	}
+}
+
 // outputVerify outputs a textual representation of r to stdout.
 func outputVerify(f *sif.FileImage, r integrity.VerifyResult) bool {
 	e := r.Entity()
 
 	// Print signing entity info.
 	if e != nil {
-		prefix := color.New(color.FgYellow).Sprint("[REMOTE]")
+		keyring := keyringOf(e)
 
-		if isGlobal(e) {
+		var prefix string
+		switch keyring {
+		case "global":
 			prefix = color.New(color.FgCyan).Sprint("[GLOBAL]")
-		} else if isLocal(e) {
+		case "local":
 			prefix = color.New(color.FgGreen).Sprint("[LOCAL]")
+		case sypgp.LegacyRemote:
+			prefix = color.New(color.FgMagenta).Sprint("[LEGACY]")
+		default:
+			prefix = color.New(color.FgYellow).Sprint("[REMOTE]")
 		}
 
 		// Print identity, if possible.
@@ -169,8 +192,9 @@ func outputVerify(f *sif.FileImage, r integrity.VerifyResult) bool {
 			sylog.Warningf("Primary identity unknown")
 		}
 
-		// Always print fingerprint.
+		// Always print fingerprint, and the keyring holding the key.
 		fmt.Printf("%-18v Fingerprint: %X\n", prefix, e.PrimaryKey.Fingerprint)
+		fmt.Printf("%-18v Keyring: %v\n", prefix, keyring)
 	}
 
 	// Print table of signed objects.
@@ -214,6 +238,7 @@ type keyEntity struct {
 	Name        string
 	Fingerprint string
 	KeyLocal    bool
+	Keyring     string `json:",omitempty"`
 	KeyCheck    bool
 	DataCheck   bool
 }
@@ -227,7 +252,7 @@ type keyList struct {
 // getJSONCallback returns a signature.VerifyCallback that appends to kl.
 func getJSONCallback(kl *keyList) sifsignature.VerifyCallback {
 	return func(f *sif.FileImage, r integrity.VerifyResult) bool {
-		name, fp := "unknown", ""
+		name, fp, keyring := "unknown", "", ""
 		var keyLocal, keyCheck bool
 
 		// Increment signature count.
@@ -240,6 +265,7 @@ func getJSONCallback(kl *keyList) sifsignature.VerifyCallback {
 			}
 			fp = hex.EncodeToString(e.PrimaryKey.Fingerprint[:])
 			keyLocal = isLocal(e)
+			keyring = keyringOf(e)
 			keyCheck = true
 		}
 
@@ -250,6 +276,7 @@ func getJSONCallback(kl *keyList) sifsignature.VerifyCallback {
 				Name:        name,
 				Fingerprint: fp,
 				KeyLocal:    keyLocal,
+				Keyring:     keyring,
 				KeyCheck:    keyCheck,
 				DataCheck:   true,
 			}
@@ -269,6 +296,7 @@ func getJSONCallback(kl *keyList) sifsignature.VerifyCallback {
 				Name:        name,
 				Fingerprint: fp,
 				KeyLocal:    keyLocal,
+				Keyring:     keyring,
 				KeyCheck:    keyCheck,
 				DataCheck:   false,
 			}
@@ -0,0 +1,52 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// PluginConfigureCmd edits, validates or prints the configuration of
+// an installed plugin.
+//
+// apptainer plugin configure [--set key=value] [--unset key] [--validate] [--user] <name>
+var PluginConfigureCmd = &cobra.Command{
+	PreRun: func(cmd *cobra.Command, args []string) {
+		// only the changes of the system configuration require privileges
+		if len(pluginConfigureSet) > 0 || len(pluginConfigureUnset) > 0 {
+			checkPluginStatePriv(cmd, args)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		err := apptainer.ConfigurePlugin(args[0], apptainer.PluginConfigureOptions{
+			Set:      pluginConfigureSet,
+			Unset:    pluginConfigureUnset,
+			Validate: pluginConfigureValidate,
+			User:     pluginUser,
+		})
+		if err != nil {
+			if os.IsNotExist(err) {
+				sylog.Fatalf("Failed to configure plugin %q: plugin not found.", args[0])
+			}
+			sylog.Fatalf("Failed to configure plugin %q: %s.", args[0], err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+
+	Use:     docs.PluginConfigureUse,
+	Short:   docs.PluginConfigureShort,
+	Long:    docs.PluginConfigureLong,
+	Example: docs.PluginConfigureExample,
+}
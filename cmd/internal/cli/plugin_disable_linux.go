@@ -23,9 +23,14 @@ import (
 //
 // apptainer plugin disable <name>
 var PluginDisableCmd = &cobra.Command{
-	PreRun: CheckRootOrUnpriv,
+	PreRun: checkPluginStatePriv,
 	Run: func(cmd *cobra.Command, args []string) {
-		err := apptainer.DisablePlugin(args[0], buildcfg.LIBEXECDIR)
+		var err error
+		if pluginUser {
+			err = apptainer.DisableUserPlugin(args[0])
+		} else {
+			err = apptainer.DisablePlugin(args[0], buildcfg.LIBEXECDIR)
+		}
 		if err != nil {
 			if os.IsNotExist(err) {
 				sylog.Fatalf("Failed to disable plugin %q: plugin not found.", args[0])
@@ -22,9 +22,14 @@ import (
 //
 // apptainer plugin enable <name>
 var PluginEnableCmd = &cobra.Command{
-	PreRun: CheckRootOrUnpriv,
+	PreRun: checkPluginStatePriv,
 	Run: func(cmd *cobra.Command, args []string) {
-		err := apptainer.EnablePlugin(args[0])
+		var err error
+		if pluginUser {
+			err = apptainer.EnableUserPlugin(args[0])
+		} else {
+			err = apptainer.EnablePlugin(args[0])
+		}
 		if err != nil {
 			if os.IsNotExist(err) {
 				sylog.Fatalf("Failed to enable plugin %q: plugin not found.", args[0])
@@ -17,6 +17,64 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// --user
+var pluginUser bool
+
+var pluginUserFlag = cmdline.Flag{
+	ID:           "pluginUserFlag",
+	Value:        &pluginUser,
+	DefaultValue: false,
+	Name:         "user",
+	Usage:        "enable, disable or configure the plugin for the current user only",
+}
+
+// --set
+var pluginConfigureSet []string
+
+var pluginConfigureSetFlag = cmdline.Flag{
+	ID:           "pluginConfigureSetFlag",
+	Value:        &pluginConfigureSet,
+	DefaultValue: cmdline.StringArray{},
+	Name:         "set",
+	Usage:        "set a configuration key, nested keys are separated with dots (can be specified multiple times)",
+	Tag:          "<key=value>",
+}
+
+// --unset
+var pluginConfigureUnset []string
+
+var pluginConfigureUnsetFlag = cmdline.Flag{
+	ID:           "pluginConfigureUnsetFlag",
+	Value:        &pluginConfigureUnset,
+	DefaultValue: cmdline.StringArray{},
+	Name:         "unset",
+	Usage:        "remove a configuration key (can be specified multiple times)",
+	Tag:          "<key>",
+}
+
+// --validate
+var pluginConfigureValidate bool
+
+var pluginConfigureValidateFlag = cmdline.Flag{
+	ID:           "pluginConfigureValidateFlag",
+	Value:        &pluginConfigureValidate,
+	DefaultValue: false,
+	Name:         "validate",
+	Usage:        "check the configuration of the plugin",
+}
+
+// -j|--json
+var pluginListJSON bool
+
+var pluginListJSONFlag = cmdline.Flag{
+	ID:           "pluginListJSONFlag",
+	Value:        &pluginListJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the plugins and their state as a JSON array",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(PluginCmd)
@@ -28,6 +86,13 @@ func init() {
 		cmdManager.RegisterSubCmd(PluginCmd, PluginCompileCmd)
 		cmdManager.RegisterSubCmd(PluginCmd, PluginInspectCmd)
 		cmdManager.RegisterSubCmd(PluginCmd, PluginCreateCmd)
+		cmdManager.RegisterSubCmd(PluginCmd, PluginConfigureCmd)
+
+		cmdManager.RegisterFlagForCmd(&pluginUserFlag, PluginEnableCmd, PluginDisableCmd, PluginConfigureCmd)
+		cmdManager.RegisterFlagForCmd(&pluginConfigureSetFlag, PluginConfigureCmd)
+		cmdManager.RegisterFlagForCmd(&pluginConfigureUnsetFlag, PluginConfigureCmd)
+		cmdManager.RegisterFlagForCmd(&pluginConfigureValidateFlag, PluginConfigureCmd)
+		cmdManager.RegisterFlagForCmd(&pluginListJSONFlag, PluginListCmd)
 	})
 }
 
@@ -48,3 +113,11 @@ var PluginCmd = &cobra.Command{
 	Aliases:       []string{"plugins"},
 	SilenceErrors: true,
 }
+
+// checkPluginStatePriv checks the privileges required to change the
+// system state of a plugin, the user state can always be changed.
+func checkPluginStatePriv(cmd *cobra.Command, args []string) {
+	if !pluginUser {
+		CheckRootOrUnpriv(cmd, args)
+	}
+}
@@ -19,7 +19,7 @@ import (
 // PluginListCmd lists the plugins installed in the system.
 var PluginListCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
-		err := apptainer.ListPlugins()
+		err := apptainer.ListPlugins(pluginListJSON)
 		if err != nil {
 			sylog.Fatalf("Failed to get a list of installed plugins: %s.", err)
 		}
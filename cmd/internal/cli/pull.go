@@ -23,7 +23,9 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/client/oci"
 	"github.com/apptainer/apptainer/internal/pkg/client/oras"
 	"github.com/apptainer/apptainer/internal/pkg/client/shub"
+	"github.com/apptainer/apptainer/internal/pkg/client/urihandler"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
+	"github.com/apptainer/apptainer/internal/pkg/util/interactive"
 	"github.com/apptainer/apptainer/internal/pkg/util/uri"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -41,6 +43,10 @@ const (
 	HTTPSProtocol = "https"
 	// OrasProtocol holds the oras URI.
 	OrasProtocol = "oras"
+	// FTPProtocol holds the remote ftp base URI.
+	FTPProtocol = "ftp"
+	// SFTPProtocol holds the remote sftp base URI.
+	SFTPProtocol = "sftp"
 )
 
 var (
@@ -57,8 +63,20 @@ var (
 	pullArch string
 	// pullArchVariant is the architecture variant, e.g., arm32v5, arm32v6, arm32v7, v5,v6,v7 are variants
 	pullArchVariant string
+	// pullChecksum is the expected checksum of an image pulled from http(s), ftp or sftp.
+	pullChecksum string
 )
 
+// --checksum
+var pullChecksumFlag = cmdline.Flag{
+	ID:           "pullChecksumFlag",
+	Value:        &pullChecksum,
+	DefaultValue: "",
+	Name:         "checksum",
+	Usage:        "verify the checksum of an image pulled from http(s), ftp or sftp, as sha256:<hex> or sha512:<hex>",
+	EnvKeys:      []string{"PULL_CHECKSUM"},
+}
+
 // --arch
 var pullArchFlag = cmdline.Flag{
 	ID:           "pullArchFlag",
@@ -161,6 +179,12 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&dockerLoginFlag, PullCmd)
 
+		cmdManager.RegisterFlagForCmd(&netUsernameFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&netPasswordFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&netTokenFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&netLoginFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullChecksumFlag, PullCmd)
+
 		cmdManager.RegisterFlagForCmd(&buildNoCleanupFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullAllowUnsignedFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullAllowUnauthenticatedFlag, PullCmd)
@@ -251,7 +275,7 @@ func pullRun(cmd *cobra.Command, args []string) {
 
 		_, err = library.PullToFile(ctx, imgCache, pullTo, ref, pullArch, tmpDir, lc, co)
 		if err != nil && err != library.ErrLibraryPullUnsigned {
-			sylog.Fatalf("While pulling library image: %v", err)
+			fatalError(err, "While pulling library image: %v", err)
 		}
 		if err == library.ErrLibraryPullUnsigned {
 			sylog.Warningf("Skipping container verification")
@@ -259,7 +283,7 @@ func pullRun(cmd *cobra.Command, args []string) {
 	case ShubProtocol:
 		_, err := shub.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, noHTTPS)
 		if err != nil {
-			sylog.Fatalf("While pulling shub image: %v\n", err)
+			fatalError(err, "While pulling shub image: %v\n", err)
 		}
 	case OrasProtocol:
 		ociAuth, err := makeDockerCredentials(cmd)
@@ -267,14 +291,27 @@ func pullRun(cmd *cobra.Command, args []string) {
 			sylog.Fatalf("Unable to make docker oci credentials: %s", err)
 		}
 
-		_, err = oras.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, ociAuth, noHTTPS)
+		certDir, cleanup, err := getRegistryCertDir(pullFrom)
+		if err != nil {
+			sylog.Fatalf("Unable to get registry certificates: %v", err)
+		}
+		_, err = oras.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, ociAuth, noHTTPS, certDir)
+		cleanup()
 		if err != nil {
-			sylog.Fatalf("While pulling image from oci registry: %v", err)
+			fatalError(err, "While pulling image from oci registry: %v", err)
 		}
-	case HTTPProtocol, HTTPSProtocol:
-		_, err := net.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir)
+	case HTTPProtocol, HTTPSProtocol, FTPProtocol, SFTPProtocol:
+		auth, err := makeNetCredentials(cmd)
 		if err != nil {
-			sylog.Fatalf("While pulling from image from http(s): %v\n", err)
+			sylog.Fatalf("While reading credentials: %v", err)
+		}
+		opts := net.Options{
+			Checksum: pullChecksum,
+			Auth:     auth,
+		}
+		_, err = net.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, opts)
+		if err != nil {
+			fatalError(err, "While pulling from image from %s: %v\n", transport, err)
 		}
 	case oci.IsSupported(transport):
 		ociAuth, err := makeDockerCredentials(cmd)
@@ -287,6 +324,13 @@ func pullRun(cmd *cobra.Command, args []string) {
 			sylog.Fatalf("While processing the arch and arch variant: %v", err)
 			return
 		}
+		if transport == "docker" {
+			selectTmpDir(cmd, remoteTmpSpace(ctx, pullFrom))
+		}
+		certDir, cleanup, err := getRegistryCertDir(pullFrom)
+		if err != nil {
+			sylog.Fatalf("Unable to get registry certificates: %v", err)
+		}
 		pullOpts := oci.PullOptions{
 			TmpDir:     tmpDir,
 			OciAuth:    ociAuth,
@@ -294,15 +338,43 @@ func pullRun(cmd *cobra.Command, args []string) {
 			NoHTTPS:    noHTTPS,
 			NoCleanUp:  buildArgs.noCleanUp,
 			Pullarch:   arch,
+			CertDir:    certDir,
 		}
 
 		_, err = oci.PullToFile(ctx, imgCache, pullTo, pullFrom, pullOpts)
+		cleanup()
 		if err != nil {
-			sylog.Fatalf("While making image from oci registry: %v", err)
+			fatalError(err, "While making image from oci registry: %v", err)
 		}
 	case "":
 		sylog.Fatalf("No transport type URI supplied")
 	default:
-		sylog.Fatalf("Unsupported transport type: %s", transport)
+		h, err := urihandler.Get(transport)
+		if err != nil {
+			sylog.Fatalf("%v", err)
+		} else if h == nil {
+			sylog.Fatalf("Unsupported transport type: %s", transport)
+		}
+		if _, err := urihandler.PullToFile(ctx, imgCache, h, pullTo, pullFrom, tmpDir); err != nil {
+			fatalError(err, "While pulling %s image: %v", transport, err)
+		}
+	}
+}
+
+// makeNetCredentials returns the credentials of the http(s), ftp and sftp
+// image downloads, asking for them with --net-login.
+func makeNetCredentials(cmd *cobra.Command) (net.Auth, error) {
+	if !netLogin {
+		return netAuth, nil
+	}
+	var err error
+	usernameFlag := cmd.Flags().Lookup("net-username")
+	if usernameFlag == nil || !usernameFlag.Changed {
+		netAuth.Username, err = interactive.AskQuestion("Enter Username: ")
+		if err != nil {
+			return netAuth, err
+		}
 	}
+	netAuth.Password, err = interactive.AskQuestionNoEcho("Enter Password: ")
+	return netAuth, err
 }
@@ -17,12 +17,14 @@ import (
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/pkg/client/library"
 	"github.com/apptainer/apptainer/internal/pkg/client/oras"
+	"github.com/apptainer/apptainer/internal/pkg/client/urihandler"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	"github.com/apptainer/apptainer/internal/pkg/signature"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/internal/pkg/util/uri"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 )
 
@@ -35,6 +37,9 @@ var (
 
 	// pushDescription holds a description to be set against a library container
 	pushDescription string
+
+	// pushChunkSize holds the size of the parts of a multipart library upload
+	pushChunkSize string
 )
 
 // --library
@@ -68,6 +73,16 @@ var pushDescriptionFlag = cmdline.Flag{
 	Usage:        "description for container image (library:// only)",
 }
 
+// --chunk-size
+var pushChunkSizeFlag = cmdline.Flag{
+	ID:           "pushChunkSizeFlag",
+	Value:        &pushChunkSize,
+	DefaultValue: "",
+	Name:         "chunk-size",
+	Usage:        "size of the parts of a multipart upload, e.g. 128MiB, at least 5MiB (library:// only)",
+	EnvKeys:      []string{"PUSH_CHUNK_SIZE"},
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(PushCmd)
@@ -75,6 +90,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&pushLibraryURIFlag, PushCmd)
 		cmdManager.RegisterFlagForCmd(&pushAllowUnsignedFlag, PushCmd)
 		cmdManager.RegisterFlagForCmd(&pushDescriptionFlag, PushCmd)
+		cmdManager.RegisterFlagForCmd(&pushChunkSizeFlag, PushCmd)
 		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, PushCmd)
 
 		cmdManager.RegisterFlagForCmd(&dockerHostFlag, PushCmd)
@@ -130,9 +146,17 @@ var PushCmd = &cobra.Command{
 				}
 			}
 
-			resp, err := library.Push(cmd.Context(), file, destRef, pushDescription, lc)
+			var opts library.PushOptions
+			if pushChunkSize != "" {
+				opts.ChunkSize, err = units.RAMInBytes(pushChunkSize)
+				if err != nil {
+					sylog.Fatalf("Invalid chunk size %q: %v", pushChunkSize, err)
+				}
+			}
+
+			resp, err := library.Push(cmd.Context(), file, destRef, pushDescription, lc, opts)
 			if err != nil {
-				sylog.Fatalf("Unable to push image to library: %v", err)
+				fatalError(err, "Unable to push image to library: %v", err)
 			}
 
 			// If the library supports direct upload into an OCI backing
@@ -162,19 +186,37 @@ var PushCmd = &cobra.Command{
 			if cmd.Flag(pushDescriptionFlag.Name).Changed {
 				sylog.Warningf("Description is not supported for push to oras. Ignoring it.")
 			}
+			if cmd.Flag(pushChunkSizeFlag.Name).Changed {
+				sylog.Warningf("Chunk size is not supported for push to oras. Ignoring it.")
+			}
 			ociAuth, err := makeDockerCredentials(cmd)
 			if err != nil {
 				sylog.Fatalf("Unable to make docker oci credentials: %s", err)
 			}
 
-			if err := oras.UploadImage(cmd.Context(), file, ref, ociAuth, noHTTPS); err != nil {
-				sylog.Fatalf("Unable to push image to oci registry: %v", err)
+			certDir, cleanup, err := getRegistryCertDir(ref)
+			if err != nil {
+				sylog.Fatalf("Unable to get registry certificates: %v", err)
+			}
+			err = oras.UploadImage(cmd.Context(), file, ref, ociAuth, noHTTPS, certDir)
+			cleanup()
+			if err != nil {
+				fatalError(err, "Unable to push image to oci registry: %v", err)
 			}
 			sylog.Infof("Upload complete")
 		case "":
 			sylog.Fatalf("Transport type URI required but not supplied")
 		default:
-			sylog.Fatalf("Unsupported transport type: %s", transport)
+			h, err := urihandler.Get(transport)
+			if err != nil {
+				sylog.Fatalf("%v", err)
+			} else if h == nil {
+				sylog.Fatalf("Unsupported transport type: %s", transport)
+			}
+			if err := urihandler.Push(cmd.Context(), h, file, dest); err != nil {
+				fatalError(err, "Unable to push image: %v", err)
+			}
+			sylog.Infof("Upload complete")
 		}
 	},
 
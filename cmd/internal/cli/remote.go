@@ -20,6 +20,7 @@ import (
 	"github.com/apptainer/apptainer/internal/app/apptainer"
 	"github.com/apptainer/apptainer/internal/pkg/client/library"
 	"github.com/apptainer/apptainer/internal/pkg/remote"
+	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/syfs"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -44,6 +45,18 @@ var (
 	remoteUseExclusive      bool
 	remoteAddInsecure       bool
 	remoteAddNotDefault     bool
+	loginOIDC               bool
+	loginOIDCIssuer         string
+	loginOIDCClientID       string
+	loginOIDCPassphrase     bool
+	remoteAddCACert         string
+	remoteAddClientCert     string
+	remoteAddClientKey      string
+	remoteStatusRequire     []string
+	remoteStatusJSON        bool
+	remoteExportTokens      bool
+	remoteImportMerge       bool
+	remoteImportReplace     bool
 )
 
 // assemble values of remoteConfig for user/sys locations
@@ -129,6 +142,42 @@ var remoteLoginInsecureFlag = cmdline.Flag{
 	EnvKeys:      []string{"LOGIN_INSECURE"},
 }
 
+// --oidc
+var remoteLoginOIDCFlag = cmdline.Flag{
+	ID:           "remoteLoginOIDCFlag",
+	Value:        &loginOIDC,
+	DefaultValue: false,
+	Name:         "oidc",
+	Usage:        "login with the OIDC device authorization flow, the access token being refreshed on use",
+}
+
+// --oidc-issuer
+var remoteLoginOIDCIssuerFlag = cmdline.Flag{
+	ID:           "remoteLoginOIDCIssuerFlag",
+	Value:        &loginOIDCIssuer,
+	DefaultValue: "",
+	Name:         "oidc-issuer",
+	Usage:        "URL of the OIDC issuer, if not configured for the remote",
+}
+
+// --oidc-client-id
+var remoteLoginOIDCClientIDFlag = cmdline.Flag{
+	ID:           "remoteLoginOIDCClientIDFlag",
+	Value:        &loginOIDCClientID,
+	DefaultValue: "",
+	Name:         "oidc-client-id",
+	Usage:        "OIDC client ID, if not configured for the remote (default \"apptainer\")",
+}
+
+// --oidc-passphrase
+var remoteLoginOIDCPassphraseFlag = cmdline.Flag{
+	ID:           "remoteLoginOIDCPassphraseFlag",
+	Value:        &loginOIDCPassphrase,
+	DefaultValue: false,
+	Name:         "oidc-passphrase",
+	Usage:        "protect the OIDC refresh token with a passphrase rather than a key of the login keyring",
+}
+
 // -e|--exclusive
 var remoteUseExclusiveFlag = cmdline.Flag{
 	ID:           "remoteUseExclusiveFlag",
@@ -180,6 +229,79 @@ var remoteAddNotDefaultFlag = cmdline.Flag{
 	Usage:        "do not designate the newly-added remote endpoint as the default",
 }
 
+// --ca-cert
+var remoteAddCACertFlag = cmdline.Flag{
+	ID:           "remoteAddCACertFlag",
+	Value:        &remoteAddCACert,
+	DefaultValue: "",
+	Name:         "ca-cert",
+	Usage:        "path to a PEM CA bundle trusted for the services of the remote endpoint",
+}
+
+// --client-cert
+var remoteAddClientCertFlag = cmdline.Flag{
+	ID:           "remoteAddClientCertFlag",
+	Value:        &remoteAddClientCert,
+	DefaultValue: "",
+	Name:         "client-cert",
+	Usage:        "path to a PEM client certificate for mutual TLS with the services of the remote endpoint",
+}
+
+// --client-key
+var remoteAddClientKeyFlag = cmdline.Flag{
+	ID:           "remoteAddClientKeyFlag",
+	Value:        &remoteAddClientKey,
+	DefaultValue: "",
+	Name:         "client-key",
+	Usage:        "path to the PEM private key of the client certificate, with mode 0600",
+}
+
+// --require
+var remoteStatusRequireFlag = cmdline.Flag{
+	ID:           "remoteStatusRequireFlag",
+	Value:        &remoteStatusRequire,
+	DefaultValue: []string{},
+	Name:         "require",
+	Usage:        "a list of the services which must be reachable, e.g. library,keyserver (default all)",
+}
+
+// -j|--json
+var remoteStatusJSONFlag = cmdline.Flag{
+	ID:           "remoteStatusJSONFlag",
+	Value:        &remoteStatusJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the status of the remote endpoint as JSON",
+}
+
+// --insecure-include-tokens
+var remoteExportTokensFlag = cmdline.Flag{
+	ID:           "remoteExportTokensFlag",
+	Value:        &remoteExportTokens,
+	DefaultValue: false,
+	Name:         "insecure-include-tokens",
+	Usage:        "include the authentication tokens and credentials in the exported file",
+}
+
+// --merge
+var remoteImportMergeFlag = cmdline.Flag{
+	ID:           "remoteImportMergeFlag",
+	Value:        &remoteImportMerge,
+	DefaultValue: false,
+	Name:         "merge",
+	Usage:        "merge the imported remotes with the existing ones (default)",
+}
+
+// --replace
+var remoteImportReplaceFlag = cmdline.Flag{
+	ID:           "remoteImportReplaceFlag",
+	Value:        &remoteImportReplace,
+	DefaultValue: false,
+	Name:         "replace",
+	Usage:        "replace the existing remotes with the imported ones",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(RemoteCmd)
@@ -190,6 +312,8 @@ func init() {
 		cmdManager.RegisterSubCmd(RemoteCmd, RemoteLoginCmd)
 		cmdManager.RegisterSubCmd(RemoteCmd, RemoteLogoutCmd)
 		cmdManager.RegisterSubCmd(RemoteCmd, RemoteStatusCmd)
+		cmdManager.RegisterSubCmd(RemoteCmd, RemoteExportCmd)
+		cmdManager.RegisterSubCmd(RemoteCmd, RemoteImportCmd)
 		cmdManager.RegisterSubCmd(RemoteCmd, RemoteAddKeyserverCmd)
 		cmdManager.RegisterSubCmd(RemoteCmd, RemoteRemoveKeyserverCmd)
 		cmdManager.RegisterSubCmd(RemoteCmd, RemoteGetLoginPasswordCmd)
@@ -198,21 +322,35 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&remoteConfigFlag, RemoteCmd)
 		// use tokenfile to log in to a remote
 		cmdManager.RegisterFlagForCmd(&remoteTokenFileFlag, RemoteLoginCmd, RemoteAddCmd)
-		// add --global flag to remote add/remove/use commands
-		cmdManager.RegisterFlagForCmd(&remoteGlobalFlag, RemoteAddCmd, RemoteRemoveCmd, RemoteUseCmd)
+		// add --global flag to remote add/remove/use/export/import commands
+		cmdManager.RegisterFlagForCmd(&remoteGlobalFlag, RemoteAddCmd, RemoteRemoveCmd, RemoteUseCmd, RemoteExportCmd, RemoteImportCmd)
 		// add --no-login flag to add command
 		cmdManager.RegisterFlagForCmd(&remoteNoLoginFlag, RemoteAddCmd)
 		// add --insecure, --no-login flags to add command
 		cmdManager.RegisterFlagForCmd(&remoteAddInsecureFlag, RemoteAddCmd)
 		cmdManager.RegisterFlagForCmd(&remoteAddNotDefaultFlag, RemoteAddCmd)
+		cmdManager.RegisterFlagForCmd(&remoteAddCACertFlag, RemoteAddCmd)
+		cmdManager.RegisterFlagForCmd(&remoteAddClientCertFlag, RemoteAddCmd)
+		cmdManager.RegisterFlagForCmd(&remoteAddClientKeyFlag, RemoteAddCmd)
 
 		cmdManager.RegisterFlagForCmd(&remoteLoginUsernameFlag, RemoteLoginCmd)
 		cmdManager.RegisterFlagForCmd(&remoteLoginPasswordFlag, RemoteLoginCmd)
 		cmdManager.RegisterFlagForCmd(&remoteLoginPasswordStdinFlag, RemoteLoginCmd)
 		cmdManager.RegisterFlagForCmd(&remoteLoginInsecureFlag, RemoteLoginCmd)
+		cmdManager.RegisterFlagForCmd(&remoteLoginOIDCFlag, RemoteLoginCmd)
+		cmdManager.RegisterFlagForCmd(&remoteLoginOIDCIssuerFlag, RemoteLoginCmd)
+		cmdManager.RegisterFlagForCmd(&remoteLoginOIDCClientIDFlag, RemoteLoginCmd)
+		cmdManager.RegisterFlagForCmd(&remoteLoginOIDCPassphraseFlag, RemoteLoginCmd)
 
 		cmdManager.RegisterFlagForCmd(&remoteUseExclusiveFlag, RemoteUseCmd)
 
+		cmdManager.RegisterFlagForCmd(&remoteStatusRequireFlag, RemoteStatusCmd)
+		cmdManager.RegisterFlagForCmd(&remoteStatusJSONFlag, RemoteStatusCmd)
+
+		cmdManager.RegisterFlagForCmd(&remoteExportTokensFlag, RemoteExportCmd)
+		cmdManager.RegisterFlagForCmd(&remoteImportMergeFlag, RemoteImportCmd)
+		cmdManager.RegisterFlagForCmd(&remoteImportReplaceFlag, RemoteImportCmd)
+
 		cmdManager.RegisterFlagForCmd(&remoteKeyserverOrderFlag, RemoteAddKeyserverCmd)
 		cmdManager.RegisterFlagForCmd(&remoteKeyserverInsecureFlag, RemoteAddKeyserverCmd)
 	})
@@ -291,8 +429,14 @@ var RemoteAddCmd = &cobra.Command{
 			sylog.Fatalf("http URI requires --insecure or APPTAINER_ADD_INSECURE=true")
 		}
 
+		tlsFiles := endpoint.TLSFiles{
+			CACert:     remoteAddCACert,
+			ClientCert: remoteAddClientCert,
+			ClientKey:  remoteAddClientKey,
+		}
+
 		makeDefault := !remoteAddNotDefault
-		if err := apptainer.RemoteAdd(remoteConfig, name, uri, global, localInsecure, makeDefault); err != nil {
+		if err := apptainer.RemoteAdd(remoteConfig, name, uri, global, localInsecure, makeDefault, tlsFiles); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 		sylog.Infof("Remote %q added.", name)
@@ -392,6 +536,14 @@ var RemoteLoginCmd = &cobra.Command{
 		loginArgs.Password = loginPassword
 		loginArgs.Tokenfile = loginTokenFile
 		loginArgs.Insecure = loginInsecure
+		loginArgs.OIDC = loginOIDC
+		loginArgs.OIDCIssuer = loginOIDCIssuer
+		loginArgs.OIDCClientID = loginOIDCClientID
+		loginArgs.OIDCPassphrase = loginOIDCPassphrase
+
+		if loginOIDC && loginTokenFile != "" {
+			sylog.Fatalf("--oidc and --tokenfile are mutually exclusive")
+		}
 
 		if loginPasswordStdin {
 			p, err := io.ReadAll(os.Stdin)
@@ -449,7 +601,7 @@ var RemoteStatusCmd = &cobra.Command{
 			name = args[0]
 		}
 
-		if err := apptainer.RemoteStatus(remoteConfig, name); err != nil {
+		if err := apptainer.RemoteStatus(remoteConfig, name, remoteStatusRequire, remoteStatusJSON); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 	},
@@ -462,6 +614,48 @@ var RemoteStatusCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 }
 
+// RemoteExportCmd apptainer remote export [file]
+var RemoteExportCmd = &cobra.Command{
+	Args:   cobra.ExactArgs(1),
+	PreRun: setGlobalRemoteConfig,
+	Run: func(cmd *cobra.Command, args []string) {
+		if remoteExportTokens {
+			sylog.Warningf("Authentication tokens and credentials are written to %s", args[0])
+		}
+		if err := apptainer.RemoteExport(remoteConfig, args[0], remoteExportTokens); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+
+	Use:     docs.RemoteExportUse,
+	Short:   docs.RemoteExportShort,
+	Long:    docs.RemoteExportLong,
+	Example: docs.RemoteExportExample,
+
+	DisableFlagsInUseLine: true,
+}
+
+// RemoteImportCmd apptainer remote import [file]
+var RemoteImportCmd = &cobra.Command{
+	Args:   cobra.ExactArgs(1),
+	PreRun: setGlobalRemoteConfig,
+	Run: func(cmd *cobra.Command, args []string) {
+		if remoteImportMerge && remoteImportReplace {
+			sylog.Fatalf("--merge and --replace are mutually exclusive")
+		}
+		if err := apptainer.RemoteImport(remoteConfig, args[0], global, remoteImportReplace); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+
+	Use:     docs.RemoteImportUse,
+	Short:   docs.RemoteImportShort,
+	Long:    docs.RemoteImportLong,
+	Example: docs.RemoteImportExample,
+
+	DisableFlagsInUseLine: true,
+}
+
 // RemoteAddKeyserverCmd apptainer remote add-keyserver (deprecated)
 var RemoteAddKeyserverCmd = &cobra.Command{
 	Args: cobra.RangeArgs(1, 2),
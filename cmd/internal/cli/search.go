@@ -11,10 +11,12 @@
 package cli
 
 import (
+	"fmt"
 	"runtime"
 
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/pkg/client/library"
+	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	"github.com/apptainer/apptainer/internal/pkg/util/uri"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -29,6 +31,16 @@ var (
 	SearchArch string
 	// SearchSigned is set true to only search for signed containers
 	SearchSigned bool
+	// SearchOwner holds the entity owning the images to display in search results
+	SearchOwner string
+	// SearchLimit holds the number of images per page of search results
+	SearchLimit int
+	// SearchPage holds the page of search results to display
+	SearchPage int
+	// SearchJSON is set true to display search results as JSON
+	SearchJSON bool
+	// SearchRemote holds the name of the remote endpoint to search
+	SearchRemote string
 )
 
 // --library
@@ -61,6 +73,52 @@ var searchSignedFlag = cmdline.Flag{
 	EnvKeys:      []string{"SEARCH_SIGNED"},
 }
 
+// --owner
+var searchOwnerFlag = cmdline.Flag{
+	ID:           "searchOwnerFlag",
+	Value:        &SearchOwner,
+	DefaultValue: "",
+	Name:         "owner",
+	Usage:        "search for only images owned by this entity",
+}
+
+// --limit
+var searchLimitFlag = cmdline.Flag{
+	ID:           "searchLimitFlag",
+	Value:        &SearchLimit,
+	DefaultValue: 0,
+	Name:         "limit",
+	Usage:        "number of images per page of results (default all)",
+}
+
+// --page
+var searchPageFlag = cmdline.Flag{
+	ID:           "searchPageFlag",
+	Value:        &SearchPage,
+	DefaultValue: 1,
+	Name:         "page",
+	Usage:        "page of results to display, with --limit",
+}
+
+// -j|--json
+var searchJSONFlag = cmdline.Flag{
+	ID:           "searchJSONFlag",
+	Value:        &SearchJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the results as JSON",
+}
+
+// --remote
+var searchRemoteFlag = cmdline.Flag{
+	ID:           "searchRemoteFlag",
+	Value:        &SearchRemote,
+	DefaultValue: "",
+	Name:         "remote",
+	Usage:        "name of the remote endpoint to search (default the active one)",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(SearchCmd)
@@ -68,6 +126,11 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&searchLibraryFlag, SearchCmd)
 		cmdManager.RegisterFlagForCmd(&searchArchFlag, SearchCmd)
 		cmdManager.RegisterFlagForCmd(&searchSignedFlag, SearchCmd)
+		cmdManager.RegisterFlagForCmd(&searchOwnerFlag, SearchCmd)
+		cmdManager.RegisterFlagForCmd(&searchLimitFlag, SearchCmd)
+		cmdManager.RegisterFlagForCmd(&searchPageFlag, SearchCmd)
+		cmdManager.RegisterFlagForCmd(&searchJSONFlag, SearchCmd)
+		cmdManager.RegisterFlagForCmd(&searchRemoteFlag, SearchCmd)
 	})
 }
 
@@ -81,7 +144,20 @@ var SearchCmd = &cobra.Command{
 			sylog.Fatalf("URI protocols not supported in search query")
 		}
 
-		config, err := getLibraryClientConfig(SearchLibraryURI)
+		var config *client.Config
+		var err error
+		if SearchRemote != "" {
+			var ep *endpoint.Config
+			ep, err = getNamedRemote(SearchRemote)
+			if err == nil {
+				config, err = ep.LibraryClientConfig(SearchLibraryURI)
+			}
+			if err == nil && config.BaseURL == "" {
+				err = fmt.Errorf("remote %s has no library client", SearchRemote)
+			}
+		} else {
+			config, err = getLibraryClientConfig(SearchLibraryURI)
+		}
 		if err != nil {
 			sylog.Fatalf("Error while getting library client config: %v", err)
 		}
@@ -91,7 +167,14 @@ var SearchCmd = &cobra.Command{
 			sylog.Fatalf("Error initializing library client: %v", err)
 		}
 
-		if err := library.SearchLibrary(cmd.Context(), libraryClient, args[0], SearchArch, SearchSigned); err != nil {
+		opts := library.SearchOptions{
+			Arch:   SearchArch,
+			Signed: SearchSigned,
+			Owner:  SearchOwner,
+			Limit:  SearchLimit,
+			Page:   SearchPage,
+		}
+		if err := library.SearchLibrary(cmd.Context(), libraryClient, args[0], opts, SearchJSON); err != nil {
 			sylog.Fatalf("Couldn't search library: %v", err)
 		}
 	},
@@ -26,6 +26,7 @@ var (
 	priKeyPath string
 	priKeyIdx  int
 	signAll    bool
+	signGPGKey string
 )
 
 // -g|--group-id
@@ -88,6 +89,15 @@ var signKeyIdxFlag = cmdline.Flag{
 	Usage:        "PGP private key to use (index from 'key list --secret')",
 }
 
+// --use-gpg-agent
+var signGPGAgentFlag = cmdline.Flag{
+	ID:           "signGPGAgentFlag",
+	Value:        &signGPGKey,
+	DefaultValue: "",
+	Name:         "use-gpg-agent",
+	Usage:        "sign with the key of the GnuPG keyring with this ID, held by gpg-agent",
+}
+
 // -a|--all (deprecated)
 var signAllFlag = cmdline.Flag{
 	ID:           "signAllFlag",
@@ -110,6 +120,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&signPrivateKeyFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signKeyIdxFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signAllFlag, SignCmd)
+		cmdManager.RegisterFlagForCmd(&signGPGAgentFlag, SignCmd)
 	})
 }
 
@@ -143,6 +154,11 @@ func doSignCmd(cmd *cobra.Command, cpath string) {
 		}
 		opts = append(opts, sifsignature.OptSignWithSigner(s))
 
+	case cmd.Flag(signGPGAgentFlag.Name).Changed:
+		sylog.Infof("Signing image with key %s held by gpg-agent", signGPGKey)
+
+		opts = append(opts, sifsignature.OptSignWithGPGAgent(signGPGKey))
+
 	default:
 		sylog.Infof("Signing image with PGP key material")
 
@@ -0,0 +1,219 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/runtime/launch"
+	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/sif/v2/pkg/sif"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+const (
+	// stdinImageArg is the image argument reading a SIF image from stdin.
+	stdinImageArg = "-"
+	// stdinImageMaxSizeEnv sets the maximum size of an image read from
+	// stdin, unlimited by default.
+	stdinImageMaxSizeEnv = "APPTAINER_STDIN_IMAGE_MAX_SIZE"
+	// stdinImageName is the name of the image read from stdin in its
+	// private temporary directory.
+	stdinImageName = "image.sif"
+)
+
+// stdinImageDir is the private temporary directory holding the image read
+// from stdin, removed when the command exits.
+var stdinImageDir string
+
+var (
+	errStdinImageTooLarge = errors.New("image read from stdin is too large")
+	errStdinImageNoSpace  = errors.New("not enough space to store the image read from stdin")
+)
+
+// getStdinImageMaxSize returns the maximum size in bytes of an image read
+// from stdin set by the environment, or 0 if unlimited.
+func getStdinImageMaxSize() (int64, error) {
+	envKey := env.TrimApptainerKey(stdinImageMaxSizeEnv)
+	v := env.GetenvLegacy(envKey, envKey)
+	if v == "" {
+		return 0, nil
+	}
+	size, err := units.RAMInBytes(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q: %v", stdinImageMaxSizeEnv, v, err)
+	}
+	return size, nil
+}
+
+// copyStdinImage copies the image read from r to w, failing if it is
+// larger than maxSize bytes when maxSize is positive.
+func copyStdinImage(w io.Writer, r io.Reader, maxSize int64) error {
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	n, err := io.Copy(w, r)
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return errStdinImageNoSpace
+	} else if err != nil {
+		return err
+	}
+	if maxSize > 0 && n > maxSize {
+		return fmt.Errorf("%w: the maximum size set by %s is %s", errStdinImageTooLarge, stdinImageMaxSizeEnv, units.BytesSize(float64(maxSize)))
+	}
+	return nil
+}
+
+// createStdinImageFile returns a file to write the image in dir. When the
+// kernel supports it the file is created unnamed with O_TMPFILE, and is
+// only linked to path once complete, linked being false.
+func createStdinImageFile(dir, path string) (f *os.File, linked bool, err error) {
+	fd, err := unix.Open(dir, unix.O_TMPFILE|unix.O_RDWR|unix.O_CLOEXEC, 0o600)
+	if err == nil {
+		return os.NewFile(uintptr(fd), path), false, nil
+	}
+	sylog.Debugf("Could not create unnamed temporary file in %s, falling back to a named file: %v", dir, err)
+	f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o600)
+	return f, true, err
+}
+
+// readStdinImage reads the SIF image from r into the private directory
+// dir, and returns its path. The image is checked to be a SIF image.
+func readStdinImage(r io.Reader, dir string, maxSize int64) (string, error) {
+	path := filepath.Join(dir, stdinImageName)
+	f, linked, err := createStdinImageFile(dir, path)
+	if err != nil {
+		return "", fmt.Errorf("while creating temporary image file: %w", err)
+	}
+	defer f.Close()
+
+	if err := copyStdinImage(f, r, maxSize); errors.Is(err, errStdinImageNoSpace) {
+		return "", fmt.Errorf("%w in %s, set APPTAINER_TMPDIR to a directory with more space", err, dir)
+	} else if err != nil {
+		return "", fmt.Errorf("while reading image from stdin: %w", err)
+	}
+
+	fimg, err := sif.LoadContainer(f, sif.OptLoadWithCloseOnUnload(false))
+	if err != nil {
+		return "", fmt.Errorf("data read from stdin is not a SIF image: %w", err)
+	}
+	_ = fimg.UnloadContainer()
+
+	if !linked {
+		// the image appears in the directory only once complete
+		procPath := fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+		if err := unix.Linkat(unix.AT_FDCWD, procPath, unix.AT_FDCWD, path, unix.AT_SYMLINK_FOLLOW); err != nil {
+			return "", fmt.Errorf("while linking temporary image file: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// envTmpDir returns the temporary directory set by APPTAINER_TMPDIR, for
+// the commands without the hidden tmpdir flag.
+func envTmpDir() string {
+	if dir := env.GetenvLegacy("TMPDIR", "TMPDIR"); dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// removeStdinImage removes the image read from stdin, if any.
+func removeStdinImage() {
+	if stdinImageDir == "" {
+		return
+	}
+	if err := os.RemoveAll(stdinImageDir); err != nil {
+		sylog.Warningf("Could not remove temporary image directory %s: %v", stdinImageDir, err)
+	}
+	stdinImageDir = ""
+}
+
+// handleStdinImage reads the SIF image piped to the command cmd into a
+// private temporary directory in tmpDir, and returns its path. The image
+// is removed on a signal, and must be removed with removeStdinImage when
+// the container isn't started.
+func handleStdinImage(cmd *cobra.Command, tmpDir string) string {
+	name := cmd.Name()
+	if cmd.HasParent() && cmd.Parent() != cmd.Root() {
+		name = cmd.Parent().Name() + " " + name
+	}
+	switch name {
+	case "exec", "run", "test", "inspect":
+	case "shell":
+		sylog.Fatalf("The shell command needs stdin for interactive use, the image can't be read from stdin: use an image file instead")
+	default:
+		sylog.Fatalf("The %s command can't read the image from stdin: use an image file instead", name)
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		sylog.Fatalf("No image piped to stdin: pipe a SIF image to read it from stdin, or use an image file")
+	}
+
+	maxSize, err := getStdinImageMaxSize()
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	dir, err := os.MkdirTemp(tmpDir, "stdin-image-")
+	if err != nil {
+		sylog.Fatalf("While creating temporary image directory: %s", err)
+	}
+	stdinImageDir = dir
+
+	// the signal handler is reset when the starter is executed, the
+	// engine removes the image when the container exits
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-sigCh
+		os.RemoveAll(dir)
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	}()
+
+	sylog.Debugf("Reading image from stdin into %s", dir)
+	path, err := readStdinImage(os.Stdin, dir, maxSize)
+	if err != nil {
+		removeStdinImage()
+		sylog.Fatalf("%s", err)
+	}
+
+	// a command re-executed in a root-mapped user namespace runs the
+	// image read, stdin being consumed
+	for i, arg := range os.Args[1:] {
+		if arg == stdinImageArg {
+			os.Args[i+1] = path
+			break
+		}
+	}
+	return path
+}
+
+// adoptStdinImage takes over the deletion of the image read from stdin
+// by the command which re-executed this one in a root-mapped user
+// namespace, image being the image argument.
+func adoptStdinImage(image string) {
+	dir := os.Getenv(launch.DeleteImageDirEnv)
+	if dir == "" {
+		return
+	}
+	os.Unsetenv(launch.DeleteImageDirEnv)
+	if filepath.Dir(image) == dir {
+		stdinImageDir = dir
+	}
+}
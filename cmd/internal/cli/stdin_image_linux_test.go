@@ -0,0 +1,186 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/runtime/launch"
+)
+
+// fullWriter fails with ENOSPC once size bytes are written.
+type fullWriter struct {
+	size int
+	n    int
+}
+
+func (w *fullWriter) Write(p []byte) (int, error) {
+	if w.n+len(p) > w.size {
+		n := w.size - w.n
+		w.n = w.size
+		return n, &os.PathError{Op: "write", Path: "image", Err: syscall.ENOSPC}
+	}
+	w.n += len(p)
+	return len(p), nil
+}
+
+func TestCopyStdinImage(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 4096)
+
+	tests := []struct {
+		name    string
+		w       func() io.Writer
+		maxSize int64
+		wantErr error
+	}{
+		{
+			name: "Unlimited",
+			w:    func() io.Writer { return new(bytes.Buffer) },
+		},
+		{
+			name:    "ExactSize",
+			w:       func() io.Writer { return new(bytes.Buffer) },
+			maxSize: 4096,
+		},
+		{
+			name:    "TooLarge",
+			w:       func() io.Writer { return new(bytes.Buffer) },
+			maxSize: 4095,
+			wantErr: errStdinImageTooLarge,
+		},
+		{
+			name:    "DiskFull",
+			w:       func() io.Writer { return &fullWriter{size: 1024} },
+			wantErr: errStdinImageNoSpace,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := copyStdinImage(tt.w(), bytes.NewReader(data), tt.maxSize)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetStdinImageMaxSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "10MiB", want: 10 << 20},
+		{value: "1g", want: 1 << 30},
+		{value: "big", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv(stdinImageMaxSizeEnv, tt.value)
+			got, err := getStdinImageMaxSize()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadStdinImage(t *testing.T) {
+	image, err := os.ReadFile(busyboxSIF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path, err := readStdinImage(bytes.NewReader(image), dir, 0)
+	if err != nil {
+		t.Fatalf("while reading image: %s", err)
+	}
+	if path != filepath.Join(dir, stdinImageName) {
+		t.Errorf("got path %s, want %s", path, filepath.Join(dir, stdinImageName))
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(len(image)) || fi.Mode().Perm() != 0o600 {
+		t.Errorf("unexpected image size %d and permissions %o", fi.Size(), fi.Mode().Perm())
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		maxSize int64
+		wantErr string
+	}{
+		{
+			name:    "NotSIF",
+			data:    []byte("#!/bin/sh\necho not a SIF image\n"),
+			wantErr: "data read from stdin is not a SIF image",
+		},
+		{
+			name:    "Empty",
+			wantErr: "data read from stdin is not a SIF image",
+		},
+		{
+			name:    "TooLarge",
+			data:    image,
+			maxSize: int64(len(image)) - 1,
+			wantErr: fmt.Sprintf("the maximum size set by %s", stdinImageMaxSizeEnv),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			_, err := readStdinImage(bytes.NewReader(tt.data), dir, tt.maxSize)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdoptStdinImage(t *testing.T) {
+	defer func() { stdinImageDir = "" }()
+	dir := t.TempDir()
+
+	t.Setenv(launch.DeleteImageDirEnv, dir)
+	adoptStdinImage("/other/image.sif")
+	if stdinImageDir != "" {
+		t.Errorf("directory %s adopted for an image outside of it", stdinImageDir)
+	}
+	if _, ok := os.LookupEnv(launch.DeleteImageDirEnv); ok {
+		t.Errorf("environment variable not unset")
+	}
+
+	t.Setenv(launch.DeleteImageDirEnv, dir)
+	adoptStdinImage(filepath.Join(dir, stdinImageName))
+	if stdinImageDir != dir {
+		t.Errorf("got directory %q, want %s", stdinImageDir, dir)
+	}
+	removeStdinImage()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("directory %s not removed: %v", dir, err)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/build/types"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+	"github.com/spf13/cobra"
+)
+
+// tmpDirCandidates returns the tmpdir candidates of the configuration,
+// unless the temporary directory was set with the tmpdir flag or the
+// APPTAINER_TMPDIR environment variable.
+func tmpDirCandidates(cmd *cobra.Command) []string {
+	if f := cmd.Flags().Lookup("tmpdir"); f != nil && f.Changed {
+		return nil
+	} else if env.GetenvLegacy("TMPDIR", "TMPDIR") != "" {
+		return nil
+	}
+	if conf := apptainerconf.GetCurrentConfig(); conf != nil {
+		return conf.TmpDirCandidates
+	}
+	return nil
+}
+
+// selectTmpDir sets tmpDir to the temporary directory to use for an
+// operation needing about required bytes of temporary space, or exits if
+// there's not enough space.
+func selectTmpDir(cmd *cobra.Command, required int64) {
+	dir, err := fs.ChooseTmpDir(tmpDir, tmpDirCandidates(cmd), required)
+	if err != nil {
+		sylog.Fatalf("%v", err)
+	}
+	tmpDir = dir
+}
+
+// buildTmpSpace returns the estimated temporary space needed to build a
+// SIF image from the definitions defs, or zero if unknown.
+func buildTmpSpace(ctx context.Context, defs []types.Definition) int64 {
+	var required int64
+	for _, d := range defs {
+		switch d.Header["bootstrap"] {
+		case "localimage":
+			required += imageTmpSpace(d.Header["from"])
+		case "docker":
+			required += remoteTmpSpace(ctx, "docker://"+strings.TrimPrefix(d.Header["from"], "//"))
+		}
+	}
+	return required
+}
+
+// imageTmpSpace returns the estimated space needed to extract the image
+// file path, from the size of its root filesystem partitions, or zero if
+// unknown.
+func imageTmpSpace(path string) int64 {
+	img, err := image.Init(path, false)
+	if err != nil {
+		sylog.Debugf("Could not estimate the size of %s: %s", path, err)
+		return 0
+	}
+	defer img.File.Close()
+
+	parts, err := img.GetRootFsPartitions()
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, p := range parts {
+		if p.Type == image.SQUASHFS {
+			size += int64(p.Size) * fs.ExtractFactor
+		} else {
+			size += int64(p.Size)
+		}
+	}
+	return size
+}
+
+// remoteTmpSpace returns the estimated space needed to extract the
+// registry image src, from the size of its compressed layers, or zero if
+// unknown.
+func remoteTmpSpace(ctx context.Context, src string) int64 {
+	attrs, err := fetchRemoteMetadata(ctx, src)
+	if err != nil {
+		sylog.Debugf("Could not estimate the size of %s: %s", src, err)
+		return 0
+	}
+	var size int64
+	for _, l := range attrs.Layers {
+		size += l.Size
+	}
+	return size * fs.ExtractFactor
+}
@@ -0,0 +1,85 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"time"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(TopCmd)
+		cmdManager.RegisterFlagForCmd(&topAllUsersFlag, TopCmd)
+		cmdManager.RegisterFlagForCmd(&topIntervalFlag, TopCmd)
+		cmdManager.RegisterFlagForCmd(&topJSONFlag, TopCmd)
+	})
+}
+
+// --all-users
+var topAllUsers bool
+
+var topAllUsersFlag = cmdline.Flag{
+	ID:           "topAllUsersFlag",
+	Value:        &topAllUsers,
+	DefaultValue: false,
+	Name:         "all-users",
+	Usage:        "display the containers of all users (root only)",
+}
+
+// --interval
+var topInterval string
+
+var topIntervalFlag = cmdline.Flag{
+	ID:           "topIntervalFlag",
+	Value:        &topInterval,
+	DefaultValue: "2s",
+	Name:         "interval",
+	Usage:        "interval between refreshes and CPU usage measurement period",
+	Tag:          "<duration>",
+}
+
+// -j|--json
+var topJSON bool
+
+var topJSONFlag = cmdline.Flag{
+	ID:           "topJSONFlag",
+	Value:        &topJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print a single sample in json",
+}
+
+// TopCmd apptainer top
+var TopCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if topAllUsers && os.Getuid() != 0 {
+			sylog.Fatalf("Only the root user can display the containers of all users")
+		}
+		interval, err := time.ParseDuration(topInterval)
+		if err != nil || interval <= 0 {
+			sylog.Fatalf("Invalid --interval value %q: a positive duration is required", topInterval)
+		}
+		return apptainer.Top(cmd.Context(), topAllUsers, interval, topJSON)
+	},
+
+	Use:     docs.TopUse,
+	Short:   docs.TopShort,
+	Long:    docs.TopLong,
+	Example: docs.TopExample,
+}
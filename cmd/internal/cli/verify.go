@@ -35,6 +35,7 @@ var (
 	jsonVerify                   bool   // -j flag
 	verifyAll                    bool
 	verifyLegacy                 bool
+	verifyKeyringRemote          string // remote whose keyring is consulted
 )
 
 // -u|--url
@@ -260,6 +261,15 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 	default:
 		sylog.Infof("Verifying image with PGP key material")
 
+		// Only consult the keyring of the remote in use along with the local keyring.
+		migrateKeyring("")
+		name, _, err := resolveRemote("")
+		if err != nil {
+			sylog.Fatalf("Unable to load remote configuration: %v", err)
+		}
+		verifyKeyringRemote = name
+		opts = append(opts, sifsignature.OptVerifyWithRemoteKeyring(name))
+
 		// Set keyserver option, if applicable.
 		if localVerify {
 			opts = append(opts, sifsignature.OptVerifyWithPGP())
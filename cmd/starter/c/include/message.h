@@ -54,8 +54,22 @@
 
 #define MSGLVL_ENV              "APPTAINER_MESSAGELEVEL"
 
+/*
+ * failure stages reported with an error record, the exit codes must
+ * match those of internal/pkg/util/starter/report.go
+ */
+#define REPORT_NAMESPACE            "namespace"
+#define REPORT_NAMESPACE_EXIT       246
+#define REPORT_CAPABILITIES         "capabilities"
+#define REPORT_CAPABILITIES_EXIT    245
+
+/* file descriptor where error records are written, -1 if not set */
+extern int report_fd;
+
 void _print(int level, const char *function, const char *file, char *format, ...) __attribute__ ((__format__(printf, 4, 5)));
+void _report(const char *stage, int errnum, const char *path, char *format, ...) __attribute__ ((__format__(printf, 4, 5)));
 
 #define apptainer_message(a,b...) _print(a, __func__, __FILE__, b)
+#define apptainer_report(s,e,p,b...) _report(s, e, p, b)
 
 #endif /*_APPTAINER_MESSAGE_H */
@@ -18,6 +18,12 @@
 
 #define fatalf(b...)     apptainer_message(ERROR, b); \
                          exit(1)
+/* fatalr reports an error record for the stage s and path p before exiting */
+#define fatalr(s,p,b...) { int __errnum = errno; \
+                         apptainer_report(s, __errnum, p, b); \
+                         errno = __errnum; \
+                         apptainer_message(ERROR, b); \
+                         exit(s##_EXIT); }
 #define debugf(b...)     apptainer_message(DEBUG, b)
 #define verbosef(b...)   apptainer_message(VERBOSE, b)
 #define infof(b...)      apptainer_message(INFO, b)
@@ -29,6 +35,7 @@
 #define MAX_GID             32
 #define MAX_STARTER_FDS     1024
 #define MAX_CMD_SIZE        MAX_PATH_SIZE+MAX_MAP_SIZE+64
+#define MAX_TIME_OFFSETS    128
 
 #ifndef PR_SET_NO_NEW_PRIVS
 #define PR_SET_NO_NEW_PRIVS 38
@@ -73,6 +80,11 @@ enum goexec {
 #define CLONE_NEWCGROUP     0x02000000
 #endif
 
+/* time namespace, only created with unshare as the flag overlaps CSIGNAL */
+#ifndef CLONE_NEWTIME
+#define CLONE_NEWTIME       0x00000080
+#endif
+
 typedef enum {
     false,
     true
@@ -106,6 +118,10 @@ struct namespace {
     char uts[MAX_PATH_SIZE];
     char cgroup[MAX_PATH_SIZE];
     char pid[MAX_PATH_SIZE];
+    char time[MAX_PATH_SIZE];
+
+    /* clock offsets written to timens_offsets for a created time namespace */
+    char timeOffsets[MAX_TIME_OFFSETS];
 };
 
 /* container privileges */
@@ -127,6 +143,11 @@ struct privileges {
     gid_t targetGID[MAX_GID];
     int numGID;
 
+    /* supplementary groups set for container process execution */
+    bool setGroups;
+    gid_t groups[MAX_GID];
+    int numGroups;
+
     /* container process capabilities */
     struct capabilities capabilities;
 };
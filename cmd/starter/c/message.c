@@ -24,6 +24,7 @@
 #define _GNU_SOURCE
 
 #include <ctype.h>
+#include <errno.h>
 #include <stdio.h>
 #include <stdlib.h>
 #include <unistd.h>
@@ -34,6 +35,7 @@
 #include "include/message.h"
 
 int messagelevel = -99;
+int report_fd = -1;
 
 extern const char *__progname;
 
@@ -195,3 +197,68 @@ void _print(int level, const char *function, const char *file_in, char *format,
         exit(255);
     }
 }
+
+/* escape_json copies the string in to out as a JSON string content */
+static void escape_json(const char *in, char *out, size_t size) {
+    size_t i = 0;
+
+    for ( ; *in != '\0' && i + 7 < size; in++ ) {
+        unsigned char c = (unsigned char)*in;
+
+        if ( c == '"' || c == '\\' ) {
+            out[i++] = '\\';
+            out[i++] = c;
+        } else if ( c < 0x20 ) {
+            i += snprintf(out+i, size-i, "\\u%04x", c);
+        } else {
+            out[i++] = c;
+        }
+    }
+    out[i] = '\0';
+}
+
+/*
+ * _report writes an error record for the failure stage as a JSON line to
+ * report_fd, the CLI translates the record into an actionable message and
+ * exits with the exit code of the stage.
+ */
+void _report(const char *stage, int errnum, const char *path, char *format, ...) {
+    char message[512];
+    char escaped_message[1024];
+    char escaped_path[1024];
+    char record[4096];
+    size_t len;
+    int length;
+    ssize_t ret;
+    va_list args;
+
+    if ( report_fd < 0 ) {
+        return;
+    }
+
+    va_start (args, format);
+    vsnprintf(message, sizeof(message), format, args);
+    va_end (args);
+
+    /* strip the trailing new line of the message */
+    len = strlen(message);
+    if ( len > 0 && message[len-1] == '\n' ) {
+        message[len-1] = '\0';
+    }
+
+    escape_json(message, escaped_message, sizeof(escaped_message));
+    escape_json(path != NULL ? path : "", escaped_path, sizeof(escaped_path));
+
+    length = snprintf(record, sizeof(record), "{\"stage\":\"%s\",\"errno\":%d,\"path\":\"%s\",\"message\":\"%s\"}\n", stage, errnum, escaped_path, escaped_message);
+    if ( length < 0 || length >= (int)sizeof(record) ) {
+        return;
+    }
+    /* a record is smaller than PIPE_BUF, the write is atomic */
+    do {
+        ret = write(report_fd, record, length);
+    } while ( ret < 0 && errno == EINTR );
+
+    if ( ret < 0 ) {
+        apptainer_message(DEBUG, "Failed to write error record: %s\n", strerror(errno));
+    }
+}
@@ -61,6 +61,8 @@
 #define SELF_IPC_NS     "/proc/self/ns/ipc"
 #define SELF_MNT_NS     "/proc/self/ns/mnt"
 #define SELF_CGROUP_NS  "/proc/self/ns/cgroup"
+#define SELF_TIME_NS    "/proc/self/ns/time"
+#define SELF_TIME_NS_CHILDREN   "/proc/self/ns/time_for_children"
 
 #define capflag(x)  (1ULL << x)
 
@@ -71,6 +73,9 @@ struct starterConfig *sconfig;
 int rpc_socket[2] = {-1, -1};
 int master_socket[2] = {-1, -1};
 
+/* pipe where stages report error records read by the master process */
+int error_pipe[2] = {-1, -1};
+
 /* set Go execution call after init function returns */
 enum goexec goexecute;
 
@@ -291,7 +296,7 @@ static void apply_privileges(struct privileges *privileges, struct capabilities
     for ( caps_index = 0; caps_index <= last_cap; caps_index++ ) {
         if ( !(privileges->capabilities.bounding & capflag(caps_index)) ) {
             if ( prctl(PR_CAPBSET_DROP, caps_index) < 0 ) {
-                fatalf("Failed to drop cap %d bounding capabilities set: %s\n", caps_index, strerror(errno));
+                fatalr(REPORT_CAPABILITIES, NULL, "Failed to drop cap %d bounding capabilities set: %s\n", caps_index, strerror(errno));
             }
         }
     }
@@ -303,7 +308,7 @@ static void apply_privileges(struct privileges *privileges, struct capabilities
      * because CAP_SETUID/CAP_SETGID could be already dropped
      */
     if ( prctl(PR_SET_SECUREBITS, SECBIT_KEEP_CAPS) < 0 ) {
-        fatalf("Failed to set securebits: %s\n", strerror(errno));
+        fatalr(REPORT_CAPABILITIES, NULL, "Failed to set securebits: %s\n", strerror(errno));
     }
 
     /* apply target GID for root user or if setgroups is allowed within user namespace */
@@ -313,17 +318,24 @@ static void apply_privileges(struct privileges *privileges, struct capabilities
 
             debugf("Set main group ID to %d\n", targetGID);
             if ( setresgid(targetGID, targetGID, targetGID) < 0 ) {
-                fatalf("Failed to set GID %d: %s\n", targetGID, strerror(errno));
+                fatalr(REPORT_CAPABILITIES, NULL, "Failed to set GID %d: %s\n", targetGID, strerror(errno));
             }
 
             if ( privileges->numGID > 1 ) {
                 debugf("Set %d additional group IDs\n", privileges->numGID);
                 if ( setgroups(privileges->numGID, privileges->targetGID) < 0 ) {
-                    fatalf("Failed to set additional groups: %s\n", strerror(errno));
+                    fatalr(REPORT_CAPABILITIES, NULL, "Failed to set additional groups: %s\n", strerror(errno));
                 }
             }
         }
     }
+    /* replace the supplementary groups, the engine checked they are allowed */
+    if ( privileges->setGroups ) {
+        debugf("Set %d supplementary group IDs\n", privileges->numGroups);
+        if ( setgroups(privileges->numGroups, privileges->groups) < 0 ) {
+            fatalr(REPORT_CAPABILITIES, NULL, "Failed to set supplementary groups: %s\n", strerror(errno));
+        }
+    }
     /* apply target UID for root user, also apply if user namespace UID is zero */
     if ( currentUID == 0 ) {
         targetUID = privileges->targetUID;
@@ -331,12 +343,12 @@ static void apply_privileges(struct privileges *privileges, struct capabilities
 
     debugf("Set user ID to %d\n", targetUID);
     if ( setresuid(targetUID, targetUID, targetUID) < 0 ) {
-        fatalf("Failed to set all user ID to %d: %s\n", targetUID, strerror(errno));
+        fatalr(REPORT_CAPABILITIES, NULL, "Failed to set all user ID to %d: %s\n", targetUID, strerror(errno));
     }
 
     if ( privileges->noNewPrivs ) {
         if ( prctl(PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0) < 0 ) {
-            fatalf("Failed to set no new privs flag: %s\n", strerror(errno));
+            fatalr(REPORT_CAPABILITIES, NULL, "Failed to set no new privs flag: %s\n", strerror(errno));
         }
         if ( prctl(PR_GET_NO_NEW_PRIVS, 0, 0 ,0, 0) != 1 ) {
             fatalf("Aborting, failed to set no new privs flag: %s\n", strerror(errno));
@@ -347,7 +359,7 @@ static void apply_privileges(struct privileges *privileges, struct capabilities
     header.pid = 0;
 
     if ( capset(&header, data) < 0 ) {
-        fatalf("Failed to set process capabilities\n");
+        fatalr(REPORT_CAPABILITIES, NULL, "Failed to set process capabilities\n");
     }
 
 #ifdef USER_CAPABILITIES
@@ -355,7 +367,7 @@ static void apply_privileges(struct privileges *privileges, struct capabilities
     for ( caps_index = 0; caps_index <= last_cap; caps_index++ ) {
         if ( (privileges->capabilities.ambient & capflag(caps_index)) ) {
             if ( prctl(PR_CAP_AMBIENT, PR_CAP_AMBIENT_RAISE, caps_index, 0, 0) < 0 ) {
-                fatalf("Failed to set ambient capability: %s\n", strerror(errno));
+                fatalr(REPORT_CAPABILITIES, NULL, "Failed to set ambient capability: %s\n", strerror(errno));
             }
         }
     }
@@ -486,6 +498,10 @@ static char *nserror(int err, int nstype) {
         name = "cgroup";
         ns = name;
         break;
+    case CLONE_NEWTIME:
+        name = "time";
+        ns = name;
+        break;
     }
     if ( err == EINVAL ) {
         snprintf(path, MAX_PATH_SIZE-1, "/proc/self/ns/%s", ns);
@@ -542,6 +558,9 @@ static int create_namespace(int nstype) {
     case CLONE_NEWCGROUP:
         verbosef("Create cgroup namespace\n");
         break;
+    case CLONE_NEWTIME:
+        verbosef("Create time namespace\n");
+        break;
     default:
         warningf("Skipping unknown namespace creation\n");
         errno = EINVAL;
@@ -575,6 +594,9 @@ static int enter_namespace(char *nspath, int nstype) {
     case CLONE_NEWCGROUP:
         verbosef("Entering in cgroup namespace\n");
         break;
+    case CLONE_NEWTIME:
+        verbosef("Entering in time namespace\n");
+        break;
     default:
         verbosef("Entering in unknown namespace\n");
         errno = EINVAL;
@@ -710,7 +732,7 @@ static void setup_userns_mappings(struct privileges *privileges) {
 static int user_namespace_init(struct namespace *nsconfig) {
     if ( is_namespace_enter(nsconfig->user, NULL) ) {
         if ( enter_namespace(nsconfig->user, CLONE_NEWUSER) < 0 ) {
-            fatalf("Failed to enter in user namespace: %s\n", strerror(errno));
+            fatalr(REPORT_NAMESPACE, nsconfig->user, "Failed to enter in user namespace: %s\n", strerror(errno));
         }
         return ENTER_NAMESPACE;
     } else if ( is_namespace_create(nsconfig, CLONE_NEWUSER) ) {
@@ -723,7 +745,7 @@ static int user_namespace_init(struct namespace *nsconfig) {
 static int pid_namespace_init(struct namespace *nsconfig) {
     if ( is_namespace_enter(nsconfig->pid, SELF_PID_NS) ) {
         if ( enter_namespace(nsconfig->pid, CLONE_NEWPID) < 0 ) {
-            fatalf("Failed to enter in pid namespace: %s\n", strerror(errno));
+            fatalr(REPORT_NAMESPACE, nsconfig->pid, "Failed to enter in pid namespace: %s\n", strerror(errno));
         }
         return ENTER_NAMESPACE;
     } else if ( is_namespace_create(nsconfig, CLONE_NEWPID) ) {
@@ -736,12 +758,12 @@ static int pid_namespace_init(struct namespace *nsconfig) {
 static int network_namespace_init(struct namespace *nsconfig) {
     if ( is_namespace_enter(nsconfig->network, SELF_NET_NS) ) {
         if ( enter_namespace(nsconfig->network, CLONE_NEWNET) < 0 ) {
-            fatalf("Failed to enter in network namespace: %s\n", strerror(errno));
+            fatalr(REPORT_NAMESPACE, nsconfig->network, "Failed to enter in network namespace: %s\n", strerror(errno));
         }
         return ENTER_NAMESPACE;
     } else if ( is_namespace_create(nsconfig, CLONE_NEWNET) ) {
         if ( create_namespace(CLONE_NEWNET) < 0 ) {
-            fatalf("Failed to create network namespace: %s\n", nserror(errno, CLONE_NEWNET));
+            fatalr(REPORT_NAMESPACE, NULL, "Failed to create network namespace: %s\n", nserror(errno, CLONE_NEWNET));
         }
         if ( nsconfig->bringLoopbackInterface ) {
             struct ifreq req;
@@ -770,12 +792,12 @@ static int network_namespace_init(struct namespace *nsconfig) {
 static int uts_namespace_init(struct namespace *nsconfig) {
     if ( is_namespace_enter(nsconfig->uts, SELF_UTS_NS) ) {
         if ( enter_namespace(nsconfig->uts, CLONE_NEWUTS) < 0 ) {
-            fatalf("Failed to enter in uts namespace: %s\n", strerror(errno));
+            fatalr(REPORT_NAMESPACE, nsconfig->uts, "Failed to enter in uts namespace: %s\n", strerror(errno));
         }
         return ENTER_NAMESPACE;
     } else if ( is_namespace_create(nsconfig, CLONE_NEWUTS) ) {
         if ( create_namespace(CLONE_NEWUTS) < 0 ) {
-            fatalf("Failed to create uts namespace: %s\n", nserror(errno, CLONE_NEWUTS));
+            fatalr(REPORT_NAMESPACE, NULL, "Failed to create uts namespace: %s\n", nserror(errno, CLONE_NEWUTS));
         }
         return CREATE_NAMESPACE;
     }
@@ -784,12 +806,12 @@ static int uts_namespace_init(struct namespace *nsconfig) {
 static int ipc_namespace_init(struct namespace *nsconfig) {
     if ( is_namespace_enter(nsconfig->ipc, SELF_IPC_NS) ) {
         if ( enter_namespace(nsconfig->ipc, CLONE_NEWIPC) < 0 ) {
-            fatalf("Failed to enter in ipc namespace: %s\n", strerror(errno));
+            fatalr(REPORT_NAMESPACE, nsconfig->ipc, "Failed to enter in ipc namespace: %s\n", strerror(errno));
         }
         return ENTER_NAMESPACE;
     } else if ( is_namespace_create(nsconfig, CLONE_NEWIPC) ) {
         if ( create_namespace(CLONE_NEWIPC) < 0 ) {
-            fatalf("Failed to create ipc namespace: %s\n", nserror(errno, CLONE_NEWIPC));
+            fatalr(REPORT_NAMESPACE, NULL, "Failed to create ipc namespace: %s\n", nserror(errno, CLONE_NEWIPC));
         }
         return CREATE_NAMESPACE;
     }
@@ -798,21 +820,64 @@ static int ipc_namespace_init(struct namespace *nsconfig) {
 static int cgroup_namespace_init(struct namespace *nsconfig) {
     if ( is_namespace_enter(nsconfig->cgroup, SELF_CGROUP_NS) ) {
         if ( enter_namespace(nsconfig->cgroup, CLONE_NEWCGROUP) < 0 ) {
-            fatalf("Failed to enter in cgroup namespace: %s\n", strerror(errno));
+            fatalr(REPORT_NAMESPACE, nsconfig->cgroup, "Failed to enter in cgroup namespace: %s\n", strerror(errno));
         }
         return ENTER_NAMESPACE;
     } else if ( is_namespace_create(nsconfig, CLONE_NEWCGROUP) ) {
         if ( create_namespace(CLONE_NEWCGROUP) < 0 ) {
-            fatalf("Failed to create cgroup namespace: %s\n", nserror(errno, CLONE_NEWCGROUP));
+            fatalr(REPORT_NAMESPACE, NULL, "Failed to create cgroup namespace: %s\n", nserror(errno, CLONE_NEWCGROUP));
         }
         return CREATE_NAMESPACE;
     }
 }
 
+/*
+ * write the clock offsets of the time namespace created for the children
+ * of the calling process, it must be done before any process enters it
+ */
+static void setup_time_offsets(const char *offsets) {
+    FILE *offsets_fp;
+
+    if ( offsets[0] == 0 ) {
+        return;
+    }
+
+    debugf("Write clock offsets to timens_offsets file\n");
+    offsets_fp = fopen("/proc/self/timens_offsets", "w");
+    if ( offsets_fp != NULL ) {
+        fprintf(offsets_fp, "%s", offsets);
+        if ( fclose(offsets_fp) < 0 ) {
+            fatalf("Failed to write clock offsets of time namespace: %s\n", strerror(errno));
+        }
+    } else {
+        fatalf("Could not open timens_offsets file: %s\n", strerror(errno));
+    }
+}
+
+static int time_namespace_init(struct namespace *nsconfig) {
+    if ( is_namespace_enter(nsconfig->time, SELF_TIME_NS) ) {
+        if ( enter_namespace(nsconfig->time, CLONE_NEWTIME) < 0 ) {
+            fatalr(REPORT_NAMESPACE, nsconfig->time, "Failed to enter in time namespace: %s\n", strerror(errno));
+        }
+        return ENTER_NAMESPACE;
+    } else if ( is_namespace_create(nsconfig, CLONE_NEWTIME) ) {
+        if ( create_namespace(CLONE_NEWTIME) < 0 ) {
+            fatalr(REPORT_NAMESPACE, NULL, "Failed to create time namespace: %s\n", nserror(errno, CLONE_NEWTIME));
+        }
+        setup_time_offsets(nsconfig->timeOffsets);
+        /* the namespace is created for the children only, enter it for the container process */
+        if ( enter_namespace(SELF_TIME_NS_CHILDREN, CLONE_NEWTIME) < 0 ) {
+            fatalr(REPORT_NAMESPACE, NULL, "Failed to enter in time namespace: %s\n", strerror(errno));
+        }
+        return CREATE_NAMESPACE;
+    }
+    return NO_NAMESPACE;
+}
+
 static int mount_namespace_init(struct namespace *nsconfig, bool masterPropagateMount) {
     if ( is_namespace_enter(nsconfig->mount, SELF_MNT_NS) ) {
         if ( enter_namespace(nsconfig->mount, CLONE_NEWNS) < 0 ) {
-            fatalf("Failed to enter in mount namespace: %s\n", strerror(errno));
+            fatalr(REPORT_NAMESPACE, nsconfig->mount, "Failed to enter in mount namespace: %s\n", strerror(errno));
         }
         return ENTER_NAMESPACE;
     } else if ( is_namespace_create(nsconfig, CLONE_NEWNS) ) {
@@ -823,7 +888,7 @@ static int mount_namespace_init(struct namespace *nsconfig, bool masterPropagate
                 fatalf("Failed to unshare root file system: %s\n", strerror(errno));
             }
             if ( create_namespace(CLONE_NEWNS) < 0 ) {
-                fatalf("Failed to create mount namespace: %s\n", nserror(errno, CLONE_NEWNS));
+                fatalr(REPORT_NAMESPACE, NULL, "Failed to create mount namespace: %s\n", nserror(errno, CLONE_NEWNS));
             }
             if ( propagation && mount(NULL, "/", NULL, propagation, NULL) < 0 ) {
                 fatalf("Failed to set mount propagation: %s\n", strerror(errno));
@@ -831,7 +896,7 @@ static int mount_namespace_init(struct namespace *nsconfig, bool masterPropagate
         } else {
             /* create a namespace for container process to separate master during pivot_root */
             if ( create_namespace(CLONE_NEWNS) < 0 ) {
-                fatalf("Failed to create mount namespace: %s\n", nserror(errno, CLONE_NEWNS));
+                fatalr(REPORT_NAMESPACE, NULL, "Failed to create mount namespace: %s\n", nserror(errno, CLONE_NEWNS));
             }
 
             /* set shared propagation to propagate few mount points to master */
@@ -854,7 +919,7 @@ static int shared_mount_namespace_init(struct namespace *nsconfig) {
         fatalf("Failed to unshare root file system: %s\n", strerror(errno));
     }
     if ( create_namespace(CLONE_NEWNS) < 0 ) {
-        fatalf("Failed to create mount namespace: %s\n", nserror(errno, CLONE_NEWNS));
+        fatalr(REPORT_NAMESPACE, NULL, "Failed to create mount namespace: %s\n", nserror(errno, CLONE_NEWNS));
     }
     if ( mount(NULL, "/", NULL, propagation, NULL) < 0 ) {
         fatalf("Failed to set mount propagation: %s\n", strerror(errno));
@@ -1011,9 +1076,16 @@ static void cleanup_fd(fdlist_t *master, struct starter *starter) {
     close(fd_proc);
 }
 
+/* wait_event and send_event are retried when interrupted by a signal */
 static int wait_event(int fd) {
     unsigned char val = 1;
-    if ( read(fd, &val, sizeof(unsigned char)) <= 0 ) {
+    ssize_t ret;
+
+    do {
+        ret = read(fd, &val, sizeof(unsigned char));
+    } while ( ret < 0 && errno == EINTR );
+
+    if ( ret <= 0 ) {
         return(-1);
     }
     return(0);
@@ -1021,7 +1093,13 @@ static int wait_event(int fd) {
 
 static int send_event(int fd) {
     unsigned char val = 1;
-    if ( write(fd, &val, sizeof(unsigned char)) <= 0 ) {
+    ssize_t ret;
+
+    do {
+        ret = write(fd, &val, sizeof(unsigned char));
+    } while ( ret < 0 && errno == EINTR );
+
+    if ( ret <= 0 ) {
         return(-1);
     }
     return(0);
@@ -1098,7 +1176,12 @@ static void wait_child(const char *name, pid_t child_pid, bool noreturn) {
     int status;
     int exit_status = 0;
 
-    pid_t pid = waitpid(child_pid, &status, 0);
+    pid_t pid;
+
+    do {
+        pid = waitpid(child_pid, &status, 0);
+    } while ( pid < 0 && errno == EINTR );
+
     if ( pid < 0 ) {
         fatalf("Failed to wait %s: %s\n", name, strerror(errno));
     } else if ( pid != child_pid ) {
@@ -1275,6 +1358,15 @@ __attribute__((constructor)) static void init(void) {
     /* fix I/O streams to point to /dev/null if they are closed */
     fix_streams();
 
+    /*
+     * error records pipe shared by all processes, created before saving the
+     * opened file descriptors so it's not closed once stage 1 exits
+     */
+    if ( pipe2(error_pipe, O_CLOEXEC|O_NONBLOCK) < 0 ) {
+        fatalf("Failed to create error records pipe: %s\n", strerror(errno));
+    }
+    report_fd = error_pipe[1];
+
     /* save opened file descriptors that won't be closed when stage 1 exits */
     master_fds = list_fd();
 
@@ -1431,7 +1523,7 @@ __attribute__((constructor)) static void init(void) {
             if ( create_namespace(CLONE_NEWUSER) < 0 ) {
                 infof("A system administrator may need to enable user namespaces, install\n");
                 infof("  apptainer-suid, or compile with ./mconfig --with-suid\n");
-                fatalf("Failed to create user namespace: %s\n", nserror(errno, CLONE_NEWUSER));
+                fatalr(REPORT_NAMESPACE, NULL, "Failed to create user namespace: %s\n", nserror(errno, CLONE_NEWUSER));
             }
         } else {
             /*
@@ -1475,6 +1567,7 @@ __attribute__((constructor)) static void init(void) {
         uts_namespace_init(&sconfig->container.namespace);
         ipc_namespace_init(&sconfig->container.namespace);
         cgroup_namespace_init(&sconfig->container.namespace);
+        time_namespace_init(&sconfig->container.namespace);
 
         /*
          * depending of engines, the master process may require to propagate mount point
@@ -1508,6 +1601,12 @@ __attribute__((constructor)) static void init(void) {
             if ( process == 0 ) {
                 if ( sconfig->starter.isSuid && geteuid() == 0 ) {
                     set_rpc_privileges();
+                } else {
+                    /*
+                     * don't keep setting up the container once the
+                     * container process was terminated by a signal
+                     */
+                    set_parent_death_signal(SIGKILL);
                 }
                 verbosef("Spawn RPC server\n");
                 goexecute = RPC_SERVER;
@@ -1589,8 +1688,17 @@ __attribute__((constructor)) static void init(void) {
                     setup_userns_mappings(&sconfig->container.privileges);
                 } else {
                     chdir_to_proc_pid(sconfig->container.pid);
-                    /* use newuidmap/newgidmap as fallback for hybrid workflow */
-                    setup_userns_mappings_external(&sconfig->container);
+                    if ( uid == 0 ) {
+                        /*
+                         * root inside a user namespace (nested fakeroot) has the
+                         * capabilities to write the mappings of the ids available
+                         * in its namespace, newuidmap/newgidmap would reject them
+                         */
+                        setup_userns_mappings(&sconfig->container.privileges);
+                    } else {
+                        /* use newuidmap/newgidmap as fallback for hybrid workflow */
+                        setup_userns_mappings_external(&sconfig->container);
+                    }
                     /*
                      * without setuid, we could not join mount namespace below, so
                      * we need to join the fakeroot user namespace first
@@ -1693,9 +1801,9 @@ __attribute__((constructor)) static void init(void) {
         }
     }
     if ( clone_flags & CLONE_NEWPID != 0 && clone_flags & CLONE_NEWUSER == 0 ) {
-        fatalf("Failed to create container namespace: %s\n", nserror(errno, CLONE_NEWPID));
+        fatalr(REPORT_NAMESPACE, NULL, "Failed to create container namespace: %s\n", nserror(errno, CLONE_NEWPID));
     } else if ( clone_flags & CLONE_NEWUSER != 0 ) {
-        fatalf("Failed to create container namespace: %s\n", nserror(errno, CLONE_NEWUSER));
+        fatalr(REPORT_NAMESPACE, NULL, "Failed to create container namespace: %s\n", nserror(errno, CLONE_NEWUSER));
     }
     if ( errno == EINVAL ) {
         infof("Unprivileged user namespaces may not be enabled\n");
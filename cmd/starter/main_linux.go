@@ -30,6 +30,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine"
 	starterConfig "github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/starter"
 	"github.com/apptainer/apptainer/internal/pkg/util/mainthread"
+	starterutil "github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/pkg/sylog"
 
 	// register engines
@@ -45,6 +46,10 @@ func getEngine(jsonConfig []byte, privStageOne bool) *engine.Engine {
 }
 
 func startup() {
+	// error records are written to the pipe created in
+	// cmd/starter/c/starter.c and read by the master process
+	starterutil.SetReportFd(int(C.error_pipe[1]))
+
 	// global variable defined in cmd/starter/c/starter.c,
 	// C.sconfig points to a shared memory area
 	csconf := unsafe.Pointer(C.sconfig)
@@ -81,7 +86,7 @@ func startup() {
 			sylog.Fatalf("%s", err)
 		}
 
-		starter.Master(int(C.rpc_socket[0]), int(C.master_socket[0]), pid, e)
+		starter.Master(int(C.rpc_socket[0]), int(C.master_socket[0]), int(C.error_pipe[0]), pid, e)
 	case C.RPC_SERVER:
 		sylog.Verbosef("Serve RPC requests\n")
 
@@ -208,13 +208,29 @@ Enterprise Performance Computing (EPC)`
   APPTAINER_CACHEDIR is not set). By default the entire cache is cleaned, use
   --days and --type flags to override this behavior. Note: if you use Apptainer
   as root, cache will be stored in '/root/.apptainer/.cache', to clean that
-  cache, you will need to run 'cache clean' as root, or with 'sudo'.`
+  cache, you will need to run 'cache clean' as root, or with 'sudo'.
+
+  The --age, --larger-than and --name flags only remove the entries not used
+  for a duration, larger than a size, or pulled from a source matching a glob
+  pattern. When several are given, an entry must match all of them. The last
+  use of an entry is recorded by Apptainer, so it doesn't depend on the access
+  times of the filesystem. Entries being created by a pull are never removed.
+  With --dry-run, the entries which would be removed are listed with their
+  size, last use and source.`
 	CacheCleanExample string = `
   All group commands have their own help output:
 
   $ apptainer help cache clean --days 30
   $ apptainer help cache clean --type=library,oci
-  $ apptainer cache clean --help`
+  $ apptainer cache clean --help
+
+  Remove the entries not used in the last 30 days and larger than 1 GiB:
+
+  $ apptainer cache clean --age 30d --larger-than 1G
+
+  Show the entries pulled from Docker Hub images named alpine:
+
+  $ apptainer cache clean --dry-run --name 'docker://*alpine*'`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Cache List
@@ -223,13 +239,106 @@ Enterprise Performance Computing (EPC)`
 	CacheListShort string = `List your local Apptainer cache`
 	CacheListLong  string = `
   This will list your local cache (stored at $HOME/.apptainer/cache if
-  APPTAINER_CACHEDIR is not set).`
+  APPTAINER_CACHEDIR is not set).
+
+  With --verbose, each entry is shown with its creation and last use times,
+  its size and the reference it was pulled from. OCI blobs are shown with the
+  images using them. With --json, the entries are printed as a JSON array with
+  the same information and their digest. The provenance of the entries
+  created by older versions of Apptainer is unknown.
+
+  When a maximum cache size is set with APPTAINER_CACHE_MAX_SIZE or the
+  'cache max size' directive of apptainer.conf, the space used against it is
+  also shown. The least recently used entries are evicted by a pull to stay
+  under the maximum size.`
 	CacheListExample string = `
   All group commands have their own help output:
 
   $ apptainer help cache list
   $ apptainer help cache list --type=library,oci
-  $ apptainer cache list --help`
+  $ apptainer cache list --help
+
+  Show the images using each OCI blob:
+
+  $ apptainer cache list --type blob --json`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache export
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheExportUse   string = `export [export options...] <file>`
+	CacheExportShort string = `Export your local Apptainer cache to an archive`
+	CacheExportLong  string = `
+  This will write the entries of your local cache, with their provenance, to a
+  tar archive which can be imported into the cache of another system with
+  'apptainer cache import'. The archive is compressed with zstd when the file
+  name ends with .zst. By default all the entries are exported, use the --type
+  flag to only export some types of entries.
+
+  Together with the global --offline flag, this allows to run and build from
+  the cached images on air-gapped systems without network access.`
+	CacheExportExample string = `
+  Export the OCI images and the library images of the cache:
+
+  $ apptainer cache export --type oci-blob,oci-tmp,library cache.tar.zst`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache import
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheImportUse   string = `import <file>`
+	CacheImportShort string = `Import an archive into your local Apptainer cache`
+	CacheImportLong  string = `
+  This will add the entries of an archive written by 'apptainer cache export'
+  to your local cache. The digest of each file is verified, and the entries
+  already in the cache are skipped.`
+	CacheImportExample string = `
+  Import a cache archive, then build from it without network access:
+
+  $ apptainer cache import cache.tar.zst
+  $ apptainer --offline build alpine.sif docker://alpine`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache verify
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheVerifyUse   string = `verify [verify options...]`
+	CacheVerifyShort string = `Verify the integrity of your local Apptainer cache`
+	CacheVerifyLong  string = `
+  This will verify the entries of your local cache. The digest of each entry
+  is computed again and compared with the expected one: the digest of the OCI
+  blobs and library images is their name, and the digest of the other entries
+  was recorded when they were pulled. The SIF images are also parsed, and
+  their OCI blobs checked against their digest. The corrupted entries are
+  reported with the reference they were pulled from, when known.
+
+  With --delete-corrupt, the corrupted entries are removed so that they are
+  pulled again. Entries being pulled are waited for before being verified.`
+	CacheVerifyExample string = `
+  Verify the OCI blobs, and remove the corrupted ones:
+
+  $ apptainer cache verify --type oci-blob --delete-corrupt
+
+  Verify the whole cache, with the results in JSON:
+
+  $ apptainer cache verify --json`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache dedup
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheDedupUse   string = `dedup [dedup options...]`
+	CacheDedupShort string = `Share the data of the identical files of your local Apptainer cache`
+	CacheDedupLong  string = `
+  This will find the identical files of your local cache, having the same size
+  and digest, and replace them with reflinks so that they share their data on
+  disk. Reflinks are copy-on-write, so the files remain independent. They are
+  supported by filesystems like btrfs and XFS; on other filesystems only the
+  estimated savings are reported.
+
+  Pulls and builds already share the data of the cache with the images they
+  create, with reflinks when supported, and the OCI blobs extracted by a build
+  with hard links otherwise.`
+	CacheDedupExample string = `
+  Show the space which would be saved:
+
+  $ apptainer cache dedup --dry-run`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key
@@ -256,12 +365,19 @@ Enterprise Performance Computing (EPC)`
 	KeyImportShort string = `Import a local key into the local or global keyring`
 	KeyImportLong  string = `
   The 'key import' command allows you to add a key to your local or global keyring
-  from a specific file.`
+  from a specific file.
+
+  With --gpg, the key with the given ID is imported from the GnuPG keyring,
+  using gpg. Only its public key is imported, unless --secret is given, its
+  passphrase being then asked by the pinentry of gpg-agent.`
 	KeyImportExample string = `
   $ apptainer key import ./my-key.asc
 
   # Import into global keyring (root user only)
-  $ apptainer key import --global ./my-key.asc`
+  $ apptainer key import --global ./my-key.asc
+
+  # Import the public key of the GnuPG keyring
+  $ apptainer key import --gpg 0x12345678`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key export
@@ -269,7 +385,11 @@ Enterprise Performance Computing (EPC)`
 	KeyExportUse   string = `export [export options...] <output-file>`
 	KeyExportShort string = `Export a public or private key into a specific file`
 	KeyExportLong  string = `
-  The 'key export' command allows you to export a key and save it to a file.`
+  The 'key export' command allows you to export a key and save it to a file.
+
+  With --gpg, the key with the given fingerprint is exported to the GnuPG
+  keyring rather than to a file, using gpg. With --secret, its secret key is
+  exported too, protected with the same passphrase.`
 	KeyExportExample string = `
   Exporting a private key:
   
@@ -277,7 +397,11 @@ Enterprise Performance Computing (EPC)`
 
   Exporting a public key:
   
-  $ apptainer key export ./public.asc`
+  $ apptainer key export ./public.asc
+
+  Exporting a public key to the GnuPG keyring:
+
+  $ apptainer key export --gpg 8883491F4268F173C6E5DC49EDECE4F3F38D871E`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key newpair
@@ -287,10 +411,18 @@ Enterprise Performance Computing (EPC)`
 	KeyNewPairLong  string = `
   The 'key newpair' command allows you to create a new key or public/private
   keys to be stored in the default user local keyring location (e.g., 
-  $HOME/.apptainer/keys).`
+  $HOME/.apptainer/keys).
+
+  The fingerprint of the new key is printed on the standard output. With
+  --batch, the command never prompts and fails if the name, email or
+  passphrase are not provided by flags, for non-interactive provisioning.`
 	KeyNewPairExample string = `
   $ apptainer key newpair
-  $ apptainer key newpair --password=psk --name=your-name --comment="key comment" --email=mail@email.com --push=false`
+  $ apptainer key newpair --password=psk --name=your-name --comment="key comment" --email=mail@email.com --push=false
+
+  # generate a CI signing key without any prompt
+  $ apptainer key newpair --batch --name=ci --email=ci@example.com \
+      --passphrase-file=/run/secrets/key-pass --algorithm=ed25519 --expiry=2y --json`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key list
@@ -299,11 +431,19 @@ Enterprise Performance Computing (EPC)`
 	KeyListShort string = `List keys in your local or in the global keyring`
 	KeyListLong  string = `
   List your local keys in your keyring. Will list public (trusted) keys
-  by default.`
+  by default.
+
+  The public keys retrieved from the keyserver of a remote while verifying
+  images are kept in a separate keyring for each remote, listed with
+  --remote. The public keys of the keyring predating the remote keyrings
+  are moved to the 'legacy' remote keyring.`
 	KeyListExample string = `
   $ apptainer key list
   $ apptainer key list --secret
 
+  # list the keys retrieved from the keyserver of the remote 'library'
+  $ apptainer key list --remote library
+
   # list global public keys
   $ apptainer key list --global`
 
@@ -358,9 +498,13 @@ Enterprise Performance Computing (EPC)`
 	KeyRemoveShort string = `Remove a local public key from your local or the global keyring`
 	KeyRemoveLong  string = `
   The 'key remove' command will remove a local public key from
-  the local or the global keyring.`
+  the local or the global keyring, or with --remote from the keyring of
+  the keys retrieved from the keyserver of a remote.`
 	KeyRemoveExample string = `
-  $ apptainer key remove D87FE3AF5C1F063FCBCC9B02F812842B5EEE5934`
+  $ apptainer key remove D87FE3AF5C1F063FCBCC9B02F812842B5EEE5934
+
+  # remove a key retrieved from the keyserver of the remote 'library'
+  $ apptainer key remove --remote library D87FE3AF5C1F063FCBCC9B02F812842B5EEE5934`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// delete
@@ -372,6 +516,65 @@ Enterprise Performance Computing (EPC)`
 	DeleteExample string = `
   $ apptainer delete --arch=amd64 library://username/project/image:1.0`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// fakeroot
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	FakerootUse   string = `fakeroot --check [--json]`
+	FakerootShort string = `Diagnose the --fakeroot mechanisms available to the user`
+	FakerootLong  string = `
+  The fakeroot --check command reports, with pass or fail and the reason, the
+  requirements of each mechanism used by the --fakeroot option, and which one a
+  build or an action command would select right now:
+
+  - a user namespace mapped with the /etc/subuid and /etc/subgid ranges of the
+    user, set up by the setuid starter, or by the newuidmap and newgidmap
+    binaries, which must be setuid root or have file capabilities, without a
+    setuid installation,
+  - an unprivileged user namespace mapping only the user to root, which may be
+    disabled by the kernel user.max_user_namespaces,
+    kernel.unprivileged_userns_clone or
+    kernel.apparmor_restrict_unprivileged_userns settings, combined with the
+    fakeroot command if found,
+  - the fakeroot command alone, which only works with sandbox images.
+
+  The selection follows the same code as the --fakeroot option. The command
+  exits with a non-zero status when --fakeroot would fail. Use --json to attach
+  the diagnostics to a support request.`
+	FakerootExample string = `
+  $ apptainer fakeroot --check
+  $ apptainer fakeroot --check --json`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// doctor
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	DoctorUse   string = `doctor [--for exec|build|instance|fakeroot] [--json]`
+	DoctorShort string = `Diagnose the environment used to run and build containers`
+	DoctorLong  string = `
+  The doctor command checks the host for the most common causes of failures
+  and reports each check as pass, warn or fail, with a one-line remediation
+  hint for warnings and failures:
+
+  - the permissions of the setuid starter, when used,
+  - the creation of unprivileged user namespaces,
+  - the /etc/subuid and /etc/subgid ranges, newuidmap, newgidmap and the
+    fakeroot command used by --fakeroot,
+  - the squashfuse, fuse-overlayfs and fuse2fs binaries used without the setuid
+    starter,
+  - the cgroup delegation needed by resource limits as a regular user,
+  - the free space of the temporary directory,
+  - the write access to the cache directory, which root may lack on NFS with
+    root squash,
+  - the apptainer.conf directives disallowing image formats.
+
+  The checks reuse the code of the commands they diagnose. Use --for to only
+  run the checks relevant to a flow, which can be repeated or comma separated.
+  The command exits with a non-zero status when a failure would prevent the
+  checked flows. Use --json to attach the report to a support request.`
+	DoctorExample string = `
+  $ apptainer doctor
+  $ apptainer doctor --for fakeroot
+  $ apptainer doctor --for exec,instance --json`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// capability
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -497,18 +700,62 @@ Enterprise Performance Computing (EPC)`
   shub://*            A container hosted on Singularity Hub.
 
   oras://*            A SIF container hosted on an OCI registry that supports
-                      the OCI Registry As Storage (ORAS) specification.`
+                      the OCI Registry As Storage (ORAS) specification.
+
+  -                   A SIF image piped to stdin, for the exec, run and test
+                      commands. The image is stored in a private temporary
+                      file in APPTAINER_TMPDIR, removed when the container
+                      exits. APPTAINER_STDIN_IMAGE_MAX_SIZE limits its size
+                      (e.g. 2GiB).`
+	environment string = `
+
+  The container environment is assembled from the following sources, each
+  one overriding the previous ones:
+
+  - the host environment, unless --cleanenv is set, in which case only the
+    variables matching --preserve-env patterns are kept,
+  - the %environment of the image,
+  - the APPTAINERENV_ variables of the host,
+  - the variables of --env-file,
+  - the variables of --env.
+
+  The variables matching --unset-env patterns are then removed whatever
+  their source, except HOME and PATH. --dry-run reports the origin of each
+  variable set from the host side.`
+	exitStatus string = `
+
+  The exit status is the exit code of the container process. When it is
+  killed by a signal, the exit status is 128 plus the signal number, like
+  137 for SIGKILL, whether the container runs with the setuid or the user
+  namespace flow, with or without --pid. The exit codes from 241 to 255 are
+  reserved for the failures of Apptainer itself:
+
+  - 241 to 246 when the container startup fails, with an error record naming
+    the failing stage: 246 namespace, 245 capabilities, 244 config,
+    243 mount, 242 create and 241 start,
+  - 247 when the image doesn't exist, 248 when the credentials to fetch it
+    are missing or rejected, and 249 when the image or an option is denied
+    by the site policy, like the ECL or apptainer.conf; pull, push and
+    build exit with the same codes,
+  - 255 for the other failures, like an invalid configuration.
+
+  With --json-errors, the error record also holds the class of the failure,
+  "not-found", "unauthorized" or "policy", and its exit code.
+
+  Invalid command line options are reported with the exit status 1, before
+  the container is started.`
 	ExecUse   string = `exec [exec options...] <container> <command>`
 	ExecShort string = `Run a command within a container`
 	ExecLong  string = `
-  apptainer exec supports the following formats:` + formats
+  apptainer exec supports the following formats:` + formats + environment + exitStatus
 	ExecExamples string = `
   $ apptainer exec /tmp/debian.sif cat /etc/debian_version
   $ apptainer exec /tmp/debian.sif python ./hello_world.py
   $ cat hello_world.py | apptainer exec /tmp/debian.sif python
   $ sudo apptainer exec --writable /tmp/debian.sif apt-get update
   $ apptainer exec instance://my_instance ps -ef
-  $ apptainer exec library://centos cat /etc/os-release`
+  $ apptainer exec library://centos cat /etc/os-release
+  $ curl -s https://example.com/debian.sif | apptainer exec - cat /etc/debian_version`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance
@@ -531,13 +778,51 @@ Enterprise Performance Computing (EPC)`
 	InstanceListShort string = `List all running and named Apptainer instances`
 	InstanceListLong  string = `
   The instance list command allows you to view the Apptainer container
-  instances that are currently running in the background.`
+  instances that are currently running in the background. The SCRIPT column
+  tells if an instance executes the container startscript (instance start),
+  runscript (instance run) or /sbin/init (instance start --boot). The HEALTH
+  column shows the status of instances started with --health-cmd (starting,
+  healthy or unhealthy), the JSON output also has the number of consecutive
+  failed health checks and the output of the last one.
+
+  With --enabled, root lists instead the instances enabled to start at boot
+  with 'instance enable', of all users or of the user set with --user.
+
+  The --filter flag selects the listed instances with key=value pairs:
+  name=<glob> and image=<glob> match the instance name and image path (or
+  image file name for a glob without a slash),
+  older-than=<duration> and newer-than=<duration> the time since the instance
+  was started (e.g. 90m or 24h), and user=<username> lists the instances of
+  another user for root, like --user. Filters with the same key match any of
+  their values, filters with different keys must all match. The same filters
+  can be given to 'instance stop'.
+
+  With --quiet, only the instance names are printed, one per line. With
+  --format, each instance is printed with a Go template where \t and \n are
+  a tab and a newline, tab separated columns being aligned. The fields
+  available to templates are:
+
+    .Name        instance name
+    .Pid         PID of the instance process
+    .User        owner of the instance
+    .Image       image path
+    .IP          IP address, empty without network
+    .IPv6        IPv6 address on a dual-stack network
+    .Ports       published ports, e.g. {{join .Ports ","}}
+    .Script      start, run or boot
+    .Health      health status, empty without health check
+    .Restarts    number of restarts with a restart policy
+    .Started     start time, e.g. {{.Started.Format "15:04"}}
+    .LogOutPath  path of the stdout log file
+    .LogErrPath  path of the stderr log file
+
+  The join and json functions are also available to templates.`
 	InstanceListExample string = `
   $ apptainer instance list
-  INSTANCE NAME      PID       IMAGE
-  test               11963     /home/mibauer/apptainer/sinstance/test.sif
-  test2              11964     /home/mibauer/apptainer/sinstance/test.sif
-  lolcow             11965     /home/mibauer/apptainer/sinstance/lolcow.sif
+  INSTANCE NAME    PID      IP    IMAGE                                          SCRIPT    HEALTH
+  test             11963          /home/mibauer/apptainer/sinstance/test.sif     start     healthy
+  test2            11964          /home/mibauer/apptainer/sinstance/test.sif     start     -
+  lolcow           11965          /home/mibauer/apptainer/sinstance/lolcow.sif   run       -
 
   $ apptainer instance list 'test*'
   INSTANCE NAME      PID       IMAGE
@@ -547,7 +832,17 @@ Enterprise Performance Computing (EPC)`
   $ sudo apptainer instance list -u mibauer
   INSTANCE NAME      PID       IMAGE
   test               11963     /home/mibauer/apptainer/sinstance/test.sif
-  test2              16219     /home/mibauer/apptainer/sinstance/test.sif`
+  test2              16219     /home/mibauer/apptainer/sinstance/test.sif
+
+  $ sudo apptainer instance list --enabled
+  USER       INSTANCE NAME    IMAGE
+  mibauer    test             /home/mibauer/apptainer/sinstance/test.sif
+
+  $ apptainer instance list --filter image=test.sif --format '{{.Name}}\t{{.Pid}}\t{{.IP}}'
+  test     11963
+  test2    11964
+
+  $ apptainer instance stop $(apptainer instance list -q --filter older-than=24h)`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance start
@@ -559,7 +854,49 @@ Enterprise Performance Computing (EPC)`
   existing container image that will begin running in the background. If a
   startscript is defined in the container metadata the commands in that script
   will be executed with the instance start command as well. You can optionally
-  pass arguments to startscript.
+  pass arguments to startscript. The instance fails to start if the container
+  has neither a startscript nor a runscript.
+
+  With --restart on-failure[:max] or --restart always, a supervisor process
+  restarts the instance with an exponential backoff when it exits, either with
+  a non-zero status (at most max consecutive times if specified) or whatever
+  its status. Stopping the instance with 'instance stop' stops its supervisor.
+
+  With --health-cmd, the supervisor process runs the given shell command in
+  the instance every --health-interval, killing it after --health-timeout. The
+  instance is healthy when the command succeeds, and unhealthy after
+  --health-retries consecutive failures, not counting failures during the
+  --health-start-period before the first success. With --on-unhealthy restart
+  or stop, an unhealthy instance is restarted or stopped.
+
+  With --ready-timeout N, NOTIFY_SOCKET is set in the instance to a socket
+  where the startscript, or a service it starts, writes READY=1 once the
+  instance is ready, like with systemd sd_notify. The instance start command
+  then waits up to N seconds for this notification, and stops the instance
+  and fails if it's not received in time. The PID written to the --pid-file
+  file is only written once the instance is ready.
+
+  With a setuid installation, root can start an instance on behalf of another
+  user with --user. The command then runs with the user's uid, gid,
+  supplementary groups, home directory, cache and systemd user session, exactly
+  as if the user ran it, and the delegation is logged to syslog. Such
+  instances are stopped with 'instance stop --user'.
+
+  With --enabled, root starts all the instances enabled with 'instance enable'
+  which aren't running, see 'apptainer help instance enable'.
+
+  Each instance has a sockets directory, only accessible by its owner and
+  removed when the instance stops, bound at /run/apptainer/instance or at the
+  path set with --sockets-path. Other containers, including instances, started
+  with --join-sockets <instance name> have the same directory bound read-write
+  at the same path, to connect to the unix sockets created there. Its host
+  path is reported by 'instance list --json'.
+
+  On a CNI network, an instance keeps the address it got on its first network
+  when it's started again with the same name, unless the address was taken in
+  the meantime. A fixed address and MAC address can be set with --ip and --mac,
+  failing if another instance holds it. The address of an instance is released
+  with 'instance stop --release-ip' and reported by 'instance list --json'.
 
   apptainer instance start accepts the following container formats` + formats
 	InstanceStartExample string = `
@@ -576,7 +913,14 @@ Enterprise Performance Computing (EPC)`
   Apptainer my-sql.sif>
 
   $ apptainer instance stop /tmp/my-sql.sif mysql
-  Stopping /tmp/my-sql.sif mysql`
+  Stopping /tmp/my-sql.sif mysql
+
+  Start an instance on behalf of user alice, as root
+  $ sudo apptainer instance start --user alice /tmp/my-sql.sif mysql
+  $ sudo apptainer instance stop --user alice mysql
+
+  Start an instance with a fixed address on the bridge network
+  $ sudo apptainer instance start --net --network bridge --ip 10.22.0.10 /tmp/my-sql.sif mysql`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance run
@@ -588,7 +932,9 @@ Enterprise Performance Computing (EPC)`
   existing container image that will begin running in the background. If a
   runscript is defined in the container metadata the commands in that script
   will be executed with the instance run command as well. You can optionally
-  pass arguments to runscript.
+  pass arguments to runscript. The instance fails to start if the container
+  has no runscript. The --restart, --ready-timeout, --health-* and --user
+  options behave as with 'instance start'.
 
   NOTE: This command was added to Apptainer significantly later than the other 
   action commands and will not work with older containers. In that case, you may
@@ -614,28 +960,255 @@ Enterprise Performance Computing (EPC)`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance stats
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
-	InstanceStatsUse   string = `stats [stats options...] <instance name>`
+	InstanceStatsUse   string = `stats [stats options...] [instance name]`
 	InstanceStatsShort string = `Get stats for a named instance`
 	InstanceStatsLong  string = `
   The instance stats command allows you to get statistics for a named instance,
   either printed to the terminal or in json. If you are root, you can optionally
   ask for statistics for a container instance belonging to a specific user. If
-  you add --no-stream, you will only see one timepoint. Asking for json implies
-  the same.`
+  you add --no-stream, you will only see one timepoint, otherwise json output is
+  streamed as one record per line. With cgroups v2, the number of processes
+  killed by the OOM killer and the memory pressure stall information are also
+  reported.
+
+  With --prometheus, no instance name is given and the stats of all instances
+  are served in the Prometheus text format on the /metrics endpoint of the
+  --listen address (default :9807), they are collected on each scrape.
+  Metrics depending on a cgroup controller which is not available are omitted.`
 	InstanceStatsExample string = `
   $ apptainer instance stats mysql
   $ apptainer instance stats --json mysql
   $ apptainer instance stats --no-stream mysql
+  $ apptainer instance stats --prometheus --listen 127.0.0.1:9807
   $ sudo apptainer instance stats --user <username> user-mysql`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance events
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceEventsUse   string = `events [events options...] <instance name>`
+	InstanceEventsShort string = `Get memory events for a named instance`
+	InstanceEventsLong  string = `
+  The instance events command prints the cumulative memory events counters
+  (including processes killed by the OOM killer) and the memory pressure stall
+  information of a named instance. It requires cgroups v2. With --follow, a new
+  record is printed each time the counters change, until the instance exits.
+  If you are root, you can optionally ask for events of a container instance
+  belonging to a specific user.`
+	InstanceEventsExample string = `
+  $ apptainer instance events mysql
+  $ apptainer instance events --follow mysql
+  $ apptainer instance events --follow --json mysql
+  $ sudo apptainer instance events --user <username> user-mysql`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// top
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	TopUse   string = `top [top options...]`
+	TopShort string = `Display the resource usage of running containers`
+	TopLong  string = `
+  The top command displays the CPU, memory usage and number of processes of
+  the running containers of the current user: instances, and containers started
+  with exec, run, shell or test which are registered in XDG_RUNTIME_DIR (see the
+  'register containers' directive in apptainer.conf). On a terminal, the display
+  is refreshed in place every --interval, otherwise or with --json a single
+  sample measured over --interval is printed. If you are root, --all-users
+  displays the containers of all users.`
+	TopExample string = `
+  $ apptainer top
+  $ apptainer top --interval 5s
+  $ apptainer top --json
+  $ sudo apptainer top --all-users`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance update
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceUpdateUse   string = `update [update options...] <instance name>`
+	InstanceUpdateShort string = `Update the resource limits of a running instance`
+	InstanceUpdateLong  string = `
+  The instance update command changes the cgroup resource limits of a running
+  instance in place, without restarting it. It accepts the same limit flags as
+  instance start (--memory, --cpus, --pids-limit...), which only update the
+  limits they set, or --apply-cgroups with a cgroups TOML file replacing all
+  the limits, those not set in the file being removed.
+
+  The instance must have been started with resource limits. As a non-root
+  user, only the cgroup controllers delegated to you by systemd can be
+  updated. Lowering the memory limit below the current usage of the instance
+  is allowed, with a warning, but its processes may be killed by the OOM
+  killer.
+
+  The updated limits are recorded with the instance, and applied again when
+  the instance is restarted by 'instance restart' or its restart policy.
+
+  If you are root, you can optionally update an instance belonging to a
+  specific user with --user.`
+	InstanceUpdateExample string = `
+  $ apptainer instance start --memory 8G my-sql.sif mysql
+  $ apptainer instance update --memory 16G --cpus 8 --pids-limit 4096 mysql
+  $ apptainer instance update --apply-cgroups limits.toml mysql`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance enable
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceEnableUse   string = `enable [enable options...] <instance name>`
+	InstanceEnableShort string = `Enable a running instance to start at boot`
+	InstanceEnableLong  string = `
+  The instance enable command records the launch configuration of a running
+  instance (image, command line options, environment, working directory and
+  user) in the registry of the instances started at boot, usually
+  /var/lib/apptainer/instances-enabled. It can only be used by root, and
+  applies to root's instances unless --user is set.
+
+  At boot, 'apptainer instance start --enabled', run by the shipped
+  apptainer-instances.service systemd unit, starts each enabled instance
+  which isn't running as its owner, after checking that its image still exists
+  and is allowed by the ECL. The failure of an instance doesn't prevent the
+  others from starting. Add --dry-run to list the instances which would be
+  started.`
+	InstanceEnableExample string = `
+  $ apptainer instance start --restart always my-sql.sif mysql
+  $ sudo apptainer instance enable --user mibauer mysql
+  $ sudo apptainer instance start --enabled --dry-run
+  USER       INSTANCE NAME    IMAGE                        ACTION
+  mibauer    mysql            /home/mibauer/my-sql.sif     none (running)
+  $ sudo systemctl enable apptainer-instances.service`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance disable
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceDisableUse   string = `disable [disable options...] <instance name glob>`
+	InstanceDisableShort string = `Disable instances started at boot`
+	InstanceDisableLong  string = `
+  The instance disable command removes instances from the registry of the
+  instances started at boot. It can only be used by root, and applies to
+  root's instances unless --user is set. Running instances are not stopped.`
+	InstanceDisableExample string = `
+  $ sudo apptainer instance disable --user mibauer mysql`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance generate-unit
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceGenerateUnitUse   string = `generate-unit [start options...] <container path> <instance name> [startscript args...]`
+	InstanceGenerateUnitShort string = `Generate a systemd unit starting a named instance`
+	InstanceGenerateUnitLong  string = `
+  The instance generate-unit command prints a systemd service unit starting a
+  named instance with the instance start options given on the command line,
+  and stopping it with instance stop. The unit writes the instance PID to the
+  file set with --pid-file, or to a file in the runtime directory of the
+  service manager, and passes the APPTAINER_* and APPTAINERENV_* environment
+  variables to apptainer.
+
+  The --restart policy is applied by systemd: on-failure and always map to the
+  same systemd Restart= settings, and on-failure:max limits the unit to max
+  restarts within 5 minutes.
+
+  With --install, the unit is installed as apptainer-instance-<instance
+  name>.service, either as a user unit (the default for non-root users, or
+  with --user) or as a system unit (the default for root, or with --system),
+  and the service manager is reloaded. Add --now to also enable and start the
+  unit.`
+	InstanceGenerateUnitExample string = `
+  $ apptainer instance generate-unit --bind /data:/data my-sql.sif mysql > mysql.service
+  $ apptainer instance generate-unit --install --now --restart on-failure:3 my-sql.sif mysql
+  $ systemctl --user status apptainer-instance-mysql.service
+  $ sudo apptainer instance generate-unit --install --system my-sql.sif mysql`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance logs
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceLogsUse   string = `logs [logs options...] <instance name>`
+	InstanceLogsShort string = `Print the logs of a named instance`
+	InstanceLogsLong  string = `
+  The instance logs command prints the standard output and error logs of a
+  named instance, respectively to the standard output and error streams. Use
+  --stdout or --stderr to print only one of them, and --tail to print only the
+  last lines of each log. With --follow, new log lines are printed until the
+  command is interrupted, including after the log files have been rotated.
+  With --timestamps, lines are prefixed with the time they were read.
+
+  Log files are rotated when they reach the size set by the --log-max-size
+  option of instance start/run, or by the 'instance log max size' directive in
+  apptainer.conf. Rotated logs are kept as <log file>.1 (the most recent) up to
+  <log file>.N where N is set by --log-max-files.
+
+  If you are root, you can optionally ask for logs of a container instance
+  belonging to a specific user.`
+	InstanceLogsExample string = `
+  $ apptainer instance logs mysql
+  $ apptainer instance logs --follow --tail 10 mysql
+  $ apptainer instance logs --stderr --timestamps mysql
+  $ sudo apptainer instance logs --user <username> user-mysql`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance inspect
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceInspectUse   string = `inspect [inspect options...] <instance name>`
+	InstanceInspectShort string = `Show the launch configuration of a named instance`
+	InstanceInspectLong  string = `
+  The instance inspect command shows the configuration a named instance was
+  started with, as resolved once the apptainer.conf directives and the command
+  line options are merged: the version of apptainer which started it, the
+  namespaces in use, the cgroup path, the network and GPU options, the bind
+  paths, overlays and environment, and the mount table applied in the
+  container. The values of the environment variables which may hold secrets,
+  like tokens, passwords or keys, are redacted.
+
+  Fields are reported as unknown for instances started by an older version of
+  apptainer, and the mount table is unknown when it couldn't be read when the
+  instance was started.`
+	InstanceInspectExample string = `
+  $ apptainer instance inspect mysql
+  $ apptainer instance inspect --json mysql
+  $ sudo apptainer instance inspect --user <username> user-mysql`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance cleanup
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceCleanupUse   string = `cleanup [cleanup options...] [instance name glob]`
+	InstanceCleanupShort string = `Clean up the resources left by crashed instances`
+	InstanceCleanupLong  string = `
+  The command apptainer instance cleanup releases the resources left by stale
+  instances, whose starter process was killed or which were started before the
+  last reboot: FUSE image mounts, the instance cgroup, the addresses allocated
+  on CNI networks, and the instance files. This pass also runs automatically at
+  the start of the other instance commands for the instances of the current
+  user.
+
+  Only the resources positively identified as created for a stale instance are
+  released: FUSE mounts carrying the apptainer marker with the pid of the
+  instance in their source, and the /apptainer/<pid> cgroup or apptainer-<pid>
+  systemd scope once empty. Nothing is released while the instance pid belongs
+  to a running process. Releasing CNI network resources requires root, root can
+  clean up the instances of all users with --all-users.
+
+  With --dry-run, the stale instances and the resources which would be released
+  are only listed.`
+	InstanceCleanupExample string = `
+  $ apptainer instance cleanup --dry-run
+  $ apptainer instance cleanup
+  $ sudo apptainer instance cleanup --all-users`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance stop
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
-	InstanceStopUse   string = `stop [stop options...] [instance]`
+	InstanceStopUse   string = `stop [stop options...] [instance name glob...]`
 	InstanceStopShort string = `Stop a named instance of a given container image`
 	InstanceStopLong  string = `
   The command apptainer instance stop allows you to stop and clean up a named,
-  running instance of a given container image.`
+  running instance of a given container image. The instance names may be glob
+  patterns matching several instances, or --all stops all instances.
+
+  Instances are sent SIGINT, or the signal set with --signal, and are killed
+  with SIGKILL if they are still running after the --timeout grace period, in
+  which case the command fails. With --force, instances are killed
+  immediately. The command returns once the instance processes have exited,
+  including any process left in the instance cgroup. The resources and files
+  of instances which already exited are cleaned up, see 'instance cleanup'. Root can stop the instances of another user with
+  --user, which is logged to syslog. With --release-ip, the network addresses
+  kept for the instances are released, even if they are not running.
+
+  With --filter, only the running instances matching all the filters are
+  stopped, see 'instance list' for the available filters.`
 	InstanceStopExample string = `
   $ apptainer instance start my-sql.sif mysql1
   $ apptainer instance start my-sql.sif mysql2
@@ -651,7 +1224,32 @@ Enterprise Performance Computing (EPC)`
   Send SIGTERM to the instance
   $ apptainer instance stop -s SIGTERM mysql1
   $ apptainer instance stop -s TERM mysql1
-  $ apptainer instance stop -s 15 mysql1`
+  $ apptainer instance stop -s 15 mysql1
+
+  Give the instance 60 seconds to stop before killing it
+  $ apptainer instance stop -s SIGTERM -t 60 mysql1
+
+  Stop all instances matching a glob pattern
+  $ apptainer instance stop --all 'web-*'
+
+  Stop an instance and release its network address
+  $ apptainer instance stop --release-ip mysql1
+
+  Stop all instances of an image started more than a day ago
+  $ apptainer instance stop --all --filter image=my-sql.sif --filter older-than=24h`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance restart
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceRestartUse   string = `restart [restart options...] <instance name>`
+	InstanceRestartShort string = `Restart a named instance with its original options`
+	InstanceRestartLong  string = `
+  The instance restart command stops a named instance and starts it again with
+  the command line options, environment and working directory it was originally
+  started with, including its restart policy.`
+	InstanceRestartExample string = `
+  $ apptainer instance start --restart on-failure:5 my-sql.sif mysql
+  $ apptainer instance restart mysql`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// pull
@@ -675,7 +1273,10 @@ Enterprise Performance Computing (EPC)`
       oras://registry/namespace/image:tag
 
   http, https: Pull an image using the http(s?) protocol
-      https://example.com/alpine.sif`
+      https://example.com/alpine.sif
+
+  Installed plugins can handle additional URI schemes, their images are cached
+  by the digest the plugin resolves them to.`
 	PullExample string = `
   From a library
   $ apptainer pull alpine.sif library://alpine:latest
@@ -705,6 +1306,13 @@ Enterprise Performance Computing (EPC)`
   oras:
       oras://registry/namespace/image:tag
 
+  Installed plugins can handle additional URI schemes.
+
+  Before uploading to the library, the size of the image is checked against
+  the storage quota of the entity. Images larger than 64MiB are uploaded in
+  parts, whose size can be set with --chunk-size; a failed part is retried,
+  and an interrupted upload is resumed by running the same push again, as
+  long as the library keeps it.
 
   NOTE: It's always good practice to sign your containers before
   pushing them to the library. An auth token is required to push to the library,
@@ -724,11 +1332,21 @@ Enterprise Performance Computing (EPC)`
 	SearchLong  string = `
   Search a Container Library for container images matching the search query.
   You can specify an alternate architecture, and/or limit
-  the results to only signed images.`
+  the results to only signed images, or to the images of an owner.
+
+  With --limit, the results are split in pages of that many images, the page
+  displayed being selected with --page. The library of the active remote is
+  searched, or of the remote given with --remote.
+
+  With --json, the results are printed as a JSON array of images, with the
+  path, tags, hash, arch, size, buildDate, description, signed and
+  fingerprints fields.`
 	SearchExample string = `
   $ apptainer search lolcow
   $ apptainer search --arch arm64 alpine
-  $ apptainer search --signed tensorflow`
+  $ apptainer search --signed tensorflow
+  $ apptainer search --owner library --limit 10 --page 2 --json alpine
+  $ apptainer search --remote MyRemote alpine`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// run
@@ -743,7 +1361,7 @@ Enterprise Performance Computing (EPC)`
   automatically. All arguments following the container name will be passed
   directly to the runscript.
 
-  apptainer run accepts the following container formats:` + formats
+  apptainer run accepts the following container formats:` + formats + environment + exitStatus
 	RunExamples string = `
   # Here we see that the runscript prints "Hello world: "
   $ apptainer exec /tmp/debian.sif cat /apptainer
@@ -763,7 +1381,7 @@ Enterprise Performance Computing (EPC)`
 	ShellUse   string = `shell [shell options...] <container>`
 	ShellShort string = `Run a shell within a container`
 	ShellLong  string = `
-  apptainer shell supports the following formats:` + formats
+  apptainer shell supports the following formats:` + formats + environment + exitStatus
 	ShellExamples string = `
   $ apptainer shell /tmp/Debian.sif
   Apptainer/Debian.sif> pwd
@@ -801,13 +1419,22 @@ Enterprise Performance Computing (EPC)`
   the file.
 
   Key material can be provided via PEM-encoded file, or an entity in the PGP
-  keyring. To manage the PGP keyring, see 'apptainer help key'.`
+  keyring. To manage the PGP keyring, see 'apptainer help key'.
+
+  With --use-gpg-agent, the image is signed with the key of the GnuPG keyring
+  with the given ID, the signature being delegated to gpg-agent: the private
+  key never enters the Apptainer keyring, and its passphrase is asked by the
+  pinentry of the agent. Only RSA keys are supported. To verify the
+  signatures, import the public key with 'apptainer key import --gpg'.`
 	SignExample string = `
   Sign with a private key:
   $ apptainer sign --key private.pem container.sif
 
   Sign with PGP:
-  $ apptainer sign container.sif`
+  $ apptainer sign container.sif
+
+  Sign with a key held by gpg-agent:
+  $ apptainer sign --use-gpg-agent 0x12345678 container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// verify
@@ -819,7 +1446,12 @@ Enterprise Performance Computing (EPC)`
   within a SIF image.
 
   Key material can be provided via PEM-encoded file, or via the PGP keyring. To
-  manage the PGP keyring, see 'apptainer help key'.`
+  manage the PGP keyring, see 'apptainer help key'.
+
+  With the PGP keyring, only the global keyring, the local keyring, the
+  legacy keyring and the keyring of the remote in use are consulted, the
+  keys retrieved from the keyserver of the remote being stored in the
+  latter. The keyring holding the key of each signature is reported.`
 	VerifyExample string = `
   Verify with a public key:
   $ apptainer verify --key public.pem container.sif
@@ -859,21 +1491,82 @@ Enterprise Performance Computing (EPC)`
   $ apptainer run-help --app foo my_container.sif
 
     Some help for application in this container`
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Apps
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	AppsUse   string = `apps [apps options...] <image path>`
+	AppsShort string = `List the SCIF apps of an image`
+	AppsLong  string = `
+  The apps command lists the SCIF apps installed in an image under /scif/apps,
+  with a summary taken from the first line of the %apphelp section of each
+  app, or from a label ending with summary or description if the app has no
+  help.
+
+  With --json, the labels and environment of each app are also printed, along
+  with the disk usage in bytes of the app directory, which is null if it could
+  not be determined. Getting the size of the apps of a SIF image requires
+  running a container.
+
+  The apps are run with the --app option of the run, exec, shell, test and
+  instance start commands, and inspected with inspect --app. These commands
+  fail with the list of the available apps when the image has no app with the
+  given name. (See https://sci-f.github.io for more information on SCIF apps)`
+	AppsExample string = `
+  $ apptainer apps analysis.sif
+  APP         SUMMARY
+  plot        Plot the results of a simulation
+  simulate    Run a simulation from an input file
+
+  $ apptainer apps --json analysis.sif
+
+  $ apptainer run --app simulate analysis.sif --steps 100 input.dat`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Inspect
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
-	InspectUse   string = `inspect [inspect options...] <image path>`
+	InspectUse   string = `inspect [inspect options...] <image path or URI>`
 	InspectShort string = `Show metadata for an image`
 	InspectLong  string = `
   Inspect will show you labels, environment variables, apps and scripts associated 
   with the image determined by the flags you pass. By default, they will be shown in 
   plain text. If you would like to list them in json format, you should use the --json flag.
+
+  The JSON output holds the selected attributes under data.attributes, an
+  attribute missing from the image being reported as null. With --app, the
+  labels, environment and scripts of the app are reported under
+  data.attributes.apps.<app>, the command failing with the list of the
+  available apps if the image has no such app. The --format option formats the attributes of
+  the JSON output with a Go template, and implies --all.
+
+  A SIF image piped to stdin is inspected with - as image argument.
+
+  SIF and sandbox images, and OCI image URIs (docker://, docker-daemon:,
+  docker-archive:, oci: and oci-archive:) can be inspected. For an OCI image
+  URI only the image configuration is fetched, and the labels, environment,
+  runscript and OCI configuration reported are the ones of the container
+  which would be built from it.
+
+  With --remote, the metadata of a docker://, oras:// or library:// image is
+  read from its registry or library without pulling the image: only the
+  manifest and image configuration are fetched, and for SIF images the header
+  and descriptor table of the image with range requests. The size,
+  architecture, layer digests, labels, environment and entrypoint are
+  reported, and the JSON output has the type remote. oras:// and library://
+  images which are not in the cache are inspected this way automatically.
+  Nothing is written to the cache, unless --cache-metadata is given to record
+  the metadata for use in offline mode.
   `
 	InspectExample string = `
   $ apptainer inspect ubuntu.sif
+  $ apptainer inspect --json --runscript --app foo ubuntu.sif
+  $ apptainer inspect --format '{{ index .labels "org.label-schema.build-date" }}' ubuntu.sif
+  $ apptainer inspect --oci-config docker://ubuntu
+  $ apptainer inspect --remote --json docker://ubuntu
+  $ apptainer inspect --remote --cache-metadata oras://registry/image:tag
   
   If you want to list the applications (apps) installed in a container (located at
-  /scif/apps) you should run inspect command with --list-apps <container-image> flag.
+  /scif/apps) you should run inspect command with --list-apps <container-image> flag,
+  or the apps command to also show their summary.
   ( See https://sci-f.github.io for more information on SCIF apps)
 
   The following environment variables are available to you when called 
@@ -934,8 +1627,7 @@ Enterprise Performance Computing (EPC)`
       then subsequent container commands will all run within the same 
       namespaces. This means that the --writable and --contain options will not 
       be honored as the namespaces have already been configured by the 
-      'apptainer start' command.
-`
+      'apptainer start' command.` + exitStatus
 	RunTestExample string = `
   Set the '%test' section with a definition file like so:
   %test
@@ -1013,13 +1705,18 @@ Enterprise Performance Computing (EPC)`
 	OciAttachExample string = `
   $ apptainer oci attach mycontainer`
 
-	OciExecUse   string = `exec <container_ID> <command> <args>`
+	OciExecUse   string = `exec [exec options...] <container_ID> <command> <args>`
 	OciExecShort string = `Execute a command within container (root user only)`
 	OciExecLong  string = `
   Exec will execute the provided command/arguments within container identified 
-  by container ID.`
+  by container ID. The command enters in all the namespaces and in the cgroup 
+  of the container.`
 	OciExecExample string = `
-  $ apptainer oci exec mycontainer id`
+  $ apptainer oci exec mycontainer id
+
+  To run an interactive shell with a terminal in the /tmp directory :
+
+  $ apptainer oci exec --tty --cwd /tmp --env TERM=xterm mycontainer /bin/sh`
 
 	OciRunUse   string = `run -b <bundle_path> [run options...] <container_ID>`
 	OciRunShort string = `Create/start/attach/delete a container from a bundle directory (root user only)`
@@ -1062,6 +1759,19 @@ Enterprise Performance Computing (EPC)`
 	OciResumeExample string = `
   $ apptainer oci resume mycontainer`
 
+	OciEventsUse   string = `events [events options...] <container_ID>`
+	OciEventsShort string = `Display container events and resource usage statistics (root user only)`
+	OciEventsLong  string = `
+  Events will display the resource usage statistics of the container every 
+  interval, and its OOM kills with cgroups v2, as JSON lines compatible with 
+  runc events, until the container stops.`
+	OciEventsExample string = `
+  $ apptainer oci events --interval 1s mycontainer
+
+  or to display the statistics once :
+
+  $ apptainer oci events --stats mycontainer`
+
 	OciMountUse   string = `mount <sif_image> <bundle_path>`
 	OciMountShort string = `Mount create an OCI bundle from SIF image (root user only)`
 	OciMountLong  string = `
@@ -1088,11 +1798,14 @@ Enterprise Performance Computing (EPC)`
   $ apptainer help config fakeroot
   $ apptainer config fakeroot --help`
 
-	ConfigFakerootUse   string = `fakeroot <option> <user>`
+	ConfigFakerootUse   string = `fakeroot <option> [user]`
 	ConfigFakerootShort string = `Manage fakeroot user mappings entries (root user only)`
 	ConfigFakerootLong  string = `
   The config fakeroot command allow a root user to add/remove/enable/disable fakeroot
-  user mappings.`
+  user mappings. Users can be added in bulk from a file or a group, ranges are
+  allocated deterministically in the order of the users, without overlapping
+  existing entries. The subuid and subgid files are locked and replaced
+  atomically, like shadow-utils tools do.`
 	ConfigFakerootExample string = `
   To add a fakeroot user mapping for vagrant user:
   $ apptainer config fakeroot --add vagrant
@@ -1104,7 +1817,16 @@ Enterprise Performance Computing (EPC)`
   $ apptainer config fakeroot --disable vagrant
 
   To enable a fakeroot user mapping for vagrant user:
-  $ apptainer config fakeroot --enable vagrant`
+  $ apptainer config fakeroot --enable vagrant
+
+  To show the fakeroot user mappings added for the users listed in users.txt:
+  $ apptainer config fakeroot --add-file users.txt --dry-run
+
+  To add fakeroot user mappings for the members of the hpc group:
+  $ apptainer config fakeroot --add-group hpc
+
+  To audit /etc/subuid and /etc/subgid:
+  $ apptainer config fakeroot --validate`
 
 	ConfigGlobalUse   string = `global <option> <directive> [value,...]`
 	ConfigGlobalShort string = `Edit apptainer.conf from command line (root user only or unprivileged installation)`
@@ -1137,11 +1859,13 @@ Enterprise Performance Computing (EPC)`
   $ apptainer help overlay create
   $ apptainer overlay create --help`
 
-	OverlayCreateUse   string = `create <options> image`
+	OverlayCreateUse   string = `create <options> [image]`
 	OverlayCreateShort string = `Create EXT3 writable overlay image`
 	OverlayCreateLong  string = `
   The overlay create command allows creating EXT3 writable overlay image either
-  as a single EXT3 image or by adding it automatically to an existing SIF image.`
+  as a single EXT3 image or by adding it automatically to an existing SIF image.
+  With --sif, the overlay is always added to the given SIF image, appended in
+  place without rewriting the image.`
 	OverlayCreateExample string = `
   To create and add a writable overlay to an existing SIF image:
   $ apptainer overlay create --size 1024 /tmp/image.sif
@@ -1153,7 +1877,10 @@ Enterprise Performance Computing (EPC)`
   $ apptainer overlay create --size 1024 --sparse /tmp/ext3_overlay.img
 
   To create an EXT3 writable overlay image for use with --fakeroot actions:
-  $ apptainer overlay create --fakeroot --size 1024 /tmp/my_overlay.img`
+  $ apptainer overlay create --fakeroot --size 1024 /tmp/my_overlay.img
+
+  To add a writable overlay with some directories to an existing SIF image:
+  $ apptainer overlay create --create-dirs /data,/opt/app --size 2048 --sif /tmp/image.sif`
 
 	CheckpointUse   string = `checkpoint`
 	CheckpointShort string = `Manage container checkpoint state (experimental)`
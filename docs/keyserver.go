@@ -37,13 +37,22 @@ const (
   keyservers that have already been specified. Therefore, when specifying
   '--order 1', the new keyserver will become the primary one. If no endpoint is
   specified, the new keyserver will be associated with the default remote
-  endpoint.`
+  endpoint.
+
+  By default a keyserver is used for all operations: the first keyserver in
+  order allowing it is used to push, search and pull keys, and all the
+  keyservers allowing it are queried at once for keys during verification,
+  the first answer being used. The --no-push, --no-search and --no-verify
+  options exclude the keyserver from these operations.`
 	KeyserverAddExample string = `
   $ apptainer keyserver add https://keys.example.com
 
   To add a keyserver to be used as the primary keyserver for the current
   endpoint:
-  $ apptainer keyserver add --order 1 https://keys.example.com`
+  $ apptainer keyserver add --order 1 https://keys.example.com
+
+  To add a read-only mirror only used to verify images:
+  $ apptainer keyserver add --order 2 --no-push --no-search https://mirror.example.com`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// keyserver remove command
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -83,7 +92,10 @@ const (
 	KeyserverListLong  string = `
   The 'keyserver list' command lists all keyservers configured for use with a
   given remote endpoint. If no endpoint is specified, the default
-  remote endpoint will be assumed.`
+  remote endpoint will be assumed. The operations each keyserver is used for
+  are shown, and with --status the keyservers are queried to show if they are
+  reachable and their response time.`
 	KeyserverListExample string = `
-  $ apptainer keyserver list`
+  $ apptainer keyserver list
+  $ apptainer keyserver list --status`
 )
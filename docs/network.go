@@ -0,0 +1,91 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package docs
+
+// Network command usage.
+const (
+	NetworkUse   string = `network [network options...]`
+	NetworkShort string = `Manage the CNI networks used with --network`
+	NetworkLong  string = `
+  The 'network' command allows you to create, list, inspect and remove the CNI
+  networks selected with the --network option of the action and instance
+  commands.
+
+  The networks created by root are written in the CNI configuration directory
+  of the system. The networks created by a user are written in the 'network'
+  directory of the apptainer configuration directory of the user ($HOME/.apptainer
+  by default), they are only used in rootless mode, once the networks of the
+  system are searched: with --fakeroot, or when the administrator permits their
+  name with the 'allow net networks' directive.`
+	NetworkExample string = `
+  All group commands have their own help output:
+
+  $ apptainer help network create
+  $ apptainer network list --help`
+)
+
+// Network create command usage.
+const (
+	NetworkCreateUse   string = `create [create options...] <name>`
+	NetworkCreateShort string = `Create a CNI network`
+	NetworkCreateLong  string = `
+  The 'network create' command creates a network of the bridge driver, with
+  the host-local IPAM, the firewall, portmap and bandwidth plugins. The subnets
+  of the network must not overlap with the subnets of the existing networks.
+  An internal network has no default route nor masquerading, its containers
+  only reach each other.`
+	NetworkCreateExample string = `
+  $ apptainer network create --subnet 10.88.1.0/24 mynet
+  $ apptainer network create --subnet 10.88.2.0/24 --gateway 10.88.2.254 \
+      --ipv6 fd00:10:88:2::/64 --internal backend
+  $ apptainer instance start --network mynet image.sif web`
+)
+
+// Network list command usage.
+const (
+	NetworkListUse   string = `list [list options...]`
+	NetworkListShort string = `List the CNI networks`
+	NetworkListLong  string = `
+  The 'network list' command lists the networks of the system, followed by the
+  networks of the user when run by a user. A network of the user with the name
+  of a network of the system is not listed, as --network selects the network
+  of the system.`
+	NetworkListExample string = `
+  $ apptainer network list
+  NAME      SCOPE   SUBNETS                         PLUGINS
+  bridge    system  10.22.0.0/16,fd00:10:22::/64    bridge,firewall,portmap,bandwidth
+  mynet     user    10.88.1.0/24                    bridge,firewall,portmap,bandwidth
+
+  $ apptainer network list --json`
+)
+
+// Network inspect command usage.
+const (
+	NetworkInspectUse   string = `inspect <name>`
+	NetworkInspectShort string = `Show the configuration of a CNI network`
+	NetworkInspectLong  string = `
+  The 'network inspect' command shows the scope, the subnets and the CNI
+  configuration of a network as JSON, along with the running instances of the
+  user attached to it.`
+	NetworkInspectExample string = `
+  $ apptainer network inspect mynet`
+)
+
+// Network remove command usage.
+const (
+	NetworkRemoveUse   string = `remove <name>`
+	NetworkRemoveShort string = `Remove a CNI network`
+	NetworkRemoveLong  string = `
+  The 'network remove' command removes a network created with 'network
+  create', from the networks of the system when run by root, or else from the
+  networks of the user. A network with running instances attached is not
+  removed, they must be stopped first.`
+	NetworkRemoveExample string = `
+  $ apptainer network remove mynet`
+)
@@ -30,7 +30,14 @@ const (
 	PluginCompileLong  string = `
   The 'plugin compile' command allows a developer to compile an Apptainer
   plugin in the expected environment. The provided host directory is the 
-  location of the plugin's source code. A compiled plugin is packed into a SIF file.`
+  location of the plugin's source code. A compiled plugin is packed into a SIF file.
+
+  A plugin with a go.mod file, as generated by 'plugin create', can be compiled
+  outside of the Apptainer source tree. It is compiled against the plugin SDK
+  installed with 'make install-plugin-sdk', or the Apptainer source tree if it is
+  available, or else the module of the matching Apptainer release downloaded with
+  the Go toolchain. The SIF file records the Go version, build settings and
+  module versions the plugin was compiled with.`
 	PluginCompileExample string = `
   $ apptainer plugin compile $HOME/apptainer/test-plugin`
 )
@@ -41,7 +48,9 @@ const (
 	PluginInstallShort string = `Install a compiled Apptainer plugin`
 	PluginInstallLong  string = `
   The 'plugin install' command installs the compiled plugin found at plugin_path
-  into the appropriate directory on the host.`
+  into the appropriate directory on the host. A plugin compiled with a different
+  Go version, build settings or module versions than Apptainer is refused, and
+  must be recompiled with 'plugin compile'.`
 	PluginInstallExample string = `
   $ apptainer plugin install $HOME/apptainer/test-plugin/test-plugin.sif`
 )
@@ -61,33 +70,81 @@ const (
 	PluginListUse   string = `list [list options...]`
 	PluginListShort string = `List installed Apptainer plugins`
 	PluginListLong  string = `
-  The 'plugin list' command lists the Apptainer plugins installed on the host.`
+  The 'plugin list' command lists the Apptainer plugins installed on the host,
+  whether they are enabled, by the system or the user '(user)', and whether
+  they are compatible with this Apptainer and loaded without error. A plugin
+  which is not compatible, or fails to load, is disabled with a warning.`
 	PluginListExample string = `
   $ apptainer plugin list
-  ENABLED  NAME
-      yes  example.org/plugin`
+  ENABLED  STATUS        NAME
+      yes  ok            example.org/plugin
+       no  incompatible  example.org/other-plugin (user)
+
+  $ apptainer plugin list --json`
 )
 
 // Plugin enable command usage.
 const (
-	PluginEnableUse   string = `enable <name>`
+	PluginEnableUse   string = `enable [enable options...] <name>`
 	PluginEnableShort string = `Enable an installed Apptainer plugin`
 	PluginEnableLong  string = `
   The 'plugin enable' command allows a user to enable a plugin that is already
-  installed in the system and which has been previously disabled.`
+  installed in the system and which has been previously disabled. With --user,
+  the plugin is enabled for the current user only, which doesn't require any
+  privilege.`
 	PluginEnableExample string = `
-  $ apptainer plugin enable example.org/plugin`
+  $ apptainer plugin enable example.org/plugin
+  $ apptainer plugin enable --user example.org/plugin`
 )
 
 // Plugin disable command usage.
 const (
-	PluginDisableUse   string = `disable <name>`
+	PluginDisableUse   string = `disable [disable options...] <name>`
 	PluginDisableShort string = `disable an installed Apptainer plugin`
 	PluginDisableLong  string = `
   The 'plugin disable' command allows a user to disable a plugin that is already
-  installed in the system and which has been previously enabled.`
+  installed in the system and which has been previously enabled. With --user,
+  the plugin is disabled for the current user only, which doesn't require any
+  privilege. The plugins enabled or disabled by the user only apply to the
+  commands and container configuration, the plugins called by the container
+  runtime follow the system state. All plugins can be disabled for a single
+  command with the global --no-plugins flag.`
 	PluginDisableExample string = `
-  $ apptainer plugin disable example.org/plugin`
+  $ apptainer plugin disable example.org/plugin
+  $ apptainer plugin disable --user example.org/plugin
+  $ apptainer --no-plugins exec image.sif true`
+)
+
+// Plugin configure command usage.
+const (
+	PluginConfigureUse   string = `configure [configure options...] <name>`
+	PluginConfigureShort string = `Edit, validate or show the configuration of an installed Apptainer plugin`
+	PluginConfigureLong  string = `
+  The 'plugin configure' command allows a user to manage the configuration of
+  an installed plugin. The configuration is read from the YAML file
+  <name>.yaml of the plugins directory of the apptainer configuration
+  directory, and from the same file in ~/.apptainer/plugins for the current
+  user, the user values taking precedence over the system ones. Nested
+  mappings are merged key by key, any other value is replaced.
+
+  With --set and --unset, the keys of the system configuration file are
+  changed, or those of the user configuration file with --user, which doesn't
+  require any privilege. The values are parsed as YAML, and the resulting
+  configuration is validated by the plugin before being written. With
+  --validate, the current configuration is checked. Otherwise, the
+  configuration is printed.
+
+  The configuration is checked again each time the plugin is loaded, a plugin
+  with an invalid configuration is disabled with a warning. The user
+  configuration only applies to the commands and container configuration, the
+  plugins called by the container runtime only read the system configuration.`
+	PluginConfigureExample string = `
+  $ sudo apptainer plugin configure --set root=/data/projects example.com/project-plugin
+  $ apptainer plugin configure --user --set destination=/work example.com/project-plugin
+  $ apptainer plugin configure --validate example.com/project-plugin
+  $ apptainer plugin configure example.com/project-plugin
+  destination: /work
+  root: /data/projects`
 )
 
 // Plugin inspect command usage.
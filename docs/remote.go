@@ -54,9 +54,20 @@ const (
 	RemoteAddLong  string = `
   The 'remote add' command allows you to add a new remote endpoint to be
   be used for apptainer remote services. Authentication with a newly created
-  endpoint will occur automatically.`
+  endpoint will occur automatically.
+
+  For an endpoint requiring mutual TLS, or using certificates of a private
+  certificate authority, --ca-cert adds a PEM CA bundle trusted in addition
+  to the system ones, and --client-cert and --client-key set the client
+  certificate presented. The client key must only be readable by its owner
+  (mode 0600). They are used for the library and keyserver services of the
+  endpoint, and by pull, push and run for the endpoint itself or the OCI
+  registry of its library, when used as a docker:// or oras:// registry.`
 	RemoteAddExample string = `
-  $ apptainer remote add ExampleCloud cloud.example.com`
+  $ apptainer remote add ExampleCloud cloud.example.com
+
+  To add an endpoint requiring mutual TLS:
+  $ apptainer remote add --ca-cert ca.pem --client-cert me.pem --client-key me.key ExampleCloud cloud.example.com`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// remote remove command
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -99,10 +110,23 @@ const (
   endpoint.
 
   If no endpoint or registry is specified, the command will login to the currently
-  active remote endpoint.`
+  active remote endpoint.
+
+  With --oidc, the login uses the OIDC device authorization flow of the
+  endpoint's OpenID provider, given with --oidc-issuer or configured for the
+  remote: a URL and a code are printed, to open and enter in a browser. The
+  access token is then refreshed when used. The refresh token is stored
+  encrypted in the remote configuration, with a key kept in the login keyring
+  of the user, or with --oidc-passphrase derived from a passphrase, asked when
+  refreshing or read from the APPTAINER_OIDC_PASSPHRASE environment variable.
+  Once the refresh token expires, or the user logs out of the session holding
+  the login keyring, a new login is required.`
 	RemoteLoginExample string = `
   To log in to an endpoint:
-  $ apptainer remote login SylabsCloud`
+  $ apptainer remote login SylabsCloud
+
+  To log in to an endpoint with an OpenID provider:
+  $ apptainer remote login --oidc --oidc-issuer https://auth.example.com/realms/hpc MyRemote`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// remote logout command
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -119,7 +143,7 @@ const (
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// remote status command
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
-	RemoteStatusUse   string = `status [remote_name]`
+	RemoteStatusUse   string = `status [status options...] [remote_name]`
 	RemoteStatusShort string = `Check the status of the apptainer services at an endpoint, and your authentication token`
 	RemoteStatusLong  string = `
   The 'remote status' command checks the status of the specified remote endpoint
@@ -127,7 +151,73 @@ const (
   user's logged-in status (or lack thereof) on that endpoint. If no endpoint is
   specified, it will check the status of the default remote. If
   you have logged in with an authentication token the validity of that token
-  will be checked.`
+  will be checked.
+
+  The services are probed concurrently, with a short timeout. For each one,
+  the status tells whether it is reachable, or why not: DNS lookup failure,
+  timeout, connection refused, untrusted server certificate, rejected client
+  certificate or server error. The validity and expiry date of the certificate
+  presented by the service are shown too.
+
+  The command fails if one of the services isn't reachable, or only one of
+  the services listed with --require. With --json, the status is printed as a
+  JSON object with the remote, uri, services, requiredDown, identity and token
+  fields, each service having the service, uri, reachable, latencyMs,
+  version, errorKind (dns, timeout, refused, tls-untrusted,
+  tls-client-rejected, http, not-provided or error), error and tls fields.`
 	RemoteStatusExample string = `
-  $ apptainer remote status`
+  $ apptainer remote status
+
+  To check that the library and keyserver of a remote are reachable, from a
+  script:
+  $ apptainer remote status --json --require library,keyserver MyRemote`
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// remote export command
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	RemoteExportUse   string = `export [export options...] <file>`
+	RemoteExportShort string = `Export the remote endpoints and keyservers to a file`
+	RemoteExportLong  string = `
+  The 'remote export' command writes the remote endpoints configured, with
+  their keyservers and TLS files, to a YAML file in the format of the remote
+  configuration, to be imported on other hosts with 'remote import'. With a
+  file '-', the configuration is written to the standard output.
+
+  The remotes of the system configuration are left out of an export of the
+  user configuration, and are exported with --global. The authentication
+  tokens and credentials are never written, unless --insecure-include-tokens
+  is given.`
+	RemoteExportExample string = `
+  $ apptainer remote export remotes.yaml
+
+  To export the system configuration:
+  $ sudo apptainer remote export --global remotes.yaml`
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// remote import command
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	RemoteImportUse   string = `import [import options...] <file>`
+	RemoteImportShort string = `Import remote endpoints and keyservers from a file`
+	RemoteImportLong  string = `
+  The 'remote import' command adds the remote endpoints of a file written by
+  'remote export' to the configuration. Each entry is validated: its URI, its
+  TLS files, and an exclusive remote can only be imported with --global.
+
+  By default, or with --merge, the imported remotes are merged with the
+  existing ones: a remote already defined differently is reported as a
+  conflict and left unchanged, and the active remote of the file is only used
+  if none is set. With --replace, the existing remotes are removed first, and
+  the active remote of the file is used. The remotes of the system
+  configuration are never replaced by a user import.
+
+  With --global, the remotes are imported into the system configuration,
+  seen immediately by all users, their own remotes being layered on top. An
+  exclusive remote of the system configuration is the active remote of all
+  users.
+
+  The entries which couldn't be imported are reported individually, and the
+  command fails once the other ones are imported.`
+	RemoteImportExample string = `
+  $ apptainer remote import remotes.yaml
+
+  To provision the remotes of all users of a host:
+  $ sudo apptainer remote import --global --replace remotes.yaml`
 )
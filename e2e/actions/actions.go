@@ -11,23 +11,32 @@ package actions
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/Netflix/go-expect"
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
 	"github.com/apptainer/apptainer/e2e/internal/testhelper"
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/test/tool/exec"
 	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/network"
+	"github.com/apptainer/apptainer/pkg/util/slice"
+	"github.com/creack/pty"
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
 type actionTests struct {
@@ -384,6 +393,111 @@ func (c actionTests) actionShell(t *testing.T) {
 	}
 }
 
+// actionPty tests the pseudo-terminal allocated with --pty: the window size
+// changes and Ctrl-C reach the container process, and the terminal of the
+// caller is restored once the container process crashed.
+func (c actionTests) actionPty(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	// the trap of SIGINT prints the window size before crashing
+	script := `trap 'stty size; kill -SEGV $$' INT; trap 'stty size' WINCH; echo ready; while :; do sleep 0.1; done`
+
+	var tty *os.File
+	termios := func(t *testing.T, c *expect.Console) *unix.Termios {
+		t.Helper()
+		if tty == nil {
+			tty = c.Tty()
+		}
+		tios, err := unix.IoctlGetTermios(int(tty.Fd()), unix.TCGETS)
+		if err != nil {
+			t.Fatalf("while getting console attributes: %s", err)
+		}
+		return tios
+	}
+	raw := func(tios *unix.Termios) bool {
+		return tios.Lflag&(unix.ICANON|unix.ECHO) == 0
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		consoleOps []e2e.ApptainerConsoleOp
+		exit       int
+	}{
+		{
+			name: "Pty",
+			args: []string{"--pty", c.env.ImagePath, "/bin/sh", "-c", script},
+			consoleOps: []e2e.ApptainerConsoleOp{
+				e2e.ConsoleExpect("ready"),
+				func(t *testing.T, c *expect.Console) {
+					if !raw(termios(t, c)) {
+						t.Errorf("console not in raw mode with --pty")
+					}
+					if err := pty.Setsize(tty, &pty.Winsize{Rows: 33, Cols: 111}); err != nil {
+						t.Fatalf("while resizing console: %s", err)
+					}
+				},
+				e2e.ConsoleExpect("33 111"),
+				// Ctrl-C
+				e2e.ConsoleSend("\x03"),
+				e2e.ConsoleExpect("33 111"),
+				func(t *testing.T, c *expect.Console) {
+					// the terminal is restored once the container exited
+					for i := 0; i < 100 && raw(termios(t, c)); i++ {
+						time.Sleep(100 * time.Millisecond)
+					}
+					if raw(termios(t, c)) {
+						t.Errorf("console not restored after the container crashed")
+					}
+				},
+			},
+			exit: 128 + int(syscall.SIGSEGV),
+		},
+		{
+			name: "NoPty",
+			args: []string{"--no-pty", c.env.ImagePath, "/bin/sh", "-c", "test -t 0 && echo tty"},
+			consoleOps: []e2e.ApptainerConsoleOp{
+				e2e.ConsoleExpect("tty"),
+				func(t *testing.T, c *expect.Console) {
+					if raw(termios(t, c)) {
+						t.Errorf("console in raw mode with --no-pty")
+					}
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tty = nil
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.args...),
+			e2e.ConsoleRun(tt.consoleOps...),
+			e2e.ExpectExit(tt.exit),
+		)
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("PtyNoTerminal"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--pty", c.env.ImagePath, "true"),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "--pty requires a terminal on standard input")),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("PtyAndNoPty"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--pty", "--no-pty", c.env.ImagePath, "true"),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "--pty and --no-pty can't be used together")),
+	)
+}
+
 // STDPipe tests pipe stdin/stdout to apptainer actions cmd
 func (c actionTests) STDPipe(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
@@ -474,6 +588,13 @@ func (c actionTests) STDPipe(t *testing.T) {
 			output:  "RUNNING FOO",
 			exit:    0,
 		},
+		{
+			name:    "AppsBarArguments",
+			command: "run",
+			argv:    []string{"--app", "bar", c.env.ImagePath, "--", "a", "b c"},
+			output:  "--\na\nb c",
+			exit:    0,
+		},
 		{
 			name:    "CwdPath",
 			command: "exec",
@@ -1108,833 +1229,2672 @@ func (c actionTests) actionNetwork(t *testing.T) {
 	}
 }
 
-//nolint:maintidx
-func (c actionTests) actionBinds(t *testing.T) {
+// actionNetworkIPv6 checks that the bundled bridge network gives the
+// container an IPv6 address and default route along with the IPv4 ones,
+// and that IPv6 network arguments are accepted.
+func (c actionTests) actionNetworkIPv6(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
 
-	workspace, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "bind-workspace-", "")
-	sandbox, _ := e2e.MakeTempDir(t, workspace, "sandbox-", "")
-	defer e2e.Privileged(cleanup)
-
-	contCanaryDir := "/canary"
-	hostCanaryDir := filepath.Join(workspace, "canary")
-
-	contCanaryFile := "/canary/file"
-	hostCanaryFile := filepath.Join(hostCanaryDir, "file")
-	hostCanaryFileWithComma := filepath.Join(hostCanaryDir, "file,comma")
-	hostCanaryFileWithColon := filepath.Join(hostCanaryDir, "file:colon")
-
-	canaryFileBind := hostCanaryFile + ":" + contCanaryFile
-	canaryFileMount := "type=bind,source=" + hostCanaryFile + ",destination=" + contCanaryFile
-	canaryDirBind := hostCanaryDir + ":" + contCanaryDir
-	canaryDirMount := "type=bind,source=" + hostCanaryDir + ",destination=" + contCanaryDir
-
-	hostHomeDir := filepath.Join(workspace, "home")
-	hostWorkDir := filepath.Join(workspace, "workdir")
+	e2e.Privileged(require.Network)(t)
+	if !network.IPv6Enabled() {
+		t.Skip("IPv6 is disabled on this host")
+	}
 
-	createWorkspaceDirs := func(t *testing.T) {
-		e2e.Privileged(func(t *testing.T) {
-			if err := os.RemoveAll(hostCanaryDir); err != nil && !os.IsNotExist(err) {
-				t.Fatalf("failed to delete canary_dir: %s", err)
-			}
-			if err := os.RemoveAll(hostHomeDir); err != nil && !os.IsNotExist(err) {
-				t.Fatalf("failed to delete workspace home: %s", err)
-			}
-			if err := os.RemoveAll(hostWorkDir); err != nil && !os.IsNotExist(err) {
-				t.Fatalf("failed to delete workspace work: %s", err)
-			}
-		})(t)
+	tests := []struct {
+		name        string
+		networkArgs []string
+		command     string
+		expectOp    e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:     "IPv4Address",
+			command:  "ip -4 -o addr show eth0",
+			expectOp: e2e.ExpectOutput(e2e.ContainMatch, "inet 10.22."),
+		},
+		{
+			name:     "IPv6Address",
+			command:  "ip -6 -o addr show eth0 scope global",
+			expectOp: e2e.ExpectOutput(e2e.ContainMatch, "inet6 fd00:10:22::"),
+		},
+		{
+			name:     "IPv6DefaultRoute",
+			command:  "ip -6 route show default",
+			expectOp: e2e.ExpectOutput(e2e.ContainMatch, "default via fd00:10:22::1"),
+		},
+		{
+			name:        "IPv6Range",
+			networkArgs: []string{"ipRange=fd00:10:22:0:1::/80"},
+			command:     "ip -6 -o addr show eth0 scope global",
+			expectOp:    e2e.ExpectOutput(e2e.ContainMatch, "inet6 fd00:10:22:0:1:"),
+		},
+		{
+			name:        "IPv6PortMap",
+			networkArgs: []string{"portmap=[::1]:11500:80/tcp"},
+			command:     "true",
+		},
+	}
 
-		if err := fs.Mkdir(hostCanaryDir, 0o777); err != nil {
-			t.Fatalf("failed to create canary_dir: %s", err)
-		}
-		if err := fs.Touch(hostCanaryFile); err != nil {
-			t.Fatalf("failed to create canary_file: %s", err)
-		}
-		if err := fs.Touch(hostCanaryFileWithComma); err != nil {
-			t.Fatalf("failed to create canary_file_comma: %s", err)
-		}
-		if err := fs.Touch(hostCanaryFileWithColon); err != nil {
-			t.Fatalf("failed to create canary_file_colon: %s", err)
-		}
-		if err := os.Chmod(hostCanaryFile, 0o777); err != nil {
-			t.Fatalf("failed to apply permissions on canary_file: %s", err)
-		}
-		if err := fs.Mkdir(hostHomeDir, 0o777); err != nil {
-			t.Fatalf("failed to create workspace home directory: %s", err)
-		}
-		if err := fs.Mkdir(hostWorkDir, 0o777); err != nil {
-			t.Fatalf("failed to create workspace work directory: %s", err)
+	for _, tt := range tests {
+		args := []string{"--net", "--network", "bridge"}
+		for _, a := range tt.networkArgs {
+			args = append(args, "--network-args", a)
 		}
+		args = append(args, c.env.ImagePath, "sh", "-c", tt.command)
+
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(args...),
+			e2e.ExpectExit(0, tt.expectOp),
+		)
 	}
+}
 
-	// convert test image to sandbox
-	c.env.RunApptainer(
-		t,
-		e2e.WithProfile(e2e.UserProfile),
-		e2e.WithCommand("build"),
-		e2e.WithArgs("--force", "--sandbox", sandbox, c.env.ImagePath),
-		e2e.ExpectExit(0),
-	)
+// actionNetworkArgs checks that the --network-args and --network-args-file
+// arguments are validated against the plugins of the network.
+func (c actionTests) actionNetworkArgs(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
 
-	checkHostFn := func(path string, fn func(string) bool) func(*testing.T) {
-		return func(t *testing.T) {
-			if t.Failed() {
-				return
-			}
-			if !fn(path) {
-				t.Errorf("%s not found on host", path)
-			}
-			if err := os.RemoveAll(path); err != nil {
-				t.Errorf("failed to delete %s: %s", path, err)
-			}
+	e2e.Privileged(require.Network)(t)
+
+	argsFile := func(content string) string {
+		path := filepath.Join(t.TempDir(), "args.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
 		}
-	}
-	checkHostFile := func(path string) func(*testing.T) {
-		return checkHostFn(path, fs.IsFile)
-	}
-	checkHostDir := func(path string) func(*testing.T) {
-		return checkHostFn(path, fs.IsDir)
+		return path
 	}
 
 	tests := []struct {
-		name    string
-		args    []string
-		postRun func(*testing.T)
-		exit    int
+		name       string
+		args       []string
+		expectExit int
+		expectOp   e2e.ApptainerCmdResultOp
 	}{
 		{
-			name: "NonExistentSource",
-			args: []string{
-				"--bind", "/non/existent/source/path",
-				sandbox,
-				"true",
-			},
-			exit: 255,
+			name:       "StaticIP",
+			args:       []string{"--network-args", "IP=10.22.0.250"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ContainMatch, "inet 10.22.0.250/"),
 		},
 		{
-			name: "RelativeBindDestination",
-			args: []string{
-				"--bind", hostCanaryFile + ":relative",
-				sandbox,
-				"true",
-			},
-			exit: 255,
+			name:       "UnknownKey",
+			args:       []string{"--network-args", "portmp=8080:80/tcp"},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "unknown network argument portmp, the plugins of network bridge take:"),
 		},
 		{
-			name: "SimpleFile",
-			args: []string{
-				"--bind", canaryFileBind,
-				sandbox,
-				"test", "-f", contCanaryFile,
-			},
-			exit: 0,
+			name:       "MalformedPortMap",
+			args:       []string{"--network-args", "portmap=8080-80/tcp"},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "expected portmap=[hostIP:]hostPort[:containerPort]/protocol"),
 		},
 		{
-			name: "SimpleFileUnderlay",
-			args: []string{
-				"--underlay",
-				"--bind", canaryFileBind,
-				sandbox,
-				"test", "-f", contCanaryFile,
-			},
-			exit: 0,
+			name:       "ArgsFile",
+			args:       []string{"--network-args-file", argsFile(`{"bridge": {"ipRanges": [[{"subnet": "10.22.1.0/24"}]]}}`)},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ContainMatch, "inet 10.22.1."),
 		},
 		{
-			name: "SimpleFileCwd",
-			args: []string{
-				"--bind", canaryFileBind,
-				"--cwd", contCanaryDir,
-				sandbox,
-				"test", "-f", "file",
-			},
-			exit: 0,
+			name:       "ArgsFileUnknownField",
+			args:       []string{"--network-args-file", argsFile(`{"bridge": {"bandwidth": {"ingresRate": 1000}}}`)},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "invalid bandwidth capability arguments of network bridge"),
 		},
+	}
+
+	for _, tt := range tests {
+		args := append([]string{"--net", "--network", "bridge"}, tt.args...)
+		args = append(args, c.env.ImagePath, "ip", "-4", "-o", "addr", "show", "eth0")
+
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(args...),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
+		)
+	}
+}
+
+// actionNetworkDNS checks that the DNS configuration returned by the CNI
+// plugins of a network is written to the container resolv.conf according
+// to the container dns policy directive, and recorded for instances.
+func (c actionTests) actionNetworkDNS(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	e2e.Privileged(require.Network)(t)
+
+	// the bridge plugin returns the DNS configuration of the network
+	confDir := t.TempDir()
+	conf := `{
+		"cniVersion": "1.0.0",
+		"name": "dnstest",
+		"plugins": [
+			{
+				"type": "bridge",
+				"bridge": "apptdns0",
+				"isGateway": true,
+				"ipMasq": true,
+				"dns": {
+					"nameservers": ["10.29.0.53"],
+					"domain": "cni.test",
+					"search": ["cni.test"],
+					"options": ["ndots:3"]
+				},
+				"ipam": {
+					"type": "host-local",
+					"subnet": "10.29.0.0/16",
+					"routes": [{"dst": "0.0.0.0/0"}]
+				}
+			}
+		]
+	}`
+	e2e.Privileged(func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(confDir, "90_dnstest.conflist"), []byte(conf), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	})(t)
+
+	e2e.SetDirective(t, c.env, "cni configuration path", confDir)
+	defer e2e.ResetDirective(t, c.env, "cni configuration path")
+	defer e2e.ResetDirective(t, c.env, "container dns policy")
+
+	tests := []struct {
+		name     string
+		policy   string
+		args     []string
+		expectOp e2e.ApptainerCmdResultOp
+	}{
 		{
-			name: "SimpleFilePwd",
-			args: []string{
-				"--bind", canaryFileBind,
-				"--pwd", contCanaryDir,
-				sandbox,
-				"test", "-f", "file",
-			},
-			exit: 0,
+			name:     "CNIFirst",
+			policy:   "cni-first",
+			expectOp: e2e.ExpectOutput(e2e.RegexMatch, `^nameserver 10\.29\.0\.53\n(.|\n)*domain cni\.test\nsearch cni\.test.*\noptions ndots:3`),
 		},
 		{
-			name: "SimpleFilePwdUnderlay",
-			args: []string{
-				"--underlay",
-				"--bind", canaryFileBind,
-				"--pwd", contCanaryDir,
-				sandbox,
-				"test", "-f", "file",
-			},
-			exit: 0,
+			name:     "CNIFirstWithDNS",
+			policy:   "cni-first",
+			args:     []string{"--dns", "10.29.0.54", "--dns-search", "example.test"},
+			expectOp: e2e.ExpectOutput(e2e.ExactMatch, "nameserver 10.29.0.53\nnameserver 10.29.0.54\ndomain cni.test\nsearch cni.test example.test\noptions ndots:3"),
 		},
 		{
-			name: "SimpleDir",
-			args: []string{
-				"--bind", canaryDirBind,
-				sandbox,
-				"test", "-f", contCanaryFile,
-			},
-			exit: 0,
-		},
-		{
-			name: "SimpleDirCwd",
-			args: []string{
-				"--bind", canaryDirBind,
-				"--cwd", contCanaryDir,
-				sandbox,
-				"test", "-f", "file",
-			},
-			exit: 0,
-		},
-		{
-			name: "SimpleDirPwd",
-			args: []string{
-				"--bind", canaryDirBind,
-				"--pwd", contCanaryDir,
-				sandbox,
-				"test", "-f", "file",
-			},
-			exit: 0,
-		},
-		{
-			name: "SimpleDirUnderlay",
-			args: []string{
-				"--underlay",
-				"--bind", canaryDirBind,
-				sandbox,
-				"test", "-f", contCanaryFile,
-			},
-			exit: 0,
-		},
-		{
-			name: "SimpleDirPwdUnderlay",
-			args: []string{
-				"--underlay",
-				"--bind", canaryDirBind,
-				"--pwd", contCanaryDir,
-				sandbox,
-				"test", "-f", "file",
-			},
-			exit: 0,
+			name:     "CNIOnly",
+			policy:   "cni-only",
+			args:     []string{"--dns", "10.29.0.54"},
+			expectOp: e2e.ExpectOutput(e2e.ExactMatch, "nameserver 10.29.0.53\ndomain cni.test\nsearch cni.test\noptions ndots:3"),
 		},
 		{
-			name: "SimpleFileWritableOK",
-			args: []string{
-				"--writable",
-				"--bind", hostCanaryFile,
-				sandbox,
-				"test", "-f", hostCanaryFile,
-			},
-			exit: 0,
+			name:     "HostOnly",
+			policy:   "host-only",
+			args:     []string{"--dns", "10.29.0.54"},
+			expectOp: e2e.ExpectOutput(e2e.ExactMatch, "nameserver 10.29.0.54"),
 		},
+	}
+
+	for _, tt := range tests {
+		e2e.SetDirective(t, c.env, "container dns policy", tt.policy)
+
+		args := append([]string{"--net", "--network", "dnstest"}, tt.args...)
+		args = append(args, c.env.ImagePath, "cat", "/etc/resolv.conf")
+
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(args...),
+			e2e.ExpectExit(0, tt.expectOp),
+		)
+	}
+
+	// the effective resolv.conf of an instance is recorded
+	e2e.SetDirective(t, c.env, "container dns policy", "cni-only")
+	instanceName := "dnstest"
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("InstanceStart"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--net", "--network", "dnstest", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("InstanceInspect"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("instance inspect"),
+		e2e.WithArgs("--json", instanceName),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			var inspect struct {
+				Details struct {
+					ResolvConf []string `json:"resolvConf"`
+				} `json:"details"`
+			}
+			if err := json.Unmarshal(r.Stdout, &inspect); err != nil {
+				t.Fatalf("could not decode instance configuration: %s", err)
+			}
+			want := []string{"nameserver 10.29.0.53", "domain cni.test", "search cni.test", "options ndots:3"}
+			if strings.Join(inspect.Details.ResolvConf, "\n") != strings.Join(want, "\n") {
+				t.Errorf("got resolv.conf %q, want %q", inspect.Details.ResolvConf, want)
+			}
+		}),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("InstanceStop"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
+}
+
+// actionNetworkNone checks that --network=none always gives a fresh network
+// namespace holding only the loopback interface, with no outbound access.
+func (c actionTests) actionNetworkNone(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("OnlyLoopback"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--network", "none", c.env.ImagePath, "sh", "-c", "ip -o link | cut -d: -f2 | tr -d ' '"),
+				e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, "lo")),
+			)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("LoopbackUp"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--network", "none", c.env.ImagePath, "ip", "link", "show", "lo"),
+				e2e.ExpectExit(0, e2e.ExpectOutput(e2e.RegexMatch, `<LOOPBACK,UP,LOWER_UP>`)),
+			)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("NoLoopback"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--network", "none", "--no-loopback", c.env.ImagePath, "ip", "link", "show", "lo"),
+				e2e.ExpectExit(0, e2e.ExpectOutput(e2e.UnwantedContainMatch, "UP")),
+			)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("OutboundConnectFails"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--network", "none", c.env.ImagePath, "wget", "-q", "-T", "2", "-O", "/dev/null", "http://1.1.1.1"),
+				e2e.ExpectExit(1),
+			)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("Audit"),
+				e2e.WithProfile(profile),
+				e2e.WithGlobalOptions("--verbose"),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--network", "none", c.env.ImagePath, "true"),
+				e2e.ExpectExit(0, e2e.ExpectError(e2e.ContainMatch, "Network namespace audit: interface lo is up")),
+			)
+		})
+	}
+}
+
+// actionNested runs apptainer inside an apptainer container to check that
+// options are adapted to the nested environment for exec and build.
+func (c actionTests) actionNested(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	e2e.EnsureDebianImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "nested-", "nested build directory")
+	defer cleanup(t)
+
+	// make the apptainer installation available in the outer container
+	binds := []string{
+		buildcfg.BINDIR,
+		filepath.Join(buildcfg.LIBEXECDIR, "apptainer"),
+		filepath.Join(buildcfg.SYSCONFDIR, "apptainer"),
+		filepath.Join(buildcfg.LOCALSTATEDIR, "apptainer"),
+		tmpDir,
+	}
+	outer := []string{"--bind", strings.Join(binds, ","), c.env.DebianImagePath, c.env.CmdPath, "-v"}
+
+	defFile := filepath.Join(tmpDir, "nested.def")
+	def := fmt.Sprintf("Bootstrap: localimage\nFrom: %s\n\n%%post\n    touch /nested\n", c.env.ImagePath)
+	if err := os.WriteFile(defFile, []byte(def), 0o644); err != nil {
+		t.Fatalf("failed to write definition file: %s", err)
+	}
+	sandbox := filepath.Join(tmpDir, "sandbox")
+
+	tests := []struct {
+		name   string
+		args   []string
+		expect e2e.ApptainerCmdResultOp
+	}{
 		{
-			name: "SimpleFileWritableUnderlayOK",
-			args: []string{
-				"--underlay",
-				"--writable",
-				"--bind", hostCanaryFile,
-				sandbox,
-				"test", "-f", hostCanaryFile,
-			},
-			exit: 0,
+			name:   "Exec",
+			args:   []string{"exec", c.env.ImagePath, "true"},
+			expect: e2e.ExpectError(e2e.ContainMatch, "Running inside a container"),
 		},
 		{
-			name: "SimpleFileWritableKO",
-			args: []string{
-				"--writable",
-				"--bind", canaryFileBind,
-				sandbox,
-				"test", "-f", contCanaryFile,
-			},
-			exit: 255,
+			name:   "ExecNoAutodetect",
+			args:   []string{"exec", "--no-nesting-autodetect", "--userns", c.env.ImagePath, "true"},
+			expect: e2e.ExpectError(e2e.UnwantedContainMatch, "Running inside a container"),
 		},
 		{
-			name: "SimpleDirWritableOK",
-			args: []string{
-				"--writable",
-				"--bind", hostCanaryDir,
-				sandbox,
-				"test", "-f", hostCanaryFile,
-			},
-			exit: 0,
+			name:   "Build",
+			args:   []string{"build", "--sandbox", sandbox, defFile},
+			expect: e2e.ExpectError(e2e.ContainMatch, "Running inside a container"),
 		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(append(outer, tt.args...)...),
+			e2e.ExpectExit(0, tt.expect),
+		)
+	}
+
+	if _, err := os.Stat(filepath.Join(sandbox, "nested")); err != nil {
+		t.Errorf("nested build didn't run the %%post section: %s", err)
+	}
+}
+
+// actionNestedFakeroot runs apptainer with --fakeroot inside an apptainer
+// --fakeroot container, which uses a nested user namespace mapping the ids
+// of the outer one.
+func (c actionTests) actionNestedFakeroot(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	e2e.EnsureDebianImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "nested-fakeroot-", "nested fakeroot build directory")
+	defer cleanup(t)
+
+	// make the apptainer installation available in the outer container
+	binds := []string{
+		buildcfg.BINDIR,
+		filepath.Join(buildcfg.LIBEXECDIR, "apptainer"),
+		filepath.Join(buildcfg.SYSCONFDIR, "apptainer"),
+		filepath.Join(buildcfg.LOCALSTATEDIR, "apptainer"),
+		tmpDir,
+	}
+	outer := []string{"--bind", strings.Join(binds, ","), c.env.DebianImagePath, c.env.CmdPath}
+
+	// the ownership change requires more than a root-mapped namespace
+	defFile := filepath.Join(tmpDir, "nested.def")
+	def := fmt.Sprintf("Bootstrap: localimage\nFrom: %s\n\n%%post\n    touch /nested\n    chown 1:1 /nested\n", c.env.ImagePath)
+	if err := os.WriteFile(defFile, []byte(def), 0o644); err != nil {
+		t.Fatalf("failed to write definition file: %s", err)
+	}
+	sandbox := filepath.Join(tmpDir, "sandbox")
+
+	tests := []struct {
+		name   string
+		args   []string
+		expect e2e.ApptainerCmdResultOp
+	}{
 		{
-			name: "SimpleDirWritableKO",
-			args: []string{
-				"--writable",
-				"--bind", canaryDirBind,
-				sandbox,
-				"test", "-f", contCanaryFile,
-			},
-			exit: 255,
+			name:   "Exec",
+			args:   []string{"exec", "--fakeroot", c.env.ImagePath, "id", "-u"},
+			expect: e2e.ExpectOutput(e2e.ExactMatch, "0"),
 		},
 		{
-			name: "HomeContainOverride",
-			args: []string{
-				"--contain",
-				"--bind", hostCanaryDir + ":/home",
-				sandbox,
-				"test", "-f", "/home/file",
-			},
-			exit: 0,
+			name:   "ExecMapping",
+			args:   []string{"exec", "--fakeroot", c.env.ImagePath, "true"},
+			expect: e2e.ExpectError(e2e.ContainMatch, "using a nested user namespace"),
 		},
 		{
-			name: "HomeContainOverrideUnderlay",
-			args: []string{
-				"--underlay",
-				"--contain",
-				"--bind", hostCanaryDir + ":/home",
-				sandbox,
-				"test", "-f", "/home/file",
-			},
-			exit: 0,
+			name:   "Build",
+			args:   []string{"build", "--fakeroot", "--sandbox", sandbox, defFile},
+			expect: e2e.ExpectError(e2e.ContainMatch, "using a nested user namespace"),
 		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.FakerootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(append(outer, tt.args...)...),
+			e2e.ExpectExit(0, tt.expect),
+		)
+	}
+
+	if _, err := os.Stat(filepath.Join(sandbox, "nested")); err != nil {
+		t.Errorf("nested fakeroot build didn't run the %%post section: %s", err)
+	}
+}
+
+// actionIDMapMount tests the ID-mapped mounts of binds and overlay
+// directories, files created by the fakeroot user must be owned by the
+// user on the host.
+func (c actionTests) actionIDMapMount(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "idmap-", "ID-mapped mount directory")
+	defer cleanup(t)
+
+	bindDir := filepath.Join(tmpDir, "bind")
+	overlayDir := filepath.Join(tmpDir, "overlay")
+	for _, dir := range []string{bindDir, overlayDir} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatalf("failed to create %s: %s", dir, err)
+		}
+	}
+
+	// the ID-mapped mount falls back to a regular bind mount when
+	// not supported by the kernel or the filesystem
+	unsupported := false
+	checkSupport := func(t *testing.T, r *e2e.ApptainerCmdResult) {
+		if strings.Contains(string(r.Stderr), "Could not use an ID-mapped mount") {
+			unsupported = true
+		}
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		files []string
+	}{
 		{
-			name: "TmpContainOverride",
+			name: "Bind",
 			args: []string{
-				"--contain",
-				"--bind", hostCanaryDir + ":/tmp",
-				sandbox,
-				"test", "-f", "/tmp/file",
+				"--bind", bindDir + ":/idmap:idmap", c.env.ImagePath,
+				"sh", "-c", "touch /idmap/root /idmap/other && (chown 1:1 /idmap/other || true)",
 			},
-			exit: 0,
-		},
-		{
-			name: "TmpContainOverrideUnderlay",
-			args: []string{
-				"--underlay",
-				"--contain",
-				"--bind", hostCanaryDir + ":/tmp",
-				sandbox,
-				"test", "-f", "/tmp/file",
+			files: []string{
+				filepath.Join(bindDir, "root"),
+				filepath.Join(bindDir, "other"),
 			},
-			exit: 0,
 		},
 		{
-			name: "VarTmpContainOverride",
-			args: []string{
-				"--contain",
-				"--bind", hostCanaryDir + ":/var/tmp",
-				sandbox,
-				"test", "-f", "/var/tmp/file",
-			},
-			exit: 0,
-		},
-		{
-			name: "VarTmpContainOverrideUnderlay",
-			args: []string{
-				"--underlay",
-				"--contain",
-				"--bind", hostCanaryDir + ":/var/tmp",
-				sandbox,
-				"test", "-f", "/var/tmp/file",
-			},
-			exit: 0,
+			name:  "Overlay",
+			args:  []string{"--overlay", overlayDir + ":idmap", c.env.ImagePath, "touch", "/idmap-overlay"},
+			files: []string{filepath.Join(overlayDir, "upper", "idmap-overlay")},
 		},
+	}
+
+	for _, tt := range tests {
+		unsupported = false
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.FakerootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(0, checkSupport),
+		)
+		if unsupported {
+			t.Logf("ID-mapped mounts not supported, skipping ownership checks for %s", tt.name)
+			continue
+		}
+		for _, file := range tt.files {
+			fi, err := os.Stat(file)
+			if err != nil {
+				t.Errorf("failed to stat %s: %s", file, err)
+				continue
+			}
+			if uid := int(fi.Sys().(*syscall.Stat_t).Uid); uid != e2e.OrigUID() {
+				t.Errorf("%s is owned by %d on the host instead of %d", file, uid, e2e.OrigUID())
+			}
+		}
+	}
+}
+
+// actionSessionDir tests the --sessiondir and --sessiondir-size options,
+// and the removal of the session directory left by a killed starter.
+func (c actionTests) actionSessionDir(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	sessionDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "sessiondir-", "session directory")
+	defer cleanup(t)
+
+	// only root can exceed the 'sessiondir max size' directive (64 MiB by default)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("SizeAboveLimitUser"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--sessiondir-size", "100000", c.env.ImagePath, "true"),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "'sessiondir max size'")),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("SizeBelowLimitUser"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--sessiondir-size", "16", c.env.ImagePath, "true"),
+		e2e.ExpectExit(0),
+	)
+	for _, profile := range []e2e.Profile{e2e.RootProfile, e2e.RootUserNamespaceProfile} {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest("SizeAboveLimit"+profile.String()),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--sessiondir-size", "128", c.env.ImagePath, "true"),
+			e2e.ExpectExit(0),
+		)
+	}
+	// the limit applies to users in a user namespace too, even as fakeroot
+	for _, profile := range []e2e.Profile{e2e.UserNamespaceProfile, e2e.FakerootProfile} {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest("SizeAboveLimit"+profile.String()),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--sessiondir-size", "100000", c.env.ImagePath, "true"),
+			e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "'sessiondir max size'")),
+		)
+	}
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest("DiskBacked"+profile.String()),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--sessiondir", sessionDir, c.env.ImagePath, "true"),
+			e2e.PostRun(func(t *testing.T) {
+				entries, err := os.ReadDir(sessionDir)
+				if err != nil {
+					t.Fatalf("failed to read %s: %s", sessionDir, err)
+				}
+				for _, e := range entries {
+					t.Errorf("session directory %s not removed", e.Name())
+				}
+			}),
+			e2e.ExpectExit(0),
+		)
+	}
+
+	// a killed starter can't remove its session directory, it's left
+	// unlocked and removed by the next container using the same path
+	for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.RootProfile} {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest("Killed"+profile.String()),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--sessiondir", sessionDir, c.env.ImagePath, "sleep", "60"),
+			e2e.SignalAfter(5*time.Second, syscall.SIGKILL),
+			e2e.PostRun(func(t *testing.T) {
+				entries, err := os.ReadDir(sessionDir)
+				if err != nil {
+					t.Fatalf("failed to read %s: %s", sessionDir, err)
+				}
+				if len(entries) == 0 {
+					t.Errorf("no session directory left in %s by the killed starter", sessionDir)
+				}
+			}),
+			e2e.ExpectExit(128+int(syscall.SIGKILL)),
+		)
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest("CleanupAfterKilled"+profile.String()),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--sessiondir", sessionDir, c.env.ImagePath, "true"),
+			e2e.PostRun(func(t *testing.T) {
+				entries, err := os.ReadDir(sessionDir)
+				if err != nil {
+					t.Fatalf("failed to read %s: %s", sessionDir, err)
+				}
+				for _, e := range entries {
+					t.Errorf("stale session directory %s not removed", e.Name())
+				}
+			}),
+			e2e.ExpectExit(0),
+		)
+	}
+}
+
+// actionTimezone tests the --tz and --keep-locale options by comparing
+// the date output inside and outside the container.
+func (c actionTests) actionTimezone(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	e2e.EnsureDebianImage(t, c.env)
+
+	const zone = "America/New_York"
+	if _, err := os.Stat(filepath.Join("/usr/share/zoneinfo", zone)); err != nil {
+		t.Skipf("timezone %s not available on host: %s", zone, err)
+	}
+
+	// use a fixed date to not depend on the daylight saving time
+	dateArgs := []string{"date", "-d", "@0", "+%Z %z"}
+	hostDate := func(t *testing.T, tz string) string {
+		args := append([]string{"-u", "TZ"}, dateArgs...)
+		if tz != "" {
+			args = append([]string{"TZ=" + tz}, dateArgs...)
+		}
+		res := exec.Command("env", args...).Run(t)
+		if res.Error != nil {
+			t.Fatalf("while running date on host: %s", res.Error)
+		}
+		return strings.TrimSpace(res.Stdout())
+	}
+	zoneDate := hostDate(t, zone)
+	localDate := hostDate(t, "")
+
+	tests := []struct {
+		name    string
+		image   string
+		args    []string
+		envs    []string
+		exit    int
+		matcher e2e.ApptainerCmdResultOp
+	}{
 		{
-			name: "SymlinkOneLevelFileBind",
-			args: []string{
-				"--bind", hostCanaryFile + ":/var/etc/symlink1",
-				sandbox,
-				"test", "-f", "/etc/symlink1",
-			},
-			exit: 0,
+			name:    "ZoneNoZoneinfo",
+			image:   c.env.ImagePath,
+			args:    []string{"--tz", zone},
+			matcher: e2e.ExpectOutput(e2e.ExactMatch, zoneDate),
 		},
 		{
-			name: "SymlinkOneLevelFileBindUnderlay",
-			args: []string{
-				"--underlay",
-				"--bind", hostCanaryFile + ":/var/etc/symlink1",
-				sandbox,
-				"test", "-f", "/etc/symlink1",
-			},
-			exit: 0,
+			name:    "ZoneDebian",
+			image:   c.env.DebianImagePath,
+			args:    []string{"--tz", zone},
+			matcher: e2e.ExpectOutput(e2e.ExactMatch, zoneDate),
 		},
 		{
-			name: "SymlinkTwoLevelFileBind",
-			args: []string{
-				"--bind", hostCanaryFile + ":/var/etc/madness/symlink2",
-				sandbox,
-				"test", "-f", "/madness/symlink2",
-			},
-			exit: 0,
+			name:    "ZoneOverrideHostTZ",
+			image:   c.env.DebianImagePath,
+			args:    []string{"--tz", zone},
+			envs:    []string{"TZ=UTC"},
+			matcher: e2e.ExpectOutput(e2e.ExactMatch, zoneDate),
 		},
 		{
-			name: "SymlinkTwoLevelFileBindUnderlay",
-			args: []string{
-				"--underlay",
-				"--bind", hostCanaryFile + ":/var/etc/madness/symlink2",
-				sandbox,
-				"test", "-f", "/madness/symlink2",
-			},
-			exit: 0,
+			name:    "Host",
+			image:   c.env.DebianImagePath,
+			args:    []string{"--tz", "host"},
+			matcher: e2e.ExpectOutput(e2e.ExactMatch, localDate),
 		},
 		{
-			name: "SymlinkOneLevelDirBind",
-			args: []string{
-				"--bind", hostCanaryDir + ":/var/etc",
-				sandbox,
-				"test", "-f", "/etc/file",
-			},
-			exit: 0,
+			name:    "InvalidZone",
+			image:   c.env.ImagePath,
+			args:    []string{"--tz", "../../etc/passwd"},
+			exit:    255,
+			matcher: e2e.ExpectError(e2e.ContainMatch, "not a valid timezone name"),
 		},
 		{
-			name: "SymlinkOneLevelDirBindUnderlay",
-			args: []string{
-				"--underlay",
-				"--bind", hostCanaryDir + ":/var/etc",
-				sandbox,
-				"test", "-f", "/etc/file",
-			},
-			exit: 0,
+			name:    "UnknownZone",
+			image:   c.env.ImagePath,
+			args:    []string{"--tz", "Mars/Olympus_Mons"},
+			exit:    255,
+			matcher: e2e.ExpectError(e2e.ContainMatch, "timezone Mars/Olympus_Mons not found"),
 		},
+	}
+
+	for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.RootProfile, e2e.UserNamespaceProfile} {
+		profile := profile
+		t.Run(profile.String(), func(t *testing.T) {
+			for _, tt := range tests {
+				args := append(append(tt.args, tt.image), dateArgs...)
+				c.env.RunApptainer(
+					t,
+					e2e.AsSubtest(tt.name),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs(args...),
+					e2e.WithEnv(tt.envs),
+					e2e.ExpectExit(tt.exit, tt.matcher),
+				)
+			}
+		})
+	}
+
+	// locale variables are dropped by --cleanenv unless --keep-locale is set
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("CleanEnv"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--cleanenv", c.env.ImagePath, "/bin/sh", "-c", "echo $LANG $LC_TIME"),
+		e2e.WithEnv([]string{"LANG=C.UTF-8", "LC_TIME=POSIX"}),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, "C")),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("CleanEnvKeepLocale"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--cleanenv", "--keep-locale", c.env.ImagePath, "/bin/sh", "-c", "echo $LANG $LC_TIME"),
+		e2e.WithEnv([]string{"LANG=C.UTF-8", "LC_TIME=POSIX"}),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, "C.UTF-8 POSIX")),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("CleanEnvKeepLocaleOverride"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--cleanenv", "--keep-locale", "--env", "LC_TIME=C", c.env.ImagePath, "/bin/sh", "-c", "echo $LANG $LC_TIME"),
+		e2e.WithEnv([]string{"LANG=C.UTF-8", "LC_TIME=POSIX"}),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, "C.UTF-8 C")),
+	)
+}
+
+// actionReadOnlyRoot tests the --read-only-root and --writable-path options.
+func (c actionTests) actionReadOnlyRoot(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tests := []struct {
+		name    string
+		args    []string
+		exit    int
+		matcher e2e.ApptainerCmdResultOp
+	}{
 		{
-			name: "SymlinkTwoLevelDirBind",
-			args: []string{
-				"--bind", hostCanaryDir + ":/var/etc/madness",
-				sandbox,
-				"test", "-f", "/madness/file",
-			},
+			name: "WritablePath",
+			args: []string{"--read-only-root", "--writable-tmpfs", "--writable-path", "/scratch", c.env.ImagePath, "touch", "/scratch/file"},
 			exit: 0,
 		},
 		{
-			name: "SymlinkTwoLevelDirBindUnderlay",
-			args: []string{
-				"--underlay",
-				"--bind", hostCanaryDir + ":/var/etc/madness",
-				sandbox,
-				"test", "-f", "/madness/file",
-			},
+			name: "ExistingWritablePath",
+			args: []string{"--read-only-root", "--writable-tmpfs", "--writable-path", "/etc", c.env.ImagePath, "touch", "/etc/file"},
 			exit: 0,
 		},
 		{
-			name: "SymlinkOneLevelNewDirBind",
-			args: []string{
-				"--bind", hostCanaryDir + ":/var/etc/new",
-				sandbox,
-				"test", "-f", "/etc/new/file",
-			},
-			exit: 0,
+			name:    "ReadOnlyRoot",
+			args:    []string{"--read-only-root", "--writable-tmpfs", "--writable-path", "/scratch", c.env.ImagePath, "touch", "/file"},
+			exit:    1,
+			matcher: e2e.ExpectError(e2e.ContainMatch, "Read-only file system"),
 		},
 		{
-			name: "SymlinkOneLevelNewDirBindUnderlay",
-			args: []string{
-				"--underlay",
-				"--bind", hostCanaryDir + ":/var/etc/new",
-				sandbox,
-				"test", "-f", "/etc/new/file",
-			},
-			exit: 0,
+			name:    "ReadOnlyRootWritableTmpfs",
+			args:    []string{"--read-only-root", "--writable-tmpfs", c.env.ImagePath, "touch", "/file"},
+			exit:    1,
+			matcher: e2e.ExpectError(e2e.ContainMatch, "--writable-tmpfs has no effect with a read-only root"),
 		},
 		{
-			name: "SymlinkTwoLevelNewDirBind",
-			args: []string{
-				"--bind", hostCanaryDir + ":/var/etc/madness/new",
-				sandbox,
-				"test", "-f", "/madness/new/file",
-			},
-			exit: 0,
+			name:    "ReadOnlyRootWritable",
+			args:    []string{"--read-only-root", "--writable", c.env.ImagePath, "true"},
+			exit:    255,
+			matcher: e2e.ExpectError(e2e.ContainMatch, "--writable can't be used with a read-only root"),
 		},
 		{
-			name: "SymlinkTwoLevelNewDirBindUnderlay",
-			args: []string{
-				"--underlay",
-				"--bind", hostCanaryDir + ":/var/etc/madness/new",
-				sandbox,
-				"test", "-f", "/madness/new/file",
-			},
-			exit: 0,
+			name:    "WritablePathWithoutReadOnlyRoot",
+			args:    []string{"--writable-tmpfs", "--writable-path", "/scratch", c.env.ImagePath, "true"},
+			exit:    255,
+			matcher: e2e.ExpectError(e2e.ContainMatch, "--writable-path requires --read-only-root"),
 		},
 		{
-			name: "NestedBindFile",
-			args: []string{
-				"--bind", canaryDirBind,
-				"--bind", hostCanaryFile + ":" + filepath.Join(contCanaryDir, "file2"),
-				sandbox,
-				"test", "-f", "/canary/file2",
-			},
-			postRun: checkHostFile(filepath.Join(hostCanaryDir, "file2")),
-			exit:    0,
+			name:    "WritablePathWithoutOverlay",
+			args:    []string{"--read-only-root", "--writable-path", "/scratch", c.env.ImagePath, "true"},
+			exit:    255,
+			matcher: e2e.ExpectError(e2e.ContainMatch, "writable paths require a writable overlay"),
 		},
 		{
-			name: "NestedBindFileUnderlay",
-			args: []string{
-				"--underlay",
-				"--bind", canaryDirBind,
-				"--bind", hostCanaryFile + ":" + filepath.Join(contCanaryDir, "file2"),
-				sandbox,
-				"test", "-f", "/canary/file2",
-			},
-			postRun: checkHostFile(filepath.Join(hostCanaryDir, "file2")),
-			exit:    0,
+			name:    "RelativeWritablePath",
+			args:    []string{"--read-only-root", "--writable-tmpfs", "--writable-path", "scratch", c.env.ImagePath, "true"},
+			exit:    255,
+			matcher: e2e.ExpectError(e2e.ContainMatch, "is not an absolute path"),
 		},
-		{
-			name: "NestedBindDir",
-			args: []string{
-				"--bind", canaryDirBind,
-				"--bind", hostCanaryDir + ":" + filepath.Join(contCanaryDir, "dir2"),
-				sandbox,
-				"test", "-d", "/canary/dir2",
+	}
+
+	for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.RootProfile} {
+		profile := profile
+		t.Run(profile.String(), func(t *testing.T) {
+			for _, tt := range tests {
+				c.env.RunApptainer(
+					t,
+					e2e.AsSubtest(tt.name),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs(tt.args...),
+					e2e.ExpectExit(tt.exit, tt.matcher),
+				)
+			}
+		})
+	}
+}
+
+// actionDryRun tests the --dry-run option, which is also a cheap way to
+// check the container configuration.
+func (c actionTests) actionDryRun(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	type planMount struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+		Options     string `json:"options"`
+		Origin      string `json:"origin"`
+	}
+	type planEnv struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Origin string `json:"origin"`
+	}
+	type plan struct {
+		Image      string      `json:"image"`
+		Args       []string    `json:"args"`
+		Mounts     []planMount `json:"mounts"`
+		Namespaces []string    `json:"namespaces"`
+		Env        []planEnv   `json:"env"`
+	}
+
+	checkPlan := func(fn func(t *testing.T, p plan)) e2e.ApptainerCmdResultOp {
+		return func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			var p plan
+			if err := json.Unmarshal(r.Stdout, &p); err != nil {
+				t.Fatalf("while decoding dry run output: %s\n%s", err, r.Stdout)
+			}
+			fn(t, p)
+		}
+	}
+	hasMount := func(p plan, dest, origin string) bool {
+		for _, m := range p.Mounts {
+			if m.Destination == dest && m.Origin == origin {
+				return true
+			}
+		}
+		return false
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		exit    int
+		matcher e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:    "Table",
+			command: "exec",
+			args:    []string{"--dry-run", "--bind", "/etc:/mnt", c.env.ImagePath, "true"},
+			matcher: e2e.ExpectOutput(e2e.RegexMatch, `(?m)^/etc\s+/mnt\s+.*flag: --bind/--mount$`),
+		},
+		{
+			name:    "JSON",
+			command: "exec",
+			args:    []string{"--dry-run", "--json", "--pid", "--env", "FOO=bar", "--bind", "/etc:/mnt", c.env.ImagePath, "true"},
+			matcher: checkPlan(func(t *testing.T, p plan) {
+				if p.Image != c.env.ImagePath {
+					t.Errorf("unexpected image %s", p.Image)
+				}
+				if !hasMount(p, "/mnt", "flag: --bind/--mount") {
+					t.Errorf("bind to /mnt not found in %v", p.Mounts)
+				}
+				if !hasMount(p, "/proc", "conf: mount proc") {
+					t.Errorf("/proc mount not found in %v", p.Mounts)
+				}
+				found := false
+				for _, ns := range p.Namespaces {
+					found = found || ns == "pid"
+				}
+				if !found {
+					t.Errorf("PID namespace not found in %v", p.Namespaces)
+				}
+				found = false
+				for _, e := range p.Env {
+					found = found || (e.Name == "FOO" && e.Value == "bar" && e.Origin == "flag: --env")
+				}
+				if !found {
+					t.Errorf("FOO variable not found in %v", p.Env)
+				}
+			}),
+		},
+		{
+			name:    "NoMountProc",
+			command: "exec",
+			args:    []string{"--dry-run", "--json", "--no-mount", "proc", c.env.ImagePath, "true"},
+			matcher: checkPlan(func(t *testing.T, p plan) {
+				if hasMount(p, "/proc", "conf: mount proc") {
+					t.Errorf("unexpected /proc mount with --no-mount proc")
+				}
+			}),
+		},
+		{
+			name:    "FSMounts",
+			command: "exec",
+			args: []string{
+				"--dry-run", "--json",
+				"--mount", "type=tmpfs,dst=/scratch,size=8m,mode=0700",
+				"--mount", "type=devpts,dst=/dev/pts,newinstance",
+				"--shm-size", "16m",
+				c.env.ImagePath, "true",
 			},
-			postRun: checkHostDir(filepath.Join(hostCanaryDir, "dir2")),
+			matcher: checkPlan(func(t *testing.T, p plan) {
+				want := map[string][]string{
+					"/scratch": {"flag: --mount", "tmpfs", "size=8388608", "mode=700"},
+					"/dev/pts": {"flag: --mount", "devpts", "newinstance"},
+					"/dev/shm": {"flag: --shm-size", "tmpfs", "size=16777216", "mode=1777"},
+				}
+				for _, m := range p.Mounts {
+					w, ok := want[m.Destination]
+					if !ok || m.Origin != w[0] {
+						continue
+					}
+					delete(want, m.Destination)
+					opts := strings.Split(m.Options, ",")
+					for _, o := range w[1:] {
+						if !slice.ContainsString(opts, o) {
+							t.Errorf("option %s of %s not found in %s", o, m.Destination, m.Options)
+						}
+					}
+				}
+				for dest := range want {
+					t.Errorf("%s mount not found in %v", dest, p.Mounts)
+				}
+			}),
+		},
+		{
+			name:    "NotExecuted",
+			command: "exec",
+			args:    []string{"--dry-run", c.env.ImagePath, "false"},
 			exit:    0,
 		},
 		{
-			name: "NestedBindDirUnderlay",
+			name:    "JSONWithoutDryRun",
+			command: "exec",
+			args:    []string{"--json", c.env.ImagePath, "true"},
+			exit:    255,
+			matcher: e2e.ExpectError(e2e.ContainMatch, "--json requires --dry-run"),
+		},
+		{
+			name:    "InstanceStart",
+			command: "instance start",
+			args:    []string{"--dry-run", c.env.ImagePath, "dryrun"},
+			matcher: e2e.ExpectOutput(e2e.RegexMatch, `(?m)^Instance:\s+dryrun$`),
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.exit, tt.matcher),
+		)
+	}
+
+	// the instance must not have been started
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("InstanceNotStarted"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("instance list"),
+		e2e.WithArgs("dryrun"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.UnwantedContainMatch, "dryrun")),
+	)
+}
+
+// actionStartupErrors injects a mount failure during the container startup
+// and checks the exit code of the mount stage, the actionable message and
+// the error record printed with --json-errors.
+func (c actionTests) actionStartupErrors(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	dir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "startup-errors-", "")
+	defer cleanup(t)
+
+	// binding a directory on a file fails with ENOTDIR
+	args := []string{"--bind", dir + ":/.singularity.d/runscript", c.env.ImagePath, "true"}
+
+	for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile} {
+		profile := profile
+		t.Run(profile.String(), func(t *testing.T) {
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("Message"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs(args...),
+				e2e.ExpectExit(
+					243,
+					e2e.ExpectError(e2e.ContainMatch, "mounting "+dir+" failed: ENOTDIR"),
+				),
+			)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("JSON"),
+				e2e.WithProfile(profile),
+				e2e.WithGlobalOptions("--json-errors"),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs(args...),
+				e2e.ExpectExit(
+					243,
+					e2e.ExpectError(e2e.ContainMatch, `"stage":"mount","errno":20,"errname":"ENOTDIR","path":"`+dir+`"`),
+				),
+			)
+		})
+	}
+}
+
+// startupSignals sends signals at random points of the container
+// startup: SIGCONT, broadcast by job schedulers at job start, must not
+// make the launch fail while SIGTERM must tear down the container without
+// leaving mounts or session directories behind. The number of launches is
+// set with E2E_STARTUP_SIGNALS_ITERATIONS.
+func (c actionTests) startupSignals(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	iterations := 100
+	if v := os.Getenv("E2E_STARTUP_SIGNALS_ITERATIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			t.Fatalf("bad E2E_STARTUP_SIGNALS_ITERATIONS value %q: %s", v, err)
+		}
+		iterations = n
+	}
+
+	sessionDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "sessiondir-", "session directory")
+	defer cleanup(t)
+
+	checkLeftovers := func(t *testing.T) {
+		entries, err := os.ReadDir(sessionDir)
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", sessionDir, err)
+		}
+		for _, e := range entries {
+			t.Errorf("session directory %s not removed", e.Name())
+		}
+		mountinfo, err := os.ReadFile("/proc/self/mountinfo")
+		if err != nil {
+			t.Fatalf("failed to read mountinfo: %s", err)
+		}
+		if strings.Contains(string(mountinfo), sessionDir) {
+			t.Errorf("mounts left in %s:\n%s", sessionDir, mountinfo)
+		}
+	}
+
+	profiles := []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile}
+	seed := time.Now().UnixNano()
+	t.Logf("Using random seed %d", seed)
+	rnd := rand.New(rand.NewSource(seed))
+
+	for i := 0; i < iterations; i++ {
+		sig, codes := syscall.SIGCONT, []int{0}
+		if i%2 == 1 {
+			// the launch completes or is terminated, at any point
+			sig, codes = syscall.SIGTERM, []int{0, 128 + int(syscall.SIGTERM), 255}
+		}
+		profile := profiles[(i/2)%len(profiles)]
+		delay := time.Duration(rnd.Int63n(int64(500 * time.Millisecond)))
+
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(fmt.Sprintf("%s/%s/%d", profile, unix.SignalName(sig), i)),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--sessiondir", sessionDir, c.env.ImagePath, "true"),
+			e2e.SignalAfter(delay, sig),
+			e2e.PostRun(checkLeftovers),
+			e2e.ExpectExitIn(codes),
+		)
+		if t.Failed() {
+			break
+		}
+	}
+}
+
+//nolint:maintidx
+func (c actionTests) actionBinds(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	workspace, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "bind-workspace-", "")
+	sandbox, _ := e2e.MakeTempDir(t, workspace, "sandbox-", "")
+	defer e2e.Privileged(cleanup)
+
+	contCanaryDir := "/canary"
+	hostCanaryDir := filepath.Join(workspace, "canary")
+
+	contCanaryFile := "/canary/file"
+	hostCanaryFile := filepath.Join(hostCanaryDir, "file")
+	hostCanaryFileWithComma := filepath.Join(hostCanaryDir, "file,comma")
+	hostCanaryFileWithColon := filepath.Join(hostCanaryDir, "file:colon")
+
+	canaryFileBind := hostCanaryFile + ":" + contCanaryFile
+	canaryFileMount := "type=bind,source=" + hostCanaryFile + ",destination=" + contCanaryFile
+	canaryDirBind := hostCanaryDir + ":" + contCanaryDir
+	canaryDirMount := "type=bind,source=" + hostCanaryDir + ",destination=" + contCanaryDir
+
+	hostHomeDir := filepath.Join(workspace, "home")
+	hostWorkDir := filepath.Join(workspace, "workdir")
+
+	createWorkspaceDirs := func(t *testing.T) {
+		e2e.Privileged(func(t *testing.T) {
+			if err := os.RemoveAll(hostCanaryDir); err != nil && !os.IsNotExist(err) {
+				t.Fatalf("failed to delete canary_dir: %s", err)
+			}
+			if err := os.RemoveAll(hostHomeDir); err != nil && !os.IsNotExist(err) {
+				t.Fatalf("failed to delete workspace home: %s", err)
+			}
+			if err := os.RemoveAll(hostWorkDir); err != nil && !os.IsNotExist(err) {
+				t.Fatalf("failed to delete workspace work: %s", err)
+			}
+		})(t)
+
+		if err := fs.Mkdir(hostCanaryDir, 0o777); err != nil {
+			t.Fatalf("failed to create canary_dir: %s", err)
+		}
+		if err := fs.Touch(hostCanaryFile); err != nil {
+			t.Fatalf("failed to create canary_file: %s", err)
+		}
+		if err := fs.Touch(hostCanaryFileWithComma); err != nil {
+			t.Fatalf("failed to create canary_file_comma: %s", err)
+		}
+		if err := fs.Touch(hostCanaryFileWithColon); err != nil {
+			t.Fatalf("failed to create canary_file_colon: %s", err)
+		}
+		if err := os.Chmod(hostCanaryFile, 0o777); err != nil {
+			t.Fatalf("failed to apply permissions on canary_file: %s", err)
+		}
+		if err := fs.Mkdir(hostHomeDir, 0o777); err != nil {
+			t.Fatalf("failed to create workspace home directory: %s", err)
+		}
+		if err := fs.Mkdir(hostWorkDir, 0o777); err != nil {
+			t.Fatalf("failed to create workspace work directory: %s", err)
+		}
+	}
+
+	// convert test image to sandbox
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--force", "--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+
+	checkHostFn := func(path string, fn func(string) bool) func(*testing.T) {
+		return func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			if !fn(path) {
+				t.Errorf("%s not found on host", path)
+			}
+			if err := os.RemoveAll(path); err != nil {
+				t.Errorf("failed to delete %s: %s", path, err)
+			}
+		}
+	}
+	checkHostFile := func(path string) func(*testing.T) {
+		return checkHostFn(path, fs.IsFile)
+	}
+	checkHostDir := func(path string) func(*testing.T) {
+		return checkHostFn(path, fs.IsDir)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		postRun func(*testing.T)
+		exit    int
+	}{
+		{
+			name: "NonExistentSource",
 			args: []string{
-				"--underlay",
-				"--bind", canaryDirBind,
-				"--bind", hostCanaryDir + ":" + filepath.Join(contCanaryDir, "dir2"),
+				"--bind", "/non/existent/source/path",
 				sandbox,
-				"test", "-d", "/canary/dir2",
+				"true",
 			},
-			postRun: checkHostDir(filepath.Join(hostCanaryDir, "dir2")),
-			exit:    0,
+			exit: 255,
 		},
 		{
-			name: "MultipleNestedBindDir",
+			name: "RelativeBindDestination",
 			args: []string{
-				"--bind", canaryDirBind,
-				"--bind", hostCanaryDir + ":" + filepath.Join(contCanaryDir, "dir2"),
-				"--bind", hostCanaryFile + ":" + filepath.Join(filepath.Join(contCanaryDir, "dir2"), "nested"),
+				"--bind", hostCanaryFile + ":relative",
 				sandbox,
-				"test", "-f", "/canary/dir2/nested",
+				"true",
 			},
-			postRun: checkHostFile(filepath.Join(hostCanaryDir, "nested")),
-			exit:    0,
+			exit: 255,
 		},
 		{
-			name: "MultipleNestedBindDirUnderlay",
+			name: "SimpleFile",
+			args: []string{
+				"--bind", canaryFileBind,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleFileUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", canaryFileBind,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleFileCwd",
+			args: []string{
+				"--bind", canaryFileBind,
+				"--cwd", contCanaryDir,
+				sandbox,
+				"test", "-f", "file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleFilePwd",
+			args: []string{
+				"--bind", canaryFileBind,
+				"--pwd", contCanaryDir,
+				sandbox,
+				"test", "-f", "file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleFilePwdUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", canaryFileBind,
+				"--pwd", contCanaryDir,
+				sandbox,
+				"test", "-f", "file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleDir",
+			args: []string{
+				"--bind", canaryDirBind,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleDirCwd",
+			args: []string{
+				"--bind", canaryDirBind,
+				"--cwd", contCanaryDir,
+				sandbox,
+				"test", "-f", "file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleDirPwd",
+			args: []string{
+				"--bind", canaryDirBind,
+				"--pwd", contCanaryDir,
+				sandbox,
+				"test", "-f", "file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleDirUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", canaryDirBind,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleDirPwdUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", canaryDirBind,
+				"--pwd", contCanaryDir,
+				sandbox,
+				"test", "-f", "file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleFileWritableOK",
+			args: []string{
+				"--writable",
+				"--bind", hostCanaryFile,
+				sandbox,
+				"test", "-f", hostCanaryFile,
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleFileWritableUnderlayOK",
+			args: []string{
+				"--underlay",
+				"--writable",
+				"--bind", hostCanaryFile,
+				sandbox,
+				"test", "-f", hostCanaryFile,
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleFileWritableKO",
+			args: []string{
+				"--writable",
+				"--bind", canaryFileBind,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 255,
+		},
+		{
+			name: "SimpleDirWritableOK",
+			args: []string{
+				"--writable",
+				"--bind", hostCanaryDir,
+				sandbox,
+				"test", "-f", hostCanaryFile,
+			},
+			exit: 0,
+		},
+		{
+			name: "SimpleDirWritableKO",
+			args: []string{
+				"--writable",
+				"--bind", canaryDirBind,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 255,
+		},
+		{
+			name: "HomeContainOverride",
+			args: []string{
+				"--contain",
+				"--bind", hostCanaryDir + ":/home",
+				sandbox,
+				"test", "-f", "/home/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "HomeContainOverrideUnderlay",
+			args: []string{
+				"--underlay",
+				"--contain",
+				"--bind", hostCanaryDir + ":/home",
+				sandbox,
+				"test", "-f", "/home/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "TmpContainOverride",
+			args: []string{
+				"--contain",
+				"--bind", hostCanaryDir + ":/tmp",
+				sandbox,
+				"test", "-f", "/tmp/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "TmpContainOverrideUnderlay",
+			args: []string{
+				"--underlay",
+				"--contain",
+				"--bind", hostCanaryDir + ":/tmp",
+				sandbox,
+				"test", "-f", "/tmp/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "VarTmpContainOverride",
+			args: []string{
+				"--contain",
+				"--bind", hostCanaryDir + ":/var/tmp",
+				sandbox,
+				"test", "-f", "/var/tmp/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "VarTmpContainOverrideUnderlay",
+			args: []string{
+				"--underlay",
+				"--contain",
+				"--bind", hostCanaryDir + ":/var/tmp",
+				sandbox,
+				"test", "-f", "/var/tmp/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkOneLevelFileBind",
+			args: []string{
+				"--bind", hostCanaryFile + ":/var/etc/symlink1",
+				sandbox,
+				"test", "-f", "/etc/symlink1",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkOneLevelFileBindUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", hostCanaryFile + ":/var/etc/symlink1",
+				sandbox,
+				"test", "-f", "/etc/symlink1",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkTwoLevelFileBind",
+			args: []string{
+				"--bind", hostCanaryFile + ":/var/etc/madness/symlink2",
+				sandbox,
+				"test", "-f", "/madness/symlink2",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkTwoLevelFileBindUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", hostCanaryFile + ":/var/etc/madness/symlink2",
+				sandbox,
+				"test", "-f", "/madness/symlink2",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkOneLevelDirBind",
+			args: []string{
+				"--bind", hostCanaryDir + ":/var/etc",
+				sandbox,
+				"test", "-f", "/etc/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkOneLevelDirBindUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", hostCanaryDir + ":/var/etc",
+				sandbox,
+				"test", "-f", "/etc/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkTwoLevelDirBind",
+			args: []string{
+				"--bind", hostCanaryDir + ":/var/etc/madness",
+				sandbox,
+				"test", "-f", "/madness/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkTwoLevelDirBindUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", hostCanaryDir + ":/var/etc/madness",
+				sandbox,
+				"test", "-f", "/madness/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkOneLevelNewDirBind",
+			args: []string{
+				"--bind", hostCanaryDir + ":/var/etc/new",
+				sandbox,
+				"test", "-f", "/etc/new/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkOneLevelNewDirBindUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", hostCanaryDir + ":/var/etc/new",
+				sandbox,
+				"test", "-f", "/etc/new/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkTwoLevelNewDirBind",
+			args: []string{
+				"--bind", hostCanaryDir + ":/var/etc/madness/new",
+				sandbox,
+				"test", "-f", "/madness/new/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "SymlinkTwoLevelNewDirBindUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", hostCanaryDir + ":/var/etc/madness/new",
+				sandbox,
+				"test", "-f", "/madness/new/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "NestedBindFile",
+			args: []string{
+				"--bind", canaryDirBind,
+				"--bind", hostCanaryFile + ":" + filepath.Join(contCanaryDir, "file2"),
+				sandbox,
+				"test", "-f", "/canary/file2",
+			},
+			postRun: checkHostFile(filepath.Join(hostCanaryDir, "file2")),
+			exit:    0,
+		},
+		{
+			name: "NestedBindFileUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", canaryDirBind,
+				"--bind", hostCanaryFile + ":" + filepath.Join(contCanaryDir, "file2"),
+				sandbox,
+				"test", "-f", "/canary/file2",
+			},
+			postRun: checkHostFile(filepath.Join(hostCanaryDir, "file2")),
+			exit:    0,
+		},
+		{
+			name: "NestedBindDir",
+			args: []string{
+				"--bind", canaryDirBind,
+				"--bind", hostCanaryDir + ":" + filepath.Join(contCanaryDir, "dir2"),
+				sandbox,
+				"test", "-d", "/canary/dir2",
+			},
+			postRun: checkHostDir(filepath.Join(hostCanaryDir, "dir2")),
+			exit:    0,
+		},
+		{
+			name: "NestedBindDirUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", canaryDirBind,
+				"--bind", hostCanaryDir + ":" + filepath.Join(contCanaryDir, "dir2"),
+				sandbox,
+				"test", "-d", "/canary/dir2",
+			},
+			postRun: checkHostDir(filepath.Join(hostCanaryDir, "dir2")),
+			exit:    0,
+		},
+		{
+			name: "MultipleNestedBindDir",
+			args: []string{
+				"--bind", canaryDirBind,
+				"--bind", hostCanaryDir + ":" + filepath.Join(contCanaryDir, "dir2"),
+				"--bind", hostCanaryFile + ":" + filepath.Join(filepath.Join(contCanaryDir, "dir2"), "nested"),
+				sandbox,
+				"test", "-f", "/canary/dir2/nested",
+			},
+			postRun: checkHostFile(filepath.Join(hostCanaryDir, "nested")),
+			exit:    0,
+		},
+		{
+			name: "MultipleNestedBindDirUnderlay",
+			args: []string{
+				"--underlay",
+				"--bind", canaryDirBind,
+				"--bind", hostCanaryDir + ":" + filepath.Join(contCanaryDir, "dir2"),
+				"--bind", hostCanaryFile + ":" + filepath.Join(filepath.Join(contCanaryDir, "dir2"), "nested"),
+				sandbox,
+				"test", "-f", "/canary/dir2/nested",
+			},
+			postRun: checkHostFile(filepath.Join(hostCanaryDir, "nested")),
+			exit:    0,
+		},
+		{
+			name: "CustomHomeOneToOne",
+			args: []string{
+				"--home", hostHomeDir,
+				"--bind", hostCanaryDir + ":" + filepath.Join(hostHomeDir, "canary121RO"),
+				sandbox,
+				"test", "-f", filepath.Join(hostHomeDir, "canary121RO/file"),
+			},
+			postRun: checkHostDir(filepath.Join(hostHomeDir, "canary121RO")),
+			exit:    0,
+		},
+		{
+			name: "CustomHomeOneToOneUnderlay",
+			args: []string{
+				"--underlay",
+				"--home", hostHomeDir,
+				"--bind", hostCanaryDir + ":" + filepath.Join(hostHomeDir, "canary121RO"),
+				sandbox,
+				"test", "-f", filepath.Join(hostHomeDir, "canary121RO/file"),
+			},
+			postRun: checkHostDir(filepath.Join(hostHomeDir, "canary121RO")),
+			exit:    0,
+		},
+		{
+			name: "CustomHomeBind",
+			args: []string{
+				"--home", hostHomeDir + ":/home/e2e",
+				"--bind", hostCanaryDir + ":/home/e2e/canaryRO",
+				sandbox,
+				"test", "-f", "/home/e2e/canaryRO/file",
+			},
+			postRun: checkHostDir(filepath.Join(hostHomeDir, "canaryRO")),
+			exit:    0,
+		},
+		{
+			name: "CustomHomeBindUnderlay",
+			args: []string{
+				"--underlay",
+				"--home", hostHomeDir + ":/home/e2e",
+				"--bind", hostCanaryDir + ":/home/e2e/canaryRO",
+				sandbox,
+				"test", "-f", "/home/e2e/canaryRO/file",
+			},
+			postRun: checkHostDir(filepath.Join(hostHomeDir, "canaryRO")),
+			exit:    0,
+		},
+		{
+			name: "CustomHomeBindWritableOK",
+			args: []string{
+				"--home", hostHomeDir + ":/home/e2e",
+				"--bind", hostCanaryDir + ":/home/e2e/canaryRW",
+				"--writable",
+				sandbox,
+				"test", "-f", "/home/e2e/canaryRW/file",
+			},
+			postRun: checkHostDir(filepath.Join(hostHomeDir, "canaryRW")),
+			exit:    0,
+		},
+		{
+			name: "CustomHomeBindWritableKO",
+			args: []string{
+				"--home", canaryDirBind,
+				"--writable",
+				sandbox,
+				"true",
+			},
+			exit: 255,
+		},
+		{
+			name: "WorkdirTmpBind",
+			args: []string{
+				"--workdir", hostWorkDir,
+				"--contain",
+				"--bind", hostCanaryDir + ":/tmp/canary/dir",
+				sandbox,
+				"test", "-f", "/tmp/canary/dir/file",
+			},
+			postRun: checkHostDir(filepath.Join(hostWorkDir, "tmp", "canary/dir")),
+			exit:    0,
+		},
+		{
+			name: "WorkdirTmpBindUnderlay",
+			args: []string{
+				"--underlay",
+				"--workdir", hostWorkDir,
+				"--contain",
+				"--bind", hostCanaryDir + ":/tmp/canary/dir",
+				sandbox,
+				"test", "-f", "/tmp/canary/dir/file",
+			},
+			postRun: checkHostDir(filepath.Join(hostWorkDir, "tmp", "canary/dir")),
+			exit:    0,
+		},
+		{
+			name: "WorkdirTmpBindWritable",
+			args: []string{
+				"--writable",
+				"--workdir", hostWorkDir,
+				"--contain",
+				"--bind", hostCanaryDir + ":/tmp/canary/dir",
+				sandbox,
+				"test", "-f", "/tmp/canary/dir/file",
+			},
+			postRun: checkHostDir(filepath.Join(hostWorkDir, "tmp", "canary/dir")),
+			exit:    0,
+		},
+		{
+			name: "WorkdirVarTmpBind",
+			args: []string{
+				"--workdir", hostWorkDir,
+				"--contain",
+				"--bind", hostCanaryDir + ":/var/tmp/canary/dir",
+				sandbox,
+				"test", "-f", "/var/tmp/canary/dir/file",
+			},
+			postRun: checkHostDir(filepath.Join(hostWorkDir, "var_tmp", "canary/dir")),
+			exit:    0,
+		},
+		{
+			name: "WorkdirVarTmpBindUnderlay",
+			args: []string{
+				"--underlay",
+				"--workdir", hostWorkDir,
+				"--contain",
+				"--bind", hostCanaryDir + ":/var/tmp/canary/dir",
+				sandbox,
+				"test", "-f", "/var/tmp/canary/dir/file",
+			},
+			postRun: checkHostDir(filepath.Join(hostWorkDir, "var_tmp", "canary/dir")),
+			exit:    0,
+		},
+		{
+			name: "WorkdirVarTmpBindWritable",
+			args: []string{
+				"--writable",
+				"--workdir", hostWorkDir,
+				"--contain",
+				"--bind", hostCanaryDir + ":/var/tmp/canary/dir",
+				sandbox,
+				"test", "-f", "/var/tmp/canary/dir/file",
+			},
+			postRun: checkHostDir(filepath.Join(hostWorkDir, "var_tmp", "canary/dir")),
+			exit:    0,
+		},
+		{
+			name: "ScratchTmpfsBind",
+			args: []string{
+				"--scratch", "/scratch",
+				"--bind", hostCanaryDir + ":/scratch/dir",
+				sandbox,
+				"test", "-f", "/scratch/dir/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "ScratchTmpfsBindUnderlay",
+			args: []string{
+				"--underlay",
+				"--scratch", "/scratch",
+				"--bind", hostCanaryDir + ":/scratch/dir",
+				sandbox,
+				"test", "-f", "/scratch/dir/file",
+			},
+			exit: 0,
+		},
+		{
+			name: "ScratchWorkdirBind",
+			args: []string{
+				"--workdir", hostWorkDir,
+				"--scratch", "/scratch",
+				"--bind", hostCanaryDir + ":/scratch/dir",
+				sandbox,
+				"test", "-f", "/scratch/dir/file",
+			},
+			postRun: checkHostDir(filepath.Join(hostWorkDir, "scratch/scratch", "dir")),
+			exit:    0,
+		},
+		{
+			name: "ScratchWorkdirBindUnderlay",
+			args: []string{
+				"--underlay",
+				"--workdir", hostWorkDir,
+				"--scratch", "/scratch",
+				"--bind", hostCanaryDir + ":/scratch/dir",
+				sandbox,
+				"test", "-f", "/scratch/dir/file",
+			},
+			postRun: checkHostDir(filepath.Join(hostWorkDir, "scratch/scratch", "dir")),
+			exit:    0,
+		},
+		{
+			name: "BindFileWithCommaOK",
+			args: []string{
+				"--bind", strings.ReplaceAll(hostCanaryFileWithComma, ",", "\\,") + ":" + contCanaryFile,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 0,
+		},
+		{
+			name: "BindFileWithCommaUnderlayOK",
+			args: []string{
+				"--underlay",
+				"--bind", strings.ReplaceAll(hostCanaryFileWithComma, ",", "\\,") + ":" + contCanaryFile,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 0,
+		},
+		{
+			name: "BindFileWithCommaKO",
+			args: []string{
+				"--bind", hostCanaryFileWithComma + ":" + contCanaryFile,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 255,
+		},
+		{
+			name: "BindFileWithColonOK",
+			args: []string{
+				"--bind", strings.ReplaceAll(hostCanaryFileWithColon, ":", "\\:") + ":" + contCanaryFile,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 0,
+		},
+		{
+			name: "BindFileWithColonKO",
+			args: []string{
+				"--bind", hostCanaryFileWithColon + ":" + contCanaryFile,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 255,
+		},
+		// For the --mount variants we are really just verifying the CLI
+		// acceptance of one or more --mount flags. Translation from --mount
+		// strings to BindPath structs is checked in unit tests. The
+		// functionality of bind mounts of various kinds is already checked
+		// above, with --bind flags. No need to duplicate all of these.
+		{
+			name: "MountSingle",
+			args: []string{
+				"--mount", canaryFileMount,
+				sandbox,
+				"test", "-f", contCanaryFile,
+			},
+			exit: 0,
+		},
+		{
+			name: "MountNested",
+			args: []string{
+				"--mount", canaryDirMount,
+				"--mount", "source=" + hostCanaryFile + ",destination=" + filepath.Join(contCanaryDir, "file3"),
+				sandbox,
+				"test", "-f", "/canary/file3",
+			},
+			postRun: checkHostFile(filepath.Join(hostCanaryDir, "file3")),
+			exit:    0,
+		},
+	}
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+		createWorkspaceDirs(t)
+
+		t.Run(profile.String(), func(t *testing.T) {
+			for _, tt := range tests {
+				c.env.RunApptainer(
+					t,
+					e2e.AsSubtest(tt.name),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs(tt.args...),
+					e2e.PostRun(tt.postRun),
+					e2e.ExpectExit(tt.exit),
+				)
+			}
+		})
+	}
+}
+
+// exitSignals checks the exit code contract of the actions: the exit code
+// of the payload is passed through, a payload killed by a signal exits
+// with 128 plus the signal number, under each flow, with and without the
+// PID namespace where the payload is a child of the container init process.
+func (c actionTests) exitSignals(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	payloads := []struct {
+		name   string
+		script string
+		exit   int
+	}{
+		{"Exit0", "exit 0", 0},
+		{"Exit1", "exit 1", 1},
+		{"Exit134", "exit 134", 134},
+		{"Exit200", "exit 200", 200},
+		{"SignalHup", "kill -HUP $$", 128 + int(syscall.SIGHUP)},
+		{"SignalInt", "trap - INT; kill -INT $$", 128 + int(syscall.SIGINT)},
+		{"SignalKill", "kill -KILL $$", 128 + int(syscall.SIGKILL)},
+		{"SignalAbort", "kill -ABRT $$", 128 + int(syscall.SIGABRT)},
+		{"SignalSegv", "kill -SEGV $$", 128 + int(syscall.SIGSEGV)},
+		{"SignalUsr1", "kill -USR1 $$", 128 + int(syscall.SIGUSR1)},
+		{"SignalTerm", "kill -TERM $$", 128 + int(syscall.SIGTERM)},
+	}
+
+	profiles := []e2e.Profile{
+		e2e.UserProfile,
+		e2e.RootProfile,
+		e2e.FakerootProfile,
+		e2e.UserNamespaceProfile,
+	}
+
+	for _, profile := range profiles {
+		for _, pid := range []bool{false, true} {
+			var opts []string
+			flow := profile.String()
+			if pid {
+				opts = append(opts, "--pid")
+				flow += "/pid"
+			}
+			for _, command := range []string{"exec", "run", "test", "shell"} {
+				for _, tt := range payloads {
+					var args []string
+					var stdin io.Reader
+					if command == "shell" {
+						args = append(append(args, opts...), "--shell", "/bin/sh", c.env.ImagePath)
+						stdin = strings.NewReader(tt.script + "\n")
+					} else {
+						args = append(append(args, opts...), c.env.ImagePath, "/bin/sh", "-c", tt.script)
+						stdin = strings.NewReader("")
+					}
+					c.env.RunApptainer(
+						t,
+						e2e.AsSubtest(flow+"/"+command+"/"+tt.name),
+						e2e.WithProfile(profile),
+						e2e.WithCommand(command),
+						e2e.WithArgs(args...),
+						e2e.WithStdin(stdin),
+						e2e.ExpectExit(tt.exit),
+					)
+				}
+			}
+		}
+	}
+}
+
+func (c actionTests) fuseMount(t *testing.T) {
+	t.Skip("Broken on github for ubuntu 18.04/20.04")
+
+	require.Filesystem(t, "fuse")
+
+	u := e2e.UserProfile.HostUser(t)
+
+	imageDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "sshfs-", "")
+	defer e2e.Privileged(cleanup)
+
+	sshfsWrapper := filepath.Join(imageDir, "sshfs-wrapper")
+	rootPrivKey := filepath.Join(imageDir, "/etc/ssh/ssh_host_rsa_key")
+	userPrivKey := filepath.Join(imageDir, "user.key")
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--force", "--sandbox", imageDir, "testdata/sshfs.def"),
+		e2e.PostRun(func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			content, err := os.ReadFile(rootPrivKey)
+			if err != nil {
+				t.Errorf("could not read ssh private key: %s", err)
+				return
+			}
+			if err := os.WriteFile(userPrivKey, content, 0o600); err != nil {
+				t.Errorf("could not write ssh user private key: %s", err)
+				return
+			}
+			if err := os.Chown(userPrivKey, int(u.UID), int(u.GID)); err != nil {
+				t.Errorf("could not change ssh user private key owner: %s", err)
+				return
+			}
+		}),
+		e2e.ExpectExit(0),
+	)
+
+	stdinReader, stdinWriter := io.Pipe()
+
+	// we don't use an instance as it could conflict with
+	// instance tests running in parallel
+	go func() {
+		c.env.RunApptainer(
+			t,
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithStdin(stdinReader),
+			e2e.WithCommand("run"),
+			e2e.WithArgs("--writable", "--no-home", imageDir),
+			e2e.PostRun(func(t *testing.T) {
+				stdinReader.Close()
+				stdinWriter.Close()
+			}),
+			e2e.ExpectExit(0),
+		)
+	}()
+
+	// terminate ssh server once done
+	defer func() {
+		stdinWriter.Write([]byte("bye"))
+		stdinWriter.Close()
+	}()
+
+	// wait until ssh server is up and running
+	retry := 0
+	for {
+		conn, err := net.Dial("tcp", "127.0.0.1:2022")
+		if err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(1 * time.Second)
+		retry++
+		if retry == 5 {
+			t.Fatalf("ssh server unreachable after 5 seconds: %+v", err)
+		}
+	}
+
+	basicTests := []struct {
+		name    string
+		spec    string
+		key     string
+		profile e2e.Profile
+	}{
+		{
+			name:    "HostDaemonAsRoot",
+			spec:    "host-daemon",
+			key:     rootPrivKey,
+			profile: e2e.RootProfile,
+		},
+		{
+			name:    "HostAsRoot",
+			spec:    "host",
+			key:     rootPrivKey,
+			profile: e2e.RootProfile,
+		},
+		{
+			name:    "ContainerDaemonAsRoot",
+			spec:    "container-daemon",
+			key:     rootPrivKey,
+			profile: e2e.RootProfile,
+		},
+		{
+			name:    "ContainerAsRoot",
+			spec:    "container",
+			key:     rootPrivKey,
+			profile: e2e.RootProfile,
+		},
+		{
+			name:    "HostDaemonAsUser",
+			spec:    "host-daemon",
+			key:     userPrivKey,
+			profile: e2e.UserProfile,
+		},
+		{
+			name:    "HostAsUser",
+			spec:    "host",
+			key:     userPrivKey,
+			profile: e2e.UserProfile,
+		},
+		{
+			name:    "ContainerDaemonAsUser",
+			spec:    "container-daemon",
+			key:     userPrivKey,
+			profile: e2e.UserProfile,
+		},
+		{
+			name:    "ContainerAsUser",
+			spec:    "container",
+			key:     userPrivKey,
+			profile: e2e.UserProfile,
+		},
+		{
+			name:    "HostDaemonAsUserNamespace",
+			spec:    "host-daemon",
+			key:     userPrivKey,
+			profile: e2e.UserNamespaceProfile,
+		},
+		{
+			name:    "HostAsUserNamespace",
+			spec:    "host",
+			key:     userPrivKey,
+			profile: e2e.UserNamespaceProfile,
+		},
+		{
+			name:    "ContainerDaemonAsUserNamespace",
+			spec:    "container-daemon",
+			key:     userPrivKey,
+			profile: e2e.UserNamespaceProfile,
+		},
+		{
+			name:    "ContainerAsUserNamespace",
+			spec:    "container",
+			key:     userPrivKey,
+			profile: e2e.UserNamespaceProfile,
+		},
+		{
+			name:    "HostDaemonAsFakeroot",
+			spec:    "host-daemon",
+			key:     userPrivKey,
+			profile: e2e.FakerootProfile,
+		},
+		{
+			name:    "HostAsFakeroot",
+			spec:    "host",
+			key:     userPrivKey,
+			profile: e2e.FakerootProfile,
+		},
+		{
+			name:    "ContainerDaemonAsFakeroot",
+			spec:    "container-daemon",
+			key:     userPrivKey,
+			profile: e2e.FakerootProfile,
+		},
+		{
+			name:    "ContainerAsFakeroot",
+			spec:    "container",
+			key:     userPrivKey,
+			profile: e2e.FakerootProfile,
+		},
+	}
+
+	optionFmt := "%s:%s root@127.0.0.1:/ -p 2022 -F %s -o IdentityFile=%s -o StrictHostKeyChecking=no %s"
+	sshConfig := filepath.Join(imageDir, "etc", "ssh", "ssh_config")
+
+	for _, tt := range basicTests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs([]string{
+				"--fusemount", fmt.Sprintf(optionFmt, tt.spec, sshfsWrapper, sshConfig, tt.key, "/mnt"),
+				imageDir,
+				"test", "-d", "/mnt/etc",
+			}...),
+			e2e.ExpectExit(0),
+		)
+	}
+}
+
+//nolint:maintidx
+func (c actionTests) bindImage(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	require.Command(t, "mkfs.ext3")
+	require.Command(t, "mksquashfs")
+	require.Command(t, "dd")
+
+	testdir, err := os.MkdirTemp(c.env.TestDir, "bind-image-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scratchDir := filepath.Join(testdir, "scratch")
+	if err := os.MkdirAll(filepath.Join(scratchDir, "bin"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup := func(t *testing.T) {
+		if t.Failed() {
+			t.Logf("Not removing directory %s for test %s", testdir, t.Name())
+			return
+		}
+		err := os.RemoveAll(testdir)
+		if err != nil {
+			t.Logf("Error while removing directory %s for test %s: %#v", testdir, t.Name(), err)
+		}
+	}
+	defer cleanup(t)
+
+	sifSquashImage := filepath.Join(testdir, "data_squash.sif")
+	sifExt3Image := filepath.Join(testdir, "data_ext3.sif")
+	squashfsImage := filepath.Join(testdir, "squashfs.simg")
+	ext3Img := filepath.Join(testdir, "ext3_fs.img")
+
+	// create root directory for squashfs image
+	squashDir, err := os.MkdirTemp(testdir, "root-squash-dir-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(squashDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	squashMarkerFile := "squash_marker"
+	if err := fs.Touch(filepath.Join(squashDir, squashMarkerFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	// create the squashfs overlay image
+	cmd := exec.Command("mksquashfs", squashDir, squashfsImage, "-noappend", "-all-root")
+	if res := cmd.Run(t); res.Error != nil {
+		t.Fatalf("Unexpected error while running command.\n%s", res)
+	}
+
+	// create the overlay ext3 image
+	cmd = exec.Command("dd", "if=/dev/zero", "of="+ext3Img, "bs=1M", "count=64", "status=none")
+	if res := cmd.Run(t); res.Error != nil {
+		t.Fatalf("Unexpected error while running command.\n%s", res)
+	}
+
+	cmd = exec.Command("mkfs.ext3", "-q", "-F", ext3Img)
+	if res := cmd.Run(t); res.Error != nil {
+		t.Fatalf("Unexpected error while running command.\n%s", res)
+	}
+
+	// create new SIF images
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("sif"),
+		e2e.WithArgs([]string{"new", sifSquashImage}...),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("sif"),
+		e2e.WithArgs([]string{"new", sifExt3Image}...),
+		e2e.ExpectExit(0),
+	)
+
+	// arch partition doesn't matter for data partition so
+	// take amd64 by default
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("sif"),
+		e2e.WithArgs([]string{
+			"add",
+			"--datatype", "4", "--partarch", "2",
+			"--partfs", "1", "--parttype", "3",
+			sifSquashImage, squashfsImage,
+		}...),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("sif"),
+		e2e.WithArgs([]string{
+			"add",
+			"--datatype", "4", "--partarch", "2",
+			"--partfs", "2", "--parttype", "3",
+			sifExt3Image, ext3Img,
+		}...),
+		e2e.ExpectExit(0),
+	)
+
+	tests := []struct {
+		name    string
+		profile e2e.Profile
+		args    []string
+		exit    int
+	}{
+		{
+			name:    "NoBindOption",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--underlay",
-				"--bind", canaryDirBind,
-				"--bind", hostCanaryDir + ":" + filepath.Join(contCanaryDir, "dir2"),
-				"--bind", hostCanaryFile + ":" + filepath.Join(filepath.Join(contCanaryDir, "dir2"), "nested"),
-				sandbox,
-				"test", "-f", "/canary/dir2/nested",
+				"--bind", squashfsImage + ":/bind",
+				c.env.ImagePath,
+				"test", "-f", filepath.Join("/bind", squashMarkerFile),
 			},
-			postRun: checkHostFile(filepath.Join(hostCanaryDir, "nested")),
-			exit:    0,
+			exit: 1,
 		},
 		{
-			name: "CustomHomeOneToOne",
+			name:    "BadIDValue",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--home", hostHomeDir,
-				"--bind", hostCanaryDir + ":" + filepath.Join(hostHomeDir, "canary121RO"),
-				sandbox,
-				"test", "-f", filepath.Join(hostHomeDir, "canary121RO/file"),
+				"--bind", squashfsImage + ":/bind:id=0",
+				c.env.ImagePath,
+				"true",
 			},
-			postRun: checkHostDir(filepath.Join(hostHomeDir, "canary121RO")),
-			exit:    0,
+			exit: 255,
 		},
 		{
-			name: "CustomHomeOneToOneUnderlay",
+			name:    "BadBindOption",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--underlay",
-				"--home", hostHomeDir,
-				"--bind", hostCanaryDir + ":" + filepath.Join(hostHomeDir, "canary121RO"),
-				sandbox,
-				"test", "-f", filepath.Join(hostHomeDir, "canary121RO/file"),
+				"--bind", squashfsImage + ":/bind:fake_option=fake",
+				c.env.ImagePath,
+				"true",
 			},
-			postRun: checkHostDir(filepath.Join(hostHomeDir, "canary121RO")),
-			exit:    0,
+			exit: 255,
 		},
 		{
-			name: "CustomHomeBind",
+			name:    "SandboxKO",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--home", hostHomeDir + ":/home/e2e",
-				"--bind", hostCanaryDir + ":/home/e2e/canaryRO",
-				sandbox,
-				"test", "-f", "/home/e2e/canaryRO/file",
+				"--bind", squashDir + ":/bind:image-src=/",
+				c.env.ImagePath,
+				"true",
 			},
-			postRun: checkHostDir(filepath.Join(hostHomeDir, "canaryRO")),
-			exit:    0,
+			exit: 255,
 		},
 		{
-			name: "CustomHomeBindUnderlay",
+			name:    "Squashfs",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--underlay",
-				"--home", hostHomeDir + ":/home/e2e",
-				"--bind", hostCanaryDir + ":/home/e2e/canaryRO",
-				sandbox,
-				"test", "-f", "/home/e2e/canaryRO/file",
+				"--bind", squashfsImage + ":/bind:image-src=/",
+				c.env.ImagePath,
+				"test", "-f", filepath.Join("/bind", squashMarkerFile),
 			},
-			postRun: checkHostDir(filepath.Join(hostHomeDir, "canaryRO")),
-			exit:    0,
+			exit: 0,
 		},
 		{
-			name: "CustomHomeBindWritableOK",
+			name:    "SquashfsDouble",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--home", hostHomeDir + ":/home/e2e",
-				"--bind", hostCanaryDir + ":/home/e2e/canaryRW",
-				"--writable",
-				sandbox,
-				"test", "-f", "/home/e2e/canaryRW/file",
+				"--bind", squashfsImage + ":/bind1:image-src=/",
+				"--bind", squashfsImage + ":/bind2:image-src=/",
+				c.env.ImagePath,
+				"test", "-f", filepath.Join("/bind1", squashMarkerFile), "-a", "-f", filepath.Join("/bind2", squashMarkerFile),
 			},
-			postRun: checkHostDir(filepath.Join(hostHomeDir, "canaryRW")),
-			exit:    0,
+			exit: 0,
 		},
 		{
-			name: "CustomHomeBindWritableKO",
-			args: []string{
-				"--home", canaryDirBind,
-				"--writable",
-				sandbox,
-				"true",
-			},
-			exit: 255,
+			name:    "SquashfsBadSource",
+			profile: e2e.UserProfile,
+			args:    []string{"--bind", squashfsImage + ":/bind:image-src=/ko", c.env.ImagePath, "true"},
+			exit:    255,
 		},
 		{
-			name: "WorkdirTmpBind",
+			name:    "SquashfsMixedBind",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--workdir", hostWorkDir,
-				"--contain",
-				"--bind", hostCanaryDir + ":/tmp/canary/dir",
-				sandbox,
-				"test", "-f", "/tmp/canary/dir/file",
+				"--bind", squashfsImage + ":/bind1:image-src=/",
+				"--bind", squashDir + ":/bind2",
+				c.env.ImagePath,
+				"test", "-f", filepath.Join("/bind1", squashMarkerFile), "-a", "-f", filepath.Join("/bind2", squashMarkerFile),
 			},
-			postRun: checkHostDir(filepath.Join(hostWorkDir, "tmp", "canary/dir")),
-			exit:    0,
+			exit: 0,
 		},
 		{
-			name: "WorkdirTmpBindUnderlay",
+			name:    "Ext3Write",
+			profile: e2e.RootProfile,
 			args: []string{
-				"--underlay",
-				"--workdir", hostWorkDir,
-				"--contain",
-				"--bind", hostCanaryDir + ":/tmp/canary/dir",
-				sandbox,
-				"test", "-f", "/tmp/canary/dir/file",
+				"--bind", ext3Img + ":/bind:image-src=/",
+				c.env.ImagePath,
+				"touch", "/bind/ext3_marker",
 			},
-			postRun: checkHostDir(filepath.Join(hostWorkDir, "tmp", "canary/dir")),
-			exit:    0,
+			exit: 0,
 		},
 		{
-			name: "WorkdirTmpBindWritable",
+			name:    "Ext3WriteKO",
+			profile: e2e.RootProfile,
 			args: []string{
-				"--writable",
-				"--workdir", hostWorkDir,
-				"--contain",
-				"--bind", hostCanaryDir + ":/tmp/canary/dir",
-				sandbox,
-				"test", "-f", "/tmp/canary/dir/file",
+				"--bind", ext3Img + ":/bind:image-src=/,ro",
+				c.env.ImagePath,
+				"touch", "/bind/ext3_marker",
 			},
-			postRun: checkHostDir(filepath.Join(hostWorkDir, "tmp", "canary/dir")),
-			exit:    0,
+			exit: 1,
 		},
 		{
-			name: "WorkdirVarTmpBind",
+			name:    "SifDataExt3Write",
+			profile: e2e.RootProfile,
 			args: []string{
-				"--workdir", hostWorkDir,
-				"--contain",
-				"--bind", hostCanaryDir + ":/var/tmp/canary/dir",
-				sandbox,
-				"test", "-f", "/var/tmp/canary/dir/file",
+				"--bind", sifExt3Image + ":/bind:image-src=/",
+				c.env.ImagePath,
+				"touch", "/bind/ext3_marker",
 			},
-			postRun: checkHostDir(filepath.Join(hostWorkDir, "var_tmp", "canary/dir")),
-			exit:    0,
+			exit: 0,
 		},
 		{
-			name: "WorkdirVarTmpBindUnderlay",
+			name:    "Ext3Read",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--underlay",
-				"--workdir", hostWorkDir,
-				"--contain",
-				"--bind", hostCanaryDir + ":/var/tmp/canary/dir",
-				sandbox,
-				"test", "-f", "/var/tmp/canary/dir/file",
+				"--bind", ext3Img + ":/bind:image-src=/",
+				c.env.ImagePath,
+				"test", "-f", "/bind/ext3_marker",
 			},
-			postRun: checkHostDir(filepath.Join(hostWorkDir, "var_tmp", "canary/dir")),
-			exit:    0,
+			exit: 0,
 		},
 		{
-			name: "WorkdirVarTmpBindWritable",
+			name:    "Ext3Double",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--writable",
-				"--workdir", hostWorkDir,
-				"--contain",
-				"--bind", hostCanaryDir + ":/var/tmp/canary/dir",
-				sandbox,
-				"test", "-f", "/var/tmp/canary/dir/file",
+				"--bind", ext3Img + ":/bind1:image-src=/",
+				"--bind", ext3Img + ":/bind2:image-src=/",
+				c.env.ImagePath,
+				"true",
 			},
-			postRun: checkHostDir(filepath.Join(hostWorkDir, "var_tmp", "canary/dir")),
-			exit:    0,
+			exit: 255,
 		},
 		{
-			name: "ScratchTmpfsBind",
+			name:    "SifDataSquash",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--scratch", "/scratch",
-				"--bind", hostCanaryDir + ":/scratch/dir",
-				sandbox,
-				"test", "-f", "/scratch/dir/file",
+				"--bind", sifSquashImage + ":/bind:image-src=/",
+				c.env.ImagePath,
+				"test", "-f", filepath.Join("/bind", squashMarkerFile),
 			},
 			exit: 0,
 		},
 		{
-			name: "ScratchTmpfsBindUnderlay",
+			name:    "SifDataExt3Read",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--underlay",
-				"--scratch", "/scratch",
-				"--bind", hostCanaryDir + ":/scratch/dir",
-				sandbox,
-				"test", "-f", "/scratch/dir/file",
+				"--bind", sifExt3Image + ":/bind:image-src=/",
+				c.env.ImagePath,
+				"test", "-f", "/bind/ext3_marker",
 			},
 			exit: 0,
 		},
 		{
-			name: "ScratchWorkdirBind",
-			args: []string{
-				"--workdir", hostWorkDir,
-				"--scratch", "/scratch",
-				"--bind", hostCanaryDir + ":/scratch/dir",
-				sandbox,
-				"test", "-f", "/scratch/dir/file",
-			},
-			postRun: checkHostDir(filepath.Join(hostWorkDir, "scratch/scratch", "dir")),
-			exit:    0,
-		},
-		{
-			name: "ScratchWorkdirBindUnderlay",
-			args: []string{
-				"--underlay",
-				"--workdir", hostWorkDir,
-				"--scratch", "/scratch",
-				"--bind", hostCanaryDir + ":/scratch/dir",
-				sandbox,
-				"test", "-f", "/scratch/dir/file",
-			},
-			postRun: checkHostDir(filepath.Join(hostWorkDir, "scratch/scratch", "dir")),
-			exit:    0,
-		},
-		{
-			name: "BindFileWithCommaOK",
+			name:    "SifDataExt3AndSquash",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--bind", strings.ReplaceAll(hostCanaryFileWithComma, ",", "\\,") + ":" + contCanaryFile,
-				sandbox,
-				"test", "-f", contCanaryFile,
+				"--bind", sifExt3Image + ":/ext3:image-src=/",
+				"--bind", sifSquashImage + ":/squash:image-src=/",
+				c.env.ImagePath,
+				"test", "-f", filepath.Join("/squash", squashMarkerFile), "-a", "-f", "/ext3/ext3_marker",
 			},
 			exit: 0,
 		},
 		{
-			name: "BindFileWithCommaUnderlayOK",
+			name:    "SifDataExt3Double",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--underlay",
-				"--bind", strings.ReplaceAll(hostCanaryFileWithComma, ",", "\\,") + ":" + contCanaryFile,
-				sandbox,
-				"test", "-f", contCanaryFile,
+				"--bind", sifExt3Image + ":/bind1:image-src=/",
+				"--bind", sifExt3Image + ":/bind2:image-src=/",
+				c.env.ImagePath,
+				"true",
 			},
-			exit: 0,
+			exit: 255,
 		},
 		{
-			name: "BindFileWithCommaKO",
+			name:    "SifWithID",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--bind", hostCanaryFileWithComma + ":" + contCanaryFile,
-				sandbox,
-				"test", "-f", contCanaryFile,
+				// rootfs ID is now '4'
+				"--bind", c.env.ImagePath + ":/rootfs:id=4",
+				c.env.ImagePath,
+				"test", "-d", "/rootfs/etc",
 			},
-			exit: 255,
+			exit: 0,
 		},
+		// check ordering between image and user bind
 		{
-			name: "BindFileWithColonOK",
+			name:    "SquashfsBeforeScratch",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--bind", strings.ReplaceAll(hostCanaryFileWithColon, ":", "\\:") + ":" + contCanaryFile,
-				sandbox,
-				"test", "-f", contCanaryFile,
+				"--bind", sifSquashImage + ":/scratch/bin:image-src=/",
+				"--bind", scratchDir + ":/scratch",
+				c.env.ImagePath,
+				"test", "-f", filepath.Join("/scratch/bin", squashMarkerFile),
 			},
 			exit: 0,
 		},
 		{
-			name: "BindFileWithColonKO",
+			name:    "ScratchBeforeSquashfs",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--bind", hostCanaryFileWithColon + ":" + contCanaryFile,
-				sandbox,
-				"test", "-f", contCanaryFile,
+				"--bind", scratchDir + ":/scratch",
+				"--bind", sifSquashImage + ":/scratch/bin:image-src=/",
+				c.env.ImagePath,
+				"test", "-f", filepath.Join("/scratch/bin", squashMarkerFile),
 			},
-			exit: 255,
+			exit: 0,
 		},
 		// For the --mount variants we are really just verifying the CLI
-		// acceptance of one or more --mount flags. Translation from --mount
-		// strings to BindPath structs is checked in unit tests. The
-		// functionality of bind mounts of various kinds is already checked
+		// acceptance of one or more image bind mount strings. Translation from
+		// --mount strings to BindPath structs is checked in unit tests. The
+		// functionality of image mounts of various kinds is already checked
 		// above, with --bind flags. No need to duplicate all of these.
 		{
-			name: "MountSingle",
+			name:    "MountSifWithID",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--mount", canaryFileMount,
-				sandbox,
-				"test", "-f", contCanaryFile,
+				// rootfs ID is now '4'
+				"--mount", "type=bind,source=" + c.env.ImagePath + ",destination=/rootfs,id=4",
+				c.env.ImagePath,
+				"test", "-d", "/rootfs/etc",
 			},
 			exit: 0,
 		},
 		{
-			name: "MountNested",
+			name:    "MountSifDataExt3AndSquash",
+			profile: e2e.UserProfile,
 			args: []string{
-				"--mount", canaryDirMount,
-				"--mount", "source=" + hostCanaryFile + ",destination=" + filepath.Join(contCanaryDir, "file3"),
-				sandbox,
-				"test", "-f", "/canary/file3",
+				"--mount", "type=bind,source=" + sifExt3Image + ",destination=/ext3,image-src=/",
+				"--mount", "type=bind,source=" + sifSquashImage + ",destination=/squash,image-src=/",
+				c.env.ImagePath,
+				"test", "-f", filepath.Join("/squash", squashMarkerFile), "-a", "-f", "/ext3/ext3_marker",
 			},
-			postRun: checkHostFile(filepath.Join(hostCanaryDir, "file3")),
-			exit:    0,
+			exit: 0,
 		},
 	}
 
-	for _, profile := range e2e.Profiles {
-		profile := profile
-		createWorkspaceDirs(t)
-
-		t.Run(profile.String(), func(t *testing.T) {
-			for _, tt := range tests {
-				c.env.RunApptainer(
-					t,
-					e2e.AsSubtest(tt.name),
-					e2e.WithProfile(profile),
-					e2e.WithCommand("exec"),
-					e2e.WithArgs(tt.args...),
-					e2e.PostRun(tt.postRun),
-					e2e.ExpectExit(tt.exit),
-				)
-			}
-		})
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.exit),
+		)
 	}
 }
 
-func (c actionTests) exitSignals(t *testing.T) {
+// actionUmask tests that the within-container umask is correct in action flows
+// Must be run in sequential section as it modifies host process umask.
+func (c actionTests) actionUmask(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	u := e2e.UserProfile.HostUser(t)
+
+	// Set umask for tests to 0000
+	oldUmask := syscall.Umask(0)
+	defer syscall.Umask(oldUmask)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.FakerootProfile),
+		e2e.WithDir(u.Dir),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(c.env.ImagePath, "sh", "-c", "umask"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ExactMatch, "0000"),
+		),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.FakerootProfile),
+		e2e.WithDir(u.Dir),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--no-umask", c.env.ImagePath, "sh", "-c", "umask"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ExactMatch, "0022"),
+		),
+	)
+}
+
+// actionUmaskGroups tests the --umask and --groups options, and the
+// 'container umask' directive, with and without the setuid starter.
+func (c actionTests) actionUmaskGroups(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
 
+	gid := strconv.Itoa(e2e.OrigGID())
+
 	tests := []struct {
-		name string
-		args []string
-		exit int
+		name       string
+		profile    e2e.Profile
+		umask      string
+		args       []string
+		expectExit int
+		expectOp   e2e.ApptainerCmdResultOp
 	}{
 		{
-			name: "Exit0",
-			args: []string{c.env.ImagePath, "/bin/sh", "-c", "exit 0"},
-			exit: 0,
+			name:     "UmaskUser",
+			profile:  e2e.UserProfile,
+			args:     []string{"--umask", "0077", c.env.ImagePath, "sh", "-c", "umask"},
+			expectOp: e2e.ExpectOutput(e2e.ExactMatch, "0077"),
 		},
 		{
-			name: "Exit1",
-			args: []string{c.env.ImagePath, "/bin/sh", "-c", "exit 1"},
-			exit: 1,
+			name:     "UmaskUserNamespace",
+			profile:  e2e.UserNamespaceProfile,
+			args:     []string{"--umask", "027", c.env.ImagePath, "sh", "-c", "umask"},
+			expectOp: e2e.ExpectOutput(e2e.ExactMatch, "0027"),
+		},
+		{
+			name:     "UmaskOverNoUmask",
+			profile:  e2e.UserProfile,
+			args:     []string{"--no-umask", "--umask", "0007", c.env.ImagePath, "sh", "-c", "umask"},
+			expectOp: e2e.ExpectOutput(e2e.ExactMatch, "0007"),
+		},
+		{
+			name:     "UmaskDirective",
+			profile:  e2e.UserNamespaceProfile,
+			umask:    "0077",
+			args:     []string{c.env.ImagePath, "sh", "-c", "umask"},
+			expectOp: e2e.ExpectOutput(e2e.ExactMatch, "0077"),
+		},
+		{
+			name:     "UmaskFlagOverDirective",
+			profile:  e2e.UserProfile,
+			umask:    "0077",
+			args:     []string{"--umask", "0022", c.env.ImagePath, "sh", "-c", "umask"},
+			expectOp: e2e.ExpectOutput(e2e.ExactMatch, "0022"),
+		},
+		{
+			name:       "UmaskInvalid",
+			profile:    e2e.UserProfile,
+			args:       []string{"--umask", "0999", c.env.ImagePath, "true"},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, `invalid umask "0999" from --umask`),
+		},
+		{
+			name:     "GroupsNone",
+			profile:  e2e.UserProfile,
+			args:     []string{"--groups", "none", c.env.ImagePath, "id", "-G"},
+			expectOp: e2e.ExpectOutput(e2e.ExactMatch, gid),
+		},
+		{
+			name:     "GroupsPrimary",
+			profile:  e2e.UserProfile,
+			args:     []string{"--groups", gid, c.env.ImagePath, "id", "-G"},
+			expectOp: e2e.ExpectOutput(e2e.ExactMatch, gid),
+		},
+		{
+			name:       "GroupsNotMember",
+			profile:    e2e.UserProfile,
+			args:       []string{"--groups", "4242", c.env.ImagePath, "id", "-G"},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "group 4242 is not a group of the user"),
 		},
 		{
-			name: "Exit134",
-			args: []string{c.env.ImagePath, "/bin/sh", "-c", "exit 134"},
-			exit: 134,
+			name:     "GroupsRoot",
+			profile:  e2e.RootProfile,
+			args:     []string{"--groups", "0,4242", c.env.ImagePath, "id", "-G"},
+			expectOp: e2e.ExpectOutput(e2e.ExactMatch, "0 4242"),
 		},
 		{
-			name: "SignalKill",
-			args: []string{c.env.ImagePath, "/bin/sh", "-c", "kill -KILL $$"},
-			exit: 137,
+			name:       "GroupsUserNamespace",
+			profile:    e2e.UserNamespaceProfile,
+			args:       []string{"--groups", "none", c.env.ImagePath, "id", "-G"},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "--groups requires the setuid workflow"),
 		},
 		{
-			name: "SignalAbort",
-			args: []string{c.env.ImagePath, "/bin/sh", "-c", "kill -ABRT $$"},
-			exit: 134,
+			name:     "DryRun",
+			profile:  e2e.UserProfile,
+			args:     []string{"--dry-run", "--umask", "0027", "--groups", "none", c.env.ImagePath, "true"},
+			expectOp: e2e.ExpectOutput(e2e.RegexMatch, `(?m)^Umask:\s+0027$(.|\n)*^Supplementary groups:\s+none$`),
 		},
 	}
 
@@ -1942,564 +3902,856 @@ func (c actionTests) exitSignals(t *testing.T) {
 		c.env.RunApptainer(
 			t,
 			e2e.AsSubtest(tt.name),
-			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithProfile(tt.profile),
+			e2e.PreRun(func(t *testing.T) {
+				if tt.umask != "" {
+					e2e.SetDirective(t, c.env, "container umask", tt.umask)
+				}
+			}),
+			e2e.PostRun(func(t *testing.T) {
+				if tt.umask != "" {
+					e2e.ResetDirective(t, c.env, "container umask")
+				}
+			}),
 			e2e.WithCommand("exec"),
 			e2e.WithArgs(tt.args...),
-			e2e.ExpectExit(tt.exit),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
 		)
 	}
 }
 
-func (c actionTests) fuseMount(t *testing.T) {
-	t.Skip("Broken on github for ubuntu 18.04/20.04")
-
-	require.Filesystem(t, "fuse")
-
-	u := e2e.UserProfile.HostUser(t)
-
-	imageDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "sshfs-", "")
-	defer e2e.Privileged(cleanup)
-
-	sshfsWrapper := filepath.Join(imageDir, "sshfs-wrapper")
-	rootPrivKey := filepath.Join(imageDir, "/etc/ssh/ssh_host_rsa_key")
-	userPrivKey := filepath.Join(imageDir, "user.key")
-
-	c.env.RunApptainer(
-		t,
-		e2e.WithProfile(e2e.RootProfile),
-		e2e.WithCommand("build"),
-		e2e.WithArgs("--force", "--sandbox", imageDir, "testdata/sshfs.def"),
-		e2e.PostRun(func(t *testing.T) {
-			if t.Failed() {
-				return
-			}
-			content, err := os.ReadFile(rootPrivKey)
-			if err != nil {
-				t.Errorf("could not read ssh private key: %s", err)
-				return
-			}
-			if err := os.WriteFile(userPrivKey, content, 0o600); err != nil {
-				t.Errorf("could not write ssh user private key: %s", err)
-				return
-			}
-			if err := os.Chown(userPrivKey, int(u.UID), int(u.GID)); err != nil {
-				t.Errorf("could not change ssh user private key owner: %s", err)
-				return
-			}
-		}),
-		e2e.ExpectExit(0),
-	)
-
-	stdinReader, stdinWriter := io.Pipe()
-
-	// we don't use an instance as it could conflict with
-	// instance tests running in parallel
-	go func() {
-		c.env.RunApptainer(
-			t,
-			e2e.WithProfile(e2e.RootProfile),
-			e2e.WithStdin(stdinReader),
-			e2e.WithCommand("run"),
-			e2e.WithArgs("--writable", "--no-home", imageDir),
-			e2e.PostRun(func(t *testing.T) {
-				stdinReader.Close()
-				stdinWriter.Close()
-			}),
-			e2e.ExpectExit(0),
-		)
-	}()
-
-	// terminate ssh server once done
-	defer func() {
-		stdinWriter.Write([]byte("bye"))
-		stdinWriter.Close()
-	}()
-
-	// wait until ssh server is up and running
-	retry := 0
-	for {
-		conn, err := net.Dial("tcp", "127.0.0.1:2022")
-		if err == nil {
-			conn.Close()
-			break
-		}
-		time.Sleep(1 * time.Second)
-		retry++
-		if retry == 5 {
-			t.Fatalf("ssh server unreachable after 5 seconds: %+v", err)
-		}
-	}
+// actionUnsquash tests that the --unsquash option succeeds in conversion
+func (c actionTests) actionUnsquash(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
 
-	basicTests := []struct {
+	tests := []struct {
 		name    string
-		spec    string
-		key     string
 		profile e2e.Profile
 	}{
 		{
-			name:    "HostDaemonAsRoot",
-			spec:    "host-daemon",
-			key:     rootPrivKey,
-			profile: e2e.RootProfile,
+			name:    "user",
+			profile: e2e.UserProfile,
 		},
 		{
-			name:    "HostAsRoot",
-			spec:    "host",
-			key:     rootPrivKey,
-			profile: e2e.RootProfile,
+			name:    "userns",
+			profile: e2e.UserNamespaceProfile,
 		},
 		{
-			name:    "ContainerDaemonAsRoot",
-			spec:    "container-daemon",
-			key:     rootPrivKey,
-			profile: e2e.RootProfile,
+			name:    "fakeroot",
+			profile: e2e.FakerootProfile,
 		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--unsquash", c.env.ImagePath, "true"),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectError(e2e.ContainMatch, "Converting SIF"),
+			),
+		)
+	}
+}
+
+func (c actionTests) actionNoMount(t *testing.T) {
+	// TODO - this does not test --no-mount hostfs as that is a little tricky
+	// We are in a mount namespace for e2e tests, so we can setup some mounts in there,
+	// create a custom config with `mount hostfs = yes` set, and then look for presence
+	// or absence of the mounts. I'd like to think about this a bit more though - work up
+	// some nice helpers & cleanup for the actions we need.
+	e2e.EnsureImage(t, c.env)
+
+	tests := []struct {
+		name string
+		// Which mount directive to override (disable)
+		noMount string
+		// Output of `mount` command to ensure we should not find
+		// e.g for `--no-mount home` "on /home" as mount command output is of the form:
+		//   tmpfs on /home/dave type tmpfs (rw,seclabel,nosuid,nodev,relatime,size=16384k,uid=1000,gid=1000)
+		noMatch string
+		// Whether to run the test in default and/or contained modes
+		// Needs to be specified as e.g. by default `/dev` mount is a full bind that will always include `/dev/pts`
+		// ... but in --contained mode disabling devpts stops it being bound in.
+		testDefault   bool
+		testContained bool
+		// To test --no-mount cwd we need to chdir for the execution
+		cwd  string
+		exit int
+	}{
 		{
-			name:    "ContainerAsRoot",
-			spec:    "container",
-			key:     rootPrivKey,
-			profile: e2e.RootProfile,
+			name:          "proc",
+			noMount:       "proc",
+			noMatch:       "on /proc",
+			testDefault:   true,
+			testContained: true,
+			exit:          1, // mount fails with exit code 1 when there is no `/proc`
 		},
 		{
-			name:    "HostDaemonAsUser",
-			spec:    "host-daemon",
-			key:     userPrivKey,
-			profile: e2e.UserProfile,
+			name:          "sys",
+			noMount:       "sys",
+			noMatch:       "on /sys",
+			testDefault:   true,
+			testContained: true,
+			exit:          0,
 		},
 		{
-			name:    "HostAsUser",
-			spec:    "host",
-			key:     userPrivKey,
-			profile: e2e.UserProfile,
+			name:          "dev",
+			noMount:       "dev",
+			noMatch:       "on /dev",
+			testDefault:   true,
+			testContained: true,
+			exit:          0,
 		},
 		{
-			name:    "ContainerDaemonAsUser",
-			spec:    "container-daemon",
-			key:     userPrivKey,
-			profile: e2e.UserProfile,
+			name:          "devpts",
+			noMount:       "devpts",
+			noMatch:       "on /dev/pts",
+			testDefault:   false,
+			testContained: true,
+			exit:          0,
 		},
 		{
-			name:    "ContainerAsUser",
-			spec:    "container",
-			key:     userPrivKey,
-			profile: e2e.UserProfile,
+			name:          "tmp",
+			noMount:       "tmp",
+			noMatch:       "on /tmp",
+			testDefault:   true,
+			testContained: true,
+			exit:          0,
 		},
 		{
-			name:    "HostDaemonAsUserNamespace",
-			spec:    "host-daemon",
-			key:     userPrivKey,
-			profile: e2e.UserNamespaceProfile,
+			name:          "home",
+			noMount:       "home",
+			noMatch:       "on /home",
+			testDefault:   true,
+			testContained: true,
+			exit:          0,
+			// run from / to avoid /home mount via CWD mount
+			cwd: "/",
 		},
 		{
-			name:    "HostAsUserNamespace",
-			spec:    "host",
-			key:     userPrivKey,
-			profile: e2e.UserNamespaceProfile,
+			// test by excluding both home and cwd without chdir
+			name:          "home,cwd",
+			noMount:       "home,cwd",
+			noMatch:       "on /home",
+			testDefault:   true,
+			testContained: true,
+			exit:          0,
 		},
 		{
-			name:    "ContainerDaemonAsUserNamespace",
-			spec:    "container-daemon",
-			key:     userPrivKey,
-			profile: e2e.UserNamespaceProfile,
+			// /srv is an LSB directory we should be able to rely on for our CWD test
+			name:        "cwd",
+			noMount:     "cwd",
+			noMatch:     "on /srv",
+			testDefault: true,
+			// CWD is never mounted with contain so --no-mount CWD doesn't have an effect,
+			// but let's verify it isn't mounted anyway.
+			testContained: true,
+			cwd:           "/srv",
+			exit:          0,
 		},
+		// /etc/hosts & /etc/localtime are default 'bind path' entries we should
+		// be able to disable by abs path. Although other 'bind path' entries
+		// are ignored under '--contain' these two are handled specially in
+		// addBindsMount(), so make sure that `--no-mount` applies properly
+		// under contain also.
 		{
-			name:    "ContainerAsUserNamespace",
-			spec:    "container",
-			key:     userPrivKey,
-			profile: e2e.UserNamespaceProfile,
+			name:          "/etc/hosts",
+			noMount:       "/etc/hosts",
+			noMatch:       "on /etc/hosts",
+			testDefault:   true,
+			testContained: true,
+			exit:          0,
 		},
 		{
-			name:    "HostDaemonAsFakeroot",
-			spec:    "host-daemon",
-			key:     userPrivKey,
-			profile: e2e.FakerootProfile,
+			name:          "/etc/localtime",
+			noMount:       "/etc/localtime",
+			noMatch:       "on /etc/localtime",
+			testDefault:   true,
+			testContained: true,
+			exit:          0,
 		},
+		// bind-paths should disable all of the bind path mounts - including both defaults
 		{
-			name:    "HostAsFakeroot",
-			spec:    "host",
-			key:     userPrivKey,
-			profile: e2e.FakerootProfile,
+			name:          "binds-paths-hosts",
+			noMount:       "bind-paths",
+			noMatch:       "on /etc/hosts",
+			testDefault:   true,
+			testContained: true,
+			exit:          0,
 		},
 		{
-			name:    "ContainerDaemonAsFakeroot",
-			spec:    "container-daemon",
-			key:     userPrivKey,
-			profile: e2e.FakerootProfile,
+			name:          "bind-paths-localtime",
+			noMount:       "bind-paths",
+			noMatch:       "on /etc/localtime",
+			testDefault:   true,
+			testContained: true,
+			exit:          0,
+		},
+	}
+
+	for _, tt := range tests {
+
+		if tt.testDefault {
+			c.env.RunApptainer(
+				t,
+				e2e.WithDir(tt.cwd),
+				e2e.AsSubtest(tt.name),
+				e2e.WithProfile(e2e.UserProfile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--no-mount", tt.noMount, c.env.ImagePath, "mount"),
+				e2e.ExpectExit(tt.exit,
+					e2e.ExpectOutput(e2e.UnwantedContainMatch, tt.noMatch)),
+			)
+		}
+		if tt.testContained {
+			c.env.RunApptainer(
+				t,
+				e2e.WithDir(tt.cwd),
+				e2e.AsSubtest(tt.name+"Contained"),
+				e2e.WithProfile(e2e.UserProfile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--contain", "--no-mount", tt.noMount, c.env.ImagePath, "mount"),
+				e2e.ExpectExit(tt.exit,
+					e2e.ExpectOutput(e2e.UnwantedContainMatch, tt.noMatch)),
+			)
+		}
+	}
+}
+
+// actionCompat checks that the --compat flag sets up the expected environment
+// for improved oci/docker compatibility
+// Must be run in sequential section as it modifies host process umask.
+func (c actionTests) actionCompat(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	type test struct {
+		name     string
+		args     []string
+		exitCode int
+		expect   e2e.ApptainerCmdResultOp
+	}
+
+	tests := []test{
+		{
+			name:     "containall",
+			args:     []string{"--compat", c.env.ImagePath, "sh", "-c", "ls -lah $HOME"},
+			exitCode: 0,
+			expect:   e2e.ExpectOutput(e2e.ContainMatch, "total 0"),
+		},
+		{
+			name:     "writable-tmpfs",
+			args:     []string{"--compat", c.env.ImagePath, "sh", "-c", "touch /test"},
+			exitCode: 0,
 		},
 		{
-			name:    "ContainerAsFakeroot",
-			spec:    "container",
-			key:     userPrivKey,
-			profile: e2e.FakerootProfile,
+			name:     "no-init",
+			args:     []string{"--compat", c.env.ImagePath, "sh", "-c", "ps"},
+			exitCode: 0,
+			expect:   e2e.ExpectOutput(e2e.UnwantedContainMatch, "appinit"),
+		},
+		{
+			name:     "no-umask",
+			args:     []string{"--compat", c.env.ImagePath, "sh", "-c", "umask"},
+			exitCode: 0,
+			expect:   e2e.ExpectOutput(e2e.ContainMatch, "0022"),
 		},
 	}
 
-	optionFmt := "%s:%s root@127.0.0.1:/ -p 2022 -F %s -o IdentityFile=%s -o StrictHostKeyChecking=no %s"
-	sshConfig := filepath.Join(imageDir, "etc", "ssh", "ssh_config")
+	oldUmask := syscall.Umask(0)
+	defer syscall.Umask(oldUmask)
 
-	for _, tt := range basicTests {
+	for _, tt := range tests {
 		c.env.RunApptainer(
 			t,
 			e2e.AsSubtest(tt.name),
-			e2e.WithProfile(tt.profile),
+			e2e.WithProfile(e2e.UserProfile),
 			e2e.WithCommand("exec"),
-			e2e.WithArgs([]string{
-				"--fusemount", fmt.Sprintf(optionFmt, tt.spec, sshfsWrapper, sshConfig, tt.key, "/mnt"),
-				imageDir,
-				"test", "-d", "/mnt/etc",
-			}...),
-			e2e.ExpectExit(0),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(
+				tt.exitCode,
+				tt.expect,
+			),
 		)
 	}
 }
 
-//nolint:maintidx
-func (c actionTests) bindImage(t *testing.T) {
+// actionFakerootCheck verifies that fakeroot --check reports the subuid
+// mapping of the test user, which is used by the fakeroot profile
+func (c actionTests) actionFakerootCheck(t *testing.T) {
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("text"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("fakeroot"),
+		e2e.WithArgs("--check"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ContainMatch, "Selected mechanism: subuid user namespace")),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("json"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("fakeroot"),
+		e2e.WithArgs("--check", "--json"),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			var d struct {
+				Checks []struct {
+					Name   string `json:"name"`
+					Status string `json:"status"`
+				} `json:"checks"`
+				Mechanism string `json:"mechanism"`
+				Usable    bool   `json:"usable"`
+			}
+			if err := json.Unmarshal(r.Stdout, &d); err != nil {
+				t.Fatalf("could not decode fakeroot diagnostics: %s", err)
+			}
+			if d.Mechanism != "subuid user namespace" || !d.Usable {
+				t.Errorf("got mechanism %q (usable %v), want usable subuid user namespace", d.Mechanism, d.Usable)
+			}
+			for _, check := range d.Checks {
+				if check.Name == "/etc/subuid" && check.Status != "pass" {
+					t.Errorf("got /etc/subuid check status %q, want pass", check.Status)
+				}
+			}
+		}),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("no check"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("fakeroot"),
+		e2e.ExpectExit(1),
+	)
+}
+
+// actionFakerootHome verifies that home dir is /root with --fakeroot
+// (see: https://github.com/apptainer/apptainer/issues/618)
+func (c actionTests) actionFakerootHome(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
 
-	require.Command(t, "mkfs.ext3")
-	require.Command(t, "mksquashfs")
-	require.Command(t, "dd")
+	type test struct {
+		name     string
+		args     []string
+		exitCode int
+		expect   e2e.ApptainerCmdResultOp
+	}
 
-	testdir, err := os.MkdirTemp(c.env.TestDir, "bind-image-")
-	if err != nil {
-		t.Fatal(err)
+	tests := []test{
+		{
+			name:     "fakeroot --with-suid",
+			args:     []string{c.env.ImagePath, "sh", "-c", "echo $HOME"},
+			exitCode: 0,
+			expect:   e2e.ExpectOutput(e2e.ExactMatch, "/root"),
+		},
+		{
+			name:     "fakeroot --without-suid",
+			args:     []string{"--userns", c.env.ImagePath, "sh", "-c", "echo $HOME"},
+			exitCode: 0,
+			expect:   e2e.ExpectOutput(e2e.ExactMatch, "/root"),
+		},
 	}
 
-	scratchDir := filepath.Join(testdir, "scratch")
-	if err := os.MkdirAll(filepath.Join(scratchDir, "bin"), 0o700); err != nil {
-		t.Fatal(err)
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.FakerootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(
+				tt.exitCode,
+				tt.expect,
+			),
+		)
 	}
+}
 
-	cleanup := func(t *testing.T) {
-		if t.Failed() {
-			t.Logf("Not removing directory %s for test %s", testdir, t.Name())
-			return
-		}
-		err := os.RemoveAll(testdir)
-		if err != nil {
-			t.Logf("Error while removing directory %s for test %s: %#v", testdir, t.Name(), err)
+// actionFakerootDB tests that the ownership set with the fakeroot command
+// in a sandbox is kept across runs with --fakeroot-db.
+func (c actionTests) actionFakerootDB(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	require.Command(t, "fakeroot")
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "fakeroot-db-", "")
+	defer e2e.Privileged(cleanup)
+	sandbox := filepath.Join(tmpDir, "sandbox")
+	db := filepath.Join(tmpDir, "fakeroot.db")
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--force", "--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+
+	tests := []struct {
+		name   string
+		args   []string
+		expect e2e.ApptainerCmdResultOp
+	}{
+		{
+			name: "chown",
+			args: []string{"sh", "-c", "touch /etc/fakedb && chown 1:1 /etc/fakedb"},
+		},
+		{
+			name:   "ownership kept",
+			args:   []string{"stat", "-c", "%u:%g", "/etc/fakedb"},
+			expect: e2e.ExpectOutput(e2e.ExactMatch, "1:1"),
+		},
+	}
+
+	for _, tt := range tests {
+		args := append([]string{"--ignore-subuid", "--writable", "--fakeroot-db", db, sandbox}, tt.args...)
+		exitOps := []e2e.ApptainerCmdResultOp{}
+		if tt.expect != nil {
+			exitOps = append(exitOps, tt.expect)
 		}
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.FakerootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(args...),
+			e2e.ExpectExit(0, exitOps...),
+		)
 	}
-	defer cleanup(t)
+}
 
-	sifSquashImage := filepath.Join(testdir, "data_squash.sif")
-	sifExt3Image := filepath.Join(testdir, "data_ext3.sif")
-	squashfsImage := filepath.Join(testdir, "squashfs.simg")
-	ext3Img := filepath.Join(testdir, "ext3_fs.img")
+// Make sure --workdir and --scratch work together nicely even when workdir is a
+// relative path. Test needs to be run in non-parallel mode, because it changes
+// the current working directory of the host.
+func (c actionTests) relWorkdirScratch(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
 
-	// create root directory for squashfs image
-	squashDir, err := os.MkdirTemp(testdir, "root-squash-dir-")
+	testdir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "persistent-overlay-", "")
+	t.Cleanup(func() {
+		if !t.Failed() {
+			e2e.Privileged(cleanup)
+		}
+	})
+
+	const subdirName string = "mysubdir"
+	if err := os.Mkdir(filepath.Join(testdir, subdirName), 0o777); err != nil {
+		t.Fatalf("could not create subdirectory %q in %q: %s", subdirName, testdir, err)
+	}
+
+	// Change current working directory, with deferred undoing of change.
+	prevCwd, err := os.Getwd()
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("could not get current working directory: %s", err)
 	}
-	if err := os.Chmod(squashDir, 0o755); err != nil {
-		t.Fatal(err)
+	defer os.Chdir(prevCwd)
+	if err = os.Chdir(testdir); err != nil {
+		t.Fatalf("could not change cwd to %q: %s", testdir, err)
 	}
 
-	squashMarkerFile := "squash_marker"
-	if err := fs.Touch(filepath.Join(squashDir, squashMarkerFile)); err != nil {
-		t.Fatal(err)
-	}
+	profiles := []e2e.Profile{e2e.UserProfile, e2e.RootProfile, e2e.FakerootProfile, e2e.UserNamespaceProfile}
 
-	// create the squashfs overlay image
-	cmd := exec.Command("mksquashfs", squashDir, squashfsImage, "-noappend", "-all-root")
-	if res := cmd.Run(t); res.Error != nil {
-		t.Fatalf("Unexpected error while running command.\n%s", res)
+	for _, p := range profiles {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(p.String()),
+			e2e.WithProfile(p),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--contain", "--workdir", "./"+subdirName, "--scratch", "/myscratch", c.env.ImagePath, "true"),
+			e2e.ExpectExit(0),
+		)
 	}
+}
 
-	// create the overlay ext3 image
-	cmd = exec.Command("dd", "if=/dev/zero", "of="+ext3Img, "bs=1M", "count=64", "status=none")
-	if res := cmd.Run(t); res.Error != nil {
-		t.Fatalf("Unexpected error while running command.\n%s", res)
-	}
+// actionStdinImage tests reading the image from stdin with "-" as image
+// argument, the image being removed once the container exits.
+func (c actionTests) actionStdinImage(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
 
-	cmd = exec.Command("mkfs.ext3", "-q", "-F", ext3Img)
-	if res := cmd.Run(t); res.Error != nil {
-		t.Fatalf("Unexpected error while running command.\n%s", res)
+	openImage := func(t *testing.T) *os.File {
+		f, err := os.Open(c.env.ImagePath)
+		if err != nil {
+			t.Fatalf("while opening %s: %s", c.env.ImagePath, err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
 	}
 
-	// create new SIF images
-	c.env.RunApptainer(
-		t,
-		e2e.WithProfile(e2e.UserProfile),
-		e2e.WithCommand("sif"),
-		e2e.WithArgs([]string{"new", sifSquashImage}...),
-		e2e.ExpectExit(0),
-	)
-	c.env.RunApptainer(
-		t,
-		e2e.WithProfile(e2e.UserProfile),
-		e2e.WithCommand("sif"),
-		e2e.WithArgs([]string{"new", sifExt3Image}...),
-		e2e.ExpectExit(0),
-	)
+	for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.RootProfile, e2e.UserNamespaceProfile} {
+		t.Run(profile.String(), func(t *testing.T) {
+			tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "stdin-", "")
+			t.Cleanup(func() {
+				if !t.Failed() {
+					cleanup(t)
+				}
+			})
+			checkRemoved := func(t *testing.T, r *e2e.ApptainerCmdResult) {
+				entries, err := os.ReadDir(tmpDir)
+				if err != nil {
+					t.Fatalf("while reading %s: %s", tmpDir, err)
+				}
+				if len(entries) > 0 {
+					t.Errorf("image read from stdin not removed from %s", tmpDir)
+				}
+			}
+			tmpEnv := e2e.WithEnv(append(os.Environ(), "APPTAINER_TMPDIR="+tmpDir))
 
-	// arch partition doesn't matter for data partition so
-	// take amd64 by default
-	c.env.RunApptainer(
-		t,
-		e2e.WithProfile(e2e.UserProfile),
-		e2e.WithCommand("sif"),
-		e2e.WithArgs([]string{
-			"add",
-			"--datatype", "4", "--partarch", "2",
-			"--partfs", "1", "--parttype", "3",
-			sifSquashImage, squashfsImage,
-		}...),
-		e2e.ExpectExit(0),
-	)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("exec"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("-", "cat", "/etc/os-release"),
+				e2e.WithStdin(openImage(t)),
+				tmpEnv,
+				e2e.ExpectExit(0,
+					e2e.ExpectOutput(e2e.ContainMatch, "Alpine Linux"),
+					checkRemoved,
+				),
+			)
+
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("exit code"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("-", "false"),
+				e2e.WithStdin(openImage(t)),
+				tmpEnv,
+				e2e.ExpectExit(1, checkRemoved),
+			)
+
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("not SIF"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("run"),
+				e2e.WithArgs("-"),
+				e2e.WithStdin(strings.NewReader("#!/bin/sh\necho not a SIF\n")),
+				tmpEnv,
+				e2e.ExpectExit(255,
+					e2e.ExpectError(e2e.ContainMatch, "data read from stdin is not a SIF image"),
+					checkRemoved,
+				),
+			)
+
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("max size"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("-", "true"),
+				e2e.WithStdin(openImage(t)),
+				e2e.WithEnv(append(os.Environ(), "APPTAINER_TMPDIR="+tmpDir, "APPTAINER_STDIN_IMAGE_MAX_SIZE=1KiB")),
+				e2e.ExpectExit(255,
+					e2e.ExpectError(e2e.ContainMatch, "image read from stdin is too large"),
+					checkRemoved,
+				),
+			)
+
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("shell"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("shell"),
+				e2e.WithArgs("-"),
+				e2e.WithStdin(openImage(t)),
+				tmpEnv,
+				e2e.ExpectExit(255,
+					e2e.ExpectError(e2e.ContainMatch, "the image can't be read from stdin: use an image file instead"),
+					checkRemoved,
+				),
+			)
+		})
+	}
+}
 
-	c.env.RunApptainer(
-		t,
-		e2e.WithProfile(e2e.UserProfile),
-		e2e.WithCommand("sif"),
-		e2e.WithArgs([]string{
-			"add",
-			"--datatype", "4", "--partarch", "2",
-			"--partfs", "2", "--parttype", "3",
-			sifExt3Image, ext3Img,
-		}...),
-		e2e.ExpectExit(0),
-	)
+// bindPropagation checks that file systems mounted on the host under
+// a bind source after the container started are visible in the container
+// according to the mount propagation of the bind.
+func (c actionTests) bindPropagation(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	defer e2e.ResetDirective(t, c.env, "bind propagation")
 
 	tests := []struct {
-		name    string
-		profile e2e.Profile
-		args    []string
-		exit    int
+		name      string
+		bind      func(src string) []string
+		directive string
+		visible   bool
 	}{
 		{
-			name:    "NoBindOption",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", squashfsImage + ":/bind",
-				c.env.ImagePath,
-				"test", "-f", filepath.Join("/bind", squashMarkerFile),
-			},
-			exit: 1,
-		},
-		{
-			name:    "BadIDValue",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", squashfsImage + ":/bind:id=0",
-				c.env.ImagePath,
-				"true",
-			},
-			exit: 255,
-		},
-		{
-			name:    "BadBindOption",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", squashfsImage + ":/bind:fake_option=fake",
-				c.env.ImagePath,
-				"true",
-			},
-			exit: 255,
-		},
-		{
-			name:    "SandboxKO",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", squashDir + ":/bind:image-src=/",
-				c.env.ImagePath,
-				"true",
-			},
-			exit: 255,
+			name:    "BindRslave",
+			bind:    func(src string) []string { return []string{"--bind", src + ":/propagation:rslave"} },
+			visible: true,
 		},
 		{
-			name:    "Squashfs",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", squashfsImage + ":/bind:image-src=/",
-				c.env.ImagePath,
-				"test", "-f", filepath.Join("/bind", squashMarkerFile),
-			},
-			exit: 0,
+			name:    "BindRprivate",
+			bind:    func(src string) []string { return []string{"--bind", src + ":/propagation:ro,rprivate"} },
+			visible: false,
 		},
 		{
-			name:    "SquashfsDouble",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", squashfsImage + ":/bind1:image-src=/",
-				"--bind", squashfsImage + ":/bind2:image-src=/",
-				c.env.ImagePath,
-				"test", "-f", filepath.Join("/bind1", squashMarkerFile), "-a", "-f", filepath.Join("/bind2", squashMarkerFile),
+			name: "MountRslave",
+			bind: func(src string) []string {
+				return []string{"--mount", "type=bind,source=" + src + ",destination=/propagation,bind-propagation=rslave"}
 			},
-			exit: 0,
+			visible: true,
 		},
 		{
-			name:    "SquashfsBadSource",
-			profile: e2e.UserProfile,
-			args:    []string{"--bind", squashfsImage + ":/bind:image-src=/ko", c.env.ImagePath, "true"},
-			exit:    255,
+			name:      "DirectiveRslave",
+			bind:      func(src string) []string { return []string{"--bind", src + ":/propagation"} },
+			directive: "rslave",
+			visible:   true,
 		},
 		{
-			name:    "SquashfsMixedBind",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", squashfsImage + ":/bind1:image-src=/",
-				"--bind", squashDir + ":/bind2",
-				c.env.ImagePath,
-				"test", "-f", filepath.Join("/bind1", squashMarkerFile), "-a", "-f", filepath.Join("/bind2", squashMarkerFile),
-			},
-			exit: 0,
+			name:      "DirectiveOverridden",
+			bind:      func(src string) []string { return []string{"--bind", src + ":/propagation:rprivate"} },
+			directive: "rslave",
+			visible:   false,
 		},
+	}
+
+	for _, profile := range []e2e.Profile{e2e.RootProfile, e2e.UserNamespaceProfile} {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			for i, tt := range tests {
+				src, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "propagation-", "")
+				sub := filepath.Join(src, "sub")
+				if err := os.Mkdir(sub, 0o755); err != nil {
+					cleanup(t)
+					t.Fatal(err)
+				}
+
+				// the bind source is a shared mount point in the test
+				// mount namespace, the container one being its slave
+				e2e.Privileged(func(t *testing.T) {
+					if err := unix.Mount(src, src, "", unix.MS_BIND, ""); err != nil {
+						t.Fatalf("while bind mounting %s: %s", src, err)
+					}
+					if err := unix.Mount("", src, "", unix.MS_SHARED, ""); err != nil {
+						t.Fatalf("while making %s shared: %s", src, err)
+					}
+				})(t)
+
+				if tt.directive != "" {
+					e2e.SetDirective(t, c.env, "bind propagation", src+"="+tt.directive)
+				} else {
+					e2e.ResetDirective(t, c.env, "bind propagation")
+				}
+
+				instanceName := fmt.Sprintf("propagation%d", i)
+				args := append(tt.bind(src), c.env.ImagePath, instanceName)
+				c.env.RunApptainer(
+					t,
+					e2e.AsSubtest(tt.name+"/start"),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("instance start"),
+					e2e.WithArgs(args...),
+					e2e.ExpectExit(0),
+				)
+
+				// mount a file system under the bind source once the
+				// container is running
+				e2e.Privileged(func(t *testing.T) {
+					if err := unix.Mount("tmpfs", sub, "tmpfs", 0, "mode=0755"); err != nil {
+						t.Fatalf("while mounting tmpfs on %s: %s", sub, err)
+					}
+					if err := os.WriteFile(filepath.Join(sub, "marker"), nil, 0o644); err != nil {
+						t.Fatalf("while creating marker: %s", err)
+					}
+				})(t)
+
+				exit := 1
+				if tt.visible {
+					exit = 0
+				}
+				c.env.RunApptainer(
+					t,
+					e2e.AsSubtest(tt.name+"/check"),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs("instance://"+instanceName, "test", "-f", "/propagation/sub/marker"),
+					e2e.ExpectExit(exit),
+				)
+
+				c.env.RunApptainer(
+					t,
+					e2e.AsSubtest(tt.name+"/stop"),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("instance stop"),
+					e2e.WithArgs(instanceName),
+					e2e.ExpectExit(0),
+				)
+
+				e2e.Privileged(func(t *testing.T) {
+					if err := unix.Unmount(src, unix.MNT_DETACH); err != nil {
+						t.Errorf("while unmounting %s: %s", src, err)
+					}
+				})(t)
+				cleanup(t)
+			}
+		})
+	}
+}
+
+// actionFSMounts tests the tmpfs and devpts mounts of --mount and
+// --shm-size by checking their options in /proc/mounts.
+func (c actionTests) actionFSMounts(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	defer e2e.ResetDirective(t, c.env, "max tmpfs size")
+
+	tests := []struct {
+		name      string
+		profiles  []e2e.Profile
+		args      []string
+		directive string
+		match     string
+		exit      int
+	}{
 		{
-			name:    "Ext3Write",
-			profile: e2e.RootProfile,
-			args: []string{
-				"--bind", ext3Img + ":/bind:image-src=/",
-				c.env.ImagePath,
-				"touch", "/bind/ext3_marker",
-			},
-			exit: 0,
+			name:     "ShmSize",
+			profiles: []e2e.Profile{e2e.UserProfile, e2e.RootProfile, e2e.UserNamespaceProfile, e2e.FakerootProfile},
+			args:     []string{"--shm-size", "16m"},
+			match:    `(?m)^\S+ /dev/shm tmpfs \S*size=16384k[, ]`,
 		},
 		{
-			name:    "Ext3WriteKO",
-			profile: e2e.RootProfile,
-			args: []string{
-				"--bind", ext3Img + ":/bind:image-src=/,ro",
-				c.env.ImagePath,
-				"touch", "/bind/ext3_marker",
-			},
-			exit: 1,
+			name:     "ShmSizeContain",
+			profiles: []e2e.Profile{e2e.UserProfile, e2e.RootProfile, e2e.UserNamespaceProfile},
+			args:     []string{"--contain", "--shm-size", "16m"},
+			match:    `(?m)^\S+ /dev/shm tmpfs \S*size=16384k[, ]`,
 		},
 		{
-			name:    "SifDataExt3Write",
-			profile: e2e.RootProfile,
-			args: []string{
-				"--bind", sifExt3Image + ":/bind:image-src=/",
-				c.env.ImagePath,
-				"touch", "/bind/ext3_marker",
-			},
-			exit: 0,
+			name:     "ShmMount",
+			profiles: []e2e.Profile{e2e.UserProfile, e2e.RootProfile, e2e.UserNamespaceProfile},
+			args:     []string{"--mount", "type=tmpfs,dst=/dev/shm,size=32m,mode=1777"},
+			match:    `(?m)^\S+ /dev/shm tmpfs \S*size=32768k[, ]`,
 		},
 		{
-			name:    "Ext3Read",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", ext3Img + ":/bind:image-src=/",
-				c.env.ImagePath,
-				"test", "-f", "/bind/ext3_marker",
-			},
-			exit: 0,
+			name:     "ShmConflict",
+			profiles: []e2e.Profile{e2e.UserProfile},
+			args:     []string{"--shm-size", "16m", "--mount", "type=tmpfs,dst=/dev/shm"},
+			exit:     255,
 		},
 		{
-			name:    "Ext3Double",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", ext3Img + ":/bind1:image-src=/",
-				"--bind", ext3Img + ":/bind2:image-src=/",
-				c.env.ImagePath,
-				"true",
-			},
-			exit: 255,
+			name:     "TmpfsScratch",
+			profiles: []e2e.Profile{e2e.UserProfile, e2e.RootProfile, e2e.UserNamespaceProfile},
+			args:     []string{"--mount", "type=tmpfs,destination=/scratch,size=8m,mode=0700"},
+			match:    `(?m)^\S+ /scratch tmpfs \S*size=8192k,mode=700`,
 		},
 		{
-			name:    "SifDataSquash",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", sifSquashImage + ":/bind:image-src=/",
-				c.env.ImagePath,
-				"test", "-f", filepath.Join("/bind", squashMarkerFile),
-			},
-			exit: 0,
+			name:     "TmpfsReadonly",
+			profiles: []e2e.Profile{e2e.UserProfile, e2e.RootProfile},
+			args:     []string{"--mount", "type=tmpfs,destination=/scratch,ro"},
+			match:    `(?m)^\S+ /scratch tmpfs ro,`,
 		},
 		{
-			name:    "SifDataExt3Read",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", sifExt3Image + ":/bind:image-src=/",
-				c.env.ImagePath,
-				"test", "-f", "/bind/ext3_marker",
-			},
-			exit: 0,
+			name:      "TmpfsClamped",
+			profiles:  []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile},
+			args:      []string{"--mount", "type=tmpfs,destination=/scratch,size=64m"},
+			directive: "8",
+			match:     `(?m)^\S+ /scratch tmpfs \S*size=8192k`,
 		},
 		{
-			name:    "SifDataExt3AndSquash",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", sifExt3Image + ":/ext3:image-src=/",
-				"--bind", sifSquashImage + ":/squash:image-src=/",
-				c.env.ImagePath,
-				"test", "-f", filepath.Join("/squash", squashMarkerFile), "-a", "-f", "/ext3/ext3_marker",
-			},
-			exit: 0,
+			name:      "TmpfsDefaultClamped",
+			profiles:  []e2e.Profile{e2e.UserProfile},
+			args:      []string{"--mount", "type=tmpfs,destination=/scratch"},
+			directive: "8",
+			match:     `(?m)^\S+ /scratch tmpfs \S*size=8192k`,
 		},
 		{
-			name:    "SifDataExt3Double",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", sifExt3Image + ":/bind1:image-src=/",
-				"--bind", sifExt3Image + ":/bind2:image-src=/",
-				c.env.ImagePath,
-				"true",
-			},
-			exit: 255,
+			name:      "TmpfsRootUnclamped",
+			profiles:  []e2e.Profile{e2e.RootProfile},
+			args:      []string{"--mount", "type=tmpfs,destination=/scratch,size=64m"},
+			directive: "8",
+			match:     `(?m)^\S+ /scratch tmpfs \S*size=65536k`,
 		},
 		{
-			name:    "SifWithID",
-			profile: e2e.UserProfile,
-			args: []string{
-				// rootfs ID is now '4'
-				"--bind", c.env.ImagePath + ":/rootfs:id=4",
-				c.env.ImagePath,
-				"test", "-d", "/rootfs/etc",
-			},
-			exit: 0,
+			name:     "Devpts",
+			profiles: []e2e.Profile{e2e.UserProfile, e2e.RootProfile, e2e.UserNamespaceProfile},
+			args:     []string{"--mount", "type=devpts,dst=/dev/pts,newinstance,ptmxmode=0600"},
+			match:    `(?m)^\S+ /dev/pts devpts \S*mode=620,ptmxmode=600`,
 		},
-		// check ordering between image and user bind
 		{
-			name:    "SquashfsBeforeScratch",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", sifSquashImage + ":/scratch/bin:image-src=/",
-				"--bind", scratchDir + ":/scratch",
-				c.env.ImagePath,
-				"test", "-f", filepath.Join("/scratch/bin", squashMarkerFile),
-			},
-			exit: 0,
+			name:     "DevptsContain",
+			profiles: []e2e.Profile{e2e.UserProfile, e2e.RootProfile},
+			args:     []string{"--contain", "--mount", "type=devpts,dst=/dev/pts,newinstance,ptmxmode=0600"},
+			match:    `(?m)^\S+ /dev/pts devpts \S*mode=620,ptmxmode=600`,
 		},
-		{
-			name:    "ScratchBeforeSquashfs",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--bind", scratchDir + ":/scratch",
-				"--bind", sifSquashImage + ":/scratch/bin:image-src=/",
-				c.env.ImagePath,
-				"test", "-f", filepath.Join("/scratch/bin", squashMarkerFile),
-			},
-			exit: 0,
+	}
+
+	for _, tt := range tests {
+		if tt.directive != "" {
+			e2e.SetDirective(t, c.env, "max tmpfs size", tt.directive)
+		} else {
+			e2e.ResetDirective(t, c.env, "max tmpfs size")
+		}
+		for _, profile := range tt.profiles {
+			var expect []e2e.ApptainerCmdResultOp
+			if tt.match != "" {
+				expect = append(expect, e2e.ExpectOutput(e2e.RegexMatch, tt.match))
+			}
+			args := append(tt.args, c.env.ImagePath, "cat", "/proc/mounts")
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest(tt.name+"/"+profile.String()),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs(args...),
+				e2e.ExpectExit(tt.exit, expect...),
+			)
+		}
+	}
+}
+
+// actionLimitedFs tests running an image stored on a FUSE filesystem
+// without memory mapping support, like the mounts of object stores, which
+// is copied to a temporary directory with the setuid starter, and mounted
+// by squashfuse otherwise.
+func (c actionTests) actionLimitedFs(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	require.Filesystem(t, "fuse")
+
+	source, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "limitedfs-source-", "")
+	defer cleanup(t)
+	if err := fs.CopyFile(c.env.ImagePath, filepath.Join(source, "image.sif"), 0o644); err != nil {
+		t.Fatalf("Could not copy test image file: %v", err)
+	}
+	target, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "limitedfs-", "")
+	defer cleanup(t)
+	e2e.Privileged(func(t *testing.T) {
+		e2e.MountLimitedFs(t, source, target)
+	})(t)
+	image := filepath.Join(target, "image.sif")
+
+	tests := []struct {
+		name       string
+		profile    e2e.Profile
+		copyMax    string
+		expectExit int
+		expectOp   e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:       "copy",
+			profile:    e2e.UserProfile,
+			expectExit: 0,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "without memory mapping support, copying it to"),
 		},
-		// For the --mount variants we are really just verifying the CLI
-		// acceptance of one or more image bind mount strings. Translation from
-		// --mount strings to BindPath structs is checked in unit tests. The
-		// functionality of image mounts of various kinds is already checked
-		// above, with --bind flags. No need to duplicate all of these.
 		{
-			name:    "MountSifWithID",
-			profile: e2e.UserProfile,
-			args: []string{
-				// rootfs ID is now '4'
-				"--mount", "type=bind,source=" + c.env.ImagePath + ",destination=/rootfs,id=4",
-				c.env.ImagePath,
-				"test", "-d", "/rootfs/etc",
-			},
-			exit: 0,
+			name:       "copy disabled",
+			profile:    e2e.UserProfile,
+			copyMax:    "0",
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "larger than the 'image copy max size' of 0 MiB"),
 		},
 		{
-			name:    "MountSifDataExt3AndSquash",
-			profile: e2e.UserProfile,
-			args: []string{
-				"--mount", "type=bind,source=" + sifExt3Image + ",destination=/ext3,image-src=/",
-				"--mount", "type=bind,source=" + sifSquashImage + ",destination=/squash,image-src=/",
-				c.env.ImagePath,
-				"test", "-f", filepath.Join("/squash", squashMarkerFile), "-a", "-f", "/ext3/ext3_marker",
-			},
-			exit: 0,
+			name:       "squashfuse",
+			profile:    e2e.UserNamespaceProfile,
+			copyMax:    "0",
+			expectExit: 0,
 		},
 	}
 
@@ -2508,388 +4760,587 @@ func (c actionTests) bindImage(t *testing.T) {
 			t,
 			e2e.AsSubtest(tt.name),
 			e2e.WithProfile(tt.profile),
+			e2e.PreRun(func(t *testing.T) {
+				if tt.copyMax != "" {
+					e2e.SetDirective(t, c.env, "image copy max size", tt.copyMax)
+				}
+			}),
+			e2e.PostRun(func(t *testing.T) {
+				if tt.copyMax != "" {
+					e2e.ResetDirective(t, c.env, "image copy max size")
+				}
+			}),
 			e2e.WithCommand("exec"),
-			e2e.WithArgs(tt.args...),
-			e2e.ExpectExit(tt.exit),
+			e2e.WithArgs(image, "true"),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
 		)
 	}
 }
 
-// actionUmask tests that the within-container umask is correct in action flows
-// Must be run in sequential section as it modifies host process umask.
-func (c actionTests) actionUmask(t *testing.T) {
+// hostUptime returns the uptime of the host, from the boottime clock.
+func hostUptime(t *testing.T) float64 {
+	b, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		t.Fatalf("could not read /proc/uptime: %s", err)
+	}
+	return parseUptime(t, string(b))
+}
+
+// parseUptime returns the uptime of the /proc/uptime content.
+func parseUptime(t *testing.T, content string) float64 {
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		t.Fatalf("unexpected /proc/uptime content %q", content)
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		t.Fatalf("unexpected /proc/uptime content %q: %s", content, err)
+	}
+	return uptime
+}
+
+// actionTimeNamespace tests the clock offsets of --time-offset, by reading
+// /proc/uptime inside and outside of the container, for a container and
+// for an instance joined by exec.
+func (c actionTests) actionTimeNamespace(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
+	require.TimeNamespace(t)
 
-	u := e2e.UserProfile.HostUser(t)
+	const boottime = 86400
 
-	// Set umask for tests to 0000
-	oldUmask := syscall.Umask(0)
-	defer syscall.Umask(oldUmask)
+	// the offset is checked within a minute, for slow test runs
+	checkUptime := func(t *testing.T, stdout string) {
+		if t.Failed() {
+			return
+		}
+		host := hostUptime(t)
+		container := parseUptime(t, stdout)
+		if diff := container - host; diff < boottime-60 || diff > boottime+60 {
+			t.Errorf("container uptime %.2f is not offset by %d seconds from host uptime %.2f", container, boottime, host)
+		}
+	}
 
-	c.env.RunApptainer(
-		t,
-		e2e.WithProfile(e2e.FakerootProfile),
-		e2e.WithDir(u.Dir),
-		e2e.WithCommand("exec"),
-		e2e.WithArgs(c.env.ImagePath, "sh", "-c", "umask"),
-		e2e.ExpectExit(
-			0,
-			e2e.ExpectOutput(e2e.ExactMatch, "0000"),
-		),
-	)
+	profiles := []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile, e2e.FakerootProfile}
 
-	c.env.RunApptainer(
-		t,
-		e2e.WithProfile(e2e.FakerootProfile),
-		e2e.WithDir(u.Dir),
-		e2e.WithCommand("exec"),
-		e2e.WithArgs("--no-umask", c.env.ImagePath, "sh", "-c", "umask"),
-		e2e.ExpectExit(
-			0,
-			e2e.ExpectOutput(e2e.ExactMatch, "0022"),
-		),
-	)
-}
+	for _, profile := range profiles {
+		t.Run(profile.String(), func(t *testing.T) {
+			var stdout, stderr string
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("uptime"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--time-offset", fmt.Sprintf("monotonic=+3600,boottime=+%d", boottime), c.env.ImagePath, "cat", "/proc/uptime"),
+				e2e.ExpectExit(0, e2e.GetStreams(&stdout, &stderr)),
+			)
+			checkUptime(t, stdout)
 
-// actionUnsquash tests that the --unsquash option succeeds in conversion
-func (c actionTests) actionUnsquash(t *testing.T) {
-	e2e.EnsureImage(t, c.env)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("offsets"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--time-offset", "monotonic=-1.5s,boottime=+24h", c.env.ImagePath, "cat", "/proc/self/timens_offsets"),
+				e2e.ExpectExit(
+					0,
+					e2e.ExpectOutput(e2e.RegexMatch, `(?m)^monotonic\s+-2\s+500000000$`),
+					e2e.ExpectOutput(e2e.RegexMatch, `(?m)^boottime\s+86400\s+0$`),
+				),
+			)
+
+			// without --time-offset the host clocks are used
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("none"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs(c.env.ImagePath, "cat", "/proc/self/timens_offsets"),
+				e2e.ExpectExit(
+					0,
+					e2e.ExpectOutput(e2e.RegexMatch, `(?m)^boottime\s+0\s+0$`),
+				),
+			)
+
+			instanceName := "timens-" + strings.ToLower(profile.String())
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("instance/start"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("instance start"),
+				e2e.WithArgs("--time-offset", fmt.Sprintf("boottime=%d", boottime), c.env.ImagePath, instanceName),
+				e2e.ExpectExit(0),
+			)
+
+			stdout = ""
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("instance/exec"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("instance://"+instanceName, "cat", "/proc/uptime"),
+				e2e.ExpectExit(0, e2e.GetStreams(&stdout, &stderr)),
+			)
+			checkUptime(t, stdout)
+
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("instance/join-offset"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--time-offset", "boottime=1", "instance://"+instanceName, "true"),
+				e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "can't be used to join an instance")),
+			)
+
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("instance/stop"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("instance stop"),
+				e2e.WithArgs(instanceName),
+				e2e.ExpectExit(0),
+			)
+		})
+	}
 
 	tests := []struct {
-		name    string
-		profile e2e.Profile
+		name     string
+		args     []string
+		expectOp e2e.ApptainerCmdResultOp
 	}{
 		{
-			name:    "user",
-			profile: e2e.UserProfile,
+			name:     "BadClock",
+			args:     []string{"--time-offset", "realtime=+3600"},
+			expectOp: e2e.ExpectError(e2e.ContainMatch, "use monotonic or boottime"),
 		},
 		{
-			name:    "userns",
-			profile: e2e.UserNamespaceProfile,
+			name:     "BadOffset",
+			args:     []string{"--time-offset", "boottime=tomorrow"},
+			expectOp: e2e.ExpectError(e2e.ContainMatch, "neither a number of seconds nor a duration"),
 		},
 		{
-			name:    "fakeroot",
-			profile: e2e.FakerootProfile,
+			name:     "BadFaketime",
+			args:     []string{"--faketime", "2020-01-01"},
+			expectOp: e2e.ExpectError(e2e.ContainMatch, "an RFC3339 date"),
 		},
 	}
-
 	for _, tt := range tests {
 		c.env.RunApptainer(
 			t,
 			e2e.AsSubtest(tt.name),
-			e2e.WithProfile(tt.profile),
+			e2e.WithProfile(e2e.UserProfile),
 			e2e.WithCommand("exec"),
-			e2e.WithArgs("--unsquash", c.env.ImagePath, "true"),
-			e2e.ExpectExit(
-				0,
-				e2e.ExpectError(e2e.ContainMatch, "Converting SIF"),
-			),
+			e2e.WithArgs(append(tt.args, c.env.ImagePath, "true")...),
+			e2e.ExpectExit(255, tt.expectOp),
 		)
 	}
+
+	// the test image has no libfaketime, only the warning is expected
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("FaketimeNoLib"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--faketime", "2020-01-01T00:00:00Z", c.env.ImagePath, "true"),
+		e2e.ExpectExit(0, e2e.ExpectError(e2e.ContainMatch, "libfaketime not found in container")),
+	)
 }
 
-func (c actionTests) actionNoMount(t *testing.T) {
-	// TODO - this does not test --no-mount hostfs as that is a little tricky
-	// We are in a mount namespace for e2e tests, so we can setup some mounts in there,
-	// create a custom config with `mount hostfs = yes` set, and then look for presence
-	// or absence of the mounts. I'd like to think about this a bit more though - work up
-	// some nice helpers & cleanup for the actions we need.
+// actionHostname tests that --hostname and --domainname set the hostname of
+// the UTS namespace, /etc/hostname and the 127.0.1.1 entry of /etc/hosts
+// consistently, also when the hostname is forced by 'container hostname'.
+func (c actionTests) actionHostname(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
 
+	const script = "hostname; hostname -f; cat /etc/hostname /proc/sys/kernel/domainname; grep ^127.0.1.1 /etc/hosts"
+
+	user := regexp.MustCompile(`[^A-Za-z0-9-]`).ReplaceAllString(e2e.CurrentUser(t).Name, "-")
+	// the UTS namespace inherits the domainname of the host without --domainname
+	b, err := os.ReadFile("/proc/sys/kernel/domainname")
+	if err != nil {
+		t.Fatalf("could not read domainname: %s", err)
+	}
+	hostDomainname := strings.TrimSpace(string(b))
+
 	tests := []struct {
-		name string
-		// Which mount directive to override (disable)
-		noMount string
-		// Output of `mount` command to ensure we should not find
-		// e.g for `--no-mount home` "on /home" as mount command output is of the form:
-		//   tmpfs on /home/dave type tmpfs (rw,seclabel,nosuid,nodev,relatime,size=16384k,uid=1000,gid=1000)
-		noMatch string
-		// Whether to run the test in default and/or contained modes
-		// Needs to be specified as e.g. by default `/dev` mount is a full bind that will always include `/dev/pts`
-		// ... but in --contained mode disabling devpts stops it being bound in.
-		testDefault   bool
-		testContained bool
-		// To test --no-mount cwd we need to chdir for the execution
-		cwd  string
-		exit int
+		name      string
+		profiles  []e2e.Profile
+		args      []string
+		directive string
+		output    string
 	}{
 		{
-			name:          "proc",
-			noMount:       "proc",
-			noMatch:       "on /proc",
-			testDefault:   true,
-			testContained: true,
-			exit:          1, // mount fails with exit code 1 when there is no `/proc`
-		},
-		{
-			name:          "sys",
-			noMount:       "sys",
-			noMatch:       "on /sys",
-			testDefault:   true,
-			testContained: true,
-			exit:          0,
-		},
-		{
-			name:          "dev",
-			noMount:       "dev",
-			noMatch:       "on /dev",
-			testDefault:   true,
-			testContained: true,
-			exit:          0,
-		},
-		{
-			name:          "devpts",
-			noMount:       "devpts",
-			noMatch:       "on /dev/pts",
-			testDefault:   false,
-			testContained: true,
-			exit:          0,
-		},
-		{
-			name:          "tmp",
-			noMount:       "tmp",
-			noMatch:       "on /tmp",
-			testDefault:   true,
-			testContained: true,
-			exit:          0,
-		},
-		{
-			name:          "home",
-			noMount:       "home",
-			noMatch:       "on /home",
-			testDefault:   true,
-			testContained: true,
-			exit:          0,
-			// run from / to avoid /home mount via CWD mount
-			cwd: "/",
-		},
-		{
-			// test by excluding both home and cwd without chdir
-			name:          "home,cwd",
-			noMount:       "home,cwd",
-			noMatch:       "on /home",
-			testDefault:   true,
-			testContained: true,
-			exit:          0,
-		},
-		{
-			// /srv is an LSB directory we should be able to rely on for our CWD test
-			name:        "cwd",
-			noMount:     "cwd",
-			noMatch:     "on /srv",
-			testDefault: true,
-			// CWD is never mounted with contain so --no-mount CWD doesn't have an effect,
-			// but let's verify it isn't mounted anyway.
-			testContained: true,
-			cwd:           "/srv",
-			exit:          0,
-		},
-		// /etc/hosts & /etc/localtime are default 'bind path' entries we should
-		// be able to disable by abs path. Although other 'bind path' entries
-		// are ignored under '--contain' these two are handled specially in
-		// addBindsMount(), so make sure that `--no-mount` applies properly
-		// under contain also.
-		{
-			name:          "/etc/hosts",
-			noMount:       "/etc/hosts",
-			noMatch:       "on /etc/hosts",
-			testDefault:   true,
-			testContained: true,
-			exit:          0,
+			name:     "Hostname",
+			profiles: []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile, e2e.FakerootProfile, e2e.RootProfile},
+			args:     []string{"--hostname", "mycontainer"},
+			output:   "mycontainer\nmycontainer\nmycontainer\n" + hostDomainname + "\n127.0.1.1\tmycontainer",
 		},
-		{
-			name:          "/etc/localtime",
-			noMount:       "/etc/localtime",
-			noMatch:       "on /etc/localtime",
-			testDefault:   true,
-			testContained: true,
-			exit:          0,
+		{
+			name:     "Domainname",
+			profiles: []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile, e2e.FakerootProfile, e2e.RootProfile},
+			args:     []string{"--hostname", "mycontainer", "--domainname", "example.org"},
+			output:   "mycontainer\nmycontainer.example.org\nmycontainer\nexample.org\n127.0.1.1\tmycontainer.example.org mycontainer",
 		},
-		// bind-paths should disable all of the bind path mounts - including both defaults
 		{
-			name:          "binds-paths-hosts",
-			noMount:       "bind-paths",
-			noMatch:       "on /etc/hosts",
-			testDefault:   true,
-			testContained: true,
-			exit:          0,
+			name:     "ContainDomainname",
+			profiles: []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile},
+			args:     []string{"--contain", "--hostname", "mycontainer", "--domainname", "example.org"},
+			output:   "mycontainer\nmycontainer.example.org\nmycontainer\nexample.org\n127.0.1.1\tmycontainer.example.org mycontainer",
 		},
 		{
-			name:          "bind-paths-localtime",
-			noMount:       "bind-paths",
-			noMatch:       "on /etc/localtime",
-			testDefault:   true,
-			testContained: true,
-			exit:          0,
+			name:      "DirectiveHostname",
+			profiles:  []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile},
+			args:      []string{"--domainname", "example.org"},
+			directive: "%u-container",
+			output:    fmt.Sprintf("%[1]s-container\n%[1]s-container.example.org\n%[1]s-container\nexample.org\n127.0.1.1\t%[1]s-container.example.org %[1]s-container", user),
 		},
 	}
 
 	for _, tt := range tests {
-
-		if tt.testDefault {
+		for _, profile := range tt.profiles {
 			c.env.RunApptainer(
 				t,
-				e2e.WithDir(tt.cwd),
-				e2e.AsSubtest(tt.name),
-				e2e.WithProfile(e2e.UserProfile),
-				e2e.WithCommand("exec"),
-				e2e.WithArgs("--no-mount", tt.noMount, c.env.ImagePath, "mount"),
-				e2e.ExpectExit(tt.exit,
-					e2e.ExpectOutput(e2e.UnwantedContainMatch, tt.noMatch)),
-			)
-		}
-		if tt.testContained {
-			c.env.RunApptainer(
-				t,
-				e2e.WithDir(tt.cwd),
-				e2e.AsSubtest(tt.name+"Contained"),
-				e2e.WithProfile(e2e.UserProfile),
+				e2e.AsSubtest(tt.name+"/"+profile.String()),
+				e2e.WithProfile(profile),
+				e2e.PreRun(func(t *testing.T) {
+					if tt.directive != "" {
+						e2e.SetDirective(t, c.env, "container hostname", tt.directive)
+					}
+				}),
+				e2e.PostRun(func(t *testing.T) {
+					if tt.directive != "" {
+						e2e.ResetDirective(t, c.env, "container hostname")
+					}
+				}),
 				e2e.WithCommand("exec"),
-				e2e.WithArgs("--contain", "--no-mount", tt.noMount, c.env.ImagePath, "mount"),
-				e2e.ExpectExit(tt.exit,
-					e2e.ExpectOutput(e2e.UnwantedContainMatch, tt.noMatch)),
+				e2e.WithArgs(append(tt.args, c.env.ImagePath, "sh", "-c", script)...),
+				e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, tt.output)),
 			)
 		}
 	}
+
+	// the hostname of the directive overrides --hostname
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("DirectiveOverride"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.PreRun(func(t *testing.T) {
+			e2e.SetDirective(t, c.env, "container hostname", "forced")
+		}),
+		e2e.PostRun(func(t *testing.T) {
+			e2e.ResetDirective(t, c.env, "container hostname")
+		}),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--hostname", "mycontainer", c.env.ImagePath, "hostname"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ExactMatch, "forced"),
+			e2e.ExpectError(e2e.ContainMatch, "Ignoring --hostname mycontainer"),
+		),
+	)
+
+	instanceName := "hostname-instance"
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("instance/start"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--hostname", "myinstance", "--domainname", "example.org", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("instance/exec"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("instance://"+instanceName, "hostname", "-f"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, "myinstance.example.org")),
+	)
+	// joining the instance doesn't create a UTS namespace
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("instance/join-hostname"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--hostname", "other", "instance://"+instanceName, "hostname"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ExactMatch, "myinstance"),
+			e2e.ExpectError(e2e.ContainMatch, "no UTS namespace is created when joining an instance"),
+		),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("instance/stop"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
 }
 
-// actionCompat checks that the --compat flag sets up the expected environment
-// for improved oci/docker compatibility
-// Must be run in sequential section as it modifies host process umask.
-func (c actionTests) actionCompat(t *testing.T) {
+// actionImageFormats tests running the root filesystem from bare squashfs
+// and ext3 images and from tar archives, with the signer policy restricting
+// the formats allowed to run unsigned.
+func (c actionTests) actionImageFormats(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
 
-	type test struct {
-		name     string
-		args     []string
-		exitCode int
-		expect   e2e.ApptainerCmdResultOp
+	require.Command(t, "mksquashfs")
+	require.Command(t, "mkfs.ext3")
+	require.Command(t, "tar")
+	require.Command(t, "zstd")
+
+	testdir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "image-formats-", "")
+	defer e2e.Privileged(cleanup)(t)
+
+	sandbox := filepath.Join(testdir, "sandbox")
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--force", "--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+
+	images := map[string]string{
+		"squashfs": filepath.Join(testdir, "rootfs.squashfs"),
+		"ext3":     filepath.Join(testdir, "rootfs.ext3"),
+		"tar":      filepath.Join(testdir, "rootfs.tar"),
+		"tar.gz":   filepath.Join(testdir, "rootfs.tar.gz"),
+		// no extension, the format is detected from the content
+		"tar.zst": filepath.Join(testdir, "rootfs"),
+	}
+	cmds := [][]string{
+		{"mksquashfs", sandbox, images["squashfs"], "-noappend", "-all-root"},
+		{"mkfs.ext3", "-q", "-F", "-d", sandbox, images["ext3"], "256M"},
+		{"tar", "-C", sandbox, "-cf", images["tar"], "."},
+		{"tar", "-C", sandbox, "-czf", images["tar.gz"], "."},
+		{"tar", "-C", sandbox, "-I", "zstd", "-cf", images["tar.zst"], "."},
+	}
+	for _, args := range cmds {
+		cmd := exec.Command(args[0], args[1:]...)
+		if res := cmd.Run(t); res.Error != nil {
+			t.Fatalf("Unexpected error while running command.\n%s", res)
+		}
 	}
 
-	tests := []test{
+	for _, format := range []string{"squashfs", "ext3", "tar", "tar.gz", "tar.zst"} {
+		profiles := []e2e.Profile{e2e.UserProfile}
+		// tar archives are extracted without privileges in any case
+		if strings.HasPrefix(format, "tar") {
+			profiles = append(profiles, e2e.UserNamespaceProfile)
+		}
+		for _, profile := range profiles {
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest(format+"/"+profile.String()),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs(images[format], "test", "-x", "/bin/sh"),
+				e2e.ExpectExit(0),
+			)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		unsigned   string
+		expectExit int
+		expectOp   e2e.ApptainerCmdResultOp
+	}{
 		{
-			name:     "containall",
-			args:     []string{"--compat", c.env.ImagePath, "sh", "-c", "ls -lah $HOME"},
-			exitCode: 0,
-			expect:   e2e.ExpectOutput(e2e.ContainMatch, "total 0"),
+			name:       "TarWritableTmpfs",
+			args:       []string{"--writable-tmpfs", images["tar.gz"], "touch", "/file"},
+			expectExit: 0,
 		},
 		{
-			name:     "writable-tmpfs",
-			args:     []string{"--compat", c.env.ImagePath, "sh", "-c", "touch /test"},
-			exitCode: 0,
+			name:       "TarBind",
+			args:       []string{"--bind", testdir + ":/mnt", images["tar.gz"], "test", "-d", "/mnt/sandbox"},
+			expectExit: 0,
 		},
 		{
-			name:     "no-init",
-			args:     []string{"--compat", c.env.ImagePath, "sh", "-c", "ps"},
-			exitCode: 0,
-			expect:   e2e.ExpectOutput(e2e.UnwantedContainMatch, "appinit"),
+			name:       "TarWritable",
+			args:       []string{"--writable", images["tar.gz"], "true"},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "can't be used with --writable"),
 		},
 		{
-			name:     "no-umask",
-			args:     []string{"--compat", c.env.ImagePath, "sh", "-c", "umask"},
-			exitCode: 0,
-			expect:   e2e.ExpectOutput(e2e.ContainMatch, "0022"),
+			name:       "TarUnsignedRefused",
+			args:       []string{images["tar.gz"], "true"},
+			unsigned:   "sandbox",
+			expectExit: 249,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "refused by the signer policy"),
+		},
+		{
+			name:       "TarUnsignedAllowed",
+			args:       []string{images["tar.gz"], "true"},
+			unsigned:   "sandbox, tar",
+			expectExit: 0,
+		},
+		{
+			name:       "SquashfsUnsignedRefused",
+			args:       []string{images["squashfs"], "true"},
+			unsigned:   "sandbox, tar",
+			expectExit: 249,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "refused by the signer policy"),
+		},
+		{
+			name:       "Ext3UnsignedAllowed",
+			args:       []string{images["ext3"], "true"},
+			unsigned:   "ext3",
+			expectExit: 0,
 		},
 	}
 
-	oldUmask := syscall.Umask(0)
-	defer syscall.Umask(oldUmask)
-
 	for _, tt := range tests {
 		c.env.RunApptainer(
 			t,
 			e2e.AsSubtest(tt.name),
 			e2e.WithProfile(e2e.UserProfile),
+			e2e.PreRun(func(t *testing.T) {
+				if tt.unsigned != "" {
+					e2e.SetDirective(t, c.env, "require signed images", "yes")
+					e2e.SetDirective(t, c.env, "allow unsigned formats", tt.unsigned)
+				}
+			}),
+			e2e.PostRun(func(t *testing.T) {
+				if tt.unsigned != "" {
+					e2e.ResetDirective(t, c.env, "require signed images")
+					e2e.ResetDirective(t, c.env, "allow unsigned formats")
+				}
+			}),
 			e2e.WithCommand("exec"),
 			e2e.WithArgs(tt.args...),
-			e2e.ExpectExit(
-				tt.exitCode,
-				tt.expect,
-			),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
 		)
 	}
 }
 
-// actionFakerootHome verifies that home dir is /root with --fakeroot
-// (see: https://github.com/apptainer/apptainer/issues/618)
-func (c actionTests) actionFakerootHome(t *testing.T) {
+// actionConvertPolicy tests the signer policy with SIF images converted to
+// a temporary sandbox with --unsquash: the SIF image is checked rather than
+// the sandbox, which is checked too in setuid mode as it's writable by the
+// user.
+func (c actionTests) actionConvertPolicy(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
 
-	type test struct {
-		name     string
-		args     []string
-		exitCode int
-		expect   e2e.ApptainerCmdResultOp
-	}
+	testdir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "signed-unsquash-", "")
+	defer e2e.Privileged(cleanup)(t)
 
-	tests := []test{
-		{
-			name:     "fakeroot --with-suid",
-			args:     []string{c.env.ImagePath, "sh", "-c", "echo $HOME"},
-			exitCode: 0,
-			expect:   e2e.ExpectOutput(e2e.ExactMatch, "/root"),
-		},
-		{
-			name:     "fakeroot --without-suid",
-			args:     []string{"--userns", c.env.ImagePath, "sh", "-c", "echo $HOME"},
-			exitCode: 0,
-			expect:   e2e.ExpectOutput(e2e.ExactMatch, "/root"),
-		},
-	}
+	keysDir, _ := e2e.MakeKeysDir(t, testdir)
+	c.env.KeyringDir = keysDir
 
-	for _, tt := range tests {
+	signed := filepath.Join(testdir, "signed.sif")
+	unsigned := filepath.Join(testdir, "unsigned.sif")
+	for _, img := range []string{signed, unsigned} {
 		c.env.RunApptainer(
 			t,
-			e2e.AsSubtest(tt.name),
-			e2e.WithProfile(e2e.FakerootProfile),
-			e2e.WithCommand("exec"),
-			e2e.WithArgs(tt.args...),
-			e2e.ExpectExit(
-				tt.exitCode,
-				tt.expect,
-			),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs(img, c.env.ImagePath),
+			e2e.ExpectExit(0),
 		)
 	}
-}
-
-// Make sure --workdir and --scratch work together nicely even when workdir is a
-// relative path. Test needs to be run in non-parallel mode, because it changes
-// the current working directory of the host.
-func (c actionTests) relWorkdirScratch(t *testing.T) {
-	e2e.EnsureImage(t, c.env)
-
-	testdir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "persistent-overlay-", "")
-	t.Cleanup(func() {
-		if !t.Failed() {
-			e2e.Privileged(cleanup)
-		}
-	})
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key import"),
+		e2e.WithArgs("testdata/ecl-pgpkeys/key1.asc"),
+		e2e.ConsoleRun(e2e.ConsoleSendLine("e2e")),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("sign"),
+		e2e.WithArgs("-k", "0", signed),
+		e2e.ConsoleRun(e2e.ConsoleSendLine("e2e")),
+		e2e.ExpectExit(0),
+	)
 
-	const subdirName string = "mysubdir"
-	if err := os.Mkdir(filepath.Join(testdir, subdirName), 0o777); err != nil {
-		t.Fatalf("could not create subdirectory %q in %q: %s", subdirName, testdir, err)
+	// the trusted keys directory must be owned by root in setuid mode
+	trustedDir := filepath.Join(testdir, "trusted")
+	if err := os.Mkdir(trustedDir, 0o755); err != nil {
+		t.Fatal(err)
 	}
-
-	// Change current working directory, with deferred undoing of change.
-	prevCwd, err := os.Getwd()
+	key, err := os.ReadFile("testdata/ecl-pgpkeys/pubkey1.asc")
 	if err != nil {
-		t.Fatalf("could not get current working directory: %s", err)
+		t.Fatal(err)
 	}
-	defer os.Chdir(prevCwd)
-	if err = os.Chdir(testdir); err != nil {
-		t.Fatalf("could not change cwd to %q: %s", testdir, err)
+	if err := os.WriteFile(filepath.Join(trustedDir, "pubkey1.asc"), key, 0o644); err != nil {
+		t.Fatal(err)
 	}
+	e2e.Privileged(func(t *testing.T) {
+		if err := os.Chown(trustedDir, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	})(t)
 
-	profiles := []e2e.Profile{e2e.UserProfile, e2e.RootProfile, e2e.FakerootProfile, e2e.UserNamespaceProfile}
+	tests := []struct {
+		name       string
+		profile    e2e.Profile
+		image      string
+		unsigned   string
+		expectExit int
+		expectOp   e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:       "SignedUserNamespace",
+			profile:    e2e.UserNamespaceProfile,
+			image:      signed,
+			expectExit: 0,
+		},
+		{
+			name:       "UnsignedUserNamespace",
+			profile:    e2e.UserNamespaceProfile,
+			image:      unsigned,
+			unsigned:   "sandbox",
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "refused by the signer policy"),
+		},
+		{
+			name:       "SignedSetuid",
+			profile:    e2e.UserProfile,
+			image:      signed,
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "not allowed unsigned in setuid mode"),
+		},
+		{
+			name:       "SignedSetuidSandboxAllowed",
+			profile:    e2e.UserProfile,
+			image:      signed,
+			unsigned:   "sandbox",
+			expectExit: 0,
+		},
+		{
+			name:       "UnsignedSetuid",
+			profile:    e2e.UserProfile,
+			image:      unsigned,
+			unsigned:   "sandbox",
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "refused by the signer policy"),
+		},
+	}
 
-	for _, p := range profiles {
+	for _, tt := range tests {
 		c.env.RunApptainer(
 			t,
-			e2e.AsSubtest(p.String()),
-			e2e.WithProfile(p),
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.PreRun(func(t *testing.T) {
+				e2e.SetDirective(t, c.env, "require signed images", "yes")
+				e2e.SetDirective(t, c.env, "trusted signers", "@"+trustedDir)
+				if tt.unsigned != "" {
+					e2e.SetDirective(t, c.env, "allow unsigned formats", tt.unsigned)
+				}
+			}),
+			e2e.PostRun(func(t *testing.T) {
+				e2e.ResetDirective(t, c.env, "require signed images")
+				e2e.ResetDirective(t, c.env, "trusted signers")
+				e2e.ResetDirective(t, c.env, "allow unsigned formats")
+			}),
 			e2e.WithCommand("exec"),
-			e2e.WithArgs("--contain", "--workdir", "./"+subdirName, "--scratch", "/myscratch", c.env.ImagePath, "true"),
-			e2e.ExpectExit(0),
+			e2e.WithArgs("--unsquash", tt.image, "true"),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
 		)
 	}
 }
@@ -2932,16 +5383,41 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"issue 6165":                   c.issue6165,               // https://github.com/apptainer/singularity/issues/6165
 		"issue 619":                    c.issue619,                // https://github.com/apptainer/apptainer/issues/619
 		"network":                      c.actionNetwork,           // test basic networking
+		"network none":                 c.actionNetworkNone,       // test --network=none isolation
+		"network ipv6":                 c.actionNetworkIPv6,       // test dual-stack bridge networking
+		"network args":                 c.actionNetworkArgs,       // test --network-args validation
+		"network dns":                  np(c.actionNetworkDNS),    // test CNI DNS in resolv.conf
+		"sessiondir":                   c.actionSessionDir,        // test --sessiondir and --sessiondir-size
+		"nested":                       c.actionNested,            // test apptainer inside apptainer
+		"nested fakeroot":              c.actionNestedFakeroot,    // test --fakeroot inside --fakeroot
+		"idmap mount":                  c.actionIDMapMount,        // test ID-mapped binds and overlay directories
+		"fakeroot db":                  c.actionFakerootDB,        // test --fakeroot-db keeps the ownership in a sandbox
+		"timezone":                     c.actionTimezone,          // test --tz and --keep-locale
+		"read-only root":               c.actionReadOnlyRoot,      // test --read-only-root and --writable-path
+		"dry run":                      c.actionDryRun,            // test --dry-run
+		"startup errors":               c.actionStartupErrors,     // test error records of startup failures
 		"binds":                        c.actionBinds,             // test various binds with --bind and --mount
 		"exit and signals":             c.exitSignals,             // test exit and signals propagation
+		"startup signals":              np(c.startupSignals),      // test signals received during the container startup
 		"fuse mount":                   c.fuseMount,               // test fusemount option
 		"bind image":                   c.bindImage,               // test bind image with --bind and --mount
 		"unsquash":                     c.actionUnsquash,          // test --unsquash
 		"no-mount":                     c.actionNoMount,           // test --no-mount
 		"compat":                       np(c.actionCompat),        // test --compat
 		"umask":                        np(c.actionUmask),         // test umask propagation
+		"umask groups":                 np(c.actionUmaskGroups),   // test --umask, --groups and 'container umask'
 		"invalidRemote":                np(c.invalidRemote),       // GHSA-5mv9-q7fq-9394
 		"fakeroot home":                c.actionFakerootHome,      // test home dir in fakeroot
+		"fakeroot check":               c.actionFakerootCheck,     // test fakeroot --check
 		"relWorkdirScratch":            np(c.relWorkdirScratch),   // test relative --workdir with --scratch
+		"stdin image":                  c.actionStdinImage,        // test reading the image from stdin with "-"
+		"bind propagation":             np(c.bindPropagation),     // test per-bind mount propagation
+		"fs mounts":                    np(c.actionFSMounts),      // test tmpfs and devpts mounts with --mount and --shm-size
+		"pty":                          c.actionPty,               // test --pty window size, signals and terminal restoration
+		"limited fs":                   np(c.actionLimitedFs),     // test images on a FUSE filesystem without memory mapping support
+		"image formats":                np(c.actionImageFormats),  // test squashfs, ext3 and tar archive images with the signer policy
+		"signed unsquash":              np(c.actionConvertPolicy), // test the signer policy of SIF images converted with --unsquash
+		"time namespace":               np(c.actionTimeNamespace), // test --time-offset with /proc/uptime and instances
+		"hostname":                     np(c.actionHostname),      // test --hostname and --domainname with /etc/hostname and /etc/hosts
 	}
 }
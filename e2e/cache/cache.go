@@ -18,6 +18,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
@@ -92,6 +93,49 @@ func (c cacheTests) testNoninteractiveCacheCmds(t *testing.T) {
 			expectedEmptyCache: true,
 			exit:               0,
 		},
+		{
+			name:               "clean force age within",
+			options:            []string{"clean", "--force", "--age", "30d"},
+			needImage:          true,
+			expectedEmptyCache: false,
+			exit:               0,
+		},
+		{
+			name:               "clean force larger than",
+			options:            []string{"clean", "--force", "--larger-than", "1K"},
+			needImage:          true,
+			expectedEmptyCache: true,
+			exit:               0,
+		},
+		{
+			name:               "clean force name",
+			options:            []string{"clean", "--force", "--name", "http://*"},
+			needImage:          true,
+			expectedEmptyCache: true,
+			exit:               0,
+		},
+		{
+			name:               "clean force name no match",
+			options:            []string{"clean", "--force", "--name", "docker://*"},
+			needImage:          true,
+			expectedEmptyCache: false,
+			exit:               0,
+		},
+		{
+			name:               "clean dry-run report",
+			options:            []string{"clean", "--dry-run", "--type", "net"},
+			needImage:          true,
+			expectedOutput:     "Would remove 1 cache entries",
+			expectedEmptyCache: false,
+			exit:               0,
+		},
+		{
+			name:           "clean invalid age",
+			options:        []string{"clean", "--force", "--age", "30x"},
+			needImage:      false,
+			expectedOutput: "",
+			exit:           255,
+		},
 		{
 			name:           "clean help",
 			options:        []string{"clean", "--help"},
@@ -122,6 +166,14 @@ func (c cacheTests) testNoninteractiveCacheCmds(t *testing.T) {
 			expectedEmptyCache: false,
 			exit:               0,
 		},
+		{
+			name:               "list json",
+			needImage:          true,
+			options:            []string{"list", "--type", "all", "--json"},
+			expectedOutput:     `"source": "http://`,
+			expectedEmptyCache: false,
+			exit:               0,
+		},
 	}
 	// A directory where we store the image and used by separate commands
 	tempDir, imgStoreCleanup := e2e.MakeTempDir(t, "", "", "image store")
@@ -151,11 +203,13 @@ func (c cacheTests) testNoninteractiveCacheCmds(t *testing.T) {
 			e2e.WithProfile(e2e.UserProfile),
 			e2e.WithCommand("cache"),
 			e2e.WithArgs(tt.options...),
-			e2e.ExpectExit(tt.exit),
+			e2e.ExpectExit(tt.exit, e2e.ExpectOutput(e2e.ContainMatch, tt.expectedOutput)),
 		)
 
 		if tt.needImage && tt.expectedEmptyCache {
 			ensureNotCached(t, tt.name, imageURL, cacheDir)
+		} else if tt.needImage {
+			ensureCached(t, tt.name, imageURL, cacheDir)
 		}
 	}
 }
@@ -461,6 +515,284 @@ func (c cacheTests) testMultipleArch(t *testing.T) {
 	}
 }
 
+// testCacheMaxSize checks the least recently used entries are evicted to
+// stay under the maximum size of the cache.
+func (c cacheTests) testCacheMaxSize(t *testing.T) {
+	tempDir, tempCleanup := e2e.MakeTempDir(t, "", "", "cache max size")
+	defer tempCleanup(t)
+	imagePath := filepath.Join(tempDir, imgName)
+
+	cacheDir, cleanup := e2e.MakeCacheDir(t, "")
+	defer cleanup(t)
+	c.env.UnprivCacheDir = cacheDir
+
+	fi, err := os.Stat(c.env.ImagePath)
+	if err != nil {
+		t.Fatalf("Could not stat test image: %v", err)
+	}
+	// room for a single image
+	maxSize := fmt.Sprintf("APPTAINER_CACHE_MAX_SIZE=%d", fi.Size()*3/2)
+
+	var urls []string
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, c.env.ImagePath)
+		}))
+		defer srv.Close()
+		urls = append(urls, srv.URL)
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("pull first"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithEnv([]string{maxSize}),
+		e2e.WithCommand("pull"),
+		e2e.WithArgs("--force", imagePath, urls[0]),
+		e2e.ExpectExit(0),
+	)
+	ensureCached(t, "pull first", urls[0], cacheDir)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("pull second evicts first"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithEnv([]string{maxSize}),
+		e2e.WithCommand("pull"),
+		e2e.WithArgs("--force", imagePath, urls[1]),
+		e2e.ExpectExit(0, e2e.ExpectError(e2e.ContainMatch, "Evicted net cache entry")),
+	)
+	ensureNotCached(t, "pull second evicts first", urls[0], cacheDir)
+	ensureCached(t, "pull second evicts first", urls[1], cacheDir)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("list quota"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithEnv([]string{maxSize}),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("list"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ContainMatch, "Cache quota:")),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("pull larger than max size"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithEnv([]string{"APPTAINER_CACHE_MAX_SIZE=1K"}),
+		e2e.WithCommand("pull"),
+		e2e.WithArgs("--force", imagePath, urls[0]),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "larger than the maximum cache size")),
+	)
+	ensureNotCached(t, "pull larger than max size", urls[0], cacheDir)
+	ensureCached(t, "pull larger than max size", urls[1], cacheDir)
+}
+
+// testConcurrentPulls checks concurrent pulls of the same image download
+// it only once, the other pulls waiting for it and using its cache entry.
+func (c cacheTests) testConcurrentPulls(t *testing.T) {
+	const pulls = 8
+
+	tempDir, tempCleanup := e2e.MakeTempDir(t, "", "", "concurrent pulls")
+	defer tempCleanup(t)
+
+	cacheDir, cleanup := e2e.MakeCacheDir(t, "")
+	defer cleanup(t)
+	c.env.UnprivCacheDir = cacheDir
+
+	var downloads int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&downloads, 1)
+		}
+		http.ServeFile(w, r, c.env.ImagePath)
+	}))
+	defer srv.Close()
+
+	t.Run("pulls", func(t *testing.T) {
+		for i := 0; i < pulls; i++ {
+			imagePath := filepath.Join(tempDir, fmt.Sprintf("image%d.sif", i))
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest(fmt.Sprintf("pull%d", i)),
+				e2e.WithProfile(e2e.UserProfile),
+				e2e.WithCommand("pull"),
+				e2e.WithArgs(imagePath, srv.URL),
+				e2e.PreRun(func(t *testing.T) {
+					t.Parallel()
+				}),
+				e2e.ExpectExit(0),
+			)
+		}
+	})
+
+	if n := atomic.LoadInt32(&downloads); n != 1 {
+		t.Errorf("image downloaded %d times by %d concurrent pulls, expected once", n, pulls)
+	}
+	ensureCached(t, "concurrent pulls", srv.URL, cacheDir)
+}
+
+// testExportImport exports the cache to an archive, imports it into a
+// fresh cache and builds from it without network access.
+func (c cacheTests) testExportImport(t *testing.T) {
+	tempDir, tempCleanup := e2e.MakeTempDir(t, "", "", "cache export")
+	defer tempCleanup(t)
+	archive := filepath.Join(tempDir, "cache.tar.zst")
+
+	srcCacheDir, srcCleanup := e2e.MakeCacheDir(t, "")
+	defer srcCleanup(t)
+	c.env.UnprivCacheDir = srcCacheDir
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("build to cache"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--no-https", filepath.Join(tempDir, "online.sif"), c.env.TestRegistryImage),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("export"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache export"),
+		e2e.WithArgs("--type", "oci-blob,oci-tmp,library", archive),
+		e2e.ExpectExit(0, e2e.ExpectError(e2e.ContainMatch, "Exported")),
+	)
+
+	destCacheDir, destCleanup := e2e.MakeCacheDir(t, "")
+	defer destCleanup(t)
+	c.env.UnprivCacheDir = destCacheDir
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("offline build not cached"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithGlobalOptions("--offline"),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--no-https", filepath.Join(tempDir, "missing.sif"), c.env.TestRegistryImage),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "is not in the cache")),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("import"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache import"),
+		e2e.WithArgs(archive),
+		e2e.ExpectExit(0, e2e.ExpectError(e2e.ContainMatch, "skipped 0 already in the cache")),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("import again"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache import"),
+		e2e.WithArgs(archive),
+		e2e.ExpectExit(0, e2e.ExpectError(e2e.ContainMatch, "Imported 0 cache entries")),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("offline build"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithGlobalOptions("--offline"),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--no-https", filepath.Join(tempDir, "offline.sif"), c.env.TestRegistryImage),
+		e2e.ExpectExit(0),
+	)
+}
+
+// testVerify corrupts a cache entry and checks cache verify reports and
+// removes it.
+func (c cacheTests) testVerify(t *testing.T) {
+	tempDir, tempCleanup := e2e.MakeTempDir(t, "", "", "cache verify")
+	defer tempCleanup(t)
+
+	cacheDir, cleanup := e2e.MakeCacheDir(t, "")
+	defer cleanup(t)
+
+	imageURL, srvCleanup := prepTest(t, c.env, "cache verify", cacheDir, filepath.Join(tempDir, imgName))
+	defer srvCleanup()
+	c.env.UnprivCacheDir = cacheDir
+
+	shasum, err := netHash(imageURL)
+	if err != nil {
+		t.Fatalf("couldn't compute hash of image %s: %v", imageURL, err)
+	}
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("valid"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache verify"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ContainMatch, "0 corrupted")),
+	)
+
+	cachedImage := filepath.Join(cacheDir, "cache", "net", shasum)
+	f, err := os.OpenFile(cachedImage, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("could not open %s: %v", cachedImage, err)
+	}
+	if _, err := f.WriteAt([]byte("corrupted"), 4096); err != nil {
+		t.Fatalf("could not corrupt %s: %v", cachedImage, err)
+	}
+	f.Close()
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("corrupted"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache verify"),
+		e2e.ExpectExit(255,
+			e2e.ExpectError(e2e.ContainMatch, "Corrupted net cache entry "+shasum+" from "+imageURL),
+		),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("json"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache verify"),
+		e2e.WithArgs("--json", "--type", "net"),
+		e2e.ExpectExit(255, e2e.ExpectOutput(e2e.ContainMatch, `"error": "digest is`)),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("delete corrupt"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache verify"),
+		e2e.WithArgs("--delete-corrupt"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ContainMatch, "1 corrupted, 1 removed")),
+	)
+	ensureNotCached(t, "cache verify", imageURL, cacheDir)
+}
+
+func (c cacheTests) testDedup(t *testing.T) {
+	tempDir, tempCleanup := e2e.MakeTempDir(t, "", "", "cache dedup")
+	defer tempCleanup(t)
+
+	cacheDir, cleanup := e2e.MakeCacheDir(t, "")
+	defer cleanup(t)
+
+	imageURL, srvCleanup := prepTest(t, c.env, "cache dedup", cacheDir, filepath.Join(tempDir, imgName))
+	defer srvCleanup()
+	c.env.UnprivCacheDir = cacheDir
+
+	// the server serves the same image at any URL, cached as another entry
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("pull duplicate"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("pull"),
+		e2e.WithArgs("--force", filepath.Join(tempDir, "copy.sif"), imageURL+"/copy"),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("dry run"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache dedup"),
+		e2e.WithArgs("--dry-run"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ContainMatch, "Found 1 duplicate files among 2 cache files")),
+	)
+}
+
 // ensureNotCached checks the entry related to an image is not in the cache
 func ensureNotCached(t *testing.T, testName string, imageURL string, cacheParentDir string) {
 	shasum, err := netHash(imageURL)
@@ -548,5 +880,10 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"issue5097":                np(c.issue5097),
 		"issue5350":                np(c.issue5350),
 		"test multiple archs":      np(c.testMultipleArch),
+		"cache max size":           np(c.testCacheMaxSize),
+		"concurrent pulls":         np(c.testConcurrentPulls),
+		"export import":            np(c.testExportImport),
+		"verify":                   np(c.testVerify),
+		"dedup":                    np(c.testDedup),
 	}
 }
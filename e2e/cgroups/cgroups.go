@@ -11,6 +11,10 @@ package cgroups
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"syscall"
 	"testing"
 
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
@@ -97,12 +101,27 @@ func (c *ctx) instanceStats(t *testing.T, profile e2e.Profile) {
 					e2e.ExpectOutput(e2e.ContainMatch, "BLOCK I/O"),
 					e2e.ExpectOutput(e2e.ContainMatch, "PIDS"),
 					e2e.ExpectOutput(e2e.ContainMatch, "PIDS"),
+					e2e.ExpectOutput(e2e.ContainMatch, "OOM KILLS"),
+					e2e.ExpectOutput(e2e.ContainMatch, "MEM PSI SOME / FULL"),
 					// Instance name is visible
 					e2e.ExpectOutput(e2e.ContainMatch, instanceName),
 					// Memory limit is visible
 					e2e.ExpectOutput(e2e.ContainMatch, "/ 250MiB"),
 				),
 			)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("stats json"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("instance stats"),
+				e2e.WithArgs("--json", "--no-stream", instanceName),
+				e2e.ExpectExit(tt.statsErrorCode,
+					e2e.ExpectOutput(e2e.ContainMatch, `"instance": "`+instanceName+`"`),
+					e2e.ExpectOutput(e2e.ContainMatch, `"cpu_time_ns"`),
+					e2e.ExpectOutput(e2e.ContainMatch, `"memory_current_bytes"`),
+					e2e.ExpectOutput(e2e.ContainMatch, `"pids"`),
+				),
+			)
 			c.env.RunApptainer(
 				t,
 				e2e.AsSubtest("stop"),
@@ -724,6 +743,298 @@ func (c *ctx) instanceFlagsRootless(t *testing.T) {
 }
 
 // E2ETests is the main func to trigger the test suite
+// oomEvents tests the reporting of OOM kills with a small memory limit
+// and an allocation exceeding it
+func (c *ctx) oomEvents(t *testing.T, profile e2e.Profile) {
+	e2e.EnsureImage(t, c.env)
+	require.CgroupsV2Unified(t)
+	if !profile.Privileged() {
+		require.CgroupsV2Delegated(t, "memory")
+	}
+
+	// tail buffers its whole input when there is no newline
+	stress := []string{"/bin/sh", "-c", "head -c 256m /dev/zero | tail"}
+	limits := []string{"--memory", "32M", "--memory-swap", "32M"}
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("exec"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(append(append(limits, c.env.ImagePath), stress...)...),
+		e2e.ExpectExit(137,
+			e2e.ExpectError(e2e.ContainMatch, "Container was OOM-killed after reaching its 32MiB limit"),
+		),
+	)
+
+	instanceName := randomName(t)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("start"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs(append(limits, c.env.ImagePath, instanceName)...),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("stress"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(append([]string{"instance://" + instanceName}, stress...)...),
+		e2e.ExpectExit(137),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("events"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("instance events"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0,
+			e2e.ExpectOutput(e2e.RegexMatch, `oom_kill=[1-9]`),
+			e2e.ExpectOutput(e2e.ContainMatch, "psi_some_avg10="),
+		),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("stats"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("instance stats"),
+		e2e.WithArgs("--json", "--no-stream", instanceName),
+		e2e.ExpectExit(0,
+			e2e.ExpectOutput(e2e.RegexMatch, `"oom_kill": [1-9]`),
+			e2e.ExpectOutput(e2e.ContainMatch, `"memory_pressure"`),
+		),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("stop"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
+}
+
+// pidsForkBomb checks that a pids limit is in effect as soon as the
+// payload starts, a bounded fork bomb must hit the limit.
+func (c *ctx) pidsForkBomb(t *testing.T, profile e2e.Profile) {
+	e2e.EnsureImage(t, c.env)
+	if !profile.Privileged() {
+		require.CgroupsV2Unified(t)
+		require.CgroupsV2Delegated(t, "pids")
+	}
+
+	// the shell aborts with an error status when it can't fork
+	bomb := "n=0; while [ $n -lt 64 ]; do sleep 1 & n=$((n+1)); done; wait"
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(profile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--pid", "--pids-limit", "16", c.env.ImagePath, "/bin/sh", "-c", bomb),
+		e2e.ExpectExitIn([]int{1, 2},
+			e2e.ExpectError(e2e.ContainMatch, "can't fork"),
+		),
+	)
+}
+
+// instanceUpdate tests updating the resource limits of a running instance
+func (c *ctx) instanceUpdate(t *testing.T, profile e2e.Profile) {
+	e2e.EnsureImage(t, c.env)
+	require.CgroupsV2Unified(t)
+	if !profile.Privileged() {
+		require.CgroupsV2Delegated(t, "memory")
+		require.CgroupsV2Delegated(t, "pids")
+	}
+
+	instanceName := randomName(t)
+	joinName := "instance://" + instanceName
+	shellCmd := "cd /sys/fs/cgroup$(cat /proc/self/cgroup | grep '^0::' | cut -d ':' -f 3) && cat memory.max pids.max"
+
+	instancePid := func(t *testing.T) (pid string) {
+		c.env.RunApptainer(
+			t,
+			e2e.WithProfile(profile),
+			e2e.WithCommand("instance list"),
+			e2e.WithArgs("--json", instanceName),
+			e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+				m := regexp.MustCompile(`"pid": (\d+)`).FindStringSubmatch(string(r.Stdout))
+				if m == nil {
+					t.Errorf("no pid found for instance %s", instanceName)
+					return
+				}
+				pid = m[1]
+			}),
+		)
+		return pid
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("start"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--memory", "512M", "--pids-limit", "1024", "-B", "/sys/fs/cgroup", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+	pid := instancePid(t)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("update"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("instance update"),
+		e2e.WithArgs("--memory", "1G", "--pids-limit", "4096", instanceName),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("check"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(joinName, "/bin/sh", "-c", shellCmd),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, "1073741824\n4096")),
+	)
+	if newPid := instancePid(t); newPid != pid {
+		t.Errorf("instance restarted by update: PID %s, was %s", newPid, pid)
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("update below usage"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("instance update"),
+		e2e.WithArgs("--memory", "4k", instanceName),
+		e2e.ExpectExit(0, e2e.ExpectError(e2e.ContainMatch, "is below the current memory usage")),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("no limits"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("instance update"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "No resource limits to update")),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("stop"),
+		e2e.WithProfile(profile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
+}
+
+func (c *ctx) instanceUpdateRoot(t *testing.T) {
+	c.instanceUpdate(t, e2e.RootProfile)
+}
+
+func (c *ctx) instanceUpdateRootless(t *testing.T) {
+	c.instanceUpdate(t, e2e.UserProfile)
+}
+
+func (c *ctx) oomEventsRoot(t *testing.T) {
+	c.oomEvents(t, e2e.RootProfile)
+}
+
+func (c *ctx) oomEventsRootless(t *testing.T) {
+	c.oomEvents(t, e2e.UserProfile)
+}
+
+func (c *ctx) pidsForkBombRoot(t *testing.T) {
+	c.pidsForkBomb(t, e2e.RootProfile)
+}
+
+func (c *ctx) pidsForkBombRootless(t *testing.T) {
+	c.pidsForkBomb(t, e2e.UserProfile)
+}
+
+// jobCgroupNotDelegated tests that exec, run and instance start with
+// --cgroups join-job run gracefully without a container cgroup when the
+// cgroup they are started in isn't delegated to the user, as the
+// root-owned cgroup of the e2e tests is for the unprivileged user.
+func (c *ctx) jobCgroupNotDelegated(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	require.CgroupsV2Unified(t)
+
+	paths, err := cgroups.ParseCgroupFile("/proc/self/cgroup")
+	if err != nil {
+		t.Fatalf("while reading current cgroup: %s", err)
+	}
+	fi, err := os.Stat(filepath.Join("/sys/fs/cgroup", paths[""]))
+	if err != nil {
+		t.Fatalf("while reading current cgroup: %s", err)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); !ok || st.Uid != 0 {
+		t.Skipf("current cgroup %s is not owned by root", paths[""])
+	}
+
+	notDelegated := e2e.ExpectError(e2e.ContainMatch, "Not creating a container cgroup beneath the job cgroup")
+	noLimits := e2e.ExpectError(e2e.ContainMatch, "Resource limits will not be applied")
+
+	for _, cmd := range []string{"exec", "run"} {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(cmd),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand(cmd),
+			e2e.WithArgs("--cgroups", "join-job", "--memory", "250M", c.env.ImagePath, "/bin/true"),
+			e2e.ExpectExit(0, notDelegated, noLimits),
+		)
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("none"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--cgroups", "none", "--memory", "250M", c.env.ImagePath, "/bin/true"),
+		e2e.ExpectExit(0, e2e.ExpectError(e2e.UnwantedContainMatch, "cgroup")),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("invalid"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--cgroups", "join", c.env.ImagePath, "/bin/true"),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, `invalid cgroups mode "join"`)),
+	)
+
+	instanceName := randomName(t)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("instance start"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--cgroups", "join-job", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0, notDelegated),
+	)
+	// the stats are those of the job cgroup the instance stays in
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("instance stats"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("instance stats"),
+		e2e.WithArgs("--json", "--no-stream", instanceName),
+		e2e.ExpectExit(0,
+			e2e.ExpectOutput(e2e.ContainMatch, `"instance": "`+instanceName+`"`),
+			e2e.ExpectOutput(e2e.ContainMatch, `"memory_current_bytes"`),
+		),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("instance stop"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
+}
+
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := &ctx{
 		env: env,
@@ -742,5 +1053,12 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"action rootless cgroups":         np(env.WithRootlessManagers(c.actionApplyRootless)),
 		"action flags root cgroups":       np(env.WithRootManagers(c.actionFlagsRoot)),
 		"action flags rootless cgroups":   np(env.WithRootlessManagers(c.actionFlagsRootless)),
+		"oom events root":                 np(env.WithRootManagers(c.oomEventsRoot)),
+		"oom events rootless":             np(env.WithRootlessManagers(c.oomEventsRootless)),
+		"instance update root":            np(env.WithRootManagers(c.instanceUpdateRoot)),
+		"instance update rootless":        np(env.WithRootlessManagers(c.instanceUpdateRootless)),
+		"pids fork bomb root":             np(env.WithRootManagers(c.pidsForkBombRoot)),
+		"pids fork bomb rootless":         np(env.WithRootlessManagers(c.pidsForkBombRootless)),
+		"job cgroup not delegated":        np(c.jobCgroupNotDelegated),
 	}
 }
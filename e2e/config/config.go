@@ -20,6 +20,7 @@ import (
 	"github.com/apptainer/apptainer/e2e/internal/testhelper"
 	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs/overlay"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
 )
 
@@ -32,6 +33,7 @@ type configTests struct {
 	ext3Image            string
 	ext3OverlayImage     string
 	sandboxImage         string
+	tarImage             string
 	pemPublic            string
 	pemPrivate           string
 }
@@ -106,6 +108,16 @@ func (c *configTests) prepImages(t *testing.T) (cleanup func(t *testing.T)) {
 		}
 	})
 
+	// A tar.gz archive of a root filesystem
+	t.Run("PrepareTar", func(t *testing.T) {
+		c.tarImage = filepath.Join(tmpDir, "rootfs.tar.gz")
+		cmd := exec.Command("tar", "-C", c.sandboxImage, "-czf", c.tarImage, ".")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			defer cleanup(t)
+			t.Fatalf("Error creating tar archive: %v: %s", err, out)
+		}
+	})
+
 	// An ext3 overlay embedded in a SIF
 	c.ext3OverlayImage = filepath.Join(tmpDir, "ext3Overlay.img")
 	if err := fs.CopyFile(c.sifImage, c.ext3OverlayImage, 0o755); err != nil {
@@ -143,6 +155,7 @@ func (c configTests) configGlobal(t *testing.T) {
 		profile           e2e.Profile
 		addRequirementsFn func(*testing.T)
 		cwd               string
+		env               []string
 		directive         string
 		directiveValue    string
 		exit              int
@@ -373,7 +386,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "limit container owners",
 			directiveValue: u.Name,
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "LimitContainerOwnersUserAndRoot",
@@ -389,7 +402,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "limit container groups",
 			directiveValue: g.Name,
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "LimitContainerGroupsUserAndRoot",
@@ -405,7 +418,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "limit container paths",
 			directiveValue: "/proc",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "LimitContainerPathsTestdir",
@@ -421,7 +434,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow container sif",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowContainerSifYes",
@@ -437,7 +450,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow container encrypted",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowContainerEncryptedYes",
@@ -453,7 +466,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow container squashfs",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowContainerSquashfsYes",
@@ -469,7 +482,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow container extfs",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowContainerExtfsYes",
@@ -485,7 +498,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow container dir",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowContainerDirYes",
@@ -495,6 +508,38 @@ func (c configTests) configGlobal(t *testing.T) {
 			directiveValue: "yes",
 			exit:           0,
 		},
+		{
+			name:           "AllowContainerDirNoTar",
+			argv:           []string{c.tarImage, "true"},
+			profile:        e2e.UserProfile,
+			directive:      "allow container dir",
+			directiveValue: "no",
+			exit:           249,
+		},
+		{
+			name:           "AllowContainerTarNo",
+			argv:           []string{c.tarImage, "true"},
+			profile:        e2e.UserProfile,
+			directive:      "allow container tar",
+			directiveValue: "no",
+			exit:           249,
+		},
+		{
+			name:           "AllowContainerTarNoUserns",
+			argv:           []string{c.tarImage, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "allow container tar",
+			directiveValue: "no",
+			exit:           249,
+		},
+		{
+			name:           "AllowContainerTarYes",
+			argv:           []string{c.tarImage, "true"},
+			profile:        e2e.UserProfile,
+			directive:      "allow container tar",
+			directiveValue: "yes",
+			exit:           0,
+		},
 		// NOTE: the "allow setuid-mount" tests have to stay after the
 		// "allow container" tests because they will be left in their
 		// default settings which can interfere with "allow container" tests.
@@ -504,7 +549,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow setuid-mount encrypted",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowSetuidMountEncryptedNoUserns",
@@ -528,7 +573,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow setuid-mount squashfs",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowSetuidMountSquashfsNoSif",
@@ -536,7 +581,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow setuid-mount squashfs",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowSetuidMountSquashfsNoBind",
@@ -544,7 +589,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow setuid-mount squashfs",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowSetuidMountSquashfsNoUserns",
@@ -600,7 +645,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow setuid-mount extfs",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowSetuidMountExtfsNoSif",
@@ -608,7 +653,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow setuid-mount extfs",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowSetuidMountExtfsNoBind",
@@ -616,7 +661,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			profile:        e2e.UserProfile,
 			directive:      "allow setuid-mount extfs",
 			directiveValue: "no",
-			exit:           255,
+			exit:           249,
 		},
 		{
 			name:           "AllowSetuidMountExtfsNoUserns",
@@ -666,6 +711,177 @@ func (c configTests) configGlobal(t *testing.T) {
 			directiveValue: "yes",
 			exit:           0,
 		},
+		{
+			name:           "EnforceReadOnlyRootUser",
+			argv:           []string{"--writable-tmpfs", c.sifImage, "touch", "/file"},
+			profile:        e2e.UserProfile,
+			directive:      "enforce read only root",
+			directiveValue: "yes",
+			exit:           1,
+			resultOp:       e2e.ExpectError(e2e.ContainMatch, "Read-only file system"),
+		},
+		{
+			name:           "EnforceReadOnlyRootUserWritable",
+			argv:           []string{"--writable", c.sandboxImage, "true"},
+			profile:        e2e.UserProfile,
+			directive:      "enforce read only root",
+			directiveValue: "yes",
+			exit:           255,
+		},
+		{
+			name:           "EnforceReadOnlyRootRoot",
+			argv:           []string{"--writable-tmpfs", c.sifImage, "touch", "/file"},
+			profile:        e2e.RootProfile,
+			directive:      "enforce read only root",
+			directiveValue: "yes",
+			exit:           0,
+		},
+		{
+			name:           "ImageMountDriverAuto",
+			argv:           []string{c.sifImage, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "image mount driver",
+			directiveValue: "auto",
+			exit:           0,
+			resultOp:       e2e.ExpectError(e2e.UnwantedContainMatch, "Converting SIF file to temporary sandbox"),
+		},
+		{
+			name:           "ImageMountDriverKernel",
+			argv:           []string{c.sifImage, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "image mount driver",
+			directiveValue: "kernel",
+			exit:           0,
+			resultOp:       e2e.ExpectError(e2e.ContainMatch, "Converting SIF file to temporary sandbox"),
+		},
+		{
+			name:           "ImageMountDriverKernelExtfs",
+			argv:           []string{c.ext3Image, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "image mount driver",
+			directiveValue: "kernel",
+			exit:           255,
+		},
+		{
+			name:           "ImageMountDriverKernelSetuid",
+			argv:           []string{c.sifImage, "true"},
+			profile:        e2e.UserProfile,
+			directive:      "image mount driver",
+			directiveValue: "kernel",
+			exit:           0,
+		},
+		{
+			name:           "ImageMountDriverSquashfuse",
+			argv:           []string{c.sifImage, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "image mount driver",
+			directiveValue: "squashfuse",
+			exit:           0,
+			resultOp:       e2e.ExpectError(e2e.UnwantedContainMatch, "Converting SIF file to temporary sandbox"),
+		},
+		{
+			name:           "ImageMountDriverSquashfuseExtfs",
+			argv:           []string{c.ext3Image, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "image mount driver",
+			directiveValue: "squashfuse",
+			exit:           255,
+			resultOp:       e2e.ExpectError(e2e.ContainMatch, "disabled by 'image mount driver = squashfuse'"),
+		},
+		{
+			name:           "ImageMountDriverFuse2fs",
+			argv:           []string{c.ext3Image, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "image mount driver",
+			directiveValue: "fuse2fs",
+			exit:           0,
+		},
+		{
+			name:           "ImageMountDriverFuse2fsSif",
+			argv:           []string{c.sifImage, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "image mount driver",
+			directiveValue: "fuse2fs",
+			exit:           0,
+			resultOp:       e2e.ExpectError(e2e.ContainMatch, "Converting SIF file to temporary sandbox"),
+		},
+		{
+			name:           "OverlayDriverAuto",
+			argv:           []string{"--writable-tmpfs", c.sifImage, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "overlay driver",
+			directiveValue: "auto",
+			exit:           0,
+		},
+		{
+			name:           "OverlayDriverKernel",
+			argv:           []string{"--writable-tmpfs", c.sifImage, "grep", "-q", " - overlay ", "/proc/self/mountinfo"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "overlay driver",
+			directiveValue: "kernel",
+			exit:           0,
+			addRequirementsFn: func(t *testing.T) {
+				if err := overlay.CheckRootless(); err != nil {
+					t.Skipf("kernel overlay not usable in a user namespace: %s", err)
+				}
+			},
+		},
+		{
+			name:              "OverlayDriverFuse",
+			argv:              []string{"--writable-tmpfs", c.sifImage, "grep", "-q", "fuse-overlayfs", "/proc/self/mountinfo"},
+			profile:           e2e.UserNamespaceProfile,
+			directive:         "overlay driver",
+			directiveValue:    "fuse",
+			exit:              0,
+			addRequirementsFn: func(t *testing.T) { require.Command(t, "fuse-overlayfs") },
+		},
+		{
+			name:           "OverlayDriverNone",
+			argv:           []string{"--writable-tmpfs", c.sifImage, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "overlay driver",
+			directiveValue: "fuse",
+			exit:           255,
+			resultOp:       e2e.ExpectError(e2e.ContainMatch, "no overlay driver usable"),
+			addRequirementsFn: func(t *testing.T) {
+				if _, err := exec.LookPath("fuse-overlayfs"); err == nil {
+					t.Skip("fuse-overlayfs found")
+				}
+			},
+		},
+		{
+			name:           "SquashfuseThreadsSingle",
+			argv:           []string{c.sifImage, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "squashfuse threads",
+			directiveValue: "1",
+			exit:           0,
+		},
+		{
+			name:           "SquashfuseThreadsMulti",
+			argv:           []string{c.sifImage, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "squashfuse threads",
+			directiveValue: "4",
+			exit:           0,
+		},
+		{
+			name:           "SquashfuseThreadsFlag",
+			argv:           []string{"--squashfuse-threads", "2", c.sifImage, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "squashfuse threads",
+			directiveValue: "1",
+			exit:           0,
+		},
+		{
+			name:           "SquashfuseThreadsFlagInvalid",
+			argv:           []string{"--squashfuse-threads", "-1", c.sifImage, "true"},
+			profile:        e2e.UserNamespaceProfile,
+			directive:      "squashfuse threads",
+			directiveValue: "0",
+			exit:           255,
+			resultOp:       e2e.ExpectError(e2e.ContainMatch, "invalid number of squashfuse threads"),
+		},
 		// FIXME
 		// The e2e tests currently run inside a PID namespace.
 		//   (see internal/init/init_linux.go)
@@ -687,6 +903,25 @@ func (c configTests) configGlobal(t *testing.T) {
 			directiveValue: "no",
 			exit:           0,
 		},
+		{
+			name:           "SuidEnvAllowlistPresent",
+			argv:           []string{"--cleanenv", c.env.ImagePath, "printenv", "SLURM_JOB_ID"},
+			profile:        e2e.UserProfile,
+			env:            []string{"SLURM_JOB_ID=42"},
+			directive:      "suid env allowlist",
+			directiveValue: "SLURM_*",
+			exit:           0,
+			resultOp:       e2e.ExpectOutput(e2e.ExactMatch, "42"),
+		},
+		{
+			name:           "SuidEnvAllowlistAbsent",
+			argv:           []string{"--cleanenv", c.env.ImagePath, "printenv", "KRB5CCNAME"},
+			profile:        e2e.UserProfile,
+			env:            []string{"KRB5CCNAME=FILE:/tmp/krb5cc_e2e"},
+			directive:      "suid env allowlist",
+			directiveValue: "SLURM_*",
+			exit:           1,
+		},
 	}
 
 	for _, tt := range tests {
@@ -695,6 +930,7 @@ func (c configTests) configGlobal(t *testing.T) {
 			e2e.AsSubtest(tt.name),
 			e2e.WithProfile(tt.profile),
 			e2e.WithDir(tt.cwd),
+			e2e.WithEnv(tt.env),
 			e2e.PreRun(func(t *testing.T) {
 				if tt.addRequirementsFn != nil {
 					tt.addRequirementsFn(t)
@@ -955,6 +1191,13 @@ func (c configTests) configFile(t *testing.T) {
 			conf:    "max loop devices = 128\n",
 			exit:    0,
 		},
+		{
+			name:    "SuidEnvAllowlistDangerous",
+			argv:    []string{c.env.ImagePath, "true"},
+			profile: e2e.RootProfile,
+			conf:    "suid env allowlist = SLURM_*, LD_*\n",
+			exit:    255,
+		},
 		{
 			name:    "UserForbidden",
 			argv:    []string{c.env.ImagePath, "true"},
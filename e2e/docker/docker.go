@@ -389,6 +389,57 @@ func (c ctx) testDockerWhiteoutSymlink(t *testing.T) {
 	)
 }
 
+// Check that the layers extracted while the image is fetched into the cache
+// give the same container content as the layers extracted from a copy of
+// the image, as done with --disable-cache
+func (c ctx) testDockerStreamUnpack(t *testing.T) {
+	imageDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "stream-", "")
+	t.Cleanup(func() {
+		if !t.Failed() {
+			cleanup(t)
+		}
+	})
+
+	for _, src := range []string{"docker://ghcr.io/apptainer/aufs-sanity", "docker://ghcr.io/apptainer/linkwh"} {
+		name := filepath.Base(src)
+		digests := make(map[string]string)
+
+		for _, mode := range []string{"cache", "nocache"} {
+			imagePath := filepath.Join(imageDir, name+"-"+mode+".sif")
+			sandboxPath := filepath.Join(imageDir, name+"-"+mode)
+
+			args := []string{imagePath, src}
+			if mode == "nocache" {
+				args = append([]string{"--disable-cache"}, args...)
+			}
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest(name+" "+mode),
+				e2e.WithProfile(e2e.UserProfile),
+				e2e.WithCommand("build"),
+				e2e.WithArgs(args...),
+				e2e.ExpectExit(0),
+			)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest(name+" "+mode+" sandbox"),
+				e2e.WithProfile(e2e.UserProfile),
+				e2e.WithCommand("build"),
+				e2e.WithArgs("--sandbox", sandboxPath, imagePath),
+				e2e.ExpectExit(0),
+			)
+			if t.Failed() {
+				return
+			}
+			digests[mode] = e2e.ContentDigest(t, sandboxPath, ".singularity.d/labels.json")
+		}
+
+		if digests["cache"] != digests["nocache"] {
+			t.Errorf("%s content digests differ: %s with cache, %s without cache", src, digests["cache"], digests["nocache"])
+		}
+	}
+}
+
 func (c ctx) testDockerDefFile(t *testing.T) {
 	imageDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "def-", "")
 	t.Cleanup(func() {
@@ -506,7 +557,7 @@ func (c ctx) testDockerRegistry(t *testing.T) {
 		},
 		{
 			name: "BusyBoxNamespace",
-			exit: 255,
+			exit: 247,
 			dfd: e2e.DefFileDetails{
 				Bootstrap: "docker",
 				From:      "my-busybox",
@@ -896,6 +947,7 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 			t.Run("permissions", c.testDockerPermissions)
 			t.Run("pulls", c.testDockerPulls)
 			t.Run("whiteout symlink", c.testDockerWhiteoutSymlink)
+			t.Run("stream unpack", c.testDockerStreamUnpack)
 			t.Run("labels", c.testDockerLabels)
 			t.Run("cmd", c.testDockerCMD)
 			t.Run("entrypoint", c.testDockerENTRYPOINT)
@@ -155,7 +155,7 @@ func (c *ctx) eclConfig(t *testing.T) {
 				Activated: true,
 			},
 			args: []string{signed, "true"},
-			exit: 255,
+			exit: 249,
 		},
 		{
 			name:    "run with whitelist key1 and signed image",
@@ -209,7 +209,7 @@ func (c *ctx) eclConfig(t *testing.T) {
 				},
 			},
 			args: []string{unsigned, "true"},
-			exit: 255,
+			exit: 249,
 		},
 		{
 			name:    "run with whitelist no key and unsigned image",
@@ -226,7 +226,7 @@ func (c *ctx) eclConfig(t *testing.T) {
 				},
 			},
 			args: []string{unsigned, "true"},
-			exit: 255,
+			exit: 249,
 		},
 		{
 			name:    "run with whitelist fake directory and signed image",
@@ -244,7 +244,7 @@ func (c *ctx) eclConfig(t *testing.T) {
 				},
 			},
 			args: []string{unsigned, "true"},
-			exit: 255,
+			exit: 249,
 		},
 		{
 			name:    "run with whitestrict and signed image",
@@ -280,7 +280,7 @@ func (c *ctx) eclConfig(t *testing.T) {
 				},
 			},
 			args: []string{signedOne, "true"},
-			exit: 255,
+			exit: 249,
 		},
 		{
 			name:    "run with whitestrict and unsigned image",
@@ -298,7 +298,7 @@ func (c *ctx) eclConfig(t *testing.T) {
 				},
 			},
 			args: []string{unsigned, "true"},
-			exit: 255,
+			exit: 249,
 		},
 		{
 			name:    "run with blacklist (key1) and signed image",
@@ -316,7 +316,7 @@ func (c *ctx) eclConfig(t *testing.T) {
 				},
 			},
 			args: []string{signed, "true"},
-			exit: 255,
+			exit: 249,
 		},
 		{
 			name:    "run with blacklist (key2) and single signed image",
@@ -369,7 +369,7 @@ func (c *ctx) eclConfig(t *testing.T) {
 				},
 			},
 			args: []string{signed, "true"},
-			exit: 255, // should fail because signed key does not exist
+			exit: 249, // should fail because signed key does not exist
 			err:  "while checking container image with ECL: image not signed by required entities",
 		},
 		{
@@ -406,7 +406,7 @@ func (c *ctx) eclConfig(t *testing.T) {
 				},
 			},
 			args: []string{signed, "true"},
-			exit: 255, // should fail because both keys should exist
+			exit: 249, // should fail because both keys should exist
 			err:  "while checking container image with ECL: image not signed by required entities",
 		},
 		{
@@ -432,7 +432,7 @@ func (c *ctx) eclConfig(t *testing.T) {
 				},
 			},
 			args: []string{signed, "true"},
-			exit: 255, // should fail because the image is signed by forbidden keys
+			exit: 249, // should fail because the image is signed by forbidden keys
 			err:  "while checking container image with ECL: image signed by a forbidden entity",
 		},
 	}
@@ -329,6 +329,97 @@ func (c ctx) apptainerEnvOption(t *testing.T) {
 	}
 }
 
+// apptainerEnvPreserveUnset checks --preserve-env and --unset-env, the
+// latter being applied after all other environment sources.
+func (c ctx) apptainerEnvPreserveUnset(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tests := []struct {
+		name     string
+		args     []string
+		hostEnv  []string
+		matchEnv string
+		matchVal string
+		exit     int
+	}{
+		{
+			name:     "CleanEnvPreserve",
+			args:     []string{"--cleanenv", "--preserve-env", "SLURM_*,OTHER"},
+			hostEnv:  []string{"SLURM_JOB_ID=42"},
+			matchEnv: "SLURM_JOB_ID",
+			matchVal: "42",
+		},
+		{
+			name:     "CleanEnvNotPreserved",
+			args:     []string{"--cleanenv", "--preserve-env", "OTHER"},
+			hostEnv:  []string{"SLURM_JOB_ID=42"},
+			matchEnv: "SLURM_JOB_ID",
+			matchVal: "",
+		},
+		{
+			name:     "UnsetHost",
+			args:     []string{"--unset-env", "SLURM_*"},
+			hostEnv:  []string{"SLURM_JOB_ID=42"},
+			matchEnv: "SLURM_JOB_ID",
+			matchVal: "",
+		},
+		{
+			name:     "UnsetEnvOption",
+			args:     []string{"--env", "FOO=bar", "--unset-env", "FOO"},
+			matchEnv: "FOO",
+			matchVal: "",
+		},
+		{
+			name:     "UnsetApptainerEnv",
+			args:     []string{"--unset-env", "FOO"},
+			hostEnv:  []string{"APPTAINERENV_FOO=bar"},
+			matchEnv: "FOO",
+			matchVal: "",
+		},
+		{
+			name:     "UnsetImageEnvironment",
+			args:     []string{"--unset-env", "AVENGERS"},
+			matchEnv: "AVENGERS",
+			matchVal: "",
+		},
+		{
+			name:     "UnsetOther",
+			args:     []string{"--unset-env", "OTHER"},
+			matchEnv: "AVENGERS",
+			matchVal: "assemble",
+		},
+		{
+			name:     "UnsetAllKeepsPath",
+			args:     []string{"--unset-env", "*"},
+			matchEnv: "PATH",
+			matchVal: defaultPath + ":/go/bin:/usr/local/go/bin",
+		},
+		{
+			name:     "InvalidPattern",
+			args:     []string{"--unset-env", "FOO;BAR"},
+			matchEnv: "FOO",
+			exit:     255,
+		},
+	}
+
+	for _, tt := range tests {
+		args := append(tt.args, c.env.ImagePath, "/bin/sh", "-c", "echo \"${"+tt.matchEnv+"}\"")
+		var ops []e2e.ApptainerCmdResultOp
+		if tt.exit == 0 {
+			ops = append(ops, e2e.ExpectOutput(e2e.ExactMatch, tt.matchVal))
+		}
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithEnv(tt.hostEnv),
+			e2e.WithArgs(args...),
+			e2e.ExpectExit(tt.exit, ops...),
+		)
+	}
+}
+
 func (c ctx) apptainerEnvFile(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
 
@@ -637,13 +728,14 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	}
 
 	return testhelper.Tests{
-		"environment manipulation": c.apptainerEnv,
-		"environment option":       c.apptainerEnvOption,
-		"environment file":         c.apptainerEnvFile,
-		"env eval":                 c.apptainerEnvEval,
-		"issue 5057":               c.issue5057, // https://github.com/apptainer/singularity/issues/5057
-		"issue 5426":               c.issue5426, // https://github.com/apptainer/singularity/issues/5426
-		"issue 43":                 c.issue43,   // https://github.com/sylabs/singularity/issues/43
-		"issue 1263":               c.issue1263, // https://github.com/sylabs/singularity/issues/1263
+		"environment manipulation":   c.apptainerEnv,
+		"environment option":         c.apptainerEnvOption,
+		"environment file":           c.apptainerEnvFile,
+		"environment preserve/unset": c.apptainerEnvPreserveUnset,
+		"env eval":                   c.apptainerEnvEval,
+		"issue 5057":                 c.issue5057, // https://github.com/apptainer/singularity/issues/5057
+		"issue 5426":                 c.issue5426, // https://github.com/apptainer/singularity/issues/5426
+		"issue 43":                   c.issue43,   // https://github.com/sylabs/singularity/issues/43
+		"issue 1263":                 c.issue1263, // https://github.com/sylabs/singularity/issues/1263
 	}
 }
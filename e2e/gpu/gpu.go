@@ -10,6 +10,7 @@
 package gpu
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -21,6 +22,7 @@ import (
 	"github.com/apptainer/apptainer/e2e/internal/testhelper"
 	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/gpu"
 )
 
 var buildDefinition = `Bootstrap: localimage
@@ -215,6 +217,172 @@ func (c ctx) testNvCCLI(t *testing.T) {
 	}
 }
 
+// nvCCLIMock is a nvidia-container-cli mock recording its arguments, and
+// listing fake driver files, or failing when NVCCLI_MOCK_FAIL is set.
+const nvCCLIMock = `#!/bin/sh
+echo "$@" >> "%[1]s"
+if [ -n "$NVCCLI_MOCK_FAIL" ]; then
+	echo "nvidia-container-cli: initialization error: mock failure" >&2
+	exit 1
+fi
+cat <<EOF
+/dev/nvidiactl
+/dev/nvidia0
+/usr/bin/nvidia-smi
+/usr/lib/x86_64-linux-gnu/libcuda.so.535.104.05
+/run/nvidia-persistenced/socket
+EOF
+`
+
+// testNvCCLIMock checks the nvidia-container-cli command lines and the
+// mounts planned with --nvccli, using a mock of nvidia-container-cli and
+// --dry-run so no GPU is required.
+func (c ctx) testNvCCLIMock(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	if gpu.FindCDISpec(gpu.NvidiaCDIKind) != nil {
+		t.Skip("NVIDIA CDI specification found, nvidia-container-cli is not used")
+	}
+
+	tmpdir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "nvccli-mock-", "nvidia-container-cli mock")
+	defer cleanup(t)
+	argsFile := filepath.Join(tmpdir, "args")
+	mock := filepath.Join(tmpdir, "nvidia-container-cli")
+	if err := os.WriteFile(mock, []byte(fmt.Sprintf(nvCCLIMock, argsFile)), 0o755); err != nil {
+		t.Fatalf("while writing nvidia-container-cli mock: %s", err)
+	}
+	env := append(os.Environ(), "PATH="+tmpdir+":"+os.Getenv("PATH"))
+
+	type planMount struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+		Origin      string `json:"origin"`
+	}
+	type plan struct {
+		Mounts []planMount `json:"mounts"`
+		NvCCLI []string    `json:"nvccli"`
+	}
+	checkPlan := func(fn func(t *testing.T, p plan)) e2e.ApptainerCmdResultOp {
+		return func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			var p plan
+			if err := json.Unmarshal(r.Stdout, &p); err != nil {
+				t.Fatalf("while decoding dry run output: %s\n%s", err, r.Stdout)
+			}
+			fn(t, p)
+		}
+	}
+	hasMount := func(p plan, src, dest string) bool {
+		for _, m := range p.Mounts {
+			if m.Source == src && m.Destination == dest && m.Origin == "flag: --nvccli" {
+				return true
+			}
+		}
+		return false
+	}
+	// mockArgs checks the arguments of the last mock call
+	mockArgs := func(want ...string) e2e.ApptainerCmdResultOp {
+		return func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			b, err := os.ReadFile(argsFile)
+			if err != nil {
+				t.Fatalf("nvidia-container-cli mock not called: %s", err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+			if got := lines[len(lines)-1]; got != strings.Join(want, " ") {
+				t.Errorf("nvidia-container-cli called with %q, want %q", got, strings.Join(want, " "))
+			}
+		}
+	}
+
+	listArgs := []string{"--user", "list", "--libraries", "--binaries", "--ipcs", "--device=0:1"}
+
+	tests := []struct {
+		name       string
+		args       []string
+		env        []string
+		expectExit int
+		expectOps  []e2e.ApptainerCmdResultOp
+	}{
+		{
+			name: "Configure",
+			args: []string{"--nvccli", "--gpus", "0,mig:1:2", "--nv-caps", "compute,video"},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				checkPlan(func(t *testing.T, p plan) {
+					got := strings.Join(p.NvCCLI, " ")
+					for _, want := range []string{"configure", "--device=0,1:2", "--compute", "--video", "<rootfs>"} {
+						if !strings.Contains(got, want) {
+							t.Errorf("%q not found in nvidia-container-cli command %q", want, got)
+						}
+					}
+					if strings.Contains(got, "--utility") {
+						t.Errorf("default capabilities set in nvidia-container-cli command %q", got)
+					}
+				}),
+			},
+		},
+		{
+			name: "ContainAll",
+			args: []string{"--containall", "--nvccli", "--gpus", "mig:0:1"},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				checkPlan(func(t *testing.T, p plan) {
+					if len(p.NvCCLI) > 0 {
+						t.Errorf("nvidia-container-cli configure planned with --containall: %q", p.NvCCLI)
+					}
+					for _, m := range [][2]string{
+						{"/dev/nvidiactl", "/dev/nvidiactl"},
+						{"/dev/nvidia0", "/dev/nvidia0"},
+						{"/usr/bin/nvidia-smi", "/usr/bin/nvidia-smi"},
+						{"/usr/lib/x86_64-linux-gnu/libcuda.so.535.104.05", "/.singularity.d/libs/libcuda.so.535.104.05"},
+						{"/run/nvidia-persistenced/socket", "/run/nvidia-persistenced/socket"},
+					} {
+						if !hasMount(p, m[0], m[1]) {
+							t.Errorf("%s to %s not found in %v", m[0], m[1], p.Mounts)
+						}
+					}
+				}),
+				mockArgs(listArgs...),
+			},
+		},
+		{
+			name:       "Failure",
+			args:       []string{"--containall", "--nvccli", "--gpus", "0"},
+			env:        []string{"NVCCLI_MOCK_FAIL=1"},
+			expectExit: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "initialization error: mock failure"),
+			},
+		},
+		{
+			name:       "InvalidGPUs",
+			args:       []string{"--nvccli", "--gpus", "mig:0"},
+			expectExit: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "invalid --gpus"),
+			},
+		},
+		{
+			name:       "InvalidCaps",
+			args:       []string{"--nvccli", "--nv-caps", "compute,gpu"},
+			expectExit: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "invalid --nv-caps"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		args := append([]string{"--dry-run", "--json"}, tt.args...)
+		args = append(args, c.env.ImagePath, "true")
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(args...),
+			e2e.WithEnv(append(env, tt.env...)),
+			e2e.ExpectExit(tt.expectExit, tt.expectOps...),
+		)
+	}
+}
+
 func (c ctx) testRocm(t *testing.T) {
 	require.Rocm(t)
 	require.Command(t, "lsmod")
@@ -551,6 +719,7 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	return testhelper.Tests{
 		"nvidia":       c.testNvidiaLegacy,
 		"nvccli":       c.testNvCCLI,
+		"nvccli mock":  c.testNvCCLIMock,
 		"rocm":         c.testRocm,
 		"build nvidia": c.testBuildNvidiaLegacy,
 		"build nvccli": c.testBuildNvCCLI,
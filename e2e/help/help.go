@@ -85,6 +85,7 @@ func (c ctx) testCommands(t *testing.T) {
 		{"Cache", "cache"},
 		{"Capability", "capability"},
 		{"Exec", "exec"},
+		{"Fakeroot", "fakeroot"},
 		{"Instance", "instance"},
 		{"Key", "key"},
 		{"OCI", "oci"},
@@ -10,13 +10,17 @@
 package imgbuild
 
 import (
+	"debug/elf"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -25,6 +29,10 @@ import (
 	"github.com/apptainer/apptainer/e2e/internal/testhelper"
 	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/machine"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/sif/v2/pkg/sif"
+	"golang.org/x/sys/unix"
 )
 
 var testFileContent = "Test file content\n"
@@ -2074,6 +2082,233 @@ func (c *imgBuildTests) testSIFHeaderAndExecute(t *testing.T) {
 	}
 }
 
+// Check that a sandbox extracted from a SIF image with all the processors
+// available to unsquashfs has the same content as the root filesystem
+// extracted with a single threaded unsquashfs.
+func (c imgBuildTests) buildSandboxFromSIF(t *testing.T) {
+	require.Command(t, "unsquashfs")
+	e2e.EnsureImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "sandbox-from-sif-", "")
+	t.Cleanup(func() {
+		if !t.Failed() {
+			e2e.Privileged(cleanup)(t)
+		}
+	})
+
+	squashImage := filepath.Join(tmpDir, "rootfs.sqfs")
+	singleSandbox := filepath.Join(tmpDir, "single")
+	sandbox := filepath.Join(tmpDir, "sandbox")
+
+	img, err := image.Init(c.env.ImagePath, false)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", c.env.ImagePath, err)
+	}
+	r, err := image.NewPartitionReader(img, image.RootFs, -1)
+	if err != nil {
+		t.Fatalf("failed to get root partition: %s", err)
+	}
+	f, err := os.Create(squashImage)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", squashImage, err)
+	}
+	_, err = io.Copy(f, r)
+	f.Close()
+	if err != nil {
+		t.Fatalf("failed to copy squash image %s: %s", squashImage, err)
+	}
+
+	cmd := exec.Command("unsquashfs", "-no-progress", "-processors", "1", "-user-xattrs", "-d", singleSandbox, squashImage)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("unexpected error while running unsquashfs: %s: %s", err, out)
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+	if t.Failed() {
+		return
+	}
+
+	// dev is not extracted for non root users and the build updates
+	// the container metadata
+	exclude := []string{"dev", ".singularity.d"}
+	if e2e.ContentDigest(t, sandbox, exclude...) != e2e.ContentDigest(t, singleSandbox, exclude...) {
+		t.Errorf("content of sandbox %s differs from the content extracted by unsquashfs in %s", sandbox, singleSandbox)
+	}
+}
+
+// buildTmpDirSpace checks that a build fails early when the temporary
+// directory is too small to extract the source image.
+func (c imgBuildTests) buildTmpDirSpace(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "tmpdir-space-", "")
+	t.Cleanup(func() {
+		if !t.Failed() {
+			cleanup(t)
+		}
+	})
+
+	smallDir := filepath.Join(tmpDir, "small")
+	if err := os.Mkdir(smallDir, 0o755); err != nil {
+		t.Fatalf("failed to create %s: %s", smallDir, err)
+	}
+	e2e.Privileged(func(t *testing.T) {
+		if err := unix.Mount("tmpfs", smallDir, "tmpfs", 0, "size=64k,mode=1777"); err != nil {
+			t.Fatalf("failed to mount tmpfs on %s: %s", smallDir, err)
+		}
+	})(t)
+	t.Cleanup(func() {
+		e2e.Privileged(func(t *testing.T) {
+			_ = unix.Unmount(smallDir, unix.MNT_DETACH)
+		})(t)
+	})
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithEnv(append(os.Environ(), "APPTAINER_TMPDIR="+smallDir)),
+		e2e.WithArgs(filepath.Join(tmpDir, "image.sif"), c.env.ImagePath),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "not enough space in temporary directory "+smallDir),
+			e2e.ExpectError(e2e.ContainMatch, "set APPTAINER_TMPDIR"),
+		),
+	)
+}
+
+// buildArch checks the architecture recorded in images built with --arch,
+// and the failures without emulation for another architecture.
+func (c imgBuildTests) buildArch(t *testing.T) {
+	foreignArch := "arm64"
+	if runtime.GOARCH == "arm64" {
+		foreignArch = "amd64"
+	}
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "build-arch-", "")
+	t.Cleanup(func() {
+		if !t.Failed() {
+			cleanup(t)
+		}
+	})
+
+	// without binaries, the image architecture is the requested one
+	scratchDef := e2e.RawDefFile(t, tmpDir, strings.NewReader("Bootstrap: scratch\n\n%labels\n    arch "+foreignArch+"\n"))
+	imagePath := filepath.Join(tmpDir, "scratch.sif")
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--arch", foreignArch, imagePath, scratchDef),
+		e2e.ExpectExit(0),
+	)
+	if t.Failed() {
+		return
+	}
+	f, err := sif.LoadContainerFromPath(imagePath, sif.OptLoadWithFlag(os.O_RDONLY))
+	if err != nil {
+		t.Fatalf("failed to load %s: %s", imagePath, err)
+	}
+	arch := f.PrimaryArch()
+	f.UnloadContainer()
+	if arch != foreignArch {
+		t.Errorf("unexpected architecture %s recorded in %s instead of %s", arch, imagePath, foreignArch)
+	}
+
+	if machine.CompatibleWith(foreignArch) {
+		t.Logf("Emulation of %s available, skipping the checks without emulation", foreignArch)
+		return
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(imagePath, "/bin/true"),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "the image's architecture ("+foreignArch+") could not run on the host's"),
+			e2e.ExpectError(e2e.ContainMatch, "qemu-user-static"),
+		),
+	)
+
+	// the architecture of a sandbox is the one of its shell
+	e2e.EnsureImage(t, c.env)
+	sandbox := filepath.Join(tmpDir, "sandbox")
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+	if t.Failed() {
+		return
+	}
+	writeForeignShell(t, filepath.Join(sandbox, "bin", "sh"), foreignArch)
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(sandbox, "/bin/true"),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "The image's architecture ("+foreignArch+") doesn't match the host's ("+runtime.GOARCH+")"),
+			e2e.ExpectError(e2e.ContainMatch, "qemu-user-static"),
+		),
+	)
+
+	postDef := e2e.RawDefFile(t, tmpDir, strings.NewReader("Bootstrap: docker\nFrom: alpine:3.19\n\n%post\n    true\n"))
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--arch", foreignArch, filepath.Join(tmpDir, "post.sif"), postDef),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "no emulation available to run the %post and %test sections"),
+		),
+	)
+}
+
+// writeForeignShell replaces the shell at path by the ELF header of an
+// executable of the architecture arch (arm64 or amd64).
+func writeForeignShell(t *testing.T, path, arch string) {
+	h := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_AARCH64),
+		Version:   uint32(elf.EV_CURRENT),
+		Ehsize:    64,
+		Phentsize: 56,
+		Shentsize: 64,
+	}
+	if arch == "amd64" {
+		h.Machine = uint16(elf.EM_X86_64)
+	}
+	copy(h.Ident[:], elf.ELFMAG)
+	h.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	h.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	h.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("failed to remove %s: %s", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o755)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", path, err)
+	}
+	defer f.Close()
+	if err := binary.Write(f, binary.LittleEndian, &h); err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+}
+
 // Check that test and runscript that specify a custom #! use it as the interpreter.
 func (c imgBuildTests) buildCustomShebang(t *testing.T) {
 	tmpdir, cleanup := c.tempDir(t, "build-shebang-test")
@@ -2270,6 +2505,9 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"issue 5668":                             c.issue5668,                            // https://github.com/apptainer/singularity/issues/5435
 		"issue 5690":                             c.issue5690,                            // https://github.com/apptainer/singularity/issues/5690
 		"test sif header and execute image":      c.testSIFHeaderAndExecute,              // https://github.com/apptainer/apptainer/issues/211
+		"sandbox from sif":                       c.buildSandboxFromSIF,                  // sandbox extracted with parallel unsquashfs
+		"tmpdir space":                           c.buildTmpDirSpace,                     // build fails early without enough temporary space
+		"build arch":                             c.buildArch,                            // build for another architecture with --arch
 		"build sif image using gocryptfs":        c.testGocryptfsSIFBuild,                // https://github.com/apptainer/apptainer/issues/484
 		"definition build with template support": c.buildDefinitionWithBuildArgs,         // builds from definition with build args (build arg file) support
 		"issue 1812":                             c.issue1812,                            // https://github.com/sylabs/singularity/issues/1812
@@ -42,6 +42,7 @@ func (c ctx) apptainerInspect(t *testing.T) {
 	sifImage := filepath.Join(testDir, "image.sif")
 	squashImage := filepath.Join(testDir, "image.sqs")
 	sandboxImage := filepath.Join(testDir, "sandbox")
+	tarImage := filepath.Join(testDir, "rootfs.tgz")
 
 	c.env.RunApptainer(
 		t,
@@ -81,6 +82,10 @@ func (c ctx) apptainerInspect(t *testing.T) {
 	if res := cmd.Run(t); res.Error != nil {
 		t.Fatalf("Unexpected error while running command.\n%s", res)
 	}
+	cmd = exec.Command("tar", "-C", sandboxImage, "-czf", tarImage, ".")
+	if res := cmd.Run(t); res.Error != nil {
+		t.Fatalf("Unexpected error while running command.\n%s", res)
+	}
 
 	compareLabel := func(label, expected string, appName string) func(*testing.T, *inspect.Metadata) {
 		return func(t *testing.T, meta *inspect.Metadata) {
@@ -415,6 +420,173 @@ func (c ctx) apptainerInspect(t *testing.T) {
 		e2e.WithArgs("--all", sandboxImage),
 		e2e.ExpectExit(0, compareAll),
 	)
+
+	// test --format and the null attributes of a selection
+	for _, img := range []struct {
+		name string
+		path string
+	}{
+		{"SIF", sifImage},
+		{"Squash", squashImage},
+		{"Sandbox", sandboxImage},
+	} {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(img.name+"/format"),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("inspect"),
+			e2e.WithArgs("--format", `{{ .labels.E2E }} {{ index .apps.hello.labels "HELLOTHISIS" }}`, img.path),
+			e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, "AWESOME hello")),
+		)
+
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(img.name+"/null"),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("inspect"),
+			e2e.WithArgs("--json", "--startscript", "--app", "world", img.path),
+			e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+				var out struct {
+					Data struct {
+						Attributes struct {
+							Apps map[string]map[string]json.RawMessage `json:"apps"`
+						} `json:"attributes"`
+					} `json:"data"`
+				}
+				if err := json.Unmarshal(r.Stdout, &out); err != nil {
+					t.Fatalf("unable to parse json output: %s", err)
+				}
+				if v, ok := out.Data.Attributes.Apps["world"]["startscript"]; !ok || string(v) != "null" {
+					t.Errorf("unexpected startscript %q for an app without startscript", v)
+				}
+			}),
+		)
+
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(img.name+"/missingApp"),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("inspect"),
+			e2e.WithArgs("--runscript", "--app", "missing", img.path),
+			e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, `no app "missing": available apps are hello, world`)),
+		)
+
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(img.name+"/apps"),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("apps"),
+			e2e.WithArgs(img.path),
+			e2e.ExpectExit(0, e2e.ExpectOutput(e2e.RegexMatch, `(?m)^hello +This is the help for hello!$`)),
+		)
+
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(img.name+"/appsJSON"),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("apps"),
+			e2e.WithArgs("--json", img.path),
+			e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+				var apps []struct {
+					Name   string            `json:"name"`
+					Labels map[string]string `json:"labels"`
+					Size   *int64            `json:"size"`
+				}
+				if err := json.Unmarshal(r.Stdout, &apps); err != nil {
+					t.Fatalf("unable to parse json output: %s", err)
+				}
+				if len(apps) != 2 || apps[0].Name != "hello" || apps[1].Name != "world" {
+					t.Fatalf("unexpected apps %+v", apps)
+				}
+				if apps[0].Labels["HELLOTHISIS"] != "hello" {
+					t.Errorf("unexpected labels %v for app hello", apps[0].Labels)
+				}
+				if apps[0].Size == nil {
+					t.Errorf("no size reported for app hello")
+				}
+			}),
+		)
+	}
+
+	// test --image-format, the metadata of a tar archive being read from
+	// the sandbox it's extracted to
+	for _, img := range []struct {
+		name   string
+		path   string
+		format string
+	}{
+		{"SIF", sifImage, "sif"},
+		{"Squash", squashImage, "squashfs"},
+		{"Sandbox", sandboxImage, "sandbox"},
+		{"Tar", tarImage, "tar.gz"},
+	} {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(img.name+"/imageFormat"),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("inspect"),
+			e2e.WithArgs("--image-format", img.path),
+			e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, img.format)),
+		)
+	}
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Tar/format"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--format", `{{ .imageFormat }} {{ .labels.E2E }}`, tarImage),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, "tar.gz AWESOME")),
+	)
+}
+
+// inspectRemote checks the metadata of a SIF image pushed to a registry
+// is shown without pulling the image.
+func (c ctx) inspectRemote(t *testing.T) {
+	e2e.EnsureORASImage(t, c.env)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("text"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--remote", c.env.OrasTestImage),
+		e2e.ExpectExit(0,
+			e2e.ExpectOutput(e2e.ContainMatch, "Remote metadata of "+c.env.OrasTestImage),
+			e2e.ExpectOutput(e2e.RegexMatch, `(?m)^Layers: +1$`),
+		),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("json"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--remote", "--json", c.env.OrasTestImage),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			var m inspect.RemoteMetadata
+			if err := json.Unmarshal(r.Stdout, &m); err != nil {
+				t.Fatalf("unable to parse json output: %s", err)
+			}
+			if m.Type != inspect.RemoteType {
+				t.Errorf("got type %q, want %q", m.Type, inspect.RemoteType)
+			}
+			if len(m.Attributes.Layers) != 1 || m.Attributes.Layers[0].Digest != m.Attributes.Digest {
+				t.Errorf("unexpected layers %v for digest %s", m.Attributes.Layers, m.Attributes.Digest)
+			}
+			if len(m.Attributes.Objects) == 0 {
+				t.Errorf("no SIF objects reported")
+			}
+		}),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("selection"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--remote", "--runscript", c.env.OrasTestImage),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "--remote can only be combined with --json")),
+	)
 }
 
 // E2ETests is the main func to trigger the test suite
@@ -425,5 +597,6 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 
 	return testhelper.Tests{
 		"inspect command": c.apptainerInspect,
+		"inspect remote":  c.inspectRemote,
 	}
 }
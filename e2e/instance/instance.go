@@ -11,19 +11,27 @@ package instance
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
 	"os"
+	"os/exec"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
 	"github.com/apptainer/apptainer/e2e/internal/testhelper"
+	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
 	"github.com/apptainer/apptainer/pkg/util/fs/proc"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
 // randomName generates a random name based on a UUID.
@@ -114,6 +122,484 @@ func (c *ctx) testInstanceRun(t *testing.T) {
 	)
 }
 
+// Test that instance run executes the runscript of an image defining
+// no startscript, that instance stop signals the process group of the
+// runscript, and that instance run and start fail clearly when the image
+// has no script to execute.
+func (c *ctx) testInstanceRunRunscriptOnly(t *testing.T) {
+	dir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "instance-run-", "")
+	defer e2e.Privileged(cleanup)
+
+	sandbox := filepath.Join(dir, "sandbox")
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("BuildSandbox"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+	if t.Failed() {
+		return
+	}
+
+	runscript := filepath.Join(sandbox, ".singularity.d", "runscript")
+	startscript := filepath.Join(sandbox, ".singularity.d", "startscript")
+	if err := os.Remove(startscript); err != nil && !os.IsNotExist(err) {
+		t.Fatalf("failed to remove startscript: %s", err)
+	}
+	if err := os.WriteFile(runscript, []byte("#!/bin/sh\nexec sleep \"$@\"\n"), 0o755); err != nil {
+		t.Fatalf("failed to write runscript: %s", err)
+	}
+
+	instanceName := randomName(t)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("RunscriptOnly"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance run"),
+		e2e.WithArgs(sandbox, instanceName, "3600"),
+		e2e.PostRun(func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			defer c.stopInstance(t, instanceName)
+
+			// the runscript process must be running with its arguments
+			stdout, _, success := c.execInstance(t, instanceName, "sh", "-c", "cat /proc/[0-9]*/cmdline | tr '\\0' ' '")
+			if success && !strings.Contains(stdout, "sleep 3600") {
+				t.Errorf("runscript process not found in instance: %s", stdout)
+			}
+
+			c.env.RunApptainer(
+				t,
+				e2e.WithProfile(c.profile),
+				e2e.WithCommand("instance list"),
+				e2e.WithArgs("--json", instanceName),
+				e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+					var instances instanceList
+					if err := json.Unmarshal([]byte(r.Stdout), &instances); err != nil {
+						t.Fatalf("Error while decoding JSON from 'instance list': %v", err)
+					}
+					if len(instances.Instances) != 1 || instances.Instances[0].Script != "run" {
+						t.Errorf("expected a single run instance, got %+v", instances.Instances)
+					}
+				}),
+			)
+		}),
+		e2e.ExpectExit(0),
+	)
+
+	// instance stop signals the process group of the runscript, so its
+	// children can exit cleanly
+	markerDir := filepath.Join(dir, "marker")
+	if err := os.Mkdir(markerDir, 0o777); err != nil {
+		t.Fatalf("failed to create marker directory: %s", err)
+	}
+	if err := os.Chmod(markerDir, 0o777); err != nil {
+		t.Fatalf("failed to change marker directory permissions: %s", err)
+	}
+	groupRunscript := "#!/bin/sh\n" +
+		"sh -c 'trap \"touch /marker/stopped; exit 0\" TERM; while true; do sleep 1; done' &\n" +
+		"wait\n"
+	if err := os.WriteFile(runscript, []byte(groupRunscript), 0o755); err != nil {
+		t.Fatalf("failed to write runscript: %s", err)
+	}
+	instanceName = randomName(t)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("StopProcessGroup"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance run"),
+		e2e.WithArgs("--bind", markerDir+":/marker", sandbox, instanceName),
+		e2e.PostRun(func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			// wait for the runscript child to set its trap
+			time.Sleep(2 * time.Second)
+			c.stopInstance(t, instanceName)
+			if _, err := os.Stat(filepath.Join(markerDir, "stopped")); err != nil {
+				t.Errorf("runscript child process was not signaled by instance stop: %s", err)
+			}
+		}),
+		e2e.ExpectExit(0),
+	)
+
+	// without runscript the instance must not start, with a hint
+	// about instance start when there is a startscript
+	if err := os.WriteFile(startscript, []byte("#!/bin/sh\nexec sleep 3600\n"), 0o755); err != nil {
+		t.Fatalf("failed to write startscript: %s", err)
+	}
+	if err := os.Remove(runscript); err != nil {
+		t.Fatalf("failed to remove runscript: %s", err)
+	}
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("StartscriptOnly"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance run"),
+		e2e.WithArgs(sandbox, randomName(t)),
+		e2e.ExpectExit(255, e2e.ExpectOutput(e2e.ContainMatch, "use 'instance start' to execute its startscript")),
+	)
+
+	if err := os.Remove(startscript); err != nil {
+		t.Fatalf("failed to remove startscript: %s", err)
+	}
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("NoScript"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance run"),
+		e2e.WithArgs(sandbox, randomName(t)),
+		e2e.ExpectExit(255, e2e.ExpectOutput(e2e.ContainMatch, "no runscript or startscript found in container")),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("StartNoScript"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs(sandbox, randomName(t)),
+		e2e.ExpectExit(255, e2e.ExpectOutput(e2e.ContainMatch, "no runscript or startscript found in container")),
+	)
+}
+
+// Test that an instance with a restart policy is restarted by its
+// supervisor when it fails, and that instance restart starts an
+// instance again with its original options.
+func (c *ctx) testInstanceRestart(t *testing.T) {
+	dir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "instance-restart-", "")
+	defer e2e.Privileged(cleanup)
+
+	sandbox := filepath.Join(dir, "sandbox")
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("BuildSandbox"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+	if t.Failed() {
+		return
+	}
+
+	runscript := filepath.Join(sandbox, ".singularity.d", "runscript")
+	if err := os.WriteFile(runscript, []byte("#!/bin/sh\nsleep 2\nexit 3\n"), 0o755); err != nil {
+		t.Fatalf("failed to write runscript: %s", err)
+	}
+
+	instanceName := randomName(t)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("OnFailure"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance run"),
+		e2e.WithArgs("--restart", "on-failure:1", sandbox, instanceName),
+		e2e.PostRun(func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			// wait for the restart recorded by the supervisor
+			restarted := false
+			for retries := 0; retries < 30 && !restarted; retries++ {
+				time.Sleep(500 * time.Millisecond)
+				inst, found := c.getInstance(t, instanceName)
+				restarted = found && inst.Restarts == 1 && inst.LastExit != nil && *inst.LastExit == 3
+			}
+			if !restarted {
+				t.Errorf("instance %s was not restarted after its failure", instanceName)
+			}
+			// the maximum restart count is reached, the instance
+			// must not be restarted anymore
+			time.Sleep(5 * time.Second)
+			c.expectInstance(t, instanceName, 0)
+		}),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("InvalidPolicy"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--restart", "sometimes", c.env.ImagePath, randomName(t)),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, `invalid restart policy "sometimes"`)),
+	)
+
+	instanceName = randomName(t)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Restart"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--restart", "always", c.env.ImagePath, instanceName, strconv.Itoa(instanceStartPort)),
+		e2e.PostRun(func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			inst, _ := c.getInstance(t, instanceName)
+			c.env.RunApptainer(
+				t,
+				e2e.WithProfile(c.profile),
+				e2e.WithCommand("instance restart"),
+				e2e.WithArgs(instanceName),
+				e2e.ExpectExit(0),
+			)
+			restarted, found := c.getInstance(t, instanceName)
+			if !found || restarted.Pid == inst.Pid {
+				t.Errorf("instance %s was not restarted", instanceName)
+			} else if restarted.Restart != "always" {
+				t.Errorf("unexpected restart policy %q after restart", restarted.Restart)
+			}
+			echo(t, instanceStartPort)
+			c.stopInstance(t, instanceName)
+		}),
+		e2e.ExpectExit(0),
+	)
+}
+
+// Test that instance logs prints the log files of an instance.
+func (c *ctx) testInstanceLogs(t *testing.T) {
+	dir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "instance-logs-", "")
+	defer e2e.Privileged(cleanup)
+
+	sandbox := filepath.Join(dir, "sandbox")
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("BuildSandbox"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+	if t.Failed() {
+		return
+	}
+
+	runscript := filepath.Join(sandbox, ".singularity.d", "runscript")
+	script := "#!/bin/sh\necho out-1\necho out-2\necho err-1 >&2\nexec sleep 3600\n"
+	if err := os.WriteFile(runscript, []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write runscript: %s", err)
+	}
+
+	instanceName := randomName(t)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Start"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance run"),
+		e2e.WithArgs("--log-max-size", "1M", "--log-max-files", "2", sandbox, instanceName),
+		e2e.ExpectExit(0),
+	)
+	if t.Failed() {
+		return
+	}
+	defer c.stopInstance(t, instanceName)
+
+	// give the runscript some time to write its output
+	time.Sleep(time.Second)
+
+	tests := []struct {
+		name   string
+		args   []string
+		expect []e2e.ApptainerCmdResultOp
+	}{
+		{
+			name: "All",
+			expect: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectOutput(e2e.ContainMatch, "out-1\nout-2"),
+				e2e.ExpectError(e2e.ContainMatch, "err-1"),
+			},
+		},
+		{
+			name: "StdoutTail",
+			args: []string{"--stdout", "--tail", "1"},
+			expect: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectOutput(e2e.ContainMatch, "out-2"),
+				e2e.ExpectOutput(e2e.UnwantedContainMatch, "out-1"),
+				e2e.ExpectError(e2e.UnwantedContainMatch, "err-1"),
+			},
+		},
+		{
+			name: "StderrTimestamps",
+			args: []string{"--stderr", "--timestamps"},
+			expect: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.RegexMatch, `(?m)^\d{4}-\d{2}-\d{2}T\S+ err-1$`),
+				e2e.ExpectOutput(e2e.UnwantedContainMatch, "out-1"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance logs"),
+			e2e.WithArgs(append(tt.args, instanceName)...),
+			e2e.ExpectExit(0, tt.expect...),
+		)
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("InvalidMaxSize"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--log-max-size", "lots", c.env.ImagePath, randomName(t)),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, `Invalid instance log max size "lots"`)),
+	)
+}
+
+// Test instance health checks and the unhealthy actions.
+func (c *ctx) testInstanceHealth(t *testing.T) {
+	// waitHealth waits until the instance health status is the expected
+	// one, or until the instance is gone if status is empty.
+	waitHealth := func(t *testing.T, name, status string) (output string) {
+		for retries := 0; retries < 40; retries++ {
+			time.Sleep(500 * time.Millisecond)
+			inst, found := c.getInstance(t, name)
+			if !found && status == "" {
+				return ""
+			}
+			if found && inst.Health != nil && inst.Health.Status == status {
+				return inst.Health.LastOutput
+			}
+		}
+		t.Errorf("instance %s health status %q not reached", name, status)
+		return ""
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		status string
+		output string
+		stop   bool
+	}{
+		{
+			name:   "Healthy",
+			args:   []string{"--health-cmd", "echo ok", "--health-interval", "1s"},
+			status: "healthy",
+			output: "ok",
+			stop:   true,
+		},
+		{
+			name:   "Unhealthy",
+			args:   []string{"--health-cmd", "echo failed; false", "--health-interval", "1s", "--health-retries", "2"},
+			status: "unhealthy",
+			output: "failed",
+			stop:   true,
+		},
+		{
+			name:   "Timeout",
+			args:   []string{"--health-cmd", "sleep 60", "--health-interval", "1s", "--health-timeout", "1s", "--health-retries", "1"},
+			status: "unhealthy",
+			output: "health check timed out",
+			stop:   true,
+		},
+		{
+			name: "UnhealthyStop",
+			args: []string{"--health-cmd", "false", "--health-interval", "1s", "--health-retries", "1", "--on-unhealthy", "stop"},
+		},
+	}
+
+	for _, tt := range tests {
+		instanceName := randomName(t)
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance start"),
+			e2e.WithArgs(append(tt.args, c.env.ImagePath, instanceName)...),
+			e2e.PostRun(func(t *testing.T) {
+				if t.Failed() {
+					return
+				}
+				output := waitHealth(t, instanceName, tt.status)
+				if !strings.Contains(output, tt.output) {
+					t.Errorf("got health check output %q, want %q", output, tt.output)
+				}
+				if tt.stop {
+					c.stopInstance(t, instanceName)
+				}
+			}),
+			e2e.ExpectExit(0),
+		)
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("InvalidAction"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--health-cmd", "true", "--on-unhealthy", "kill", c.env.ImagePath, randomName(t)),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, `invalid unhealthy action "kill"`)),
+	)
+}
+
+// Test the generation of systemd units for instances.
+func (c *ctx) testInstanceGenerateUnit(t *testing.T) {
+	instanceName := randomName(t)
+
+	tests := []struct {
+		name   string
+		args   []string
+		exit   int
+		expect []e2e.ApptainerCmdResultOp
+	}{
+		{
+			name: "Default",
+			args: []string{"--user", c.env.ImagePath, instanceName},
+			expect: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectOutput(e2e.ContainMatch, "Type=forking"),
+				e2e.ExpectOutput(e2e.ContainMatch, "PIDFile=%t/apptainer-instance-"+instanceName+".pid"),
+				e2e.ExpectOutput(e2e.RegexMatch, `(?m)^ExecStart=\S+ instance start --pid-file=%t/\S+ `+regexp.QuoteMeta(c.env.ImagePath+" "+instanceName)+`$`),
+				e2e.ExpectOutput(e2e.RegexMatch, `(?m)^ExecStop=\S+ instance stop `+instanceName+`$`),
+				e2e.ExpectOutput(e2e.ContainMatch, "Restart=no"),
+				e2e.ExpectOutput(e2e.ContainMatch, "WantedBy=default.target"),
+			},
+		},
+		{
+			name: "StartOptions",
+			args: []string{"--system", "--bind", "/tmp:/data dir", "--restart", "on-failure:2", c.env.ImagePath, instanceName, "arg"},
+			expect: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectOutput(e2e.ContainMatch, `"--bind=/tmp:/data dir"`),
+				e2e.ExpectOutput(e2e.UnwantedContainMatch, "--restart"),
+				e2e.ExpectOutput(e2e.ContainMatch, "Restart=on-failure"),
+				e2e.ExpectOutput(e2e.ContainMatch, "StartLimitBurst=3"),
+				e2e.ExpectOutput(e2e.ContainMatch, instanceName+" arg\n"),
+				e2e.ExpectOutput(e2e.ContainMatch, "WantedBy=multi-user.target"),
+			},
+		},
+		{
+			name: "NowWithoutInstall",
+			args: []string{"--now", c.env.ImagePath, instanceName},
+			exit: 255,
+			expect: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "--now requires --install"),
+			},
+		},
+		{
+			name: "InvalidRestart",
+			args: []string{"--restart", "sometimes", c.env.ImagePath, instanceName},
+			exit: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance generate-unit"),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.exit, tt.expect...),
+		)
+	}
+}
+
 // Test creating many instances, but don't stop them.
 func (c *ctx) testCreateManyInstances(t *testing.T) {
 	const n = 10
@@ -143,6 +629,171 @@ func (c *ctx) testStopAll(t *testing.T) {
 	c.stopInstance(t, "", "--all")
 }
 
+// Test instance stop options: glob patterns, signal and timeout, and the
+// reported final status of the instances.
+func (c *ctx) testStopOptions(t *testing.T) {
+	dir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "instance-stop-", "")
+	defer e2e.Privileged(cleanup)
+
+	sandbox := filepath.Join(dir, "sandbox")
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("BuildSandbox"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+	if t.Failed() {
+		return
+	}
+
+	// a startscript ignoring SIGINT and SIGTERM
+	startscript := filepath.Join(sandbox, ".singularity.d", "startscript")
+	script := "#!/bin/sh\ntrap '' INT TERM\nwhile true; do sleep 1; done\n"
+	if err := os.WriteFile(startscript, []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write startscript: %s", err)
+	}
+
+	prefix := randomName(t)
+	names := []string{prefix + "-1", prefix + "-2"}
+	for _, name := range names {
+		c.env.RunApptainer(
+			t,
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance start"),
+			e2e.WithArgs(sandbox, name),
+			e2e.ExpectExit(0),
+		)
+	}
+	if t.Failed() {
+		return
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Timeout"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs("--signal", "SIGTERM", "--timeout", "2", "--all", prefix+"-*"),
+		e2e.PostRun(func(t *testing.T) {
+			c.expectInstance(t, prefix+"-*", 0)
+		}),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "did not stop within the timeout and were killed"),
+		),
+	)
+
+	name := randomName(t)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Force"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs(sandbox, name),
+		e2e.PostRun(func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			c.stopInstance(t, name, "--force", "--timeout", "2")
+		}),
+		e2e.ExpectExit(0),
+	)
+
+	// a startscript terminated by the stop signal, the final status of
+	// the instance is 128 plus the signal number
+	script = "#!/bin/sh\nwhile true; do sleep 1; done\n"
+	if err := os.WriteFile(startscript, []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write startscript: %s", err)
+	}
+	for _, sig := range []syscall.Signal{syscall.SIGTERM, syscall.SIGKILL} {
+		name := randomName(t)
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest("ExitStatus/"+unix.SignalName(sig)),
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance start"),
+			e2e.WithArgs(sandbox, name),
+			e2e.PostRun(func(t *testing.T) {
+				if t.Failed() {
+					return
+				}
+				c.env.RunApptainer(
+					t,
+					e2e.WithProfile(c.profile),
+					e2e.WithCommand("instance stop"),
+					e2e.WithArgs("--signal", unix.SignalName(sig), name),
+					e2e.ExpectExit(
+						0,
+						e2e.ExpectError(e2e.ContainMatch, fmt.Sprintf("exited with status %d", 128+int(sig))),
+					),
+				)
+				c.expectInstance(t, name, 0)
+			}),
+			e2e.ExpectExit(0),
+		)
+	}
+}
+
+// Test filtering the instance list and stop with --filter, along with the
+// --format and --quiet outputs.
+func (c *ctx) testInstanceFilter(t *testing.T) {
+	prefix := randomName(t)
+	names := []string{prefix + "-a", prefix + "-b"}
+	for _, name := range names {
+		c.env.RunApptainer(
+			t,
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance start"),
+			e2e.WithArgs(c.env.ImagePath, name),
+			e2e.ExpectExit(0),
+		)
+	}
+	if t.Failed() {
+		return
+	}
+
+	image := filepath.Base(c.env.ImagePath)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Quiet"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance list"),
+		e2e.WithArgs("-q", "--filter", "name="+prefix+"-*", "--filter", "image="+image, "--filter", "newer-than=1h"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, strings.Join(names, "\n"))),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("OlderThan"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance list"),
+		e2e.WithArgs("-q", "--filter", "older-than=1h", prefix+"-*"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, "")),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Format"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance list"),
+		e2e.WithArgs("--format", `{{.Name}}\t{{.Image}}`, names[0]),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.RegexMatch, `(?m)^`+names[0]+` +`+regexp.QuoteMeta(c.env.ImagePath)+`$`)),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Stop"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs("--all", "--filter", "name="+names[1], prefix+"-*"),
+		e2e.PostRun(func(t *testing.T) {
+			c.expectInstance(t, names[0], 1)
+			c.expectInstance(t, names[1], 0)
+		}),
+		e2e.ExpectExit(0),
+	)
+	c.stopInstance(t, names[0])
+}
+
 // Test basic options like mounting a custom home directory, changing the
 // hostname, etc.
 func (c *ctx) testBasicOptions(t *testing.T) {
@@ -285,82 +936,975 @@ func (c *ctx) testInstanceFromURI(t *testing.T) {
 	}
 }
 
-// Execute an instance process, kill master process
-// and try to start another instance with same name
-func (c *ctx) testGhostInstance(t *testing.T) {
-	cmdList := [2]string{"instance start", "instance run"}
+// Execute an instance process, kill master process
+// and try to start another instance with same name
+func (c *ctx) testGhostInstance(t *testing.T) {
+	cmdList := [2]string{"instance start", "instance run"}
+
+	for _, cmd := range cmdList {
+		// pick up a random name
+		instanceName := randomName(t)
+		pidfile := filepath.Join(c.env.TestDir, instanceName)
+
+		postFn := func(t *testing.T) {
+			defer os.Remove(pidfile)
+
+			if t.Failed() {
+				t.Fatalf("instance %s failed to start correctly", instanceName)
+			}
+
+			d, err := os.ReadFile(pidfile)
+			if err != nil {
+				t.Fatalf("failed to read pid file: %s", err)
+			}
+			trimmed := strings.TrimSuffix(string(d), "\n")
+			pid, err := strconv.ParseInt(trimmed, 10, 32)
+			if err != nil {
+				t.Fatalf("failed to convert PID %s in %s: %s", trimmed, pidfile, err)
+			}
+			ppid, err := proc.Getppid(int(pid))
+			if err != nil {
+				t.Fatalf("failed to get parent process ID for process %d: %s", pid, err)
+			}
+
+			// starting same instance twice must return an error
+			c.env.RunApptainer(
+				t,
+				e2e.WithProfile(c.profile),
+				e2e.WithCommand(cmd),
+				e2e.WithArgs(c.env.ImagePath, instanceName),
+				e2e.ExpectExit(
+					255,
+					e2e.ExpectErrorf(e2e.ContainMatch, "instance %s already exists", instanceName),
+				),
+			)
+
+			// kill master process
+			if err := syscall.Kill(int(ppid), syscall.SIGKILL); err != nil {
+				t.Fatalf("failed to send KILL signal to %d: %s", ppid, err)
+			}
+
+			// now check we are deleting ghost instance files correctly
+			c.env.RunApptainer(
+				t,
+				e2e.WithProfile(c.profile),
+				e2e.WithCommand(cmd),
+				e2e.WithArgs(c.env.ImagePath, instanceName),
+				e2e.PostRun(func(t *testing.T) {
+					if t.Failed() {
+						return
+					}
+					c.stopInstance(t, instanceName)
+				}),
+				e2e.ExpectExit(0),
+			)
+		}
+
+		c.env.RunApptainer(
+			t,
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand(cmd),
+			e2e.WithArgs("--pid-file", pidfile, c.env.ImagePath, instanceName),
+			e2e.PostRun(postFn),
+			e2e.ExpectExit(0),
+		)
+	}
+}
+
+// Test the cleanup of an instance whose starter process was killed.
+func (c *ctx) testInstanceCleanup(t *testing.T) {
+	instanceName := randomName(t)
+	pidfile := filepath.Join(c.env.TestDir, instanceName)
+
+	postFn := func(t *testing.T) {
+		defer os.Remove(pidfile)
+
+		if t.Failed() {
+			t.Fatalf("instance %s failed to start correctly", instanceName)
+		}
+
+		d, err := os.ReadFile(pidfile)
+		if err != nil {
+			t.Fatalf("failed to read pid file: %s", err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(d)))
+		if err != nil {
+			t.Fatalf("failed to convert PID in %s: %s", pidfile, err)
+		}
+		ppid, err := proc.Getppid(pid)
+		if err != nil {
+			t.Fatalf("failed to get parent process ID for process %d: %s", pid, err)
+		}
+
+		// kill the starter process, leaving the instance files behind
+		if err := syscall.Kill(ppid, syscall.SIGKILL); err != nil {
+			t.Fatalf("failed to send KILL signal to %d: %s", ppid, err)
+		}
+		for i := 0; syscall.Kill(pid, 0) != syscall.ESRCH; i++ {
+			if i == 50 {
+				t.Fatalf("instance process %d still running", pid)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest("DryRun"),
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance cleanup"),
+			e2e.WithArgs("--dry-run", instanceName),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectOutput(e2e.ContainMatch, "Stale "+instanceName+" instance"),
+			),
+		)
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest("Cleanup"),
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance cleanup"),
+			e2e.WithArgs(instanceName),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectError(e2e.ContainMatch, "Cleaned up stale "+instanceName+" instance"),
+			),
+		)
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest("NothingLeft"),
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance cleanup"),
+			e2e.WithArgs("--dry-run", instanceName),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectOutput(e2e.UnwantedContainMatch, instanceName),
+			),
+		)
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--pid-file", pidfile, c.env.ImagePath, instanceName),
+		e2e.PostRun(postFn),
+		e2e.ExpectExit(0),
+	)
+}
+
+// Test an instance not notifying its readiness before the ready timeout.
+func (c *ctx) testInstanceReadyTimeout(t *testing.T) {
+	dir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "instance-ready-", "")
+	defer e2e.Privileged(cleanup)
+
+	pidFile := filepath.Join(dir, "instance.pid")
+	instanceName := randomName(t)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Timeout"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--ready-timeout", "2", "--pid-file", pidFile, c.env.ImagePath, instanceName),
+		e2e.PostRun(func(t *testing.T) {
+			if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+				t.Errorf("pid file %s written for an instance not ready", pidFile)
+			}
+			c.expectInstance(t, instanceName, 0)
+		}),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "timeout waiting for instance readiness notification"),
+		),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("InvalidTimeout"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--ready-timeout", "-1", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "Invalid instance ready timeout")),
+	)
+}
+
+// Test root starting and stopping an instance on behalf of a user
+func (c *ctx) testInstanceUser(t *testing.T) {
+	if !c.profile.In(e2e.RootProfile) {
+		return
+	}
+	username := e2e.UserProfile.HostUser(t).Name
+	instanceName := randomName(t)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Start"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--user", username, c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+
+	// the instance belongs to the user
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("List"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("instance list"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ContainMatch, instanceName)),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Stop"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs("--user", username, instanceName),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("UnprivilegedUser"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--user", "root", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "Only root user can start instances on behalf of another user"),
+		),
+	)
+}
+
+// Test enabling an instance and starting the enabled instances
+func (c *ctx) testInstanceEnable(t *testing.T) {
+	if !c.profile.In(e2e.RootProfile) {
+		return
+	}
+	instanceName := randomName(t)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Start"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs(c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Enable"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance enable"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
+	defer c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Disable"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance disable"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("ListEnabled"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance list"),
+		e2e.WithArgs("--enabled", instanceName),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ContainMatch, instanceName)),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("DryRunRunning"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--enabled", "--dry-run"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.RegexMatch, instanceName+`\s+\S+\s+none \(running\)`)),
+	)
+
+	c.stopInstance(t, instanceName)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("DryRunStopped"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--enabled", "--dry-run"),
+		e2e.PostRun(func(t *testing.T) {
+			c.expectInstance(t, instanceName, 0)
+		}),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.RegexMatch, instanceName+`\s+\S+\s+start`)),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("StartEnabled"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--enabled"),
+		e2e.PostRun(func(t *testing.T) {
+			c.expectInstance(t, instanceName, 1)
+		}),
+		e2e.ExpectExit(0),
+	)
+
+	c.stopInstance(t, instanceName)
+}
+
+// Test instances when using an alternate configdir
+// Test inspecting the launch configuration of an instance
+func (c *ctx) testInstanceInspect(t *testing.T) {
+	instanceName := randomName(t)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Start"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--bind", "/tmp:/srv", "--env", "API_TOKEN=secret", "--env", "GREETING=hello", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Text"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance inspect"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "/tmp:/srv"),
+			e2e.ExpectOutput(e2e.ContainMatch, "GREETING=hello"),
+			e2e.ExpectOutput(e2e.ContainMatch, "API_TOKEN=<redacted>"),
+			e2e.ExpectOutput(e2e.UnwantedContainMatch, "secret"),
+		),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("JSON"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance inspect"),
+		e2e.WithArgs("--json", instanceName),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			var inspect struct {
+				Instance string `json:"instance"`
+				Details  *struct {
+					Version    string   `json:"version"`
+					Binds      []string `json:"binds"`
+					Namespaces []string `json:"namespaces"`
+					Mounts     []struct {
+						Destination string `json:"destination"`
+					} `json:"mounts"`
+				} `json:"details"`
+			}
+			if err := json.Unmarshal(r.Stdout, &inspect); err != nil {
+				t.Fatalf("could not decode instance inspect output: %s", err)
+			}
+			if inspect.Instance != instanceName {
+				t.Errorf("got instance %q, want %q", inspect.Instance, instanceName)
+			}
+			if inspect.Details == nil {
+				t.Fatalf("no launch configuration recorded")
+			}
+			if inspect.Details.Version == "" {
+				t.Errorf("no version recorded")
+			}
+			if len(inspect.Details.Binds) != 1 || inspect.Details.Binds[0] != "/tmp:/srv" {
+				t.Errorf("got binds %v, want [/tmp:/srv]", inspect.Details.Binds)
+			}
+			if len(inspect.Details.Namespaces) == 0 || inspect.Details.Namespaces[0] != "mount" {
+				t.Errorf("got namespaces %v, want mount namespace first", inspect.Details.Namespaces)
+			}
+		}),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Stop"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("NotFound"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance inspect"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "no instance found")),
+	)
+}
+
+// Test that apptainer top lists instances and registered containers
+func (c *ctx) testInstanceTop(t *testing.T) {
+	instanceName := randomName(t)
 
-	for _, cmd := range cmdList {
-		// pick up a random name
-		instanceName := randomName(t)
-		pidfile := filepath.Join(c.env.TestDir, instanceName)
+	runtimeDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "instance-top-", "")
+	defer e2e.Privileged(cleanup)
 
-		postFn := func(t *testing.T) {
-			defer os.Remove(pidfile)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Start"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs(c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
 
-			if t.Failed() {
-				t.Fatalf("instance %s failed to start correctly", instanceName)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Top"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("top"),
+		e2e.WithArgs("--json", "--interval", "500ms"),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			var containers []struct {
+				Name string `json:"name"`
+				Pids int    `json:"pids"`
+			}
+			if err := json.Unmarshal(r.Stdout, &containers); err != nil {
+				t.Fatalf("could not decode top output: %s", err)
+			}
+			for _, container := range containers {
+				if container.Name != instanceName {
+					continue
+				}
+				if container.Pids == 0 {
+					t.Errorf("no process reported for instance %s", instanceName)
+				}
+				return
 			}
+			t.Errorf("instance %s not found in top output", instanceName)
+		}),
+	)
 
-			d, err := os.ReadFile(pidfile)
-			if err != nil {
-				t.Fatalf("failed to read pid file: %s", err)
+	// the container registration is visible from the container itself
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Registration"),
+		e2e.WithProfile(c.profile),
+		e2e.WithEnv([]string{"XDG_RUNTIME_DIR=" + runtimeDir}),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--bind", runtimeDir+":/xdg", c.env.ImagePath, "ls", "/xdg/apptainer/containers"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.RegexMatch, `^[0-9]+\.json`)),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Stop"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
+}
+
+// Test passing a unix socket between an instance and another container
+// through the instance sockets directory
+func (c *ctx) testInstanceSockets(t *testing.T) {
+	instanceName := randomName(t)
+	socket := "/run/apptainer/instance/echo.sock"
+	var socketsDir string
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Start"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance run"),
+		e2e.WithArgs(c.env.ImagePath, instanceName, "nc", "-l", "-k", "-U", socket, "-e", "/bin/cat"),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("List"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance list"),
+		e2e.WithArgs("--json", instanceName),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			var list struct {
+				Instances []struct {
+					Sockets string `json:"sockets"`
+				} `json:"instances"`
 			}
-			trimmed := strings.TrimSuffix(string(d), "\n")
-			pid, err := strconv.ParseInt(trimmed, 10, 32)
+			if err := json.Unmarshal(r.Stdout, &list); err != nil {
+				t.Fatalf("could not decode instance list: %s", err)
+			}
+			if len(list.Instances) != 1 || list.Instances[0].Sockets == "" {
+				t.Fatalf("no sockets directory reported in %s", r.Stdout)
+			}
+			socketsDir = list.Instances[0].Sockets
+			fi, err := os.Stat(socketsDir)
 			if err != nil {
-				t.Fatalf("failed to convert PID %s in %s: %s", trimmed, pidfile, err)
+				t.Fatalf("could not stat sockets directory: %s", err)
 			}
-			ppid, err := proc.Getppid(int(pid))
+			if fi.Mode().Perm() != 0o700 {
+				t.Errorf("got mode %o for %s, want 700", fi.Mode().Perm(), socketsDir)
+			}
+		}),
+	)
+
+	// wait for the socket, then send a message through it
+	script := fmt.Sprintf("for i in $(seq 50); do test -S %[1]s && break; sleep 0.1; done; echo hello | nc -U %[1]s", socket)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("JoinSockets"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--join-sockets", instanceName, c.env.ImagePath, "/bin/sh", "-c", script),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, "hello")),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("JoinUnknown"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--join-sockets", instanceName+"-unknown", c.env.ImagePath, "true"),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "could not find instance")),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Stop"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs(instanceName),
+		e2e.PostRun(func(t *testing.T) {
+			if socketsDir == "" {
+				return
+			}
+			if _, err := os.Stat(socketsDir); !os.IsNotExist(err) {
+				t.Errorf("sockets directory %s not removed on instance stop", socketsDir)
+			}
+		}),
+		e2e.ExpectExit(0),
+	)
+}
+
+// Test publishing a port of an instance on the host with --publish, with
+// the rootless network backend in a user namespace and with the CNI
+// portmap plugin as root.
+func (c *ctx) testPublishPorts(t *testing.T) {
+	const (
+		hostPort      = 11400
+		containerPort = 8080
+	)
+	publish := fmt.Sprintf("%d:%d", hostPort, containerPort)
+
+	tests := []struct {
+		name     string
+		profile  e2e.Profile
+		requires func(t *testing.T)
+	}{
+		{
+			name:    "Rootless",
+			profile: e2e.UserNamespaceProfile,
+			requires: func(t *testing.T) {
+				if _, err := exec.LookPath("pasta"); err != nil {
+					require.Command(t, "slirp4netns")
+				}
+			},
+		},
+		{
+			name:     "CNI",
+			profile:  e2e.RootProfile,
+			requires: e2e.Privileged(require.Network),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.requires(t)
+			instanceName := randomName(t)
+
+			// the host port is already in use
+			l, err := net.Listen("tcp", fmt.Sprintf(":%d", hostPort))
 			if err != nil {
-				t.Fatalf("failed to get parent process ID for process %d: %s", pid, err)
+				t.Fatalf("could not listen on port %d: %s", hostPort, err)
 			}
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("Conflict"),
+				e2e.WithProfile(tt.profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--publish", publish, c.env.ImagePath, "true"),
+				e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "is not available")),
+			)
+			l.Close()
 
-			// starting same instance twice must return an error
 			c.env.RunApptainer(
 				t,
-				e2e.WithProfile(c.profile),
-				e2e.WithCommand(cmd),
-				e2e.WithArgs(c.env.ImagePath, instanceName),
-				e2e.ExpectExit(
-					255,
-					e2e.ExpectErrorf(e2e.ContainMatch, "instance %s already exists", instanceName),
-				),
+				e2e.AsSubtest("Start"),
+				e2e.WithProfile(tt.profile),
+				e2e.WithCommand("instance run"),
+				e2e.WithArgs("--publish", publish, c.env.ImagePath, instanceName,
+					"nc", "-l", "-k", "-p", strconv.Itoa(containerPort), "-e", "/bin/cat"),
+				e2e.PostRun(func(t *testing.T) {
+					if !t.Failed() {
+						echo(t, hostPort)
+					}
+				}),
+				e2e.ExpectExit(0),
 			)
 
-			// kill master process
-			if err := syscall.Kill(int(ppid), syscall.SIGKILL); err != nil {
-				t.Fatalf("failed to send KILL signal to %d: %s", ppid, err)
-			}
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("List"),
+				e2e.WithProfile(tt.profile),
+				e2e.WithCommand("instance list"),
+				e2e.WithArgs("--json", instanceName),
+				e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+					var list struct {
+						Instances []struct {
+							Ports []string `json:"ports"`
+						} `json:"instances"`
+					}
+					if err := json.Unmarshal(r.Stdout, &list); err != nil {
+						t.Fatalf("could not decode instance list: %s", err)
+					}
+					want := publish + "/tcp"
+					if len(list.Instances) != 1 || len(list.Instances[0].Ports) != 1 || list.Instances[0].Ports[0] != want {
+						t.Errorf("port %s not reported in %s", want, r.Stdout)
+					}
+				}),
+			)
 
-			// now check we are deleting ghost instance files correctly
 			c.env.RunApptainer(
 				t,
-				e2e.WithProfile(c.profile),
-				e2e.WithCommand(cmd),
-				e2e.WithArgs(c.env.ImagePath, instanceName),
+				e2e.AsSubtest("Stop"),
+				e2e.WithProfile(tt.profile),
+				e2e.WithCommand("instance stop"),
+				e2e.WithArgs(instanceName),
 				e2e.PostRun(func(t *testing.T) {
-					if t.Failed() {
-						return
+					// the forward is removed with the instance
+					for retries := 0; ; retries++ {
+						l, err := net.Listen("tcp", fmt.Sprintf(":%d", hostPort))
+						if err == nil {
+							l.Close()
+							break
+						} else if retries == 20 {
+							t.Errorf("host port %d not released on instance stop: %s", hostPort, err)
+							break
+						}
+						time.Sleep(100 * time.Millisecond)
 					}
-					c.stopInstance(t, instanceName)
 				}),
 				e2e.ExpectExit(0),
 			)
+		})
+	}
+}
+
+// testInstanceAddress checks that a named instance keeps its address on a
+// CNI network across starts, and that an address set with --ip can't be
+// taken by another instance until it's released.
+func (c *ctx) testInstanceAddress(t *testing.T) {
+	e2e.Privileged(require.Network)(t)
+
+	const ip = "10.22.0.250"
+	first := randomName(t)
+	second := randomName(t)
+
+	checkIP := func(name string) e2e.ApptainerCmdResultOp {
+		return func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			var list struct {
+				Instances []struct {
+					IP         string `json:"ip"`
+					Allocation *struct {
+						Network string `json:"network"`
+						IP      string `json:"ip"`
+					} `json:"allocation"`
+				} `json:"instances"`
+			}
+			if err := json.Unmarshal(r.Stdout, &list); err != nil {
+				t.Fatalf("could not decode instance list: %s", err)
+			}
+			if len(list.Instances) != 1 || list.Instances[0].IP != ip {
+				t.Fatalf("address %s of instance %s not reported in %s", ip, name, r.Stdout)
+			}
+			if a := list.Instances[0].Allocation; a == nil || a.IP != ip || a.Network != "bridge" {
+				t.Errorf("allocation of instance %s not reported in %s", name, r.Stdout)
+			}
 		}
+	}
+
+	steps := []struct {
+		name string
+		cmd  string
+		args []string
+		exit int
+		op   e2e.ApptainerCmdResultOp
+	}{
+		{
+			name: "StartWithIP",
+			cmd:  "instance start",
+			args: []string{"--net", "--network", "bridge", "--ip", ip, c.env.ImagePath, first},
+		},
+		{
+			name: "List",
+			cmd:  "instance list",
+			args: []string{"--json", first},
+			op:   checkIP(first),
+		},
+		{
+			name: "Conflict",
+			cmd:  "instance start",
+			args: []string{"--net", "--network", "bridge", "--ip", ip, c.env.ImagePath, second},
+			exit: 255,
+			op:   e2e.ExpectError(e2e.ContainMatch, "is allocated to instance "+first),
+		},
+		{
+			name: "Stop",
+			cmd:  "instance stop",
+			args: []string{first},
+		},
+		{
+			name: "Restart",
+			cmd:  "instance start",
+			args: []string{"--net", "--network", "bridge", c.env.ImagePath, first},
+		},
+		{
+			name: "ListRestarted",
+			cmd:  "instance list",
+			args: []string{"--json", first},
+			op:   checkIP(first),
+		},
+		{
+			name: "StopRelease",
+			cmd:  "instance stop",
+			args: []string{"--release-ip", first},
+		},
+		{
+			name: "StartReleased",
+			cmd:  "instance start",
+			args: []string{"--net", "--network", "bridge", "--ip", ip, c.env.ImagePath, second},
+		},
+		{
+			name: "StopSecond",
+			cmd:  "instance stop",
+			args: []string{second},
+		},
+		{
+			// the address of a stopped instance can be released
+			name: "ReleaseStopped",
+			cmd:  "instance stop",
+			args: []string{"--release-ip", second},
+		},
+		{
+			name: "NothingToRelease",
+			cmd:  "instance stop",
+			args: []string{"--release-ip", second},
+			exit: 255,
+			op:   e2e.ExpectError(e2e.ContainMatch, "no instance found"),
+		},
+	}
 
+	for _, s := range steps {
+		var ops []e2e.ApptainerCmdResultOp
+		if s.op != nil {
+			ops = append(ops, s.op)
+		}
 		c.env.RunApptainer(
 			t,
-			e2e.WithProfile(c.profile),
-			e2e.WithCommand(cmd),
-			e2e.WithArgs("--pid-file", pidfile, c.env.ImagePath, instanceName),
-			e2e.PostRun(postFn),
+			e2e.AsSubtest(s.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand(s.cmd),
+			e2e.WithArgs(s.args...),
+			e2e.ExpectExit(s.exit, ops...),
+		)
+	}
+}
+
+// testUserNetwork checks that two instances started on a network created
+// with 'network create' reach each other, and that the network can't be
+// removed while they are running.
+func (c *ctx) testUserNetwork(t *testing.T) {
+	e2e.Privileged(require.Network)(t)
+
+	const (
+		subnet = "10.88.1.0/24"
+		ip     = "10.88.1.10"
+	)
+	netName := randomName(t)
+	first := randomName(t)
+	second := randomName(t)
+
+	defer c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("network remove"),
+		e2e.WithArgs(netName),
+		e2e.ExpectExit(0),
+	)
+
+	steps := []struct {
+		name string
+		cmd  string
+		args []string
+		exit int
+		op   e2e.ApptainerCmdResultOp
+	}{
+		{
+			name: "Create",
+			cmd:  "network create",
+			args: []string{"--subnet", subnet, netName},
+		},
+		{
+			name: "CreateOverlap",
+			cmd:  "network create",
+			args: []string{"--subnet", "10.88.1.128/25", randomName(t)},
+			exit: 255,
+			op:   e2e.ExpectError(e2e.ContainMatch, "overlaps with subnet "+subnet+" of network "+netName),
+		},
+		{
+			name: "List",
+			cmd:  "network list",
+			op:   e2e.ExpectOutput(e2e.RegexMatch, `(?m)^`+netName+`\s+system\s+`+subnet),
+		},
+		{
+			name: "StartFirst",
+			cmd:  "instance start",
+			args: []string{"--net", "--network", netName, "--ip", ip, c.env.ImagePath, first},
+		},
+		{
+			name: "StartSecond",
+			cmd:  "instance start",
+			args: []string{"--net", "--network", netName, c.env.ImagePath, second},
+		},
+		{
+			name: "Connectivity",
+			cmd:  "exec",
+			args: []string{"instance://" + second, "ping", "-c", "1", "-W", "5", ip},
+		},
+		{
+			name: "RemoveAttached",
+			cmd:  "network remove",
+			args: []string{netName},
+			exit: 255,
+			op:   e2e.ExpectError(e2e.ContainMatch, "is used by instance(s)"),
+		},
+		{
+			name: "StopFirst",
+			cmd:  "instance stop",
+			args: []string{"--release-ip", first},
+		},
+		{
+			name: "StopSecond",
+			cmd:  "instance stop",
+			args: []string{second},
+		},
+	}
+
+	for _, s := range steps {
+		var ops []e2e.ApptainerCmdResultOp
+		if s.op != nil {
+			ops = append(ops, s.op)
+		}
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(s.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand(s.cmd),
+			e2e.WithArgs(s.args...),
+			e2e.ExpectExit(s.exit, ops...),
+		)
+	}
+}
+
+// testPastaNetwork checks the outbound connectivity and the published
+// ports of containers using the pasta rootless network.
+func (c *ctx) testPastaNetwork(t *testing.T) {
+	require.Command(t, "pasta")
+
+	const (
+		hostPort      = 11410
+		containerPort = 8080
+		// outbound is the address used to check the outbound connectivity
+		outbound = "1.1.1.1:53"
+	)
+	publish := fmt.Sprintf("%d:%d", hostPort, containerPort)
+	instanceName := randomName(t)
+
+	if conn, err := net.DialTimeout("tcp", outbound, 5*time.Second); err != nil {
+		t.Logf("Skipping outbound connectivity check, %s is unreachable: %s", outbound, err)
+	} else {
+		conn.Close()
+		host, port, _ := net.SplitHostPort(outbound)
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest("Outbound"),
+			e2e.WithProfile(e2e.UserNamespaceProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--network", "pasta", c.env.ImagePath, "sh", "-c", "echo | nc -w 5 "+host+" "+port),
 			e2e.ExpectExit(0),
 		)
 	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Start"),
+		e2e.WithProfile(e2e.UserNamespaceProfile),
+		e2e.WithCommand("instance run"),
+		e2e.WithArgs("--network", "pasta", "--publish", publish, c.env.ImagePath, instanceName,
+			"nc", "-l", "-k", "-p", strconv.Itoa(containerPort), "-e", "/bin/cat"),
+		e2e.PostRun(func(t *testing.T) {
+			if !t.Failed() {
+				echo(t, hostPort)
+			}
+		}),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("List"),
+		e2e.WithProfile(e2e.UserNamespaceProfile),
+		e2e.WithCommand("instance list"),
+		e2e.WithArgs("--json", instanceName),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			var list struct {
+				Instances []struct {
+					IP    string   `json:"ip"`
+					Ports []string `json:"ports"`
+				} `json:"instances"`
+			}
+			if err := json.Unmarshal(r.Stdout, &list); err != nil {
+				t.Fatalf("could not decode instance list: %s", err)
+			}
+			if len(list.Instances) != 1 {
+				t.Fatalf("instance %s not listed in %s", instanceName, r.Stdout)
+			}
+			// the address assigned by pasta is reported
+			if net.ParseIP(list.Instances[0].IP) == nil {
+				t.Errorf("no IP address reported in %s", r.Stdout)
+			}
+			want := publish + "/tcp"
+			if len(list.Instances[0].Ports) != 1 || list.Instances[0].Ports[0] != want {
+				t.Errorf("port %s not reported in %s", want, r.Stdout)
+			}
+		}),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Stop"),
+		e2e.WithProfile(e2e.UserNamespaceProfile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
 }
 
-// Test instances when using an alternate configdir
 func (c *ctx) testInstanceWithConfigDir(t *testing.T) {
 	dir, err := os.MkdirTemp(c.env.TestDir, "InstanceWithConfigDir")
 	if err != nil {
@@ -394,6 +1938,82 @@ func (c *ctx) testInstanceWithConfigDir(t *testing.T) {
 	})(t)
 }
 
+// Test that a disk backed session directory left by a killed instance
+// is removed by the next container using the same --sessiondir.
+func (c *ctx) testSessionDirCleanup(t *testing.T) {
+	sessionDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "sessiondir-", "session directory")
+	defer cleanup(t)
+
+	instanceName := randomName(t)
+	pidfile := filepath.Join(c.env.TestDir, instanceName)
+
+	sessions := func(t *testing.T) []string {
+		matches, err := filepath.Glob(filepath.Join(sessionDir, "apptainer-session-*"))
+		if err != nil {
+			t.Fatalf("failed to list session directories: %s", err)
+		}
+		return matches
+	}
+
+	postFn := func(t *testing.T) {
+		defer os.Remove(pidfile)
+
+		if t.Failed() {
+			t.Fatalf("instance %s failed to start correctly", instanceName)
+		}
+
+		if n := len(sessions(t)); n != 1 {
+			t.Fatalf("expected 1 session directory in %s, found %d", sessionDir, n)
+		}
+
+		d, err := os.ReadFile(pidfile)
+		if err != nil {
+			t.Fatalf("failed to read pid file: %s", err)
+		}
+		trimmed := strings.TrimSuffix(string(d), "\n")
+		pid, err := strconv.ParseInt(trimmed, 10, 32)
+		if err != nil {
+			t.Fatalf("failed to convert PID %s in %s: %s", trimmed, pidfile, err)
+		}
+		ppid, err := proc.Getppid(int(pid))
+		if err != nil {
+			t.Fatalf("failed to get parent process ID for process %d: %s", pid, err)
+		}
+
+		// kill master process, no cleanup happens
+		if err := syscall.Kill(int(ppid), syscall.SIGKILL); err != nil {
+			t.Fatalf("failed to send KILL signal to %d: %s", ppid, err)
+		}
+
+		// the stale session directory is removed when the next
+		// container starts and its own on exit
+		c.env.RunApptainer(
+			t,
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--sessiondir", sessionDir, c.env.ImagePath, "true"),
+			e2e.PostRun(func(t *testing.T) {
+				if t.Failed() {
+					return
+				}
+				if left := sessions(t); len(left) != 0 {
+					t.Errorf("session directories not removed: %v", left)
+				}
+			}),
+			e2e.ExpectExit(0),
+		)
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--sessiondir", sessionDir, "--pid-file", pidfile, c.env.ImagePath, instanceName),
+		e2e.PostRun(postFn),
+		e2e.ExpectExit(0),
+	)
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := &ctx{
@@ -420,10 +2040,25 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 				{"InstanceFromURI", c.testInstanceFromURI},
 				{"CreateManyInstances", c.testCreateManyInstances},
 				{"InstanceRun", c.testInstanceRun},
+				{"InstanceRunRunscriptOnly", c.testInstanceRunRunscriptOnly},
+				{"InstanceRestart", c.testInstanceRestart},
+				{"InstanceLogs", c.testInstanceLogs},
+				{"InstanceGenerateUnit", c.testInstanceGenerateUnit},
+				{"InstanceHealth", c.testInstanceHealth},
+				{"InstanceReadyTimeout", c.testInstanceReadyTimeout},
+				{"StopOptions", c.testStopOptions},
+				{"InstanceFilter", c.testInstanceFilter},
+				{"InstanceUser", c.testInstanceUser},
+				{"InstanceEnable", c.testInstanceEnable},
+				{"InstanceInspect", c.testInstanceInspect},
+				{"InstanceTop", c.testInstanceTop},
+				{"InstanceSockets", c.testInstanceSockets},
 				{"StopAll", c.testStopAll},
 				{"GhostInstance", c.testGhostInstance},
+				{"InstanceCleanup", c.testInstanceCleanup},
 				{"CheckpointInstance", c.testCheckpointInstance},
 				{"InstanceWithConfigDir", c.testInstanceWithConfigDir},
+				{"SessionDirCleanup", c.testSessionDirCleanup},
 			}
 
 			profiles := []e2e.Profile{
@@ -440,6 +2075,10 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 				})
 			}
 		},
+		"publish":    c.testPublishPorts,
+		"pasta":      c.testPastaNetwork,
+		"address":    c.testInstanceAddress,
+		"network":    c.testUserNetwork,
 		"issue 5033": c.issue5033, // https://github.com/apptainer/singularity/issues/4836
 	}
 }
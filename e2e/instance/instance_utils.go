@@ -27,6 +27,15 @@ type instance struct {
 	Image    string `json:"img"`
 	Instance string `json:"instance"`
 	Pid      int    `json:"pid"`
+	Script   string `json:"script"`
+	Restart  string `json:"restart"`
+	Restarts int    `json:"restarts"`
+	LastExit *int   `json:"lastExitStatus"`
+	Health   *struct {
+		Status        string `json:"status"`
+		FailingStreak int    `json:"failingStreak"`
+		LastOutput    string `json:"lastOutput"`
+	} `json:"health"`
 }
 
 type instanceList struct {
@@ -99,6 +108,27 @@ func (c *ctx) expectInstance(t *testing.T, name string, nb int) {
 	)
 }
 
+// Returns the instance with the provided name, if any.
+func (c *ctx) getInstance(t *testing.T, name string) (inst instance, found bool) {
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance list"),
+		e2e.WithArgs("--json", name),
+		e2e.WithEnv(c.withEnv),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			var instances instanceList
+			if err := json.Unmarshal([]byte(r.Stdout), &instances); err != nil {
+				t.Errorf("Error while decoding JSON from 'instance list': %v", err)
+			}
+			if len(instances.Instances) == 1 {
+				inst, found = instances.Instances[0], true
+			}
+		}),
+	)
+	return
+}
+
 // Sends a deterministic message to an echo server and expects the same message
 // in response.
 func echo(t *testing.T, port int) {
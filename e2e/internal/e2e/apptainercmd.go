@@ -292,6 +292,8 @@ type apptainerCmd struct {
 	result        *ApptainerCmdResult
 	t             *testing.T
 	profile       Profile
+	signal        os.Signal
+	signalDelay   time.Duration
 }
 
 // AsSubtest requests the command to be run as a subtest
@@ -410,6 +412,15 @@ func PostRun(fn func(*testing.T)) ApptainerCmdOp {
 	}
 }
 
+// SignalAfter sends the signal sig to the apptainer command once delay
+// has elapsed since its start, if it's still running.
+func SignalAfter(delay time.Duration, sig os.Signal) ApptainerCmdOp {
+	return func(s *apptainerCmd) {
+		s.signal = sig
+		s.signalDelay = delay
+	}
+}
+
 // ExpectExit is called once the command completed and before
 // PostRun function in order to check the exit code returned. This
 // function is always required by RunCommand and can call additional
@@ -471,6 +482,46 @@ func ExpectExit(code int, resultOps ...ApptainerCmdResultOp) ApptainerCmdOp {
 	}
 }
 
+// exitCode returns the exit code of a command from the error returned
+// by its wait, or -1 if the command wasn't executed.
+func exitCode(waitErr error) int {
+	if waitErr == nil {
+		return 0
+	}
+	if x, ok := errors.Cause(waitErr).(*exec.ExitError); ok {
+		if status, ok := x.Sys().(syscall.WaitStatus); ok {
+			if status.Signaled() {
+				return 128 + int(status.Signal())
+			}
+			return status.ExitStatus()
+		}
+	}
+	return -1
+}
+
+// ExpectExitIn is like ExpectExit for a command which may exit with any
+// of the codes, like when its outcome depends on the timing of a signal.
+func ExpectExitIn(codes []int, resultOps ...ApptainerCmdResultOp) ApptainerCmdOp {
+	return func(s *apptainerCmd) {
+		if s.resultFn == nil {
+			s.resultFn = ExpectExitIn(codes, resultOps...)
+			return
+		}
+
+		code := exitCode(s.waitErr)
+		for _, c := range codes {
+			if c == code {
+				ExpectExit(code, resultOps...)(s)
+				return
+			}
+		}
+
+		s.t.Helper()
+		s.t.Logf("\n%q output:\n%s%s\n", s.result.FullCmd, string(s.result.Stderr), string(s.result.Stdout))
+		s.t.Errorf("got %d as exit code and was expecting one of %v: %+v", code, codes, s.waitErr)
+	}
+}
+
 // RunApptainer executes an Apptainer command within a test execution
 // context.
 //
@@ -666,6 +717,13 @@ func (env TestEnv) RunApptainer(t *testing.T, cmdOps ...ApptainerCmdOp) {
 				return
 			}
 		} else {
+			if s.signal != nil {
+				timer := time.AfterFunc(s.signalDelay, func() {
+					t.Logf("Sending %s to command %q", s.signal, s.result.FullCmd)
+					cmd.Process.Signal(s.signal)
+				})
+				defer timer.Stop()
+			}
 			s.waitErr = errors.Wrapf(cmd.Wait(), "waiting for command %q", s.result.FullCmd)
 		}
 
@@ -10,7 +10,12 @@
 package e2e
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
@@ -92,3 +97,51 @@ func PathPerms(t *testing.T, path string, perms os.FileMode) bool {
 
 	return s.Mode().Perm() == perms
 }
+
+// ContentDigest returns a digest of the paths, types, permissions, link
+// targets and file contents of the directory tree dir, ignoring the
+// excluded paths relative to dir.
+func ContentDigest(t *testing.T, dir string, exclude ...string) string {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		for _, e := range exclude {
+			if rel != e {
+				continue
+			}
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fmt.Fprintf(h, "%s %s\n", rel, fi.Mode())
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(h, target)
+		case fi.Mode().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("While computing content digest of %s: %v", dir, err)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,464 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package e2e
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The FUSE operations served by the limited filesystem, the others fail
+// with ENOSYS.
+const (
+	fuseLookup      = 1
+	fuseForget      = 2
+	fuseGetattr     = 3
+	fuseReadlink    = 5
+	fuseOpen        = 14
+	fuseRead        = 15
+	fuseStatfs      = 17
+	fuseRelease     = 18
+	fuseFlush       = 25
+	fuseInit        = 26
+	fuseOpendir     = 27
+	fuseReaddir     = 28
+	fuseReleasedir  = 29
+	fuseAccess      = 34
+	fuseInterrupt   = 36
+	fuseDestroy     = 38
+	fuseBatchForget = 42
+
+	fuseRootID = 1
+	// fopenDirectIO makes the kernel bypass the page cache for the
+	// opened files, which also disables their shared memory mappings.
+	fopenDirectIO = 1 << 0
+	fuseMaxWrite  = 128 << 10
+)
+
+type fuseInHeader struct {
+	Len     uint32
+	Opcode  uint32
+	Unique  uint64
+	NodeID  uint64
+	UID     uint32
+	GID     uint32
+	PID     uint32
+	Padding uint32
+}
+
+type fuseOutHeader struct {
+	Len    uint32
+	Error  int32
+	Unique uint64
+}
+
+type fuseAttr struct {
+	Ino       uint64
+	Size      uint64
+	Blocks    uint64
+	Atime     uint64
+	Mtime     uint64
+	Ctime     uint64
+	Atimensec uint32
+	Mtimensec uint32
+	Ctimensec uint32
+	Mode      uint32
+	Nlink     uint32
+	UID       uint32
+	GID       uint32
+	Rdev      uint32
+	Blksize   uint32
+	Flags     uint32
+}
+
+type fuseEntryOut struct {
+	NodeID         uint64
+	Generation     uint64
+	EntryValid     uint64
+	AttrValid      uint64
+	EntryValidNsec uint32
+	AttrValidNsec  uint32
+	Attr           fuseAttr
+}
+
+type fuseAttrOut struct {
+	AttrValid     uint64
+	AttrValidNsec uint32
+	Dummy         uint32
+	Attr          fuseAttr
+}
+
+type fuseInitIn struct {
+	Major        uint32
+	Minor        uint32
+	MaxReadahead uint32
+	Flags        uint32
+}
+
+type fuseInitOut struct {
+	Major               uint32
+	Minor               uint32
+	MaxReadahead        uint32
+	Flags               uint32
+	MaxBackground       uint16
+	CongestionThreshold uint16
+	MaxWrite            uint32
+	TimeGran            uint32
+	MaxPages            uint16
+	MapAlignment        uint16
+	Flags2              uint32
+	Unused              [7]uint32
+}
+
+type fuseOpenIn struct {
+	Flags  uint32
+	Unused uint32
+}
+
+type fuseOpenOut struct {
+	Fh        uint64
+	OpenFlags uint32
+	Padding   uint32
+}
+
+type fuseReadIn struct {
+	Fh        uint64
+	Offset    uint64
+	Size      uint32
+	ReadFlags uint32
+	LockOwner uint64
+	Flags     uint32
+	Padding   uint32
+}
+
+type fuseKstatfs struct {
+	Blocks  uint64
+	Bfree   uint64
+	Bavail  uint64
+	Files   uint64
+	Ffree   uint64
+	Bsize   uint32
+	Namelen uint32
+	Frsize  uint32
+	Padding uint32
+	Spare   [6]uint32
+}
+
+// fuseEndian is the byte order of the FUSE protocol, the native one.
+var fuseEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		fuseEndian = binary.BigEndian
+	}
+}
+
+// limitedFs is a read-only FUSE passthrough filesystem serving its files
+// with direct I/O only, without the shared memory mappings and the page
+// cache the kernel needs to reliably attach them to a loop device, like the
+// s3fs or rclone mounts of object stores.
+type limitedFs struct {
+	fd     int
+	paths  map[uint64]string
+	ids    map[string]uint64
+	files  map[uint64]*os.File
+	nextID uint64
+	nextFh uint64
+}
+
+// MountLimitedFs mounts at target a limited FUSE passthrough filesystem of
+// the directory source, which is unmounted at the end of the test. It must
+// be called with privileges, see Privileged.
+func MountLimitedFs(t *testing.T, source, target string) {
+	t.Helper()
+
+	fd, err := unix.Open("/dev/fuse", unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("could not open /dev/fuse: %s", err)
+	}
+	opts := fmt.Sprintf("fd=%d,rootmode=40000,user_id=0,group_id=0,allow_other,default_permissions", fd)
+	if err := unix.Mount("e2e-limitedfs", target, "fuse.e2e-limitedfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_RDONLY, opts); err != nil {
+		unix.Close(fd)
+		t.Fatalf("could not mount limited filesystem on %s: %s", target, err)
+	}
+
+	fs := &limitedFs{
+		fd:     fd,
+		paths:  map[uint64]string{fuseRootID: source},
+		ids:    map[string]uint64{source: fuseRootID},
+		files:  make(map[uint64]*os.File),
+		nextID: fuseRootID + 1,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fs.serve()
+	}()
+
+	t.Cleanup(func() {
+		Privileged(func(t *testing.T) {
+			if err := unix.Unmount(target, 0); err != nil {
+				t.Errorf("could not unmount limited filesystem on %s: %s", target, err)
+			}
+		})(t)
+		<-done
+		unix.Close(fd)
+	})
+}
+
+// serve serves the requests of the kernel until the filesystem is
+// unmounted.
+func (fs *limitedFs) serve() {
+	defer func() {
+		for _, f := range fs.files {
+			f.Close()
+		}
+	}()
+
+	buf := make([]byte, fuseMaxWrite+4096)
+	for {
+		n, err := unix.Read(fs.fd, buf)
+		if err == unix.EINTR || err == unix.ENOENT {
+			// interrupted read or request aborted by the kernel
+			continue
+		} else if err != nil {
+			// ENODEV once unmounted
+			return
+		}
+
+		var hdr fuseInHeader
+		r := bytes.NewReader(buf[:n])
+		if err := binary.Read(r, fuseEndian, &hdr); err != nil {
+			return
+		}
+		switch hdr.Opcode {
+		case fuseForget, fuseBatchForget, fuseInterrupt:
+			// no reply expected
+			continue
+		}
+		out, errno := fs.handle(hdr, r, buf[binary.Size(hdr):n])
+		fs.reply(hdr.Unique, out, errno)
+	}
+}
+
+// reply sends the reply to the request unique, with the result out
+// encoded, or the error errno.
+func (fs *limitedFs) reply(unique uint64, out interface{}, errno syscall.Errno) {
+	var payload bytes.Buffer
+	if errno == 0 {
+		switch v := out.(type) {
+		case nil:
+		case []byte:
+			payload.Write(v)
+		default:
+			binary.Write(&payload, fuseEndian, v)
+		}
+	}
+	hdr := fuseOutHeader{
+		Len:    uint32(binary.Size(fuseOutHeader{}) + payload.Len()),
+		Error:  -int32(errno),
+		Unique: unique,
+	}
+	var b bytes.Buffer
+	binary.Write(&b, fuseEndian, hdr)
+	b.Write(payload.Bytes())
+	unix.Write(fs.fd, b.Bytes())
+}
+
+// handle handles a request, whose arguments are read from r, or found raw
+// in body.
+func (fs *limitedFs) handle(hdr fuseInHeader, r io.Reader, body []byte) (interface{}, syscall.Errno) {
+	path, ok := fs.paths[hdr.NodeID]
+	if !ok && hdr.Opcode != fuseInit && hdr.Opcode != fuseDestroy {
+		return nil, unix.ENOENT
+	}
+
+	switch hdr.Opcode {
+	case fuseInit:
+		var in fuseInitIn
+		if err := binary.Read(r, fuseEndian, &in); err != nil {
+			return nil, unix.EIO
+		}
+		return &fuseInitOut{
+			Major:        7,
+			Minor:        31,
+			MaxReadahead: in.MaxReadahead,
+			MaxWrite:     fuseMaxWrite,
+			TimeGran:     1,
+		}, 0
+	case fuseLookup:
+		name := string(bytes.TrimRight(body, "\x00"))
+		p := filepath.Join(path, name)
+		var st unix.Stat_t
+		if err := unix.Lstat(p, &st); err != nil {
+			return nil, errno(err)
+		}
+		id, ok := fs.ids[p]
+		if !ok {
+			id = fs.nextID
+			fs.nextID++
+			fs.ids[p] = id
+			fs.paths[id] = p
+		}
+		return &fuseEntryOut{NodeID: id, EntryValid: 1, AttrValid: 1, Attr: fuseAttrOf(&st)}, 0
+	case fuseGetattr:
+		var st unix.Stat_t
+		if err := unix.Lstat(path, &st); err != nil {
+			return nil, errno(err)
+		}
+		return &fuseAttrOut{AttrValid: 1, Attr: fuseAttrOf(&st)}, 0
+	case fuseReadlink:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, errno(err)
+		}
+		return []byte(target), 0
+	case fuseOpen:
+		var in fuseOpenIn
+		if err := binary.Read(r, fuseEndian, &in); err != nil {
+			return nil, unix.EIO
+		}
+		if in.Flags&unix.O_ACCMODE != unix.O_RDONLY {
+			return nil, unix.EROFS
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errno(err)
+		}
+		fs.nextFh++
+		fs.files[fs.nextFh] = f
+		return &fuseOpenOut{Fh: fs.nextFh, OpenFlags: fopenDirectIO}, 0
+	case fuseRead:
+		var in fuseReadIn
+		if err := binary.Read(r, fuseEndian, &in); err != nil {
+			return nil, unix.EIO
+		}
+		f, ok := fs.files[in.Fh]
+		if !ok {
+			return nil, unix.EBADF
+		}
+		data := make([]byte, in.Size)
+		n, err := f.ReadAt(data, int64(in.Offset))
+		if err != nil && err != io.EOF {
+			return nil, errno(err)
+		}
+		return data[:n], 0
+	case fuseRelease:
+		var fh uint64
+		if err := binary.Read(r, fuseEndian, &fh); err != nil {
+			return nil, unix.EIO
+		}
+		if f, ok := fs.files[fh]; ok {
+			f.Close()
+			delete(fs.files, fh)
+		}
+		return nil, 0
+	case fuseOpendir:
+		return &fuseOpenOut{}, 0
+	case fuseReaddir:
+		var in fuseReadIn
+		if err := binary.Read(r, fuseEndian, &in); err != nil {
+			return nil, unix.EIO
+		}
+		return fs.readdir(path, in.Offset, in.Size)
+	case fuseStatfs:
+		var st unix.Statfs_t
+		if err := unix.Statfs(path, &st); err != nil {
+			return nil, errno(err)
+		}
+		return &fuseKstatfs{
+			Blocks:  st.Blocks,
+			Bfree:   st.Bfree,
+			Bavail:  st.Bavail,
+			Files:   st.Files,
+			Ffree:   st.Ffree,
+			Bsize:   uint32(st.Bsize),
+			Namelen: uint32(st.Namelen),
+			Frsize:  uint32(st.Frsize),
+		}, 0
+	case fuseFlush, fuseReleasedir, fuseAccess, fuseDestroy:
+		return nil, 0
+	}
+	return nil, unix.ENOSYS
+}
+
+// readdir returns the directory entries of path from offset, up to size
+// bytes.
+func (fs *limitedFs) readdir(path string, offset uint64, size uint32) (interface{}, syscall.Errno) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, errno(err)
+	}
+	names := []string{".", ".."}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	var b bytes.Buffer
+	for i := offset; i < uint64(len(names)); i++ {
+		var st unix.Stat_t
+		if err := unix.Lstat(filepath.Join(path, names[i]), &st); err != nil {
+			continue
+		}
+		// struct fuse_dirent, aligned on 8 bytes
+		entry := make([]byte, 24+len(names[i]))
+		fuseEndian.PutUint64(entry, st.Ino)
+		fuseEndian.PutUint64(entry[8:], i+1)
+		fuseEndian.PutUint32(entry[16:], uint32(len(names[i])))
+		fuseEndian.PutUint32(entry[20:], (st.Mode&unix.S_IFMT)>>12)
+		copy(entry[24:], names[i])
+		entry = append(entry, make([]byte, (8-len(entry)%8)%8)...)
+		if b.Len()+len(entry) > int(size) {
+			break
+		}
+		b.Write(entry)
+	}
+	return b.Bytes(), 0
+}
+
+// fuseAttrOf returns the FUSE attributes of a file from its status.
+func fuseAttrOf(st *unix.Stat_t) fuseAttr {
+	return fuseAttr{
+		Ino:       st.Ino,
+		Size:      uint64(st.Size),
+		Blocks:    uint64(st.Blocks),
+		Atime:     uint64(st.Atim.Sec),
+		Mtime:     uint64(st.Mtim.Sec),
+		Ctime:     uint64(st.Ctim.Sec),
+		Atimensec: uint32(st.Atim.Nsec),
+		Mtimensec: uint32(st.Mtim.Nsec),
+		Ctimensec: uint32(st.Ctim.Nsec),
+		Mode:      st.Mode,
+		Nlink:     uint32(st.Nlink),
+		UID:       st.Uid,
+		GID:       st.Gid,
+		Rdev:      uint32(st.Rdev),
+		Blksize:   uint32(st.Blksize),
+	}
+}
+
+// errno returns the error number of err, or EIO.
+func errno(err error) syscall.Errno {
+	var e syscall.Errno
+	if errors.As(err, &e) {
+		return e
+	}
+	return unix.EIO
+}
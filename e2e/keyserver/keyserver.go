@@ -51,8 +51,8 @@ func (c ctx) keyserver(t *testing.T) {
 			args:    []string{"--insecure", testKeyserver},
 			listLines: []string{
 				"DefaultRemote*",
-				"   #1  https://keys.openpgp.org  🔒",
-				"   #2  http://localhost:11371",
+				"   #1  https://keys.openpgp.org  🔒  verify,push,search",
+				"   #2  http://localhost:11371       verify,push,search",
 			},
 			expectExit: 0,
 			profile:    e2e.RootProfile,
@@ -84,8 +84,8 @@ func (c ctx) keyserver(t *testing.T) {
 			args:    []string{"--order", "1", testKeyserver},
 			listLines: []string{
 				"DefaultRemote*",
-				"   #1  http://localhost:11371    🔒",
-				"   #2  https://keys.openpgp.org  🔒",
+				"   #1  http://localhost:11371    🔒  verify,push,search",
+				"   #2  https://keys.openpgp.org  🔒  verify,push,search",
 			},
 			expectExit: 0,
 			profile:    e2e.RootProfile,
@@ -103,7 +103,7 @@ func (c ctx) keyserver(t *testing.T) {
 			args:    []string{apptainerKeyserver},
 			listLines: []string{
 				"DefaultRemote*",
-				"   #1  http://localhost:11371  🔒",
+				"   #1  http://localhost:11371  🔒  verify,push,search",
 			},
 			expectExit: 0,
 			profile:    e2e.RootProfile,
@@ -121,8 +121,8 @@ func (c ctx) keyserver(t *testing.T) {
 			args:    []string{apptainerKeyserver},
 			listLines: []string{
 				"DefaultRemote*",
-				"   #1  http://localhost:11371    🔒",
-				"   #2  https://keys.openpgp.org  🔒",
+				"   #1  http://localhost:11371    🔒  verify,push,search",
+				"   #2  https://keys.openpgp.org  🔒  verify,push,search",
 			},
 			expectExit: 0,
 			profile:    e2e.RootProfile,
@@ -133,11 +133,30 @@ func (c ctx) keyserver(t *testing.T) {
 			args:    []string{testKeyserver},
 			listLines: []string{
 				"DefaultRemote*",
-				"   #1  https://keys.openpgp.org  🔒",
+				"   #1  https://keys.openpgp.org  🔒  verify,push,search",
 			},
 			expectExit: 0,
 			profile:    e2e.RootProfile,
 		},
+		{
+			name:    "add verify only",
+			command: addKeyserver,
+			args:    []string{"--insecure", "--no-push", "--no-search", testKeyserver},
+			listLines: []string{
+				"DefaultRemote*",
+				"   #1  https://keys.openpgp.org  🔒  verify,push,search",
+				"   #2  http://localhost:11371       verify",
+			},
+			expectExit: 0,
+			profile:    e2e.RootProfile,
+		},
+		{
+			name:       "remove verify only",
+			command:    removeKeyserver,
+			args:       []string{testKeyserver},
+			expectExit: 0,
+			profile:    e2e.RootProfile,
+		},
 		{
 			name:       "add out of order",
 			command:    addKeyserver,
@@ -304,6 +304,28 @@ func (c ctx) testOciBasic(t *testing.T) {
 		e2e.ExpectExit(0),
 	)
 
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("oci exec"),
+		e2e.WithArgs("--env", "FOO=bar", "--cwd", "/tmp", containerID, "sh", "-c", "echo $FOO $(pwd)"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ExactMatch, "bar /tmp"),
+		),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("oci events"),
+		e2e.WithArgs("--stats", containerID),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, `"type":"stats"`),
+		),
+	)
+
 	c.env.RunApptainer(
 		t,
 		e2e.WithProfile(e2e.RootProfile),
@@ -365,6 +387,10 @@ func (c ctx) testOciHelp(t *testing.T) {
 			name:          "delete",
 			expectedRegex: `^Delete container \(root user only\)`,
 		},
+		{
+			name:          "events",
+			expectedRegex: `^Display container events and resource usage statistics \(root user only\)`,
+		},
 		{
 			name:          "exec",
 			expectedRegex: `^Execute a command within container \(root user only\)`,
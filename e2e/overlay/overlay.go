@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
 
@@ -193,6 +194,184 @@ func (c ctx) testOverlayCreate(t *testing.T) {
 	}
 }
 
+// Check that an overlay image used for writing by a process of another
+// host, as recorded in its lock file, can't be used for writing, unless
+// read-only or if the lock file is stale.
+func (c ctx) testOverlayLock(t *testing.T) {
+	require.Filesystem(t, "overlay")
+	require.MkfsExt3(t)
+	e2e.EnsureImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "overlay-lock", "")
+	t.Cleanup(func() {
+		if !t.Failed() {
+			e2e.Privileged(cleanup)(t)
+		}
+	})
+
+	ext3Image := filepath.Join(tmpDir, "image.ext3")
+	lockFile := ext3Image + ".lock"
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("overlay"),
+		e2e.WithArgs("create", "--size", "64", ext3Image),
+		e2e.ExpectExit(0),
+	)
+
+	writeLock := func(t *testing.T, age time.Duration) {
+		if err := os.WriteFile(lockFile, []byte("otherhost 1 otherboot\n"), 0o644); err != nil {
+			t.Fatalf("while writing lock file: %s", err)
+		}
+		modTime := time.Now().Add(-age)
+		if err := os.Chtimes(lockFile, modTime, modTime); err != nil {
+			t.Fatalf("while setting lock file time: %s", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		overlay string
+		age     time.Duration
+		exit    int
+		expect  e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:    "held by other host",
+			overlay: ext3Image,
+			exit:    255,
+			expect:  e2e.ExpectError(e2e.ContainMatch, "currently in use by process 1 on host otherhost"),
+		},
+		{
+			name:    "read-only",
+			overlay: ext3Image + ":ro",
+			exit:    0,
+		},
+		{
+			name:    "stale",
+			overlay: ext3Image,
+			age:     2 * time.Minute,
+			exit:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		writeLock(t, tt.age)
+
+		var expects []e2e.ApptainerCmdResultOp
+		if tt.expect != nil {
+			expects = append(expects, tt.expect)
+		}
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--overlay", tt.overlay, c.env.ImagePath, "true"),
+			e2e.ExpectExit(tt.exit, expects...),
+		)
+	}
+
+	// the stale lock file was replaced by the container's and removed
+	if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+		t.Errorf("lock file %s not removed after the container exit", lockFile)
+	}
+}
+
+// testOverlayCreateSIF creates an overlay with directories for --fakeroot
+// use directly in a SIF image, and checks the directories are usable by
+// fakeroot containers.
+func (c ctx) testOverlayCreateSIF(t *testing.T) {
+	require.Filesystem(t, "overlay")
+	require.MkfsExt3(t)
+	require.UserNamespace(t)
+	busyboxSIF := e2e.BusyboxSIF(t)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "overlay-sif", "")
+	defer cleanup(t)
+
+	sifImage := filepath.Join(tmpDir, "image.sif")
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs(sifImage, busyboxSIF),
+		e2e.ExpectExit(0),
+	)
+
+	tests := []struct {
+		name    string
+		profile e2e.Profile
+		command string
+		args    []string
+		exit    int
+		ops     []e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:    "missing SIF image",
+			profile: e2e.UserProfile,
+			command: "overlay",
+			args:    []string{"create", "--sif", filepath.Join(tmpDir, "missing.sif")},
+			exit:    255,
+		},
+		{
+			name:    "SIF image and image path",
+			profile: e2e.UserProfile,
+			command: "overlay",
+			args:    []string{"create", "--sif", sifImage, filepath.Join(tmpDir, "image.ext3")},
+			exit:    255,
+		},
+		{
+			name:    "create in SIF",
+			profile: e2e.UserProfile,
+			command: "overlay",
+			args:    []string{"create", "--fakeroot", "--sparse", "--create-dirs", "/data,/opt/app", "--size", "128", "--sif", sifImage},
+			exit:    0,
+		},
+		{
+			name:    "check dirs owned by fakeroot",
+			profile: e2e.FakerootProfile,
+			command: "exec",
+			args:    []string{sifImage, "sh", "-c", "stat -c %u /data /opt/app"},
+			exit:    0,
+			ops:     []e2e.ApptainerCmdResultOp{e2e.ExpectOutput(e2e.ExactMatch, "0\n0")},
+		},
+		{
+			name:    "write dirs with fakeroot",
+			profile: e2e.FakerootProfile,
+			command: "exec",
+			args:    []string{"--writable", sifImage, "sh", "-c", "touch /data/file /opt/app/file && mkdir /root/dir"},
+			exit:    0,
+		},
+		{
+			name:    "check written files",
+			profile: e2e.FakerootProfile,
+			command: "exec",
+			args:    []string{sifImage, "sh", "-c", "test -f /data/file && test -f /opt/app/file && test -d /root/dir"},
+			exit:    0,
+		},
+		{
+			name:    "create in SIF with an existing overlay",
+			profile: e2e.UserProfile,
+			command: "overlay",
+			args:    []string{"create", "--sif", sifImage},
+			exit:    255,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.exit, tt.ops...),
+		)
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -200,6 +379,8 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	}
 
 	return testhelper.Tests{
-		"create": c.testOverlayCreate,
+		"create":     c.testOverlayCreate,
+		"create sif": c.testOverlayCreateSIF,
+		"lock":       c.testOverlayLock,
 	}
 }
@@ -10,12 +10,23 @@
 package plugin
 
 import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
 	"github.com/apptainer/apptainer/e2e/internal/testhelper"
+	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
+	"github.com/opencontainers/go-digest"
 )
 
 type ctx struct {
@@ -317,6 +328,483 @@ func (c ctx) testApptainerCallbacks(t *testing.T) {
 	}
 }
 
+func (c ctx) testProjectPlugin(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	pluginDir := "../examples/plugins/project-plugin"
+	pluginName := "example.com/project-plugin"
+
+	// plugin sif file
+	sifFile := filepath.Join(c.env.TestDir, "plugin.sif")
+	defer os.Remove(sifFile)
+
+	projectRoot, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "projects-", "")
+	defer cleanup(t)
+	if err := os.Mkdir(filepath.Join(projectRoot, "demo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(projectRoot, "demo", "file"), []byte("project data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		profile    e2e.Profile
+		command    string
+		args       []string
+		directive  string
+		expectExit int
+		expectOp   e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:       "Compile",
+			profile:    e2e.UserProfile,
+			command:    "plugin compile",
+			args:       []string{"--out", sifFile, pluginDir},
+			expectExit: 0,
+		},
+		{
+			name:       "Install",
+			profile:    e2e.RootProfile,
+			command:    "plugin install",
+			args:       []string{sifFile},
+			expectExit: 0,
+		},
+		{
+			name:       "ConfigureRelativeRoot",
+			profile:    e2e.RootProfile,
+			command:    "plugin configure",
+			args:       []string{"--set", "root=projects", pluginName},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, `invalid configuration: root "projects" is not an absolute path`),
+		},
+		{
+			name:       "ConfigureUnknownKey",
+			profile:    e2e.RootProfile,
+			command:    "plugin configure",
+			args:       []string{"--set", "unknown=1", pluginName},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "field unknown not found"),
+		},
+		{
+			name:       "ConfigureUnprivileged",
+			profile:    e2e.UserProfile,
+			command:    "plugin configure",
+			args:       []string{"--set", "root=" + projectRoot, pluginName},
+			expectExit: 255,
+		},
+		{
+			name:       "Configure",
+			profile:    e2e.RootProfile,
+			command:    "plugin configure",
+			args:       []string{"--set", "root=" + projectRoot, pluginName},
+			expectExit: 0,
+		},
+		{
+			name:       "ConfigureValidate",
+			profile:    e2e.UserProfile,
+			command:    "plugin configure",
+			args:       []string{"--validate", pluginName},
+			expectExit: 0,
+		},
+		{
+			name:       "ConfigureShow",
+			profile:    e2e.UserProfile,
+			command:    "plugin configure",
+			args:       []string{pluginName},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ExactMatch, "root: "+projectRoot),
+		},
+		{
+			name:       "NoProject",
+			profile:    e2e.UserProfile,
+			command:    "exec",
+			args:       []string{c.env.ImagePath, "sh", "-c", "echo ${PROJECT_NAME:-none}"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ExactMatch, "none"),
+		},
+		{
+			name:       "ProjectBind",
+			profile:    e2e.UserProfile,
+			command:    "exec",
+			args:       []string{"--project", "demo", c.env.ImagePath, "cat", "/project/file"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ExactMatch, "project data"),
+		},
+		{
+			name:       "ProjectEnv",
+			profile:    e2e.UserProfile,
+			command:    "exec",
+			args:       []string{"--project", "demo", c.env.ImagePath, "sh", "-c", "echo $PROJECT_NAME $PROJECT_DIR"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ExactMatch, "demo /project"),
+		},
+		{
+			name:       "UnknownProject",
+			profile:    e2e.UserProfile,
+			command:    "exec",
+			args:       []string{"--project", "unknown", c.env.ImagePath, "true"},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "Plugin "+pluginName+": project unknown not found"),
+		},
+		{
+			name:       "EnvOverrideRefused",
+			profile:    e2e.UserProfile,
+			command:    "exec",
+			args:       []string{"--env", "PROJECT_NAME=other", "--project", "demo", c.env.ImagePath, "true"},
+			expectExit: 249,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "plugin "+pluginName+": removal of environment variable PROJECT_NAME not allowed"),
+		},
+		{
+			name:       "EnvOverrideAllowed",
+			profile:    e2e.UserProfile,
+			command:    "exec",
+			args:       []string{"--env", "PROJECT_NAME=other", "--project", "demo", c.env.ImagePath, "sh", "-c", "echo $PROJECT_NAME"},
+			directive:  "allow plugin removals",
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ExactMatch, "demo"),
+		},
+		{
+			name:       "ConfigureUser",
+			profile:    e2e.UserProfile,
+			command:    "plugin configure",
+			args:       []string{"--user", "--set", "destination=/work", pluginName},
+			expectExit: 0,
+		},
+		{
+			name:       "UserDestination",
+			profile:    e2e.UserProfile,
+			command:    "exec",
+			args:       []string{"--project", "demo", c.env.ImagePath, "cat", "/work/file"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ExactMatch, "project data"),
+		},
+		{
+			name:       "UnconfigureUser",
+			profile:    e2e.UserProfile,
+			command:    "plugin configure",
+			args:       []string{"--user", "--unset", "destination", pluginName},
+			expectExit: 0,
+		},
+		{
+			name:       "Unconfigure",
+			profile:    e2e.RootProfile,
+			command:    "plugin configure",
+			args:       []string{"--unset", "root", pluginName},
+			expectExit: 0,
+		},
+		{
+			name:       "Uninstall",
+			profile:    e2e.RootProfile,
+			command:    "plugin uninstall",
+			args:       []string{pluginName},
+			expectExit: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.directive != "" {
+			e2e.SetDirective(t, c.env, tt.directive, "yes")
+		}
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
+		)
+		if tt.directive != "" {
+			e2e.ResetDirective(t, c.env, tt.directive)
+		}
+	}
+}
+
+func (c ctx) testNetworkPlugin(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	e2e.Privileged(require.Network)(t)
+
+	pluginDir := "../examples/plugins/static-ip-plugin"
+	pluginName := "example.com/static-ip-plugin"
+
+	// plugin sif file
+	sifFile := filepath.Join(c.env.TestDir, "plugin.sif")
+	defer os.Remove(sifFile)
+
+	tests := []struct {
+		name       string
+		profile    e2e.Profile
+		command    string
+		args       []string
+		expectExit int
+		expectOp   e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:       "Compile",
+			profile:    e2e.UserProfile,
+			command:    "plugin compile",
+			args:       []string{"--out", sifFile, pluginDir},
+			expectExit: 0,
+		},
+		{
+			name:       "Install",
+			profile:    e2e.RootProfile,
+			command:    "plugin install",
+			args:       []string{sifFile},
+			expectExit: 0,
+		},
+		{
+			name:       "ConfigureInvalidIP",
+			profile:    e2e.RootProfile,
+			command:    "plugin configure",
+			args:       []string{"--set", "addresses.root=10.22.0", pluginName},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, `invalid IP address "10.22.0" for user root`),
+		},
+		{
+			name:       "Configure",
+			profile:    e2e.RootProfile,
+			command:    "plugin configure",
+			args:       []string{"--set", "addresses.root=10.22.0.199", pluginName},
+			expectExit: 0,
+		},
+		{
+			name:       "StaticIP",
+			profile:    e2e.RootProfile,
+			command:    "exec",
+			args:       []string{"--net", "--network", "bridge", c.env.ImagePath, "ip", "-4", "-o", "addr", "show", "eth0"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ContainMatch, "inet 10.22.0.199/"),
+		},
+		{
+			name:       "StaticIPOverridesArgs",
+			profile:    e2e.RootProfile,
+			command:    "exec",
+			args:       []string{"--net", "--network", "bridge", "--network-args", "IP=10.22.0.198", c.env.ImagePath, "ip", "-4", "-o", "addr", "show", "eth0"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ContainMatch, "inet 10.22.0.199/"),
+		},
+		{
+			// the address is released by DEL, it can be used again
+			name:       "StaticIPReleased",
+			profile:    e2e.RootProfile,
+			command:    "exec",
+			args:       []string{"--net", "--network", "bridge", c.env.ImagePath, "true"},
+			expectExit: 0,
+		},
+		{
+			name:       "OtherNetwork",
+			profile:    e2e.RootProfile,
+			command:    "exec",
+			args:       []string{"--net", "--network", "ptp", c.env.ImagePath, "ip", "-4", "-o", "addr", "show", "eth0"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.UnwantedContainMatch, "10.22.0.199"),
+		},
+		{
+			name:       "Unconfigure",
+			profile:    e2e.RootProfile,
+			command:    "plugin configure",
+			args:       []string{"--unset", "addresses", pluginName},
+			expectExit: 0,
+		},
+		{
+			name:       "Uninstall",
+			profile:    e2e.RootProfile,
+			command:    "plugin uninstall",
+			args:       []string{pluginName},
+			expectExit: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
+		)
+	}
+}
+
+// storeServer is an HTTP object store for the store plugin, serving the
+// image digests at /<name>/manifests/<tag> and the images at
+// /<name>/blobs/<digest>. The first download of each image is cut in
+// the middle to exercise the download resume of the plugin.
+type storeServer struct {
+	mu        sync.Mutex
+	manifests map[string]string
+	blobs     map[string][]byte
+	cut       map[string]bool
+}
+
+func (s *storeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.Contains(r.URL.Path, "/manifests/") && r.Method == http.MethodGet:
+		dgst, ok := s.manifests[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, dgst)
+	case strings.Contains(r.URL.Path, "/manifests/") && r.Method == http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.manifests[r.URL.Path] = string(b)
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(r.URL.Path, "/blobs/") && r.Method == http.MethodGet:
+		dgst := path.Base(r.URL.Path)
+		b, ok := s.blobs[dgst]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if !s.cut[dgst] && r.Header.Get("Range") == "" {
+			s.cut[dgst] = true
+			w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+			w.Write(b[:len(b)/2])
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b))
+	case strings.Contains(r.URL.Path, "/blobs/") && r.Method == http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.blobs[path.Base(r.URL.Path)] = b
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "unsupported request", http.StatusBadRequest)
+	}
+}
+
+func (c ctx) testStorePlugin(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	pluginDir := "../examples/plugins/store-plugin"
+	pluginName := "example.com/store-plugin"
+
+	// plugin sif file
+	sifFile := filepath.Join(c.env.TestDir, "plugin.sif")
+	defer os.Remove(sifFile)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "store-", "")
+	defer cleanup(t)
+
+	image, err := os.ReadFile(c.env.ImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst := digest.FromBytes(image).String()
+
+	store := &storeServer{
+		manifests: map[string]string{"/test/image/manifests/latest": dgst},
+		blobs:     map[string][]byte{dgst: image},
+		cut:       make(map[string]bool),
+	}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+	storeEnv := []string{"MYSTORE_URL=" + srv.URL}
+
+	tests := []struct {
+		name       string
+		profile    e2e.Profile
+		command    string
+		args       []string
+		env        []string
+		expectExit int
+		expectOp   e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:       "Compile",
+			profile:    e2e.UserProfile,
+			command:    "plugin compile",
+			args:       []string{"--out", sifFile, pluginDir},
+			expectExit: 0,
+		},
+		{
+			name:       "Install",
+			profile:    e2e.RootProfile,
+			command:    "plugin install",
+			args:       []string{sifFile},
+			expectExit: 0,
+		},
+		{
+			name:       "Exec",
+			profile:    e2e.UserProfile,
+			command:    "exec",
+			args:       []string{"mystore://test/image:latest", "cat", "/etc/os-release"},
+			env:        storeEnv,
+			expectExit: 0,
+		},
+		{
+			name:       "Pull",
+			profile:    e2e.UserProfile,
+			command:    "pull",
+			args:       []string{"--disable-cache", filepath.Join(tmpDir, "pull.sif"), "mystore://test/image"},
+			env:        storeEnv,
+			expectExit: 0,
+		},
+		{
+			name:       "PullUnknown",
+			profile:    e2e.UserProfile,
+			command:    "pull",
+			args:       []string{filepath.Join(tmpDir, "unknown.sif"), "mystore://test/unknown:latest"},
+			env:        storeEnv,
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "unexpected status 404 Not Found"),
+		},
+		{
+			name:       "Push",
+			profile:    e2e.UserProfile,
+			command:    "push",
+			args:       []string{filepath.Join(tmpDir, "pull.sif"), "mystore://test/pushed:v1"},
+			env:        storeEnv,
+			expectExit: 0,
+		},
+		{
+			name:       "ExecPushed",
+			profile:    e2e.UserProfile,
+			command:    "exec",
+			args:       []string{"mystore://test/pushed:v1", "true"},
+			env:        storeEnv,
+			expectExit: 0,
+		},
+		{
+			name:       "Uninstall",
+			profile:    e2e.RootProfile,
+			command:    "plugin uninstall",
+			args:       []string{pluginName},
+			expectExit: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.args...),
+			e2e.WithEnv(tt.env),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
+		)
+	}
+
+	if !store.cut[dgst] {
+		t.Errorf("image download not resumed")
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -329,5 +817,8 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"basic":               np(c.testPluginBasic),
 		"CLI_callbacks":       np(c.testCLICallbacks),
 		"Apptainer_callbacks": np(c.testApptainerCallbacks),
+		"project_plugin":      np(c.testProjectPlugin),
+		"store_plugin":        np(c.testStorePlugin),
+		"network_plugin":      np(c.testNetworkPlugin),
 	}
 }
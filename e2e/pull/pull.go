@@ -669,6 +669,129 @@ func (c ctx) testPullUmask(t *testing.T) {
 	}
 }
 
+// testErrorExitCodes checks the exit codes and the error records telling
+// apart the missing images, the rejected credentials and the images denied
+// by the site policy, from the other failures.
+func (c ctx) testErrorExitCodes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/private.sif":
+			if _, pass, ok := r.BasicAuth(); !ok || pass != "e2e-secret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="e2e"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			http.ServeFile(w, r, c.env.ImagePath)
+		case "/page.html":
+			w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	imagePath := filepath.Join(c.env.TestDir, "exit-code.sif")
+	credentials := []string{"APPTAINER_NET_USERNAME=e2e", "APPTAINER_NET_PASSWORD=e2e-secret"}
+
+	tests := []struct {
+		name      string
+		command   string
+		args      []string
+		env       []string
+		directive string
+		value     string
+		exit      int
+		class     string
+	}{
+		{
+			name:    "PullNotFound",
+			command: "pull",
+			args:    []string{"--force", imagePath, srv.URL + "/missing.sif"},
+			exit:    247,
+			class:   "not-found",
+		},
+		{
+			name:    "PullOrasNotFound",
+			command: "pull",
+			args:    []string{"--force", imagePath, fmt.Sprintf("oras://%s/pull_test_missing:latest", c.env.TestRegistry)},
+			exit:    247,
+			class:   "not-found",
+		},
+		{
+			name:    "PullUnauthorized",
+			command: "pull",
+			args:    []string{"--force", imagePath, srv.URL + "/private.sif"},
+			exit:    248,
+			class:   "unauthorized",
+		},
+		{
+			name:    "PullAuthorized",
+			command: "pull",
+			args:    []string{"--force", imagePath, srv.URL + "/private.sif"},
+			env:     credentials,
+			exit:    0,
+		},
+		{
+			name:    "PullNotAnImage",
+			command: "pull",
+			args:    []string{"--force", imagePath, srv.URL + "/page.html"},
+			exit:    255,
+		},
+		{
+			name:    "ExecNotFound",
+			command: "exec",
+			args:    []string{srv.URL + "/missing.sif", "true"},
+			exit:    247,
+			class:   "not-found",
+		},
+		{
+			name:    "ExecUnauthorized",
+			command: "exec",
+			args:    []string{"--disable-cache", srv.URL + "/private.sif", "true"},
+			exit:    248,
+			class:   "unauthorized",
+		},
+		{
+			name:      "ExecPolicy",
+			command:   "exec",
+			args:      []string{c.env.ImagePath, "true"},
+			directive: "limit container paths",
+			value:     "/proc",
+			exit:      249,
+			class:     "policy",
+		},
+	}
+
+	for _, tt := range tests {
+		var resultOps []e2e.ApptainerCmdResultOp
+		if tt.class != "" {
+			resultOps = append(resultOps,
+				e2e.ExpectErrorf(e2e.ContainMatch, `"class":"%s","code":%d`, tt.class, tt.exit),
+			)
+		}
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithGlobalOptions("--json-errors"),
+			e2e.WithEnv(tt.env),
+			e2e.PreRun(func(t *testing.T) {
+				if tt.directive != "" {
+					e2e.SetDirective(t, c.env, tt.directive, tt.value)
+				}
+			}),
+			e2e.PostRun(func(t *testing.T) {
+				if tt.directive != "" {
+					e2e.ResetDirective(t, c.env, tt.directive)
+				}
+			}),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.exit, resultOps...),
+		)
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -692,6 +815,8 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		// Manipulates umask for the process, so must be run alone to avoid
 		// causing permission issues for other tests.
 		"pullUmaskCheck": np(c.testPullUmask),
+		// Sets directives, so must be run alone
+		"errorExitCodes": np(c.testErrorExitCodes),
 		// Regressions
 		// Manipulates remotes, so must run alone
 		"issue5808": np(c.issue5808),
@@ -11,7 +11,9 @@ package security
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
@@ -255,6 +257,154 @@ func (c ctx) testSecurityConfOwnership(t *testing.T) {
 	)
 }
 
+// testSecurityCredentials tests the binds of the host credentials with
+// --security-credentials, using a dummy Kerberos file cache and a dummy
+// SSH agent socket.
+func (c ctx) testSecurityCredentials(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "credentials-", "security credentials")
+	defer cleanup(t)
+
+	ccache := filepath.Join(tmpdir, "krb5cc")
+	if err := os.WriteFile(ccache, []byte("dummy"), 0o600); err != nil {
+		t.Fatalf("while writing dummy credential cache: %s", err)
+	}
+	sock := filepath.Join(tmpdir, "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("while creating dummy SSH agent socket: %s", err)
+	}
+	defer ln.Close()
+
+	krb5Env := "KRB5CCNAME=FILE:" + ccache
+	sshEnv := "SSH_AUTH_SOCK=" + sock
+
+	tests := []struct {
+		name       string
+		profile    e2e.Profile
+		args       []string
+		env        []string
+		expectExit int
+		expectOps  []e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:    "Krb5",
+			profile: e2e.UserProfile,
+			args:    []string{"--security-credentials", "krb5", c.env.ImagePath, "sh", "-c", `cat "${KRB5CCNAME#FILE:}"; echo " $KRB5CCNAME"`},
+			env:     []string{krb5Env},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectOutput(e2e.ExactMatch, "dummy FILE:"+ccache),
+			},
+		},
+		{
+			name:    "SSHAgent",
+			profile: e2e.UserProfile,
+			args:    []string{"--security-credentials", "ssh-agent", c.env.ImagePath, "sh", "-c", `test -S "$SSH_AUTH_SOCK" && echo "$SSH_AUTH_SOCK"`},
+			env:     []string{sshEnv},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectOutput(e2e.ExactMatch, sock),
+			},
+		},
+		{
+			name:    "Both",
+			profile: e2e.UserProfile,
+			args:    []string{"--security-credentials", "krb5,ssh-agent", c.env.ImagePath, "sh", "-c", `test -f "${KRB5CCNAME#FILE:}" && test -S "$SSH_AUTH_SOCK" && echo ok`},
+			env:     []string{krb5Env, sshEnv},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectOutput(e2e.ExactMatch, "ok"),
+			},
+		},
+		{
+			name:    "NotRequested",
+			profile: e2e.UserProfile,
+			args:    []string{c.env.ImagePath, "sh", "-c", `test -e "$SSH_AUTH_SOCK" || echo missing`},
+			env:     []string{sshEnv},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectOutput(e2e.ExactMatch, "missing"),
+			},
+		},
+		{
+			name:    "None",
+			profile: e2e.UserProfile,
+			args:    []string{"--security-credentials", "none", c.env.ImagePath, "true"},
+			env:     []string{sshEnv},
+		},
+		{
+			name:    "Missing",
+			profile: e2e.UserProfile,
+			args:    []string{"--security-credentials", "ssh-agent", c.env.ImagePath, "true"},
+			env:     []string{"SSH_AUTH_SOCK=" + filepath.Join(tmpdir, "missing.sock")},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Not binding ssh-agent credentials"),
+			},
+		},
+		{
+			name:    "Keyring",
+			profile: e2e.UserProfile,
+			args:    []string{"--security-credentials", "krb5", c.env.ImagePath, "true"},
+			env:     []string{"KRB5CCNAME=KEYRING:persistent:1000"},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "can't be bound in the container"),
+			},
+		},
+		{
+			name:    "NotSocket",
+			profile: e2e.UserProfile,
+			args:    []string{"--security-credentials", "ssh-agent", c.env.ImagePath, "true"},
+			env:     []string{"SSH_AUTH_SOCK=" + ccache},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "is not a socket"),
+			},
+		},
+		{
+			// the credentials of the user are not exposed to a container
+			// running as root
+			name:    "NotOwned",
+			profile: e2e.RootProfile,
+			args:    []string{"--security-credentials", "krb5", c.env.ImagePath, "sh", "-c", `test -e "${KRB5CCNAME#FILE:}" || echo missing`},
+			env:     []string{krb5Env},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectOutput(e2e.ExactMatch, "missing"),
+				e2e.ExpectError(e2e.ContainMatch, "not by the container user"),
+			},
+		},
+		{
+			name:       "Invalid",
+			profile:    e2e.UserProfile,
+			args:       []string{"--security-credentials", "gpg-agent", c.env.ImagePath, "true"},
+			expectExit: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, `invalid security credential "gpg-agent"`),
+			},
+		},
+		{
+			name:       "NoneCombined",
+			profile:    e2e.UserProfile,
+			args:       []string{"--security-credentials", "none,krb5", c.env.ImagePath, "true"},
+			expectExit: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "can't be combined"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		// the credentials are hidden by --containall unless bound, and
+		// their variables are exported despite the clean environment
+		args := append([]string{"--containall"}, tt.args...)
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(args...),
+			e2e.WithEnv(append(os.Environ(), tt.env...)),
+			e2e.ExpectExit(tt.expectExit, tt.expectOps...),
+		)
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -267,5 +417,6 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"apptainerSecurityUnpriv":   c.testSecurityUnpriv,
 		"apptainerSecurityPriv":     c.testSecurityPriv,
 		"testSecurityConfOwnership": np(c.testSecurityConfOwnership),
+		"testSecurityCredentials":   c.testSecurityCredentials,
 	}
 }
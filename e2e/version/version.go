@@ -10,6 +10,7 @@
 package version
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -117,6 +118,52 @@ func (c ctx) testHelpOption(t *testing.T) {
 	)
 }
 
+// Test that version --json reports the same version as the version
+// command along with the build features
+func (c ctx) testVersionJSON(t *testing.T) {
+	var version string
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("version"),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.ApptainerCmdResult) {
+			version = strings.TrimSpace(string(r.Stdout))
+		}),
+	)
+
+	checkJSONFn := func(t *testing.T, r *e2e.ApptainerCmdResult) {
+		var v struct {
+			Version   string                 `json:"version"`
+			BuildTags []string               `json:"buildTags"`
+			Dirs      map[string]string      `json:"dirs"`
+			Features  map[string]interface{} `json:"features"`
+		}
+		if err := json.Unmarshal(r.Stdout, &v); err != nil {
+			t.Fatalf("while decoding %s: %s", r.Stdout, err)
+		}
+		if v.Version != version {
+			t.Errorf("got version %q, want %q", v.Version, version)
+		}
+		if v.Dirs["LIBEXECDIR"] == "" || len(v.BuildTags) == 0 {
+			t.Errorf("missing build configuration in %s", r.Stdout)
+		}
+		if _, ok := v.Features["setuid-starter"].(bool); !ok {
+			t.Errorf("missing setuid-starter feature in %s", r.Stdout)
+		}
+		if _, ok := v.Features["squashfuse"].(string); !ok {
+			t.Errorf("missing squashfuse feature in %s", r.Stdout)
+		}
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("version"),
+		e2e.WithArgs("--json"),
+		e2e.ExpectExit(0, checkJSONFn),
+	)
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -127,5 +174,6 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"equal version":    c.testEqualVersion,
 		"help option":      c.testHelpOption,
 		"semantic version": c.testSemanticVersion,
+		"version json":     c.testVersionJSON,
 	}
 }
@@ -0,0 +1,137 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+	clicallback "github.com/apptainer/apptainer/pkg/plugin/callback/cli"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// Config is the configuration of the plugin, read from the
+// example.com/project-plugin.yaml configuration files, and set with:
+//
+//	apptainer plugin configure --set root=/data/projects example.com/project-plugin
+type Config struct {
+	// Root is the directory holding the project directories.
+	Root string `yaml:"root"`
+	// Destination is where the project directory is bound in the container.
+	Destination string `yaml:"destination"`
+}
+
+// Validate checks the configuration once decoded.
+func (c *Config) Validate() error {
+	if !filepath.IsAbs(c.Root) {
+		return fmt.Errorf("root %q is not an absolute path", c.Root)
+	}
+	if !filepath.IsAbs(c.Destination) || filepath.Clean(c.Destination) == "/" {
+		return errors.New("destination must be an absolute path other than /")
+	}
+	return nil
+}
+
+// config holds the configuration with its default values.
+var config = Config{
+	Root:        "/srv/projects",
+	Destination: "/project",
+}
+
+// Plugin is the only variable which a plugin MUST export.
+// This symbol is accessed by the plugin framework to initialize the plugin.
+var Plugin = pluginapi.Plugin{
+	Manifest: pluginapi.Manifest{
+		Name:        "example.com/project-plugin",
+		Author:      "Apptainer Team",
+		Version:     "0.1.0",
+		Description: "This is a short example plugin binding project directories in containers",
+		Priority:    10,
+	},
+	Callbacks: []pluginapi.Callback{
+		(clicallback.Command)(callbackProjectFlag),
+		(clicallback.CommandPreRun)(callbackResolveProject),
+		(clicallback.LaunchConfig)(callbackBindProject),
+	},
+	Config: &config,
+}
+
+var (
+	project    string
+	projectDir string
+)
+
+// callbackProjectFlag adds the --project flag to the commands running
+// a container.
+func callbackProjectFlag(manager *cmdline.CommandManager) {
+	var cmds []*cobra.Command
+
+	for _, name := range []string{"exec", "run", "shell", "instance_start"} {
+		cmd := manager.GetCmd(name)
+		if cmd == nil {
+			sylog.Warningf("Could not find %s command", name)
+			continue
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	manager.RegisterFlagForCmd(&cmdline.Flag{
+		ID:           "projectFlag",
+		Value:        &project,
+		DefaultValue: "",
+		Name:         "project",
+		Usage:        "bind the directory of the project in " + config.Destination,
+		EnvKeys:      []string{"PROJECT"},
+	}, cmds...)
+}
+
+// callbackResolveProject checks the project requested once the command
+// line is parsed.
+func callbackResolveProject(cmd *cobra.Command, _ []string) error {
+	if project == "" {
+		return nil
+	}
+	if project == "." || project == ".." || strings.ContainsRune(project, filepath.Separator) {
+		return fmt.Errorf("invalid project name %q", project)
+	}
+
+	projectDir = filepath.Join(config.Root, project)
+
+	fi, err := os.Stat(projectDir)
+	if err != nil || !fi.IsDir() {
+		return fmt.Errorf("project %s not found in %s", project, config.Root)
+	}
+	sylog.Debugf("Project %s requested by the %s command", project, cmd.Name())
+	return nil
+}
+
+// callbackBindProject binds the project directory in the container and
+// sets the PROJECT_NAME and PROJECT_DIR environment variables. Overriding
+// values set by the user with --env is a removal, refused unless allowed
+// by the 'allow plugin removals' directive of apptainer.conf.
+func callbackBindProject(launch *clicallback.Launch) error {
+	if projectDir == "" {
+		return nil
+	}
+
+	launch.Binds = append(launch.Binds, apptainerConfig.BindPath{
+		Source:      projectDir,
+		Destination: config.Destination,
+	})
+	launch.Env["PROJECT_NAME"] = project
+	launch.Env["PROJECT_DIR"] = config.Destination
+	return nil
+}
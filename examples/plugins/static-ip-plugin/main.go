@@ -0,0 +1,91 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// Config is the configuration of the plugin, set with:
+//
+//	apptainer plugin configure --set addresses.alice=10.22.0.10 example.com/static-ip-plugin
+type Config struct {
+	// Network is the name of the network the addresses are set on.
+	Network string `yaml:"network"`
+	// Addresses holds the IP address of the users, indexed by user name.
+	Addresses map[string]string `yaml:"addresses"`
+}
+
+// Validate checks the configuration once decoded.
+func (c *Config) Validate() error {
+	if c.Network == "" {
+		return errors.New("network must be set")
+	}
+	for user, ip := range c.Addresses {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid IP address %q for user %s", ip, user)
+		}
+	}
+	return nil
+}
+
+// config holds the configuration with its default values.
+var config = Config{
+	Network: "bridge",
+}
+
+// Plugin is the only variable which a plugin MUST export.
+// This symbol is accessed by the plugin framework to initialize the plugin.
+var Plugin = pluginapi.Plugin{
+	Manifest: pluginapi.Manifest{
+		Name:        "example.com/static-ip-plugin",
+		Author:      "Apptainer Team",
+		Version:     "0.1.0",
+		Description: "This is a short example plugin giving a static IP address to each user",
+	},
+	Callbacks: []pluginapi.Callback{
+		(apptainercallback.NetworkConfig)(callbackStaticIP),
+	},
+	Config: &config,
+}
+
+// callbackStaticIP sets the IP address of the user on the configured
+// network, replacing any address requested with --network-args. The host-local
+// IPAM plugin releases the address on DEL with the same arguments, there's
+// nothing more to do.
+func callbackStaticIP(setup *apptainercallback.NetworkSetup) error {
+	ip, ok := config.Addresses[setup.Container.User]
+	if !ok || setup.Command != "ADD" {
+		return nil
+	}
+
+	for _, n := range setup.Networks {
+		if n.Config.Name != config.Network {
+			continue
+		}
+
+		args := n.Runtime.Args[:0]
+		for _, arg := range n.Runtime.Args {
+			if arg[0] != "IP" {
+				args = append(args, arg)
+			}
+		}
+		n.Runtime.Args = append(args, [2]string{"IP", ip})
+
+		sylog.Debugf("Static IP %s set on network %s for user %s", ip, n.Config.Name, setup.Container.User)
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+	clicallback "github.com/apptainer/apptainer/pkg/plugin/callback/cli"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+const (
+	// scheme is the URI scheme handled by the plugin.
+	scheme = "mystore"
+	// defaultStoreURL is the URL of the object store, unless overridden
+	// by the MYSTORE_URL environment variable.
+	defaultStoreURL = "http://localhost:8080"
+	// maxAttempts is the number of attempts to download an image, each
+	// resuming the previous one.
+	maxAttempts = 5
+)
+
+// Plugin is the only variable which a plugin MUST export.
+// This symbol is accessed by the plugin framework to initialize the plugin.
+var Plugin = pluginapi.Plugin{
+	Manifest: pluginapi.Manifest{
+		Name:        "example.com/store-plugin",
+		Author:      "Apptainer Team",
+		Version:     "0.1.0",
+		Description: "This is a short example plugin pulling and pushing images from an HTTP object store",
+	},
+	Callbacks: []pluginapi.Callback{
+		(clicallback.ImageURIHandler)(func() clicallback.URIHandler {
+			return &store{client: http.DefaultClient}
+		}),
+	},
+}
+
+// store handles the mystore://<name>:<tag> images of an object store
+// serving the digest of the tags at <url>/<name>/manifests/<tag>, and
+// the images at <url>/<name>/blobs/<digest>.
+type store struct {
+	client *http.Client
+}
+
+func (s *store) Scheme() string {
+	return scheme
+}
+
+// parseRef returns the manifest and blob base URLs of the image ref.
+func parseRef(ref string) (manifest, blobs string, err error) {
+	name := strings.TrimPrefix(ref, scheme+"://")
+	tag := "latest"
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	if name == "" || tag == "" {
+		return "", "", fmt.Errorf("invalid %s reference %q, expected %s://<name>:<tag>", scheme, ref, scheme)
+	}
+
+	base := os.Getenv("MYSTORE_URL")
+	if base == "" {
+		base = defaultStoreURL
+	}
+	base = strings.TrimSuffix(base, "/") + "/" + name
+	return base + "/manifests/" + tag, base + "/blobs/", nil
+}
+
+// do sends the request req and checks its status is one of expected.
+func (s *store) do(req *http.Request, expected ...int) (*http.Response, error) {
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range expected {
+		if res.StatusCode == code {
+			return res, nil
+		}
+	}
+	res.Body.Close()
+	return nil, fmt.Errorf("%s %s: unexpected status %s", req.Method, req.URL, res.Status)
+}
+
+func (s *store) Resolve(ctx context.Context, ref string) (string, error) {
+	manifest, _, err := parseRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, manifest, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := s.do(req, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Fetch downloads the image, resuming the download with a range request
+// after a failure, and checks its digest.
+func (s *store) Fetch(ctx context.Context, ref, digest, dest string, progress clicallback.Progress) error {
+	_, blobs, err := parseRef(ref)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var written, total int64 = 0, -1
+	for attempt := 1; ; attempt++ {
+		err = s.fetchRange(ctx, blobs+digest, f, &written, &total, progress)
+		if err == nil || ctx.Err() != nil || attempt == maxAttempts {
+			break
+		}
+		sylog.Debugf("Resuming download of %s at %d bytes after error: %s", ref, written, err)
+	}
+	if err != nil {
+		return err
+	}
+	return checkDigest(dest, digest)
+}
+
+// fetchRange downloads the image at url from the offset written to f,
+// updating written and total.
+func (s *store) fetchRange(ctx context.Context, url string, f *os.File, written, total *int64, progress clicallback.Progress) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if *written > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", *written))
+	}
+	res, err := s.do(req, http.StatusOK, http.StatusPartialContent)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// the server may ignore the range and send the whole image
+	if res.StatusCode == http.StatusOK {
+		*written = 0
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		*total = res.ContentLength
+	} else if *total < 0 && res.ContentLength >= 0 {
+		*total = *written + res.ContentLength
+	}
+	if _, err := f.Seek(*written, io.SeekStart); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 128*1024)
+	for {
+		n, err := res.Body.Read(buf)
+		if n > 0 {
+			if _, err := f.Write(buf[:n]); err != nil {
+				return err
+			}
+			*written += int64(n)
+			progress(*written, *total)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if *total >= 0 && *written != *total {
+		return fmt.Errorf("incomplete download of %s: %d bytes out of %d", url, *written, *total)
+	}
+	return nil
+}
+
+// checkDigest checks the sha256 digest of the file path.
+func checkDigest(path, digest string) error {
+	got, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+	if got != digest {
+		return fmt.Errorf("digest of the downloaded image %s doesn't match %s", got, digest)
+	}
+	return nil
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// progressReader reports the bytes read from r with progress.
+type progressReader struct {
+	r        io.Reader
+	read     int64
+	total    int64
+	progress clicallback.Progress
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.read += int64(n)
+	pr.progress(pr.read, pr.total)
+	return n, err
+}
+
+// Push uploads the image, then tags it.
+func (s *store) Push(ctx context.Context, src, ref string, progress clicallback.Progress) error {
+	manifest, blobs, err := parseRef(ref)
+	if err != nil {
+		return err
+	}
+	digest, err := fileDigest(src)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	body := &progressReader{r: f, total: fi.Size(), progress: progress}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, blobs+digest, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = fi.Size()
+	res, err := s.do(req, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, manifest, strings.NewReader(digest))
+	if err != nil {
+		return err
+	}
+	res, err = s.do(req, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
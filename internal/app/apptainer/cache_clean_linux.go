@@ -12,36 +12,40 @@ package apptainer
 import (
 	"errors"
 	"fmt"
+	"os"
+	"text/tabwriter"
 
 	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/slice"
 )
 
 var errInvalidCacheHandle = errors.New("invalid cache handle")
 
-// cleanCache cleans the given type of cache cacheType. It will return a
+// cleanCache cleans the given type of cache cacheType. It will return
+// the entries removed, or which would be removed in dry run mode, and an
 // error if one occurs.
-func cleanCache(imgCache *cache.Handle, cacheType string, dryRun bool, days int) error {
+func cleanCache(imgCache *cache.Handle, cacheType string, dryRun bool, filter cache.CleanFilter) ([]cache.EntryInfo, error) {
 	if imgCache == nil {
-		return fmt.Errorf("invalid image cache handle")
+		return nil, fmt.Errorf("invalid image cache handle")
 	}
-	return imgCache.CleanCache(cacheType, dryRun, days)
+	return imgCache.CleanCache(cacheType, dryRun, filter)
 }
 
 // CleanApptainerCache is the main function that drives all these
-// other functions. If force is true, remove the entries, otherwise only
-// provide a summary of what would have been done. If cacheCleanTypes
+// other functions. If dryRun is true, only print a table of the entries
+// which would be removed, otherwise remove them. If cacheCleanTypes
 // contains something, only clean that type. The special value "all" is
-// interpreted as "all types of entries". If cacheName contains
-// something, clean only cache entries matching that name.
-func CleanApptainerCache(imgCache *cache.Handle, dryRun bool, cacheCleanTypes []string, days int) error {
+// interpreted as "all types of entries". The entries removed are
+// selected by filter.
+func CleanApptainerCache(imgCache *cache.Handle, dryRun bool, cacheCleanTypes []string, filter cache.CleanFilter) error {
 	if imgCache == nil {
 		return errInvalidCacheHandle
 	}
 
 	// Default is all caches
-	cachesToClean := append(cache.OciCacheTypes, cache.FileCacheTypes...)
+	cachesToClean := append(append(cache.OciCacheTypes, cache.FileCacheTypes...), cache.DirCacheTypes...)
 
 	// If specified caches, and we don't have 'all' specified then clean the specified
 	// ones only.
@@ -49,12 +53,45 @@ func CleanApptainerCache(imgCache *cache.Handle, dryRun bool, cacheCleanTypes []
 		cachesToClean = cacheCleanTypes
 	}
 
+	var entries []cache.EntryInfo
 	for _, cacheType := range cachesToClean {
 		sylog.Debugf("Cleaning %s cache...", cacheType)
-		if err := cleanCache(imgCache, cacheType, dryRun, days); err != nil {
+		removed, err := cleanCache(imgCache, cacheType, dryRun, filter)
+		entries = append(entries, removed...)
+		if err != nil {
 			return err
 		}
 	}
 
+	if dryRun {
+		return printCleanReport(entries)
+	}
+	return nil
+}
+
+// printCleanReport prints the table of the entries which would be
+// removed by a cache clean, with their total size.
+func printCleanReport(entries []cache.EntryInfo) error {
+	var total int64
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tNAME\tSIZE\tLAST USED\tSOURCE")
+	for _, e := range entries {
+		source := e.Source
+		if source == "" {
+			source = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%.22s\t%s\t%s\t%s\n",
+			e.Type,
+			e.Name,
+			fs.FindSize(e.Size),
+			e.LastUsed.Format("2006-01-02 15:04:05"),
+			source)
+		total += e.Size
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\nWould remove %d cache entries using %s\n", len(entries), fs.FindSize(total))
 	return nil
 }
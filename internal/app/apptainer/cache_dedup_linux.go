@@ -0,0 +1,43 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// DedupApptainerCache reflinks the identical files of the cache so that
+// they share their data, and reports the space saved. If dryRun is true,
+// only the estimated savings are reported.
+func DedupApptainerCache(imgCache *cache.Handle, dryRun bool) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+
+	report, err := imgCache.Dedup(dryRun)
+	if errors.Is(err, cache.ErrReflinkUnsupported) {
+		sylog.Warningf("%v, identical files can't share their data", err)
+		dryRun = true
+	} else if err != nil {
+		return fmt.Errorf("could not deduplicate cache: %v", err)
+	}
+
+	fmt.Printf("Found %d duplicate files among %d cache files\n", report.Duplicates, report.Files)
+	if dryRun {
+		fmt.Printf("Estimated savings with reflinks: %s\n", fs.FindSize(report.Savings))
+		return nil
+	}
+	fmt.Printf("Reflinked %d files, saving about %s\n", report.Reflinked, fs.FindSize(report.Savings))
+	return nil
+}
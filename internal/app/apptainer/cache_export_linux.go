@@ -0,0 +1,138 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/slice"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdMagic is the magic number starting a zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// parseCacheTypes returns the cache types to export or verify from the
+// types given on the command line, where "all" means all types of entries.
+func parseCacheTypes(types []string) ([]string, error) {
+	all := append(append([]string{}, cache.FileCacheTypes...), cache.OciCacheTypes...)
+	if len(types) == 0 || slice.ContainsString(types, "all") {
+		return all, nil
+	}
+
+	var cacheTypes []string
+	for _, t := range types {
+		switch t {
+		case "oci-blob", "blobs":
+			t = cache.OciBlobCacheType
+		}
+		if !slice.ContainsString(all, t) {
+			return nil, fmt.Errorf("unknown cache type %s, possible types: %s, all", t, strings.Join(all, ", "))
+		}
+		if !slice.ContainsString(cacheTypes, t) {
+			cacheTypes = append(cacheTypes, t)
+		}
+	}
+	return cacheTypes, nil
+}
+
+// ExportApptainerCache writes the entries of the cacheTypes caches to the
+// archive file, compressed with zstd if its name ends with .zst. The
+// special type "all" exports all types of entries.
+func ExportApptainerCache(imgCache *cache.Handle, cacheTypes []string, file string) (err error) {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+	types, err := parseCacheTypes(cacheTypes)
+	if err != nil {
+		return err
+	}
+
+	// the archive is written to a temporary file, not to leave an
+	// incomplete archive behind on failure
+	f, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("could not create %s: %v", file, err)
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	var w io.Writer = f
+	var zw *zstd.Encoder
+	if strings.HasSuffix(file, ".zst") {
+		zw, err = zstd.NewWriter(f)
+		if err != nil {
+			return err
+		}
+		w = zw
+	}
+	count, err := imgCache.Export(w, types)
+	if err != nil {
+		return fmt.Errorf("could not export cache: %v", err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("could not write %s: %v", file, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write %s: %v", file, err)
+	}
+	if err := os.Rename(f.Name(), file); err != nil {
+		return fmt.Errorf("could not create %s: %v", file, err)
+	}
+
+	sylog.Infof("Exported %d cache entries to %s", count, file)
+	return nil
+}
+
+// ImportApptainerCache restores the entries of an archive written by
+// ExportApptainerCache, compressed with zstd or not, into the cache. The
+// entries already in the cache are skipped.
+func ImportApptainerCache(imgCache *cache.Handle, file string) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %v", file, err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, err := br.Peek(len(zstdMagic)); err == nil && bytes.Equal(magic, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	imported, skipped, err := imgCache.Import(r)
+	if err != nil {
+		return fmt.Errorf("could not import %s: %v", file, err)
+	}
+	sylog.Infof("Imported %d cache entries, skipped %d already in the cache", imported, skipped)
+	return nil
+}
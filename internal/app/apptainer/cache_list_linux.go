@@ -10,59 +10,44 @@
 package apptainer
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/apptainer/apptainer/internal/pkg/cache"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/pkg/util/slice"
 )
 
-// listTypeCache will list a cache type with given name (cacheType). The options are 'library', and 'oci'.
-// Will return: the number of containers for that type (int), the total space the container type is using (int64),
-// and an error if one occurs.
-func listTypeCache(printList bool, name, cachePath string) (int, int64, error) {
-	_, err := os.Stat(cachePath)
-	if os.IsNotExist(err) {
-		return 0, 0, nil
-	} else if err != nil {
-		return 0, 0, fmt.Errorf("unable to open cache %s at directory %s: %v", name, cachePath, err)
+// printListEntry prints a cache entry in the verbose table of a cache list.
+// The source of the entries of the OCI blob cache are the images using them.
+func printListEntry(tw io.Writer, e cache.EntryInfo) {
+	source := e.Source
+	if e.Type == cache.OciBlobCacheType {
+		source = strings.Join(e.Referrers, ",")
 	}
-
-	cacheEntries, err := os.ReadDir(cachePath)
-	if err != nil {
-		return 0, 0, fmt.Errorf("unable to open cache %s at directory %s: %v", name, cachePath, err)
+	if source == "" {
+		source = "unknown"
 	}
-
-	var totalSize int64
-
-	for _, entry := range cacheEntries {
-		fi, err := entry.Info()
-		if err != nil {
-			return 0, 0, fmt.Errorf("unable to get info for cache entry %s: %v", entry.Name(), err)
-		}
-
-		if printList {
-			fmt.Printf("%-24.22s %-22s %-16s %s\n",
-				entry.Name(),
-				fi.ModTime().Format("2006-01-02 15:04:05"),
-				fs.FindSize(fi.Size()),
-				name)
-		}
-		totalSize += fi.Size()
-	}
-
-	return len(cacheEntries), totalSize, nil
+	fmt.Fprintf(tw, "%.22s\t%s\t%s\t%s\t%s\t%s\n",
+		e.Name,
+		e.Created.Format("2006-01-02 15:04:05"),
+		e.LastUsed.Format("2006-01-02 15:04:05"),
+		fs.FindSize(e.Size),
+		e.Type,
+		source)
 }
 
 // ListApptainerCache will list the local apptainer cache for the
 // types specified by cacheListTypes. If cacheListTypes contains the
 // value "all", all the cache entries are considered. If cacheListVerbose is
 // true, the entries will be shown in the output, otherwise only a
-// summary is provided.
-func ListApptainerCache(imgCache *cache.Handle, cacheListTypes []string, cacheListVerbose bool) error {
+// summary is provided. If cacheListJSON is true, the entries are printed
+// as a JSON array with their provenance instead.
+func ListApptainerCache(imgCache *cache.Handle, cacheListTypes []string, cacheListVerbose, cacheListJSON bool) error {
 	if imgCache == nil {
 		return errInvalidCacheHandle
 	}
@@ -72,57 +57,66 @@ func ListApptainerCache(imgCache *cache.Handle, cacheListTypes []string, cacheLi
 		containerSpace, blobSpace, totalSpace int64
 	)
 
-	if cacheListVerbose {
-		fmt.Printf("%-24s %-22s %-16s %s\n", "NAME", "DATE CREATED", "SIZE", "TYPE")
-	}
-
-	containersShown := false
-	blobsShown := false
-
 	// If types requested includes "all" then we don't want to filter anything
 	if slice.ContainsString(cacheListTypes, "all") {
 		cacheListTypes = []string{}
 	}
 
-	for _, cacheType := range cache.OciCacheTypes {
-		// the type blob is special: 1. there's a
-		// separate counter for it; 2. the cache entries
-		// are actually one level deeper
+	var entries []cache.EntryInfo
+	containersShown := false
+	blobsShown := false
+
+	cacheTypes := append([]string{}, cache.OciCacheTypes...)
+	cacheTypes = append(cacheTypes, cache.FileCacheTypes...)
+	cacheTypes = append(cacheTypes, cache.DirCacheTypes...)
+	for _, cacheType := range cacheTypes {
 		if len(cacheListTypes) > 0 && !slice.ContainsString(cacheListTypes, cacheType) {
 			continue
 		}
-		cacheDir, err := imgCache.GetOciCacheDir(cacheType)
+		typeEntries, err := imgCache.ListEntries(cacheType)
 		if err != nil {
 			return err
 		}
-		cacheDir = filepath.Join(cacheDir, "blobs", "sha256")
-		blobsCount, blobsSize, err := listTypeCache(cacheListVerbose, cacheType, cacheDir)
-		if err != nil {
-			fmt.Print(err)
-			return err
+		for _, e := range typeEntries {
+			// the type blob is special, there's a separate counter for it
+			if cacheType == cache.OciBlobCacheType {
+				blobCount++
+				blobSpace += e.Size
+			} else {
+				containerCount++
+				containerSpace += e.Size
+			}
+			totalSpace += e.Size
+		}
+		if cacheType == cache.OciBlobCacheType {
+			blobsShown = true
+		} else {
+			containersShown = true
 		}
-		blobCount = blobsCount
-		blobSpace = blobsSize
-		totalSpace += blobsSize
-		blobsShown = true
+		entries = append(entries, typeEntries...)
 	}
-	for _, cacheType := range cache.FileCacheTypes {
-		if len(cacheListTypes) > 0 && !slice.ContainsString(cacheListTypes, cacheType) {
-			continue
+
+	if cacheListJSON {
+		if entries == nil {
+			entries = []cache.EntryInfo{}
 		}
-		cacheDir, err := imgCache.GetFileCacheDir(cacheType)
-		if err != nil {
-			return err
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(entries); err != nil {
+			return fmt.Errorf("could not encode cache entries: %v", err)
 		}
-		count, size, err := listTypeCache(cacheListVerbose, cacheType, cacheDir)
-		if err != nil {
-			fmt.Print(err)
+		return nil
+	}
+
+	if cacheListVerbose {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tDATE CREATED\tLAST USED\tSIZE\tTYPE\tSOURCE")
+		for _, e := range entries {
+			printListEntry(tw, e)
+		}
+		if err := tw.Flush(); err != nil {
 			return err
 		}
-		containerCount += count
-		containerSpace += size
-		totalSpace += size
-		containersShown = true
 	}
 
 	if cacheListVerbose {
@@ -145,5 +139,13 @@ func ListApptainerCache(imgCache *cache.Handle, cacheListTypes []string, cacheLi
 	fmt.Print(out.String())
 	fmt.Printf("Total space used: %s\n", fs.FindSize(totalSpace))
 
+	if maxSize := imgCache.MaxSize(); maxSize > 0 {
+		usage, err := imgCache.Usage()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Cache quota: %s of %s used (%d%%)\n", fs.FindSize(usage), fs.FindSize(maxSize), usage*100/maxSize)
+	}
+
 	return nil
 }
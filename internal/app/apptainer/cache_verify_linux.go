@@ -0,0 +1,101 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// verifyProgressInterval is the interval between two progress messages of
+// a cache verification.
+var verifyProgressInterval = 5 * time.Second
+
+// VerifyApptainerCache verifies the integrity of the entries of the
+// cacheTypes caches, where the special type "all" means all types of
+// entries. The corrupted entries are reported with their source, and
+// removed if deleteCorrupt is true. If jsonOutput is true, the results of
+// all the entries are printed as a JSON array. An error is returned if
+// corrupted entries are left in the cache.
+func VerifyApptainerCache(imgCache *cache.Handle, cacheTypes []string, deleteCorrupt, jsonOutput bool) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+	types, err := parseCacheTypes(cacheTypes)
+	if err != nil {
+		return err
+	}
+
+	var results []cache.VerifyResult
+	for _, cacheType := range types {
+		lastProgress := time.Now()
+		progress := func(r cache.VerifyResult, done, total int) {
+			if r.Error != "" {
+				sylog.Warningf("Corrupted %s cache entry %s from %s: %s", r.Type, r.Name, verifySource(r), r.Error)
+			}
+			if time.Since(lastProgress) >= verifyProgressInterval || (done == total && done > 0) {
+				sylog.Infof("Verified %d/%d %s cache entries", done, total, cacheType)
+				lastProgress = time.Now()
+			}
+		}
+		typeResults, err := imgCache.VerifyCache(cacheType, deleteCorrupt, progress)
+		results = append(results, typeResults...)
+		if err != nil {
+			return fmt.Errorf("could not verify %s cache: %v", cacheType, err)
+		}
+	}
+
+	if jsonOutput {
+		if results == nil {
+			results = []cache.VerifyResult{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	}
+
+	corrupted, removed := 0, 0
+	for _, r := range results {
+		if r.Error != "" {
+			corrupted++
+		}
+		if r.Removed {
+			sylog.Infof("Removed corrupted %s cache entry %s", r.Type, r.Name)
+			removed++
+		}
+	}
+	if !jsonOutput {
+		fmt.Printf("Verified %d cache entries: %d corrupted, %d removed\n", len(results), corrupted, removed)
+	}
+	if corrupted > removed {
+		return fmt.Errorf("%d corrupted cache entries left in the cache, remove them with --delete-corrupt", corrupted-removed)
+	}
+	return nil
+}
+
+// verifySource returns the reference a verified entry was pulled from,
+// or the images using it for a blob.
+func verifySource(r cache.VerifyResult) string {
+	source := r.Source
+	if r.Type == cache.OciBlobCacheType {
+		source = strings.Join(r.Referrers, ", ")
+	}
+	if source == "" {
+		return "an unknown source"
+	}
+	return source
+}
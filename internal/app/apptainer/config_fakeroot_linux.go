@@ -10,9 +10,16 @@
 package apptainer
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
 
 	"github.com/apptainer/apptainer/internal/pkg/fakeroot"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/sylog"
 )
 
 // FakerootConfigOp defines a type for a fakeroot
@@ -30,20 +37,73 @@ const (
 	FakerootDisableUser
 )
 
-// FakerootConfig allows to add/remove/enable/disable a user fakeroot
-// mapping entry in /etc/subuid and /etc/subgid files.
-func FakerootConfig(username string, op FakerootConfigOp) error {
+// FakerootConfig allows to add/remove/enable/disable the fakeroot
+// mapping entries of users in /etc/subuid and /etc/subgid files. Users
+// are processed in order, so that the ranges are allocated
+// deterministically. With dryRun, the changes are written to w as a
+// diff instead of being applied.
+func FakerootConfig(usernames []string, op FakerootConfigOp, dryRun bool, w io.Writer) error {
 	subUIDConfig, err := fakeroot.GetConfig(fakeroot.SubUIDFile, true, nil)
 	if err != nil {
 		return fmt.Errorf("while opening %s: %s", fakeroot.SubUIDFile, err)
 	}
+	defer subUIDConfig.Discard()
+
 	subGIDConfig, err := fakeroot.GetConfig(fakeroot.SubGIDFile, true, nil)
 	if err != nil {
 		return fmt.Errorf("while opening %s: %s", fakeroot.SubGIDFile, err)
 	}
+	defer subGIDConfig.Discard()
+
+	bulk := len(usernames) > 1
+	if op == FakerootAddUser && bulk {
+		// report the conflicts of existing entries, including the
+		// ones added by other tools, before allocating new ranges
+		for _, c := range []*fakeroot.Config{subUIDConfig, subGIDConfig} {
+			for _, problem := range c.Audit(nil) {
+				sylog.Warningf("%s: %s", c.Name(), problem)
+			}
+		}
+	}
+
+	for _, username := range usernames {
+		if err := fakerootConfigUser(subUIDConfig, subGIDConfig, username, op); err != nil {
+			if !bulk {
+				return err
+			}
+			sylog.Warningf("%s, skipping this user", err)
+		}
+	}
+
+	if dryRun {
+		for _, c := range []*fakeroot.Config{subUIDConfig, subGIDConfig} {
+			if _, err := io.WriteString(w, c.Diff()); err != nil {
+				return fmt.Errorf("while writing diff: %s", err)
+			}
+		}
+		return nil
+	}
+
+	if err := subUIDConfig.Close(); err != nil {
+		return fmt.Errorf("while writing configuration: %s", err)
+	}
+	if err := subGIDConfig.Close(); err != nil {
+		return fmt.Errorf("while writing configuration: %s", err)
+	}
+
+	return nil
+}
 
+// fakerootConfigUser applies a configuration operation to the mapping
+// entries of a user.
+func fakerootConfigUser(subUIDConfig, subGIDConfig *fakeroot.Config, username string, op FakerootConfigOp) error {
 	switch op {
 	case FakerootAddUser:
+		for _, c := range []*fakeroot.Config{subUIDConfig, subGIDConfig} {
+			if e, err := c.GetUserEntry(username); err == nil {
+				sylog.Infof("%s already has a mapping entry in %s starting at %d", username, c.Name(), e.Start)
+			}
+		}
 		if err := subUIDConfig.AddUser(username); err != nil {
 			return fmt.Errorf("while adding %s: %s", username, err)
 		}
@@ -74,13 +134,101 @@ func FakerootConfig(username string, op FakerootConfigOp) error {
 	default:
 		return fmt.Errorf("unknown configuration operation")
 	}
+	return nil
+}
 
-	if err := subUIDConfig.Close(); err != nil {
-		return fmt.Errorf("while writing configuration: %s", err)
+// FakerootUsersFromFile returns the usernames listed in a file, one per
+// line, ignoring empty lines, comments and duplicates.
+func FakerootUsersFromFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("while opening %s: %s", path, err)
 	}
-	if err := subGIDConfig.Close(); err != nil {
-		return fmt.Errorf("while writing configuration: %s", err)
+	defer f.Close()
+
+	var usernames []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		username := strings.TrimSpace(scanner.Text())
+		if username == "" || strings.HasPrefix(username, "#") || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("while reading %s: %s", path, err)
+	}
+	return usernames, nil
+}
 
-	return nil
+// FakerootUsersFromGroup returns the sorted usernames of the members of
+// a group, including the users having it as primary group.
+func FakerootUsersFromGroup(groupname string) ([]string, error) {
+	g, err := user.GetGrNam(groupname)
+	if err != nil {
+		return nil, fmt.Errorf("while looking up group %s: %s", groupname, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, member := range g.Members {
+		seen[member] = true
+	}
+	for _, u := range user.GetAllPw() {
+		if u.GID == g.GID {
+			seen[u.Name] = true
+		}
+	}
+
+	usernames := make([]string, 0, len(seen))
+	for username := range seen {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
+
+// FakerootValidate audits /etc/subuid and /etc/subgid files and writes
+// the problems found to w: invalid entries, entries of unknown users,
+// duplicate entries, overlapping ranges and ranges including the ids of
+// existing users or groups. It returns an error if a problem is found.
+func FakerootValidate(w io.Writer) error {
+	uids := make(map[uint32]string)
+	for _, u := range user.GetAllPw() {
+		uids[u.UID] = "user " + u.Name
+	}
+	gids := make(map[uint32]string)
+	for _, g := range user.GetAllGr() {
+		gids[g.GID] = "group " + g.Name
+	}
+
+	count := 0
+	for _, file := range []struct {
+		path string
+		ids  map[uint32]string
+	}{
+		{fakeroot.SubUIDFile, uids},
+		{fakeroot.SubGIDFile, gids},
+	} {
+		c, err := fakeroot.GetConfig(file.path, false, nil)
+		if err != nil {
+			return fmt.Errorf("while opening %s: %s", file.path, err)
+		}
+		problems := c.Audit(file.ids)
+		c.Close()
+
+		for _, problem := range problems {
+			if _, err := fmt.Fprintf(w, "%s: %s\n", file.path, problem); err != nil {
+				return fmt.Errorf("while writing problems: %s", err)
+			}
+		}
+		count += len(problems)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("found %d problem(s) in %s and %s", count, fakeroot.SubUIDFile, fakeroot.SubGIDFile)
+	}
+	_, err := fmt.Fprintf(w, "No problem found in %s and %s\n", fakeroot.SubUIDFile, fakeroot.SubGIDFile)
+	return err
 }
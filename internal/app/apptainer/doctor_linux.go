@@ -0,0 +1,456 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
+	"github.com/apptainer/apptainer/internal/pkg/fakeroot"
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs/overlay"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+	"github.com/apptainer/apptainer/pkg/util/namespaces"
+	"golang.org/x/sys/unix"
+)
+
+// Flows checked by apptainer doctor, selected with --for.
+const (
+	DoctorExec     = "exec"
+	DoctorBuild    = "build"
+	DoctorInstance = "instance"
+	DoctorFakeroot = "fakeroot"
+)
+
+// DoctorFlows lists the flows checked by apptainer doctor.
+var DoctorFlows = []string{DoctorExec, DoctorBuild, DoctorInstance, DoctorFakeroot}
+
+// Check statuses of apptainer doctor.
+const (
+	DoctorPass = "pass"
+	DoctorWarn = "warn"
+	DoctorFail = "fail"
+)
+
+// minTmpSpace is the free space of the temporary directory under which
+// a warning is reported, as building or extracting images may fill it.
+const minTmpSpace = 1 << 30
+
+// DoctorCheck is the result of a check of apptainer doctor.
+type DoctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Details string `json:"details"`
+	// Hint is a remediation hint for a warning or a failure
+	Hint string `json:"hint,omitempty"`
+}
+
+// DoctorReport holds the checks run by apptainer doctor.
+type DoctorReport struct {
+	Flows  []string      `json:"flows"`
+	Checks []DoctorCheck `json:"checks"`
+	// Failed is true when a check failed, preventing the checked flows
+	Failed bool `json:"failed"`
+}
+
+// doctorEnv holds the state shared by the checks.
+type doctorEnv struct {
+	uid    uint32
+	suid   bool
+	conf   *apptainerconf.File
+	tmpDir string
+	cache  *cache.Handle
+}
+
+// doctorChecks lists the checks and the flows they apply to.
+var doctorChecks = []struct {
+	flows []string
+	run   func(e *doctorEnv) []DoctorCheck
+}{
+	{[]string{DoctorExec, DoctorBuild, DoctorInstance}, checkSetuidStarter},
+	{[]string{DoctorExec, DoctorBuild, DoctorInstance, DoctorFakeroot}, checkUserNamespaces},
+	{[]string{DoctorBuild, DoctorFakeroot}, checkFakeroot},
+	{[]string{DoctorExec, DoctorInstance}, checkFuseBinaries},
+	{[]string{DoctorInstance}, checkCgroups},
+	{[]string{DoctorExec, DoctorBuild}, checkTmpDir},
+	{[]string{DoctorExec, DoctorBuild}, checkCacheDir},
+	{[]string{DoctorExec, DoctorBuild, DoctorInstance}, checkConfig},
+}
+
+// Doctor runs the checks of the environment for the flows, or for all
+// flows when empty, using tmpDir as temporary directory and the image
+// cache imgCache.
+func Doctor(flows []string, tmpDir string, imgCache *cache.Handle) (*DoctorReport, error) {
+	if len(flows) == 0 {
+		flows = DoctorFlows
+	}
+	for _, f := range flows {
+		if !contains(DoctorFlows, f) {
+			return nil, fmt.Errorf("unknown flow %q, must be one of %s", f, strings.Join(DoctorFlows, ", "))
+		}
+	}
+
+	conf := apptainerconf.GetCurrentConfig()
+	if conf == nil {
+		var err error
+		conf, err = apptainerconf.Parse("")
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse apptainer configuration file: %w", err)
+		}
+	}
+
+	// the setuid starter is used unless disabled by configuration, running
+	// as root or already inside a user namespace, like in the launcher
+	e := &doctorEnv{
+		uid:    uint32(os.Getuid()),
+		conf:   conf,
+		tmpDir: tmpDir,
+		cache:  imgCache,
+	}
+	insideUserNs, _ := namespaces.IsInsideUserNamespace(os.Getpid())
+	e.suid = buildcfg.APPTAINER_SUID_INSTALL == 1 && e.uid != 0 && !insideUserNs && conf.AllowSetuid
+
+	r := &DoctorReport{Flows: flows}
+	for _, c := range doctorChecks {
+		run := false
+		for _, f := range flows {
+			if contains(c.flows, f) {
+				run = true
+				break
+			}
+		}
+		if !run {
+			continue
+		}
+		for _, res := range c.run(e) {
+			if res.Status == DoctorFail {
+				r.Failed = true
+			}
+			r.Checks = append(r.Checks, res)
+		}
+	}
+	return r, nil
+}
+
+// PrintDoctor prints the checks of apptainer doctor for the flows, in a
+// regular or a JSON format (if formatJSON is true) to the passed writer.
+// It returns an error when a check failed.
+func PrintDoctor(w io.Writer, flows []string, tmpDir string, imgCache *cache.Handle, formatJSON bool) error {
+	r, err := Doctor(flows, tmpDir, imgCache)
+	if err != nil {
+		return err
+	}
+
+	if formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("could not encode doctor checks: %v", err)
+		}
+	} else {
+		tabWriter := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+		if _, err := fmt.Fprintln(tabWriter, "CHECK\tSTATUS\tDETAILS"); err != nil {
+			return fmt.Errorf("could not write checks header: %v", err)
+		}
+		for _, c := range r.Checks {
+			if _, err := fmt.Fprintf(tabWriter, "%s\t%s\t%s\n", c.Name, c.Status, c.Details); err != nil {
+				return fmt.Errorf("could not write checks: %v", err)
+			}
+			if c.Hint != "" {
+				if _, err := fmt.Fprintf(tabWriter, "\t\t-> %s\n", c.Hint); err != nil {
+					return fmt.Errorf("could not write checks: %v", err)
+				}
+			}
+		}
+		if err := tabWriter.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if r.Failed {
+		return fmt.Errorf("environment is not usable for %s", strings.Join(r.Flows, ", "))
+	}
+	return nil
+}
+
+// checkSetuidStarter checks the permissions of the setuid starter when
+// it's used.
+func checkSetuidStarter(e *doctorEnv) []DoctorCheck {
+	c := DoctorCheck{Name: "setuid starter", Status: DoctorPass}
+	switch {
+	case buildcfg.APPTAINER_SUID_INSTALL == 0:
+		c.Details = "unprivileged installation, user namespaces are used"
+		return []DoctorCheck{c}
+	case !e.conf.AllowSetuid:
+		c.Status = DoctorWarn
+		c.Details = "disabled by 'allow setuid = no', user namespaces are used"
+		c.Hint = "set 'allow setuid = yes' in apptainer.conf to use the setuid flow"
+		return []DoctorCheck{c}
+	case !e.suid:
+		c.Details = "not used by root or inside a user namespace"
+		return []DoctorCheck{c}
+	}
+
+	path := starterSuidPath()
+	fi, err := os.Stat(path)
+	if err != nil {
+		c.Status = DoctorFail
+		c.Details = err.Error()
+		c.Hint = "reinstall apptainer with its setuid starter, or set 'allow setuid = no' in apptainer.conf"
+		return []DoctorCheck{c}
+	}
+	if !isSetuidRoot(fi) {
+		c.Status = DoctorFail
+		c.Details = fmt.Sprintf("%s is not setuid root", path)
+		c.Hint = fmt.Sprintf("run 'chown root %s && chmod 4755 %s', or check that its filesystem is not mounted nosuid", path, path)
+		return []DoctorCheck{c}
+	}
+	c.Details = fmt.Sprintf("%s is setuid root", path)
+	return []DoctorCheck{c}
+}
+
+// starterSuidPath returns the path of the setuid starter.
+func starterSuidPath() string {
+	return filepath.Join(buildcfg.LIBEXECDIR, "apptainer/bin/starter-suid")
+}
+
+// isSetuidRoot returns whether the file is owned by root with the setuid
+// bit set.
+func isSetuidRoot(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && fi.Mode()&os.ModeSetuid != 0 && st.Uid == 0
+}
+
+// checkUserNamespaces checks that unprivileged user namespaces can be
+// created, which is required unless the setuid starter is used.
+func checkUserNamespaces(e *doctorEnv) []DoctorCheck {
+	c := DoctorCheck{Name: "user namespaces", Status: DoctorPass, Details: "unprivileged user namespaces can be created"}
+	if err := fakeroot.CheckRootMapped(); err != nil {
+		c.Status = DoctorFail
+		c.Details = err.Error()
+		if e.suid || e.uid == 0 {
+			c.Status = DoctorWarn
+		}
+		c.Hint = "enable unprivileged user namespaces, e.g. 'sysctl -w user.max_user_namespaces=15000'"
+	}
+	return []DoctorCheck{c}
+}
+
+// checkFakeroot checks the requirements of the --fakeroot mechanisms
+// with the diagnostics of apptainer fakeroot --check.
+func checkFakeroot(e *doctorEnv) []DoctorCheck {
+	d := fakeroot.Diagnose(e.uid, e.suid)
+
+	var checks []DoctorCheck
+	for _, c := range d.Checks {
+		var hint string
+		switch c.Name {
+		case fakeroot.SubUIDFile, fakeroot.SubGIDFile:
+			hint = "ask an administrator to run 'apptainer config fakeroot --add <user>'"
+		case "newuidmap", "newgidmap":
+			hint = "install the uidmap or shadow-utils package providing " + c.Name
+		case "fakeroot command":
+			hint = "install the fakeroot package"
+		default:
+			// user namespace checks are reported by checkUserNamespaces
+			continue
+		}
+		dc := DoctorCheck{Name: c.Name, Status: DoctorPass, Details: c.Details}
+		if c.Status == fakeroot.CheckFail {
+			// a failing mechanism doesn't prevent --fakeroot if
+			// another one is usable
+			dc.Status = DoctorWarn
+			dc.Hint = hint
+		}
+		checks = append(checks, dc)
+	}
+
+	c := DoctorCheck{Name: "fakeroot mechanism", Status: DoctorPass, Details: fmt.Sprintf("%s (%s)", d.Mechanism, d.Reason)}
+	if !d.Usable {
+		c.Status = DoctorFail
+		c.Hint = "run 'apptainer fakeroot --check' for details"
+	}
+	return append(checks, c)
+}
+
+// checkFuseBinaries checks for the FUSE binaries used to mount images
+// and overlays without privileges.
+func checkFuseBinaries(e *doctorEnv) []DoctorCheck {
+	binaries := []struct {
+		name string
+		hint string
+	}{
+		{"squashfuse", "install squashfuse, otherwise SIF images are extracted to a temporary sandbox"},
+		{"fuse-overlayfs", "install fuse-overlayfs, otherwise writable overlays may not be usable"},
+		{"fuse2fs", "install fuse2fs from e2fsprogs, otherwise ext3 overlay images are not usable"},
+	}
+
+	var checks []DoctorCheck
+	for _, b := range binaries {
+		c := DoctorCheck{Name: b.name, Status: DoctorPass}
+		path, err := bin.FindBin(b.name)
+		switch {
+		case err == nil:
+			c.Details = "found at " + path
+		case e.suid || e.uid == 0:
+			c.Details = "not found, images are mounted by the kernel"
+		default:
+			c.Status = DoctorWarn
+			c.Details = err.Error()
+			c.Hint = b.hint
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// checkCgroups checks that cgroups can be used to apply resource limits.
+func checkCgroups(e *doctorEnv) []DoctorCheck {
+	c := DoctorCheck{Name: "cgroup delegation", Status: DoctorPass}
+	if e.uid == 0 {
+		c.Details = "not needed by root"
+		return []DoctorCheck{c}
+	}
+	if err := cgroups.CheckRootless(e.conf.SystemdCgroups); err != nil {
+		c.Status = DoctorWarn
+		c.Details = err.Error()
+		c.Hint = "resource limits like --cpus and --memory are not available without delegated cgroups"
+		return []DoctorCheck{c}
+	}
+	c.Details = "cgroups v2 delegated through systemd"
+	return []DoctorCheck{c}
+}
+
+// checkTmpDir checks that the temporary directory is writable and has
+// enough free space.
+func checkTmpDir(e *doctorEnv) []DoctorCheck {
+	c := DoctorCheck{Name: "temporary directory", Status: DoctorPass}
+	hint := "set APPTAINER_TMPDIR to a writable directory with enough free space"
+
+	if !fs.IsDir(e.tmpDir) || !fs.IsWritable(e.tmpDir) {
+		c.Status = DoctorFail
+		c.Details = fmt.Sprintf("%s is not a writable directory", e.tmpDir)
+		c.Hint = hint
+		return []DoctorCheck{c}
+	}
+
+	var st unix.Statfs_t
+	if err := unix.Statfs(e.tmpDir, &st); err != nil {
+		c.Status = DoctorWarn
+		c.Details = fmt.Sprintf("could not get the free space of %s: %s", e.tmpDir, err)
+		return []DoctorCheck{c}
+	}
+	free := st.Bavail * uint64(st.Bsize)
+	c.Details = fmt.Sprintf("%s has %d MiB free", e.tmpDir, free>>20)
+	if free < minTmpSpace {
+		c.Status = DoctorWarn
+		c.Hint = hint
+	}
+	return []DoctorCheck{c}
+}
+
+// checkCacheDir checks that the image cache is usable, which is not the
+// case as root with an NFS cache directory exported with root squash.
+func checkCacheDir(e *doctorEnv) []DoctorCheck {
+	c := DoctorCheck{Name: "cache directory", Status: DoctorPass}
+	hint := "set APPTAINER_CACHEDIR to a local writable directory"
+
+	if e.cache.IsDisabled() && e.cache.ParentDir() == "" {
+		c.Status = DoctorWarn
+		c.Details = "disabled by " + cache.DisableEnv
+		c.Hint = "images are pulled again for each command while the cache is disabled"
+		return []DoctorCheck{c}
+	}
+
+	dir, err := fs.FirstExistingParent(e.cache.ParentDir())
+	if err != nil {
+		c.Status = DoctorFail
+		c.Details = err.Error()
+		c.Hint = hint
+		return []DoctorCheck{c}
+	}
+	var st unix.Statfs_t
+	nfs := unix.Statfs(dir, &st) == nil && int64(st.Type) == overlay.Nfs
+
+	switch {
+	case !e.cache.IsDisabled():
+		c.Details = fmt.Sprintf("%s is writable", e.cache.ParentDir())
+		if nfs {
+			c.Details += " (NFS)"
+		}
+	case nfs && e.uid == 0:
+		c.Status = DoctorFail
+		c.Details = fmt.Sprintf("%s is on NFS and not writable by root, likely exported with root squash", dir)
+		c.Hint = hint
+	default:
+		c.Status = DoctorFail
+		c.Details = fmt.Sprintf("%s is not writable", dir)
+		c.Hint = hint
+	}
+	return []DoctorCheck{c}
+}
+
+// checkConfig checks the apptainer.conf directives disallowing images
+// or features used by the common flows.
+func checkConfig(e *doctorEnv) []DoctorCheck {
+	directives := []struct {
+		directive string
+		allowed   bool
+	}{
+		{"allow container sif", e.conf.AllowContainerSIF},
+		{"allow container dir", e.conf.AllowContainerDir},
+		{"allow container squashfs", e.conf.AllowContainerSquashfs},
+		{"allow container extfs", e.conf.AllowContainerExtfs},
+		{"allow container encrypted", e.conf.AllowContainerEncrypted},
+		{"allow container tar", e.conf.AllowContainerTar},
+	}
+
+	var checks []DoctorCheck
+	for _, d := range directives {
+		if d.allowed {
+			continue
+		}
+		checks = append(checks, DoctorCheck{
+			Name:    "apptainer.conf",
+			Status:  DoctorWarn,
+			Details: fmt.Sprintf("'%s = no' disallows these images", d.directive),
+			Hint:    fmt.Sprintf("ask an administrator to set '%s = yes'", d.directive),
+		})
+	}
+	if !e.conf.AllowContainerSIF && !e.conf.AllowContainerDir {
+		checks = append(checks, DoctorCheck{
+			Name:    "apptainer.conf",
+			Status:  DoctorFail,
+			Details: "neither SIF nor sandbox images are allowed",
+			Hint:    "ask an administrator to set 'allow container sif = yes'",
+		})
+	}
+	if len(e.conf.LimitContainerPaths) > 0 {
+		checks = append(checks, DoctorCheck{
+			Name:    "apptainer.conf",
+			Status:  DoctorWarn,
+			Details: "images are limited to " + strings.Join(e.conf.LimitContainerPaths, ", "),
+			Hint:    "run images from one of the paths in 'limit container paths'",
+		})
+	}
+	if len(checks) == 0 {
+		checks = append(checks, DoctorCheck{Name: "apptainer.conf", Status: DoctorPass, Details: "all image formats allowed"})
+	}
+	return checks
+}
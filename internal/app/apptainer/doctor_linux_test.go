@@ -0,0 +1,117 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+)
+
+func newDoctorCache(t *testing.T) *cache.Handle {
+	t.Helper()
+	h, err := cache.New(cache.Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %s", err)
+	}
+	return h
+}
+
+func TestDoctorFlows(t *testing.T) {
+	conf, err := apptainerconf.Parse("")
+	if err != nil {
+		t.Fatalf("while parsing default configuration: %s", err)
+	}
+	apptainerconf.SetCurrentConfig(conf)
+	defer apptainerconf.SetCurrentConfig(nil)
+
+	h := newDoctorCache(t)
+
+	if _, err := Doctor([]string{"bogus"}, t.TempDir(), h); err == nil {
+		t.Errorf("unexpected success with an unknown flow")
+	}
+
+	tests := []struct {
+		flows []string
+		want  []string
+		skip  []string
+	}{
+		{
+			flows: []string{DoctorInstance},
+			want:  []string{"setuid starter", "user namespaces", "squashfuse", "cgroup delegation", "apptainer.conf"},
+			skip:  []string{"temporary directory", "cache directory", "fakeroot mechanism"},
+		},
+		{
+			flows: []string{DoctorFakeroot},
+			want:  []string{"user namespaces", "fakeroot mechanism"},
+			skip:  []string{"setuid starter", "squashfuse", "apptainer.conf"},
+		},
+		{
+			flows: []string{DoctorExec, DoctorBuild},
+			want:  []string{"temporary directory", "cache directory", "squashfuse", "fakeroot mechanism"},
+			skip:  []string{"cgroup delegation"},
+		},
+	}
+	for _, tt := range tests {
+		r, err := Doctor(tt.flows, t.TempDir(), h)
+		if err != nil {
+			t.Fatalf("unexpected error for %v: %s", tt.flows, err)
+		}
+		names := make(map[string]bool)
+		for _, c := range r.Checks {
+			names[c.Name] = true
+		}
+		for _, n := range tt.want {
+			if !names[n] {
+				t.Errorf("check %q not run for %v", n, tt.flows)
+			}
+		}
+		for _, n := range tt.skip {
+			if names[n] {
+				t.Errorf("check %q unexpectedly run for %v", n, tt.flows)
+			}
+		}
+	}
+}
+
+func TestDoctorChecks(t *testing.T) {
+	conf, err := apptainerconf.Parse("")
+	if err != nil {
+		t.Fatalf("while parsing default configuration: %s", err)
+	}
+
+	e := &doctorEnv{conf: conf, tmpDir: filepath.Join(t.TempDir(), "missing"), cache: newDoctorCache(t)}
+	if c := checkTmpDir(e); c[0].Status != DoctorFail || c[0].Hint == "" {
+		t.Errorf("missing temporary directory reported as %+v", c[0])
+	}
+	e.tmpDir = t.TempDir()
+	if c := checkTmpDir(e); c[0].Status == DoctorFail {
+		t.Errorf("temporary directory reported as %+v", c[0])
+	}
+	if c := checkCacheDir(e); c[0].Status != DoctorPass {
+		t.Errorf("cache directory reported as %+v", c[0])
+	}
+
+	if c := checkConfig(e); len(c) != 1 || c[0].Status != DoctorPass {
+		t.Errorf("default configuration reported as %+v", c)
+	}
+	conf.AllowContainerSIF = false
+	conf.AllowContainerDir = false
+	failed := false
+	for _, c := range checkConfig(e) {
+		if c.Status == DoctorFail {
+			failed = true
+		}
+	}
+	if !failed {
+		t.Errorf("configuration disallowing SIF and sandbox images not reported as a failure")
+	}
+}
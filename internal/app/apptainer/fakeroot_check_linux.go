@@ -0,0 +1,67 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/fakeroot"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+	"github.com/apptainer/apptainer/pkg/util/namespaces"
+)
+
+// PrintFakerootCheck prints the diagnostics of the --fakeroot mechanisms
+// for the current user, in a regular or a JSON format (if formatJSON is
+// true) to the passed writer. It returns an error when --fakeroot would
+// fail.
+func PrintFakerootCheck(w io.Writer, formatJSON bool) error {
+	// the setuid starter is used unless disabled by configuration or
+	// already inside a user namespace, like in the launcher
+	insideUserNs, _ := namespaces.IsInsideUserNamespace(os.Getpid())
+	suid := buildcfg.APPTAINER_SUID_INSTALL == 1 && !insideUserNs
+	if conf := apptainerconf.GetCurrentConfig(); conf != nil && !conf.AllowSetuid {
+		suid = false
+	}
+
+	d := fakeroot.Diagnose(uint32(os.Getuid()), suid)
+
+	if formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(d); err != nil {
+			return fmt.Errorf("could not encode fakeroot diagnostics: %v", err)
+		}
+	} else {
+		tabWriter := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+		if _, err := fmt.Fprintln(tabWriter, "CHECK\tSTATUS\tDETAILS"); err != nil {
+			return fmt.Errorf("could not write diagnostics header: %v", err)
+		}
+		for _, c := range d.Checks {
+			if _, err := fmt.Fprintf(tabWriter, "%s\t%s\t%s\n", c.Name, c.Status, c.Details); err != nil {
+				return fmt.Errorf("could not write diagnostics: %v", err)
+			}
+		}
+		if err := tabWriter.Flush(); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "\nSelected mechanism: %s (%s)\n", d.Mechanism, d.Reason); err != nil {
+			return fmt.Errorf("could not write diagnostics: %v", err)
+		}
+	}
+
+	if !d.Usable {
+		return fmt.Errorf("--fakeroot is not usable: %s", d.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/network"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+	"github.com/containernetworking/cni/libcni"
+)
+
+// selfMountInfo is the mount table searched for the FUSE mounts left by
+// stale instances.
+var selfMountInfo = "/proc/self/mountinfo"
+
+// CleanupInstances releases the resources left by the stale instances of
+// username, or of the current user if empty, matching the name pattern:
+// instances whose starter process is gone or which were started before
+// the last boot. It unmounts their FUSE mounts, removes their cgroup,
+// releases their CNI network resources and deletes their files. With
+// dryRun, the stale instances and their resources are only reported.
+// The files of the instances successfully cleaned up are returned.
+func CleanupInstances(username, name string, dryRun bool) ([]*instance.File, error) {
+	stale, err := instance.Stale(username, name, instance.AppSubDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve stale instances: %v", err)
+	}
+	cleaned := make([]*instance.File, 0, len(stale))
+	for _, i := range stale {
+		if dryRun {
+			reportStaleInstance(i)
+			continue
+		}
+		if err := cleanupInstance(i); err != nil {
+			sylog.Warningf("Could not clean up stale %s instance of %s: %s", i.Name, i.User, err)
+			continue
+		}
+		sylog.Infof("Cleaned up stale %s instance of %s", i.Name, i.Image)
+		cleaned = append(cleaned, i)
+	}
+	return cleaned, nil
+}
+
+// CleanupAllUsersInstances cleans up the stale instances of all users
+// matching the name pattern, like CleanupInstances.
+func CleanupAllUsersInstances(name string, dryRun bool) ([]*instance.File, error) {
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("only root can clean up the instances of all users")
+	}
+	var cleaned []*instance.File
+	for _, u := range user.GetAllPw() {
+		ii, err := CleanupInstances(u.Name, name, dryRun)
+		if err != nil {
+			sylog.Debugf("Could not clean up the instances of %s: %s", u.Name, err)
+			continue
+		}
+		cleaned = append(cleaned, ii...)
+	}
+	return cleaned, nil
+}
+
+// reportStaleInstance reports a stale instance and the resources which
+// would be released.
+func reportStaleInstance(i *instance.File) {
+	fmt.Printf("Stale %s instance of %s (user %s, PID=%d)\n", i.Name, i.Image, i.User, i.Pid)
+	if i.Running() {
+		fmt.Printf("  process %d still exists, resources left untouched\n", i.Pid)
+		return
+	}
+	points, err := i.StaleMounts(selfMountInfo)
+	if err != nil {
+		sylog.Debugf("Could not read mount table: %s", err)
+	}
+	for _, p := range points {
+		fmt.Printf("  would unmount %s\n", p)
+	}
+	if path := i.StaleCgroup(); path != "" {
+		fmt.Printf("  would remove cgroup %s\n", path)
+	}
+	if i.Networks != nil {
+		for _, n := range i.Networks.List {
+			conf, err := libcni.ConfListFromBytes(n.Config)
+			if err != nil {
+				continue
+			}
+			fmt.Printf("  would release network %s resources\n", conf.Name)
+		}
+	}
+	fmt.Printf("  would delete %s\n", i.Path)
+}
+
+// cleanupInstance releases the resources of a stale instance and deletes
+// its files. Only the resources positively identified as created for the
+// instance are released, and nothing is released while the instance pid
+// belongs to a process, as it may be the container process which survived
+// its parent or a new process reusing the pid.
+func cleanupInstance(i *instance.File) error {
+	if i.Running() {
+		return fmt.Errorf("process %d still exists", i.Pid)
+	}
+
+	points, err := i.StaleMounts(selfMountInfo)
+	if err != nil {
+		return fmt.Errorf("could not read mount table: %s", err)
+	}
+	for _, p := range points {
+		sylog.Verbosef("Unmounting %s", p)
+		if err := unmountFuse(p); err != nil {
+			return fmt.Errorf("could not unmount %s: %s", p, err)
+		}
+	}
+
+	if path := i.StaleCgroup(); path != "" {
+		if err := removeStaleCgroup(path); err != nil {
+			return fmt.Errorf("could not remove cgroup %s: %s", path, err)
+		}
+	}
+
+	if i.Networks != nil && len(i.Networks.List) > 0 {
+		if os.Geteuid() != 0 {
+			return fmt.Errorf("releasing its network resources requires root, run 'sudo apptainer instance cleanup --all-users'")
+		}
+		if err := releaseStaleNetworks(i); err != nil {
+			return fmt.Errorf("could not release network resources: %s", err)
+		}
+	}
+
+	return i.DeleteStale()
+}
+
+// unmountFuse lazily unmounts the FUSE mount point, with fusermount
+// for unprivileged users.
+func unmountFuse(point string) error {
+	if os.Geteuid() == 0 {
+		err := syscall.Unmount(point, syscall.MNT_DETACH)
+		if err == syscall.EINVAL {
+			// not a mount point anymore
+			return nil
+		}
+		return err
+	}
+	for _, name := range []string{"fusermount3", "fusermount"} {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			continue
+		}
+		if out, err := exec.Command(path, "-u", "-z", point).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %s", err, out)
+		}
+		return nil
+	}
+	return fmt.Errorf("fusermount not found")
+}
+
+// removeStaleCgroup removes the cgroup at path, unless processes are
+// still attached to it.
+func removeStaleCgroup(path string) error {
+	manager, err := cgroups.GetManagerForGroup(path)
+	if err != nil {
+		return err
+	}
+	pids, err := manager.GetPids()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		// don't keep the instance files for a cgroup we can't manage
+		sylog.Debugf("Could not get processes of cgroup %s: %s", path, err)
+		return nil
+	}
+	if len(pids) > 0 {
+		return fmt.Errorf("%d processes are still attached", len(pids))
+	}
+	sylog.Verbosef("Removing cgroup %s", path)
+	return manager.Destroy()
+}
+
+// systemCNIPath returns the CNI configuration and plugin directories set
+// in apptainer.conf. The paths stored in an instance file are ignored, the
+// file being writable by the instance owner while root releases its
+// networks.
+func systemCNIPath() *network.CNIPath {
+	cniPath := &network.CNIPath{
+		Conf:   filepath.Join(buildcfg.SYSCONFDIR, "apptainer", "network"),
+		Plugin: filepath.Join(buildcfg.LIBEXECDIR, "apptainer", "cni"),
+	}
+	if conf := apptainerconf.GetCurrentConfig(); conf != nil {
+		if conf.CniConfPath != "" {
+			cniPath.Conf = conf.CniConfPath
+		}
+		if conf.CniPluginPath != "" {
+			cniPath.Plugin = conf.CniPluginPath
+		}
+	}
+	return cniPath
+}
+
+// rootNetworkConfigs returns the network configurations of the directory
+// dir in files owned and only writable by root.
+func rootNetworkConfigs(dir string) ([]*libcni.NetworkConfigList, error) {
+	files, err := libcni.ConfFiles(dir, []string{".conf", ".json", ".conflist"})
+	if err != nil {
+		return nil, err
+	}
+	confs := make([]*libcni.NetworkConfigList, 0, len(files))
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if st := fi.Sys().(*syscall.Stat_t); st.Uid != 0 || fi.Mode().Perm()&0o022 != 0 {
+			sylog.Debugf("Ignoring network configuration %s not owned by root", file)
+			continue
+		}
+		var conf *libcni.NetworkConfigList
+		if strings.HasSuffix(file, ".conflist") {
+			conf, err = libcni.ConfListFromFile(file)
+		} else {
+			var c *libcni.NetworkConfig
+			if c, err = libcni.ConfFromFile(file); err == nil {
+				conf, err = libcni.ConfListFromConf(c)
+			}
+		}
+		if err != nil {
+			sylog.Debugf("Ignoring network configuration %s: %s", file, err)
+			continue
+		}
+		confs = append(confs, conf)
+	}
+	return confs, nil
+}
+
+// definedNetwork returns whether the stored network configuration config
+// matches one of the network configurations defined.
+func definedNetwork(config []byte, defined []*libcni.NetworkConfigList) bool {
+	var stored bytes.Buffer
+	if err := json.Compact(&stored, config); err != nil {
+		return false
+	}
+	for _, d := range defined {
+		var b bytes.Buffer
+		if err := json.Compact(&b, d.Bytes); err == nil && bytes.Equal(b.Bytes(), stored.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseStaleNetworks invokes CNI DEL for the networks of the stale
+// instance with their stored configuration, the network namespace being
+// gone. Only the networks whose configuration matches a network defined
+// by root in the CNI configuration directory of apptainer.conf are
+// released, with the plugins of apptainer.conf.
+func releaseStaleNetworks(i *instance.File) error {
+	cniPath := systemCNIPath()
+	defined, err := rootNetworkConfigs(cniPath.Conf)
+	if err != nil {
+		return err
+	}
+
+	confList := make([]*libcni.NetworkConfigList, 0, len(i.Networks.List))
+	networks := make([]network.Network, 0, len(i.Networks.List))
+	for _, n := range i.Networks.List {
+		conf, err := libcni.ConfListFromBytes(n.Config)
+		if err != nil {
+			return err
+		}
+		if !definedNetwork(n.Config, defined) {
+			sylog.Warningf("Not releasing network %s of instance %s, its configuration doesn't match a network defined in %s", conf.Name, i.Name, cniPath.Conf)
+			continue
+		}
+		rt := &libcni.RuntimeConf{}
+		if err := json.Unmarshal(n.Runtime, rt); err != nil {
+			return err
+		}
+		if rt.ContainerID != strconv.Itoa(i.Pid) {
+			return fmt.Errorf("network %s was set up for container %s, not %d", conf.Name, rt.ContainerID, i.Pid)
+		}
+		rt.NetNS = ""
+		confList = append(confList, conf)
+		networks = append(networks, network.Network{Config: conf, Runtime: rt})
+	}
+	if len(networks) == 0 {
+		return nil
+	}
+
+	setup, err := network.NewSetupFromConfig(confList, strconv.Itoa(i.Pid), "", cniPath)
+	if err != nil {
+		return err
+	}
+	if err := setup.SetNetworks(networks); err != nil {
+		return err
+	}
+	setup.SetEnvPath("/bin:/sbin:/usr/bin:/usr/sbin")
+	sylog.Verbosef("Releasing network resources of instance %s", i.Name)
+	return setup.DelNetworks(context.Background())
+}
@@ -0,0 +1,119 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+)
+
+const testNetworkConf = `{
+	"cniVersion": "0.3.1",
+	"name": "test",
+	"plugins": [{"type": "test-plugin"}]
+}`
+
+// writeTestPlugin writes a CNI plugin in dir creating marker when invoked.
+func writeTestPlugin(t *testing.T, dir, marker string) {
+	t.Helper()
+	script := fmt.Sprintf("#!/bin/sh\ncat >/dev/null\ntouch %s\n", marker)
+	if err := os.WriteFile(filepath.Join(dir, "test-plugin"), []byte(script), 0o755); err != nil {
+		t.Fatalf("while writing plugin: %s", err)
+	}
+}
+
+func TestReleaseStaleNetworks(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("root-owned network configurations required")
+	}
+
+	tmp := t.TempDir()
+	confDir := filepath.Join(tmp, "conf")
+	pluginDir := filepath.Join(tmp, "plugin")
+	userConfDir := filepath.Join(tmp, "userconf")
+	userPluginDir := filepath.Join(tmp, "userplugin")
+	for _, d := range []string{confDir, pluginDir, userConfDir, userPluginDir} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(confDir, "00_test.conflist"), []byte(testNetworkConf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	systemMarker := filepath.Join(tmp, "system")
+	userMarker := filepath.Join(tmp, "user")
+	writeTestPlugin(t, pluginDir, systemMarker)
+	writeTestPlugin(t, userPluginDir, userMarker)
+
+	conf, err := apptainerconf.Parse("")
+	if err != nil {
+		t.Fatalf("while parsing default configuration: %s", err)
+	}
+	conf.CniConfPath = confDir
+	conf.CniPluginPath = pluginDir
+	apptainerconf.SetCurrentConfig(conf)
+	defer apptainerconf.SetCurrentConfig(nil)
+
+	runtime, err := json.Marshal(map[string]string{"ContainerID": "4242", "IfName": "eth0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		config     string
+		wantSystem bool
+	}{
+		{
+			name:       "defined network",
+			config:     testNetworkConf,
+			wantSystem: true,
+		},
+		{
+			name:   "undefined network",
+			config: `{"cniVersion": "0.3.1", "name": "test", "plugins": [{"type": "test-plugin", "evil": true}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(systemMarker)
+			os.Remove(userMarker)
+
+			// the instance file is writable by its owner, who points
+			// the stored paths to their own plugins
+			i := &instance.File{
+				Name: "test",
+				Pid:  4242,
+				Networks: &instance.Networks{
+					ConfPath:   userConfDir,
+					PluginPath: userPluginDir,
+					List: []instance.Network{
+						{Config: json.RawMessage(tt.config), Runtime: runtime},
+					},
+				},
+			}
+			if err := releaseStaleNetworks(i); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if _, err := os.Stat(userMarker); err == nil {
+				t.Errorf("plugin from the instance file plugin path was executed")
+			}
+			if _, err := os.Stat(systemMarker); (err == nil) != tt.wantSystem {
+				t.Errorf("configured plugin executed: %v, want %v", err == nil, tt.wantSystem)
+			}
+		})
+	}
+}
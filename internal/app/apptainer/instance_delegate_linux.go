@@ -0,0 +1,159 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"errors"
+	"fmt"
+	"log/syslog"
+	"os"
+	"os/exec"
+	osuser "os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// delegatedEnvPrefixes are the environment variables of the calling user
+// which are replaced by those of the target user of a delegated command.
+var delegatedEnvPrefixes = []string{
+	"HOME=",
+	"USER=",
+	"LOGNAME=",
+	"XDG_",
+	"DBUS_SESSION_BUS_ADDRESS=",
+	"SUDO_",
+	"APPTAINER_CACHEDIR=",
+	"SINGULARITY_CACHEDIR=",
+	"APPTAINER_CONFIGDIR=",
+	"SINGULARITY_CONFIGDIR=",
+}
+
+// AuditInstanceDelegation logs to syslog that root runs the instance
+// action on behalf of username.
+func AuditInstanceDelegation(action, name, username string) {
+	msg := fmt.Sprintf("UID=%d ACTION=%q INSTANCE=%q USER=%q ARGS=%q", os.Getuid(), action, name, username, strings.Join(os.Args, " "))
+
+	w, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_NOTICE, "apptainer")
+	if err != nil {
+		sylog.Warningf("Could not create syslog: %v", err)
+		return
+	}
+	defer w.Close()
+	if err := w.Notice(msg); err != nil {
+		sylog.Warningf("Could not write to syslog: %v", err)
+	}
+}
+
+// delegatedEnv returns environ with the user specific variables replaced
+// by those of u.
+func delegatedEnv(u *user.User, environ []string) []string {
+	env := make([]string, 0, len(environ))
+	for _, e := range environ {
+		keep := true
+		for _, p := range delegatedEnvPrefixes {
+			if strings.HasPrefix(e, p) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			env = append(env, e)
+		}
+	}
+	env = append(env, "HOME="+u.Dir, "USER="+u.Name, "LOGNAME="+u.Name)
+
+	// the systemd user session is required to create the rootless
+	// cgroups of the instance
+	runtimeDir := filepath.Join("/run/user", strconv.Itoa(int(u.UID)))
+	fi, err := os.Stat(runtimeDir)
+	if err != nil || fi.Sys().(*syscall.Stat_t).Uid != u.UID {
+		sylog.Warningf("No systemd user session for %s, resource limits may not be applied to the instance", u.Name)
+		sylog.Warningf("Enable it with 'loginctl enable-linger %s'", u.Name)
+		return env
+	}
+	env = append(env, "XDG_RUNTIME_DIR="+runtimeDir)
+	if bus := filepath.Join(runtimeDir, "bus"); isSocket(bus) {
+		env = append(env, "DBUS_SESSION_BUS_ADDRESS=unix:path="+bus)
+	}
+	return env
+}
+
+// isSocket returns if path is a unix socket.
+func isSocket(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode()&os.ModeSocket != 0
+}
+
+// userCredential returns the uid, gid and supplementary groups of u.
+func userCredential(u *user.User) (*syscall.Credential, error) {
+	pu, err := osuser.LookupId(strconv.Itoa(int(u.UID)))
+	if err != nil {
+		return nil, fmt.Errorf("could not find user %s: %w", u.Name, err)
+	}
+	gids, err := pu.GroupIds()
+	if err != nil {
+		return nil, fmt.Errorf("could not get groups of user %s: %w", u.Name, err)
+	}
+	groups := make([]uint32, 0, len(gids))
+	for _, g := range gids {
+		gid, err := strconv.ParseUint(g, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group %s of user %s", g, u.Name)
+		}
+		groups = append(groups, uint32(gid))
+	}
+	return &syscall.Credential{Uid: u.UID, Gid: u.GID, Groups: groups}, nil
+}
+
+// RunAsUser executes the current apptainer command as username with
+// its uid, gid, supplementary groups and environment, exactly as if the
+// user ran it, and returns its exit status. It must be called by root.
+func RunAsUser(username string) (int, error) {
+	if os.Getuid() != 0 {
+		return 0, fmt.Errorf("only root can run commands on behalf of another user")
+	}
+	u, err := user.GetPwNam(username)
+	if err != nil {
+		return 0, fmt.Errorf("could not find user %s: %w", username, err)
+	}
+	if u.UID == 0 {
+		return 0, fmt.Errorf("can't run commands on behalf of root")
+	}
+	cred, err := userCredential(u)
+	if err != nil {
+		return 0, err
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command(self, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = delegatedEnv(u, os.Environ())
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+
+	sylog.Debugf("Running %s as user %s (uid=%d gid=%d)", self, u.Name, u.UID, u.GID)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return signalutil.ExitCode(exitErr.Sys().(syscall.WaitStatus)), nil
+		}
+		return 0, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,306 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/syecl"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/sypgp"
+)
+
+// enabledStartTimeout is the time after which the start of an enabled
+// instance is aborted, so it doesn't block the others.
+const enabledStartTimeout = 5 * time.Minute
+
+// EnableInstance records the launch configuration of a named instance of
+// username, or of the current user if empty, in the registry of the
+// instances started at boot.
+func EnableInstance(name, username string) (*instance.Enabled, error) {
+	ii, err := instanceListOrError(username, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ii) != 1 {
+		return nil, fmt.Errorf("query returned more than one instance (%d)", len(ii))
+	}
+	i := ii[0]
+	if i.Launch == nil || len(i.Launch.Args) == 0 {
+		return nil, fmt.Errorf("instance %s has no recorded launch configuration, it must be started again to be enabled", i.Name)
+	}
+
+	// the instance file is writable by its owner, the user and the
+	// program to start at boot can't be taken from its content
+	owner, err := instanceFileOwner(i, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLaunchBinary(i.Launch.Args[0]); err != nil {
+		return nil, err
+	}
+
+	e, err := instance.NewEnabled(i.Name, owner.Name, i.Image, i.Launch)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Update(); err != nil {
+		return nil, fmt.Errorf("could not write %s: %w", e.Path, err)
+	}
+	return e, nil
+}
+
+// instanceFileOwner returns the owner of the instance file i, which must
+// be username if not empty.
+func instanceFileOwner(i *instance.File, username string) (*user.User, error) {
+	fi, err := os.Lstat(i.Path)
+	if err != nil {
+		return nil, err
+	}
+	uid := fi.Sys().(*syscall.Stat_t).Uid
+	if username != "" {
+		u, err := user.GetPwNam(username)
+		if err != nil {
+			return nil, fmt.Errorf("could not find user %s: %w", username, err)
+		}
+		if u.UID != uid {
+			return nil, fmt.Errorf("instance file %s is not owned by user %s", i.Path, username)
+		}
+		return u, nil
+	}
+	u, err := user.GetPwUID(uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not find owner of %s: %w", i.Path, err)
+	}
+	return u, nil
+}
+
+// checkLaunchBinary checks that the recorded program starting an instance
+// is the installed apptainer binary.
+func checkLaunchBinary(path string) error {
+	bin := filepath.Join(buildcfg.BINDIR, "apptainer")
+	realBin, err := filepath.EvalSymlinks(bin)
+	if err != nil {
+		return fmt.Errorf("could not resolve %s: %w", bin, err)
+	}
+	if realPath, err := filepath.EvalSymlinks(path); err != nil || realPath != realBin {
+		return fmt.Errorf("instance was launched with %s instead of %s", path, bin)
+	}
+	return nil
+}
+
+// DisableInstance removes the enabled instances matching name of username,
+// or of the current user if empty, from the registry of the instances
+// started at boot.
+func DisableInstance(name, username string) error {
+	if username == "" {
+		u, err := user.CurrentOriginal()
+		if err != nil {
+			return err
+		}
+		username = u.Name
+	}
+	ee, err := instance.ListEnabled(username, name)
+	if err != nil {
+		return fmt.Errorf("could not retrieve enabled instances: %w", err)
+	}
+	if len(ee) == 0 {
+		return fmt.Errorf("no enabled instance found")
+	}
+	for _, e := range ee {
+		if err := e.Delete(); err != nil {
+			return fmt.Errorf("could not disable instance %s: %w", e.Name, err)
+		}
+		sylog.Infof("Instance %s of user %s disabled", e.Name, e.User)
+	}
+	return nil
+}
+
+// PrintEnabledInstanceList prints the enabled instances matching name of
+// username, or of all users if empty.
+func PrintEnabledInstanceList(w io.Writer, name, username string) error {
+	if username == "" {
+		username = "*"
+	}
+	ee, err := instance.ListEnabled(username, name)
+	if err != nil {
+		return fmt.Errorf("could not retrieve enabled instances: %w", err)
+	}
+
+	tabWriter := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+	defer tabWriter.Flush()
+
+	if _, err := fmt.Fprintln(tabWriter, "USER\tINSTANCE NAME\tIMAGE"); err != nil {
+		return fmt.Errorf("could not write list header: %v", err)
+	}
+	for _, e := range ee {
+		if _, err := fmt.Fprintf(tabWriter, "%s\t%s\t%s\n", e.User, e.Name, e.Image); err != nil {
+			return fmt.Errorf("could not write instance info: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateEnabledImage checks that the image of an enabled instance still
+// exists and is allowed to run by the ECL.
+func validateEnabledImage(path string) error {
+	img, err := image.Init(path, false)
+	if err != nil {
+		return err
+	}
+	defer img.File.Close()
+
+	if img.Type != image.SIF {
+		return nil
+	}
+	// proceed if no ECL config file is found, like the runtime
+	ecl, err := syecl.LoadConfig(buildcfg.ECL_FILE)
+	if err != nil {
+		return nil
+	}
+	if err := ecl.ValidateConfig(); err != nil {
+		return fmt.Errorf("while validating ECL configuration: %s", err)
+	}
+	var kr openpgp.KeyRing = openpgp.EntityList{}
+	if ecl.Activated {
+		keyring := sypgp.NewHandle(buildcfg.APPTAINER_CONFDIR, sypgp.GlobalHandleOpt())
+		kr, err = keyring.LoadPubKeyring()
+		if err != nil {
+			return fmt.Errorf("while obtaining keyring for ECL: %s", err)
+		}
+	}
+	if ok, err := ecl.ShouldRunFp(context.TODO(), img.File, kr); err != nil {
+		return fmt.Errorf("while checking container image with ECL: %s", err)
+	} else if !ok {
+		return errors.New("image prohibited by ECL")
+	}
+	return nil
+}
+
+// checkEnabledInstance returns the owner of an enabled instance if it
+// must be started, or nil if it's already running.
+func checkEnabledInstance(e *instance.Enabled) (*user.User, error) {
+	if e.Launch == nil || len(e.Launch.Args) == 0 {
+		return nil, fmt.Errorf("no launch configuration")
+	}
+	if err := checkLaunchBinary(e.Launch.Args[0]); err != nil {
+		return nil, err
+	}
+	u, err := user.GetPwNam(e.User)
+	if err != nil {
+		return nil, fmt.Errorf("could not find user %s: %w", e.User, err)
+	}
+	ii, err := instance.List(e.User, e.Name, instance.AppSubDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve instance list: %w", err)
+	} else if len(ii) > 0 {
+		return nil, nil
+	}
+	if err := validateEnabledImage(e.Image); err != nil {
+		return nil, fmt.Errorf("invalid image %s: %w", e.Image, err)
+	}
+	return u, nil
+}
+
+// startEnabledInstance starts an enabled instance as its owner with its
+// recorded launch configuration.
+func startEnabledInstance(e *instance.Enabled, u *user.User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), enabledStartTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, e.Launch.Args[0], e.Launch.Args[1:]...)
+	cmd.Env = e.Launch.Env
+	cmd.Dir = e.Launch.Dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if u.UID != 0 {
+		cred, err := userCredential(u)
+		if err != nil {
+			return err
+		}
+		cmd.Env = delegatedEnv(u, e.Launch.Env)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+		AuditInstanceDelegation("start", e.Name, u.Name)
+	}
+
+	if err := cmd.Run(); ctx.Err() != nil {
+		return fmt.Errorf("timed out after %s", enabledStartTimeout)
+	} else if err != nil {
+		return err
+	}
+	applyLaunchCgroups(e.Name, e.User, e.Launch)
+	return nil
+}
+
+// StartEnabledInstances starts the enabled instances which are not
+// running as their owner. The failure of an instance doesn't prevent the
+// others from starting. With dryRun, the instances which would be started
+// are printed instead.
+func StartEnabledInstances(w io.Writer, dryRun bool) error {
+	ee, err := instance.ListEnabled("*", "*")
+	if err != nil {
+		return fmt.Errorf("could not retrieve enabled instances: %w", err)
+	}
+
+	tabWriter := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+	defer tabWriter.Flush()
+	if dryRun {
+		if _, err := fmt.Fprintln(tabWriter, "USER\tINSTANCE NAME\tIMAGE\tACTION"); err != nil {
+			return fmt.Errorf("could not write list header: %v", err)
+		}
+	}
+
+	failed := 0
+	for _, e := range ee {
+		u, err := checkEnabledInstance(e)
+		if dryRun {
+			action := "start"
+			if err != nil {
+				action = "error: " + err.Error()
+			} else if u == nil {
+				action = "none (running)"
+			}
+			if _, err := fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\n", e.User, e.Name, e.Image, action); err != nil {
+				return fmt.Errorf("could not write instance info: %v", err)
+			}
+			continue
+		}
+
+		if err == nil && u == nil {
+			sylog.Infof("Instance %s of user %s is already running", e.Name, e.User)
+			continue
+		} else if err == nil {
+			sylog.Infof("Starting instance %s of user %s", e.Name, e.User)
+			err = startEnabledInstance(e, u)
+		}
+		if err != nil {
+			sylog.Errorf("Failed to start instance %s of user %s: %s", e.Name, e.User, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d enabled instances failed to start", failed, len(ee))
+	}
+	return nil
+}
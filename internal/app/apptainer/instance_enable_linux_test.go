@@ -0,0 +1,73 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+)
+
+func TestInstanceFileOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("root required to change the instance file owner")
+	}
+	nobody, err := user.GetPwNam("nobody")
+	if err != nil {
+		t.Skipf("no nobody user: %s", err)
+	}
+
+	// the instance file of nobody claims to belong to root
+	i := &instance.File{
+		Path: filepath.Join(t.TempDir(), "test.json"),
+		Name: "test",
+		User: "root",
+	}
+	if err := i.Update(); err != nil {
+		t.Fatalf("while writing instance file: %s", err)
+	}
+	if err := os.Chown(i.Path, int(nobody.UID), int(nobody.GID)); err != nil {
+		t.Fatalf("while changing instance file owner: %s", err)
+	}
+
+	u, err := instanceFileOwner(i, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if u.Name != nobody.Name {
+		t.Errorf("got owner %s, want %s", u.Name, nobody.Name)
+	}
+	if _, err := instanceFileOwner(i, nobody.Name); err != nil {
+		t.Errorf("unexpected error with the owner as user: %s", err)
+	}
+	if _, err := instanceFileOwner(i, "root"); err == nil {
+		t.Errorf("unexpected success with the forged user")
+	}
+}
+
+func TestCheckLaunchBinary(t *testing.T) {
+	if err := checkLaunchBinary("/bin/sh"); err == nil {
+		t.Errorf("unexpected success with /bin/sh")
+	}
+	if err := checkLaunchBinary(filepath.Join(t.TempDir(), "apptainer")); err == nil {
+		t.Errorf("unexpected success with a non-existent binary")
+	}
+
+	bin := filepath.Join(buildcfg.BINDIR, "apptainer")
+	if _, err := os.Stat(bin); err != nil {
+		t.Skipf("apptainer is not installed in %s", buildcfg.BINDIR)
+	}
+	if err := checkLaunchBinary(bin); err != nil {
+		t.Errorf("unexpected error with %s: %s", bin, err)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+)
+
+// InstanceFilter selects instances by name, image and age. Values given
+// for the same key are OR'ed, different keys are AND'ed.
+type InstanceFilter struct {
+	// Names are globs matched against the instance names
+	Names []string
+	// Images are globs matched against the instance image paths, or
+	// their file names for globs without a slash
+	Images []string
+	// OlderThan selects instances started more than this duration ago
+	OlderThan time.Duration
+	// NewerThan selects instances started less than this duration ago
+	NewerThan time.Duration
+	// User is the owner of the instances, only usable by root
+	User string
+}
+
+// ParseInstanceFilters parses the key=value filters of the instance list
+// and stop commands, it returns nil when there is no filter.
+func ParseInstanceFilters(filters []string) (*InstanceFilter, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	f := &InstanceFilter{}
+	for _, filter := range filters {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid filter %q: must be of the form key=value", filter)
+		}
+		switch key {
+		case "name", "image":
+			if _, err := filepath.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("invalid %s glob %q: %v", key, value, err)
+			}
+			if key == "name" {
+				f.Names = append(f.Names, value)
+			} else {
+				f.Images = append(f.Images, value)
+			}
+		case "older-than", "newer-than":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid %s duration %q", key, value)
+			}
+			if key == "older-than" {
+				f.OlderThan = d
+			} else {
+				f.NewerThan = d
+			}
+		case "user":
+			if f.User != "" && f.User != value {
+				return nil, fmt.Errorf("only one user filter can be given")
+			}
+			f.User = value
+		default:
+			return nil, fmt.Errorf("unknown filter %q: must be one of name, image, older-than, newer-than or user", key)
+		}
+	}
+	return f, nil
+}
+
+// matchGlobs returns if s matches one of the globs, or true if there is
+// no glob.
+func matchGlobs(globs []string, s string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, g := range globs {
+		if ok, _ := filepath.Match(g, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchImage returns if the image path matches one of the globs, globs
+// without a slash being matched against the image file name.
+func matchImage(globs []string, image string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, g := range globs {
+		s := image
+		if !strings.Contains(g, "/") {
+			s = filepath.Base(image)
+		}
+		if ok, _ := filepath.Match(g, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns if an instance started at the given time matches the
+// filter, a nil filter matches all instances. The user is not checked
+// here as it selects the directory instances are listed from.
+func (f *InstanceFilter) match(i *instance.File, started time.Time, now time.Time) bool {
+	if f == nil {
+		return true
+	}
+	if !matchGlobs(f.Names, i.Name) || !matchImage(f.Images, i.Image) {
+		return false
+	}
+	if f.OlderThan > 0 || f.NewerThan > 0 {
+		// without a start time the age of the instance is unknown
+		if started.IsZero() {
+			return false
+		}
+		age := now.Sub(started)
+		if f.OlderThan > 0 && age < f.OlderThan {
+			return false
+		}
+		if f.NewerThan > 0 && age > f.NewerThan {
+			return false
+		}
+	}
+	return true
+}
+
+// instanceStartTime returns the start time of the instance process pid,
+// or the zero time if it can't be determined.
+func instanceStartTime(pid int) time.Time {
+	boot := bootTime()
+	if boot.IsZero() {
+		return time.Time{}
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return time.Time{}
+	}
+	ps, err := parseProcStat(string(data))
+	if err != nil {
+		return time.Time{}
+	}
+	return boot.Add(time.Duration(ps.start) * time.Second / clockTicks)
+}
+
+// filterInstances returns the instances matching the filter along with
+// their start time.
+func filterInstances(ii []*instance.File, f *InstanceFilter) ([]*instance.File, []time.Time) {
+	now := time.Now()
+	matched := make([]*instance.File, 0, len(ii))
+	started := make([]time.Time, 0, len(ii))
+	for _, i := range ii {
+		s := instanceStartTime(i.Pid)
+		if f.match(i, s, now) {
+			matched = append(matched, i)
+			started = append(started, s)
+		}
+	}
+	return matched, started
+}
+
+// InstanceFields are the fields available to the Go templates given to
+// instance list --format. They are documented in the command help and
+// must be kept stable.
+type InstanceFields struct {
+	Name       string
+	Pid        int
+	User       string
+	Image      string
+	IP         string
+	IPv6       string
+	Ports      []string
+	Script     string
+	Health     string
+	Restarts   int
+	Started    time.Time
+	LogOutPath string
+	LogErrPath string
+}
+
+// newInstanceFields returns the template fields of an instance.
+func newInstanceFields(i *instance.File, started time.Time) InstanceFields {
+	health := ""
+	if i.Health != nil {
+		health = i.Health.Status
+	}
+	return InstanceFields{
+		Name:       i.Name,
+		Pid:        i.Pid,
+		User:       i.User,
+		Image:      i.Image,
+		IP:         i.IP,
+		IPv6:       i.IPv6,
+		Ports:      i.Ports,
+		Script:     i.Script,
+		Health:     health,
+		Restarts:   i.Restarts,
+		Started:    started,
+		LogOutPath: i.LogOutPath,
+		LogErrPath: i.LogErrPath,
+	}
+}
+
+// instanceTemplateFuncs are the functions available to the instance
+// list templates.
+var instanceTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// parseInstanceTemplate parses an instance list template, the \t and \n
+// escape sequences are expanded so they can be passed unquoted from a
+// shell.
+func parseInstanceTemplate(format string) (*template.Template, error) {
+	format = strings.NewReplacer(`\t`, "\t", `\n`, "\n").Replace(format)
+	tmpl, err := template.New("format").Funcs(instanceTemplateFuncs).Option("missingkey=error").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// writeInstanceTemplate renders the template once per instance, each
+// rendering ending with a newline, and aligns tab separated columns.
+func writeInstanceTemplate(w io.Writer, tmpl *template.Template, fields []InstanceFields) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+	for _, f := range fields {
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, f); err != nil {
+			return fmt.Errorf("could not format instance %s: %v", f.Name, err)
+		}
+		s := sb.String()
+		if !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		}
+		if _, err := io.WriteString(tw, s); err != nil {
+			return fmt.Errorf("could not write instance info: %v", err)
+		}
+	}
+	return tw.Flush()
+}
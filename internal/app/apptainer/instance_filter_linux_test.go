@@ -0,0 +1,265 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+)
+
+var fixtureStarted = map[string]time.Time{
+	"web1": time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+	"web2": time.Date(2024, 3, 2, 14, 5, 0, 0, time.UTC),
+	"db":   time.Date(2024, 2, 20, 8, 0, 0, 0, time.UTC),
+}
+
+// loadFixtureInstances reads the instance files of testdata/instances
+// sorted by name.
+func loadFixtureInstances(t *testing.T) []*instance.File {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("testdata", "instances", "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixture instance files: %v", err)
+	}
+	ii := make([]*instance.File, 0, len(files))
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("while reading %s: %s", file, err)
+		}
+		f := &instance.File{}
+		if err := json.Unmarshal(b, f); err != nil {
+			t.Fatalf("while decoding %s: %s", file, err)
+		}
+		f.Path = file
+		ii = append(ii, f)
+	}
+	return ii
+}
+
+func TestParseInstanceFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []string
+		want    *InstanceFilter
+		wantErr bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:    "all keys",
+			filters: []string{"name=web*", "name=db", "image=*.sif", "older-than=1h", "newer-than=48h", "user=alice"},
+			want: &InstanceFilter{
+				Names:     []string{"web*", "db"},
+				Images:    []string{"*.sif"},
+				OlderThan: time.Hour,
+				NewerThan: 48 * time.Hour,
+				User:      "alice",
+			},
+		},
+		{
+			name:    "no value",
+			filters: []string{"name="},
+			wantErr: true,
+		},
+		{
+			name:    "no separator",
+			filters: []string{"web1"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			filters: []string{"pid=12"},
+			wantErr: true,
+		},
+		{
+			name:    "bad glob",
+			filters: []string{"name=web["},
+			wantErr: true,
+		},
+		{
+			name:    "bad duration",
+			filters: []string{"older-than=1d"},
+			wantErr: true,
+		},
+		{
+			name:    "two users",
+			filters: []string{"user=alice", "user=bob"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseInstanceFilters(tt.filters)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseInstanceFilters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseInstanceFilters() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstanceFilterMatch(t *testing.T) {
+	ii := loadFixtureInstances(t)
+	now := time.Date(2024, 3, 2, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		filters []string
+		want    []string
+	}{
+		{
+			name: "no filter",
+			want: []string{"db", "web1", "web2"},
+		},
+		{
+			name:    "name",
+			filters: []string{"name=web*"},
+			want:    []string{"web1", "web2"},
+		},
+		{
+			name:    "names are OR'ed",
+			filters: []string{"name=web1", "name=db"},
+			want:    []string{"db", "web1"},
+		},
+		{
+			name:    "image path",
+			filters: []string{"image=/srv/images/*"},
+			want:    []string{"db"},
+		},
+		{
+			name:    "image file name",
+			filters: []string{"image=post*.sif"},
+			want:    []string{"db"},
+		},
+		{
+			name:    "keys are AND'ed",
+			filters: []string{"image=nginx.sif", "older-than=2h"},
+			want:    []string{"web1"},
+		},
+		{
+			name:    "newer than",
+			filters: []string{"newer-than=72h"},
+			want:    []string{"web1", "web2"},
+		},
+		{
+			name:    "age range",
+			filters: []string{"older-than=24h", "newer-than=168h"},
+			want:    []string{"web1"},
+		},
+		{
+			name:    "no match",
+			filters: []string{"name=web*", "image=/srv/images/*.sif"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseInstanceFilters(tt.filters)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var got []string
+			for _, i := range ii {
+				if f.match(i, fixtureStarted[i.Name], now) {
+					got = append(got, i.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// the age of an instance without start time is unknown
+	f := &InstanceFilter{OlderThan: time.Second}
+	if f.match(ii[0], time.Time{}, now) {
+		t.Errorf("instance without start time matched an age filter")
+	}
+}
+
+func TestInstanceTemplates(t *testing.T) {
+	ii := loadFixtureInstances(t)
+	fields := make([]InstanceFields, len(ii))
+	for n, i := range ii {
+		fields[n] = newInstanceFields(i, fixtureStarted[i.Name])
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "columns",
+			format: `{{.Name}}\t{{.Pid}}\t{{.IP}}`,
+			want: "db      1401    \n" +
+				"web1    1201    10.22.0.2\n" +
+				"web2    1301    10.22.0.3\n",
+		},
+		{
+			name:   "names",
+			format: "{{.Name}}",
+			want:   "db\nweb1\nweb2\n",
+		},
+		{
+			name:   "functions",
+			format: `{{.Name}}:{{join .Ports ","}}:{{json .Script}}`,
+			want:   "db::\"\"\nweb1:8080:80/tcp,8443:443/tcp:\"start\"\nweb2::\"run\"\n",
+		},
+		{
+			name:   "start time and health",
+			format: `{{.Name}} {{.Started.Format "2006-01-02 15:04"}} {{.Health}} {{.Restarts}}`,
+			want:   "db 2024-02-20 08:00  0\nweb1 2024-03-01 09:30 healthy 0\nweb2 2024-03-02 14:05  2\n",
+		},
+		{
+			name:   "conditional",
+			format: `{{if .IPv6}}{{.Name}} {{.IPv6}}\n{{end}}`,
+			want:   "\nweb1 fd00::2\n\n",
+		},
+		{
+			name:    "unknown field",
+			format:  "{{.Command}}",
+			wantErr: true,
+		},
+		{
+			name:    "syntax error",
+			format:  "{{.Name",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseInstanceTemplate(tt.format)
+			var b bytes.Buffer
+			if err == nil {
+				err = writeInstanceTemplate(&b, tmpl, fields)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && b.String() != tt.want {
+				t.Errorf("rendered %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}
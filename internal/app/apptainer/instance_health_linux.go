@@ -0,0 +1,131 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// unhealthyStopTimeout is the grace period given to an unhealthy
+// instance to stop before it's killed.
+const unhealthyStopTimeout = 10 * time.Second
+
+// runHealthCheck executes the health check command in the named instance
+// and returns if it succeeded along with its output. The command and its
+// children are killed when the timeout expires or the context is canceled.
+func runHealthCheck(ctx context.Context, name string, hc *instance.HealthCheck) (bool, string) {
+	self, err := os.Executable()
+	if err != nil {
+		return false, err.Error()
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command(self, "--quiet", "exec", "instance://"+name, "/bin/sh", "-c", hc.Cmd)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// a process group to kill the command along with its children, it
+	// also can't outlive the instance as it joins its PID namespace
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+
+	if err := cmd.Start(); err != nil {
+		return false, err.Error()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(hc.Timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err == nil, out.String()
+	case <-timer.C:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return false, fmt.Sprintf("health check timed out after %s", hc.Timeout)
+	case <-ctx.Done():
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return false, ""
+	}
+}
+
+// stopUnhealthyInstance stops the named instance, killing it if it's
+// still running after unhealthyStopTimeout.
+func stopUnhealthyInstance(name string) {
+	i, err := instance.Get(name, instance.AppSubDir)
+	if err != nil {
+		sylog.Warningf("Could not get unhealthy instance %s: %s", name, err)
+		return
+	}
+
+	manager := instanceCgroupManager(i)
+	stopped := make(chan int, 1)
+	go killInstance(i, manager, syscall.SIGTERM, stopped)
+
+	select {
+	case <-stopped:
+	case <-time.After(unhealthyStopTimeout):
+		sylog.Infof("Killing %s instance of %s (PID=%d) (Timeout)", i.Name, i.Image, i.Pid)
+		killInstanceProcesses(i, manager)
+	}
+}
+
+// superviseHealth periodically runs the health check of the named
+// instance and records its health status in the instance file, until
+// the context is canceled. When the instance becomes unhealthy with an
+// unhealthy action other than none, the instance is stopped and the
+// action is returned.
+func superviseHealth(ctx context.Context, name string, hc *instance.HealthCheck) string {
+	started := time.Now()
+	health := instance.NewHealth()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-time.After(hc.Interval):
+		}
+
+		ok, output := runHealthCheck(ctx, name, hc)
+		if ctx.Err() != nil {
+			return ""
+		}
+		unhealthy := health.Record(hc, ok, output, time.Now(), time.Since(started))
+
+		if i, err := instance.Get(name, instance.AppSubDir); err == nil {
+			i.Health = health
+			if err := i.Update(); err != nil {
+				sylog.Warningf("Could not update instance file: %s", err)
+			}
+		}
+
+		if !unhealthy {
+			continue
+		}
+		sylog.Warningf("Instance %s is unhealthy after %d failed health checks", name, health.FailingStreak)
+		if hc.OnUnhealthy == instance.UnhealthyNone {
+			continue
+		}
+		sylog.Infof("Stopping unhealthy instance %s (on-unhealthy %s)", name, hc.OnUnhealthy)
+		stopUnhealthyInstance(name)
+		return hc.OnUnhealthy
+	}
+}
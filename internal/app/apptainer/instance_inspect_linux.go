@@ -0,0 +1,190 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+)
+
+// unknownValue is displayed for the launch configuration fields of an
+// instance started by an older version.
+const unknownValue = "unknown"
+
+// instanceInspect is the JSON record of the launch configuration of an
+// instance, details is null for an instance started by an older version.
+type instanceInspect struct {
+	Instance string            `json:"instance"`
+	User     string            `json:"user"`
+	Pid      int               `json:"pid"`
+	Image    string            `json:"image"`
+	IP       string            `json:"ip"`
+	UserNs   bool              `json:"userns"`
+	Cgroup   bool              `json:"cgroup"`
+	Restart  string            `json:"restart,omitempty"`
+	Details  *instance.Details `json:"details"`
+}
+
+// InspectInstance prints the launch configuration of a named instance
+// of username, or of the current user if empty, in a regular or a JSON
+// format (if formatJSON is true) to the passed writer.
+func InspectInstance(w io.Writer, name, username string, formatJSON bool) error {
+	ii, err := instanceListOrError(username, name)
+	if err != nil {
+		return err
+	}
+	if len(ii) != 1 {
+		return fmt.Errorf("query returned more than one instance (%d)", len(ii))
+	}
+	i := ii[0]
+
+	if formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		err := enc.Encode(instanceInspect{
+			Instance: i.Name,
+			User:     i.User,
+			Pid:      i.Pid,
+			Image:    i.Image,
+			IP:       i.IP,
+			UserNs:   i.UserNs,
+			Cgroup:   i.Cgroup,
+			Restart:  i.Restart,
+			Details:  i.Details,
+		})
+		if err != nil {
+			return fmt.Errorf("could not encode instance configuration: %v", err)
+		}
+		return nil
+	}
+
+	tabWriter := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tabWriter.Flush()
+
+	fields := [][2]string{
+		{"Instance", i.Name},
+		{"User", i.User},
+		{"PID", strconv.Itoa(i.Pid)},
+		{"Image", i.Image},
+		{"IP", orNone(i.IP)},
+		{"User namespace", strconv.FormatBool(i.UserNs)},
+	}
+	d := i.Details
+	if d == nil {
+		// instance started by an older version
+		for _, name := range []string{"Version", "Namespaces", "Cgroup path", "Network", "Hostname", "GPU", "Fakeroot", "Contain", "Writable", "Binds", "Overlays", "Environment", "Resolv.conf", "Mounts"} {
+			fields = append(fields, [2]string{name, unknownValue})
+		}
+	} else {
+		fields = append(fields,
+			[2]string{"Version", d.Version},
+			[2]string{"Namespaces", strings.Join(d.Namespaces, ", ")},
+			[2]string{"Cgroup path", orNone(d.CgroupPath)},
+			[2]string{"Network", orNone(strings.TrimSpace(d.Network + " " + strings.Join(d.NetworkArgs, " ")))},
+			[2]string{"Hostname", orNone(d.Hostname)},
+			[2]string{"GPU", gpuSupport(d)},
+			[2]string{"Fakeroot", strconv.FormatBool(d.Fakeroot)},
+			[2]string{"Contain", strconv.FormatBool(d.Contain)},
+			[2]string{"Writable", strconv.FormatBool(d.Writable)},
+		)
+	}
+	for _, f := range fields {
+		if _, err := fmt.Fprintf(tabWriter, "%s:\t%s\n", f[0], f[1]); err != nil {
+			return fmt.Errorf("could not write instance configuration: %v", err)
+		}
+	}
+	if d == nil {
+		return nil
+	}
+
+	lists := []struct {
+		name   string
+		values []string
+	}{
+		{"Binds", d.Binds},
+		{"Overlays", d.Overlays},
+		{"Environment", d.Env},
+		{"Resolv.conf", d.ResolvConf},
+	}
+	for _, l := range lists {
+		if err := writeInspectList(tabWriter, l.name, l.values); err != nil {
+			return err
+		}
+	}
+
+	if d.Mounts == nil {
+		_, err := fmt.Fprintf(tabWriter, "Mounts:\t%s\n", unknownValue)
+		return err
+	}
+	if _, err := fmt.Fprintln(tabWriter, "Mounts:"); err != nil {
+		return fmt.Errorf("could not write instance configuration: %v", err)
+	}
+	// the mount table has its own columns
+	if err := tabWriter.Flush(); err != nil {
+		return err
+	}
+	mountWriter := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+	defer mountWriter.Flush()
+
+	if _, err := fmt.Fprintln(mountWriter, "DESTINATION\tSOURCE\tTYPE\tOPTIONS"); err != nil {
+		return fmt.Errorf("could not write instance configuration: %v", err)
+	}
+	for _, m := range d.Mounts {
+		if _, err := fmt.Fprintf(mountWriter, "%s\t%s\t%s\t%s\n", m.Destination, m.Source, m.Type, m.Options); err != nil {
+			return fmt.Errorf("could not write instance configuration: %v", err)
+		}
+	}
+	return nil
+}
+
+// writeInspectList writes a named list of values, one per line.
+func writeInspectList(w io.Writer, name string, values []string) error {
+	if len(values) == 0 {
+		_, err := fmt.Fprintf(w, "%s:\t%s\n", name, orNone(""))
+		return err
+	}
+	for n, v := range values {
+		label := ""
+		if n == 0 {
+			label = name + ":"
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", label, v); err != nil {
+			return fmt.Errorf("could not write instance configuration: %v", err)
+		}
+	}
+	return nil
+}
+
+// gpuSupport returns the GPU support enabled for an instance.
+func gpuSupport(d *instance.Details) string {
+	var gpus []string
+	if d.NvCCLI {
+		gpus = append(gpus, "nv (nvidia-container-cli)")
+	} else if d.Nv {
+		gpus = append(gpus, "nv")
+	}
+	if d.Rocm {
+		gpus = append(gpus, "rocm")
+	}
+	return orNone(strings.Join(gpus, ", "))
+}
+
+// orNone returns s, or "-" when empty.
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -15,17 +15,22 @@ package apptainer
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/cgroups"
 	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/network"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/fs/proc"
 	"github.com/buger/goterm"
@@ -33,6 +38,29 @@ import (
 	libcgroups "github.com/opencontainers/runc/libcontainer/cgroups"
 )
 
+// instanceStats is the JSON record of the resource usage of an instance,
+// extended with the memory events and pressure stall information
+// available with cgroups v2.
+type instanceStats struct {
+	Instance string    `json:"instance"`
+	Pid      int       `json:"pid"`
+	Image    string    `json:"image"`
+	Time     time.Time `json:"time"`
+	*cgroups.Metrics
+	MemoryEvents   *cgroups.MemoryEvents `json:"memory_events,omitempty"`
+	MemoryPressure *cgroups.PSIStats     `json:"memory_pressure,omitempty"`
+	// Bandwidth are the bandwidth limits of the instance on its networks
+	Bandwidth []instance.Bandwidth `json:"bandwidth,omitempty"`
+}
+
+// instanceEvent is a timestamped record of the memory events and
+// pressure stall information of an instance.
+type instanceEvent struct {
+	Time           time.Time             `json:"time"`
+	MemoryEvents   *cgroups.MemoryEvents `json:"memory_events"`
+	MemoryPressure *cgroups.PSIStats     `json:"memory_pressure,omitempty"`
+}
+
 type instanceInfo struct {
 	Instance   string `json:"instance"`
 	Pid        int    `json:"pid"`
@@ -40,16 +68,60 @@ type instanceInfo struct {
 	IP         string `json:"ip"`
 	LogErrPath string `json:"logErrPath"`
 	LogOutPath string `json:"logOutPath"`
+	Script     string `json:"script,omitempty"`
+	Sockets    string `json:"sockets,omitempty"`
+	Restart    string `json:"restart,omitempty"`
+	Restarts   int    `json:"restarts"`
+	LastExit   *int   `json:"lastExitStatus,omitempty"`
+	// IPv6 is the IPv6 address of the instance on a dual-stack network
+	IPv6 string `json:"ipv6,omitempty"`
+	// Ports are the container ports published on the host
+	Ports []string `json:"ports,omitempty"`
+	// Health is the current health status of an instance with a health check
+	Health *instance.Health `json:"health,omitempty"`
+	// Allocation is the network address kept for the instance
+	Allocation *instance.Allocation `json:"allocation,omitempty"`
+}
+
+// InstanceListOptions are the options of PrintInstanceList.
+type InstanceListOptions struct {
+	// JSON prints the instances in JSON format
+	JSON bool
+	// Logs prints the log paths of the instances
+	Logs bool
+	// Quiet prints the instance names only
+	Quiet bool
+	// Format is a Go template rendered for each instance with the
+	// InstanceFields of the instance
+	Format string
+	// Filter selects the listed instances
+	Filter *InstanceFilter
 }
 
-// PrintInstanceList fetches instance list, applying name and
-// user filters, and prints it in a regular or a JSON format (if
-// formatJSON is true) to the passed writer. Additionally, fetches
-// log paths (if showLogs is true).
-func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs bool) error {
-	if formatJSON && showLogs {
+// PrintInstanceList fetches instance list, applying name, user and
+// opts filters, and prints it in a regular, JSON, quiet or templated
+// format to the passed writer. Additionally, fetches log paths (if
+// opts.Logs is true).
+func PrintInstanceList(w io.Writer, name, user string, opts InstanceListOptions) error {
+	modes := 0
+	for _, set := range []bool{opts.JSON, opts.Logs, opts.Quiet, opts.Format != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
 		sylog.Fatalf("more than one flags have been set")
 	}
+	formatJSON := opts.JSON
+	showLogs := opts.Logs
+
+	var tmpl *template.Template
+	if opts.Format != "" {
+		var err error
+		if tmpl, err = parseInstanceTemplate(opts.Format); err != nil {
+			return err
+		}
+	}
 
 	tabWriter := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
 	defer tabWriter.Flush()
@@ -58,6 +130,24 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 	if err != nil {
 		return fmt.Errorf("could not retrieve instance list: %v", err)
 	}
+	ii, started := filterInstances(ii, opts.Filter)
+
+	if opts.Quiet {
+		for _, i := range ii {
+			if _, err := fmt.Fprintln(w, i.Name); err != nil {
+				return fmt.Errorf("could not write instance name: %v", err)
+			}
+		}
+		return nil
+	}
+
+	if tmpl != nil {
+		fields := make([]InstanceFields, len(ii))
+		for n, i := range ii {
+			fields[n] = newInstanceFields(i, started[n])
+		}
+		return writeInstanceTemplate(w, tmpl, fields)
+	}
 
 	if showLogs {
 		_, err := fmt.Fprintln(tabWriter, "INSTANCE NAME\tPID\tLOGS")
@@ -75,13 +165,26 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 	}
 
 	if !formatJSON {
-		_, err := fmt.Fprintln(tabWriter, "INSTANCE NAME\tPID\tIP\tIMAGE")
+		_, err := fmt.Fprintln(tabWriter, "INSTANCE NAME\tPID\tIP\tIMAGE\tSCRIPT\tHEALTH")
 		if err != nil {
 			return fmt.Errorf("could not write list header: %v", err)
 		}
 
 		for _, i := range ii {
-			_, err = fmt.Fprintf(tabWriter, "%s\t%d\t%s\t%s\n", i.Name, i.Pid, i.IP, i.Image)
+			script := i.Script
+			if script == "" {
+				// instance started by an older version
+				script = "-"
+			}
+			health := "-"
+			if i.Health != nil {
+				health = i.Health.Status
+			}
+			ip := i.IP
+			if i.IPv6 != "" && i.IPv6 != i.IP {
+				ip += "," + i.IPv6
+			}
+			_, err = fmt.Fprintf(tabWriter, "%s\t%d\t%s\t%s\t%s\t%s\n", i.Name, i.Pid, ip, i.Image, script, health)
 			if err != nil {
 				return fmt.Errorf("could not write instance info: %v", err)
 			}
@@ -89,14 +192,28 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 		return nil
 	}
 
+	allocs, err := instance.GetAllocations(user)
+	if err != nil {
+		sylog.Warningf("Could not retrieve the network addresses of instances: %s", err)
+	}
+
 	instances := make([]instanceInfo, len(ii))
 	for i := range instances {
 		instances[i].Image = ii[i].Image
 		instances[i].Pid = ii[i].Pid
 		instances[i].Instance = ii[i].Name
 		instances[i].IP = ii[i].IP
+		instances[i].IPv6 = ii[i].IPv6
+		instances[i].Ports = ii[i].Ports
 		instances[i].LogErrPath = ii[i].LogErrPath
 		instances[i].LogOutPath = ii[i].LogOutPath
+		instances[i].Script = ii[i].Script
+		instances[i].Sockets = ii[i].SocketsDir
+		instances[i].Restart = ii[i].Restart
+		instances[i].Restarts = ii[i].Restarts
+		instances[i].LastExit = ii[i].LastExitStatus
+		instances[i].Health = ii[i].Health
+		instances[i].Allocation = allocs[ii[i].Name]
 	}
 
 	enc := json.NewEncoder(w)
@@ -111,8 +228,8 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 	return nil
 }
 
-// WriteInstancePidFile fetches instance's PID and writes it to the pidFile,
-// truncating it if it already exists. Note that the name should not be a glob,
+// WriteInstancePidFile fetches instance's PID and atomically writes it to the pidFile,
+// replacing it if it already exists. Note that the name should not be a glob,
 // i.e. name should identify a single instance only, otherwise an error is returned.
 func WriteInstancePidFile(name, pidFile string) error {
 	inst, err := instance.List("", name, instance.AppSubDir)
@@ -123,14 +240,26 @@ func WriteInstancePidFile(name, pidFile string) error {
 		return fmt.Errorf("unexpected instance count: %d", len(inst))
 	}
 
-	f, err := os.OpenFile(pidFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NOFOLLOW, 0o644)
+	// write a temporary file renamed once complete, so the pid file is
+	// never seen partially written and no symlink is followed
+	f, err := os.CreateTemp(filepath.Dir(pidFile), "."+filepath.Base(pidFile)+".")
 	if err != nil {
 		return fmt.Errorf("could not create pid file: %v", err)
 	}
-	defer f.Close()
+	defer os.Remove(f.Name())
 
-	_, err = fmt.Fprintf(f, "%d\n", inst[0].Pid)
-	if err != nil {
+	if _, err := fmt.Fprintf(f, "%d\n", inst[0].Pid); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write pid file: %v", err)
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write pid file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write pid file: %v", err)
+	}
+	if err := os.Rename(f.Name(), pidFile); err != nil {
 		return fmt.Errorf("could not write pid file: %v", err)
 	}
 	return nil
@@ -144,7 +273,7 @@ func instanceListOrError(instanceUser, name string) ([]*instance.File, error) {
 		return ii, fmt.Errorf("could not retrieve instance list: %w", err)
 	}
 	if len(ii) == 0 {
-		return ii, fmt.Errorf("no instance found")
+		return ii, ErrNoInstance
 	}
 	return ii, err
 }
@@ -211,17 +340,14 @@ func InstanceStats(ctx context.Context, name, instanceUser string, formatJSON bo
 		sylog.Infof("Stats for %s instance of %s (PID=%d)\n", i.Name, i.Image, i.Pid)
 	}
 
-	// If asking for json and not nostream, not possible
-	if formatJSON && !noStream {
-		sylog.Warningf("JSON output is only available for a single timepoint (--no-stream)")
-		noStream = true
-	}
-
 	// Cut out early if we do not have cgroups
-	if !i.Cgroup {
+	if !i.Cgroup && !i.JobCgroup {
 		url := "the Apptainer instance user guide for instructions"
 		return fmt.Errorf("stats are only available if cgroups are enabled, see %s", url)
 	}
+	if !i.Cgroup && !formatJSON {
+		sylog.Infof("Reporting the stats of the job cgroup the instance runs in")
+	}
 
 	// Get a cgroupfs managed cgroup from the pid
 	manager, err := cgroups.GetManagerForPid(i.Pid)
@@ -229,6 +355,12 @@ func InstanceStats(ctx context.Context, name, instanceUser string, formatJSON bo
 		return fmt.Errorf("while getting cgroup manager for pid: %v", err)
 	}
 
+	// bandwidth limits set on the networks of the instance
+	var bandwidth []instance.Bandwidth
+	if i.Details != nil {
+		bandwidth = i.Details.Bandwidth
+	}
+
 	// Otherwise print shortened table
 	tabWriter := tabwriter.NewWriter(os.Stdout, 0, 8, 4, ' ', 0)
 	defer tabWriter.Flush()
@@ -250,7 +382,7 @@ func InstanceStats(ctx context.Context, name, instanceUser string, formatJSON bo
 		case <-time.After(1 * time.Second):
 
 			// Stream clears the terminal and reprint header and stats each time
-			if !noStream {
+			if !noStream && !formatJSON {
 				goterm.Clear()
 				goterm.MoveCursor(1, 1)
 				goterm.Flush()
@@ -262,17 +394,39 @@ func InstanceStats(ctx context.Context, name, instanceUser string, formatJSON bo
 				return fmt.Errorf("while getting stats for pid: %v", err)
 			}
 
-			// Do we want json?
+			// Memory events and pressure are only available with cgroups v2
+			events, _ := manager.GetMemoryEvents()
+			pressure, _ := manager.GetMemoryPressure()
+
+			// Do we want json? A stream prints one record per line
 			if formatJSON {
+				metrics, err := manager.GetMetrics(i.Pid)
+				if err != nil {
+					return fmt.Errorf("while getting metrics for pid: %v", err)
+				}
 				enc := json.NewEncoder(os.Stdout)
-				enc.SetIndent("", "\t")
-				err = enc.Encode(stats)
-				return err
+				if noStream {
+					enc.SetIndent("", "\t")
+				}
+				err = enc.Encode(instanceStats{
+					Instance:       i.Name,
+					Pid:            i.Pid,
+					Image:          i.Image,
+					Time:           time.Now(),
+					Metrics:        metrics,
+					MemoryEvents:   events,
+					MemoryPressure: pressure,
+					Bandwidth:      bandwidth,
+				})
+				if err != nil || noStream {
+					return err
+				}
+				continue
 			}
 
 			// Stats can be added from this set
 			// https://github.com/opencontainers/runc/blob/main/libcontainer/cgroups/stats.go
-			_, err = fmt.Fprintln(tabWriter, "INSTANCE NAME\tCPU USAGE\tMEM USAGE / LIMIT\tMEM %\tBLOCK I/O\tPIDS")
+			_, err = fmt.Fprintln(tabWriter, "INSTANCE NAME\tCPU USAGE\tMEM USAGE / LIMIT\tMEM %\tBLOCK I/O\tPIDS\tOOM KILLS\tMEM PSI SOME / FULL\tNET LIMIT IN / OUT")
 			if err != nil {
 				return fmt.Errorf("could not write stats header: %v", err)
 			}
@@ -282,10 +436,18 @@ func InstanceStats(ctx context.Context, name, instanceUser string, formatJSON bo
 			blockRead, blockWrite := calculateBlockIO(&stats.BlkioStats)
 
 			// Generate a shortened stats list
-			_, err = fmt.Fprintf(tabWriter, "%s\t%.2f%%\t%s / %s\t%.2f%s\t%s / %s\t%d\n", i.Name,
+			oomKills, memPressure := "-", "-"
+			if events != nil {
+				oomKills = fmt.Sprintf("%d", events.OOMKill)
+			}
+			if pressure != nil {
+				memPressure = fmt.Sprintf("%.2f%% / %.2f%%", pressure.Some.Avg10, pressure.Full.Avg10)
+			}
+
+			_, err = fmt.Fprintf(tabWriter, "%s\t%.2f%%\t%s / %s\t%.2f%s\t%s / %s\t%d\t%s\t%s\t%s\n", i.Name,
 				cpuPercent, units.BytesSize(memUsage), units.BytesSize(memLimit),
 				memPercent, "%", units.BytesSize(blockRead), units.BytesSize(blockWrite),
-				stats.PidsStats.Current)
+				stats.PidsStats.Current, oomKills, memPressure, bandwidthLimits(bandwidth))
 			tabWriter.Flush()
 			if err != nil {
 				return fmt.Errorf("could not write instance stats: %v", err)
@@ -299,52 +461,309 @@ func InstanceStats(ctx context.Context, name, instanceUser string, formatJSON bo
 	}
 }
 
-// StopInstance fetches instance list, applying name and
-// user filters, and stops them by sending a signal sig. If an instance
-// is still running after a grace period defined by timeout is expired,
-// it will be forcibly killed.
-func StopInstance(name, user string, sig syscall.Signal, timeout time.Duration) error {
-	ii, err := instanceListOrError(user, name)
+// bandwidthLimits returns the ingress and egress rate limits of an
+// instance on its networks, as shown by instance stats.
+func bandwidthLimits(bandwidth []instance.Bandwidth) string {
+	rate := func(r uint64) string {
+		if r == 0 {
+			return "-"
+		}
+		return network.FormatRate(r)
+	}
+	limits := make([]string, 0, len(bandwidth))
+	for _, b := range bandwidth {
+		limits = append(limits, fmt.Sprintf("%s: %s / %s", b.Network, rate(b.IngressRate), rate(b.EgressRate)))
+	}
+	if len(limits) == 0 {
+		return "-"
+	}
+	return strings.Join(limits, ", ")
+}
+
+// InstanceEvents prints the memory events counters and the memory pressure
+// stall information of an instance, in a regular or a JSON lines format
+// (if formatJSON is true). When follow is true, a new record is printed
+// each time the memory events counters change until the instance exits.
+func InstanceEvents(ctx context.Context, name, instanceUser string, formatJSON bool, follow bool) error {
+	ii, err := instanceListOrError(instanceUser, name)
 	if err != nil {
 		return err
 	}
-	stoppedPID := make(chan int, 1)
-	stopped := make([]int, 0)
+	if len(ii) != 1 {
+		return fmt.Errorf("query returned more than one instance (%d)", len(ii))
+	}
+	i := ii[0]
 
-	for _, i := range ii {
-		go killInstance(i, sig, stoppedPID)
+	if !i.Cgroup && !i.JobCgroup {
+		url := "the Apptainer instance user guide for instructions"
+		return fmt.Errorf("events are only available if cgroups are enabled, see %s", url)
+	}
+
+	manager, err := cgroups.GetManagerForPid(i.Pid)
+	if err != nil {
+		return fmt.Errorf("while getting cgroup manager for pid: %v", err)
+	}
+
+	events, err := manager.GetMemoryEvents()
+	if err != nil {
+		return fmt.Errorf("while getting memory events: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	printEvent := func(events *cgroups.MemoryEvents) error {
+		pressure, _ := manager.GetMemoryPressure()
+		e := instanceEvent{
+			Time:           time.Now(),
+			MemoryEvents:   events,
+			MemoryPressure: pressure,
+		}
+		if formatJSON {
+			return enc.Encode(e)
+		}
+		line := fmt.Sprintf("%s low=%d high=%d max=%d oom=%d oom_kill=%d",
+			e.Time.Format(time.RFC3339), events.Low, events.High, events.Max, events.OOM, events.OOMKill)
+		if pressure != nil {
+			line += fmt.Sprintf(" psi_some_avg10=%.2f psi_full_avg10=%.2f", pressure.Some.Avg10, pressure.Full.Avg10)
+		}
+		_, err := fmt.Println(line)
+		return err
+	}
+
+	if err := printEvent(events); err != nil || !follow {
+		return err
 	}
 
 	for {
 		select {
-		case pid := <-stoppedPID:
-			stopped = append(stopped, pid)
-			if len(stopped) == len(ii) {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(1 * time.Second):
+			cur, err := manager.GetMemoryEvents()
+			if err != nil {
+				// the instance cgroup is gone
 				return nil
 			}
-		case <-time.After(timeout):
-		killNext:
-			for _, i := range ii {
-				for _, pid := range stopped {
-					if i.Pid == pid {
-						continue killNext
-					}
-				}
+			if *cur == *events {
+				continue
+			}
+			events = cur
+			if err := printEvent(events); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// stopKillTimeout is the time given to instances killed after the stop
+// timeout to exit.
+const stopKillTimeout = 5 * time.Second
+
+// ErrNoInstance is returned when no instance matches the name given to an
+// instance command.
+var ErrNoInstance = errors.New("no instance found")
+
+// errStopTimeout is returned by StopInstance when instances were killed
+// after the stop timeout.
+var errStopTimeout = errors.New("did not stop within the timeout and were killed")
+
+// StopInstance fetches instance list, applying name, user and filter
+// filters, and stops them by sending a signal sig. If an instance
+// is still running after a grace period defined by timeout is expired,
+// it will be forcibly killed and an error is returned. Files of already
+// exited instances are removed.
+func StopInstance(name, user string, filter *InstanceFilter, sig syscall.Signal, timeout time.Duration) error {
+	// with a filter, only the running instances matching it are stopped
+	var selected map[string]bool
+	if filter != nil {
+		ii, err := instanceListOrError(user, name)
+		if err != nil {
+			return err
+		}
+		ii, _ = filterInstances(ii, filter)
+		if len(ii) == 0 {
+			return ErrNoInstance
+		}
+		selected = make(map[string]bool, len(ii))
+		for _, i := range ii {
+			selected[i.Name] = true
+		}
+	}
+
+	// stop supervisors first so stopped instances are not restarted
+	ss, err := instance.ListSupervisors(user, name, instance.AppSubDir)
+	if err != nil {
+		return fmt.Errorf("could not retrieve instance supervisors: %v", err)
+	}
+	for _, s := range ss {
+		if selected != nil && !selected[s.Name] {
+			continue
+		}
+		if err := s.Stop(); err != nil {
+			sylog.Warningf("%s", err)
+		}
+	}
+
+	ghosts, err := CleanupInstances(user, name, false)
+	if err != nil {
+		return fmt.Errorf("could not clean exited instances: %v", err)
+	}
+	for _, i := range ghosts {
+		reportExitStatus(i)
+	}
 
+	ii, err := instanceListOrError(user, name)
+	if err != nil && (len(ss) > 0 || len(ghosts) > 0) {
+		// instances were waiting to be restarted or already exited
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if selected != nil {
+		matched := make([]*instance.File, 0, len(ii))
+		for _, i := range ii {
+			if selected[i.Name] {
+				matched = append(matched, i)
+			}
+		}
+		ii = matched
+	}
+
+	managers := make([]*cgroups.Manager, len(ii))
+	stoppedPID := make(chan int, len(ii))
+	for n, i := range ii {
+		managers[n] = instanceCgroupManager(i)
+		go killInstance(i, managers[n], sig, stoppedPID)
+	}
+
+	stopped := make(map[int]bool)
+	timedOut := make([]string, 0)
+	deadline := time.After(timeout)
+
+	for len(stopped) < len(ii) {
+		select {
+		case pid := <-stoppedPID:
+			stopped[pid] = true
+		case <-deadline:
+			if len(timedOut) > 0 {
+				return fmt.Errorf("instance(s) %s still running after being killed", strings.Join(timedOut, ", "))
+			}
+			for n, i := range ii {
+				if stopped[i.Pid] {
+					continue
+				}
 				sylog.Infof("Killing %s instance of %s (PID=%d) (Timeout)\n", i.Name, i.Image, i.Pid)
-				syscall.Kill(i.Pid, syscall.SIGKILL)
+				killInstanceProcesses(i, managers[n])
+				timedOut = append(timedOut, i.Name)
 			}
-			return nil
+			deadline = time.After(stopKillTimeout)
 		}
 	}
+
+	if len(timedOut) > 0 {
+		return fmt.Errorf("instance(s) %s %w", strings.Join(timedOut, ", "), errStopTimeout)
+	}
+	return nil
 }
 
-func killInstance(i *instance.File, sig syscall.Signal, stoppedPID chan<- int) {
+// ReleaseInstanceIPs releases the network addresses kept for the instances
+// of user matching the name glob, whether they are running or not, and
+// returns the names of these instances. Running instances keep their
+// address until they are stopped.
+func ReleaseInstanceIPs(name, user string) ([]string, error) {
+	allocs, err := instance.GetAllocations(user)
+	if err != nil {
+		return nil, err
+	}
+	match := func(allocs instance.Allocations) []string {
+		var names []string
+		for n := range allocs {
+			if ok, _ := filepath.Match(name, n); ok {
+				names = append(names, n)
+			}
+		}
+		return names
+	}
+	// don't create the allocations file of the user when there is
+	// nothing to release
+	if len(match(allocs)) == 0 {
+		return nil, nil
+	}
+
+	var released []string
+	err = instance.UpdateAllocations(user, func(allocs instance.Allocations) error {
+		released = match(allocs)
+		for _, n := range released {
+			sylog.Infof("Releasing address %s of instance %s on network %s", allocs[n].IP, n, allocs[n].Network)
+			delete(allocs, n)
+		}
+		return nil
+	})
+	sort.Strings(released)
+	return released, err
+}
+
+// instanceCgroupManager returns the manager of the cgroup of an instance,
+// or nil if the instance has no cgroup.
+func instanceCgroupManager(i *instance.File) *cgroups.Manager {
+	if !i.Cgroup {
+		return nil
+	}
+	manager, err := cgroups.GetManagerForPid(i.Pid)
+	if err != nil {
+		sylog.Debugf("Could not get cgroup of %s instance: %s", i.Name, err)
+		return nil
+	}
+	return manager
+}
+
+// cgroupPids returns the PIDs of the processes in a cgroup, if any.
+func cgroupPids(manager *cgroups.Manager) []int {
+	if manager == nil {
+		return nil
+	}
+	// the cgroup is removed once the instance has exited
+	pids, err := manager.GetPids()
+	if err != nil {
+		return nil
+	}
+	return pids
+}
+
+// killInstanceProcesses kills the instance process and the processes
+// remaining in its cgroup.
+func killInstanceProcesses(i *instance.File, manager *cgroups.Manager) {
+	syscall.Kill(i.Pid, syscall.SIGKILL)
+	for _, pid := range cgroupPids(manager) {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+}
+
+// reportExitStatus reports the final exit status recorded for an exited
+// instance, which is 128 plus the signal number when the instance was
+// stopped by a signal, and removes it.
+func reportExitStatus(i *instance.File) {
+	status, err := instance.PopExitStatus(i.Name, instance.AppSubDir)
+	if err != nil {
+		sylog.Debugf("Could not get exit status of instance %s: %s", i.Name, err)
+		return
+	}
+	sylog.Infof("%s instance of %s exited with status %d", i.Name, i.Image, status)
+}
+
+// killInstance sends sig to an instance and sends its PID to stoppedPID
+// once the instance exited and its cgroup, if any, is empty so resources
+// like file locks are released.
+func killInstance(i *instance.File, manager *cgroups.Manager, sig syscall.Signal, stoppedPID chan<- int) {
 	sylog.Infof("Stopping %s instance of %s (PID=%d)\n", i.Name, i.Image, i.Pid)
-	syscall.Kill(i.Pid, sig)
+	if sig == syscall.SIGKILL {
+		killInstanceProcesses(i, manager)
+	} else {
+		syscall.Kill(i.Pid, sig)
+	}
 
 	for {
-		if err := syscall.Kill(i.PPid, 0); err == syscall.ESRCH {
+		if err := syscall.Kill(i.PPid, 0); err == syscall.ESRCH && len(cgroupPids(manager)) == 0 {
+			reportExitStatus(i)
 			stoppedPID <- i.Pid
 			break
 		}
@@ -0,0 +1,86 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+)
+
+// InstanceLogsOptions selects the instance log files printed by
+// InstanceLogs and how they are printed.
+type InstanceLogsOptions struct {
+	// Follow keeps printing new log lines until the context is canceled.
+	Follow bool
+	// Tail prints only the last Tail lines of each log file if not negative.
+	Tail int
+	// Stdout and Stderr select the standard output and error log files.
+	Stdout bool
+	Stderr bool
+	// Timestamps prefixes log lines with the time they were read.
+	Timestamps bool
+}
+
+// InstanceLogs prints the standard output and/or error log files of a
+// named instance to the standard output and error streams respectively.
+func InstanceLogs(ctx context.Context, name, instanceUser string, opts InstanceLogsOptions) error {
+	ii, err := instanceListOrError(instanceUser, name)
+	if err != nil {
+		return err
+	}
+	if len(ii) != 1 {
+		return fmt.Errorf("query returned more than one instance (%d)", len(ii))
+	}
+	i := ii[0]
+
+	type logFile struct {
+		path string
+		w    io.Writer
+	}
+	var logs []logFile
+	if opts.Stdout {
+		logs = append(logs, logFile{i.LogOutPath, os.Stdout})
+	}
+	if opts.Stderr {
+		logs = append(logs, logFile{i.LogErrPath, os.Stderr})
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make([]error, len(logs))
+
+	for n, l := range logs {
+		wg.Add(1)
+		go func(n int, l logFile) {
+			defer wg.Done()
+			errs[n] = instance.FollowLog(ctx, l.path, opts.Tail, opts.Follow, func(line []byte) {
+				mu.Lock()
+				defer mu.Unlock()
+				if opts.Timestamps {
+					fmt.Fprintf(l.w, "%s ", time.Now().Format(time.RFC3339Nano))
+				}
+				l.w.Write(line)
+			})
+		}(n, l)
+	}
+	wg.Wait()
+
+	for n, err := range errs {
+		if err != nil {
+			return fmt.Errorf("while reading log file %s: %w", logs[n].path, err)
+		}
+	}
+	return nil
+}
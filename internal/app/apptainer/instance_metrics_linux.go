@@ -0,0 +1,188 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// instanceMetric describes a metric exported in the Prometheus text format.
+type instanceMetric struct {
+	name  string
+	help  string
+	kind  string
+	value func(m *cgroups.Metrics) *uint64
+	scale float64
+}
+
+var instanceMetrics = []instanceMetric{
+	{
+		name:  "apptainer_instance_cpu_seconds_total",
+		help:  "Total CPU time consumed by the instance in seconds.",
+		kind:  "counter",
+		value: func(m *cgroups.Metrics) *uint64 { return m.CPUTime },
+		scale: 1e-9,
+	},
+	{
+		name:  "apptainer_instance_memory_usage_bytes",
+		help:  "Current memory usage of the instance in bytes.",
+		kind:  "gauge",
+		value: func(m *cgroups.Metrics) *uint64 { return m.MemoryCurrent },
+	},
+	{
+		name:  "apptainer_instance_memory_peak_bytes",
+		help:  "Maximum memory usage recorded for the instance in bytes.",
+		kind:  "gauge",
+		value: func(m *cgroups.Metrics) *uint64 { return m.MemoryPeak },
+	},
+	{
+		name:  "apptainer_instance_pids",
+		help:  "Current number of processes in the instance.",
+		kind:  "gauge",
+		value: func(m *cgroups.Metrics) *uint64 { return m.Pids },
+	},
+	{
+		name:  "apptainer_instance_block_read_bytes_total",
+		help:  "Total bytes read from block devices by the instance.",
+		kind:  "counter",
+		value: func(m *cgroups.Metrics) *uint64 { return m.BlockRead },
+	},
+	{
+		name:  "apptainer_instance_block_write_bytes_total",
+		help:  "Total bytes written to block devices by the instance.",
+		kind:  "counter",
+		value: func(m *cgroups.Metrics) *uint64 { return m.BlockWrite },
+	},
+	{
+		name:  "apptainer_instance_network_receive_bytes_total",
+		help:  "Total bytes received by the instance network interfaces.",
+		kind:  "counter",
+		value: func(m *cgroups.Metrics) *uint64 { return m.NetworkReceive },
+	},
+	{
+		name:  "apptainer_instance_network_transmit_bytes_total",
+		help:  "Total bytes transmitted by the instance network interfaces.",
+		kind:  "counter",
+		value: func(m *cgroups.Metrics) *uint64 { return m.NetworkTransmit },
+	},
+}
+
+// labelEscaper escapes label values as required by the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeInstanceMetrics writes the metrics of the instances in the Prometheus
+// text format. A metric is omitted for instances without its value.
+func writeInstanceMetrics(w io.Writer, ii []*instance.File, metrics []*cgroups.Metrics) error {
+	var b bytes.Buffer
+
+	for _, im := range instanceMetrics {
+		header := false
+		for n, i := range ii {
+			v := im.value(metrics[n])
+			if v == nil {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", im.name, im.help, im.name, im.kind)
+				header = true
+			}
+			value := fmt.Sprintf("%d", *v)
+			if im.scale != 0 {
+				value = fmt.Sprintf("%g", float64(*v)*im.scale)
+			}
+			fmt.Fprintf(&b, "%s{instance=\"%s\",image=\"%s\"} %s\n",
+				im.name, labelEscaper.Replace(i.Name), labelEscaper.Replace(i.Image), value)
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// instanceMetricsHandler collects the metrics of the instances of a user
+// with cgroups enabled each time it's called.
+func instanceMetricsHandler(instanceUser string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ii, err := instance.List(instanceUser, "*", instance.AppSubDir)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not retrieve instance list: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		var instances []*instance.File
+		var metrics []*cgroups.Metrics
+
+		for _, i := range ii {
+			if !i.Cgroup && !i.JobCgroup {
+				continue
+			}
+			manager, err := cgroups.GetManagerForPid(i.Pid)
+			if err != nil {
+				sylog.Debugf("Could not get cgroup manager for instance %s: %v", i.Name, err)
+				continue
+			}
+			m, err := manager.GetMetrics(i.Pid)
+			if err != nil {
+				sylog.Debugf("Could not get metrics for instance %s: %v", i.Name, err)
+				continue
+			}
+			instances = append(instances, i)
+			metrics = append(metrics, m)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := writeInstanceMetrics(w, instances, metrics); err != nil {
+			sylog.Debugf("Could not write instance metrics: %v", err)
+		}
+	}
+}
+
+// InstanceStatsPrometheus serves the metrics of all instances belonging to
+// instanceUser in the Prometheus text format on the listen address, until
+// the context is canceled.
+func InstanceStatsPrometheus(ctx context.Context, instanceUser, listen string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", instanceMetricsHandler(instanceUser))
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	sylog.Infof("Serving instance metrics on %s/metrics", listen)
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("while serving instance metrics: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
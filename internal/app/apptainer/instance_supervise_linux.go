@@ -0,0 +1,293 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+const (
+	// restartMinDelay and restartMaxDelay bound the exponential backoff
+	// between two consecutive restarts of an instance.
+	restartMinDelay = 1 * time.Second
+	restartMaxDelay = 60 * time.Second
+	// restartResetDelay is the time an instance must run before its
+	// consecutive restarts count is reset.
+	restartResetDelay = 5 * time.Minute
+)
+
+// RecordInstanceLaunch stores the command line, environment and working
+// directory used to start a named instance along with its restart policy
+// and health check in the instance file, so it can be started again with
+// the same flags.
+func RecordInstanceLaunch(name string, policy instance.RestartPolicy, hc *instance.HealthCheck) error {
+	i, err := instance.Get(name, instance.AppSubDir)
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{}, os.Args...)
+	if self, err := os.Executable(); err == nil {
+		args[0] = self
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("could not get current working directory: %w", err)
+	}
+
+	i.Launch = &instance.Launch{
+		Args: args,
+		Env:  os.Environ(),
+		Dir:  cwd,
+	}
+	i.Restart = policy.String()
+	i.HealthCheck = hc
+	if hc != nil {
+		i.Health = instance.NewHealth()
+	}
+
+	return i.Update()
+}
+
+// StartInstanceSupervisor starts a detached process supervising a named
+// instance, restarting it according to its restart policy and running its
+// health check, unless the instance is already supervised (when it's
+// restarted by its supervisor).
+func StartInstanceSupervisor(name string) error {
+	ss, err := instance.ListSupervisors("", name, instance.AppSubDir)
+	if err != nil {
+		return err
+	} else if len(ss) > 0 {
+		return nil
+	}
+
+	pw, err := user.CurrentOriginal()
+	if err != nil {
+		return err
+	}
+	procname, err := instance.SupervisorProcName(name, pw.Name)
+	if err != nil {
+		return err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	stdout, stderr, err := instance.SetLogFile(name, false, os.Getuid(), instance.LogSubDir)
+	if err != nil {
+		return fmt.Errorf("could not open instance log files: %w", err)
+	}
+	defer stdout.Close()
+	defer stderr.Close()
+
+	cmd := exec.Command(self, "instance", "supervise", name)
+	cmd.Args[0] = procname
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start instance supervisor: %w", err)
+	}
+	sylog.Debugf("Instance %s supervisor started (PID=%d)", name, cmd.Process.Pid)
+	return cmd.Process.Release()
+}
+
+// waitInstanceExit waits until the named instance exits, it returns false
+// if the context is canceled before. If launch is not nil, it's updated
+// with the launch configuration of the running instance, which may be
+// changed by instance update.
+func waitInstanceExit(ctx context.Context, name string, launch **instance.Launch) bool {
+	for {
+		ii, err := instance.List("", name, instance.AppSubDir)
+		if err == nil && len(ii) == 0 {
+			return true
+		}
+		if launch != nil && err == nil && ii[0].Launch != nil {
+			*launch = ii[0].Launch
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// launchInstance starts a named instance again with its original launch
+// configuration, forwarding the output to stdout and stderr.
+func launchInstance(name string, launch *instance.Launch) error {
+	cmd := exec.Command(launch.Args[0], launch.Args[1:]...)
+	cmd.Env = launch.Env
+	cmd.Dir = launch.Dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	applyLaunchCgroups(name, "", launch)
+	return nil
+}
+
+// InstanceSupervise supervises a named instance and restarts it with an
+// exponential backoff when it exits, according to its restart policy, or
+// when it's unhealthy with the restart unhealthy action. It returns when
+// the instance must not be restarted anymore, or when the context is
+// canceled by instance stop.
+func InstanceSupervise(ctx context.Context, name string) error {
+	i, err := instance.Get(name, instance.AppSubDir)
+	if err != nil {
+		return err
+	}
+	if i.Launch == nil || len(i.Launch.Args) == 0 {
+		return fmt.Errorf("no launch configuration recorded for instance %s", name)
+	}
+	policy, err := instance.ParseRestartPolicy(i.Restart)
+	if err != nil {
+		return err
+	}
+	launch := i.Launch
+	hc := i.HealthCheck
+
+	s, err := instance.NewSupervisor(name, instance.AppSubDir)
+	if err != nil {
+		return err
+	}
+	s.Pid = os.Getpid()
+	if err := s.Update(); err != nil {
+		return fmt.Errorf("could not write supervisor file: %w", err)
+	}
+	defer s.Delete()
+
+	consecutive := 0
+	started := time.Now()
+
+	for {
+		action := make(chan string, 1)
+		runCtx, cancelRun := context.WithCancel(ctx)
+		if hc != nil {
+			go func() {
+				action <- superviseHealth(runCtx, name, hc)
+			}()
+		}
+		exited := waitInstanceExit(ctx, name, &launch)
+		cancelRun()
+		if !exited {
+			return nil
+		}
+
+		unhealthyAction := ""
+		if hc != nil {
+			unhealthyAction = <-action
+		}
+		if unhealthyAction == instance.UnhealthyStop {
+			sylog.Infof("Unhealthy instance %s stopped, not restarting", name)
+			return nil
+		}
+		// the unhealthy restart action applies whatever the restart policy
+		force := unhealthyAction == instance.UnhealthyRestart
+
+		status, err := instance.PopExitStatus(name, instance.AppSubDir)
+		if err != nil {
+			sylog.Warningf("Could not get exit status of instance %s: %s", name, err)
+			status = 255
+		}
+		if time.Since(started) > restartResetDelay {
+			consecutive = 0
+		}
+
+		for {
+			if !force && !policy.ShouldRestart(status, consecutive) {
+				sylog.Infof("Instance %s exited with status %d, not restarting (restart policy %s)", name, status, policy)
+				return nil
+			}
+
+			delay := restartMinDelay << consecutive
+			if delay > restartMaxDelay || delay <= 0 {
+				delay = restartMaxDelay
+			}
+			sylog.Infof("Instance %s exited with status %d, restarting in %s", name, status, delay)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay):
+			}
+
+			consecutive++
+			s.Restarts++
+			started = time.Now()
+
+			if err := launchInstance(name, launch); err == nil {
+				break
+			}
+			sylog.Errorf("Failed to restart instance %s", name)
+			status = 255
+			force = false
+		}
+
+		if err := s.Update(); err != nil {
+			sylog.Warningf("Could not update supervisor file: %s", err)
+		}
+		i, err := instance.Get(name, instance.AppSubDir)
+		if err != nil {
+			sylog.Warningf("Could not get restarted instance %s: %s", name, err)
+			continue
+		}
+		i.Restarts = s.Restarts
+		i.LastExitStatus = &status
+		if err := i.Update(); err != nil {
+			sylog.Warningf("Could not update instance file: %s", err)
+		}
+	}
+}
+
+// RestartInstance stops a named instance and starts it again with the
+// flags it was originally started with.
+func RestartInstance(name string, timeout time.Duration) error {
+	ii, err := instanceListOrError("", name)
+	if err != nil {
+		return err
+	}
+	if len(ii) != 1 {
+		return fmt.Errorf("query returned more than one instance (%d)", len(ii))
+	}
+	i := ii[0]
+	if i.Launch == nil || len(i.Launch.Args) == 0 {
+		return fmt.Errorf("instance %s has no recorded launch configuration, it must be stopped and started manually", i.Name)
+	}
+
+	if err := StopInstance(i.Name, "", nil, syscall.SIGINT, timeout); errors.Is(err, errStopTimeout) {
+		sylog.Warningf("%s", err)
+	} else if err != nil {
+		return err
+	}
+	// wait for the instance cleanup before starting it again
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+10*time.Second)
+	defer cancel()
+	if !waitInstanceExit(ctx, i.Name, nil) {
+		return fmt.Errorf("instance %s is still running", i.Name)
+	}
+
+	if err := launchInstance(i.Name, i.Launch); err != nil {
+		return fmt.Errorf("while starting instance %s: %w", i.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// systemUnitDir is the directory where system units are installed.
+const systemUnitDir = "/etc/systemd/system"
+
+// instanceUnitDir returns the directory where the systemd unit of an
+// instance is installed.
+func instanceUnitDir(system bool) (string, error) {
+	if system {
+		return systemUnitDir, nil
+	}
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config, "systemd", "user"), nil
+}
+
+// systemctl runs systemctl for the system or user service manager.
+func systemctl(system bool, args ...string) error {
+	if !system {
+		args = append([]string{"--user"}, args...)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %v failed: %w: %s", args, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// InstallInstanceUnit installs the systemd unit of an instance, reloads
+// the service manager and, if now is true, enables and starts the unit.
+func InstallInstanceUnit(u *instance.Unit, now bool) error {
+	if u.System && os.Geteuid() != 0 {
+		return fmt.Errorf("only root can install a system unit")
+	}
+
+	dir, err := instanceUnitDir(u.System)
+	if err != nil {
+		return fmt.Errorf("could not determine systemd unit directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("could not create %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, u.ServiceName())
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not create systemd unit: %w", err)
+	}
+	if err := u.Write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write systemd unit %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write systemd unit %s: %w", path, err)
+	}
+	sylog.Infof("Installed systemd unit %s", path)
+
+	if err := systemctl(u.System, "daemon-reload"); err != nil {
+		return err
+	}
+	if now {
+		return systemctl(u.System, "enable", "--now", u.ServiceName())
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	units "github.com/docker/go-units"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// resetUnsetLimits sets the memory, CPU quota and PIDs limits which are
+// not set in resources to unlimited, so that resources replace all the
+// current limits.
+func resetUnsetLimits(resources *specs.LinuxResources) {
+	unlimited := int64(-1)
+
+	if resources.Memory == nil {
+		resources.Memory = &specs.LinuxMemory{}
+	}
+	if resources.Memory.Limit == nil {
+		resources.Memory.Limit = &unlimited
+	}
+	if resources.CPU == nil {
+		resources.CPU = &specs.LinuxCPU{}
+	}
+	if resources.CPU.Quota == nil {
+		resources.CPU.Quota = &unlimited
+	}
+	if resources.Pids == nil {
+		resources.Pids = &specs.LinuxPids{Limit: unlimited}
+	}
+}
+
+// warnMemoryUsage warns when the memory limit of resources is lower than
+// the current memory usage of the instance cgroup.
+func warnMemoryUsage(i *instance.File, manager *cgroups.Manager, resources *specs.LinuxResources) {
+	if resources.Memory == nil || resources.Memory.Limit == nil || *resources.Memory.Limit <= 0 {
+		return
+	}
+	stats, err := manager.GetStats()
+	if err != nil {
+		sylog.Debugf("Could not get memory usage of instance %s: %s", i.Name, err)
+		return
+	}
+	limit := *resources.Memory.Limit
+	if usage := stats.MemoryStats.Usage.Usage; uint64(limit) < usage {
+		sylog.Warningf("Memory limit %s is below the current memory usage %s of instance %s, its processes may be killed by the OOM killer",
+			units.BytesSize(float64(limit)), units.BytesSize(float64(usage)), i.Name)
+	}
+}
+
+// UpdateInstance updates the cgroup resource limits of a named running
+// instance with the limits in cgroupsJSON, and records them in the
+// instance file so they are applied again when the instance is
+// restarted. With replace, the limits replace all the previous ones,
+// otherwise only those set are updated.
+func UpdateInstance(name, username, cgroupsJSON string, replace bool) error {
+	ii, err := instanceListOrError(username, name)
+	if err != nil {
+		return err
+	}
+	if len(ii) != 1 {
+		return fmt.Errorf("query returned more than one instance (%d)", len(ii))
+	}
+	i := ii[0]
+	if !i.Cgroup {
+		return fmt.Errorf("instance %s was not started with cgroups resource limits, it must be restarted with one of the limit flags or --apply-cgroups", i.Name)
+	}
+
+	resources, err := cgroups.UnmarshalJSONResources(cgroupsJSON)
+	if err != nil {
+		return fmt.Errorf("while loading cgroups spec: %w", err)
+	}
+	if replace {
+		resetUnsetLimits(resources)
+	}
+
+	manager, err := cgroups.GetManagerForPid(i.Pid)
+	if err != nil {
+		return fmt.Errorf("while getting cgroup manager for pid: %v", err)
+	}
+	if err := manager.CheckDelegation(resources); err != nil {
+		return err
+	}
+	warnMemoryUsage(i, manager, resources)
+
+	if err := manager.UpdateFromSpec(resources); err != nil {
+		return err
+	}
+	sylog.Infof("Updated resource limits of %s instance of %s (PID=%d)", i.Name, i.Image, i.Pid)
+
+	if i.Launch == nil {
+		sylog.Warningf("Instance %s has no recorded launch configuration, the updated limits won't be applied on restart", i.Name)
+		return nil
+	}
+	recorded := cgroupsJSON
+	if replace {
+		data, err := json.Marshal(resources)
+		if err != nil {
+			return err
+		}
+		recorded = string(data)
+	} else {
+		recorded, err = cgroups.MergeJSONResources(i.Launch.Cgroups, cgroupsJSON)
+		if err != nil {
+			return fmt.Errorf("while recording resource limits: %w", err)
+		}
+	}
+	i.Launch.Cgroups = recorded
+	return i.Update()
+}
+
+// applyLaunchCgroups applies again the resource limits recorded in launch
+// by instance update to a named instance of username, once it has been
+// restarted.
+func applyLaunchCgroups(name, username string, launch *instance.Launch) {
+	if launch.Cgroups == "" {
+		return
+	}
+	ii, err := instance.List(username, name, instance.AppSubDir)
+	if err != nil || len(ii) != 1 {
+		sylog.Warningf("Could not get instance %s to apply its updated resource limits", name)
+		return
+	}
+	i := ii[0]
+
+	manager := instanceCgroupManager(i)
+	if manager == nil {
+		sylog.Warningf("Could not apply updated resource limits to instance %s: no cgroup", name)
+		return
+	}
+	resources, err := cgroups.UnmarshalJSONResources(launch.Cgroups)
+	if err == nil {
+		err = manager.UpdateFromSpec(resources)
+	}
+	if err != nil {
+		sylog.Warningf("Could not apply updated resource limits to instance %s: %s", name, err)
+		return
+	}
+
+	if i.Launch != nil {
+		i.Launch.Cgroups = launch.Cgroups
+		if err := i.Update(); err != nil {
+			sylog.Warningf("Could not update instance file: %s", err)
+		}
+	}
+}
@@ -20,7 +20,10 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 )
 
-func KeyserverAdd(name, uri string, order uint32, insecure bool) error {
+// KeyserverAdd adds a keyserver to the name remote endpoint, or to the
+// default one if name is empty. The keyserver is used for all the
+// operations except the disabledOps ones.
+func KeyserverAdd(name, uri string, order uint32, insecure bool, disabledOps ...endpoint.KeyserverOp) error {
 	// Explicit handling of corner cases: name and uri must be valid strings
 	if strings.TrimSpace(uri) == "" {
 		return fmt.Errorf("invalid URI: cannot have empty URI")
@@ -53,7 +56,7 @@ func KeyserverAdd(name, uri string, order uint32, insecure bool) error {
 		return fmt.Errorf("current endpoint is not a system defined endpoint")
 	}
 
-	if err := ep.AddKeyserver(uri, order, insecure); err != nil {
+	if err := ep.AddKeyserver(uri, order, insecure, disabledOps...); err != nil {
 		return err
 	}
 
@@ -11,15 +11,22 @@
 package apptainer
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"text/tabwriter"
 
 	"github.com/apptainer/apptainer/internal/pkg/remote"
+	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
+	"github.com/apptainer/apptainer/pkg/sylog"
 )
 
-// KeyserverList prints information about remote configurations
-func KeyserverList(remoteName string, usrConfigFile string) (err error) {
+// KeyserverList prints information about remote configurations. If status
+// is true, the keyservers are queried to show their reachability and
+// response time.
+func KeyserverList(remoteName string, usrConfigFile string, status bool) (err error) {
 	c := &remote.Config{}
 
 	// opening config file
@@ -55,8 +62,13 @@ func KeyserverList(remoteName string, usrConfigFile string) (err error) {
 			fmt.Fprintln(tw, " \t(unable to fetch associated keyserver info for this endpoint)")
 		}
 
+		var statuses []string
+		if status {
+			statuses = keyserverStatuses(ep)
+		}
+
 		order := 1
-		for _, kc := range ep.Keyservers {
+		for i, kc := range ep.Keyservers {
 			if kc.Skip {
 				continue
 			}
@@ -64,7 +76,11 @@ func KeyserverList(remoteName string, usrConfigFile string) (err error) {
 			if kc.Insecure {
 				secure = ""
 			}
-			fmt.Fprintf(tw, " \t#%d\t%s\t%s\n", order, kc.URI, secure)
+			fmt.Fprintf(tw, " \t#%d\t%s\t%s\t%s", order, kc.URI, secure, keyserverOps(kc))
+			if status {
+				fmt.Fprintf(tw, "\t%s", statuses[i])
+			}
+			fmt.Fprintln(tw)
 			order++
 		}
 		tw.Flush()
@@ -75,3 +91,42 @@ func KeyserverList(remoteName string, usrConfigFile string) (err error) {
 
 	return nil
 }
+
+// keyserverOps returns the operations a keyserver is used for.
+func keyserverOps(kc *endpoint.ServiceConfig) string {
+	var ops []string
+	for _, op := range []endpoint.KeyserverOp{endpoint.KeyserverVerifyOp, endpoint.KeyserverPushOp, endpoint.KeyserverSearchOp} {
+		if kc.Allows(op) {
+			ops = append(ops, op.String())
+		}
+	}
+	if len(ops) == 0 {
+		return "(unused)"
+	}
+	return strings.Join(ops, ",")
+}
+
+// keyserverStatuses queries the keyservers of the endpoint concurrently,
+// and returns their reachability and response time.
+func keyserverStatuses(ep *endpoint.Config) []string {
+	statuses := make([]string, len(ep.Keyservers))
+	var wg sync.WaitGroup
+	for i, kc := range ep.Keyservers {
+		if kc.Skip {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, kc *endpoint.ServiceConfig) {
+			defer wg.Done()
+			elapsed, err := ep.KeyserverStatus(context.Background(), kc)
+			if err != nil {
+				sylog.Debugf("Keyserver %s is unreachable: %v", kc.URI, err)
+				statuses[i] = "unreachable"
+				return
+			}
+			statuses[i] = fmt.Sprintf("reachable (%dms)", elapsed.Milliseconds())
+		}(i, kc)
+	}
+	wg.Wait()
+	return statuses
+}
@@ -0,0 +1,305 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/network"
+	"github.com/apptainer/apptainer/pkg/syfs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+	"github.com/apptainer/apptainer/pkg/util/slice"
+	"github.com/containernetworking/cni/libcni"
+)
+
+// Network scopes, the networks of the system are set by the administrator
+// and the networks of the user are created by a user for rootless mode.
+const (
+	NetworkScopeSystem = "system"
+	NetworkScopeUser   = "user"
+)
+
+// NetworkInfo describes a CNI network for the network commands.
+type NetworkInfo struct {
+	Name    string   `json:"name"`
+	Scope   string   `json:"scope"`
+	Dir     string   `json:"dir"`
+	Plugins []string `json:"plugins"`
+	Subnets []string `json:"subnets"`
+	// Spec is the description of a network created with 'network
+	// create', nil for the other networks
+	Spec *network.NetworkSpec `json:"spec,omitempty"`
+	// Instances are the running instances of the user on the network
+	Instances []string `json:"instances,omitempty"`
+	// Config is the CNI configuration of the network
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// NetworkCreateConfig is the configuration of a network created with
+// NetworkCreate.
+type NetworkCreateConfig struct {
+	Name        string
+	Driver      string
+	Subnet      string
+	Gateway     string
+	Internal    bool
+	IPv6Subnet  string
+	IPv6Gateway string
+}
+
+// networkDirs returns the directory of the networks of the system, and the
+// directory of the networks of the user, empty for root whose networks are
+// the ones of the system.
+func networkDirs() (string, string) {
+	system := filepath.Join(buildcfg.SYSCONFDIR, "apptainer", "network")
+	if conf := apptainerconf.GetCurrentConfig(); conf != nil && conf.CniConfPath != "" {
+		system = conf.CniConfPath
+	}
+	if os.Getuid() == 0 {
+		return system, ""
+	}
+	return system, syfs.NetworkConf()
+}
+
+// networkConfigs returns the networks of the directory dir, a missing
+// directory holding none.
+func networkConfigs(dir string) ([]*libcni.NetworkConfigList, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	confs, err := network.GetAllNetworkConfigList(&network.CNIPath{Conf: dir})
+	if _, ok := err.(libcni.NoConfigsFoundError); ok {
+		return nil, nil
+	}
+	return confs, err
+}
+
+// listNetworks returns the networks of the system and of the user, the
+// networks of the user shadowed by a network of the system are ignored as
+// --network resolves the networks of the system first.
+func listNetworks() ([]NetworkInfo, error) {
+	systemDir, userDir := networkDirs()
+
+	var infos []NetworkInfo
+	names := make([]string, 0)
+	for _, d := range []struct {
+		dir   string
+		scope string
+	}{
+		{systemDir, NetworkScopeSystem},
+		{userDir, NetworkScopeUser},
+	} {
+		confs, err := networkConfigs(d.dir)
+		if err != nil {
+			return nil, fmt.Errorf("while reading the networks of %s: %s", d.dir, err)
+		}
+		for _, conf := range confs {
+			if slice.ContainsString(names, conf.Name) {
+				if d.scope == NetworkScopeUser {
+					sylog.Warningf("Network %s of the user is shadowed by the network of the system with the same name", conf.Name)
+				}
+				continue
+			}
+			names = append(names, conf.Name)
+			infos = append(infos, newNetworkInfo(conf, d.dir, d.scope))
+		}
+	}
+	return infos, nil
+}
+
+// NetworkNames returns the names of the networks of the system and of the
+// user, used for the completion of --network.
+func NetworkNames() []string {
+	systemDir, userDir := networkDirs()
+
+	names := make([]string, 0)
+	for _, dir := range []string{systemDir, userDir} {
+		confs, err := networkConfigs(dir)
+		if err != nil {
+			sylog.Debugf("While reading the networks of %s: %s", dir, err)
+			continue
+		}
+		for _, conf := range confs {
+			if !slice.ContainsString(names, conf.Name) {
+				names = append(names, conf.Name)
+			}
+		}
+	}
+	return names
+}
+
+// newNetworkInfo returns the description of the network conf found in the
+// directory dir of scope.
+func newNetworkInfo(conf *libcni.NetworkConfigList, dir, scope string) NetworkInfo {
+	info := NetworkInfo{
+		Name:    conf.Name,
+		Scope:   scope,
+		Dir:     dir,
+		Plugins: make([]string, 0, len(conf.Plugins)),
+		Subnets: make([]string, 0),
+		Config:  conf.Bytes,
+	}
+	for _, p := range conf.Plugins {
+		info.Plugins = append(info.Plugins, p.Network.Type)
+	}
+	for _, subnet := range network.NetworkSubnets(conf) {
+		info.Subnets = append(info.Subnets, subnet.String())
+	}
+	if spec, err := network.ReadNetworkSpec(conf); err == nil {
+		info.Spec = &spec
+	}
+	return info
+}
+
+// networkInstances returns the running instances of the current user
+// attached to the network name.
+func networkInstances(name string) ([]string, error) {
+	ii, err := instance.List("", "*", instance.AppSubDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve instance list: %w", err)
+	}
+	var names []string
+	for _, i := range ii {
+		if i.Details == nil {
+			continue
+		}
+		if slice.ContainsString(strings.Split(i.Details.Network, ","), name) {
+			names = append(names, i.Name)
+		}
+	}
+	return names, nil
+}
+
+// NetworkCreate creates the network described by spec, in the directory of
+// the networks of the system when run by root, or else in the directory of
+// the networks of the user, which are only used in rootless mode. The
+// network must not share addresses with the other networks.
+func NetworkCreate(c NetworkCreateConfig) error {
+	spec := network.NetworkSpec(c)
+	systemDir, userDir := networkDirs()
+
+	existing, err := networkConfigs(systemDir)
+	if err != nil {
+		return fmt.Errorf("while reading the networks of %s: %s", systemDir, err)
+	}
+	userConfs, err := networkConfigs(userDir)
+	if err != nil {
+		return fmt.Errorf("while reading the networks of %s: %s", userDir, err)
+	}
+	existing = append(existing, userConfs...)
+
+	dir := systemDir
+	if userDir != "" {
+		dir = userDir
+	}
+	path, err := network.CreateNetwork(dir, spec, os.Getuid(), existing)
+	if err != nil {
+		return err
+	}
+	sylog.Infof("Network %s created in %s", spec.Name, path)
+	if userDir != "" {
+		sylog.Infof("Networks created by a user are used in --fakeroot mode, or when the administrator permits their name")
+	}
+	return nil
+}
+
+// NetworkList writes the networks of the system and of the user to w, as a
+// JSON array if jsonOutput is set.
+func NetworkList(w io.Writer, jsonOutput bool) error {
+	infos, err := listNetworks()
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		for i := range infos {
+			infos[i].Config = nil
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if infos == nil {
+			infos = []NetworkInfo{}
+		}
+		return enc.Encode(infos)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSCOPE\tSUBNETS\tPLUGINS")
+	for _, info := range infos {
+		subnets := strings.Join(info.Subnets, ",")
+		if subnets == "" {
+			subnets = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", info.Name, info.Scope, subnets, strings.Join(info.Plugins, ","))
+	}
+	return tw.Flush()
+}
+
+// NetworkInspect writes the description of the network name, along with its
+// CNI configuration and the instances of the user attached to it, as JSON
+// to w.
+func NetworkInspect(w io.Writer, name string) error {
+	infos, err := listNetworks()
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if info.Name != name {
+			continue
+		}
+		if info.Instances, err = networkInstances(name); err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	return fmt.Errorf("no network found with name %s", name)
+}
+
+// NetworkRemove removes the network name created with 'network create', from
+// the directory of the networks of the system when run by root, or else
+// from the directory of the networks of the user. A network with instances
+// of the user attached is not removed.
+func NetworkRemove(name string) error {
+	systemDir, userDir := networkDirs()
+	dir := systemDir
+	if userDir != "" {
+		dir = userDir
+	}
+
+	attached, err := networkInstances(name)
+	if err != nil {
+		return err
+	}
+	if len(attached) > 0 {
+		return fmt.Errorf("network %s is used by instance(s) %s, stop them first", name, strings.Join(attached, ", "))
+	}
+	if err := network.RemoveNetwork(dir, name); err != nil {
+		switch err.(type) {
+		case libcni.NotFoundError, libcni.NoConfigsFoundError:
+			return fmt.Errorf("no network found with name %s in %s", name, dir)
+		}
+		return err
+	}
+	sylog.Infof("Network %s removed", name)
+	return nil
+}
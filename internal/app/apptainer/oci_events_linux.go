@@ -0,0 +1,148 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
+	"github.com/apptainer/apptainer/pkg/ociruntime"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	lccgroups "github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/types"
+)
+
+// OciEvents writes the events of a container to w as runc compatible JSON
+// lines: the stats of the container every interval and its OOM kills,
+// until the container stops. With args.EventsStats the stats are written
+// once.
+func OciEvents(containerID string, args *OciArgs, w io.Writer) error {
+	state, err := getState(containerID)
+	if err != nil {
+		return err
+	}
+	if state.Status != ociruntime.Running && state.Status != ociruntime.Paused {
+		return fmt.Errorf("container %s is not running", containerID)
+	}
+	if args.EventsInterval <= 0 {
+		return fmt.Errorf("interval must be greater than 0")
+	}
+
+	manager, err := cgroups.GetManagerForPid(state.Pid)
+	if err != nil {
+		return fmt.Errorf("failed to get cgroups manager: %v", err)
+	}
+
+	enc := json.NewEncoder(w)
+	writeStats := func() error {
+		stats, err := manager.GetStats()
+		if err != nil {
+			return fmt.Errorf("while getting container stats: %s", err)
+		}
+		return enc.Encode(types.Event{Type: "stats", ID: containerID, Data: convertStats(stats)})
+	}
+
+	if args.EventsStats {
+		return writeStats()
+	}
+
+	// OOM kills are only counted with cgroups v2
+	var oomKills uint64
+	if events, err := manager.GetMemoryEvents(); err == nil {
+		oomKills = events.OOMKill
+	}
+
+	ticker := time.NewTicker(args.EventsInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		state, err := getState(containerID)
+		if err != nil || state.Status == ociruntime.Stopped {
+			return nil
+		}
+		if events, err := manager.GetMemoryEvents(); err == nil {
+			for ; oomKills < events.OOMKill; oomKills++ {
+				if err := enc.Encode(types.Event{Type: "oom", ID: containerID}); err != nil {
+					return err
+				}
+			}
+		}
+		if err := writeStats(); err != nil {
+			// the cgroup is removed when the container stops
+			sylog.Debugf("%s", err)
+			continue
+		}
+	}
+	return nil
+}
+
+// convertStats converts cgroups stats to the stats reported by runc events.
+func convertStats(cg *lccgroups.Stats) *types.Stats {
+	var s types.Stats
+
+	s.Pids.Current = cg.PidsStats.Current
+	s.Pids.Limit = cg.PidsStats.Limit
+
+	s.CPU.Usage.Kernel = cg.CpuStats.CpuUsage.UsageInKernelmode
+	s.CPU.Usage.User = cg.CpuStats.CpuUsage.UsageInUsermode
+	s.CPU.Usage.Total = cg.CpuStats.CpuUsage.TotalUsage
+	s.CPU.Usage.Percpu = cg.CpuStats.CpuUsage.PercpuUsage
+	s.CPU.Usage.PercpuKernel = cg.CpuStats.CpuUsage.PercpuUsageInKernelmode
+	s.CPU.Usage.PercpuUser = cg.CpuStats.CpuUsage.PercpuUsageInUsermode
+	s.CPU.Throttling.Periods = cg.CpuStats.ThrottlingData.Periods
+	s.CPU.Throttling.ThrottledPeriods = cg.CpuStats.ThrottlingData.ThrottledPeriods
+	s.CPU.Throttling.ThrottledTime = cg.CpuStats.ThrottlingData.ThrottledTime
+
+	s.CPUSet = types.CPUSet(cg.CPUSetStats)
+
+	memoryEntry := func(m lccgroups.MemoryData) types.MemoryEntry {
+		return types.MemoryEntry{
+			Limit:   m.Limit,
+			Usage:   m.Usage,
+			Max:     m.MaxUsage,
+			Failcnt: m.Failcnt,
+		}
+	}
+	s.Memory.Cache = cg.MemoryStats.Cache
+	s.Memory.Kernel = memoryEntry(cg.MemoryStats.KernelUsage)
+	s.Memory.KernelTCP = memoryEntry(cg.MemoryStats.KernelTCPUsage)
+	s.Memory.Swap = memoryEntry(cg.MemoryStats.SwapUsage)
+	s.Memory.Usage = memoryEntry(cg.MemoryStats.Usage)
+	s.Memory.Raw = cg.MemoryStats.Stats
+
+	blkioEntries := func(entries []lccgroups.BlkioStatEntry) []types.BlkioEntry {
+		var out []types.BlkioEntry
+		for _, e := range entries {
+			out = append(out, types.BlkioEntry(e))
+		}
+		return out
+	}
+	s.Blkio.IoServiceBytesRecursive = blkioEntries(cg.BlkioStats.IoServiceBytesRecursive)
+	s.Blkio.IoServicedRecursive = blkioEntries(cg.BlkioStats.IoServicedRecursive)
+	s.Blkio.IoQueuedRecursive = blkioEntries(cg.BlkioStats.IoQueuedRecursive)
+	s.Blkio.IoServiceTimeRecursive = blkioEntries(cg.BlkioStats.IoServiceTimeRecursive)
+	s.Blkio.IoWaitTimeRecursive = blkioEntries(cg.BlkioStats.IoWaitTimeRecursive)
+	s.Blkio.IoMergedRecursive = blkioEntries(cg.BlkioStats.IoMergedRecursive)
+	s.Blkio.IoTimeRecursive = blkioEntries(cg.BlkioStats.IoTimeRecursive)
+	s.Blkio.SectorsRecursive = blkioEntries(cg.BlkioStats.SectorsRecursive)
+
+	s.Hugetlb = make(map[string]types.Hugetlb)
+	for k, v := range cg.HugetlbStats {
+		s.Hugetlb[k] = types.Hugetlb{
+			Usage:   v.Usage,
+			Max:     v.MaxUsage,
+			Failcnt: v.Failcnt,
+		}
+	}
+
+	return &s
+}
@@ -10,17 +10,29 @@
 package apptainer
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	osignal "os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/oci"
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
 	"github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/pkg/ociruntime"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/creack/pty"
+	"golang.org/x/term"
 )
 
-// OciExec executes a command in a container
-func OciExec(containerID string, cmdArgs []string) error { //nolint:staticcheck
+// OciExec executes a command in a container, the command enters in all
+// the namespaces and in the cgroup of the container.
+func OciExec(containerID string, cmdArgs []string, args *OciArgs) error { //nolint:staticcheck
 	commonConfig, err := getCommonConfig(containerID)
 	if err != nil {
 		return fmt.Errorf("%s doesn't exist", containerID)
@@ -38,8 +50,85 @@ func OciExec(containerID string, cmdArgs []string) error { //nolint:staticcheck
 	engineConfig.Exec = true
 	engineConfig.OciConfig.SetProcessArgs(cmdArgs)
 
+	for _, env := range args.Env {
+		name, value, ok := strings.Cut(env, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("environment variable %q must be in the form NAME=VALUE", env)
+		}
+		engineConfig.OciConfig.SetProcessEnv(name, value)
+	}
+	if args.Cwd != "" {
+		if !filepath.IsAbs(args.Cwd) {
+			return fmt.Errorf("working directory %s must be an absolute path", args.Cwd)
+		}
+		engineConfig.OciConfig.SetProcessCwd(args.Cwd)
+	}
+	engineConfig.OciConfig.SetProcessTerminal(args.Tty)
+
 	os.Clearenv()
 
 	procName := fmt.Sprintf("Apptainer OCI %s", containerID)
+	if args.Tty {
+		return execTerminal(procName, commonConfig)
+	}
 	return starter.Exec(procName, commonConfig)
 }
+
+// execTerminal runs the starter for oci exec with a new terminal as
+// standard streams, the terminal is proxied to the terminal of the caller
+// until the command exits, then the caller exits with the command status.
+func execTerminal(procName string, commonConfig *config.Common) error {
+	if !term.IsTerminal(0) {
+		return fmt.Errorf("--tty requires a terminal on standard input")
+	}
+
+	master, slave, err := pty.Open()
+	if err != nil {
+		return fmt.Errorf("while allocating terminal: %s", err)
+	}
+	defer master.Close()
+
+	if err := pty.InheritSize(os.Stdin, master); err != nil {
+		sylog.Debugf("Could not set terminal size: %s", err)
+	}
+
+	ostate, err := term.MakeRaw(0)
+	if err != nil {
+		slave.Close()
+		return fmt.Errorf("while setting terminal in raw mode: %s", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	osignal.Notify(signals, syscall.SIGWINCH)
+	defer osignal.Stop(signals)
+	go func() {
+		for range signals {
+			pty.InheritSize(os.Stdin, master)
+		}
+	}()
+
+	go io.Copy(master, os.Stdin)
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(os.Stdout, master)
+		close(copied)
+	}()
+
+	err = starter.Run(
+		procName,
+		commonConfig,
+		starter.WithStdin(slave),
+		starter.WithStdout(slave),
+		starter.WithStderr(slave),
+	)
+	// the master side returns EIO once the slave side is closed
+	slave.Close()
+	<-copied
+	term.Restore(0, ostate)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(signalutil.ExitCode(exitErr.Sys().(syscall.WaitStatus)))
+	}
+	return err
+}
@@ -14,6 +14,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/instance"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/oci"
@@ -34,6 +35,16 @@ type OciArgs struct {
 	KillTimeout    uint32
 	EmptyProcess   bool
 	ForceKill      bool
+	// Tty allocates a terminal for the process run by oci exec
+	Tty bool
+	// Env and Cwd are the additional environment variables and the
+	// working directory of the process run by oci exec
+	Env []string
+	Cwd string
+	// EventsInterval is the interval between the stats reported by oci
+	// events, and EventsStats reports the stats once
+	EventsInterval time.Duration
+	EventsStats    bool
 }
 
 func getCommonConfig(containerID string) (*config.Common, error) {
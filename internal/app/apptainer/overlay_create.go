@@ -11,6 +11,7 @@ package apptainer
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -27,9 +28,8 @@ import (
 )
 
 const (
-	mkfsBinary     = "mkfs.ext3"
-	ddBinary       = "dd"
-	truncateBinary = "truncate"
+	mkfsBinary = "mkfs.ext3"
+	ddBinary   = "dd"
 )
 
 // isSigned returns true if the SIF in rw contains one or more signature objects.
@@ -47,17 +47,23 @@ func isSigned(rw sif.ReadWriter) (bool, error) {
 	return len(sigs) > 0, err
 }
 
-// addOverlayToImage adds the EXT3 overlay at overlayPath to the SIF image at imagePath.
-func addOverlayToImage(imagePath, overlayPath string) error {
+// addOverlayToImage adds the EXT3 overlay at overlayPath to the SIF image at
+// imagePath. The overlay is appended in place, the image isn't rewritten. The
+// offset of the overlay data in the image is returned.
+func addOverlayToImage(imagePath, overlayPath string) (int64, error) {
 	f, err := sif.LoadContainerFromPath(imagePath)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer f.UnloadContainer()
 
+	if f.DescriptorsFree() == 0 {
+		return 0, fmt.Errorf("no free descriptor left in %s to add the overlay partition", imagePath)
+	}
+
 	tf, err := os.Open(overlayPath)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tf.Close()
 
@@ -70,53 +76,103 @@ func addOverlayToImage(imagePath, overlayPath string) error {
 		sif.OptPartitionMetadata(sif.FsExt3, sif.PartOverlay, arch),
 	)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	if err := f.AddObject(di); err != nil {
+		return 0, err
 	}
 
-	return f.AddObject(di)
+	// the overlay is the last object added
+	ds, err := f.GetDescriptors(sif.WithPartitionType(sif.PartOverlay))
+	if err != nil {
+		return 0, err
+	}
+	var offset int64
+	var id uint32
+	for _, d := range ds {
+		if d.ID() > id {
+			id, offset = d.ID(), d.Offset()
+		}
+	}
+	return offset, nil
 }
 
-// findConvertCommand finds dd unless overlaySparse is true
-func findConvertCommand(overlaySparse bool) (string, error) {
-	// We can support additional arguments, so return a list
-	command := ""
+// punchHoles deallocates the ranges of the file at path, from offset,
+// matching the holes of the sparse file src, so that a sparse overlay
+// stays sparse once added to a SIF image.
+func punchHoles(path string, offset int64, src string) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	fi, err := sf.Stat()
+	if err != nil {
+		return err
+	}
+	df, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer df.Close()
 
-	// Sparse overlay requires truncate -s
-	if overlaySparse {
-		truncate, err := bin.FindBin(truncateBinary)
+	size := fi.Size()
+	for pos := int64(0); pos < size; {
+		hole, err := unix.Seek(int(sf.Fd()), pos, unix.SEEK_HOLE)
 		if err != nil {
-			return command, err
+			return err
 		}
-		command = truncate
-
-		// Regular (non sparse) requires dd
-	} else {
-		dd, err := bin.FindBin(ddBinary)
-		if err != nil {
-			return command, err
+		if hole >= size {
+			break
 		}
-		command = dd
+		data, err := unix.Seek(int(sf.Fd()), hole, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			data = size
+		} else if err != nil {
+			return err
+		}
+		mode := uint32(unix.FALLOC_FL_PUNCH_HOLE | unix.FALLOC_FL_KEEP_SIZE)
+		if err := unix.Fallocate(int(df.Fd()), mode, offset+hole, data-hole); err != nil {
+			return err
+		}
+		pos = data
 	}
-	return command, nil
+	return nil
+}
+
+// findBinary finds a program required to create the overlay, the error
+// naming it.
+func findBinary(name string) (string, error) {
+	path, err := bin.FindBin(name)
+	if err != nil {
+		return "", fmt.Errorf("%s is required to create the overlay image but was not found: %w", name, err)
+	}
+	return path, nil
 }
 
 // OverlayCreate creates the overlay with an optional size, image path, dirs, fakeroot and sparse option.
+// With embedSIF, the overlay is added to the existing SIF image at imgPath,
+// which is never created.
 //
 //nolint:maintidx
-func OverlayCreate(size int, imgPath string, overlaySparse bool, isFakeroot bool, overlayDirs ...string) error {
+func OverlayCreate(size int, imgPath string, embedSIF, overlaySparse, isFakeroot bool, overlayDirs ...string) error {
 	if size < 64 {
 		return fmt.Errorf("image size must be equal or greater than 64 MiB")
 	}
 
-	mkfs, err := bin.FindBin(mkfsBinary)
+	mkfs, err := findBinary(mkfsBinary)
 	if err != nil {
 		return err
 	}
 
-	// This can be dd or truncate (if supported and --sparse is true)
-	convertCommand, err := findConvertCommand(overlaySparse)
-	if err != nil {
-		return err
+	// a sparse overlay is truncated to its size, dd zeroes a regular one
+	dd := ""
+	if !overlaySparse {
+		dd, err = findBinary(ddBinary)
+		if err != nil {
+			return err
+		}
 	}
 
 	buf := new(bytes.Buffer)
@@ -174,40 +230,10 @@ func OverlayCreate(size int, imgPath string, overlaySparse bool, isFakeroot bool
 		default:
 			return fmt.Errorf("destination image must be SIF image")
 		}
+	} else if embedSIF {
+		return fmt.Errorf("could not add writable overlay to SIF image %s: %s", imgPath, err)
 	}
 
-	tmpFile := imgPath + ".ext3"
-	defer func() {
-		_ = os.Remove(tmpFile)
-	}()
-
-	errBuf := new(bytes.Buffer)
-
-	// truncate has a different interaction than dd
-	if strings.Contains(convertCommand, "truncate") {
-		cmd = exec.Command(convertCommand, fmt.Sprintf("--size=%dM", size), tmpFile)
-	} else {
-		cmd = exec.Command(convertCommand, "if=/dev/zero", "of="+tmpFile, "bs=1M", fmt.Sprintf("count=%d", size))
-	}
-
-	cmd.Stderr = errBuf
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("while zero'ing overlay image %s: %s\nCommand error: %s", tmpFile, err, errBuf)
-	}
-	errBuf.Reset()
-
-	if err := os.Chmod(tmpFile, 0o600); err != nil {
-		return fmt.Errorf("while setting 0600 permission on %s: %s", tmpFile, err)
-	}
-
-	tmpDir, err := os.MkdirTemp("", "overlay-")
-	if err != nil {
-		return fmt.Errorf("while creating temporary overlay directory: %s", err)
-	}
-	defer func() {
-		_ = os.RemoveAll(tmpDir)
-	}()
-
 	perm := os.FileMode(0o755)
 
 	uid := os.Getuid()
@@ -215,12 +241,9 @@ func OverlayCreate(size int, imgPath string, overlaySparse bool, isFakeroot bool
 		perm = 0o777
 	}
 
-	upperDir := filepath.Join(tmpDir, "upper")
-	workDir := filepath.Join(tmpDir, "work")
-
-	oldumask := unix.Umask(0)
-	defer unix.Umask(oldumask)
-
+	// The layout is created by a child in a root-mapped user namespace with
+	// --fakeroot, before any file is created, so that upper and work are
+	// owned by root in the overlay.
 	if uid != 0 {
 		if !fakeroot.IsUIDMapped(uint32(uid)) {
 			// Using --fakeroot here for use with --fakeroot
@@ -257,6 +280,51 @@ func OverlayCreate(size int, imgPath string, overlaySparse bool, isFakeroot bool
 		}
 	}
 
+	// the temporary file is next to the image, on the same filesystem
+	tmpFile := imgPath + ".ext3"
+	defer func() {
+		_ = os.Remove(tmpFile)
+	}()
+
+	errBuf := new(bytes.Buffer)
+
+	if overlaySparse {
+		f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("while creating overlay image %s: %s", tmpFile, err)
+		}
+		err = f.Truncate(int64(size) * 1024 * 1024)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("while truncating overlay image %s: %s", tmpFile, err)
+		}
+	} else {
+		cmd = exec.Command(dd, "if=/dev/zero", "of="+tmpFile, "bs=1M", fmt.Sprintf("count=%d", size))
+		cmd.Stderr = errBuf
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("while zero'ing overlay image %s: %s\nCommand error: %s", tmpFile, err, errBuf)
+		}
+		errBuf.Reset()
+	}
+
+	if err := os.Chmod(tmpFile, 0o600); err != nil {
+		return fmt.Errorf("while setting 0600 permission on %s: %s", tmpFile, err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "overlay-")
+	if err != nil {
+		return fmt.Errorf("while creating temporary overlay directory: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	upperDir := filepath.Join(tmpDir, "upper")
+	workDir := filepath.Join(tmpDir, "work")
+
+	oldumask := unix.Umask(0)
+	defer unix.Umask(oldumask)
+
 	if err := os.Mkdir(upperDir, perm); err != nil {
 		return fmt.Errorf("while creating %s: %s", upperDir, err)
 	}
@@ -282,9 +350,17 @@ func OverlayCreate(size int, imgPath string, overlaySparse bool, isFakeroot bool
 	errBuf.Reset()
 
 	if sifImage {
-		if err := addOverlayToImage(imgPath, tmpFile); err != nil {
+		offset, err := addOverlayToImage(imgPath, tmpFile)
+		if err != nil {
 			return fmt.Errorf("while adding ext3 overlay partition to %s: %w", imgPath, err)
 		}
+		// the data of the overlay is copied in the image, its unused
+		// blocks are deallocated again
+		if overlaySparse {
+			if err := punchHoles(imgPath, offset, tmpFile); err != nil {
+				sylog.Warningf("Could not keep the overlay partition of %s sparse: %s", imgPath, err)
+			}
+		}
 	} else {
 		if err := os.Rename(tmpFile, imgPath); err != nil {
 			return fmt.Errorf("while renaming %s to %s: %s", tmpFile, imgPath, err)
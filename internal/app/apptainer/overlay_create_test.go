@@ -0,0 +1,116 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// createTestSIF creates a SIF image with a dummy root filesystem partition,
+// holding capacity descriptors.
+func createTestSIF(t *testing.T, capacity int64) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "image.sif")
+	di, err := sif.NewDescriptorInput(sif.DataPartition, bytes.NewReader([]byte("rootfs")),
+		sif.OptPartitionMetadata(sif.FsSquash, sif.PartPrimSys, "amd64"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := sif.CreateContainerAtPath(path,
+		sif.OptCreateWithDescriptorCapacity(capacity),
+		sif.OptCreateWithDescriptors(di),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// allocatedBlocks returns the number of 512 bytes blocks allocated for the
+// file at path.
+func allocatedBlocks(t *testing.T, path string) int64 {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Sys().(*syscall.Stat_t).Blocks
+}
+
+func TestAddOverlayToImage(t *testing.T) {
+	const size = 16 << 20
+
+	// a sparse overlay with data at its start and end
+	overlay := filepath.Join(t.TempDir(), "overlay.ext3")
+	f, err := os.Create(overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("start"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("end"), size-3); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	t.Run("Sparse", func(t *testing.T) {
+		img := createTestSIF(t, 4)
+		offset, err := addOverlayToImage(img, overlay)
+		if err != nil {
+			t.Fatalf("addOverlayToImage() error = %v", err)
+		}
+		if err := punchHoles(img, offset, overlay); err != nil {
+			t.Skipf("punching holes not supported: %v", err)
+		}
+		if blocks := allocatedBlocks(t, img); blocks*512 >= size {
+			t.Errorf("%d blocks allocated for the image, the overlay is not sparse", blocks)
+		}
+
+		fimg, err := sif.LoadContainerFromPath(img, sif.OptLoadWithFlag(os.O_RDONLY))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer()
+		d, err := fimg.GetDescriptor(sif.WithPartitionType(sif.PartOverlay))
+		if err != nil {
+			t.Fatalf("overlay partition not found: %v", err)
+		}
+		if d.Offset() != offset || d.Size() != size {
+			t.Errorf("overlay partition at %d of size %d, want %d of size %d", d.Offset(), d.Size(), offset, size)
+		}
+		data, err := d.GetData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, []byte("start")) || !bytes.HasSuffix(data, []byte("end")) {
+			t.Errorf("overlay partition data corrupted")
+		}
+	})
+
+	t.Run("NoFreeDescriptor", func(t *testing.T) {
+		img := createTestSIF(t, 1)
+		if _, err := addOverlayToImage(img, overlay); err == nil {
+			t.Errorf("addOverlayToImage() succeeded without free descriptor")
+		}
+	})
+}
@@ -14,15 +14,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	iofs "io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
 	"strings"
 
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/sif/v2/pkg/sif"
@@ -41,6 +44,9 @@ type buildToolchain struct {
 	goPath    string
 	buildTags string
 	envs      []string
+	// goWork is the go.work file used to build plugins with their
+	// own module along with the plugin SDK matching apptainer.
+	goWork string
 }
 
 // getApptainerSrcDir returns the source directory for apptainer.
@@ -113,27 +119,26 @@ func pluginManifestPath(sourceDir string) string {
 	return filepath.Join(sourceDir, "plugin.manifest")
 }
 
+// pluginCompatPath returns the path of the compatibility manifest file
+// created after the plugin object is built.
+func pluginCompatPath(sourceDir string) string {
+	return filepath.Join(sourceDir, "plugin.compat")
+}
+
 // CompilePlugin compiles a plugin. It takes as input: sourceDir, the path to the
 // plugin's source code directory; and destSif, the path to the intended final
 // location of the plugin SIF file.
+//
+// A plugin with its own go.mod is compiled against the plugin SDK matching
+// apptainer, which is either installed under LIBEXECDIR, found in the
+// apptainer source tree, or fetched from the Go module proxy. Other
+// plugins must reside inside the apptainer source tree.
 func CompilePlugin(sourceDir, destSif, buildTags string) error {
-	apptainerSrc, err := getApptainerSrcDir()
-	if err != nil {
-		return fmt.Errorf("apptainer source directory not usable: %w", err)
-	}
-	apptainerSrc, err = filepath.Abs(apptainerSrc)
-	if err != nil {
-		return fmt.Errorf("while getting absolute path of %q: %w", apptainerSrc, err)
-	}
-	sylog.Debugf("Using apptainer source: %s", apptainerSrc)
 	pluginSrc, err := filepath.Abs(sourceDir)
 	if err != nil {
 		return fmt.Errorf("while getting absolute path of %q: %w", pluginSrc, err)
 	}
 	sylog.Debugf("Using plugin source: %s", pluginSrc)
-	if !strings.HasPrefix(pluginSrc, apptainerSrc+string(os.PathSeparator)) {
-		return fmt.Errorf("plugin source %q must be inside apptainer source %q", pluginSrc, apptainerSrc)
-	}
 
 	goPath, err := bin.FindBin("go")
 	if err != nil {
@@ -148,11 +153,38 @@ func CompilePlugin(sourceDir, destSif, buildTags string) error {
 
 	bTool := buildToolchain{
 		buildTags: buildTags,
-		workPath:  apptainerSrc,
 		goPath:    goPath,
 		envs:      append(os.Environ(), "GO111MODULE=on"),
 	}
 
+	if _, err := os.Stat(filepath.Join(pluginSrc, "go.mod")); err == nil {
+		tmpDir, err := os.MkdirTemp("", "plugin-mod-")
+		if err != nil {
+			return fmt.Errorf("while creating temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		bTool.workPath = pluginSrc
+		bTool.goWork, err = sdkWorkspace(pluginSrc, tmpDir, bTool)
+		if err != nil {
+			return fmt.Errorf("while setting up plugin SDK: %w", err)
+		}
+	} else {
+		apptainerSrc, err := getApptainerSrcDir()
+		if err != nil {
+			return fmt.Errorf("apptainer source directory not usable, and plugin has no go.mod: %w", err)
+		}
+		apptainerSrc, err = filepath.Abs(apptainerSrc)
+		if err != nil {
+			return fmt.Errorf("while getting absolute path of %q: %w", apptainerSrc, err)
+		}
+		sylog.Debugf("Using apptainer source: %s", apptainerSrc)
+		if !strings.HasPrefix(pluginSrc, apptainerSrc+string(os.PathSeparator)) {
+			return fmt.Errorf("plugin source %q without go.mod must be inside apptainer source %q", pluginSrc, apptainerSrc)
+		}
+		bTool.workPath = apptainerSrc
+	}
+
 	// build plugin object using go build
 	soPath, err := buildPlugin(pluginSrc, bTool)
 	if err != nil {
@@ -160,6 +192,14 @@ func CompilePlugin(sourceDir, destSif, buildTags string) error {
 	}
 	defer os.Remove(soPath)
 
+	// check the plugin object can be loaded by apptainer and
+	// record its compatibility manifest
+	cPath, err := generateCompat(pluginSrc)
+	if err != nil {
+		return fmt.Errorf("while generating plugin compatibility manifest: %s", err)
+	}
+	defer os.Remove(cPath)
+
 	// generate plugin manifest from .so
 	mPath, err := generateManifest(pluginSrc, bTool)
 	if err != nil {
@@ -177,6 +217,148 @@ func CompilePlugin(sourceDir, destSif, buildTags string) error {
 	return nil
 }
 
+// localSDKDir returns the directory of a copy of the plugin SDK matching
+// apptainer, installed under LIBEXECDIR or the apptainer source tree, or
+// an empty string if there is none.
+func localSDKDir() string {
+	if _, err := os.Stat(filepath.Join(plugin.SDKDir(), canaryFile)); err == nil {
+		return plugin.SDKDir()
+	}
+	if dir, err := getApptainerSrcDir(); err == nil {
+		return dir
+	}
+	return ""
+}
+
+// fetchSDK downloads the plugin SDK version from the Go module proxy, and
+// copies it to dir along with the build configuration of apptainer.
+func fetchSDK(version, dir string, bTool buildToolchain) error {
+	var out bytes.Buffer
+
+	cmd := exec.Command(bTool.goPath, "mod", "download", "-json", plugin.SDKModule+"@"+version)
+	cmd.Dir = dir
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(bTool.envs, "GOWORK=off", "GOFLAGS=")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("while downloading %s@%s: %w", plugin.SDKModule, version, err)
+	}
+
+	var mod struct {
+		Dir string
+	}
+	if err := json.Unmarshal(out.Bytes(), &mod); err != nil {
+		return fmt.Errorf("while decoding module information: %w", err)
+	}
+
+	// the downloaded module is read-only, and lacks the generated
+	// build configuration
+	err := filepath.WalkDir(mod.Dir, func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(mod.Dir, path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(filepath.Join(dir, rel), 0o755)
+		case d.Type().IsRegular():
+			return fs.CopyFile(path, filepath.Join(dir, rel), 0o644)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("while copying plugin SDK: %w", err)
+	}
+	config := filepath.Join(dir, "internal", "pkg", "buildcfg", "config.go")
+	return os.WriteFile(config, buildcfg.ConfigSource, 0o644)
+}
+
+// sdkWorkspace creates in tmpDir a Go workspace with the plugin module
+// in pluginSrc and the plugin SDK matching apptainer, with the modules
+// versions apptainer was compiled with, and returns the go.work path.
+// Using the SDK as a workspace module ensures its packages are compiled
+// exactly like those of apptainer.
+func sdkWorkspace(pluginSrc, tmpDir string, bTool buildToolchain) (string, error) {
+	goWork := filepath.Join(tmpDir, "go.work")
+
+	sdkDir := localSDKDir()
+	if sdkDir != "" {
+		sylog.Infof("Using plugin SDK in %s", sdkDir)
+	} else if version := plugin.SDKVersion(); version != "" {
+		sylog.Infof("Fetching plugin SDK %s@%s", plugin.SDKModule, version)
+		sdkDir = filepath.Join(tmpDir, "sdk")
+		if err := fetchSDK(version, sdkDir, bTool); err != nil {
+			return "", err
+		}
+	} else {
+		return "", fmt.Errorf("no plugin SDK installed in %s and apptainer %s is not a release", plugin.SDKDir(), buildcfg.PACKAGE_VERSION)
+	}
+
+	// pin the modules shared with apptainer to the same versions
+	args := []string{"work", "edit"}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range bi.Deps {
+			if dep.Path == plugin.SDKModule {
+				continue
+			}
+			m := dep
+			if dep.Replace != nil {
+				m = dep.Replace
+			}
+			if m.Version != "" {
+				args = append(args, "-replace="+dep.Path+"="+m.Path+"@"+m.Version)
+			}
+		}
+	}
+
+	for _, cmdArgs := range [][]string{{"work", "init", sdkDir, pluginSrc}, args} {
+		sylog.Debugf("Running: %s %s", bTool.goPath, strings.Join(cmdArgs, " "))
+
+		cmd := exec.Command(bTool.goPath, cmdArgs...)
+		cmd.Dir = tmpDir
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(bTool.envs, "GOWORK="+goWork, "GOFLAGS=")
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("while creating workspace %s: %w", goWork, err)
+		}
+	}
+
+	return goWork, nil
+}
+
+// generateCompat records the compatibility manifest of the plugin object
+// built from the plugin source, returning an error describing why apptainer
+// couldn't load it if it's not compatible.
+func generateCompat(sourceDir string) (string, error) {
+	in := pluginObjPath(sourceDir)
+	out := pluginCompatPath(sourceDir)
+
+	compat, err := plugin.ReadCompatibility(in)
+	if err != nil {
+		return "", err
+	}
+	host, err := plugin.HostCompatibility()
+	if err != nil {
+		return "", err
+	}
+	if err := compat.Check(host); err != nil {
+		return "", fmt.Errorf("plugin not compatible with this apptainer: %s", err)
+	}
+
+	data, err := json.Marshal(compat)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(out, data, 0o644); err != nil {
+		return "", fmt.Errorf("while writing compatibility manifest %s: %s", out, err)
+	}
+
+	return out, nil
+}
+
 // buildPlugin takes sourceDir which is the string path the host which
 // contains the source code of the plugin. buildPlugin returns the path
 // to the built file, along with an error.
@@ -193,13 +375,24 @@ func buildPlugin(sourceDir string, bTool buildToolchain) (string, error) {
 		"build",
 		"-a",
 		"-o", out,
-		"-mod=readonly",
+	}
+	envs := bTool.envs
+	if bTool.goWork != "" {
+		envs = append(envs, "GOWORK="+bTool.goWork, "GOFLAGS=")
+	} else {
+		args = append(args, "-mod=readonly")
+	}
+	// the plugin must be built with the same -trimpath setting
+	// as apptainer to be loaded
+	if host, err := plugin.HostCompatibility(); err != nil || host.Settings["-trimpath"] == "true" {
+		args = append(args, "-trimpath")
+	}
+	args = append(args,
 		"-ldflags", pluginRootDirVar,
-		"-trimpath",
 		"-buildmode=plugin",
 		"-tags", bTool.buildTags,
 		sourceDir,
-	}
+	)
 
 	sylog.Debugf("Running: %s %s", bTool.goPath, strings.Join(args, " "))
 
@@ -209,7 +402,7 @@ func buildPlugin(sourceDir string, bTool buildToolchain) (string, error) {
 	buildcmd.Stderr = os.Stderr
 	buildcmd.Stdout = os.Stdout
 	buildcmd.Stdin = os.Stdin
-	buildcmd.Env = bTool.envs
+	buildcmd.Env = envs
 
 	return out, buildcmd.Run()
 }
@@ -274,10 +467,26 @@ func makeSIF(sourceDir, sifPath string) error {
 		return err
 	}
 
+	// create plugin compatibility manifest descriptor
+	compatPath := pluginCompatPath(sourceDir)
+
+	fp, err = os.Open(compatPath)
+	if err != nil {
+		return fmt.Errorf("while opening plugin compatibility manifest file %v: %w", compatPath, err)
+	}
+	defer fp.Close()
+
+	plCompatInput, err := sif.NewDescriptorInput(sif.DataGenericJSON, fp,
+		sif.OptObjectName("plugin.compat"),
+	)
+	if err != nil {
+		return err
+	}
+
 	os.RemoveAll(sifPath)
 
 	f, err := sif.CreateContainerAtPath(sifPath,
-		sif.OptCreateWithDescriptors(plObjInput, plManifestInput),
+		sif.OptCreateWithDescriptors(plObjInput, plManifestInput, plCompatInput),
 	)
 	if err != nil {
 		return fmt.Errorf("while creating sif file: %w", err)
@@ -0,0 +1,71 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/apptainer/apptainer/internal/pkg/plugin"
+	"github.com/apptainer/apptainer/pkg/syfs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// PluginConfigureOptions holds the changes and checks requested on the
+// configuration of a plugin.
+type PluginConfigureOptions struct {
+	// Set holds the key=value settings to set.
+	Set []string
+	// Unset holds the keys to remove.
+	Unset []string
+	// Validate only checks the configuration.
+	Validate bool
+	// User edits the user configuration file instead of the
+	// system one.
+	User bool
+}
+
+// ConfigurePlugin edits, validates or prints the configuration of the
+// installed plugin named "name". Without any change or validation
+// requested, the configuration merged from the system and user
+// configuration files is printed.
+func ConfigurePlugin(name string, opts PluginConfigureOptions) error {
+	userDir := syfs.PluginConf()
+
+	if len(opts.Set) > 0 || len(opts.Unset) > 0 {
+		editDir := ""
+		if opts.User {
+			editDir = userDir
+		}
+		if err := plugin.Configure(name, editDir, opts.Set, opts.Unset); err != nil {
+			return err
+		}
+		sylog.Infof("Configuration of plugin %q updated in %s", name, plugin.ConfigPath(name, editDir))
+		return nil
+	}
+
+	if opts.Validate {
+		if err := plugin.ValidateConfig(name, userDir); err != nil {
+			return err
+		}
+		sylog.Infof("Configuration of plugin %q is valid", name)
+		return nil
+	}
+
+	data, err := plugin.ShowConfig(name, userDir)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		fmt.Printf("Plugin %q is not configured.\n", name)
+		return nil
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -9,9 +9,17 @@
 
 package apptainer
 
-import "github.com/apptainer/apptainer/internal/pkg/plugin"
+import (
+	"github.com/apptainer/apptainer/internal/pkg/plugin"
+	"github.com/apptainer/apptainer/pkg/syfs"
+)
 
 // DisablePlugin disables the named plugin.
 func DisablePlugin(name, libexecdir string) error {
 	return plugin.Disable(name)
 }
+
+// DisableUserPlugin disables the named plugin for the current user only.
+func DisableUserPlugin(name string) error {
+	return plugin.DisableUser(name, syfs.PluginState())
+}
@@ -9,9 +9,17 @@
 
 package apptainer
 
-import "github.com/apptainer/apptainer/internal/pkg/plugin"
+import (
+	"github.com/apptainer/apptainer/internal/pkg/plugin"
+	"github.com/apptainer/apptainer/pkg/syfs"
+)
 
 // EnablePlugin enables the named plugin.
 func EnablePlugin(name string) error {
 	return plugin.Enable(name)
 }
+
+// EnableUserPlugin enables the named plugin for the current user only.
+func EnableUserPlugin(name string) error {
+	return plugin.EnableUser(name, syfs.PluginState())
+}
@@ -10,37 +10,60 @@
 package apptainer
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"sort"
 
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 )
 
 // ListPlugins lists the apptainer plugins installed in the plugin
-// plugin installation directory.
-func ListPlugins() error {
+// plugin installation directory, as a JSON array if jsonOutput is set.
+func ListPlugins(jsonOutput bool) error {
 	plugins, err := plugin.List()
 	if err != nil {
 		return err
 	}
 
-	if len(plugins) == 0 {
-		fmt.Println("There are no plugins installed.")
-		return nil
-	}
-
 	sort.Slice(plugins, func(i, j int) bool {
 		return plugins[i].Name < plugins[j].Name
 	})
 
-	fmt.Printf("ENABLED  NAME\n")
-
+	infos := make([]plugin.Info, 0, len(plugins))
 	for _, p := range plugins {
+		infos = append(infos, p.Info())
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	}
+
+	if len(infos) == 0 {
+		fmt.Println("There are no plugins installed.")
+		return nil
+	}
+
+	fmt.Printf("ENABLED  STATUS        NAME\n")
+
+	for _, info := range infos {
 		enabled := "no"
-		if p.Enabled {
+		if info.Enabled {
 			enabled = "yes"
 		}
-		fmt.Printf("%7s  %s\n", enabled, p.Name)
+		status := "ok"
+		if !info.Compatible {
+			status = "incompatible"
+		} else if info.Error != "" {
+			status = "error"
+		}
+		name := info.Name
+		if info.User {
+			name += " (user)"
+		}
+		fmt.Printf("%7s  %-12s  %s\n", enabled, status, name)
 	}
 
 	return nil
@@ -21,8 +21,9 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 )
 
-// RemoteAdd adds remote to configuration
-func RemoteAdd(configFile, name, uri string, global bool, insecure bool, makeDefault bool) (err error) {
+// RemoteAdd adds remote to configuration, with the TLS files used by the
+// clients of its services if any.
+func RemoteAdd(configFile, name, uri string, global bool, insecure bool, makeDefault bool, tlsFiles endpoint.TLSFiles) (err error) {
 	// Explicit handling of corner cases: name and uri must be valid strings
 	if strings.TrimSpace(name) == "" {
 		return fmt.Errorf("invalid name: cannot have empty name")
@@ -56,6 +57,14 @@ func RemoteAdd(configFile, name, uri string, global bool, insecure bool, makeDef
 	}
 	e := endpoint.Config{URI: path.Join(u.Host + u.Path), System: global, Insecure: insecure}
 
+	// check the TLS files now rather than at the first use of the remote
+	if e.TLSFiles, err = tlsFiles.Abs(); err != nil {
+		return err
+	}
+	if _, err := e.TLSConfig(); err != nil {
+		return fmt.Errorf("invalid TLS configuration: %v", err)
+	}
+
 	if err := c.Add(name, &e); err != nil {
 		return err
 	}
@@ -0,0 +1,135 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/apptainer/apptainer/internal/pkg/remote"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// RemoteExport writes the remotes and keyservers of the configuration to
+// exportFile, or to the standard output if exportFile is "-". The
+// authentication tokens and credentials are only written if includeTokens
+// is true.
+func RemoteExport(configFile, exportFile string, includeTokens bool) error {
+	f, err := os.OpenFile(configFile, os.O_RDONLY, 0o600)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("while opening remote config file: %s", err)
+	}
+
+	c := &remote.Config{}
+	if err == nil {
+		c, err = remote.ReadFrom(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("while parsing remote config data: %s", err)
+		}
+	}
+	exp := c.Export(includeTokens)
+
+	if exportFile == "-" {
+		_, err := exp.WriteTo(os.Stdout)
+		return err
+	}
+
+	// the tokens are only readable by the user
+	perm := os.FileMode(0o644)
+	if includeTokens {
+		perm = os.FileMode(0o600)
+	}
+	out, err := os.OpenFile(exportFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("while creating export file: %s", err)
+	}
+	defer out.Close()
+
+	if _, err := exp.WriteTo(out); err != nil {
+		return fmt.Errorf("while writing remote config to file: %s", err)
+	}
+	return out.Sync()
+}
+
+// RemoteImport imports the remotes and keyservers of importFile into the
+// configuration, merged with the existing ones, or replacing them with
+// replace. The entries not imported are reported individually, and an
+// error is returned once the other entries are written.
+func RemoteImport(configFile, importFile string, global, replace bool) error {
+	in, err := os.Open(importFile)
+	if err != nil {
+		return fmt.Errorf("while opening import file: %s", err)
+	}
+	imp, err := remote.ReadFrom(in)
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("while parsing import file %s: %s", importFile, err)
+	}
+
+	// system config should be world readable
+	perm := os.FileMode(0o600)
+	if global {
+		perm = os.FileMode(0o644)
+	}
+
+	file, err := os.OpenFile(configFile, os.O_RDWR|os.O_CREATE, perm)
+	if err != nil {
+		return fmt.Errorf("while opening remote config file: %s", err)
+	}
+	defer file.Close()
+
+	c, err := remote.ReadFrom(file)
+	if err != nil {
+		return fmt.Errorf("while parsing remote config data: %s", err)
+	}
+
+	// report the conflicts with the remotes of the system configuration
+	if !global {
+		if err := syncSysConfig(c); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, r := range c.Import(imp, replace) {
+		switch {
+		case r.Err != nil:
+			failed++
+			sylog.Warningf("Not importing %s: %v", r.Name, r.Err)
+		case r.Unchanged:
+			sylog.Infof("%s unchanged", r.Name)
+		default:
+			sylog.Infof("Imported %s", r.Name)
+		}
+	}
+
+	// truncating file before writing new contents and syncing to commit file
+	if err := file.Truncate(0); err != nil {
+		return fmt.Errorf("while truncating remote config file: %s", err)
+	}
+
+	if n, err := file.Seek(0, io.SeekStart); err != nil || n != 0 {
+		return fmt.Errorf("failed to reset %s cursor: %s", file.Name(), err)
+	}
+
+	if _, err := c.WriteTo(file); err != nil {
+		return fmt.Errorf("while writing remote config to file: %s", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to flush remote config file %s: %s", file.Name(), err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d entries of %s not imported", failed, importFile)
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ import (
 	"text/tabwriter"
 
 	"github.com/apptainer/apptainer/internal/pkg/remote"
+	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 )
 
 const listLine = "%s\t%s\t%s\t%s\t%s\t%s\n"
@@ -90,3 +91,64 @@ func RemoteList(usrConfigFile string) (err error) {
 
 	return nil
 }
+
+// remoteConfigNoCreate returns the remote configuration of the user merged
+// with the one of the system, without creating the configuration file of
+// the user if missing.
+func remoteConfigNoCreate(usrConfigFile string) (*remote.Config, error) {
+	c := &remote.Config{
+		Remotes: make(map[string]*endpoint.Config),
+	}
+
+	file, err := os.Open(usrConfigFile)
+	if err == nil {
+		defer file.Close()
+		c, err = remote.ReadFrom(file)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing remote config data: %s", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("while opening remote config file: %s", err)
+	}
+
+	if err := syncSysConfig(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RemoteNames returns the sorted names of the remote endpoints, used for
+// shell completion.
+func RemoteNames(usrConfigFile string) ([]string, error) {
+	c, err := remoteConfigNoCreate(usrConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(c.Remotes))
+	for n := range c.Remotes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// KeyserverURIs returns the sorted URIs of the keyservers configured in the
+// remote endpoints, used for shell completion.
+func KeyserverURIs(usrConfigFile string) ([]string, error) {
+	c, err := remoteConfigNoCreate(usrConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	uris := make([]string, 0)
+	for _, ep := range c.Remotes {
+		for _, kc := range ep.Keyservers {
+			if kc.URI != "" && !seen[kc.URI] {
+				seen[kc.URI] = true
+				uris = append(uris, kc.URI)
+			}
+		}
+	}
+	sort.Strings(uris)
+	return uris, nil
+}
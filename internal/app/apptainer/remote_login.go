@@ -29,6 +29,12 @@ type LoginArgs struct {
 	Password  string
 	Tokenfile string
 	Insecure  bool
+
+	// OIDC login with the device authorization flow
+	OIDC           bool
+	OIDCIssuer     string
+	OIDCClientID   string
+	OIDCPassphrase bool
 }
 
 // ErrLoginAborted is raised when the login process has been aborted by the user
@@ -64,7 +70,11 @@ func RemoteLogin(usrConfigFile string, args *LoginArgs) (err error) {
 
 	if r != nil {
 		// endpoints (sylabs cloud, Singularity enterprise etc.)
-		err := endPointLogin(r, args)
+		login := endPointLogin
+		if args.OIDC {
+			login = endPointOIDCLogin
+		}
+		err := login(r, args)
 		if err == ErrLoginAborted {
 			return nil
 		}
@@ -76,6 +86,9 @@ func RemoteLogin(usrConfigFile string, args *LoginArgs) (err error) {
 		if args.Tokenfile != "" {
 			return fmt.Errorf("--tokenfile is only supported for login to a remote endpoint, not OCI (docker/oras) or keyservers")
 		}
+		if args.OIDC {
+			return fmt.Errorf("--oidc is only supported for login to a remote endpoint, not OCI (docker/oras) or keyservers")
+		}
 		sylog.Warningf("'remote login' is deprecated for registries or keyservers and will be removed in a future release; running 'registry login'")
 		return RegistryLogin(usrConfigFile, args)
 	}
@@ -151,5 +164,9 @@ func endPointLogin(ep *endpoint.Config, args *LoginArgs) error {
 	}
 	// Token is verified, update the endpoint config with it
 	ep.Token = token
+	// and forget a previous OIDC login
+	if ep.OIDC != nil {
+		ep.OIDC = &endpoint.OIDCConfig{Issuer: ep.OIDC.Issuer, ClientID: ep.OIDC.ClientID}
+	}
 	return nil
 }
@@ -49,6 +49,9 @@ func RemoteLogout(usrConfigFile, name string) (err error) {
 	if r != nil {
 		// endpoint
 		r.Token = ""
+		if r.OIDC != nil {
+			r.OIDC = &endpoint.OIDCConfig{Issuer: r.OIDC.Issuer, ClientID: r.OIDC.ClientID}
+		}
 	} else {
 		// services
 		sylog.Warningf("'remote logout' is deprecated for registries or keyservers and will be removed in a future release; running 'registry logout'")
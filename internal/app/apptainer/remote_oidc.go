@@ -0,0 +1,124 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/apptainer/apptainer/internal/pkg/remote"
+	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
+	"github.com/apptainer/apptainer/internal/pkg/util/interactive"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// oidcPassphraseEnv is the environment variable holding the passphrase
+// protecting the OIDC refresh tokens, for non interactive use.
+const oidcPassphraseEnv = "APPTAINER_OIDC_PASSPHRASE"
+
+// oidcPassphrase returns the passphrase protecting the OIDC refresh
+// tokens, from the environment or asked to the user.
+func oidcPassphrase() (string, error) {
+	if p, ok := os.LookupEnv(oidcPassphraseEnv); ok {
+		return p, nil
+	}
+	return interactive.AskQuestionNoEcho("Passphrase protecting the OIDC refresh token: ")
+}
+
+// endPointOIDCLogin logs in to a remote endpoint with the OIDC device
+// authorization flow.
+func endPointOIDCLogin(ep *endpoint.Config, args *LoginArgs) error {
+	issuer, clientID := args.OIDCIssuer, args.OIDCClientID
+	if ep.OIDC != nil {
+		if issuer == "" {
+			issuer = ep.OIDC.Issuer
+		}
+		if clientID == "" {
+			clientID = ep.OIDC.ClientID
+		}
+	}
+	if issuer == "" {
+		return fmt.Errorf("no OIDC issuer configured for this remote, set it with --oidc-issuer")
+	}
+
+	secret := &endpoint.OIDCSecret{
+		UsePassphrase: args.OIDCPassphrase,
+		Passphrase: func() (string, error) {
+			if p, ok := os.LookupEnv(oidcPassphraseEnv); ok {
+				return p, nil
+			}
+			return interactive.GetPassphrase("Enter a passphrase to protect the OIDC refresh token: ", 3)
+		},
+	}
+	prompt := func(da endpoint.DeviceAuthorization) {
+		if da.VerificationURIComplete != "" {
+			fmt.Printf("Open %s to login, and check the code %s is shown.\n", da.VerificationURIComplete, da.UserCode)
+		} else {
+			fmt.Printf("Open %s to login, and enter the code %s.\n", da.VerificationURI, da.UserCode)
+		}
+		fmt.Println("Waiting for the login to complete...")
+	}
+	return ep.OIDCDeviceLogin(context.Background(), issuer, clientID, secret, prompt)
+}
+
+// RefreshRemoteOIDCToken refreshes the access token of the name remote
+// endpoint logged in with OIDC, if it expires soon, and stores the new
+// tokens in the user configuration file. It returns the access token. An
+// error wrapping endpoint.ErrOIDCLoginRequired is returned if the user has
+// to login again.
+func RefreshRemoteOIDCToken(usrConfigFile, name string) (string, error) {
+	file, err := os.OpenFile(usrConfigFile, os.O_RDWR, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("while opening remote config file: %s", err)
+	}
+	defer file.Close()
+
+	// don't refresh concurrently, the refresh tokens may be single use
+	if err := unix.Flock(int(file.Fd()), unix.LOCK_EX); err != nil {
+		return "", fmt.Errorf("while locking remote config file: %s", err)
+	}
+
+	c, err := remote.ReadFrom(file)
+	if err != nil {
+		return "", fmt.Errorf("while parsing remote config data: %s", err)
+	}
+	ep, err := c.GetRemote(name)
+	if err != nil {
+		return "", err
+	}
+
+	refreshed, err := ep.RefreshOIDCToken(context.Background(), &endpoint.OIDCSecret{Passphrase: oidcPassphrase})
+	if errors.Is(err, endpoint.ErrOIDCLoginRequired) {
+		return "", fmt.Errorf("%w for remote %s, please re-login with 'apptainer remote login --oidc %s'", err, name, name)
+	} else if err != nil {
+		return "", err
+	} else if !refreshed {
+		return ep.Token, nil
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return "", fmt.Errorf("while truncating remote config file: %s", err)
+	}
+	if n, err := file.Seek(0, io.SeekStart); err != nil || n != 0 {
+		return "", fmt.Errorf("failed to reset %s cursor: %s", file.Name(), err)
+	}
+	if _, err := c.WriteTo(file); err != nil {
+		return "", fmt.Errorf("while writing remote config to file: %s", err)
+	}
+	if err := file.Sync(); err != nil {
+		return "", fmt.Errorf("failed to flush remote config file %s: %s", file.Name(), err)
+	}
+
+	sylog.Debugf("Refreshed access token of remote %s", name)
+	return ep.Token, nil
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	"github.com/apptainer/apptainer/internal/pkg/test"
 )
 
@@ -58,10 +59,10 @@ func TestRemoteRemove(t *testing.T) {
 	}
 
 	// Add remotes based on our config file
-	if err := RemoteAdd(validCfgFile, "cloud_testing", "cloud.random.io", false, false, true); err != nil {
+	if err := RemoteAdd(validCfgFile, "cloud_testing", "cloud.random.io", false, false, true, endpoint.TLSFiles{}); err != nil {
 		t.Fatalf("cannot add remote \"cloud\" for testing: %s\n", err)
 	}
-	if err := RemoteAdd(validCfgFile, "cloud_testing2", "cloud2.random.io", false, false, false); err != nil {
+	if err := RemoteAdd(validCfgFile, "cloud_testing2", "cloud2.random.io", false, false, false, endpoint.TLSFiles{}); err != nil {
 		t.Fatalf("cannot add remote \"cloud\" for testing: %s\n", err)
 	}
 
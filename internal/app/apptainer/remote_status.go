@@ -11,33 +11,58 @@
 package apptainer
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
-	"sort"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/client/library"
 	"github.com/apptainer/apptainer/internal/pkg/remote"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	"github.com/apptainer/apptainer/pkg/sylog"
-	containerclient "github.com/apptainer/container-library-client/client"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
 
-const statusLine = "%s\t%s\t%s\t%s\n"
+const statusLine = "%s\t%s\t%s\t%s\t%s\n"
 
-type status struct {
-	name    string
-	uri     string
-	status  string
-	version string
+// The states of the authentication token of a remote endpoint.
+const (
+	tokenNone    = "none"
+	tokenValid   = "valid"
+	tokenInvalid = "invalid"
+)
+
+// remoteIdentity is the identity of the user logged in to an endpoint.
+type remoteIdentity struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// remoteStatusReport is the status of a remote endpoint, printed as JSON
+// by RemoteStatus.
+type remoteStatusReport struct {
+	Remote   string                  `json:"remote"`
+	URI      string                  `json:"uri"`
+	Services []endpoint.ServiceProbe `json:"services"`
+	// RequiredDown lists the required services which aren't reachable.
+	RequiredDown []string        `json:"requiredDown"`
+	Identity     *remoteIdentity `json:"identity,omitempty"`
+	// Token is the state of the authentication token: none, valid or
+	// invalid.
+	Token string `json:"token"`
 }
 
 // RemoteStatus checks status of services related to an endpoint
 // If the supplied remote name is an empty string, it will attempt
-// to use the default remote.
-func RemoteStatus(usrConfigFile, name string) (err error) {
+// to use the default remote. The services are probed concurrently, and an
+// error is returned if one of the required services, or of all the
+// services if required is empty, isn't reachable. The status is printed as
+// JSON if jsonOutput is true.
+func RemoteStatus(usrConfigFile, name string, required []string, jsonOutput bool) (err error) {
 	if name != "" {
 		sylog.Infof("Checking status of remote: %s", name)
 	} else {
@@ -66,6 +91,7 @@ func RemoteStatus(usrConfigFile, name string) (err error) {
 
 	var e *endpoint.Config
 	if name == "" {
+		name = c.DefaultRemote
 		e, err = c.GetDefault()
 	} else {
 		e, err = c.GetRemote(name)
@@ -75,90 +101,126 @@ func RemoteStatus(usrConfigFile, name string) (err error) {
 		return err
 	}
 
-	sps, err := e.GetAllServices()
+	probes, err := e.ProbeServices(context.Background(), required)
 	if err != nil {
-		return fmt.Errorf("while retrieving services: %s", err)
+		return err
 	}
 
-	ch := make(chan *status)
-	for name, sp := range sps {
-		name := name
-		for _, service := range sp {
-			service := service
-			go func() {
-				ch <- doStatusCheck(name, service)
-			}()
-		}
+	report := &remoteStatusReport{
+		Remote:       name,
+		URI:          e.URI,
+		Services:     probes,
+		RequiredDown: requiredDown(probes, required),
+		Token:        tokenNone,
 	}
 
-	// map storing statuses by name
-	smap := make(map[string]*status)
-	for _, sp := range sps {
-		for range sp {
-			s := <-ch
-			if s == nil {
-				continue
-			}
-			smap[s.name] = s
+	var tokenErr error
+	if e.Token != "" {
+		report.Token = tokenValid
+		if tokenErr = e.VerifyToken(""); tokenErr != nil {
+			report.Token = tokenInvalid
+		} else if libClientConfig, err := e.LibraryClientConfig(""); err != nil {
+			sylog.Debugf("Could not get library client configuration: %v", err)
+		} else if username, email, err := library.GetIdentity(libClientConfig); err == nil && username != "" {
+			report.Identity = &remoteIdentity{Username: username, Email: email}
 		}
 	}
 
-	// list in alphanumeric order
-	names := make([]string, 0, len(smap))
-	for n := range smap {
-		names = append(names, n)
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printRemoteStatus(report)
 	}
-	sort.Strings(names)
 
-	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintf(tw, statusLine, "SERVICE", "STATUS", "VERSION", "URI")
-	for _, n := range names {
-		s := smap[n]
-		fmt.Fprintf(tw, statusLine, cases.Title(language.English).String(s.name), s.status, s.version, s.uri)
+	if tokenErr != nil {
+		return tokenErr
 	}
-	tw.Flush()
-
-	libClientConfigURI := ""
-	libClientConfig, err := e.LibraryClientConfig(libClientConfigURI)
-	if err != nil {
-		return fmt.Errorf("could not get library client configuration: %v", err)
+	if len(report.RequiredDown) > 0 {
+		return fmt.Errorf("required services unreachable: %s", strings.Join(report.RequiredDown, ", "))
 	}
-
-	printLoggedInIdentity(libClientConfig)
-
-	return doTokenCheck(e)
+	return nil
 }
 
-func doStatusCheck(name string, sp endpoint.Service) *status {
-	uri := sp.URI()
-	version, err := sp.Status()
-	if err != nil {
-		if err == endpoint.ErrStatusNotSupported {
-			return nil
+// requiredDown returns the required services, or all the services if
+// required is empty, which aren't reachable.
+func requiredDown(probes []endpoint.ServiceProbe, required []string) []string {
+	down := []string{}
+	for _, p := range probes {
+		if p.Reachable {
+			continue
+		}
+		isRequired := len(required) == 0
+		for _, r := range required {
+			isRequired = isRequired || r == p.Service
+		}
+		if isRequired && (len(down) == 0 || down[len(down)-1] != p.Service) {
+			down = append(down, p.Service)
 		}
-		return &status{name: name, uri: uri, status: "N/A"}
 	}
-	return &status{name: name, uri: uri, status: "OK", version: version}
+	return down
 }
 
-func printLoggedInIdentity(config *containerclient.Config) {
-	username, email, err := library.GetIdentity(config)
+// probeStatus returns the status of a probed service, for the text output.
+func probeStatus(p endpoint.ServiceProbe) string {
+	if p.Reachable {
+		return "OK"
+	}
+	switch p.ErrorKind {
+	case endpoint.ProbeErrorDNS:
+		return "DNS lookup failed"
+	case endpoint.ProbeErrorTimeout:
+		return "timed out"
+	case endpoint.ProbeErrorRefused:
+		return "connection refused"
+	case endpoint.ProbeErrorTLSUntrusted:
+		return "certificate not trusted"
+	case endpoint.ProbeErrorTLSClientCert:
+		return "client certificate rejected"
+	case endpoint.ProbeErrorHTTP:
+		return "server error"
+	case endpoint.ProbeErrorNotProvided:
+		return "not provided"
+	}
+	return "unreachable"
+}
 
-	if err == nil && len(username) > 0 {
-		fmt.Printf("\nLogged in as: %s <%s>\n\n", username, email)
+// certificateStatus returns the status of the certificate of a probed
+// service, for the text output.
+func certificateStatus(p endpoint.ServiceProbe) string {
+	if p.TLS == nil {
+		return "-"
 	}
+	expiry := p.TLS.NotAfter.Format("2006-01-02")
+	if time.Now().After(p.TLS.NotAfter) {
+		return "expired " + expiry
+	} else if !p.TLS.Valid {
+		return "invalid, expires " + expiry
+	}
+	return "valid until " + expiry
 }
 
-func doTokenCheck(e *endpoint.Config) error {
-	if e.Token == "" {
-		fmt.Println("\nNo authentication token set (logged out).")
-		return nil
+func printRemoteStatus(report *remoteStatusReport) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, statusLine, "SERVICE", "STATUS", "VERSION", "CERTIFICATE", "URI")
+	for _, p := range report.Services {
+		fmt.Fprintf(tw, statusLine, cases.Title(language.English).String(p.Service), probeStatus(p), p.Version, certificateStatus(p), p.URI)
 	}
-	if err := e.VerifyToken(""); err != nil {
-		fmt.Println("\nAuthentication token is invalid (please login again).")
-		return err
+	tw.Flush()
 
+	if report.Identity != nil {
+		fmt.Printf("\nLogged in as: %s <%s>\n\n", report.Identity.Username, report.Identity.Email)
+	}
+
+	switch report.Token {
+	case tokenNone:
+		fmt.Println("\nNo authentication token set (logged out).")
+	case tokenInvalid:
+		fmt.Println("\nAuthentication token is invalid (please login again).")
+	default:
+		fmt.Println("\nValid authentication token set (logged in).")
 	}
-	fmt.Println("\nValid authentication token set (logged in).")
-	return nil
 }
@@ -0,0 +1,388 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/runtime/registry"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/buger/goterm"
+	units "github.com/docker/go-units"
+	libcgroups "github.com/opencontainers/runc/libcontainer/cgroups"
+	"golang.org/x/term"
+)
+
+// clockTicks is the number of clock ticks per second used for the
+// CPU times reported in /proc/<pid>/stat.
+const clockTicks = 100
+
+// runtimeDirsGlob matches the runtime directories of all users.
+const runtimeDirsGlob = "/run/user/*"
+
+// topContainer is a running container as reported by top.
+type topContainer struct {
+	// Name is the instance name, empty for containers started with
+	// exec, run, shell or test
+	Name  string `json:"name,omitempty"`
+	User  string `json:"user"`
+	Image string `json:"image"`
+	// Pid is the pid of the starter process
+	Pid     int       `json:"pid"`
+	Started time.Time `json:"started"`
+	Cgroup  string    `json:"cgroup,omitempty"`
+	CPU     float64   `json:"cpuPercent"`
+	Memory  uint64    `json:"memoryBytes"`
+	Pids    int       `json:"pids"`
+}
+
+// procStat holds the fields of /proc/<pid>/stat used by top.
+type procStat struct {
+	ppid int
+	// ticks is the user and system CPU time
+	ticks uint64
+	// rss is the resident set size in pages
+	rss uint64
+	// start is the start time in clock ticks after boot
+	start uint64
+}
+
+// parseProcStat parses the content of a /proc/<pid>/stat file.
+func parseProcStat(data string) (procStat, error) {
+	var ps procStat
+
+	// the command name may contain spaces and parenthesis
+	i := strings.LastIndex(data, ")")
+	if i < 0 {
+		return ps, fmt.Errorf("malformed stat data")
+	}
+	fields := strings.Fields(data[i+1:])
+	if len(fields) < 22 {
+		return ps, fmt.Errorf("malformed stat data: %d fields", len(fields))
+	}
+
+	var err error
+	if ps.ppid, err = strconv.Atoi(fields[1]); err != nil {
+		return ps, err
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return ps, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return ps, err
+	}
+	ps.ticks = utime + stime
+	if ps.start, err = strconv.ParseUint(fields[19], 10, 64); err != nil {
+		return ps, err
+	}
+	if ps.rss, err = strconv.ParseUint(fields[21], 10, 64); err != nil {
+		return ps, err
+	}
+	return ps, nil
+}
+
+// readProcStats returns the stat of all processes, along with the
+// children of each process.
+func readProcStats() (map[int]procStat, map[int][]int) {
+	stats := make(map[int]procStat)
+	children := make(map[int][]int)
+
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil {
+			continue
+		}
+		// processes may exit while scanning
+		data, err := os.ReadFile(filepath.Join(dir, "stat"))
+		if err != nil {
+			continue
+		}
+		ps, err := parseProcStat(string(data))
+		if err != nil {
+			sylog.Debugf("Could not parse stat of process %d: %s", pid, err)
+			continue
+		}
+		stats[pid] = ps
+		children[ps.ppid] = append(children[ps.ppid], pid)
+	}
+	for _, c := range children {
+		sort.Ints(c)
+	}
+	return stats, children
+}
+
+// descendants returns the descendants of the process pid.
+func descendants(pid int, children map[int][]int) []int {
+	var pids []int
+	queue := append([]int(nil), children[pid]...)
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		pids = append(pids, p)
+		queue = append(queue, children[p]...)
+	}
+	return pids
+}
+
+// bootTime returns the system boot time.
+func bootTime() time.Time {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "btime ") {
+			if sec, err := strconv.ParseInt(strings.TrimSpace(line[6:]), 10, 64); err == nil {
+				return time.Unix(sec, 0)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// processCgroup returns the cgroup path of the process pid, the unified
+// hierarchy path with cgroups v2 or the pids controller path with v1.
+func processCgroup(pid int) string {
+	cgroups, err := libcgroups.ParseCgroupFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return ""
+	}
+	if path, ok := cgroups[""]; ok {
+		return path
+	}
+	return cgroups["pids"]
+}
+
+// instanceUsers returns the names of the users owning running instances,
+// found from the process names of the instance starter processes.
+func instanceUsers() []string {
+	seen := make(map[string]bool)
+	var users []string
+
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, dir := range dirs {
+		d, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil || !strings.HasPrefix(string(d), instance.ProgPrefix+": ") {
+			continue
+		}
+		name := strings.TrimPrefix(string(d), instance.ProgPrefix+": ")
+		if i := strings.Index(name, " ["); i > 0 {
+			name = name[:i]
+			if !seen[name] {
+				seen[name] = true
+				users = append(users, name)
+			}
+		}
+	}
+	return users
+}
+
+// registeredContainers returns the containers registered in the runtime
+// directory by user.
+func registeredContainers(runtimeDir, username string) []*topContainer {
+	entries, err := registry.List(runtimeDir)
+	if err != nil {
+		sylog.Debugf("Could not list containers registered in %s: %s", runtimeDir, err)
+		return nil
+	}
+	containers := make([]*topContainer, 0, len(entries))
+	for _, e := range entries {
+		containers = append(containers, &topContainer{
+			User:    username,
+			Image:   e.Image,
+			Pid:     e.Pid,
+			Started: e.Started,
+		})
+	}
+	return containers
+}
+
+// instanceContainers returns the running instances of user, or of the
+// current user if user is empty.
+func instanceContainers(username string) []*topContainer {
+	ii, err := instance.List(username, "*", instance.AppSubDir)
+	if err != nil {
+		sylog.Debugf("Could not list instances: %s", err)
+		return nil
+	}
+	containers := make([]*topContainer, 0, len(ii))
+	for _, i := range ii {
+		containers = append(containers, &topContainer{
+			Name:  i.Name,
+			User:  i.User,
+			Image: i.Image,
+			Pid:   i.PPid,
+		})
+	}
+	return containers
+}
+
+// listContainers returns the running containers of the current user,
+// or of all users if allUsers is set.
+func listContainers(allUsers bool) ([]*topContainer, error) {
+	containers := make([]*topContainer, 0)
+
+	if !allUsers {
+		u, err := user.CurrentOriginal()
+		if err != nil {
+			return nil, err
+		}
+		containers = append(containers, instanceContainers("")...)
+		if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+			containers = append(containers, registeredContainers(runtimeDir, u.Name)...)
+		}
+		return containers, nil
+	}
+
+	for _, username := range instanceUsers() {
+		containers = append(containers, instanceContainers(username)...)
+	}
+
+	runtimeDirs, _ := filepath.Glob(runtimeDirsGlob)
+	for _, runtimeDir := range runtimeDirs {
+		fi, err := os.Stat(runtimeDir)
+		if err != nil {
+			continue
+		}
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			continue
+		}
+		username := strconv.Itoa(int(st.Uid))
+		if u, err := user.GetPwUID(st.Uid); err == nil {
+			username = u.Name
+		}
+		containers = append(containers, registeredContainers(runtimeDir, username)...)
+	}
+	return containers, nil
+}
+
+// sampleContainers computes the resource usage of containers from two
+// process samples taken interval apart.
+func sampleContainers(containers []*topContainer, interval time.Duration, prev, cur map[int]procStat, children map[int][]int) {
+	boot := bootTime()
+	pageSize := uint64(os.Getpagesize())
+
+	for _, c := range containers {
+		pids := descendants(c.Pid, children)
+		c.Pids = len(pids)
+		c.CPU = 0
+		c.Memory = 0
+
+		var deltaTicks uint64
+		for _, pid := range pids {
+			ps := cur[pid]
+			c.Memory += ps.rss * pageSize
+			if p, ok := prev[pid]; ok && p.start == ps.start && ps.ticks >= p.ticks {
+				deltaTicks += ps.ticks - p.ticks
+			}
+		}
+		if interval > 0 {
+			c.CPU = float64(deltaTicks) / clockTicks / interval.Seconds() * 100
+		}
+		if len(pids) > 0 {
+			c.Cgroup = processCgroup(pids[0])
+		}
+		if c.Started.IsZero() && !boot.IsZero() {
+			if ps, ok := cur[c.Pid]; ok {
+				c.Started = boot.Add(time.Duration(ps.start) * time.Second / clockTicks)
+			}
+		}
+	}
+}
+
+// writeTopTable writes the containers resource usage as a table.
+func writeTopTable(w io.Writer, containers []*topContainer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "NAME\tUSER\tPID\tCPU %\tMEM USAGE\tPIDS\tUPTIME\tIMAGE"); err != nil {
+		return fmt.Errorf("could not write top header: %v", err)
+	}
+	for _, c := range containers {
+		name := c.Name
+		if name == "" {
+			name = "-"
+		}
+		uptime := "-"
+		if !c.Started.IsZero() {
+			uptime = units.HumanDuration(time.Since(c.Started))
+		}
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%d\t%.2f%%\t%s\t%d\t%s\t%s\n",
+			name, c.User, c.Pid, c.CPU, units.BytesSize(float64(c.Memory)), c.Pids, uptime, filepath.Base(c.Image))
+		if err != nil {
+			return fmt.Errorf("could not write container usage: %v", err)
+		}
+	}
+	return tw.Flush()
+}
+
+// Top displays the resource usage of the running containers, instances and
+// containers started with exec, run, shell or test, of the current user or
+// of all users if allUsers is set. The display is refreshed every interval
+// on a terminal, otherwise a single sample is displayed.
+func Top(ctx context.Context, allUsers bool, interval time.Duration, formatJSON bool) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+	stream := !formatJSON && term.IsTerminal(int(os.Stdout.Fd()))
+
+	prev, _ := readProcStats()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+
+		containers, err := listContainers(allUsers)
+		if err != nil {
+			return fmt.Errorf("could not list containers: %w", err)
+		}
+		cur, children := readProcStats()
+		sampleContainers(containers, interval, prev, cur, children)
+		prev = cur
+
+		sort.Slice(containers, func(i, j int) bool {
+			return containers[i].CPU > containers[j].CPU
+		})
+
+		if formatJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+			return enc.Encode(containers)
+		}
+
+		if stream {
+			goterm.Clear()
+			goterm.MoveCursor(1, 1)
+			goterm.Flush()
+		}
+		if err := writeTopTable(os.Stdout, containers); err != nil {
+			return err
+		}
+		if !stream {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    procStat
+		wantErr bool
+	}{
+		{
+			name: "simple",
+			data: "1234 (sleep) S 1200 1234 1200 0 -1 4194304 90 0 0 0 12 3 0 0 20 0 1 0 5000 2293760 131 18446744073709551615",
+			want: procStat{ppid: 1200, ticks: 15, start: 5000, rss: 131},
+		},
+		{
+			name: "command with spaces and parenthesis",
+			data: "42 (Apptainer (runtime) parent) S 1 42 42 0 -1 4194560 10 0 0 0 7 1 0 0 20 0 4 0 100 1000 50 18446744073709551615",
+			want: procStat{ppid: 1, ticks: 8, start: 100, rss: 50},
+		},
+		{
+			name:    "truncated",
+			data:    "42 (sh) S 1 42",
+			wantErr: true,
+		},
+		{
+			name:    "no command",
+			data:    "42",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProcStat(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProcStat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseProcStat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleContainers(t *testing.T) {
+	// 1 -> 10 -> 11 -> 12, 20 is not part of the container
+	children := map[int][]int{
+		1:  {10},
+		10: {11},
+		11: {12},
+		2:  {20},
+	}
+	prev := map[int]procStat{
+		11: {ppid: 10, ticks: 100, start: 50},
+		12: {ppid: 11, ticks: 10, start: 60},
+	}
+	cur := map[int]procStat{
+		10: {ppid: 1, ticks: 5, start: 40, rss: 1},
+		11: {ppid: 10, ticks: 150, start: 50, rss: 2},
+		// pid reused by a new process
+		12: {ppid: 11, ticks: 20, start: 70, rss: 3},
+		20: {ppid: 2, ticks: 1000, start: 10, rss: 100},
+	}
+
+	c := &topContainer{Pid: 1, Started: time.Now()}
+	sampleContainers([]*topContainer{c}, time.Second, prev, cur, children)
+
+	if c.Pids != 3 {
+		t.Errorf("got %d pids, want 3", c.Pids)
+	}
+	// only pid 11 was sampled twice, 50 ticks over one second
+	if c.CPU != 50 {
+		t.Errorf("got %.2f%% CPU, want 50%%", c.CPU)
+	}
+	if want := uint64(6 * os.Getpagesize()); c.Memory != want {
+		t.Errorf("got %d bytes of memory, want %d", c.Memory, want)
+	}
+}
+
+func TestDescendants(t *testing.T) {
+	children := map[int][]int{1: {2, 3}, 2: {4}, 5: {6}}
+	if got, want := descendants(1, children), []int{2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("descendants() = %v, want %v", got, want)
+	}
+	if got := descendants(4, children); len(got) != 0 {
+		t.Errorf("descendants() = %v, want none", got)
+	}
+}
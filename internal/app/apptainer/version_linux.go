@@ -0,0 +1,118 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/fakeroot"
+	"github.com/apptainer/apptainer/internal/pkg/security/apparmor"
+	"github.com/apptainer/apptainer/internal/pkg/security/seccomp"
+	"github.com/apptainer/apptainer/internal/pkg/security/selinux"
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+)
+
+// Values of the binary features of apptainer version --json.
+const (
+	FeatureBundled  = "bundled"
+	FeatureFound    = "found"
+	FeatureNotFound = "not found"
+)
+
+// versionBinaries are the optional external binaries reported as
+// features, bundled when installed in the apptainer libexec directory.
+var versionBinaries = []string{
+	"squashfuse",
+	"squashfuse_ll",
+	"fuse-overlayfs",
+	"fuse2fs",
+	"gocryptfs",
+	"cryptsetup",
+	"nvidia-container-cli",
+	"pasta",
+	"slirp4netns",
+}
+
+// VersionInfo describes this build of apptainer and the features it
+// supports on this host, printed by apptainer version --json.
+type VersionInfo struct {
+	Version string `json:"version"`
+	// Commit is the VCS revision embedded by the Go toolchain, empty
+	// when the binary was built without VCS information
+	Commit    string   `json:"commit"`
+	GoVersion string   `json:"goVersion"`
+	BuildTags []string `json:"buildTags"`
+	// Dirs are the build configuration directories and files, after
+	// relocation of the installation
+	Dirs map[string]string `json:"dirs"`
+	// Features are booleans for the security and kernel features, and
+	// bundled, found or not found for the external binaries
+	Features map[string]interface{} `json:"features"`
+}
+
+// GetVersionInfo returns the description of this build, detecting the
+// features as they are at runtime. It doesn't require privileges.
+func GetVersionInfo() *VersionInfo {
+	v := &VersionInfo{
+		Version:   buildcfg.PACKAGE_VERSION,
+		GoVersion: runtime.Version(),
+		BuildTags: strings.Fields(buildcfg.GO_BUILD_TAGS),
+		Dirs:      make(map[string]string),
+		Features:  make(map[string]interface{}),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				v.Commit = s.Value
+			}
+		}
+	}
+
+	for k, val := range buildcfg.Values() {
+		if strings.HasSuffix(k, "DIR") || strings.HasSuffix(k, "_FILE") {
+			v.Dirs[k] = val
+		}
+	}
+
+	fi, err := os.Stat(starterSuidPath())
+	v.Features["setuid-starter"] = err == nil && isSetuidRoot(fi)
+	v.Features["user-namespaces"] = fakeroot.CheckRootMapped() == nil
+	v.Features["seccomp"] = seccomp.Enabled()
+	v.Features["apparmor"] = apparmor.Enabled()
+	v.Features["selinux"] = selinux.Enabled()
+
+	bundleDir := filepath.Join(buildcfg.LIBEXECDIR, "apptainer", "bin")
+	for _, name := range versionBinaries {
+		path, err := bin.FindBin(name)
+		switch {
+		case err != nil:
+			v.Features[name] = FeatureNotFound
+		case filepath.Dir(path) == bundleDir:
+			v.Features[name] = FeatureBundled
+		default:
+			v.Features[name] = FeatureFound
+		}
+	}
+	return v
+}
+
+// PrintVersionJSON writes the description of this build in JSON format.
+func PrintVersionJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(GetVersionInfo())
+}
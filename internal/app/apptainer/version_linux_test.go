@@ -0,0 +1,81 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/test"
+)
+
+func TestPrintVersionJSON(t *testing.T) {
+	// the features must be detected without privileges
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+	if os.Geteuid() == 0 {
+		t.Fatalf("privileges not dropped")
+	}
+
+	var b bytes.Buffer
+	if err := PrintVersionJSON(&b); err != nil {
+		t.Fatalf("while printing version: %s", err)
+	}
+
+	var v map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &v); err != nil {
+		t.Fatalf("while decoding %s: %s", b.String(), err)
+	}
+
+	for _, k := range []string{"version", "commit", "goVersion"} {
+		if _, ok := v[k].(string); !ok {
+			t.Errorf("%s is %v, want a string", k, v[k])
+		}
+	}
+	if v["version"] != buildcfg.PACKAGE_VERSION {
+		t.Errorf("got version %v, want %s", v["version"], buildcfg.PACKAGE_VERSION)
+	}
+	if _, ok := v["buildTags"].([]interface{}); !ok {
+		t.Errorf("buildTags is %v, want an array", v["buildTags"])
+	}
+
+	dirs, ok := v["dirs"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("dirs is %v, want an object", v["dirs"])
+	}
+	if dirs["LIBEXECDIR"] != buildcfg.LIBEXECDIR || dirs["APPTAINER_CONF_FILE"] != buildcfg.APPTAINER_CONF_FILE {
+		t.Errorf("unexpected dirs %v", dirs)
+	}
+	if _, ok := dirs["GO_BUILD_TAGS"]; ok {
+		t.Errorf("dirs contain non directory values %v", dirs)
+	}
+
+	features, ok := v["features"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("features is %v, want an object", v["features"])
+	}
+	for _, k := range []string{"setuid-starter", "user-namespaces", "seccomp", "apparmor", "selinux"} {
+		if _, ok := features[k].(bool); !ok {
+			t.Errorf("feature %s is %v, want a boolean", k, features[k])
+		}
+	}
+	for _, k := range versionBinaries {
+		switch features[k] {
+		case FeatureBundled, FeatureFound, FeatureNotFound:
+		default:
+			t.Errorf("feature %s is %v, want %q, %q or %q", k, features[k], FeatureBundled, FeatureFound, FeatureNotFound)
+		}
+	}
+	if n := len(features); n != 5+len(versionBinaries) {
+		t.Errorf("got %d features, want %d", n, 5+len(versionBinaries))
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/util/crypt"
 	"github.com/apptainer/apptainer/internal/pkg/util/mainthread"
 	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
+	starterutil "github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/pkg/sylog"
 )
 
@@ -51,6 +52,7 @@ func createContainer(ctx context.Context, rpcSocket int, containerPid int, e *en
 			sylog.Infof("Try appending ':ro' to your overlay image or using '--fakeroot'")
 		}
 
+		starterutil.Report(starterutil.StageCreate, "", err)
 		fatalChan <- fmt.Errorf("container creation failed: %s", err)
 		return
 	}
@@ -119,14 +121,47 @@ func startContainer(ctx context.Context, masterSocket int, containerPid int, e *
 	}
 }
 
+// printRecord prints the actionable message of the error record r, or the
+// record itself as JSON if jsonErrors is set.
+func printRecord(r starterutil.Record, jsonErrors bool) {
+	out := r.Output(jsonErrors)
+	if out == "" {
+		return
+	} else if jsonErrors {
+		fmt.Fprintln(os.Stderr, out)
+		return
+	}
+	sylog.Errorf("%s", out)
+}
+
+// failureRecord returns the error record explaining the container failure
+// from the records read on errorPipe: the first record reported when the
+// master failed, or else the record matching the exit status of the
+// container process which exits with the code of the failing stage.
+func failureRecord(errorPipe int, fatal error, status syscall.WaitStatus) *starterutil.Record {
+	records, err := starterutil.ReadRecords(errorPipe)
+	if err != nil {
+		sylog.Debugf("%s", err)
+	}
+	for i, r := range records {
+		if fatal != nil || (status.Exited() && status.ExitStatus() == r.ExitCode()) {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
 // Master initializes a runtime engine and runs it.
 //
 // Saved uid 0 is preserved when run with suid flow, so that
 // the master is capable to escalate its privileges to setup
-// container environment properly.
-func Master(rpcSocket, masterSocket int, containerPid int, e *engine.Engine) {
+// container environment properly. The error records reported by
+// the failing stages are read from errorPipe.
+func Master(rpcSocket, masterSocket, errorPipe int, containerPid int, e *engine.Engine) {
 	var status syscall.WaitStatus
-	fatalChan := make(chan error, 1)
+	// each goroutine below sends at most one error, so none of them
+	// blocks once the first error was received
+	fatalChan := make(chan error, 3)
 
 	// we could receive signal from child with CreateContainer call so we
 	// set the signal handler earlier to queue signals until MonitorContainer
@@ -136,9 +171,14 @@ func Master(rpcSocket, masterSocket int, containerPid int, e *engine.Engine) {
 	signals := make(chan os.Signal, 2)
 	signal.Notify(signals)
 
-	ctx := context.TODO()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	go createContainer(ctx, rpcSocket, containerPid, e, fatalChan)
+	created := make(chan struct{})
+	go func() {
+		createContainer(ctx, rpcSocket, containerPid, e, fatalChan)
+		close(created)
+	}()
 
 	go startContainer(ctx, masterSocket, containerPid, e, fatalChan)
 
@@ -150,10 +190,25 @@ func Master(rpcSocket, masterSocket int, containerPid int, e *engine.Engine) {
 
 	fatal := <-fatalChan
 
-	if err := e.CleanupContainer(ctx, fatal, status); err != nil {
+	// the container process may be terminated by a signal while the
+	// container is created, wait until the creation is interrupted so
+	// the cleanup tears down everything set up so far, the creation
+	// fails as soon as the RPC server exits with the container process
+	cancel()
+	<-created
+
+	if err := e.CleanupContainer(context.Background(), fatal, status); err != nil {
 		sylog.Errorf("container cleanup failed: %s", err)
 	}
 
+	if r := failureRecord(errorPipe, fatal, status); r != nil {
+		if fatal != nil {
+			sylog.Errorf("%s", fatal)
+		}
+		printRecord(*r, e.JSONErrors)
+		os.Exit(r.ExitCode())
+	}
+
 	if fatal != nil {
 		sylog.Fatalf("%s", fatal)
 	}
@@ -161,20 +216,18 @@ func Master(rpcSocket, masterSocket int, containerPid int, e *engine.Engine) {
 	// reset signal handlers
 	signal.Reset()
 
-	exitCode := 0
+	exitCode := signalutil.ExitCode(status)
 
 	if status.Signaled() {
 		s := status.Signal()
 		sylog.Debugf("Child exited due to signal %d", s)
-		exitCode = 128 + int(s)
 
 		// mimic signal
 		mainthread.Execute(func() {
 			signalutil.Raise(s)
 		})
-	} else if status.Exited() {
-		sylog.Debugf("Child exited with exit status %d", status.ExitStatus())
-		exitCode = status.ExitStatus()
+	} else {
+		sylog.Debugf("Child exited with exit status %d", exitCode)
 	}
 
 	// if previous signal didn't interrupt process
@@ -11,10 +11,14 @@ package starter
 
 import (
 	"context"
+	"errors"
+	"syscall"
 	"testing"
 
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine"
 	"github.com/apptainer/apptainer/internal/pkg/test"
+	starterutil "github.com/apptainer/apptainer/internal/pkg/util/starter"
+	"golang.org/x/sys/unix"
 )
 
 // TODO: actually we can't really test Master function which is
@@ -115,3 +119,69 @@ func TestStartContainer(t *testing.T) {
 		})
 	}
 }
+
+func TestFailureRecord(t *testing.T) {
+	const (
+		mountRecord = `{"stage":"mount","errno":13,"path":"/cvmfs","message":"permission denied"}`
+		startRecord = `{"stage":"start","errno":0,"message":"exec true failed"}`
+	)
+
+	tests := []struct {
+		name      string
+		records   string
+		fatal     error
+		status    syscall.WaitStatus
+		wantStage starterutil.Stage
+	}{
+		{
+			name:   "no record",
+			fatal:  errors.New("container creation failed"),
+			status: 0,
+		},
+		{
+			name:      "master failure",
+			records:   mountRecord + "\n" + startRecord + "\n",
+			fatal:     errors.New("container creation failed"),
+			wantStage: starterutil.StageMount,
+		},
+		{
+			name:      "container exit status of the stage",
+			records:   startRecord + "\n",
+			status:    syscall.WaitStatus(255 << 8),
+			wantStage: starterutil.StageStart,
+		},
+		{
+			name:    "container exit status of the program",
+			records: startRecord + "\n",
+			status:  syscall.WaitStatus(1 << 8),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p [2]int
+			if err := unix.Pipe2(p[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+				t.Fatalf("failed to create pipe: %s", err)
+			}
+			defer unix.Close(p[0])
+			defer unix.Close(p[1])
+
+			if _, err := unix.Write(p[1], []byte(tt.records)); err != nil {
+				t.Fatalf("failed to write records: %s", err)
+			}
+
+			r := failureRecord(p[0], tt.fatal, tt.status)
+			if tt.wantStage == "" {
+				if r != nil {
+					t.Fatalf("unexpected record %+v", r)
+				}
+				return
+			}
+			if r == nil {
+				t.Fatalf("expected a record of stage %s", tt.wantStage)
+			} else if r.Stage != tt.wantStage {
+				t.Fatalf("expected a record of stage %s, got %s", tt.wantStage, r.Stage)
+			}
+		})
+	}
+}
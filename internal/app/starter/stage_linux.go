@@ -15,6 +15,8 @@ import (
 
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine"
 	starterConfig "github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/starter"
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
+	starterutil "github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/pkg/sylog"
 )
 
@@ -29,7 +31,11 @@ func StageOne(sconfig *starterConfig.Config, e *engine.Engine) {
 	sylog.Debugf("Entering stage 1\n")
 
 	if err := e.PrepareConfig(sconfig); err != nil {
-		sylog.Fatalf("%s\n", err)
+		// there is no master process yet to report the error record
+		r := starterutil.NewRecord(starterutil.StageConfig, "", err)
+		sylog.Errorf("%s", err)
+		printRecord(r, e.JSONErrors)
+		os.Exit(r.ExitCode())
 	}
 
 	if err := sconfig.Write(e.Common); err != nil {
@@ -55,9 +61,15 @@ func StageTwo(masterSocket int, e *engine.Engine) {
 	if err := e.StartProcess(masterSocket); err != nil {
 		// write data to just tell master to not execute PostStartProcess
 		// in case of failure
-		if _, err := syscall.Write(masterSocket, []byte("f")); err != nil {
+		err := signalutil.IgnoreEINTR(func() error {
+			_, err := syscall.Write(masterSocket, []byte("f"))
+			return err
+		})
+		if err != nil {
 			sylog.Errorf("fail to send data to master: %s", err)
 		}
-		sylog.Fatalf("%s\n", err)
+		starterutil.Report(starterutil.StageStart, "", err)
+		sylog.Errorf("%s", err)
+		os.Exit(starterutil.NewRecord(starterutil.StageStart, "", err).ExitCode())
 	}
 }
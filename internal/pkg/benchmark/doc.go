@@ -0,0 +1,14 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package benchmark holds benchmarks of the steps executed by the CLI
+// and the starter before a container process is launched, and a full
+// container launch. Run them with:
+//
+//	go test -run XXX -bench . ./internal/pkg/benchmark
+package benchmark
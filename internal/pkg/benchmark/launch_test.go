@@ -0,0 +1,140 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package benchmark
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/runtime/engine"
+	"github.com/apptainer/apptainer/internal/pkg/util/paths"
+	"github.com/apptainer/apptainer/pkg/image"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+
+	// register the apptainer engine
+	_ "github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer"
+)
+
+const busyboxSIF = "../../../e2e/testdata/busybox_" + runtime.GOARCH + ".sif"
+
+// BenchmarkConfParse measures the apptainer.conf parsing done once by
+// the CLI and once by the setuid starter.
+func BenchmarkConfParse(b *testing.B) {
+	conf := filepath.Join(b.TempDir(), "apptainer.conf")
+
+	defaultConf, err := apptainerconf.Parse("")
+	if err != nil {
+		b.Fatalf("while getting default configuration: %s", err)
+	}
+	f, err := os.Create(conf)
+	if err != nil {
+		b.Fatalf("while creating %s: %s", conf, err)
+	}
+	if err := apptainerconf.Generate(f, "", defaultConf); err != nil {
+		b.Fatalf("while generating %s: %s", conf, err)
+	}
+	f.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := apptainerconf.Parse(conf); err != nil {
+			b.Fatalf("while parsing %s: %s", conf, err)
+		}
+	}
+}
+
+// BenchmarkEngineConfig measures the engine configuration handoff
+// between the CLI and the starter.
+func BenchmarkEngineConfig(b *testing.B) {
+	fileConf, err := apptainerconf.Parse("")
+	if err != nil {
+		b.Fatalf("while getting default configuration: %s", err)
+	}
+
+	ec := apptainerConfig.NewConfig()
+	ec.File = fileConf
+	ec.SetImage("/tmp/busybox.sif")
+	ec.SetCwd("/home/user")
+	ec.SetContain(true)
+
+	common := &config.Common{
+		EngineName:    apptainerConfig.Name,
+		ContainerID:   "busybox.sif",
+		EngineConfig:  ec,
+		SchemaVersion: config.SchemaVersion,
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := json.Marshal(common)
+		if err != nil {
+			b.Fatalf("while marshaling engine configuration: %s", err)
+		}
+		if _, err := engine.Get(data, false); err != nil {
+			b.Fatalf("while unmarshaling engine configuration: %s", err)
+		}
+	}
+}
+
+// BenchmarkImageInit measures the image format detection.
+func BenchmarkImageInit(b *testing.B) {
+	if _, err := os.Stat(busyboxSIF); err != nil {
+		b.Skipf("%s not found", busyboxSIF)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		img, err := image.Init(busyboxSIF, false)
+		if err != nil {
+			b.Fatalf("while initializing image: %s", err)
+		}
+		img.File.Close()
+	}
+}
+
+// BenchmarkLibraryResolve measures the library resolution done for
+// --nv and --rocm, it is dominated by the ldconfig execution.
+func BenchmarkLibraryResolve(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, _, err := paths.Resolve([]string{"libc.so"}); err != nil {
+			b.Fatalf("while resolving libraries: %s", err)
+		}
+	}
+}
+
+// BenchmarkExecLaunch measures a full "apptainer exec <image> true" with
+// the installed apptainer. The image defaults to the e2e busybox image and
+// can be replaced, e.g. by a sandbox, with APPTAINER_BENCHMARK_IMAGE.
+func BenchmarkExecLaunch(b *testing.B) {
+	bin := filepath.Join(buildcfg.BINDIR, "apptainer")
+	if _, err := os.Stat(bin); err != nil {
+		b.Skipf("apptainer is not installed in %s", buildcfg.BINDIR)
+	}
+	img := os.Getenv("APPTAINER_BENCHMARK_IMAGE")
+	if img == "" {
+		img = busyboxSIF
+	}
+	if _, err := os.Stat(img); err != nil {
+		b.Skipf("%s not found", img)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if out, err := exec.Command(bin, "exec", img, "true").CombinedOutput(); err != nil {
+			b.Fatalf("while launching %s: %s: %s", img, err, out)
+		}
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"strconv"
 	"syscall"
 
+	"github.com/apptainer/apptainer/internal/pkg/build/oci"
 	"github.com/apptainer/apptainer/internal/pkg/image/packer"
 	"github.com/apptainer/apptainer/internal/pkg/util/crypt"
 	"github.com/apptainer/apptainer/internal/pkg/util/machine"
@@ -184,6 +185,14 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 		flags = append(flags, "-processors", fmt.Sprint(a.MksquashfsProcs))
 	}
 	arch := machine.ArchFromContainer(b.RootfsPath)
+	if a, ok := oci.ArchMap[b.Opts.Arch]; ok {
+		// the architecture requested with --arch
+		if arch == "" {
+			arch = a.Arch
+		} else if arch != a.Arch {
+			sylog.Warningf("Image built for %s contains %s binaries, recording %s as its architecture", a.Arch, arch, arch)
+		}
+	}
 	if arch == "" {
 		sylog.Infof("Architecture not recognized, use native")
 		arch = runtime.GOARCH
@@ -371,7 +371,7 @@ func (b *Build) Full(ctx context.Context) error {
 				return fmt.Errorf("undefined image cache")
 			}
 			if err := stage.c.Get(ctx, stage.b); err != nil {
-				return fmt.Errorf("conveyor failed to get: %v", err)
+				return fmt.Errorf("conveyor failed to get: %w", err)
 			}
 
 			_, err := stage.c.Pack(ctx)
@@ -13,27 +13,40 @@ package oci
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 
 	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/inspect"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/containers/image/v5/copy"
 	"github.com/containers/image/v5/docker"
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/oci/layout"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	gdigest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // ImageReference wraps containers/image ImageReference type
 type ImageReference struct {
+	// source is the image to fetch into the blob cache, nil if the image
+	// is only taken from the cache
 	source types.ImageReference
+	// cache, dir and tag are where the source image is stored in the blob
+	// cache
+	cache *cache.Handle
+	dir   string
+	tag   string
 	types.ImageReference
 }
 
@@ -83,6 +96,29 @@ func ConvertReference(ctx context.Context, imgCache *cache.Handle, src types.Ima
 		return nil, fmt.Errorf("undefined image cache")
 	}
 
+	// In offline mode a registry image is taken from the blob cache as
+	// stored by a previous pull of the same source, without fetching it.
+	if imgCache.IsOffline() && src.Transport().Name() == "docker" {
+		cacheTag, err := imgCache.OfflineBlobsTag(transports.ImageName(src))
+		if err != nil {
+			return nil, err
+		}
+		cacheDir, err := imgCache.GetOciCacheDir(cache.OciBlobCacheType)
+		if err != nil {
+			return nil, err
+		}
+		c, err := layout.ParseReference(cacheDir + ":" + cacheTag)
+		if err != nil {
+			return nil, err
+		}
+		return &ImageReference{
+			cache:          imgCache,
+			dir:            cacheDir,
+			tag:            cacheTag,
+			ImageReference: c,
+		}, nil
+	}
+
 	// Our cache dir is an OCI directory. We are using this as a 'blob pool'
 	// storing all incoming containers under unique tags, which are a hash of
 	// their source URI.
@@ -109,6 +145,9 @@ func ConvertReference(ctx context.Context, imgCache *cache.Handle, src types.Ima
 
 	return &ImageReference{
 		source:         src,
+		cache:          imgCache,
+		dir:            cacheDir,
+		tag:            cacheTag,
 		ImageReference: c,
 	}, nil
 }
@@ -119,21 +158,98 @@ func (t *ImageReference) NewImageSource(ctx context.Context, sys *types.SystemCo
 }
 
 func (t *ImageReference) newImageSource(ctx context.Context, sys *types.SystemContext, w io.Writer) (types.ImageSource, error) {
+	// First we are fetching into the cache, unless offline
+	if t.source == nil {
+		return t.ImageReference.NewImageSource(ctx, sys)
+	}
+	if err := t.fetch(ctx, sys, w, nil); err != nil {
+		return nil, err
+	}
+	return t.ImageReference.NewImageSource(ctx, sys)
+}
+
+// fetch copies the source image into the blob cache, calling fetched if
+// set with the digest of each blob once it's stored in the cache.
+func (t *ImageReference) fetch(ctx context.Context, sys *types.SystemContext, w io.Writer, fetched func(gdigest.Digest)) error {
 	policy := &signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}}
 	policyCtx, err := signature.NewPolicyContext(policy)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// First we are fetching into the cache
-	_, err = copy.Image(ctx, policyCtx, t.ImageReference, t.source, &copy.Options{
+	var dest types.ImageReference = t.ImageReference
+	if fetched != nil {
+		dest = &notifyReference{ImageReference: dest, fetched: fetched}
+	}
+	_, err = copy.Image(ctx, policyCtx, dest, t.source, &copy.Options{
 		ReportWriter: w,
 		SourceCtx:    sys,
 	})
+	if err != nil {
+		return err
+	}
+	if t.cache != nil {
+		if err := t.cache.SetBlobsSource(t.tag, transports.ImageName(t.source)); err != nil {
+			sylog.Debugf("Could not record source of %s in the blob cache: %v", t.tag, err)
+		}
+	}
+	return nil
+}
+
+// ShareBlobs fetches the image of ref, as returned by ConvertReference,
+// into the blob cache, then creates its blobs in the OCI layout directory
+// dir by sharing them with the cache: with reflinks when the filesystem
+// supports them, or else hard links, as blobs are never modified. It
+// returns the reference of the image in the blob cache, to copy it to dir
+// without fetching it again. Other references are returned unchanged.
+func ShareBlobs(ctx context.Context, ref types.ImageReference, sys *types.SystemContext, dir string) (types.ImageReference, error) {
+	t, ok := ref.(*ImageReference)
+	if !ok || t.dir == "" {
+		return ref, nil
+	}
+	src, err := t.NewImageSource(ctx, sys)
 	if err != nil {
 		return nil, err
 	}
-	return t.ImageReference.NewImageSource(ctx, sys)
+	defer src.Close()
+
+	b, _, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	var m imgspecv1.Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("while parsing manifest of %s: %v", t.tag, err)
+	}
+	digests := []gdigest.Digest{gdigest.FromBytes(b), m.Config.Digest}
+	for _, l := range m.Layers {
+		digests = append(digests, l.Digest)
+	}
+
+	shared := make(map[string]int)
+	for _, d := range digests {
+		if d.Validate() != nil {
+			continue
+		}
+		to := filepath.Join(dir, "blobs", d.Algorithm().String(), d.Encoded())
+		if _, err := os.Lstat(to); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+			return nil, err
+		}
+		// a blob which can't be shared is copied by the image copy
+		method, err := fs.ShareFile(filepath.Join(t.dir, "blobs", d.Algorithm().String(), d.Encoded()), to)
+		if err != nil {
+			sylog.Debugf("Could not share blob %s with the cache: %v", d, err)
+			continue
+		}
+		shared[method]++
+	}
+	sylog.Debugf("Blobs shared with the cache: %d reflinked, %d hard-linked, %d copied",
+		shared[fs.ShareReflink], shared[fs.ShareHardlink], shared[fs.ShareCopy])
+
+	return t.ImageReference, nil
 }
 
 // ParseImageName parses a uri (e.g. docker://ubuntu) into it's transport:reference
@@ -166,6 +282,20 @@ func parseURI(uri string) (types.ImageReference, *GoArch, error) {
 	return imgRef, arch, err
 }
 
+// OfflineImageDigest obtains the digest of a uri's manifest without network
+// access: the digest of a registry image is the one recorded in the blob
+// cache by a previous pull.
+func OfflineImageDigest(ctx context.Context, imgCache *cache.Handle, uri string, sys *types.SystemContext) (string, error) {
+	ref, _, err := parseURI(uri)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse image name %v: %v", uri, err)
+	}
+	if ref.Transport().Name() != "docker" {
+		return ImageDigest(ctx, uri, sys)
+	}
+	return imgCache.OfflineBlobsTag(transports.ImageName(ref))
+}
+
 // ImageDigest obtains the digest of a uri's manifest
 func ImageDigest(ctx context.Context, uri string, sys *types.SystemContext) (digest string, err error) {
 	if sys == nil {
@@ -188,6 +318,100 @@ func ImageDigest(ctx context.Context, uri string, sys *types.SystemContext) (dig
 	return getRefDigest(ctx, ref, sys)
 }
 
+// ImageConfig obtains the configuration of the image of uri, fetching its
+// manifest and configuration blob only.
+func ImageConfig(ctx context.Context, uri string, sys *types.SystemContext) (*imgspecv1.Image, error) {
+	if sys == nil {
+		var err error
+		sys, err = defaultSysCtx()
+		if err != nil {
+			return nil, fmt.Errorf("unable to create default system context: %v", err)
+		}
+	}
+	ref, arch, err := parseURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse image name %v: %v", uri, err)
+	}
+	if arch != nil {
+		sys.ArchitectureChoice = arch.Arch
+		sys.VariantChoice = arch.Var
+	}
+
+	img, err := ref.NewImage(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	return img.OCIConfig(ctx)
+}
+
+// RemoteMetadata returns the metadata of the registry image uri, read
+// from its manifest and image configuration without fetching the layers.
+func RemoteMetadata(ctx context.Context, uri string, sys *types.SystemContext) (*inspect.RemoteAttributes, error) {
+	if sys == nil {
+		var err error
+		sys, err = defaultSysCtx()
+		if err != nil {
+			return nil, fmt.Errorf("unable to create default system context: %v", err)
+		}
+	}
+	ref, arch, err := parseURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse image name %v: %v", uri, err)
+	}
+	if ref.Transport().Name() != "docker" {
+		return nil, fmt.Errorf("%s is not a registry image", uri)
+	}
+	if arch != nil {
+		sys.ArchitectureChoice = arch.Arch
+		sys.VariantChoice = arch.Var
+	}
+
+	img, err := ref.NewImage(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	b, _, err := img.Manifest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("while fetching manifest: %w", err)
+	}
+	dgst, err := manifest.Digest(b)
+	if err != nil {
+		return nil, fmt.Errorf("while computing manifest digest: %w", err)
+	}
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("while fetching image configuration: %w", err)
+	}
+
+	attrs := &inspect.RemoteAttributes{
+		Source:       uri,
+		Digest:       dgst.String(),
+		Size:         img.ConfigInfo().Size,
+		Architecture: config.Architecture,
+		Layers:       []inspect.RemoteLayer{},
+		Labels:       config.Config.Labels,
+		Env:          config.Config.Env,
+		Entrypoint:   config.Config.Entrypoint,
+		Cmd:          config.Config.Cmd,
+	}
+	if config.Variant != "" {
+		attrs.Architecture += "/" + config.Variant
+	}
+	for _, l := range img.LayerInfos() {
+		attrs.Layers = append(attrs.Layers, inspect.RemoteLayer{
+			Digest:    l.Digest.String(),
+			MediaType: l.MediaType,
+			Size:      l.Size,
+		})
+		attrs.Size += l.Size
+	}
+	return attrs, nil
+}
+
 // getRefDigest obtains the manifest digest for a ref.
 func getRefDigest(ctx context.Context, ref types.ImageReference, sys *types.SystemContext) (digest string, err error) {
 	if sys.ArchitectureChoice == "" {
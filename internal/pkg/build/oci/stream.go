@@ -0,0 +1,262 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	gdigest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/opencontainers/umoci/oci/cas"
+)
+
+// UnpackFunc unpacks the layers of manifest, reading the blobs of the
+// image from engine.
+type UnpackFunc func(ctx context.Context, engine cas.Engine, manifest imgspecv1.Manifest) error
+
+// streamLayerTypes maps the layer media types of the images which can be
+// unpacked while they are fetched to their OCI media type, the layer
+// digests don't change when the image is stored in the blob cache.
+var streamLayerTypes = map[string]string{
+	imgspecv1.MediaTypeImageLayer:                     imgspecv1.MediaTypeImageLayer,
+	imgspecv1.MediaTypeImageLayerGzip:                 imgspecv1.MediaTypeImageLayerGzip,
+	manifest.DockerV2SchemaLayerMediaTypeUncompressed: imgspecv1.MediaTypeImageLayer,
+	manifest.DockerV2Schema2LayerMediaType:            imgspecv1.MediaTypeImageLayerGzip,
+}
+
+// StreamImage fetches the image of ref, as returned by ConvertReference,
+// into the blob cache like NewImageSource, while calling unpack with the
+// OCI manifest of the image. The engine given to unpack reads the blobs
+// from the blob cache, waiting for each blob to be fetched and verified,
+// so the layers are unpacked in order while the next layers are fetched.
+// It returns false without fetching the image if it's not fetched into
+// the blob cache or if its layers can't be unpacked while it's fetched.
+func StreamImage(ctx context.Context, ref types.ImageReference, sys *types.SystemContext, unpack UnpackFunc) (bool, error) {
+	t, ok := ref.(*ImageReference)
+	if !ok || t.source == nil {
+		return false, nil
+	}
+
+	img, err := t.source.NewImage(ctx, sys)
+	if err != nil {
+		return false, err
+	}
+	defer img.Close()
+
+	m := streamManifest(img)
+	if m == nil {
+		sylog.Debugf("Layers of %s can't be unpacked while fetched", t.tag)
+		return false, nil
+	}
+	config, err := img.ConfigBlob(ctx)
+	if err != nil {
+		return false, fmt.Errorf("while getting image config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	blobs := newBlobWaiter()
+	unpackErr := make(chan error, 1)
+	go func() {
+		err := unpack(ctx, &streamEngine{
+			dir:        t.dir,
+			config:     m.Config.Digest,
+			configBlob: config,
+			blobs:      blobs,
+		}, *m)
+		if err != nil {
+			// stop fetching the image
+			cancel()
+		}
+		unpackErr <- err
+	}()
+
+	fetchErr := t.fetch(ctx, sys, sylog.Writer(), blobs.fetched)
+	blobs.finish(fetchErr)
+
+	if err := <-unpackErr; err != nil && (fetchErr == nil || errors.Is(fetchErr, context.Canceled)) {
+		return true, err
+	}
+	return true, fetchErr
+}
+
+// streamManifest returns the OCI manifest of the image stored in the blob
+// cache, or nil if the layers of img can't be unpacked while fetched.
+func streamManifest(img types.Image) *imgspecv1.Manifest {
+	config := img.ConfigInfo()
+	if config.MediaType != imgspecv1.MediaTypeImageConfig && config.MediaType != manifest.DockerV2Schema2ConfigMediaType {
+		return nil
+	}
+
+	m := &imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config: imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageConfig,
+			Digest:    config.Digest,
+			Size:      config.Size,
+		},
+	}
+	for _, l := range img.LayerInfos() {
+		mediaType, ok := streamLayerTypes[l.MediaType]
+		if !ok || len(l.URLs) > 0 {
+			return nil
+		}
+		m.Layers = append(m.Layers, imgspecv1.Descriptor{
+			MediaType: mediaType,
+			Digest:    l.Digest,
+			Size:      l.Size,
+		})
+	}
+	return m
+}
+
+// streamEngine reads the blobs of an image being fetched into the blob
+// cache dir, once they are stored in the cache. The image config is fetched
+// first as it's needed to verify the layers while unpacking them. The blob
+// cache is only a valid OCI layout once the image is fetched, so the blobs
+// are read directly and cas.Engine is embedded for the other methods which
+// are not used to unpack layers.
+type streamEngine struct {
+	cas.Engine
+	dir        string
+	config     gdigest.Digest
+	configBlob []byte
+	blobs      *blobWaiter
+}
+
+func (e *streamEngine) GetBlob(ctx context.Context, digest gdigest.Digest) (io.ReadCloser, error) {
+	if digest == e.config {
+		return io.NopCloser(bytes.NewReader(e.configBlob)), nil
+	}
+	if err := digest.Validate(); err != nil {
+		return nil, err
+	}
+	if err := e.blobs.wait(ctx, digest); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(e.dir, "blobs", digest.Algorithm().String(), digest.Encoded()))
+}
+
+// blobWaiter tracks the blobs stored in the blob cache while an image is
+// fetched.
+type blobWaiter struct {
+	mu    sync.Mutex
+	blobs map[gdigest.Digest]chan struct{}
+	done  chan struct{}
+	err   error
+}
+
+func newBlobWaiter() *blobWaiter {
+	return &blobWaiter{
+		blobs: make(map[gdigest.Digest]chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+func (w *blobWaiter) channel(digest gdigest.Digest) chan struct{} {
+	ch, ok := w.blobs[digest]
+	if !ok {
+		ch = make(chan struct{})
+		w.blobs[digest] = ch
+	}
+	return ch
+}
+
+// fetched records that the blob digest is stored in the blob cache.
+func (w *blobWaiter) fetched(digest gdigest.Digest) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ch := w.channel(digest)
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// finish records the end of the image fetch, with its error if any.
+func (w *blobWaiter) finish(err error) {
+	w.err = err
+	close(w.done)
+}
+
+// wait waits for the blob digest to be stored in the blob cache.
+func (w *blobWaiter) wait(ctx context.Context, digest gdigest.Digest) error {
+	w.mu.Lock()
+	ch := w.channel(digest)
+	w.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.done:
+	}
+
+	select {
+	case <-ch:
+		return nil
+	default:
+	}
+	if w.err != nil {
+		return fmt.Errorf("while fetching blob %s: %w", digest, w.err)
+	}
+	return fmt.Errorf("blob %s was not fetched into the blob cache", digest)
+}
+
+// notifyReference wraps the blob cache reference to be notified of the
+// blobs stored in the blob cache while an image is copied to it.
+type notifyReference struct {
+	types.ImageReference
+	fetched func(gdigest.Digest)
+}
+
+func (r *notifyReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := r.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &notifyDestination{ImageDestination: dest, fetched: r.fetched}, nil
+}
+
+type notifyDestination struct {
+	types.ImageDestination
+	fetched func(gdigest.Digest)
+}
+
+func (d *notifyDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	info, err := d.ImageDestination.PutBlob(ctx, stream, inputInfo, cache, isConfig)
+	if err == nil {
+		d.fetched(info.Digest)
+	}
+	return info, err
+}
+
+func (d *notifyDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	reused, reusedInfo, err := d.ImageDestination.TryReusingBlob(ctx, info, cache, canSubstitute)
+	if err == nil && reused {
+		d.fetched(reusedInfo.Digest)
+	}
+	return reused, reusedInfo, err
+}
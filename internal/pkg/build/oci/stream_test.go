@@ -0,0 +1,258 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/test"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	gdigest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/opencontainers/umoci/oci/cas"
+)
+
+// layerFiles are the files of each layer of the image created by
+// createLayoutImage.
+var layerFiles = [][]string{
+	{"etc/", "etc/os-release", "data"},
+	{"etc/.wh.os-release", "bin/", "bin/sh"},
+	{"usr/", "usr/lib"},
+}
+
+// createLayoutImage creates an image with a gzip layer per layerFiles entry
+// in an OCI layout directory, and returns its reference.
+func createLayoutImage(t *testing.T) types.ImageReference {
+	ctx := context.Background()
+
+	ref, err := layout.ParseReference(t.TempDir() + ":latest")
+	if err != nil {
+		t.Fatalf("while parsing layout reference: %s", err)
+	}
+	dest, err := ref.NewImageDestination(ctx, nil)
+	if err != nil {
+		t.Fatalf("while creating layout destination: %s", err)
+	}
+	defer dest.Close()
+
+	putBlob := func(blob []byte, isConfig bool) types.BlobInfo {
+		info, err := dest.PutBlob(ctx, bytes.NewReader(blob), types.BlobInfo{Digest: gdigest.FromBytes(blob), Size: int64(len(blob))}, none.NoCache, isConfig)
+		if err != nil {
+			t.Fatalf("while writing blob: %s", err)
+		}
+		return info
+	}
+
+	config := imgspecv1.Image{
+		Platform: imgspecv1.Platform{Architecture: "amd64", OS: "linux"},
+		RootFS:   imgspecv1.RootFS{Type: "layers"},
+	}
+	m := imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+	}
+	for _, files := range layerFiles {
+		var raw, compressed bytes.Buffer
+		tw := tar.NewWriter(&raw)
+		for _, name := range files {
+			hdr := &tar.Header{Name: name, Mode: 0o644, Typeflag: tar.TypeReg, Size: int64(len(name))}
+			if name[len(name)-1] == '/' {
+				hdr = &tar.Header{Name: name, Mode: 0o755, Typeflag: tar.TypeDir}
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatalf("while writing layer: %s", err)
+			}
+			if hdr.Typeflag == tar.TypeReg {
+				tw.Write([]byte(name))
+			}
+		}
+		tw.Close()
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, gdigest.FromBytes(raw.Bytes()))
+
+		gw := gzip.NewWriter(&compressed)
+		gw.Write(raw.Bytes())
+		gw.Close()
+		info := putBlob(compressed.Bytes(), false)
+		m.Layers = append(m.Layers, imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageLayerGzip,
+			Digest:    info.Digest,
+			Size:      info.Size,
+		})
+	}
+
+	configBlob, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("while marshaling config: %s", err)
+	}
+	info := putBlob(configBlob, true)
+	m.Config = imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: info.Digest, Size: info.Size}
+
+	manifestBlob, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("while marshaling manifest: %s", err)
+	}
+	if err := dest.PutManifest(ctx, manifestBlob, nil); err != nil {
+		t.Fatalf("while writing manifest: %s", err)
+	}
+	if err := dest.Commit(ctx, nil); err != nil {
+		t.Fatalf("while committing image: %s", err)
+	}
+	return ref
+}
+
+// readLayers returns the files of the layers of m read from engine.
+func readLayers(ctx context.Context, engine cas.Engine, m imgspecv1.Manifest) ([][]string, error) {
+	var layers [][]string
+	for _, l := range m.Layers {
+		r, err := engine.GetBlob(ctx, l.Digest)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		tr := tar.NewReader(gr)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			files = append(files, hdr.Name)
+		}
+		layers = append(layers, files)
+	}
+	return layers, nil
+}
+
+func TestStreamImage(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	src := createLayoutImage(t)
+	sys := createValidSysCtx()
+
+	newRef := func(t *testing.T) *ImageReference {
+		imgCache, err := cache.New(cache.Config{ParentDir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("failed to create an image cache handle: %s", err)
+		}
+		ref, err := ConvertReference(context.Background(), imgCache, src, sys)
+		if err != nil {
+			t.Fatalf("failed to convert image reference: %s", err)
+		}
+		return ref.(*ImageReference)
+	}
+
+	t.Run("Unpack", func(t *testing.T) {
+		ref := newRef(t)
+
+		var layers [][]string
+		streamed, err := StreamImage(context.Background(), ref, sys, func(ctx context.Context, engine cas.Engine, m imgspecv1.Manifest) error {
+			// the config is read before the layers to verify them
+			if _, err := engine.GetBlob(ctx, m.Config.Digest); err != nil {
+				return err
+			}
+			var err error
+			layers, err = readLayers(ctx, engine, m)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unexpected error while streaming image: %s", err)
+		} else if !streamed {
+			t.Fatalf("image was not streamed")
+		}
+		if !reflect.DeepEqual(layers, layerFiles) {
+			t.Errorf("unexpected layer files: got %v instead of %v", layers, layerFiles)
+		}
+
+		// the image is stored in the blob cache as with NewImageSource
+		img, err := ref.ImageReference.NewImage(context.Background(), sys)
+		if err != nil {
+			t.Fatalf("image is not in the blob cache: %s", err)
+		}
+		defer img.Close()
+		if n := len(img.LayerInfos()); n != len(layerFiles) {
+			t.Errorf("unexpected number of layers in the blob cache: %d", n)
+		}
+	})
+
+	t.Run("UnpackError", func(t *testing.T) {
+		unpackErr := errors.New("unpack error")
+		streamed, err := StreamImage(context.Background(), newRef(t), sys, func(ctx context.Context, engine cas.Engine, m imgspecv1.Manifest) error {
+			return unpackErr
+		})
+		if !streamed {
+			t.Errorf("image was not streamed")
+		}
+		if !errors.Is(err, unpackErr) {
+			t.Errorf("unexpected error: got %v instead of %v", err, unpackErr)
+		}
+	})
+
+	t.Run("NotCached", func(t *testing.T) {
+		streamed, err := StreamImage(context.Background(), src, sys, func(ctx context.Context, engine cas.Engine, m imgspecv1.Manifest) error {
+			return fmt.Errorf("unexpected unpack call")
+		})
+		if streamed || err != nil {
+			t.Errorf("unexpected stream of an image not fetched into the blob cache: %v", err)
+		}
+	})
+}
+
+func TestBlobWaiter(t *testing.T) {
+	ctx := context.Background()
+	fetchErr := errors.New("fetch error")
+	fetched := gdigest.FromString("fetched")
+	missing := gdigest.FromString("missing")
+
+	w := newBlobWaiter()
+	w.fetched(fetched)
+	w.fetched(fetched)
+	if err := w.wait(ctx, fetched); err != nil {
+		t.Errorf("unexpected error while waiting for a fetched blob: %s", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := w.wait(canceled, missing); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error with a canceled context: %v", err)
+	}
+
+	w.finish(fetchErr)
+	if err := w.wait(ctx, fetched); err != nil {
+		t.Errorf("unexpected error while waiting for a fetched blob: %s", err)
+	}
+	if err := w.wait(ctx, missing); !errors.Is(err, fetchErr) {
+		t.Errorf("unexpected error while waiting for a missing blob: %v", err)
+	}
+
+	w = newBlobWaiter()
+	w.finish(nil)
+	if err := w.wait(ctx, missing); err == nil {
+		t.Errorf("unexpected success while waiting for a missing blob")
+	}
+}
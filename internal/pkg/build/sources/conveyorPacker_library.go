@@ -17,6 +17,7 @@ import (
 
 	golog "github.com/go-log/log"
 
+	"github.com/apptainer/apptainer/internal/pkg/build/oci"
 	"github.com/apptainer/apptainer/internal/pkg/client/library"
 	"github.com/apptainer/apptainer/pkg/build/types"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -76,9 +77,14 @@ func (cp *LibraryConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err
 		Logger:    (golog.Logger)(sylog.DebugLogger{}),
 	}
 
-	imagePath, err := library.Pull(ctx, b.Opts.ImgCache, imageRef, runtime.GOARCH, cp.b.TmpDir, libraryConfig)
+	arch := runtime.GOARCH
+	if a, ok := oci.ArchMap[b.Opts.Arch]; ok {
+		arch = a.Arch
+	}
+
+	imagePath, err := library.Pull(ctx, b.Opts.ImgCache, imageRef, arch, cp.b.TmpDir, libraryConfig)
 	if err != nil {
-		return fmt.Errorf("while fetching library image: %v", err)
+		return fmt.Errorf("while fetching library image: %w", err)
 	}
 
 	// insert base metadata before unpacking fs
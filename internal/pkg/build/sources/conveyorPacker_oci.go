@@ -13,7 +13,6 @@ package sources
 import (
 	"archive/tar"
 	"bufio"
-	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
@@ -42,6 +41,7 @@ import (
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/opencontainers/umoci/oci/cas"
 )
 
 type ociRunscriptData struct {
@@ -136,6 +136,9 @@ type OCIConveyorPacker struct {
 	policyCtx *signature.PolicyContext
 	imgConfig imgspecv1.ImageConfig
 	sysCtx    *types.SystemContext
+	// unpacked is set when the rootfs was extracted while the image
+	// was fetched into the blob cache
+	unpacked bool
 }
 
 // Get downloads container information from the specified source
@@ -234,7 +237,9 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 		return fmt.Errorf("invalid image source: %v", err)
 	}
 
-	if !cp.b.Opts.NoCache {
+	// the images are only taken from the cache in offline mode
+	offline := b.Opts.ImgCache != nil && b.Opts.ImgCache.IsOffline()
+	if !cp.b.Opts.NoCache || offline {
 		// Grab the modified source ref from the cache
 		cp.srcRef, err = oci.ConvertReference(ctx, b.Opts.ImgCache, cp.srcRef, cp.sysCtx)
 		if err != nil {
@@ -242,16 +247,27 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 		}
 	}
 
-	// To to do the RootFS extraction we also have to have a location that
-	// contains *only* this image
-	cp.tmpfsRef, err = ocilayout.ParseReference(cp.b.TmpDir + ":" + "tmp")
+	// The layers of an image fetched into the blob cache are extracted
+	// while the image is fetched, in a single pass over the layers
+	cp.unpacked, err = oci.StreamImage(ctx, cp.srcRef, cp.sysCtx, func(ctx context.Context, engine cas.Engine, m imgspecv1.Manifest) error {
+		return unpackStream(ctx, cp.b, engine, m)
+	})
 	if err != nil {
-		return fmt.Errorf("while parsing reference: %w", err)
+		return fmt.Errorf("while fetching image: %w", err)
 	}
 
-	err = cp.fetch(ctx)
-	if err != nil {
-		return fmt.Errorf("while fetching image: %w", err)
+	if !cp.unpacked {
+		// To to do the RootFS extraction we also have to have a location that
+		// contains *only* this image
+		cp.tmpfsRef, err = ocilayout.ParseReference(cp.b.TmpDir + ":" + "tmp")
+		if err != nil {
+			return fmt.Errorf("while parsing reference: %w", err)
+		}
+
+		err = cp.fetch(ctx)
+		if err != nil {
+			return fmt.Errorf("while fetching image: %w", err)
+		}
 	}
 
 	cp.imgConfig, err = cp.getConfig(ctx)
@@ -298,8 +314,13 @@ func (cp *OCIConveyorPacker) Pack(ctx context.Context) (*sytypes.Bundle, error)
 }
 
 func (cp *OCIConveyorPacker) fetch(ctx context.Context) error {
-	// cp.srcRef contains the cache source reference
-	_, err := copy.Image(ctx, cp.policyCtx, cp.tmpfsRef, cp.srcRef, &copy.Options{
+	// cp.srcRef contains the cache source reference, the blobs of the
+	// image are shared with the cache rather than copied when possible
+	srcRef, err := oci.ShareBlobs(ctx, cp.srcRef, cp.sysCtx, cp.b.TmpDir)
+	if err != nil {
+		return err
+	}
+	_, err = copy.Image(ctx, cp.policyCtx, cp.tmpfsRef, srcRef, &copy.Options{
 		ReportWriter: io.Discard,
 		SourceCtx:    cp.sysCtx,
 	})
@@ -408,6 +429,9 @@ func (cp *OCIConveyorPacker) extractArchive(src string, dst string) error {
 }
 
 func (cp *OCIConveyorPacker) unpackTmpfs(ctx context.Context) error {
+	if cp.unpacked {
+		return finishRootfs(cp.b)
+	}
 	return unpackRootfs(ctx, cp.b, cp.tmpfsRef, cp.sysCtx)
 }
 
@@ -419,55 +443,51 @@ func (cp *OCIConveyorPacker) insertBaseEnv() (err error) {
 }
 
 func (cp *OCIConveyorPacker) insertRunScript() (err error) {
-	f, err := os.Create(cp.b.RootfsPath + "/.singularity.d/runscript")
+	runscript, err := OCIRunscript(cp.imgConfig)
 	if err != nil {
-		return
+		return err
 	}
 
-	defer f.Close()
-
-	_, err = f.WriteString("#!/bin/sh\n")
+	err = os.WriteFile(cp.b.RootfsPath+"/.singularity.d/runscript", []byte(runscript), 0o755)
 	if err != nil {
 		return
 	}
 
-	if len(cp.imgConfig.Entrypoint) > 0 {
-		_, err = f.WriteString("OCI_ENTRYPOINT='" +
-			shell.EscapeSingleQuotes(shell.ArgsQuoted(cp.imgConfig.Entrypoint)) +
+	return os.Chmod(cp.b.RootfsPath+"/.singularity.d/runscript", 0o755)
+}
+
+// OCIRunscript returns the runscript of a container built from an OCI image
+// with the configuration conf, running its ENTRYPOINT and CMD.
+func OCIRunscript(conf imgspecv1.ImageConfig) (string, error) {
+	var b strings.Builder
+
+	b.WriteString("#!/bin/sh\n")
+
+	if len(conf.Entrypoint) > 0 {
+		b.WriteString("OCI_ENTRYPOINT='" +
+			shell.EscapeSingleQuotes(shell.ArgsQuoted(conf.Entrypoint)) +
 			"'\n")
-		if err != nil {
-			return
-		}
 	} else {
-		_, err = f.WriteString("OCI_ENTRYPOINT=''\n")
-		if err != nil {
-			return
-		}
+		b.WriteString("OCI_ENTRYPOINT=''\n")
 	}
 
-	if len(cp.imgConfig.Cmd) > 0 {
-		_, err = f.WriteString("OCI_CMD='" +
-			shell.EscapeSingleQuotes(shell.ArgsQuoted(cp.imgConfig.Cmd)) +
+	if len(conf.Cmd) > 0 {
+		b.WriteString("OCI_CMD='" +
+			shell.EscapeSingleQuotes(shell.ArgsQuoted(conf.Cmd)) +
 			"'\n")
-		if err != nil {
-			return
-		}
 	} else {
-		_, err = f.WriteString("OCI_CMD=''\n")
-		if err != nil {
-			return
-		}
+		b.WriteString("OCI_CMD=''\n")
 	}
 
 	// prependCmd is a set of shell commands necessary to prepend each CMD entry to $@
 	prependCmd := ""
-	for i := len(cp.imgConfig.Cmd) - 1; i >= 0; i-- {
-		prependCmd = prependCmd + fmt.Sprintf("set -- '%s' \"$@\"\n", shell.EscapeSingleQuotes(cp.imgConfig.Cmd[i]))
+	for i := len(conf.Cmd) - 1; i >= 0; i-- {
+		prependCmd = prependCmd + fmt.Sprintf("set -- '%s' \"$@\"\n", shell.EscapeSingleQuotes(conf.Cmd[i]))
 	}
 	// prependCmd is a set of shell commands necessary to prepend each ENTRYPOINT entry to $@
 	prependEP := ""
-	for i := len(cp.imgConfig.Entrypoint) - 1; i >= 0; i-- {
-		prependEP = prependEP + fmt.Sprintf("set -- '%s' \"$@\"\n", shell.EscapeSingleQuotes(cp.imgConfig.Entrypoint[i]))
+	for i := len(conf.Entrypoint) - 1; i >= 0; i-- {
+		prependEP = prependEP + fmt.Sprintf("set -- '%s' \"$@\"\n", shell.EscapeSingleQuotes(conf.Entrypoint[i]))
 	}
 
 	data := ociRunscriptData{
@@ -477,69 +497,46 @@ func (cp *OCIConveyorPacker) insertRunScript() (err error) {
 
 	tmpl, err := template.New("runscript").Parse(ociRunscript)
 	if err != nil {
-		return fmt.Errorf("while parsing runscript template: %w", err)
+		return "", fmt.Errorf("while parsing runscript template: %w", err)
 	}
 
-	var runscript bytes.Buffer
-	err = tmpl.Execute(&runscript, data)
-	if err != nil {
-		return fmt.Errorf("while generating runscript template: %w", err)
-	}
-
-	_, err = f.WriteString(runscript.String())
-	if err != nil {
-		return
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("while generating runscript template: %w", err)
 	}
-
-	f.Sync()
-
-	err = os.Chmod(cp.b.RootfsPath+"/.singularity.d/runscript", 0o755)
-	if err != nil {
-		return
-	}
-
-	return nil
+	return b.String(), nil
 }
 
 func (cp *OCIConveyorPacker) insertEnv() (err error) {
-	f, err := os.Create(cp.b.RootfsPath + "/.singularity.d/env/10-docker2singularity.sh")
+	err = os.WriteFile(cp.b.RootfsPath+"/.singularity.d/env/10-docker2singularity.sh", []byte(OCIEnvironment(cp.imgConfig)), 0o755)
 	if err != nil {
 		return
 	}
 
-	defer f.Close()
+	return os.Chmod(cp.b.RootfsPath+"/.singularity.d/env/10-docker2singularity.sh", 0o755)
+}
 
-	_, err = f.WriteString("#!/bin/sh\n")
-	if err != nil {
-		return
-	}
+// OCIEnvironment returns the environment script of a container built from
+// an OCI image with the configuration conf, exporting its ENV variables.
+// The values are quoted so they are exported verbatim, as the OCI runtimes
+// do. A value already set in the environment takes precedence, except for
+// PATH.
+func OCIEnvironment(conf imgspecv1.ImageConfig) string {
+	var b strings.Builder
 
-	for _, element := range cp.imgConfig.Env {
-		export := ""
+	b.WriteString("#!/bin/sh\n")
+
+	for _, element := range conf.Env {
 		envParts := strings.SplitN(element, "=", 2)
 		if len(envParts) == 1 {
-			export = fmt.Sprintf("export %s=\"${%s:-}\"\n", envParts[0], envParts[0])
+			fmt.Fprintf(&b, "export %s=\"${%s:-}\"\n", envParts[0], envParts[0])
+		} else if envParts[0] == "PATH" {
+			fmt.Fprintf(&b, "export %s=%s\n", envParts[0], shell.Quote(envParts[1]))
 		} else {
-			if envParts[0] == "PATH" {
-				export = fmt.Sprintf("export %s=%q\n", envParts[0], shell.Escape(envParts[1]))
-			} else {
-				export = fmt.Sprintf("export %s=\"${%s:-%q}\"\n", envParts[0], envParts[0], shell.Escape(envParts[1]))
-			}
-		}
-		_, err = f.WriteString(export)
-		if err != nil {
-			return
+			fmt.Fprintf(&b, "test -n \"${%s:-}\" || %s=%s\n", envParts[0], envParts[0], shell.Quote(envParts[1]))
+			fmt.Fprintf(&b, "export %s\n", envParts[0])
 		}
 	}
-
-	f.Sync()
-
-	err = os.Chmod(cp.b.RootfsPath+"/.singularity.d/env/10-docker2singularity.sh", 0o755)
-	if err != nil {
-		return
-	}
-
-	return nil
+	return b.String()
 }
 
 func (cp *OCIConveyorPacker) insertOCILabels() (err error) {
@@ -17,6 +17,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/apptainer/apptainer/internal/pkg/build/sources"
@@ -24,6 +25,7 @@ import (
 	testCache "github.com/apptainer/apptainer/internal/pkg/test/tool/cache"
 	"github.com/apptainer/apptainer/pkg/build/types"
 	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 const (
@@ -283,6 +285,44 @@ func TestOCIPacker(t *testing.T) {
 	}
 }
 
+func TestOCIEnvironment(t *testing.T) {
+	conf := imgspecv1.ImageConfig{
+		Env: []string{"PATH=/usr/bin:/bin", "FOO=bar baz", "QUOTE=it's \"$x\"\n", "EMPTY"},
+	}
+	want := "#!/bin/sh\n" +
+		"export PATH=/usr/bin:/bin\n" +
+		"test -n \"${FOO:-}\" || FOO='bar baz'\n" +
+		"export FOO\n" +
+		"test -n \"${QUOTE:-}\" || QUOTE='it'\"'\"'s \"$x\"\n'\n" +
+		"export QUOTE\n" +
+		"export EMPTY=\"${EMPTY:-}\"\n"
+	if got := sources.OCIEnvironment(conf); got != want {
+		t.Errorf("unexpected environment script:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestOCIRunscript(t *testing.T) {
+	conf := imgspecv1.ImageConfig{
+		Entrypoint: []string{"/entrypoint.sh", "--verbose"},
+		Cmd:        []string{"serve"},
+	}
+	runscript, err := sources.OCIRunscript(conf)
+	if err != nil {
+		t.Fatalf("while generating runscript: %s", err)
+	}
+	for _, s := range []string{
+		"#!/bin/sh\n",
+		"OCI_ENTRYPOINT='\"/entrypoint.sh\" \"--verbose\"'\n",
+		"OCI_CMD='\"serve\"'\n",
+		"set -- '/entrypoint.sh' \"$@\"\n",
+		"set -- 'serve' \"$@\"\n",
+	} {
+		if !strings.Contains(runscript, s) {
+			t.Errorf("runscript doesn't contain %q:\n%s", s, runscript)
+		}
+	}
+}
+
 func getTestTar(url string) (path string, err error) {
 	dl, err := os.CreateTemp("", "oci-test")
 	if err != nil {
@@ -33,9 +33,9 @@ func (cp *OrasConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err err
 	// full uri for name determination and output
 	fullRef := "oras:" + ref
 
-	imagePath, err := oras.Pull(ctx, b.Opts.ImgCache, fullRef, b.Opts.TmpDir, b.Opts.DockerAuthConfig, b.Opts.NoHTTPS)
+	imagePath, err := oras.Pull(ctx, b.Opts.ImgCache, fullRef, b.Opts.TmpDir, b.Opts.DockerAuthConfig, b.Opts.NoHTTPS, "")
 	if err != nil {
-		return fmt.Errorf("while fetching library image: %v", err)
+		return fmt.Errorf("while fetching library image: %w", err)
 	}
 
 	// insert base metadata before unpacking fs
@@ -26,14 +26,17 @@ import (
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/namespaces"
 	"github.com/containers/image/v5/types"
+	"github.com/docker/go-units"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/opencontainers/umoci"
+	"github.com/opencontainers/umoci/oci/cas"
 	umocilayer "github.com/opencontainers/umoci/oci/layer"
 	"github.com/opencontainers/umoci/pkg/idtools"
 )
 
-// unpackRootfs extracts all of the layers of the given image reference into the rootfs of the provided bundle
-func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageReference, sysCtx *types.SystemContext) (err error) {
+// unpackOptions returns the umoci options to unpack the layers of an image,
+// as root or as an unprivileged user.
+func unpackOptions() (*umocilayer.UnpackOptions, error) {
 	var mapOptions umocilayer.MapOptions
 
 	loggerLevel := sylog.GetLevel()
@@ -60,17 +63,27 @@ func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageRe
 
 		uidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Geteuid()))
 		if err != nil {
-			return fmt.Errorf("error parsing uidmap: %s", err)
+			return nil, fmt.Errorf("error parsing uidmap: %s", err)
 		}
 		mapOptions.UIDMappings = append(mapOptions.UIDMappings, uidMap)
 
 		gidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Getegid()))
 		if err != nil {
-			return fmt.Errorf("error parsing gidmap: %s", err)
+			return nil, fmt.Errorf("error parsing gidmap: %s", err)
 		}
 		mapOptions.GIDMappings = append(mapOptions.GIDMappings, gidMap)
 	}
 
+	return &umocilayer.UnpackOptions{MapOptions: mapOptions}, nil
+}
+
+// unpackRootfs extracts all of the layers of the given image reference into the rootfs of the provided bundle
+func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageReference, sysCtx *types.SystemContext) (err error) {
+	unpackOptions, err := unpackOptions()
+	if err != nil {
+		return err
+	}
+
 	engineExt, err := umoci.OpenLayout(b.TmpDir)
 	if err != nil {
 		return fmt.Errorf("error opening layout: %s", err)
@@ -95,12 +108,63 @@ func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageRe
 	os.RemoveAll(b.RootfsPath)
 
 	// Unpack root filesystem
-	unpackOptions := umocilayer.UnpackOptions{MapOptions: mapOptions}
-	err = umocilayer.UnpackRootfs(ctx, engineExt, b.RootfsPath, manifest, &unpackOptions)
+	err = umocilayer.UnpackRootfs(ctx, engineExt, b.RootfsPath, manifest, unpackOptions)
 	if err != nil {
 		return fmt.Errorf("error unpacking rootfs: %s", err)
 	}
 
+	return finishRootfs(b)
+}
+
+// unpackStream extracts the layers of manifest into the rootfs of the
+// provided bundle while they are fetched, engine waiting for each layer
+// to be fetched before it's extracted.
+func unpackStream(ctx context.Context, b *sytypes.Bundle, engine cas.Engine, manifest imgspecv1.Manifest) error {
+	if err := checkUnpackSpace(b.RootfsPath, manifest); err != nil {
+		return err
+	}
+
+	unpackOptions, err := unpackOptions()
+	if err != nil {
+		return err
+	}
+
+	// UnpackRootfs from umoci v0.4.2 expects a path to a non-existing directory
+	os.RemoveAll(b.RootfsPath)
+
+	if err := umocilayer.UnpackRootfs(ctx, engine, b.RootfsPath, manifest, unpackOptions); err != nil {
+		return fmt.Errorf("error unpacking rootfs: %w", err)
+	}
+	return nil
+}
+
+// checkUnpackSpace reports the space needed to extract the layers of
+// manifest into dir, and fails early if the filesystem of dir can't hold
+// them: extracted layers take at least their compressed size.
+func checkUnpackSpace(dir string, manifest imgspecv1.Manifest) error {
+	var size int64
+	for _, l := range manifest.Layers {
+		size += l.Size
+	}
+
+	avail, err := fs.AvailableSpace(dir)
+	if err != nil {
+		sylog.Debugf("Could not get available space in %s: %s", dir, err)
+		return nil
+	}
+
+	sylog.Infof("Extracting %d layers of %s compressed to %s (%s available)",
+		len(manifest.Layers), units.BytesSize(float64(size)), dir, units.BytesSize(float64(avail)))
+	if avail < size {
+		return fmt.Errorf("not enough space in %s to extract the image: %s available, more than %s required",
+			dir, units.BytesSize(float64(avail)), units.BytesSize(float64(size)))
+	}
+	return nil
+}
+
+// finishRootfs applies the --fix-perms option to the extracted rootfs of
+// the provided bundle, or checks for restrictive permissions of a sandbox.
+func finishRootfs(b *sytypes.Bundle) error {
 	// If the `--fix-perms` flag was used, then modify the permissions so that
 	// content has owner rwX and we're done
 	if b.Opts.FixPerms {
@@ -118,7 +182,7 @@ func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageRe
 	}
 
 	// No `--fix-perms` and no sandbox... we are fine
-	return err
+	return nil
 }
 
 // checkPerms will work through the rootfs of this bundle, and find if any
@@ -56,6 +56,7 @@ func unpackSIF(b *types.Bundle, img *image.Image) (err error) {
 		}
 
 		s := unpacker.NewSquashfs()
+		s.TmpDir = b.TmpDir
 
 		// extract root filesystem
 		if err := s.ExtractAll(reader, b.RootfsPath); err != nil {
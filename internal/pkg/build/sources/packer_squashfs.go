@@ -34,6 +34,7 @@ func (p *SquashfsPacker) Pack(context.Context) (*types.Bundle, error) {
 	}
 
 	s := unpacker.NewSquashfs()
+	s.TmpDir = p.b.TmpDir
 
 	// extract root filesystem
 	if err := s.ExtractAll(reader, p.b.RootfsPath); err != nil {
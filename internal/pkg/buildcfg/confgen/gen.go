@@ -33,6 +33,21 @@ type Define struct {
 	Words []string
 }
 
+// Name returns the name of the configuration variable.
+func (d Define) Name() string {
+	return d.Words[1]
+}
+
+// IsString returns whether the configuration variable is a string.
+func (d Define) IsString() bool {
+	for _, w := range d.Words[2:] {
+		if strings.HasPrefix(w, "\"") || strings.HasPrefix(w, "`") {
+			return true
+		}
+	}
+	return false
+}
+
 // WriteLine writes a line of configuration.
 func (d Define) WriteLine() (s string) {
 	s = d.Words[2]
@@ -215,6 +230,16 @@ func relocatePath(original string) string {
 func IsReproducibleBuild() bool {
 	return SOURCEDIR == "REPRODUCIBLE_BUILD"
 }
+
+// Values returns the string configuration variables by name, with the
+// relocatable directories relocated.
+func Values() map[string]string {
+	return map[string]string{
+{{- range $i, $d := .Defines }}{{ if $d.IsString }}
+		"{{$d.Name}}": {{$d.Name}},
+{{- end }}{{ end }}
+	}
+}
 `))
 
 func main() {
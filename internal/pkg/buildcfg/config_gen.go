@@ -9,4 +9,12 @@
 
 package buildcfg
 
+import _ "embed"
+
 //go:generate "${GO_TOOL}" run confgen/gen.go "${BUILDDIR}/config.h"
+
+// ConfigSource is the source of the generated build configuration, added
+// to the plugin SDK fetched from the Go module proxy to compile plugins.
+//
+//go:embed config.go
+var ConfigSource []byte
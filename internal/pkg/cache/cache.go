@@ -17,12 +17,13 @@ import (
 	"path"
 	"path/filepath"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/pkg/syfs"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
 )
 
 var errInvalidCacheType = errors.New("invalid cache type")
@@ -33,6 +34,9 @@ const (
 	DirEnv = "APPTAINER_CACHEDIR"
 	// DisableEnv specifies whether the image should be used
 	DisableEnv = "APPTAINER_DISABLE_CACHE"
+	// MaxSizeEnv specifies the environment variable which can set the
+	// maximum size of the cache
+	MaxSizeEnv = "APPTAINER_CACHE_MAX_SIZE"
 	// SubDirName specifies the name of the directory relative to the
 	// ParentDir specified when the cache is created.
 	// By default the cache will be placed at "~/.apptainer/cache" which
@@ -51,6 +55,26 @@ const (
 	OrasCacheType = "oras"
 	// NetCacheType specifies the cache holds images pulled from http(s) internet sources
 	NetCacheType = "net"
+	// PluginCacheType specifies the cache holds images pulled from the
+	// URI schemes handled by plugins
+	PluginCacheType = "plugin"
+	// InspectCacheType specifies the cache holds the metadata of remote
+	// images recorded by inspect --cache-metadata
+	InspectCacheType = "inspect"
+	// RootfsCacheType specifies the cache holds the root filesystems
+	// extracted from the tar archives run as images
+	RootfsCacheType = "rootfs"
+
+	// GPUDirName specifies the name of the directory, relative to the cache
+	// root directory, holding the host GPU files resolved for --nv and --rocm.
+	GPUDirName = "gpu"
+
+	// MetaDirName specifies the name of the directory, relative to the cache
+	// root directory, holding the source and last use time of the entries.
+	MetaDirName = "meta"
+
+	// tmpPrefix is the prefix of the temporary files of entries being created
+	tmpPrefix = "tmp_"
 )
 
 var (
@@ -61,11 +85,18 @@ var (
 		ShubCacheType,
 		OrasCacheType,
 		NetCacheType,
+		PluginCacheType,
+		InspectCacheType,
 	}
 	// OciCacheTypes specifies the OCI cache types.
 	OciCacheTypes = []string{
 		OciBlobCacheType,
 	}
+	// DirCacheTypes specifies the cache types whose entries are
+	// directories.
+	DirCacheTypes = []string{
+		RootfsCacheType,
+	}
 )
 
 // Config describes the requested configuration requested when a new handle is created,
@@ -75,6 +106,11 @@ type Config struct {
 	ParentDir string
 	// Disable specifies whether the user request the cache to be disabled by default.
 	Disable bool
+	// MaxSize specifies the maximum size of the cache in bytes, 0 means no limit.
+	MaxSize int64
+	// Offline specifies whether network access is disabled, the images
+	// being only taken from the cache.
+	Offline bool
 }
 
 // Handle is an structure representing the image cache, it's location and subdirectories
@@ -89,6 +125,13 @@ type Handle struct {
 	rootDir string
 	// If the cache is disabled
 	disabled bool
+	// maxSize is the maximum size of the cache in bytes, 0 means no limit
+	maxSize int64
+	// offline is true if the images are only taken from the cache
+	offline bool
+	// blobLockFd holds a shared lock on the OCI blob cache while it is
+	// used by this process, so that it isn't evicted, or -1
+	blobLockFd int
 }
 
 func (h *Handle) GetFileCacheDir(cacheType string) (cacheDir string, err error) {
@@ -98,10 +141,14 @@ func (h *Handle) GetFileCacheDir(cacheType string) (cacheDir string, err error)
 	return h.getCacheTypeDir(cacheType), nil
 }
 
+// GetOciCacheDir returns the directory of an OCI cache type. The cache
+// type is then considered in use by this process and isn't evicted to
+// make room for new entries.
 func (h *Handle) GetOciCacheDir(cacheType string) (cacheDir string, err error) {
 	if !stringInSlice(cacheType, OciCacheTypes) {
 		return "", errInvalidCacheType
 	}
+	h.lockBlobs()
 	return h.getCacheTypeDir(cacheType), nil
 }
 
@@ -111,7 +158,7 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 		return nil, nil
 	}
 
-	e = &Entry{}
+	e = &Entry{CacheType: cacheType, lockFd: -1, handle: h}
 
 	cacheDir, err := h.GetFileCacheDir(cacheType)
 	if err != nil {
@@ -119,6 +166,7 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 	}
 
 	e.Path = filepath.Join(cacheDir, hash)
+	e.metaPath = h.getMetaPath(cacheType, hash)
 
 	// If there is a directory it's from an older version of Apptainer
 	// We need to remove it as we work with single files per hash only now
@@ -140,7 +188,7 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 
 	if !pathExists {
 		e.Exists = false
-		f, err := fs.MakeTmpFile(cacheDir, "tmp_", 0o700)
+		f, err := fs.MakeTmpFile(cacheDir, tmpPrefix, 0o700)
 		if err != nil {
 			return nil, err
 		}
@@ -149,6 +197,13 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 			return nil, err
 		}
 		e.TmpPath = f.Name()
+		// Lock the temporary file until the entry is finalized, so it
+		// isn't removed by a concurrent cache clean
+		e.lockFd, err = lock.Exclusive(e.TmpPath)
+		if err != nil {
+			e.lockFd = -1
+			sylog.Debugf("Could not lock cache temporary file '%s': %v", e.TmpPath, err)
+		}
 		return e, nil
 	}
 
@@ -159,50 +214,97 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 
 	// It exists in the cache and it's a file. Caller can use the Path directly
 	e.Exists = true
+	if err := touchMeta(e.metaPath); err != nil {
+		sylog.Debugf("Could not record last use of cache entry %s: %v", e.Path, err)
+	}
 	return e, nil
 }
 
-func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error) {
+// LookupEntry returns the path of the entry named hash of the file cache
+// type cacheType, and whether it exists. Unlike GetEntry, nothing is
+// written to the cache.
+func (h *Handle) LookupEntry(cacheType string, hash string) (string, bool) {
+	if h.disabled || !stringInSlice(cacheType, FileCacheTypes) {
+		return "", false
+	}
+	path := filepath.Join(h.getCacheTypeDir(cacheType), hash)
+	return path, fs.IsFile(path)
+}
+
+// CleanCache removes the entries of the cache type cacheType selected by
+// filter, or only reports them if dryRun is true. It returns the entries
+// removed, or which would be removed. Entries being created by a pull are
+// skipped.
+func (h *Handle) CleanCache(cacheType string, dryRun bool, filter CleanFilter) ([]EntryInfo, error) {
 	dir := h.getCacheTypeDir(cacheType)
 
 	files, err := os.ReadDir(dir)
 	if (err != nil && os.IsNotExist(err)) || len(files) == 0 {
 		sylog.Infof("No cached files to remove at %s", dir)
-		return nil
+		return nil, nil
+	}
+
+	if cacheType == OciBlobCacheType && !dryRun {
+		unlock, ok := h.lockBlobsExclusive()
+		if !ok {
+			sylog.Infof("Skipping %s cache: in use by a pull or a build", cacheType)
+			return nil, nil
+		}
+		defer unlock()
 	}
 
+	var removed []EntryInfo
 	errCount := 0
 	for _, f := range files {
-		if days >= 0 {
-			fi, err := f.Info()
-			if err != nil {
-				sylog.Errorf("Could not get info for cache entry '%s': %v", f.Name(), err)
-				errCount = errCount + 1
-				continue
-			}
-
-			if time.Since(fi.ModTime()) < time.Duration(days*24)*time.Hour {
-				sylog.Debugf("Skipping %s: less that %d days old", f.Name(), days)
-				continue
-			}
+		info, err := h.entryInfo(cacheType, f)
+		if err != nil {
+			sylog.Errorf("Could not get info for cache entry '%s': %v", f.Name(), err)
+			errCount = errCount + 1
+			continue
+		}
+		if skip := filter.skip(info); skip != "" {
+			sylog.Debugf("Skipping %s: %s", f.Name(), skip)
+			continue
 		}
 
+		entryPath := path.Join(dir, f.Name())
+		if strings.HasPrefix(f.Name(), tmpPrefix) && inUse(entryPath) {
+			sylog.Infof("Skipping %s cache entry %s: being created by a pull", cacheType, f.Name())
+			continue
+		}
+
+		removed = append(removed, info)
+		if dryRun {
+			continue
+		}
 		sylog.Infof("Removing %s cache entry: %s", cacheType, f.Name())
-		if !dryRun {
-			// We RemoveAll in case the entry is a directory from Singularity (prior to 3.6)
-			err := os.RemoveAll(path.Join(dir, f.Name()))
-			if err != nil {
-				sylog.Errorf("Could not remove cache entry '%s': %v", f.Name(), err)
-				errCount = errCount + 1
-			}
+		// We RemoveAll in case the entry is a directory from Singularity (prior to 3.6),
+		// extracted root filesystems may hold directories without write permission
+		remove := os.RemoveAll
+		if stringInSlice(cacheType, DirCacheTypes) {
+			remove = fs.ForceRemoveAll
+		}
+		if err := remove(entryPath); err != nil {
+			sylog.Errorf("Could not remove cache entry '%s': %v", f.Name(), err)
+			errCount = errCount + 1
+			continue
+		}
+		if err := os.RemoveAll(h.entryMetaPath(cacheType, f.Name())); err != nil {
+			sylog.Debugf("Could not remove metadata of cache entry '%s': %v", f.Name(), err)
 		}
 	}
 
 	if errCount > 0 {
-		return fmt.Errorf("failed to remove %d cache entries", errCount)
+		return removed, fmt.Errorf("failed to remove %d cache entries", errCount)
 	}
 
-	return err
+	return removed, nil
+}
+
+// MaxSize returns the maximum size of the cache in bytes, 0 means no
+// limit.
+func (h *Handle) MaxSize() int64 {
+	return h.maxSize
 }
 
 // IsDisabled returns true if the cache is disabled
@@ -210,14 +312,56 @@ func (h *Handle) IsDisabled() bool {
 	return h.disabled
 }
 
+// ParentDir returns the directory holding the cache.
+func (h *Handle) ParentDir() string {
+	return h.parentDir
+}
+
+// GPUCacheDir returns the directory holding the host GPU files resolved
+// for --nv and --rocm, an empty string if the cache is disabled.
+func (h *Handle) GPUCacheDir() string {
+	if h.disabled {
+		return ""
+	}
+	return path.Join(h.rootDir, GPUDirName)
+}
+
+// RootfsCacheDir returns the directory holding the root filesystems
+// extracted from tar archives, an empty string if the cache is disabled.
+func (h *Handle) RootfsCacheDir() string {
+	if h.disabled {
+		return ""
+	}
+	return h.getCacheTypeDir(RootfsCacheType)
+}
+
 // Return the directory for a specific CacheType
 func (h *Handle) getCacheTypeDir(cacheType string) string {
 	return path.Join(h.rootDir, cacheType)
 }
 
+// Return the metadata file of an entry of a specific CacheType
+func (h *Handle) getMetaPath(cacheType, name string) string {
+	return path.Join(h.rootDir, MetaDirName, cacheType, name)
+}
+
+// Return the metadata to remove with an entry of a specific CacheType. The
+// sources of the images in the OCI blob cache are removed with any of its
+// entries.
+func (h *Handle) entryMetaPath(cacheType, name string) string {
+	if cacheType == OciBlobCacheType {
+		return h.getMetaPath(cacheType, "")
+	}
+	return h.getMetaPath(cacheType, name)
+}
+
 // New initializes a cache within the directory specified in Config.ParentDir
 func New(cfg Config) (h *Handle, err error) {
-	h = new(Handle)
+	h = &Handle{
+		maxSize:    cfg.MaxSize,
+		offline:    cfg.Offline,
+		blobLockFd: -1,
+	}
 
 	// Check whether the cache is disabled by the user.
 	// strconv.ParseBool("") raises an error so we cannot directly use strconv.ParseBool(os.Getenv(DisableEnv))
@@ -274,7 +418,7 @@ func New(cfg Config) (h *Handle, err error) {
 		return nil, fmt.Errorf("failed initializing caching directory: %s", err)
 	}
 	// Initialize the subdirectories of the cache
-	for _, ct := range FileCacheTypes {
+	for _, ct := range append(FileCacheTypes, DirCacheTypes...) {
 		dir := h.getCacheTypeDir(ct)
 		if err = initCacheDir(dir); err != nil {
 			return nil, fmt.Errorf("failed initializing caching directory: %s", err)
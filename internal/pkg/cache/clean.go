@@ -0,0 +1,150 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// CleanFilter selects the cache entries removed by CleanCache. An entry
+// is removed when it is selected by all the filters set.
+type CleanFilter struct {
+	// Days selects the entries created at least Days days ago, if not
+	// negative.
+	Days int
+	// Age selects the entries not used for at least Age, if not zero.
+	Age time.Duration
+	// LargerThan selects the entries larger than LargerThan bytes, if not
+	// zero.
+	LargerThan int64
+	// Name selects the entries pulled from a source reference matching
+	// this glob pattern, where * also matches '/', if not empty.
+	Name string
+}
+
+// EntryInfo describes a cache entry for a cache list or clean.
+type EntryInfo struct {
+	// Type is the cache type of the entry.
+	Type string `json:"type"`
+	// Name is the name of the entry in the cache type directory.
+	Name string `json:"name"`
+	// Source is the reference the entry was pulled from, if recorded.
+	Source string `json:"source,omitempty"`
+	// Digest is the digest of the image the entry was pulled from, or of
+	// the entry content, if recorded.
+	Digest string `json:"digest,omitempty"`
+	// Size is the size of the entry in bytes.
+	Size int64 `json:"size"`
+	// Created is the time the entry was created.
+	Created time.Time `json:"created"`
+	// LastUsed is the last time the entry was used by a pull or a run.
+	LastUsed time.Time `json:"lastUsed"`
+	// Referrers are the references of the images using an OCI blob.
+	Referrers []string `json:"referrers,omitempty"`
+}
+
+// skip returns why an entry is not selected by the filter, or an empty
+// string if it is.
+func (f CleanFilter) skip(e EntryInfo) string {
+	if f.Days >= 0 && time.Since(e.Created) < time.Duration(f.Days*24)*time.Hour {
+		return fmt.Sprintf("less than %d days old", f.Days)
+	}
+	if f.Age > 0 && time.Since(e.LastUsed) < f.Age {
+		return fmt.Sprintf("used less than %s ago", f.Age)
+	}
+	if f.LargerThan > 0 && e.Size <= f.LargerThan {
+		return fmt.Sprintf("not larger than %d bytes", f.LargerThan)
+	}
+	if f.Name != "" && (e.Source == "" || !matchSource(f.Name, e.Source)) {
+		return fmt.Sprintf("source doesn't match %q", f.Name)
+	}
+	return ""
+}
+
+// matchSource returns if the source reference matches the glob pattern,
+// where * matches any sequence of characters including '/'.
+func matchSource(pattern, source string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, `\*`, ".*")
+	re = strings.ReplaceAll(re, `\?`, ".")
+	matched, err := regexp.MatchString("^"+re+"$", source)
+	return err == nil && matched
+}
+
+// entryInfo returns the information of the entry f of cacheType.
+func (h *Handle) entryInfo(cacheType string, f fs.DirEntry) (EntryInfo, error) {
+	e := EntryInfo{Type: cacheType, Name: f.Name()}
+
+	fi, err := f.Info()
+	if err != nil {
+		return e, err
+	}
+	e.Created = fi.ModTime()
+	e.LastUsed = fi.ModTime()
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		if atime := time.Unix(st.Atim.Unix()); atime.After(e.LastUsed) {
+			e.LastUsed = atime
+		}
+	}
+
+	e.Size = fi.Size()
+	if fi.IsDir() {
+		e.Size, err = dirSize(path.Join(h.getCacheTypeDir(cacheType), f.Name()))
+		if err != nil {
+			return e, err
+		}
+	}
+
+	// the metadata file records the last use even on filesystems
+	// mounted with noatime
+	if meta, lastUsed, err := readMeta(h.getMetaPath(cacheType, f.Name())); err == nil {
+		e.LastUsed = lastUsed
+		e.Source = meta.Source
+		e.Digest = meta.Digest
+	}
+	return e, nil
+}
+
+// dirSize returns the total size of the files in dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// inUse returns if the temporary file of an entry is locked by a pull.
+func inUse(file string) bool {
+	fd, err := unix.Open(file, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return false
+	}
+	defer unix.Close(fd)
+	return unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB) == unix.EWOULDBLOCK
+}
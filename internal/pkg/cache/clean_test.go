@@ -0,0 +1,132 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCleanCache(t *testing.T) {
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	// create entries as a pull does
+	addEntry := func(name, source string, size int, lastUsed time.Time) {
+		e, err := h.GetEntry(NetCacheType, name)
+		if err != nil {
+			t.Fatalf("failed to get entry %s: %v", name, err)
+		}
+		if err := os.WriteFile(e.TmpPath, make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		e.Source = source
+		if err := e.Finalize(); err != nil {
+			t.Fatalf("failed to finalize entry %s: %v", name, err)
+		}
+		if err := os.Chtimes(e.metaPath, lastUsed, lastUsed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	addEntry("old", "https://example.com/old.sif", 10, now.Add(-48*time.Hour))
+	addEntry("large", "https://example.com/large.sif", 1000, now)
+	addEntry("recent", "https://example.org/recent.sif", 10, now.Add(-48*time.Hour))
+
+	// a hit records the last use
+	if e, err := h.GetEntry(NetCacheType, "recent"); err != nil || !e.Exists {
+		t.Fatalf("failed to get entry recent: %v", err)
+	}
+
+	// an entry being pulled is never removed
+	pulling, err := h.GetEntry(NetCacheType, "pulling")
+	if err != nil {
+		t.Fatalf("failed to get entry pulling: %v", err)
+	}
+	defer pulling.CleanTmp()
+
+	tests := []struct {
+		name     string
+		filter   CleanFilter
+		expected []string
+	}{
+		{
+			name:     "age",
+			filter:   CleanFilter{Age: 24 * time.Hour},
+			expected: []string{"old"},
+		},
+		{
+			name:     "larger than",
+			filter:   CleanFilter{LargerThan: 100},
+			expected: []string{"large"},
+		},
+		{
+			name:     "name",
+			filter:   CleanFilter{Name: "https://*.com/*"},
+			expected: []string{"large", "old"},
+		},
+		{
+			name:     "name and age",
+			filter:   CleanFilter{Name: "*example*", Age: 24 * time.Hour},
+			expected: []string{"old"},
+		},
+		{
+			name:     "days",
+			filter:   CleanFilter{Days: 1},
+			expected: nil,
+		},
+		{
+			name:     "all",
+			filter:   CleanFilter{},
+			expected: []string{"large", "old", "recent"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := h.CleanCache(NetCacheType, true, tt.filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name)
+			}
+			sort.Strings(names)
+			if len(names) != len(tt.expected) {
+				t.Fatalf("unexpected entries %v, expected %v", names, tt.expected)
+			}
+			for i := range names {
+				if names[i] != tt.expected[i] {
+					t.Fatalf("unexpected entries %v, expected %v", names, tt.expected)
+				}
+			}
+		})
+	}
+
+	// remove the old entry and its metadata
+	if _, err := h.CleanCache(NetCacheType, false, CleanFilter{Age: 24 * time.Hour}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir, _ := h.GetFileCacheDir(NetCacheType)
+	if _, err := os.Stat(filepath.Join(dir, "old")); !os.IsNotExist(err) {
+		t.Errorf("old entry not removed")
+	}
+	if _, err := os.Stat(h.getMetaPath(NetCacheType, "old")); !os.IsNotExist(err) {
+		t.Errorf("old entry metadata not removed")
+	}
+	if _, err := os.Stat(pulling.TmpPath); err != nil {
+		t.Errorf("temporary file of entry being pulled removed: %v", err)
+	}
+}
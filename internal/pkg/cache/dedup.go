@@ -0,0 +1,215 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	fsutil "github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/sys/unix"
+)
+
+// ErrReflinkUnsupported is returned by Dedup when the filesystem of the
+// cache doesn't support reflinks.
+var ErrReflinkUnsupported = errors.New("the filesystem of the cache doesn't support reflinks")
+
+// DedupReport is the result of the deduplication of the cache.
+type DedupReport struct {
+	// Files is the number of files of the cache examined.
+	Files int
+	// Duplicates is the number of files identical to another file of the
+	// cache, and not already hard-linked to it.
+	Duplicates int
+	// Savings is the size of the duplicates, saved by sharing their data
+	// with reflinks.
+	Savings int64
+	// Reflinked is the number of duplicates reflinked.
+	Reflinked int
+}
+
+// dedupFile is a file of the cache considered for deduplication.
+type dedupFile struct {
+	cacheType string
+	name      string
+	path      string
+	size      int64
+}
+
+// Dedup finds the identical files of the cache, having the same size and
+// digest, and reflinks them so that they share their data. If dryRun is
+// true, the duplicates are only reported. ErrReflinkUnsupported is
+// returned, with the report of the duplicates, if the filesystem doesn't
+// support reflinks.
+func (h *Handle) Dedup(dryRun bool) (DedupReport, error) {
+	var report DedupReport
+	if h.disabled {
+		return report, nil
+	}
+
+	files, err := h.dedupFiles()
+	if err != nil {
+		return report, err
+	}
+	report.Files = len(files)
+
+	bySize := make(map[int64][]dedupFile)
+	for _, f := range files {
+		if f.size > 0 {
+			bySize[f.size] = append(bySize[f.size], f)
+		}
+	}
+
+	unsupported := false
+	for _, sameSize := range bySize {
+		if len(sameSize) < 2 {
+			continue
+		}
+		byDigest := make(map[string][]dedupFile)
+		for _, f := range sameSize {
+			d, err := fileDigest(f.path)
+			if err != nil {
+				sylog.Debugf("Skipping %s cache entry %s: %v", f.cacheType, f.name, err)
+				continue
+			}
+			byDigest[d] = append(byDigest[d], f)
+		}
+
+		for _, same := range byDigest {
+			src := same[0]
+			for _, dst := range same[1:] {
+				if sameFile(src.path, dst.path) {
+					continue
+				}
+				report.Duplicates++
+				report.Savings += dst.size
+				if dryRun || unsupported {
+					continue
+				}
+				if err := h.reflink(src, dst); errors.Is(err, ErrReflinkUnsupported) {
+					unsupported = true
+				} else if err != nil {
+					sylog.Warningf("Could not reflink %s cache entry %s: %v", dst.cacheType, dst.name, err)
+				} else {
+					sylog.Debugf("Reflinked %s cache entry %s to %s cache entry %s", dst.cacheType, dst.name, src.cacheType, src.name)
+					report.Reflinked++
+				}
+			}
+		}
+	}
+
+	if unsupported {
+		return report, ErrReflinkUnsupported
+	}
+	return report, nil
+}
+
+// dedupFiles returns the files of the cache considered for deduplication:
+// the entries of the file cache types and the OCI blobs.
+func (h *Handle) dedupFiles() ([]dedupFile, error) {
+	var files []dedupFile
+	for _, cacheType := range FileCacheTypes {
+		entries, err := h.ListEntries(cacheType)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			files = append(files, dedupFile{
+				cacheType: cacheType,
+				name:      e.Name,
+				path:      path.Join(h.getCacheTypeDir(cacheType), e.Name),
+				size:      e.Size,
+			})
+		}
+	}
+
+	// don't let the blobs be evicted or cleaned meanwhile
+	h.lockBlobs()
+	blobs, err := h.blobEntries()
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range blobs {
+		files = append(files, dedupFile{
+			cacheType: OciBlobCacheType,
+			name:      b.Name,
+			path:      path.Join(h.getCacheTypeDir(OciBlobCacheType), "blobs", string(digest.SHA256), b.Name),
+			size:      b.Size,
+		})
+	}
+	return files, nil
+}
+
+// sameFile returns if two paths are the same file, e.g. hard links.
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	return err == nil && os.SameFile(fa, fb)
+}
+
+// reflink replaces the file dst by a reflink of the identical file src,
+// keeping its permissions and modification time.
+func (h *Handle) reflink(src, dst dedupFile) error {
+	in, err := os.Open(src.path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := os.Stat(dst.path)
+	if err != nil {
+		return err
+	}
+
+	// the temporary files of the blob cache are in its layout directory
+	dir := filepath.Dir(dst.path)
+	if dst.cacheType == OciBlobCacheType {
+		dir = h.getCacheTypeDir(OciBlobCacheType)
+	}
+	tmp, err := os.CreateTemp(dir, tmpPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = fsutil.CloneFile(tmp, in)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOTTY) || errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EINVAL) {
+		return ErrReflinkUnsupported
+	} else if err != nil {
+		return fmt.Errorf("could not reflink %s: %v", src.path, err)
+	}
+	if err := os.Chmod(tmp.Name(), fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), fi.ModTime(), fi.ModTime()); err != nil {
+		return err
+	}
+
+	// don't replace an entry replaced meanwhile by a pull
+	if dst.cacheType != OciBlobCacheType {
+		unlock, err := h.lockEntry(dst.cacheType, dst.name)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	if cur, err := os.Stat(dst.path); err != nil || !os.SameFile(cur, fi) {
+		return fmt.Errorf("replaced or removed meanwhile")
+	}
+	return os.Rename(tmp.Name(), dst.path)
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	// three identical entries, one of them hard-linked, and a different one
+	for _, name := range []string{"a", "b", "c"} {
+		if err := pullEntry(h, NetCacheType, name, 1024); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pullEntry(h, OrasCacheType, "d", 2048); err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := h.GetFileCacheDir(NetCacheType)
+	if err := os.Remove(filepath.Join(dir, "c")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(dir, "a"), filepath.Join(dir, "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := h.Dedup(true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := DedupReport{Files: 4, Duplicates: 1, Savings: 1024}
+	if report != expected {
+		t.Errorf("unexpected dry run report %+v, expected %+v", report, expected)
+	}
+
+	report, err = h.Dedup(false)
+	if errors.Is(err, ErrReflinkUnsupported) {
+		if report != expected {
+			t.Errorf("unexpected report %+v, expected %+v", report, expected)
+		}
+		t.Skip("reflinks not supported by the filesystem")
+	} else if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected.Reflinked = 1
+	if report != expected {
+		t.Errorf("unexpected report %+v, expected %+v", report, expected)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if b, err := os.ReadFile(filepath.Join(dir, name)); err != nil || len(b) != 1024 {
+			t.Errorf("unexpected content of entry %s after dedup: %v", name, err)
+		}
+	}
+}
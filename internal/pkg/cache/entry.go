@@ -13,11 +13,18 @@ package cache
 import (
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
 )
 
+// entryLockSuffix is the suffix of the name of the lock files of the
+// entries, in the pull lock directory of their cache type.
+const entryLockSuffix = ".entry"
+
 // Entry is a structure representing an entry in the cache. An entry is a file under the
 // CacheType subdir within the Cache rootDir
 type Entry struct {
@@ -31,6 +38,22 @@ type Entry struct {
 	// tmpPath is the temporary location that should be used for a new cache entry as it
 	// is created
 	TmpPath string
+	// Source is the reference the entry is pulled from, recorded with the
+	// entry when it is finalized
+	Source string
+	// Digest is the digest of the image the entry is pulled from, recorded
+	// with the entry when it is finalized. The digest of the entry content
+	// is recorded if not set
+	Digest string
+
+	// metaPath is the location of the file recording the source and the
+	// last use of the entry
+	metaPath string
+	// lockFd holds a lock on the temporary file while the entry is created,
+	// so that it isn't removed by a cache clean, or -1
+	lockFd int
+	// handle is the cache the entry belongs to
+	handle *Handle
 }
 
 // Finalize an entry by renaming it to its permanent path atomically
@@ -39,15 +62,43 @@ func (e *Entry) Finalize() error {
 	// This is a file, so we won't have an IsExist error since...
 	//   If newpath already exists and is not a directory, Rename replaces it.
 	//   https://golang.org/pkg/os/#Rename
-	err := os.Rename(e.TmpPath, e.Path)
+	if e.handle != nil && e.handle.maxSize > 0 {
+		unlock, err := e.handle.makeRoom(e)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	// the metadata is recorded first, so that the entry never appears
+	// without its provenance
+	content, err := fileDigest(e.TmpPath)
+	if err != nil {
+		sylog.Debugf("Could not compute digest of cache entry %s: %v", e.Path, err)
+	}
+	if e.Digest == "" {
+		e.Digest = content
+	}
+	if e.handle != nil {
+		unlock, err := e.handle.lockEntry(e.CacheType, filepath.Base(e.Path))
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	if err := writeMeta(e.metaPath, entryMeta{Source: e.Source, Digest: e.Digest, Content: content}); err != nil {
+		sylog.Debugf("Could not record provenance of cache entry %s: %v", e.Path, err)
+	}
+	err = os.Rename(e.TmpPath, e.Path)
 	if err != nil {
 		return fmt.Errorf("could not finalize cached file: %v", err)
 	}
+	e.release()
 	return nil
 }
 
 // CleanTmp should be defer'd when an Entry is created and will remove any temporary file
 func (e *Entry) CleanTmp() {
+	defer e.release()
 	// If there is no TmpPath / file there then there is nothing to clean up
 	if e.TmpPath == "" || !fs.IsFile(e.TmpPath) {
 		return
@@ -57,3 +108,29 @@ func (e *Entry) CleanTmp() {
 		sylog.Errorf("Could not remove cache temporary file '%s': %v", e.TmpPath, err)
 	}
 }
+
+// release releases the lock on the temporary file, if held
+func (e *Entry) release() {
+	if e.lockFd < 0 {
+		return
+	}
+	if err := lock.Release(e.lockFd); err != nil {
+		sylog.Debugf("Could not release lock of cache temporary file '%s': %v", e.TmpPath, err)
+	}
+	e.lockFd = -1
+}
+
+// lockEntry takes an exclusive lock on a cache entry, so that it isn't
+// replaced by a pull while it is verified. It returns a function releasing
+// the lock.
+func (h *Handle) lockEntry(cacheType, name string) (func(), error) {
+	dir := path.Join(h.rootDir, LockDirName, cacheType)
+	if err := fs.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("could not create entry lock directory: %v", err)
+	}
+	unlock, err := waitLock(path.Join(dir, name+entryLockSuffix), "")
+	if err != nil {
+		return nil, fmt.Errorf("could not lock cache entry %s: %v", name, err)
+	}
+	return unlock, nil
+}
@@ -0,0 +1,434 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	fsutil "github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// exportManifestName is the name of the first file of a cache archive,
+	// listing the files of the archive with their digest.
+	exportManifestName = "apptainer-cache.json"
+	// exportVersion is the version of the cache archive format.
+	exportVersion = 1
+	// maxIndexSize is the maximum size of the index of the OCI blob cache
+	// read from a cache archive.
+	maxIndexSize = 64 << 20
+)
+
+// exportManifest lists the files of a cache archive.
+type exportManifest struct {
+	Version int          `json:"version"`
+	Files   []exportFile `json:"files"`
+}
+
+// exportFile is a file of a cache archive, with its path relative to the
+// cache root directory.
+type exportFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+// isExportEntry returns if the file of a cache archive is a cache entry,
+// as opposed to metadata or the OCI blob cache layout.
+func isExportEntry(rel string) bool {
+	return !strings.HasPrefix(rel, MetaDirName+"/") &&
+		rel != path.Join(OciBlobCacheType, ocispec.ImageIndexFile) &&
+		rel != path.Join(OciBlobCacheType, ocispec.ImageLayoutFile)
+}
+
+// Export writes the entries of the cacheTypes caches to w as a tar
+// archive, with their metadata and the layout of the OCI blob cache. It
+// returns the number of entries exported.
+func (h *Handle) Export(w io.Writer, cacheTypes []string) (int, error) {
+	if h.disabled {
+		return 0, fmt.Errorf("cache is disabled")
+	}
+
+	var files []string
+	for _, cacheType := range cacheTypes {
+		typeFiles, err := h.exportFiles(cacheType)
+		if err != nil {
+			return 0, err
+		}
+		files = append(files, typeFiles...)
+	}
+
+	manifest := exportManifest{Version: exportVersion}
+	count := 0
+	for _, rel := range files {
+		size, d, err := fileSizeDigest(path.Join(h.rootDir, rel))
+		if err != nil {
+			return 0, fmt.Errorf("could not read cache file %s: %v", rel, err)
+		}
+		manifest.Files = append(manifest.Files, exportFile{Path: rel, Size: size, Digest: d})
+		if isExportEntry(rel) {
+			count++
+		}
+	}
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return 0, err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{Name: exportManifestName, Mode: 0o600, Size: int64(len(b)), ModTime: time.Now()}); err != nil {
+		return 0, err
+	}
+	if _, err := tw.Write(b); err != nil {
+		return 0, err
+	}
+	for _, f := range manifest.Files {
+		if err := writeExportFile(tw, path.Join(h.rootDir, f.Path), f); err != nil {
+			return 0, fmt.Errorf("could not export cache file %s: %v", f.Path, err)
+		}
+	}
+	return count, tw.Close()
+}
+
+// exportFiles returns the files of the cacheType cache to export, the
+// entries first, then their metadata and, for the OCI blob cache, its
+// layout and index.
+func (h *Handle) exportFiles(cacheType string) ([]string, error) {
+	var entries []string
+	if cacheType == OciBlobCacheType {
+		// don't let the blobs be evicted or cleaned while exported
+		h.lockBlobs()
+		blobs, err := h.blobEntries()
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range blobs {
+			entries = append(entries, path.Join(OciBlobCacheType, "blobs", string(digest.SHA256), b.Name))
+		}
+	} else {
+		typeEntries, err := h.ListEntries(cacheType)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range typeEntries {
+			entries = append(entries, path.Join(cacheType, e.Name))
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	files := entries
+	metaDir := h.getMetaPath(cacheType, "")
+	metas, err := os.ReadDir(metaDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read metadata of the %s cache: %v", cacheType, err)
+	}
+	exported := make(map[string]bool)
+	for _, e := range entries {
+		exported[path.Base(e)] = true
+	}
+	for _, m := range metas {
+		// the sources of the images of the blob cache are all exported
+		if strings.HasPrefix(m.Name(), tmpPrefix) || (cacheType != OciBlobCacheType && !exported[m.Name()]) {
+			continue
+		}
+		files = append(files, path.Join(MetaDirName, cacheType, m.Name()))
+	}
+	if cacheType == OciBlobCacheType {
+		files = append(files,
+			path.Join(OciBlobCacheType, ocispec.ImageLayoutFile),
+			path.Join(OciBlobCacheType, ocispec.ImageIndexFile),
+		)
+	}
+	return files, nil
+}
+
+// fileSizeDigest returns the size and the sha256 digest of a file.
+func fileSizeDigest(file string) (int64, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeExportFile writes a file to a cache archive, keeping its
+// modification time which records the last use of the entries.
+func writeExportFile(tw *tar.Writer, file string, f exportFile) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:    f.Path,
+		Mode:    0o600,
+		Size:    f.Size,
+		ModTime: fi.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, in, f.Size)
+	return err
+}
+
+// Import restores the entries of a cache archive written by Export from r.
+// The digest of each file is verified, and the entries already in the
+// cache are skipped. It returns the number of entries imported and
+// skipped.
+func (h *Handle) Import(r io.Reader) (imported, skipped int, err error) {
+	if h.disabled {
+		return 0, 0, fmt.Errorf("cache is disabled")
+	}
+	// don't let the blob cache be evicted or cleaned while imported
+	h.lockBlobs()
+
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != exportManifestName {
+		return 0, 0, fmt.Errorf("not an apptainer cache archive")
+	}
+	var manifest exportManifest
+	if err := json.NewDecoder(io.LimitReader(tr, maxIndexSize)).Decode(&manifest); err != nil {
+		return 0, 0, fmt.Errorf("could not read cache archive manifest: %v", err)
+	}
+	if manifest.Version != exportVersion {
+		return 0, 0, fmt.Errorf("unsupported cache archive version %d", manifest.Version)
+	}
+	files := make(map[string]exportFile)
+	for _, f := range manifest.Files {
+		files[f.Path] = f
+	}
+
+	var index []byte
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return imported, skipped, fmt.Errorf("could not read cache archive: %v", err)
+		}
+		f, ok := files[hdr.Name]
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			sylog.Warningf("Ignoring unexpected file %s of the cache archive", hdr.Name)
+			continue
+		}
+		rel, err := importPath(f.Path)
+		if err != nil {
+			return imported, skipped, err
+		}
+
+		if rel == path.Join(OciBlobCacheType, ocispec.ImageIndexFile) {
+			// the index is merged with the index of the blob cache
+			index, err = readVerified(tr, f)
+			if err != nil {
+				return imported, skipped, err
+			}
+			continue
+		}
+
+		dest := path.Join(h.rootDir, rel)
+		if _, err := os.Lstat(dest); err == nil {
+			if isExportEntry(rel) {
+				sylog.Debugf("Skipping cache entry %s: already in the cache", rel)
+				skipped++
+			}
+			continue
+		}
+		if err := importFile(tr, dest, f, hdr); err != nil {
+			return imported, skipped, err
+		}
+		if isExportEntry(rel) {
+			sylog.Debugf("Imported cache entry %s", rel)
+			imported++
+		}
+	}
+
+	if index != nil {
+		if err := h.mergeBlobsIndex(index); err != nil {
+			return imported, skipped, err
+		}
+	}
+	return imported, skipped, nil
+}
+
+// importPath checks the path of a file of a cache archive is a cache
+// entry or metadata, and returns it cleaned.
+func importPath(p string) (string, error) {
+	rel := path.Clean(p)
+	parts := strings.Split(rel, "/")
+	if path.IsAbs(rel) || len(parts) < 2 || parts[0] == ".." {
+		return "", fmt.Errorf("invalid path %s in cache archive", p)
+	}
+
+	cacheType, depth := parts[0], 2
+	if cacheType == MetaDirName {
+		cacheType, depth = parts[1], 3
+	}
+	switch {
+	case cacheType == OciBlobCacheType && depth == 3 && len(parts) == 3:
+	case cacheType == OciBlobCacheType && depth == 2:
+	case len(parts) == depth && stringInSlice(cacheType, FileCacheTypes):
+	default:
+		return "", fmt.Errorf("invalid path %s in cache archive", p)
+	}
+	if strings.HasPrefix(path.Base(rel), tmpPrefix) {
+		return "", fmt.Errorf("invalid path %s in cache archive", p)
+	}
+	// the blobs are addressed by their digest
+	if cacheType == OciBlobCacheType && parts[0] == OciBlobCacheType && len(parts) == 4 {
+		if parts[1] != "blobs" || digest.NewDigestFromEncoded(digest.Algorithm(parts[2]), parts[3]).Validate() != nil {
+			return "", fmt.Errorf("invalid blob path %s in cache archive", p)
+		}
+	}
+	return rel, nil
+}
+
+// readVerified reads a small file of a cache archive, verifying its
+// digest.
+func readVerified(r io.Reader, f exportFile) ([]byte, error) {
+	if f.Size > maxIndexSize {
+		return nil, fmt.Errorf("%s of the cache archive is too large", f.Path)
+	}
+	b, err := io.ReadAll(io.LimitReader(r, f.Size))
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s from cache archive: %v", f.Path, err)
+	}
+	if d := digest.SHA256.FromBytes(b); d.String() != f.Digest {
+		return nil, fmt.Errorf("digest of %s from cache archive is %s, expected %s", f.Path, d, f.Digest)
+	}
+	return b, nil
+}
+
+// importFile writes a file of a cache archive to dest in the cache,
+// atomically once its digest is verified.
+func importFile(r io.Reader, dest string, f exportFile, hdr *tar.Header) error {
+	if err := fsutil.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), tmpPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	verifier := digest.SHA256.Digester()
+	n, err := io.Copy(io.MultiWriter(tmp, verifier.Hash()), io.LimitReader(r, f.Size))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("could not import %s from cache archive: %v", f.Path, err)
+	}
+	d := verifier.Digest()
+	if n != f.Size || d.String() != f.Digest {
+		return fmt.Errorf("digest of %s from cache archive is %s, expected %s", f.Path, d, f.Digest)
+	}
+	// the blobs must match the digest addressing them
+	if strings.HasPrefix(f.Path, path.Join(OciBlobCacheType, "blobs")+"/") && d.Encoded() != path.Base(f.Path) {
+		return fmt.Errorf("digest of blob %s from cache archive is %s", f.Path, d)
+	}
+
+	if err := os.Chtimes(tmp.Name(), hdr.ModTime, hdr.ModTime); err != nil {
+		sylog.Debugf("Could not set modification time of %s: %v", dest, err)
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// mergeBlobsIndex adds the images of an index of a cache archive, whose
+// manifests are in the blob cache, to the index of the blob cache.
+func (h *Handle) mergeBlobsIndex(b []byte) error {
+	var imported ocispec.Index
+	if err := json.Unmarshal(b, &imported); err != nil {
+		return fmt.Errorf("could not parse index of the cache archive: %v", err)
+	}
+
+	dir := h.getCacheTypeDir(OciBlobCacheType)
+	indexPath := path.Join(dir, ocispec.ImageIndexFile)
+	index := ocispec.Index{MediaType: ocispec.MediaTypeImageIndex}
+	index.SchemaVersion = 2
+	if b, err := os.ReadFile(indexPath); err == nil {
+		if err := json.Unmarshal(b, &index); err != nil {
+			return fmt.Errorf("could not parse index of the blob cache: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("could not read index of the blob cache: %v", err)
+	}
+
+	type key struct {
+		digest digest.Digest
+		tag    string
+	}
+	present := make(map[key]bool)
+	for _, desc := range index.Manifests {
+		present[key{desc.Digest, desc.Annotations[ocispec.AnnotationRefName]}] = true
+	}
+	added := 0
+	for _, desc := range imported.Manifests {
+		k := key{desc.Digest, desc.Annotations[ocispec.AnnotationRefName]}
+		if present[k] || desc.Digest.Validate() != nil {
+			continue
+		}
+		if _, err := os.Stat(path.Join(dir, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded())); err != nil {
+			continue
+		}
+		index.Manifests = append(index.Manifests, desc)
+		present[k] = true
+		added++
+	}
+	if added == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, tmpPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), indexPath)
+}
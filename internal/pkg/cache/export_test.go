@@ -0,0 +1,178 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// storeBlobsImage stores an image with a single layer in the OCI blob
+// cache, as pulled from source, and returns its tag.
+func storeBlobsImage(h *Handle, source, layer string) (string, error) {
+	dir, err := h.GetOciCacheDir(OciBlobCacheType)
+	if err != nil {
+		return "", err
+	}
+	blobsDir := filepath.Join(dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobsDir, 0o700); err != nil {
+		return "", err
+	}
+	writeBlob := func(b []byte) (digest.Digest, error) {
+		d := digest.SHA256.FromBytes(b)
+		return d, os.WriteFile(filepath.Join(blobsDir, d.Encoded()), b, 0o600)
+	}
+
+	l, err := writeBlob([]byte(layer))
+	if err != nil {
+		return "", err
+	}
+	b, _ := json.Marshal(ocispec.Manifest{Layers: []ocispec.Descriptor{{Digest: l}}})
+	m, err := writeBlob(b)
+	if err != nil {
+		return "", err
+	}
+	tag := m.String()
+	b, _ = json.Marshal(ocispec.Index{Manifests: []ocispec.Descriptor{
+		{Digest: m, Annotations: map[string]string{ocispec.AnnotationRefName: tag}},
+	}})
+	if err := os.WriteFile(filepath.Join(dir, ocispec.ImageIndexFile), b, 0o600); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ocispec.ImageLayoutFile), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0o600); err != nil {
+		return "", err
+	}
+	return tag, h.SetBlobsSource(tag, source)
+}
+
+func TestExportImport(t *testing.T) {
+	src, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	for _, name := range []string{"first", "second"} {
+		if err := pullEntry(src, NetCacheType, name, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pullEntry(src, LibraryCacheType, "library", 10); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := storeBlobsImage(src, "docker://alpine:latest", "alpine layer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	count, err := src.Export(&archive, []string{NetCacheType, OciBlobCacheType})
+	if err != nil {
+		t.Fatalf("unexpected export error: %v", err)
+	}
+	// the net entries, the layer and the manifest
+	if count != 4 {
+		t.Errorf("exported %d entries, expected 4", count)
+	}
+
+	dest, err := New(Config{ParentDir: t.TempDir(), Offline: true})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	// an image already in the cache is kept
+	if _, err := storeBlobsImage(dest, "docker://busybox:latest", "busybox layer"); err != nil {
+		t.Fatal(err)
+	}
+	imported, skipped, err := dest.Import(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("unexpected import error: %v", err)
+	}
+	if imported != 4 || skipped != 0 {
+		t.Errorf("imported %d and skipped %d entries, expected 4 and 0", imported, skipped)
+	}
+
+	// the entries are found by their source without network access
+	path, err := dest.OfflineEntry(NetCacheType, "https://example.com/first")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if filepath.Base(path) != "first" {
+		t.Errorf("unexpected entry %s", path)
+	}
+	if _, err := dest.OfflineEntry(LibraryCacheType, "https://example.com/library"); err == nil || !strings.Contains(err.Error(), "is not in the cache") {
+		t.Errorf("unexpected error for an entry not exported: %v", err)
+	}
+	for source, expected := range map[string]string{"docker://alpine:latest": tag, "docker://busybox:latest": ""} {
+		got, err := dest.OfflineBlobsTag(source)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", source, err)
+		} else if expected != "" && got != expected {
+			t.Errorf("unexpected tag %s for %s, expected %s", got, source, expected)
+		}
+	}
+	entries, err := dest.ListEntries(OciBlobCacheType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("unexpected blob entries %+v", entries)
+	}
+
+	// importing again skips everything
+	imported, skipped, err = dest.Import(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("unexpected import error: %v", err)
+	}
+	if imported != 0 || skipped != 4 {
+		t.Errorf("imported %d and skipped %d entries, expected 0 and 4", imported, skipped)
+	}
+}
+
+func TestImportCorrupted(t *testing.T) {
+	src, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	e, err := src.GetEntry(NetCacheType, "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(e.TmpPath, []byte("original content"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e.Source = "https://example.com/image"
+	if err := e.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	if _, err := src.Export(&archive, []string{NetCacheType}); err != nil {
+		t.Fatalf("unexpected export error: %v", err)
+	}
+	corrupted := bytes.Replace(archive.Bytes(), []byte("original content"), []byte("modified content"), 1)
+
+	dest, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if _, _, err := dest.Import(bytes.NewReader(corrupted)); err == nil || !strings.Contains(err.Error(), "digest") {
+		t.Errorf("unexpected error for a corrupted archive: %v", err)
+	}
+	entries, err := dest.ListEntries(NetCacheType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("corrupted entries imported: %+v", entries)
+	}
+}
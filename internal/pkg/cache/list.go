@@ -0,0 +1,161 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ListEntries returns the entries of the cache type cacheType, excluding
+// the ones being created. The entries of the OCI blob cache are its blobs,
+// with the references of the images using them.
+func (h *Handle) ListEntries(cacheType string) ([]EntryInfo, error) {
+	if h.disabled {
+		return nil, nil
+	}
+	if cacheType == OciBlobCacheType {
+		return h.blobEntries()
+	}
+
+	dir := h.getCacheTypeDir(cacheType)
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to open cache %s at directory %s: %v", cacheType, dir, err)
+	}
+
+	entries := make([]EntryInfo, 0, len(files))
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), tmpPrefix) {
+			continue
+		}
+		info, err := h.entryInfo(cacheType, f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get info for cache entry %s: %v", f.Name(), err)
+		}
+		entries = append(entries, info)
+	}
+	return entries, nil
+}
+
+// SetBlobsSource records the reference source of the image stored with
+// the tag in the OCI blob cache, once its blobs are written.
+func (h *Handle) SetBlobsSource(tag, source string) error {
+	if h.disabled {
+		return nil
+	}
+	return writeMeta(h.getMetaPath(OciBlobCacheType, tag), entryMeta{Source: source, Digest: tag})
+}
+
+// blobEntries returns the blobs of the OCI blob cache.
+func (h *Handle) blobEntries() ([]EntryInfo, error) {
+	dir := h.getCacheTypeDir(OciBlobCacheType)
+	blobsDir := filepath.Join(dir, "blobs", string(digest.SHA256))
+	files, err := os.ReadDir(blobsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to open cache %s at directory %s: %v", OciBlobCacheType, blobsDir, err)
+	}
+
+	referrers := h.blobReferrers(dir)
+
+	entries := make([]EntryInfo, 0, len(files))
+	for _, f := range files {
+		fi, err := f.Info()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get info for cache entry %s: %v", f.Name(), err)
+		}
+		e := EntryInfo{
+			Type:     OciBlobCacheType,
+			Name:     f.Name(),
+			Digest:   digest.NewDigestFromEncoded(digest.SHA256, f.Name()).String(),
+			Size:     fi.Size(),
+			Created:  fi.ModTime(),
+			LastUsed: fi.ModTime(),
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			if atime := time.Unix(st.Atim.Unix()); atime.After(e.LastUsed) {
+				e.LastUsed = atime
+			}
+		}
+		e.Referrers = referrers[e.Digest]
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// blobReferrers returns the references of the images using each blob of
+// the OCI blob cache in dir, from the manifests of its index. The image
+// digest is used for the images without a recorded source.
+func (h *Handle) blobReferrers(dir string) map[string][]string {
+	referrers := make(map[string][]string)
+	add := func(d digest.Digest, ref string) {
+		for _, r := range referrers[d.String()] {
+			if r == ref {
+				return
+			}
+		}
+		referrers[d.String()] = append(referrers[d.String()], ref)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			sylog.Debugf("Could not read index of the blob cache: %v", err)
+		}
+		return referrers
+	}
+	var index ocispec.Index
+	if err := json.Unmarshal(b, &index); err != nil {
+		sylog.Debugf("Could not parse index of the blob cache: %v", err)
+		return referrers
+	}
+
+	for _, desc := range index.Manifests {
+		tag := desc.Annotations[ocispec.AnnotationRefName]
+		ref := desc.Digest.String()
+		if tag != "" {
+			if meta, _, err := readMeta(h.getMetaPath(OciBlobCacheType, tag)); err == nil && meta.Source != "" {
+				ref = meta.Source
+			}
+		}
+		add(desc.Digest, ref)
+
+		if desc.Digest.Validate() != nil {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded()))
+		if err != nil {
+			sylog.Debugf("Could not read manifest %s of the blob cache: %v", desc.Digest, err)
+			continue
+		}
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(b, &manifest); err != nil {
+			sylog.Debugf("Could not parse manifest %s of the blob cache: %v", desc.Digest, err)
+			continue
+		}
+		add(manifest.Config.Digest, ref)
+		for _, layer := range manifest.Layers {
+			add(layer.Digest, ref)
+		}
+	}
+	return referrers
+}
@@ -0,0 +1,140 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestListEntries(t *testing.T) {
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	// an entry pulled with a known digest
+	if err := pullEntry(h, LibraryCacheType, "sha256.abcd", 10); err != nil {
+		t.Fatal(err)
+	}
+	e, err := h.GetEntry(LibraryCacheType, "sha256.abcd")
+	if err != nil || !e.Exists {
+		t.Fatalf("failed to get entry: %v", err)
+	}
+
+	// an entry without digest has the digest of its content
+	if err := pullEntry(h, NetCacheType, "pulled", 0); err != nil {
+		t.Fatal(err)
+	}
+	// entries created by older versions, without or with a plain source
+	dir, _ := h.GetFileCacheDir(NetCacheType)
+	for _, name := range []string{"old", "plain"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(h.getMetaPath(NetCacheType, "plain"), []byte("https://example.com/plain\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := h.ListEntries(NetCacheType)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	expected := []struct{ name, source, digest string }{
+		{"old", "", ""},
+		{"plain", "https://example.com/plain", ""},
+		{"pulled", "https://example.com/pulled", digest.SHA256.FromBytes(nil).String()},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	for i, e := range expected {
+		if entries[i].Name != e.name || entries[i].Source != e.source || entries[i].Digest != e.digest {
+			t.Errorf("unexpected entry %+v, expected %+v", entries[i], e)
+		}
+	}
+}
+
+func TestListBlobEntries(t *testing.T) {
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	dir, err := h.GetOciCacheDir(OciBlobCacheType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobsDir := filepath.Join(dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobsDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeBlob := func(b []byte) digest.Digest {
+		d := digest.SHA256.FromBytes(b)
+		if err := os.WriteFile(filepath.Join(blobsDir, d.Encoded()), b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	shared := writeBlob([]byte("shared layer"))
+	own := writeBlob([]byte("own layer"))
+	config := writeBlob([]byte("{}"))
+	manifest := func(layers ...digest.Digest) digest.Digest {
+		m := ocispec.Manifest{Config: ocispec.Descriptor{Digest: config}}
+		for _, l := range layers {
+			m.Layers = append(m.Layers, ocispec.Descriptor{Digest: l})
+		}
+		b, _ := json.Marshal(m)
+		return writeBlob(b)
+	}
+	alpine := manifest(shared)
+	ubuntu := manifest(shared, own)
+
+	index := ocispec.Index{Manifests: []ocispec.Descriptor{
+		{Digest: alpine, Annotations: map[string]string{ocispec.AnnotationRefName: "sha256:alpine"}},
+		{Digest: ubuntu, Annotations: map[string]string{ocispec.AnnotationRefName: "sha256:ubuntu"}},
+	}}
+	b, _ := json.Marshal(index)
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// the source of the ubuntu image is unknown, pulled by an older version
+	if err := h.SetBlobsSource("sha256:alpine", "docker://alpine:latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := h.ListEntries(OciBlobCacheType)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	referrers := make(map[digest.Digest][]string)
+	for _, e := range entries {
+		sort.Strings(e.Referrers)
+		referrers[digest.Digest(e.Digest)] = e.Referrers
+	}
+	expected := map[digest.Digest][]string{
+		shared: {"docker://alpine:latest", ubuntu.String()},
+		own:    {ubuntu.String()},
+		config: {"docker://alpine:latest", ubuntu.String()},
+		alpine: {"docker://alpine:latest"},
+		ubuntu: {ubuntu.String()},
+	}
+	if !reflect.DeepEqual(referrers, expected) {
+		t.Errorf("unexpected referrers %v, expected %v", referrers, expected)
+	}
+}
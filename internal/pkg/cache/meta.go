@@ -0,0 +1,109 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	fsutil "github.com/apptainer/apptainer/internal/pkg/util/fs"
+)
+
+// entryMeta is the provenance of a cache entry, recorded in its metadata
+// file. The modification time of the metadata file records the last use
+// of the entry.
+type entryMeta struct {
+	// Source is the reference the entry was pulled from.
+	Source string `json:"source,omitempty"`
+	// Digest is the digest of the image the entry was pulled from, or of
+	// the entry content.
+	Digest string `json:"digest,omitempty"`
+	// Content is the digest of the entry content, to verify its integrity.
+	Content string `json:"content,omitempty"`
+}
+
+// readMeta returns the provenance and the last use recorded in the
+// metadata file of an entry. A metadata file only holding the source, as
+// written by previous versions, is accepted.
+func readMeta(metaPath string) (entryMeta, time.Time, error) {
+	var meta entryMeta
+
+	fi, err := os.Stat(metaPath)
+	if err != nil {
+		return meta, time.Time{}, err
+	}
+	b, err := os.ReadFile(metaPath)
+	if err != nil {
+		return meta, time.Time{}, err
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		meta = entryMeta{Source: strings.TrimSpace(string(b))}
+	}
+	return meta, fi.ModTime(), nil
+}
+
+// writeMeta atomically records the provenance of an entry in its
+// metadata file, which also records the last use of the entry with its
+// modification time.
+func writeMeta(metaPath string, meta entryMeta) error {
+	dir := filepath.Dir(metaPath)
+	if err := fsutil.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, tmpPrefix+filepath.Base(metaPath))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), metaPath)
+}
+
+// touchMeta records the last use of an entry in its metadata file.
+func touchMeta(metaPath string) error {
+	now := time.Now()
+	err := os.Chtimes(metaPath, now, now)
+	if os.IsNotExist(err) {
+		return writeMeta(metaPath, entryMeta{})
+	}
+	return err
+}
+
+// fileDigest returns the sha256 digest of the content of a file.
+func fileDigest(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("could not compute digest of %s: %v", file, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// IsOffline returns true if network access is disabled, the images being
+// only taken from the cache.
+func (h *Handle) IsOffline() bool {
+	return h.offline
+}
+
+// offlineError returns the error of an image missing in the cache while
+// network access is disabled.
+func (h *Handle) offlineError(source string) error {
+	if h.disabled {
+		return fmt.Errorf("%s can't be pulled: network access is disabled in offline mode, and the cache is disabled", source)
+	}
+	return fmt.Errorf("%s is not in the cache, and can't be pulled: network access is disabled in offline mode", source)
+}
+
+// OfflineEntry returns the path of the most recently used entry of the
+// cacheType cache pulled from source, without network access.
+func (h *Handle) OfflineEntry(cacheType, source string) (string, error) {
+	if h.disabled {
+		return "", h.offlineError(source)
+	}
+	entries, err := h.ListEntries(cacheType)
+	if err != nil {
+		return "", err
+	}
+
+	var found *EntryInfo
+	for i, e := range entries {
+		if e.Source == source && (found == nil || e.LastUsed.After(found.LastUsed)) {
+			found = &entries[i]
+		}
+	}
+	if found == nil {
+		return "", h.offlineError(source)
+	}
+
+	sylog.Debugf("Using %s cache entry %s for %s in offline mode", cacheType, found.Name, source)
+	if err := touchMeta(h.getMetaPath(cacheType, found.Name)); err != nil {
+		sylog.Debugf("Could not record last use of cache entry %s: %v", found.Name, err)
+	}
+	return path.Join(h.getCacheTypeDir(cacheType), found.Name), nil
+}
+
+// OfflineBlobsTag returns the tag of the most recently stored image of the
+// OCI blob cache pulled from source, without network access.
+func (h *Handle) OfflineBlobsTag(source string) (string, error) {
+	if h.disabled {
+		return "", h.offlineError(source)
+	}
+	dir := h.getMetaPath(OciBlobCacheType, "")
+	files, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("could not read sources of the blob cache: %v", err)
+	}
+
+	var tag string
+	var stored time.Time
+	for _, f := range files {
+		meta, modTime, err := readMeta(path.Join(dir, f.Name()))
+		if err != nil || meta.Source != source || meta.Digest == "" {
+			continue
+		}
+		if tag == "" || modTime.After(stored) {
+			tag, stored = meta.Digest, modTime
+		}
+	}
+	if tag == "" {
+		return "", h.offlineError(source)
+	}
+	sylog.Debugf("Using image %s of the blob cache for %s in offline mode", tag, source)
+	return tag, nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	fsutil "github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
+)
+
+// LockDirName specifies the name of the directory, relative to the cache
+// root directory, holding the locks of the images being pulled.
+const LockDirName = "lock"
+
+var (
+	// lockPoll is the maximum delay between two attempts to acquire a
+	// cache lock held by another process, the delay starts at
+	// lockPollMin and doubles at each attempt.
+	lockPoll    = 500 * time.Millisecond
+	lockPollMin = 10 * time.Millisecond
+	// lockMessage is the interval between two messages of a process
+	// waiting for a cache lock.
+	lockMessage = 30 * time.Second
+)
+
+// LockPull waits until no other process is pulling the image identified
+// by key into the cacheType cache, and locks it so that concurrent pulls
+// of the same image wait for this one and then use its cache entry. It
+// must be called before any network request for the image, and returns a
+// function releasing the lock. The lock works across the hosts sharing
+// the cache, a lock held by a dead process or host is broken.
+func (h *Handle) LockPull(cacheType, key string) (func(), error) {
+	if h.disabled {
+		return func() {}, nil
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	lockName := path.Join(h.rootDir, LockDirName, cacheType, hex.EncodeToString(sum[:]))
+	if err := fsutil.MkdirAll(path.Dir(lockName), 0o700); err != nil {
+		return nil, fmt.Errorf("could not create pull lock directory: %v", err)
+	}
+	unlock, err := waitLock(lockName, "Waiting for another process to finish pulling "+key+"...")
+	if err != nil {
+		return nil, fmt.Errorf("could not lock pull of %s: %v", key, err)
+	}
+	return unlock, nil
+}
+
+// waitLock waits until the lock file lockName is acquired, printing
+// message at most every lockMessage while it's held by another process.
+// It returns a function releasing the lock.
+func waitLock(lockName, message string) (func(), error) {
+	var lastMessage time.Time
+	delay := lockPollMin
+	for {
+		l, err := lock.TryFile(lockName)
+		if err == nil {
+			return l.Unlock, nil
+		}
+		var held *lock.HeldError
+		if !errors.As(err, &held) {
+			return nil, err
+		}
+
+		if message != "" && time.Since(lastMessage) >= lockMessage {
+			sylog.Infof("%s", message)
+			lastMessage = time.Now()
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > lockPoll {
+			delay = lockPoll
+		}
+	}
+}
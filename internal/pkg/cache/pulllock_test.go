@@ -0,0 +1,174 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
+)
+
+func TestLockPullConcurrent(t *testing.T) {
+	const pulls = 50
+	parentDir := t.TempDir()
+
+	var downloads int32
+	var wg sync.WaitGroup
+	errs := make(chan error, pulls)
+	for i := 0; i < pulls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// each pull has its own handle like separate processes
+			h, err := New(Config{ParentDir: parentDir})
+			if err != nil {
+				errs <- err
+				return
+			}
+			unlock, err := h.LockPull(NetCacheType, "https://example.com/image.sif")
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer unlock()
+
+			e, err := h.GetEntry(NetCacheType, "image")
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer e.CleanTmp()
+			if e.Exists {
+				return
+			}
+			atomic.AddInt32(&downloads, 1)
+			// a slow download
+			time.Sleep(10 * time.Millisecond)
+			if err := os.WriteFile(e.TmpPath, []byte("image"), 0o600); err != nil {
+				errs <- err
+				return
+			}
+			if err := e.Finalize(); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if downloads != 1 {
+		t.Errorf("image downloaded %d times, expected once", downloads)
+	}
+}
+
+func TestLockPullStale(t *testing.T) {
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	hostname, _ := os.Hostname()
+
+	// find the lock file used for the key
+	unlock, err := h.LockPull(NetCacheType, "key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(h.rootDir, LockDirName, NetCacheType, "*"))
+	if len(files) != 1 {
+		t.Fatalf("unexpected lock files %v", files)
+	}
+	lockName := files[0]
+	unlock()
+	if _, err := os.Stat(lockName); !os.IsNotExist(err) {
+		t.Fatalf("lock not released")
+	}
+
+	tests := []struct {
+		name   string
+		holder string
+		age    time.Duration
+	}{
+		{
+			// a process ID above the maximum is never alive
+			name:   "dead process",
+			holder: fmt.Sprintf("%s %d", hostname, 1<<30),
+		},
+		{
+			name:   "not refreshed",
+			holder: "otherhost 1",
+			age:    2 * lock.StaleFileAge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(lockName, []byte(tt.holder+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			modTime := time.Now().Add(-tt.age)
+			if err := os.Chtimes(lockName, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				unlock, err := h.LockPull(NetCacheType, "key")
+				if err == nil {
+					unlock()
+				}
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("stale lock not broken")
+			}
+		})
+	}
+
+	// a lock held by a live process of another host is waited for
+	if err := os.WriteFile(lockName, []byte("otherhost 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan func(), 1)
+	go func() {
+		unlock, err := h.LockPull(NetCacheType, "key")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			close(acquired)
+			return
+		}
+		acquired <- unlock
+	}()
+	select {
+	case <-acquired:
+		t.Fatalf("lock held by another process acquired")
+	case <-time.After(3 * lockPoll):
+	}
+	os.Remove(lockName)
+	select {
+	case unlock := <-acquired:
+		if unlock != nil {
+			unlock()
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("released lock not acquired")
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	fsutil "github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// quotaLockName is the lock file held while entries are evicted to make
+	// room for a new entry, so that concurrent pulls don't exceed the
+	// maximum size together.
+	quotaLockName = "quota.lock"
+	// blobLockName is the file locked by the processes using the OCI
+	// blob cache.
+	blobLockName = "blob.lock"
+	// blobEntryName is the name of the OCI blob cache in the cache
+	// entries, as its blobs are evicted together.
+	blobEntryName = "*"
+)
+
+// openLock opens a lock file, creating it if needed.
+func openLock(file string) (int, error) {
+	return unix.Open(file, unix.O_RDONLY|unix.O_CREAT|unix.O_CLOEXEC, 0o600)
+}
+
+// lockBlobs takes a shared lock on the OCI blob cache, held until the
+// process exits, so that it isn't evicted or cleaned while used.
+func (h *Handle) lockBlobs() {
+	if h.disabled || h.blobLockFd >= 0 {
+		return
+	}
+	fd, err := openLock(path.Join(h.rootDir, blobLockName))
+	if err != nil {
+		sylog.Debugf("Could not open lock of the blob cache: %v", err)
+		return
+	}
+	if err := unix.Flock(fd, unix.LOCK_SH); err != nil {
+		sylog.Debugf("Could not lock the blob cache: %v", err)
+		unix.Close(fd)
+		return
+	}
+	h.blobLockFd = fd
+}
+
+// lockBlobsExclusive tries to take an exclusive lock on the OCI blob
+// cache, upgrading the lock held by this process if any. It returns false
+// when the blob cache is used by another process, otherwise a function
+// releasing the exclusive lock.
+func (h *Handle) lockBlobsExclusive() (func(), bool) {
+	fd := h.blobLockFd
+	if fd < 0 {
+		var err error
+		fd, err = openLock(path.Join(h.rootDir, blobLockName))
+		if err != nil {
+			sylog.Debugf("Could not open lock of the blob cache: %v", err)
+			return nil, false
+		}
+	}
+	if err := unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		if fd == h.blobLockFd {
+			// a failed conversion may release the shared lock
+			_ = unix.Flock(fd, unix.LOCK_SH)
+		} else {
+			unix.Close(fd)
+		}
+		return nil, false
+	}
+	return func() {
+		if fd == h.blobLockFd {
+			_ = unix.Flock(fd, unix.LOCK_SH)
+		} else {
+			unix.Close(fd)
+		}
+	}, true
+}
+
+// makeRoom evicts the least recently used entries of the cache until the
+// new entry e fits in the maximum size of the cache. The entries in use
+// are skipped. It returns a function releasing the lock serializing the
+// additions of entries, to call once the entry is finalized.
+func (h *Handle) makeRoom(e *Entry) (func(), error) {
+	fi, err := os.Stat(e.TmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get size of cache entry: %v", err)
+	}
+	size := fi.Size()
+	if size > h.maxSize {
+		return nil, fmt.Errorf("image of %s is larger than the maximum cache size of %s, increase it with %s or 'cache max size' in apptainer.conf, or use --disable-cache",
+			fsutil.FindSize(size), fsutil.FindSize(h.maxSize), MaxSizeEnv)
+	}
+
+	unlock, err := waitLock(path.Join(h.rootDir, quotaLockName), "")
+	if err != nil {
+		return nil, fmt.Errorf("could not lock cache: %v", err)
+	}
+
+	entries, err := h.quotaEntries()
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	var usage int64
+	for _, entry := range entries {
+		usage += entry.Size
+	}
+	sylog.Debugf("Cache uses %s of %s, adding %s", fsutil.FindSize(usage), fsutil.FindSize(h.maxSize), fsutil.FindSize(size))
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+	for _, entry := range entries {
+		if usage+size <= h.maxSize {
+			break
+		}
+		if !h.evict(entry) {
+			continue
+		}
+		sylog.Infof("Evicted %s cache entry %s (%s, last used %s) to stay under the maximum cache size of %s",
+			entry.Type, entry.Name, fsutil.FindSize(entry.Size), entry.LastUsed.Format("2006-01-02 15:04:05"), fsutil.FindSize(h.maxSize))
+		usage -= entry.Size
+	}
+	if usage+size > h.maxSize {
+		sylog.Warningf("Cache uses %s, more than its maximum size of %s, because the other entries are in use",
+			fsutil.FindSize(usage+size), fsutil.FindSize(h.maxSize))
+	}
+	return unlock, nil
+}
+
+// Usage returns the size in bytes of the cache counted against its
+// maximum size.
+func (h *Handle) Usage() (int64, error) {
+	if h.disabled {
+		return 0, nil
+	}
+	entries, err := h.quotaEntries()
+	if err != nil {
+		return 0, err
+	}
+	var usage int64
+	for _, e := range entries {
+		usage += e.Size
+	}
+	return usage, nil
+}
+
+// quotaEntries returns the entries counted in the cache size: the
+// entries of the file cache types, excluding the ones being created, and
+// the OCI blob cache as a single entry.
+func (h *Handle) quotaEntries() ([]EntryInfo, error) {
+	var entries []EntryInfo
+	for _, cacheType := range FileCacheTypes {
+		files, err := os.ReadDir(h.getCacheTypeDir(cacheType))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("could not list %s cache entries: %v", cacheType, err)
+		}
+		for _, f := range files {
+			if strings.HasPrefix(f.Name(), tmpPrefix) {
+				continue
+			}
+			info, err := h.entryInfo(cacheType, f)
+			if err != nil {
+				sylog.Debugf("Could not get info for cache entry '%s': %v", f.Name(), err)
+				continue
+			}
+			entries = append(entries, info)
+		}
+	}
+
+	blobs, err := blobsInfo(h.getCacheTypeDir(OciBlobCacheType))
+	if err != nil {
+		return nil, err
+	}
+	if blobs.Size > 0 {
+		entries = append(entries, blobs)
+	}
+	return entries, nil
+}
+
+// blobsInfo returns the OCI blob cache as a single entry, last used when
+// its most recently used blob was.
+func blobsInfo(dir string) (EntryInfo, error) {
+	e := EntryInfo{Type: OciBlobCacheType, Name: blobEntryName}
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e.Size += fi.Size()
+		lastUsed := fi.ModTime()
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			if atime := time.Unix(st.Atim.Unix()); atime.After(lastUsed) {
+				lastUsed = atime
+			}
+		}
+		if lastUsed.After(e.LastUsed) {
+			e.LastUsed = lastUsed
+		}
+		return nil
+	})
+	if err != nil {
+		return e, fmt.Errorf("could not get size of the blob cache: %v", err)
+	}
+	e.Created = e.LastUsed
+	return e, nil
+}
+
+// evict removes an entry of the cache, unless it's in use. It returns if
+// the entry was removed.
+func (h *Handle) evict(e EntryInfo) bool {
+	if e.Type == OciBlobCacheType {
+		unlock, ok := h.lockBlobsExclusive()
+		if !ok {
+			sylog.Debugf("Not evicting the blob cache: in use")
+			return false
+		}
+		defer unlock()
+		dir := h.getCacheTypeDir(OciBlobCacheType)
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			sylog.Warningf("Could not evict the blob cache: %v", err)
+			return false
+		}
+		for _, f := range files {
+			if err := os.RemoveAll(path.Join(dir, f.Name())); err != nil {
+				sylog.Warningf("Could not evict the blob cache: %v", err)
+				return false
+			}
+		}
+		if err := os.RemoveAll(h.entryMetaPath(OciBlobCacheType, "")); err != nil {
+			sylog.Debugf("Could not remove metadata of the blob cache: %v", err)
+		}
+		return true
+	}
+
+	if err := os.RemoveAll(path.Join(h.getCacheTypeDir(e.Type), e.Name)); err != nil {
+		sylog.Warningf("Could not evict %s cache entry %s: %v", e.Type, e.Name, err)
+		return false
+	}
+	if err := os.RemoveAll(h.entryMetaPath(e.Type, e.Name)); err != nil {
+		sylog.Debugf("Could not remove metadata of cache entry '%s': %v", e.Name, err)
+	}
+	return true
+}
@@ -0,0 +1,201 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// pullEntry creates an entry of size bytes like a pull does.
+func pullEntry(h *Handle, cacheType, name string, size int) error {
+	e, err := h.GetEntry(cacheType, name)
+	if err != nil {
+		return err
+	}
+	defer e.CleanTmp()
+	if e.Exists {
+		return nil
+	}
+	if err := os.WriteFile(e.TmpPath, make([]byte, size), 0o600); err != nil {
+		return err
+	}
+	e.Source = "https://example.com/" + name
+	return e.Finalize()
+}
+
+func TestQuotaEviction(t *testing.T) {
+	parentDir := t.TempDir()
+	h, err := New(Config{ParentDir: parentDir, MaxSize: 300})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	for _, name := range []string{"first", "second", "third"} {
+		if err := pullEntry(h, NetCacheType, name, 100); err != nil {
+			t.Fatalf("failed to pull %s: %v", name, err)
+		}
+	}
+	// make the entries used in a known order, first being used last
+	now := time.Now()
+	for i, name := range []string{"second", "third", "first"} {
+		used := now.Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(h.getMetaPath(NetCacheType, name), used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// an entry being pulled is not counted nor evicted
+	pulling, err := h.GetEntry(NetCacheType, "pulling")
+	if err != nil {
+		t.Fatalf("failed to get entry pulling: %v", err)
+	}
+	defer pulling.CleanTmp()
+	if err := os.WriteFile(pulling.TmpPath, make([]byte, 100), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the least recently used entries are evicted for a 150 bytes entry
+	if err := pullEntry(h, LibraryCacheType, "fourth", 150); err != nil {
+		t.Fatalf("failed to pull fourth: %v", err)
+	}
+	dir, _ := h.GetFileCacheDir(NetCacheType)
+	for name, kept := range map[string]bool{"second": false, "third": false, "first": true} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept && err != nil {
+			t.Errorf("entry %s evicted", name)
+		} else if !kept && err == nil {
+			t.Errorf("entry %s not evicted", name)
+		}
+	}
+	if _, err := os.Stat(pulling.TmpPath); err != nil {
+		t.Errorf("entry being pulled removed: %v", err)
+	}
+	if usage, err := h.Usage(); err != nil || usage != 250 {
+		t.Errorf("unexpected usage %d (%v), expected 250", usage, err)
+	}
+
+	// an entry larger than the maximum size fails
+	err = pullEntry(h, NetCacheType, "huge", 301)
+	if err == nil || !strings.Contains(err.Error(), "larger than the maximum cache size") {
+		t.Errorf("unexpected error for an entry larger than the maximum size: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "huge")); err == nil {
+		t.Errorf("entry larger than the maximum size added")
+	}
+}
+
+func TestQuotaBlobsInUse(t *testing.T) {
+	parentDir := t.TempDir()
+	h, err := New(Config{ParentDir: parentDir, MaxSize: 200})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	// another process using the blob cache
+	user, err := New(Config{ParentDir: parentDir})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	blobDir, err := user.GetOciCacheDir(OciBlobCacheType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := filepath.Join(blobDir, "blobs", "sha256", "0123")
+	if err := os.MkdirAll(filepath.Dir(blob), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.WriteFile(blob, make([]byte, 150), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(blob, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pullEntry(h, NetCacheType, "image", 100); err != nil {
+		t.Fatalf("failed to pull image: %v", err)
+	}
+	if _, err := os.Stat(blob); err != nil {
+		t.Errorf("blob cache in use evicted")
+	}
+
+	// once released when the other process exits, the blob cache is evicted
+	unix.Close(user.blobLockFd)
+	user.blobLockFd = -1
+	if err := pullEntry(h, NetCacheType, "image2", 100); err != nil {
+		t.Fatalf("failed to pull image2: %v", err)
+	}
+	if _, err := os.Stat(blob); !os.IsNotExist(err) {
+		t.Errorf("blob cache not evicted")
+	}
+}
+
+func TestQuotaConcurrentPulls(t *testing.T) {
+	const (
+		pulls     = 16
+		entrySize = 100
+		maxSize   = 350
+	)
+	parentDir := t.TempDir()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, pulls)
+	for i := 0; i < pulls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// each pull has its own handle like separate processes
+			h, err := New(Config{ParentDir: parentDir, MaxSize: maxSize})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := pullEntry(h, NetCacheType, fmt.Sprintf("image%d", i), entrySize); err != nil {
+				errs <- fmt.Errorf("pull %d: %w", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	h, err := New(Config{ParentDir: parentDir, MaxSize: maxSize})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	usage, err := h.Usage()
+	if err != nil {
+		t.Fatalf("failed to get cache usage: %v", err)
+	}
+	if usage > maxSize {
+		t.Errorf("cache usage %d exceeds maximum size %d", usage, maxSize)
+	}
+	if usage != 3*entrySize {
+		t.Errorf("cache usage %d, expected %d", usage, 3*entrySize)
+	}
+	dir, _ := h.GetFileCacheDir(NetCacheType)
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), tmpPrefix) {
+			t.Errorf("temporary file %s left", f.Name())
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/sif/v2/pkg/sif"
+	"github.com/opencontainers/go-digest"
+)
+
+// sifHeaderSize is the size of the beginning of a file holding the SIF
+// magic of a SIF image.
+const sifHeaderSize = 2048
+
+// VerifyResult is the result of the verification of a cache entry.
+type VerifyResult struct {
+	EntryInfo
+	// Expected is the digest the entry content is expected to have, empty
+	// if unknown.
+	Expected string `json:"expected,omitempty"`
+	// Actual is the digest of the entry content.
+	Actual string `json:"actual,omitempty"`
+	// Error describes the corruption of the entry, empty if it is valid.
+	Error string `json:"error,omitempty"`
+	// Removed is true if the corrupted entry was removed from the cache.
+	Removed bool `json:"removed,omitempty"`
+}
+
+// VerifyCache verifies the entries of the cacheType cache: the digest of
+// their content is recomputed and compared with the expected digest when
+// it is known, and the SIF images are parsed and the digests of their
+// OCI blobs checked. If remove is true, the corrupted entries are removed
+// so that they are pulled again. The progress function, if not nil, is
+// called after each entry verified with the number of entries verified
+// and to verify.
+func (h *Handle) VerifyCache(cacheType string, remove bool, progress func(result VerifyResult, done, total int)) ([]VerifyResult, error) {
+	if h.disabled {
+		return nil, nil
+	}
+	if cacheType == OciBlobCacheType {
+		// don't let the blobs be evicted or cleaned while verified
+		h.lockBlobs()
+	}
+	entries, err := h.ListEntries(cacheType)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]VerifyResult, 0, len(entries))
+	var corrupted []int
+	for i, e := range entries {
+		r, err := h.verifyEntry(e, remove && cacheType != OciBlobCacheType)
+		if err != nil {
+			return results, err
+		}
+		if r.Error != "" {
+			corrupted = append(corrupted, len(results))
+		}
+		results = append(results, r)
+		if progress != nil {
+			progress(r, i+1, len(entries))
+		}
+	}
+
+	// the blobs can only be removed while the blob cache isn't used
+	if remove && cacheType == OciBlobCacheType && len(corrupted) > 0 {
+		unlock, ok := h.lockBlobsExclusive()
+		if !ok {
+			sylog.Warningf("Could not remove the corrupted blobs: the %s cache is used by a pull or a build", cacheType)
+			return results, nil
+		}
+		defer unlock()
+		for _, i := range corrupted {
+			results[i].Removed = h.removeCorrupted(results[i].EntryInfo)
+		}
+	}
+	return results, nil
+}
+
+// verifyEntry verifies a cache entry, holding its lock so that it isn't
+// replaced by a pull meanwhile, and removes it if corrupted and remove is
+// true.
+func (h *Handle) verifyEntry(e EntryInfo, remove bool) (VerifyResult, error) {
+	r := VerifyResult{EntryInfo: e}
+
+	var entryPath string
+	if e.Type == OciBlobCacheType {
+		entryPath = path.Join(h.getCacheTypeDir(OciBlobCacheType), "blobs", string(digest.SHA256), e.Name)
+		r.Expected = digest.NewDigestFromEncoded(digest.SHA256, e.Name).String()
+	} else {
+		unlock, err := h.lockEntry(e.Type, e.Name)
+		if err != nil {
+			return r, err
+		}
+		defer unlock()
+
+		entryPath = path.Join(h.getCacheTypeDir(e.Type), e.Name)
+		r.Expected = h.expectedDigest(e)
+	}
+
+	actual, err := fileDigest(entryPath)
+	if os.IsNotExist(err) {
+		// removed meanwhile
+		return r, nil
+	} else if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.Actual = actual
+		if r.Expected != "" && r.Actual != r.Expected {
+			r.Error = fmt.Sprintf("digest is %s, expected %s", r.Actual, r.Expected)
+		} else if e.Type == InspectCacheType {
+			if err := verifyInspectMetadata(entryPath); err != nil {
+				r.Error = err.Error()
+			}
+		} else if e.Type != OciBlobCacheType {
+			if err := verifySIF(entryPath, e.Type); err != nil {
+				r.Error = err.Error()
+			}
+		}
+	}
+
+	if r.Error != "" && remove {
+		r.Removed = h.removeCorrupted(e)
+	}
+	return r, nil
+}
+
+// expectedDigest returns the digest the content of an entry of a file
+// cache type is expected to have, as recorded when it was pulled, or
+// given by its name for the library entries. It returns an empty string
+// if it is unknown.
+func (h *Handle) expectedDigest(e EntryInfo) string {
+	meta, _, err := readMeta(h.getMetaPath(e.Type, e.Name))
+	if err == nil && meta.Content != "" {
+		return meta.Content
+	}
+	switch e.Type {
+	case LibraryCacheType:
+		// library images are stored by the hash of their content
+		if strings.HasPrefix(e.Name, "sha256.") {
+			return digest.NewDigestFromEncoded(digest.SHA256, strings.TrimPrefix(e.Name, "sha256.")).String()
+		}
+	case NetCacheType, ShubCacheType:
+		// the digest of the entries of older versions is their content's
+		return meta.Digest
+	}
+	return ""
+}
+
+// verifySIF checks a SIF image of the cache can be loaded, and that its
+// OCI blobs match their digest. The images of the net and shub caches
+// aren't necessarily SIF images.
+func verifySIF(file, cacheType string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b := make([]byte, sifHeaderSize)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	if !bytes.Contains(b[:n], []byte("SIF_MAGIC")) {
+		if cacheType == NetCacheType || cacheType == ShubCacheType {
+			return nil
+		}
+		return fmt.Errorf("not a SIF image")
+	}
+
+	fimg, err := sif.LoadContainer(f, sif.OptLoadWithCloseOnUnload(false))
+	if err != nil {
+		return fmt.Errorf("invalid SIF image: %v", err)
+	}
+	defer fimg.UnloadContainer()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	descrs, err := fimg.GetDescriptors()
+	if err != nil && err != sif.ErrNoObjects {
+		return fmt.Errorf("invalid SIF image: %v", err)
+	}
+	for _, d := range descrs {
+		if d.Offset() < 0 || d.Size() < 0 || d.Offset()+d.Size() > fi.Size() {
+			return fmt.Errorf("SIF object %d is truncated", d.ID())
+		}
+		expected, err := d.OCIBlobDigest()
+		if err != nil {
+			// not an OCI blob
+			continue
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, d.GetReader()); err != nil {
+			return fmt.Errorf("could not read SIF object %d: %v", d.ID(), err)
+		}
+		if actual := hex.EncodeToString(h.Sum(nil)); expected.Algorithm != "sha256" || actual != expected.Hex {
+			return fmt.Errorf("digest of SIF object %d is sha256:%s, expected %s", d.ID(), actual, expected)
+		}
+	}
+	return nil
+}
+
+// verifyInspectMetadata checks the remote image metadata recorded in the
+// inspect cache can be decoded.
+func verifyInspectMetadata(file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(b) {
+		return fmt.Errorf("invalid inspect metadata")
+	}
+	return nil
+}
+
+// removeCorrupted removes a corrupted entry from the cache, and returns
+// true if it was removed.
+func (h *Handle) removeCorrupted(e EntryInfo) bool {
+	entryPath := path.Join(h.getCacheTypeDir(e.Type), e.Name)
+	if e.Type == OciBlobCacheType {
+		entryPath = path.Join(h.getCacheTypeDir(e.Type), "blobs", string(digest.SHA256), e.Name)
+	}
+	if err := os.Remove(entryPath); err != nil && !os.IsNotExist(err) {
+		sylog.Errorf("Could not remove corrupted %s cache entry %s: %v", e.Type, e.Name, err)
+		return false
+	}
+	if e.Type != OciBlobCacheType {
+		if err := os.Remove(h.getMetaPath(e.Type, e.Name)); err != nil && !os.IsNotExist(err) {
+			sylog.Debugf("Could not remove metadata of cache entry %s: %v", e.Name, err)
+		}
+	}
+	return true
+}
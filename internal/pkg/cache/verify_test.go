@@ -0,0 +1,239 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// corrupt replaces old with new in a file, keeping its modification time.
+func corrupt(t *testing.T, file, old, new string) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte(old)) {
+		t.Fatalf("%q not found in %s", old, file)
+	}
+	b = bytes.Replace(b, []byte(old), []byte(new), 1)
+	if err := os.WriteFile(file, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyCache(t *testing.T) {
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	for _, name := range []string{"valid", "corrupted"} {
+		e, err := h.GetEntry(NetCacheType, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(e.TmpPath, []byte("image content"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		e.Source = "https://example.com/" + name
+		if err := e.Finalize(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir, _ := h.GetFileCacheDir(NetCacheType)
+	corrupt(t, filepath.Join(dir, "corrupted"), "content", "CONTENT")
+
+	results, err := h.VerifyCache(NetCacheType, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	for _, r := range results {
+		switch r.Name {
+		case "valid":
+			if r.Error != "" {
+				t.Errorf("unexpected error for valid entry: %s", r.Error)
+			}
+		case "corrupted":
+			if !strings.Contains(r.Error, "digest is") || r.Source != "https://example.com/corrupted" || r.Removed {
+				t.Errorf("unexpected result for corrupted entry: %+v", r)
+			}
+		}
+	}
+
+	// the corrupted entry is removed, not the valid one
+	results, err = h.VerifyCache(NetCacheType, true, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, r := range results {
+		if r.Removed != (r.Name == "corrupted") {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+	entries, err := h.ListEntries(NetCacheType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "valid" {
+		t.Errorf("unexpected entries after removal %+v", entries)
+	}
+}
+
+func TestVerifyCacheBlobs(t *testing.T) {
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if _, err := storeBlobsImage(h, "docker://alpine:latest", "alpine layer"); err != nil {
+		t.Fatal(err)
+	}
+	blobs, _ := filepath.Glob(filepath.Join(h.getCacheTypeDir(OciBlobCacheType), "blobs", "sha256", "*"))
+	for _, b := range blobs {
+		if c, _ := os.ReadFile(b); string(c) == "alpine layer" {
+			corrupt(t, b, "alpine", "ALPINE")
+		}
+	}
+
+	results, err := h.VerifyCache(OciBlobCacheType, true, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	corrupted := 0
+	for _, r := range results {
+		if r.Error == "" {
+			continue
+		}
+		corrupted++
+		if len(r.Referrers) != 1 || r.Referrers[0] != "docker://alpine:latest" || !r.Removed {
+			t.Errorf("unexpected result for corrupted blob: %+v", r)
+		}
+		if _, err := os.Stat(filepath.Join(h.getCacheTypeDir(OciBlobCacheType), "blobs", "sha256", r.Name)); !os.IsNotExist(err) {
+			t.Errorf("corrupted blob %s not removed", r.Name)
+		}
+	}
+	if corrupted != 1 {
+		t.Errorf("found %d corrupted blobs, expected 1: %+v", corrupted, results)
+	}
+}
+
+func TestVerifyCacheSIF(t *testing.T) {
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	// an OCI-SIF image, and an image which isn't a SIF image
+	e, err := h.GetEntry(OciTempCacheType, "ocisif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	di, err := sif.NewDescriptorInput(sif.DataOCIBlob, strings.NewReader("blob content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fimg, err := sif.CreateContainerAtPath(e.TmpPath, sif.OptCreateWithDescriptors(di))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+	e.Digest = "sha256:image"
+	if err := e.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pullEntry(h, OciTempCacheType, "notsif", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// the content digests are unknown for the entries of older versions
+	dir, _ := h.GetFileCacheDir(OciTempCacheType)
+	corrupt(t, filepath.Join(dir, "ocisif"), "blob content", "BLOB content")
+	for _, name := range []string{"ocisif", "notsif"} {
+		if err := writeMeta(h.getMetaPath(OciTempCacheType, name), entryMeta{Source: "docker://" + name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := h.VerifyCache(OciTempCacheType, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"ocisif": "digest of SIF object 1",
+		"notsif": "not a SIF image",
+	}
+	for _, r := range results {
+		if !strings.Contains(r.Error, expected[r.Name]) || r.Error == "" {
+			t.Errorf("unexpected error for %s: %q, expected %q", r.Name, r.Error, expected[r.Name])
+		}
+	}
+}
+
+func TestVerifyCacheInspect(t *testing.T) {
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	if _, ok := h.LookupEntry(InspectCacheType, "sha256:metadata"); ok {
+		t.Errorf("unexpected entry found in an empty cache")
+	}
+	e, err := h.GetEntry(InspectCacheType, "sha256:metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(e.TmpPath, []byte(`{"source": "docker://alpine"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	if path, ok := h.LookupEntry(InspectCacheType, "sha256:metadata"); !ok || path != e.Path {
+		t.Errorf("got entry %s (%v), expected %s", path, ok, e.Path)
+	}
+	if _, ok := h.LookupEntry("unknown", "sha256:metadata"); ok {
+		t.Errorf("unexpected entry found for an unknown cache type")
+	}
+	if err := pullEntry(h, InspectCacheType, "invalid", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := h.VerifyCache(InspectCacheType, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"sha256:metadata": "",
+		"invalid":         "invalid inspect metadata",
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("got %d results, expected %d", len(results), len(expected))
+	}
+	for _, r := range results {
+		if r.Error != expected[r.Name] {
+			t.Errorf("unexpected error for %s: %q, expected %q", r.Name, r.Error, expected[r.Name])
+		}
+	}
+}
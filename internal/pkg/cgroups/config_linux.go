@@ -194,6 +194,27 @@ func UnmarshalJSONResources(data string) (*specs.LinuxResources, error) {
 	return &res, nil
 }
 
+// MergeJSONResources returns the JSON resources of base updated with those
+// set in update. Values set in update replace those of base, others are
+// kept.
+func MergeJSONResources(base, update string) (string, error) {
+	res := specs.LinuxResources{}
+	if base != "" {
+		if err := json.Unmarshal([]byte(base), &res); err != nil {
+			return "", err
+		}
+	}
+	// unmarshaling reuses the structures already allocated by base
+	if err := json.Unmarshal([]byte(update), &res); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 // LoadConfig loads a TOML cgroups config file into our native cgroups.Config struct
 func LoadConfig(confPath string) (config Config, err error) {
 	path, err := filepath.Abs(confPath)
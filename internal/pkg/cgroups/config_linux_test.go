@@ -0,0 +1,47 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"testing"
+)
+
+func TestMergeJSONResources(t *testing.T) {
+	base := `{"memory":{"limit":1073741824,"reservation":536870912},"pids":{"limit":100}}`
+	update := `{"memory":{"limit":2147483648},"cpu":{"shares":512}}`
+
+	merged, err := MergeJSONResources(base, update)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	res, err := UnmarshalJSONResources(merged)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.Memory == nil || res.Memory.Limit == nil || *res.Memory.Limit != 2147483648 {
+		t.Errorf("memory limit not updated: %s", merged)
+	}
+	if res.Memory.Reservation == nil || *res.Memory.Reservation != 536870912 {
+		t.Errorf("memory reservation not kept: %s", merged)
+	}
+	if res.Pids == nil || res.Pids.Limit != 100 {
+		t.Errorf("pids limit not kept: %s", merged)
+	}
+	if res.CPU == nil || res.CPU.Shares == nil || *res.CPU.Shares != 512 {
+		t.Errorf("cpu shares not added: %s", merged)
+	}
+
+	if _, err := MergeJSONResources("", update); err != nil {
+		t.Errorf("unexpected error with empty base: %s", err)
+	}
+	if _, err := MergeJSONResources(base, "{"); err == nil {
+		t.Errorf("unexpected success with invalid update")
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	lccgroups "github.com/opencontainers/runc/libcontainer/cgroups"
+)
+
+// ErrNotUnified is returned when memory events or pressure are requested
+// on a system which isn't using cgroups v2 with a unified hierarchy.
+var ErrNotUnified = errors.New("memory events are only available with cgroups v2")
+
+// MemoryEvents holds the cumulative counters of the cgroups v2
+// memory.events file.
+type MemoryEvents struct {
+	Low     uint64 `json:"low"`
+	High    uint64 `json:"high"`
+	Max     uint64 `json:"max"`
+	OOM     uint64 `json:"oom"`
+	OOMKill uint64 `json:"oom_kill"`
+}
+
+// PSIData holds the pressure stall information averages over 10, 60 and
+// 300 seconds as percentages, and the total stall time in microseconds.
+type PSIData struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"`
+}
+
+// PSIStats holds the pressure stall information for tasks where some
+// or all (full) of them were stalled.
+type PSIStats struct {
+	Some PSIData `json:"some"`
+	Full PSIData `json:"full"`
+}
+
+// unifiedPath returns the path of the managed cgroup in the cgroups v2
+// hierarchy.
+func (m *Manager) unifiedPath() (string, error) {
+	if m.group == "" || m.cgroup == nil {
+		return "", ErrUnitialized
+	}
+	if !lccgroups.IsCgroup2UnifiedMode() {
+		return "", ErrNotUnified
+	}
+	return m.cgroup.Path(""), nil
+}
+
+// GetMemoryEvents returns the memory events counters of the managed cgroup.
+func (m *Manager) GetMemoryEvents() (*MemoryEvents, error) {
+	path, err := m.unifiedPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(path, "memory.events"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseMemoryEvents(f)
+}
+
+// GetMemoryPressure returns the memory pressure stall information of
+// the managed cgroup.
+func (m *Manager) GetMemoryPressure() (*PSIStats, error) {
+	path, err := m.unifiedPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(path, "memory.pressure"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parsePSI(f)
+}
+
+// GetMemoryLimit returns the memory limit in bytes of the managed cgroup,
+// or 0 if there is no limit.
+func (m *Manager) GetMemoryLimit() (uint64, error) {
+	path, err := m.unifiedPath()
+	if err != nil {
+		return 0, err
+	}
+	b, err := os.ReadFile(filepath.Join(path, "memory.max"))
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(b))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// MonitorMemoryEvents polls the memory events of the managed cgroup every
+// interval and calls fn with the previous and current counters when they
+// change. The memory.events file isn't kept open between polls so the
+// monitoring doesn't keep the cgroup alive. The returned function stops
+// the monitoring and waits for it to complete.
+func (m *Manager) MonitorMemoryEvents(interval time.Duration, fn func(prev, cur *MemoryEvents)) (stop func(), err error) {
+	prev, err := m.GetMemoryEvents()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				cur, err := m.GetMemoryEvents()
+				if err != nil {
+					// cgroup is gone
+					return
+				}
+				if *cur != *prev {
+					fn(prev, cur)
+					prev = cur
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}, nil
+}
+
+// parseMemoryEvents parses the content of a memory.events file.
+func parseMemoryEvents(r io.Reader) (*MemoryEvents, error) {
+	events := &MemoryEvents{}
+	fields := map[string]*uint64{
+		"low":      &events.Low,
+		"high":     &events.High,
+		"max":      &events.Max,
+		"oom":      &events.OOM,
+		"oom_kill": &events.OOMKill,
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		kv := strings.Fields(scanner.Text())
+		if len(kv) != 2 {
+			continue
+		}
+		field, ok := fields[kv[0]]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing memory event %s: %w", kv[0], err)
+		}
+		*field = v
+	}
+	return events, scanner.Err()
+}
+
+// parsePSI parses the content of a pressure stall information file, like:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePSI(r io.Reader) (*PSIStats, error) {
+	stats := &PSIStats{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var data *PSIData
+		switch fields[0] {
+		case "some":
+			data = &stats.Some
+		case "full":
+			data = &stats.Full
+		default:
+			continue
+		}
+
+		for _, f := range fields[1:] {
+			k, v, ok := strings.Cut(f, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid pressure stall information field %q", f)
+			}
+			var err error
+			switch k {
+			case "avg10":
+				data.Avg10, err = strconv.ParseFloat(v, 64)
+			case "avg60":
+				data.Avg60, err = strconv.ParseFloat(v, 64)
+			case "avg300":
+				data.Avg300, err = strconv.ParseFloat(v, 64)
+			case "total":
+				data.Total, err = strconv.ParseUint(v, 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("while parsing pressure stall information %s: %w", k, err)
+			}
+		}
+	}
+	return stats, scanner.Err()
+}
@@ -0,0 +1,52 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMemoryEvents(t *testing.T) {
+	content := "low 1\nhigh 2\nmax 3\noom 4\noom_kill 5\noom_group_kill 6\n"
+
+	events, err := parseMemoryEvents(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := MemoryEvents{Low: 1, High: 2, Max: 3, OOM: 4, OOMKill: 5}
+	if *events != want {
+		t.Errorf("got %+v, want %+v", *events, want)
+	}
+
+	if _, err := parseMemoryEvents(strings.NewReader("oom_kill x\n")); err == nil {
+		t.Errorf("unexpected success with invalid counter")
+	}
+}
+
+func TestParsePSI(t *testing.T) {
+	content := "some avg10=1.50 avg60=0.25 avg300=0.00 total=1234\n" +
+		"full avg10=0.50 avg60=0.10 avg300=0.00 total=567\n"
+
+	stats, err := parsePSI(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := PSIStats{
+		Some: PSIData{Avg10: 1.5, Avg60: 0.25, Total: 1234},
+		Full: PSIData{Avg10: 0.5, Avg60: 0.1, Total: 567},
+	}
+	if *stats != want {
+		t.Errorf("got %+v, want %+v", *stats, want)
+	}
+
+	if _, err := parsePSI(strings.NewReader("some avg10\n")); err == nil {
+		t.Errorf("unexpected success with invalid field")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	lccgroups "github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// The cgroups modes, selecting where the cgroup of a container is created.
+const (
+	// ModeCreate creates a new cgroup for the container, with the cgroups
+	// manager set in apptainer.conf.
+	ModeCreate = "create"
+	// ModeJoinJob creates the container cgroup beneath the cgroup of the
+	// invoking process, e.g. the cgroup of a batch scheduler job, when
+	// it's delegated to the user.
+	ModeJoinJob = "join-job"
+	// ModeNone doesn't set up any cgroup for the container.
+	ModeNone = "none"
+)
+
+// CurrentGroup returns the path of the cgroup of the current process,
+// relative to the cgroup mount point.
+func CurrentGroup() (string, error) {
+	return pidToPath(os.Getpid())
+}
+
+// CheckJobDelegation checks that the current user can create a sub-cgroup of
+// group, relative to the cgroup mount point, applying resources. Root can
+// create a sub-cgroup anywhere, while other users need group to be delegated
+// to them, with the controllers needed by resources enabled for its
+// children.
+func CheckJobDelegation(group string, resources *specs.LinuxResources) error {
+	if os.Getuid() == 0 {
+		return nil
+	}
+	if !lccgroups.IsCgroup2UnifiedMode() {
+		return fmt.Errorf("rootless cgroups requires cgroups v2")
+	}
+	return checkDirDelegation(filepath.Join(unifiedMountPoint, group), requiredControllers(resources))
+}
+
+// checkDirDelegation checks that the cgroup v2 directory dir lets the
+// current user create a sub-cgroup, move processes into it, and apply limits
+// with controllers.
+func checkDirDelegation(dir string, controllers []string) error {
+	if err := unix.Access(dir, unix.W_OK); err != nil {
+		return fmt.Errorf("cgroup %s is not delegated to the current user", dir)
+	}
+	if err := unix.Access(filepath.Join(dir, "cgroup.procs"), unix.W_OK); err != nil {
+		return fmt.Errorf("cgroup %s is not delegated to the current user", dir)
+	}
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return fmt.Errorf("while reading cgroup subtree controllers: %w", err)
+	}
+	enabled := strings.Fields(string(data))
+
+	var missing []string
+	for _, c := range controllers {
+		found := false
+		for _, e := range enabled {
+			if e == c {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("cgroup controllers %s are not enabled for the sub-cgroups of %s", strings.Join(missing, ", "), dir)
+	}
+	return nil
+}
+
+// NewJobManagerWithJSON creates a Manager for a new cgroup apptainer-<pid>
+// beneath the job cgroup parent, relative to the cgroup mount point,
+// applies the JSON configuration supplied, and adds pid to the cgroup. The
+// cgroupfs manager is always used, as the job cgroup isn't managed by
+// systemd for the user.
+func NewJobManagerWithJSON(jsonSpec string, pid int, parent string) (manager *Manager, err error) {
+	if pid == 0 {
+		return nil, fmt.Errorf("a pid is required to create a new cgroup")
+	}
+	spec, err := UnmarshalJSONResources(jsonSpec)
+	if err != nil {
+		return nil, fmt.Errorf("while loading cgroups spec: %w", err)
+	}
+	group := filepath.Join(parent, "apptainer-"+strconv.Itoa(pid))
+
+	sylog.Debugf("Creating cgroups manager for %s", group)
+
+	mgr, err := newManagerRootless(spec, group, false, os.Getuid() != 0)
+	if err != nil {
+		return nil, err
+	}
+	return mgr, mgr.applyAndAddProc(spec, pid)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeJobCgroup creates a directory looking like a cgroup v2 job cgroup,
+// with the subtree controllers enabled and the directory and cgroup.procs
+// modes given.
+func fakeJobCgroup(t *testing.T, subtree string, dirMode, procsMode os.FileMode) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "job_1234")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte(subtree+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	procs := filepath.Join(dir, "cgroup.procs")
+	if err := os.WriteFile(procs, nil, procsMode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(procs, procsMode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, dirMode); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0o755) })
+	return dir
+}
+
+func TestCheckDirDelegation(t *testing.T) {
+	tests := []struct {
+		name        string
+		subtree     string
+		dirMode     os.FileMode
+		procsMode   os.FileMode
+		controllers []string
+		// unprivileged marks the cases relying on permissions, that root
+		// bypasses
+		unprivileged bool
+		wantErr      bool
+	}{
+		{
+			name:        "Delegated",
+			subtree:     "cpu memory pids",
+			dirMode:     0o755,
+			procsMode:   0o644,
+			controllers: []string{"cpu", "memory"},
+		},
+		{
+			name:      "DelegatedNoControllers",
+			dirMode:   0o755,
+			procsMode: 0o644,
+		},
+		{
+			name:        "ControllerNotEnabled",
+			subtree:     "cpu pids",
+			dirMode:     0o755,
+			procsMode:   0o644,
+			controllers: []string{"cpu", "memory"},
+			wantErr:     true,
+		},
+		{
+			name:         "DirNotWritable",
+			subtree:      "cpu memory pids",
+			dirMode:      0o555,
+			procsMode:    0o644,
+			unprivileged: true,
+			wantErr:      true,
+		},
+		{
+			name:         "ProcsNotWritable",
+			subtree:      "cpu memory pids",
+			dirMode:      0o755,
+			procsMode:    0o444,
+			unprivileged: true,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.unprivileged && os.Getuid() == 0 {
+				t.Skip("permissions are not enforced for root")
+			}
+			dir := fakeJobCgroup(t, tt.subtree, tt.dirMode, tt.procsMode)
+			err := checkDirDelegation(dir, tt.controllers)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkDirDelegation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 	lcconfigs "github.com/opencontainers/runc/libcontainer/configs"
 	lcspecconv "github.com/opencontainers/runc/libcontainer/specconv"
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
 )
 
 var ErrUnitialized = errors.New("cgroups manager is not initialized")
@@ -170,6 +171,76 @@ func (m *Manager) UpdateFromFile(path string) error {
 	return m.UpdateFromSpec(&spec)
 }
 
+// requiredControllers returns the cgroups v2 controllers needed to apply
+// resources.
+func requiredControllers(resources *specs.LinuxResources) []string {
+	var controllers []string
+	if r := resources.CPU; r != nil {
+		if r.Shares != nil || r.Quota != nil || r.Period != nil || r.RealtimeRuntime != nil || r.RealtimePeriod != nil {
+			controllers = append(controllers, "cpu")
+		}
+		if r.Cpus != "" || r.Mems != "" {
+			controllers = append(controllers, "cpuset")
+		}
+	}
+	if resources.BlockIO != nil {
+		controllers = append(controllers, "io")
+	}
+	if resources.Memory != nil {
+		controllers = append(controllers, "memory")
+	}
+	if resources.Pids != nil {
+		controllers = append(controllers, "pids")
+	}
+	if len(resources.HugepageLimits) > 0 {
+		controllers = append(controllers, "hugetlb")
+	}
+	return controllers
+}
+
+// CheckDelegation checks that the managed cgroup can be updated with
+// resources by the current user. Root can update any cgroup, while other
+// users can only update cgroups v2 controllers delegated to them.
+func (m *Manager) CheckDelegation(resources *specs.LinuxResources) error {
+	if m.group == "" || m.cgroup == nil {
+		return ErrUnitialized
+	}
+	if os.Getuid() == 0 {
+		return nil
+	}
+	if !lccgroups.IsCgroup2UnifiedMode() {
+		return fmt.Errorf("rootless cgroups requires cgroups v2")
+	}
+
+	path := m.cgroup.Path("")
+	if err := unix.Access(filepath.Join(path, "cgroup.procs"), unix.W_OK); err != nil {
+		return fmt.Errorf("cgroup %s is not delegated to the current user", path)
+	}
+	data, err := os.ReadFile(filepath.Join(path, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("while reading cgroup controllers: %w", err)
+	}
+	available := strings.Fields(string(data))
+
+	var missing []string
+	for _, c := range requiredControllers(resources) {
+		found := false
+		for _, a := range available {
+			if a == c {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("cgroup controllers %s are not delegated to the current user", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 // AddProc adds the process with specified pid to the managed cgroup
 //
 // Disable context check as it raises a warning throuch lcmanager.New, which is
@@ -223,6 +294,15 @@ func (m *Manager) Thaw() (err error) {
 	return m.cgroup.Freeze(lcconfigs.Thawed)
 }
 
+// GetPids returns the PIDs of the processes in the managed cgroup and its
+// sub-cgroups.
+func (m *Manager) GetPids() ([]int, error) {
+	if m.group == "" || m.cgroup == nil {
+		return nil, ErrUnitialized
+	}
+	return m.cgroup.GetAllPids()
+}
+
 // Destroy deletes the managed cgroup.
 func (m *Manager) Destroy() (err error) {
 	if m.group == "" || m.cgroup == nil {
@@ -242,14 +322,8 @@ func checkRootless(group string, systemd bool) (rootless bool, err error) {
 		return false, nil
 	}
 
-	if !lccgroups.IsCgroup2HybridMode() && !lccgroups.IsCgroup2UnifiedMode() {
-		return false, fmt.Errorf("rootless cgroups requires cgroups v2")
-	}
-	if !systemd {
-		return false, fmt.Errorf("rootless cgroups require 'systemd cgroups' to be enabled in apptainer.conf")
-	}
-	if os.Getenv("XDG_RUNTIME_DIR") == "" || os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
-		return false, fmt.Errorf("rootless cgroups require a D-Bus session - check that XDG_RUNTIME_DIR and DBUS_SESSION_BUS_ADDRESS are set")
+	if err := CheckRootless(systemd); err != nil {
+		return false, err
 	}
 
 	if !strings.HasPrefix(group, "user.slice:") {
@@ -259,6 +333,22 @@ func checkRootless(group string, systemd bool) (rootless bool, err error) {
 	return true, nil
 }
 
+// CheckRootless checks that the host supports cgroups for a non-root
+// user, which requires cgroups v2, the systemd cgroups manager and a D-Bus
+// session to delegate a cgroup to the user.
+func CheckRootless(systemd bool) error {
+	if !lccgroups.IsCgroup2HybridMode() && !lccgroups.IsCgroup2UnifiedMode() {
+		return fmt.Errorf("rootless cgroups requires cgroups v2")
+	}
+	if !systemd {
+		return fmt.Errorf("rootless cgroups require 'systemd cgroups' to be enabled in apptainer.conf")
+	}
+	if os.Getenv("XDG_RUNTIME_DIR") == "" || os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return fmt.Errorf("rootless cgroups require a D-Bus session - check that XDG_RUNTIME_DIR and DBUS_SESSION_BUS_ADDRESS are set")
+	}
+	return nil
+}
+
 // newManager creates a new Manager, with the associated resources and cgroup.
 // The Manager is ready to manage the cgroup but does not apply limits etc.
 //
@@ -278,6 +368,14 @@ func newManager(resources *specs.LinuxResources, group string, systemd bool) (ma
 	if err != nil {
 		return nil, err
 	}
+	return newManagerRootless(resources, group, systemd, rootless)
+}
+
+// newManagerRootless creates a new Manager like newManager, once it's known
+// whether rootless cgroups are used.
+//
+// nolint:contextcheck
+func newManagerRootless(resources *specs.LinuxResources, group string, systemd, rootless bool) (manager *Manager, err error) {
 	// Rootless manager code invokes systemctl, which it expects to be on PATH.
 	// Must set default PATH as starter sets up a very stripped down environment.
 	if rootless {
@@ -337,6 +435,7 @@ func newManager(resources *specs.LinuxResources, group string, systemd bool) (ma
 }
 
 // NewManagerWithSpec creates a Manager, applies the configuration in spec, and adds pid to the cgroup.
+// The limits are in effect before pid is added to the cgroup.
 // If a group name is supplied, it will be used by the manager.
 // If group = "" then "/apptainer/<pid>" is used as a default.
 func NewManagerWithSpec(spec *specs.LinuxResources, pid int, group string, systemd bool) (manager *Manager, err error) {
@@ -361,15 +460,37 @@ func NewManagerWithSpec(spec *specs.LinuxResources, pid int, group string, syste
 	if err != nil {
 		return nil, err
 	}
-	// Apply the cgroup to pid (add pid to cgroup)
-	if err := mgr.cgroup.Apply(pid); err != nil {
-		return nil, err
-	}
-	if err := mgr.UpdateFromSpec(spec); err != nil {
-		return nil, err
+	// The systemd manager sets limits as properties of the scope unit
+	// created for pid. With cgroupfs the cgroup is created and its limits
+	// written before pid is added, so that pid never runs unconstrained.
+	if systemd {
+		if err := mgr.cgroup.Apply(pid); err != nil {
+			return nil, err
+		}
+		if err := mgr.UpdateFromSpec(spec); err != nil {
+			return nil, err
+		}
+		return mgr, nil
 	}
 
-	return mgr, nil
+	return mgr, mgr.applyAndAddProc(spec, pid)
+}
+
+// applyAndAddProc creates the cgroupfs managed cgroup, writes its limits and
+// then adds pid, so that pid never runs unconstrained.
+func (m *Manager) applyAndAddProc(spec *specs.LinuxResources, pid int) error {
+	if err := m.cgroup.Apply(-1); err != nil {
+		return err
+	}
+	if err := m.UpdateFromSpec(spec); err != nil {
+		_ = m.Destroy()
+		return err
+	}
+	if err := m.AddProc(pid); err != nil {
+		_ = m.Destroy()
+		return fmt.Errorf("while adding process %d to cgroup: %w", pid, err)
+	}
+	return nil
 }
 
 // NewManagerWithJSON creates a Manager, applies the JSON configuration supplied, and adds pid to the cgroup.
@@ -16,6 +16,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -23,6 +24,7 @@ import (
 
 	"github.com/apptainer/apptainer/internal/pkg/test"
 	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
+	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
 // This file contains tests that will run under cgroups v1 & v2, and test utility functions.
@@ -47,6 +49,53 @@ func TestCgroups(t *testing.T) {
 	runSystemdTests(t, tests)
 }
 
+func TestRequiredControllers(t *testing.T) {
+	shares := uint64(1024)
+	limit := int64(1 << 30)
+
+	tests := []struct {
+		name      string
+		resources specs.LinuxResources
+		want      []string
+	}{
+		{
+			name: "None",
+		},
+		{
+			name: "CPUAndMemory",
+			resources: specs.LinuxResources{
+				CPU:    &specs.LinuxCPU{Shares: &shares},
+				Memory: &specs.LinuxMemory{Limit: &limit},
+			},
+			want: []string{"cpu", "memory"},
+		},
+		{
+			name: "CpusetOnly",
+			resources: specs.LinuxResources{
+				CPU: &specs.LinuxCPU{Cpus: "0-1"},
+			},
+			want: []string{"cpuset"},
+		},
+		{
+			name: "PidsAndIO",
+			resources: specs.LinuxResources{
+				BlockIO: &specs.LinuxBlockIO{},
+				Pids:    &specs.LinuxPids{Limit: 10},
+			},
+			want: []string{"io", "pids"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := requiredControllers(&tt.resources)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got controllers %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func runCgroupfsTests(t *testing.T, tests CgroupTests) {
 	t.Run("cgroupfs", func(t *testing.T) {
 		for _, tt := range tests {
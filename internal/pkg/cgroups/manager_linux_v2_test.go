@@ -15,6 +15,7 @@ import (
 	"path"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/test"
 	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
@@ -51,6 +52,10 @@ func TestCgroupsV2(t *testing.T) {
 			name:     "FreezeThaw",
 			testFunc: testFreezeThawV2,
 		},
+		{
+			name:     "MemoryEvents",
+			testFunc: testMemoryEventsV2,
+		},
 	}
 	runCgroupfsTests(t, tests)
 	runSystemdTests(t, tests)
@@ -202,3 +207,35 @@ func testFreezeThawV2(t *testing.T, systemd bool) {
 	ensureStateBecomes(t, pid, "RS")
 	ensureInt(t, freezePath, 0)
 }
+
+func testMemoryEventsV2(t *testing.T, systemd bool) {
+	manager := &Manager{}
+	if _, err := manager.GetMemoryEvents(); err == nil {
+		t.Errorf("unexpected success getting memory events of uninitialized manager")
+	}
+
+	_, manager, cleanup := testManager(t, systemd)
+	defer cleanup()
+
+	events, err := manager.GetMemoryEvents()
+	if err != nil {
+		t.Fatalf("While getting memory events: %v", err)
+	}
+	if events.OOMKill != 0 {
+		t.Errorf("Unexpected oom_kill count %d", events.OOMKill)
+	}
+	if _, err := manager.GetMemoryPressure(); err != nil {
+		t.Errorf("While getting memory pressure: %v", err)
+	}
+	if _, err := manager.GetMemoryLimit(); err != nil {
+		t.Errorf("While getting memory limit: %v", err)
+	}
+
+	stop, err := manager.MonitorMemoryEvents(10*time.Millisecond, func(prev, cur *MemoryEvents) {})
+	if err != nil {
+		t.Fatalf("While monitoring memory events: %v", err)
+	}
+	stop()
+	// stopping twice must not block or panic
+	stop()
+}
@@ -0,0 +1,270 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	lccgroups "github.com/opencontainers/runc/libcontainer/cgroups"
+)
+
+// Metrics holds the resource usage counters of a cgroup. A counter is nil
+// when the controller providing it isn't available for the cgroup.
+type Metrics struct {
+	// CPUTime is the total CPU time consumed, in nanoseconds.
+	CPUTime *uint64 `json:"cpu_time_ns,omitempty"`
+	// MemoryCurrent is the current memory usage, in bytes.
+	MemoryCurrent *uint64 `json:"memory_current_bytes,omitempty"`
+	// MemoryPeak is the maximum memory usage recorded, in bytes.
+	MemoryPeak *uint64 `json:"memory_peak_bytes,omitempty"`
+	// Pids is the current number of processes.
+	Pids *uint64 `json:"pids,omitempty"`
+	// BlockRead and BlockWrite are the bytes read from and written to
+	// block devices.
+	BlockRead  *uint64 `json:"block_read_bytes,omitempty"`
+	BlockWrite *uint64 `json:"block_write_bytes,omitempty"`
+	// NetworkReceive and NetworkTransmit are the bytes received and
+	// transmitted by the network interfaces, excluding loopback.
+	NetworkReceive  *uint64 `json:"network_receive_bytes,omitempty"`
+	NetworkTransmit *uint64 `json:"network_transmit_bytes,omitempty"`
+}
+
+// controllerPath returns the path of the managed cgroup for a controller,
+// or an empty string if the controller isn't available.
+func (m *Manager) controllerPath(controller string) string {
+	if lccgroups.IsCgroup2UnifiedMode() {
+		return m.cgroup.Path("")
+	}
+	return m.cgroup.Path(controller)
+}
+
+// GetMetrics returns the resource usage counters of the managed cgroup.
+// Network counters are read from the network namespace of the process
+// pid, they are omitted if pid is 0.
+func (m *Manager) GetMetrics(pid int) (*Metrics, error) {
+	if m.group == "" || m.cgroup == nil {
+		return nil, ErrUnitialized
+	}
+
+	metrics := &Metrics{}
+	unified := lccgroups.IsCgroup2UnifiedMode()
+
+	if path := m.controllerPath("cpuacct"); path != "" {
+		if unified {
+			if usage, err := readCgroupFile(filepath.Join(path, "cpu.stat"), parseCPUStat); err == nil {
+				metrics.CPUTime = usage
+			}
+		} else if usage, err := readCgroupFile(filepath.Join(path, "cpuacct.usage"), parseUint); err == nil {
+			metrics.CPUTime = usage
+		}
+	}
+
+	if path := m.controllerPath("memory"); path != "" {
+		current, peak := "memory.current", "memory.peak"
+		if !unified {
+			current, peak = "memory.usage_in_bytes", "memory.max_usage_in_bytes"
+		}
+		if v, err := readCgroupFile(filepath.Join(path, current), parseUint); err == nil {
+			metrics.MemoryCurrent = v
+		}
+		if v, err := readCgroupFile(filepath.Join(path, peak), parseUint); err == nil {
+			metrics.MemoryPeak = v
+		}
+	}
+
+	if path := m.controllerPath("pids"); path != "" {
+		if v, err := readCgroupFile(filepath.Join(path, "pids.current"), parseUint); err == nil {
+			metrics.Pids = v
+		}
+	}
+
+	if path := m.controllerPath("blkio"); path != "" {
+		var stat *blockIO
+		var err error
+		if unified {
+			stat, err = readCgroupFile(filepath.Join(path, "io.stat"), parseIOStat)
+		} else {
+			// the throttle file accounts for the I/O of all schedulers
+			stat, err = readCgroupFile(filepath.Join(path, "blkio.throttle.io_service_bytes_recursive"), parseBlkioServiceBytes)
+		}
+		if err == nil {
+			metrics.BlockRead = &stat.read
+			metrics.BlockWrite = &stat.write
+		}
+	}
+
+	if pid > 0 {
+		if net, err := readCgroupFile(fmt.Sprintf("/proc/%d/net/dev", pid), parseNetDev); err == nil {
+			metrics.NetworkReceive = &net.read
+			metrics.NetworkTransmit = &net.write
+		}
+	}
+
+	return metrics, nil
+}
+
+// blockIO holds the bytes read and written, or received and transmitted.
+type blockIO struct {
+	read  uint64
+	write uint64
+}
+
+// readCgroupFile opens path and returns the result of the parse function.
+func readCgroupFile[T any](path string, parse func(io.Reader) (T, error)) (T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+// parseUint parses the content of a single value file like memory.current.
+func parseUint(r io.Reader) (*uint64, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// parseCPUStat parses the content of a cgroups v2 cpu.stat file and
+// returns the CPU usage in nanoseconds.
+func parseCPUStat(r io.Reader) (*uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		kv := strings.Fields(scanner.Text())
+		if len(kv) != 2 || kv[0] != "usage_usec" {
+			continue
+		}
+		v, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing cpu usage: %w", err)
+		}
+		v *= 1000
+		return &v, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no cpu usage found")
+}
+
+// parseIOStat parses the content of a cgroups v2 io.stat file, like:
+//
+//	8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+func parseIOStat(r io.Reader) (*blockIO, error) {
+	stat := &blockIO{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for _, f := range fields[1:] {
+			k, v, ok := strings.Cut(f, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid io stat field %q", f)
+			}
+			var counter *uint64
+			switch k {
+			case "rbytes":
+				counter = &stat.read
+			case "wbytes":
+				counter = &stat.write
+			default:
+				continue
+			}
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("while parsing io stat %s: %w", k, err)
+			}
+			*counter += n
+		}
+	}
+	return stat, scanner.Err()
+}
+
+// parseBlkioServiceBytes parses the content of a cgroups v1
+// blkio.*io_service_bytes* file, like:
+//
+//	8:0 Read 1459200
+//	8:0 Write 314773504
+//	Total 316232704
+func parseBlkioServiceBytes(r io.Reader) (*blockIO, error) {
+	stat := &blockIO{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		var counter *uint64
+		switch fields[1] {
+		case "Read":
+			counter = &stat.read
+		case "Write":
+			counter = &stat.write
+		default:
+			continue
+		}
+		n, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing blkio %s bytes: %w", fields[1], err)
+		}
+		*counter += n
+	}
+	return stat, scanner.Err()
+}
+
+// parseNetDev parses the content of a /proc/<pid>/net/dev file and returns
+// the bytes received and transmitted by all interfaces except loopback.
+func parseNetDev(r io.Reader) (*blockIO, error) {
+	net := &blockIO{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		iface, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			// header lines
+			continue
+		}
+		if strings.TrimSpace(iface) == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("invalid network device line for %s", strings.TrimSpace(iface))
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing received bytes: %w", err)
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing transmitted bytes: %w", err)
+		}
+		net.read += rx
+		net.write += tx
+	}
+	return net, scanner.Err()
+}
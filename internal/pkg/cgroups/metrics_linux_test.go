@@ -0,0 +1,90 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseMetricsFiles(t *testing.T) {
+	cpu, err := readCgroupFile(filepath.Join("testdata", "cpu.stat"), parseCPUStat)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if *cpu != 2500000000 {
+		t.Errorf("got cpu usage %d, want 2500000000", *cpu)
+	}
+
+	mem, err := readCgroupFile(filepath.Join("testdata", "memory.current"), parseUint)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if *mem != 104857600 {
+		t.Errorf("got memory usage %d, want 104857600", *mem)
+	}
+
+	tests := []struct {
+		name  string
+		file  string
+		parse func(io.Reader) (*blockIO, error)
+		want  blockIO
+	}{
+		{
+			name:  "IOStat",
+			file:  "io.stat",
+			parse: parseIOStat,
+			want:  blockIO{read: 1463296, write: 314781696},
+		},
+		{
+			name:  "BlkioServiceBytes",
+			file:  "blkio.throttle.io_service_bytes_recursive",
+			parse: parseBlkioServiceBytes,
+			want:  blockIO{read: 1463296, write: 314781696},
+		},
+		{
+			name:  "NetDev",
+			file:  "net.dev",
+			parse: parseNetDev,
+			want:  blockIO{read: 1050624, write: 525312},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCgroupFile(filepath.Join("testdata", tt.file), tt.parse)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMetricsErrors(t *testing.T) {
+	if _, err := parseCPUStat(strings.NewReader("user_usec 10\n")); err == nil {
+		t.Errorf("unexpected success without cpu usage")
+	}
+	if _, err := parseUint(strings.NewReader("max\n")); err == nil {
+		t.Errorf("unexpected success with invalid value")
+	}
+	if _, err := parseIOStat(strings.NewReader("8:0 rbytes\n")); err == nil {
+		t.Errorf("unexpected success with invalid io stat field")
+	}
+	if _, err := parseBlkioServiceBytes(strings.NewReader("8:0 Read x\n")); err == nil {
+		t.Errorf("unexpected success with invalid blkio counter")
+	}
+	if _, err := parseNetDev(strings.NewReader("eth0: 1 2 3\n")); err == nil {
+		t.Errorf("unexpected success with truncated network device line")
+	}
+}
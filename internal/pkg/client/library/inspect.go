@@ -0,0 +1,69 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/client"
+	"github.com/apptainer/apptainer/pkg/inspect"
+	libClient "github.com/apptainer/container-library-client/client"
+)
+
+// RemoteMetadata returns the metadata of the library image imageRef for
+// arch, read from the library and from the header and descriptors of the
+// SIF image fetched with range requests, without pulling the image.
+func RemoteMetadata(ctx context.Context, imageRef *libClient.Ref, arch string, libraryConfig *libClient.Config) (*inspect.RemoteAttributes, error) {
+	c, err := libClient.NewClient(libraryConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize client library: %v", err)
+	}
+
+	ref := fmt.Sprintf("%s:%s", strings.TrimPrefix(imageRef.Path, "/"), imageRef.Tags[0])
+
+	libraryImage, err := c.GetImage(ctx, arch, ref)
+	if err != nil {
+		if errors.Is(err, libClient.ErrNotFound) {
+			return nil, client.NotFound(fmt.Errorf("image does not exist in the library: %s (%s)", ref, arch))
+		}
+		return nil, err
+	}
+
+	attrs := &inspect.RemoteAttributes{
+		Source: imageRef.String(),
+		Digest: libraryImage.Hash,
+		Size:   libraryImage.Size,
+		Layers: []inspect.RemoteLayer{{Digest: libraryImage.Hash, Size: libraryImage.Size}},
+	}
+
+	u := c.BaseURL.ResolveReference(&url.URL{
+		Path:     "v1/imagefile/" + ref,
+		RawQuery: url.Values{"arch": []string{arch}}.Encode(),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	if err := client.ReadRemoteSIF(client.NewHTTPReaderAt(c.HTTPClient, req), attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
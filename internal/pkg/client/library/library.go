@@ -11,11 +11,13 @@ package library
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
@@ -147,51 +149,184 @@ func DownloadImageNoProgress(ctx context.Context, c *libClient.Client, imagePath
 	return DownloadImage(ctx, c, imagePath, arch, libraryRef, nil)
 }
 
-// SearchLibrary searches the library and outputs results to stdout
-func SearchLibrary(ctx context.Context, c *libClient.Client, value, arch string, signed bool) error {
+// SearchOptions holds the filters and the pagination of a library search.
+type SearchOptions struct {
+	Arch   string // comma-separated list of architectures
+	Signed bool   // only signed images
+	Owner  string // entity owning the images
+	Limit  int    // number of images per page, all images if 0
+	Page   int    // page of the images, starting at 1
+}
+
+// SearchImage is an image found by a library search.
+type SearchImage struct {
+	Path         string    `json:"path"`
+	Tags         []string  `json:"tags"`
+	Hash         string    `json:"hash"`
+	Arch         string    `json:"arch,omitempty"`
+	Size         int64     `json:"size"`
+	BuildDate    time.Time `json:"buildDate"`
+	Description  string    `json:"description,omitempty"`
+	Signed       bool      `json:"signed"`
+	Fingerprints []string  `json:"fingerprints,omitempty"`
+}
+
+// matchImage returns if the image img matches the filters of opts, which
+// an older library server may have ignored.
+func (opts SearchOptions) matchImage(img libClient.Image) bool {
+	if opts.Arch != "" && img.Architecture != nil {
+		found := false
+		for _, arch := range strings.Split(opts.Arch, ",") {
+			found = found || arch == *img.Architecture
+		}
+		if !found {
+			return false
+		}
+	}
+	if opts.Signed && !imageSigned(img) {
+		return false
+	}
+	if opts.Owner != "" && !strings.EqualFold(opts.Owner, img.EntityName) {
+		return false
+	}
+	return true
+}
+
+// imageSigned returns if the image img is signed.
+func imageSigned(img libClient.Image) bool {
+	if img.Signed != nil {
+		return *img.Signed
+	}
+	return len(img.Fingerprints) > 0
+}
+
+// SearchImages searches the library for the images matching value and the
+// filters of opts, and returns them sorted by path. The filters and the
+// pagination are passed to the library, and applied to the results of a
+// library ignoring them.
+func SearchImages(ctx context.Context, c *libClient.Client, value string, opts SearchOptions) ([]SearchImage, error) {
 	if len(value) < 3 {
-		return fmt.Errorf("bad query '%s'. You must search for at least 3 characters", value)
+		return nil, fmt.Errorf("bad query '%s'. You must search for at least 3 characters", value)
+	}
+	if opts.Limit < 0 || opts.Page < 0 {
+		return nil, fmt.Errorf("invalid pagination: limit and page must be positive")
+	}
+	if opts.Page == 0 {
+		opts.Page = 1
 	}
 
 	searchSpec := map[string]string{
 		"value": value,
-		"arch":  arch,
 	}
-
-	if signed {
+	if opts.Arch != "" {
+		searchSpec["arch"] = opts.Arch
+	}
+	if opts.Signed {
 		searchSpec["signed"] = "true"
 	}
+	if opts.Owner != "" {
+		searchSpec["owner"] = opts.Owner
+	}
+	if opts.Limit > 0 {
+		searchSpec["limit"] = strconv.Itoa(opts.Limit)
+		searchSpec["page"] = strconv.Itoa(opts.Page)
+	}
 
 	results, err := c.Search(ctx, searchSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]SearchImage, 0, len(results.Images))
+	for _, img := range results.Images {
+		if !opts.matchImage(img) {
+			continue
+		}
+		si := SearchImage{
+			Path:         fmt.Sprintf("library://%s/%s/%s", img.EntityName, img.CollectionName, img.ContainerName),
+			Tags:         img.Tags,
+			Hash:         img.Hash,
+			Size:         img.Size,
+			BuildDate:    img.CreatedAt,
+			Signed:       imageSigned(img),
+			Fingerprints: img.Fingerprints,
+		}
+		if img.Architecture != nil {
+			si.Arch = *img.Architecture
+		}
+		if img.Description != "" && strings.ToLower(img.Description) != noDescription {
+			si.Description = img.Description
+		}
+		images = append(images, si)
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].Path < images[j].Path
+	})
+
+	// a library supporting the pagination returns at most a page
+	if opts.Limit > 0 && len(results.Images) > opts.Limit {
+		start := (opts.Page - 1) * opts.Limit
+		if start > len(images) {
+			start = len(images)
+		}
+		end := start + opts.Limit
+		if end > len(images) {
+			end = len(images)
+		}
+		images = images[start:end]
+	}
+	return images, nil
+}
+
+// SearchLibrary searches the library and outputs results to stdout, as JSON
+// if jsonOutput is true.
+func SearchLibrary(ctx context.Context, c *libClient.Client, value string, opts SearchOptions, jsonOutput bool) error {
+	if opts.Page == 0 {
+		opts.Page = 1
+	}
+	images, err := SearchImages(ctx, c, value, opts)
 	if err != nil {
 		return err
 	}
 
-	numImages := len(results.Images)
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(images)
+	}
 
-	if numImages > 0 {
-		imageList := []string{}
-		for _, img := range results.Images {
-			tagSpec := img.Hash
-			if len(img.Tags) > 0 {
-				tagSpec = strings.Join(img.Tags, ",")
-			}
-			imageItem := fmt.Sprintf("\tlibrary://%s/%s/%s:%s", img.EntityName, img.CollectionName, img.ContainerName, tagSpec)
-			if img.Description != "" && strings.ToLower(img.Description) != noDescription {
-				imageItem = imageItem + fmt.Sprintf("\n\t\t%s", img.Description)
-			}
-			if len(img.Fingerprints) > 0 {
-				imageItem = imageItem + fmt.Sprintf("\n\t\tSigned by: %s", strings.Join(img.Fingerprints, ","))
-			}
-			imageList = append(imageList, imageItem)
+	arch := opts.Arch
+	if arch == "" {
+		arch = "all architectures"
+	}
+	if len(images) == 0 {
+		fmt.Printf("No container images found for %s matching %q.\n\n", arch, value)
+		return nil
+	}
+
+	imageList := make([]string, 0, len(images))
+	for _, img := range images {
+		tagSpec := img.Hash
+		if len(img.Tags) > 0 {
+			tagSpec = strings.Join(img.Tags, ",")
+		}
+		imageItem := fmt.Sprintf("\t%s:%s", img.Path, tagSpec)
+		if img.Description != "" {
+			imageItem = imageItem + fmt.Sprintf("\n\t\t%s", img.Description)
+		}
+		if len(img.Fingerprints) > 0 {
+			imageItem = imageItem + fmt.Sprintf("\n\t\tSigned by: %s", strings.Join(img.Fingerprints, ","))
 		}
-		sort.Strings(imageList)
-		fmt.Printf("Found %d container images for %s matching %q:\n\n", numImages, arch, value)
-		fmt.Println(strings.Join(imageList, "\n\n"))
-		fmt.Printf("\n")
+		imageList = append(imageList, imageItem)
+	}
+	sort.Strings(imageList)
+	if opts.Limit > 0 {
+		fmt.Printf("Page %d of container images for %s matching %q:\n\n", opts.Page, arch, value)
 	} else {
-		fmt.Printf("No container images found for %s matching %q.\n\n", arch, value)
+		fmt.Printf("Found %d container images for %s matching %q:\n\n", len(images), arch, value)
 	}
+	fmt.Println(strings.Join(imageList, "\n\n"))
+	fmt.Printf("\n")
 
 	return nil
 }
@@ -10,8 +10,17 @@
 package library
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strconv"
 	"testing"
+
+	libClient "github.com/apptainer/container-library-client/client"
 )
 
 func TestNormalizeLibraryRef(t *testing.T) {
@@ -54,3 +63,106 @@ func TestNormalizeLibraryRef(t *testing.T) {
 		})
 	}
 }
+
+// newSearchServer starts a library server searching the images, paginated
+// if paginate is true, and records the query of the last search.
+func newSearchServer(t *testing.T, images []libClient.Image, paginate bool, query *url.Values) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/search" {
+			http.NotFound(w, r)
+			return
+		}
+		*query = r.URL.Query()
+
+		results := images
+		if paginate {
+			limit, _ := strconv.Atoi(query.Get("limit"))
+			page, _ := strconv.Atoi(query.Get("page"))
+			start := (page - 1) * limit
+			if start > len(results) {
+				start = len(results)
+			}
+			end := start + limit
+			if end > len(results) {
+				end = len(results)
+			}
+			results = results[start:end]
+		}
+		json.NewEncoder(w).Encode(libClient.SearchResponse{Data: libClient.SearchResults{Images: results}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSearchImages(t *testing.T) {
+	amd64 := "amd64"
+	arm64 := "arm64"
+	signed := true
+	var images []libClient.Image
+	for i := 0; i < 5; i++ {
+		images = append(images, libClient.Image{
+			EntityName:     "alice",
+			CollectionName: "default",
+			ContainerName:  fmt.Sprintf("alpine%d", i),
+			Tags:           []string{"latest"},
+			Architecture:   &amd64,
+		})
+	}
+	images[1].Signed = &signed
+	images[1].Fingerprints = []string{"ABCD"}
+	images[4].EntityName = "zoe"
+	images[3].Architecture = &arm64
+
+	for _, paginate := range []bool{true, false} {
+		var query url.Values
+		srv := newSearchServer(t, images, paginate, &query)
+		c, err := libClient.NewClient(&libClient.Config{BaseURL: srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the pages of a library ignoring the pagination are computed
+		var paths []string
+		for page := 1; page <= 3; page++ {
+			res, err := SearchImages(context.Background(), c, "alpine", SearchOptions{Limit: 2, Page: page})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(res) > 2 {
+				t.Errorf("page %d with %d images", page, len(res))
+			}
+			for _, img := range res {
+				paths = append(paths, img.Path)
+			}
+		}
+		if query.Get("limit") != "2" || query.Get("page") != "3" {
+			t.Errorf("pagination not passed to the library: %v", query)
+		}
+		if len(paths) != len(images) {
+			t.Errorf("unexpected images with paginate=%v: %v", paginate, paths)
+		}
+		for i, p := range paths {
+			if expected := fmt.Sprintf("library://%s/default/alpine%d", images[i].EntityName, i); p != expected {
+				t.Errorf("unexpected image %s, expected %s", p, expected)
+			}
+		}
+	}
+
+	// the filters ignored by a library are applied
+	var query url.Values
+	srv := newSearchServer(t, images, false, &query)
+	c, err := libClient.NewClient(&libClient.Config{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := SearchImages(context.Background(), c, "alpine", SearchOptions{Arch: "amd64", Owner: "alice", Signed: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res) != 1 || res[0].Path != "library://alice/default/alpine1" || !res[0].Signed || res[0].Arch != "amd64" {
+		t.Errorf("unexpected images: %+v", res)
+	}
+	if query.Get("owner") != "alice" || query.Get("arch") != "amd64" || query.Get("signed") != "true" {
+		t.Errorf("filters not passed to the library: %v", query)
+	}
+}
@@ -32,6 +32,20 @@ var ErrLibraryPullUnsigned = errors.New("failed to verify container")
 
 // pull will pull a library image into the cache if directTo="", or a specific file if directTo is set.
 func pull(ctx context.Context, imgCache *cache.Handle, directTo string, imageRef *libClient.Ref, arch string, libraryConfig *libClient.Config) (string, error) {
+	// without network access the image can only be taken from the cache
+	if imgCache.IsOffline() {
+		return imgCache.OfflineEntry(cache.LibraryCacheType, imageRef.String())
+	}
+
+	// wait for the concurrent pulls of the same image and use their entry
+	if directTo == "" {
+		unlock, err := imgCache.LockPull(cache.LibraryCacheType, imageRef.String()+" "+arch)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+	}
+
 	c, err := libClient.NewClient(libraryConfig)
 	if err != nil {
 		return "", fmt.Errorf("unable to initialize client library: %v", err)
@@ -42,7 +56,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo string, imageRef
 	libraryImage, err := c.GetImage(ctx, arch, ref)
 	if err != nil {
 		if errors.Is(err, libClient.ErrNotFound) {
-			return "", fmt.Errorf("image does not exist in the library: %s (%s)", ref, arch)
+			return "", client.NotFound(fmt.Errorf("image does not exist in the library: %s (%s)", ref, arch))
 		}
 		return "", err
 	}
@@ -55,7 +69,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo string, imageRef
 	if directTo != "" {
 		// Download direct to file
 		if err := downloadWrapper(ctx, c, directTo, arch, imageRef, progressBar); err != nil {
-			return "", fmt.Errorf("unable to download image: %v", err)
+			return "", fmt.Errorf("unable to download image: %w", err)
 		}
 		return directTo, nil
 	}
@@ -68,7 +82,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo string, imageRef
 
 	if !cacheEntry.Exists {
 		if err := downloadWrapper(ctx, c, cacheEntry.TmpPath, arch, imageRef, progressBar); err != nil {
-			return "", fmt.Errorf("unable to download image: %v", err)
+			return "", fmt.Errorf("unable to download image: %w", err)
 		}
 
 		if cacheFileHash, err := libClient.ImageHash(cacheEntry.TmpPath); err != nil {
@@ -77,6 +91,8 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo string, imageRef
 			return "", fmt.Errorf("cached file hash(%s) and expected hash(%s) does not match", cacheFileHash, libraryImage.Hash)
 		}
 
+		cacheEntry.Source = imageRef.String()
+		cacheEntry.Digest = libraryImage.Hash
 		if err := cacheEntry.Finalize(); err != nil {
 			return "", err
 		}
@@ -132,7 +148,7 @@ func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo string, pull
 
 	src, err := pull(ctx, imgCache, directTo, pullFrom, arch, libraryConfig)
 	if err != nil {
-		return "", fmt.Errorf("error fetching image: %v", err)
+		return "", fmt.Errorf("error fetching image: %w", err)
 	}
 
 	if directTo == "" {
@@ -14,6 +14,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"time"
 
@@ -24,9 +26,19 @@ import (
 	"golang.org/x/term"
 )
 
+// PushOptions holds the options of a push to the library.
+type PushOptions struct {
+	// ChunkSize is the size of the parts of a multipart upload, chosen by
+	// the library if 0.
+	ChunkSize int64
+}
+
 // Push will upload an image file to the library.
 // Returns the upload completion response on success, containing container path and quota usage.
-func Push(ctx context.Context, sourceFile string, destRef *scslibrary.Ref, desc string, libraryConfig *scslibrary.Config) (uploadResponse *scslibrary.UploadImageComplete, err error) {
+// The size of the image is checked against the quota of the library entity
+// before uploading it. The failed parts of the upload are retried, and an
+// interrupted multipart upload is resumed by pushing the same image again.
+func Push(ctx context.Context, sourceFile string, destRef *scslibrary.Ref, desc string, libraryConfig *scslibrary.Config, opts PushOptions) (uploadResponse *scslibrary.UploadImageComplete, err error) {
 	fi, err := os.Stat(sourceFile)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -34,41 +46,96 @@ func Push(ctx context.Context, sourceFile string, destRef *scslibrary.Ref, desc
 		}
 		return nil, err
 	}
+	if err := checkChunkSize(opts.ChunkSize, fi.Size()); err != nil {
+		return nil, err
+	}
 
 	arch, err := sifArch(sourceFile)
 	if err != nil {
 		return nil, err
 	}
 
-	libraryClient, err := scslibrary.NewClient(libraryConfig)
+	// open image for uploading
+	f, err := os.Open(sourceFile)
+	if err != nil {
+		return nil, fmt.Errorf("error opening image %s for reading: %v", sourceFile, err)
+	}
+	defer f.Close()
+
+	// the library client uploads the image through the upload transport
+	httpClient := http.DefaultClient
+	if libraryConfig.HTTPClient != nil {
+		httpClient = libraryConfig.HTTPClient
+	}
+	ut := &uploadTransport{
+		base:      httpClient.Transport,
+		file:      f,
+		chunkSize: opts.ChunkSize,
+		stateDir:  uploadStateDir(),
+		parts:     make(map[string]int),
+	}
+	if ut.base == nil {
+		ut.base = http.DefaultTransport
+	}
+	hc := *httpClient
+	hc.Transport = ut
+	config := *libraryConfig
+	config.HTTPClient = &hc
+
+	libraryClient, err := scslibrary.NewClient(&config)
 	if err != nil {
 		return nil, fmt.Errorf("error initializing library client: %v", err)
 	}
+	ut.baseURL = libraryClient.BaseURL
 
 	if destRef.Host != "" && destRef.Host != libraryClient.BaseURL.Host {
 		return nil, errors.New("push to location other than current remote is not supported")
 	}
 
-	// open image for uploading
-	f, err := os.Open(sourceFile)
-	if err != nil {
-		return nil, fmt.Errorf("error opening image %s for reading: %v", sourceFile, err)
+	entity, _, _, _ := scslibrary.ParseLibraryPath(destRef.Path)
+	imageExists := func() bool {
+		hash, err := scslibrary.ImageHash(sourceFile)
+		if err != nil {
+			return false
+		}
+		img, err := libraryClient.GetImage(ctx, arch, destRef.Path+":"+hash)
+		return err == nil && img.Uploaded
 	}
-	defer f.Close()
-
-	var progressBar scslibrary.UploadCallback
-	if term.IsTerminal(2) {
-		progressBar = &client.UploadProgressBar{}
+	if err := checkQuota(ctx, libraryClient, entity, fi.Size(), imageExists); err != nil {
+		return nil, err
 	}
 
-	resp, err := libraryClient.UploadImage(ctx, f, destRef.Path, arch, destRef.Tags, desc, progressBar)
 	defer func(t time.Time) {
-		if err == nil && resp != nil && progressBar == nil {
+		if err == nil && uploadResponse != nil && !term.IsTerminal(2) {
 			sylog.Infof("Uploaded %d bytes in %v\n", fi.Size(), time.Since(t))
 		}
 	}(time.Now())
 
-	return resp, err
+	for {
+		var progressBar scslibrary.UploadCallback
+		if term.IsTerminal(2) {
+			progressBar = &client.UploadProgressBar{}
+		}
+		uploadResponse, err = libraryClient.UploadImage(ctx, f, destRef.Path, arch, destRef.Tags, desc, progressBar)
+		if err == nil || !ut.expired {
+			break
+		}
+		// the next attempt starts a new upload
+		sylog.Warningf("%v, restarting it", errUploadExpired)
+		ut.expired, ut.resumed = false, false
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		if ut.quotaErr != nil {
+			return nil, ut.quotaErr
+		}
+		if ut.resumable() {
+			sylog.Infof("Run the same push command again to resume the upload")
+		}
+	}
+	return uploadResponse, err
 }
 
 func sifArch(filename string) (string, error) {
@@ -0,0 +1,281 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	libClient "github.com/apptainer/container-library-client/client"
+	"github.com/apptainer/sif/v2/pkg/sif"
+	jsonresp "github.com/sylabs/json-resp"
+)
+
+// testChunkSize splits the test image in 5 parts.
+const testChunkSize = 16 << 20
+
+// libraryServer is a library serving the multipart upload API, with an
+// object store failing the uploads of the parts for which fail returns
+// true.
+type libraryServer struct {
+	*httptest.Server
+	quota int64
+	fail  func(part, attempt int) bool
+
+	mu       sync.Mutex
+	uploads  int
+	uploadID string
+	attempts map[int]int
+	parts    map[int][]byte
+	image    []byte
+}
+
+func newLibraryServer(t *testing.T, quota int64) *libraryServer {
+	s := &libraryServer{
+		quota:    quota,
+		attempts: make(map[int]int),
+		parts:    make(map[int][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *libraryServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch p := r.URL.Path; {
+	case p == "/version":
+		jsonresp.WriteResponse(w, libClient.VersionInfo{APIVersion: "2.0.0"}, http.StatusOK)
+	case p == "/v1/entities/entity":
+		jsonresp.WriteResponse(w, libClient.Entity{ID: "entity-id", Size: 1 << 20, Quota: s.quota}, http.StatusOK)
+	case p == "/v1/collections/entity/collection":
+		jsonresp.WriteResponse(w, libClient.Collection{ID: "collection-id"}, http.StatusOK)
+	case p == "/v1/containers/entity/collection/container":
+		jsonresp.WriteResponse(w, libClient.Container{ID: "container-id"}, http.StatusOK)
+	case p == "/v1/images" && r.Method == http.MethodPost:
+		jsonresp.WriteResponse(w, libClient.Image{ID: "image-id"}, http.StatusOK)
+	case p == "/v2/tags/container-id":
+		if r.Method == http.MethodGet {
+			jsonresp.WriteResponse(w, libClient.ArchTagMap{}, http.StatusOK)
+		}
+	case p == "/v2/imagefile/image-id/_multipart" && r.Method == http.MethodPost:
+		if s.quota > 0 && s.quota < 1<<30 {
+			jsonresp.WriteError(w, "storage quota exceeded", http.StatusRequestEntityTooLarge)
+			return
+		}
+		s.uploads++
+		s.uploadID = fmt.Sprintf("upload-%d", s.uploads)
+		s.parts = make(map[int][]byte)
+		jsonresp.WriteResponse(w, libClient.MultipartUpload{UploadID: s.uploadID, TotalParts: 2, PartSize: 64 << 20}, http.StatusOK)
+	case p == "/v2/imagefile/image-id/_multipart" && r.Method == http.MethodPut:
+		var req libClient.UploadImagePartRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.UploadID != s.uploadID {
+			jsonresp.WriteError(w, "no such upload", http.StatusNotFound)
+			return
+		}
+		jsonresp.WriteResponse(w, libClient.UploadImagePart{
+			PresignedURL: fmt.Sprintf("%s/store/%s/%d", s.URL, req.UploadID, req.PartNumber),
+		}, http.StatusOK)
+	case strings.HasPrefix(p, "/store/"):
+		var id string
+		var part int
+		fmt.Sscanf(strings.ReplaceAll(p, "/", " "), " store %s %d", &id, &part)
+		s.attempts[part]++
+		if s.fail != nil && s.fail(part, s.attempts[part]) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(b)) != r.ContentLength {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.parts[part] = b
+		w.Header().Set("ETag", fmt.Sprintf("etag-%d", part))
+	case p == "/v2/imagefile/image-id/_multipart_complete":
+		var req libClient.CompleteMultipartUploadRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.UploadID != s.uploadID {
+			jsonresp.WriteError(w, "no such upload", http.StatusNotFound)
+			return
+		}
+		s.image = nil
+		for _, cp := range req.CompletedParts {
+			if cp.Token != fmt.Sprintf("etag-%d", cp.PartNumber) {
+				jsonresp.WriteError(w, "invalid part token", http.StatusBadRequest)
+				return
+			}
+			s.image = append(s.image, s.parts[cp.PartNumber]...)
+		}
+		jsonresp.WriteResponse(w, libClient.UploadImageComplete{ContainerURL: "/entity/collection/container"}, http.StatusOK)
+	case p == "/v2/imagefile/image-id/_multipart_abort":
+		s.uploadID = ""
+		jsonresp.WriteResponse(w, struct{}{}, http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// createPushSIF creates a SIF image large enough for a multipart upload.
+func createPushSIF(t *testing.T) (string, []byte) {
+	t.Helper()
+	data := make([]byte, 70<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	path := filepath.Join(t.TempDir(), "image.sif")
+	di, err := sif.NewDescriptorInput(sif.DataPartition, bytes.NewReader(data),
+		sif.OptPartitionMetadata(sif.FsSquash, sif.PartPrimSys, "amd64"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := sif.CreateContainerAtPath(path, sif.OptCreateWithDescriptors(di))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, b
+}
+
+func push(s *libraryServer, path string) error {
+	ref := &libClient.Ref{Path: "entity/collection/container", Tags: []string{"latest"}}
+	config := &libClient.Config{BaseURL: s.URL, AuthToken: "token"}
+	_, err := Push(context.Background(), path, ref, "", config, PushOptions{ChunkSize: testChunkSize})
+	return err
+}
+
+func setupPush(t *testing.T) {
+	dir := t.TempDir()
+	uploadStateDir = func() string { return dir }
+	retryDelay = 0
+}
+
+func TestPushRetryPart(t *testing.T) {
+	setupPush(t)
+	path, image := createPushSIF(t)
+	s := newLibraryServer(t, 0)
+	// the first attempt of the second part fails
+	s.fail = func(part, attempt int) bool { return part == 2 && attempt == 1 }
+
+	if err := push(s, path); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	if !bytes.Equal(s.image, image) {
+		t.Errorf("uploaded image differs")
+	}
+	if s.attempts[2] != 2 {
+		t.Errorf("%d attempts for part 2, want 2", s.attempts[2])
+	}
+	if s.uploads != 1 {
+		t.Errorf("%d uploads started, want 1", s.uploads)
+	}
+}
+
+func TestPushResume(t *testing.T) {
+	tests := []struct {
+		name        string
+		expire      bool
+		wantUploads int
+		wantRetried int
+	}{
+		{name: "resume", wantUploads: 1, wantRetried: 1},
+		{name: "expired", expire: true, wantUploads: 2, wantRetried: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupPush(t)
+			path, image := createPushSIF(t)
+			s := newLibraryServer(t, 0)
+			// the third part fails until the push is run again
+			s.fail = func(part, attempt int) bool { return part == 3 }
+
+			if err := push(s, path); err == nil {
+				t.Fatalf("unexpected success of the interrupted push")
+			}
+			if s.attempts[3] != uploadAttempts {
+				t.Errorf("%d attempts for part 3, want %d", s.attempts[3], uploadAttempts)
+			}
+			if s.uploadID == "" {
+				t.Fatalf("interrupted upload aborted")
+			}
+			if tt.expire {
+				s.uploadID = ""
+			}
+
+			s.fail = nil
+			if err := push(s, path); err != nil {
+				t.Fatalf("resumed push failed: %v", err)
+			}
+			if !bytes.Equal(s.image, image) {
+				t.Errorf("uploaded image differs")
+			}
+			if s.uploads != tt.wantUploads {
+				t.Errorf("%d uploads started, want %d", s.uploads, tt.wantUploads)
+			}
+			// the parts uploaded before the interruption are only sent
+			// again when the upload expired
+			if s.attempts[1] != tt.wantRetried {
+				t.Errorf("%d attempts for part 1, want %d", s.attempts[1], tt.wantRetried)
+			}
+			if files, _ := os.ReadDir(uploadStateDir()); len(files) != 0 {
+				t.Errorf("upload state left after the push")
+			}
+		})
+	}
+}
+
+func TestPushQuota(t *testing.T) {
+	tests := []struct {
+		name  string
+		quota int64
+		want  error
+	}{
+		{name: "preflight", quota: 32 << 20, want: &QuotaError{}},
+		{name: "library", quota: 512 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupPush(t)
+			path, _ := createPushSIF(t)
+			s := newLibraryServer(t, tt.quota)
+
+			err := push(s, path)
+			if !errors.Is(err, ErrQuotaExceeded) {
+				t.Fatalf("push error = %v, want %v", err, ErrQuotaExceeded)
+			}
+			var qerr *QuotaError
+			if errors.As(err, &qerr) != (tt.want != nil) {
+				t.Errorf("push error = %v, preflight check expected %v", err, tt.want != nil)
+			}
+			if len(s.attempts) != 0 {
+				t.Errorf("image data sent despite the quota")
+			}
+		})
+	}
+}
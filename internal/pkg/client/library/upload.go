@@ -0,0 +1,645 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/syfs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	scslibrary "github.com/apptainer/container-library-client/client"
+	jsonresp "github.com/sylabs/json-resp"
+)
+
+// uploadAttempts is the number of attempts to upload a part of an image, or
+// the whole image with the single part uploader.
+const uploadAttempts = 3
+
+// retryDelay is the delay before an upload is retried, multiplied by the
+// number of the attempt.
+var retryDelay = time.Second
+
+// uploadStateDir returns the directory holding the state of the
+// interrupted uploads.
+var uploadStateDir = syfs.UploadState
+
+// The limits of the multipart uploads of the object stores backing the
+// library.
+const (
+	minChunkSize = 5 << 20
+	maxParts     = 10000
+)
+
+// ErrQuotaExceeded is returned when an image doesn't fit in the storage
+// quota of the library.
+var ErrQuotaExceeded = errors.New("library storage quota exceeded")
+
+// QuotaError is returned when the preflight check finds that an image
+// doesn't fit in the storage quota of the library entity.
+type QuotaError struct {
+	Size  int64
+	Usage int64
+	Quota int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%v: image of %s doesn't fit, using %s out of %s",
+		ErrQuotaExceeded, fs.FindSize(e.Size), fs.FindSize(e.Usage), fs.FindSize(e.Quota))
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// errUploadExpired is returned when the library no longer knows a resumed
+// upload, which is then restarted.
+var errUploadExpired = errors.New("the interrupted upload has expired on the library")
+
+// checkChunkSize checks the part size set with --chunk-size for an image
+// of size bytes.
+func checkChunkSize(chunkSize, size int64) error {
+	if chunkSize == 0 {
+		return nil
+	}
+	if chunkSize < minChunkSize {
+		return fmt.Errorf("chunk size %s is below the minimum of %s", fs.FindSize(chunkSize), fs.FindSize(minChunkSize))
+	}
+	if (size+chunkSize-1)/chunkSize > maxParts {
+		return fmt.Errorf("chunk size %s splits the image in more than %d parts", fs.FindSize(chunkSize), maxParts)
+	}
+	return nil
+}
+
+// checkQuota checks that an image of size bytes fits in the storage quota
+// of the entity, before any data is uploaded. The check is skipped when
+// the library doesn't report the quota, and when the image is already in
+// the library, as it isn't uploaded again.
+func checkQuota(ctx context.Context, c *scslibrary.Client, entity string, size int64, imageExists func() bool) error {
+	if entity == "" {
+		return nil
+	}
+	u := c.BaseURL.ResolveReference(&url.URL{Path: "v1/entities/" + entity})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		// a new entity is created by the push
+		sylog.Debugf("Skipping quota check, entity %s: %s", entity, res.Status)
+		return nil
+	}
+
+	var er scslibrary.EntityResponse
+	if err := json.NewDecoder(res.Body).Decode(&er); err != nil {
+		return fmt.Errorf("error decoding entity: %v", err)
+	}
+	e := er.Data
+	if e.Quota <= 0 || e.Size+size <= e.Quota {
+		return nil
+	}
+	if imageExists() {
+		return nil
+	}
+	return &QuotaError{Size: size, Usage: e.Size, Quota: e.Quota}
+}
+
+// uploadState is the state of a multipart upload, saved to resume it when
+// the push is interrupted.
+type uploadState struct {
+	ImageID    string            `json:"imageID"`
+	UploadID   string            `json:"uploadID"`
+	Size       int64             `json:"size"`
+	ModTime    time.Time         `json:"modTime"`
+	PartSize   int64             `json:"partSize"`
+	TotalParts int               `json:"totalParts"`
+	Options    map[string]string `json:"options,omitempty"`
+	// Parts holds the ETags of the uploaded parts, by part number.
+	Parts map[int]string `json:"parts"`
+}
+
+// uploadTransport wraps the transport of the library client during a push.
+// It retries the failed parts of the upload, keeps the state of a multipart
+// upload to resume it when the push is run again, and records the quota
+// errors of the library. The library keeps an interrupted multipart upload
+// for a time of its choosing; when it no longer knows it, the upload is
+// restarted.
+type uploadTransport struct {
+	base      http.RoundTripper
+	baseURL   *url.URL
+	file      *os.File
+	chunkSize int64
+	stateDir  string
+
+	mu      sync.Mutex
+	state   *uploadState
+	resumed bool
+	// parts maps the presigned URLs of the parts to their number, single
+	// is the presigned URL of the single part upload.
+	parts  map[string]int
+	single string
+	// quotaErr is the quota error returned by the library, expired is set
+	// when the library no longer knows a resumed upload.
+	quotaErr error
+	expired  bool
+}
+
+func (t *uploadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	n, isPart := t.parts[req.URL.String()]
+	isSingle := t.single != "" && req.URL.String() == t.single
+	t.mu.Unlock()
+	switch {
+	case isPart:
+		return t.uploadPart(req, n)
+	case isSingle:
+		return t.upload(req, 0, req.ContentLength, true)
+	}
+
+	if req.URL.Host != t.baseURL.Host || !strings.HasPrefix(req.URL.Path, t.baseURL.Path) {
+		return t.base.RoundTrip(req)
+	}
+	// v2/imagefile/<id>[/<operation>]
+	p := strings.Split(strings.TrimPrefix(req.URL.Path, t.baseURL.Path), "/")
+	if len(p) < 3 || p[0] != "v2" || p[1] != "imagefile" {
+		return t.forward(req)
+	}
+	op := ""
+	if len(p) > 3 {
+		op = p[3]
+	}
+
+	switch {
+	case op == "" && req.Method == http.MethodPost:
+		return t.startSingle(req)
+	case op == "_multipart" && req.Method == http.MethodPost:
+		return t.startMultipart(req, p[2])
+	case op == "_multipart" && req.Method == http.MethodPut:
+		return t.presignPart(req)
+	case op == "_multipart_complete":
+		res, err := t.forward(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode/100 == 2 {
+			t.removeState()
+		} else if err := t.checkExpired(res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	case op == "_multipart_abort":
+		t.mu.Lock()
+		keep := t.state != nil && !t.expired
+		t.mu.Unlock()
+		if keep {
+			// the upload is kept for the next push to resume it
+			return jsonResponse(req, http.StatusOK, struct{}{})
+		}
+	}
+	return t.forward(req)
+}
+
+// forward sends a request to the library, recording the quota errors.
+func (t *uploadTransport) forward(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusInsufficientStorage:
+	default:
+		return res, nil
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, 1<<16))
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(b))
+
+	if res.StatusCode == http.StatusForbidden && !strings.Contains(strings.ToLower(string(b)), "quota") {
+		return res, nil
+	}
+	msg := res.Status
+	if err := jsonresp.ReadError(bytes.NewReader(b)); err != nil {
+		msg = err.Error()
+	}
+	t.mu.Lock()
+	t.quotaErr = fmt.Errorf("%w: %s", ErrQuotaExceeded, msg)
+	t.mu.Unlock()
+	return res, nil
+}
+
+// checkExpired returns errUploadExpired when the library rejected a resumed
+// upload, whose state is then removed.
+func (t *uploadTransport) checkExpired(res *http.Response) error {
+	t.mu.Lock()
+	resumed := t.resumed
+	t.mu.Unlock()
+	if !resumed || (res.StatusCode != http.StatusNotFound && res.StatusCode != http.StatusBadRequest) {
+		return nil
+	}
+	res.Body.Close()
+	t.removeState()
+	t.mu.Lock()
+	t.expired = true
+	t.mu.Unlock()
+	return errUploadExpired
+}
+
+// startSingle starts a single part upload, recording its presigned URL.
+func (t *uploadTransport) startSingle(req *http.Request) (*http.Response, error) {
+	res, err := t.forward(req)
+	if err != nil || res.StatusCode/100 != 2 {
+		return res, err
+	}
+	var r scslibrary.UploadImageResponse
+	if err := decodeBody(res, &r); err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.single = r.Data.UploadURL
+	t.mu.Unlock()
+	return jsonResponse(req, res.StatusCode, r)
+}
+
+// startMultipart starts a multipart upload, or resumes the interrupted
+// upload of the same image. The part size is set to the chunk size, if set.
+func (t *uploadTransport) startMultipart(req *http.Request, imageID string) (*http.Response, error) {
+	var body scslibrary.MultipartUploadStartRequest
+	if err := readBody(req, &body); err != nil {
+		return nil, err
+	}
+	fi, err := t.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if st := t.loadState(imageID); st != nil && st.Size == body.Size && st.ModTime.Equal(fi.ModTime()) {
+		sylog.Infof("Resuming interrupted upload, %d of %d parts already uploaded", len(st.Parts), st.TotalParts)
+		t.mu.Lock()
+		t.state, t.resumed = st, true
+		t.mu.Unlock()
+		return jsonResponse(req, http.StatusOK, scslibrary.MultipartUploadStartResponse{
+			Data: scslibrary.MultipartUpload{
+				UploadID:   st.UploadID,
+				TotalParts: st.TotalParts,
+				PartSize:   st.PartSize,
+				Options:    st.Options,
+			},
+		})
+	}
+
+	res, err := t.forward(req)
+	if err != nil || res.StatusCode/100 != 2 {
+		return res, err
+	}
+	var r scslibrary.MultipartUploadStartResponse
+	if err := decodeBody(res, &r); err != nil {
+		return nil, err
+	}
+	if t.chunkSize > 0 {
+		r.Data.PartSize = t.chunkSize
+		r.Data.TotalParts = int((body.Size + t.chunkSize - 1) / t.chunkSize)
+	}
+
+	st := &uploadState{
+		ImageID:    imageID,
+		UploadID:   r.Data.UploadID,
+		Size:       body.Size,
+		ModTime:    fi.ModTime(),
+		PartSize:   r.Data.PartSize,
+		TotalParts: r.Data.TotalParts,
+		Options:    r.Data.Options,
+		Parts:      make(map[int]string),
+	}
+	t.mu.Lock()
+	t.state = st
+	t.mu.Unlock()
+	t.saveState()
+	return jsonResponse(req, res.StatusCode, r)
+}
+
+// presignPart requests the presigned URL of a part, which isn't requested
+// for the parts already uploaded before an interruption.
+func (t *uploadTransport) presignPart(req *http.Request) (*http.Response, error) {
+	var body scslibrary.UploadImagePartRequest
+	if err := readBody(req, &body); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	done := false
+	if t.state != nil {
+		_, done = t.state.Parts[body.PartNumber]
+	}
+	u := fmt.Sprintf("uploaded-part:%d", body.PartNumber)
+	if done {
+		t.parts[u] = body.PartNumber
+	}
+	t.mu.Unlock()
+	if done {
+		return jsonResponse(req, http.StatusOK, scslibrary.UploadImagePartResponse{
+			Data: scslibrary.UploadImagePart{PresignedURL: u},
+		})
+	}
+
+	res, err := t.forward(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		if err := t.checkExpired(res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	var r scslibrary.UploadImagePartResponse
+	if err := decodeBody(res, &r); err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.parts[r.Data.PresignedURL] = body.PartNumber
+	t.mu.Unlock()
+	return jsonResponse(req, res.StatusCode, r)
+}
+
+// uploadPart uploads part n, skipping the data read by the library client
+// if it was uploaded before an interruption.
+func (t *uploadTransport) uploadPart(req *http.Request, n int) (*http.Response, error) {
+	t.mu.Lock()
+	etag, done := t.state.Parts[n]
+	offset := int64(n-1) * t.state.PartSize
+	t.mu.Unlock()
+
+	if done {
+		if _, err := io.Copy(io.Discard, req.Body); err != nil {
+			return nil, err
+		}
+		res := &http.Response{
+			Status:     http.StatusText(http.StatusOK),
+			StatusCode: http.StatusOK,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Etag": []string{etag}},
+			Body:       http.NoBody,
+			Request:    req,
+		}
+		return res, nil
+	}
+
+	res, err := t.upload(req, offset, req.ContentLength, false)
+	if err != nil || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+	t.mu.Lock()
+	t.state.Parts[n] = res.Header.Get("ETag")
+	total := t.state.TotalParts
+	t.mu.Unlock()
+	t.saveState()
+	sylog.Debugf("Uploaded part %d of %d", n, total)
+	return res, nil
+}
+
+// upload sends the size bytes of the image file at offset to the object
+// store, retrying on the network and server errors. The first attempt
+// sends the body read by the library client, whose rest is skipped when it
+// fails, the retries reading the image file. The retries of a single part
+// upload resume where the object store stopped if it supports it.
+func (t *uploadTransport) upload(req *http.Request, offset, size int64, single bool) (*http.Response, error) {
+	ctx := req.Context()
+	body := &clientBody{r: req.Body}
+	r := req.Clone(ctx)
+	r.Body = io.NopCloser(body)
+	r.GetBody = nil
+
+	for attempt := 1; ; attempt++ {
+		res, err := t.base.RoundTrip(r)
+		if err == nil && !retryStatus(res.StatusCode) {
+			return res, nil
+		}
+		if err == nil {
+			res.Body.Close()
+			err = fmt.Errorf("object store returned an error: %s", res.Status)
+		}
+		if ctx.Err() != nil || attempt == uploadAttempts {
+			return nil, err
+		}
+		if derr := body.skip(); derr != nil {
+			return nil, derr
+		}
+
+		sylog.Warningf("Upload interrupted: %v, retrying", err)
+		select {
+		case <-time.After(time.Duration(attempt) * retryDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		var start int64
+		if single {
+			start = t.resumeOffset(req, size)
+		}
+		r = req.Clone(ctx)
+		r.Body = io.NopCloser(io.NewSectionReader(t.file, offset+start, size-start))
+		r.GetBody = nil
+		r.ContentLength = size - start
+		if start > 0 {
+			sylog.Debugf("Resuming upload at byte %d", start)
+			r.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, size-1, size))
+		}
+	}
+}
+
+// resumeOffset asks the object store how much of a single part upload it
+// received, with an empty request with a "bytes */<size>" Content-Range.
+// The stores supporting resumable uploads answer with a 308 status and the
+// received Range, the upload restarts from zero otherwise.
+func (t *uploadTransport) resumeOffset(req *http.Request, size int64) int64 {
+	r := req.Clone(req.Context())
+	r.Body = http.NoBody
+	r.GetBody = nil
+	r.ContentLength = 0
+	r.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	res, err := t.base.RoundTrip(r)
+	if err != nil {
+		return 0
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusPermanentRedirect {
+		return 0
+	}
+	var end int64
+	if _, err := fmt.Sscanf(res.Header.Get("Range"), "bytes=0-%d", &end); err != nil || end+1 >= size {
+		return 0
+	}
+	return end + 1
+}
+
+// retryStatus returns whether a failed upload with this status is retried.
+func retryStatus(code int) bool {
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+// clientBody is the body of an upload read by the library client. When the
+// upload fails, the rest of the body is skipped, and the transport can't
+// read it anymore.
+type clientBody struct {
+	mu      sync.Mutex
+	r       io.Reader
+	skipped bool
+}
+
+func (b *clientBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.skipped {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return b.r.Read(p)
+}
+
+// skip reads the rest of the body, so that the library client continues
+// with the next part.
+func (b *clientBody) skip() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.skipped {
+		return nil
+	}
+	b.skipped = true
+	_, err := io.Copy(io.Discard, b.r)
+	return err
+}
+
+// statePath returns the path of the state of the upload of an image.
+func (t *uploadTransport) statePath(imageID string) string {
+	return filepath.Join(t.stateDir, t.baseURL.Hostname()+"-"+imageID+".json")
+}
+
+// loadState returns the saved state of the upload of an image, or nil.
+func (t *uploadTransport) loadState(imageID string) *uploadState {
+	b, err := os.ReadFile(t.statePath(imageID))
+	if err != nil {
+		return nil
+	}
+	st := new(uploadState)
+	if err := json.Unmarshal(b, st); err != nil || st.ImageID != imageID || st.PartSize <= 0 {
+		sylog.Debugf("Ignoring invalid upload state of image %s: %v", imageID, err)
+		return nil
+	}
+	if st.Parts == nil {
+		st.Parts = make(map[int]string)
+	}
+	return st
+}
+
+// saveState saves the state of the current multipart upload. The push
+// can't be resumed if it fails.
+func (t *uploadTransport) saveState() {
+	t.mu.Lock()
+	b, err := json.Marshal(t.state)
+	path := t.statePath(t.state.ImageID)
+	t.mu.Unlock()
+	if err == nil {
+		err = os.MkdirAll(t.stateDir, 0o700)
+	}
+	if err == nil {
+		err = os.WriteFile(path+".tmp", b, 0o600)
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		sylog.Warningf("Unable to save the upload state, an interrupted push won't be resumed: %v", err)
+	}
+}
+
+// removeState removes the state of the current multipart upload.
+func (t *uploadTransport) removeState() {
+	t.mu.Lock()
+	st := t.state
+	t.state = nil
+	t.mu.Unlock()
+	if st == nil {
+		return
+	}
+	if err := os.Remove(t.statePath(st.ImageID)); err != nil && !os.IsNotExist(err) {
+		sylog.Debugf("While removing upload state: %v", err)
+	}
+}
+
+// resumable returns whether the failed push can be resumed by running it
+// again.
+func (t *uploadTransport) resumable() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state != nil && !t.expired
+}
+
+// readBody decodes the JSON body of a request to the library, which can
+// then be sent.
+func readBody(req *http.Request, v interface{}) error {
+	b, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	return json.Unmarshal(b, v)
+}
+
+// decodeBody decodes the JSON body of a response of the library.
+func decodeBody(res *http.Response, v interface{}) error {
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// jsonResponse returns a response of the library with a JSON body.
+func jsonResponse(req *http.Request, code int, v interface{}) (*http.Response, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        http.StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+		Request:       req,
+	}, nil
+}
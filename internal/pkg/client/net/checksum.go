@@ -0,0 +1,163 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package net
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/image"
+)
+
+// Checksum is the expected digest of a downloaded image.
+type Checksum struct {
+	// Algorithm is sha256 or sha512.
+	Algorithm string
+	// Hex is the hexadecimal encoded digest.
+	Hex string
+}
+
+// ParseChecksum parses a checksum in the <algorithm>:<hex> format, as set
+// with --checksum.
+func ParseChecksum(s string) (*Checksum, error) {
+	algo, digest, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("checksum %q is not in the <algorithm>:<hex> format", s)
+	}
+	c := &Checksum{Algorithm: strings.ToLower(algo), Hex: strings.ToLower(digest)}
+	h := c.newHash()
+	if h == nil {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q, must be sha256 or sha512", algo)
+	}
+	if b, err := hex.DecodeString(c.Hex); err != nil || len(b) != h.Size() {
+		return nil, fmt.Errorf("invalid %s checksum %q", c.Algorithm, digest)
+	}
+	return c, nil
+}
+
+// String returns the checksum in the <algorithm>:<hex> format.
+func (c *Checksum) String() string {
+	return c.Algorithm + ":" + c.Hex
+}
+
+// cacheKey returns the name of the cache entry of the images with this
+// checksum, shared by the identical images pulled from different URLs.
+func (c *Checksum) cacheKey() string {
+	return c.Algorithm + "-" + c.Hex
+}
+
+func (c *Checksum) newHash() hash.Hash {
+	switch c.Algorithm {
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// verify checks the digest of the file at path.
+func (c *Checksum) verify(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := c.newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("while computing %s checksum: %w", c.Algorithm, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != c.Hex {
+		return fmt.Errorf("checksum mismatch: got %s:%s, expected %s", c.Algorithm, got, c)
+	}
+	return nil
+}
+
+// splitSource splits the checksum set as a #<algorithm>=<hex> fragment from
+// the URL src. The checksum set with --checksum takes precedence, but must
+// match the fragment if both are set.
+func splitSource(src, checksum string) (string, *Checksum, error) {
+	u, fragment, _ := strings.Cut(src, "#")
+
+	var c *Checksum
+	if fragment != "" {
+		algo, digest, ok := strings.Cut(fragment, "=")
+		if !ok {
+			return "", nil, fmt.Errorf("URL fragment %q is not a checksum in the <algorithm>=<hex> format", fragment)
+		}
+		fc, err := ParseChecksum(algo + ":" + digest)
+		if err != nil {
+			return "", nil, err
+		}
+		c = fc
+	}
+	if checksum != "" {
+		fc, err := ParseChecksum(checksum)
+		if err != nil {
+			return "", nil, err
+		}
+		if c != nil && *c != *fc {
+			return "", nil, fmt.Errorf("checksum %s differs from the checksum %s of the URL", fc, c)
+		}
+		c = fc
+	}
+	return u, c, nil
+}
+
+// errNotImage is returned when a downloaded file isn't an image.
+var errNotImage = errors.New("not a SIF, squashfs or OCI archive image")
+
+// checkImage checks that the file at path is a SIF or squashfs image, or an
+// OCI archive, before it's cached.
+func checkImage(path string) error {
+	img, err := image.Init(path, false)
+	if err == nil {
+		if img.File != nil {
+			img.File.Close()
+		}
+		if img.Type == image.SIF || img.Type == image.SQUASHFS {
+			return nil
+		}
+	}
+	if isOCIArchive(path) {
+		return nil
+	}
+	return errNotImage
+}
+
+// isOCIArchive returns whether the file at p is a tar archive holding an
+// OCI image layout.
+func isOCIArchive(p string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			return false
+		}
+		if path.Clean(hdr.Name) == "oci-layout" {
+			return true
+		}
+	}
+}
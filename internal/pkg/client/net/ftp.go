@@ -0,0 +1,196 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/client"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// ftpTimeout is the timeout of the connections to an FTP server.
+const ftpTimeout = 30 * time.Second
+
+// ftpConn is a connection to an FTP server, supporting the passive mode
+// binary transfers needed to download an image.
+type ftpConn struct {
+	*textproto.Conn
+	host string
+}
+
+// cmd sends an FTP command and reads the response, which must have the
+// expected code.
+func (c *ftpConn) cmd(expectCode int, format string, args ...interface{}) (int, string, error) {
+	if _, err := c.Cmd(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.ReadResponse(expectCode)
+}
+
+// dialData opens the data connection of a passive mode transfer, with EPSV,
+// or PASV if the server doesn't support it. The data connection always uses
+// the host of the control connection.
+func (c *ftpConn) dialData(ctx context.Context) (net.Conn, error) {
+	var port int
+	_, msg, err := c.cmd(229, "EPSV")
+	if err == nil {
+		// 229 Entering Extended Passive Mode (|||port|)
+		start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("invalid EPSV response %q", msg)
+		}
+		fields := strings.Split(msg[start+1:end], "|")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("invalid EPSV response %q", msg)
+		}
+		if port, err = strconv.Atoi(fields[3]); err != nil {
+			return nil, fmt.Errorf("invalid EPSV response %q", msg)
+		}
+	} else {
+		_, msg, err = c.cmd(227, "PASV")
+		if err != nil {
+			return nil, err
+		}
+		// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+		start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("invalid PASV response %q", msg)
+		}
+		fields := strings.Split(msg[start+1:end], ",")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("invalid PASV response %q", msg)
+		}
+		p1, err1 := strconv.Atoi(fields[4])
+		p2, err2 := strconv.Atoi(fields[5])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid PASV response %q", msg)
+		}
+		port = p1<<8 | p2
+	}
+
+	d := net.Dialer{Timeout: ftpTimeout}
+	return d.DialContext(ctx, "tcp", net.JoinHostPort(c.host, strconv.Itoa(port)))
+}
+
+// downloadFTP downloads the image at u into out from offset, with the
+// credentials of the URL, of auth, or anonymously.
+func downloadFTP(ctx context.Context, u *url.URL, out *os.File, offset int64, auth Auth) error {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "21")
+	}
+	d := net.Dialer{Timeout: ftpTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	c := &ftpConn{Conn: textproto.NewConn(conn), host: u.Hostname()}
+	defer c.Close()
+	// the connection is closed on cancellation, e.g. with Ctrl-C
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if _, _, err := c.ReadResponse(220); err != nil {
+		return err
+	}
+
+	user, pass := "anonymous", "anonymous@"
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	} else if auth.Username != "" {
+		user, pass = auth.Username, auth.Password
+	}
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err != nil {
+		return err
+	}
+	if code == 331 {
+		code, _, err = c.cmd(0, "PASS %s", pass)
+		if err != nil {
+			return err
+		}
+	}
+	if code != 230 {
+		return &permanentError{client.Unauthorized(fmt.Errorf("FTP login as %s failed: %d", user, code))}
+	}
+
+	if _, _, err := c.cmd(200, "TYPE I"); err != nil {
+		return err
+	}
+
+	path := u.Path
+	var size int64 = -1
+	if _, msg, err := c.cmd(213, "SIZE %s", path); err == nil {
+		size, _ = strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	}
+
+	data, err := c.dialData(ctx)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	if offset > 0 {
+		if _, _, err := c.cmd(350, "REST %d", offset); err != nil {
+			// without REST support the download restarts
+			sylog.Debugf("FTP server doesn't support REST, restarting download: %v", err)
+			if err := out.Truncate(0); err != nil {
+				return &permanentError{err}
+			}
+			if _, err := out.Seek(0, 0); err != nil {
+				return &permanentError{err}
+			}
+			offset = 0
+		} else {
+			sylog.Debugf("Resuming download at byte %d", offset)
+		}
+	}
+
+	code, msg, err := c.cmd(0, "RETR %s", path)
+	if err != nil {
+		return err
+	}
+	if code == 550 {
+		return &permanentError{client.NotFound(fmt.Errorf("the requested image was not found: %s", msg))}
+	} else if code != 125 && code != 150 {
+		return fmt.Errorf("FTP download failed: %d %s", code, msg)
+	}
+
+	if size >= 0 {
+		size -= offset
+	}
+	pb := client.ProgressBarCallback(ctx)
+	if err := pb(size, data, out); err != nil {
+		return err
+	}
+	data.Close()
+
+	if _, _, err := c.ReadResponse(226); err != nil {
+		return err
+	}
+	c.Cmd("QUIT")
+	return nil
+}
@@ -14,8 +14,11 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
@@ -31,16 +34,53 @@ import (
 // Timeout for an image pull in seconds - could be a large download...
 const pullTimeout = 1800
 
+// downloadAttempts is the number of attempts to download an image, the
+// download being resumed where it stopped when the server allows it.
+const downloadAttempts = 3
+
+// retryDelay is the delay before a download is resumed, multiplied by the
+// number of the attempt.
+var retryDelay = time.Second
+
+// Auth holds the credentials used to download an image. The credentials
+// of the URL take precedence.
+type Auth struct {
+	Username string
+	Password string
+	// BearerToken is sent as an HTTP bearer token, instead of the basic
+	// authentication of Username and Password.
+	BearerToken string
+}
+
+// setHTTP sets the authentication header of an HTTP request.
+func (a Auth) setHTTP(req *http.Request) {
+	if a.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+a.BearerToken)
+	} else if a.Username != "" || a.Password != "" {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+}
+
+// Options holds the options of a network image pull.
+type Options struct {
+	// Checksum is the expected digest of the image, as <algorithm>:<hex>,
+	// also accepted as a #<algorithm>=<hex> fragment of the URL.
+	Checksum string
+	// Auth holds the credentials used to download the image.
+	Auth Auth
+}
+
 // IsNetPullRef returns true if the provided string is a valid url
 // reference for a pull operation.
 func IsNetPullRef(netRef string) bool {
-	match, _ := regexp.MatchString("^http(s)?://", netRef)
+	match, _ := regexp.MatchString("^(http(s)?|s?ftp)://", netRef)
 	return match
 }
 
-// DownloadImage will retrieve an image from an http(s) URI,
-// saving it into the specified file
-func DownloadImage(ctx context.Context, filePath string, netURL string) error {
+// DownloadImage will retrieve an image from an http(s), ftp or sftp URI,
+// saving it into the specified file. The download is resumed if the
+// connection is lost.
+func DownloadImage(ctx context.Context, filePath string, netURL string, auth Auth) error {
 	if !IsNetPullRef(netURL) {
 		return fmt.Errorf("not a valid url reference: %s", netURL)
 	}
@@ -50,100 +90,274 @@ func DownloadImage(ctx context.Context, filePath string, netURL string) error {
 		sylog.Infof("Download filename not provided. Downloading to: %s\n", filePath)
 	}
 
-	url := netURL
-	sylog.Debugf("Pulling from URL: %s\n", url)
-
-	httpClient := &http.Client{
-		Timeout: pullTimeout * time.Second,
+	u, err := url.Parse(netURL)
+	if err != nil {
+		return err
 	}
+	sylog.Debugf("Pulling from URL: %s\n", u.Redacted())
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	// Perms are 777 *prior* to umask
+	out, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o777)
 	if err != nil {
 		return err
 	}
+	defer out.Close()
+
+	var download func(ctx context.Context, offset int64) error
+	switch u.Scheme {
+	case "ftp":
+		download = func(ctx context.Context, offset int64) error {
+			return downloadFTP(ctx, u, out, offset, auth)
+		}
+	case "sftp":
+		download = func(ctx context.Context, offset int64) error {
+			return downloadSFTP(ctx, u, out, offset, auth)
+		}
+	default:
+		download = func(ctx context.Context, offset int64) error {
+			return downloadHTTP(ctx, u, out, offset, auth)
+		}
+	}
 
+	for attempt := 1; ; attempt++ {
+		offset, err := out.Seek(0, io.SeekCurrent)
+		if err == nil {
+			err = download(ctx, offset)
+		}
+		if err == nil {
+			break
+		}
+		var perr *permanentError
+		if ctx.Err() != nil || errors.As(err, &perr) || attempt == downloadAttempts {
+			// Delete incomplete image file in the event of failure
+			// we get here e.g. if the context is canceled by Ctrl-C
+			out.Close()
+			sylog.Infof("Cleaning up incomplete download: %s", filePath)
+			if err := os.Remove(filePath); err != nil {
+				sylog.Errorf("Error while removing incomplete download: %v", err)
+			}
+			return err
+		}
+		sylog.Warningf("Download interrupted: %v, retrying", err)
+		select {
+		case <-time.After(time.Duration(attempt) * retryDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	sylog.Debugf("Download complete\n")
+
+	return nil
+}
+
+// permanentError is an error of a download which is not retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// newHTTPClient returns the client downloading images. The authentication
+// header is only kept for redirections to the same origin.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: pullTimeout * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if !sameOrigin(req.URL, via[0].URL) {
+				req.Header.Del("Authorization")
+			}
+			return nil
+		},
+	}
+}
+
+// sameOrigin returns whether the URLs a and b have the same scheme, host
+// and port.
+func sameOrigin(a, b *url.URL) bool {
+	port := func(u *url.URL) string {
+		if p := u.Port(); p != "" {
+			return p
+		}
+		if u.Scheme == "https" {
+			return "443"
+		}
+		return "80"
+	}
+	return a.Scheme == b.Scheme && strings.EqualFold(a.Hostname(), b.Hostname()) && port(a) == port(b)
+}
+
+// downloadHTTP downloads the image at u into out, from offset. The download
+// is restarted from the beginning if the server doesn't support ranges.
+func downloadHTTP(ctx context.Context, u *url.URL, out *os.File, offset int64, auth Auth) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return &permanentError{err}
+	}
 	req.Header.Set("User-Agent", useragent.Value())
+	auth.setHTTP(req)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 
-	res, err := httpClient.Do(req)
+	res, err := newHTTPClient().Do(req)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode == http.StatusNotFound {
-		return fmt.Errorf("the requested image was not found")
-	}
-
-	if res.StatusCode != http.StatusOK {
+	switch {
+	case res.StatusCode == http.StatusPartialContent && offset > 0:
+		var start int64
+		if _, err := fmt.Sscanf(res.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+			return fmt.Errorf("unexpected range %q in response", res.Header.Get("Content-Range"))
+		}
+		sylog.Debugf("Resuming download at byte %d", offset)
+	case res.StatusCode == http.StatusOK:
+		if offset > 0 {
+			sylog.Debugf("Server doesn't support ranges, restarting download")
+			if err := out.Truncate(0); err != nil {
+				return &permanentError{err}
+			}
+			if _, err := out.Seek(0, io.SeekStart); err != nil {
+				return &permanentError{err}
+			}
+		}
+	case res.StatusCode == http.StatusNotFound:
+		return &permanentError{client.NotFound(fmt.Errorf("the requested image was not found"))}
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return &permanentError{client.Unauthorized(fmt.Errorf("access to the requested image was denied: %s", res.Status))}
+	case res.StatusCode >= 500:
+		return fmt.Errorf("server error: %s", res.Status)
+	default:
 		buf := new(bytes.Buffer)
 		buf.ReadFrom(res.Body)
 		s := buf.String()
-		return fmt.Errorf("Download did not succeed: %d %s\n\t",
-			res.StatusCode, s)
+		return &permanentError{fmt.Errorf("Download did not succeed: %d %s\n\t",
+			res.StatusCode, s)}
 	}
 
 	sylog.Debugf("OK response received, beginning body download\n")
 
-	// Perms are 777 *prior* to umask
-	out, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o777)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
 	pb := client.ProgressBarCallback(ctx)
+	return pb(res.ContentLength, res.Body, out)
+}
 
-	err = pb(res.ContentLength, res.Body, out)
-
+// imageDate returns the last modification date of the image at u, as
+// returned by an HTTP HEAD call and the Last-Modified header, or "" if
+// it's not available.
+func imageDate(ctx context.Context, u string, auth Auth) string {
+	if !strings.HasPrefix(u, "http") {
+		return ""
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
 	if err != nil {
-		// Delete incomplete image file in the event of failure
-		// we get here e.g. if the context is canceled by Ctrl-C
-		res.Body.Close()
-		out.Close()
-		sylog.Infof("Cleaning up incomplete download: %s", filePath)
-		if err := os.Remove(filePath); err != nil {
-			sylog.Errorf("Error while removing incomplete download: %v", err)
-		}
-		return err
+		sylog.Debugf("Error constructing http request: %v", err)
+		return ""
+	}
+	req.Header.Set("User-Agent", useragent.Value())
+	auth.setHTTP(req)
+	res, err := newHTTPClient().Do(req)
+	if err != nil {
+		sylog.Debugf("Error making http request: %v", err)
+		return ""
 	}
+	res.Body.Close()
 
-	sylog.Debugf("Download complete\n")
+	headerDate := res.Header.Get("Last-Modified")
+	sylog.Debugf("HTTP Last-Modified header is: %s", headerDate)
+	return headerDate
+}
 
+// download downloads the image at pullFrom into path, checking its
+// checksum if set and its format.
+func download(ctx context.Context, path, pullFrom string, checksum *Checksum, auth Auth) error {
+	sylog.Infof("Downloading network image")
+	if err := DownloadImage(ctx, path, pullFrom, auth); err != nil {
+		return fmt.Errorf("unable to Download Image: %w", err)
+	}
+	if checksum != nil {
+		if err := checksum.verify(path); err != nil {
+			os.Remove(path)
+			return fmt.Errorf("image downloaded from %s: %w", redact(pullFrom), err)
+		}
+		sylog.Verbosef("Verified %s checksum of image", checksum.Algorithm)
+	}
+	if err := checkImage(path); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("image downloaded from %s: %w", redact(pullFrom), err)
+	}
 	return nil
 }
 
-// pull will pull a http(s) image into the cache if directTo="", or a specific file if directTo is set.
-func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string) (imagePath string, err error) {
-	// We will cache using a sha256 over the URL and the date of the file that
-	// is to be fetched, as returned by an HTTP HEAD call and the Last-Modified
-	// header. If no date is available, use the current date-time, which will
-	// effectively result in no caching.
-	imageDate := time.Now().String()
-
-	req, err := http.NewRequest("HEAD", pullFrom, nil)
+// redact returns the URL u without its password.
+func redact(u string) string {
+	pu, err := url.Parse(u)
 	if err != nil {
-		sylog.Fatalf("Error constructing http request: %v\n", err)
+		return u
 	}
-	res, err := http.DefaultClient.Do(req)
+	return pu.Redacted()
+}
+
+// pull will pull a http(s), ftp or sftp image into the cache if directTo="",
+// or a specific file if directTo is set.
+func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, opts Options) (imagePath string, err error) {
+	pullFrom, checksum, err := splitSource(pullFrom, opts.Checksum)
 	if err != nil {
-		sylog.Fatalf("Error making http request: %v\n", err)
+		return "", err
 	}
 
-	headerDate := res.Header.Get("Last-Modified")
-	sylog.Debugf("HTTP Last-Modified header is: %s", headerDate)
-	if headerDate != "" {
-		imageDate = headerDate
+	// We will cache using the checksum of the image if set, so that the
+	// identical images pulled from different URLs share the cache entry.
+	// Otherwise we use a sha256 over the URL and the date of the file
+	// that is to be fetched. If no date is available, use the current
+	// date-time, which will effectively result in no caching.
+	hash := ""
+	if checksum != nil {
+		hash = checksum.cacheKey()
+	}
+
+	// without network access the image can only be taken from the cache
+	if imgCache.IsOffline() {
+		if hash != "" {
+			if e, err := imgCache.GetEntry(cache.NetCacheType, hash); err == nil && e != nil && e.Exists {
+				return e.Path, nil
+			}
+		}
+		return imgCache.OfflineEntry(cache.NetCacheType, pullFrom)
+	}
+
+	// wait for the concurrent pulls of the same image and use their entry
+	if directTo == "" {
+		unlock, err := imgCache.LockPull(cache.NetCacheType, pullFrom)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
 	}
 
-	h := sha256.New()
-	h.Write([]byte(pullFrom + imageDate))
-	hash := hex.EncodeToString(h.Sum(nil))
+	if hash == "" && directTo == "" {
+		date := imageDate(ctx, pullFrom, opts.Auth)
+		if date == "" {
+			date = time.Now().String()
+		}
+		h := sha256.New()
+		h.Write([]byte(pullFrom + date))
+		hash = hex.EncodeToString(h.Sum(nil))
+	}
 	sylog.Debugf("Image hash for cache is: %s", hash)
 
 	if directTo != "" {
-		sylog.Infof("Downloading network image")
-		if err := DownloadImage(ctx, directTo, pullFrom); err != nil {
-			return "", fmt.Errorf("unable to Download Image: %v", err)
+		if err := download(ctx, directTo, pullFrom, checksum, opts.Auth); err != nil {
+			return "", err
 		}
 		imagePath = directTo
 
@@ -155,12 +369,11 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 		defer cacheEntry.CleanTmp()
 
 		if !cacheEntry.Exists {
-			sylog.Infof("Downloading network image")
-			err := DownloadImage(ctx, cacheEntry.TmpPath, pullFrom)
-			if err != nil {
-				sylog.Fatalf("%v\n", err)
+			if err := download(ctx, cacheEntry.TmpPath, pullFrom, checksum, opts.Auth); err != nil {
+				return "", err
 			}
 
+			cacheEntry.Source = pullFrom
 			err = cacheEntry.Finalize()
 			if err != nil {
 				return "", err
@@ -176,8 +389,8 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 	return imagePath, nil
 }
 
-// Pull will pull a http(s) image to the cache or direct to a temporary file if cache is disabled
-func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom string, tmpDir string) (imagePath string, err error) {
+// Pull will pull a http(s), ftp or sftp image to the cache or direct to a temporary file if cache is disabled
+func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom string, tmpDir string, opts Options) (imagePath string, err error) {
 	directTo := ""
 
 	if imgCache.IsDisabled() {
@@ -189,20 +402,20 @@ func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom string, tmpDir s
 		sylog.Infof("Downloading library image to tmp cache: %s", directTo)
 	}
 
-	return pull(ctx, imgCache, directTo, pullFrom)
+	return pull(ctx, imgCache, directTo, pullFrom, opts)
 }
 
-// PullToFile will pull an http(s) image to the specified location, through the cache, or directly if cache is disabled
-func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string) (imagePath string, err error) {
+// PullToFile will pull an http(s), ftp or sftp image to the specified location, through the cache, or directly if cache is disabled
+func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, opts Options) (imagePath string, err error) {
 	directTo := ""
 	if imgCache.IsDisabled() {
 		directTo = pullTo
 		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
 	}
 
-	src, err := pull(ctx, imgCache, directTo, pullFrom)
+	src, err := pull(ctx, imgCache, directTo, pullFrom, opts)
 	if err != nil {
-		return "", fmt.Errorf("error fetching image to cache: %v", err)
+		return "", fmt.Errorf("error fetching image to cache: %w", err)
 	}
 
 	if directTo == "" {
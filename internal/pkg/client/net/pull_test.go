@@ -0,0 +1,250 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package net
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+)
+
+func init() {
+	useragent.InitValue("apptainer", "3.0.0")
+	retryDelay = 0
+}
+
+// ociArchive returns a tar archive holding an OCI image layout.
+func ociArchive(t *testing.T) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	layout := []byte(`{"imageLayoutVersion": "1.0.0"}`)
+	if err := tw.WriteHeader(&tar.Header{Name: "oci-layout", Mode: 0o644, Size: int64(len(layout))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(layout); err != nil {
+		t.Fatal(err)
+	}
+	// padding, so that an interrupted download can be resumed
+	padding := bytes.Repeat([]byte("x"), 64<<10)
+	if err := tw.WriteHeader(&tar.Header{Name: "padding", Mode: 0o644, Size: int64(len(padding))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(padding); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseChecksum(t *testing.T) {
+	digest := sha256Hex([]byte("image"))
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "sha256", in: "sha256:" + digest, want: "sha256:" + digest},
+		{name: "upper case", in: "SHA256:" + strings.ToUpper(digest), want: "sha256:" + digest},
+		{name: "no algorithm", in: digest, wantErr: true},
+		{name: "unsupported algorithm", in: "md5:" + digest, wantErr: true},
+		{name: "invalid hex", in: "sha256:xyz", wantErr: true},
+		{name: "wrong length", in: "sha512:" + digest, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseChecksum(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseChecksum(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if err == nil && c.String() != tt.want {
+				t.Errorf("ParseChecksum(%q) = %s, want %s", tt.in, c, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSource(t *testing.T) {
+	digest := sha256Hex([]byte("image"))
+	other := sha256Hex([]byte("other"))
+
+	tests := []struct {
+		name     string
+		src      string
+		checksum string
+		wantURL  string
+		want     string
+		wantErr  bool
+	}{
+		{name: "none", src: "https://example.com/image.sif", wantURL: "https://example.com/image.sif"},
+		{name: "fragment", src: "https://example.com/image.sif#sha256=" + digest, wantURL: "https://example.com/image.sif", want: "sha256:" + digest},
+		{name: "flag", src: "https://example.com/image.sif", checksum: "sha256:" + digest, wantURL: "https://example.com/image.sif", want: "sha256:" + digest},
+		{name: "both", src: "https://example.com/image.sif#sha256=" + digest, checksum: "sha256:" + digest, wantURL: "https://example.com/image.sif", want: "sha256:" + digest},
+		{name: "conflict", src: "https://example.com/image.sif#sha256=" + digest, checksum: "sha256:" + other, wantErr: true},
+		{name: "invalid fragment", src: "https://example.com/image.sif#latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, c, err := splitSource(tt.src, tt.checksum)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if u != tt.wantURL {
+				t.Errorf("splitSource() URL = %s, want %s", u, tt.wantURL)
+			}
+			got := ""
+			if c != nil {
+				got = c.String()
+			}
+			if got != tt.want {
+				t.Errorf("splitSource() checksum = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	img := ociArchive(t)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// announce the whole image but drop the connection halfway
+			w.Header().Set("Content-Length", fmt.Sprint(len(img)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(img[:len(img)/2])
+			return
+		}
+		var start int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err != nil || start != len(img)/2 {
+			t.Errorf("unexpected range %q", r.Header.Get("Range"))
+			w.WriteHeader(http.StatusOK)
+			w.Write(img)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(img)-1, len(img)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(img[start:])
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "image")
+	checksum := &Checksum{Algorithm: "sha256", Hex: sha256Hex(img)}
+	if err := download(context.Background(), path, srv.URL+"/image.tar", checksum, Auth{}); err != nil {
+		t.Fatalf("download() error = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, img) {
+		t.Errorf("downloaded image differs")
+	}
+}
+
+func TestDownloadErrors(t *testing.T) {
+	img := ociArchive(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.tar":
+			w.Write(img)
+		case "/page.html":
+			w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		checksum *Checksum
+		wantErr  string
+	}{
+		{name: "checksum mismatch", path: "/image.tar", checksum: &Checksum{Algorithm: "sha256", Hex: sha256Hex([]byte("other"))}, wantErr: "checksum mismatch"},
+		{name: "not an image", path: "/page.html", wantErr: errNotImage.Error()},
+		{name: "not found", path: "/missing.sif", wantErr: "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image")
+			err := download(context.Background(), path, srv.URL+tt.path, tt.checksum, Auth{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("download() error = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("image left after a failed download")
+			}
+		})
+	}
+}
+
+func TestRedirectAuth(t *testing.T) {
+	img := ociArchive(t)
+	var otherAuth, sameAuth string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherAuth = r.Header.Get("Authorization")
+		w.Write(img)
+	}))
+	defer other.Close()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same":
+			http.Redirect(w, r, srv.URL+"/image.tar", http.StatusFound)
+		case "/other":
+			http.Redirect(w, r, other.URL+"/image.tar", http.StatusFound)
+		default:
+			sameAuth = r.Header.Get("Authorization")
+			w.Write(img)
+		}
+	}))
+	defer srv.Close()
+
+	auth := Auth{BearerToken: "secret"}
+	if err := download(context.Background(), filepath.Join(t.TempDir(), "image"), srv.URL+"/same", nil, auth); err != nil {
+		t.Fatalf("download() error = %v", err)
+	}
+	if sameAuth != "Bearer secret" {
+		t.Errorf("Authorization header %q after a redirection to the same origin", sameAuth)
+	}
+	if err := download(context.Background(), filepath.Join(t.TempDir(), "image"), srv.URL+"/other", nil, auth); err != nil {
+		t.Fatalf("download() error = %v", err)
+	}
+	if otherAuth != "" {
+		t.Errorf("Authorization header %q sent to another origin", otherAuth)
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package net
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/apptainer/apptainer/internal/pkg/client"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// The SFTP version 3 packets used to download a file.
+const (
+	sftpInit    = 1
+	sftpVersion = 2
+	sftpOpen    = 3
+	sftpClose   = 4
+	sftpRead    = 5
+	sftpFstat   = 8
+	sftpStatus  = 101
+	sftpHandle  = 102
+	sftpData    = 103
+	sftpAttrs   = 105
+
+	sftpStatusEOF        = 1
+	sftpStatusNoSuchFile = 2
+	sftpOpenRead         = 1
+	sftpAttrSize         = 1
+	// sftpReadSize is the size of the read requests, supported by all
+	// servers.
+	sftpReadSize = 32768
+)
+
+// sftpFile is a file opened for reading on an SFTP server, read
+// sequentially.
+type sftpFile struct {
+	w      io.Writer
+	r      io.Reader
+	id     uint32
+	handle string
+	offset uint64
+	eof    bool
+}
+
+// sendPacket sends an SFTP packet of type typ with the fields given, which
+// are uint32, uint64 or string values.
+func (f *sftpFile) sendPacket(typ byte, fields ...interface{}) error {
+	b := []byte{0, 0, 0, 0, typ}
+	for _, field := range fields {
+		switch v := field.(type) {
+		case uint32:
+			b = binary.BigEndian.AppendUint32(b, v)
+		case uint64:
+			b = binary.BigEndian.AppendUint64(b, v)
+		case string:
+			b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+			b = append(b, v...)
+		}
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	_, err := f.w.Write(b)
+	return err
+}
+
+// recvPacket receives an SFTP packet, returning its type and payload.
+func (f *sftpFile) recvPacket() (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(f.r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(hdr[:4])
+	if length < 1 || length > 1<<20 {
+		return 0, nil, fmt.Errorf("invalid SFTP packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(f.r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[4], payload, nil
+}
+
+// request sends a request with a new id and receives its response, whose
+// payload is returned without the id.
+func (f *sftpFile) request(typ byte, fields ...interface{}) (byte, []byte, error) {
+	f.id++
+	if err := f.sendPacket(typ, append([]interface{}{f.id}, fields...)...); err != nil {
+		return 0, nil, err
+	}
+	rtyp, payload, err := f.recvPacket()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(payload) < 4 || binary.BigEndian.Uint32(payload) != f.id {
+		return 0, nil, fmt.Errorf("unexpected SFTP response")
+	}
+	return rtyp, payload[4:], nil
+}
+
+// sftpString reads a string field from b, returning the rest of b.
+func sftpString(b []byte) (string, []byte, error) {
+	if len(b) < 4 {
+		return "", nil, fmt.Errorf("truncated SFTP packet")
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		return "", nil, fmt.Errorf("truncated SFTP packet")
+	}
+	return string(b[4 : 4+n]), b[4+n:], nil
+}
+
+// statusError returns the error of an SFTP status response.
+func statusError(payload []byte) (uint32, error) {
+	if len(payload) < 4 {
+		return 0, fmt.Errorf("truncated SFTP packet")
+	}
+	code := binary.BigEndian.Uint32(payload)
+	msg, _, _ := sftpString(payload[4:])
+	return code, fmt.Errorf("SFTP error %d: %s", code, msg)
+}
+
+// openSFTP initializes the SFTP session on w and r, and opens path for
+// reading, returning the file and its size, or -1 if unknown.
+func openSFTP(w io.Writer, r io.Reader, path string) (*sftpFile, int64, error) {
+	f := &sftpFile{w: w, r: r}
+	if err := f.sendPacket(sftpInit, uint32(3)); err != nil {
+		return nil, 0, err
+	}
+	typ, _, err := f.recvPacket()
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ != sftpVersion {
+		return nil, 0, fmt.Errorf("unexpected SFTP response to init")
+	}
+
+	typ, payload, err := f.request(sftpOpen, path, uint32(sftpOpenRead), uint32(0))
+	if err != nil {
+		return nil, 0, err
+	}
+	switch typ {
+	case sftpHandle:
+		if f.handle, _, err = sftpString(payload); err != nil {
+			return nil, 0, err
+		}
+	case sftpStatus:
+		code, err := statusError(payload)
+		if code == sftpStatusNoSuchFile {
+			err = &permanentError{client.NotFound(fmt.Errorf("the requested image was not found: %w", err))}
+		}
+		return nil, 0, err
+	default:
+		return nil, 0, fmt.Errorf("unexpected SFTP response to open")
+	}
+
+	size := int64(-1)
+	typ, payload, err = f.request(sftpFstat, f.handle)
+	if err == nil && typ == sftpAttrs && len(payload) >= 12 {
+		if binary.BigEndian.Uint32(payload)&sftpAttrSize != 0 {
+			size = int64(binary.BigEndian.Uint64(payload[4:]))
+		}
+	}
+	return f, size, nil
+}
+
+// Read reads the next chunk of the file.
+func (f *sftpFile) Read(p []byte) (int, error) {
+	if f.eof {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if n > sftpReadSize {
+		n = sftpReadSize
+	}
+	typ, payload, err := f.request(sftpRead, f.handle, f.offset, uint32(n))
+	if err != nil {
+		return 0, err
+	}
+	switch typ {
+	case sftpData:
+		data, _, err := sftpString(payload)
+		if err != nil {
+			return 0, err
+		}
+		n = copy(p, data)
+		f.offset += uint64(n)
+		return n, nil
+	case sftpStatus:
+		code, err := statusError(payload)
+		if code == sftpStatusEOF {
+			f.eof = true
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+	return 0, fmt.Errorf("unexpected SFTP response to read")
+}
+
+// Close closes the file handle.
+func (f *sftpFile) Close() error {
+	_, _, err := f.request(sftpClose, f.handle)
+	return err
+}
+
+// sshConfig returns the client configuration to connect as the user of
+// the URL, or of auth, or the current user, authenticating with the SSH
+// agent or the password. The host key of the server must be in the
+// known_hosts file of the user.
+func sshConfig(u *url.URL, auth Auth) (*ssh.ClientConfig, func(), error) {
+	username := auth.Username
+	password := auth.Password
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	if username == "" {
+		cu, err := user.Current()
+		if err != nil {
+			return nil, nil, err
+		}
+		username = cu.Username
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	hostKeyCallback, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, nil, &permanentError{fmt.Errorf("host key of %s can't be verified: %w", u.Hostname(), err)}
+	}
+
+	cleanup := func() {}
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			cleanup = func() { conn.Close() }
+		} else {
+			sylog.Debugf("Could not connect to SSH agent: %v", err)
+		}
+	}
+	if password != "" {
+		methods = append(methods, ssh.Password(password))
+	}
+	if len(methods) == 0 {
+		return nil, nil, &permanentError{errors.New("no SSH agent or password to authenticate to the SFTP server")}
+	}
+
+	return &ssh.ClientConfig{
+		User:            username,
+		Auth:            methods,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         ftpTimeout,
+	}, cleanup, nil
+}
+
+// downloadSFTP downloads the image at u into out from offset.
+func downloadSFTP(ctx context.Context, u *url.URL, out *os.File, offset int64, auth Auth) error {
+	config, cleanup, err := sshConfig(u, auth)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	d := net.Dialer{Timeout: ftpTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		var kerr *knownhosts.KeyError
+		if errors.As(err, &kerr) {
+			return &permanentError{err}
+		}
+		return err
+	}
+	c := ssh.NewClient(sshConn, chans, reqs)
+	defer c.Close()
+	// the connection is closed on cancellation, e.g. with Ctrl-C
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+
+	session, err := c.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	w, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return err
+	}
+
+	f, size, err := openSFTP(w, r, u.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if offset > 0 {
+		sylog.Debugf("Resuming download at byte %d", offset)
+		f.offset = uint64(offset)
+		if size >= 0 {
+			size -= offset
+		}
+	}
+
+	pb := client.ProgressBarCallback(ctx)
+	return pb(size, f, out)
+}
@@ -35,6 +35,9 @@ type PullOptions struct {
 	NoHTTPS    bool
 	NoCleanUp  bool
 	Pullarch   string
+	// CertDir is a containers/image certificate directory with the CA
+	// certificates and client certificate of the registry, if not empty.
+	CertDir string
 }
 
 // pull will build a SIF image into the cache if directTo="", or a specific file if directTo is set.
@@ -50,6 +53,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 		AuthFilePath:             syfs.DockerConf(),
 		DockerRegistryUserAgent:  useragent.Value(),
 		BigFilesTemporaryDir:     opts.TmpDir,
+		DockerCertPath:           opts.CertDir,
 	}
 	if opts.Pullarch != "" {
 		if arch, ok := oci.ArchMap[opts.Pullarch]; ok {
@@ -65,15 +69,40 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 		sysCtx.DockerInsecureSkipTLSVerify = ocitypes.NewOptionalBool(true)
 	}
 
-	hash, err := oci.ImageDigest(ctx, pullFrom, sysCtx)
-	if err != nil {
-		return "", fmt.Errorf("failed to get checksum for %s: %s", pullFrom, err)
+	// wait for the concurrent pulls of the same image and use their entry
+	if directTo == "" {
+		unlock, err := imgCache.LockPull(cache.OciTempCacheType, pullFrom+" "+opts.Pullarch)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+	}
+
+	var hash string
+	if imgCache.IsOffline() {
+		// use the SIF image converted by a previous pull if any, or else
+		// convert the image of the blob cache
+		if directTo == "" {
+			if path, err := imgCache.OfflineEntry(cache.OciTempCacheType, pullFrom); err == nil {
+				sylog.Infof("Using cached SIF image")
+				return path, nil
+			}
+		}
+		hash, err = oci.OfflineImageDigest(ctx, imgCache, pullFrom, sysCtx)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		hash, err = oci.ImageDigest(ctx, pullFrom, sysCtx)
+		if err != nil {
+			return "", fmt.Errorf("failed to get checksum for %s: %w", pullFrom, err)
+		}
 	}
 
 	if directTo != "" {
 		sylog.Infof("Converting OCI blobs to SIF format")
 		if err := convertOciToSIF(ctx, imgCache, pullFrom, directTo, opts); err != nil {
-			return "", fmt.Errorf("while building SIF from layers: %v", err)
+			return "", fmt.Errorf("while building SIF from layers: %w", err)
 		}
 		imagePath = directTo
 	} else {
@@ -87,9 +116,11 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 			sylog.Infof("Converting OCI blobs to SIF format")
 
 			if err := convertOciToSIF(ctx, imgCache, pullFrom, cacheEntry.TmpPath, opts); err != nil {
-				return "", fmt.Errorf("while building SIF from layers: %v", err)
+				return "", fmt.Errorf("while building SIF from layers: %w", err)
 			}
 
+			cacheEntry.Source = pullFrom
+			cacheEntry.Digest = hash
 			err = cacheEntry.Finalize()
 			if err != nil {
 				return "", err
@@ -162,9 +193,9 @@ func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom st
 	src, err := pull(ctx, imgCache, directTo, pullFrom, opts)
 	if err != nil {
 		if strings.Contains(err.Error(), "unsupported image-specific operation on artifact with type \"application/vnd.unknown.config.v1+json\"") {
-			return "", fmt.Errorf("%v; try changing the protocol to oras://", err)
+			return "", fmt.Errorf("%w; try changing the protocol to oras://", err)
 		}
-		return "", fmt.Errorf("error fetching image to cache: %v", err)
+		return "", fmt.Errorf("error fetching image to cache: %w", err)
 	}
 
 	if directTo == "" {
@@ -13,6 +13,7 @@ package oras
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -23,7 +24,9 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/apptainer/apptainer/internal/pkg/client"
 	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/inspect"
 	"github.com/apptainer/apptainer/pkg/syfs"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/containerd/containerd/images"
@@ -31,6 +34,7 @@ import (
 	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/tlsclientconfig"
 	ocitypes "github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
@@ -80,14 +84,36 @@ func (t *orasUploadTransport) RoundTrip(r *http.Request) (*http.Response, error)
 	return t.rt.RoundTrip(r)
 }
 
-func newOrasUploadTransport() http.RoundTripper {
+func newOrasUploadTransport(rt http.RoundTripper) http.RoundTripper {
 	return &orasUploadTransport{
-		rt: http.DefaultTransport,
+		rt: rt,
 	}
 }
 
-func getResolver(ctx context.Context, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, push, progressBar bool) (remotes.Resolver, error) {
-	opts := docker.ResolverOptions{Credentials: genCredfn(ociAuth), PlainHTTP: noHTTPS}
+// newCertDirTransport returns an HTTP transport with the CA certificates
+// and client certificate of certDir, a containers/image certificate
+// directory.
+func newCertDirTransport(certDir string) (http.RoundTripper, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if err := tlsclientconfig.SetupCertificates(certDir, tc); err != nil {
+		return nil, fmt.Errorf("while loading certificates from %s: %v", certDir, err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tc
+	return transport, nil
+}
+
+func getResolver(ctx context.Context, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, push, progressBar bool, certDir string) (remotes.Resolver, error) {
+	httpClient := &http.Client{}
+	if certDir != "" {
+		transport, err := newCertDirTransport(certDir)
+		if err != nil {
+			return nil, err
+		}
+		httpClient.Transport = transport
+	}
+
+	opts := docker.ResolverOptions{Credentials: genCredfn(ociAuth), PlainHTTP: noHTTPS, Client: httpClient}
 	if ociAuth != nil && (ociAuth.Username != "" || ociAuth.Password != "") {
 		return docker.NewResolver(opts), nil
 	}
@@ -98,15 +124,17 @@ func getResolver(ctx context.Context, ociAuth *ocitypes.DockerAuthConfig, noHTTP
 		return docker.NewResolver(opts), nil
 	}
 
-	httpClient := &http.Client{}
-
 	// docker client doesn't merge scopes correctly and can set multiple scopes in url parameters when pushing image:
 	// "scope=repository:my_namespace/alpine:pull&scope=repository:my_namespace:alpine:pull,push",
 	// this could be merged to "scope=repository:my_namespace:alpine:pull,push".
 	// Since there are authorization servers that might not support multiple scopes, a custom transport is injected
 	// to merge duplicated scopes
 	if push {
-		httpClient.Transport = newOrasUploadTransport()
+		rt := httpClient.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		httpClient.Transport = newOrasUploadTransport(rt)
 	}
 
 	solver, err := cli.Resolver(ctx, httpClient, noHTTPS)
@@ -121,8 +149,9 @@ func getResolver(ctx context.Context, ociAuth *ocitypes.DockerAuthConfig, noHTTP
 	return solver, nil
 }
 
-// DownloadImage downloads a SIF image specified by an oci reference to a file using the included credentials
-func DownloadImage(ctx context.Context, imagePath, ref string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) error {
+// DownloadImage downloads a SIF image specified by an oci reference to a file using the included credentials,
+// and the certificates of certDir if not empty
+func DownloadImage(ctx context.Context, imagePath, ref string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool, certDir string) error {
 	ref = strings.TrimPrefix(ref, "oras://")
 	ref = strings.TrimPrefix(ref, "//")
 
@@ -137,7 +166,7 @@ func DownloadImage(ctx context.Context, imagePath, ref string, ociAuth *ocitypes
 		sylog.Infof("No tag or digest found, using default: %s", SifDefaultTag)
 	}
 
-	resolver, err := getResolver(ctx, ociAuth, noHTTPS, false, true)
+	resolver, err := getResolver(ctx, ociAuth, noHTTPS, false, true, certDir)
 	if err != nil {
 		return fmt.Errorf("while getting resolver: %s", err)
 	}
@@ -175,7 +204,7 @@ func DownloadImage(ctx context.Context, imagePath, ref string, ociAuth *ocitypes
 
 	_, err = oras.Copy(orasctx.WithLoggerDiscarded(ctx), resolver, spec.String(), store, "", allowedMediaTypes, pullHandler)
 	if err != nil {
-		return fmt.Errorf("unable to pull from registry: %s", err)
+		return fmt.Errorf("unable to pull from registry: %w", err)
 	}
 
 	// ensure that we have downloaded a SIF
@@ -194,8 +223,8 @@ func DownloadImage(ctx context.Context, imagePath, ref string, ociAuth *ocitypes
 }
 
 // UploadImage uploads the image specified by path and pushes it to the provided oci reference,
-// it will use credentials if supplied
-func UploadImage(ctx context.Context, path, ref string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) error {
+// it will use credentials, and the certificates of certDir, if supplied
+func UploadImage(ctx context.Context, path, ref string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool, certDir string) error {
 	// ensure that are uploading a SIF
 	if err := ensureSIF(path); err != nil {
 		return err
@@ -222,7 +251,7 @@ func UploadImage(ctx context.Context, path, ref string, ociAuth *ocitypes.Docker
 		sylog.Infof("No tag or digest found, using default: %s", SifDefaultTag)
 	}
 
-	resolver, err := getResolver(ctx, ociAuth, noHTTPS, true, true)
+	resolver, err := getResolver(ctx, ociAuth, noHTTPS, true, true, certDir)
 	if err != nil {
 		return fmt.Errorf("while getting resolver: %s", err)
 	}
@@ -273,68 +302,149 @@ func ensureSIF(filepath string) error {
 	return nil
 }
 
-// ImageSHA returns the sha256 digest of the SIF layer of the OCI manifest
-// oci spec dictates only sha256 and sha512 are supported at time creation for this function
-// sha512 is currently optional for implementations, this function will return an error when
-// encountering such digests.
-// https://github.com/opencontainers/image-spec/blob/master/descriptor.md#registered-algorithms
-func ImageSHA(ctx context.Context, uri string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) (string, error) {
-	ref := strings.TrimPrefix(uri, "oras://")
-	ref = strings.TrimPrefix(ref, "//")
-
-	resolver, err := getResolver(ctx, ociAuth, noHTTPS, false, false)
-	if err != nil {
-		return "", fmt.Errorf("while getting resolver: %s", err)
-	}
+// fetchManifest resolves the reference ref and returns its image manifest.
+func fetchManifest(ctx context.Context, resolver remotes.Resolver, ref string) (ocispec.Manifest, error) {
+	var man ocispec.Manifest
 
 	_, desc, err := resolver.Resolve(ctx, ref)
 	if err != nil {
-		return "", fmt.Errorf("while resolving reference: %v", err)
+		return man, fmt.Errorf("while resolving reference: %w", err)
 	}
 
 	// ensure that we received an image manifest descriptor
 	if desc.MediaType != ocispec.MediaTypeImageManifest {
 		if desc.MediaType == manifest.DockerV2Schema2MediaType {
-			return "", errors.New("unexpected docker media type received; try changing the protocol to docker://")
+			return man, errors.New("unexpected docker media type received; try changing the protocol to docker://")
 		}
-		return "", fmt.Errorf("could not get image manifest, received mediaType: %s", desc.MediaType)
+		return man, fmt.Errorf("could not get image manifest, received mediaType: %s", desc.MediaType)
 	}
 
 	fetcher, err := resolver.Fetcher(ctx, ref)
 	if err != nil {
-		return "", fmt.Errorf("while creating fetcher for reference: %v", err)
+		return man, fmt.Errorf("while creating fetcher for reference: %w", err)
 	}
 
 	rc, err := fetcher.Fetch(ctx, desc)
 	if err != nil {
-		return "", fmt.Errorf("while fetching manifest: %v", err)
+		return man, fmt.Errorf("while fetching manifest: %w", err)
 	}
 	defer rc.Close()
 
 	b, err := io.ReadAll(rc)
 	if err != nil {
-		return "", fmt.Errorf("while reading manifest: %v", err)
+		return man, fmt.Errorf("while reading manifest: %w", err)
 	}
 
-	var man ocispec.Manifest
 	if err := json.Unmarshal(b, &man); err != nil {
-		return "", fmt.Errorf("while unmarshalling manifest: %v", err)
+		return man, fmt.Errorf("while unmarshalling manifest: %w", err)
 	}
+	return man, nil
+}
 
-	// search image layers for sif image and return sha
+// sifLayer returns the SIF layer of the manifest man.
+func sifLayer(man ocispec.Manifest) (ocispec.Descriptor, error) {
 	for _, l := range man.Layers {
 		for _, t := range sifLayerMediaTypes {
 			if l.MediaType == t {
-				// only allow sha256 digests
-				if l.Digest.Algorithm() != digest.SHA256 {
-					return "", fmt.Errorf("SIF layer found with incorrect digest algorithm: %s", l.Digest.Algorithm())
-				}
-				return l.Digest.String(), nil
+				return l, nil
 			}
 		}
 	}
+	return ocispec.Descriptor{}, fmt.Errorf("no layer found corresponding to SIF image")
+}
+
+// ImageSHA returns the sha256 digest of the SIF layer of the OCI manifest
+// oci spec dictates only sha256 and sha512 are supported at time creation for this function
+// sha512 is currently optional for implementations, this function will return an error when
+// encountering such digests.
+// https://github.com/opencontainers/image-spec/blob/master/descriptor.md#registered-algorithms
+func ImageSHA(ctx context.Context, uri string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool, certDir string) (string, error) {
+	ref := strings.TrimPrefix(uri, "oras://")
+	ref = strings.TrimPrefix(ref, "//")
+
+	resolver, err := getResolver(ctx, ociAuth, noHTTPS, false, false, certDir)
+	if err != nil {
+		return "", fmt.Errorf("while getting resolver: %s", err)
+	}
+
+	man, err := fetchManifest(ctx, resolver, ref)
+	if err != nil {
+		return "", err
+	}
+
+	// search image layers for sif image and return sha
+	l, err := sifLayer(man)
+	if err != nil {
+		return "", err
+	}
+	// only allow sha256 digests
+	if l.Digest.Algorithm() != digest.SHA256 {
+		return "", fmt.Errorf("SIF layer found with incorrect digest algorithm: %s", l.Digest.Algorithm())
+	}
+	return l.Digest.String(), nil
+}
+
+// RemoteMetadata returns the metadata of the SIF image uri, read from its
+// manifest and from the header and descriptors of the SIF layer fetched
+// with range requests, without pulling the image.
+func RemoteMetadata(ctx context.Context, uri string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool, certDir string) (*inspect.RemoteAttributes, error) {
+	ref := strings.TrimPrefix(uri, "oras://")
+	ref = strings.TrimPrefix(ref, "//")
+
+	spec, err := reference.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse oci reference: %s", err)
+	}
+	if spec.Object == "" {
+		spec.Object = SifDefaultTag
+	}
+	ref = spec.String()
+
+	resolver, err := getResolver(ctx, ociAuth, noHTTPS, false, false, certDir)
+	if err != nil {
+		return nil, fmt.Errorf("while getting resolver: %s", err)
+	}
+
+	man, err := fetchManifest(ctx, resolver, ref)
+	if err != nil {
+		return nil, err
+	}
+	layer, err := sifLayer(man)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := &inspect.RemoteAttributes{
+		Source: uri,
+		Digest: layer.Digest.String(),
+	}
+	for _, l := range man.Layers {
+		attrs.Layers = append(attrs.Layers, inspect.RemoteLayer{
+			Digest:    l.Digest.String(),
+			MediaType: l.MediaType,
+			Size:      l.Size,
+		})
+		attrs.Size += l.Size
+	}
+
+	fetcher, err := resolver.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("while creating fetcher for reference: %w", err)
+	}
+	rc, err := fetcher.Fetch(ctx, layer)
+	if err != nil {
+		return nil, fmt.Errorf("while fetching SIF layer: %w", err)
+	}
+	defer rc.Close()
 
-	return "", fmt.Errorf("no layer found corresponding to SIF image")
+	rs, ok := rc.(io.ReadSeeker)
+	if !ok {
+		return nil, fmt.Errorf("SIF layer of %s can't be read with range requests", uri)
+	}
+	if err := client.ReadRemoteSIF(client.NewReadSeekerAt(rs), attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
 }
 
 // ImageHash returns the appropriate hash for a provided image file
@@ -21,16 +21,30 @@ import (
 )
 
 // pull will pull an oras image into the cache if directTo="", or a specific file if directTo is set.
-func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) (imagePath string, err error) {
-	hash, err := ImageSHA(ctx, pullFrom, ociAuth, noHTTPS)
+func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool, certDir string) (imagePath string, err error) {
+	// without network access the image can only be taken from the cache
+	if imgCache.IsOffline() {
+		return imgCache.OfflineEntry(cache.OrasCacheType, pullFrom)
+	}
+
+	// wait for the concurrent pulls of the same image and use their entry
+	if directTo == "" {
+		unlock, err := imgCache.LockPull(cache.OrasCacheType, pullFrom)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+	}
+
+	hash, err := ImageSHA(ctx, pullFrom, ociAuth, noHTTPS, certDir)
 	if err != nil {
-		return "", fmt.Errorf("failed to get checksum for %s: %s", pullFrom, err)
+		return "", fmt.Errorf("failed to get checksum for %s: %w", pullFrom, err)
 	}
 
 	if directTo != "" {
 		sylog.Infof("Downloading oras image")
-		if err := DownloadImage(ctx, directTo, pullFrom, ociAuth, noHTTPS); err != nil {
-			return "", fmt.Errorf("unable to Download Image: %v", err)
+		if err := DownloadImage(ctx, directTo, pullFrom, ociAuth, noHTTPS, certDir); err != nil {
+			return "", fmt.Errorf("unable to Download Image: %w", err)
 		}
 		imagePath = directTo
 
@@ -43,8 +57,8 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 		if !cacheEntry.Exists {
 			sylog.Infof("Downloading oras image")
 
-			if err := DownloadImage(ctx, cacheEntry.TmpPath, pullFrom, ociAuth, noHTTPS); err != nil {
-				return "", fmt.Errorf("unable to Download Image: %v", err)
+			if err := DownloadImage(ctx, cacheEntry.TmpPath, pullFrom, ociAuth, noHTTPS, certDir); err != nil {
+				return "", fmt.Errorf("unable to Download Image: %w", err)
 			}
 			if cacheFileHash, err := ImageHash(cacheEntry.TmpPath); err != nil {
 				return "", fmt.Errorf("error getting ImageHash: %v", err)
@@ -52,6 +66,8 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 				return "", fmt.Errorf("cached file hash(%s) and expected hash(%s) does not match", cacheFileHash, hash)
 			}
 
+			cacheEntry.Source = pullFrom
+			cacheEntry.Digest = hash
 			err = cacheEntry.Finalize()
 			if err != nil {
 				return "", err
@@ -66,8 +82,9 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 	return imagePath, nil
 }
 
-// Pull will pull an oras image to the cache or direct to a temporary file if cache is disabled
-func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) (imagePath string, err error) {
+// Pull will pull an oras image to the cache or direct to a temporary file if cache is disabled.
+// The registry certificates of certDir are used if not empty.
+func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool, certDir string) (imagePath string, err error) {
 	directTo := ""
 
 	if imgCache.IsDisabled() {
@@ -79,20 +96,21 @@ func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string,
 		sylog.Infof("Downloading oras image to tmp cache: %s", directTo)
 	}
 
-	return pull(ctx, imgCache, directTo, pullFrom, ociAuth, noHTTPS)
+	return pull(ctx, imgCache, directTo, pullFrom, ociAuth, noHTTPS, certDir)
 }
 
-// PullToFile will pull an oras image to the specified location, through the cache, or directly if cache is disabled
-func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) (imagePath string, err error) {
+// PullToFile will pull an oras image to the specified location, through the cache, or directly if cache is disabled.
+// The registry certificates of certDir are used if not empty.
+func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool, certDir string) (imagePath string, err error) {
 	directTo := ""
 	if imgCache.IsDisabled() {
 		directTo = pullTo
 		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
 	}
 
-	src, err := pull(ctx, imgCache, directTo, pullFrom, ociAuth, noHTTPS)
+	src, err := pull(ctx, imgCache, directTo, pullFrom, ociAuth, noHTTPS, certDir)
 	if err != nil {
-		return "", fmt.Errorf("error fetching image to cache: %v", err)
+		return "", fmt.Errorf("error fetching image to cache: %w", err)
 	}
 
 	if directTo == "" {
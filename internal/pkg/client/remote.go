@@ -0,0 +1,264 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/apptainer/apptainer/pkg/inspect"
+	libClient "github.com/apptainer/container-library-client/client"
+	"github.com/apptainer/sif/v2/pkg/sif"
+	"github.com/containerd/containerd/errdefs"
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/containers/image/v5/docker"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+// ErrUnauthorized is returned when the credentials for a registry or a
+// library are missing or rejected.
+var ErrUnauthorized = errors.New("authentication required")
+
+// ErrNotFound is returned when the image of a reference doesn't exist.
+var ErrNotFound = errors.New("image not found")
+
+// classError marks an error with the sentinel error of its class, which
+// errors.Is matches, keeping its message unchanged.
+type classError struct {
+	err    error
+	target error
+}
+
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classError) Unwrap() error {
+	return e.err
+}
+
+func (e *classError) Is(target error) bool {
+	return target == e.target
+}
+
+// Unauthorized returns err marked as matching ErrUnauthorized.
+func Unauthorized(err error) error {
+	return &classError{err: err, target: ErrUnauthorized}
+}
+
+// NotFound returns err marked as matching ErrNotFound.
+func NotFound(err error) error {
+	return &classError{err: err, target: ErrNotFound}
+}
+
+// IsNotFound returns whether err reports an image missing from a library,
+// a registry or a server.
+func IsNotFound(err error) bool {
+	if errors.Is(err, ErrNotFound) || errors.Is(err, libClient.ErrNotFound) || errdefs.IsNotFound(err) {
+		return true
+	}
+	var statusErr remoteserrors.ErrUnexpectedStatus
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusNotFound
+	}
+	isNotFoundCode := func(e errcode.Error) bool {
+		return e.Code == v2.ErrorCodeManifestUnknown || e.Code == v2.ErrorCodeNameUnknown || e.Code == v2.ErrorCodeBlobUnknown
+	}
+	var codeErr errcode.Error
+	if errors.As(err, &codeErr) && isNotFoundCode(codeErr) {
+		return true
+	}
+	var codeErrs errcode.Errors
+	if errors.As(err, &codeErrs) {
+		for _, e := range codeErrs {
+			if ce, ok := e.(errcode.Error); ok && isNotFoundCode(ce) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsUnauthorized returns whether err reports credentials missing or
+// rejected by a registry or a library.
+func IsUnauthorized(err error) bool {
+	if errors.Is(err, ErrUnauthorized) || errors.Is(err, libClient.ErrUnauthorized) {
+		return true
+	}
+	var credErr docker.ErrUnauthorizedForCredentials
+	if errors.As(err, &credErr) {
+		return true
+	}
+	var statusErr remoteserrors.ErrUnexpectedStatus
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden
+	}
+	isAuthCode := func(e errcode.Error) bool {
+		return e.Code == errcode.ErrorCodeUnauthorized || e.Code == errcode.ErrorCodeDenied
+	}
+	var codeErr errcode.Error
+	if errors.As(err, &codeErr) && isAuthCode(codeErr) {
+		return true
+	}
+	var codeErrs errcode.Errors
+	if errors.As(err, &codeErrs) {
+		for _, e := range codeErrs {
+			if ce, ok := e.(errcode.Error); ok && isAuthCode(ce) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HTTPReaderAt reads a remote file with HTTP range requests, so that only
+// the parts read are downloaded.
+type HTTPReaderAt struct {
+	client *http.Client
+	req    *http.Request
+}
+
+// NewHTTPReaderAt returns a reader of the file downloaded by req, the
+// range requests being sent with client.
+func NewHTTPReaderAt(client *http.Client, req *http.Request) *HTTPReaderAt {
+	return &HTTPReaderAt{client: client, req: req}
+}
+
+// ReadAt reads len(p) bytes of the remote file at offset off.
+func (r *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	req := r.req.Clone(r.req.Context())
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, io.EOF
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return 0, fmt.Errorf("%w: %s", ErrUnauthorized, res.Status)
+	case http.StatusOK:
+		return 0, fmt.Errorf("range requests are not supported by %s", req.URL.Host)
+	default:
+		return 0, fmt.Errorf("unexpected http status %s", res.Status)
+	}
+
+	n, err := io.ReadFull(res.Body, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readSeekerAt reads a ReadSeeker at offsets, such as a registry blob
+// seeking with range requests.
+type readSeekerAt struct {
+	mu sync.Mutex
+	rs io.ReadSeeker
+}
+
+// NewReadSeekerAt returns a reader at offsets of rs.
+func NewReadSeekerAt(rs io.ReadSeeker) io.ReaderAt {
+	return &readSeekerAt{rs: rs}
+}
+
+func (r *readSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.rs, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readOnlySIF allows to load a SIF image from a reader, the image being
+// only read.
+type readOnlySIF struct {
+	io.ReaderAt
+}
+
+var errReadOnlySIF = errors.New("remote SIF image is read-only")
+
+func (readOnlySIF) Write([]byte) (int, error)      { return 0, errReadOnlySIF }
+func (readOnlySIF) Seek(int64, int) (int64, error) { return 0, errReadOnlySIF }
+func (readOnlySIF) Truncate(int64) error           { return errReadOnlySIF }
+
+// sifMetadataName is the name of the JSON object holding the inspect
+// metadata of the SIF images built by Apptainer.
+const sifMetadataName = "inspect-metadata.json"
+
+// maxSIFMetadataSize is the maximum size of the inspect metadata read
+// from a remote SIF image.
+const maxSIFMetadataSize = 16 << 20
+
+// ReadRemoteSIF sets the architecture, the descriptor table, the labels,
+// the environment and the runscript of attrs from the SIF image read by
+// r. Only the header, the descriptors and the inspect metadata object are
+// read.
+func ReadRemoteSIF(r io.ReaderAt, attrs *inspect.RemoteAttributes) error {
+	f, err := sif.LoadContainer(readOnlySIF{r}, sif.OptLoadWithCloseOnUnload(false))
+	if err != nil {
+		return fmt.Errorf("while reading SIF header: %w", err)
+	}
+	defer f.UnloadContainer()
+
+	attrs.Architecture = f.PrimaryArch()
+
+	ds, err := f.GetDescriptors()
+	if err != nil && !errors.Is(err, sif.ErrNoObjects) {
+		return fmt.Errorf("while reading SIF descriptors: %w", err)
+	}
+	for _, d := range ds {
+		o := inspect.RemoteObject{
+			ID:   d.ID(),
+			Type: d.DataType().String(),
+			Name: d.Name(),
+			Size: d.Size(),
+		}
+		if d.DataType() == sif.DataPartition {
+			if _, _, arch, err := d.PartitionMetadata(); err == nil {
+				o.Arch = arch
+			}
+		}
+		attrs.Objects = append(attrs.Objects, o)
+
+		if d.DataType() != sif.DataGenericJSON || d.Name() != sifMetadataName || d.Size() > maxSIFMetadataSize {
+			continue
+		}
+		b, err := d.GetData()
+		if err != nil {
+			return fmt.Errorf("while reading SIF inspect metadata: %w", err)
+		}
+		metadata := new(inspect.Metadata)
+		if err := json.Unmarshal(b, metadata); err != nil {
+			return fmt.Errorf("while decoding SIF inspect metadata: %w", err)
+		}
+		attrs.Labels = metadata.Attributes.Labels
+		attrs.Environment = metadata.Attributes.Environment
+		attrs.Runscript = metadata.Attributes.Runscript
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/inspect"
+	"github.com/apptainer/sif/v2/pkg/sif"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+// remoteSIF returns a SIF image with a partition of size bytes and the
+// inspect metadata of the images built by Apptainer.
+func remoteSIF(t *testing.T, size int) []byte {
+	t.Helper()
+
+	part, err := sif.NewDescriptorInput(sif.DataPartition, bytes.NewReader(make([]byte, size)),
+		sif.OptPartitionMetadata(sif.FsSquash, sif.PartPrimSys, "amd64"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := sif.NewDescriptorInput(sif.DataGenericJSON,
+		strings.NewReader(`{"data": {"attributes": {"labels": {"org.label": "remote"}, "runscript": "#!/bin/sh"}}}`),
+		sif.OptObjectName(sifMetadataName),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b sif.Buffer
+	f, err := sif.CreateContainer(&b, sif.OptCreateWithDescriptors(part, metadata), sif.OptCreateDeterministic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestReadRemoteSIF(t *testing.T) {
+	const partSize = 1 << 20
+	image := remoteSIF(t, partSize)
+
+	var read int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "" {
+			t.Errorf("request without range")
+		}
+		rw := &countingWriter{ResponseWriter: w, n: &read}
+		http.ServeContent(rw, r, "image.sif", time.Time{}, bytes.NewReader(image))
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := new(inspect.RemoteAttributes)
+	if err := ReadRemoteSIF(NewHTTPReaderAt(srv.Client(), req), attrs); err != nil {
+		t.Fatalf("while reading remote SIF: %s", err)
+	}
+
+	if attrs.Architecture != "amd64" {
+		t.Errorf("got architecture %q, want amd64", attrs.Architecture)
+	}
+	if len(attrs.Objects) != 2 {
+		t.Fatalf("got objects %v, want 2 objects", attrs.Objects)
+	}
+	if o := attrs.Objects[0]; o.Type != sif.DataPartition.String() || o.Size != partSize || o.Arch != "amd64" {
+		t.Errorf("unexpected partition object %+v", o)
+	}
+	if o := attrs.Objects[1]; o.Name != sifMetadataName {
+		t.Errorf("unexpected metadata object %+v", o)
+	}
+	if attrs.Labels["org.label"] != "remote" || attrs.Runscript != "#!/bin/sh" {
+		t.Errorf("unexpected labels %v and runscript %q", attrs.Labels, attrs.Runscript)
+	}
+	if n := atomic.LoadInt64(&read); n >= partSize {
+		t.Errorf("%d bytes read, the partition must not be downloaded", n)
+	}
+}
+
+// countingWriter counts the bytes of the response bodies.
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(w.n, int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
+
+func TestHTTPReaderAtErrors(t *testing.T) {
+	tests := []struct {
+		name             string
+		status           int
+		wantErr          string
+		wantUnauthorized bool
+	}{
+		{
+			name:             "Unauthorized",
+			status:           http.StatusUnauthorized,
+			wantErr:          "authentication required",
+			wantUnauthorized: true,
+		},
+		{
+			name:             "Forbidden",
+			status:           http.StatusForbidden,
+			wantErr:          "authentication required",
+			wantUnauthorized: true,
+		},
+		{
+			name:    "NoRangeSupport",
+			status:  http.StatusOK,
+			wantErr: "range requests are not supported",
+		},
+		{
+			name:    "NotFound",
+			status:  http.StatusNotFound,
+			wantErr: "unexpected http status 404",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, "content")
+			}))
+			defer srv.Close()
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ReadRemoteSIF(NewHTTPReaderAt(srv.Client(), req), new(inspect.RemoteAttributes))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+			if IsUnauthorized(err) != tt.wantUnauthorized {
+				t.Errorf("unauthorized is %v, want %v", IsUnauthorized(err), tt.wantUnauthorized)
+			}
+		})
+	}
+
+	if IsUnauthorized(errors.New("authentication required")) {
+		t.Errorf("unrelated error reported as unauthorized")
+	}
+}
+
+func TestErrorClasses(t *testing.T) {
+	notFound := NotFound(errors.New("image does not exist in the library: test/image:latest (amd64)"))
+	unauthorized := Unauthorized(errors.New("access to the requested image was denied: 403 Forbidden"))
+
+	tests := []struct {
+		name             string
+		err              error
+		wantNotFound     bool
+		wantUnauthorized bool
+	}{
+		{name: "NotFound", err: notFound, wantNotFound: true},
+		{name: "NotFoundWrapped", err: fmt.Errorf("while pulling: %w", notFound), wantNotFound: true},
+		{name: "Unauthorized", err: unauthorized, wantUnauthorized: true},
+		{name: "UnauthorizedWrapped", err: fmt.Errorf("while pulling: %w", unauthorized), wantUnauthorized: true},
+		{name: "ManifestUnknown", err: fmt.Errorf("reading manifest: %w", v2.ErrorCodeManifestUnknown.WithMessage("manifest unknown")), wantNotFound: true},
+		{name: "Denied", err: fmt.Errorf("reading manifest: %w", errcode.ErrorCodeDenied.WithMessage("denied")), wantUnauthorized: true},
+		{name: "Unrelated", err: errors.New("image not found")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if IsNotFound(tt.err) != tt.wantNotFound {
+				t.Errorf("IsNotFound() = %v, want %v", IsNotFound(tt.err), tt.wantNotFound)
+			}
+			if IsUnauthorized(tt.err) != tt.wantUnauthorized {
+				t.Errorf("IsUnauthorized() = %v, want %v", IsUnauthorized(tt.err), tt.wantUnauthorized)
+			}
+		})
+	}
+
+	// the message of the marked errors is unchanged
+	if got, want := notFound.Error(), "image does not exist in the library: test/image:latest (amd64)"; got != want {
+		t.Errorf("message %q, want %q", got, want)
+	}
+}
@@ -133,6 +133,20 @@ func DownloadImage(ctx context.Context, manifest APIResponse, filePath, shubRef
 
 // pull will pull an oras image into the cache if directTo="", or a specific file if directTo is set.
 func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, noHTTPS bool) (imagePath string, err error) {
+	// without network access the image can only be taken from the cache
+	if imgCache.IsOffline() {
+		return imgCache.OfflineEntry(cache.ShubCacheType, pullFrom)
+	}
+
+	// wait for the concurrent pulls of the same image and use their entry
+	if directTo == "" {
+		unlock, err := imgCache.LockPull(cache.ShubCacheType, pullFrom)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+	}
+
 	shubURI, err := ParseReference(pullFrom)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse shub uri: %s", err)
@@ -164,6 +178,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 				return "", err
 			}
 
+			cacheEntry.Source = pullFrom
 			err = cacheEntry.Finalize()
 			if err != nil {
 				return "", err
@@ -0,0 +1,270 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package urihandler pulls and pushes the images of the URI schemes
+// handled by plugins.
+package urihandler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/client"
+	"github.com/apptainer/apptainer/internal/pkg/client/oci"
+	"github.com/apptainer/apptainer/internal/pkg/plugin"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/uri"
+	"github.com/apptainer/apptainer/pkg/image"
+	clicallback "github.com/apptainer/apptainer/pkg/plugin/callback/cli"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/opencontainers/go-digest"
+)
+
+// reserved are the URI schemes and build bootstrap agents handled by
+// apptainer, besides the image URIs, which can't be handled by plugins.
+var reserved = map[string]bool{
+	"instance":    true,
+	"localimage":  true,
+	"busybox":     true,
+	"debootstrap": true,
+	"arch":        true,
+	"yum":         true,
+	"zypper":      true,
+	"scratch":     true,
+}
+
+var (
+	handlers     map[string]clicallback.URIHandler
+	handlersErr  error
+	handlersOnce sync.Once
+)
+
+// loadHandlers returns the URI handlers registered by the plugins,
+// indexed by scheme.
+func loadHandlers() (map[string]clicallback.URIHandler, error) {
+	handlersOnce.Do(func() {
+		callbackType := (clicallback.ImageURIHandler)(nil)
+		entries, err := plugin.LoadCallbackEntries(callbackType)
+		if err != nil {
+			handlersErr = fmt.Errorf("while loading plugins callbacks '%T': %w", callbackType, err)
+			return
+		}
+
+		handlers = make(map[string]clicallback.URIHandler)
+		for _, e := range entries {
+			h := e.Callback.(clicallback.ImageURIHandler)()
+			scheme := h.Scheme()
+			if ok, _ := uri.IsValid(scheme + ":"); ok || reserved[scheme] {
+				sylog.Warningf("Ignoring the handler of plugin %s for the %s URI scheme handled by apptainer", e.Plugin, scheme)
+				continue
+			}
+			if _, ok := handlers[scheme]; ok {
+				sylog.Warningf("Ignoring the handler of plugin %s for the %s URI scheme already handled by another plugin", e.Plugin, scheme)
+				continue
+			}
+			handlers[scheme] = h
+		}
+	})
+	return handlers, handlersErr
+}
+
+// Get returns the handler registered by a plugin for the URI scheme, or
+// nil if there's none.
+func Get(scheme string) (clicallback.URIHandler, error) {
+	if scheme == "" {
+		return nil, nil
+	}
+	h, err := loadHandlers()
+	if err != nil {
+		return nil, err
+	}
+	return h[scheme], nil
+}
+
+// progressBar reports the progress of a transfer of a URI handler with
+// a download progress bar.
+type progressBar struct {
+	bar     client.DownloadProgressBar
+	started bool
+	done    int64
+	total   int64
+}
+
+func (p *progressBar) update(done, total int64) {
+	if !p.started {
+		p.bar.Init(total)
+		p.started = true
+		p.total = total
+	}
+	if done > p.done {
+		p.bar.IncrBy(int(done - p.done))
+		p.done = done
+	}
+}
+
+// finish completes the progress bar once the transfer is finished.
+func (p *progressBar) finish(err error) {
+	if !p.started {
+		return
+	}
+	if err != nil || p.total <= 0 || p.done != p.total {
+		p.bar.Abort(err != nil)
+	}
+	p.bar.Wait()
+}
+
+// fetch downloads the image pullFrom resolved to dgst with the handler h
+// to the file dest, converting it to a SIF image if it's an OCI archive.
+func fetch(ctx context.Context, h clicallback.URIHandler, pullFrom, dgst, dest, tmpDir string) error {
+	pb := &progressBar{}
+	err := h.Fetch(ctx, pullFrom, dgst, dest, pb.update)
+	pb.finish(err)
+	if err != nil {
+		return err
+	}
+
+	img, err := image.Init(dest, false)
+	if err == nil {
+		defer img.File.Close()
+		if img.Type == image.SIF {
+			return nil
+		}
+	}
+
+	sylog.Debugf("Converting the OCI archive of %s to a SIF image", pullFrom)
+	noCache, err := cache.New(cache.Config{Disable: true})
+	if err != nil {
+		return err
+	}
+	sifPath := dest + ".sif"
+	defer os.Remove(sifPath)
+	if _, err := oci.PullToFile(ctx, noCache, sifPath, "oci-archive:"+dest, oci.PullOptions{TmpDir: tmpDir}); err != nil {
+		return fmt.Errorf("while converting %s to a SIF image: %v", pullFrom, err)
+	}
+	return os.Rename(sifPath, dest)
+}
+
+// pull will pull an image with the handler h into the cache if
+// directTo="", or a specific file if directTo is set.
+func pull(ctx context.Context, imgCache *cache.Handle, h clicallback.URIHandler, directTo, pullFrom, tmpDir string) (imagePath string, err error) {
+	// without network access the image can only be taken from the cache
+	if imgCache.IsOffline() {
+		return imgCache.OfflineEntry(cache.PluginCacheType, pullFrom)
+	}
+
+	// wait for the concurrent pulls of the same image and use their entry
+	if directTo == "" {
+		unlock, err := imgCache.LockPull(cache.PluginCacheType, pullFrom)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+	}
+
+	resolved, err := h.Resolve(ctx, pullFrom)
+	if err != nil {
+		return "", err
+	}
+	dgst, err := digest.Parse(resolved)
+	if err != nil {
+		return "", fmt.Errorf("invalid digest %q returned by the %s handler: %v", resolved, h.Scheme(), err)
+	}
+	sylog.Debugf("Image %s resolved to %s", pullFrom, dgst)
+
+	if directTo != "" {
+		sylog.Infof("Downloading %s image", h.Scheme())
+		if err := fetch(ctx, h, pullFrom, dgst.String(), directTo, tmpDir); err != nil {
+			return "", err
+		}
+		return directTo, nil
+	}
+
+	// the entries are named like those of the library cache
+	cacheEntry, err := imgCache.GetEntry(cache.PluginCacheType, dgst.Algorithm().String()+"."+dgst.Encoded())
+	if err != nil {
+		return "", fmt.Errorf("unable to check if %v exists in cache: %v", dgst, err)
+	}
+	defer cacheEntry.CleanTmp()
+
+	if !cacheEntry.Exists {
+		sylog.Infof("Downloading %s image", h.Scheme())
+		if err := fetch(ctx, h, pullFrom, dgst.String(), cacheEntry.TmpPath, tmpDir); err != nil {
+			return "", err
+		}
+
+		cacheEntry.Source = pullFrom
+		cacheEntry.Digest = dgst.String()
+		if err := cacheEntry.Finalize(); err != nil {
+			return "", err
+		}
+	} else {
+		sylog.Infof("Using cached SIF image")
+	}
+
+	return cacheEntry.Path, nil
+}
+
+// Pull will pull an image with the handler h to the cache or direct to a
+// temporary file if cache is disabled.
+func Pull(ctx context.Context, imgCache *cache.Handle, h clicallback.URIHandler, pullFrom, tmpDir string) (imagePath string, err error) {
+	directTo := ""
+
+	if imgCache.IsDisabled() {
+		file, err := os.CreateTemp(tmpDir, "sbuild-tmp-cache-")
+		if err != nil {
+			return "", fmt.Errorf("unable to create tmp file: %v", err)
+		}
+		file.Close()
+		directTo = file.Name()
+		sylog.Infof("Downloading %s image to tmp cache: %s", h.Scheme(), directTo)
+	}
+
+	return pull(ctx, imgCache, h, directTo, pullFrom, tmpDir)
+}
+
+// PullToFile will pull an image with the handler h to the specified
+// location, through the cache, or directly if cache is disabled.
+func PullToFile(ctx context.Context, imgCache *cache.Handle, h clicallback.URIHandler, pullTo, pullFrom, tmpDir string) (imagePath string, err error) {
+	directTo := ""
+	if imgCache.IsDisabled() {
+		directTo = pullTo
+		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
+	}
+
+	src, err := pull(ctx, imgCache, h, directTo, pullFrom, tmpDir)
+	if err != nil {
+		return "", err
+	}
+
+	if directTo == "" {
+		// mode is before umask if pullTo doesn't exist
+		err = fs.CopyFileAtomic(src, pullTo, 0o777)
+		if err != nil {
+			return "", fmt.Errorf("error copying image out of cache: %v", err)
+		}
+	}
+
+	return pullTo, nil
+}
+
+// Push uploads the SIF image src to ref with the handler h, if it
+// supports push.
+func Push(ctx context.Context, h clicallback.URIHandler, src, ref string) error {
+	pusher, ok := h.(clicallback.URIPusher)
+	if !ok {
+		return fmt.Errorf("push is not supported by the %s handler", h.Scheme())
+	}
+
+	pb := &progressBar{}
+	err := pusher.Push(ctx, src, ref, pb.update)
+	pb.finish(err)
+	return err
+}
@@ -0,0 +1,124 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fakeroot
+
+import (
+	"fmt"
+	"sort"
+)
+
+// idRange is an inclusive range of ids used by an entry.
+type idRange struct {
+	start uint64
+	end   uint64
+	entry *Entry
+}
+
+// idRanges is a list of ranges sorted by start, with the highest end
+// of the ranges up to each index, to find overlaps with a binary search.
+type idRanges struct {
+	ranges []idRange
+	maxEnd []uint64
+}
+
+// usedRanges returns the ranges of the valid entries.
+func (c *Config) usedRanges() *idRanges {
+	r := new(idRanges)
+	for _, e := range c.entries {
+		if e.invalid {
+			continue
+		}
+		r.ranges = append(r.ranges, idRange{
+			start: uint64(e.Start),
+			end:   uint64(e.Start) + uint64(e.Count) - 1,
+			entry: e,
+		})
+	}
+	sort.SliceStable(r.ranges, func(i, j int) bool {
+		return r.ranges[i].start < r.ranges[j].start
+	})
+	r.maxEnd = make([]uint64, len(r.ranges))
+	for i, ir := range r.ranges {
+		r.maxEnd[i] = ir.end
+		if i > 0 && r.maxEnd[i-1] > ir.end {
+			r.maxEnd[i] = r.maxEnd[i-1]
+		}
+	}
+	return r
+}
+
+// overlaps returns if an id between start and end is used by a range.
+func (r *idRanges) overlaps(start, end uint64) bool {
+	// ranges before i start at or before end
+	i := sort.Search(len(r.ranges), func(i int) bool {
+		return r.ranges[i].start > end
+	})
+	return i > 0 && r.maxEnd[i-1] >= start
+}
+
+// entryName returns the user and the line of an entry for messages.
+func entryName(e *Entry) string {
+	return fmt.Sprintf("line %d (%s)", e.lineNum, e.line)
+}
+
+// Audit checks the configuration file entries and returns the problems
+// found: invalid entries, entries of unknown users, users with several
+// entries, overlapping ranges and ranges including the ids found in
+// realIDs, mapping the ids of existing users or groups to their name.
+func (c *Config) Audit(realIDs map[uint32]string) []string {
+	var problems []string
+
+	byUID := make(map[uint32][]*Entry)
+	for _, e := range c.entries {
+		switch {
+		case e.invalid:
+			problems = append(problems, fmt.Sprintf("%s: invalid range", entryName(e)))
+		case e.UID == maxUID:
+			problems = append(problems, fmt.Sprintf("%s: unknown user", entryName(e)))
+		default:
+			byUID[e.UID] = append(byUID[e.UID], e)
+		}
+	}
+	for _, e := range c.entries {
+		entries := byUID[e.UID]
+		if len(entries) > 1 && entries[0] == e {
+			for _, dup := range entries[1:] {
+				problems = append(problems, fmt.Sprintf("%s: duplicate entry for the user of %s", entryName(dup), entryName(e)))
+			}
+		}
+	}
+
+	used := c.usedRanges()
+	for i := 1; i < len(used.ranges); i++ {
+		if used.ranges[i].start > used.maxEnd[i-1] {
+			continue
+		}
+		// report the overlap with the range ending last before
+		for j := i - 1; j >= 0; j-- {
+			if used.ranges[j].end == used.maxEnd[i-1] {
+				problems = append(problems, fmt.Sprintf("%s: range overlaps with %s", entryName(used.ranges[i].entry), entryName(used.ranges[j].entry)))
+				break
+			}
+		}
+	}
+
+	ids := make([]uint32, 0, len(realIDs))
+	for id := range realIDs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, r := range used.ranges {
+		i := sort.Search(len(ids), func(i int) bool { return uint64(ids[i]) >= r.start })
+		if i < len(ids) && uint64(ids[i]) <= r.end {
+			problems = append(problems, fmt.Sprintf("%s: range includes the id %d of %s", entryName(r.entry), ids[i], realIDs[ids[i]]))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,117 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fakeroot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSubIDFile(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "subid")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %s", file, err)
+	}
+	return file
+}
+
+func TestAudit(t *testing.T) {
+	file := writeSubIDFile(t, `user_1:100000:65536
+user_2:150000:65536
+user_1:300000:65536
+nouser_3:400000:65536
+user_4:-1:65536
+user_5:500000:65536
+`)
+
+	config, err := GetConfig(file, false, getUserFn)
+	if err != nil {
+		t.Fatalf("unexpected error while getting config %s: %s", file, err)
+	}
+	defer config.Close()
+
+	problems := config.Audit(map[uint32]string{500001: "user real", 1000: "user other"})
+
+	expected := []string{
+		"line 2 (user_2:150000:65536): range overlaps with line 1 (user_1:100000:65536)",
+		"line 3 (user_1:300000:65536): duplicate entry for the user of line 1 (user_1:100000:65536)",
+		"line 4 (nouser_3:400000:65536): unknown user",
+		"line 5 (user_4:-1:65536): invalid range",
+		"line 6 (user_5:500000:65536): range includes the id 500001 of user real",
+	}
+	for _, e := range expected {
+		found := false
+		for _, p := range problems {
+			if p == e {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("problem %q not reported", e)
+		}
+	}
+	if len(problems) != len(expected) {
+		t.Errorf("got %d problems instead of %d: %v", len(problems), len(expected), problems)
+	}
+}
+
+func TestAddUserOverlap(t *testing.T) {
+	// an entry starting after startMax overlaps the first candidate range
+	file := writeSubIDFile(t, fmt.Sprintf("user_1:%d:%d\n", startMax+1000, validRangeCount))
+
+	config, err := GetConfig(file, true, getUserFn)
+	if err != nil {
+		t.Fatalf("unexpected error while getting config %s: %s", file, err)
+	}
+
+	for i, username := range []string{"user_2", "user_3"} {
+		if err := config.AddUser(username); err != nil {
+			t.Fatalf("unexpected error while adding %s: %s", username, err)
+		}
+		e, err := config.GetUserEntry(username)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", username, err)
+		}
+		expected := startMax - uint32(i+1)*validRangeCount
+		if e.Start != expected {
+			t.Errorf("%s range start should be %d, got %d", username, expected, e.Start)
+		}
+	}
+
+	if err := config.DisableUser("user_1"); err != nil {
+		t.Fatalf("unexpected error while disabling user_1: %s", err)
+	}
+
+	diff := config.Diff()
+	for _, line := range []string{
+		fmt.Sprintf("-user_1:%d:%d", startMax+1000, validRangeCount),
+		fmt.Sprintf("+!user_1:%d:%d", startMax+1000, validRangeCount),
+		fmt.Sprintf("+2:%d:%d", startMax-validRangeCount, validRangeCount),
+		fmt.Sprintf("+3:%d:%d", startMax-2*validRangeCount, validRangeCount),
+	} {
+		if !strings.Contains(diff, line+"\n") {
+			t.Errorf("diff doesn't contain %q:\n%s", line, diff)
+		}
+	}
+
+	// discarded changes are not written
+	if err := config.Discard(); err != nil {
+		t.Fatalf("unexpected error while discarding changes: %s", err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", file, err)
+	}
+	if strings.Count(string(b), "\n") != 1 {
+		t.Errorf("discarded changes written to %s:\n%s", file, b)
+	}
+}
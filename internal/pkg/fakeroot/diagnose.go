@@ -0,0 +1,261 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// This file is for the selection of the --fakeroot mechanism, shared by
+//   the launcher, the build command and the fakeroot diagnostics
+
+package fakeroot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	osExec "os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+	"golang.org/x/sys/unix"
+)
+
+// Mechanisms used by --fakeroot, in order of preference.
+const (
+	// MechanismSubuid is a user namespace mapping the user to root and
+	// its /etc/subuid and /etc/subgid ranges to the other ids.
+	MechanismSubuid = "subuid user namespace"
+	// MechanismNested is a user namespace created by root inside a user
+	// namespace, mapping the ids available in it to themselves.
+	MechanismNested = "nested user namespace"
+	// MechanismRootMapped is an unprivileged user namespace mapping only
+	// the user to root, combined with the fakeroot command if found.
+	MechanismRootMapped = "root-mapped user namespace"
+	// MechanismFakerootCmd is the fakeroot command alone, which only
+	// works with sandbox images.
+	MechanismFakerootCmd = "fakeroot command"
+	// MechanismNone means that --fakeroot can't be used.
+	MechanismNone = "none"
+)
+
+// Check statuses of the fakeroot diagnostics.
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+	CheckInfo = "info"
+)
+
+// errIgnoredFakerootCmd is returned when looking for the fakeroot command
+// with --ignore-fakeroot-command.
+var errIgnoredFakerootCmd = errors.New("fakeroot command is ignored because of --ignore-fakeroot-command")
+
+// UseSubuid returns if --fakeroot uses a user namespace mapped with the
+// /etc/subuid and /etc/subgid ranges of uid, rather than a root-mapped
+// user namespace or the fakeroot command.
+func UseSubuid(uid uint32, ignoreSubuid bool) bool {
+	return uid == 0 || (IsUIDMapped(uid) && !ignoreSubuid)
+}
+
+// FindFakeCommand returns the path of the fakeroot command, unless it's
+// ignored with --ignore-fakeroot-command.
+func FindFakeCommand(ignore bool) (string, error) {
+	if ignore {
+		return "", errIgnoredFakerootCmd
+	}
+	return FindFake()
+}
+
+// CheckRootMapped checks that an unprivileged user namespace mapping
+// the user to root can be created, by running /bin/true in it.
+func CheckRootMapped() error {
+	cmd := osExec.Command("/bin/true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: syscall.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: syscall.Getgid(), Size: 1},
+		},
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("could not create a root-mapped user namespace: %w", err)
+	}
+	return nil
+}
+
+// Check is the result of a fakeroot diagnostics check.
+type Check struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Details string `json:"details"`
+}
+
+// Diagnosis reports the requirements of each --fakeroot mechanism and
+// the mechanism selected for the user.
+type Diagnosis struct {
+	UID       uint32  `json:"uid"`
+	Checks    []Check `json:"checks"`
+	Mechanism string  `json:"mechanism"`
+	// Reason explains why the mechanism is selected
+	Reason string `json:"reason"`
+	// Usable is false when --fakeroot would fail
+	Usable bool `json:"usable"`
+}
+
+func (d *Diagnosis) add(name, status, format string, a ...any) {
+	d.Checks = append(d.Checks, Check{Name: name, Status: status, Details: fmt.Sprintf(format, a...)})
+}
+
+// Diagnose checks the requirements of each --fakeroot mechanism for uid
+// and reports the one selected, following the same order as the
+// launcher and the build command. With suid, the user namespace is set up by the setuid
+// starter rather than by newuidmap and newgidmap.
+func Diagnose(uid uint32, suid bool) *Diagnosis {
+	d := &Diagnosis{UID: uid, Usable: true}
+
+	idmapOK := true
+	for _, name := range []string{"newuidmap", "newgidmap"} {
+		if err := checkIDMapBinary(name); err != nil {
+			d.add(name, CheckFail, "%s", err)
+			idmapOK = false
+		} else {
+			d.add(name, CheckPass, "found and privileged")
+		}
+	}
+
+	subidOK := true
+	for _, file := range []string{SubUIDFile, SubGIDFile} {
+		if uid == 0 {
+			d.add(file, CheckInfo, "not needed by root")
+			continue
+		}
+		r, err := GetIDRange(file, uid)
+		if err != nil {
+			d.add(file, CheckFail, "%s", err)
+			subidOK = false
+			continue
+		}
+		d.add(file, CheckPass, "range of %d ids starting at %d", r.Size, r.HostID)
+	}
+
+	checkUsernsSysctls(d)
+	nestedRoot := uid == 0 && IsNestedRoot()
+	nestedErr := errOnlyRootMapped
+	if nestedRoot {
+		nestedErr = CheckNested()
+		if nestedErr != nil {
+			d.add("nested user namespace", CheckFail, "%s", nestedErr)
+		} else {
+			r, _ := GetNestedIDRange(SubUIDFile, uid)
+			d.add("nested user namespace", CheckPass, "%d ids available in the current user namespace", r.Size+1)
+		}
+	}
+	rootMappedErr := CheckRootMapped()
+	if rootMappedErr != nil {
+		d.add("root-mapped user namespace", CheckFail, "%s", rootMappedErr)
+	} else {
+		d.add("root-mapped user namespace", CheckPass, "created successfully")
+	}
+
+	fakerootPath, fakerootErr := FindFake()
+	if fakerootErr != nil {
+		d.add("fakeroot command", CheckFail, "%s", fakerootErr)
+	} else {
+		d.add("fakeroot command", CheckPass, "found at %s", fakerootPath)
+	}
+
+	withFakeroot := ""
+	if fakerootErr == nil {
+		withFakeroot = ", combined with the fakeroot command"
+	}
+
+	switch {
+	case nestedRoot && nestedErr == nil:
+		d.Mechanism = MechanismNested
+		d.Reason = "running as root in a user namespace, newuidmap and newgidmap are not needed"
+	case nestedRoot:
+		d.Mechanism = MechanismRootMapped
+		d.Reason = "already running as root in a user namespace, reusing its mapping" + withFakeroot
+	case UseSubuid(uid, false):
+		d.Mechanism = MechanismSubuid
+		switch {
+		case uid == 0:
+			d.Reason = "running as root"
+		case !subidOK:
+			d.Reason = "user listed in " + SubUIDFile + ", but its subordinate id ranges are not usable"
+			d.Usable = false
+		case suid:
+			d.Reason = "user listed in " + SubUIDFile + ", namespace set up by the setuid starter"
+		case idmapOK:
+			d.Reason = "user listed in " + SubUIDFile + ", namespace set up by newuidmap and newgidmap"
+		default:
+			d.Reason = "user listed in " + SubUIDFile + ", but newuidmap and newgidmap are not usable"
+			d.Usable = false
+		}
+	case rootMappedErr == nil:
+		d.Mechanism = MechanismRootMapped
+		d.Reason = "user not listed in " + SubUIDFile + withFakeroot
+	case fakerootErr == nil:
+		d.Mechanism = MechanismFakerootCmd
+		d.Reason = "no user namespace available, only sandbox images can be used with exec"
+	default:
+		d.Mechanism = MechanismNone
+		d.Reason = "--fakeroot requires either being in " + SubUIDFile + ", unprivileged user namespaces, or the fakeroot command"
+		d.Usable = false
+	}
+	return d
+}
+
+// checkIDMapBinary checks that the newuidmap or newgidmap binary is
+// found and either setuid root or has file capabilities.
+func checkIDMapBinary(name string) error {
+	path, err := bin.FindBin(name)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	if fi.Mode()&os.ModeSetuid != 0 && st.Uid == 0 {
+		return nil
+	}
+	if _, err := unix.Getxattr(path, "security.capability", nil); err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s is neither setuid root nor has file capabilities", path)
+}
+
+// checkUsernsSysctls adds the checks of the kernel settings restricting
+// unprivileged user namespaces, when present.
+func checkUsernsSysctls(d *Diagnosis) {
+	sysctls := []struct {
+		path string
+		// ok returns if the value allows unprivileged user namespaces
+		ok func(string) bool
+	}{
+		{"/proc/sys/user/max_user_namespaces", func(v string) bool { return v != "0" }},
+		// Debian and derivatives
+		{"/proc/sys/kernel/unprivileged_userns_clone", func(v string) bool { return v != "0" }},
+		// Ubuntu 23.10 and later
+		{"/proc/sys/kernel/apparmor_restrict_unprivileged_userns", func(v string) bool { return v == "0" }},
+	}
+	for _, s := range sysctls {
+		b, err := os.ReadFile(s.path)
+		if err != nil {
+			continue
+		}
+		v := strings.TrimSpace(string(b))
+		name := strings.ReplaceAll(strings.TrimPrefix(s.path, "/proc/sys/"), "/", ".")
+		if s.ok(v) {
+			d.add(name, CheckPass, "set to %s", v)
+		} else {
+			d.add(name, CheckFail, "set to %s, unprivileged user namespaces are restricted", v)
+		}
+	}
+}
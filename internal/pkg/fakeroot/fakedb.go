@@ -0,0 +1,176 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// This file is for the database of the fakeroot command given with
+//   --fakeroot-db, keeping the ownership and permissions faked in a sandbox
+//   across runs.  The database is saved and loaded by faked itself (with
+//   its -s and -i options) and only changes what the processes running
+//   under the fakeroot command see: the files on disk stay owned by the
+//   user, anyone able to write the database file or the sandbox can change
+//   what it records, so it is a convenience and not a security mechanism.
+
+package fakeroot
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// FakeDB is the path in the container where the database file of the
+// fakeroot command is bound.
+const FakeDB = "/.singularity.d/libs/fakeroot.db"
+
+// fakeDBKey identifies a file in the database of faked.
+type fakeDBKey struct {
+	dev uint64
+	ino uint64
+}
+
+// GetFakeDBArgs returns the arguments of the fakeroot command loading
+// the database at start and saving it at exit.
+func GetFakeDBArgs() []string {
+	return []string{"-i", FakeDB, "-s", FakeDB}
+}
+
+// PrepareFakeDB creates the database file of the fakeroot command if it
+// doesn't exist, and prunes the malformed entries and the entries of the
+// files which no longer exist in the sandbox directory.
+func PrepareFakeDB(dbPath, sandbox string) error {
+	content, err := os.ReadFile(dbPath)
+	if os.IsNotExist(err) {
+		if err := os.WriteFile(dbPath, nil, 0o600); err != nil {
+			return fmt.Errorf("could not create fakeroot database %s: %s", dbPath, err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not read fakeroot database %s: %s", dbPath, err)
+	}
+	if len(content) == 0 {
+		return nil
+	}
+
+	files, complete, err := sandboxFiles(sandbox)
+	if err != nil {
+		return err
+	}
+	if !complete {
+		sylog.Debugf("Some files of %s could not be listed, keeping the fakeroot database entries of missing files", sandbox)
+	}
+
+	var pruned bytes.Buffer
+	removed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		key, err := parseFakeDBEntry(line)
+		if err != nil {
+			sylog.Debugf("Removing malformed entry %q from fakeroot database: %s", line, err)
+			removed++
+			continue
+		}
+		if _, ok := files[key]; !ok && complete {
+			sylog.Debugf("Removing entry %q of a missing file from fakeroot database", line)
+			removed++
+			continue
+		}
+		pruned.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read fakeroot database %s: %s", dbPath, err)
+	}
+	if removed == 0 {
+		return nil
+	}
+
+	sylog.Verbosef("Removed %d stale or malformed entries from fakeroot database %s", removed, dbPath)
+	if err := os.WriteFile(dbPath, pruned.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("could not write fakeroot database %s: %s", dbPath, err)
+	}
+	return nil
+}
+
+// parseFakeDBEntry returns the file identifier of a line saved by faked,
+// like "dev=fd01,ino=1234,mode=100644,uid=0,gid=0,nlink=1,rdev=0".
+func parseFakeDBEntry(line string) (fakeDBKey, error) {
+	var key fakeDBKey
+	fields := make(map[string]string)
+	for _, f := range strings.Split(line, ",") {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			return key, fmt.Errorf("field %q without value", f)
+		}
+		fields[k] = v
+	}
+
+	for _, f := range []struct {
+		name string
+		base int
+	}{
+		{"dev", 16},
+		{"ino", 10},
+		{"mode", 8},
+		{"uid", 10},
+		{"gid", 10},
+	} {
+		v, ok := fields[f.name]
+		if !ok {
+			return key, fmt.Errorf("missing %s field", f.name)
+		}
+		n, err := strconv.ParseUint(v, f.base, 64)
+		if err != nil {
+			return key, fmt.Errorf("invalid %s field: %s", f.name, err)
+		}
+		switch f.name {
+		case "dev":
+			key.dev = n
+		case "ino":
+			key.ino = n
+		}
+	}
+	return key, nil
+}
+
+// sandboxFiles returns the identifiers of the files in the sandbox
+// directory, as seen by faked through the bind mount of the sandbox, and
+// whether all of them could be listed.
+func sandboxFiles(sandbox string) (map[fakeDBKey]struct{}, bool, error) {
+	files := make(map[fakeDBKey]struct{})
+	complete := true
+	err := filepath.WalkDir(sandbox, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == sandbox {
+				return err
+			}
+			sylog.Debugf("While listing files for the fakeroot database: %s", err)
+			complete = false
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			complete = false
+			return nil
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			files[fakeDBKey{dev: st.Dev, ino: st.Ino}] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("could not list files of %s: %s", sandbox, err)
+	}
+	return files, complete, nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fakeroot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func fakeDBEntry(t *testing.T, path string) string {
+	var st syscall.Stat_t
+	if err := syscall.Lstat(path, &st); err != nil {
+		t.Fatalf("failed to stat %s: %s", path, err)
+	}
+	return fmt.Sprintf("dev=%x,ino=%d,mode=%o,uid=0,gid=0,nlink=1,rdev=0", st.Dev, st.Ino, st.Mode)
+}
+
+func TestPrepareFakeDB(t *testing.T) {
+	tmpDir := t.TempDir()
+	sandbox := filepath.Join(tmpDir, "sandbox")
+	db := filepath.Join(tmpDir, "fakeroot.db")
+
+	kept := filepath.Join(sandbox, "etc", "kept")
+	removed := filepath.Join(sandbox, "removed")
+	if err := os.MkdirAll(filepath.Dir(kept), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{kept, removed} {
+		if err := os.WriteFile(f, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a missing database is created empty
+	if err := PrepareFakeDB(db, sandbox); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b, err := os.ReadFile(db); err != nil || len(b) != 0 {
+		t.Fatalf("database not created empty: %q, %v", b, err)
+	}
+
+	keptEntry := fakeDBEntry(t, kept)
+	dirEntry := fakeDBEntry(t, filepath.Dir(kept))
+	content := keptEntry + "\n" +
+		fakeDBEntry(t, removed) + "\n" +
+		"dev=zz,ino=1,mode=100644,uid=0,gid=0,nlink=1,rdev=0\n" +
+		"garbage\n" +
+		dirEntry + "\n"
+	if err := os.WriteFile(db, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PrepareFakeDB(db, sandbox); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := os.ReadFile(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := keptEntry + "\n" + dirEntry + "\n"; string(b) != expected {
+		t.Errorf("unexpected database content %q, expected %q", b, expected)
+	}
+}
+
+func TestParseFakeDBEntry(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		expected    fakeDBKey
+		expectError bool
+	}{
+		{
+			name:     "valid",
+			line:     "dev=fd01,ino=1234,mode=100644,uid=0,gid=0,nlink=1,rdev=0",
+			expected: fakeDBKey{dev: 0xfd01, ino: 1234},
+		},
+		{
+			name:     "extra field",
+			line:     "dev=10,ino=2,mode=40755,uid=1,gid=1,nlink=2,rdev=0,size=0",
+			expected: fakeDBKey{dev: 0x10, ino: 2},
+		},
+		{
+			name:        "missing gid",
+			line:        "dev=10,ino=2,mode=40755,uid=1",
+			expectError: true,
+		},
+		{
+			name:        "invalid mode",
+			line:        "dev=10,ino=2,mode=9,uid=1,gid=1",
+			expectError: true,
+		},
+		{
+			name:        "empty",
+			line:        "",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseFakeDBEntry(tt.line)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("unexpected success for %q", tt.line)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if key != tt.expected {
+				t.Errorf("unexpected key %+v, expected %+v", key, tt.expected)
+			}
+		})
+	}
+}
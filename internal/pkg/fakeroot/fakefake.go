@@ -22,6 +22,7 @@ import (
 
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
 	"github.com/apptainer/apptainer/pkg/sylog"
 )
 
@@ -50,7 +51,7 @@ func UnshareRootMapped(args []string, includeMountNamespace bool) error {
 		if exiterr, ok := err.(*osExec.ExitError); ok {
 			// exit with the non-zero exit code
 			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				os.Exit(status.ExitStatus())
+				os.Exit(signalutil.ExitCode(status))
 			}
 		}
 		sylog.Fatalf("error waiting for root-mapped unprivileged command: %v", err)
@@ -14,7 +14,6 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -22,7 +21,6 @@ import (
 
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
 	"github.com/apptainer/apptainer/pkg/sylog"
-	"github.com/apptainer/apptainer/pkg/util/fs/lock"
 	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
@@ -50,6 +48,7 @@ const (
 // Entry represents an entry line of subuid/subgid configuration file.
 type Entry struct {
 	line     string
+	lineNum  int
 	UID      uint32
 	Start    uint32
 	Count    uint32
@@ -61,7 +60,9 @@ type Entry struct {
 // file and manages its configuration.
 type Config struct {
 	entries       []*Entry
+	lines         []string
 	file          *os.File
+	unlock        func() error
 	readOnly      bool
 	requireUpdate bool
 	getUserFn     func(string) (*user.User, error)
@@ -79,7 +80,8 @@ var (
 // GetConfig parses a subuid/subgid configuration file and returns
 // a Config holding all mapping entries, it allows to pass a custom
 // function getUserFn used to lookup in a custom user database, if
-// there is no custom function, the default one is used.
+// there is no custom function, the default one is used. When opened
+// for edition, the file is locked until Close or Discard is called.
 func GetConfig(filename string, edit bool, getUserFn GetUserFn) (*Config, error) {
 	var err error
 
@@ -105,20 +107,30 @@ func GetConfig(filename string, edit bool, getUserFn GetUserFn) (*Config, error)
 		return nil, fmt.Errorf("failed to open: %s: %s", filename, err)
 	}
 
+	if !config.readOnly {
+		config.unlock, err = lockFile(filename)
+		if err != nil {
+			config.file.Close()
+			return nil, err
+		}
+	}
+
 	config.entries = make([]*Entry, 0)
 
 	scanner := bufio.NewScanner(config.file)
 	for scanner.Scan() {
-		config.parseEntry(scanner.Text())
+		config.lines = append(config.lines, scanner.Text())
+		config.parseEntry(scanner.Text(), len(config.lines))
 	}
 
 	return config, nil
 }
 
 // parseEntry parses a line and adds an entry.
-func (c *Config) parseEntry(line string) {
+func (c *Config) parseEntry(line string, lineNum int) {
 	e := new(Entry)
 	e.line = line
+	e.lineNum = lineNum
 
 	fields := strings.Split(line, fieldSeparator)
 	// entry doesn't have the right number of fields,
@@ -173,37 +185,82 @@ func (c *Config) parseEntry(line string) {
 // Close closes the configuration file handle, if there is any pending
 // updates and the configuration was opened for writing, all entries
 // are written before into the configuration file before closing it.
+// The file is replaced atomically and its lock is released.
 func (c *Config) Close() error {
-	defer c.file.Close()
+	defer c.Discard()
 
 	if !c.requireUpdate || c.readOnly {
 		return nil
 	}
 
-	var buf bytes.Buffer
 	filename := c.file.Name()
+	if err := writeFileAtomic(filename, c.content()); err != nil {
+		return fmt.Errorf("error while writing configuration file %s: %s", filename, err)
+	}
+
+	return nil
+}
+
+// Name returns the path of the configuration file.
+func (c *Config) Name() string {
+	return c.file.Name()
+}
+
+// Discard closes the configuration file handle without writing pending
+// updates and releases the lock of the file opened for writing.
+func (c *Config) Discard() error {
+	c.file.Close()
+	if c.unlock != nil {
+		unlock := c.unlock
+		c.unlock = nil
+		return unlock()
+	}
+	return nil
+}
 
+// content returns the configuration file content with pending updates.
+func (c *Config) content() []byte {
+	var buf bytes.Buffer
 	for _, entry := range c.entries {
 		buf.WriteString(entry.line + "\n")
 	}
+	return buf.Bytes()
+}
 
-	fd, err := lock.Exclusive(filename)
-	if err != nil {
-		return fmt.Errorf("error while acquiring lock in %s: %s", filename, err)
+// Diff returns the lines removed from the configuration file prefixed
+// by '-' and the lines added prefixed by '+', or an empty string if
+// there is no pending update.
+func (c *Config) Diff() string {
+	if !c.requireUpdate {
+		return ""
 	}
-	defer lock.Release(fd)
 
-	if err := c.file.Truncate(0); err != nil {
-		return fmt.Errorf("error while truncating %s to 0: %s", filename, err)
-	}
-	if _, err := c.file.Seek(0, io.SeekStart); err != nil {
-		return fmt.Errorf("error while resetting file offset: %s", err)
+	count := make(map[string]int)
+	for _, line := range c.lines {
+		count[line]++
 	}
-	if _, err := c.file.Write(buf.Bytes()); err != nil {
-		return fmt.Errorf("error while writing configuration file %s: %s", filename, err)
+	var added []string
+	for _, e := range c.entries {
+		if count[e.line] > 0 {
+			count[e.line]--
+		} else {
+			added = append(added, e.line)
+		}
 	}
 
-	return nil
+	var buf bytes.Buffer
+	name := c.file.Name()
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", name, name)
+	for _, line := range c.lines {
+		if count[line] > 0 {
+			count[line]--
+			fmt.Fprintf(&buf, "-%s\n", line)
+		}
+	}
+	for _, line := range added {
+		fmt.Fprintf(&buf, "+%s\n", line)
+	}
+	return buf.String()
 }
 
 // AddUser adds a user mapping entry, it will automatically
@@ -219,21 +276,10 @@ func (c *Config) AddUser(username string) error {
 	if err != nil {
 		return fmt.Errorf("could not retrieve user information for %s: %s", username, err)
 	}
+	used := c.usedRanges()
 	for i := startMax; i >= startMin; i -= validRangeCount {
 		current := i
-		available := true
-		for _, entry := range c.entries {
-			if entry.invalid {
-				continue
-			}
-			start := entry.Start
-			end := entry.Start + entry.Count - 1
-			if current >= start && current <= end {
-				available = false
-				break
-			}
-		}
-		if available {
+		if !used.overlaps(uint64(current), uint64(current)+uint64(validRangeCount)-1) {
 			c.requireUpdate = true
 			line := fmt.Sprintf("%d:%d:%d", u.UID, current, validRangeCount)
 			c.entries = append(
@@ -0,0 +1,140 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// This file is for the locking and the atomic update of the subuid and
+//   subgid files, following the conventions of shadow-utils so that
+//   usermod, useradd and apptainer don't update them concurrently
+
+package fakeroot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// lockTries is the number of attempts to acquire a lock held by
+	// another process, like shadow-utils.
+	lockTries = 15
+	// lockDelay is the delay between two lock attempts.
+	lockDelay = time.Second
+)
+
+// lockFile acquires the lock of filename the way shadow-utils does: a
+// file containing the process ID is hard linked to filename.lock, a lock
+// left by a dead process is removed. It returns a function releasing the
+// lock.
+func lockFile(filename string) (func() error, error) {
+	lockName := filename + ".lock"
+	pidName := fmt.Sprintf("%s.%d", filename, os.Getpid())
+
+	if err := os.WriteFile(pidName, []byte(strconv.Itoa(os.Getpid())), 0o600); err != nil {
+		return nil, fmt.Errorf("could not create %s: %s", pidName, err)
+	}
+	defer os.Remove(pidName)
+
+	for i := 0; ; i++ {
+		err := os.Link(pidName, lockName)
+		if err == nil {
+			return func() error { return os.Remove(lockName) }, nil
+		} else if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("could not create %s: %s", lockName, err)
+		}
+
+		// remove a stale lock and retry immediately
+		pid, err := lockOwner(lockName)
+		if err != nil {
+			return nil, err
+		}
+		if syscall.Kill(pid, 0) == syscall.ESRCH {
+			if err := os.Remove(lockName); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("could not remove stale lock %s: %s", lockName, err)
+			}
+			continue
+		}
+
+		if i == lockTries-1 {
+			return nil, fmt.Errorf("%s is locked by process %d", filename, pid)
+		}
+		time.Sleep(lockDelay)
+	}
+}
+
+// lockOwner returns the process ID written in a lock file.
+func lockOwner(lockName string) (int, error) {
+	b, err := os.ReadFile(lockName)
+	if err != nil {
+		return 0, fmt.Errorf("could not read %s: %s", lockName, err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid process ID in lock file %s", lockName)
+	}
+	return pid, nil
+}
+
+// writeFileAtomic replaces filename with data, keeping its permissions
+// and ownership. The previous content is saved in filename- and the new
+// content is written to filename+ then renamed, like shadow-utils.
+func writeFileAtomic(filename string, data []byte) error {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+
+	old, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := writeFileSync(filename+"-", old, fi.Mode().Perm(), st); err != nil {
+		return err
+	}
+
+	newName := filename + "+"
+	if err := writeFileSync(newName, data, fi.Mode().Perm(), st); err != nil {
+		os.Remove(newName)
+		return err
+	}
+	if err := os.Rename(newName, filename); err != nil {
+		os.Remove(newName)
+		return fmt.Errorf("could not replace %s: %s", filename, err)
+	}
+	return nil
+}
+
+// writeFileSync writes data to filename, with the passed permissions and
+// the ownership of st, and syncs it to disk.
+func writeFileSync(filename string, data []byte, perm os.FileMode, st *syscall.Stat_t) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %s", filename, err)
+	}
+	defer f.Close()
+
+	if err := f.Chmod(perm); err != nil {
+		return fmt.Errorf("could not set permissions of %s: %s", filename, err)
+	}
+	if os.Geteuid() == 0 {
+		if err := f.Chown(int(st.Uid), int(st.Gid)); err != nil {
+			return fmt.Errorf("could not set ownership of %s: %s", filename, err)
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("could not write %s: %s", filename, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("could not sync %s: %s", filename, err)
+	}
+	return f.Close()
+}
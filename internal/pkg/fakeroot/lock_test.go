@@ -0,0 +1,74 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fakeroot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "subuid")
+	lockName := file + ".lock"
+
+	unlock, err := lockFile(file)
+	if err != nil {
+		t.Fatalf("unexpected error while locking %s: %s", file, err)
+	}
+	if pid, err := lockOwner(lockName); err != nil {
+		t.Errorf("unexpected error while reading lock: %s", err)
+	} else if pid != os.Getpid() {
+		t.Errorf("lock owned by %d instead of %d", pid, os.Getpid())
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unexpected error while unlocking %s: %s", file, err)
+	}
+	if _, err := os.Stat(lockName); !os.IsNotExist(err) {
+		t.Errorf("lock file %s not removed", lockName)
+	}
+
+	// a lock left by a dead process is removed
+	if err := os.WriteFile(lockName, []byte("2147483646"), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %s", lockName, err)
+	}
+	unlock, err = lockFile(file)
+	if err != nil {
+		t.Fatalf("unexpected error while locking %s with a stale lock: %s", file, err)
+	}
+	unlock()
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "subuid")
+	if err := os.WriteFile(file, []byte("old\n"), 0o640); err != nil {
+		t.Fatalf("failed to write %s: %s", file, err)
+	}
+
+	if err := writeFileAtomic(file, []byte("new\n")); err != nil {
+		t.Fatalf("unexpected error while writing %s: %s", file, err)
+	}
+
+	for name, content := range map[string]string{file: "new\n", file + "-": "old\n"} {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Errorf("failed to read %s: %s", name, err)
+		} else if string(b) != content {
+			t.Errorf("%s contains %q instead of %q", name, b, content)
+		}
+	}
+	if fi, err := os.Stat(file); err != nil {
+		t.Errorf("failed to stat %s: %s", file, err)
+	} else if fi.Mode().Perm() != 0o640 {
+		t.Errorf("%s has mode %o instead of 640", file, fi.Mode().Perm())
+	}
+	if _, err := os.Stat(file + "+"); !os.IsNotExist(err) {
+		t.Errorf("temporary file %s not removed", file+"+")
+	}
+}
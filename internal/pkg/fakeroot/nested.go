@@ -0,0 +1,147 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// This file is for nested fakeroot, that is, --fakeroot used by root
+//   inside a user namespace, like in another --fakeroot container
+
+package fakeroot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osExec "os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/pkg/util/namespaces"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// id mappings of the current user namespace, variables to allow testing
+var (
+	selfUIDMap = "/proc/self/uid_map"
+	selfGIDMap = "/proc/self/gid_map"
+)
+
+// errOnlyRootMapped is returned when the current user namespace maps no
+// other id than root, leaving nothing to map in a nested namespace.
+var errOnlyRootMapped = errors.New("only root is mapped in the current user namespace")
+
+// IsNestedRoot returns true when running as root inside a user namespace,
+// where newuidmap and newgidmap can't map the subordinate ids of a further
+// user namespace.
+func IsNestedRoot() bool {
+	if os.Getuid() != 0 {
+		return false
+	}
+	insideUserNs, _ := namespaces.IsInsideUserNamespace(os.Getpid())
+	return insideUserNs
+}
+
+// GetNestedIDRange returns the range of the ids other than root mapped in
+// the current user namespace, which a nested fakeroot user namespace maps
+// to themselves. It has the same signature as GetIDRange to be used in
+// its place, path selects the uid or gid mappings and uid is ignored.
+func GetNestedIDRange(path string, _ uint32) (*specs.LinuxIDMapping, error) {
+	mapFile := selfUIDMap
+	if path == SubGIDFile {
+		mapFile = selfGIDMap
+	}
+	f, err := os.Open(mapFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read id mappings: %w", err)
+	}
+	defer f.Close()
+	return parseNestedIDRange(f)
+}
+
+// parseNestedIDRange returns the range of the ids contiguously mapped
+// after root in a uid_map or gid_map file.
+func parseNestedIDRange(r io.Reader) (*specs.LinuxIDMapping, error) {
+	var mappings []specs.LinuxIDMapping
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed id mapping %q", scanner.Text())
+		}
+		var ids [3]uint32
+		for i, field := range fields {
+			id, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("malformed id mapping %q: %w", scanner.Text(), err)
+			}
+			ids[i] = uint32(id)
+		}
+		mappings = append(mappings, specs.LinuxIDMapping{ContainerID: ids[0], HostID: ids[1], Size: ids[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read id mappings: %w", err)
+	}
+
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].ContainerID < mappings[j].ContainerID
+	})
+	// end of the ids mapped contiguously from 0, the sum can't
+	// overflow as the kernel restricts mappings to 32 bits ids
+	var end uint64
+	for _, m := range mappings {
+		if uint64(m.ContainerID) > end {
+			break
+		}
+		if e := uint64(m.ContainerID) + uint64(m.Size); e > end {
+			end = e
+		}
+	}
+	if end <= 1 {
+		return nil, errOnlyRootMapped
+	}
+	return &specs.LinuxIDMapping{
+		ContainerID: 1,
+		HostID:      1,
+		Size:        uint32(end - 1),
+	}, nil
+}
+
+// CheckNested checks that a nested user namespace mapping root and the
+// ranges of ids returned by GetNestedIDRange can be created, by running
+// /bin/true in it.
+func CheckNested() error {
+	uidRange, err := GetNestedIDRange(SubUIDFile, 0)
+	if err != nil {
+		return err
+	}
+	gidRange, err := GetNestedIDRange(SubGIDFile, 0)
+	if err != nil {
+		return err
+	}
+
+	cmd := osExec.Command("/bin/true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: 0, Size: 1},
+			{ContainerID: int(uidRange.ContainerID), HostID: int(uidRange.HostID), Size: int(uidRange.Size)},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: 0, Size: 1},
+			{ContainerID: int(gidRange.ContainerID), HostID: int(gidRange.HostID), Size: int(gidRange.Size)},
+		},
+		GidMappingsEnableSetgroups: true,
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("could not create a nested user namespace: %w", err)
+	}
+	return nil
+}
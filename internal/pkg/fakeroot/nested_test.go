@@ -0,0 +1,91 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fakeroot
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestParseNestedIDRange(t *testing.T) {
+	tests := []struct {
+		name            string
+		idMap           string
+		expectedMapping *specs.LinuxIDMapping
+		expectedErr     error
+		expectError     bool
+	}{
+		{
+			name:  "fakeroot subuid mapping",
+			idMap: "         0       1000          1\n         1     100000      65536\n",
+			expectedMapping: &specs.LinuxIDMapping{
+				ContainerID: 1,
+				HostID:      1,
+				Size:        65536,
+			},
+		},
+		{
+			name:  "single range",
+			idMap: "0 100000 65536\n",
+			expectedMapping: &specs.LinuxIDMapping{
+				ContainerID: 1,
+				HostID:      1,
+				Size:        65535,
+			},
+		},
+		{
+			name:  "unordered ranges with a gap",
+			idMap: "1 100000 999\n0 1000 1\n2000 200000 10\n",
+			expectedMapping: &specs.LinuxIDMapping{
+				ContainerID: 1,
+				HostID:      1,
+				Size:        999,
+			},
+		},
+		{
+			name:        "root-mapped",
+			idMap:       "0 1000 1\n",
+			expectedErr: errOnlyRootMapped,
+		},
+		{
+			name:        "root not mapped",
+			idMap:       "1 100000 65536\n",
+			expectedErr: errOnlyRootMapped,
+		},
+		{
+			name:        "malformed",
+			idMap:       "0 1000\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := parseNestedIDRange(strings.NewReader(tt.idMap))
+			switch {
+			case tt.expectedErr != nil:
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("got error %v, want %v", err, tt.expectedErr)
+				}
+			case tt.expectError:
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			case !reflect.DeepEqual(m, tt.expectedMapping):
+				t.Errorf("got mapping %+v, want %+v", m, tt.expectedMapping)
+			}
+		})
+	}
+}
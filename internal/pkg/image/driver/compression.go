@@ -0,0 +1,210 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package driver
+
+import (
+	"bufio"
+	"compress/gzip"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// kernelSquashfsOptions maps squashfs compression algorithms to the
+// kernel configuration option enabling their support. gzip has no
+// option with older kernels and is always assumed to be supported,
+// the kernel has never supported the legacy lzma compression.
+var kernelSquashfsOptions = map[string]string{
+	"gzip": "",
+	"lzo":  "CONFIG_SQUASHFS_LZO",
+	"xz":   "CONFIG_SQUASHFS_XZ",
+	"lz4":  "CONFIG_SQUASHFS_LZ4",
+	"zstd": "CONFIG_SQUASHFS_ZSTD",
+}
+
+// squashfuseLibraries maps the compression libraries squashfuse can be
+// linked with to the squashfs compression algorithms they provide.
+var squashfuseLibraries = map[string][]string{
+	"libz.so":    {"gzip"},
+	"liblzma.so": {"lzma", "xz"},
+	"liblzo2.so": {"lzo"},
+	"liblz4.so":  {"lz4"},
+	"libzstd.so": {"zstd"},
+}
+
+// libraryDirs are the directories searched for the squashfuse shared
+// libraries when the binary isn't linked with the compression libraries
+// directly.
+var libraryDirs = []string{
+	"/lib64",
+	"/usr/lib64",
+	"/lib",
+	"/usr/lib",
+	"/lib/*-linux-gnu",
+	"/usr/lib/*-linux-gnu",
+}
+
+// squashfsCompression returns the compression algorithm used by the
+// squashfs filesystem located at offset in source.
+func squashfsCompression(source string, offset uint64) (string, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	b := make([]byte, 96)
+	n, err := f.ReadAt(b, int64(offset))
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return image.GetSquashfsComp(b[:n])
+}
+
+// kernelConfig returns the configuration of the running kernel, or
+// nil if it isn't available.
+func kernelConfig() map[string]string {
+	var r io.Reader
+
+	if f, err := os.Open("/proc/config.gz"); err == nil {
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		var uts unix.Utsname
+		if err := unix.Uname(&uts); err != nil {
+			return nil
+		}
+		f, err := os.Open("/boot/config-" + unix.ByteSliceToString(uts.Release[:]))
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		r = f
+	}
+	return parseKernelConfig(r)
+}
+
+// parseKernelConfig parses the enabled options of a kernel configuration.
+func parseKernelConfig(r io.Reader) map[string]string {
+	config := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			config[k] = v
+		}
+	}
+	return config
+}
+
+// CheckKernelSquashfs returns an error when the running kernel is known
+// to not support the compression of the squashfs filesystem located at
+// offset in source.
+func CheckKernelSquashfs(source string, offset uint64) error {
+	comp, err := squashfsCompression(source, offset)
+	if err != nil || comp == "" {
+		sylog.Debugf("Could not determine squashfs compression of %s: %v", source, err)
+		return nil
+	}
+	option, ok := kernelSquashfsOptions[comp]
+	if !ok {
+		return fmt.Errorf("the kernel doesn't support %s compressed squashfs images", comp)
+	} else if option == "" {
+		return nil
+	}
+	config := kernelConfig()
+	if config == nil {
+		sylog.Debugf("Kernel configuration not available, assuming %s squashfs compression is supported", comp)
+		return nil
+	}
+	if config[option] != "y" && config[option] != "m" {
+		return fmt.Errorf("the kernel doesn't support %s compressed squashfs images (%s is not set)", comp, option)
+	}
+	return nil
+}
+
+// elfCompressions returns the squashfs compression algorithms provided
+// by the libraries the ELF binary path is linked with, recursing once
+// into the squashfuse shared libraries.
+func elfCompressions(path string, recurse bool) map[string]bool {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		return nil
+	}
+
+	comps := make(map[string]bool)
+	for _, lib := range libs {
+		for name, algos := range squashfuseLibraries {
+			if lib != name && !strings.HasPrefix(lib, name+".") {
+				continue
+			}
+			for _, algo := range algos {
+				comps[algo] = true
+			}
+		}
+		if !recurse || !strings.HasPrefix(lib, "libsquashfuse") {
+			continue
+		}
+		dirs := append([]string{filepath.Join(filepath.Dir(path), "..", "lib")}, libraryDirs...)
+		for _, dir := range dirs {
+			matches, _ := filepath.Glob(filepath.Join(dir, lib))
+			if len(matches) == 0 {
+				continue
+			}
+			for algo := range elfCompressions(matches[0], false) {
+				comps[algo] = true
+			}
+			break
+		}
+	}
+	return comps
+}
+
+// checkSquashfs returns an error when the squashfuse binary is known to
+// not support the compression of the squashfs filesystem located at
+// offset in source.
+func (f *fuseappsFeature) checkSquashfs(source string, offset uint64) error {
+	comp, err := squashfsCompression(source, offset)
+	if err != nil || comp == "" {
+		sylog.Debugf("Could not determine squashfs compression of %s: %v", source, err)
+		return nil
+	}
+	comps := elfCompressions(f.cmdPath, true)
+	if !comps["gzip"] {
+		// zlib is always required by squashfuse, when it's not found
+		// the compression libraries are statically linked
+		sylog.Debugf("Could not determine compressions supported by %s", f.cmdPath)
+		return nil
+	}
+	if !comps[comp] {
+		return fmt.Errorf("%v doesn't support %s compressed squashfs images", f.binName, comp)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package driver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseKernelConfig(t *testing.T) {
+	config := parseKernelConfig(strings.NewReader(`
+#
+# Automatically generated file; DO NOT EDIT.
+#
+CONFIG_SQUASHFS=m
+CONFIG_SQUASHFS_XZ=y
+# CONFIG_SQUASHFS_LZO is not set
+CONFIG_SQUASHFS_ZSTD=y
+`))
+
+	tests := []struct {
+		option string
+		value  string
+	}{
+		{"CONFIG_SQUASHFS", "m"},
+		{"CONFIG_SQUASHFS_XZ", "y"},
+		{"CONFIG_SQUASHFS_LZO", ""},
+		{"CONFIG_SQUASHFS_ZSTD", "y"},
+		{"CONFIG_SQUASHFS_LZ4", ""},
+	}
+	for _, tt := range tests {
+		if v := config[tt.option]; v != tt.value {
+			t.Errorf("unexpected value for %s: got %q, want %q", tt.option, v, tt.value)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/pkg/image"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -39,16 +40,20 @@ type fuseappsInstance struct {
 type fuseappsFeature struct {
 	binName   string
 	cmdPath   string
+	disabled  bool
 	instances []fuseappsInstance
 }
 
 type fuseappsDriver struct {
-	squashFeature    fuseappsFeature
-	ext3Feature      fuseappsFeature
-	overlayFeature   fuseappsFeature
-	gocryptfsFeature fuseappsFeature
-	cmdPrefix        []string
-	squashSetUID     bool
+	squashFeature     fuseappsFeature
+	ext3Feature       fuseappsFeature
+	overlayFeature    fuseappsFeature
+	gocryptfsFeature  fuseappsFeature
+	cmdPrefix         []string
+	squashSetUID      bool
+	squashThreads     uint
+	squashMultiThread bool
+	mountDriver       string
 }
 
 func (f *fuseappsFeature) init(binNames string, purpose string, desired image.DriverFeature) {
@@ -84,12 +89,19 @@ func InitImageDrivers(register bool, unprivileged bool, fileconf *apptainerconf.
 		return nil
 	}
 
-	var squashFeature fuseappsFeature
-	var ext3Feature fuseappsFeature
+	// the image mount driver policy selects which FUSE programs
+	// may be used to mount image filesystems
+	mountDriver := fileconf.ImageMountDriver
+	squashFeature := fuseappsFeature{binName: "squashfuse", disabled: mountDriver == "kernel" || mountDriver == "fuse2fs"}
+	ext3Feature := fuseappsFeature{binName: "fuse2fs", disabled: mountDriver == "kernel" || mountDriver == "squashfuse"}
 	var overlayFeature fuseappsFeature
 	var gocryptfsFeature fuseappsFeature
-	squashFeature.init("squashfuse_ll|squashfuse", "mount SIF", desiredFeatures&image.ImageFeature)
-	ext3Feature.init("fuse2fs", "mount EXT3 filesystems", desiredFeatures&image.ImageFeature)
+	if !squashFeature.disabled {
+		squashFeature.init("squashfuse_ll|squashfuse", "mount SIF", desiredFeatures&image.ImageFeature)
+	}
+	if !ext3Feature.disabled {
+		ext3Feature.init("fuse2fs", "mount EXT3 filesystems", desiredFeatures&image.ImageFeature)
+	}
 	overlayFeature.init("fuse-overlayfs", "use overlay", desiredFeatures&image.OverlayFeature)
 	gocryptfsFeature.init("gocryptfs", "use gocryptfs", desiredFeatures&image.ImageFeature)
 
@@ -99,36 +111,60 @@ func InitImageDrivers(register bool, unprivileged bool, fileconf *apptainerconf.
 	// support them, but when it does they are in the help output so we
 	// scan for that.
 	// See https://github.com/apptainer/apptainer/issues/736
+	// The help output also tells if squashfuse was built with the
+	// multi-threaded FUSE loop.
 	squashSetUID := true
-	if squashFeature.binName == "squashfuse_ll" {
-		squashSetUID = false
+	squashMultiThread := false
+	if squashFeature.cmdPath != "" {
+		if squashFeature.binName == "squashfuse_ll" {
+			squashSetUID = false
+		}
 		cmd := exec.Command(squashFeature.cmdPath)
 		output, err := cmd.StdoutPipe()
 		if err != nil {
-			return fmt.Errorf("error making squashfuse_ll output pipe: %v", err)
+			return fmt.Errorf("error making %v output pipe: %v", squashFeature.binName, err)
 		}
 		cmd.Stderr = cmd.Stdout
 		err = cmd.Start()
 		if err != nil {
-			return fmt.Errorf("error starting squashfuse_ll: %v", err)
+			return fmt.Errorf("error starting %v: %v", squashFeature.binName, err)
 		}
 		scanner := bufio.NewScanner(output)
 		for scanner.Scan() {
 			line := scanner.Text()
-			if strings.Contains(line, "-o uid=") {
+			if strings.Contains(line, "-o uid=") && !squashSetUID {
 				squashSetUID = true
 				sylog.Debugf("squashfuse_ll supports -o uid")
-				break
+			}
+			if strings.Contains(line, "max_threads") && !squashMultiThread {
+				squashMultiThread = true
+				sylog.Debugf("%v supports -o max_threads", squashFeature.binName)
 			}
 		}
 		_ = cmd.Wait()
 	}
 
+	squashThreads := fileconf.SquashfuseThreads
+	if squashThreads > 1 && squashFeature.cmdPath != "" && !squashMultiThread {
+		sylog.Verbosef("%v doesn't support the multi-threaded mode, ignoring squashfuse threads", squashFeature.binName)
+		squashThreads = 0
+	}
+
 	if squashFeature.cmdPath != "" || ext3Feature.cmdPath != "" || overlayFeature.cmdPath != "" || gocryptfsFeature.cmdPath != "" {
 		sylog.Debugf("Setting ImageDriver to %v", DriverName)
 		fileconf.ImageDriver = DriverName
 		if register {
-			return image.RegisterDriver(DriverName, &fuseappsDriver{squashFeature, ext3Feature, overlayFeature, gocryptfsFeature, []string{}, squashSetUID})
+			return image.RegisterDriver(DriverName, &fuseappsDriver{
+				squashFeature:     squashFeature,
+				ext3Feature:       ext3Feature,
+				overlayFeature:    overlayFeature,
+				gocryptfsFeature:  gocryptfsFeature,
+				cmdPrefix:         []string{},
+				squashSetUID:      squashSetUID,
+				squashThreads:     squashThreads,
+				squashMultiThread: squashMultiThread,
+				mountDriver:       mountDriver,
+			})
 		}
 	}
 	return nil
@@ -165,26 +201,33 @@ func (d *fuseappsDriver) Mount(params *image.MountParams, mfunc image.MountFunc)
 
 	case "squashfs":
 		f = &d.squashFeature
-		optsStr := ""
+		// the mount source identifies the mount as ours when cleaning
+		// up after a crash
+		optsStr := "fsname=" + instance.FuseSource(os.Getpid())
 		if d.squashSetUID {
-			optsStr = fmt.Sprintf("uid=%v,gid=%v", os.Getuid(), os.Getgid())
+			optsStr += fmt.Sprintf(",uid=%v,gid=%v", os.Getuid(), os.Getgid())
 		}
 		if params.Offset > 0 {
-			if optsStr != "" {
-				optsStr += ","
+			optsStr += ",offset=" + strconv.FormatUint(params.Offset, 10)
+		}
+		if d.squashThreads > 1 {
+			optsStr += ",max_threads=" + strconv.FormatUint(uint64(d.squashThreads), 10)
+		}
+		if f.cmdPath != "" {
+			if err := f.checkSquashfs(params.Source, params.Offset); err != nil {
+				return err
 			}
-			optsStr += "offset=" + strconv.FormatUint(params.Offset, 10)
 		}
 		srcPath := params.Source
 		if path.Dir(params.Source) == "/proc/self/fd" {
 			// this will be passed as the first ExtraFile below, always fd 3
 			srcPath = "/proc/self/fd/3"
 		}
-		if optsStr != "" {
-			cmdArgs = append(cmdArgs, f.cmdPath, "-f", "-o", optsStr, srcPath, params.Target)
-		} else {
-			cmdArgs = append(cmdArgs, f.cmdPath, "-f", srcPath, params.Target)
+		cmdArgs = append(cmdArgs, f.cmdPath, "-f")
+		if d.squashThreads == 1 {
+			cmdArgs = append(cmdArgs, "-s")
 		}
+		cmdArgs = append(cmdArgs, "-o", optsStr, srcPath, params.Target)
 		cmd = exec.Command(cmdArgs[0], cmdArgs[1:]...)
 	case "gocryptfs":
 		f = &d.gocryptfsFeature
@@ -240,6 +283,9 @@ func (d *fuseappsDriver) Mount(params *image.MountParams, mfunc image.MountFunc)
 		return fmt.Errorf("filesystem type %v not recognized by image driver", params.Filesystem)
 	}
 
+	if f.disabled {
+		return fmt.Errorf("mounting %v images with %v is disabled by 'image mount driver = %v' in apptainer.conf", params.Filesystem, f.binName, d.mountDriver)
+	}
 	if f.cmdPath == "" {
 		return fmt.Errorf("%v not found", f.binName)
 	}
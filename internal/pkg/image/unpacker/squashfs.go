@@ -11,11 +11,18 @@
 package unpacker
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -28,8 +35,15 @@ const (
 
 	// exclude 'dev/' directory from extraction for non root users
 	excludeDevRegex = `^(.{0}[^d]|.{1}[^e]|.{2}[^v]|.{3}[^\x2f]).*$`
+
+	// size of the unsquashfs error output tail reported on failure
+	stderrTailSize = 4096
 )
 
+// progressInterval is the minimum interval between two extraction
+// progress messages.
+var progressInterval = 5 * time.Second
+
 var cmdFunc func(unsquashfs string, dest string, filename string, filter string, opts ...string) (*exec.Cmd, error)
 
 // unsquashfsCmd is the command instance for executing unsquashfs command
@@ -60,6 +74,114 @@ func unsquashfsCmd(unsquashfs string, dest string, filename string, filter strin
 // Squashfs represents a squashfs unpacker.
 type Squashfs struct {
 	UnsquashfsPath string
+	// TmpDir is the directory where the squashfs data is staged when
+	// it's not read from a file, the destination parent directory is
+	// used if empty.
+	TmpDir string
+	// processors is the number of processors used by unsquashfs,
+	// all the available processors are used if zero.
+	processors int
+}
+
+// unsquashfsFeatures are the optional features supported by an unsquashfs
+// binary.
+type unsquashfsFeatures struct {
+	// processors is set if the number of processors can be set with
+	// -processors.
+	processors bool
+	// percentage is set if the progress can be printed as percentages
+	// with -percentage.
+	percentage bool
+}
+
+var (
+	featuresMutex sync.Mutex
+	featuresCache = make(map[string]unsquashfsFeatures)
+)
+
+// getFeatures returns the features supported by the unsquashfs binary,
+// detected once from its help output.
+func getFeatures(unsquashfs string) unsquashfsFeatures {
+	featuresMutex.Lock()
+	defer featuresMutex.Unlock()
+
+	if f, ok := featuresCache[unsquashfs]; ok {
+		return f
+	}
+	// some versions exit with a non-zero status after displaying
+	// their help, so the error is ignored and only the output is parsed
+	out, _ := exec.Command(unsquashfs, "-help").CombinedOutput()
+	f := parseFeatures(out)
+	sylog.Debugf("unsquashfs %s features: processors=%t percentage=%t", unsquashfs, f.processors, f.percentage)
+	featuresCache[unsquashfs] = f
+	return f
+}
+
+// parseFeatures returns the features listed in the unsquashfs help output.
+func parseFeatures(help []byte) unsquashfsFeatures {
+	var f unsquashfsFeatures
+	for _, field := range bytes.Fields(help) {
+		switch string(field) {
+		case "-processors", "-p[rocessors]":
+			f.processors = true
+		case "-percentage":
+			f.percentage = true
+		}
+	}
+	return f
+}
+
+// tailBuffer keeps the last stderrTailSize bytes written to it.
+type tailBuffer struct {
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if n := len(b.buf) - stderrTailSize; n > 0 {
+		b.buf = append(b.buf[:0], b.buf[n:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// String returns the buffered output, starting at the first complete line
+// if the output was truncated.
+func (b *tailBuffer) String() string {
+	buf := b.buf
+	if b.truncated {
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			buf = buf[i+1:]
+		}
+	}
+	return string(bytes.TrimSpace(buf))
+}
+
+// reportProgress reads the unsquashfs output from r until EOF, reporting
+// the extraction percentages printed with -percentage at most every
+// progressInterval, and returns the other output.
+func reportProgress(r io.Reader) string {
+	var output strings.Builder
+
+	last := time.Now()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		percent, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil {
+			output.WriteString(line + "\n")
+			continue
+		}
+		if time.Since(last) >= progressInterval {
+			sylog.Infof("Extracted %d%% of the squashfs image", percent)
+			last = time.Now()
+		}
+	}
+	// drain the output if it's not made of lines
+	io.Copy(io.Discard, r)
+
+	return output.String()
 }
 
 // NewSquashfs initializes and returns a Squahfs unpacker instance
@@ -85,8 +207,11 @@ func (s *Squashfs) extract(files []string, reader io.Reader, dest string) (err e
 
 	if _, ok := reader.(*os.File); !ok {
 		// use the destination parent directory to store the
-		// temporary archive
-		tmpdir := filepath.Dir(dest)
+		// temporary archive if no temporary directory is set
+		tmpdir := s.TmpDir
+		if tmpdir == "" {
+			tmpdir = filepath.Dir(dest)
+		}
 
 		// unsquashfs doesn't support to send file content over
 		// a stdin pipe since it use lseek for every read it does
@@ -133,6 +258,18 @@ func (s *Squashfs) extract(files []string, reader io.Reader, dest string) (err e
 		opts = append(opts, "-no-xattrs")
 	}
 
+	features := getFeatures(s.UnsquashfsPath)
+	if features.processors {
+		processors := s.processors
+		if processors == 0 {
+			processors = runtime.NumCPU()
+		}
+		opts = append(opts, "-processors", strconv.Itoa(processors))
+	}
+	if features.percentage {
+		opts = append(opts, "-percentage")
+	}
+
 	// non real root users could not create pseudo devices so we compare
 	// the host UID (to include fake root user) and apply a filter at extraction (#5690)
 	filter := ""
@@ -168,14 +305,26 @@ func (s *Squashfs) extract(files []string, reader io.Reader, dest string) (err e
 		cmd.Stdin = reader
 	}
 
-	o, err := cmd.CombinedOutput()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("command error: %s", err)
+	}
+	stderr := new(tailBuffer)
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("extract command failed: %s", err)
+	}
+	o := reportProgress(stdout)
+	err = cmd.Wait()
 
 	sylog.Debugf("*** BEGIN WRAPPED UNSQUASHFS OUTPUT ***")
-	sylog.Debugf(string(o))
+	sylog.Debugf(o)
+	sylog.Debugf(stderr.String())
 	sylog.Debugf("*** END WRAPPED UNSQUASHFS OUTPUT ***")
 
 	if err != nil {
-		return fmt.Errorf("extract command failed: %s: %s", string(o), err)
+		return fmt.Errorf("extract command failed: %s: %s", stderr.String(), err)
 	}
 
 	return nil
@@ -12,10 +12,13 @@ package unpacker
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func createArchive(t *testing.T) *os.File {
@@ -121,6 +124,125 @@ func testSquashfs(t *testing.T, tmpParent string) {
 	}
 }
 
+func TestParseFeatures(t *testing.T) {
+	tests := []struct {
+		name     string
+		help     string
+		expected unsquashfsFeatures
+	}{
+		{
+			name: "unsquashfs 3.4",
+			help: `SYNTAX: unsquashfs [options] filesystem [directories or files to extract]
+	-v[ersion]		print version, licence and copyright information
+	-i[nfo]			print files as they are unsquashed
+	-n[o-progress]		don't display the progress bar`,
+		},
+		{
+			name: "unsquashfs 4.3",
+			help: `SYNTAX: unsquashfs [options] filesystem [directories or files to extract]
+	-v[ersion]		print version, licence and copyright information
+	-p[rocessors] <number>	use <number> processors.  By default will use
+				number of processors available
+	-n[o-progress]		don't display the progress bar`,
+			expected: unsquashfsFeatures{processors: true},
+		},
+		{
+			name: "unsquashfs 4.5",
+			help: `SYNTAX: unsquashfs [options] filesystem [files to extract or exclude (with -excludes) or cat (with -cat )]
+	-p[rocessors] <number>	use <number> processors.  By default will use
+				the number of processors available
+	-no-progress		don't display the progress bar
+	-percentage		display a percentage rather than the full
+				progress bar.  Can be used with dialog --gauge
+				etc.`,
+			expected: unsquashfsFeatures{processors: true, percentage: true},
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if f := parseFeatures([]byte(tt.help)); f != tt.expected {
+				t.Errorf("unexpected features: got %+v instead of %+v", f, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := new(tailBuffer)
+	fmt.Fprintf(b, "first error\n")
+	if s := b.String(); s != "first error" {
+		t.Errorf("unexpected output: %q", s)
+	}
+
+	for i := 0; b.String() == "" || !b.truncated; i++ {
+		fmt.Fprintf(b, "error line %d\n", i)
+	}
+	fmt.Fprintf(b, "last error\n")
+	s := b.String()
+	if len(s) > stderrTailSize {
+		t.Errorf("output not truncated: %d bytes", len(s))
+	}
+	if strings.Contains(s, "first error") || !strings.HasPrefix(s, "error line") {
+		t.Errorf("unexpected output start: %q", s[:20])
+	}
+	if !strings.HasSuffix(s, "last error") {
+		t.Errorf("unexpected output end: %q", s[len(s)-20:])
+	}
+}
+
+func TestReportProgress(t *testing.T) {
+	defer func(interval time.Duration) {
+		progressInterval = interval
+	}(progressInterval)
+	progressInterval = 0
+
+	out := reportProgress(strings.NewReader("Parallel unsquashfs: Using 4 processors\n0\n50\n100\ncreated 2 files\n"))
+	if out != "Parallel unsquashfs: Using 4 processors\ncreated 2 files\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+// BenchmarkExtractAll compares the extraction with one processor, as done
+// by default when unsquashfs doesn't see the available processors, with the
+// extraction with all the available processors.
+func BenchmarkExtractAll(b *testing.B) {
+	s := NewSquashfs()
+	if !s.HasUnsquashfs() {
+		b.Skip("unsquashfs not found")
+	}
+	mk, err := exec.LookPath("mksquashfs")
+	if err != nil {
+		b.Skip("mksquashfs not found")
+	}
+
+	// an archive of the apptainer sources, about 60MB
+	archive := filepath.Join(b.TempDir(), "archive.sqfs")
+	cmd := exec.Command(mk, "../../../../", archive, "-noappend", "-no-progress", "-e", ".git", "builddir")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		b.Fatalf("while creating archive: %s: %s", err, out)
+	}
+
+	for _, processors := range []int{1, 0} {
+		s.processors = processors
+		b.Run(fmt.Sprintf("processors=%d", processors), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				f, err := os.Open(archive)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := s.ExtractAll(f, filepath.Join(b.TempDir(), "rootfs")); err != nil {
+					b.Fatal(err)
+				}
+				f.Close()
+			}
+		})
+	}
+}
+
 func TestMain(m *testing.M) {
 	cmdFunc = unsquashfsCmd
 	os.Exit(m.Run())
@@ -0,0 +1,131 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
+)
+
+// allocationsFile is the file storing the network address allocations of
+// the instances of a user, in the directory of the instance files.
+const allocationsFile = "allocations.json"
+
+// Allocation is the network address allocated to a named instance on a
+// CNI network, reused when the instance is started again.
+type Allocation struct {
+	Network string `json:"network"`
+	IP      string `json:"ip"`
+	MAC     string `json:"mac,omitempty"`
+}
+
+// Allocations are the network address allocations of the instances of a
+// user, indexed by instance name.
+type Allocations map[string]*Allocation
+
+// allocationsPath returns the path of the allocations file of username,
+// or of the current user if empty.
+func allocationsPath(username string) (string, error) {
+	path, err := getPath(username, AppSubDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(path, allocationsFile), nil
+}
+
+// GetAllocations returns the network address allocations of the instances
+// of username, or of the current user if empty.
+func GetAllocations(username string) (Allocations, error) {
+	path, err := allocationsPath(username)
+	if err != nil {
+		return nil, err
+	}
+	return readAllocations(path)
+}
+
+// UpdateAllocations calls fn with the network address allocations of the
+// instances of username, or of the current user if empty, and stores them
+// once modified by fn, unless fn returns an error. The allocations file is
+// locked during the call, so that concurrent instance starts get a
+// consistent view.
+func UpdateAllocations(username string, fn func(Allocations) error) error {
+	path, err := allocationsPath(username)
+	if err != nil {
+		return err
+	}
+	return updateAllocations(path, fn)
+}
+
+// readAllocations reads the allocations file at path, a missing file
+// holding no allocation.
+func readAllocations(path string) (Allocations, error) {
+	allocs := make(Allocations)
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return allocs, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read network address allocations: %w", err)
+	}
+	if len(b) == 0 {
+		return allocs, nil
+	}
+	if err := json.Unmarshal(b, &allocs); err != nil {
+		return nil, fmt.Errorf("could not decode network address allocations %s: %w", path, err)
+	}
+	return allocs, nil
+}
+
+// updateAllocations implements UpdateAllocations for the allocations file
+// at path.
+func updateAllocations(path string, fn func(Allocations) error) error {
+	oldumask := syscall.Umask(0)
+	defer syscall.Umask(oldumask)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// the file is rewritten in place to keep the lock on the same inode
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|syscall.O_NOFOLLOW, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not open network address allocations: %w", err)
+	}
+	defer f.Close()
+
+	fd, err := lock.Exclusive(path)
+	if err != nil {
+		return fmt.Errorf("could not lock network address allocations: %w", err)
+	}
+	defer lock.Release(fd)
+
+	allocs, err := readAllocations(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(allocs); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(allocs)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(b, 0); err != nil {
+		return fmt.Errorf("could not write network address allocations: %w", err)
+	}
+	return f.Sync()
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestUpdateAllocations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app", allocationsFile)
+
+	// concurrent updates must not lose allocations
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- updateAllocations(path, func(allocs Allocations) error {
+				allocs[fmt.Sprintf("instance%d", i)] = &Allocation{Network: "bridge", IP: fmt.Sprintf("10.22.0.%d", i+2)}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	allocs, err := readAllocations(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(allocs) != n {
+		t.Fatalf("got %d allocations, want %d", len(allocs), n)
+	}
+	want := &Allocation{Network: "bridge", IP: "10.22.0.7"}
+	if got := allocs["instance5"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got allocation %+v, want %+v", got, want)
+	}
+
+	// allocations are not stored when the update fails
+	errConflict := errors.New("conflict")
+	err = updateAllocations(path, func(allocs Allocations) error {
+		delete(allocs, "instance5")
+		return errConflict
+	})
+	if !errors.Is(err, errConflict) {
+		t.Errorf("got error %v, want %v", err, errConflict)
+	}
+	allocs, err = readAllocations(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if allocs["instance5"] == nil {
+		t.Errorf("allocation removed by a failed update")
+	}
+
+	// a shorter content doesn't leave trailing data
+	err = updateAllocations(path, func(allocs Allocations) error {
+		for name := range allocs {
+			delete(allocs, name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if allocs, err := readAllocations(path); err != nil || len(allocs) != 0 {
+		t.Errorf("got allocations %v (%v), want none", allocs, err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redactedValue replaces the value of the environment variables which
+// may hold secrets.
+const redactedValue = "<redacted>"
+
+// secretEnvRegexp matches the names of the environment variables which
+// may hold secrets.
+var secretEnvRegexp = regexp.MustCompile(`(?i)(TOKEN|SECRET|PASSW(OR)?D|PASSPHRASE|CREDENTIAL|AUTH|PRIVATE|_KEY$|^KEY$)`)
+
+// Details represents the resolved launch configuration of an instance,
+// as applied by the engine once the configuration file directives and
+// the command line options are merged.
+type Details struct {
+	// Version is the version of apptainer which started the instance
+	Version     string   `json:"version"`
+	Binds       []string `json:"binds"`
+	Overlays    []string `json:"overlays"`
+	Env         []string `json:"env"`
+	Network     string   `json:"network,omitempty"`
+	NetworkArgs []string `json:"networkArgs,omitempty"`
+	Hostname    string   `json:"hostname,omitempty"`
+	Nv          bool     `json:"nv"`
+	NvCCLI      bool     `json:"nvccli"`
+	Rocm        bool     `json:"rocm"`
+	Fakeroot    bool     `json:"fakeroot"`
+	Contain     bool     `json:"contain"`
+	Writable    bool     `json:"writable"`
+	// Namespaces are the namespaces created for the instance
+	Namespaces []string `json:"namespaces"`
+	// CgroupPath is the path of the instance cgroup relative to the
+	// cgroup mount point, when started with resource limits, or of the
+	// job cgroup it runs in
+	CgroupPath string `json:"cgroupPath,omitempty"`
+	// Mounts is the mount table of the instance once started, nil if
+	// it couldn't be read
+	Mounts []Mount `json:"mounts"`
+	// ResolvConf holds the lines of the resolv.conf file of the instance,
+	// once merged with the DNS configuration of its networks
+	ResolvConf []string `json:"resolvConf,omitempty"`
+	// Bandwidth are the bandwidth limits of the instance on its networks
+	Bandwidth []Bandwidth `json:"bandwidth,omitempty"`
+}
+
+// Bandwidth represents the bandwidth limits of an instance on a network,
+// rates are in bits per second and bursts in bits.
+type Bandwidth struct {
+	Network      string `json:"network"`
+	IngressRate  uint64 `json:"ingressRate,omitempty"`
+	IngressBurst uint64 `json:"ingressBurst,omitempty"`
+	EgressRate   uint64 `json:"egressRate,omitempty"`
+	EgressBurst  uint64 `json:"egressBurst,omitempty"`
+}
+
+// Mount represents an entry of the mount table of an instance.
+type Mount struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Type        string `json:"type"`
+	Options     string `json:"options"`
+}
+
+// SanitizeEnv returns the sorted environment with the values of the
+// variables which may hold secrets redacted.
+func SanitizeEnv(env []string) []string {
+	sanitized := make([]string, 0, len(env))
+	for _, e := range env {
+		k, _, ok := strings.Cut(e, "=")
+		if ok && secretEnvRegexp.MatchString(k) {
+			e = k + "=" + redactedValue
+		}
+		sanitized = append(sanitized, e)
+	}
+	sort.Strings(sanitized)
+	return sanitized
+}
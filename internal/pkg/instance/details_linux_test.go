@@ -0,0 +1,42 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeEnv(t *testing.T) {
+	env := []string{
+		"PATH=/usr/bin:/bin",
+		"GITHUB_TOKEN=ghp_xxx",
+		"AWS_SECRET_ACCESS_KEY=abc",
+		"DB_PASSWORD=pass",
+		"SSH_AUTH_SOCK=/tmp/agent",
+		"API_KEY=123",
+		"KEYBOARD=us",
+		"LANG=C",
+		"EMPTY",
+	}
+	want := []string{
+		"API_KEY=<redacted>",
+		"AWS_SECRET_ACCESS_KEY=<redacted>",
+		"DB_PASSWORD=<redacted>",
+		"EMPTY",
+		"GITHUB_TOKEN=<redacted>",
+		"KEYBOARD=us",
+		"LANG=C",
+		"PATH=/usr/bin:/bin",
+		"SSH_AUTH_SOCK=<redacted>",
+	}
+	if got := SanitizeEnv(env); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
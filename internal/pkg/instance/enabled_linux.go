@@ -0,0 +1,121 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+)
+
+// EnabledDir is the root managed registry of the instances started at
+// boot, with one sub-directory per user.
+var EnabledDir = filepath.Join(buildcfg.LOCALSTATEDIR, "apptainer", "instances-enabled")
+
+// Enabled represents the registry file of an instance enabled to be
+// started at boot.
+type Enabled struct {
+	Path  string `json:"-"`
+	Name  string `json:"name"`
+	User  string `json:"user"`
+	Image string `json:"image"`
+	// Launch is the launch configuration the instance is started with
+	Launch *Launch `json:"launch"`
+}
+
+// NewEnabled returns the registry file of a named instance of username.
+func NewEnabled(name, username, image string, launch *Launch) (*Enabled, error) {
+	if err := CheckName(name); err != nil {
+		return nil, err
+	}
+	if username == "" {
+		return nil, fmt.Errorf("empty username")
+	}
+	return &Enabled{
+		Path:   filepath.Join(EnabledDir, username, name+".json"),
+		Name:   name,
+		User:   username,
+		Image:  image,
+		Launch: launch,
+	}, nil
+}
+
+// ListEnabled returns the registry files of the enabled instances
+// matching username and name patterns, sorted by user and name.
+func ListEnabled(username, name string) ([]*Enabled, error) {
+	pattern := filepath.Join(EnabledDir, username, name+".json")
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	list := make([]*Enabled, 0, len(files))
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		e := &Enabled{}
+		if err := json.Unmarshal(b, e); err != nil {
+			return nil, fmt.Errorf("while decoding %s: %w", file, err)
+		}
+		e.Path = file
+		list = append(list, e)
+	}
+	return list, nil
+}
+
+// Update atomically stores the registry file, which is only readable by
+// root as the launch environment may contain secrets.
+func (e *Enabled) Update() error {
+	b, err := json.MarshalIndent(e, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	oldumask := syscall.Umask(0o077)
+	defer syscall.Umask(oldumask)
+
+	dir := filepath.Dir(e.Path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+e.Name+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %s", e.Path, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), e.Path)
+}
+
+// Delete deletes the registry file.
+func (e *Enabled) Delete() error {
+	if err := os.Remove(e.Path); err != nil {
+		return err
+	}
+	// remove the user directory once empty
+	os.Remove(filepath.Dir(e.Path))
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnabled(t *testing.T) {
+	oldDir := EnabledDir
+	EnabledDir = t.TempDir()
+	defer func() { EnabledDir = oldDir }()
+
+	launch := &Launch{
+		Args: []string{"/usr/bin/apptainer", "instance", "start", "/tmp/test.sif", "web"},
+		Env:  []string{"HOME=/home/alice"},
+		Dir:  "/home/alice",
+	}
+	entries := []struct {
+		name string
+		user string
+	}{
+		{"web", "alice"},
+		{"db", "alice"},
+		{"web", "bob"},
+	}
+	for _, en := range entries {
+		e, err := NewEnabled(en.name, en.user, "/tmp/test.sif", launch)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := e.Update(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		fi, err := os.Stat(e.Path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if fi.Mode().Perm() != 0o600 {
+			t.Errorf("got mode %o for %s, want 600", fi.Mode().Perm(), e.Path)
+		}
+	}
+
+	if _, err := NewEnabled("bad/name", "alice", "", launch); err == nil {
+		t.Errorf("unexpected success with an invalid name")
+	}
+
+	all, err := ListEnabled("*", "*")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var got []string
+	for _, e := range all {
+		got = append(got, e.User+"/"+e.Name)
+	}
+	want := []string{"alice/db", "alice/web", "bob/web"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got enabled instances %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(all[0].Launch, launch) {
+		t.Errorf("got launch %+v, want %+v", all[0].Launch, launch)
+	}
+
+	bob, err := ListEnabled("bob", "*")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(bob) != 1 {
+		t.Fatalf("got %d enabled instances for bob, want 1", len(bob))
+	}
+	if err := bob[0].Delete(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(EnabledDir, "bob")); !os.IsNotExist(err) {
+		t.Errorf("empty user directory not removed")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// HealthStarting is the health status of an instance until its
+	// health check succeeds or fails after the start period.
+	HealthStarting = "starting"
+	// HealthHealthy is the health status of an instance whose last
+	// health check succeeded.
+	HealthHealthy = "healthy"
+	// HealthUnhealthy is the health status of an instance whose health
+	// check failed Retries consecutive times.
+	HealthUnhealthy = "unhealthy"
+
+	// UnhealthyNone only records the unhealthy status of an instance.
+	UnhealthyNone = "none"
+	// UnhealthyRestart restarts an unhealthy instance.
+	UnhealthyRestart = "restart"
+	// UnhealthyStop stops an unhealthy instance.
+	UnhealthyStop = "stop"
+
+	// maxHealthOutput is the maximum size of the health check output
+	// recorded in the instance file.
+	maxHealthOutput = 4096
+)
+
+// HealthCheck is the health check configuration of an instance.
+type HealthCheck struct {
+	// Cmd is the shell command executed in the instance, a zero exit
+	// status means the instance is healthy.
+	Cmd string `json:"cmd"`
+	// Interval is the time between two health checks.
+	Interval time.Duration `json:"interval"`
+	// Timeout is the time after which a health check is killed and
+	// considered failed.
+	Timeout time.Duration `json:"timeout"`
+	// Retries is the number of consecutive failures after which the
+	// instance is unhealthy.
+	Retries int `json:"retries"`
+	// StartPeriod is the time after the instance start during which
+	// failures are not counted.
+	StartPeriod time.Duration `json:"startPeriod"`
+	// OnUnhealthy is the action taken when the instance becomes
+	// unhealthy, one of none, restart or stop.
+	OnUnhealthy string `json:"onUnhealthy"`
+}
+
+// Validate checks the health check configuration.
+func (hc *HealthCheck) Validate() error {
+	switch {
+	case strings.TrimSpace(hc.Cmd) == "":
+		return fmt.Errorf("empty health check command")
+	case hc.Interval <= 0:
+		return fmt.Errorf("health check interval must be positive")
+	case hc.Timeout <= 0:
+		return fmt.Errorf("health check timeout must be positive")
+	case hc.Retries < 1:
+		return fmt.Errorf("health check retries must be at least 1")
+	case hc.StartPeriod < 0:
+		return fmt.Errorf("health check start period can't be negative")
+	}
+	switch hc.OnUnhealthy {
+	case UnhealthyNone, UnhealthyRestart, UnhealthyStop:
+	default:
+		return fmt.Errorf("invalid unhealthy action %q, must be one of none, restart or stop", hc.OnUnhealthy)
+	}
+	return nil
+}
+
+// Health is the current health status of an instance.
+type Health struct {
+	// Status is one of starting, healthy or unhealthy.
+	Status string `json:"status"`
+	// FailingStreak is the number of consecutive failed health checks.
+	FailingStreak int `json:"failingStreak"`
+	// LastOutput is the output of the last health check, truncated.
+	LastOutput string `json:"lastOutput"`
+	// LastCheck is the time of the last health check.
+	LastCheck time.Time `json:"lastCheck"`
+}
+
+// NewHealth returns the health status of a started instance.
+func NewHealth() *Health {
+	return &Health{Status: HealthStarting}
+}
+
+// Record updates the health status with the result of a health check
+// run at t, running is the time elapsed since the instance started.
+// It returns true when the instance just became unhealthy.
+func (h *Health) Record(hc *HealthCheck, ok bool, output string, t time.Time, running time.Duration) bool {
+	if len(output) > maxHealthOutput {
+		output = output[:maxHealthOutput]
+	}
+	h.LastOutput = output
+	h.LastCheck = t
+
+	if ok {
+		h.Status = HealthHealthy
+		h.FailingStreak = 0
+		return false
+	}
+	// failures during the start period don't count
+	if h.Status == HealthStarting && running < hc.StartPeriod {
+		return false
+	}
+
+	h.FailingStreak++
+	if h.FailingStreak >= hc.Retries && h.Status != HealthUnhealthy {
+		h.Status = HealthUnhealthy
+		return true
+	}
+	return false
+}
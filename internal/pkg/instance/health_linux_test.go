@@ -0,0 +1,120 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckValidate(t *testing.T) {
+	valid := HealthCheck{
+		Cmd:         "true",
+		Interval:    time.Second,
+		Timeout:     time.Second,
+		Retries:     3,
+		OnUnhealthy: UnhealthyNone,
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(hc *HealthCheck)
+		expectError bool
+	}{
+		{name: "Valid", modify: func(hc *HealthCheck) {}},
+		{name: "Restart", modify: func(hc *HealthCheck) { hc.OnUnhealthy = UnhealthyRestart }},
+		{name: "EmptyCmd", modify: func(hc *HealthCheck) { hc.Cmd = " " }, expectError: true},
+		{name: "NoInterval", modify: func(hc *HealthCheck) { hc.Interval = 0 }, expectError: true},
+		{name: "NoTimeout", modify: func(hc *HealthCheck) { hc.Timeout = 0 }, expectError: true},
+		{name: "NoRetries", modify: func(hc *HealthCheck) { hc.Retries = 0 }, expectError: true},
+		{name: "NegativeStartPeriod", modify: func(hc *HealthCheck) { hc.StartPeriod = -time.Second }, expectError: true},
+		{name: "InvalidAction", modify: func(hc *HealthCheck) { hc.OnUnhealthy = "kill" }, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := valid
+			tt.modify(&hc)
+			err := hc.Validate()
+			if tt.expectError && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestHealthRecord(t *testing.T) {
+	hc := &HealthCheck{Retries: 2, StartPeriod: 10 * time.Second}
+
+	type check struct {
+		ok        bool
+		running   time.Duration
+		status    string
+		streak    int
+		unhealthy bool
+	}
+
+	tests := []struct {
+		name   string
+		checks []check
+	}{
+		{
+			name: "StartPeriodFailures",
+			checks: []check{
+				{ok: false, running: time.Second, status: HealthStarting},
+				{ok: false, running: 5 * time.Second, status: HealthStarting},
+				{ok: true, running: 8 * time.Second, status: HealthHealthy},
+			},
+		},
+		{
+			name: "FailuresAfterStartPeriod",
+			checks: []check{
+				{ok: false, running: 11 * time.Second, status: HealthStarting, streak: 1},
+				{ok: false, running: 12 * time.Second, status: HealthUnhealthy, streak: 2, unhealthy: true},
+				{ok: false, running: 13 * time.Second, status: HealthUnhealthy, streak: 3},
+				{ok: true, running: 14 * time.Second, status: HealthHealthy},
+			},
+		},
+		{
+			name: "HealthyThenFailures",
+			checks: []check{
+				{ok: true, running: time.Second, status: HealthHealthy},
+				// the start period only applies before the first success
+				{ok: false, running: 2 * time.Second, status: HealthHealthy, streak: 1},
+				{ok: false, running: 3 * time.Second, status: HealthUnhealthy, streak: 2, unhealthy: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealth()
+			for n, c := range tt.checks {
+				unhealthy := h.Record(hc, c.ok, "output", time.Now(), c.running)
+				if unhealthy != c.unhealthy {
+					t.Errorf("check %d: got unhealthy transition %v, want %v", n, unhealthy, c.unhealthy)
+				}
+				if h.Status != c.status || h.FailingStreak != c.streak {
+					t.Errorf("check %d: got %s/%d, want %s/%d", n, h.Status, h.FailingStreak, c.status, c.streak)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthRecordOutput(t *testing.T) {
+	h := NewHealth()
+	h.Record(&HealthCheck{Retries: 1}, true, strings.Repeat("x", 2*maxHealthOutput), time.Now(), 0)
+	if len(h.LastOutput) != maxHealthOutput {
+		t.Errorf("got output of %d bytes, want %d", len(h.LastOutput), maxHealthOutput)
+	}
+}
@@ -11,6 +11,7 @@ package instance
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -55,6 +56,49 @@ type File struct {
 	LogErrPath string `json:"logErrPath"`
 	LogOutPath string `json:"logOutPath"`
 	Checkpoint string `json:"checkpoint"`
+	Script     string `json:"script,omitempty"`
+	// IPv6 is the IPv6 address of the instance, along with the IPv4
+	// one in IP on a dual-stack network
+	IPv6 string `json:"ipv6,omitempty"`
+	// Ports are the container ports published on the host, as
+	// hostPort:containerPort/protocol
+	Ports []string `json:"ports,omitempty"`
+	// Launch is the original launch configuration of the instance
+	Launch *Launch `json:"launch,omitempty"`
+	// Restart is the restart policy of the instance
+	Restart string `json:"restart,omitempty"`
+	// Restarts is the number of times the instance was restarted by
+	// its supervisor
+	Restarts int `json:"restarts,omitempty"`
+	// LastExitStatus is the exit status of the instance before its
+	// last restart
+	LastExitStatus *int `json:"lastExitStatus,omitempty"`
+	// HealthCheck is the health check configuration of the instance
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+	// Health is the current health status of the instance
+	Health *Health `json:"health,omitempty"`
+	// SocketsDir is the host directory shared with the containers
+	// started with --join-sockets
+	SocketsDir string `json:"socketsDir,omitempty"`
+	// SocketsMount is the container directory where SocketsDir is bound
+	SocketsMount string `json:"socketsMount,omitempty"`
+	// Details is the resolved launch configuration of the instance,
+	// missing for instances started by older versions
+	Details *Details `json:"details,omitempty"`
+	// BootID is the boot ID of the kernel the instance was started on
+	BootID string `json:"bootID,omitempty"`
+	// Networks are the CNI networks of the instance
+	Networks *Networks `json:"networks,omitempty"`
+	// JobCgroup is set when the instance was started in a job cgroup
+	// with --cgroups join-job, its cgroup being beneath the job cgroup
+	// with Cgroup, or the job cgroup itself otherwise
+	JobCgroup bool `json:"jobCgroup,omitempty"`
+}
+
+// Supervised returns if the instance has a supervisor process applying
+// its restart policy or running its health check.
+func (i *File) Supervised() bool {
+	return (i.Restart != "" && i.Restart != RestartNo) || i.HealthCheck != nil
 }
 
 // ProcName returns process name based on instance name
@@ -149,51 +193,64 @@ func Add(name string, subDir string) (*File, error) {
 	if err == nil {
 		return nil, fmt.Errorf("instance %s already exists", name)
 	}
-	i := &File{Name: name}
+	i := &File{Name: name, BootID: BootID()}
 	i.Path, err = getPath("", subDir)
 	if err != nil {
 		return nil, err
 	}
 	jsonFile := name + ".json"
 	i.Path = filepath.Join(i.Path, name, jsonFile)
+	// the exit status of a previous instance with this name is stale
+	if path, err := exitPath(name, subDir); err == nil {
+		os.Remove(path)
+	}
 	return i, nil
 }
 
 // List returns instance files matching username and/or name pattern
 func List(username string, name string, subDir string) ([]*File, error) {
+	list, _, err := listFiles(username, name, subDir)
+	return list, err
+}
+
+// listFiles returns instance files matching username and/or name pattern,
+// along with the files of exited instances.
+func listFiles(username string, name string, subDir string) ([]*File, []*File, error) {
 	list := make([]*File, 0)
+	ghosts := make([]*File, 0)
 
 	path, err := getPath(username, subDir)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	pattern := filepath.Join(path, name, name+".json")
 	files, err := filepath.Glob(pattern)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	for _, file := range files {
 		r, err := os.Open(file)
 		if os.IsNotExist(err) {
 			continue
 		} else if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		f := &File{}
 		if err := json.NewDecoder(r).Decode(f); err != nil {
 			r.Close()
-			return nil, err
+			return nil, nil, err
 		}
 		r.Close()
 		f.Path = file
-		// delete ghost apptainer instance files
+		// ghost apptainer instance files are left for the cleanup
+		// of the instance resources
 		if subDir == AppSubDir && f.isExited() {
-			f.Delete()
+			ghosts = append(ghosts, f)
 			continue
 		}
 		list = append(list, f)
 	}
-	return list, nil
+	return list, ghosts, nil
 }
 
 // Delete deletes instance file
@@ -202,13 +259,26 @@ func (i *File) Delete() error {
 	if dir == "." {
 		dir = ""
 	}
+	if i.SocketsDir != "" {
+		socketsDir, err := i.ownedSocketsDir()
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			sylog.Warningf("Not removing the sockets directory of instance %s: %s", i.Name, err)
+		default:
+			sylog.Debugf("Deleting %v", socketsDir)
+			if err := os.RemoveAll(socketsDir); err != nil {
+				sylog.Warningf("Could not remove sockets directory %s: %s", socketsDir, err)
+			}
+		}
+	}
 	sylog.Debugf("Deleting %v", dir)
 	return os.RemoveAll(dir)
 }
 
 // isExited returns if the instance process is exited or not.
 func (i *File) isExited() bool {
-	if i.PPid <= 0 {
+	if i.PPid <= 0 || i.Rebooted() {
 		return true
 	}
 
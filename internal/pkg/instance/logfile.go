@@ -0,0 +1,268 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// RotatedLogPath returns the path of the nth rotated file of the log
+// file path, the most recent rotated file being the first one.
+func RotatedLogPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// RotateLog rotates the log file path when its size reaches maxSize. The
+// content is copied to path.1 before truncating the file, so processes
+// writing to the log file in append mode keep a valid file descriptor.
+// Older rotated files are shifted to path.2 up to path.<maxFiles>, the
+// rotated files beyond maxFiles are deleted. It returns if the log file
+// was rotated.
+func RotateLog(path string, maxSize int64, maxFiles int) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if maxSize <= 0 || fi.Size() < maxSize {
+		return false, nil
+	}
+
+	if err := pruneRotatedLogs(path, maxFiles); err != nil {
+		return false, err
+	}
+
+	if maxFiles > 0 {
+		for n := maxFiles - 1; n > 0; n-- {
+			err := os.Rename(RotatedLogPath(path, n), RotatedLogPath(path, n+1))
+			if err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+		}
+		if err := copyLog(path, RotatedLogPath(path, 1)); err != nil {
+			return false, err
+		}
+	}
+
+	return true, os.Truncate(path, 0)
+}
+
+// pruneRotatedLogs deletes the rotated files of the log file path which
+// would be beyond maxFiles after a rotation.
+func pruneRotatedLogs(path string, maxFiles int) error {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(m, path+"."))
+		if err != nil || n < maxFiles {
+			continue
+		}
+		if err := os.Remove(m); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyLog copies the log file src to dst.
+func copyLog(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// RotateLogs checks every interval if the log files need to be rotated
+// with RotateLog. The returned function stops the rotation.
+func RotateLogs(paths []string, maxSize int64, maxFiles int, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, path := range paths {
+					rotated, err := RotateLog(path, maxSize, maxFiles)
+					if err != nil && !os.IsNotExist(err) {
+						sylog.Warningf("Could not rotate log file %s: %s", path, err)
+					} else if rotated {
+						sylog.Debugf("Log file %s rotated", path)
+					}
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
+
+// tailOffset returns the offset of the last n lines of the file f,
+// or 0 if n is negative.
+func tailOffset(f *os.File, n int) (int64, error) {
+	if n < 0 {
+		return 0, nil
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := fi.Size()
+	if n == 0 {
+		return size, nil
+	}
+
+	const chunkSize = 4096
+	buf := make([]byte, chunkSize)
+	lines := 0
+
+	for offset := size; offset > 0; {
+		chunk := int64(chunkSize)
+		if offset < chunk {
+			chunk = offset
+		}
+		offset -= chunk
+		if _, err := f.ReadAt(buf[:chunk], offset); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := chunk - 1; i >= 0; i-- {
+			// ignore the newline terminating the last line
+			if buf[i] != '\n' || offset+i == size-1 {
+				continue
+			}
+			lines++
+			if lines == n {
+				return offset + i + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// FollowLog calls fn for each line of the log file path, starting with
+// the last tail lines or the whole file if tail is negative. When follow
+// is true, it then waits for new lines until the context is canceled,
+// and restarts from the beginning of the file when it's truncated by a
+// log rotation.
+func FollowLog(ctx context.Context, path string, tail int, follow bool, fn func(line []byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	offset, err := tailOffset(f, tail)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	var partial []byte
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			offset += int64(n)
+			data := append(partial, buf[:n]...)
+			for {
+				i := bytes.IndexByte(data, '\n')
+				if i < 0 {
+					break
+				}
+				fn(data[:i+1])
+				data = data[i+1:]
+			}
+			partial = append([]byte{}, data...)
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if !follow {
+			if len(partial) > 0 {
+				fn(partial)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if len(partial) > 0 {
+				fn(partial)
+			}
+			return nil
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			// the log file is removed with the instance
+			continue
+		}
+		cur, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if !os.SameFile(fi, cur) {
+			// the log file was replaced, read the new one
+			nf, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			f.Close()
+			f = nf
+			offset = 0
+		} else if fi.Size() < offset {
+			// the log file was truncated by a rotation
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			offset = 0
+		}
+	}
+}
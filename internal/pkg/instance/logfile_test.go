@@ -0,0 +1,164 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotateLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instance.out")
+
+	// keep the file open in append mode like the instance process
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer f.Close()
+
+	for i, content := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := f.WriteString(content); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		rotated, err := RotateLog(path, 4, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !rotated {
+			t.Fatalf("log file not rotated at iteration %d", i)
+		}
+	}
+
+	if rotated, err := RotateLog(path, 4, 2); err != nil || rotated {
+		t.Errorf("unexpected rotation of an empty log file: %v", err)
+	}
+
+	expected := map[string]string{
+		path:                    "",
+		RotatedLogPath(path, 1): "third\n",
+		RotatedLogPath(path, 2): "second\n",
+	}
+	for p, want := range expected {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(b) != want {
+			t.Errorf("got %q in %s, want %q", b, p, want)
+		}
+	}
+	if _, err := os.Stat(RotatedLogPath(path, 3)); !os.IsNotExist(err) {
+		t.Errorf("rotated log file beyond the maximum not pruned")
+	}
+
+	// the file descriptor is still valid and writes at the beginning
+	if _, err := f.WriteString("fourth\n"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "fourth\n" {
+		t.Errorf("got %q after rotation, want %q", b, "fourth\n")
+	}
+}
+
+func TestFollowLogTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instance.err")
+	if err := os.WriteFile(path, []byte("1\n2\n3\n4"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		tail int
+		want string
+	}{
+		{tail: -1, want: "1\n2\n3\n4"},
+		{tail: 0, want: ""},
+		{tail: 2, want: "3\n4"},
+		{tail: 10, want: "1\n2\n3\n4"},
+	}
+	for _, tt := range tests {
+		var sb strings.Builder
+		err := FollowLog(context.Background(), path, tt.tail, false, func(line []byte) {
+			sb.Write(line)
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if sb.String() != tt.want {
+			t.Errorf("got %q with tail %d, want %q", sb.String(), tt.tail, tt.want)
+		}
+	}
+}
+
+func TestFollowLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instance.out")
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer f.Close()
+
+	var mu sync.Mutex
+	var lines []string
+	waitLines := func(n int) {
+		t.Helper()
+		for i := 0; i < 50; i++ {
+			mu.Lock()
+			got := len(lines)
+			mu.Unlock()
+			if got >= n {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("timeout waiting for %d lines, got %q", n, lines)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- FollowLog(ctx, path, -1, true, func(line []byte) {
+			mu.Lock()
+			lines = append(lines, string(line))
+			mu.Unlock()
+		})
+	}()
+
+	if _, err := f.WriteString("before rotation\n"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	waitLines(1)
+
+	if _, err := RotateLog(path, 1, 1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// let the follower notice the truncation
+	time.Sleep(300 * time.Millisecond)
+
+	if _, err := f.WriteString("after\n"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	waitLines(2)
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{"before rotation\n", "after\n"}
+	if strings.Join(lines, "") != strings.Join(want, "") {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+}
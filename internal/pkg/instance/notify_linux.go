@@ -0,0 +1,125 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+const (
+	// NotifyMountDir is the container directory where the directory
+	// holding the readiness notification socket of an instance is bound.
+	NotifyMountDir = "/run/apptainer"
+	// NotifySocketPath is the path of the readiness notification socket in
+	// the container.
+	NotifySocketPath = NotifyMountDir + "/" + notifySocketName
+	// NotifySocketEnv is the environment variable pointing the instance
+	// processes to the readiness notification socket.
+	NotifySocketEnv = "NOTIFY_SOCKET"
+
+	notifySocketName = "notify.sock"
+	// notifyPollInterval is the interval at which the instance is checked
+	// while waiting for its readiness notification.
+	notifyPollInterval = 500 * time.Millisecond
+)
+
+var (
+	// ErrReadyTimeout is returned when an instance didn't notify its
+	// readiness before the timeout.
+	ErrReadyTimeout = errors.New("timeout waiting for instance readiness notification")
+	// ErrNotReady is returned when an instance exited before notifying
+	// its readiness.
+	ErrNotReady = errors.New("instance exited before notifying its readiness")
+)
+
+// NotifySocket is a datagram socket receiving sd_notify style readiness
+// notifications from the processes of an instance.
+type NotifySocket struct {
+	dir  string
+	conn *net.UnixConn
+}
+
+// NewNotifySocket creates a readiness notification socket in a new
+// temporary directory, to be bound at NotifyMountDir in the container.
+func NewNotifySocket() (*NotifySocket, error) {
+	dir, err := os.MkdirTemp("", "apptainer-notify-")
+	if err != nil {
+		return nil, fmt.Errorf("could not create notification socket directory: %w", err)
+	}
+
+	addr := &net.UnixAddr{Name: filepath.Join(dir, notifySocketName), Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("could not create notification socket: %w", err)
+	}
+	return &NotifySocket{dir: dir, conn: conn}, nil
+}
+
+// Dir returns the host directory holding the notification socket.
+func (n *NotifySocket) Dir() string {
+	return n.dir
+}
+
+// Wait waits up to timeout for a READY=1 notification. If alive is not
+// nil it's called periodically and Wait returns ErrNotReady as soon as it
+// returns false.
+func (n *NotifySocket) Wait(timeout time.Duration, alive func() bool) error {
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, 4096)
+
+	for {
+		readDeadline := time.Now().Add(notifyPollInterval)
+		if readDeadline.After(deadline) {
+			readDeadline = deadline
+		}
+		if err := n.conn.SetReadDeadline(readDeadline); err != nil {
+			return err
+		}
+
+		l, err := n.conn.Read(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if !time.Now().Before(deadline) {
+				return ErrReadyTimeout
+			}
+			if alive != nil && !alive() {
+				return ErrNotReady
+			}
+			continue
+		} else if err != nil {
+			return fmt.Errorf("while reading notification socket: %w", err)
+		}
+
+		for _, line := range bytes.Split(buf[:l], []byte("\n")) {
+			key, value, _ := bytes.Cut(line, []byte("="))
+			switch string(key) {
+			case "READY":
+				if string(value) == "1" {
+					return nil
+				}
+			case "STATUS":
+				sylog.Verbosef("Instance status: %s", value)
+			}
+		}
+	}
+}
+
+// Close closes the notification socket and removes its directory.
+func (n *NotifySocket) Close() error {
+	n.conn.Close()
+	return os.RemoveAll(n.dir)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func notify(t *testing.T, n *NotifySocket, msg string) {
+	t.Helper()
+
+	conn, err := net.Dial("unixgram", filepath.Join(n.Dir(), notifySocketName))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestNotifySocket(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgs    []string
+		alive   func() bool
+		wantErr error
+	}{
+		{
+			name: "Ready",
+			msgs: []string{"STATUS=starting", "STATUS=almost\nREADY=1"},
+		},
+		{
+			name:    "NotReady",
+			msgs:    []string{"READY=0", "STATUS=READY=1"},
+			wantErr: ErrReadyTimeout,
+		},
+		{
+			name:    "Timeout",
+			wantErr: ErrReadyTimeout,
+		},
+		{
+			name:    "Exited",
+			alive:   func() bool { return false },
+			wantErr: ErrNotReady,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := NewNotifySocket()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer n.Close()
+
+			for _, msg := range tt.msgs {
+				notify(t, n, msg)
+			}
+
+			err = n.Wait(2*notifyPollInterval, tt.alive)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNotifySocketClose(t *testing.T) {
+	n, err := NewNotifySocket()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := n.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(n.Dir()); !os.IsNotExist(err) {
+		t.Errorf("notification socket directory %s not removed", n.Dir())
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+const (
+	// SocketsSubDir represents directory where the sockets directories
+	// of the instances are created
+	SocketsSubDir = "sockets"
+	// SocketsMountDir is the default container directory where the
+	// sockets directory of an instance is bound.
+	SocketsMountDir = "/run/apptainer/instance"
+)
+
+// SocketsDir returns the host directory shared by a named instance with
+// the containers started with --join-sockets, to exchange unix sockets.
+func SocketsDir(name string) (string, error) {
+	return GetDir(name, SocketsSubDir)
+}
+
+// CreateSocketsDir creates the empty sockets directory of a named
+// instance, only accessible by its owner, and returns its path. A
+// directory left by an instance which didn't clean up is replaced.
+func CreateSocketsDir(name string) (string, error) {
+	dir, err := SocketsDir(name)
+	if err != nil {
+		return "", err
+	}
+
+	oldumask := syscall.Umask(0o077)
+	defer syscall.Umask(oldumask)
+
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("could not remove stale sockets directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("could not create sockets directory: %w", err)
+	}
+	return dir, nil
+}
+
+// ownedSocketsDir returns the sockets directory of the instance, rebuilt
+// from the instance file name and owner, as the stored SocketsDir can be
+// rewritten by the owner while the instance may be deleted by root. An
+// error is returned unless the directory is a 0700 directory of the owner
+// under the owner's instance sockets directory.
+func (i *File) ownedSocketsDir() (string, error) {
+	fi, err := os.Lstat(i.Path)
+	if err != nil {
+		return "", err
+	}
+	owner := fi.Sys().(*syscall.Stat_t).Uid
+
+	username := ""
+	if int(owner) != os.Getuid() {
+		pw, err := user.GetPwUID(owner)
+		if err != nil {
+			return "", fmt.Errorf("could not get owner of %s: %w", i.Path, err)
+		}
+		username = pw.Name
+	}
+	name := strings.TrimSuffix(filepath.Base(i.Path), ".json")
+	if err := CheckName(name); err != nil {
+		return "", err
+	}
+	base, err := getPath(username, SocketsSubDir)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, name)
+	if filepath.Clean(i.SocketsDir) != dir {
+		sylog.Warningf("Ignoring sockets directory %s stored in %s, using %s", i.SocketsDir, i.Path, dir)
+	}
+
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return "", err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	if filepath.Dir(realDir) != realBase {
+		return "", fmt.Errorf("%s is not in the instance sockets directory %s", realDir, realBase)
+	}
+	fi, err = os.Lstat(realDir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() || fi.Mode().Perm() != 0o700 {
+		return "", fmt.Errorf("%s is not a directory with mode 0700", realDir)
+	}
+	if uid := fi.Sys().(*syscall.Stat_t).Uid; uid != owner {
+		return "", fmt.Errorf("%s is owned by UID %d instead of %d", realDir, uid, owner)
+	}
+	return realDir, nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/test"
+)
+
+func TestSocketsDir(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	const name = "sockets-test"
+
+	dir, err := CreateSocketsDir(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if fi.Mode().Perm() != 0o700 {
+		t.Errorf("got mode %o for %s, want 700", fi.Mode().Perm(), dir)
+	}
+
+	// a stale directory is emptied
+	stale := filepath.Join(dir, "stale.sock")
+	if err := os.WriteFile(stale, nil, 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := CreateSocketsDir(name); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale file %s not removed", stale)
+	}
+
+	// the sockets directory is removed with the instance file, the
+	// directory stored in the instance file is ignored
+	other := t.TempDir()
+	file, err := Add(name, testSubDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	file.SocketsDir = other
+	if err := file.Update(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := file.Delete(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("sockets directory %s not removed", dir)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("directory %s stored in the instance file removed: %s", other, err)
+	}
+
+	// a sockets directory not private to the owner is kept
+	if dir, err = CreateSocketsDir(name); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if file, err = Add(name, testSubDir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	file.SocketsDir = dir
+	if err := file.Update(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := file.Delete(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("sockets directory %s with mode 0755 removed: %s", dir, err)
+	}
+	os.RemoveAll(dir)
+
+	if _, err := CreateSocketsDir("bad/name"); err == nil {
+		t.Errorf("unexpected success with an invalid name")
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/pkg/util/fs/proc"
+)
+
+// fuseSourcePrefix is the prefix of the source of the FUSE mounts made
+// by apptainer, followed by the pid of the process doing the mount.
+const fuseSourcePrefix = "apptainer-fuse:"
+
+// bootIDPath is the file holding the boot ID of the running kernel.
+var bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// Network is a CNI network of an instance, stored so that its resources
+// can be released once the instance is gone.
+type Network struct {
+	// Config is the CNI network configuration list
+	Config json.RawMessage `json:"config"`
+	// Runtime is the CNI runtime configuration of the instance
+	Runtime json.RawMessage `json:"runtime"`
+}
+
+// Networks are the CNI networks of an instance along with the CNI
+// paths they were set up with.
+type Networks struct {
+	ConfPath   string    `json:"confPath"`
+	PluginPath string    `json:"pluginPath"`
+	List       []Network `json:"list"`
+}
+
+// FuseSource returns the source of the FUSE mounts made by the process
+// pid, identifying them as owned by an instance once it is gone.
+func FuseSource(pid int) string {
+	return fuseSourcePrefix + strconv.Itoa(pid)
+}
+
+// fuseSourcePid returns the pid of the process which made the FUSE
+// mount with source, or false if the mount wasn't made by apptainer.
+func fuseSourcePid(source string) (int, bool) {
+	if !strings.HasPrefix(source, fuseSourcePrefix) {
+		return 0, false
+	}
+	s := strings.TrimPrefix(source, fuseSourcePrefix)
+	pid, err := strconv.Atoi(s)
+	if err != nil || pid <= 0 || strconv.Itoa(pid) != s {
+		return 0, false
+	}
+	return pid, true
+}
+
+// BootID returns the boot ID of the running kernel, empty if it can't
+// be read.
+func BootID() string {
+	b, err := os.ReadFile(bootIDPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// processExists returns if the process pid exists, a process owned by
+// another user exists too.
+func processExists(pid int) bool {
+	return pid > 0 && syscall.Kill(pid, 0) != syscall.ESRCH
+}
+
+// Stale returns the files of the exited instances matching username
+// and/or name pattern, whose parent process is gone or which were started
+// before the last boot. The files are left in place until the resources
+// of the instances are released.
+func Stale(username string, name string, subDir string) ([]*File, error) {
+	_, ghosts, err := listFiles(username, name, subDir)
+	return ghosts, err
+}
+
+// Running returns if a process of the stale instance may still be running,
+// in which case its resources must be left untouched: the container
+// process may have survived its parent, or its pid may belong to another
+// process now, possibly another container using the same container ID.
+func (i *File) Running() bool {
+	return processExists(i.Pid)
+}
+
+// Rebooted returns if the instance was started before the last boot.
+func (i *File) Rebooted() bool {
+	return i.BootID != "" && i.BootID != BootID()
+}
+
+// StaleMounts returns the mount points listed in the mountinfo file
+// which are FUSE mounts made by a process of the stale instance. A mount
+// is only returned when its source carries the apptainer marker with the
+// pid of the instance, or of its parent, and this process is gone.
+func (i *File) StaleMounts(mountinfo string) ([]string, error) {
+	if i.Rebooted() {
+		// the mounts were gone with the reboot, the pids are meaningless
+		return nil, nil
+	}
+	entries, err := proc.GetMountInfoEntry(mountinfo)
+	if err != nil {
+		return nil, err
+	}
+	var points []string
+	for _, e := range entries {
+		if !strings.HasPrefix(e.FSType, "fuse") {
+			continue
+		}
+		pid, ok := fuseSourcePid(e.Source)
+		if !ok || (pid != i.Pid && pid != i.PPid) {
+			continue
+		}
+		if processExists(pid) {
+			continue
+		}
+		points = append(points, e.Point)
+	}
+	// unmount the nested mounts first
+	for l, r := 0, len(points)-1; l < r; l, r = l+1, r-1 {
+		points[l], points[r] = points[r], points[l]
+	}
+	return points, nil
+}
+
+// StaleCgroup returns the path of the cgroup of the stale instance,
+// relative to the cgroup mount point, or an empty string if the instance
+// had no cgroup or its path isn't one created by apptainer for the
+// instance: /apptainer/<pid>, a systemd apptainer-<pid>.scope unit, or
+// apptainer-<pid> beneath a job cgroup.
+func (i *File) StaleCgroup() string {
+	if !i.Cgroup || i.Pid <= 0 || i.Rebooted() {
+		return ""
+	}
+	if i.Details == nil || i.Details.CgroupPath == "" {
+		return filepath.Join("/apptainer", strconv.Itoa(i.Pid))
+	}
+	path := filepath.Clean(i.Details.CgroupPath)
+	pid := strconv.Itoa(i.Pid)
+	if path == filepath.Join("/apptainer", pid) {
+		return path
+	}
+	if filepath.Base(path) == "apptainer-"+pid+".scope" {
+		return path
+	}
+	if i.JobCgroup && filepath.Base(path) == "apptainer-"+pid {
+		return path
+	}
+	return ""
+}
+
+// DeleteStale deletes the files of the stale instance, unless they were
+// replaced by the files of a new instance with the same name meanwhile.
+func (i *File) DeleteStale() error {
+	b, err := os.ReadFile(i.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	f := &File{}
+	if err := json.Unmarshal(b, f); err != nil {
+		return err
+	}
+	if f.Pid != i.Pid || f.PPid != i.PPid || f.BootID != i.BootID {
+		return fmt.Errorf("instance %s was started again", i.Name)
+	}
+	return i.Delete()
+}
@@ -0,0 +1,292 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/test"
+)
+
+// deadPid returns the pid of a process which exited.
+func deadPid(t *testing.T) int {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("could not run true: %s", err)
+	}
+	return cmd.Process.Pid
+}
+
+// setBootID replaces the boot ID of the running kernel with id for the
+// duration of the test.
+func setBootID(t *testing.T, id string) {
+	path := filepath.Join(t.TempDir(), "boot_id")
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o644); err != nil {
+		t.Fatalf("could not write boot ID: %s", err)
+	}
+	old := bootIDPath
+	bootIDPath = path
+	t.Cleanup(func() { bootIDPath = old })
+}
+
+func TestFuseSourcePid(t *testing.T) {
+	tests := []struct {
+		source string
+		pid    int
+		ok     bool
+	}{
+		{source: FuseSource(1234), pid: 1234, ok: true},
+		{source: "apptainer-fuse:1", pid: 1, ok: true},
+		{source: "squashfuse", ok: false},
+		{source: "apptainer-fuse:", ok: false},
+		{source: "apptainer-fuse:0", ok: false},
+		{source: "apptainer-fuse:-12", ok: false},
+		{source: "apptainer-fuse:012", ok: false},
+		{source: "apptainer-fuse:12abc", ok: false},
+		{source: "xapptainer-fuse:12", ok: false},
+	}
+	for _, tt := range tests {
+		pid, ok := fuseSourcePid(tt.source)
+		if ok != tt.ok || pid != tt.pid {
+			t.Errorf("fuseSourcePid(%q) = %d, %v, want %d, %v", tt.source, pid, ok, tt.pid, tt.ok)
+		}
+	}
+}
+
+func TestStaleMounts(t *testing.T) {
+	setBootID(t, "current")
+
+	dead := deadPid(t)
+	alive := os.Getpid()
+
+	lines := []string{
+		// FUSE mount of the dead instance process
+		"40 30 0:50 / /tmp/rootfs-1 ro,nosuid,nodev master:1 - fuse.squashfuse " + FuseSource(dead) + " ro,user_id=0,group_id=0",
+		// nested FUSE mount of the dead instance process
+		"41 40 0:51 / /tmp/rootfs-1/overlay rw,nosuid,nodev - fuse.squashfuse_ll " + FuseSource(dead) + " ro,user_id=0,group_id=0",
+		// FUSE mount of a live process
+		"42 30 0:52 / /tmp/rootfs-2 ro,nosuid,nodev - fuse.squashfuse " + FuseSource(alive) + " ro,user_id=0,group_id=0",
+		// FUSE mount of another dead process
+		"43 30 0:53 / /tmp/rootfs-3 ro,nosuid,nodev - fuse.squashfuse " + FuseSource(dead+1) + " ro,user_id=0,group_id=0",
+		// FUSE mount without the marker
+		"44 30 0:54 / /tmp/rootfs-4 ro,nosuid,nodev - fuse.squashfuse squashfuse ro,user_id=0,group_id=0",
+		// not a FUSE mount, with the marker
+		"45 30 0:55 / /tmp/rootfs-5 rw,nosuid,nodev - tmpfs " + FuseSource(dead) + " rw",
+	}
+	mountinfo := filepath.Join(t.TempDir(), "mountinfo")
+	if err := os.WriteFile(mountinfo, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("could not write mountinfo: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		file   *File
+		points []string
+	}{
+		{
+			name:   "DeadPid",
+			file:   &File{Pid: dead, PPid: dead + 2, BootID: "current"},
+			points: []string{"/tmp/rootfs-1/overlay", "/tmp/rootfs-1"},
+		},
+		{
+			name:   "DeadPPid",
+			file:   &File{Pid: dead + 2, PPid: dead, BootID: "current"},
+			points: []string{"/tmp/rootfs-1/overlay", "/tmp/rootfs-1"},
+		},
+		{
+			name: "AlivePid",
+			file: &File{Pid: alive, PPid: dead + 2, BootID: "current"},
+		},
+		{
+			name: "OtherPids",
+			file: &File{Pid: dead + 4, PPid: dead + 5, BootID: "current"},
+		},
+		{
+			name: "Rebooted",
+			file: &File{Pid: dead, PPid: dead + 2, BootID: "previous"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points, err := tt.file.StaleMounts(mountinfo)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(points, tt.points) {
+				t.Errorf("got mount points %v, want %v", points, tt.points)
+			}
+		})
+	}
+}
+
+func TestStaleCgroup(t *testing.T) {
+	setBootID(t, "current")
+
+	tests := []struct {
+		name string
+		file *File
+		want string
+	}{
+		{
+			name: "NoCgroup",
+			file: &File{Pid: 100, BootID: "current"},
+		},
+		{
+			name: "DefaultPath",
+			file: &File{Pid: 100, Cgroup: true, BootID: "current"},
+			want: "/apptainer/100",
+		},
+		{
+			name: "CgroupfsPath",
+			file: &File{Pid: 100, Cgroup: true, BootID: "current", Details: &Details{CgroupPath: "/apptainer/100"}},
+			want: "/apptainer/100",
+		},
+		{
+			name: "SystemdPath",
+			file: &File{Pid: 100, Cgroup: true, BootID: "current", Details: &Details{CgroupPath: "/system.slice/apptainer-100.scope"}},
+			want: "/system.slice/apptainer-100.scope",
+		},
+		{
+			name: "JobPath",
+			file: &File{Pid: 100, Cgroup: true, JobCgroup: true, BootID: "current", Details: &Details{CgroupPath: "/slurm/uid_1000/job_42/step_0/apptainer-100"}},
+			want: "/slurm/uid_1000/job_42/step_0/apptainer-100",
+		},
+		{
+			name: "JobPathNotJoined",
+			file: &File{Pid: 100, Cgroup: true, BootID: "current", Details: &Details{CgroupPath: "/slurm/uid_1000/job_42/step_0/apptainer-100"}},
+		},
+		{
+			name: "JobStatsOnly",
+			file: &File{Pid: 100, JobCgroup: true, BootID: "current", Details: &Details{CgroupPath: "/slurm/uid_1000/job_42/step_0"}},
+		},
+		{
+			name: "OtherPid",
+			file: &File{Pid: 100, Cgroup: true, BootID: "current", Details: &Details{CgroupPath: "/apptainer/101"}},
+		},
+		{
+			name: "OtherGroup",
+			file: &File{Pid: 100, Cgroup: true, BootID: "current", Details: &Details{CgroupPath: "/user.slice/user-1000.slice"}},
+		},
+		{
+			name: "ParentOfApptainer",
+			file: &File{Pid: 100, Cgroup: true, BootID: "current", Details: &Details{CgroupPath: "/apptainer/100/.."}},
+		},
+		{
+			name: "Rebooted",
+			file: &File{Pid: 100, Cgroup: true, BootID: "previous"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.file.StaleCgroup(); got != tt.want {
+				t.Errorf("got cgroup %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStale(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	setBootID(t, "current")
+
+	dead := deadPid(t)
+	prefix := "stale_test_" + strconv.Itoa(os.Getpid())
+
+	records := []struct {
+		name  string
+		file  *File
+		stale bool
+	}{
+		{
+			name:  prefix + "_dead",
+			file:  &File{Pid: dead, PPid: dead, BootID: "current"},
+			stale: true,
+		},
+		{
+			name:  prefix + "_rebooted",
+			file:  &File{Pid: fakeInstancePid, PPid: fakeInstancePid, BootID: "previous"},
+			stale: true,
+		},
+		{
+			name:  prefix + "_running",
+			file:  &File{Pid: fakeInstancePid, PPid: fakeInstancePid, BootID: "current"},
+			stale: false,
+		},
+	}
+	for _, r := range records {
+		dir, err := GetDir(r.name, AppSubDir)
+		if err != nil {
+			t.Fatalf("could not get instance directory: %s", err)
+		}
+		r.file.Name = r.name
+		r.file.User = "test"
+		r.file.Path = filepath.Join(dir, r.name+".json")
+		if err := r.file.Update(); err != nil {
+			t.Fatalf("could not write instance file %s: %s", r.name, err)
+		}
+		defer r.file.Delete()
+	}
+
+	stale, err := Stale("", prefix+"_*", AppSubDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	found := make(map[string]*File)
+	for _, f := range stale {
+		found[f.Name] = f
+	}
+	for _, r := range records {
+		if _, ok := found[r.name]; ok != r.stale {
+			t.Errorf("instance %s reported stale: %v, want %v", r.name, ok, r.stale)
+		}
+	}
+
+	// the files are only deleted once the resources are released
+	for _, f := range stale {
+		if _, err := os.Stat(f.Path); err != nil {
+			t.Errorf("file of stale instance %s was deleted: %s", f.Name, err)
+		}
+	}
+
+	// the file of an instance started again with the same name is kept
+	f := found[prefix+"_dead"]
+	if f == nil {
+		t.Fatalf("stale instance %s_dead not found", prefix)
+	}
+	restarted := *f
+	restarted.Pid = os.Getpid()
+	if err := restarted.Update(); err != nil {
+		t.Fatalf("could not update instance file: %s", err)
+	}
+	if err := f.DeleteStale(); err == nil {
+		t.Errorf("unexpected success deleting the file of a restarted instance")
+	}
+	if _, err := os.Stat(f.Path); err != nil {
+		t.Errorf("file of restarted instance was deleted: %s", err)
+	}
+
+	g := found[prefix+"_rebooted"]
+	if g == nil {
+		t.Fatalf("stale instance %s_rebooted not found", prefix)
+	}
+	if err := g.DeleteStale(); err != nil {
+		t.Errorf("unexpected error deleting stale instance file: %s", err)
+	}
+	if _, err := os.Stat(g.Path); !os.IsNotExist(err) {
+		t.Errorf("file of stale instance %s was not deleted", g.Name)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// RestartNo never restarts an instance.
+	RestartNo = "no"
+	// RestartOnFailure restarts an instance exiting with a non-zero status.
+	RestartOnFailure = "on-failure"
+	// RestartAlways restarts an instance whatever its exit status.
+	RestartAlways = "always"
+
+	// SupervisorProgPrefix is the prefix used by an instance supervisor process
+	SupervisorProgPrefix = "Apptainer instance supervisor"
+
+	supervisorSuffix = ".supervisor.json"
+	exitSuffix       = ".exit"
+)
+
+// RestartPolicy describes when an instance is restarted after it exits.
+type RestartPolicy struct {
+	Mode string
+	// MaxRetries is the maximum number of consecutive restarts with the
+	// on-failure mode, 0 means unlimited.
+	MaxRetries int
+}
+
+// ParseRestartPolicy parses a restart policy in the
+// no|on-failure[:max]|always format.
+func ParseRestartPolicy(s string) (RestartPolicy, error) {
+	mode, max, hasMax := strings.Cut(s, ":")
+	p := RestartPolicy{Mode: mode}
+
+	switch mode {
+	case RestartNo, RestartAlways:
+		if hasMax {
+			return p, fmt.Errorf("restart policy %s doesn't accept a maximum retry count", mode)
+		}
+	case RestartOnFailure:
+		if !hasMax {
+			break
+		}
+		n, err := strconv.Atoi(max)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("invalid maximum retry count %q for restart policy %s", max, mode)
+		}
+		p.MaxRetries = n
+	default:
+		return p, fmt.Errorf("invalid restart policy %q, must be one of no, on-failure[:max] or always", s)
+	}
+	return p, nil
+}
+
+// String returns the restart policy in the format accepted by
+// ParseRestartPolicy.
+func (p RestartPolicy) String() string {
+	if p.Mode == RestartOnFailure && p.MaxRetries > 0 {
+		return fmt.Sprintf("%s:%d", p.Mode, p.MaxRetries)
+	}
+	return p.Mode
+}
+
+// ShouldRestart returns if an instance exiting with status must be
+// restarted after it has been restarted restarts consecutive times.
+func (p RestartPolicy) ShouldRestart(status, restarts int) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return status != 0 && (p.MaxRetries == 0 || restarts < p.MaxRetries)
+	}
+	return false
+}
+
+// Launch holds the original command line, environment and working
+// directory of an instance, to start it again with the same flags.
+type Launch struct {
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+	Dir  string   `json:"dir"`
+	// Cgroups holds the resource limits set with instance update, in
+	// JSON format, applied over those of the command line
+	Cgroups string `json:"cgroups,omitempty"`
+}
+
+// Supervisor represents the file storing the state of the process
+// supervising an instance with a restart policy. It's stored next to
+// the instance directory as it must outlive the instance.
+type Supervisor struct {
+	Path     string `json:"-"`
+	Pid      int    `json:"pid"`
+	Name     string `json:"name"`
+	Restarts int    `json:"restarts"`
+}
+
+// NewSupervisor returns the supervisor file of a named instance.
+func NewSupervisor(name string, subDir string) (*Supervisor, error) {
+	if err := CheckName(name); err != nil {
+		return nil, err
+	}
+	path, err := getPath("", subDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Supervisor{
+		Name: name,
+		Path: filepath.Join(path, name+supervisorSuffix),
+	}, nil
+}
+
+// ListSupervisors returns the supervisor files matching username and/or
+// name pattern, files of supervisors which are not running anymore are
+// deleted.
+func ListSupervisors(username string, name string, subDir string) ([]*Supervisor, error) {
+	list := make([]*Supervisor, 0)
+
+	path, err := getPath(username, subDir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(path, name+supervisorSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		s := &Supervisor{}
+		if err := json.Unmarshal(b, s); err != nil {
+			return nil, err
+		}
+		s.Path = file
+		if !s.IsRunning() {
+			s.Delete()
+			continue
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// IsRunning returns if the supervisor process is still running.
+func (s *Supervisor) IsRunning() bool {
+	if s.Pid <= 0 {
+		return false
+	}
+	d, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", s.Pid))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(string(d), SupervisorProgPrefix)
+}
+
+// Update stores the supervisor state in the supervisor file.
+func (s *Supervisor) Update() error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path, b, 0o600)
+}
+
+// Delete deletes the supervisor file.
+func (s *Supervisor) Delete() error {
+	if err := os.Remove(s.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Stop stops the supervisor process so the instance it supervises isn't
+// restarted anymore, and deletes the supervisor file.
+func (s *Supervisor) Stop() error {
+	if s.IsRunning() {
+		if err := syscall.Kill(s.Pid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("while stopping supervisor of instance %s: %w", s.Name, err)
+		}
+	}
+	return s.Delete()
+}
+
+// SupervisorProcName returns the process name of the supervisor of a
+// named instance.
+func SupervisorProcName(name string, username string) (string, error) {
+	if err := CheckName(name); err != nil {
+		return "", fmt.Errorf("while checking instance name: %s", err)
+	}
+	return fmt.Sprintf(prognameFormat, SupervisorProgPrefix, username, name), nil
+}
+
+// exitPath returns the path of the file recording the exit status of
+// a named instance.
+func exitPath(name string, subDir string) (string, error) {
+	if err := CheckName(name); err != nil {
+		return "", err
+	}
+	path, err := getPath("", subDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(path, name+exitSuffix), nil
+}
+
+// SetExitStatus records the exit status of a named instance, for its
+// supervisor to apply the restart policy and for instance stop to report
+// it.
+func SetExitStatus(name string, subDir string, status int) error {
+	path, err := exitPath(name, subDir)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(status)), 0o600)
+}
+
+// PopExitStatus returns and deletes the exit status recorded for a named
+// instance.
+func PopExitStatus(name string, subDir string) (int, error) {
+	path, err := exitPath(name, subDir)
+	if err != nil {
+		return 0, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	os.Remove(path)
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"testing"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy      string
+		want        RestartPolicy
+		expectError bool
+	}{
+		{policy: "no", want: RestartPolicy{Mode: RestartNo}},
+		{policy: "always", want: RestartPolicy{Mode: RestartAlways}},
+		{policy: "on-failure", want: RestartPolicy{Mode: RestartOnFailure}},
+		{policy: "on-failure:3", want: RestartPolicy{Mode: RestartOnFailure, MaxRetries: 3}},
+		{policy: "on-failure:0", expectError: true},
+		{policy: "on-failure:x", expectError: true},
+		{policy: "always:3", expectError: true},
+		{policy: "never", expectError: true},
+		{policy: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			p, err := ParseRestartPolicy(tt.policy)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("unexpected success for policy %q", tt.policy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for policy %q: %s", tt.policy, err)
+			}
+			if p != tt.want {
+				t.Errorf("got %+v, want %+v", p, tt.want)
+			}
+			if p.String() != tt.policy {
+				t.Errorf("got string %q, want %q", p.String(), tt.policy)
+			}
+		})
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RestartPolicy
+		status   int
+		restarts int
+		want     bool
+	}{
+		{"NoFailure", RestartPolicy{Mode: RestartNo}, 1, 0, false},
+		{"AlwaysSuccess", RestartPolicy{Mode: RestartAlways}, 0, 10, true},
+		{"OnFailureSuccess", RestartPolicy{Mode: RestartOnFailure}, 0, 0, false},
+		{"OnFailureFailure", RestartPolicy{Mode: RestartOnFailure}, 1, 100, true},
+		{"OnFailureBelowMax", RestartPolicy{Mode: RestartOnFailure, MaxRetries: 2}, 1, 1, true},
+		{"OnFailureMaxReached", RestartPolicy{Mode: RestartOnFailure, MaxRetries: 2}, 1, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.ShouldRestart(tt.status, tt.restarts); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// unitRestartInterval is the interval used to count the restarts of a
+// unit with an on-failure:max restart policy, it matches the time an
+// instance must run before its supervisor resets its restarts count.
+const unitRestartInterval = "5min"
+
+// Unit describes a systemd service unit managing an instance started
+// with apptainer instance start.
+type Unit struct {
+	// Name is the instance name.
+	Name string
+	// Apptainer is the path of the apptainer binary.
+	Apptainer string
+	// Args are the instance start arguments, options included, except the
+	// --pid-file option which is set from PidFile.
+	Args []string
+	// PidFile is the instance PID file, it may contain systemd specifiers.
+	PidFile string
+	// Restart is the restart policy of the instance, applied by systemd.
+	Restart RestartPolicy
+	// Env is the environment of the apptainer process.
+	Env []string
+	// WorkingDir is the working directory of the apptainer process.
+	WorkingDir string
+	// System is true for a system unit, false for a user unit.
+	System bool
+}
+
+// ServiceName returns the name of the systemd service unit.
+func (u *Unit) ServiceName() string {
+	return "apptainer-instance-" + u.Name + ".service"
+}
+
+// escapeSpecifiers escapes the characters interpreted by systemd as
+// specifiers (and variables when vars is true).
+func escapeSpecifiers(s string, vars bool) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if vars {
+		s = strings.ReplaceAll(s, "$", "$$")
+	}
+	return s
+}
+
+// quoteUnitValue quotes s as a single word of a systemd unit setting
+// when required.
+func quoteUnitValue(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\;") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// execLine returns a systemd command line for args, escaping specifiers
+// and variables.
+func execLine(args ...string) string {
+	words := make([]string, len(args))
+	for i, arg := range args {
+		words[i] = quoteUnitValue(escapeSpecifiers(arg, true))
+	}
+	return strings.Join(words, " ")
+}
+
+// Write writes the systemd service unit.
+func (u *Unit) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, "# Generated by apptainer instance generate-unit\n")
+	fmt.Fprintf(b, "[Unit]\n")
+	fmt.Fprintf(b, "Description=Apptainer instance %s\n", escapeSpecifiers(u.Name, false))
+	fmt.Fprintf(b, "Wants=network-online.target\n")
+	fmt.Fprintf(b, "After=network-online.target\n")
+	if u.Restart.Mode == RestartOnFailure && u.Restart.MaxRetries > 0 {
+		fmt.Fprintf(b, "StartLimitIntervalSec=%s\n", unitRestartInterval)
+		fmt.Fprintf(b, "StartLimitBurst=%d\n", u.Restart.MaxRetries+1)
+	}
+
+	fmt.Fprintf(b, "\n[Service]\n")
+	fmt.Fprintf(b, "Type=forking\n")
+	fmt.Fprintf(b, "PIDFile=%s\n", u.PidFile)
+	if u.WorkingDir != "" {
+		fmt.Fprintf(b, "WorkingDirectory=%s\n", escapeSpecifiers(u.WorkingDir, false))
+	}
+	for _, env := range u.Env {
+		fmt.Fprintf(b, "Environment=%s\n", quoteUnitValue(escapeSpecifiers(env, false)))
+	}
+	fmt.Fprintf(b, "ExecStart=%s %s %s\n",
+		execLine(u.Apptainer, "instance", "start"),
+		quoteUnitValue("--pid-file="+u.PidFile),
+		execLine(u.Args...),
+	)
+	fmt.Fprintf(b, "ExecStop=%s\n", execLine(u.Apptainer, "instance", "stop", u.Name))
+	switch u.Restart.Mode {
+	case RestartOnFailure, RestartAlways:
+		fmt.Fprintf(b, "Restart=%s\n", u.Restart.Mode)
+		fmt.Fprintf(b, "RestartSec=1\n")
+	default:
+		fmt.Fprintf(b, "Restart=no\n")
+	}
+
+	target := "default.target"
+	if u.System {
+		target = "multi-user.target"
+	}
+	fmt.Fprintf(b, "\n[Install]\n")
+	fmt.Fprintf(b, "WantedBy=%s\n", target)
+
+	return b.Flush()
+}
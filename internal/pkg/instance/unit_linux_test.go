@@ -0,0 +1,195 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseUnit parses a systemd unit into a map of "section.key" settings.
+func parseUnit(t *testing.T, unit string) map[string][]string {
+	t.Helper()
+
+	settings := make(map[string][]string)
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(unit))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "["):
+			section = strings.Trim(line, "[]")
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				t.Fatalf("malformed unit line %q", line)
+			}
+			settings[section+"."+key] = append(settings[section+"."+key], value)
+		}
+	}
+	return settings
+}
+
+// splitUnitWords splits a unit setting value into words following the
+// systemd quoting rules, expanding escaped specifiers and variables.
+func splitUnitWords(t *testing.T, value string) []string {
+	t.Helper()
+
+	var words []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && quoted:
+			i++
+			if i == len(value) {
+				t.Fatalf("trailing escape in %q", value)
+			}
+			switch value[i] {
+			case 'n':
+				word.WriteByte('\n')
+			case 't':
+				word.WriteByte('\t')
+			default:
+				word.WriteByte(value[i])
+			}
+		case c == '"':
+			quoted = !quoted
+			inWord = true
+		case c == ' ' && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case (c == '%' || c == '$') && i+1 < len(value) && value[i+1] == c:
+			word.WriteByte(c)
+			inWord = true
+			i++
+		case c == '%' || c == '$':
+			t.Fatalf("unescaped %q in %q", c, value)
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quoted {
+		t.Fatalf("unterminated quote in %q", value)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+func TestUnitWrite(t *testing.T) {
+	args := []string{
+		"--bind=/data dir:/data",
+		"--env=PRICE=$5 100%",
+		`--env=QUOTE="a\b"`,
+		"/images/web.sif",
+		"web",
+		"--",
+		"",
+		";",
+	}
+
+	tests := []struct {
+		name     string
+		unit     Unit
+		settings map[string][]string
+	}{
+		{
+			name: "UserNoRestart",
+			unit: Unit{
+				Name:       "web",
+				Apptainer:  "/usr/bin/apptainer",
+				Args:       args,
+				PidFile:    "%t/apptainer-instance-web.pid",
+				Restart:    RestartPolicy{Mode: RestartNo},
+				Env:        []string{"APPTAINER_CACHEDIR=/cache dir"},
+				WorkingDir: "/home/user",
+			},
+			settings: map[string][]string{
+				"Service.Type":             {"forking"},
+				"Service.PIDFile":          {"%t/apptainer-instance-web.pid"},
+				"Service.Restart":          {"no"},
+				"Service.WorkingDirectory": {"/home/user"},
+				"Service.Environment":      {`"APPTAINER_CACHEDIR=/cache dir"`},
+				"Install.WantedBy":         {"default.target"},
+			},
+		},
+		{
+			name: "SystemOnFailure",
+			unit: Unit{
+				Name:      "web",
+				Apptainer: "/usr/bin/apptainer",
+				Args:      args,
+				PidFile:   "/run/web.pid",
+				Restart:   RestartPolicy{Mode: RestartOnFailure, MaxRetries: 3},
+				System:    true,
+			},
+			settings: map[string][]string{
+				"Unit.StartLimitBurst":       {"4"},
+				"Unit.StartLimitIntervalSec": {unitRestartInterval},
+				"Service.PIDFile":            {"/run/web.pid"},
+				"Service.Restart":            {"on-failure"},
+				"Install.WantedBy":           {"multi-user.target"},
+			},
+		},
+		{
+			name: "Always",
+			unit: Unit{
+				Name:      "web",
+				Apptainer: "/usr/bin/apptainer",
+				Args:      args,
+				PidFile:   "/run/web.pid",
+				Restart:   RestartPolicy{Mode: RestartAlways},
+			},
+			settings: map[string][]string{
+				"Service.Restart": {"always"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			if err := tt.unit.Write(&sb); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			settings := parseUnit(t, sb.String())
+
+			for key, want := range tt.settings {
+				if got := settings[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("got %s=%q, want %q", key, got, want)
+				}
+			}
+
+			if len(settings["Service.ExecStart"]) != 1 {
+				t.Fatalf("got %d ExecStart settings, want 1", len(settings["Service.ExecStart"]))
+			}
+			// specifiers in the pid file are expanded by systemd
+			execStart := strings.Replace(settings["Service.ExecStart"][0], tt.unit.PidFile, "PIDFILE", 1)
+			wantStart := append([]string{tt.unit.Apptainer, "instance", "start", "--pid-file=PIDFILE"}, args...)
+			if got := splitUnitWords(t, execStart); !reflect.DeepEqual(got, wantStart) {
+				t.Errorf("got ExecStart %q, want %q", got, wantStart)
+			}
+
+			wantStop := []string{tt.unit.Apptainer, "instance", "stop", tt.unit.Name}
+			if got := splitUnitWords(t, settings["Service.ExecStop"][0]); !reflect.DeepEqual(got, wantStop) {
+				t.Errorf("got ExecStop %q, want %q", got, wantStop)
+			}
+		})
+	}
+}
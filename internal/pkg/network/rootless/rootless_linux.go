@@ -0,0 +1,468 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package rootless provides user mode networking for the network namespace
+// of unprivileged containers with pasta or slirp4netns, forwarding the
+// published host ports to the container.
+package rootless
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+	"github.com/apptainer/apptainer/pkg/network"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/slice"
+)
+
+const (
+	// Auto selects pasta if available, slirp4netns otherwise.
+	Auto = "auto"
+	// Pasta is the pasta backend, from the passt project.
+	Pasta = "pasta"
+	// Slirp4netns is the slirp4netns backend.
+	Slirp4netns = "slirp4netns"
+)
+
+// readyTimeout is the time to wait for the backend to configure the
+// network namespace.
+const readyTimeout = 10 * time.Second
+
+// Network is a user mode network started for the network namespace of a
+// container.
+type Network struct {
+	// Backend is the name of the backend providing the network.
+	Backend string
+	// Ports are the host ports forwarded to the container.
+	Ports []network.PortMapEntry
+	// DNS are the DNS servers of the container.
+	DNS []string
+
+	pid     int
+	done    chan error
+	exitFd  *os.File
+	tmpDir  string
+	pidFile string
+}
+
+// IsBackend returns whether name is the name of a backend, selecting the
+// rootless network with --network.
+func IsBackend(name string) bool {
+	return name == Pasta || name == Slirp4netns
+}
+
+// FindBackend returns the name and the path of the backend to use for
+// the preference set in apptainer.conf or with --network, one of Auto,
+// Pasta or Slirp4netns. Pasta falls back to slirp4netns, with a warning
+// when pasta was explicitly requested.
+func FindBackend(preference string) (string, string, error) {
+	var backends []string
+
+	switch preference {
+	case Auto, "", Pasta:
+		backends = []string{Pasta, Slirp4netns}
+	case Slirp4netns:
+		backends = []string{preference}
+	default:
+		return "", "", fmt.Errorf("unknown rootless network backend %q", preference)
+	}
+
+	for _, b := range backends {
+		path, err := bin.FindBin(b)
+		if err == nil {
+			if b != preference && preference == Pasta {
+				sylog.Warningf("%s not found, falling back to %s for the rootless network", Pasta, b)
+			}
+			return b, path, nil
+		}
+		sylog.Debugf("Rootless network backend %s not found: %s", b, err)
+	}
+	return "", "", fmt.Errorf("%s not found, it is required to publish ports without a network permitted by the administrator", strings.Join(backends, " or "))
+}
+
+// CheckPorts checks that the host ports of the forwards are not already
+// in use.
+func CheckPorts(ports []network.PortMapEntry) error {
+	for _, p := range ports {
+		if err := network.CheckHostPort(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start starts the backend name at path for the network namespace of the
+// process pid, forwarding the host ports to the container and using the
+// DNS servers dns if any. It returns once the network namespace is
+// configured.
+func Start(name, path string, pid int, ports []network.PortMapEntry, dns []string) (*Network, error) {
+	n := &Network{
+		Backend: name,
+		Ports:   ports,
+		DNS:     dns,
+		pid:     pid,
+	}
+
+	tmpDir, err := os.MkdirTemp("", "apptainer-"+name+"-")
+	if err != nil {
+		return nil, err
+	}
+	n.tmpDir = tmpDir
+
+	switch name {
+	case Pasta:
+		err = n.startPasta(path, pid)
+	case Slirp4netns:
+		err = n.startSlirp4netns(path, pid)
+	default:
+		err = fmt.Errorf("unknown rootless network backend %q", name)
+	}
+	if err != nil {
+		n.Stop()
+		return nil, fmt.Errorf("while starting %s: %s", name, err)
+	}
+
+	sylog.Debugf("Started %s for the network namespace of PID %d with ports %v", name, pid, ports)
+	return n, nil
+}
+
+// pastaArgs returns the arguments of pasta for the network namespace of
+// the process pid, writing its PID to pidFile. Pasta exits by itself when
+// the network namespace goes away.
+func pastaArgs(pid int, pidFile string, ports []network.PortMapEntry, dns []string) []string {
+	args := []string{
+		"--config-net",
+		"--quiet",
+		"--no-map-gw",
+		"--pid", pidFile,
+		// don't forward the ports bound on the loopback of the
+		// container to the host
+		"-T", "none",
+		"-U", "none",
+	}
+
+	tcp, udp := 0, 0
+	for _, p := range ports {
+		opt := "-t"
+		if p.Protocol == "udp" {
+			opt = "-u"
+			udp++
+		} else {
+			tcp++
+		}
+		spec := fmt.Sprintf("%d:%d", p.HostPort, p.ContainerPort)
+		if p.HostIP != "" {
+			spec = p.HostIP + "/" + spec
+		}
+		args = append(args, opt, spec)
+	}
+	if tcp == 0 {
+		args = append(args, "-t", "none")
+	}
+	if udp == 0 {
+		args = append(args, "-u", "none")
+	}
+	for _, d := range dns {
+		args = append(args, "--dns", d)
+	}
+
+	return append(args, strconv.Itoa(pid))
+}
+
+// startPasta runs pasta, which daemonizes once the network namespace is
+// configured and the ports are bound.
+func (n *Network) startPasta(path string, pid int) error {
+	n.pidFile = filepath.Join(n.tmpDir, "pasta.pid")
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, pastaArgs(pid, n.pidFile, n.Ports, n.DNS)...)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// startSlirp4netns runs slirp4netns, then adds the forwards with its API
+// socket once it reports the network namespace is configured.
+func (n *Network) startSlirp4netns(path string, pid int) error {
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+	defer readyW.Close()
+
+	exitR, exitW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer exitR.Close()
+	n.exitFd = exitW
+
+	socket := filepath.Join(n.tmpDir, "slirp4netns.sock")
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(path,
+		"--configure",
+		"--mtu=65520",
+		"--disable-host-loopback",
+		"--ready-fd=3",
+		"--exit-fd=4",
+		"--api-socket", socket,
+		strconv.Itoa(pid),
+		"tap0",
+	)
+	cmd.ExtraFiles = []*os.File{readyW, exitR}
+	cmd.Stderr = &stderr
+	// don't get signals sent to the process group of the container
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+		close(done)
+	}()
+
+	ready := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		_, err := readyR.Read(b)
+		ready <- err
+	}()
+	// closing our end lets the read fail if slirp4netns exits
+	readyW.Close()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			<-done
+			return fmt.Errorf("exited before being ready: %s", strings.TrimSpace(stderr.String()))
+		}
+	case err := <-done:
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	case <-time.After(readyTimeout):
+		n.done = done
+		return fmt.Errorf("timeout while waiting for the network namespace configuration")
+	}
+	n.done = done
+
+	for _, p := range n.Ports {
+		if err := slirpAddHostFwd(socket, p); err != nil {
+			return fmt.Errorf("while forwarding port %s: %s", p, err)
+		}
+	}
+	return nil
+}
+
+// slirpRequest is a request of the slirp4netns API.
+type slirpRequest struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+// slirpHostFwd are the arguments of the add_hostfwd request.
+type slirpHostFwd struct {
+	Proto     string `json:"proto"`
+	HostAddr  string `json:"host_addr"`
+	HostPort  int    `json:"host_port"`
+	GuestPort int    `json:"guest_port"`
+}
+
+// slirpResponse is a response of the slirp4netns API.
+type slirpResponse struct {
+	Return map[string]interface{} `json:"return,omitempty"`
+	Error  *struct {
+		Desc string `json:"desc"`
+	} `json:"error,omitempty"`
+}
+
+// slirpAddHostFwd forwards the host port of p to the container with the
+// slirp4netns API socket.
+func slirpAddHostFwd(socket string, p network.PortMapEntry) error {
+	hostAddr := p.HostIP
+	if hostAddr == "" {
+		hostAddr = "0.0.0.0"
+	}
+	req := slirpRequest{
+		Execute: "add_hostfwd",
+		Arguments: slirpHostFwd{
+			Proto:     p.Protocol,
+			HostAddr:  hostAddr,
+			HostPort:  p.HostPort,
+			GuestPort: p.ContainerPort,
+		},
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return err
+	}
+	// slirp4netns handles the request once the write side is closed
+	if err := conn.(*net.UnixConn).CloseWrite(); err != nil {
+		return err
+	}
+
+	var res slirpResponse
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		return fmt.Errorf("while decoding response: %s", err)
+	}
+	if res.Error != nil {
+		return errors.New(res.Error.Desc)
+	}
+	return nil
+}
+
+// procNet is the directory holding the network information of the network
+// namespace of a process.
+var procNet = "/proc/%d/net"
+
+// Addresses returns the IPv4 and IPv6 addresses of the container, as
+// configured by the backend in its network namespace. Link local and
+// loopback addresses are ignored.
+func (n *Network) Addresses() (string, string, error) {
+	dir := fmt.Sprintf(procNet, n.pid)
+
+	f, err := os.Open(filepath.Join(dir, "fib_trie"))
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	ipv4 := parseFibTrie(f)
+
+	ipv6 := []string{}
+	if f6, err := os.Open(filepath.Join(dir, "if_inet6")); err == nil {
+		defer f6.Close()
+		ipv6 = parseIfInet6(f6)
+	}
+
+	var v4, v6 string
+	if len(ipv4) > 0 {
+		v4 = ipv4[0]
+	}
+	if len(ipv6) > 0 {
+		v6 = ipv6[0]
+	}
+	return v4, v6, nil
+}
+
+// parseFibTrie returns the local IPv4 addresses listed in the fib_trie
+// file r, except the loopback ones.
+func parseFibTrie(r io.Reader) []string {
+	var addrs []string
+
+	last := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 2 && fields[0] == "|--":
+			last = fields[1]
+		case len(fields) == 3 && fields[0] == "/32" && fields[1] == "host" && fields[2] == "LOCAL":
+			ip := net.ParseIP(last)
+			if ip == nil || ip.IsLoopback() || slice.ContainsString(addrs, last) {
+				continue
+			}
+			addrs = append(addrs, last)
+		}
+	}
+	return addrs
+}
+
+// parseIfInet6 returns the global IPv6 addresses listed in the if_inet6
+// file r.
+func parseIfInet6(r io.Reader) []string {
+	var addrs []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// address, interface index, prefix length, scope, flags and
+		// interface name
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 6 || len(fields[0]) != 32 || fields[3] != "00" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[0])
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, net.IP(b).String())
+	}
+	return addrs
+}
+
+// Stop stops the backend, releasing the forwarded host ports.
+func (n *Network) Stop() error {
+	var err error
+
+	if n.exitFd != nil {
+		// slirp4netns exits when its exit file descriptor is closed
+		err = n.exitFd.Close()
+		n.exitFd = nil
+	}
+	if n.done != nil {
+		// wait for the forwarded ports to be released
+		select {
+		case <-n.done:
+		case <-time.After(readyTimeout):
+			sylog.Warningf("%s didn't exit after %s", n.Backend, readyTimeout)
+		}
+		n.done = nil
+	}
+	if n.pidFile != "" {
+		if err = killPidFile(n.pidFile); errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		n.pidFile = ""
+	}
+	if n.tmpDir != "" {
+		os.RemoveAll(n.tmpDir)
+		n.tmpDir = ""
+	}
+	return err
+}
+
+// killPidFile terminates the process whose PID is written in path.
+func killPidFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return fmt.Errorf("invalid PID in %s: %s", path, err)
+	}
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package rootless
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/apptainer/pkg/network"
+)
+
+func TestFindBackend(t *testing.T) {
+	if _, _, err := FindBackend("vde"); err == nil {
+		t.Errorf("unexpected success with an unknown backend")
+	}
+	// the backends may not be installed, but the result must be consistent,
+	// pasta falling back to slirp4netns
+	for _, pref := range []string{Auto, Pasta} {
+		name, path, err := FindBackend(pref)
+		if err == nil && (name != Pasta && name != Slirp4netns || path == "") {
+			t.Errorf("unexpected backend %q at %q for %s", name, path, pref)
+		}
+	}
+}
+
+func TestCheckPorts(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	used := []network.PortMapEntry{{HostPort: port, ContainerPort: 80, Protocol: "tcp", HostIP: "127.0.0.1"}}
+	if err := CheckPorts(used); err == nil {
+		t.Errorf("unexpected success with the used port %d", port)
+	}
+	// the same port number is free for udp
+	used[0].Protocol = "udp"
+	if err := CheckPorts(used); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestPastaArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []network.PortMapEntry
+		dns   []string
+		want  []string
+	}{
+		{
+			name: "NoPorts",
+			want: []string{"-t", "none", "-u", "none", "42"},
+		},
+		{
+			name: "TCP",
+			ports: []network.PortMapEntry{
+				{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+				{HostPort: 8443, ContainerPort: 443, Protocol: "tcp"},
+			},
+			want: []string{"-t", "8080:80", "-t", "8443:443", "-u", "none", "42"},
+		},
+		{
+			name: "UDP",
+			ports: []network.PortMapEntry{
+				{HostPort: 5353, ContainerPort: 53, Protocol: "udp"},
+			},
+			want: []string{"-u", "5353:53", "-t", "none", "42"},
+		},
+		{
+			name: "HostIP",
+			ports: []network.PortMapEntry{
+				{HostPort: 8080, ContainerPort: 80, Protocol: "tcp", HostIP: "::1"},
+			},
+			want: []string{"-t", "::1/8080:80", "-u", "none", "42"},
+		},
+		{
+			name: "DNS",
+			dns:  []string{"1.1.1.1", "2606:4700:4700::1111"},
+			want: []string{"-t", "none", "-u", "none", "--dns", "1.1.1.1", "--dns", "2606:4700:4700::1111", "42"},
+		},
+	}
+
+	common := []string{"--config-net", "--quiet", "--no-map-gw", "--pid", "/pid", "-T", "none", "-U", "none"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pastaArgs(42, "/pid", tt.ports, tt.dns)
+			want := append(append([]string{}, common...), tt.want...)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseFibTrie(t *testing.T) {
+	fibTrie := `Main:
+  +-- 0.0.0.0/0 3 0 5
+     |-- 0.0.0.0
+        /0 universe UNICAST
+     +-- 127.0.0.0/8 2 0 2
+        +-- 127.0.0.0/31 1 0 0
+           |-- 127.0.0.0
+              /8 host LOCAL
+           |-- 127.0.0.1
+              /32 host LOCAL
+     +-- 192.168.1.0/24 2 0 2
+        |-- 192.168.1.0
+           /24 link UNICAST
+        |-- 192.168.1.25
+           /32 host LOCAL
+        |-- 192.168.1.255
+           /32 link BROADCAST
+Local:
+  +-- 0.0.0.0/0 3 0 5
+     +-- 192.168.1.0/24 2 0 2
+        |-- 192.168.1.25
+           /32 host LOCAL
+`
+	want := []string{"192.168.1.25"}
+	if got := parseFibTrie(strings.NewReader(fibTrie)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseIfInet6(t *testing.T) {
+	ifInet6 := `00000000000000000000000000000001 01 80 10 80       lo
+fe80000000000000c8a1b2fffec3d4e5 02 40 20 80     eth0
+fd000000000000000000000000000019 02 40 00 80     eth0
+`
+	want := []string{"fd00::19"}
+	if got := parseIfInet6(strings.NewReader(ifInet6)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	orig := procNet
+	t.Cleanup(func() { procNet = orig })
+	procNet = filepath.Join(t.TempDir(), "%d")
+
+	n := &Network{pid: 42}
+	if _, _, err := n.Addresses(); err == nil {
+		t.Errorf("unexpected success without fib_trie")
+	}
+
+	dir := fmt.Sprintf(procNet, 42)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fibTrie := "Main:\n  |-- 10.0.2.100\n     /32 host LOCAL\n"
+	if err := os.WriteFile(filepath.Join(dir, "fib_trie"), []byte(fibTrie), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// IPv6 may be disabled
+	v4, v6, err := n.Addresses()
+	if err != nil || v4 != "10.0.2.100" || v6 != "" {
+		t.Errorf("got %q %q %v, want 10.0.2.100 without IPv6", v4, v6, err)
+	}
+}
+
+// serveSlirpAPI serves a single request of the slirp4netns API on socket
+// with the response res, sending the decoded request to reqs.
+func serveSlirpAPI(t *testing.T, socket string, res string, reqs chan<- map[string]interface{}) {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// like slirp4netns, read the request until the client closes
+		// the write side
+		b, _ := io.ReadAll(conn)
+		req := make(map[string]interface{})
+		json.Unmarshal(b, &req)
+		reqs <- req
+		conn.Write([]byte(res))
+	}()
+}
+
+func TestSlirpAddHostFwd(t *testing.T) {
+	p := network.PortMapEntry{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}
+
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	reqs := make(chan map[string]interface{}, 1)
+	serveSlirpAPI(t, socket, `{"return": {"id": 1}}`, reqs)
+
+	if err := slirpAddHostFwd(socket, p); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string]interface{}{
+		"execute": "add_hostfwd",
+		"arguments": map[string]interface{}{
+			"proto":      "tcp",
+			"host_addr":  "0.0.0.0",
+			"host_port":  float64(8080),
+			"guest_port": float64(80),
+		},
+	}
+	if got := <-reqs; !reflect.DeepEqual(got, want) {
+		t.Errorf("got request %v, want %v", got, want)
+	}
+
+	socket = filepath.Join(t.TempDir(), "api.sock")
+	serveSlirpAPI(t, socket, `{"error": {"desc": "bad request: add_hostfwd: slirp_add_hostfwd failed"}}`, reqs)
+	if err := slirpAddHostFwd(socket, p); err == nil {
+		t.Errorf("unexpected success with an error response")
+	}
+}
@@ -11,7 +11,7 @@ package plugin
 
 import (
 	"crypto/sha256"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -22,7 +22,7 @@ import (
 )
 
 // Install installs a plugin from a SIF image under rootDir. It will:
-//  1. Check that the SIF is a valid plugin
+//  1. Check that the SIF is a valid plugin, compatible with apptainer
 //  2. Use name from Manifest and calculate the installation path
 //  3. Copy the SIF into the plugin path
 //  4. Extract the binary object into the path
@@ -56,12 +56,27 @@ func Install(sifPath string) error {
 		return fmt.Errorf("plugin manifest name %q contains path traversal", manifest.Name)
 	}
 
+	compat, err := getCompat(img)
+	if errors.Is(err, errNoCompat) {
+		sylog.Warningf("Plugin %s has no compatibility manifest, recompile it with this version of apptainer if it fails to load", manifest.Name)
+	} else if err != nil {
+		return fmt.Errorf("could not get compatibility manifest: %s", err)
+	} else {
+		host, err := HostCompatibility()
+		if err != nil {
+			return err
+		}
+		if err := compat.Check(host); err != nil {
+			return fmt.Errorf("plugin %s is not compatible with this apptainer, recompile it with 'apptainer plugin compile': %s", manifest.Name, err)
+		}
+	}
+
 	m := &Meta{
 		Name:    manifest.Name,
 		Enabled: true,
 	}
 
-	err = m.install(img)
+	err = m.install(img, compat)
 	if err != nil {
 		return fmt.Errorf("could not install plugin: %w", err)
 	}
@@ -84,7 +99,9 @@ func Uninstall(name string) error {
 }
 
 // List returns all the apptainer plugins installed in
-// rootDir in the form of a list of Meta information.
+// rootDir in the form of a list of Meta information, with
+// the plugins enabled or disabled by the user if UseUserState
+// was called.
 func List() ([]*Meta, error) {
 	pattern := filepath.Join(rootDir, "*.meta")
 	entries, err := filepath.Glob(pattern)
@@ -112,6 +129,7 @@ func List() ([]*Meta, error) {
 
 		metas = append(metas, meta)
 	}
+	applyUserState(metas)
 
 	return metas, nil
 }
@@ -181,29 +199,18 @@ func Inspect(name string) (pluginapi.Manifest, error) {
 			return manifest, err
 		}
 
-		// Replace the original name, which seems to be
-		// the name of a plugin, by the path to the
-		// installed manifest file for that plugin.
-		data, err := os.ReadFile(meta.manifestName())
-		if err != nil {
-			return manifest, err
-		}
-		if err := json.Unmarshal(data, &manifest); err != nil {
-			return manifest, err
-		}
-	} else {
-		// at this point, either the file is there under the original
-		// name or we found one by looking at the metafile.
-		img, err := image.Init(name, false)
-		if err != nil {
-			return manifest, fmt.Errorf("could not load plugin: %w", err)
-		} else if !isPluginFile(img) {
-			return manifest, fmt.Errorf("%s is not a valid plugin", name)
-		}
-		return getManifest(img)
+		// Read the installed manifest file for that plugin.
+		return meta.manifest()
 	}
 
-	return manifest, nil
+	// at this point, the file is there under the original name.
+	img, err := image.Init(name, false)
+	if err != nil {
+		return manifest, fmt.Errorf("could not load plugin: %w", err)
+	} else if !isPluginFile(img) {
+		return manifest, fmt.Errorf("%s is not a valid plugin", name)
+	}
+	return getManifest(img)
 }
 
 //
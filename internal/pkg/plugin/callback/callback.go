@@ -11,14 +11,25 @@ package callback
 
 import (
 	"fmt"
+	"sort"
 	"unsafe"
 
 	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
 )
 
+// Entry is a callback registered by a loaded plugin.
+type Entry struct {
+	// Plugin is the name of the plugin registering the callback.
+	Plugin string
+	// Priority is the priority of the plugin.
+	Priority int
+	// Callback is the callback function.
+	Callback pluginapi.Callback
+}
+
 // pluginCallback contains hook callbacks function registered
-// by loaded plugins.
-var pluginCallbacks = make(map[string][]pluginapi.Callback)
+// by loaded plugins, ordered by plugin priority.
+var pluginCallbacks = make(map[string][]Entry)
 
 // sameType compares if the two interfaces have the same type.
 func sameType(a interface{}, b interface{}) bool {
@@ -30,27 +41,48 @@ func sameType(a interface{}, b interface{}) bool {
 // Loaded returns the loaded plugin callbacks of callback
 // type passed in argument.
 func Loaded(callbackType pluginapi.Callback) ([]pluginapi.Callback, error) {
-	callbacks := pluginCallbacks[Name(callbackType)]
+	entries, err := LoadedEntries(callbackType)
+	if err != nil {
+		return nil, err
+	}
+
+	callbacks := make([]pluginapi.Callback, 0, len(entries))
+	for _, e := range entries {
+		callbacks = append(callbacks, e.Callback)
+	}
+
+	return callbacks, nil
+}
+
+// LoadedEntries returns the loaded plugin callbacks of callback
+// type passed in argument along with the plugins registering them.
+func LoadedEntries(callbackType pluginapi.Callback) ([]Entry, error) {
+	entries := pluginCallbacks[Name(callbackType)]
 
 	// we ensure the plugin callback correspond to the registered callback
-	for _, callback := range callbacks {
-		if !sameType(callbackType, callback) {
-			return nil, fmt.Errorf("plugin callback has type '%T' instead of '%T'", callback, callbackType)
+	for _, e := range entries {
+		if !sameType(callbackType, e.Callback) {
+			return nil, fmt.Errorf("plugin %s callback has type '%T' instead of '%T'", e.Plugin, e.Callback, callbackType)
 		}
 	}
 
-	return callbacks, nil
+	return entries, nil
 }
 
-// Load loads a plugin callback.
-func Load(callback pluginapi.Callback) {
+// Load loads a plugin callback of the plugin described by manifest.
+func Load(manifest pluginapi.Manifest, callback pluginapi.Callback) {
 	name := Name(callback)
 
-	if pluginCallbacks[name] == nil {
-		pluginCallbacks[name] = make([]pluginapi.Callback, 0)
-	}
+	entries := append(pluginCallbacks[name], Entry{
+		Plugin:   manifest.Name,
+		Priority: manifest.Priority,
+		Callback: callback,
+	})
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Priority < entries[j].Priority
+	})
 
-	pluginCallbacks[name] = append(pluginCallbacks[name], callback)
+	pluginCallbacks[name] = entries
 }
 
 // Names returns a list of unique callback name passed in argument.
@@ -0,0 +1,167 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+)
+
+// SDKModule is the path of the Go module providing the plugin SDK, the
+// pkg/plugin package and the callback interfaces.
+const SDKModule = "github.com/apptainer/apptainer"
+
+// compatSettings are the build settings which must be identical for the
+// apptainer binary and the plugin objects for the Go runtime to load them.
+var compatSettings = []string{
+	"-compiler", "-tags", "-trimpath", "-race", "-msan", "-asan",
+	"CGO_ENABLED", "GOOS", "GOARCH",
+	"GO386", "GOAMD64", "GOARM", "GOARM64", "GOMIPS", "GOMIPS64", "GOPPC64", "GORISCV64",
+}
+
+// releaseVersion matches the apptainer release versions.
+var releaseVersion = regexp.MustCompile(`^\d+\.\d+\.\d+(-rc\.\d+)?$`)
+
+// Compatibility is the compatibility manifest of a plugin, recording the
+// SDK version, Go version and build settings the plugin object was
+// compiled with, and the versions of the modules it is linked with.
+type Compatibility struct {
+	// SDKVersion is the version of apptainer the plugin was compiled for.
+	SDKVersion string `json:"sdkVersion"`
+	// GoVersion is the version of the Go toolchain.
+	GoVersion string `json:"goVersion"`
+	// Settings are the build settings relevant to the compatibility.
+	Settings map[string]string `json:"settings"`
+	// Modules maps the paths of the modules linked to their versions
+	// and checksums.
+	Modules map[string]string `json:"modules"`
+}
+
+// newCompatibility returns the compatibility manifest of the build info bi
+// for the apptainer version sdkVersion.
+func newCompatibility(bi *debug.BuildInfo, sdkVersion string) *Compatibility {
+	c := &Compatibility{
+		SDKVersion: sdkVersion,
+		GoVersion:  bi.GoVersion,
+		Settings:   make(map[string]string),
+		Modules:    make(map[string]string),
+	}
+
+	for _, s := range bi.Settings {
+		for _, key := range compatSettings {
+			if s.Key != key {
+				continue
+			}
+			value := s.Value
+			if key == "-tags" {
+				tags := strings.Split(value, ",")
+				sort.Strings(tags)
+				value = strings.Join(tags, ",")
+			}
+			c.Settings[key] = value
+		}
+	}
+
+	for _, dep := range bi.Deps {
+		if dep.Path == SDKModule {
+			continue
+		}
+		m := dep
+		if dep.Replace != nil {
+			m = dep.Replace
+		}
+		c.Modules[dep.Path] = strings.TrimSpace(m.Path + "@" + m.Version + " " + m.Sum)
+	}
+
+	return c
+}
+
+// HostCompatibility returns the compatibility manifest of the running
+// apptainer binary.
+func HostCompatibility() (*Compatibility, error) {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil, fmt.Errorf("no build information embedded in apptainer")
+	}
+	return newCompatibility(bi, buildcfg.PACKAGE_VERSION), nil
+}
+
+// ReadCompatibility returns the compatibility manifest of the plugin
+// object path, compiled by this version of apptainer.
+func ReadCompatibility(path string) (*Compatibility, error) {
+	bi, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("while reading build information of %s: %w", path, err)
+	}
+	return newCompatibility(bi, buildcfg.PACKAGE_VERSION), nil
+}
+
+// Check returns an error describing the differences preventing a plugin
+// with the compatibility manifest c to be loaded by the apptainer binary
+// with the compatibility manifest host.
+func (c *Compatibility) Check(host *Compatibility) error {
+	var diffs []string
+
+	if c.SDKVersion != host.SDKVersion {
+		diffs = append(diffs, fmt.Sprintf("compiled for apptainer %s, running %s", c.SDKVersion, host.SDKVersion))
+	}
+	if c.GoVersion != host.GoVersion {
+		diffs = append(diffs, fmt.Sprintf("compiled with %s, apptainer compiled with %s", c.GoVersion, host.GoVersion))
+	}
+	for _, key := range compatSettings {
+		if c.Settings[key] != host.Settings[key] {
+			diffs = append(diffs, fmt.Sprintf("build setting %s is %q, apptainer has %q", key, c.Settings[key], host.Settings[key]))
+		}
+	}
+
+	paths := make([]string, 0, len(c.Modules))
+	for path := range c.Modules {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if hv, ok := host.Modules[path]; ok && hv != c.Modules[path] {
+			diffs = append(diffs, fmt.Sprintf("module %s is %s, apptainer has %s", path, c.Modules[path], hv))
+		}
+	}
+
+	if len(diffs) > 0 {
+		return fmt.Errorf("%s", strings.Join(diffs, "; "))
+	}
+	return nil
+}
+
+// SDKVersion returns the version of the SDKModule matching the running
+// apptainer binary, which can be fetched from the Go module proxy, or an
+// empty string for development builds.
+func SDKVersion() string {
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Path == SDKModule {
+		v := bi.Main.Version
+		if v != "" && v != "(devel)" && !strings.HasSuffix(v, "+dirty") {
+			return v
+		}
+	}
+	if releaseVersion.MatchString(buildcfg.PACKAGE_VERSION) {
+		return "v" + buildcfg.PACKAGE_VERSION
+	}
+	return ""
+}
+
+// SDKDir returns the directory where a copy of the SDKModule matching the
+// apptainer binary is installed by 'make install-plugin-sdk'.
+func SDKDir() string {
+	return filepath.Join(filepath.Dir(buildcfg.PLUGIN_ROOTDIR), "plugin-sdk")
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func testBuildInfo() *debug.BuildInfo {
+	return &debug.BuildInfo{
+		GoVersion: "go1.21.0",
+		Main:      debug.Module{Path: SDKModule, Version: "(devel)"},
+		Deps: []*debug.Module{
+			{Path: SDKModule, Version: "v1.2.0"},
+			{Path: "github.com/spf13/cobra", Version: "v1.7.0", Sum: "h1:cobra"},
+			{Path: "oras.land/oras-go", Version: "v1.2.3", Replace: &debug.Module{Path: "github.com/sylabs/oras-go", Version: "v1.2.4"}},
+		},
+		Settings: []debug.BuildSetting{
+			{Key: "-tags", Value: "sylog,apptainer_engine"},
+			{Key: "-trimpath", Value: "true"},
+			{Key: "-ldflags", Value: "-X main.PluginRootDir=/plugins"},
+			{Key: "GOARCH", Value: "amd64"},
+		},
+	}
+}
+
+func TestNewCompatibility(t *testing.T) {
+	c := newCompatibility(testBuildInfo(), "1.2.0")
+
+	if _, ok := c.Modules[SDKModule]; ok {
+		t.Errorf("SDK module recorded in modules")
+	}
+	if got, want := c.Modules["oras.land/oras-go"], "github.com/sylabs/oras-go@v1.2.4"; got != want {
+		t.Errorf("got replaced module %q, want %q", got, want)
+	}
+	if got, want := c.Settings["-tags"], "apptainer_engine,sylog"; got != want {
+		t.Errorf("got tags %q, want %q", got, want)
+	}
+	if _, ok := c.Settings["-ldflags"]; ok {
+		t.Errorf("unexpected -ldflags build setting")
+	}
+}
+
+func TestCompatibilityCheck(t *testing.T) {
+	host := newCompatibility(testBuildInfo(), "1.2.0")
+
+	tests := []struct {
+		name    string
+		modify  func(bi *debug.BuildInfo)
+		sdk     string
+		wantErr bool
+	}{
+		{name: "Compatible", modify: func(*debug.BuildInfo) {}, sdk: "1.2.0"},
+		{
+			name: "TagsOrder",
+			modify: func(bi *debug.BuildInfo) {
+				bi.Settings[0].Value = "apptainer_engine,sylog"
+			},
+			sdk: "1.2.0",
+		},
+		{
+			name: "PluginOnlyModule",
+			modify: func(bi *debug.BuildInfo) {
+				bi.Deps = append(bi.Deps, &debug.Module{Path: "example.com/lib", Version: "v0.1.0"})
+			},
+			sdk: "1.2.0",
+		},
+		{name: "SDKVersion", modify: func(*debug.BuildInfo) {}, sdk: "1.1.0", wantErr: true},
+		{
+			name: "GoVersion",
+			modify: func(bi *debug.BuildInfo) {
+				bi.GoVersion = "go1.20.0"
+			},
+			sdk:     "1.2.0",
+			wantErr: true,
+		},
+		{
+			name: "Trimpath",
+			modify: func(bi *debug.BuildInfo) {
+				bi.Settings = bi.Settings[:1]
+			},
+			sdk:     "1.2.0",
+			wantErr: true,
+		},
+		{
+			name: "ModuleVersion",
+			modify: func(bi *debug.BuildInfo) {
+				bi.Deps[1] = &debug.Module{Path: "github.com/spf13/cobra", Version: "v1.8.0", Sum: "h1:cobra18"}
+			},
+			sdk:     "1.2.0",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bi := testBuildInfo()
+			tt.modify(bi)
+			err := newCompatibility(bi, tt.sdk).Check(host)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
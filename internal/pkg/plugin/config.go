@@ -0,0 +1,350 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+	"gopkg.in/yaml.v3"
+)
+
+// configDir is the directory holding the system configuration files of
+// the plugins.
+var configDir = filepath.Join(buildcfg.APPTAINER_CONFDIR, "plugins")
+
+// errInvalidConfig is returned when the configuration of a plugin fails
+// to load, the plugin binary isn't at fault.
+var errInvalidConfig = errors.New("invalid configuration")
+
+// userConfigDir is the directory holding the configuration files of the
+// plugins set by the user, taking precedence over the system ones.
+var userConfigDir string
+
+// configDefaults holds the default configuration of the loaded plugins,
+// before their configuration files are decoded into it.
+var configDefaults sync.Map
+
+// UseUserConfig reads the configuration files of the plugins set by the
+// user in dir on top of the system ones. Like the user state, it only
+// applies to the calling process.
+func UseUserConfig(dir string) {
+	userConfigDir = dir
+}
+
+// ConfigPath returns the path of the configuration file of the plugin
+// named "name" in the directory dir, the system one if dir is empty.
+func ConfigPath(name, dir string) string {
+	if dir == "" {
+		dir = configDir
+	}
+	return filepath.Join(dir, name+".yaml")
+}
+
+// readConfigFile returns the configuration values of the file path, an
+// empty configuration if it doesn't exist.
+func readConfigFile(path string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("while decoding %s: %s", path, err)
+	}
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	return values, nil
+}
+
+// readConfig returns the configuration values of the plugin named "name",
+// the values of the user configuration file in userDir, if set, taking
+// precedence over the system ones.
+func readConfig(name, userDir string) (map[string]interface{}, error) {
+	values, err := readConfigFile(ConfigPath(name, ""))
+	if err != nil {
+		return nil, err
+	}
+	if userDir == "" {
+		return values, nil
+	}
+	user, err := readConfigFile(ConfigPath(name, userDir))
+	if err != nil {
+		return nil, err
+	}
+	mergeConfig(values, user)
+	return values, nil
+}
+
+// mergeConfig merges the configuration values src into dst, the values of
+// src taking precedence. Nested mappings are merged recursively, any other
+// value, including sequences, is replaced.
+func mergeConfig(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcOk := v.(map[string]interface{})
+		dstMap, dstOk := dst[k].(map[string]interface{})
+		if srcOk && dstOk {
+			mergeConfig(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// decodeConfig decodes the configuration values into the plugin
+// configuration cfg, rejecting the unknown keys, and validates it.
+func decodeConfig(values map[string]interface{}, cfg interface{}) error {
+	if v := reflect.ValueOf(cfg); v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("plugin configuration of type %T is not a pointer to a structure", cfg)
+	}
+
+	if len(values) > 0 {
+		data, err := yaml.Marshal(values)
+		if err != nil {
+			return err
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := cfg.(pluginapi.ConfigValidator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// defaultConfig returns a copy of the default configuration of the plugin
+// p, as set before its configuration files were decoded.
+func defaultConfig(p *pluginapi.Plugin) interface{} {
+	v, _ := configDefaults.LoadOrStore(p, copyConfig(p.Config))
+	return copyConfig(v)
+}
+
+// copyConfig returns a shallow copy of the configuration cfg.
+func copyConfig(cfg interface{}) interface{} {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr {
+		return cfg
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface()
+}
+
+// loadConfig decodes the configuration files of the plugin p into its
+// configuration, if it takes any.
+func loadConfig(p *pluginapi.Plugin) error {
+	values, err := readConfig(p.Manifest.Name, userConfigDir)
+	if err == nil && p.Config == nil {
+		if len(values) > 0 {
+			err = fmt.Errorf("plugin doesn't take any configuration")
+		}
+	} else if err == nil {
+		// keep the defaults for the validation of the configuration changes
+		defaultConfig(p)
+		err = decodeConfig(values, p.Config)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", errInvalidConfig, err)
+	}
+	return nil
+}
+
+// setConfigKey sets the value of the dotted key in the configuration
+// values, creating the intermediate mappings.
+func setConfigKey(values map[string]interface{}, key string, value interface{}) error {
+	parts := strings.Split(key, ".")
+	for i, p := range parts[:len(parts)-1] {
+		if p == "" {
+			return fmt.Errorf("invalid key %q", key)
+		}
+		v, ok := values[p]
+		if !ok {
+			v = make(map[string]interface{})
+			values[p] = v
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not a mapping", strings.Join(parts[:i+1], "."))
+		}
+		values = m
+	}
+	last := parts[len(parts)-1]
+	if last == "" {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	values[last] = value
+	return nil
+}
+
+// unsetConfigKey removes the dotted key from the configuration values,
+// along with the mappings left empty.
+func unsetConfigKey(values map[string]interface{}, key string) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) == 1 {
+		delete(values, key)
+		return
+	}
+	if m, ok := values[parts[0]].(map[string]interface{}); ok {
+		unsetConfigKey(m, parts[1])
+		if len(m) == 0 {
+			delete(values, parts[0])
+		}
+	}
+}
+
+// parseConfigSet parses a key=value configuration setting, the value is
+// decoded as YAML to be typed.
+func parseConfigSet(set string) (string, interface{}, error) {
+	key, str, ok := strings.Cut(set, "=")
+	if !ok || key == "" {
+		return "", nil, fmt.Errorf("invalid setting %q, expected key=value", set)
+	}
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(str), &value); err != nil {
+		return "", nil, fmt.Errorf("invalid value for %s: %s", key, err)
+	}
+	return key, value, nil
+}
+
+// loadConfigObject loads the installed plugin named "name" to check its
+// configuration.
+func loadConfigObject(name string) (*pluginapi.Plugin, error) {
+	m, err := loadMetaByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkCompat(); err != nil {
+		return nil, fmt.Errorf("not compatible with this apptainer, it must be recompiled: %s", err)
+	}
+	return LoadObject(m.binaryName())
+}
+
+// validateConfig checks the configuration values of the plugin p.
+func validateConfig(p *pluginapi.Plugin, values map[string]interface{}) error {
+	if p.Config == nil {
+		if len(values) > 0 {
+			return fmt.Errorf("plugin %s doesn't take any configuration", p.Manifest.Name)
+		}
+		return nil
+	}
+	return decodeConfig(values, defaultConfig(p))
+}
+
+// Configure sets and unsets the keys of the configuration file of the
+// installed plugin named "name", the user one in userDir if set, or the
+// system one. The resulting configuration is validated before the file
+// is written, and the file is removed once empty.
+func Configure(name, userDir string, set, unset []string) error {
+	p, err := loadConfigObject(name)
+	if err != nil {
+		return err
+	}
+
+	path := ConfigPath(name, userDir)
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	for _, s := range set {
+		key, value, err := parseConfigSet(s)
+		if err != nil {
+			return err
+		}
+		if err := setConfigKey(values, key, value); err != nil {
+			return err
+		}
+	}
+	for _, key := range unset {
+		unsetConfigKey(values, key)
+	}
+
+	// the user configuration is validated on top of the system one
+	merged := values
+	if userDir != "" {
+		merged, err = readConfigFile(ConfigPath(name, ""))
+		if err != nil {
+			return err
+		}
+		mergeConfig(merged, values)
+	}
+	if err := validateConfig(p, merged); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidConfig, err)
+	}
+
+	if len(values) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	dirMode, fileMode := os.FileMode(0o755), os.FileMode(0o644)
+	if userDir != "" {
+		dirMode, fileMode = 0o700, 0o600
+	}
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, fileMode)
+}
+
+// ValidateConfig checks the configuration of the installed plugin named
+// "name", merged from the system configuration file and the user one in
+// userDir, if set.
+func ValidateConfig(name, userDir string) error {
+	p, err := loadConfigObject(name)
+	if err != nil {
+		return err
+	}
+	values, err := readConfig(name, userDir)
+	if err != nil {
+		return err
+	}
+	if err := validateConfig(p, values); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidConfig, err)
+	}
+	return nil
+}
+
+// ShowConfig returns the configuration of the installed plugin named
+// "name" as YAML, merged from the system configuration file and the user
+// one in userDir, if set.
+func ShowConfig(name, userDir string) ([]byte, error) {
+	if _, err := loadMetaByName(name); err != nil {
+		return nil, err
+	}
+	values, err := readConfig(name, userDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return yaml.Marshal(values)
+}
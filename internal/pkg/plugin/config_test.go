@@ -0,0 +1,212 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+)
+
+type testConfig struct {
+	Root    string `yaml:"root"`
+	Workers int    `yaml:"workers"`
+	Server  struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+	} `yaml:"server"`
+	Tags []string `yaml:"tags"`
+}
+
+func (c *testConfig) Validate() error {
+	if c.Workers < 1 {
+		return errors.New("workers must be positive")
+	}
+	return nil
+}
+
+func writeConfigFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	orig := configDir
+	configDir = t.TempDir()
+	t.Cleanup(func() { configDir = orig })
+	userDir := t.TempDir()
+
+	name := "example.com/config"
+	writeConfigFile(t, ConfigPath(name, ""), `
+root: /system
+workers: 2
+server:
+  host: system.example.com
+  port: 80
+tags: [a, b]
+`)
+	writeConfigFile(t, ConfigPath(name, userDir), `
+workers: 4
+server:
+  port: 8080
+tags: [c]
+`)
+
+	values, err := readConfig(name, userDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := &testConfig{}
+	if err := decodeConfig(values, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the user values take precedence, mappings are merged and
+	// sequences replaced
+	if cfg.Root != "/system" || cfg.Workers != 4 {
+		t.Errorf("unexpected root %q and workers %d", cfg.Root, cfg.Workers)
+	}
+	if cfg.Server.Host != "system.example.com" || cfg.Server.Port != 8080 {
+		t.Errorf("unexpected server %+v", cfg.Server)
+	}
+	if !reflect.DeepEqual(cfg.Tags, []string{"c"}) {
+		t.Errorf("unexpected tags %v", cfg.Tags)
+	}
+
+	// without the user configuration
+	values, err = readConfig(name, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if values["workers"] != 2 {
+		t.Errorf("unexpected system workers %v", values["workers"])
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		cfg     interface{}
+		wantErr bool
+	}{
+		{
+			name:   "Defaults",
+			values: map[string]interface{}{},
+			cfg:    &testConfig{Workers: 1},
+		},
+		{
+			name:   "Valid",
+			values: map[string]interface{}{"workers": 3, "server": map[string]interface{}{"port": 80}},
+			cfg:    &testConfig{},
+		},
+		{
+			name:    "UnknownKey",
+			values:  map[string]interface{}{"workers": 3, "unknown": true},
+			cfg:     &testConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "UnknownNestedKey",
+			values:  map[string]interface{}{"workers": 3, "server": map[string]interface{}{"unknown": true}},
+			cfg:     &testConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "WrongType",
+			values:  map[string]interface{}{"workers": "many"},
+			cfg:     &testConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "Validate",
+			values:  map[string]interface{}{"workers": 0},
+			cfg:     &testConfig{Workers: 1},
+			wantErr: true,
+		},
+		{
+			name:    "NotPointer",
+			values:  map[string]interface{}{},
+			cfg:     testConfig{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decodeConfig(tt.values, tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultConfig(t *testing.T) {
+	p := &pluginapi.Plugin{Config: &testConfig{Workers: 1}}
+
+	if err := decodeConfig(map[string]interface{}{"workers": 5}, defaultConfig(p)); err != nil {
+		t.Fatal(err)
+	}
+	if err := decodeConfig(map[string]interface{}{"workers": 8}, p.Config); err != nil {
+		t.Fatal(err)
+	}
+
+	// the defaults are recorded once, before the configuration is decoded
+	if cfg := defaultConfig(p).(*testConfig); cfg.Workers != 1 {
+		t.Errorf("got default workers %d, want 1", cfg.Workers)
+	}
+}
+
+func TestSetConfigKey(t *testing.T) {
+	values := map[string]interface{}{"root": "/srv"}
+
+	for _, s := range []string{"workers=4", "server.port=8080", "server.host=example.com", "tags=[a, b]"} {
+		key, value, err := parseConfigSet(s)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", s, err)
+		}
+		if err := setConfigKey(values, key, value); err != nil {
+			t.Fatalf("unexpected error for %s: %v", s, err)
+		}
+	}
+	want := map[string]interface{}{
+		"root":    "/srv",
+		"workers": 4,
+		"server":  map[string]interface{}{"port": 8080, "host": "example.com"},
+		"tags":    []interface{}{"a", "b"},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+
+	if err := setConfigKey(values, "root.sub", 1); err == nil {
+		t.Errorf("unexpected success setting a key below a scalar")
+	}
+	if _, _, err := parseConfigSet("workers"); err == nil {
+		t.Errorf("unexpected success parsing a setting without value")
+	}
+
+	unsetConfigKey(values, "server.port")
+	unsetConfigKey(values, "server.host")
+	unsetConfigKey(values, "tags")
+	unsetConfigKey(values, "missing.key")
+	want = map[string]interface{}{"root": "/srv", "workers": 4}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
 
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -50,6 +52,16 @@ func installCallback(path string) error {
 // Write plugin callbacks here and register them in Callbacks
 `
 
+const goMod = `module %s
+
+go %s
+
+require %s v0.0.0-00010101000000-000000000000
+`
+
+// goVersionRegexp matches the language version of a Go toolchain version.
+var goVersionRegexp = regexp.MustCompile(`^go(\d+\.\d+)`)
+
 const gitIgnore = `apptainer_source
 *.sif
 *.o
@@ -79,6 +91,14 @@ func Create(path, name string) error {
 		return fmt.Errorf("while creating plugin %s: %s", filename, err)
 	}
 
+	// create go.mod skeleton, the plugin SDK module matching
+	// apptainer is provided by 'plugin compile'
+	filename = filepath.Join(dir, "go.mod")
+	content = fmt.Sprintf(goMod, name, goVersion(), SDKModule)
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("while creating plugin %s: %s", filename, err)
+	}
+
 	// create .gitignore skeleton
 	filename = filepath.Join(dir, ".gitignore")
 	if err := os.WriteFile(filename, []byte(gitIgnore), 0o644); err != nil {
@@ -109,3 +129,12 @@ func Create(path, name string) error {
 
 	return nil
 }
+
+// goVersion returns the language version of the Go toolchain apptainer
+// was compiled with, for the go directive of the plugin go.mod.
+func goVersion() string {
+	if m := goVersionRegexp.FindStringSubmatch(runtime.Version()); m != nil {
+		return m[1]
+	}
+	return "1.21"
+}
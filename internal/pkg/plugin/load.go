@@ -13,16 +13,17 @@ import (
 	"errors"
 	"fmt"
 	"plugin"
-	"strings"
 	"sync"
 
 	"github.com/apptainer/apptainer/internal/pkg/plugin/callback"
 	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+	"github.com/apptainer/apptainer/pkg/sylog"
 )
 
 type loadedPlugins struct {
 	metas   []*Meta
 	plugins map[string]struct{}
+	failed  map[string]bool
 	sync.Mutex
 }
 
@@ -30,13 +31,34 @@ var lp loadedPlugins
 
 // LoadCallbacks loads plugins registered for the hook instance passed in parameter.
 func LoadCallbacks(cb pluginapi.Callback) ([]pluginapi.Callback, error) {
-	callbackName := callback.Name(cb)
+	if err := loadPlugins(cb); err != nil {
+		return nil, err
+	}
+	return callback.Loaded(cb)
+}
 
-	if err := initMetaPlugin(); err != nil {
+// LoadCallbackEntries loads plugins registered for the hook instance passed
+// in parameter, and returns their callbacks along with the plugins names.
+func LoadCallbackEntries(cb pluginapi.Callback) ([]callback.Entry, error) {
+	if err := loadPlugins(cb); err != nil {
 		return nil, err
 	}
+	return callback.LoadedEntries(cb)
+}
+
+// loadPlugins loads the enabled plugins registered for the hook instance
+// passed in parameter. A plugin failing to load, typically because it's
+// not compatible with this apptainer, is disabled with a warning.
+func loadPlugins(cb pluginapi.Callback) error {
+	if noPlugins {
+		return nil
+	}
 
-	var errs []error
+	callbackName := callback.Name(cb)
+
+	if err := initMetaPlugin(); err != nil {
+		return err
+	}
 
 	for _, meta := range lp.metas {
 		if !meta.Enabled {
@@ -45,45 +67,13 @@ func LoadCallbacks(cb pluginapi.Callback) ([]pluginapi.Callback, error) {
 
 		for _, name := range meta.Callbacks {
 			if name == callbackName {
-				if err := loadCallbacks(meta.binaryName()); err != nil {
-					// This might be destroying information by
-					// grabbing only the textual description of the
-					// error
-					wrappedErr := fmt.Errorf("while initializing plugin %q: %s", meta.Name, err)
-					errs = append(errs, wrappedErr)
-				}
+				loadMeta(meta)
+				break
 			}
 		}
 	}
 
-	if len(errs) > 0 {
-		// Collect all the errors into a single one that can be
-		// returned.
-		//
-		// Beware that we are destroying information that might
-		// be part of the type underlying the error interface we
-		// are getting here. UI-wise this might not be ideal,
-		// because the user might end up seeing a bunch of
-		// errors "slightly" separated by "; ".
-		//
-		// The alternative is to implement a type that collects
-		// the individual errors and implements the error
-		// interface by doing something similar to this. If
-		// there's some code that needs to handle errors in a
-		// more discrete way, it could type-assert an interface
-		// to check if it's possible to obtain the individual
-		// errors.
-		var b strings.Builder
-		for i, err := range errs {
-			if i > 0 {
-				b.WriteString("; ")
-			}
-			b.WriteString(err.Error())
-		}
-		return nil, errors.New(b.String())
-	}
-
-	return callback.Loaded(cb)
+	return nil
 }
 
 // initMetaPlugin reads plugin metadata files and stores data
@@ -100,6 +90,9 @@ func initMetaPlugin() error {
 	if lp.plugins == nil {
 		lp.plugins = make(map[string]struct{})
 	}
+	if lp.failed == nil {
+		lp.failed = make(map[string]bool)
+	}
 
 	lp.metas, err = List()
 	if err != nil {
@@ -109,24 +102,58 @@ func initMetaPlugin() error {
 	return nil
 }
 
-// loadCallbacks loads the plugin and the plugin callbacks.
-func loadCallbacks(path string) error {
+// loadMeta loads the plugin described by meta and its callbacks, unless
+// it already failed to. An incompatible plugin would fail to load, it's
+// disabled until recompiled for this apptainer.
+func loadMeta(meta *Meta) {
 	lp.Lock()
 	defer lp.Unlock()
 
-	if _, ok := lp.plugins[path]; ok {
-		return nil
+	path := meta.binaryName()
+	if _, ok := lp.plugins[path]; ok || lp.failed[path] {
+		return
 	}
 
+	err := meta.checkCompat()
+	if err != nil {
+		err = fmt.Errorf("not compatible with this apptainer, it must be recompiled: %s", err)
+	} else {
+		err = loadCallbacks(meta.binaryName())
+	}
+	if err != nil {
+		sylog.Warningf("Disabling plugin %q: %s", meta.Name, err)
+		lp.failed[path] = true
+	}
+	// the configuration may be the user one, the plugin itself is fine
+	if !errors.Is(err, errInvalidConfig) {
+		meta.recordError(err)
+	}
+}
+
+// loadCallbacks loads the plugin, its configuration and the plugin
+// callbacks, the loaded plugins lock must be held by the caller.
+func loadCallbacks(path string) (err error) {
+	// a plugin panicking in its initialization must not abort
+	// the command
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("plugin initialization failed: %v", r)
+		}
+	}()
+
 	pl, err := LoadObject(path)
 	if err != nil {
 		return err
 	}
 
+	if err := loadConfig(pl); err != nil {
+		return err
+	}
+
 	lp.plugins[path] = struct{}{}
 
 	for _, c := range pl.Callbacks {
-		callback.Load(c)
+		callback.Load(pl.Manifest, c)
 	}
 
 	return nil
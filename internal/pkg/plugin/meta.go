@@ -21,6 +21,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/plugin/callback"
 	"github.com/apptainer/apptainer/pkg/image"
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
 	"github.com/apptainer/apptainer/pkg/sylog"
 )
 
@@ -32,6 +33,8 @@ var (
 	nameManifest = "object.manifest"
 	// nameBinary is the name of the plugin object
 	nameBinary = "object.so"
+	// nameCompat is the name of the plugin compatibility manifest
+	nameCompat = "object.compat"
 )
 
 // Meta is an internal representation of a plugin binary
@@ -45,6 +48,31 @@ type Meta struct {
 	Enabled bool
 	// Callbacks contains callbacks name registered by the plugin.
 	Callbacks []string
+	// Error is the reason of the last failure to load the plugin.
+	Error string `json:",omitempty"`
+
+	// userState reports whether Enabled was set by the user.
+	userState bool
+}
+
+// Info describes an installed plugin and its state.
+type Info struct {
+	// Name is the name of the plugin.
+	Name string `json:"name"`
+	// Version is the version of the plugin from its manifest.
+	Version string `json:"version"`
+	// Enabled reports whether the plugin is loaded.
+	Enabled bool `json:"enabled"`
+	// User reports whether the plugin was enabled or disabled by the user.
+	User bool `json:"user"`
+	// Compatible reports whether the plugin is compatible with the
+	// running apptainer.
+	Compatible bool `json:"compatible"`
+	// Error is the reason the plugin is not compatible, or of its last
+	// failure to load.
+	Error string `json:"error,omitempty"`
+	// Path is the installation directory of the plugin.
+	Path string `json:"path"`
 }
 
 // loadFromJSON loads a Meta type from an io.Reader containing
@@ -91,7 +119,7 @@ func metaPath(name string) string {
 
 // install installs the plugin represented by m into the plugin installation
 // directory. This should normally only be called in InstallFromSIF.
-func (m *Meta) install(img *image.Image) error {
+func (m *Meta) install(img *image.Image, compat *Compatibility) error {
 	if err := os.MkdirAll(m.path(), 0o755); err != nil {
 		return err
 	}
@@ -102,6 +130,9 @@ func (m *Meta) install(img *image.Image) error {
 	if err := m.installManifest(img); err != nil {
 		return err
 	}
+	if err := m.installCompat(compat); err != nil {
+		return err
+	}
 
 	// must be called before installMeta to also
 	// get plugin callbacks name
@@ -144,6 +175,40 @@ func (m *Meta) installManifest(img *image.Image) error {
 	return err
 }
 
+func (m *Meta) installCompat(compat *Compatibility) error {
+	if compat == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(compat)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.compatName(), data, 0o644)
+}
+
+// checkCompat returns an error if the compatibility manifest of the
+// installed plugin doesn't match the running apptainer binary. Plugins
+// installed without compatibility manifest are not checked.
+func (m *Meta) checkCompat() error {
+	data, err := os.ReadFile(m.compatName())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var compat Compatibility
+	if err := json.Unmarshal(data, &compat); err != nil {
+		return fmt.Errorf("while decoding compatibility manifest: %s", err)
+	}
+	host, err := HostCompatibility()
+	if err != nil {
+		return err
+	}
+	return compat.Check(host)
+}
+
 func (m *Meta) runInstall() error {
 	binary := m.binaryName()
 
@@ -256,6 +321,61 @@ func (m *Meta) uninstallMeta() error {
 	return os.Remove(metaPath(m.Name))
 }
 
+// Info returns the description of the installed plugin m.
+func (m *Meta) Info() Info {
+	info := Info{
+		Name:       m.Name,
+		Enabled:    m.Enabled,
+		User:       m.userState,
+		Compatible: true,
+		Error:      m.Error,
+		Path:       m.path(),
+	}
+	if manifest, err := m.manifest(); err == nil {
+		info.Version = manifest.Version
+	}
+	if err := m.checkCompat(); err != nil {
+		info.Compatible = false
+		info.Error = err.Error()
+	}
+	return info
+}
+
+func (m *Meta) manifest() (pluginapi.Manifest, error) {
+	var manifest pluginapi.Manifest
+
+	data, err := os.ReadFile(m.manifestName())
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(data, &manifest)
+	return manifest, err
+}
+
+// recordError records the reason of the failure to load the plugin in
+// its metadata, or clears it if err is nil. It's a no-op when the plugin
+// installation directory is not writable.
+func (m *Meta) recordError(err error) {
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+	if m.Error == reason {
+		return
+	}
+	m.Error = reason
+
+	// reload the metadata to not record the user state
+	meta, err := loadMetaByName(m.Name)
+	if err != nil {
+		return
+	}
+	meta.Error = reason
+	if err := meta.installMeta(); err != nil {
+		sylog.Debugf("Could not record the error of plugin %q: %s", m.Name, err)
+	}
+}
+
 func (m *Meta) enable() error {
 	m.Enabled = true
 	return m.installMeta()
@@ -274,6 +394,10 @@ func (m *Meta) manifestName() string {
 	return filepath.Join(m.path(), nameManifest)
 }
 
+func (m *Meta) compatName() string {
+	return filepath.Join(m.path(), nameCompat)
+}
+
 func (m *Meta) binaryName() string {
 	return filepath.Join(m.path(), nameBinary)
 }
@@ -11,6 +11,7 @@ package plugin
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 
@@ -26,8 +27,15 @@ const (
 	// pluginManifestName is the name of the plugin manifest within
 	// the SIF file
 	pluginManifestName = "plugin.manifest"
+	// pluginCompatName is the name of the plugin compatibility
+	// manifest within the SIF file
+	pluginCompatName = "plugin.compat"
 )
 
+// errNoCompat is returned by getCompat for plugins compiled by a version
+// of apptainer not recording the compatibility manifest.
+var errNoCompat = errors.New("no compatibility manifest")
+
 // isPluginFile checks if the image.Image contains the sections which
 // make up a valid plugin. A plugin sif file should have the following
 // format:
@@ -38,13 +46,15 @@ const (
 //	  - PartType: sif.PartData
 //	DESCR[1]: Sifmanifest
 //	  - Datatype: sif.DataGenericJSON
+//	DESCR[2]: Sifcompat (optional)
+//	  - Datatype: sif.DataGenericJSON
 func isPluginFile(img *image.Image) bool {
 	if img.Type != image.SIF {
 		return false
 	}
 
 	part, _ := img.GetAllPartitions()
-	if len(part) != 1 || len(img.Sections) != 1 {
+	if len(part) != 1 || len(img.Sections) < 1 || len(img.Sections) > 2 {
 		return false
 	}
 
@@ -66,6 +76,15 @@ func isPluginFile(img *image.Image) bool {
 		return false
 	}
 
+	// check compatibility manifest
+	if len(img.Sections) == 2 {
+		if img.Sections[1].Name != pluginCompatName {
+			return false
+		} else if img.Sections[1].Type != uint32(sif.DataGenericJSON) {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -85,6 +104,26 @@ func getManifest(img *image.Image) (pluginapi.Manifest, error) {
 	return manifest, nil
 }
 
+// getCompat will extract the compatibility manifest from the input
+// FileImage, errNoCompat is returned if the plugin doesn't have one.
+func getCompat(img *image.Image) (*Compatibility, error) {
+	if len(img.Sections) < 2 {
+		return nil, errNoCompat
+	}
+
+	r, err := getCompatReader(img)
+	if err != nil {
+		return nil, err
+	}
+
+	var compat Compatibility
+	if err := json.NewDecoder(r).Decode(&compat); err != nil {
+		return nil, fmt.Errorf("while decoding JSON compatibility manifest: %s", err)
+	}
+
+	return &compat, nil
+}
+
 func getBinaryReader(img *image.Image) (io.Reader, error) {
 	return image.NewPartitionReader(img, pluginBinaryName, -1)
 }
@@ -92,3 +131,7 @@ func getBinaryReader(img *image.Image) (io.Reader, error) {
 func getManifestReader(img *image.Image) (io.Reader, error) {
 	return image.NewSectionReader(img, pluginManifestName, -1)
 }
+
+func getCompatReader(img *image.Image) (io.Reader, error) {
+	return image.NewSectionReader(img, pluginCompatName, -1)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+var (
+	// noPlugins disables the loading of all plugins.
+	noPlugins bool
+	// userStatePath is the path of the file holding the plugins enabled
+	// or disabled by the user, applied on top of the system state.
+	userStatePath string
+)
+
+// DisableLoading disables the loading of all plugins by this process.
+func DisableLoading() {
+	noPlugins = true
+}
+
+// UseUserState applies the plugins enabled or disabled by the user in
+// the state file path when listing and loading plugins. It only applies
+// to the calling process, the engines run by the starter binaries only
+// consider the system state.
+func UseUserState(path string) {
+	userStatePath = path
+}
+
+// ReadUserState returns the enabled state of the plugins set by the user
+// in the state file path, indexed by plugin name.
+func ReadUserState(path string) (map[string]bool, error) {
+	state := make(map[string]bool)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("while decoding %s: %s", path, err)
+	}
+	return state, nil
+}
+
+// EnableUser enables the installed plugin named "name" for the user with
+// the state file path.
+func EnableUser(name, path string) error {
+	return setUserState(name, path, true)
+}
+
+// DisableUser disables the installed plugin named "name" for the user
+// with the state file path.
+func DisableUser(name, path string) error {
+	return setUserState(name, path, false)
+}
+
+func setUserState(name, path string, enabled bool) error {
+	if _, err := loadMetaByName(name); err != nil {
+		return err
+	}
+
+	state, err := ReadUserState(path)
+	if err != nil {
+		return err
+	}
+	if e, ok := state[name]; ok && e == enabled {
+		sylog.Infof("Plugin %q is already %s for the user", name, stateString(enabled))
+		return nil
+	}
+	state[name] = enabled
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// applyUserState sets the enabled state of metas from the user state
+// file, if any.
+func applyUserState(metas []*Meta) {
+	if userStatePath == "" {
+		return
+	}
+
+	state, err := ReadUserState(userStatePath)
+	if err != nil {
+		sylog.Warningf("Ignoring the plugins enabled or disabled by the user: %s", err)
+		return
+	}
+	for _, m := range metas {
+		if enabled, ok := state[m.Name]; ok {
+			m.Enabled = enabled
+			m.userState = true
+		}
+	}
+}
+
+func stateString(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
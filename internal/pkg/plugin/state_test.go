@@ -0,0 +1,108 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupRootDir installs the metadata of the named plugins, all enabled,
+// in a temporary plugin root directory.
+func setupRootDir(t *testing.T, names ...string) {
+	orig := rootDir
+	rootDir = t.TempDir()
+	t.Cleanup(func() {
+		rootDir = orig
+		userStatePath = ""
+	})
+
+	for _, name := range names {
+		m := &Meta{Name: name, Enabled: true}
+		if err := os.MkdirAll(m.path(), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.installMeta(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUserState(t *testing.T) {
+	setupRootDir(t, "example.com/a", "example.com/b")
+	path := filepath.Join(t.TempDir(), "plugins.json")
+
+	if err := DisableUser("example.com/a", path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := DisableUser("example.com/missing", path); err == nil {
+		t.Errorf("unexpected success for a plugin not installed")
+	}
+
+	state, err := ReadUserState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled, ok := state["example.com/a"]; !ok || enabled {
+		t.Errorf("plugin not disabled in the user state: %v", state)
+	}
+
+	// the user state is only applied once requested
+	UseUserState(path)
+	metas, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range metas {
+		user := m.Name == "example.com/a"
+		if m.Enabled == user || m.userState != user {
+			t.Errorf("plugin %s: got enabled %v, user %v", m.Name, m.Enabled, m.userState)
+		}
+	}
+
+	// the system state is left untouched
+	m, err := loadMetaByName("example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Enabled {
+		t.Errorf("plugin disabled in the system state")
+	}
+}
+
+func TestLoadMetaFailure(t *testing.T) {
+	setupRootDir(t, "example.com/broken")
+	lp = loadedPlugins{}
+	t.Cleanup(func() { lp = loadedPlugins{} })
+
+	if err := initMetaPlugin(); err != nil {
+		t.Fatal(err)
+	}
+	m := lp.metas[0]
+	if err := os.WriteFile(m.binaryName(), []byte("not a plugin"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loadMeta(m)
+	if !lp.failed[m.binaryName()] {
+		t.Fatalf("plugin failing to load not disabled")
+	}
+
+	recorded, err := loadMetaByName(m.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.Error == "" {
+		t.Errorf("failure not recorded in the plugin metadata")
+	}
+	if info := recorded.Info(); info.Error == "" || !info.Compatible {
+		t.Errorf("unexpected plugin info %+v", info)
+	}
+}
@@ -31,35 +31,27 @@ func (config *Config) KeyserverClientOpts(uri string, op KeyserverOp) ([]keyClie
 		return nil, err
 	}
 
-	var primaryKeyserver *ServiceConfig
+	var keyservers []*ServiceConfig
+	tlsFiles := config.TLSFiles
 
 	for _, kc := range config.Keyservers {
-		if kc.Skip {
+		if kc.Skip || !kc.Allows(op) {
 			continue
 		}
-		primaryKeyserver = kc
-		break
-	}
-
-	// shouldn't happen
-	if primaryKeyserver == nil {
-		return nil, fmt.Errorf("no primary keyserver configured")
+		keyservers = append(keyservers, kc)
 	}
 
-	var keyservers []*ServiceConfig
-
 	if isDefault {
-		uri = primaryKeyserver.URI
-
-		if op == KeyserverVerifyOp {
-			// verify operation can query multiple keyserver, the token
-			// is automatically set by the custom client
-			keyservers = config.Keyservers
-		} else {
-			// use the primary keyserver
-			keyservers = []*ServiceConfig{
-				primaryKeyserver,
-			}
+		if len(keyservers) == 0 {
+			return nil, fmt.Errorf("no keyserver configured for %s operations", op)
+		}
+		uri = keyservers[0].URI
+
+		// verify operation can query multiple keyserver, the token
+		// is automatically set by the custom client, other operations
+		// use the first keyserver allowing them
+		if op != KeyserverVerifyOp {
+			keyservers = keyservers[:1]
 		}
 	} else if config.Exclusive {
 		available := make([]string, 0)
@@ -70,6 +62,7 @@ func (config *Config) KeyserverClientOpts(uri string, op KeyserverOp) ([]keyClie
 			}
 			available = append(available, kc.URI)
 			if remoteutil.SameKeyserver(uri, kc.URI) {
+				keyservers = []*ServiceConfig{kc}
 				found = true
 				break
 			}
@@ -88,12 +81,20 @@ func (config *Config) KeyserverClientOpts(uri string, op KeyserverOp) ([]keyClie
 				External: true,
 			},
 		}
+		// a keyserver not configured for the endpoint only gets the
+		// site-wide CA bundles
+		tlsFiles = TLSFiles{}
+	}
+
+	tc, err := tlsFiles.tlsConfig(siteCABundles())
+	if err != nil {
+		return nil, err
 	}
 
 	co := []keyClient.Option{
 		keyClient.OptBaseURL(uri),
 		keyClient.OptUserAgent(useragent.Value()),
-		keyClient.OptHTTPClient(newClient(keyservers, op)),
+		keyClient.OptHTTPClient(newClient(keyservers, op, tc)),
 	}
 	return co, nil
 }
@@ -110,6 +111,17 @@ func (config *Config) LibraryClientConfig(uri string) (*libClient.Config, error)
 		HTTPClient: &http.Client{},
 	}
 
+	// a library not configured for the endpoint only gets the site-wide
+	// CA bundles
+	transport, err := siteTransport()
+	if isDefault || config.Exclusive {
+		transport, err = config.HTTPTransport()
+	}
+	if err != nil {
+		return nil, err
+	}
+	libraryConfig.HTTPClient.Transport = transport
+
 	if isDefault {
 		libURI, err := config.GetServiceURI(Library)
 		if err != nil {
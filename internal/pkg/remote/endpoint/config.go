@@ -41,6 +41,8 @@ type Config struct {
 	Exclusive  bool             `yaml:"Exclusive"`          // true if the endpoint must be used exclusively
 	Insecure   bool             `yaml:"Insecure,omitempty"` // Allow use of http for service discovery
 	Keyservers []*ServiceConfig `yaml:"Keyservers,omitempty"`
+	OIDC       *OIDCConfig      `yaml:"OIDC,omitempty"` // OIDC login, the Token being its access token
+	TLSFiles   `yaml:",inline"`
 
 	// for internal purpose
 	credentials []*credential.Config
@@ -80,6 +82,9 @@ type ServiceConfig struct {
 	Skip     bool   `yaml:"Skip"`
 	External bool   `yaml:"External"`
 	Insecure bool   `yaml:"Insecure"`
+	NoPush   bool   `yaml:"NoPush,omitempty"`   // not used to push keys
+	NoSearch bool   `yaml:"NoSearch,omitempty"` // not used to search and pull keys
+	NoVerify bool   `yaml:"NoVerify,omitempty"` // not queried for keys during verification
 }
 
 func cacheDir() string {
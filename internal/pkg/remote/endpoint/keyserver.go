@@ -11,14 +11,19 @@
 package endpoint
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
 	remoteutil "github.com/apptainer/apptainer/internal/pkg/remote/util"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
 )
 
 // KeyserverOp represents a keyserver operation type.
@@ -35,8 +40,62 @@ const (
 	KeyserverVerifyOp
 )
 
-// AddKeyserver adds a keyserver for the corresponding remote endpoint.
-func (config *Config) AddKeyserver(uri string, order uint32, insecure bool) error {
+var (
+	// keyserverTimeout is the timeout of a request to a keyserver.
+	keyserverTimeout = 5 * time.Second
+	// keyserverDialTimeout is the timeout of the connection to a
+	// keyserver, so that an unreachable keyserver fails fast.
+	keyserverDialTimeout = 2 * time.Second
+)
+
+// String returns the name of the keyserver operation.
+func (op KeyserverOp) String() string {
+	switch op {
+	case KeyserverPushOp:
+		return "push"
+	case KeyserverPullOp:
+		return "pull"
+	case KeyserverSearchOp:
+		return "search"
+	case KeyserverVerifyOp:
+		return "verify"
+	}
+	return fmt.Sprintf("KeyserverOp(%d)", uint8(op))
+}
+
+// Allows returns if the keyserver can be used for the operation op. The
+// pull operation is allowed with the search capability.
+func (kc *ServiceConfig) Allows(op KeyserverOp) bool {
+	switch op {
+	case KeyserverPushOp:
+		return !kc.NoPush
+	case KeyserverPullOp, KeyserverSearchOp:
+		return !kc.NoSearch
+	case KeyserverVerifyOp:
+		return !kc.NoVerify
+	}
+	return false
+}
+
+// setCapabilities sets the operations the keyserver can be used for, all
+// of them except the disabled ones.
+func (kc *ServiceConfig) setCapabilities(disabledOps []KeyserverOp) {
+	kc.NoPush, kc.NoSearch, kc.NoVerify = false, false, false
+	for _, op := range disabledOps {
+		switch op {
+		case KeyserverPushOp:
+			kc.NoPush = true
+		case KeyserverPullOp, KeyserverSearchOp:
+			kc.NoSearch = true
+		case KeyserverVerifyOp:
+			kc.NoVerify = true
+		}
+	}
+}
+
+// AddKeyserver adds a keyserver for the corresponding remote endpoint. The
+// keyserver is used for all the operations except the disabledOps ones.
+func (config *Config) AddKeyserver(uri string, order uint32, insecure bool, disabledOps ...KeyserverOp) error {
 	if err := config.UpdateKeyserversConfig(); err != nil {
 		return err
 	}
@@ -78,6 +137,7 @@ func (config *Config) AddKeyserver(uri string, order uint32, insecure bool) erro
 			Insecure: insecure,
 		}
 	}
+	kc.setCapabilities(disabledOps)
 
 	// insert it as specified by the order
 	config.Keyservers = append(config.Keyservers[:order-1], append([]*ServiceConfig{kc}, config.Keyservers[order-1:]...)...)
@@ -157,45 +217,75 @@ func (config *Config) UpdateKeyserversConfig() error {
 	return nil
 }
 
-type keyserverTransport struct {
-	keyservers []*ServiceConfig
-	op         KeyserverOp
-	client     *http.Client
+// keyserverSource records the URI of the keyserver which answered a key
+// request.
+type keyserverSource struct {
+	mu  sync.Mutex
+	uri string
 }
 
-func (c *keyserverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	ctx := req.Context()
+type keyserverSourceKey struct{}
 
-	for i, k := range c.keyservers {
-		if k.Skip {
-			continue
-		}
+// WithKeyserverSource returns a context recording which keyserver answered
+// the key requests made with it, and a function returning the URI of the
+// keyserver which answered the last successful request.
+func WithKeyserverSource(ctx context.Context) (context.Context, func() string) {
+	src := &keyserverSource{}
+	return context.WithValue(ctx, keyserverSourceKey{}, src), func() string {
+		src.mu.Lock()
+		defer src.mu.Unlock()
+		return src.uri
+	}
+}
 
-		cloneReq := req.Clone(ctx)
+// recordKeyserverSource records the keyserver which answered a request in
+// its context, if requested with WithKeyserverSource.
+func recordKeyserverSource(ctx context.Context, uri string) {
+	if src, ok := ctx.Value(keyserverSourceKey{}).(*keyserverSource); ok {
+		src.mu.Lock()
+		src.uri = uri
+		src.mu.Unlock()
+	}
+}
 
-		if i > 0 {
-			u, err := remoteutil.NormalizeKeyserverURI(k.URI)
-			if err != nil {
-				return nil, err
-			}
-			cloneReq.URL.Scheme = u.Scheme
-			cloneReq.URL.Host = u.Host
-			cloneReq.URL.User = u.User
-		}
+type keyserverTransport struct {
+	keyservers []*ServiceConfig
+	op         KeyserverOp
+	clients    []*http.Client
+}
 
-		sylog.Debugf("Querying keyserver %s", cloneReq.URL)
+// keyserverResult is the response of a keyserver to a request.
+type keyserverResult struct {
+	index int
+	resp  *http.Response
+	err   error
+}
 
-		cloneReq.Header.Del("Authorization")
-		if k.credential != nil && k.credential.Auth != "" {
-			cloneReq.Header.Set("Authorization", k.credential.Auth)
-		}
+// cancelBody is a response body canceling the context of its request
+// once closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
 
-		tr, ok := c.client.Transport.(*http.Transport)
-		if ok {
-			tr.TLSClientConfig.InsecureSkipVerify = k.Insecure
-		}
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
 
-		resp, err := c.client.Do(cloneReq)
+func (c *keyserverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(c.keyservers) == 0 {
+		return nil, fmt.Errorf("no keyserver configured")
+	}
+	// keys are looked up on all the keyservers at once for verification,
+	// so that an unreachable keyserver doesn't delay it
+	if c.op == KeyserverVerifyOp && len(c.keyservers) > 1 && (req.Body == nil || req.Body == http.NoBody) {
+		return c.parallelRoundTrip(req)
+	}
+
+	for i, k := range c.keyservers {
+		resp, err := c.query(req, i)
 		if err != nil {
 			if i < len(c.keyservers)-1 {
 				continue
@@ -208,25 +298,178 @@ func (c *keyserverTransport) RoundTrip(req *http.Request) (*http.Response, error
 			continue
 		}
 
+		if resp.StatusCode/100 == 2 {
+			recordKeyserverSource(req.Context(), k.URI)
+		}
 		return resp, err
 	}
 
 	return nil, fmt.Errorf("no keyserver configured")
 }
 
-func newClient(keyservers []*ServiceConfig, op KeyserverOp) *http.Client {
-	innerTransport := http.DefaultTransport.(*http.Transport).Clone()
-	innerTransport.DisableKeepAlives = true
-	innerTransport.TLSClientConfig = &tls.Config{}
-	innerClient := &http.Client{
-		Timeout:   5 * time.Second,
-		Transport: innerTransport,
+// parallelRoundTrip sends the request to all the keyservers at once and
+// returns the first successful response. If none succeeds, the response or
+// error of the first keyserver in order is returned.
+func (c *keyserverTransport) parallelRoundTrip(req *http.Request) (*http.Response, error) {
+	results := make(chan keyserverResult, len(c.keyservers))
+	cancels := make([]context.CancelFunc, len(c.keyservers))
+	for i := range c.keyservers {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancels[i] = cancel
+		go func(i int, req *http.Request) {
+			resp, err := c.query(req, i)
+			results <- keyserverResult{index: i, resp: resp, err: err}
+		}(i, req.WithContext(ctx))
 	}
+
+	failures := make([]keyserverResult, len(c.keyservers))
+	for n := 1; n <= len(c.keyservers); n++ {
+		r := <-results
+		if r.err != nil || r.resp.StatusCode/100 != 2 {
+			failures[r.index] = r
+			continue
+		}
+
+		sylog.Debugf("Keyserver %s answered first", c.keyservers[r.index].URI)
+		for i, cancel := range cancels {
+			if i != r.index {
+				cancel()
+			}
+		}
+		// release the responses of the other keyservers
+		go func(pending int) {
+			for ; pending > 0; pending-- {
+				if r := <-results; r.resp != nil {
+					r.resp.Body.Close()
+				}
+			}
+		}(len(c.keyservers) - n)
+		for _, f := range failures {
+			if f.resp != nil {
+				f.resp.Body.Close()
+			}
+		}
+
+		recordKeyserverSource(req.Context(), c.keyservers[r.index].URI)
+		r.resp.Body = &cancelBody{ReadCloser: r.resp.Body, cancel: cancels[r.index]}
+		return r.resp, nil
+	}
+
+	// no keyserver succeeded
+	chosen := 0
+	for i, f := range failures {
+		if f.resp != nil {
+			chosen = i
+			break
+		}
+	}
+	for i, f := range failures {
+		if i == chosen {
+			continue
+		}
+		if f.resp != nil {
+			f.resp.Body.Close()
+		}
+		cancels[i]()
+	}
+	f := failures[chosen]
+	if f.resp == nil {
+		cancels[chosen]()
+		return nil, f.err
+	}
+	f.resp.Body = &cancelBody{ReadCloser: f.resp.Body, cancel: cancels[chosen]}
+	return f.resp, nil
+}
+
+// query sends the request to the keyserver at index i.
+func (c *keyserverTransport) query(req *http.Request, i int) (*http.Response, error) {
+	k := c.keyservers[i]
+	cloneReq := req.Clone(req.Context())
+
+	if i > 0 {
+		u, err := remoteutil.NormalizeKeyserverURI(k.URI)
+		if err != nil {
+			return nil, err
+		}
+		cloneReq.URL.Scheme = u.Scheme
+		cloneReq.URL.Host = u.Host
+		cloneReq.URL.User = u.User
+	}
+
+	sylog.Debugf("Querying keyserver %s", cloneReq.URL)
+
+	cloneReq.Header.Del("Authorization")
+	if k.credential != nil && k.credential.Auth != "" {
+		cloneReq.Header.Set("Authorization", k.credential.Auth)
+	}
+
+	return c.clients[i].Do(cloneReq)
+}
+
+// newKeyserverClient returns an HTTP client for a keyserver, with short
+// timeouts and the TLS configuration tc if not nil.
+func newKeyserverClient(tc *tls.Config, insecure bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	if tc != nil {
+		transport.TLSClientConfig = tc.Clone()
+	} else {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.InsecureSkipVerify = insecure //nolint:gosec
+	transport.DialContext = (&net.Dialer{
+		Timeout: keyserverDialTimeout,
+	}).DialContext
+	transport.TLSHandshakeTimeout = keyserverDialTimeout
 	return &http.Client{
-		Transport: &keyserverTransport{
-			keyservers: keyservers,
-			op:         op,
-			client:     innerClient,
-		},
+		Timeout:   keyserverTimeout,
+		Transport: &tlsTransport{rt: transport},
+	}
+}
+
+func newClient(keyservers []*ServiceConfig, op KeyserverOp, tc *tls.Config) *http.Client {
+	t := &keyserverTransport{
+		op: op,
+	}
+	for _, k := range keyservers {
+		if k.Skip {
+			continue
+		}
+		t.keyservers = append(t.keyservers, k)
+		t.clients = append(t.clients, newKeyserverClient(tc, k.Insecure))
+	}
+	return &http.Client{
+		Transport: t,
+	}
+}
+
+// KeyserverStatus queries the keyserver kc of the endpoint and returns its
+// response time, or an error if it is unreachable.
+func (config *Config) KeyserverStatus(ctx context.Context, kc *ServiceConfig) (time.Duration, error) {
+	tc, err := config.TLSConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	u, err := remoteutil.NormalizeKeyserverURI(kc.URI)
+	if err != nil {
+		return 0, err
+	}
+	u.Path = "/pks/lookup"
+	u.RawQuery = "op=stats"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", useragent.Value())
+
+	start := time.Now()
+	resp, err := newKeyserverClient(tc, kc.Insecure).Do(req)
+	if err != nil {
+		return 0, err
 	}
+	resp.Body.Close()
+	// any HTTP response means the keyserver is reachable
+	return time.Since(start), nil
 }
@@ -10,8 +10,13 @@
 package endpoint
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
 )
@@ -191,3 +196,123 @@ func TestAddRemoveKeyserver(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyserverCapabilities(t *testing.T) {
+	ep := &Config{
+		URI: testCloudURI,
+		Keyservers: []*ServiceConfig{
+			{
+				URI:      "https://keys.example.com",
+				External: true,
+				NoPush:   true,
+			},
+		},
+	}
+	if err := ep.AddKeyserver("https://mirror.example.com", 0, false, KeyserverPushOp, KeyserverSearchOp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kc := ep.Keyservers[1]
+	if !kc.NoPush || !kc.NoSearch || kc.NoVerify {
+		t.Errorf("unexpected capabilities %+v", kc)
+	}
+	for op, allowed := range map[KeyserverOp]bool{
+		KeyserverPushOp:   false,
+		KeyserverPullOp:   false,
+		KeyserverSearchOp: false,
+		KeyserverVerifyOp: true,
+	} {
+		if kc.Allows(op) != allowed {
+			t.Errorf("%s operation allowed: %v, expected %v", op, !allowed, allowed)
+		}
+	}
+
+	// no keyserver allows to push keys
+	if _, err := ep.KeyserverClientOpts("", KeyserverPushOp); err == nil {
+		t.Errorf("unexpected success for push operation")
+	}
+	if _, err := ep.KeyserverClientOpts("", KeyserverVerifyOp); err != nil {
+		t.Errorf("unexpected error for verify operation: %v", err)
+	}
+}
+
+func TestKeyserverTransport(t *testing.T) {
+	respond := func(status int, body string, delay time.Duration) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+		}))
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+	slow := respond(http.StatusOK, "slow", 2*time.Second)
+	notFound := respond(http.StatusNotFound, "", 0)
+	found := respond(http.StatusOK, "found", 0)
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	tests := []struct {
+		name       string
+		op         KeyserverOp
+		keyservers []string
+		wantStatus int
+		wantBody   string
+		wantSource string
+	}{
+		{
+			name:       "verify first success",
+			op:         KeyserverVerifyOp,
+			keyservers: []string{dead.URL, notFound, slow, found},
+			wantStatus: http.StatusOK,
+			wantBody:   "found",
+			wantSource: found,
+		},
+		{
+			name:       "verify not found",
+			op:         KeyserverVerifyOp,
+			keyservers: []string{dead.URL, notFound},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "search in order",
+			op:         KeyserverSearchOp,
+			keyservers: []string{notFound, slow, found},
+			wantStatus: http.StatusOK,
+			wantBody:   "slow",
+			wantSource: slow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keyservers []*ServiceConfig
+			for _, uri := range tt.keyservers {
+				keyservers = append(keyservers, &ServiceConfig{URI: uri, External: true})
+			}
+			ctx, source := WithKeyserverSource(context.Background())
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, tt.keyservers[0]+"/pks/lookup?op=get&search=0x1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := newClient(keyservers, tt.op, nil).Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("could not read response: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus || string(b) != tt.wantBody {
+				t.Errorf("unexpected response %d %q, expected %d %q", resp.StatusCode, b, tt.wantStatus, tt.wantBody)
+			}
+			if source() != tt.wantSource {
+				t.Errorf("unexpected source %q, expected %q", source(), tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+)
+
+const (
+	// DefaultOIDCClientID is the client ID used for the OIDC login when
+	// none is configured.
+	DefaultOIDCClientID = "apptainer"
+
+	// oidcDiscoveryPath is the path of the OpenID provider configuration,
+	// relative to the issuer URL.
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+	// oidcDeviceGrantType is the grant type of the device authorization
+	// flow.
+	oidcDeviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	// oidcScope is the scope requested, offline_access to get a refresh
+	// token.
+	oidcScope = "openid offline_access"
+	// oidcExpiryMargin is the time before the expiry of an access token
+	// from which it is refreshed.
+	oidcExpiryMargin = 30 * time.Second
+)
+
+// ErrOIDCLoginRequired is returned when the OIDC session of an endpoint
+// expired, and the user has to login again.
+var ErrOIDCLoginRequired = errors.New("OIDC session expired")
+
+// OIDCConfig describes the OIDC login of a remote endpoint.
+type OIDCConfig struct {
+	Issuer       string    `yaml:"Issuer"`
+	ClientID     string    `yaml:"ClientID,omitempty"`
+	RefreshToken string    `yaml:"RefreshToken,omitempty"` // encrypted refresh token
+	KeySource    string    `yaml:"KeySource,omitempty"`    // source of the refresh token encryption key
+	KeyID        string    `yaml:"KeyID,omitempty"`        // ID of the key in the login keyring, or passphrase salt
+	Expiry       time.Time `yaml:"Expiry,omitempty"`       // expiry of the access token
+}
+
+// DeviceAuthorization is the verification the user has to complete to
+// login with the device authorization flow.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// oidcProvider holds the endpoints of an OpenID provider.
+type oidcProvider struct {
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+}
+
+// oidcToken is the response of the token endpoint.
+type oidcToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+	Description  string `json:"error_description"`
+}
+
+// oidcPost posts the form to an endpoint of the OpenID provider and decodes
+// the JSON response into v. The error responses of the token endpoint are
+// decoded too, with their HTTP status ignored.
+func oidcPost(ctx context.Context, endpoint string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", useragent.Value())
+
+	client := &http.Client{Timeout: defaultTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request to server: %v", err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("while reading response body: %v", err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("error response from server: %s", res.Status)
+	}
+	return nil
+}
+
+// discoverOIDC returns the endpoints of the OpenID provider issuer.
+func discoverOIDC(ctx context.Context, issuer string) (*oidcProvider, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(issuer, "/")+oidcDiscoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", useragent.Value())
+
+	client := &http.Client{Timeout: defaultTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to server: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error response from server: %s", res.Status)
+	}
+
+	p := &oidcProvider{}
+	if err := json.NewDecoder(res.Body).Decode(p); err != nil {
+		return nil, fmt.Errorf("while decoding OpenID provider configuration: %v", err)
+	}
+	if p.TokenEndpoint == "" {
+		return nil, fmt.Errorf("OpenID provider %s has no token endpoint", issuer)
+	}
+	return p, nil
+}
+
+// setOIDCToken sets the access token of the endpoint, and stores the
+// refresh token encrypted if the provider returned one.
+func (config *Config) setOIDCToken(t *oidcToken, secret *OIDCSecret) error {
+	if t.RefreshToken != "" {
+		enc, err := secret.encrypt(config.OIDC, t.RefreshToken)
+		if err != nil {
+			return fmt.Errorf("while encrypting refresh token: %v", err)
+		}
+		config.OIDC.RefreshToken = enc
+	}
+	config.Token = t.AccessToken
+	config.OIDC.Expiry = time.Time{}
+	if t.ExpiresIn > 0 {
+		config.OIDC.Expiry = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second).UTC()
+	}
+	return nil
+}
+
+// OIDCDeviceLogin logs in to the endpoint with the OAuth2 device
+// authorization flow of the OpenID provider issuer. The verification the
+// user has to complete is passed to the prompt function, then the token
+// endpoint is polled until the user completes it. The access token is set
+// as the endpoint token, and the refresh token is stored encrypted with the
+// secret so that the access token is refreshed by RefreshOIDCToken.
+func (config *Config) OIDCDeviceLogin(ctx context.Context, issuer, clientID string, secret *OIDCSecret, prompt func(DeviceAuthorization)) error {
+	if clientID == "" {
+		clientID = DefaultOIDCClientID
+	}
+	p, err := discoverOIDC(ctx, issuer)
+	if err != nil {
+		return err
+	}
+	if p.DeviceAuthorizationEndpoint == "" {
+		return fmt.Errorf("OpenID provider %s doesn't support the device authorization flow", issuer)
+	}
+
+	var da DeviceAuthorization
+	form := url.Values{"client_id": {clientID}, "scope": {oidcScope}}
+	if err := oidcPost(ctx, p.DeviceAuthorizationEndpoint, form, &da); err != nil {
+		return fmt.Errorf("while requesting device authorization: %v", err)
+	}
+	if da.DeviceCode == "" {
+		return fmt.Errorf("no device code returned by %s", p.DeviceAuthorizationEndpoint)
+	}
+	prompt(da)
+
+	interval := time.Duration(da.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(da.ExpiresIn) * time.Second)
+	form = url.Values{
+		"grant_type":  {oidcDeviceGrantType},
+		"device_code": {da.DeviceCode},
+		"client_id":   {clientID},
+	}
+	for {
+		if da.ExpiresIn > 0 && time.Now().After(deadline) {
+			return fmt.Errorf("device authorization expired, login again")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		var t oidcToken
+		if err := oidcPost(ctx, p.TokenEndpoint, form, &t); err != nil {
+			return fmt.Errorf("while requesting token: %v", err)
+		}
+		switch t.Error {
+		case "":
+			if t.AccessToken == "" {
+				return fmt.Errorf("no access token returned by %s", p.TokenEndpoint)
+			}
+			config.OIDC = &OIDCConfig{
+				Issuer:   issuer,
+				ClientID: clientID,
+			}
+			return config.setOIDCToken(&t, secret)
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		case "expired_token":
+			return fmt.Errorf("device authorization expired, login again")
+		case "access_denied":
+			return fmt.Errorf("device authorization denied")
+		default:
+			return fmt.Errorf("token request failed: %s %s", t.Error, t.Description)
+		}
+	}
+}
+
+// NeedsOIDCRefresh returns if the endpoint is logged in with
+// OIDCDeviceLogin and its access token expires soon.
+func (config *Config) NeedsOIDCRefresh() bool {
+	if config.OIDC == nil || config.OIDC.RefreshToken == "" {
+		return false
+	}
+	if config.Token == "" {
+		return true
+	}
+	return !config.OIDC.Expiry.IsZero() && time.Now().Add(oidcExpiryMargin).After(config.OIDC.Expiry)
+}
+
+// RefreshOIDCToken refreshes the access token of an endpoint logged in
+// with OIDCDeviceLogin, if it expires soon, with the refresh token
+// decrypted with the secret. It returns true if the token was refreshed,
+// and an error wrapping ErrOIDCLoginRequired if the refresh token expired.
+func (config *Config) RefreshOIDCToken(ctx context.Context, secret *OIDCSecret) (bool, error) {
+	if !config.NeedsOIDCRefresh() {
+		return false, nil
+	}
+
+	refreshToken, err := secret.decrypt(config.OIDC, config.OIDC.RefreshToken)
+	if err != nil {
+		return false, fmt.Errorf("%w: could not decrypt refresh token: %v", ErrOIDCLoginRequired, err)
+	}
+	p, err := discoverOIDC(ctx, config.OIDC.Issuer)
+	if err != nil {
+		return false, err
+	}
+
+	clientID := config.OIDC.ClientID
+	if clientID == "" {
+		clientID = DefaultOIDCClientID
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {clientID},
+	}
+	var t oidcToken
+	if err := oidcPost(ctx, p.TokenEndpoint, form, &t); err != nil {
+		return false, fmt.Errorf("while refreshing token: %v", err)
+	}
+	if t.Error == "invalid_grant" {
+		return false, fmt.Errorf("%w: %s", ErrOIDCLoginRequired, t.Description)
+	} else if t.Error != "" {
+		return false, fmt.Errorf("token refresh failed: %s %s", t.Error, t.Description)
+	} else if t.AccessToken == "" {
+		return false, fmt.Errorf("no access token returned by %s", p.TokenEndpoint)
+	}
+
+	sylog.Debugf("Refreshed OIDC access token from %s", config.OIDC.Issuer)
+	return true, config.setOIDCToken(&t, secret)
+}
@@ -0,0 +1,191 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package endpoint
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// OIDCKeySourceKeyring is the source of a refresh token encryption key
+	// stored in the login keyring of the user.
+	OIDCKeySourceKeyring = "keyring"
+	// OIDCKeySourcePassphrase is the source of a refresh token encryption
+	// key derived from a passphrase.
+	OIDCKeySourcePassphrase = "passphrase"
+
+	// oidcKeyPrefix prefixes the description of the keys of the login
+	// keyring.
+	oidcKeyPrefix = "apptainer-oidc:"
+	// oidcKeySize is the size of the AES-256 encryption keys.
+	oidcKeySize = 32
+)
+
+// OIDCSecret provides the key encrypting the refresh token of an endpoint:
+// a random key stored in the login keyring of the user, the kernel user
+// keyring kept as long as the user is logged in, or a key derived from a
+// passphrase.
+type OIDCSecret struct {
+	// UsePassphrase selects a passphrase rather than the login keyring
+	// for a new key.
+	UsePassphrase bool
+	// Passphrase returns the passphrase a key is derived from.
+	Passphrase func() (string, error)
+
+	// key caches the key, not to ask the passphrase twice.
+	key []byte
+}
+
+// randomBytes returns n random bytes.
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// getKey returns the key of the OIDC configuration oc, creating it if
+// create is true and oc has no key yet.
+func (s *OIDCSecret) getKey(oc *OIDCConfig, create bool) ([]byte, error) {
+	if s.key != nil {
+		return s.key, nil
+	}
+
+	if oc.KeySource == "" {
+		if !create {
+			return nil, fmt.Errorf("no encryption key")
+		}
+		id, err := randomBytes(16)
+		if err != nil {
+			return nil, err
+		}
+		oc.KeyID = hex.EncodeToString(id)
+		oc.KeySource = OIDCKeySourceKeyring
+		if s.UsePassphrase {
+			oc.KeySource = OIDCKeySourcePassphrase
+		}
+	}
+
+	var err error
+	switch oc.KeySource {
+	case OIDCKeySourceKeyring:
+		s.key, err = keyringKey(oidcKeyPrefix+oc.KeyID, create)
+	case OIDCKeySourcePassphrase:
+		s.key, err = s.passphraseKey(oc.KeyID)
+	default:
+		err = fmt.Errorf("unknown key source %q", oc.KeySource)
+	}
+	return s.key, err
+}
+
+// keyringKey returns the key with the given description from the user
+// keyring, adding a random key if create is true and it isn't found.
+func keyringKey(desc string, create bool) ([]byte, error) {
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", desc, 0)
+	if errors.Is(err, unix.ENOKEY) && create {
+		key, err := randomBytes(oidcKeySize)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := unix.AddKey("user", desc, key, unix.KEY_SPEC_USER_KEYRING); err != nil {
+			return nil, fmt.Errorf("could not add key to the login keyring: %v", err)
+		}
+		return key, nil
+	} else if errors.Is(err, unix.ENOKEY) {
+		return nil, fmt.Errorf("key not found in the login keyring")
+	} else if err != nil {
+		return nil, fmt.Errorf("could not access the login keyring: %v", err)
+	}
+
+	key := make([]byte, oidcKeySize)
+	n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, key, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key from the login keyring: %v", err)
+	} else if n != oidcKeySize {
+		return nil, fmt.Errorf("invalid key in the login keyring")
+	}
+	return key, nil
+}
+
+// passphraseKey derives a key from the passphrase, with the salt encoded
+// in hexadecimal.
+func (s *OIDCSecret) passphraseKey(salt string) ([]byte, error) {
+	if s.Passphrase == nil {
+		return nil, fmt.Errorf("no passphrase provided")
+	}
+	b, err := hex.DecodeString(salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %v", err)
+	}
+	pass, err := s.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+	return scrypt.Key([]byte(pass), b, 1<<15, 8, 1, oidcKeySize)
+}
+
+// encrypt encrypts the refresh token with the key of oc, created if
+// needed, and returns it encoded in base64.
+func (s *OIDCSecret) encrypt(oc *OIDCConfig, token string) (string, error) {
+	key, err := s.getKey(oc, true)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(token), nil)), nil
+}
+
+// decrypt decrypts a refresh token encrypted by encrypt.
+func (s *OIDCSecret) decrypt(oc *OIDCConfig, enc string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", err
+	}
+	key, err := s.getKey(oc, false)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted token")
+	}
+	token, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("wrong key or passphrase")
+	}
+	return string(token), nil
+}
@@ -0,0 +1,174 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockOIDC is a mock OpenID provider supporting the device authorization
+// flow, with single use refresh tokens.
+type mockOIDC struct {
+	mu      sync.Mutex
+	url     string
+	polls   int
+	issued  int
+	refresh map[string]bool
+}
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	m := &mockOIDC{refresh: make(map[string]bool)}
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidcDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcProvider{
+			DeviceAuthorizationEndpoint: m.url + "/device",
+			TokenEndpoint:               m.url + "/token",
+		})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("client_id") != "apptainer" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(oidcToken{Error: "invalid_client"})
+			return
+		}
+		json.NewEncoder(w).Encode(DeviceAuthorization{
+			DeviceCode:      "device-code",
+			UserCode:        "ABCD-EFGH",
+			VerificationURI: m.url + "/verify",
+			ExpiresIn:       60,
+			Interval:        1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		switch r.PostFormValue("grant_type") {
+		case oidcDeviceGrantType:
+			// the user completes the verification after the first poll
+			m.polls++
+			if m.polls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(oidcToken{Error: "authorization_pending"})
+				return
+			}
+		case "refresh_token":
+			rt := r.PostFormValue("refresh_token")
+			if !m.refresh[rt] {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(oidcToken{Error: "invalid_grant", Description: "Token is not active"})
+				return
+			}
+			delete(m.refresh, rt)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(oidcToken{Error: "unsupported_grant_type"})
+			return
+		}
+
+		m.issued++
+		rt := fmt.Sprintf("refresh-%d", m.issued)
+		m.refresh[rt] = true
+		json.NewEncoder(w).Encode(oidcToken{
+			AccessToken:  fmt.Sprintf("access-%d", m.issued),
+			RefreshToken: rt,
+			ExpiresIn:    3600,
+		})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	m.url = srv.URL
+	return m
+}
+
+func TestOIDCDeviceLogin(t *testing.T) {
+	m := newMockOIDC(t)
+	passphrase := "secret"
+	secret := func() *OIDCSecret {
+		return &OIDCSecret{
+			UsePassphrase: true,
+			Passphrase:    func() (string, error) { return passphrase, nil },
+		}
+	}
+
+	ep := &Config{URI: "cloud.example.com"}
+	var prompted DeviceAuthorization
+	err := ep.OIDCDeviceLogin(context.Background(), m.url, "", secret(), func(da DeviceAuthorization) {
+		prompted = da
+	})
+	if err != nil {
+		t.Fatalf("unexpected login error: %v", err)
+	}
+	if prompted.UserCode != "ABCD-EFGH" {
+		t.Errorf("unexpected device authorization prompted %+v", prompted)
+	}
+	if ep.Token != "access-1" || ep.OIDC.KeySource != OIDCKeySourcePassphrase {
+		t.Errorf("unexpected endpoint after login: token %q, OIDC %+v", ep.Token, ep.OIDC)
+	}
+	if ep.OIDC.RefreshToken == "" || ep.OIDC.RefreshToken == "refresh-1" {
+		t.Errorf("refresh token not stored encrypted: %q", ep.OIDC.RefreshToken)
+	}
+
+	// the access token is only refreshed once it expires
+	if refreshed, err := ep.RefreshOIDCToken(context.Background(), secret()); err != nil || refreshed {
+		t.Fatalf("unexpected refresh of a valid token: %v", err)
+	}
+	ep.OIDC.Expiry = time.Now()
+	if refreshed, err := ep.RefreshOIDCToken(context.Background(), secret()); err != nil || !refreshed {
+		t.Fatalf("token not refreshed: %v", err)
+	}
+	if ep.Token != "access-2" || ep.NeedsOIDCRefresh() {
+		t.Errorf("unexpected token %q after refresh", ep.Token)
+	}
+
+	// a wrong passphrase requires to login again
+	ep.OIDC.Expiry = time.Now()
+	passphrase = "wrong"
+	if _, err := ep.RefreshOIDCToken(context.Background(), secret()); !errors.Is(err, ErrOIDCLoginRequired) {
+		t.Errorf("unexpected error with a wrong passphrase: %v", err)
+	}
+
+	// as an expired refresh token
+	passphrase = "secret"
+	m.mu.Lock()
+	m.refresh = make(map[string]bool)
+	m.mu.Unlock()
+	if _, err := ep.RefreshOIDCToken(context.Background(), secret()); !errors.Is(err, ErrOIDCLoginRequired) {
+		t.Errorf("unexpected error with an expired refresh token: %v", err)
+	}
+}
+
+func TestOIDCSecretKeyring(t *testing.T) {
+	oc := &OIDCConfig{}
+	enc, err := (&OIDCSecret{}).encrypt(oc, "refresh token")
+	if err != nil {
+		t.Skipf("login keyring not available: %v", err)
+	}
+	if oc.KeySource != OIDCKeySourceKeyring || oc.KeyID == "" {
+		t.Fatalf("unexpected key %+v", oc)
+	}
+	token, err := (&OIDCSecret{}).decrypt(oc, enc)
+	if err != nil || token != "refresh token" {
+		t.Errorf("unexpected decrypted token %q: %v", token, err)
+	}
+
+	// a key missing from the login keyring isn't created to decrypt
+	oc.KeyID = "missing"
+	if _, err := (&OIDCSecret{}).decrypt(oc, enc); err == nil {
+		t.Errorf("unexpected success decrypting with a missing key")
+	}
+}
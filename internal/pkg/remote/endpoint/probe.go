@@ -0,0 +1,274 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package endpoint
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+	jsonresp "github.com/sylabs/json-resp"
+)
+
+// The kinds of errors of a service probe.
+const (
+	ProbeErrorDNS           = "dns"
+	ProbeErrorTimeout       = "timeout"
+	ProbeErrorRefused       = "refused"
+	ProbeErrorTLSUntrusted  = "tls-untrusted"
+	ProbeErrorTLSClientCert = "tls-client-rejected"
+	ProbeErrorHTTP          = "http"
+	ProbeErrorNotProvided   = "not-provided"
+	ProbeErrorOther         = "error"
+)
+
+// probeVersionPath is the path of the version of a service.
+const probeVersionPath = "/version"
+
+var (
+	// probeTimeout is the timeout of the probe of a service.
+	probeTimeout = 5 * time.Second
+	// probeDialTimeout is the timeout of the connection retrieving the
+	// certificate of a service failing the TLS handshake.
+	probeDialTimeout = 2 * time.Second
+)
+
+// ServiceProbe is the result of the probe of a service of an endpoint.
+type ServiceProbe struct {
+	// Service is the name of the service.
+	Service string `json:"service"`
+	// URI is the URI of the service.
+	URI string `json:"uri"`
+	// Reachable is true if the service answered.
+	Reachable bool `json:"reachable"`
+	// LatencyMs is the response time of the service in milliseconds.
+	LatencyMs int64 `json:"latencyMs,omitempty"`
+	// Version is the version of the service, if it exposes it.
+	Version string `json:"version,omitempty"`
+	// ErrorKind is the kind of error if the service isn't reachable.
+	ErrorKind string `json:"errorKind,omitempty"`
+	// Error is the error if the service isn't reachable.
+	Error string `json:"error,omitempty"`
+	// TLS describes the certificate presented by the service.
+	TLS *CertificateProbe `json:"tls,omitempty"`
+}
+
+// CertificateProbe describes the certificate presented by a service.
+type CertificateProbe struct {
+	// Valid is true if the certificate is trusted and not expired.
+	Valid bool `json:"valid"`
+	// Error is the reason why the certificate isn't valid.
+	Error string `json:"error,omitempty"`
+	// Subject is the subject of the certificate.
+	Subject string `json:"subject"`
+	// Issuer is the issuer of the certificate.
+	Issuer string `json:"issuer"`
+	// NotAfter is the expiry date of the certificate.
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// newCertificateProbe returns the description of the certificate cert,
+// with the error of its verification if any.
+func newCertificateProbe(cert *x509.Certificate, verifyErr error) *CertificateProbe {
+	cp := &CertificateProbe{
+		Valid:    verifyErr == nil,
+		Subject:  cert.Subject.String(),
+		Issuer:   cert.Issuer.String(),
+		NotAfter: cert.NotAfter.UTC(),
+	}
+	if verifyErr != nil {
+		cp.Error = verifyErr.Error()
+	}
+	return cp
+}
+
+// probeErrorKind returns the kind of the error of a probe request.
+func probeErrorKind(err error) string {
+	var (
+		dnsErr *net.DNSError
+		netErr net.Error
+	)
+	switch {
+	case errors.Is(err, ErrServerCertUntrusted):
+		return ProbeErrorTLSUntrusted
+	case errors.Is(err, ErrClientCertRejected):
+		return ProbeErrorTLSClientCert
+	case errors.As(err, &dnsErr):
+		return ProbeErrorDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ProbeErrorTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ProbeErrorRefused
+	}
+	return ProbeErrorOther
+}
+
+// peerCertificate returns the certificate presented by the server of the
+// URI u, without verifying it, for the description of a certificate
+// failing the verification.
+func peerCertificate(ctx context.Context, u *url.URL) *x509.Certificate {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	var cert *x509.Certificate
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: probeDialTimeout},
+		Config: &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: true, //nolint:gosec
+			// the certificate is captured even if the server then
+			// rejects the handshake for lack of a client certificate
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				if len(cs.PeerCertificates) > 0 {
+					cert = cs.PeerCertificates[0]
+				}
+				return nil
+			},
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err == nil {
+		conn.Close()
+	}
+	return cert
+}
+
+// probeService probes the service name at uri, with a request to its
+// version path using the HTTP transport of the endpoint.
+func probeService(ctx context.Context, name, uri string, transport http.RoundTripper) ServiceProbe {
+	p := ServiceProbe{Service: name, URI: uri}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		p.ErrorKind = ProbeErrorOther
+		p.Error = err.Error()
+		return p
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(uri, "/")+probeVersionPath, nil)
+	if err != nil {
+		p.ErrorKind = ProbeErrorOther
+		p.Error = err.Error()
+		return p
+	}
+	req.Header.Set("User-Agent", useragent.Value())
+
+	start := time.Now()
+	res, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		p.ErrorKind = probeErrorKind(err)
+		p.Error = err.Error()
+		if p.ErrorKind == ProbeErrorTLSUntrusted || p.ErrorKind == ProbeErrorTLSClientCert {
+			if cert := peerCertificate(ctx, u); cert != nil {
+				// a rejected client certificate means the server
+				// certificate was verified
+				var verifyErr error
+				var urlErr *url.Error
+				if p.ErrorKind == ProbeErrorTLSUntrusted && errors.As(err, &urlErr) {
+					verifyErr = urlErr.Err
+				}
+				p.TLS = newCertificateProbe(cert, verifyErr)
+			}
+		}
+		return p
+	}
+	defer res.Body.Close()
+	p.LatencyMs = time.Since(start).Milliseconds()
+
+	if res.TLS != nil && len(res.TLS.PeerCertificates) > 0 {
+		p.TLS = newCertificateProbe(res.TLS.PeerCertificates[0], nil)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusOK:
+		var v struct {
+			Version string `json:"version"`
+		}
+		if err := jsonresp.ReadResponse(res.Body, &v); err == nil {
+			p.Version = v.Version
+		}
+	case res.StatusCode >= http.StatusInternalServerError:
+		p.ErrorKind = ProbeErrorHTTP
+		p.Error = fmt.Sprintf("error response from server: %s", res.Status)
+		return p
+	}
+	// other responses, e.g. without version path, mean the service is
+	// reachable
+	p.Reachable = true
+	return p
+}
+
+// ProbeServices probes the services of the endpoint concurrently, and
+// returns the results sorted by service name. The services named in
+// required but not provided by the endpoint are reported as unreachable.
+func (config *Config) ProbeServices(ctx context.Context, required []string) ([]ServiceProbe, error) {
+	transport, err := config.HTTPTransport()
+	if err != nil {
+		return nil, err
+	}
+	services, err := config.GetAllServices()
+	if err != nil {
+		return nil, fmt.Errorf("while retrieving services: %w", err)
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		probes []ServiceProbe
+	)
+	for name, ss := range services {
+		for _, s := range ss {
+			if s.URI() == "" {
+				continue
+			}
+			wg.Add(1)
+			go func(name, uri string) {
+				defer wg.Done()
+				p := probeService(ctx, name, uri, transport)
+				mu.Lock()
+				probes = append(probes, p)
+				mu.Unlock()
+			}(name, s.URI())
+		}
+	}
+	wg.Wait()
+
+	for _, name := range required {
+		if len(services[name]) == 0 {
+			probes = append(probes, ServiceProbe{
+				Service:   name,
+				ErrorKind: ProbeErrorNotProvided,
+				Error:     "service not provided by the endpoint",
+			})
+		}
+	}
+
+	sort.Slice(probes, func(i, j int) bool {
+		if probes[i].Service != probes[j].Service {
+			return probes[i].Service < probes[j].Service
+		}
+		return probes[i].URI < probes[j].URI
+	})
+	return probes, nil
+}
@@ -0,0 +1,147 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package endpoint
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestService(uri string) []Service {
+	return []Service{&service{cfg: &ServiceConfig{URI: uri}}}
+}
+
+func TestProbeServices(t *testing.T) {
+	// a listener closed to get a refused connection
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + l.Addr().String()
+	l.Close()
+
+	block := make(chan struct{})
+	defer close(block)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/library/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"version":"v1.2.3"}}`))
+	})
+	mux.HandleFunc("/builder/version", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/token/version", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/slow/version", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// a TLS server with a certificate of an unknown CA
+	serverCert, certFile, keyFile := writeCert(t, t.TempDir(), "server", x509.ExtKeyUsageServerAuth)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsSrv := httptest.NewUnstartedServer(mux)
+	tlsSrv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	tlsSrv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	tlsSrv.StartTLS()
+	defer tlsSrv.Close()
+
+	// a TLS server trusted with the CA bundle of the endpoint
+	trustedSrv := httptest.NewTLSServer(mux)
+	defer trustedSrv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: trustedSrv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(d time.Duration) { probeTimeout = d }(probeTimeout)
+	probeTimeout = 500 * time.Millisecond
+
+	ep := &Config{URI: "cloud.example.com", TLSFiles: TLSFiles{CACert: caFile}}
+	ep.services = map[string][]Service{
+		Library:     newTestService(srv.URL + "/library"),
+		Builder:     newTestService(srv.URL + "/builder"),
+		Token:       newTestService(srv.URL + "/token"),
+		Consent:     newTestService(srv.URL + "/slow"),
+		Keyserver:   newTestService(refused),
+		"dns":       newTestService("https://apptainer-probe.invalid"),
+		"untrusted": newTestService(tlsSrv.URL + "/library"),
+		"trusted":   newTestService(trustedSrv.URL + "/library"),
+	}
+
+	probes, err := ep.ProbeServices(context.Background(), []string{Library, "registry"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]struct {
+		reachable bool
+		kind      string
+		version   string
+	}{
+		Library:     {reachable: true, version: "v1.2.3"},
+		Token:       {reachable: true},
+		Builder:     {kind: ProbeErrorHTTP},
+		Consent:     {kind: ProbeErrorTimeout},
+		Keyserver:   {kind: ProbeErrorRefused},
+		"dns":       {kind: ProbeErrorDNS},
+		"untrusted": {kind: ProbeErrorTLSUntrusted},
+		"trusted":   {reachable: true, version: "v1.2.3"},
+		"registry":  {kind: ProbeErrorNotProvided},
+	}
+	if len(probes) != len(expected) {
+		t.Fatalf("unexpected probes %+v", probes)
+	}
+	for i, p := range probes {
+		if i > 0 && probes[i-1].Service > p.Service {
+			t.Errorf("probes not sorted by service: %s before %s", probes[i-1].Service, p.Service)
+		}
+		e := expected[p.Service]
+		if p.Reachable != e.reachable || p.ErrorKind != e.kind || p.Version != e.version {
+			t.Errorf("unexpected probe of %s: %+v", p.Service, p)
+		}
+	}
+
+	// the certificate failing the verification is still described
+	for _, p := range probes {
+		switch p.Service {
+		case "untrusted":
+			if p.TLS == nil || p.TLS.Valid || p.TLS.Error == "" || !p.TLS.NotAfter.Equal(serverCert.NotAfter) {
+				t.Errorf("unexpected certificate of untrusted service: %+v", p.TLS)
+			}
+		case "trusted":
+			if p.TLS == nil || !p.TLS.Valid || !p.TLS.NotAfter.Equal(trustedSrv.Certificate().NotAfter) {
+				t.Errorf("unexpected certificate of trusted service: %+v", p.TLS)
+			}
+		case Library:
+			if p.TLS != nil {
+				t.Errorf("unexpected certificate of HTTP service: %+v", p.TLS)
+			}
+		}
+	}
+}
@@ -76,6 +76,8 @@ type service struct {
 	// configMap holds additional specific service configuration key/val pairs.
 	// e.g. `registryURI` most be known for the library service to facilitate OCI-SIF push/pull/
 	configMap map[string]string
+	// transport is the HTTP transport of the endpoint, with its TLS configuration.
+	transport http.RoundTripper
 }
 
 // URI returns the service URI.
@@ -92,7 +94,8 @@ func (s *service) Status() (version string, err error) {
 	}
 
 	client := &http.Client{
-		Timeout: 30 * time.Second,
+		Timeout:   30 * time.Second,
+		Transport: s.transport,
 	}
 
 	req, err := http.NewRequest(http.MethodGet, s.cfg.URI+"/version", nil)
@@ -104,7 +107,7 @@ func (s *service) Status() (version string, err error) {
 
 	res, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error making request to server: %v", err)
+		return "", fmt.Errorf("error making request to server: %w", err)
 	}
 	defer res.Body.Close()
 
@@ -134,10 +137,16 @@ func (config *Config) GetAllServices() (map[string][]Service, error) {
 		return config.services, nil
 	}
 
+	transport, err := config.HTTPTransport()
+	if err != nil {
+		return nil, err
+	}
+
 	config.services = make(map[string][]Service)
 
 	client := &http.Client{
-		Timeout: defaultTimeout,
+		Timeout:   defaultTimeout,
+		Transport: transport,
 	}
 
 	epURL, err := config.GetURL()
@@ -160,7 +169,7 @@ func (config *Config) GetAllServices() (map[string][]Service, error) {
 	if cacheReader == nil {
 		res, err := client.Do(req)
 		if err != nil {
-			return nil, fmt.Errorf("error making request to server: %s", err)
+			return nil, fmt.Errorf("error making request to server: %w", err)
 		} else if res.StatusCode != http.StatusOK {
 			return nil, fmt.Errorf("error response from server: %s", err)
 		}
@@ -218,6 +227,7 @@ func (config *Config) GetAllServices() (map[string][]Service, error) {
 			&service{
 				cfg:       sConfig,
 				configMap: sConfigMap,
+				transport: transport,
 			},
 		}
 	}
@@ -0,0 +1,307 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package endpoint
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+)
+
+var (
+	// ErrServerCertUntrusted is returned when the certificate of a server
+	// isn't signed by a trusted CA, or doesn't match its name.
+	ErrServerCertUntrusted = errors.New("server certificate not trusted")
+	// ErrClientCertRejected is returned when a server requiring mutual TLS
+	// rejects the client certificate, or none was presented.
+	ErrClientCertRejected = errors.New("client certificate rejected")
+)
+
+// clientCertAlerts are the TLS alerts sent by a server rejecting the
+// client certificate.
+var clientCertAlerts = []string{
+	"bad certificate",
+	"unsupported certificate",
+	"certificate revoked",
+	"certificate expired",
+	"certificate unknown",
+	"unknown certificate authority",
+	"certificate required",
+}
+
+// TLSFiles are the files of the TLS configuration of an endpoint, used
+// for the library, keyserver and registry services of the endpoint.
+type TLSFiles struct {
+	CACert     string `yaml:"CACert,omitempty"`     // PEM CA bundle trusted in addition to the system one
+	ClientCert string `yaml:"ClientCert,omitempty"` // PEM client certificate for mutual TLS
+	ClientKey  string `yaml:"ClientKey,omitempty"`  // PEM private key of the client certificate
+}
+
+// IsSet returns if a CA bundle or a client certificate is configured.
+func (f TLSFiles) IsSet() bool {
+	return f.CACert != "" || f.ClientCert != ""
+}
+
+// Abs returns the TLS files with absolute paths.
+func (f TLSFiles) Abs() (TLSFiles, error) {
+	for _, p := range []*string{&f.CACert, &f.ClientCert, &f.ClientKey} {
+		if *p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(*p)
+		if err != nil {
+			return f, err
+		}
+		*p = abs
+	}
+	return f, nil
+}
+
+// siteCABundles returns the site-wide CA bundles of apptainer.conf.
+func siteCABundles() []string {
+	if conf := apptainerconf.GetCurrentConfig(); conf != nil {
+		return conf.RemoteCABundle
+	}
+	return nil
+}
+
+// checkClientKey checks that the private key file is only accessible by
+// its owner.
+func checkClientKey(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("while accessing client key: %v", err)
+	}
+	if perm := fi.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf("client key %s is accessible by other users (mode %#o), set its mode to 0600", path, perm)
+	}
+	return nil
+}
+
+// tlsConfig returns the TLS configuration trusting the CA bundles in
+// addition to the system ones, and presenting the client certificate of
+// the files f if any. It returns nil if there is nothing to configure.
+func (f TLSFiles) tlsConfig(bundles []string) (*tls.Config, error) {
+	if f.CACert != "" {
+		bundles = append(bundles, f.CACert)
+	}
+	if len(bundles) == 0 && f.ClientCert == "" && f.ClientKey == "" {
+		return nil, nil
+	}
+
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(bundles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			sylog.Debugf("Could not load system CA certificates: %v", err)
+			pool = x509.NewCertPool()
+		}
+		for _, b := range bundles {
+			pem, err := os.ReadFile(b)
+			if err != nil {
+				return nil, fmt.Errorf("while reading CA bundle: %v", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no PEM certificate found in CA bundle %s", b)
+			}
+		}
+		tc.RootCAs = pool
+	}
+
+	if f.ClientCert != "" || f.ClientKey != "" {
+		if f.ClientCert == "" || f.ClientKey == "" {
+			return nil, fmt.Errorf("both a client certificate and a client key are required for mutual TLS")
+		}
+		if err := checkClientKey(f.ClientKey); err != nil {
+			return nil, err
+		}
+		// the error of LoadX509KeyPair doesn't contain the key material
+		cert, err := tls.LoadX509KeyPair(f.ClientCert, f.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("while loading client certificate %s: %v", f.ClientCert, err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// TLSConfig returns the TLS configuration of the clients of the endpoint
+// services: the site-wide CA bundles of apptainer.conf and the TLS files of
+// the endpoint. It returns nil if there is nothing to configure.
+func (config *Config) TLSConfig() (*tls.Config, error) {
+	return config.TLSFiles.tlsConfig(siteCABundles())
+}
+
+// tlsTransport is an HTTP transport identifying the TLS errors of its
+// requests.
+type tlsTransport struct {
+	rt http.RoundTripper
+}
+
+func (t *tlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return resp, TLSError(err)
+	}
+	return resp, nil
+}
+
+// TLSError returns err wrapped with ErrServerCertUntrusted or
+// ErrClientCertRejected if it is such a TLS error, or err otherwise.
+func TLSError(err error) error {
+	if err == nil || errors.Is(err, ErrServerCertUntrusted) || errors.Is(err, ErrClientCertRejected) {
+		return err
+	}
+
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return fmt.Errorf("%w: %v", ErrServerCertUntrusted, err)
+	}
+
+	// the alerts sent by the server are only available as error messages
+	msg := err.Error()
+	for _, alert := range clientCertAlerts {
+		if strings.Contains(msg, "remote error: tls: "+alert) {
+			return fmt.Errorf("%w: %v", ErrClientCertRejected, err)
+		}
+	}
+	return err
+}
+
+// newTransport returns an HTTP transport with the TLS configuration tc,
+// identifying the TLS errors of its requests.
+func newTransport(tc *tls.Config) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tc != nil {
+		transport.TLSClientConfig = tc
+	}
+	return &tlsTransport{rt: transport}
+}
+
+// HTTPTransport returns an HTTP transport for the services of the endpoint,
+// with its TLS configuration.
+func (config *Config) HTTPTransport() (http.RoundTripper, error) {
+	tc, err := config.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newTransport(tc), nil
+}
+
+// siteTransport returns an HTTP transport for services not associated with
+// the endpoint, with only the site-wide CA bundles.
+func siteTransport() (http.RoundTripper, error) {
+	tc, err := TLSFiles{}.tlsConfig(siteCABundles())
+	if err != nil {
+		return nil, err
+	}
+	return newTransport(tc), nil
+}
+
+// registryHost returns the host of an image reference, with or without a
+// transport prefix.
+func registryHost(ref string) string {
+	if i := strings.Index(ref, "://"); i >= 0 {
+		ref = ref[i+3:]
+	}
+	ref = strings.TrimPrefix(ref, "//")
+	host, _, _ := strings.Cut(ref, "/")
+	return host
+}
+
+// uriHost returns the host of a URI, with or without a scheme.
+func uriHost(uri string) string {
+	if !strings.Contains(uri, "://") {
+		uri = "https://" + uri
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// isRegistry returns if host is the endpoint itself or the OCI registry of
+// its library service.
+func (config *Config) isRegistry(host string) bool {
+	if host == "" {
+		return false
+	}
+	if uriHost(config.URI) == host {
+		return true
+	}
+	registryURI, err := config.RegistryURI()
+	if err != nil {
+		sylog.Debugf("No registry associated with the endpoint: %v", err)
+		return false
+	}
+	return uriHost(registryURI) == host
+}
+
+// RegistryCertDir returns a directory with the CA bundles and client
+// certificate of the endpoint for the registry of the image reference ref,
+// laid out as a containers/image certificate directory, with ca-N.crt,
+// client.cert and client.key files. It returns an empty path if the
+// endpoint has no TLS files, or if the registry isn't the endpoint itself or
+// the OCI registry of its library service. The returned function removes
+// the directory.
+func (config *Config) RegistryCertDir(ref string) (string, func(), error) {
+	noop := func() {}
+	if !config.TLSFiles.IsSet() || !config.isRegistry(registryHost(ref)) {
+		return "", noop, nil
+	}
+	// check the files before linking them
+	if _, err := config.TLSConfig(); err != nil {
+		return "", noop, err
+	}
+
+	dir, err := os.MkdirTemp("", "apptainer-certs-")
+	if err != nil {
+		return "", noop, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	links := make(map[string]string)
+	bundles := siteCABundles()
+	if config.CACert != "" {
+		bundles = append(bundles, config.CACert)
+	}
+	for i, b := range bundles {
+		links[fmt.Sprintf("ca-%d.crt", i)] = b
+	}
+	if config.ClientCert != "" {
+		links["client.cert"] = config.ClientCert
+		links["client.key"] = config.ClientKey
+	}
+	for name, target := range links {
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			cleanup()
+			return "", noop, err
+		}
+		if err := os.Symlink(abs, filepath.Join(dir, name)); err != nil {
+			cleanup()
+			return "", noop, err
+		}
+	}
+	return dir, cleanup, nil
+}
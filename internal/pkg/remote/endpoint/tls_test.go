@@ -0,0 +1,230 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package endpoint
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeClientCert generates a self-signed client certificate, written
+// with its key in dir, and returns it with the paths of the files.
+func writeClientCert(t *testing.T, dir, name string) (*x509.Certificate, string, string) {
+	return writeCert(t, dir, name, x509.ExtKeyUsageClientAuth)
+}
+
+// writeCert generates a self-signed certificate for the usage, valid for
+// 127.0.0.1, written with its key in dir, and returns it with the paths of
+// the files.
+func writeCert(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, certFile, keyFile
+}
+
+// newMutualTLSServer starts a TLS server requiring a client certificate
+// signed by client, and returns it with the path of its CA bundle.
+func newMutualTLSServer(t *testing.T, dir string, client *x509.Certificate) (*httptest.Server, string) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(client)
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+	}
+	// the rejected handshakes are expected
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return srv, caFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, certFile, keyFile := writeClientCert(t, dir, "client")
+	_, otherCertFile, otherKeyFile := writeClientCert(t, dir, "other")
+	srv, caFile := newMutualTLSServer(t, dir, clientCert)
+
+	tests := []struct {
+		name        string
+		files       TLSFiles
+		expectError error
+	}{
+		{
+			name:        "NoCA",
+			files:       TLSFiles{ClientCert: certFile, ClientKey: keyFile},
+			expectError: ErrServerCertUntrusted,
+		},
+		{
+			name:        "NoClientCert",
+			files:       TLSFiles{CACert: caFile},
+			expectError: ErrClientCertRejected,
+		},
+		{
+			name:        "UntrustedClientCert",
+			files:       TLSFiles{CACert: caFile, ClientCert: otherCertFile, ClientKey: otherKeyFile},
+			expectError: ErrClientCertRejected,
+		},
+		{
+			name:  "MutualTLS",
+			files: TLSFiles{CACert: caFile, ClientCert: certFile, ClientKey: keyFile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := &Config{URI: strings.TrimPrefix(srv.URL, "https://"), TLSFiles: tt.files}
+			transport, err := ep.HTTPTransport()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			client := &http.Client{Transport: transport}
+
+			resp, err := client.Get(srv.URL)
+			if tt.expectError != nil {
+				if !errors.Is(err, tt.expectError) {
+					t.Errorf("unexpected error %v, expected %v", err, tt.expectError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status %s", resp.Status)
+			}
+		})
+	}
+}
+
+func TestTLSConfigClientKey(t *testing.T) {
+	dir := t.TempDir()
+	_, certFile, keyFile := writeClientCert(t, dir, "client")
+
+	// a client key readable by other users is refused
+	if err := os.Chmod(keyFile, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ep := &Config{TLSFiles: TLSFiles{ClientCert: certFile, ClientKey: keyFile}}
+	_, err := ep.TLSConfig()
+	if err == nil || !strings.Contains(err.Error(), "set its mode to 0600") {
+		t.Errorf("unexpected error for a client key with mode 0644: %v", err)
+	}
+
+	// as a client certificate without key
+	ep.ClientKey = ""
+	if _, err := ep.TLSConfig(); err == nil {
+		t.Errorf("unexpected success without client key")
+	}
+
+	// nothing to configure
+	ep.TLSFiles = TLSFiles{}
+	if tc, err := ep.TLSConfig(); err != nil || tc != nil {
+		t.Errorf("unexpected TLS configuration %v: %v", tc, err)
+	}
+}
+
+func TestRegistryCertDir(t *testing.T) {
+	dir := t.TempDir()
+	_, certFile, keyFile := writeClientCert(t, dir, "client")
+
+	ep := &Config{
+		URI:      "registry.example.com",
+		TLSFiles: TLSFiles{CACert: certFile, ClientCert: certFile, ClientKey: keyFile},
+	}
+
+	certDir, cleanup, err := ep.RegistryCertDir("docker://registry.example.com/library/alpine:latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"ca-0.crt", "client.cert", "client.key"} {
+		if _, err := os.Stat(filepath.Join(certDir, name)); err != nil {
+			t.Errorf("missing %s in certificate directory: %v", name, err)
+		}
+	}
+	cleanup()
+	if _, err := os.Stat(certDir); !os.IsNotExist(err) {
+		t.Errorf("certificate directory not removed")
+	}
+
+	// the TLS files aren't used for a registry foreign to the endpoint
+	ep.URI = ""
+	ep.services = map[string][]Service{
+		Library: {&service{cfg: &ServiceConfig{}, configMap: map[string]string{RegistryURIConfigKey: "https://oci.example.com"}}},
+	}
+	if certDir, _, err := ep.RegistryCertDir("oras://docker.io/library/alpine:latest"); err != nil || certDir != "" {
+		t.Errorf("unexpected certificate directory %q for a foreign registry: %v", certDir, err)
+	}
+	// and are for the OCI registry of the library
+	certDir, cleanup, err = ep.RegistryCertDir("oras://oci.example.com/library/alpine:latest")
+	if err != nil || certDir == "" {
+		t.Errorf("no certificate directory for the library registry: %v", err)
+	}
+	cleanup()
+}
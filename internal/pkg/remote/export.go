@@ -0,0 +1,223 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remote
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
+	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
+)
+
+// ImportResult is the result of the import of a remote endpoint, or of the
+// credentials of a service.
+type ImportResult struct {
+	Name      string // name of the remote, or URI of the service of the credentials
+	Unchanged bool   // the entry is identical to the existing one
+	Err       error  // the reason why the entry wasn't imported
+}
+
+// Export returns a copy of the remotes of c defined in its configuration
+// file, the remotes synced from the system configuration being left out of
+// a user configuration. The authentication tokens and credentials are only
+// exported if includeTokens is true.
+func (c *Config) Export(includeTokens bool) *Config {
+	exp := &Config{Remotes: make(map[string]*endpoint.Config)}
+
+	for name, e := range c.Remotes {
+		if e.System && !c.system {
+			continue
+		}
+		ee := &endpoint.Config{
+			URI:        e.URI,
+			System:     e.System,
+			Exclusive:  e.Exclusive,
+			Insecure:   e.Insecure,
+			Keyservers: e.Keyservers,
+			TLSFiles:   e.TLSFiles,
+		}
+		if e.OIDC != nil {
+			ee.OIDC = &endpoint.OIDCConfig{
+				Issuer:   e.OIDC.Issuer,
+				ClientID: e.OIDC.ClientID,
+			}
+			if includeTokens {
+				*ee.OIDC = *e.OIDC
+			}
+		}
+		if includeTokens {
+			ee.Token = e.Token
+		}
+		exp.Remotes[name] = ee
+	}
+	if _, ok := exp.Remotes[c.DefaultRemote]; ok {
+		exp.DefaultRemote = c.DefaultRemote
+	}
+	if includeTokens {
+		exp.Credentials = c.Credentials
+	}
+	return exp
+}
+
+// validateImport checks the remote endpoint e named name before its import.
+func (c *Config) validateImport(name string, e *endpoint.Config) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid name: cannot have empty name")
+	}
+	if strings.TrimSpace(e.URI) == "" {
+		return fmt.Errorf("invalid URI: cannot have empty URI")
+	}
+	if strings.Contains(e.URI, "://") {
+		return fmt.Errorf("invalid URI %s: no protocol expected", e.URI)
+	}
+	if _, err := url.Parse("https://" + e.URI); err != nil {
+		return fmt.Errorf("invalid URI: %v", err)
+	}
+	if e.Exclusive && !c.system {
+		return fmt.Errorf("exclusive can't be set by user")
+	}
+	for _, kc := range e.Keyservers {
+		if kc == nil || strings.TrimSpace(kc.URI) == "" {
+			return fmt.Errorf("invalid keyserver: cannot have empty URI")
+		}
+	}
+	if _, err := e.TLSConfig(); err != nil {
+		return fmt.Errorf("invalid TLS configuration: %v", err)
+	}
+	return nil
+}
+
+// sameRemote returns if the imported remote endpoint e defines the same
+// remote as the existing one.
+func sameRemote(existing, e *endpoint.Config) bool {
+	return existing.URI == e.URI &&
+		existing.Insecure == e.Insecure &&
+		existing.Exclusive == e.Exclusive &&
+		existing.TLSFiles == e.TLSFiles &&
+		reflect.DeepEqual(existing.Keyservers, e.Keyservers)
+}
+
+// Import adds the remotes and credentials of in to c, and returns the
+// result of the import of each entry, sorted by name. With replace, the
+// remotes of c defined in its configuration file are removed first,
+// otherwise the remotes already defined differently are reported as
+// conflicts and left unchanged. The active remote of in is used if c has
+// none, or with replace, unless a remote has been set exclusive.
+func (c *Config) Import(in *Config, replace bool) []ImportResult {
+	if replace {
+		for name, e := range c.Remotes {
+			if e.System && !c.system {
+				continue
+			}
+			if c.DefaultRemote == name {
+				c.DefaultRemote = ""
+			}
+			delete(c.Remotes, name)
+		}
+	}
+
+	names := make([]string, 0, len(in.Remotes))
+	for name := range in.Remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var results []ImportResult
+	exclusive := ""
+	for name, e := range c.Remotes {
+		if e.Exclusive {
+			exclusive = name
+		}
+	}
+
+	for _, name := range names {
+		e := in.Remotes[name]
+		r := ImportResult{Name: name}
+
+		if existing, ok := c.Remotes[name]; ok {
+			switch {
+			case existing.System && !c.system:
+				r.Err = fmt.Errorf("%s is global and can't be replaced", name)
+			case sameRemote(existing, e):
+				r.Unchanged = true
+			default:
+				r.Err = fmt.Errorf("%s is already a remote with a different configuration", name)
+			}
+			results = append(results, r)
+			continue
+		}
+		if r.Err = c.validateImport(name, e); r.Err != nil {
+			results = append(results, r)
+			continue
+		}
+		if e.Exclusive && exclusive != "" {
+			r.Err = fmt.Errorf("remote %s has already been set exclusive", exclusive)
+			results = append(results, r)
+			continue
+		}
+
+		ee := *e
+		ee.System = c.system
+		if ee.Exclusive {
+			exclusive = name
+		}
+		c.Remotes[name] = &ee
+		results = append(results, r)
+	}
+
+	results = append(results, c.importCredentials(in.Credentials)...)
+
+	switch {
+	case exclusive != "":
+		c.DefaultRemote = exclusive
+	case in.DefaultRemote == "":
+	case c.DefaultRemote == "" || replace:
+		if _, ok := c.Remotes[in.DefaultRemote]; ok {
+			c.DefaultRemote = in.DefaultRemote
+		}
+	}
+	return results
+}
+
+// importCredentials adds the credentials creds to c, and returns the result
+// of the import of each of them.
+func (c *Config) importCredentials(creds []*credential.Config) []ImportResult {
+	var results []ImportResult
+
+	for _, cred := range creds {
+		r := ImportResult{Name: cred.URI}
+		if strings.TrimSpace(cred.URI) == "" {
+			r.Err = fmt.Errorf("invalid credentials: cannot have empty URI")
+			results = append(results, r)
+			continue
+		}
+		found := false
+		for _, existing := range c.Credentials {
+			if existing.URI != cred.URI {
+				continue
+			}
+			found = true
+			if *existing == *cred {
+				r.Unchanged = true
+			} else {
+				r.Err = fmt.Errorf("already logged in to %s with different credentials", cred.URI)
+			}
+		}
+		if !found {
+			cc := *cred
+			c.Credentials = append(c.Credentials, &cc)
+		}
+		results = append(results, r)
+	}
+	return results
+}
@@ -120,6 +120,16 @@ func (c *Config) SyncFrom(sys *Config) error {
 				c.DefaultRemote = name
 			}
 			eUsr.Keyservers = eSys.Keyservers
+			eUsr.TLSFiles = eSys.TLSFiles
+			if eSys.OIDC != nil {
+				// the OIDC provider is configured globally, the tokens
+				// individually
+				if eUsr.OIDC == nil {
+					eUsr.OIDC = &endpoint.OIDCConfig{}
+				}
+				eUsr.OIDC.Issuer = eSys.OIDC.Issuer
+				eUsr.OIDC.ClientID = eSys.OIDC.ClientID
+			}
 			continue
 		}
 
@@ -131,6 +141,13 @@ func (c *Config) SyncFrom(sys *Config) error {
 			System:     true,
 			Exclusive:  eSys.Exclusive,
 			Keyservers: eSys.Keyservers,
+			TLSFiles:   eSys.TLSFiles,
+		}
+		if eSys.OIDC != nil {
+			e.OIDC = &endpoint.OIDCConfig{
+				Issuer:   eSys.OIDC.Issuer,
+				ClientID: eSys.OIDC.ClientID,
+			}
 		}
 
 		if err := c.Add(name, e); err != nil {
@@ -17,6 +17,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
 	"gopkg.in/yaml.v3"
@@ -448,6 +449,103 @@ func TestAddRemote(t *testing.T) {
 	})
 }
 
+func TestExportImport(t *testing.T) {
+	ks := []*endpoint.ServiceConfig{{URI: "https://keys.example.com", External: true}}
+	usr := Config{
+		DefaultRemote: "cloud",
+		Remotes: map[string]*endpoint.Config{
+			"cloud": {
+				URI:        "cloud.example.com",
+				Token:      testToken,
+				Keyservers: ks,
+				OIDC:       &endpoint.OIDCConfig{Issuer: "https://auth.example.com", RefreshToken: "secret"},
+			},
+			"site": {URI: "site.example.com", System: true},
+		},
+		Credentials: []*credential.Config{{URI: "https://keys.example.com", Auth: "Bearer secret"}},
+	}
+
+	exp := usr.Export(false)
+	b := new(bytes.Buffer)
+	if _, err := exp.WriteTo(b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(b.String(), "secret") || strings.Contains(b.String(), testToken) {
+		t.Errorf("tokens exported:\n%s", b.String())
+	}
+	if _, ok := exp.Remotes["site"]; ok {
+		t.Errorf("remote of the system configuration exported")
+	}
+	if exp.DefaultRemote != "cloud" || exp.Remotes["cloud"].OIDC.Issuer != "https://auth.example.com" {
+		t.Errorf("unexpected export: %+v", exp)
+	}
+	if withTokens := usr.Export(true); withTokens.Remotes["cloud"].Token != testToken || len(withTokens.Credentials) != 1 {
+		t.Errorf("tokens not exported with includeTokens")
+	}
+
+	imp, err := ReadFrom(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	imp.Remotes["other"] = &endpoint.Config{URI: "other.example.com"}
+	imp.Remotes["pinned"] = &endpoint.Config{URI: "pinned.example.com", Exclusive: true}
+	imp.Remotes["bad"] = &endpoint.Config{URI: "https://bad.example.com"}
+
+	dst := Config{
+		Remotes: map[string]*endpoint.Config{
+			"cloud": {URI: "cloud.example.com", Keyservers: ks},
+			"other": {URI: "different.example.com"},
+			"site":  {URI: "site.example.com", System: true},
+		},
+	}
+	results := dst.Import(imp, false)
+	expected := map[string]string{
+		"bad":    "no protocol expected",
+		"cloud":  "",
+		"other":  "different configuration",
+		"pinned": "can't be set by user",
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	for _, r := range results {
+		switch e := expected[r.Name]; {
+		case e == "" && (r.Err != nil || !r.Unchanged):
+			t.Errorf("unexpected result for %s: %+v", r.Name, r)
+		case e != "" && (r.Err == nil || !strings.Contains(r.Err.Error(), e)):
+			t.Errorf("unexpected error for %s: %v", r.Name, r.Err)
+		}
+	}
+	if dst.DefaultRemote != "cloud" || dst.Remotes["other"].URI != "different.example.com" {
+		t.Errorf("unexpected configuration after merge: %+v", dst)
+	}
+
+	// the remotes of the system configuration are kept with replace
+	delete(imp.Remotes, "bad")
+	delete(imp.Remotes, "pinned")
+	imp.DefaultRemote = "other"
+	for _, r := range dst.Import(imp, true) {
+		if r.Err != nil {
+			t.Errorf("unexpected error for %s: %v", r.Name, r.Err)
+		}
+	}
+	if dst.DefaultRemote != "other" || dst.Remotes["other"].URI != "other.example.com" || dst.Remotes["site"] == nil {
+		t.Errorf("unexpected configuration after replace: %+v", dst)
+	}
+
+	// an exclusive remote of the system configuration is the active one
+	sys := Config{Remotes: map[string]*endpoint.Config{}, system: true}
+	imp.Remotes["pinned"] = &endpoint.Config{URI: "pinned.example.com", Exclusive: true}
+	for _, r := range sys.Import(imp, false) {
+		if r.Err != nil {
+			t.Errorf("unexpected error for %s: %v", r.Name, r.Err)
+		}
+	}
+	if sys.DefaultRemote != "pinned" || !sys.Remotes["cloud"].System {
+		t.Errorf("unexpected system configuration: %+v", sys)
+	}
+}
+
 func TestRemoveRemote(t *testing.T) {
 	testsPass := []remoteTest{
 		{
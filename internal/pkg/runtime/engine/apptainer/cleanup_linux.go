@@ -23,6 +23,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/internal/pkg/util/crypt"
 	"github.com/apptainer/apptainer/internal/pkg/util/priv"
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
 	"github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/pkg/build/types"
 	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
@@ -47,12 +48,18 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 	// fakeroot workflow
 	e.stopFuseDrivers()
 
+	if fatal != nil || status.Signaled() || status.ExitStatus() != 0 {
+		checkSessionFull()
+	}
+
 	if imageDriver != nil {
 		if err := umount(); err != nil {
 			sylog.Infof("Cleanup error: %s", err)
 		}
 	}
 
+	unlockWritableImages()
+
 	if tempDir := e.EngineConfig.GetDeleteTempDir(); tempDir != "" {
 		sylog.Verbosef("Removing image tempDir %s", tempDir)
 		sylog.Infof("Cleaning up image...")
@@ -78,6 +85,13 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 		}
 	}
 
+	if imageDir := e.EngineConfig.GetDeleteImageDir(); imageDir != "" {
+		sylog.Verbosef("Removing temporary image directory %s", imageDir)
+		if err := os.RemoveAll(imageDir); err != nil {
+			sylog.Errorf("failed to delete temporary image directory %s: %s", imageDir, err)
+		}
+	}
+
 	if networkSetup != nil {
 		var dropPrivilege priv.DropPrivFunc
 
@@ -88,6 +102,11 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 			dropPrivilege, _ = priv.Escalate()
 		}
 		sylog.Debugf("Cleaning up CNI network config %s", net)
+		// the plugins get the networks set up, and teardown proceeds
+		// even if they fail
+		if err := e.runNetworkCallbacks("DEL", networkSetup); err != nil {
+			sylog.Errorf("network plugin callback failed: %v", err)
+		}
 		if err := networkSetup.DelNetworks(ctx); err != nil {
 			sylog.Errorf("could not delete networks: %v", err)
 		}
@@ -96,7 +115,15 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 		}
 	}
 
+	if rootlessNet != nil {
+		sylog.Debugf("Stopping rootless network %s", rootlessNet.Backend)
+		if err := rootlessNet.Stop(); err != nil {
+			sylog.Errorf("could not stop rootless network: %v", err)
+		}
+	}
+
 	if cgroupsManager != nil {
+		reportMemoryEvents(status)
 		if err := cgroupsManager.Destroy(); err != nil {
 			sylog.Warningf("failed to remove cgroup configuration: %v", err)
 		}
@@ -108,11 +135,38 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 		}
 	}
 
+	if diskSession != nil {
+		if err := umountSession(); err != nil {
+			sylog.Debugf("Could not unmount session directory: %s", err)
+		}
+		sylog.Verbosef("Removing session directory %s", diskSession.Path)
+
+		err := diskSession.Remove()
+		if err != nil && e.EngineConfig.GetFakeroot() && os.Getuid() != 0 {
+			// files created by other users mapped in the fakeroot
+			// user namespace can only be removed from there
+			err = fakerootCleanup(diskSession.Path)
+		}
+		if err != nil {
+			sylog.Warningf("failed to remove session directory %s: %s", diskSession.Path, err)
+			sylog.Warningf("It will be removed by the next container started with the same --sessiondir")
+		}
+	}
+
 	if e.EngineConfig.GetInstance() {
 		file, err := instance.Get(e.CommonConfig.ContainerID, instance.AppSubDir)
 		if err != nil {
 			return err
 		}
+		// record the exit status for the supervisor of the instance
+		// and instance stop
+		code := signalutil.ExitCode(status)
+		if fatal != nil {
+			code = 255
+		}
+		if err := instance.SetExitStatus(file.Name, instance.AppSubDir, code); err != nil {
+			sylog.Warningf("Could not record exit status of instance %s: %s", file.Name, err)
+		}
 		return file.Delete()
 	}
 
@@ -189,6 +243,44 @@ func umount() (err error) {
 	return fmt.Errorf("%s", strings.Join(errs, ", "))
 }
 
+// checkSessionFull warns when the session directory memory filesystem
+// ran out of space, as it's likely the cause of the container failure.
+func checkSessionFull() {
+	if sessionMount == "" || sessionSize == 0 {
+		return
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(sessionMount, &st); err != nil {
+		sylog.Debugf("Could not get session directory usage: %s", err)
+		return
+	}
+	if st.Bavail > 0 && st.Ffree > 0 {
+		return
+	}
+	sylog.Warningf("The session directory %s ran out of space (%d MiB)", sessionMount, sessionSize)
+	sylog.Warningf("Increase the 'sessiondir max size' directive in apptainer.conf, or use --sessiondir-size or --sessiondir")
+}
+
+// umountSession lazily unmounts the session directory to release
+// the disk backed session directory before its removal.
+func umountSession() error {
+	caps := uint64(1 << capabilities.Map["CAP_SYS_ADMIN"].Value)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	oldEffective, err := capabilities.SetProcessEffective(caps)
+	if err != nil {
+		return fmt.Errorf("error setting CAP_SYS_ADMIN: %v", err)
+	}
+	defer capabilities.SetProcessEffective(oldEffective) //nolint:errcheck
+
+	if err := syscall.Unmount(sessionMount, syscall.MNT_DETACH); err != nil && err != syscall.EINVAL {
+		return fmt.Errorf("while unmounting %s: %s", sessionMount, err)
+	}
+	return nil
+}
+
 func cleanupCrypt(path string) error {
 	if err := umount(); err != nil {
 		return err
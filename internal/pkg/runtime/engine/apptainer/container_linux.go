@@ -12,7 +12,7 @@ package apptainer
 import (
 	"context"
 	"fmt"
-	"io"
+	"net"
 	"os"
 	osuser "os/user"
 	"path/filepath"
@@ -23,7 +23,10 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/cgroups"
 	"github.com/apptainer/apptainer/internal/pkg/image/driver"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/network/rootless"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
+	args "github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer/rpc"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer/rpc/client"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
@@ -35,11 +38,14 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/util/gpu"
 	"github.com/apptainer/apptainer/internal/pkg/util/mainthread"
 	"github.com/apptainer/apptainer/internal/pkg/util/priv"
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
+	"github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
 	"github.com/apptainer/apptainer/pkg/image"
 	"github.com/apptainer/apptainer/pkg/network"
 	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
 	apptainer "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/syfs"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/fs/proc"
 	"github.com/apptainer/apptainer/pkg/util/namespaces"
@@ -57,9 +63,14 @@ import (
 var (
 	cryptDev       string
 	networkSetup   *network.Setup
+	rootlessNet    *rootless.Network
 	imageDriver    image.Driver
 	umountPoints   []string
 	cgroupsManager *cgroups.Manager
+	diskSession    *layout.DiskSession
+	sessionMount   string
+	sessionSize    int
+	resolvContent  []byte
 )
 
 // defaultCNIConfPath is the default directory to CNI network configuration files.
@@ -68,6 +79,11 @@ var defaultCNIConfPath = filepath.Join(buildcfg.SYSCONFDIR, "apptainer", "networ
 // defaultCNIPluginPath is the default directory to CNI plugins executables.
 var defaultCNIPluginPath = filepath.Join(buildcfg.LIBEXECDIR, "apptainer", "cni")
 
+// sessionHostsPath is the session file of the hosts file generated for the
+// container hostname, the session may already hold the default hosts file
+// of contain.
+const sessionHostsPath = "/etc/hosts.hostname"
+
 type lastMount struct {
 	dest  string
 	flags uintptr
@@ -87,9 +103,14 @@ type container struct {
 	mountInfoPath string
 	lastMount     lastMount
 	skippedMount  []string
+	mountBatch    []batchedMount
 	suidFlag      uintptr
 	devSourcePath string
 	skipCwd       bool
+	euid          int
+	// plan is set when the mount points are only registered to be
+	// listed by PlanMounts, nothing is mounted nor created on the host
+	plan bool
 }
 
 //nolint:maintidx
@@ -100,6 +121,129 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 		return fmt.Errorf("no root filesystem image provided")
 	}
 
+	cwd := engine.EngineConfig.GetCwd()
+	if err := os.Chdir(cwd); err != nil {
+		return fmt.Errorf("can't change directory to %s: %s", cwd, err)
+	}
+
+	c, err := newContainer(engine, rpcOps, pid, os.Geteuid())
+	if err != nil {
+		return err
+	}
+
+	p := &mount.Points{}
+	system := &mount.System{Points: p, Mount: c.mount}
+
+	usernsFd, err := c.addMounts(system, pid)
+	if err != nil {
+		return err
+	}
+
+	networkSetup, err := c.prepareNetworkSetup(system, pid)
+	if err != nil {
+		return err
+	}
+
+	sylog.Debugf("Mount all")
+	if err := system.MountAll(); err != nil {
+		return errors.Wrap(err, "mount hook function failure")
+	}
+
+	if engine.EngineConfig.GetSessionLayer() == apptainer.UnderlayLayer {
+		// Underlay bind points can interfere with unmounting
+		//  the image, so unmount all those bind points first
+		bindPoints := []string{}
+		for _, bindPoint := range system.Points.GetAllBinds() {
+			if strings.Contains(bindPoint.Destination, "/session/underlay/") {
+				bindPoints = append(bindPoints, bindPoint.Destination)
+			}
+		}
+		umountPoints = append(umountPoints, bindPoints...)
+	}
+
+	if engine.EngineConfig.GetNvCCLI() {
+		// If a container has a CUDA install in it then nvidia-container-cli will bind mount
+		// from <session_dir>/final/usr/local/cuda/compat into the main container lib dir.
+		// This *requires* that the container rootfs is a private mount, as it is a bind source.
+		// By default, the rootfs will be mounted shared due to requirements of the FUSE mount
+		// handling, so make it private here just before calling nvidia-container-cli.
+		if err := c.rpcOps.Mount("", c.session.FinalPath(), "", syscall.MS_PRIVATE, ""); err != nil {
+			return err
+		}
+
+		sylog.Debugf("nvidia-container-cli")
+		// If we are not inside a user namespace then the NVCCLI call must exec nvidia-container-cli
+		// as the host uid 0. This may happen via the setuid starter, or from apptainer being run
+		// directly as uid 0, e.g. `sudo apptainer`.
+		if err := c.rpcOps.NvCCLI(engine.EngineConfig.GetNvCCLIEnv(), c.session.FinalPath(), c.userNS); err != nil {
+			return err
+		}
+	}
+
+	// chroot from RPC server current working directory since
+	// it's already in final directory after chdirFinal call
+	sylog.Debugf("Chroot into %s\n", c.session.FinalPath())
+	_, err = c.rpcOps.Chroot(".", "pivot")
+	if err != nil {
+		sylog.Debugf("Fallback to move/chroot")
+		_, err = c.rpcOps.Chroot(".", "move")
+		if err != nil {
+			return fmt.Errorf("chroot failed: %s", err)
+		}
+	}
+
+	if networkSetup != nil {
+		if err := networkSetup(ctx); err != nil {
+			return err
+		}
+	}
+
+	cgJSON := engine.EngineConfig.GetCgroupsJSON()
+	if cgJSON != "" {
+		// Rootless cgroups setup interacts with systemd over D-Bus.
+		// The session bus address and XDG runtime dir must be set in the environment.
+		if os.Getuid() != 0 {
+			sylog.Debugf("Setting rootless XDG_RUNTIME_DIR / DBUS_SESSION_ADDRESS for cgroup manager")
+			os.Setenv("XDG_RUNTIME_DIR", engine.EngineConfig.GetXdgRuntimeDir())
+			os.Setenv("DBUS_SESSION_BUS_ADDRESS", engine.EngineConfig.GetDbusSessionBusAddress())
+		}
+
+		// the container process is waiting for the RPC server to exit
+		// before executing the payload, so limits are in effect first
+		if job := engine.EngineConfig.GetJobCgroup(); job != "" {
+			cgroupsManager, err = cgroups.NewJobManagerWithJSON(cgJSON, pid, job)
+		} else {
+			cgroupsManager, err = cgroups.NewManagerWithJSON(cgJSON, pid, "", engine.EngineConfig.File.SystemdCgroups)
+		}
+		os.Unsetenv("XDG_RUNTIME_DIR")
+		os.Unsetenv("DBUS_SESSION_BUS_ADDRESS")
+		if err != nil {
+			if !engine.EngineConfig.File.AllowCgroupsFailure {
+				return fmt.Errorf("while applying cgroups config: %v", err)
+			}
+			sylog.Warningf("Running container without resource limits, failed to apply cgroups config: %v", err)
+			cgroupsManager = nil
+		} else {
+			startMemoryMonitor()
+		}
+	}
+
+	sylog.Debugf("Chdir into / to avoid errors\n")
+	err = syscall.Chdir("/")
+	if err != nil {
+		return fmt.Errorf("change directory failed: %s", err)
+	}
+
+	if err := engine.runFuseDrivers(false, usernsFd); err != nil {
+		return fmt.Errorf("while running FUSE drivers: %s", err)
+	}
+
+	return nil
+}
+
+// newContainer returns the container set up from the engine configuration,
+// euid being the effective user ID of the engine process creating it.
+func newContainer(engine *EngineOperations, rpcOps *client.RPC, pid int, euid int) (*container, error) {
 	c := &container{
 		engine:        engine,
 		rpcOps:        rpcOps,
@@ -107,11 +251,7 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 		mountInfoPath: fmt.Sprintf("/proc/%d/mountinfo", pid),
 		skippedMount:  make([]string, 0),
 		suidFlag:      syscall.MS_NOSUID,
-	}
-
-	cwd := engine.EngineConfig.GetCwd()
-	if err := os.Chdir(cwd); err != nil {
-		return fmt.Errorf("can't change directory to %s: %s", cwd, err)
+		euid:          euid,
 	}
 
 	if engine.EngineConfig.OciConfig.Linux != nil {
@@ -141,12 +281,27 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 		}
 	}
 
-	if os.Geteuid() != 0 {
+	if c.euid != 0 {
 		c.sessionSize = int(c.engine.EngineConfig.File.SessiondirMaxSize)
 	} else if engine.EngineConfig.GetAllowSUID() && !c.userNS {
 		c.suidFlag = 0
 	}
 
+	// only root can request a session directory larger than
+	// the 'sessiondir max size' directive, the effective uid
+	// being 0 in setuid mode and in a user namespace
+	if size := engine.EngineConfig.GetSessionDirSize(); size > 0 {
+		uid, err := namespaces.HostUID()
+		if err != nil {
+			return nil, fmt.Errorf("while getting host user ID: %s", err)
+		}
+		maxSize := int(c.engine.EngineConfig.File.SessiondirMaxSize)
+		if uid != 0 && maxSize > 0 && size > maxSize {
+			return nil, fmt.Errorf("requested session directory size of %d MiB exceeds the 'sessiondir max size' limit of %d MiB set in apptainer.conf", size, maxSize)
+		}
+		c.sessionSize = size
+	}
+
 	// user namespace was not requested but we need to check
 	// if we are currently running in a user namespace and set
 	// value accordingly to avoid remount errors while running
@@ -162,37 +317,47 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 	callbackType := (apptainercallback.RegisterImageDriver)(nil)
 	callbacks, err := plugin.LoadCallbacks(callbackType)
 	if err != nil {
-		return fmt.Errorf("while loading plugins callbacks '%T': %s", callbackType, err)
+		return nil, fmt.Errorf("while loading plugins callbacks '%T': %s", callbackType, err)
 	}
 	for _, callback := range callbacks {
 		if err := callback.(apptainercallback.RegisterImageDriver)(c.userNS); err != nil {
-			return fmt.Errorf("while registering image driver: %s", err)
+			return nil, fmt.Errorf("while registering image driver: %s", err)
 		}
 	}
 
 	driverName := c.engine.EngineConfig.File.ImageDriver
 	imageDriver = image.GetDriver(driverName)
 	if driverName != "" && imageDriver == nil {
-		return fmt.Errorf("%q: no such image driver", driverName)
+		return nil, fmt.Errorf("%q: no such image driver", driverName)
 	}
 
-	p := &mount.Points{}
-	system := &mount.System{Points: p, Mount: c.mount}
+	return c, nil
+}
 
+// addMounts sets up the session layout and registers the container mount
+// points with their hook functions in system. It returns the file
+// descriptor of the container user namespace passed to the FUSE programs.
+//
+//nolint:maintidx
+func (c *container) addMounts(system *mount.System, pid int) (int, error) {
 	createCwdDirTag := mount.AuthorizedTag(mount.LayerTag)
 	if c.engine.EngineConfig.GetSessionLayer() == apptainer.UnderlayLayer {
 		createCwdDirTag = mount.PreLayerTag
 	}
 	if err := system.RunBeforeTag(createCwdDirTag, c.createCwdDir); err != nil {
-		return err
+		return -1, err
 	}
 
 	if err := c.setupSessionLayout(system); err != nil {
-		return err
+		return -1, err
+	}
+
+	if err := c.setupReadOnlyRoot(system); err != nil {
+		return -1, err
 	}
 
 	if err := c.setupImageDriver(system, pid); err != nil {
-		return err
+		return -1, err
 	}
 
 	umountPoints = append(umountPoints, c.session.RootFsPath())
@@ -202,156 +367,73 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 	}
 
 	if err := system.RunAfterTag(mount.SessionTag, c.addMountInfo); err != nil {
-		return err
+		return -1, err
 	}
 	if err := system.RunBeforeTag(mount.CwdTag, c.addCwdMount); err != nil {
-		return err
+		return -1, err
+	}
+	if err := system.RunAfterTag(mount.UserbindsTag, c.flushMountBatch); err != nil {
+		return -1, err
 	}
 	if err := system.RunAfterTag(mount.SharedTag, c.addIdentityMount); err != nil {
-		return err
+		return -1, err
 	}
 	// this call must occur just after all container layers are mounted
 	// to prevent user binds to screw up session final directory and
 	// consequently chroot
 	if err := system.RunAfterTag(mount.SharedTag, c.chdirFinal); err != nil {
-		return err
+		return -1, err
 	}
 
 	if err := c.addRootfsMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addImageBindMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addKernelMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addDevMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addHostMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addBindsMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addHomeMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addUserbindsMount(system); err != nil {
-		return err
+		return -1, err
+	}
+	if err := c.addFSMounts(system); err != nil {
+		return -1, err
 	}
 	if err := c.addTmpMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addScratchMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addLibsMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addFilesMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addResolvConfMount(system); err != nil {
-		return err
+		return -1, err
 	}
 	if err := c.addHostnameMount(system); err != nil {
-		return err
+		return -1, err
 	}
-	usernsFd, err := c.addFuseMount(system)
-	if err != nil {
-		return err
+	if err := c.addLocaltimeMount(system); err != nil {
+		return -1, err
 	}
-
-	networkSetup, err := c.prepareNetworkSetup(system, pid)
-	if err != nil {
-		return err
-	}
-
-	sylog.Debugf("Mount all")
-	if err := system.MountAll(); err != nil {
-		return errors.Wrap(err, "mount hook function failure")
-	}
-
-	if engine.EngineConfig.GetSessionLayer() == apptainer.UnderlayLayer {
-		// Underlay bind points can interfere with unmounting
-		//  the image, so unmount all those bind points first
-		bindPoints := []string{}
-		for _, bindPoint := range system.Points.GetAllBinds() {
-			if strings.Contains(bindPoint.Destination, "/session/underlay/") {
-				bindPoints = append(bindPoints, bindPoint.Destination)
-			}
-		}
-		umountPoints = append(umountPoints, bindPoints...)
-	}
-
-	if engine.EngineConfig.GetNvCCLI() {
-		// If a container has a CUDA install in it then nvidia-container-cli will bind mount
-		// from <session_dir>/final/usr/local/cuda/compat into the main container lib dir.
-		// This *requires* that the container rootfs is a private mount, as it is a bind source.
-		// By default, the rootfs will be mounted shared due to requirements of the FUSE mount
-		// handling, so make it private here just before calling nvidia-container-cli.
-		if err := c.rpcOps.Mount("", c.session.FinalPath(), "", syscall.MS_PRIVATE, ""); err != nil {
-			return err
-		}
-
-		sylog.Debugf("nvidia-container-cli")
-		// If we are not inside a user namespace then the NVCCLI call must exec nvidia-container-cli
-		// as the host uid 0. This may happen via the setuid starter, or from apptainer being run
-		// directly as uid 0, e.g. `sudo apptainer`.
-		if err := c.rpcOps.NvCCLI(engine.EngineConfig.GetNvCCLIEnv(), c.session.FinalPath(), c.userNS); err != nil {
-			return err
-		}
-	}
-
-	// chroot from RPC server current working directory since
-	// it's already in final directory after chdirFinal call
-	sylog.Debugf("Chroot into %s\n", c.session.FinalPath())
-	_, err = c.rpcOps.Chroot(".", "pivot")
-	if err != nil {
-		sylog.Debugf("Fallback to move/chroot")
-		_, err = c.rpcOps.Chroot(".", "move")
-		if err != nil {
-			return fmt.Errorf("chroot failed: %s", err)
-		}
-	}
-
-	if networkSetup != nil {
-		if err := networkSetup(ctx); err != nil {
-			return err
-		}
-	}
-
-	cgJSON := engine.EngineConfig.GetCgroupsJSON()
-	if cgJSON != "" {
-		// Rootless cgroups setup interacts with systemd over D-Bus.
-		// The session bus address and XDG runtime dir must be set in the environment.
-		if os.Getuid() != 0 {
-			sylog.Debugf("Setting rootless XDG_RUNTIME_DIR / DBUS_SESSION_ADDRESS for cgroup manager")
-			os.Setenv("XDG_RUNTIME_DIR", engine.EngineConfig.GetXdgRuntimeDir())
-			os.Setenv("DBUS_SESSION_BUS_ADDRESS", engine.EngineConfig.GetDbusSessionBusAddress())
-		}
-
-		cgroupsManager, err = cgroups.NewManagerWithJSON(cgJSON, pid, "", engine.EngineConfig.File.SystemdCgroups)
-		if err != nil {
-			return fmt.Errorf("while applying cgroups config: %v", err)
-		}
-		os.Unsetenv("XDG_RUNTIME_DIR")
-		os.Unsetenv("DBUS_SESSION_BUS_ADDRESS")
-	}
-
-	sylog.Debugf("Chdir into / to avoid errors\n")
-	err = syscall.Chdir("/")
-	if err != nil {
-		return fmt.Errorf("change directory failed: %s", err)
-	}
-
-	if err := engine.runFuseDrivers(false, usernsFd); err != nil {
-		return fmt.Errorf("while running FUSE drivers: %s", err)
-	}
-
-	return nil
+	return c.addFuseMount(system)
 }
 
 // setupSessionLayout will create the session layout according to the capabilities of Apptainer
@@ -367,6 +449,20 @@ func (c *container) setupSessionLayout(system *mount.System) error {
 		return fmt.Errorf("failed to resolve session directory %s: %s", buildcfg.SESSIONDIR, err)
 	}
 
+	sessionMount = sessionPath
+
+	if dir := c.engine.EngineConfig.GetSessionDir(); dir != "" && c.plan {
+		diskSession = layout.PlannedDiskSession(dir)
+	} else if dir != "" {
+		diskSession, err = layout.NewDiskSession(dir)
+		if err != nil {
+			return fmt.Errorf("while creating disk backed session directory: %s", err)
+		}
+		sylog.Debugf("Using disk backed session directory %s", diskSession.Path)
+	} else {
+		sessionSize = c.sessionSize
+	}
+
 	sessionLayer := c.engine.EngineConfig.GetSessionLayer()
 
 	sylog.Debugf("Using Layer system: %s\n", sessionLayer)
@@ -392,7 +488,7 @@ func (c *container) setupSessionLayout(system *mount.System) error {
 // setupOverlayLayout sets up the session with overlay filesystem
 func (c *container) setupOverlayLayout(system *mount.System, sessionPath string) (err error) {
 	sylog.Debugf("Creating overlay SESSIONDIR layout\n")
-	if c.session, err = layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, overlay.New()); err != nil {
+	if c.session, err = c.newSession(system, sessionPath, overlay.New()); err != nil {
 		return err
 	}
 	return c.addOverlayMount(system)
@@ -401,17 +497,97 @@ func (c *container) setupOverlayLayout(system *mount.System, sessionPath string)
 // setupUnderlayLayout sets up the session with underlay "filesystem"
 func (c *container) setupUnderlayLayout(system *mount.System, sessionPath string) (err error) {
 	sylog.Debugf("Creating underlay SESSIONDIR layout\n")
-	c.session, err = layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, underlay.New())
+	c.session, err = c.newSession(system, sessionPath, underlay.New())
 	return err
 }
 
 // setupDefaultLayout sets up the session without overlay or underlay
 func (c *container) setupDefaultLayout(system *mount.System, sessionPath string) (err error) {
 	sylog.Debugf("Creating default SESSIONDIR layout\n")
-	c.session, err = layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, nil)
+	c.session, err = c.newSession(system, sessionPath, nil)
 	return err
 }
 
+// newSession creates the session layout manager, the session directory is
+// either a memory filesystem or a bind mount of the disk backed session
+// directory when requested
+func (c *container) newSession(system *mount.System, sessionPath string, l layout.Layer) (*layout.Session, error) {
+	if diskSession != nil {
+		return layout.NewDiskBackedSession(sessionPath, diskSession.Path, system, l)
+	}
+	return layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, l)
+}
+
+// setupReadOnlyRoot registers the hooks keeping the container root
+// filesystem read-only when an overlay upper directory is in use, except
+// for the writable paths. Without upper directory the root filesystem is
+// already read-only.
+func (c *container) setupReadOnlyRoot(system *mount.System) error {
+	if !c.engine.EngineConfig.GetReadOnlyRoot() {
+		return nil
+	}
+
+	ov, ok := c.session.Layer.(*overlay.Overlay)
+	if !ok || ov.GetUpperDir() == "" {
+		if len(c.engine.EngineConfig.GetWritablePaths()) > 0 {
+			return fmt.Errorf("writable paths require a writable overlay, use --writable-tmpfs or a writable --overlay")
+		}
+		sylog.Debugf("Container root filesystem is read-only, no writable overlay")
+		return nil
+	}
+
+	if err := system.RunBeforeTag(mount.LayerTag, c.createWritablePaths); err != nil {
+		return err
+	}
+	return system.RunAfterTag(mount.LayerTag, c.remountRootReadOnly)
+}
+
+// createWritablePaths creates the writable paths missing in the image in
+// the overlay layer directory.
+func (c *container) createWritablePaths(*mount.System) error {
+	rootfs := c.session.RootFsPath()
+
+	for _, path := range c.engine.EngineConfig.GetWritablePaths() {
+		dest := fs.EvalRelative(path, rootfs)
+		if _, err := c.rpcOps.Stat(filepath.Join(rootfs, dest)); err == nil {
+			continue
+		}
+		dest = filepath.Join(c.session.Layer.Dir(), dest)
+		if _, err := c.session.GetPath(dest); err == nil {
+			continue
+		}
+		if err := c.session.AddDir(dest); err != nil {
+			return fmt.Errorf("while creating writable path %s: %s", path, err)
+		}
+	}
+	return c.session.Update()
+}
+
+// remountRootReadOnly bind mounts the writable paths onto themselves to
+// keep them writable, then remounts the overlay root read-only so that
+// writes elsewhere fail with EROFS instead of landing in the upper directory.
+func (c *container) remountRootReadOnly(*mount.System) error {
+	final := c.session.FinalPath()
+
+	for _, path := range c.engine.EngineConfig.GetWritablePaths() {
+		dest := filepath.Join(final, fs.EvalRelative(path, final))
+		sylog.Debugf("Keeping %s writable", path)
+		if err := c.rpcOps.Mount(dest, dest, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("while keeping %s writable: %s", path, err)
+		}
+	}
+
+	flags, err := c.getBindFlags(final, syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY)
+	if err != nil {
+		return err
+	}
+	sylog.Debugf("Remounting container root filesystem read-only")
+	if err := c.rpcOps.Mount("", final, "", flags, ""); err != nil {
+		return fmt.Errorf("while remounting container root filesystem read-only: %s", err)
+	}
+	return nil
+}
+
 // isLayerEnabled returns whether or not overlay or underlay system
 // is enabled
 func (c *container) isLayerEnabled() bool {
@@ -435,7 +611,7 @@ func (c *container) mount(point *mount.Point, system *mount.System) error {
 // setupImageDriver prepare the image driver configured in apptainer.conf
 // to start it after the session setup.
 func (c *container) setupImageDriver(system *mount.System, containerPid int) error {
-	if imageDriver == nil {
+	if imageDriver == nil || c.plan {
 		return nil
 	}
 
@@ -661,11 +837,34 @@ func (c *container) mountGeneric(mnt *mount.Point, tag mount.AuthorizedTag) (err
 		}
 	}
 
+	// user binds are mounted with a single RPC call once all of them
+	// are processed, see flushMountBatch
+	if tag == mount.UserbindsTag && (bindMount || remount || propagation) && !mount.IDMap(mnt.InternalOptions) {
+		c.mountBatch = append(c.mountBatch, batchedMount{
+			point: *mnt,
+			args: args.MountArgs{
+				Source:     source,
+				Target:     dest,
+				Filesystem: mnt.Type,
+				Mountflags: flags,
+				Data:       optsString,
+			},
+		})
+		return nil
+	} else if tag == mount.UserbindsTag && len(c.mountBatch) > 0 {
+		// filesystems and ID-mapped binds may be mounted on top of
+		// the queued user binds
+		if err := c.flushMountBatch(nil); err != nil {
+			return err
+		}
+	}
+
 mount:
 	err = nil
 	if !bindMount && !remount && mnt.Type == "overlay" && tag == mount.LayerTag &&
 		imageDriver != nil && imageDriver.Features()&image.OverlayFeature != 0 {
-		if c.engine.EngineConfig.File.EnableOverlay == "driver" {
+		if c.engine.EngineConfig.File.EnableOverlay == "driver" ||
+			c.engine.EngineConfig.GetOverlayDriver() == fsoverlay.DriverFuse {
 			// Set an error to switch to the overlay image driver
 			// below during the mount error check
 			err = fmt.Errorf("overlay image driver selected by configuration")
@@ -702,97 +901,221 @@ mount:
 			}
 		}
 	}
+	if err == nil && bindMount && !remount && mount.IDMap(mnt.InternalOptions) {
+		if err = c.mountIDMapped(source, dest); err == nil {
+			return nil
+		}
+		sylog.Warningf("Could not use an ID-mapped mount for %s, using a regular bind mount: %s", source, err)
+		err = nil
+	}
 	if err == nil {
 		err = c.rpcOps.Mount(source, dest, mnt.Type, flags, optsString)
 	}
-	if os.IsNotExist(err) {
-		switch tag {
-		case mount.KernelTag,
-			mount.HostfsTag,
-			mount.BindsTag,
-			mount.CwdTag,
-			mount.FilesTag,
-			mount.TmpTag:
-			c.skippedMount = append(c.skippedMount, mnt.Destination)
-			sylog.Warningf("Skipping mount %s [%s]: %s doesn't exist in container", source, tag, mnt.Destination)
+	if err != nil && (bindMount || remount || propagation) {
+		return c.bindMountError(mnt, tag, source, flags, err)
+	} else if os.IsNotExist(err) {
+		return c.missingDestination(mnt, tag, source)
+	} else if err != nil {
+		if mnt.Type == "devpts" {
+			sylog.Verbosef("Couldn't mount devpts filesystem, continuing with PTY allocation functionality disabled")
 			return nil
-		default:
-			if c.engine.EngineConfig.GetWritableImage() {
-				sylog.Warningf(
-					"By using --writable, Apptainer can't create %s destination automatically without overlay or underlay",
-					mnt.Destination,
-				)
-			} else if !c.isLayerEnabled() {
-				sylog.Warningf("No layer in use (overlay or underlay), check your configuration, "+
-					"Apptainer can't create %s destination automatically without overlay or underlay", mnt.Destination)
+		} else if mnt.Type == "overlay" && err == syscall.ESTALE {
+			// overlay mount can return this error when a previous mount was
+			// done with an upper layer and overlay inodes index is enabled
+			// by default, see https://github.com/apptainer/singularity/issues/4539
+			sylog.Verbosef("Overlay mount failed with %s, mounting with index=off", err)
+			optsString = fmt.Sprintf("%s,index=off", optsString)
+			goto mount
+		} else if mnt.Type == "overlay" && err == syscall.EINVAL {
+			sylog.Verbosef("Overlay mount failed with %s, mounting without xino option", err)
+			optsString = strings.Replace(optsString, ",xino=on", "", -1)
+			goto mount
+		} else if mnt.Type == "overlay" && tag == mount.LayerTag {
+			if imageDriver != nil && imageDriver.Features()&image.OverlayFeature != 0 &&
+				c.engine.EngineConfig.File.OverlayDriver != fsoverlay.DriverKernel {
+
+				sylog.Debugf("kernel overlay mount failed, trying image driver: %v", err)
+				// Kernel overlay didn't work so try the image driver
+				params := &image.MountParams{
+					Source:     source,
+					Target:     dest,
+					Filesystem: mnt.Type,
+					Flags:      flags,
+					FSOptions:  opts,
+				}
+				return imageDriver.Mount(params, c.rpcOps.Mount)
 			}
-			return fmt.Errorf("destination %s doesn't exist in container", mnt.Destination)
+			// ask for the OverlayFeature just in case there's
+			//  a message about why it is not available
+			driver.InitImageDrivers(false, c.userNS, c.engine.EngineConfig.File, image.OverlayFeature)
+			// fall through to print the kernel mount error
 		}
-	} else if err != nil {
-		if !bindMount && !remount {
-			if mnt.Type == "devpts" {
-				sylog.Verbosef("Couldn't mount devpts filesystem, continuing with PTY allocation functionality disabled")
-				return nil
-			} else if mnt.Type == "overlay" && err == syscall.ESTALE {
-				// overlay mount can return this error when a previous mount was
-				// done with an upper layer and overlay inodes index is enabled
-				// by default, see https://github.com/apptainer/singularity/issues/4539
-				sylog.Verbosef("Overlay mount failed with %s, mounting with index=off", err)
-				optsString = fmt.Sprintf("%s,index=off", optsString)
-				goto mount
-			} else if mnt.Type == "overlay" && err == syscall.EINVAL {
-				sylog.Verbosef("Overlay mount failed with %s, mounting without xino option", err)
-				optsString = strings.Replace(optsString, ",xino=on", "", -1)
-				goto mount
-			} else if mnt.Type == "overlay" && tag == mount.LayerTag {
-				if imageDriver != nil && imageDriver.Features()&image.OverlayFeature != 0 {
+		// mount error for other filesystems is considered fatal
+		starter.Report(starter.StageMount, mnt.Destination, err)
+		return fmt.Errorf("can't mount %s filesystem to %s: %s", mnt.Type, mnt.Destination, err)
+	}
 
-					sylog.Debugf("kernel overlay mount failed, trying image driver: %v", err)
-					// Kernel overlay didn't work so try the image driver
-					params := &image.MountParams{
-						Source:     source,
-						Target:     dest,
-						Filesystem: mnt.Type,
-						Flags:      flags,
-						FSOptions:  opts,
-					}
-					return imageDriver.Mount(params, c.rpcOps.Mount)
-				}
-				// ask for the OverlayFeature just in case there's
-				//  a message about why it is not available
-				driver.InitImageDrivers(false, c.userNS, c.engine.EngineConfig.File, image.OverlayFeature)
-				// fall through to print the kernel mount error
-			}
-			// mount error for other filesystems is considered fatal
-			return fmt.Errorf("can't mount %s filesystem to %s: %s", mnt.Type, mnt.Destination, err)
-		}
-		if remount {
-			if os.IsPermission(err) && c.userNS {
-				// when using user namespace we always try to apply mount flags with
-				// remount, then if we get a permission denied error, we continue
-				// execution by ignoring the error and warn user if the bind mount
-				// need to be mounted read-only
-				if flags&syscall.MS_RDONLY != 0 {
-					sylog.Warningf("Could not remount %s read-only: %s", mnt.Destination, err)
-				} else {
-					sylog.Verbosef("Could not remount %s: %s", mnt.Destination, err)
-				}
-				return nil
-			}
-			return fmt.Errorf("could not remount %s: %s", mnt.Destination, err)
+	return nil
+}
+
+// missingDestination handles the mount of source to the destination of mnt
+// missing in the container, the mount is skipped for the tags allowing it.
+func (c *container) missingDestination(mnt *mount.Point, tag mount.AuthorizedTag, source string) error {
+	switch tag {
+	case mount.KernelTag,
+		mount.HostfsTag,
+		mount.BindsTag,
+		mount.CwdTag,
+		mount.FilesTag,
+		mount.TmpTag:
+		c.skippedMount = append(c.skippedMount, mnt.Destination)
+		sylog.Warningf("Skipping mount %s [%s]: %s doesn't exist in container", source, tag, mnt.Destination)
+		return nil
+	default:
+		if c.engine.EngineConfig.GetWritableImage() {
+			sylog.Warningf(
+				"By using --writable, Apptainer can't create %s destination automatically without overlay or underlay",
+				mnt.Destination,
+			)
+		} else if !c.isLayerEnabled() {
+			sylog.Warningf("No layer in use (overlay or underlay), check your configuration, "+
+				"Apptainer can't create %s destination automatically without overlay or underlay", mnt.Destination)
 		}
+		return fmt.Errorf("destination %s doesn't exist in container", mnt.Destination)
+	}
+}
 
-		if mount.SkipOnError(mnt.InternalOptions) {
-			sylog.Warningf("could not mount %s: %s", mnt.Source, err)
-			c.skippedMount = append(c.skippedMount, mnt.Destination)
+// bindMountError handles the error of the bind mount, remount or mount
+// propagation change of mnt mounted with flags, it returns nil if the
+// error is ignored.
+func (c *container) bindMountError(mnt *mount.Point, tag mount.AuthorizedTag, source string, flags uintptr, err error) error {
+	if os.IsNotExist(err) {
+		return c.missingDestination(mnt, tag, source)
+	}
+	if mount.HasRemountFlag(flags) {
+		if os.IsPermission(err) && c.userNS {
+			// when using user namespace we always try to apply mount flags with
+			// remount, then if we get a permission denied error, we continue
+			// execution by ignoring the error and warn user if the bind mount
+			// need to be mounted read-only
+			if flags&syscall.MS_RDONLY != 0 {
+				sylog.Warningf("Could not remount %s read-only: %s", mnt.Destination, err)
+			} else {
+				sylog.Verbosef("Could not remount %s: %s", mnt.Destination, err)
+			}
 			return nil
 		}
-		return fmt.Errorf("could not mount %s: %s", mnt.Source, err)
+		starter.Report(starter.StageMount, mnt.Destination, err)
+		return fmt.Errorf("could not remount %s: %s", mnt.Destination, err)
+	}
+	if flags&syscall.MS_BIND == 0 && mount.HasPropagationFlag(flags) {
+		starter.Report(starter.StageMount, mnt.Destination, err)
+		return fmt.Errorf("could not set mount propagation of %s: %s", mnt.Destination, err)
 	}
 
+	if mount.SkipOnError(mnt.InternalOptions) {
+		sylog.Warningf("could not mount %s: %s", mnt.Source, err)
+		c.skippedMount = append(c.skippedMount, mnt.Destination)
+		return nil
+	}
+	starter.Report(starter.StageMount, mnt.Source, err)
+	return fmt.Errorf("could not mount %s: %s", mnt.Source, err)
+}
+
+// batchedMount is a mount queued to be performed with the next MountBatch
+// RPC call.
+type batchedMount struct {
+	point mount.Point
+	args  args.MountArgs
+}
+
+// flushMountBatch performs the queued user bind mounts with a single RPC
+// call instead of one call per bind mount, remount and mount propagation
+// change, in the same order. The errors are handled as with mountGeneric,
+// the mounts following an ignored error are resumed with a new call.
+func (c *container) flushMountBatch(system *mount.System) error {
+	batch := c.mountBatch
+	c.mountBatch = nil
+
+	for len(batch) > 0 {
+		pending := make([]batchedMount, 0, len(batch))
+		mounts := make([]args.MountArgs, 0, len(batch))
+		for _, m := range batch {
+			// a failed bind mount may have been skipped after its
+			// remount was queued
+			if m.args.Mountflags&syscall.MS_BIND == 0 && c.isSkippedMount(m.point.Destination) {
+				continue
+			}
+			pending = append(pending, m)
+			mounts = append(mounts, m.args)
+		}
+		if len(mounts) == 0 {
+			return nil
+		}
+
+		sylog.Debugf("Mounting %d user bind mount points with a single call", len(mounts))
+		i, err := c.rpcOps.MountBatch(mounts)
+		if err == nil {
+			return nil
+		} else if i < 0 {
+			return fmt.Errorf("while mounting user binds: %s", err)
+		}
+		m := pending[i]
+		if err := c.bindMountError(&m.point, mount.UserbindsTag, m.args.Source, m.args.Mountflags, err); err != nil {
+			return fmt.Errorf("mount %s->%s error: %s", m.point.Source, m.point.Destination, err)
+		}
+		batch = pending[i+1:]
+	}
 	return nil
 }
 
+// isSkippedMount returns whether the mount to dest was skipped.
+func (c *container) isSkippedMount(dest string) bool {
+	for _, skipped := range c.skippedMount {
+		if skipped == dest {
+			return true
+		}
+	}
+	return false
+}
+
+// mountIDMapped bind mounts source on dest as an ID-mapped mount mapping
+// the user to itself on disk, so files created by the container root user
+// in fakeroot mode are owned by the user rather than by a subordinate id.
+// The detached mount is created by the master process, with escalated
+// privileges in the setuid workflow, because it requires CAP_SYS_ADMIN in
+// the host user namespace, then it's passed to the RPC server which
+// attaches it in the container mount namespace.
+func (c *container) mountIDMapped(source, dest string) error {
+	socketPair := c.engine.EngineConfig.GetUnixSocketPair()
+	if socketPair[0] < 0 {
+		return fmt.Errorf("no socket available to pass the mount")
+	}
+
+	uid, gid := os.Getuid(), os.Getgid()
+	if os.Geteuid() != 0 {
+		dropPrivilege, err := priv.Escalate()
+		if err != nil {
+			return fmt.Errorf("ID-mapped mounts require root or a setuid installation: %s", err)
+		}
+		defer dropPrivilege()
+	}
+
+	treeFd, err := mount.IDMapTree(source, uid, gid)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(treeFd)
+
+	err = signalutil.IgnoreEINTR(func() error {
+		return unix.Sendmsg(socketPair[0], []byte{0}, unix.UnixRights(treeFd), nil, 0)
+	})
+	if err != nil {
+		return fmt.Errorf("while sending mount file descriptor: %s", err)
+	}
+	return c.rpcOps.MoveMount(socketPair[1], dest)
+}
+
 // mount image via loop
 func (c *container) mountImage(mnt *mount.Point) error {
 	var key []byte
@@ -842,6 +1165,12 @@ func (c *container) mountImage(mnt *mount.Point) error {
 		return fmt.Errorf("gocryptfs requires user namespace, please add `--userns` option")
 	}
 
+	if mountType == "squashfs" {
+		if err := driver.CheckKernelSquashfs(mnt.Source, offset); err != nil {
+			return err
+		}
+	}
+
 	attachFlag := os.O_RDWR
 	loopFlags := uint32(unix.LO_FLAGS_AUTOCLEAR)
 
@@ -1099,7 +1428,7 @@ func (c *container) addOverlayMount(system *mount.System) error {
 					overlayImageDriver = true
 				}
 
-				if os.Geteuid() != 0 && !overlayImageDriver {
+				if c.euid != 0 && !overlayImageDriver {
 					if !c.userNS {
 						return fmt.Errorf("only root user can use sandbox as overlay in setuid mode")
 					}
@@ -1107,7 +1436,11 @@ func (c *container) addOverlayMount(system *mount.System) error {
 				}
 
 				flags := uintptr(c.suidFlag | syscall.MS_NODEV)
-				err = system.Points.AddBind(mount.PreLayerTag, img.Path, dst, flags)
+				var options []string
+				if img.Writable && c.engine.EngineConfig.GetOverlayIDMap() {
+					options = append(options, "idmap")
+				}
+				err = system.Points.AddBind(mount.PreLayerTag, img.Path, dst, flags, options...)
 				if err != nil {
 					return fmt.Errorf("while adding sandbox image: %s", err)
 				}
@@ -1417,11 +1750,15 @@ func (c *container) addDevMount(system *mount.System) error {
 		if err := c.session.AddDir("/dev/shm"); err != nil {
 			return fmt.Errorf("failed to add /dev/shm session directory: %s", err)
 		}
-		devshmPath, _ := c.session.GetPath("/dev/shm")
-		flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
-		err := system.Points.AddFS(mount.DevTag, devshmPath, c.sessionFsType, flags, "mode=1777")
-		if err != nil {
-			return fmt.Errorf("failed to add /dev/shm temporary filesystem: %s", err)
+		// a /dev/shm tmpfs requested with --mount or --shm-size replaces
+		// the default one
+		if !c.hasFSMount("/dev/shm") {
+			devshmPath, _ := c.session.GetPath("/dev/shm")
+			flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+			err := system.Points.AddFS(mount.DevTag, devshmPath, c.sessionFsType, flags, "mode=1777")
+			if err != nil {
+				return fmt.Errorf("failed to add /dev/shm temporary filesystem: %s", err)
+			}
 		}
 
 		if c.ipcNS {
@@ -1460,7 +1797,7 @@ func (c *container) addDevMount(system *mount.System) error {
 			}
 			sylog.Debugf("Mounting devpts for staged /dev/pts")
 			devptsPath, _ := c.session.GetPath("/dev/pts")
-			err = system.Points.AddFS(mount.DevTag, devptsPath, "devpts", syscall.MS_NOSUID|syscall.MS_NOEXEC, options)
+			err := system.Points.AddFS(mount.DevTag, devptsPath, "devpts", syscall.MS_NOSUID|syscall.MS_NOEXEC, options)
 			if err != nil {
 				return fmt.Errorf("failed to add devpts filesystem: %s", err)
 			}
@@ -1552,6 +1889,13 @@ func (c *container) addDevMount(system *mount.System) error {
 			}
 		}
 
+		// GPU devices selected with --gpus or from a CDI specification
+		for _, dev := range c.engine.EngineConfig.GetGPUDevices() {
+			if err := c.addSessionDev(dev, system); err != nil {
+				return err
+			}
+		}
+
 		if err := c.addSessionDev("/dev/fd", system); err != nil {
 			return err
 		}
@@ -1701,11 +2045,44 @@ func (c *container) addBindsMount(system *mount.System) error {
 		if err := system.Points.AddRemount(mount.BindsTag, dst, flags); err != nil {
 			return fmt.Errorf("unable to add %s for remount: %s", dst, err)
 		}
+		if pflags := c.getBindPropagation(src, ""); pflags != 0 {
+			if err := system.Points.AddPropagation(mount.BindsTag, dst, pflags); err != nil {
+				return fmt.Errorf("unable to add %s mount propagation: %s", dst, err)
+			}
+		}
 	}
 
 	return nil
 }
 
+// getBindPropagation returns the mount propagation flags of a bind of the
+// host path src, set by the bind option propagation, or else by the
+// 'bind propagation' directive of the closest parent path of src, or 0
+// if no propagation is set. The propagation is applied after the bind and
+// its remount, mounts done in the container never reach the host as the
+// container mount namespace is a slave of the host one at best.
+func (c *container) getBindPropagation(src, propagation string) uintptr {
+	if propagation == "" {
+		match := ""
+		for path, p := range c.engine.EngineConfig.File.BindPropagation {
+			if (src == path || strings.HasPrefix(src, strings.TrimSuffix(path, "/")+"/")) && len(path) > len(match) {
+				match = path
+				propagation = p
+			}
+		}
+		if propagation == "" {
+			return 0
+		}
+		sylog.Debugf("Using 'bind propagation %s = %s' for %s", match, propagation, src)
+	}
+
+	flags, _ := mount.ConvertOptions([]string{propagation})
+	if flags&(syscall.MS_SHARED|syscall.MS_SLAVE) != 0 && !c.engine.EngineConfig.File.MountSlave {
+		sylog.Warningf("Mounts done on the host under %s won't show up in the container: 'mount slave' is disabled by configuration", src)
+	}
+	return flags
+}
+
 // getHomePaths returns the source and destination path of the requested home mount
 func (c *container) getHomePaths() (source string, dest string, err error) {
 	if c.engine.EngineConfig.GetCustomHome() {
@@ -1920,7 +2297,12 @@ func (c *container) addUserbindsMount(system *mount.System) error {
 
 		sylog.Debugf("Adding %s to mount list\n", src)
 
-		if err := system.Points.AddBind(mount.UserbindsTag, src, dst, flags); err == mount.ErrMountExists {
+		var options []string
+		if b.IDMap() {
+			options = append(options, "idmap")
+		}
+
+		if err := system.Points.AddBind(mount.UserbindsTag, src, dst, flags, options...); err == mount.ErrMountExists {
 			sylog.Warningf("While bind mounting '%s:%s': %s", src, dst, err)
 		} else if err != nil {
 			return fmt.Errorf("unable to add %s to mount list: %s", src, err)
@@ -1930,9 +2312,149 @@ func (c *container) addUserbindsMount(system *mount.System) error {
 				c.session.OverrideDir(dst, src)
 			}
 			system.Points.AddRemount(mount.UserbindsTag, dst, flags)
+			if pflags := c.getBindPropagation(src, b.Propagation()); pflags != 0 {
+				if err := system.Points.AddPropagation(mount.UserbindsTag, dst, pflags); err != nil {
+					return fmt.Errorf("unable to add %s mount propagation: %s", dst, err)
+				}
+			}
+		}
+	}
+
+	// files already exposed read-only by the bind of their parent
+	// directory don't need to be bind mounted again
+	isFile := func(path string) bool {
+		fi, err := os.Stat(path)
+		return err == nil && fi.Mode().IsRegular()
+	}
+	for _, dst := range system.Points.RemoveRedundantBinds(mount.UserbindsTag, isFile) {
+		sylog.Debugf("Skipping %s bind mount: already exposed by a parent bind mount", dst)
+	}
+
+	return nil
+}
+
+// containerIDs returns the uid and gid of the container user.
+func (c *container) containerIDs() (int, int) {
+	uid, gid := os.Getuid(), os.Getgid()
+	if c.engine.EngineConfig.GetFakeroot() {
+		return 0, 0
+	}
+	if uid == 0 && c.engine.EngineConfig.GetTargetUID() != 0 {
+		uid = c.engine.EngineConfig.GetTargetUID()
+	}
+	if gids := c.engine.EngineConfig.GetTargetGID(); gid == 0 && len(gids) > 0 {
+		gid = gids[0]
+	}
+	return uid, gid
+}
+
+// hasFSMount returns if a filesystem is mounted on dest with --mount.
+func (c *container) hasFSMount(dest string) bool {
+	for _, m := range c.engine.EngineConfig.GetFSMounts() {
+		if m.Destination == dest {
+			return c.engine.EngineConfig.File.UserBindControl
 		}
 	}
+	return false
+}
+
+// addFSMounts adds the tmpfs and devpts filesystems requested with --mount.
+// They are mounted with the user binds and disappear with the container
+// mount namespace, nothing is left to clean up on the host.
+func (c *container) addFSMounts(system *mount.System) error {
+	mounts := c.engine.EngineConfig.GetFSMounts()
+	if len(mounts) == 0 {
+		return nil
+	}
+	if !c.engine.EngineConfig.File.UserBindControl {
+		sylog.Warningf("Ignoring tmpfs and devpts mounts: user bind control disabled by system administrator")
+		return nil
+	}
+
+	devStaged := c.engine.EngineConfig.File.MountDev == "minimal" || c.engine.EngineConfig.GetContain()
+	uid, gid := c.containerIDs()
 
+	for _, m := range mounts {
+		if strings.HasPrefix(m.Destination, "/dev/") {
+			if c.engine.EngineConfig.File.MountDev == "no" || c.engine.EngineConfig.GetNoDev() {
+				sylog.Warningf("Skipping %s mount on %s: /dev disallowed by configuration", m.Type, m.Destination)
+				continue
+			}
+			// the destination must exist in the staged /dev
+			if devStaged && c.devSourcePath == "" {
+				if err := c.session.AddDir(m.Destination); err != nil {
+					return fmt.Errorf("failed to add %s session directory: %s", m.Destination, err)
+				}
+			}
+		}
+
+		var flags uintptr
+		var options []string
+
+		switch m.Type {
+		case apptainer.FSTypeTmpfs:
+			flags = syscall.MS_NOSUID | syscall.MS_NODEV
+			mode := m.Mode
+			if mode == "" {
+				mode = "1777"
+			}
+			options = append(options, "mode="+mode)
+			if m.Size > 0 {
+				options = append(options, fmt.Sprintf("size=%d", m.Size))
+			}
+			mUID, mGID := uid, gid
+			if m.UID != nil {
+				mUID = *m.UID
+			}
+			if m.GID != nil {
+				mGID = *m.GID
+			}
+			options = append(options, fmt.Sprintf("uid=%d", mUID), fmt.Sprintf("gid=%d", mGID))
+		case apptainer.FSTypeDevpts:
+			flags = syscall.MS_NOSUID | syscall.MS_NOEXEC
+			mode, ptmxMode := m.Mode, m.PtmxMode
+			if mode == "" {
+				mode = "620"
+			}
+			if ptmxMode == "" {
+				ptmxMode = "666"
+			}
+			options = append(options, "newinstance", "ptmxmode=0"+ptmxMode, "mode=0"+mode)
+			if m.UID != nil {
+				options = append(options, fmt.Sprintf("uid=%d", *m.UID))
+			}
+			if m.GID != nil {
+				options = append(options, fmt.Sprintf("gid=%d", *m.GID))
+			} else if !c.userNS {
+				group, err := user.GetGrNam("tty")
+				if err != nil {
+					return fmt.Errorf("problem resolving 'tty' group gid: %s", err)
+				}
+				options = append(options, fmt.Sprintf("gid=%d", group.GID))
+			}
+			// with a host /dev, the kernel allocates the PTYs opened
+			// with /dev/ptmx from the devpts mounted on /dev/pts, the
+			// staged /dev has a /dev/ptmx symlink instead
+			if devStaged && c.devSourcePath == "" {
+				if _, err := c.session.GetPath("/dev/ptmx"); err != nil {
+					if err := c.session.AddSymlink("/dev/ptmx", "/dev/pts/ptmx"); err != nil {
+						return fmt.Errorf("failed to create /dev/ptmx symlink: %s", err)
+					}
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported mount type %q", m.Type)
+		}
+		if m.Readonly {
+			flags |= syscall.MS_RDONLY
+		}
+
+		sylog.Debugf("Adding %s filesystem on %s to mount list", m.Type, m.Destination)
+		err := system.Points.AddFS(mount.UserbindsTag, m.Destination, m.Type, flags, strings.Join(options, ","))
+		if err != nil {
+			return fmt.Errorf("unable to add %s filesystem on %s to mount list: %s", m.Type, m.Destination, err)
+		}
+	}
 	return nil
 }
 
@@ -1969,10 +2491,10 @@ func (c *container) addTmpMount(system *mount.System) error {
 			tmpSource = filepath.Join(workdir, tmpSource)
 			vartmpSource = filepath.Join(workdir, vartmpSource)
 
-			if err := fs.Mkdir(tmpSource, os.ModeSticky|0o777); err != nil && !os.IsExist(err) {
+			if err := c.mkdirWorkdir(fs.Mkdir, tmpSource, os.ModeSticky|0o777); err != nil {
 				return fmt.Errorf("failed to create %s: %s", tmpSource, err)
 			}
-			if err := fs.Mkdir(vartmpSource, os.ModeSticky|0o777); err != nil && !os.IsExist(err) {
+			if err := c.mkdirWorkdir(fs.Mkdir, vartmpSource, os.ModeSticky|0o777); err != nil {
 				return fmt.Errorf("failed to create %s: %s", vartmpSource, err)
 			}
 		} else {
@@ -2018,6 +2540,19 @@ func (c *container) addTmpMount(system *mount.System) error {
 	return nil
 }
 
+// mkdirWorkdir creates the directory path of the --workdir directory with
+// mkdir, if it doesn't exist. Nothing is created when the mount points are
+// only planned.
+func (c *container) mkdirWorkdir(mkdir func(string, os.FileMode) error, path string, mode os.FileMode) error {
+	if c.plan {
+		return nil
+	}
+	if err := mkdir(path, mode); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (c *container) addScratchMount(system *mount.System) error {
 	const scratchSessionDir = "/scratch"
 
@@ -2042,7 +2577,7 @@ func (c *container) addScratchMount(system *mount.System) error {
 			return fmt.Errorf("can't determine absolute path of workdir %s: %s", workdir, err)
 		}
 		sourceDir := filepath.Join(workdir, scratchSessionDir)
-		if err := fs.MkdirAll(sourceDir, 0o750); err != nil {
+		if err := c.mkdirWorkdir(fs.MkdirAll, sourceDir, 0o750); err != nil {
 			return fmt.Errorf("could not create scratch working directory %s: %s", sourceDir, err)
 		}
 	}
@@ -2055,7 +2590,7 @@ func (c *container) addScratchMount(system *mount.System) error {
 		fullSourceDir, _ := c.session.GetPath(src)
 		if hasWorkdir {
 			fullSourceDir = filepath.Join(workdir, scratchSessionDir, dir)
-			if err := fs.MkdirAll(fullSourceDir, 0o750); err != nil {
+			if err := c.mkdirWorkdir(fs.MkdirAll, fullSourceDir, 0o750); err != nil {
 				return fmt.Errorf("could not create scratch working directory %s: %s", fullSourceDir, err)
 			}
 		}
@@ -2150,30 +2685,32 @@ func (c *container) addCwdMount(system *mount.System) error {
 		}
 		return fmt.Errorf("could not bind cwd directory %s into container: %s", cwdHost, err)
 	}
-	return system.Points.AddRemount(mount.CwdTag, cwdHost, flags)
-}
-
-func (c *container) createCwdDir(system *mount.System) error {
-	if c.engine.EngineConfig.GetContain() {
-		c.skipCwd = true
-		sylog.Verbosef("Not mounting current directory: contain was requested")
-		return nil
-	}
-	if !c.engine.EngineConfig.File.UserBindControl {
-		c.skipCwd = true
-		sylog.Warningf("Not mounting current directory: user bind control is disabled by system administrator")
-		return nil
-	}
-	if c.engine.EngineConfig.GetNoCwd() {
-		c.skipCwd = true
+	return system.Points.AddRemount(mount.CwdTag, cwdHost, flags)
+}
+
+// cwdMountAllowed returns whether the current working directory may be
+// mounted in the container, depending on the image content, and logs why
+// it's not mounted otherwise.
+func (c *container) cwdMountAllowed(cwdHost string) bool {
+	switch {
+	case c.engine.EngineConfig.GetContain():
+		sylog.Verbosef("Not mounting current directory: contain was requested")
+	case !c.engine.EngineConfig.File.UserBindControl:
+		sylog.Warningf("Not mounting current directory: user bind control is disabled by system administrator")
+	case c.engine.EngineConfig.GetNoCwd():
 		sylog.Debugf("Skipping current directory mount by user request.")
-		return nil
+	case cwdHost == "" || cwdHost == "/":
+		sylog.Warningf("No current working directory set: skipping mount")
+	default:
+		return true
 	}
+	return false
+}
 
+func (c *container) createCwdDir(system *mount.System) error {
 	cwdHost := filepath.Clean(c.engine.EngineConfig.GetCwd())
-	if cwdHost == "" || cwdHost == "/" {
+	if !c.cwdMountAllowed(cwdHost) {
 		c.skipCwd = true
-		sylog.Warningf("No current working directory set: skipping mount")
 		return nil
 	} else if cwdHost[0] != '/' {
 		return fmt.Errorf("current working directory %s is not an absolute path", cwdHost)
@@ -2354,7 +2891,10 @@ func (c *container) addFilesMount(system *mount.System) error {
 	return nil
 }
 
-func (c *container) addIdentityMount(system *mount.System) error {
+// identityUID returns the user ID of the container process, and whether
+// the /etc/passwd and /etc/group files are generated for it, they are not
+// when root runs a writable container.
+func (c *container) identityUID() (int, bool) {
 	uid := os.Getuid()
 	if uid == 0 && c.engine.EngineConfig.GetTargetUID() != 0 {
 		uid = c.engine.EngineConfig.GetTargetUID()
@@ -2362,10 +2902,16 @@ func (c *container) addIdentityMount(system *mount.System) error {
 		uid = 0
 	}
 
-	if (uid == 0) &&
+	writable := (uid == 0) &&
 		(c.engine.EngineConfig.GetWritableImage() ||
 			c.engine.EngineConfig.GetWritableTmpfs()) ||
-		c.engine.EngineConfig.GetWritableOverlay() {
+		c.engine.EngineConfig.GetWritableOverlay()
+	return uid, !writable || c.engine.EngineConfig.GetReadOnlyRoot()
+}
+
+func (c *container) addIdentityMount(system *mount.System) error {
+	uid, ok := c.identityUID()
+	if !ok {
 		sylog.Verbosef("skipping bind-mount of /etc/passwd and /etc/group (container is writable running as root)")
 		return nil
 	}
@@ -2429,31 +2975,14 @@ func (c *container) addResolvConfMount(system *mount.System) error {
 	resolvConf := "/etc/resolv.conf"
 
 	if c.engine.EngineConfig.File.ConfigResolvConf {
-		var err error
-		var content []byte
-
-		dns := c.engine.EngineConfig.GetDNS()
-
-		if dns == "" {
-			r, err := os.Open(resolvConf)
-			if err != nil {
-				return err
-			}
-			content, err = io.ReadAll(r)
-			r.Close()
-			if err != nil {
-				return err
-			}
-		} else {
-			dns = strings.Replace(dns, " ", "", -1)
-			content, err = files.ResolvConf(strings.Split(dns, ","))
-			if err != nil {
-				return err
-			}
+		content, err := c.hostResolvConf()
+		if err != nil {
+			return err
 		}
 		if err := c.session.AddFile(resolvConf, content); err != nil {
 			sylog.Warningf("failed to add resolv.conf session file: %s", err)
 		}
+		resolvContent = content
 		sessionFile, _ := c.session.GetPath(resolvConf)
 
 		sylog.Debugf("Adding %s to mount list\n", resolvConf)
@@ -2468,6 +2997,78 @@ func (c *container) addResolvConfMount(system *mount.System) error {
 	return nil
 }
 
+// hostResolvConf returns the content of the container resolv.conf before
+// the networks are set up, the host one or the one built from --dns,
+// --dns-search and --dns-option. The host nameservers are used when only
+// the search domains or the options are set.
+func (c *container) hostResolvConf() ([]byte, error) {
+	const resolvConf = "/etc/resolv.conf"
+
+	split := func(list string) []string {
+		var values []string
+		for _, v := range strings.Split(strings.Replace(list, " ", "", -1), ",") {
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+
+	dns := c.engine.EngineConfig.GetDNS()
+	search, options := c.engine.EngineConfig.GetDNSSearch()
+	if dns == "" && search == "" && options == "" {
+		return os.ReadFile(resolvConf)
+	}
+	if dns != "" {
+		// keep the error of an empty nameserver list
+		if _, err := files.ResolvConf(split(dns)); err != nil {
+			return nil, err
+		}
+	}
+
+	conf := files.DNSConfig{
+		Nameservers: split(dns),
+		Search:      split(search),
+		Options:     split(options),
+	}
+	if dns == "" {
+		host, err := os.ReadFile(resolvConf)
+		if err != nil {
+			return nil, err
+		}
+		conf.Nameservers = files.ParseResolvConf(host).Nameservers
+	}
+	return conf.Content()
+}
+
+func (c *container) addLocaltimeMount(system *mount.System) error {
+	localtime := "/etc/localtime"
+
+	zone := c.engine.EngineConfig.GetTimezone()
+	if zone == "" {
+		return nil
+	}
+
+	// the zone is resolved again here as the engine configuration
+	// comes from the user
+	content, err := files.Localtime(zone)
+	if err != nil {
+		return fmt.Errorf("while reading timezone %s: %s", zone, err)
+	}
+	if err := c.session.AddFile(localtime, content); err != nil {
+		return fmt.Errorf("failed to add localtime session file: %s", err)
+	}
+	sessionFile, _ := c.session.GetPath(localtime)
+
+	sylog.Debugf("Adding %s to mount list\n", localtime)
+	err = system.Points.AddBind(mount.FilesTag, sessionFile, localtime, syscall.MS_BIND)
+	if err != nil {
+		return fmt.Errorf("unable to add %s to mount list: %s", localtime, err)
+	}
+	sylog.Verbosef("Default mount: %s:%s (timezone %s)", localtime, localtime, zone)
+	return nil
+}
+
 func (c *container) addHostnameMount(system *mount.System) error {
 	hostnameFile := "/etc/hostname"
 
@@ -2491,19 +3092,100 @@ func (c *container) addHostnameMount(system *mount.System) error {
 				return fmt.Errorf("unable to add %s to mount list: %s", hostnameFile, err)
 			}
 			sylog.Verbosef("Default mount: /etc/hostname:/etc/hostname")
-			if _, err := c.rpcOps.SetHostname(hostname); err != nil {
-				return fmt.Errorf("failed to set container hostname: %s", err)
+			if err := c.setHostname(hostname); err != nil {
+				return err
+			}
+			// the hosts file of the container is only known once the
+			// root filesystem and the binds are set
+			if err := system.RunAfterTag(mount.SharedTag, c.addHostsMount); err != nil {
+				return err
 			}
 		}
+	} else if c.engine.EngineConfig.GetHostname() != "" {
+		sylog.Warningf("Ignoring hostname %s, no UTS namespace is created for the container", c.engine.EngineConfig.GetHostname())
 	} else {
 		sylog.Debugf("Skipping hostname mount, not virtualizing UTS namespace on user request")
 	}
 	return nil
 }
 
+// hostsBoundByUser returns the source of the /etc/hosts file bound by the
+// user, if any.
+func hostsBoundByUser(system *mount.System) (string, bool) {
+	for _, point := range system.Points.GetByTag(mount.UserbindsTag) {
+		if point.Destination == "/etc/hosts" {
+			return point.Source, true
+		}
+	}
+	return "", false
+}
+
+// setHostname sets the hostname and domain name of the container UTS
+// namespace, unless the mount points are only planned.
+func (c *container) setHostname(hostname string) error {
+	if c.plan {
+		return nil
+	}
+	if _, err := c.rpcOps.SetHostname(hostname); err != nil {
+		return fmt.Errorf("failed to set container hostname: %s", err)
+	}
+	if domainname := c.engine.EngineConfig.GetDomainname(); domainname != "" {
+		sylog.Debugf("Set container domainname %s", domainname)
+		if _, err := c.rpcOps.SetDomainname(domainname); err != nil {
+			return fmt.Errorf("failed to set container domainname: %s", err)
+		}
+	}
+	return nil
+}
+
+// addHostsMount binds a hosts file mapping 127.0.1.1 to the container
+// hostname over /etc/hosts, so the hostname resolves to its fully qualified
+// name. The entries are those of the hosts file bound by 'bind path' or
+// contain, or else those of the container image. A hosts file bound by the
+// user is kept as is.
+func (c *container) addHostsMount(system *mount.System) error {
+	const hostsPath = "/etc/hosts"
+
+	if source, ok := hostsBoundByUser(system); ok {
+		sylog.Debugf("Skipping %s generation, bound by user from %s", hostsPath, source)
+		return nil
+	}
+
+	base := filepath.Join(c.session.RootFsPath(), hostsPath)
+	for _, point := range system.Points.GetByTag(mount.BindsTag) {
+		if point.Destination == hostsPath {
+			base = point.Source
+		}
+	}
+	sylog.Debugf("Adding container hostname to the entries of %s", base)
+	entries, err := os.ReadFile(base)
+	if err != nil {
+		sylog.Debugf("Using default hosts entries, could not read %s: %s", base, err)
+		entries = files.DefaultHosts()
+	}
+
+	content, err := files.Hosts(entries, c.engine.EngineConfig.GetHostname(), c.engine.EngineConfig.GetDomainname())
+	if err != nil {
+		return fmt.Errorf("unable to add hostname to hosts file: %s", err)
+	}
+	if err := c.session.AddFile(sessionHostsPath, content); err != nil {
+		return fmt.Errorf("failed to add hosts session file: %s", err)
+	}
+	defer c.session.Update()
+	sessionFile, _ := c.session.GetPath(sessionHostsPath)
+
+	sylog.Debugf("Adding %s to mount list\n", hostsPath)
+	if err := system.Points.AddBind(mount.FilesTag, sessionFile, hostsPath, syscall.MS_BIND); err != nil {
+		return fmt.Errorf("unable to add %s to mount list: %s", hostsPath, err)
+	}
+	sylog.Verbosef("Default mount: /etc/hosts:/etc/hosts (hostname %s)", c.engine.EngineConfig.GetHostname())
+	return nil
+}
+
 func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(context.Context) error, error) {
 	const (
 		fakerootNet  = "fakeroot"
+		bridgeNet    = "bridge"
 		noneNet      = "none"
 		procNetNs    = "/proc/self/ns/net"
 		sessionNetNs = "/netns"
@@ -2511,22 +3193,69 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 
 	net := c.engine.EngineConfig.GetNetwork()
 
-	// If we haven't requested a network namespace, or we have but with no config, we are done here
-	if !c.netNS || net == noneNet {
+	// If we haven't requested a network namespace we are done here
+	if !c.netNS {
 		return nil, nil
 	}
+	publish, err := c.engine.publishPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	// With no network config, the namespace must only contain the loopback
+	// interface, this doesn't require any CNI plugin
+	if net == noneNet {
+		if ip, mac := c.engine.EngineConfig.GetInstanceAddress(); len(publish) == 0 && (ip != "" || mac != "") {
+			return nil, fmt.Errorf("--ip and --mac require a CNI network, not --network %s", noneNet)
+		}
+		if len(publish) > 0 {
+			return c.prepareRootlessNetwork(pid, publish, "")
+		}
+		return c.auditIsolatedNetwork, nil
+	}
+
+	// --network pasta or slirp4netns selects the rootless network backend
+	if rootless.IsBackend(net) {
+		return c.prepareRootlessNetwork(pid, publish, net)
+	}
 
-	// In fakeroot mode only permit the `fakeroot` CNI config, overriding any other request.
 	euid := os.Geteuid()
+
+	cniPath := &network.CNIPath{}
+
+	cniPath.Conf = c.engine.EngineConfig.File.CniConfPath
+	if cniPath.Conf == "" {
+		cniPath.Conf = defaultCNIConfPath
+	}
+	cniPath.Plugin = c.engine.EngineConfig.File.CniPluginPath
+	if cniPath.Plugin == "" {
+		cniPath.Plugin = defaultCNIPluginPath
+	}
+	// the networks created by the user are only used in rootless mode
+	if euid != 0 {
+		cniPath.UserConf = filepath.Join(c.engine.EngineConfig.GetConfigDir(), syfs.NetworkConfDir)
+		cniPath.UserID = euid
+	}
+
+	// In fakeroot mode only permit the `fakeroot` CNI config, or the networks
+	// created by the user, overriding any other request.
 	fakeroot := c.engine.EngineConfig.GetFakeroot()
 	forceFakerootNet := false
 	if fakeroot && euid != 0 {
-		if net != fakerootNet {
+		userNets := true
+		for _, n := range strings.Split(net, ",") {
+			userNets = userNets && cniPath.IsUserNetwork(n)
+		}
+		if userNets {
+			sylog.Debugf("Using network(s) %s created by the user in --fakeroot mode", net)
+		} else if net != fakerootNet {
 			sylog.Warningf("Only --network=%s is permitted in --fakeroot mode. You requested '%s'.", fakerootNet, net)
 			sylog.Warningf("Overriding with --network=%s", fakerootNet)
 		}
 		forceFakerootNet = true
-		net = fakerootNet
+		if !userNets {
+			net = fakerootNet
+		}
 	}
 
 	allowedNetUnpriv := false
@@ -2550,7 +3279,8 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 			allowedNetNetwork = adminPermitted || fakerootPermitted
 			// If any one requested network is not allowed, disallow the whole config
 			if !allowedNetNetwork {
-				if !fakeroot {
+				// the ports are published by the rootless network instead
+				if !fakeroot && (len(publish) == 0 || !c.userNS) {
 					sylog.Errorf("Network %s is not permitted for unprivileged users.", n)
 				}
 				break
@@ -2561,6 +3291,10 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 	}
 
 	if (c.userNS || euid != 0) && !fakeroot && !allowedNetUnpriv {
+		if len(publish) > 0 && c.userNS {
+			sylog.Debugf("Network %s not permitted, publishing ports with the rootless network", net)
+			return c.prepareRootlessNetwork(pid, publish, "")
+		}
 		return nil, fmt.Errorf("network requires root or a suid installation with /etc/subuid --fakeroot; non-root users can only use --network=%s unless permitted by the administrator", noneNet)
 	}
 
@@ -2576,33 +3310,61 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 	}
 	networks := strings.Split(net, ",")
 
-	cniPath := &network.CNIPath{}
+	setup, err := network.NewSetup(networks, strconv.Itoa(pid), nspath, cniPath)
+	if err != nil {
+		return nil, fmt.Errorf("network setup failed: %s", err)
+	}
+	networkSetup = setup
 
-	cniPath.Conf = c.engine.EngineConfig.File.CniConfPath
-	if cniPath.Conf == "" {
-		cniPath.Conf = defaultCNIConfPath
+	if subnet := c.engine.EngineConfig.File.BridgeIPv6Subnet; subnet != "" && slice.ContainsString(networks, bridgeNet) {
+		if err := networkSetup.SetIPv6Subnet(bridgeNet, subnet); err != nil {
+			return nil, fmt.Errorf("while setting the IPv6 subnet of the %s network: %s", bridgeNet, err)
+		}
 	}
-	cniPath.Plugin = c.engine.EngineConfig.File.CniPluginPath
-	if cniPath.Plugin == "" {
-		cniPath.Plugin = defaultCNIPluginPath
+
+	if err := networkSetup.SetCapabilityArgs(c.engine.EngineConfig.GetNetworkCapabilityArgs()); err != nil {
+		return nil, fmt.Errorf("error while setting network arguments file: %s", err)
 	}
 
-	setup, err := network.NewSetup(networks, strconv.Itoa(pid), nspath, cniPath)
+	addressArgs, err := c.instanceAddressArgs(networks[0])
 	if err != nil {
-		return nil, fmt.Errorf("network setup failed: %s", err)
+		return nil, err
 	}
-	networkSetup = setup
 
 	netargs := c.engine.EngineConfig.GetNetworkArgs()
+	if len(publish) > 0 {
+		if err := rootless.CheckPorts(publish); err != nil {
+			return nil, err
+		}
+		// the ports are published by the portmap plugin of the first network
+		for _, p := range publish {
+			netargs = append(netargs, "portmap="+p.String())
+		}
+	}
+	netargs = append(netargs, addressArgs...)
 	if err := networkSetup.SetArgs(netargs); err != nil {
 		return nil, fmt.Errorf("error while setting network arguments: %s", err)
 	}
+	// adding IPv6 addresses would fail the CNI ADD
+	if !network.IPv6Enabled() {
+		changed, err := networkSetup.DisableIPv6()
+		if err != nil {
+			return nil, fmt.Errorf("network setup failed: %s", err)
+		}
+		if len(changed) > 0 {
+			sylog.Warningf("IPv6 is disabled on this host, only configuring IPv4 on network(s) %s", strings.Join(changed, ", "))
+		}
+	}
+	if err := c.engine.runNetworkCallbacks("ADD", networkSetup); err != nil {
+		return nil, fmt.Errorf("network setup failed: %s", err)
+	}
 
 	return func(ctx context.Context) error {
 		if fakeroot || allowedNetUnpriv {
-			// prevent port hijacking between user processes
-			for _, n := range strings.Split(net, ",") {
-				if err := networkSetup.SetPortProtection(n, 0); err != nil {
+			// prevent port hijacking between user processes, including
+			// on the networks added by plugins
+			for _, n := range networkSetup.Networks() {
+				if err := networkSetup.SetPortProtection(n.Config.Name, 0); err != nil {
 					return err
 				}
 			}
@@ -2620,10 +3382,239 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 		if err := networkSetup.AddNetworks(ctx); err != nil {
 			return fmt.Errorf("%s", err)
 		}
+		return c.setNetworkDNS()
+	}, nil
+}
+
+// instanceAddressArgs returns the network arguments requesting the
+// addresses of a named instance on network, the ones set with --ip and
+// --mac or else the ones allocated to the instance by a previous start if
+// they are still free. An address set with --ip is reserved for the
+// instance in the allocations of the user, it must not be reserved by
+// another instance nor in use on the network.
+func (c *container) instanceAddressArgs(network string) ([]string, error) {
+	ip, mac := c.engine.EngineConfig.GetInstanceAddress()
+	if !c.engine.EngineConfig.GetInstance() {
+		return nil, nil
+	}
+	name := c.engine.CommonConfig.ContainerID
+
+	os.Setenv("APPTAINER_CONFIGDIR", c.engine.EngineConfig.GetConfigDir())
+
+	err := instance.UpdateAllocations("", func(allocs instance.Allocations) error {
+		if ip == "" {
+			a := allocs[name]
+			if a == nil || a.Network != network {
+				return nil
+			}
+			used, err := networkSetup.IPAllocated(network, net.ParseIP(a.IP))
+			if err != nil {
+				return err
+			}
+			if used {
+				sylog.Infof("Address %s of instance %s is in use on network %s, allocating a new one", a.IP, name, network)
+				return nil
+			}
+			sylog.Debugf("Reusing the address %s of instance %s on network %s", a.IP, name, network)
+			ip = a.IP
+			if mac == "" {
+				mac = a.MAC
+			}
+			return nil
+		}
+
+		for other, a := range allocs {
+			if other != name && a.Network == network && net.ParseIP(a.IP).Equal(net.ParseIP(ip)) {
+				return fmt.Errorf("address %s on network %s is allocated to instance %s, release it with 'apptainer instance stop --release-ip %s'", ip, network, other, other)
+			}
+		}
+		used, err := networkSetup.IPAllocated(network, net.ParseIP(ip))
+		if err != nil {
+			return err
+		}
+		if used {
+			return fmt.Errorf("address %s is already in use on network %s", ip, network)
+		}
+		allocs[name] = &instance.Allocation{Network: network, IP: ip, MAC: mac}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while allocating the address of instance %s: %w", name, err)
+	}
+
+	var args []string
+	if ip != "" {
+		args = append(args, network+":IP="+ip)
+	}
+	if mac != "" {
+		args = append(args, network+":MAC="+mac)
+	}
+	return args, nil
+}
+
+// setNetworkDNS writes the DNS configuration returned by the CNI plugins
+// of the networks to the container resolv.conf, according to the container
+// dns policy directive: followed by the entries of the host resolv.conf, or
+// the ones set with --dns, --dns-search and --dns-option, with cni-first,
+// alone with cni-only, and not at all with host-only.
+func (c *container) setNetworkDNS() error {
+	policy := c.engine.EngineConfig.File.ContainerDNSPolicy
+	if !c.engine.EngineConfig.File.ConfigResolvConf || policy == "host-only" {
+		return nil
+	}
+	dns, err := networkSetup.GetDNS()
+	if err != nil {
+		return err
+	}
+	conf := files.DNSConfig{
+		Nameservers: dns.Nameservers,
+		Domain:      dns.Domain,
+		Search:      dns.Search,
+		Options:     dns.Options,
+	}
+	if conf.Empty() {
+		return nil
+	}
+
+	if policy == "cni-only" {
+		if search, options := c.engine.EngineConfig.GetDNSSearch(); c.engine.EngineConfig.GetDNS() != "" || search != "" || options != "" {
+			sylog.Warningf("--dns, --dns-search and --dns-option are ignored with 'container dns policy = cni-only'")
+		}
+	} else {
+		conf = files.MergeDNS(conf, files.ParseResolvConf(resolvContent))
+	}
+	content, err := conf.Content()
+	if err != nil {
+		return fmt.Errorf("invalid DNS configuration returned by the networks: %s", err)
+	}
+	sylog.Debugf("Setting the DNS configuration returned by the networks with the %s policy", policy)
+	if err := c.rpcOps.ResolvConf(content); err != nil {
+		sylog.Warningf("Could not set the DNS configuration returned by the networks: %s", err)
+		return nil
+	}
+	resolvContent = content
+	return nil
+}
+
+// prepareRootlessNetwork returns the function starting the rootless network
+// backend forwarding the published ports to the network namespace of the
+// container process pid. The backend is the one selected with --network,
+// or the one set in apptainer.conf when backend is empty. The namespace
+// must be owned by the user, unless running as root.
+func (c *container) prepareRootlessNetwork(pid int, publish []network.PortMapEntry, backend string) (func(context.Context) error, error) {
+	if !c.userNS && os.Geteuid() != 0 {
+		if backend != "" {
+			return nil, fmt.Errorf("--network %s requires a user namespace with --userns or --fakeroot", backend)
+		}
+		return nil, fmt.Errorf("--publish requires a network permitted by the administrator, or a user namespace with --userns or --fakeroot")
+	}
+
+	if ip, mac := c.engine.EngineConfig.GetInstanceAddress(); ip != "" || mac != "" {
+		sylog.Warningf("--ip and --mac are ignored by the rootless network, they require a CNI network")
+	}
+
+	if backend == "" {
+		backend = c.engine.EngineConfig.File.RootlessNetworkBackend
+	}
+	name, path, err := rootless.FindBackend(backend)
+	if err != nil {
+		return nil, err
+	}
+	if err := rootless.CheckPorts(publish); err != nil {
+		return nil, err
+	}
+
+	var dns []string
+	if d := c.engine.EngineConfig.GetDNS(); d != "" {
+		dns = strings.Split(d, ",")
+	}
+
+	return func(ctx context.Context) error {
+		n, err := rootless.Start(name, path, pid, publish, dns)
+		if err != nil {
+			return err
+		}
+		rootlessNet = n
 		return nil
 	}, nil
 }
 
+// publishPorts returns the container ports published on the host.
+func (e *EngineOperations) publishPorts() ([]network.PortMapEntry, error) {
+	ports := e.EngineConfig.GetPublishPorts()
+	publish := make([]network.PortMapEntry, 0, len(ports))
+	for _, p := range ports {
+		pm, err := network.ParsePublish(p)
+		if err != nil {
+			return nil, err
+		}
+		publish = append(publish, pm)
+	}
+	return publish, nil
+}
+
+// runNetworkCallbacks calls the NetworkConfig callbacks of the plugins
+// with the networks of setup, before the CNI command cmd, and applies
+// their changes to setup.
+func (e *EngineOperations) runNetworkCallbacks(cmd string, setup *network.Setup) error {
+	callbackType := (apptainercallback.NetworkConfig)(nil)
+	callbacks, err := plugin.LoadCallbacks(callbackType)
+	if err != nil {
+		return fmt.Errorf("while loading plugins callbacks '%T': %s", callbackType, err)
+	}
+	if len(callbacks) == 0 {
+		return nil
+	}
+
+	ns := &apptainercallback.NetworkSetup{
+		Command: cmd,
+		Container: apptainercallback.NetworkContainer{
+			UID:   os.Getuid(),
+			Image: e.EngineConfig.GetImage(),
+		},
+		Networks: setup.Networks(),
+	}
+	if pw, err := user.CurrentOriginal(); err == nil {
+		ns.Container.User = pw.Name
+	}
+	if e.EngineConfig.GetInstance() {
+		ns.Container.Instance = e.CommonConfig.ContainerID
+	}
+
+	for _, cb := range callbacks {
+		if err := cb.(apptainercallback.NetworkConfig)(ns); err != nil {
+			return err
+		}
+	}
+	return setup.SetNetworks(ns.Networks)
+}
+
+// auditIsolatedNetwork reports interfaces and routes found in the container
+// network namespace when no network was configured, and ensures that nothing
+// but the loopback interface is present.
+func (c *container) auditIsolatedNetwork(_ context.Context) error {
+	audit, err := c.rpcOps.NetworkAudit()
+	if err != nil {
+		return fmt.Errorf("while auditing container network namespace: %s", err)
+	}
+
+	for _, i := range audit.Interfaces {
+		state := "down"
+		if i.Up {
+			state = "up"
+		}
+		sylog.Verbosef("Network namespace audit: interface %s is %s", i.Name, state)
+	}
+	for _, r := range audit.Routes {
+		sylog.Verbosef("Network namespace audit: route %s", r)
+	}
+
+	if foreign := audit.ForeignInterfaces(); len(foreign) > 0 {
+		return fmt.Errorf("unexpected network interface(s) %s found in isolated network namespace", strings.Join(foreign, ", "))
+	}
+	return nil
+}
+
 // getFuseFdFromRPC returns fuse file descriptors from RPC server based on
 // the file descriptor list provided in argument, it also returns an
 // additional file descriptor corresponding to /proc/self/ns/user.
@@ -2638,7 +3629,10 @@ func (c *container) getFuseFdFromRPC(fds []int) ([]int, error) {
 
 	bufSpace := (len(fds) + 1) * 4
 	buf := make([]byte, unix.CmsgSpace(bufSpace))
-	_, _, _, _, err := unix.Recvmsg(socketPair[0], nil, buf, 0)
+	err := signalutil.IgnoreEINTR(func() error {
+		_, _, _, _, err := unix.Recvmsg(socketPair[0], nil, buf, 0)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("while receiving file descriptors: %s", err)
 	}
@@ -2679,7 +3673,10 @@ func (c *container) openFuseFdFromRPC() (int, int, error) {
 
 	bufSpace := 4
 	buf := make([]byte, unix.CmsgSpace(bufSpace))
-	_, _, _, _, err = unix.Recvmsg(socketPair[0], nil, buf, 0)
+	err = signalutil.IgnoreEINTR(func() error {
+		_, _, _, _, err := unix.Recvmsg(socketPair[0], nil, buf, 0)
+		return err
+	})
 	if err != nil {
 		return -1, -1, fmt.Errorf("while receiving file descriptors: %s", err)
 	}
@@ -2706,7 +3703,7 @@ func (c *container) openFuseFdFromRPC() (int, int, error) {
 // mount requests for FUSE filesystems
 func (c *container) addFuseMount(system *mount.System) (int, error) {
 	fakeroot := c.engine.EngineConfig.GetFakeroot()
-	fakerootHybrid := fakeroot && os.Geteuid() != 0
+	fakerootHybrid := fakeroot && c.euid != 0
 
 	uid := os.Getuid()
 	gid := os.Getgid()
@@ -2734,7 +3731,7 @@ func (c *container) addFuseMount(system *mount.System) (int, error) {
 		fds = append(fds, fuseMount.Fd)
 	}
 
-	if len(fds) > 0 {
+	if len(fds) > 0 && !c.plan {
 		newfds, err := c.getFuseFdFromRPC(fds)
 		if err != nil {
 			return usernsFd, err
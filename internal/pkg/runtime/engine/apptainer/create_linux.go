@@ -11,14 +11,22 @@ package apptainer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/rpc"
 
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer/rpc/client"
+	"github.com/apptainer/apptainer/pkg/image"
 	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
 )
 
+// imageLocks are the lock files held by the master process while the
+// container uses images for writing.
+var imageLocks []*lock.File
+
 // CreateContainer is called from master process to prepare container
 // environment, e.g. perform mount operations, setup network, etc.
 //
@@ -40,6 +48,10 @@ func (e *EngineOperations) CreateContainer(ctx context.Context, pid int, rpcConn
 		return nil
 	}
 
+	if err := e.lockWritableImages(); err != nil {
+		return err
+	}
+
 	rpcOps := &client.RPC{
 		Client: rpc.NewClient(rpcConn),
 		Name:   e.CommonConfig.EngineName,
@@ -50,3 +62,46 @@ func (e *EngineOperations) CreateContainer(ctx context.Context, pid int, rpcConn
 
 	return create(ctx, e, rpcOps, pid)
 }
+
+// lockWritableImages creates a lock file next to each image file used for
+// writing, held until the container exits. Unlike the byte-range locks
+// taken when the images are opened, the lock files prevent a concurrent
+// writable use of the images from other hosts sharing a NFS, Lustre or GPFS
+// filesystem. Images used read-only, like with --overlay image:ro, are
+// not locked so that they can be used by many containers.
+func (e *EngineOperations) lockWritableImages() error {
+	for _, img := range e.EngineConfig.GetImageList() {
+		if !img.Writable || img.Type == image.SANDBOX {
+			continue
+		}
+		l, err := lock.TryFile(img.Path + ".lock")
+		var held *lock.HeldError
+		if errors.As(err, &held) {
+			unlockWritableImages()
+			holder := "another process"
+			if held.Holder != nil {
+				holder = held.Holder.String()
+			}
+			err := fmt.Errorf("can't open %s for writing, currently in use by %s (lock file %s)", img.Path, holder, held.Path)
+			if img.Usage == image.OverlayUsage {
+				err = fmt.Errorf("%w, use '--overlay %s:ro' to share it read-only", err, img.Path)
+			}
+			return err
+		} else if err != nil {
+			sylog.Verbosef("Could not create lock file for %s: %s", img.Path, err)
+			sylog.Verbosef("Data corruptions may occur if %s is open for writing from multiple hosts", img.Path)
+			continue
+		}
+		imageLocks = append(imageLocks, l)
+	}
+	return nil
+}
+
+// unlockWritableImages removes the lock files of the images used for
+// writing.
+func unlockWritableImages() {
+	for _, l := range imageLocks {
+		l.Unlock()
+	}
+	imageLocks = nil
+}
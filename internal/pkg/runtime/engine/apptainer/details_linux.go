@@ -0,0 +1,140 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/fs/proc"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// instanceDetails returns the resolved launch configuration of the
+// instance process pid, to be stored in the instance file for inspection.
+// It must be called before the namespace paths of the instance are set
+// in the OCI configuration.
+func (e *EngineOperations) instanceDetails(pid int) *instance.Details {
+	ec := e.EngineConfig
+
+	d := &instance.Details{
+		Version:     buildcfg.PACKAGE_VERSION,
+		Binds:       []string{},
+		Overlays:    ec.GetOverlayImage(),
+		Network:     ec.GetNetwork(),
+		NetworkArgs: ec.GetNetworkArgs(),
+		Hostname:    ec.GetHostname(),
+		Nv:          ec.GetNvLegacy() || ec.GetNvCCLI(),
+		NvCCLI:      ec.GetNvCCLI(),
+		Rocm:        ec.GetRocm(),
+		Fakeroot:    ec.GetFakeroot(),
+		Contain:     ec.GetContain(),
+		Writable:    ec.GetWritableImage(),
+		// the mount namespace is always created by the engine
+		Namespaces: []string{string(specs.MountNamespace)},
+	}
+	if d.Overlays == nil {
+		d.Overlays = []string{}
+	}
+
+	for _, b := range ec.GetBindPath() {
+		bind := b.Source + ":" + b.Destination
+		var opts []string
+		if b.Readonly() {
+			opts = append(opts, "ro")
+		}
+		if p := b.Propagation(); p != "" {
+			opts = append(opts, p)
+		}
+		if len(opts) > 0 {
+			bind += ":" + strings.Join(opts, ",")
+		}
+		d.Binds = append(d.Binds, bind)
+	}
+
+	// the environment variables set with --env, --env-file and
+	// APPTAINERENV_ override those of the host
+	env := append([]string{}, e.EngineConfig.OciConfig.Process.Env...)
+	for k, v := range ec.GetApptainerEnv() {
+		env = append(env, k+"="+v)
+	}
+	d.Env = instance.SanitizeEnv(dedupEnv(env))
+
+	if e.EngineConfig.OciConfig.Linux != nil {
+		for _, ns := range e.EngineConfig.OciConfig.Linux.Namespaces {
+			if ns.Type != specs.MountNamespace {
+				d.Namespaces = append(d.Namespaces, string(ns.Type))
+			}
+		}
+	}
+
+	for _, line := range strings.Split(string(resolvContent), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			d.ResolvConf = append(d.ResolvConf, line)
+		}
+	}
+
+	if networkSetup != nil {
+		for _, n := range networkSetup.Networks() {
+			if b, ok := networkSetup.GetBandwidth(n.Config.Name); ok {
+				d.Bandwidth = append(d.Bandwidth, instance.Bandwidth{
+					Network:      n.Config.Name,
+					IngressRate:  b.IngressRate,
+					IngressBurst: b.IngressBurst,
+					EgressRate:   b.EgressRate,
+					EgressBurst:  b.EgressBurst,
+				})
+			}
+		}
+	}
+
+	if ec.GetCgroupsJSON() != "" || ec.GetJobCgroup() != "" {
+		if manager, err := cgroups.GetManagerForPid(pid); err != nil {
+			sylog.Debugf("Could not get cgroup of instance: %s", err)
+		} else if d.CgroupPath, err = manager.GetCgroupRelPath(); err != nil {
+			sylog.Debugf("Could not get cgroup path of instance: %s", err)
+		}
+	}
+
+	entries, err := proc.GetMountInfoEntry(fmt.Sprintf("/proc/%d/mountinfo", pid))
+	if err != nil {
+		sylog.Debugf("Could not read mount table of instance: %s", err)
+		return d
+	}
+	d.Mounts = make([]instance.Mount, 0, len(entries))
+	for _, entry := range entries {
+		d.Mounts = append(d.Mounts, instance.Mount{
+			Source:      entry.Source,
+			Destination: entry.Point,
+			Type:        entry.FSType,
+			Options:     strings.Join(entry.Options, ","),
+		})
+	}
+	return d
+}
+
+// dedupEnv returns env keeping only the last value of each variable.
+func dedupEnv(env []string) []string {
+	index := make(map[string]int)
+	dedup := make([]string, 0, len(env))
+	for _, e := range env {
+		k, _, _ := strings.Cut(e, "=")
+		if i, ok := index[k]; ok {
+			dedup[i] = e
+			continue
+		}
+		index[k] = len(dedup)
+		dedup = append(dedup, e)
+	}
+	return dedup
+}
@@ -24,6 +24,9 @@ import (
 type EngineOperations struct {
 	CommonConfig *config.Common                `json:"-"`
 	EngineConfig *apptainerConfig.EngineConfig `json:"engineConfig"`
+	// plan is set when the engine configuration is only prepared by
+	// PlanMounts in the launcher process
+	plan bool
 }
 
 // InitConfig stores the parsed config.Common inside the engine.
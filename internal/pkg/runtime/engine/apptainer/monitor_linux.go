@@ -13,9 +13,19 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+	"time"
 
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	units "github.com/docker/go-units"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	memoryLimit       uint64
+	stopMemoryMonitor func()
 )
 
 // MonitorContainer is called from master once the container has
@@ -73,3 +83,54 @@ func (e *EngineOperations) MonitorContainer(pid int, signals chan os.Signal) (sy
 		}
 	}
 }
+
+// startMemoryMonitor reports processes killed by the OOM killer while
+// the container is running, when a memory limit is set on a cgroups v2
+// hierarchy.
+func startMemoryMonitor() {
+	limit, err := cgroupsManager.GetMemoryLimit()
+	if err != nil {
+		sylog.Debugf("Memory events monitoring disabled: %s", err)
+		return
+	} else if limit == 0 {
+		return
+	}
+	memoryLimit = limit
+
+	stopMemoryMonitor, err = cgroupsManager.MonitorMemoryEvents(time.Second, func(prev, cur *cgroups.MemoryEvents) {
+		if n := cur.OOMKill - prev.OOMKill; n > 0 {
+			sylog.Warningf("OOM killer terminated %d process(es) in the container after it reached its %s memory limit", n, units.BytesSize(float64(limit)))
+		}
+	})
+	if err != nil {
+		sylog.Debugf("Memory events monitoring disabled: %s", err)
+	}
+}
+
+// reportMemoryEvents stops the memory events monitoring and reports if
+// the container process was terminated by the OOM killer.
+func reportMemoryEvents(status syscall.WaitStatus) {
+	if stopMemoryMonitor == nil {
+		return
+	}
+	stopMemoryMonitor()
+
+	events, err := cgroupsManager.GetMemoryEvents()
+	if err != nil {
+		sylog.Debugf("Could not get memory events: %s", err)
+		return
+	} else if events.OOMKill == 0 {
+		return
+	}
+
+	// a shell reports a child killed by SIGKILL with the exit code 137
+	exitStatus := fmt.Sprintf("exit code %d", status.ExitStatus())
+	killed := status.ExitStatus() == 128+int(syscall.SIGKILL)
+	if status.Signaled() {
+		exitStatus = fmt.Sprintf("killed by signal %d (%s)", status.Signal(), unix.SignalName(status.Signal()))
+		killed = status.Signal() == syscall.SIGKILL
+	}
+	if killed {
+		sylog.Errorf("Container was OOM-killed after reaching its %s limit, %s", units.BytesSize(float64(memoryLimit)), exitStatus)
+	}
+}
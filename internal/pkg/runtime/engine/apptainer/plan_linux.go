@@ -0,0 +1,172 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/image/driver"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs/mount"
+	"github.com/apptainer/apptainer/pkg/image"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+)
+
+// PlannedMount describes a mount point registered by the engine for the
+// container, with the tag of the mount step it belongs to.
+type PlannedMount struct {
+	mount.Point
+	Tag mount.AuthorizedTag
+	// Conditional is set when the mount depends on the content of
+	// the container image.
+	Conditional bool
+}
+
+// planStarterConfig replaces the starter configuration while the images
+// are loaded by PlanMounts, no file descriptor is kept for the container.
+type planStarterConfig struct {
+	suid bool
+}
+
+func (c planStarterConfig) GetIsSUID() bool            { return c.suid }
+func (planStarterConfig) KeepFileDescriptor(int) error { return nil }
+func (planStarterConfig) SetWorkingDirectoryFd(int)    {}
+
+// PlanMounts returns the mount points registered by the engine for the
+// container of engineConfig, in mount order, to print the plan of a dry
+// run from the launcher. The configuration is prepared and the images are
+// loaded and checked as by PrepareConfig, without the starter settings,
+// but nothing is mounted nor created on the host. The hook functions run
+// once the container filesystems are mounted are not called, only the
+// identity files, the hosts file and the current working directory mounts
+// they would add are planned. engineConfig is updated as by the engine.
+func PlanMounts(engineConfig *apptainerConfig.EngineConfig, suid bool) ([]PlannedMount, error) {
+	e := &EngineOperations{EngineConfig: engineConfig, plan: true}
+	userNS := !suid || engineConfig.GetFakeroot()
+
+	if engineConfig.GetCwd() == "" {
+		if cwd, err := os.Getwd(); err == nil {
+			engineConfig.SetCwd(cwd)
+		} else {
+			engineConfig.SetCwd("/")
+		}
+	}
+	if n := engineConfig.GetSquashfuseThreads(); n > 0 {
+		engineConfig.File.SquashfuseThreads = uint(n)
+	}
+	driver.InitImageDrivers(true, userNS, engineConfig.File, 0)
+	imageDriver = image.GetDriver(engineConfig.File.ImageDriver)
+
+	useTargetIDs := os.Getuid() == 0 && (engineConfig.GetTargetUID() != 0 || len(engineConfig.GetTargetGID()) > 0)
+	e.setUserInfo(useTargetIDs)
+
+	if err := e.prepareReadOnlyRoot(); err != nil {
+		return nil, err
+	}
+	if err := e.prepareFSMounts(); err != nil {
+		return nil, err
+	}
+	if err := e.prepareGPUDevices(); err != nil {
+		return nil, err
+	}
+	if err := e.loadImages(planStarterConfig{suid: suid}, userNS); err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, img := range engineConfig.GetImageList() {
+			img.File.Close()
+		}
+	}()
+
+	// the engine runs with the effective user ID 0 in setuid mode
+	euid := os.Geteuid()
+	if suid {
+		euid = 0
+	}
+	c, err := newContainer(e, nil, os.Getpid(), euid)
+	if err != nil {
+		return nil, err
+	}
+	c.plan = true
+
+	system := &mount.System{Points: &mount.Points{}}
+	if _, err := c.addMounts(system, os.Getpid()); err != nil {
+		return nil, err
+	}
+	if err := c.addPlannedHookMounts(system); err != nil {
+		return nil, err
+	}
+
+	var planned []PlannedMount
+	system.EachPoint(func(tag mount.AuthorizedTag, point mount.Point) {
+		// remounts and propagation changes have no source
+		if point.Source == "" {
+			return
+		}
+		planned = append(planned, PlannedMount{
+			Point:       point,
+			Tag:         tag,
+			Conditional: tag == mount.CwdTag,
+		})
+	})
+	return planned, nil
+}
+
+// addPlannedHookMounts registers the mount points added by the hook
+// functions of addIdentityMount, addHostsMount and addCwdMount, which
+// depend on the content of the mounted container image. The current
+// working directory is only mounted when it's missing in the image.
+func (c *container) addPlannedHookMounts(system *mount.System) error {
+	var files []string
+	if _, ok := c.identityUID(); ok {
+		if c.engine.EngineConfig.File.ConfigPasswd {
+			files = append(files, "/etc/passwd")
+		}
+		if c.engine.EngineConfig.File.ConfigGroup {
+			files = append(files, "/etc/group")
+		}
+	}
+	for _, path := range files {
+		if err := c.addPlannedSessionFile(system, path, path); err != nil {
+			return err
+		}
+	}
+
+	if c.utsNS && c.engine.EngineConfig.GetHostname() != "" {
+		if _, ok := hostsBoundByUser(system); !ok {
+			if err := c.addPlannedSessionFile(system, sessionHostsPath, "/etc/hosts"); err != nil {
+				return err
+			}
+		}
+	}
+
+	cwd := filepath.Clean(c.engine.EngineConfig.GetCwd())
+	if c.cwdMountAllowed(cwd) {
+		flags := uintptr(syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV | syscall.MS_REC)
+		if err := system.Points.AddBind(mount.CwdTag, cwd, cwd, flags); err != nil {
+			return fmt.Errorf("could not bind cwd directory %s into container: %s", cwd, err)
+		}
+	}
+	return nil
+}
+
+// addPlannedSessionFile registers the bind of the session file path,
+// generated by a hook function, over dest.
+func (c *container) addPlannedSessionFile(system *mount.System, path, dest string) error {
+	if err := c.session.AddFile(path, nil); err != nil {
+		return fmt.Errorf("failed to add %s session file: %s", path, err)
+	}
+	sessionFile, _ := c.session.GetPath(path)
+	if err := system.Points.AddBind(mount.FilesTag, sessionFile, dest, syscall.MS_BIND); err != nil {
+		return fmt.Errorf("unable to add %s to mount list: %s", dest, err)
+	}
+	return nil
+}
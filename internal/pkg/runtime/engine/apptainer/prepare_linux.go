@@ -36,16 +36,19 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs/overlay"
 	"github.com/apptainer/apptainer/internal/pkg/util/mainthread"
+	starterutil "github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
 	"github.com/apptainer/apptainer/pkg/image"
 	fakerootcallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/fakeroot"
 	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
 	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/apptainer/apptainer/pkg/syfs"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/sypgp"
 	"github.com/apptainer/apptainer/pkg/util/capabilities"
 	"github.com/apptainer/apptainer/pkg/util/fs/proc"
 	"github.com/apptainer/apptainer/pkg/util/namespaces"
+	"github.com/apptainer/apptainer/pkg/util/slice"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
 )
@@ -58,6 +61,7 @@ var nsProcName = map[specs.LinuxNamespaceType]string{
 	specs.CgroupNamespace:  "cgroup",
 	specs.NetworkNamespace: "net",
 	specs.UserNamespace:    "user",
+	specs.TimeNamespace:    "time",
 }
 
 // PrepareConfig is called during stage1 to validate and prepare
@@ -140,7 +144,19 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		useTargetIDs = true
 	}
 
+	if gids, ok := e.EngineConfig.GetGroups(); ok {
+		if err := e.checkGroups(gids, starterConfig.GetIsSUID()); err != nil {
+			return err
+		}
+		starterConfig.SetGroups(gids)
+	}
+
 	userNS := !starterConfig.GetIsSUID() || e.EngineConfig.GetFakeroot()
+	// squashfuse runs as the user, so the requested number
+	// of threads overrides the configuration as is
+	if n := e.EngineConfig.GetSquashfuseThreads(); n > 0 {
+		e.EngineConfig.File.SquashfuseThreads = uint(n)
+	}
 	driver.InitImageDrivers(true, userNS, e.EngineConfig.File, 0)
 	imageDriver = image.GetDriver(e.EngineConfig.File.ImageDriver)
 
@@ -154,6 +170,15 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		if err := e.prepareContainerConfig(starterConfig); err != nil {
 			return err
 		}
+		if err := e.prepareReadOnlyRoot(); err != nil {
+			return err
+		}
+		if err := e.prepareFSMounts(); err != nil {
+			return err
+		}
+		if err := e.prepareGPUDevices(); err != nil {
+			return err
+		}
 		if err := e.loadImages(starterConfig, userNS); err != nil {
 			return err
 		}
@@ -189,7 +214,13 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 	}
 
 	sylog.Debugf("image driver is %v", e.EngineConfig.File.ImageDriver)
-	if sendFd || e.EngineConfig.File.ImageDriver != "" {
+	// ID-mapped mounts are passed by the master process to the RPC server
+	idmap := e.EngineConfig.GetOverlayIDMap()
+	for _, b := range e.EngineConfig.GetBindPath() {
+		idmap = idmap || b.IDMap()
+	}
+
+	if sendFd || idmap || e.EngineConfig.File.ImageDriver != "" {
 		fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
 		if err != nil {
 			return fmt.Errorf("failed to create socketpair to pass file descriptor: %s", err)
@@ -217,6 +248,86 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 	return nil
 }
 
+// prepareReadOnlyRoot enforces a read-only root for unprivileged users when
+// required by configuration, and checks the read-only root options as the
+// engine configuration comes from the user.
+func (e *EngineOperations) prepareReadOnlyRoot() error {
+	if e.EngineConfig.File.EnforceReadOnlyRoot && os.Getuid() != 0 {
+		e.EngineConfig.SetReadOnlyRoot(true)
+	}
+	if !e.EngineConfig.GetReadOnlyRoot() {
+		e.EngineConfig.SetWritablePaths(nil)
+		return nil
+	}
+	if e.EngineConfig.GetWritableImage() {
+		return fmt.Errorf("--writable can't be used with a read-only root")
+	}
+	for _, p := range e.EngineConfig.GetWritablePaths() {
+		if !filepath.IsAbs(p) || filepath.Clean(p) == "/" {
+			return fmt.Errorf("invalid writable path %s", p)
+		}
+	}
+	return nil
+}
+
+// prepareGPUDevices checks the GPU device nodes to bind into a staged /dev,
+// as the engine configuration comes from the user. Only the NVIDIA and DRI
+// character devices are accepted.
+func (e *EngineOperations) prepareGPUDevices() error {
+	for _, dev := range e.EngineConfig.GetGPUDevices() {
+		if filepath.Clean(dev) != dev ||
+			!strings.HasPrefix(dev, "/dev/nvidia") && !strings.HasPrefix(dev, "/dev/dri/") {
+			return fmt.Errorf("%s is not a GPU device", dev)
+		}
+		fi, err := os.Stat(dev)
+		if err != nil {
+			return fmt.Errorf("while checking GPU device: %s", err)
+		}
+		if fi.Mode()&os.ModeCharDevice == 0 {
+			return fmt.Errorf("%s is not a character device", dev)
+		}
+	}
+	return nil
+}
+
+// prepareFSMounts checks the tmpfs and devpts mounts requested with
+// --mount, as the engine configuration comes from the user, and clamps the
+// tmpfs sizes of unprivileged users to 'max tmpfs size'.
+func (e *EngineOperations) prepareFSMounts() error {
+	maxSize := int64(e.EngineConfig.File.MaxTmpfsSize) * 1024 * 1024
+	mounts := e.EngineConfig.GetFSMounts()
+
+	for i, m := range mounts {
+		if m.Type != apptainerConfig.FSTypeTmpfs && m.Type != apptainerConfig.FSTypeDevpts {
+			return fmt.Errorf("unsupported mount type %q", m.Type)
+		}
+		if !filepath.IsAbs(m.Destination) || filepath.Clean(m.Destination) == "/" {
+			return fmt.Errorf("invalid %s mount destination %s", m.Type, m.Destination)
+		}
+		for _, mode := range []string{m.Mode, m.PtmxMode} {
+			if mode == "" {
+				continue
+			}
+			if v, err := strconv.ParseUint(mode, 8, 32); err != nil || v > 0o7777 {
+				return fmt.Errorf("invalid %s mount mode %q", m.Type, mode)
+			}
+		}
+		if m.Size < 0 {
+			return fmt.Errorf("invalid tmpfs size %d", m.Size)
+		}
+		if m.Type != apptainerConfig.FSTypeTmpfs || maxSize == 0 || os.Getuid() == 0 {
+			continue
+		}
+		if m.Size == 0 || m.Size > maxSize {
+			if m.Size > maxSize {
+				sylog.Warningf("Size of tmpfs %s limited to %d MiB by 'max tmpfs size'", m.Destination, e.EngineConfig.File.MaxTmpfsSize)
+			}
+			mounts[i].Size = maxSize
+		}
+	}
+	return nil
+}
+
 // prepareUserCaps is responsible for checking that user's requested
 // capabilities are authorized.
 func (e *EngineOperations) prepareUserCaps(enforced bool) error {
@@ -568,7 +679,11 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 		uid := uint32(os.Getuid())
 		gid := uint32(os.Getgid())
 
-		if !starterConfig.GetIsSUID() && fakerootutil.IsUIDMapped(uid) {
+		// root inside a user namespace maps the ids available in it
+		// without newuidmap/newgidmap
+		nested := fakerootutil.IsNestedRoot()
+
+		if !starterConfig.GetIsSUID() && !nested && fakerootutil.IsUIDMapped(uid) {
 			// no SUID workflow, check if newuidmap/newgidmap are present
 			sylog.Verbosef("Fakeroot requested with unprivileged workflow, fallback to newuidmap/newgidmap")
 			sylog.Debugf("Search for newuidmap binary")
@@ -593,6 +708,9 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 		} else if len(callbacks) == 1 {
 			getIDRange = callbacks[0].(fakerootcallback.UserMapping)
 		}
+		if nested {
+			getIDRange = fakerootutil.GetNestedIDRange
+		}
 
 		e.EngineConfig.OciConfig.AddLinuxUIDMapping(uid, 0, 1)
 		idRange, err := getIDRange(fakerootutil.SubUIDFile, uid)
@@ -621,12 +739,19 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 		starterConfig.SetTargetGID([]int{0})
 	}
 
-	starterConfig.SetBringLoopbackInterface(true)
+	starterConfig.SetBringLoopbackInterface(!e.EngineConfig.GetNoLoopback())
 
 	starterConfig.SetInstance(e.EngineConfig.GetInstance())
 
 	starterConfig.SetNsFlagsFromSpec(e.EngineConfig.OciConfig.Linux.Namespaces)
 
+	// clock offsets of the time namespace
+	if e.EngineConfig.OciConfig.Linux != nil && len(e.EngineConfig.OciConfig.Linux.TimeOffsets) > 0 {
+		if err := starterConfig.SetTimeOffsets(e.EngineConfig.OciConfig.Linux.TimeOffsets); err != nil {
+			return err
+		}
+	}
+
 	// user namespace ID mappings
 	if e.EngineConfig.OciConfig.Linux != nil {
 		if err := starterConfig.AddUIDMappings(e.EngineConfig.OciConfig.Linux.UIDMappings); err != nil {
@@ -1071,16 +1196,19 @@ func (e *EngineOperations) setSessionLayer(img *image.Image) error {
 	}
 
 	if userNS {
-		if writableTmpfs || hasOverlayImage {
-			sylog.Debugf("Overlay requested while in user namespace")
-			// Try overlay although it will only work if the image driver or the
-			//  kernel support unprivileged overlay
-			e.EngineConfig.SetSessionLayer(apptainerConfig.OverlayLayer)
-			return nil
+		stack := overlay.Stack{
+			Layers:      writableTmpfs || hasOverlayImage || hasSIFOverlay,
+			FuseOverlay: imageDriver != nil && imageDriver.Features()&image.OverlayFeature != 0,
+			Underlay:    e.EngineConfig.File.EnableUnderlay,
+			CacheFile:   filepath.Join(syfs.ConfigDir(), "overlay-rootless-check"),
 		}
-		if hasSIFOverlay {
-			sylog.Debugf("Overlay partition found while in user namespace")
-			// Likewise try the overlay because of the partition
+		if stack.Layers {
+			sylog.Debugf("Overlay requested while in user namespace")
+			driver, err := overlay.SelectDriver(e.EngineConfig.File.OverlayDriver, stack)
+			if err != nil {
+				return err
+			}
+			e.EngineConfig.SetOverlayDriver(driver)
 			e.EngineConfig.SetSessionLayer(apptainerConfig.OverlayLayer)
 			return nil
 		}
@@ -1091,13 +1219,15 @@ func (e *EngineOperations) setSessionLayer(img *image.Image) error {
 					e.EngineConfig.SetSessionLayer(apptainerConfig.UnderlayLayer)
 					return nil
 				}
-				err := overlay.CheckRootless()
-				if err == nil {
-					e.EngineConfig.SetSessionLayer(apptainerConfig.OverlayLayer)
+				driver, err := overlay.SelectDriver(e.EngineConfig.File.OverlayDriver, stack)
+				if err != nil {
+					sylog.Debugf("%s", err)
 					return nil
 				}
-				if err != overlay.ErrNoRootlessOverlay {
-					sylog.Warningf("While checking for rootless overlay support: %s", err)
+				e.EngineConfig.SetOverlayDriver(driver)
+				if driver != overlay.DriverSquashfuseBind {
+					e.EngineConfig.SetSessionLayer(apptainerConfig.OverlayLayer)
+					return nil
 				}
 			}
 			if !e.EngineConfig.File.EnableUnderlay {
@@ -1159,7 +1289,15 @@ func (e *EngineOperations) setSessionLayer(img *image.Image) error {
 	return nil
 }
 
-func (e *EngineOperations) loadImages(starterConfig *starter.Config, userNS bool) error {
+// imageStarterConfig is the starter configuration used while loading the
+// images, which keeps their file descriptors open for the container.
+type imageStarterConfig interface {
+	GetIsSUID() bool
+	KeepFileDescriptor(fd int) error
+	SetWorkingDirectoryFd(fd int)
+}
+
+func (e *EngineOperations) loadImages(starterConfig imageStarterConfig, userNS bool) error {
 	images := make([]image.Image, 0)
 
 	// load rootfs image
@@ -1168,6 +1306,44 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config, userNS bool
 	if err != nil {
 		return err
 	}
+	if img.Type == image.TAR {
+		return fmt.Errorf("tar archive %s must be extracted to a sandbox to run", img.Path)
+	}
+
+	// the sandbox extracted from a tar archive is subject to the policies
+	// of both the sandbox and the archive
+	var archive *image.Image
+	if path := e.EngineConfig.GetImageArchive(); path != "" {
+		if img.Type != image.SANDBOX {
+			return fmt.Errorf("image %s extracted from tar archive %s is not a sandbox", img.Path, path)
+		}
+		if writable {
+			return fmt.Errorf("could not use %s for writing, tar archives are run read-only", path)
+		}
+		archive, err = e.loadImage(path, false, userNS)
+		if err != nil {
+			return err
+		}
+		defer archive.File.Close()
+		if archive.Type != image.TAR {
+			return fmt.Errorf("%s is not a tar archive", archive.Path)
+		}
+	}
+
+	// the sandbox converted from an image file by the launcher is subject
+	// to the policy of the image file, and in setuid mode to the policy of
+	// the sandbox too, as it's writable by the user
+	var converted *image.Image
+	if path := e.EngineConfig.GetImageConverted(); path != "" && e.EngineConfig.File.RequireSignedImages {
+		if img.Type != image.SANDBOX {
+			return fmt.Errorf("image %s converted from %s is not a sandbox", img.Path, path)
+		}
+		converted, err = image.Init(path, false)
+		if err != nil {
+			return fmt.Errorf("while loading image %s converted to sandbox: %s", path, err)
+		}
+		defer converted.File.Close()
+	}
 
 	rootFs, err := img.GetRootFsPartition()
 	if err != nil {
@@ -1190,6 +1366,25 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config, userNS bool
 		return err
 	}
 
+	if e.EngineConfig.File.RequireSignedImages {
+		policyImages := []*image.Image{img}
+		if archive != nil {
+			policyImages = append(policyImages, archive)
+		}
+		if converted != nil {
+			policyImages = []*image.Image{converted}
+			if starterConfig.GetIsSUID() {
+				policyImages = append(policyImages, img)
+			}
+		}
+		for _, pi := range policyImages {
+			err := syecl.CheckSignerPolicy(context.TODO(), e.EngineConfig.File.TrustedSigners, e.EngineConfig.File.AllowUnsignedFormats, pi, starterConfig.GetIsSUID())
+			if err != nil {
+				return starterutil.PolicyDenied(fmt.Errorf("image %s refused by the signer policy of %s: %s", pi.Path, buildcfg.APPTAINER_CONF_FILE, err))
+			}
+		}
+	}
+
 	// sandbox are handled differently for security reasons
 	if img.Type == image.SANDBOX {
 		if img.Path == "/" {
@@ -1251,9 +1446,9 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config, userNS bool
 			}
 
 			if ok, err := ecl.ShouldRunFp(context.TODO(), img.File, kr); err != nil {
-				return fmt.Errorf("while checking container image with ECL: %s", err)
+				return starterutil.PolicyDenied(fmt.Errorf("while checking container image with ECL: %s", err))
 			} else if !ok {
-				return errors.New("image prohibited by ECL")
+				return starterutil.PolicyDenied(errors.New("image prohibited by ECL"))
 			}
 		}
 
@@ -1268,7 +1463,7 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config, userNS bool
 					continue
 				}
 				if !userNS && !e.EngineConfig.File.AllowSetuidMountExtfs {
-					return fmt.Errorf("configuration disallows users from mounting SIF extfs partition in setuid mode, try --userns")
+					return starterutil.PolicyDenied(fmt.Errorf("configuration disallows users from mounting SIF extfs partition in setuid mode, try --userns"))
 				}
 				if img.Writable {
 					writableOverlayPath = img.Path
@@ -1288,7 +1483,7 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config, userNS bool
 	case apptainerConfig.OverlayLayer:
 		overlayImages, err := e.loadOverlayImages(starterConfig, writableOverlayPath, userNS)
 		if err != nil {
-			return fmt.Errorf("while loading overlay images: %s", err)
+			return fmt.Errorf("while loading overlay images: %w", err)
 		}
 		images = append(images, overlayImages...)
 	case apptainerConfig.UnderlayLayer:
@@ -1300,7 +1495,7 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config, userNS bool
 
 	bindImages, err := e.loadBindImages(starterConfig, userNS)
 	if err != nil {
-		return fmt.Errorf("while loading data bind images: %s", err)
+		return fmt.Errorf("while loading data bind images: %w", err)
 	}
 	images = append(images, bindImages...)
 
@@ -1310,23 +1505,27 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config, userNS bool
 }
 
 // loadOverlayImages loads overlay images.
-func (e *EngineOperations) loadOverlayImages(starterConfig *starter.Config, writableOverlayPath string, userNS bool) ([]image.Image, error) {
+func (e *EngineOperations) loadOverlayImages(starterConfig imageStarterConfig, writableOverlayPath string, userNS bool) ([]image.Image, error) {
 	images := make([]image.Image, 0)
 
 	for _, overlayImg := range e.EngineConfig.GetOverlayImage() {
 		writableOverlay := true
+		idmap := false
 
 		splitted := strings.SplitN(overlayImg, ":", 2)
 		if len(splitted) == 2 {
-			if splitted[1] == "ro" {
+			switch splitted[1] {
+			case "ro":
 				writableOverlay = false
+			case "idmap":
+				idmap = true
 			}
 		}
 
 		img, err := e.loadImage(splitted[0], writableOverlay, userNS)
 		if err != nil {
 			if !image.IsReadOnlyFilesytem(err) {
-				return nil, fmt.Errorf("failed to open overlay image %s: %s", splitted[0], err)
+				return nil, fmt.Errorf("failed to open overlay image %s: %w", splitted[0], err)
 			}
 			// let's proceed with readonly filesystem and set
 			// writableOverlay to appropriate value
@@ -1343,6 +1542,14 @@ func (e *EngineOperations) loadOverlayImages(starterConfig *starter.Config, writ
 				)
 			}
 			writableOverlayPath = img.Path
+
+			if idmap {
+				if img.Type == image.SANDBOX {
+					e.EngineConfig.SetOverlayIDMap(true)
+				} else {
+					sylog.Warningf("ID-mapped mounts are only supported with overlay directories, ignoring idmap for %s", img.Path)
+				}
+			}
 		}
 
 		e.EngineConfig.SetWritableOverlay(writableOverlay)
@@ -1361,7 +1568,7 @@ func (e *EngineOperations) loadOverlayImages(starterConfig *starter.Config, writ
 }
 
 // loadBindImages load data bind images.
-func (e *EngineOperations) loadBindImages(starterConfig *starter.Config, userNS bool) ([]image.Image, error) {
+func (e *EngineOperations) loadBindImages(starterConfig imageStarterConfig, userNS bool) ([]image.Image, error) {
 	images := make([]image.Image, 0)
 
 	binds := e.EngineConfig.GetBindPath()
@@ -1377,7 +1584,7 @@ func (e *EngineOperations) loadBindImages(starterConfig *starter.Config, userNS
 
 		img, err := e.loadImage(imagePath, !binds[i].Readonly(), userNS)
 		if err != nil && !image.IsReadOnlyFilesytem(err) {
-			return nil, fmt.Errorf("failed to load data image %s: %s", imagePath, err)
+			return nil, fmt.Errorf("failed to load data image %s: %w", imagePath, err)
 		}
 		img.Usage = image.DataUsage
 
@@ -1405,7 +1612,11 @@ func (e *EngineOperations) loadImage(path string, writable bool, userNS bool) (*
 	}
 
 	// get the real path from /proc/self/fd/X
-	imgTarget, err := mainthread.Readlink(imgObject.Source)
+	readlink := mainthread.Readlink
+	if e.plan {
+		readlink = os.Readlink
+	}
+	imgTarget, err := readlink(imgObject.Source)
 	if err != nil {
 		return nil, fmt.Errorf("while reading symlink %s: %s", imgObject.Source, err)
 	}
@@ -1425,21 +1636,21 @@ func (e *EngineOperations) loadImage(path string, writable bool, userNS bool) (*
 		if authorized, err := imgObject.AuthorizedPath(e.EngineConfig.File.LimitContainerPaths); err != nil {
 			return nil, err
 		} else if !authorized {
-			return nil, fmt.Errorf("apptainer image is not in an allowed configured path")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("apptainer image is not in an allowed configured path"))
 		}
 	}
 	if len(e.EngineConfig.File.LimitContainerGroups) != 0 {
 		if authorized, err := imgObject.AuthorizedGroup(e.EngineConfig.File.LimitContainerGroups); err != nil {
 			return nil, err
 		} else if !authorized {
-			return nil, fmt.Errorf("apptainer image is not owned by required group(s)")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("apptainer image is not owned by required group(s)"))
 		}
 	}
 	if len(e.EngineConfig.File.LimitContainerOwners) != 0 {
 		if authorized, err := imgObject.AuthorizedOwner(e.EngineConfig.File.LimitContainerOwners); err != nil {
 			return nil, err
 		} else if !authorized {
-			return nil, fmt.Errorf("apptainer image is not owned by required user(s)")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("apptainer image is not owned by required user(s)"))
 		}
 	}
 
@@ -1447,28 +1658,33 @@ func (e *EngineOperations) loadImage(path string, writable bool, userNS bool) (*
 	// Bare SquashFS
 	case image.SQUASHFS:
 		if !e.EngineConfig.File.AllowContainerSquashfs {
-			return nil, fmt.Errorf("configuration disallows users from running squashFS containers")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("configuration disallows users from running squashFS containers"))
 		}
 		if !userNS && !e.EngineConfig.File.AllowSetuidMountSquashfs {
-			return nil, fmt.Errorf("configuration disallows users from mounting squashFS in setuid mode, try --userns")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("configuration disallows users from mounting squashFS in setuid mode, try --userns"))
 		}
 	// Bare EXT3
 	case image.EXT3:
 		if !e.EngineConfig.File.AllowContainerExtfs {
-			return nil, fmt.Errorf("configuration disallows users from running extFS containers")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("configuration disallows users from running extFS containers"))
 		}
 		if !userNS && !e.EngineConfig.File.AllowSetuidMountExtfs {
-			return nil, fmt.Errorf("configuration disallows users from mounting extfs in setuid mode, try --userns")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("configuration disallows users from mounting extfs in setuid mode, try --userns"))
 		}
 	// Bare sandbox directory
 	case image.SANDBOX:
 		if !e.EngineConfig.File.AllowContainerDir {
-			return nil, fmt.Errorf("configuration disallows users from running sandbox containers")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("configuration disallows users from running sandbox containers"))
+		}
+	// tar archive extracted to a sandbox
+	case image.TAR:
+		if !e.EngineConfig.File.AllowContainerTar {
+			return nil, starterutil.PolicyDenied(fmt.Errorf("configuration disallows users from running tar archives"))
 		}
 	// SIF
 	case image.SIF:
 		if !userNS && !e.EngineConfig.File.AllowSetuidMountSquashfs {
-			return nil, fmt.Errorf("configuration disallows users from mounting SIF squashFS partition in setuid mode, try --userns")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("configuration disallows users from mounting SIF squashFS partition in setuid mode, try --userns"))
 		}
 		// Check if SIF contains an encrypted rootfs partition.
 		// We don't support encryption for other partitions at present.
@@ -1478,14 +1694,14 @@ func (e *EngineOperations) loadImage(path string, writable bool, userNS bool) (*
 		}
 		// SIF with encryption
 		if encrypted && !e.EngineConfig.File.AllowContainerEncrypted {
-			return nil, fmt.Errorf("configuration disallows users from running encrypted SIF containers")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("configuration disallows users from running encrypted SIF containers"))
 		}
 		if encrypted && !userNS && !e.EngineConfig.File.AllowSetuidMountEncrypted {
-			return nil, fmt.Errorf("configuration disallows users from mounting encrypted files in setuid mode, try --userns")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("configuration disallows users from mounting encrypted files in setuid mode, try --userns"))
 		}
 		// SIF without encryption - regardless of rootfs filesystem type
 		if !encrypted && !e.EngineConfig.File.AllowContainerSIF {
-			return nil, fmt.Errorf("configuration disallows users from running unencrypted SIF containers")
+			return nil, starterutil.PolicyDenied(fmt.Errorf("configuration disallows users from running unencrypted SIF containers"))
 		}
 	// We shouldn't be able to run anything else, but make sure we don't!
 	default:
@@ -1495,6 +1711,33 @@ func (e *EngineOperations) loadImage(path string, writable bool, userNS bool) (*
 	return imgObject, imgErr
 }
 
+// checkGroups checks that the supplementary groups selected for the
+// container process can be set. Root can set any group, other users can
+// only keep some of their groups, in the setuid workflow as the groups
+// can't be dropped in an unprivileged user namespace.
+func (e *EngineOperations) checkGroups(gids []int, suid bool) error {
+	if e.EngineConfig.GetFakeroot() {
+		return fmt.Errorf("the supplementary groups can't be selected with --fakeroot")
+	}
+	if os.Getuid() == 0 {
+		return nil
+	}
+	if !suid {
+		return fmt.Errorf("the supplementary groups can't be selected in an unprivileged user namespace")
+	}
+	groups, err := os.Getgroups()
+	if err != nil {
+		return fmt.Errorf("while getting groups: %s", err)
+	}
+	groups = append(groups, os.Getgid())
+	for _, gid := range gids {
+		if !slice.ContainsInt(groups, gid) {
+			return fmt.Errorf("group %d is not a group of the user, only root can add groups", gid)
+		}
+	}
+	return nil
+}
+
 func (e *EngineOperations) setUserInfo(useTargetIDs bool) {
 	var gids []int
 
@@ -1525,7 +1768,9 @@ func (e *EngineOperations) setUserInfo(useTargetIDs bool) {
 
 	e.EngineConfig.JSON.UserInfo.Groups = make(map[int]string)
 
-	if useTargetIDs {
+	if groups, ok := e.EngineConfig.GetGroups(); ok {
+		gids = append(gids, groups...)
+	} else if useTargetIDs {
 		gids = e.EngineConfig.GetTargetGID()
 	} else {
 		gids, err = os.Getgroups()
@@ -37,10 +37,12 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	"github.com/apptainer/apptainer/internal/pkg/security"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
 	"github.com/apptainer/apptainer/internal/pkg/util/machine"
 	"github.com/apptainer/apptainer/internal/pkg/util/shell"
 	"github.com/apptainer/apptainer/internal/pkg/util/shell/interpreter"
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
 	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
 	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
@@ -54,6 +56,10 @@ import (
 
 const defaultShell = "/bin/sh"
 
+// logRotateInterval is the interval at which the instance log files
+// size is checked for rotation.
+const logRotateInterval = 10 * time.Second
+
 // StartProcess is called during stage2 after RPC server finished
 // environment preparation. This is the container process itself.
 //
@@ -90,6 +96,15 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		}
 	}
 
+	e.setTimezoneEnv()
+	e.setFaketimeEnv()
+
+	if isInstance && !bootInstance && !e.EngineConfig.GetInstanceJoin() {
+		if err := checkInstanceScript(e.EngineConfig.GetInstanceScript(), e.EngineConfig.OciConfig.Process.Env); err != nil {
+			return err
+		}
+	}
+
 	if e.EngineConfig.File.MountDev == "minimal" || e.EngineConfig.GetContain() {
 		// If on a terminal, reopen /dev/console so /proc/self/fd/[0-2
 		//   will point to /dev/console.  This is needed so that tty and
@@ -122,6 +137,21 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		}
 	}
 
+	// With a pseudo-terminal allocated by the launcher, the container
+	// process starts a new session with the terminal as controlling
+	// terminal, so that the signals generated by the terminal, e.g. with
+	// Ctrl-C, are sent to the foreground process group of the container
+	// rather than to apptainer.
+	pty := e.EngineConfig.GetPty() && term.IsTerminal(0)
+	if pty {
+		if _, err := unix.Setsid(); err != nil {
+			return fmt.Errorf("while creating a new session: %s", err)
+		}
+		if err := unix.IoctlSetInt(0, unix.TIOCSCTTY, 0); err != nil {
+			return fmt.Errorf("while setting controlling terminal: %s", err)
+		}
+	}
+
 	if e.EngineConfig.OciConfig.Linux != nil {
 		namespaces := e.EngineConfig.OciConfig.Linux.Namespaces
 		for _, ns := range namespaces {
@@ -196,6 +226,9 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 	errChan := make(chan error, 1)
 	statusChan := make(chan syscall.WaitStatus, 1)
 	cmdPid := -2
+	// stopSignal is the last signal forwarded to the processes of an
+	// instance, the instance exits with it once they all exited
+	var stopSignal syscall.Signal
 
 	args, env, err := runActionScript(e.EngineConfig)
 	if err != nil {
@@ -210,6 +243,10 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		cmd.Env = env
 		cmd.SysProcAttr = &syscall.SysProcAttr{
 			Setpgid: isInstance,
+			// the command is the foreground process group of the
+			// pseudo-terminal rather than the shim process
+			Foreground: pty,
+			Ctty:       0,
 		}
 		if err := cmd.Start(); err != nil {
 			if e, ok := err.(*os.PathError); ok {
@@ -258,6 +295,10 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 					var status syscall.WaitStatus
 
 					wpid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+					if err == syscall.ECHILD && isInstance && stopSignal != 0 {
+						sylog.Debugf("No child process left, exiting ...")
+						os.Exit(128 + int(stopSignal))
+					}
 					if wpid <= 0 || err != nil {
 						// We break the loop since an error occurred
 						break
@@ -281,6 +322,7 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 				// mean to update the Go runtime or the kernel to something more
 				// stable :)
 				if isInstance && cmdPid > 0 {
+					stopSignal = signal
 					if err := syscall.Kill(-cmdPid, signal); err == syscall.ESRCH {
 						sylog.Debugf("No child process, exiting ...")
 						os.Exit(128 + int(signal))
@@ -308,11 +350,7 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 			}
 			if !isInstance {
 				if len(statusChan) > 0 {
-					status := <-statusChan
-					if status.Signaled() {
-						os.Exit(128 + int(status.Signal()))
-					}
-					os.Exit(status.ExitStatus())
+					os.Exit(signalutil.ExitCode(<-statusChan))
 				} else if err == nil {
 					os.Exit(0)
 				}
@@ -378,11 +416,23 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 		file.LogOutPath = logOutPath
 		file.Checkpoint = e.EngineConfig.GetDMTCPConfig().Checkpoint
 
-		ip, err := e.getIP()
+		ipv4, ipv6, err := e.getIPs()
 		if err != nil {
 			sylog.Warningf("Could not get ip for %s: %s", pw.Name, err)
 		}
-		file.IP = ip
+		// the IP is the IPv6 address on an IPv6 only network
+		file.IP = ipv4
+		if ipv4 == "" {
+			file.IP = ipv6
+		}
+		file.IPv6 = ipv6
+		if err := e.recordInstanceAddress(name, ipv4); err != nil {
+			sylog.Warningf("Could not store the network address of instance %s: %s", name, err)
+		}
+		file.Ports = e.EngineConfig.GetPublishPorts()
+		file.SocketsDir, file.SocketsMount = e.EngineConfig.GetInstanceSockets()
+		file.Details = e.instanceDetails(pid)
+		file.Networks = e.instanceNetworks()
 
 		// by default we add all namespaces except the user namespace which
 		// is added conditionally. This delegates checks to the C starter code
@@ -399,6 +449,7 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 			{"mnt", specs.MountNamespace},
 			{"cgroup", specs.CgroupNamespace},
 			{"net", specs.NetworkNamespace},
+			{"time", specs.TimeNamespace},
 		}
 		for _, n := range namespaces {
 			nspath := filepath.Join(path, n.nstype)
@@ -413,11 +464,19 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 			}
 		}
 
+		file.Script = e.EngineConfig.GetInstanceScript()
+		if e.EngineConfig.GetBootInstance() {
+			file.Script = "boot"
+		}
+
 		// If we are using cgroups with this instance then mark that in the instance config.
 		// We don't store the path, as we will get the cgroup manager by Pid.
-		if e.EngineConfig.GetCgroupsJSON() != "" {
+		if e.EngineConfig.GetCgroupsJSON() != "" && cgroupsManager != nil {
 			file.Cgroup = true
 		}
+		// An instance started in a job cgroup either has its cgroup
+		// beneath it, or stays in the job cgroup for stats.
+		file.JobCgroup = e.EngineConfig.GetJobCgroup() != ""
 
 		// grab configuration to store in instance file
 		file.Config, err = json.Marshal(e.CommonConfig)
@@ -427,6 +486,12 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 
 		err = file.Update()
 
+		// the master process supervises the instance until it exits,
+		// rotate the log files from here
+		if maxSize, maxFiles := e.EngineConfig.GetInstanceLogRotation(); maxSize > 0 {
+			instance.RotateLogs([]string{logOutPath, logErrPath}, maxSize, maxFiles, logRotateInterval)
+		}
+
 		// send SIGUSR1 to the parent process in order to tell it
 		// to detach container process and run as instance.
 		// Sleep a bit in case child would exit
@@ -440,6 +505,100 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 	return nil
 }
 
+// checkInstanceScript returns an error when the container has no script
+// to execute for an instance started with instance start or run, instead
+// of letting the action script fall back to a shell exiting immediately.
+// Instance start keeps running the container without startscript as long
+// as it has a runscript.
+func checkInstanceScript(script string, env []string) error {
+	for _, keyval := range env {
+		if strings.HasPrefix(keyval, "SINGULARITY_APPNAME=") && keyval != "SINGULARITY_APPNAME=" {
+			// app runscripts are handled by the action script
+			return nil
+		}
+	}
+	runscript := fs.IsExec("/.singularity.d/runscript") || fs.IsExec("/apptainer")
+	startscript := fs.IsExec("/.singularity.d/startscript")
+	switch {
+	case script == "run" && runscript:
+		return nil
+	case script == "run" && startscript:
+		return fmt.Errorf("no runscript found in container, use 'instance start' to execute its startscript")
+	case script != "run" && (runscript || startscript):
+		return nil
+	}
+	return fmt.Errorf("no runscript or startscript found in container, nothing to run as instance")
+}
+
+// setTimezoneEnv sets TZ to the container timezone unless already set, only
+// if the image has its zoneinfo file, otherwise programs rely on the
+// /etc/localtime file bound by the engine.
+func (e *EngineOperations) setTimezoneEnv() {
+	zone := e.EngineConfig.GetTimezone()
+	if zone == "" || zone == files.TimezoneHost {
+		return
+	}
+	for _, keyval := range e.EngineConfig.OciConfig.Process.Env {
+		if strings.HasPrefix(keyval, "TZ=") {
+			sylog.Debugf("Keeping %s set by the environment", keyval)
+			return
+		}
+	}
+	if _, err := os.Stat(filepath.Join(files.ZoneinfoDir, zone)); err != nil {
+		sylog.Debugf("Not setting TZ, timezone %s not found in container: %s", zone, err)
+		return
+	}
+	e.EngineConfig.OciConfig.Process.Env = append(e.EngineConfig.OciConfig.Process.Env, "TZ="+zone)
+}
+
+// faketimeLibs are the patterns matching libfaketime in the container.
+var faketimeLibs = []string{
+	"/usr/lib*/faketime/libfaketime.so.1",
+	"/usr/lib*/*/faketime/libfaketime.so.1",
+	"/usr/local/lib*/faketime/libfaketime.so.1",
+}
+
+// setFaketimeEnv preloads libfaketime with the offset of the realtime clock
+// set by --faketime, unless FAKETIME is already set. The monotonic clocks
+// are left to the time namespace. It requires libfaketime in the image.
+func (e *EngineOperations) setFaketimeEnv() {
+	offset := e.EngineConfig.GetFakeTime()
+	if offset == "" {
+		return
+	}
+	env := make([]string, 0, len(e.EngineConfig.OciConfig.Process.Env)+3)
+	preload := ""
+	for _, keyval := range e.EngineConfig.OciConfig.Process.Env {
+		if strings.HasPrefix(keyval, "FAKETIME=") {
+			sylog.Debugf("Keeping %s set by the environment", keyval)
+			return
+		}
+		if strings.HasPrefix(keyval, "LD_PRELOAD=") {
+			preload = strings.TrimPrefix(keyval, "LD_PRELOAD=")
+			continue
+		}
+		env = append(env, keyval)
+	}
+
+	lib := ""
+	for _, pattern := range faketimeLibs {
+		if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+			lib = matches[0]
+			break
+		}
+	}
+	if lib == "" {
+		sylog.Warningf("libfaketime not found in container, --faketime doesn't apply to the realtime clock")
+		return
+	}
+	sylog.Debugf("Preloading %s with FAKETIME=%s", lib, offset)
+
+	if preload != "" {
+		lib += ":" + preload
+	}
+	e.EngineConfig.OciConfig.Process.Env = append(env, "FAKETIME="+offset, "DONT_FAKE_MONOTONIC=1", "LD_PRELOAD="+lib)
+}
+
 func (e *EngineOperations) setPathEnv() {
 	env := e.EngineConfig.OciConfig.Process.Env
 	for _, keyval := range env {
@@ -569,26 +728,95 @@ func (e *EngineOperations) stopFuseDrivers() {
 	}
 }
 
-func (e *EngineOperations) getIP() (string, error) {
+// getIPs returns the IPv4 and IPv6 addresses of the container on its
+// first network, or the ones assigned by the rootless network backend.
+func (e *EngineOperations) getIPs() (string, string, error) {
+	if rootlessNet != nil {
+		return rootlessNet.Addresses()
+	}
 	if networkSetup == nil {
-		return "", nil
+		return "", "", nil
 	}
 
 	net := strings.Split(e.EngineConfig.GetNetwork(), ",")
 
-	ip, err := networkSetup.GetNetworkIP(net[0], "4")
-	if err == nil {
-		return ip.String(), nil
+	var ipv4, ipv6 string
+	if ip, err := networkSetup.GetNetworkIP(net[0], "4"); err == nil {
+		ipv4 = ip.String()
+	}
+	if ip, err := networkSetup.GetNetworkIP(net[0], "6"); err == nil {
+		ipv6 = ip.String()
 	}
-	sylog.Warningf("Could not get ipv4 %s", err)
+	if ipv4 == "" && ipv6 == "" {
+		return "", "", errors.New("could not get ip")
+	}
+	return ipv4, ipv6, nil
+}
 
-	ip, err = networkSetup.GetNetworkIP(net[0], "6")
-	if err == nil {
-		return ip.String(), nil
+// recordInstanceAddress stores the address of the instance name on its
+// first CNI network, so that a next start of the instance gets the same
+// address. The address set with --ip is stored over the IPv4 one.
+func (e *EngineOperations) recordInstanceAddress(name, ipv4 string) error {
+	if networkSetup == nil {
+		return nil
 	}
-	sylog.Warningf("Could not get ipv6 %s", err)
+	net := strings.Split(e.EngineConfig.GetNetwork(), ",")
 
-	return "", errors.New("could not get ip")
+	ip, _ := e.EngineConfig.GetInstanceAddress()
+	if ip == "" {
+		ip = ipv4
+	}
+	if ip == "" {
+		if v6, err := networkSetup.GetNetworkIP(net[0], "6"); err == nil {
+			ip = v6.String()
+		}
+	}
+	if ip == "" {
+		return nil
+	}
+	mac, err := networkSetup.GetNetworkMAC(net[0])
+	if err != nil {
+		sylog.Debugf("Could not get the MAC address of instance %s: %s", name, err)
+	}
+
+	return instance.UpdateAllocations("", func(allocs instance.Allocations) error {
+		allocs[name] = &instance.Allocation{Network: net[0], IP: ip, MAC: mac}
+		return nil
+	})
+}
+
+// instanceNetworks returns the CNI networks of the instance, stored in the
+// instance file to release their resources if the instance crashes.
+func (e *EngineOperations) instanceNetworks() *instance.Networks {
+	if networkSetup == nil {
+		return nil
+	}
+	nets := &instance.Networks{
+		ConfPath:   e.EngineConfig.File.CniConfPath,
+		PluginPath: e.EngineConfig.File.CniPluginPath,
+	}
+	if nets.ConfPath == "" {
+		nets.ConfPath = defaultCNIConfPath
+	}
+	if nets.PluginPath == "" {
+		nets.PluginPath = defaultCNIPluginPath
+	}
+	for _, n := range networkSetup.Networks() {
+		if !json.Valid(n.Config.Bytes) {
+			sylog.Debugf("Could not store the configuration of network %s", n.Config.Name)
+			return nil
+		}
+		runtime, err := json.Marshal(n.Runtime)
+		if err != nil {
+			sylog.Debugf("Could not store the runtime configuration of network %s: %s", n.Config.Name, err)
+			return nil
+		}
+		nets.List = append(nets.List, instance.Network{
+			Config:  n.Config.Bytes,
+			Runtime: runtime,
+		})
+	}
+	return nets
 }
 
 func getExecError(err error, args []string, shell string) error {
@@ -644,7 +872,8 @@ func (b *bufferCloser) Close() error {
 // when the script is sourced (OCI compatible behavior).
 // If noEval is false then exports are double quoted, and their content is evaluated,
 // consuming one level of shell escaping and performing any unescaped var substitution,
-// subshell execution etc (Apptainer historic behavior).
+// subshell execution etc (Apptainer historic behavior). In both cases the quotes,
+// backslashes and newlines of a value can't end its export.
 func injectEnvHandler(senv map[string]string, noEval bool) interpreter.OpenHandler {
 	var once sync.Once
 
@@ -674,10 +903,10 @@ func injectEnvHandler(senv map[string]string, noEval bool) interpreter.OpenHandl
 				}
 				if noEval {
 					// No evaluation when the export is sourced
-					value = "'" + shell.EscapeSingleQuotes(value) + "'"
+					value = shell.Quote(value)
 				} else {
 					// Shell evaluation when the export is sourced
-					value = "\"" + shell.EscapeDoubleQuotes(value) + "\""
+					value = shell.QuoteExpand(value)
 				}
 				b.WriteString(fmt.Sprintf(snippet, key, value))
 			}
@@ -687,6 +916,46 @@ func injectEnvHandler(senv map[string]string, noEval bool) interpreter.OpenHandl
 	}
 }
 
+// unsetEnvHandler returns the script removing the variables matching the
+// glob patterns, whatever their source. The patterns are checked by the
+// launcher to only hold variable names and glob characters.
+func unsetEnvHandler(patterns []string) interpreter.OpenHandler {
+	var once sync.Once
+
+	return func(_ string, _ int, _ os.FileMode) (io.ReadWriteCloser, error) {
+		b := new(bufferCloser)
+
+		once.Do(func() {
+			if len(patterns) == 0 {
+				return
+			}
+			snippet := `
+			__unset_env__() {
+				local IFS=$'\n'
+				set -o noglob
+				for e in $(getallenv); do
+					key=${e%%%%=*}
+					case "${key}" in
+					HOME|PATH)
+						;;
+					%s)
+						sylog debug "Unsetting ${key} environment variable"
+						unset "${key}"
+						;;
+					esac
+				done
+				set +o noglob
+			}
+			__unset_env__
+			unset -f __unset_env__
+			`
+			b.WriteString(fmt.Sprintf(snippet, strings.Join(patterns, "|")))
+		})
+
+		return b, nil
+	}
+}
+
 func runtimeVarsHandler(senv map[string]string) interpreter.OpenHandler {
 	var once sync.Once
 
@@ -722,7 +991,7 @@ func sylogBuiltin(ctx context.Context, argv []string) error {
 }
 
 // getAllEnvBuiltin display all exported variables in the form KEY=VALUE.
-func getAllEnvBuiltin(shell *interpreter.Shell) interpreter.ShellBuiltin {
+func getAllEnvBuiltin(_ *interpreter.Shell) interpreter.ShellBuiltin {
 	return func(ctx context.Context, argv []string) error {
 		hc := interp.HandlerCtx(ctx)
 
@@ -737,23 +1006,71 @@ func getAllEnvBuiltin(shell *interpreter.Shell) interpreter.ShellBuiltin {
 				sylog.Debugf("Not exporting %q to container environment: invalid key", key)
 				continue
 			}
-			// Because we are using IFS=\n we need to escape newlines here and
-			// unescape them in the action script when we export the var again.
-			//
-			// This is imperfect - it is not possible to represent a string
-			// containing a literal '\u000A' (unicode escaped newline) in it.
-			//
-			// Full escaping / unescaping requires iterative parsing of the
-			// string in the action script. This is too awkward and slow in
-			// shell code. If we can use `printf -v VAR "%b" ...` from mvdan.cc/sh
-			// in future, we may be able to revisit this.
-			env := strings.Replace(env, "\n", "\\u000A", -1)
-			fmt.Fprintf(hc.Stdout, "%s\n", env)
+			// Because variables are separated by newlines we need to escape
+			// newlines here, restoreenv restores the value when it exports
+			// the var again.
+			fmt.Fprintf(hc.Stdout, "%s\n", shell.EscapeNewlines(env))
 		}
 		return nil
 	}
 }
 
+// clearEnvBuiltin takes the variables listed by getallenv and displays the
+// commands unsetting them, to be evaluated at once by the action script.
+// Looping over the variables in the script is slow with the embedded shell
+// interpreter, which parses and compiles case patterns for each variable.
+func clearEnvBuiltin(ctx context.Context, argv []string) error {
+	if len(argv) != 1 {
+		return fmt.Errorf("clearenv builtin requires one argument")
+	}
+	hc := interp.HandlerCtx(ctx)
+
+	var unset, readonly []string
+
+	for _, e := range strings.Split(argv[0], "\n") {
+		key := strings.SplitN(e, "=", 2)[0]
+		switch key {
+		case "", "PWD", "HOME", "OPTIND", "UID", "GID", "SINGULARITY_APPNAME", "SINGULARITY_SHELL":
+		case "APPTAINER_NAME", "APPTAINER_CONTAINER", "APPTAINER_INSTANCE":
+			readonly = append(readonly, key)
+		default:
+			unset = append(unset, key)
+		}
+	}
+
+	if len(readonly) > 0 {
+		fmt.Fprintf(hc.Stdout, "readonly %s\n", strings.Join(readonly, " "))
+	}
+	if len(unset) > 0 {
+		fmt.Fprintf(hc.Stdout, "unset %s\n", strings.Join(unset, " "))
+	}
+	return nil
+}
+
+// restoreEnvBuiltin takes the variables listed by getallenv and displays the
+// commands exporting again those which haven't been defined by the image
+// environment and unsetting those defined empty, to be evaluated at once by
+// the action script.
+func restoreEnvBuiltin(ctx context.Context, argv []string) error {
+	if len(argv) != 1 {
+		return fmt.Errorf("restoreenv builtin requires one argument")
+	}
+	hc := interp.HandlerCtx(ctx)
+
+	for _, e := range strings.Split(argv[0], "\n") {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if vr := hc.Env.Get(kv[0]); !vr.IsSet() {
+			fmt.Fprintf(hc.Stdout, "export %s=%s\n", kv[0], shell.Quote(shell.UnescapeNewlines(kv[1])))
+		} else if vr.String() == "" {
+			fmt.Fprintf(hc.Stdout, "unset %s\n", kv[0])
+		}
+	}
+	return nil
+}
+
 // fixPathBuiltin takes the current path value to fix it by injecting
 // missing default path and returns value on shell interpreter output.
 func fixPathBuiltin(ctx context.Context, argv []string) error {
@@ -850,8 +1167,13 @@ func runActionScript(engineConfig *apptainerConfig.EngineConfig) ([]string, []st
 
 	shell.RegisterOpenHandler("/.singularity.d/env/99-runtimevars.sh", runtimeVarsHandler(senv))
 
+	// remove --unset-env variables after the image environment
+	shell.RegisterOpenHandler("/.unset-apptainer-env.sh", unsetEnvHandler(engineConfig.GetUnsetEnv()))
+
 	// register few builtin
 	shell.RegisterShellBuiltin("getallenv", getAllEnvBuiltin(shell))
+	shell.RegisterShellBuiltin("clearenv", clearEnvBuiltin)
+	shell.RegisterShellBuiltin("restoreenv", restoreEnvBuiltin)
 	shell.RegisterShellBuiltin("sylog", sylogBuiltin)
 	shell.RegisterShellBuiltin("fixpath", fixPathBuiltin)
 	shell.RegisterShellBuiltin("hash", hashBuiltin)
@@ -897,6 +1219,9 @@ func runActionScript(engineConfig *apptainerConfig.EngineConfig) ([]string, []st
 	if err == nil && getEnvVal(penv, "FAKEROOTKEY") == "" {
 		// fakeroot command exists but we're not running nested
 		sylog.Verbosef("Running command with %v", filepath.Base(fakerootPath))
+		if engineConfig.GetFakerootDB() != "" {
+			fakeargs = append(fakeargs, fakeroot.GetFakeDBArgs()...)
+		}
 		args = append(fakeargs, args...)
 
 		// Without this workaround fakeroot does not work
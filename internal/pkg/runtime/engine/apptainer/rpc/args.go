@@ -16,6 +16,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/apptainer/apptainer/pkg/network"
 	"golang.org/x/sys/unix"
 )
 
@@ -43,6 +44,24 @@ type MountArgs struct {
 	Data       string
 }
 
+// MountBatchArgs defines the arguments to MountBatch.
+type MountBatchArgs struct {
+	Mounts []MountArgs
+}
+
+// MountBatchReply defines the reply of MountBatch, Index being the index
+// of the failed mount when Err is set.
+type MountBatchReply struct {
+	Index int
+	Err   error
+}
+
+// MoveMountArgs defines the arguments to MoveMount.
+type MoveMountArgs struct {
+	Socket int
+	Target string
+}
+
 // CryptArgs defines the arguments to mount.
 type CryptArgs struct {
 	Offset    uint64
@@ -62,6 +81,11 @@ type HostnameArgs struct {
 	Hostname string
 }
 
+// DomainnameArgs defines the arguments to setdomainname.
+type DomainnameArgs struct {
+	Domainname string
+}
+
 // ChdirArgs defines the arguments to chdir.
 type ChdirArgs struct {
 	Dir string
@@ -153,6 +177,19 @@ type NvCCLIArgs struct {
 	UserNS     bool
 }
 
+// NetworkAuditArgs defines the arguments to NetworkAudit.
+type NetworkAuditArgs struct{}
+
+// NetworkAuditReply defines the reply of NetworkAudit.
+type NetworkAuditReply struct {
+	Audit network.Audit
+}
+
+// ResolvConfArgs defines the arguments to ResolvConf.
+type ResolvConfArgs struct {
+	Data []byte
+}
+
 // FileInfo returns FileInfo interface to be passed as RPC argument.
 func FileInfo(fi os.FileInfo) os.FileInfo {
 	return &fileInfo{
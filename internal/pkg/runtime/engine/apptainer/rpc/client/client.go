@@ -15,6 +15,7 @@ import (
 	"os"
 
 	args "github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer/rpc"
+	"github.com/apptainer/apptainer/pkg/network"
 	"golang.org/x/sys/unix"
 )
 
@@ -45,6 +46,35 @@ func (t *RPC) Mount(source string, target string, filesystem string, flags uintp
 	return err
 }
 
+// MountBatch calls the MountBatch RPC performing the supplied mounts in
+// order with a single call. The mounts stop at the first failed mount,
+// whose index is returned with its error, the index is -1 for an RPC
+// communication error.
+func (t *RPC) MountBatch(mounts []args.MountArgs) (int, error) {
+	arguments := &args.MountBatchArgs{
+		Mounts: mounts,
+	}
+
+	var reply args.MountBatchReply
+
+	if err := t.Client.Call(t.Name+".MountBatch", arguments, &reply); err != nil {
+		return -1, err
+	}
+	if reply.Err != nil {
+		return reply.Index, reply.Err
+	}
+	return len(mounts), nil
+}
+
+// MoveMount calls the MoveMount RPC using the supplied arguments.
+func (t *RPC) MoveMount(socket int, target string) error {
+	arguments := &args.MoveMountArgs{
+		Socket: socket,
+		Target: target,
+	}
+	return t.Client.Call(t.Name+".MoveMount", arguments, nil)
+}
+
 // Decrypt calls the DeCrypt RPC using the supplied arguments.
 func (t *RPC) Decrypt(offset uint64, path string, key []byte, masterPid int) (string, error) {
 	arguments := &args.CryptArgs{
@@ -104,6 +134,16 @@ func (t *RPC) SetHostname(hostname string) (int, error) {
 	return reply, err
 }
 
+// SetDomainname calls the setdomainname RPC using the supplied arguments.
+func (t *RPC) SetDomainname(domainname string) (int, error) {
+	arguments := &args.DomainnameArgs{
+		Domainname: domainname,
+	}
+	var reply int
+	err := t.Client.Call(t.Name+".SetDomainname", arguments, &reply)
+	return reply, err
+}
+
 // Chdir calls the chdir RPC using the supplied arguments.
 func (t *RPC) Chdir(dir string) (int, error) {
 	arguments := &args.ChdirArgs{
@@ -264,3 +304,19 @@ func (t *RPC) NvCCLI(flags []string, rootFsPath string, userNS bool) error {
 	}
 	return t.Client.Call(t.Name+".NvCCLI", arguments, nil)
 }
+
+// ResolvConf replaces the content of the container /etc/resolv.conf.
+func (t *RPC) ResolvConf(data []byte) error {
+	arguments := &args.ResolvConfArgs{
+		Data: data,
+	}
+	return t.Client.Call(t.Name+".ResolvConf", arguments, nil)
+}
+
+// NetworkAudit lists interfaces and routes of the container network namespace.
+func (t *RPC) NetworkAudit() (*network.Audit, error) {
+	arguments := &args.NetworkAuditArgs{}
+	var reply args.NetworkAuditReply
+	err := t.Client.Call(t.Name+".NetworkAudit", arguments, &reply)
+	return &reply.Audit, err
+}
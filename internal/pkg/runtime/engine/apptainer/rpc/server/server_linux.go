@@ -22,7 +22,9 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/internal/pkg/util/gpu"
 	"github.com/apptainer/apptainer/internal/pkg/util/mainthread"
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/network"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/capabilities"
 	"github.com/apptainer/apptainer/pkg/util/loop"
@@ -73,6 +75,54 @@ func (t *Methods) Mount(arguments *args.MountArgs, mountErr *error) (err error)
 	return
 }
 
+// MountBatch performs the mounts with the specified arguments in order,
+// stopping at the first failed mount. It saves an RPC round trip per
+// mount for containers with many bind mounts.
+func (t *Methods) MountBatch(arguments *args.MountBatchArgs, reply *args.MountBatchReply) (err error) {
+	for i := range arguments.Mounts {
+		var mountErr error
+		if err := t.Mount(&arguments.Mounts[i], &mountErr); err != nil {
+			return err
+		}
+		if mountErr != nil {
+			reply.Index = i
+			reply.Err = mountErr
+			return nil
+		}
+	}
+	return nil
+}
+
+// MoveMount receives a detached mount tree file descriptor over unix
+// socket and attaches it to the target.
+func (t *Methods) MoveMount(arguments *args.MoveMountArgs, reply *int) (err error) {
+	buf := make([]byte, unix.CmsgSpace(4))
+	err = signalutil.IgnoreEINTR(func() error {
+		_, _, _, _, err := unix.Recvmsg(arguments.Socket, nil, buf, 0)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("while receiving mount file descriptor: %s", err)
+	}
+	msgs, err := unix.ParseSocketControlMessage(buf)
+	if err != nil {
+		return fmt.Errorf("while parsing socket control message: %s", err)
+	}
+	if len(msgs) == 0 {
+		return fmt.Errorf("no mount file descriptor received")
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil {
+		return fmt.Errorf("while getting mount file descriptor: %s", err)
+	}
+	defer unix.Close(fds[0])
+
+	mainthread.Execute(func() {
+		err = unix.MoveMount(fds[0], "", unix.AT_FDCWD, arguments.Target, unix.MOVE_MOUNT_F_EMPTY_PATH)
+	})
+	return err
+}
+
 // Decrypt decrypts the loop device.
 func (t *Methods) Decrypt(arguments *args.CryptArgs, reply *string) (err error) {
 	cryptName := ""
@@ -310,6 +360,11 @@ func (t *Methods) SetHostname(arguments *args.HostnameArgs, reply *int) error {
 	return syscall.Sethostname([]byte(arguments.Hostname))
 }
 
+// SetDomainname sets domainname with the specified arguments.
+func (t *Methods) SetDomainname(arguments *args.DomainnameArgs, reply *int) error {
+	return syscall.Setdomainname([]byte(arguments.Domainname))
+}
+
 // Chdir changes current working directory to path.
 func (t *Methods) Chdir(arguments *args.ChdirArgs, reply *int) error {
 	return mainthread.Chdir(arguments.Dir)
@@ -352,8 +407,9 @@ func (t *Methods) SendFuseFd(arguments *args.SendFuseFdArgs, reply *int) error {
 	//  the following change to golang.org/x/sys/unix which removed
 	//  that value as a default:
 	//     https://go-review.googlesource.com/c/sys/+/412497
-	err = unix.Sendmsg(arguments.Socket, []byte{0}, rights, nil, 0)
-	return err
+	return signalutil.IgnoreEINTR(func() error {
+		return unix.Sendmsg(arguments.Socket, []byte{0}, rights, nil, 0)
+	})
 }
 
 // OpenSendFuseFd open a new /dev/fuse file descriptor and send it
@@ -366,7 +422,9 @@ func (t *Methods) OpenSendFuseFd(arguments *args.OpenSendFuseFdArgs, reply *int)
 	*reply = fd
 
 	rights := unix.UnixRights(fd)
-	return unix.Sendmsg(arguments.Socket, []byte{0}, rights, nil, 0)
+	return signalutil.IgnoreEINTR(func() error {
+		return unix.Sendmsg(arguments.Socket, []byte{0}, rights, nil, 0)
+	})
 }
 
 // Symlink performs a symlink with the specified arguments.
@@ -462,3 +520,37 @@ func (t *Methods) NvCCLI(arguments *args.NvCCLIArgs, reply *int) (err error) {
 
 	return gpu.NVCLIConfigure(arguments.Flags, arguments.RootFsPath, arguments.UserNS)
 }
+
+// ResolvConf replaces the content of the container /etc/resolv.conf
+// bind mounted from the session directory. A symlink isn't followed.
+func (t *Methods) ResolvConf(arguments *args.ResolvConfArgs, reply *int) error {
+	const resolvConf = "/etc/resolv.conf"
+
+	f, err := os.OpenFile(resolvConf, os.O_WRONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %s", resolvConf, err)
+	}
+	if fi, err := f.Stat(); err != nil || !fi.Mode().IsRegular() {
+		f.Close()
+		return fmt.Errorf("%s is not a regular file", resolvConf)
+	}
+	err = f.Truncate(0)
+	if err == nil {
+		_, err = f.Write(arguments.Data)
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// NetworkAudit lists interfaces and routes of the network namespace
+// the RPC server is running in.
+func (t *Methods) NetworkAudit(arguments *args.NetworkAuditArgs, reply *args.NetworkAuditReply) error {
+	audit, err := network.AuditNamespace()
+	if err != nil {
+		return err
+	}
+	reply.Audit = *audit
+	return nil
+}
@@ -144,6 +144,7 @@ func (g *Generator) AddOrReplaceLinuxNamespace(ns specs.LinuxNamespaceType, path
 	case specs.CgroupNamespace:
 	case specs.IPCNamespace:
 	case specs.PIDNamespace:
+	case specs.TimeNamespace:
 	default:
 		return
 	}
@@ -165,6 +166,18 @@ func (g *Generator) AddOrReplaceLinuxNamespace(ns specs.LinuxNamespaceType, path
 	g.Config.Linux.Namespaces = append(g.Config.Linux.Namespaces, namespace)
 }
 
+// RemoveLinuxNamespace removes a container process namespace.
+func (g *Generator) RemoveLinuxNamespace(ns specs.LinuxNamespaceType) {
+	g.initLinuxNamespaces()
+
+	for i, n := range g.Config.Linux.Namespaces {
+		if n.Type == ns {
+			g.Config.Linux.Namespaces = append(g.Config.Linux.Namespaces[:i], g.Config.Linux.Namespaces[i+1:]...)
+			return
+		}
+	}
+}
+
 // SetProcessArgs sets container process arguments.
 func (g *Generator) SetProcessArgs(args []string) {
 	g.initProcess()
@@ -220,6 +233,20 @@ func (g *Generator) AddLinuxGIDMapping(host, container, size uint32) {
 	g.Config.Linux.GIDMappings = append(g.Config.Linux.GIDMappings, idMapping)
 }
 
+// SetLinuxTimeOffset sets the offset of the clock in the time namespace,
+// clock being monotonic or boottime.
+func (g *Generator) SetLinuxTimeOffset(clock string, secs int64, nanosecs uint32) {
+	g.initLinux()
+
+	if g.Config.Linux.TimeOffsets == nil {
+		g.Config.Linux.TimeOffsets = make(map[string]specs.LinuxTimeOffset)
+	}
+	g.Config.Linux.TimeOffsets[clock] = specs.LinuxTimeOffset{
+		Secs:     secs,
+		Nanosecs: nanosecs,
+	}
+}
+
 // AddProcessRlimits adds a container process rlimit.
 func (g *Generator) AddProcessRlimits(rType string, rHard uint64, rSoft uint64) {
 	g.initProcess()
@@ -165,6 +165,24 @@ func TestGenerate(t *testing.T) {
 	if len(config.Linux.Namespaces) != 2 {
 		t.Fatalf("wrong OCI process namespace size: %d instead of 2", len(config.Linux.Namespaces))
 	}
+	g.RemoveLinuxNamespace(specs.PIDNamespace)
+	if len(config.Linux.Namespaces) != 1 {
+		t.Fatalf("wrong OCI process namespace size: %d instead of 1", len(config.Linux.Namespaces))
+	} else if config.Linux.Namespaces[0].Type != specs.UserNamespace {
+		t.Fatalf("wrong OCI process user namespace entry: %v", config.Linux.Namespaces[0])
+	}
+	g.AddOrReplaceLinuxNamespace(specs.PIDNamespace, "")
+
+	g.SetLinuxTimeOffset("monotonic", 3600, 0)
+	g.SetLinuxTimeOffset("boottime", -60, 500)
+	g.SetLinuxTimeOffset("monotonic", 7200, 0)
+	if len(config.Linux.TimeOffsets) != 2 {
+		t.Fatalf("wrong OCI time offsets size: %d instead of 2", len(config.Linux.TimeOffsets))
+	} else if off := config.Linux.TimeOffsets["monotonic"]; off.Secs != 7200 || off.Nanosecs != 0 {
+		t.Fatalf("wrong OCI monotonic time offset: %v", off)
+	} else if off := config.Linux.TimeOffsets["boottime"]; off.Secs != -60 || off.Nanosecs != 500 {
+		t.Fatalf("wrong OCI boottime time offset: %v", off)
+	}
 
 	g.AddProcessRlimits("A_LIMIT", 1024, 128)
 	if len(config.Process.Rlimits) != 1 {
@@ -22,6 +22,7 @@ import "C"
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"syscall"
 	"unsafe"
@@ -32,6 +33,7 @@ import (
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/capabilities"
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
 )
 
 // SConfig is an alias for *C.struct_starterConfig
@@ -335,6 +337,8 @@ func (c *Config) SetNsFlagsFromSpec(namespaces []specs.LinuxNamespace) {
 				c.config.container.namespace.flags |= syscall.CLONE_NEWNS
 			case specs.CgroupNamespace:
 				c.config.container.namespace.flags |= 0x2000000
+			case specs.TimeNamespace:
+				c.config.container.namespace.flags |= 0x80
 			}
 		}
 	}
@@ -365,6 +369,8 @@ func (c *Config) SetNsPath(nstype specs.LinuxNamespaceType, path string) error {
 		C.memcpy(unsafe.Pointer(&c.config.container.namespace.mount[0]), cpath, size)
 	case specs.CgroupNamespace:
 		C.memcpy(unsafe.Pointer(&c.config.container.namespace.cgroup[0]), cpath, size)
+	case specs.TimeNamespace:
+		C.memcpy(unsafe.Pointer(&c.config.container.namespace.time[0]), cpath, size)
 	}
 
 	C.free(cpath)
@@ -385,6 +391,41 @@ func (c *Config) SetNsPathFromSpec(namespaces []specs.LinuxNamespace) error {
 	return nil
 }
 
+// timeClockID maps the clocks of the OCI time offsets to the clock IDs
+// written to timens_offsets.
+var timeClockID = map[string]int{
+	"monotonic": unix.CLOCK_MONOTONIC,
+	"boottime":  unix.CLOCK_BOOTTIME,
+}
+
+// SetTimeOffsets sets the clock offsets of the time namespace created
+// for the container.
+func (c *Config) SetTimeOffsets(offsets map[string]specs.LinuxTimeOffset) error {
+	clocks := make([]string, 0, len(offsets))
+	for clock := range offsets {
+		clocks = append(clocks, clock)
+	}
+	sort.Strings(clocks)
+
+	var b strings.Builder
+	for _, clock := range clocks {
+		id, ok := timeClockID[clock]
+		if !ok {
+			return fmt.Errorf("unsupported clock %s for time namespace offset", clock)
+		}
+		fmt.Fprintf(&b, "%d %d %d\n", id, offsets[clock].Secs, offsets[clock].Nanosecs)
+	}
+	if b.Len() > C.MAX_TIME_OFFSETS-1 {
+		return fmt.Errorf("time namespace offsets too big")
+	}
+
+	offs := C.CString(b.String())
+	C.memcpy(unsafe.Pointer(&c.config.container.namespace.timeOffsets[0]), unsafe.Pointer(offs), C.size_t(b.Len()))
+	C.free(unsafe.Pointer(offs))
+
+	return nil
+}
+
 // SetCapabilities sets corresponding capability set identified by ctype
 // from a capability string list identified by ctype.
 func (c *Config) SetCapabilities(ctype string, caps []string) {
@@ -436,6 +477,22 @@ func (c *Config) SetTargetGID(gids []int) {
 	}
 }
 
+// SetGroups sets the supplementary groups of the container process,
+// replacing the groups of the user.
+func (c *Config) SetGroups(gids []int) {
+	c.config.container.privileges.setGroups = C.true
+	c.config.container.privileges.numGroups = C.int(len(gids))
+
+	for i, gid := range gids {
+		if i >= C.MAX_GID {
+			sylog.Warningf("you can't specify more than %d group IDs", C.MAX_GID)
+			c.config.container.privileges.numGroups = C.MAX_GID
+			break
+		}
+		c.config.container.privileges.groups[i] = C.gid_t(gid)
+	}
+}
+
 // Release performs an unmap of a shared starter config and releases the mapped memory.
 // This method should be called as soon as the process doesn't need to access or modify
 // the underlying starter configuration. Attempt to modify the underlying config after
@@ -16,10 +16,15 @@ import (
 	"net"
 	"net/rpc"
 	"os"
+	"strconv"
+	"strings"
 	"syscall"
 
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/starter"
 	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/apptainer/apptainer/pkg/sylog"
 )
 
 // Engine is the combination of an Operations and a config.Common. The apptainer
@@ -95,20 +100,76 @@ type Operations interface {
 	CleanupContainer(context.Context, error, syscall.WaitStatus) error
 }
 
-// getName returns the engine name set in JSON []byte configuration.
-func getName(b []byte) string {
-	engineName := struct {
-		EngineName string `json:"engineName"`
-	}{}
-	if err := json.Unmarshal(b, &engineName); err != nil {
-		return ""
+// header is the part of the JSON []byte configuration identifying the
+// engine and the CLI which produced the configuration.
+type header struct {
+	SchemaVersion string `json:"schemaVersion"`
+	Version       string `json:"version"`
+	EngineName    string `json:"engineName"`
+}
+
+// getHeader returns the header of the JSON []byte configuration.
+func getHeader(b []byte) header {
+	var h header
+	if err := json.Unmarshal(b, &h); err != nil {
+		return header{}
+	}
+	return h
+}
+
+// majorVersion returns the major version of a configuration schema
+// version, configurations without schema version have major version 1.
+func majorVersion(version string) (int, error) {
+	if version == "" {
+		return 1, nil
+	}
+	major, _, _ := strings.Cut(version, ".")
+	v, err := strconv.Atoi(major)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("bad configuration schema version %q", version)
+	}
+	return v, nil
+}
+
+// checkVersion returns an error if the configuration described by h was
+// produced by a CLI using a configuration schema incompatible with the
+// one of this starter.
+func checkVersion(h header) error {
+	cliVersion := h.Version
+	if cliVersion == "" {
+		cliVersion = "unknown"
+	}
+	schemaVersion := h.SchemaVersion
+	if schemaVersion == "" {
+		schemaVersion = "unversioned"
+	}
+
+	sylog.Debugf(
+		"CLI version %s (config schema %s), starter version %s (config schema %s)",
+		cliVersion, schemaVersion, buildcfg.PACKAGE_VERSION, config.SchemaVersion,
+	)
+
+	major, err := majorVersion(h.SchemaVersion)
+	if err != nil {
+		return err
 	}
-	return engineName.EngineName
+	starterMajor, _ := majorVersion(config.SchemaVersion)
+	if major > starterMajor {
+		return fmt.Errorf(
+			"CLI and starter versions are incompatible: CLI version %s uses config schema %s, starter version %s supports config schema %s",
+			cliVersion, schemaVersion, buildcfg.PACKAGE_VERSION, config.SchemaVersion,
+		)
+	}
+	return nil
 }
 
 // Get returns the engine described by the JSON []byte configuration.
 func Get(b []byte, privStageOne bool) (*Engine, error) {
-	engineName := getName(b)
+	h := getHeader(b)
+	if err := checkVersion(h); err != nil {
+		return nil, err
+	}
+	engineName := h.EngineName
 
 	// ensure engine with given name is registered
 	eOp, ok := registeredOperations[engineName]
@@ -124,7 +185,9 @@ func Get(b []byte, privStageOne bool) (*Engine, error) {
 		},
 	}
 
-	// parse received JSON configuration to specific EngineConfig
+	// parse received JSON configuration to specific EngineConfig, unknown
+	// fields added by a newer CLI with the same schema major version are
+	// ignored
 	if err := json.Unmarshal(b, e.Common); err != nil {
 		return nil, fmt.Errorf("could not parse JSON configuration: %s", err)
 	}
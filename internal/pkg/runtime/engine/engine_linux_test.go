@@ -0,0 +1,115 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package engine_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/runtime/engine"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+
+	// register the apptainer engine
+	_ "github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer"
+)
+
+func checkEngine(t *testing.T, e *engine.Engine) {
+	t.Helper()
+
+	ec, ok := e.EngineConfig.(*apptainerConfig.EngineConfig)
+	if !ok {
+		t.Fatalf("unexpected engine config type %T", e.EngineConfig)
+	}
+	if e.EngineName != apptainerConfig.Name {
+		t.Errorf("got engine %q, want %q", e.EngineName, apptainerConfig.Name)
+	}
+	if e.ContainerID != "alpine.sif" {
+		t.Errorf("got container ID %q, want %q", e.ContainerID, "alpine.sif")
+	}
+	if got := ec.GetImage(); got != "/tmp/alpine.sif" {
+		t.Errorf("got image %q, want %q", got, "/tmp/alpine.sif")
+	}
+	if got := ec.GetCwd(); got != "/home/user" {
+		t.Errorf("got cwd %q, want %q", got, "/home/user")
+	}
+	if !ec.GetContain() {
+		t.Errorf("contain option lost")
+	}
+	binds := ec.GetBindPath()
+	if len(binds) != 1 || binds[0].Source != "/data" || binds[0].Destination != "/mnt" {
+		t.Errorf("unexpected bind paths %+v", binds)
+	}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixture     string
+		expectError string
+	}{
+		{
+			name:    "previous release",
+			fixture: "config-unversioned.json",
+		},
+		{
+			name:    "newer minor version",
+			fixture: "config-1.9.json",
+		},
+		{
+			name:        "newer major version",
+			fixture:     "config-2.0.json",
+			expectError: "CLI and starter versions are incompatible: CLI version 2.0.0 uses config schema 2.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatalf("failed to read fixture: %s", err)
+			}
+
+			e, err := engine.Get(b, false)
+			if tt.expectError != "" {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				} else if !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("got error %q, want %q", err, tt.expectError)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			checkEngine(t, e)
+
+			// round-trip with the current schema version
+			e.SchemaVersion = config.SchemaVersion
+			b, err = json.Marshal(e.Common)
+			if err != nil {
+				t.Fatalf("failed to marshal config: %s", err)
+			}
+			e, err = engine.Get(b, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			checkEngine(t, e)
+		})
+	}
+}
+
+func TestGetBadSchemaVersion(t *testing.T) {
+	b := []byte(`{"schemaVersion":"x.1","engineName":"apptainer"}`)
+	if _, err := engine.Get(b, false); err == nil {
+		t.Errorf("unexpected success with a bad schema version")
+	}
+}
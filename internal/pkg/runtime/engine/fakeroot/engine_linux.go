@@ -26,6 +26,7 @@ import (
 	fakerootConfig "github.com/apptainer/apptainer/internal/pkg/runtime/engine/fakeroot/config"
 	"github.com/apptainer/apptainer/internal/pkg/security/seccomp"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
 	fakerootcallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/fakeroot"
 	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -84,10 +85,16 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 	apptainerconf.SetCurrentConfig(fileConfig)
 	apptainerconf.SetBinaryPath(buildcfg.LIBEXECDIR, !starterConfig.GetIsSUID())
 
+	// root inside a user namespace maps the ids available in it
+	// without newuidmap/newgidmap
+	nested := fakerootutil.IsNestedRoot()
+
 	if starterConfig.GetIsSUID() {
 		if !fileConfig.AllowSetuid {
 			return fmt.Errorf("fakeroot requires to set 'allow setuid = yes' in %s", configurationFile)
 		}
+	} else if nested {
+		sylog.Verbosef("Fakeroot requested as root in a user namespace, using a nested user namespace")
 	} else {
 		sylog.Verbosef("Fakeroot requested with unprivileged workflow, fallback to newuidmap/newgidmap")
 		sylog.Debugf("Search for newuidmap binary")
@@ -119,6 +126,9 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 	} else if len(callbacks) == 1 {
 		getIDRange = callbacks[0].(fakerootcallback.UserMapping)
 	}
+	if nested {
+		getIDRange = fakerootutil.GetNestedIDRange
+	}
 
 	g.AddLinuxUIDMapping(uid, 0, 1)
 	idRange, err := getIDRange(fakerootutil.SubUIDFile, uid)
@@ -345,7 +355,10 @@ func (e *EngineOperations) MonitorContainer(pid int, signals chan os.Signal) (sy
 
 	go func() {
 		sylog.Debugf("Waiting for container process %d", pid)
-		_, err := syscall.Wait4(pid, &status, 0, nil)
+		err := signalutil.IgnoreEINTR(func() error {
+			_, err := syscall.Wait4(pid, &status, 0, nil)
+			return err
+		})
 		sylog.Debugf("Wait for process %d complete with status %v, error %v", pid, status, err)
 		waitStatus <- status
 		waitError <- err
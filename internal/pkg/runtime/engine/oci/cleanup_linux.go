@@ -16,6 +16,7 @@ import (
 	"syscall"
 
 	"github.com/apptainer/apptainer/internal/pkg/instance"
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
 	"github.com/apptainer/apptainer/pkg/ociruntime"
 	"github.com/apptainer/apptainer/pkg/sylog"
 )
@@ -64,12 +65,11 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 		exitCode = 255
 		desc = fatal.Error()
 	} else if status.Signaled() {
-		s := status.Signal()
-		exitCode = int(s) + 128
-		desc = fmt.Sprintf("interrupted by signal %s", s.String())
+		exitCode = signalutil.ExitCode(status)
+		desc = fmt.Sprintf("interrupted by signal %s", status.Signal().String())
 	} else {
 		exitCode = status.ExitStatus()
-		desc = fmt.Sprintf("exited with code %d", status.ExitStatus())
+		desc = fmt.Sprintf("exited with code %d", exitCode)
 	}
 
 	e.EngineConfig.State.ExitCode = &exitCode
@@ -139,6 +139,15 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		if err := syscall.Close(e.EngineConfig.InputStreams[0]); err != nil {
 			return err
 		}
+	} else if e.EngineConfig.Exec && e.EngineConfig.OciConfig.Process.Terminal {
+		// oci exec --tty passes the slave side of the terminal
+		// allocated by the CLI as standard streams
+		if _, err := syscall.Setsid(); err != nil {
+			return err
+		}
+		if _, _, err := syscall.Syscall(syscall.SYS_IOCTL, os.Stdin.Fd(), uintptr(syscall.TIOCSCTTY), 1); err != 0 {
+			return fmt.Errorf("failed to set controlling terminal: %s", err.Error())
+		}
 	}
 
 	// trigger pre-start process
@@ -0,0 +1,57 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launch
+
+import (
+	"path/filepath"
+	"runtime"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/machine"
+	imgutil "github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// imageArch returns the architecture of img: the one recorded for the root
+// filesystem partition of a SIF image, or the one of the shell binary of a
+// sandbox. An empty string is returned if the architecture is unknown.
+func imageArch(img *imgutil.Image) string {
+	switch img.Type {
+	case imgutil.SANDBOX:
+		shell := fs.EvalRelative("/bin/sh", img.Path)
+		arch, err := machine.ArchFromElf(filepath.Join(img.Path, shell))
+		if err != nil {
+			sylog.Debugf("Could not get the architecture of %s: %s", img.Path, err)
+			return ""
+		}
+		return arch
+	case imgutil.SIF:
+		part, err := img.GetRootFsPartition()
+		if err == nil && part.Arch != "unknown" {
+			return part.Arch
+		}
+	}
+	return ""
+}
+
+// checkImageArch warns if the architecture of the sandbox image can't run
+// on the host, and reports in verbose output when image runs with
+// binfmt_misc emulation. Opening a SIF image of an architecture which
+// can't run on the host already fails with the same hint.
+func checkImageArch(img *imgutil.Image) {
+	arch := imageArch(img)
+	switch {
+	case arch == "":
+	case machine.Emulated(arch):
+		sylog.Verbosef("Running the %s image on the %s host with binfmt_misc emulation", arch, runtime.GOARCH)
+	case !machine.CompatibleWith(arch) && img.Type == imgutil.SANDBOX:
+		sylog.Warningf("The image's architecture (%s) doesn't match the host's (%s) and no emulation is available, the container will fail with 'exec format error'", arch, runtime.GOARCH)
+		sylog.Warningf("To run it with emulation %s", machine.EmulationHint)
+	}
+}
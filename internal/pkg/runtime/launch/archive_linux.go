@@ -0,0 +1,171 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	apexlog "github.com/apex/log"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	imgutil "github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
+	"github.com/apptainer/apptainer/pkg/util/namespaces"
+	umocilayer "github.com/opencontainers/umoci/oci/layer"
+	"github.com/opencontainers/umoci/pkg/idtools"
+)
+
+// prepareArchiveImage extracts the tar archive image to a sandbox the
+// container runs from, read-only. The sandbox is kept in the cache under
+// the digest of the archive, so the archive is extracted once, or in a
+// temporary directory removed on exit if the cache is disabled.
+func (l *Launcher) prepareArchiveImage(image string) error {
+	if l.cfg.Writable {
+		return fmt.Errorf("tar archive %s is run read-only, it can't be used with --writable", image)
+	}
+
+	// a dry run plans the container of an empty temporary sandbox
+	cacheDir := l.cfg.RootfsCacheDir
+	if cacheDir == "" || l.cfg.DryRun {
+		fi, err := os.Stat(image)
+		if err != nil {
+			return err
+		}
+		tmpDir, err := fs.ChooseTmpDir(l.cfg.TmpDir, l.cfg.TmpDirCandidates, fi.Size()*fs.ExtractFactor)
+		if err != nil {
+			return err
+		}
+		rootfs, err := os.MkdirTemp(tmpDir, "rootfs-")
+		if err != nil {
+			return fmt.Errorf("could not create temporary sandbox: %w", err)
+		}
+		if l.cfg.DryRun {
+			sylog.Verbosef("Planning the container of an empty sandbox in place of tar archive %s", image)
+		} else {
+			sylog.Infof("Extracting tar archive to temporary sandbox...")
+			if err := extractArchive(image, rootfs); err != nil {
+				fs.ForceRemoveAll(rootfs)
+				return fmt.Errorf("while extracting %s: %w", image, err)
+			}
+		}
+		l.engineConfig.SetImage(rootfs)
+		l.engineConfig.SetImageArchive(image)
+		l.engineConfig.SetDeleteTempDir(rootfs)
+		return nil
+	}
+
+	digest, err := archiveDigest(image)
+	if err != nil {
+		return fmt.Errorf("while computing digest of %s: %w", image, err)
+	}
+	rootfs := filepath.Join(cacheDir, digest)
+	if fs.IsDir(rootfs) {
+		sylog.Debugf("Using sandbox %s extracted from %s", rootfs, image)
+	} else if err := extractArchiveToCache(image, cacheDir, rootfs); err != nil {
+		return err
+	}
+	l.engineConfig.SetImage(rootfs)
+	l.engineConfig.SetImageArchive(image)
+	return nil
+}
+
+// extractArchiveToCache extracts the tar archive image to the cache entry
+// rootfs, through a temporary directory locked until it's renamed, so a
+// concurrent cache clean skips it and a concurrent extraction doesn't
+// overwrite it.
+func extractArchiveToCache(image, cacheDir, rootfs string) error {
+	if err := os.MkdirAll(cacheDir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(cacheDir, "tmp_")
+	if err != nil {
+		return fmt.Errorf("could not create sandbox in cache: %w", err)
+	}
+	if fd, err := lock.Exclusive(tmp); err == nil {
+		defer lock.Release(fd)
+	}
+
+	sylog.Infof("Extracting tar archive to sandbox in cache %s...", cacheDir)
+	if err := extractArchive(image, tmp); err != nil {
+		fs.ForceRemoveAll(tmp)
+		return fmt.Errorf("while extracting %s: %w", image, err)
+	}
+	if err := os.Rename(tmp, rootfs); err != nil {
+		fs.ForceRemoveAll(tmp)
+		if !fs.IsDir(rootfs) {
+			return fmt.Errorf("could not add sandbox to cache: %w", err)
+		}
+		// extracted by a concurrent run in the meantime
+		sylog.Debugf("Sandbox %s extracted concurrently", rootfs)
+	}
+	return nil
+}
+
+// archiveDigest returns the hex encoded sha256 digest of the file.
+func archiveDigest(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// extractArchive extracts the root filesystem of the tar archive image,
+// compressed or not, into the directory rootfs. As an unprivileged user the
+// files are owned by the user.
+func extractArchive(image, rootfs string) error {
+	f, err := os.Open(image)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := imgutil.NewArchiveReader(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var opts umocilayer.UnpackOptions
+	if namespaces.IsUnprivileged() {
+		opts.MapOptions.Rootless = true
+		uidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Geteuid()))
+		if err != nil {
+			return fmt.Errorf("error parsing uidmap: %s", err)
+		}
+		gidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Getegid()))
+		if err != nil {
+			return fmt.Errorf("error parsing gidmap: %s", err)
+		}
+		opts.MapOptions.UIDMappings = append(opts.MapOptions.UIDMappings, uidMap)
+		opts.MapOptions.GIDMappings = append(opts.MapOptions.GIDMappings, gidMap)
+	}
+	// umoci reports the files it can't restore exactly as an unprivileged
+	// user, only show them in debug output
+	if sylog.GetLevel() < int(sylog.DebugLevel) {
+		apexlog.SetLevel(apexlog.ErrorLevel)
+	}
+
+	if err := umocilayer.UnpackLayer(rootfs, r, &opts); err != nil {
+		return err
+	}
+	// the root directory is created with restrictive permissions
+	return os.Chmod(rootfs, 0o755)
+}
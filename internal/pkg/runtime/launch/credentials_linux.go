@@ -0,0 +1,216 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// The host credentials bound in the container with --security-credentials.
+const (
+	credentialKrb5     = "krb5"
+	credentialMunge    = "munge"
+	credentialSSHAgent = "ssh-agent"
+	credentialNone     = "none"
+)
+
+var (
+	// mungeSocket is the socket of the munge daemon.
+	mungeSocket = "/run/munge/munge.socket.2"
+	// kcmSocket is the socket of the Kerberos KCM daemon, as set up by
+	// sssd-kcm and Heimdal.
+	kcmSocket = "/var/run/.heim_org.h5l.kcm-socket"
+)
+
+// setCredentialBinds binds the host credentials requested with
+// --security-credentials, or by the 'security credentials' directive, at
+// the same location in the container and exports the variables pointing to
+// them. Missing credentials, and credentials not owned by the container
+// user, are skipped with a warning.
+func (l *Launcher) setCredentialBinds() error {
+	creds := l.cfg.SecurityCredentials
+	origin := "flag: --security-credentials"
+	if len(creds) == 0 {
+		creds = l.engineConfig.File.SecurityCredentials
+		origin = "conf: security credentials"
+	}
+
+	kinds := make(map[string]bool)
+	for _, c := range creds {
+		switch c {
+		case credentialKrb5, credentialMunge, credentialSSHAgent, credentialNone:
+			kinds[c] = true
+		default:
+			return fmt.Errorf("invalid security credential %q, must be one of krb5, munge, ssh-agent or none", c)
+		}
+	}
+	if kinds[credentialNone] {
+		if len(kinds) > 1 {
+			return fmt.Errorf("security credential none can't be combined with other credentials")
+		}
+		return nil
+	}
+	if len(kinds) == 0 {
+		return nil
+	}
+	if l.engineConfig.GetInstanceJoin() {
+		sylog.Debugf("Joining an instance, not binding security credentials")
+		return nil
+	}
+
+	if kinds[credentialKrb5] {
+		l.setKrb5Binds(origin)
+	}
+	if kinds[credentialMunge] {
+		if fi, ok := credentialStat("munge", mungeSocket); ok && isSocket("munge", mungeSocket, fi) {
+			// the munge daemon authenticates the clients, its socket is
+			// meant to be used by any user
+			l.addCredentialBind(mungeSocket, origin)
+		}
+	}
+	if kinds[credentialSSHAgent] {
+		l.setSSHAgentBinds(origin)
+	}
+	return nil
+}
+
+// setKrb5Binds binds the Kerberos credential cache of KRB5CCNAME, or the
+// default file cache of the user, and exports KRB5CCNAME.
+func (l *Launcher) setKrb5Binds(origin string) {
+	ccname, ok := os.LookupEnv("KRB5CCNAME")
+	if !ok || ccname == "" {
+		ccname = "FILE:/tmp/krb5cc_" + strconv.FormatUint(uint64(l.uid), 10)
+	}
+
+	kind, path := "FILE", ccname
+	if i := strings.Index(ccname, ":"); i > 0 && !strings.HasPrefix(ccname, "/") {
+		kind, path = ccname[:i], ccname[i+1:]
+	}
+
+	switch kind {
+	case "FILE":
+		fi, ok := credentialStat("krb5", path)
+		if !ok || !l.credentialOwned("krb5", path, fi) {
+			return
+		}
+	case "DIR":
+		// a subsidiary cache, DIR::<dir>/tkt, selects a cache of the
+		// collection
+		if strings.HasPrefix(path, ":") {
+			path = filepath.Dir(path[1:])
+		}
+		fi, ok := credentialStat("krb5", path)
+		if !ok || !l.credentialOwned("krb5", path, fi) {
+			return
+		}
+	case "KCM":
+		// the KCM daemon authenticates the clients, its socket is
+		// owned by root
+		fi, ok := credentialStat("krb5", kcmSocket)
+		if !ok || !isSocket("krb5", kcmSocket, fi) {
+			return
+		}
+		path = kcmSocket
+	default:
+		sylog.Warningf("Kerberos credential cache %s can't be bound in the container, only FILE, DIR and KCM caches can", ccname)
+		return
+	}
+
+	if l.addCredentialBind(path, origin) {
+		l.setCredentialEnv("KRB5CCNAME", ccname, origin)
+	}
+}
+
+// setSSHAgentBinds binds the SSH agent socket of SSH_AUTH_SOCK and exports
+// SSH_AUTH_SOCK.
+func (l *Launcher) setSSHAgentBinds(origin string) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		sylog.Warningf("Not binding ssh-agent credentials: SSH_AUTH_SOCK is not set")
+		return
+	}
+	fi, ok := credentialStat("ssh-agent", sock)
+	if !ok || !isSocket("ssh-agent", sock, fi) || !l.credentialOwned("ssh-agent", sock, fi) {
+		return
+	}
+	if l.addCredentialBind(sock, origin) {
+		l.setCredentialEnv("SSH_AUTH_SOCK", sock, origin)
+	}
+}
+
+// credentialStat returns the information of the host credential path, or
+// warns if it's missing.
+func credentialStat(kind, path string) (os.FileInfo, bool) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		sylog.Warningf("Not binding %s credentials: %s", kind, err)
+		return nil, false
+	}
+	return fi, true
+}
+
+// isSocket returns whether the host credential path is a socket, or warns.
+func isSocket(kind, path string, fi os.FileInfo) bool {
+	if fi.Mode()&os.ModeSocket == 0 {
+		sylog.Warningf("Not binding %s credentials: %s is not a socket", kind, path)
+		return false
+	}
+	return true
+}
+
+// credentialOwned returns whether the host credential path is owned by the
+// container user, or warns. Credentials of another user are never exposed,
+// e.g. when root runs a container as another user with --security uid.
+func (l *Launcher) credentialOwned(kind, path string, fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	if st.Uid != l.uid {
+		sylog.Warningf("Not binding %s credentials: %s is owned by UID %d, not by the container user (UID %d)", kind, path, st.Uid, l.uid)
+		return false
+	}
+	return true
+}
+
+// addCredentialBind binds the host credential path at the same location
+// in the container, returning false if it can't be expressed as a bind.
+func (l *Launcher) addCredentialBind(path, origin string) bool {
+	if strings.Contains(path, ":") {
+		sylog.Warningf("Not binding credentials %s: the path contains ':'", path)
+		return false
+	}
+	path = filepath.Clean(path)
+	if l.credentialFiles == nil {
+		l.credentialFiles = make(map[string]string)
+	}
+	if _, ok := l.credentialFiles[path]; ok {
+		return true
+	}
+	l.credentialFiles[path] = origin
+	l.cfg.BindPaths = append(l.cfg.BindPaths, path+":"+path)
+	sylog.Debugf("Binding security credentials %s", path)
+	return true
+}
+
+// setCredentialEnv sets a variable in the container pointing to the bound
+// credentials, unless set with --env, --env-file or APPTAINERENV_.
+func (l *Launcher) setCredentialEnv(key, value, origin string) {
+	if l.credentialEnv == nil {
+		l.credentialEnv = make(map[string]originEnvVar)
+	}
+	l.credentialEnv[key] = originEnvVar{value: value, origin: origin}
+}
@@ -0,0 +1,481 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer"
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs/mount"
+	"github.com/apptainer/apptainer/internal/pkg/util/gpu"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Plan describes the container configuration prepared by the launcher,
+// as it would be passed to the starter. ImageFrom is the image file or tar
+// archive converted to the Image sandbox.
+type Plan struct {
+	Image      string       `json:"image"`
+	ImageFrom  string       `json:"imageFrom,omitempty"`
+	Instance   string       `json:"instance,omitempty"`
+	Args       []string     `json:"args"`
+	Cwd        string       `json:"cwd"`
+	Mounts     []PlanMount  `json:"mounts"`
+	Namespaces []string     `json:"namespaces"`
+	Env        []PlanEnv    `json:"env"`
+	UnsetEnv   []string     `json:"unsetEnv,omitempty"`
+	Cgroups    any          `json:"cgroups,omitempty"`
+	JobCgroup  string       `json:"jobCgroup,omitempty"`
+	NvCCLI     []string     `json:"nvccli,omitempty"`
+	Security   PlanSecurity `json:"security"`
+}
+
+// PlanMount describes a mount planned in the container, with the origin
+// of the mount: a configuration directive, a command line flag or a
+// default.
+type PlanMount struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Options     string `json:"options,omitempty"`
+	Origin      string `json:"origin"`
+}
+
+// PlanEnv describes a variable of the container environment, with the
+// origin of its value: the host, a command line flag, an APPTAINERENV_
+// variable or a default. Variables defined by the image are set when the
+// container starts and may override the values from the host.
+type PlanEnv struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Origin string `json:"origin"`
+}
+
+// PlanSecurity describes the security options planned for the container.
+type PlanSecurity struct {
+	Setuid          bool     `json:"setuid"`
+	Fakeroot        bool     `json:"fakeroot"`
+	TargetUID       int      `json:"targetUID,omitempty"`
+	TargetGID       []int    `json:"targetGID,omitempty"`
+	Umask           string   `json:"umask"`
+	Groups          []int    `json:"groups"`
+	AddCaps         string   `json:"addCaps,omitempty"`
+	DropCaps        string   `json:"dropCaps,omitempty"`
+	KeepPrivs       bool     `json:"keepPrivs"`
+	NoPrivs         bool     `json:"noPrivs"`
+	AllowSUID       bool     `json:"allowSUID"`
+	NoNewPrivileges bool     `json:"noNewPrivileges"`
+	Options         []string `json:"options,omitempty"`
+}
+
+// dryRun prints the planned container configuration instead of calling
+// the starter. The temporary sandbox planned in place of an image to
+// convert is removed.
+func (l *Launcher) dryRun(w io.Writer, instanceName string, useSuid bool) error {
+	if dir := l.engineConfig.GetDeleteTempDir(); dir != "" {
+		defer fs.ForceRemoveAll(dir)
+	}
+	plan, err := l.plan(instanceName, useSuid)
+	if err != nil {
+		return err
+	}
+	if l.cfg.DryRunJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+	return plan.print(w)
+}
+
+// plan builds the planned container configuration from the engine
+// configuration, the mounts being those registered by the engine.
+func (l *Launcher) plan(instanceName string, useSuid bool) (*Plan, error) {
+	ec := l.engineConfig
+	oci := l.generator.Config
+
+	mounts, err := l.planMounts(useSuid)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{
+		Image:    ec.GetImage(),
+		Instance: instanceName,
+		Mounts:   mounts,
+		Env:      l.planEnv(useSuid),
+		UnsetEnv: ec.GetUnsetEnv(),
+		Security: PlanSecurity{
+			Setuid:          useSuid,
+			Fakeroot:        ec.GetFakeroot(),
+			TargetUID:       ec.GetTargetUID(),
+			TargetGID:       ec.GetTargetGID(),
+			Umask:           "0022",
+			Groups:          l.planGroups(),
+			AddCaps:         ec.GetAddCaps(),
+			DropCaps:        ec.GetDropCaps(),
+			KeepPrivs:       ec.GetKeepPrivs(),
+			NoPrivs:         ec.GetNoPrivs(),
+			AllowSUID:       ec.GetAllowSUID(),
+			NoNewPrivileges: oci.Process.NoNewPrivileges,
+			Options:         ec.GetSecurity(),
+		},
+	}
+
+	if ec.GetRestoreUmask() {
+		p.Security.Umask = fmt.Sprintf("%04o", ec.GetUmask())
+	}
+
+	p.Args = oci.Process.Args
+	p.Cwd = oci.Process.Cwd
+	if p.Cwd == "" {
+		p.Cwd = ec.GetCwd()
+	}
+
+	// the mount namespace is always created by the engine
+	p.Namespaces = []string{string(specs.MountNamespace)}
+	if oci.Linux != nil {
+		for _, ns := range oci.Linux.Namespaces {
+			if ns.Type != specs.MountNamespace {
+				p.Namespaces = append(p.Namespaces, string(ns.Type))
+			}
+		}
+	}
+
+	// the container root filesystem is only known by the engine
+	if ec.GetNvCCLI() {
+		ldconfig, err := bin.FindBin("ldconfig")
+		if err != nil {
+			ldconfig = "ldconfig"
+		}
+		userNS := l.cfg.Namespaces.User || l.cfg.Fakeroot || (!useSuid && os.Geteuid() != 0)
+		args, err := gpu.NVCLIConfigureArgs(ec.GetNvCCLIEnv(), ldconfig, "<rootfs>", userNS)
+		if err == nil {
+			p.NvCCLI = append([]string{"nvidia-container-cli"}, args...)
+		}
+	}
+
+	if cg := ec.GetCgroupsJSON(); cg != "" {
+		var resources any
+		if err := json.Unmarshal([]byte(cg), &resources); err == nil {
+			p.Cgroups = resources
+		} else {
+			p.Cgroups = cg
+		}
+	}
+	p.JobCgroup = ec.GetJobCgroup()
+
+	p.ImageFrom = ec.GetImageConverted()
+	if p.ImageFrom == "" {
+		p.ImageFrom = ec.GetImageArchive()
+	}
+
+	return p, nil
+}
+
+// planGroups returns the supplementary groups of the container process,
+// those selected with --groups or 'container groups', or else the groups
+// of the user.
+func (l *Launcher) planGroups() []int {
+	if gids, ok := l.engineConfig.GetGroups(); ok {
+		return gids
+	}
+	gids, _ := os.Getgroups()
+	if gids == nil {
+		gids = []int{}
+	}
+	return gids
+}
+
+// planEnv returns the sorted container environment, the host environment
+// passed through being overridden by --env, --env-file and APPTAINERENV_
+// variables.
+func (l *Launcher) planEnv(useSuid bool) []PlanEnv {
+	vars := make(map[string]PlanEnv)
+	for _, e := range l.generator.Config.Process.Env {
+		k, v, _ := strings.Cut(e, "=")
+		vars[k] = PlanEnv{Name: k, Value: v, Origin: l.hostEnvOrigin(k, useSuid)}
+	}
+	for k, v := range l.engineConfig.GetApptainerEnv() {
+		origin, ok := l.envOrigins[k]
+		if !ok {
+			origin = "env: " + env.ApptainerEnvPrefix
+		}
+		vars[k] = PlanEnv{Name: k, Value: v, Origin: origin}
+	}
+
+	list := make([]PlanEnv, 0, len(vars))
+	for _, e := range vars {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// hostEnvOrigin returns the origin of a variable of the container process
+// environment, which is either passed from the host, set by the runtime or
+// a default.
+func (l *Launcher) hostEnvOrigin(key string, useSuid bool) string {
+	for _, prefix := range env.ApptainerPrefixes {
+		// host APPTAINER_ variables are never forwarded
+		if strings.HasPrefix(key, prefix) {
+			return "runtime"
+		}
+	}
+	switch {
+	case key == "HOME" || key == "PATH":
+		return "default"
+	case !l.cfg.CleanEnv:
+		return "host"
+	case env.MatchPatterns(key, l.cfg.PreserveEnv):
+		return "flag: --preserve-env"
+	case useSuid && env.MatchPatterns(key, l.engineConfig.File.SuidEnvAllowlist):
+		return "conf: suid env allowlist"
+	case key == "LANG":
+		return "default"
+	}
+	return "host"
+}
+
+// planMounts returns the mount points registered by the engine for the
+// container, in mount order, with their origin.
+func (l *Launcher) planMounts(useSuid bool) ([]PlanMount, error) {
+	planned, err := apptainer.PlanMounts(l.engineConfig, useSuid)
+	if err != nil {
+		return nil, err
+	}
+	mounts := make([]PlanMount, 0, len(planned))
+	for _, pm := range planned {
+		var opts []string
+		if pm.Type != "" {
+			opts = append(opts, pm.Type)
+		}
+		opts = append(opts, pm.Options...)
+		origin := l.mountOrigin(pm)
+		if pm.Conditional {
+			origin += " (if missing in the image)"
+		}
+		mounts = append(mounts, PlanMount{
+			Source:      pm.Source,
+			Destination: pm.Destination,
+			Options:     strings.Join(opts, ","),
+			Origin:      origin,
+		})
+	}
+	return mounts, nil
+}
+
+// mountOrigin returns the origin of a mount point registered by the
+// engine, from the mount step it belongs to.
+//
+//nolint:gocyclo
+func (l *Launcher) mountOrigin(pm apptainer.PlannedMount) string {
+	ec := l.engineConfig
+
+	switch pm.Tag {
+	case mount.SessionTag:
+		switch {
+		case ec.GetSessionDir() != "":
+			return "flag: --sessiondir"
+		case ec.GetSessionDirSize() > 0:
+			return "flag: --sessiondir-size"
+		}
+		return "default: session directory"
+	case mount.RootfsTag:
+		return "image"
+	case mount.ImageBindTag:
+		return "flag: --bind/--mount"
+	case mount.PreLayerTag:
+		if ec.GetWritableTmpfs() && pm.Source == pm.Destination {
+			return "flag: --writable-tmpfs"
+		}
+		if images := ec.GetImageList(); len(images) > 0 && pm.Source == images[0].Source {
+			return "image overlay partition"
+		}
+		return "flag: --overlay"
+	case mount.DevTag:
+		switch {
+		case pm.Type == "devpts":
+			return "conf: mount devpts"
+		case ec.GetNvLegacy() && strings.HasPrefix(pm.Source, "/dev/nvidia"):
+			return "flag: --nv"
+		case ec.GetRocm() && (pm.Source == "/dev/kfd" || strings.HasPrefix(pm.Source, "/dev/dri")):
+			return "flag: --rocm"
+		}
+		return l.gpuFileOrigin(pm.Source, "conf: mount dev")
+	case mount.HostfsTag:
+		return "conf: mount hostfs"
+	case mount.BindsTag:
+		switch {
+		case pm.Type == "fuse":
+			return "flag: --fusemount"
+		case ec.GetContain():
+			return "default: --contain"
+		}
+		return "conf: bind path"
+	case mount.KernelTag:
+		return "conf: mount " + strings.TrimPrefix(pm.Destination, "/")
+	case mount.HomeTag:
+		if ec.GetCustomHome() {
+			return "flag: --home"
+		}
+		return "conf: mount home"
+	case mount.TmpTag:
+		return "conf: mount tmp"
+	case mount.ScratchTag:
+		return "flag: --scratch"
+	case mount.CwdTag:
+		return "default: current directory"
+	case mount.FilesTag:
+		return l.fileOrigin(pm)
+	case mount.UserbindsTag:
+		switch {
+		case pm.Type == apptainerConfig.FSTypeTmpfs && pm.Destination == "/dev/shm" && l.cfg.ShmSize != "":
+			return "flag: --shm-size"
+		case pm.Type == apptainerConfig.FSTypeTmpfs || pm.Type == apptainerConfig.FSTypeDevpts:
+			return "flag: --mount"
+		}
+		if name, ok := l.pluginBinds[pm.Destination]; ok {
+			return "plugin: " + name
+		} else if o, ok := l.credentialFiles[pm.Source]; ok && pm.Source == pm.Destination {
+			return o
+		} else if o, ok := l.socketsBinds[pm.Source]; ok {
+			return o
+		}
+		return "flag: --bind/--mount"
+	case mount.OtherTag:
+		return "flag: --fusemount"
+	}
+	return "engine"
+}
+
+// fileOrigin returns the origin of a file or library bound by the engine.
+func (l *Launcher) fileOrigin(pm apptainer.PlannedMount) string {
+	ec := l.engineConfig
+	conf := ec.File
+
+	switch pm.Destination {
+	case "/etc/passwd":
+		return "conf: config passwd"
+	case "/etc/group":
+		return "conf: config group"
+	case "/etc/resolv.conf":
+		if search, options := ec.GetDNSSearch(); ec.GetDNS() != "" || search != "" || options != "" {
+			return "flag: --dns"
+		}
+		return "conf: config resolv_conf"
+	case "/etc/hostname", "/etc/hosts":
+		if conf.ContainerHostname != "" {
+			return "conf: container hostname"
+		}
+		return "flag: --hostname"
+	case "/etc/localtime":
+		if l.cfg.Timezone == "" {
+			return "conf: mount localtime"
+		}
+		return "flag: --tz"
+	case "/.singularity.d/libs":
+		return "default: libraries directory"
+	}
+	for _, lib := range ec.GetLibrariesPath() {
+		if src, _, _ := strings.Cut(lib, ":"); src == pm.Source {
+			return l.gpuFileOrigin(pm.Source, "flag: --contain-libs")
+		}
+	}
+	return l.gpuFileOrigin(pm.Source, "flag: --dmtcp-launch/--dmtcp-restart")
+}
+
+// gpuFileOrigin returns the origin of a host file bound into the container,
+// the GPU flag having added it or else origin.
+func (l *Launcher) gpuFileOrigin(src, origin string) string {
+	if o, ok := l.gpuFiles[src]; ok {
+		return o
+	}
+	return origin
+}
+
+// print writes the plan as readable tables.
+func (p *Plan) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Image:\t%s\n", p.Image)
+	if p.ImageFrom != "" {
+		fmt.Fprintf(tw, "Image from:\t%s\n", p.ImageFrom)
+	}
+	if p.Instance != "" {
+		fmt.Fprintf(tw, "Instance:\t%s\n", p.Instance)
+	}
+	fmt.Fprintf(tw, "Process:\t%s\n", strings.Join(p.Args, " "))
+	fmt.Fprintf(tw, "Working directory:\t%s\n", p.Cwd)
+	fmt.Fprintf(tw, "Namespaces:\t%s\n", strings.Join(p.Namespaces, ", "))
+
+	fmt.Fprintf(tw, "\nMOUNT SOURCE\tDESTINATION\tOPTIONS\tORIGIN\n")
+	for _, m := range p.Mounts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.Source, m.Destination, m.Options, m.Origin)
+	}
+
+	fmt.Fprintf(tw, "\nENVIRONMENT\tORIGIN\n")
+	for _, e := range p.Env {
+		fmt.Fprintf(tw, "%s=%s\t%s\n", e.Name, e.Value, e.Origin)
+	}
+	if len(p.UnsetEnv) > 0 {
+		fmt.Fprintf(tw, "Unset by --unset-env:\t%s\n", strings.Join(p.UnsetEnv, ", "))
+	}
+
+	if len(p.NvCCLI) > 0 {
+		fmt.Fprintf(tw, "\nnvidia-container-cli:\t%s\n", strings.Join(p.NvCCLI, " "))
+	}
+
+	if p.Cgroups != nil {
+		b, err := json.Marshal(p.Cgroups)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "\nCgroups:\t%s\n", b)
+	}
+	if p.JobCgroup != "" {
+		if p.Cgroups == nil {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "Job cgroup:\t%s\n", p.JobCgroup)
+	}
+
+	s := p.Security
+	fmt.Fprintf(tw, "\nSECURITY\n")
+	fmt.Fprintf(tw, "Setuid workflow:\t%t\n", s.Setuid)
+	fmt.Fprintf(tw, "Fakeroot:\t%t\n", s.Fakeroot)
+	if s.TargetUID != 0 || len(s.TargetGID) > 0 {
+		fmt.Fprintf(tw, "Target UID/GID:\t%d/%v\n", s.TargetUID, s.TargetGID)
+	}
+	fmt.Fprintf(tw, "Umask:\t%s\n", s.Umask)
+	groups := "none"
+	if len(s.Groups) > 0 {
+		groups = strings.Trim(fmt.Sprint(s.Groups), "[]")
+	}
+	fmt.Fprintf(tw, "Supplementary groups:\t%s\n", groups)
+	fmt.Fprintf(tw, "Add capabilities:\t%s\n", s.AddCaps)
+	fmt.Fprintf(tw, "Drop capabilities:\t%s\n", s.DropCaps)
+	fmt.Fprintf(tw, "Keep privileges:\t%t\n", s.KeepPrivs)
+	fmt.Fprintf(tw, "No privileges:\t%t\n", s.NoPrivs)
+	fmt.Fprintf(tw, "Allow setuid:\t%t\n", s.AllowSUID)
+	fmt.Fprintf(tw, "No new privileges:\t%t\n", s.NoNewPrivileges)
+	if len(s.Options) > 0 {
+		fmt.Fprintf(tw, "Security options:\t%s\n", strings.Join(s.Options, ", "))
+	}
+
+	return tw.Flush()
+}
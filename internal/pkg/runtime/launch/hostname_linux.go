@@ -0,0 +1,89 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launch
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// invalidHostnameChars matches the characters not allowed in a hostname
+// label, replaced in the user name expanded in a hostname pattern.
+var invalidHostnameChars = regexp.MustCompile(`[^A-Za-z0-9-]`)
+
+// setHostname sets the hostname and domainname of the container, from
+// --hostname and --domainname, or the 'container hostname' directive of
+// apptainer.conf forcing the hostname. They require a UTS namespace, which
+// is not created when joining an instance.
+func (l *Launcher) setHostname(instanceName string) error {
+	hostname, domainname := l.cfg.Hostname, l.cfg.Domainname
+	if pattern := l.engineConfig.File.ContainerHostname; pattern != "" {
+		forced, err := expandHostname(pattern)
+		if err != nil {
+			return fmt.Errorf("while expanding 'container hostname' of apptainer.conf: %w", err)
+		}
+		if hostname != "" && hostname != forced {
+			sylog.Warningf("Ignoring --hostname %s, the hostname %s is set by apptainer.conf", hostname, forced)
+		}
+		hostname = forced
+	}
+	if hostname == "" && domainname == "" {
+		return nil
+	}
+
+	if l.engineConfig.GetInstanceJoin() {
+		if l.cfg.Hostname != "" || domainname != "" {
+			sylog.Warningf("Ignoring --hostname and --domainname, no UTS namespace is created when joining an instance")
+		}
+		return nil
+	}
+
+	// the domainname alone qualifies the hostname of the host, or the
+	// instance name of a booted instance
+	if hostname == "" && l.cfg.Boot && instanceName != "" {
+		hostname = instanceName
+	} else if hostname == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("while getting hostname: %w", err)
+		}
+		hostname, _, _ = strings.Cut(h, ".")
+	}
+	l.cfg.Namespaces.UTS = true
+	l.engineConfig.SetHostname(hostname)
+	l.engineConfig.SetDomainname(domainname)
+	return nil
+}
+
+// expandHostname returns the hostname of the pattern, %u being replaced by
+// the name of the calling user, %h by the short hostname of the host and
+// %% by a percent sign.
+func expandHostname(pattern string) (string, error) {
+	u, err := user.CurrentOriginal()
+	if err != nil {
+		return "", fmt.Errorf("while getting current user: %w", err)
+	}
+	h, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("while getting hostname: %w", err)
+	}
+	h, _, _ = strings.Cut(h, ".")
+
+	r := strings.NewReplacer(
+		"%u", invalidHostnameChars.ReplaceAllString(u.Name, "-"),
+		"%h", h,
+		"%%", "%",
+	)
+	return r.Replace(pattern), nil
+}
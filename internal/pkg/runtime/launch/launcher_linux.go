@@ -14,6 +14,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -28,19 +29,25 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/image/driver"
 	"github.com/apptainer/apptainer/internal/pkg/image/unpacker"
 	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/network/rootless"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci/generate"
+	"github.com/apptainer/apptainer/internal/pkg/runtime/registry"
 	"github.com/apptainer/apptainer/internal/pkg/security"
+	"github.com/apptainer/apptainer/internal/pkg/syecl"
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
 	"github.com/apptainer/apptainer/internal/pkg/util/gpu"
+	"github.com/apptainer/apptainer/internal/pkg/util/nesting"
 	"github.com/apptainer/apptainer/internal/pkg/util/shell/interpreter"
 	"github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
 	"github.com/apptainer/apptainer/pkg/build/types"
 	imgutil "github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/network"
 	clicallback "github.com/apptainer/apptainer/pkg/plugin/callback/cli"
 	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
 	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
@@ -53,6 +60,8 @@ import (
 	"github.com/apptainer/apptainer/pkg/util/fs/proc"
 	"github.com/apptainer/apptainer/pkg/util/namespaces"
 	"github.com/apptainer/apptainer/pkg/util/rlimit"
+	"github.com/apptainer/apptainer/pkg/util/slice"
+	units "github.com/docker/go-units"
 	lccgroups "github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
@@ -97,43 +106,58 @@ func NewLauncher(opts ...Option) (*Launcher, error) {
 func (l *Launcher) Exec(ctx context.Context, image string, args []string, instanceName string) error {
 	var err error
 
+	if l.cfg.DryRunJSON && !l.cfg.DryRun {
+		return fmt.Errorf("--json requires --dry-run")
+	}
+
+	// Select compatible options when running inside another container.
+	if !l.cfg.NoNestingAutodetect {
+		l.adaptToNesting(nesting.Detect())
+	}
+
 	var fakerootPath string
 	if l.cfg.Fakeroot {
-		if (l.uid == 0) && namespaces.IsUnprivileged() {
+		nestedRoot := l.uid == 0 && fakeroot.IsNestedRoot()
+		var nestedErr error
+		if nestedRoot {
+			nestedErr = fakeroot.CheckNested()
+		}
+		if nestedRoot && nestedErr == nil {
+			// The engine maps the ids available in the current
+			// user namespace to themselves in a nested one
+			sylog.Infof("Running as root in a user namespace, using a nested user namespace")
+		} else if nestedRoot {
+			sylog.Infof("Could not use a nested user namespace (%v), reusing the current one", nestedErr)
 			// Already running root-mapped unprivileged
 			l.cfg.Fakeroot = false
 			l.cfg.Namespaces.User = true
 			sylog.Debugf("running root-mapped unprivileged")
 			var err error
-			if l.cfg.IgnoreFakerootCmd {
-				err = errors.New("fakeroot command is ignored because of --ignore-fakeroot-command")
-			} else {
-				fakerootPath, err = fakeroot.FindFake()
-			}
+			fakerootPath, err = fakeroot.FindFakeCommand(l.cfg.IgnoreFakerootCmd)
 			if err != nil {
 				sylog.Infof("fakeroot command not found, using only root-mapped namespace")
 			} else {
 				sylog.Infof("Using fakeroot command combined with root-mapped namespace")
 			}
-		} else if (l.uid != 0) && (!fakeroot.IsUIDMapped(l.uid) || l.cfg.IgnoreSubuid) {
+		} else if !fakeroot.UseSubuid(l.uid, l.cfg.IgnoreSubuid) {
 			sylog.Infof("User not listed in %v, trying root-mapped namespace", fakeroot.SubUIDFile)
 			l.cfg.Fakeroot = false
 			var err error
 			if l.cfg.IgnoreUserns {
 				err = errors.New("could not start root-mapped namespace because --ignore-userns is set")
 			} else {
+				if l.cfg.DeleteImageDir != "" {
+					os.Setenv(DeleteImageDirEnv, l.cfg.DeleteImageDir)
+				}
 				err = fakeroot.UnshareRootMapped(os.Args, false)
+				os.Unsetenv(DeleteImageDirEnv)
 			}
 			if err == nil {
 				// All good
 				os.Exit(0)
 			}
 			sylog.Debugf("UnshareRootMapped failed: %v", err)
-			if l.cfg.IgnoreFakerootCmd {
-				err = errors.New("fakeroot command is ignored because of --ignore-fakeroot-command")
-			} else {
-				fakerootPath, err = fakeroot.FindFake()
-			}
+			fakerootPath, err = fakeroot.FindFakeCommand(l.cfg.IgnoreFakerootCmd)
 			if err != nil {
 				sylog.Fatalf("--fakeroot requires either being in %v, unprivileged user namespaces, or the fakeroot command", fakeroot.SubUIDFile)
 			}
@@ -167,7 +191,9 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 	}
 
 	// Set container Umask w.r.t. our own, before any umask manipulation happens.
-	l.setUmask()
+	if err := l.setUmask(); err != nil {
+		return err
+	}
 
 	insideUserNs, _ := namespaces.IsInsideUserNamespace(os.Getpid())
 
@@ -182,6 +208,9 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 	if err != nil {
 		sylog.Fatalf("Could not configure target UID/GID: %s", err)
 	}
+	if err := l.setGroups(useSuid); err != nil {
+		return fmt.Errorf("while setting supplementary groups: %w", err)
+	}
 
 	// Set image to run, or instance to join, and APPTAINER_CONTAINER/APPTAINER_NAME env vars.
 	if err := l.setImageOrInstance(image, instanceName); err != nil {
@@ -195,12 +224,12 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 	// Prefer underlay for bind
 	l.engineConfig.SetUnderlay(l.cfg.Underlay)
 
-	// Check key is available for encrypted image, if applicable.
+	// Check image architecture and key availability for encrypted image, if applicable.
 	// If we are joining an instance, then any encrypted image is already mounted.
 	if !l.engineConfig.GetInstanceJoin() {
-		err = l.checkEncryptionKey()
+		err = l.checkImage()
 		if err != nil {
-			sylog.Fatalf("While checking container encryption: %s", err)
+			sylog.Fatalf("While checking container image: %s", err)
 		}
 	}
 
@@ -214,6 +243,29 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 		l.generator.AddProcessRlimits("RLIMIT_STACK", hard, soft)
 	}
 
+	// Bind the readiness notification socket of an instance.
+	if instanceName != "" && l.cfg.NotifyDir != "" {
+		l.cfg.BindPaths = append(l.cfg.BindPaths, l.cfg.NotifyDir+":"+instance.NotifyMountDir)
+		if l.cfg.Env == nil {
+			l.cfg.Env = make(map[string]string)
+		}
+		l.cfg.Env[instance.NotifySocketEnv] = instance.NotifySocketPath
+	}
+
+	// Bind the sockets directory of the instance, and of the joined one.
+	if err := l.setSocketsBinds(instanceName); err != nil {
+		sylog.Fatalf("While setting instance sockets directory: %s", err)
+	}
+
+	// Bind the host credentials requested with --security-credentials.
+	if err := l.setCredentialBinds(); err != nil {
+		sylog.Fatalf("While setting security credentials: %s", err)
+	}
+
+	if err := l.setFakerootDB(image, fakerootPath); err != nil {
+		sylog.Fatalf("While setting fakeroot database: %s", err)
+	}
+
 	// Handle requested binds, fuse mounts.
 	if err := l.setBinds(fakerootPath); err != nil {
 		sylog.Fatalf("While setting bind mount configuration: %s", err)
@@ -249,6 +301,11 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 		l.engineConfig.SetWritableTmpfs(l.cfg.WritableTmpfs)
 	}
 
+	// Read-only root with writable paths requested, or enforced by configuration?
+	if err := l.setReadOnlyRoot(); err != nil {
+		return fmt.Errorf("while setting read-only root: %w", err)
+	}
+
 	// Additional user requested library binds into /.singularity.d/libs.
 	l.engineConfig.AppendLibrariesPath(l.cfg.ContainLibs...)
 
@@ -257,15 +314,63 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 	l.engineConfig.SetWorkdir(l.cfg.WorkDir)
 	l.engineConfig.SetConfigDir(syfs.ConfigDir())
 
+	// Session directory backing and size.
+	if l.cfg.SessionDirSize < 0 {
+		return fmt.Errorf("invalid session directory size %d MiB", l.cfg.SessionDirSize)
+	}
+	l.engineConfig.SetSessionDirSize(l.cfg.SessionDirSize)
+
+	if l.cfg.SquashfuseThreads < 0 {
+		return fmt.Errorf("invalid number of squashfuse threads %d", l.cfg.SquashfuseThreads)
+	}
+	l.engineConfig.SetSquashfuseThreads(l.cfg.SquashfuseThreads)
+	if l.cfg.SessionDir != "" {
+		sessionDir, err := filepath.Abs(l.cfg.SessionDir)
+		if err != nil {
+			return fmt.Errorf("while resolving session directory %s: %s", l.cfg.SessionDir, err)
+		}
+		l.engineConfig.SetSessionDir(sessionDir)
+	}
+
 	// Container networking configuration.
 	l.engineConfig.SetNetwork(l.cfg.Network)
 	l.engineConfig.SetDNS(l.cfg.DNS)
+	l.engineConfig.SetDNSSearch(l.cfg.DNSSearch, l.cfg.DNSOptions)
+
+	// Container timezone, from --tz or the 'mount localtime' directive.
+	tz := l.cfg.Timezone
+	if tz == "" && l.engineConfig.File.MountLocaltime {
+		tz = files.TimezoneHost
+	}
+	if tz != "" {
+		zone, err := files.ResolveTimezone(tz)
+		if err != nil {
+			return fmt.Errorf("while setting container timezone: %w", err)
+		}
+		l.engineConfig.SetTimezone(zone)
+	}
 	l.engineConfig.SetNetworkArgs(l.cfg.NetworkArgs)
+	if l.cfg.NetworkArgsFile != "" {
+		args, err := network.ReadCapabilityArgs(l.cfg.NetworkArgsFile)
+		if err != nil {
+			return fmt.Errorf("while reading --network-args-file: %w", err)
+		}
+		l.engineConfig.SetNetworkCapabilityArgs(args)
+	}
+	publish := make([]string, 0, len(l.cfg.Publish))
+	for _, p := range l.cfg.Publish {
+		pm, err := network.ParsePublish(p)
+		if err != nil {
+			return fmt.Errorf("while parsing --publish: %w", err)
+		}
+		publish = append(publish, pm.String())
+	}
+	l.engineConfig.SetPublishPorts(publish)
+	l.engineConfig.SetNoLoopback(l.cfg.NoLoopback)
 
 	// If user wants to set a hostname, it requires the UTS namespace.
-	if l.cfg.Hostname != "" {
-		l.cfg.Namespaces.UTS = true
-		l.engineConfig.SetHostname(l.cfg.Hostname)
+	if err := l.setHostname(instanceName); err != nil {
+		return err
 	}
 
 	// Set requested capabilities (effective for root, or if sysadmin has permitted to another user).
@@ -313,7 +418,9 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 		l.cfg.Namespaces.User = !l.cfg.IgnoreUserns
 	}
 
-	l.setCgroups(instanceName)
+	if err := l.setCgroups(instanceName); err != nil {
+		return fmt.Errorf("while setting cgroups configuration: %w", err)
+	}
 
 	// --boot flag requires privilege, so check for this.
 	err = withPrivilege(l.uid, l.cfg.Boot, "--boot", func() error { return nil })
@@ -338,6 +445,26 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 		l.cfg.Namespaces.PID = true
 		l.engineConfig.SetInstance(true)
 		l.engineConfig.SetBootInstance(l.cfg.Boot)
+		l.engineConfig.SetInstanceScript(l.cfg.InstanceScript)
+
+		maxSize := l.cfg.InstanceLogMaxSize
+		if maxSize < 0 {
+			maxSize = int64(l.engineConfig.File.InstanceLogMaxSize) * 1024 * 1024
+		}
+		if l.cfg.InstanceLogMaxFiles < 0 {
+			return fmt.Errorf("invalid number of instance log files %d", l.cfg.InstanceLogMaxFiles)
+		}
+		l.engineConfig.SetInstanceLogRotation(maxSize, l.cfg.InstanceLogMaxFiles)
+
+		if l.cfg.InstanceIP != "" && net.ParseIP(l.cfg.InstanceIP) == nil {
+			return fmt.Errorf("--ip %s is not an IP address", l.cfg.InstanceIP)
+		}
+		if l.cfg.InstanceMAC != "" {
+			if _, err := net.ParseMAC(l.cfg.InstanceMAC); err != nil {
+				return fmt.Errorf("--mac %s is not a hardware address: %s", l.cfg.InstanceMAC, err)
+			}
+		}
+		l.engineConfig.SetInstanceAddress(l.cfg.InstanceIP, l.cfg.InstanceMAC)
 
 		if useSuid && !l.cfg.Namespaces.User && hidepidProc() {
 			return fmt.Errorf("hidepid option set on /proc mount, require 'hidepid=0' to start instance with setuid workflow")
@@ -351,7 +478,7 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 		if l.cfg.Boot {
 			l.cfg.Namespaces.UTS = true
 			l.cfg.Namespaces.Net = true
-			if l.cfg.Hostname == "" {
+			if l.engineConfig.GetHostname() == "" {
 				l.engineConfig.SetHostname(instanceName)
 			}
 			if !l.cfg.KeepPrivs {
@@ -361,10 +488,18 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 		}
 	}
 
+	if err := l.setPty(instanceName); err != nil {
+		return err
+	}
+
 	// Set the required namespaces in the engine config.
 	l.setNamespaces()
+	// Set the time namespace and the realtime clock offset.
+	if err := l.setTime(); err != nil {
+		return err
+	}
 	// Set the container environment.
-	if err := l.setEnvVars(ctx, args); err != nil {
+	if err := l.setEnvVars(ctx, args, useSuid); err != nil {
 		return fmt.Errorf("while setting environment: %s", err)
 	}
 	// Set the container process work directory.
@@ -372,11 +507,23 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 
 	l.generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "APPNAME", l.cfg.AppName)
 
+	// Allow any plugins with callbacks to mutate the bind mounts,
+	// environment and namespaces of the container.
+	if err := l.runLaunchCallbacks(image); err != nil {
+		return err
+	}
+
 	// Get image ready to run, if needed, via FUSE mount / extraction / image driver handling.
-	if err := l.prepareImage(ctx, insideUserNs, image); err != nil {
+	if err := l.prepareImage(ctx, insideUserNs, useSuid, image); err != nil {
 		return fmt.Errorf("while preparing image: %s", err)
 	}
 
+	// With --dry-run, print the planned configuration and stop before the
+	// starter is called.
+	if l.cfg.DryRun {
+		return l.dryRun(os.Stdout, instanceName, useSuid)
+	}
+
 	loadOverlay := false
 	if !l.cfg.Namespaces.User && (buildcfg.APPTAINER_SUID_INSTALL == 1 || os.Getuid() == 0) {
 		has, err := proc.HasFilesystem("overlay")
@@ -399,7 +546,18 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 
 	// Call the starter binary using our prepared config.
 	if l.engineConfig.GetInstance() {
+		socketsDir, _ := l.engineConfig.GetInstanceSockets()
+		if socketsDir != "" {
+			if _, err := instance.CreateSocketsDir(instanceName); err != nil {
+				return err
+			}
+		}
 		err = l.starterInstance(loadOverlay, insideUserNs, instanceName, useSuid, cfg)
+		if err != nil && socketsDir != "" {
+			os.RemoveAll(socketsDir)
+		}
+	} else if l.engineConfig.GetPty() {
+		err = l.starterPty(loadOverlay, useSuid, cfg)
 	} else {
 		err = l.starterInteractive(loadOverlay, useSuid, cfg)
 	}
@@ -411,16 +569,86 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 	return nil
 }
 
-// setUmask saves the current umask, to be set for the process run in the container,
-// unless the --no-umask option was specified.
+// setUmask sets the umask of the process run in the container: the umask
+// of --umask, the default 0022 with --no-umask, the 'container umask' of
+// apptainer.conf, or else the current umask.
 // https://github.com/apptainer/singularity/issues/5214
-func (l *Launcher) setUmask() {
+func (l *Launcher) setUmask() error {
 	currMask := syscall.Umask(0o022)
-	if !l.cfg.NoUmask {
+	mask, origin := l.cfg.Umask, "--umask"
+	if mask == "" && !l.cfg.NoUmask {
+		mask, origin = l.engineConfig.File.ContainerUmask, "'container umask' in apptainer.conf"
+	}
+	if mask != "" {
+		m, err := strconv.ParseUint(mask, 8, 32)
+		if err != nil || m > 0o777 {
+			return fmt.Errorf("invalid umask %q from %s, an octal number up to 0777 is expected", mask, origin)
+		}
+		sylog.Debugf("Setting umask %04o from %s for the container", m, origin)
+		l.engineConfig.SetUmask(int(m))
+		l.engineConfig.SetRestoreUmask(true)
+	} else if !l.cfg.NoUmask {
 		sylog.Debugf("Saving umask %04o for propagation into container", currMask)
 		l.engineConfig.SetUmask(currMask)
 		l.engineConfig.SetRestoreUmask(true)
 	}
+	return nil
+}
+
+// setGroups selects the supplementary groups of the container process from
+// --groups, or else the 'container groups' directive. Only root can add
+// groups, the groups of --groups the user doesn't have are refused while
+// those of the directive are ignored. The groups can't be dropped in an
+// unprivileged user namespace, where the directive is ignored too.
+func (l *Launcher) setGroups(useSuid bool) error {
+	spec, fromConf := l.cfg.Groups, false
+	if spec == "" {
+		spec, fromConf = l.engineConfig.File.ContainerGroups, true
+	}
+	if spec == "" || spec == "keep" {
+		return nil
+	}
+
+	isRoot := os.Getuid() == 0
+	if l.cfg.Fakeroot || l.cfg.Namespaces.User || (!isRoot && !useSuid) {
+		if fromConf {
+			sylog.Debugf("Ignoring 'container groups = %s' in an unprivileged user namespace", spec)
+			return nil
+		}
+		return fmt.Errorf("--groups requires the setuid workflow, the supplementary groups can't be dropped in an unprivileged user namespace")
+	}
+
+	gids := []int{}
+	if spec == "none" {
+		l.engineConfig.SetGroups(gids)
+		return nil
+	}
+	userGroups, err := os.Getgroups()
+	if err != nil {
+		return err
+	}
+	userGroups = append(userGroups, os.Getgid())
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		var gid int
+		if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+			gid = int(id)
+		} else if gr, err := user.GetGrNam(name); err == nil {
+			gid = int(gr.GID)
+		} else {
+			return fmt.Errorf("unknown group %q: %w", name, err)
+		}
+		if !isRoot && !slice.ContainsInt(userGroups, gid) {
+			if fromConf {
+				sylog.Debugf("Ignoring group %s of 'container groups', not a group of the user", name)
+				continue
+			}
+			return fmt.Errorf("group %s is not a group of the user, only root can add groups", name)
+		}
+		gids = append(gids, gid)
+	}
+	l.engineConfig.SetGroups(gids)
+	return nil
 }
 
 // setTargetIDs sets engine configuration for any requested target UID and GID
@@ -480,6 +708,47 @@ func (l *Launcher) setTargetIDs(useSuid bool) (err error) {
 	return nil
 }
 
+// setSocketsBinds adds the binds of the sockets directory of a starting
+// instance, and of the instance joined with --join-sockets, whose
+// sockets directory is created before the instance is started.
+func (l *Launcher) setSocketsBinds(instanceName string) error {
+	if l.cfg.JoinSockets != "" {
+		if l.engineConfig.GetInstanceJoin() {
+			return fmt.Errorf("--join-sockets can't be used when joining an instance")
+		}
+		file, err := instance.Get(l.cfg.JoinSockets, instance.AppSubDir)
+		if err != nil {
+			return fmt.Errorf("could not find instance %s: %w", l.cfg.JoinSockets, err)
+		}
+		if file.SocketsDir == "" {
+			return fmt.Errorf("instance %s has no sockets directory", l.cfg.JoinSockets)
+		}
+		if instanceName != "" && file.SocketsMount == l.cfg.SocketsPath {
+			return fmt.Errorf("sockets directory of instance %s is bound at %s, set a different --sockets-path", l.cfg.JoinSockets, file.SocketsMount)
+		}
+		l.cfg.BindPaths = append(l.cfg.BindPaths, file.SocketsDir+":"+file.SocketsMount+":rw")
+		l.socketsBinds = map[string]string{file.SocketsDir: "flag: --join-sockets"}
+	}
+
+	if instanceName == "" || l.cfg.SocketsPath == "" {
+		return nil
+	}
+	if !filepath.IsAbs(l.cfg.SocketsPath) {
+		return fmt.Errorf("sockets path %s must be an absolute path", l.cfg.SocketsPath)
+	}
+	dir, err := instance.SocketsDir(instanceName)
+	if err != nil {
+		return err
+	}
+	l.engineConfig.SetInstanceSockets(dir, l.cfg.SocketsPath)
+	l.cfg.BindPaths = append(l.cfg.BindPaths, dir+":"+l.cfg.SocketsPath)
+	if l.socketsBinds == nil {
+		l.socketsBinds = make(map[string]string)
+	}
+	l.socketsBinds[dir] = "flag: --sockets-path"
+	return nil
+}
+
 // setImageOrInstance sets the image to start, or instance and it's image to be joined.
 func (l *Launcher) setImageOrInstance(image string, name string) error {
 	if strings.HasPrefix(image, "instance://") {
@@ -500,8 +769,19 @@ func (l *Launcher) setImageOrInstance(image string, name string) error {
 
 		// If we are running non-root, join the instance cgroup now, as we
 		// can't manipulate the ppid cgroup in the engine prepareInstanceJoinConfig().
-		// This flow is only applicable with the systemd cgroups manager.
-		if file.Cgroup && l.uid != 0 {
+		// An instance cgroup beneath a delegated job cgroup can be joined
+		// directly, as the job cgroup is a common user-owned ancestor.
+		// Otherwise this flow is only applicable with the systemd cgroups manager.
+		if file.Cgroup && file.JobCgroup && l.uid != 0 {
+			sylog.Debugf("Moving process %d to instance cgroup beneath job cgroup", os.Getpid())
+			manager, err := cgroups.GetManagerForPid(file.Pid)
+			if err != nil {
+				return fmt.Errorf("couldn't create cgroup manager: %w", err)
+			}
+			if err := manager.AddProc(os.Getpid()); err != nil {
+				return fmt.Errorf("couldn't add process to instance cgroup: %w", err)
+			}
+		} else if file.Cgroup && l.uid != 0 {
 			if !l.engineConfig.File.SystemdCgroups {
 				return fmt.Errorf("joining non-root instance with cgroups requires systemd as cgroups manager")
 			}
@@ -540,24 +820,38 @@ func (l *Launcher) setImageOrInstance(image string, name string) error {
 			return fmt.Errorf("failed to determine image absolute path for %s: %w", image, err)
 		}
 		l.engineConfig.SetImage(abspath)
+		l.engineConfig.SetDeleteImageDir(l.cfg.DeleteImageDir)
 	}
 	return nil
 }
 
-// checkEncryptionKey verifies key material is available if the image is encrypted.
-// Allows us to fail fast if required key material is not available / usable.
-func (l *Launcher) checkEncryptionKey() error {
-	sylog.Debugf("Checking for encrypted system partition")
+// checkImage opens the image once to check its architecture and the key
+// material of an encrypted image, and keeps its root filesystem partition
+// for the image preparation. Loading the SIF descriptors is the costly part
+// of opening an image, so it's not done again for each check.
+func (l *Launcher) checkImage() error {
 	img, err := imgutil.Init(l.engineConfig.GetImage(), false)
 	if err != nil {
 		return fmt.Errorf("could not open image %s: %w", l.engineConfig.GetImage(), err)
 	}
+	defer img.File.Close()
+
+	checkImageArch(img)
 
 	part, err := img.GetRootFsPartition()
 	if err != nil {
 		return fmt.Errorf("while getting root filesystem in %s: %w", l.engineConfig.GetImage(), err)
 	}
+	l.rootfs = part
+
+	return l.checkEncryptionKey(part)
+}
 
+// checkEncryptionKey verifies key material is available if the root filesystem
+// partition is encrypted. Allows us to fail fast if required key material is
+// not available / usable.
+func (l *Launcher) checkEncryptionKey(part *imgutil.Section) error {
+	sylog.Debugf("Checking for encrypted system partition")
 	if part.Type == imgutil.ENCRYPTSQUASHFS || part.Type == imgutil.GOCRYPTFSSQUASHFS {
 		sylog.Debugf("Encrypted container filesystem detected")
 
@@ -573,10 +867,6 @@ func (l *Launcher) checkEncryptionKey() error {
 
 		l.engineConfig.SetEncryptionKey(plaintextKey)
 	}
-	// don't defer this call as in all cases it won't be
-	// called before execing starter, so it would leak the
-	// image file descriptor to the container process
-	img.File.Close()
 	return nil
 }
 
@@ -631,13 +921,34 @@ func (l *Launcher) setBinds(fakerootPath string) error {
 	}
 	// Now add binds from one or more --mount and env var.
 	// Note that these do not get exported for nested containers
+	var fsMounts []apptainerConfig.FSMount
 	for _, m := range l.cfg.Mounts {
-		bps, err := apptainerConfig.ParseMountString(m)
+		bps, fms, err := apptainerConfig.ParseMounts(m)
 		if err != nil {
 			return fmt.Errorf("while parsing mount %q: %w", m, err)
 		}
 		binds = append(binds, bps...)
+		fsMounts = append(fsMounts, fms...)
+	}
+	// --shm-size is a shorthand for a tmpfs mount on /dev/shm
+	if l.cfg.ShmSize != "" {
+		for _, m := range fsMounts {
+			if m.Destination == "/dev/shm" {
+				return fmt.Errorf("--shm-size conflicts with the mount of /dev/shm requested with --mount")
+			}
+		}
+		size, err := units.RAMInBytes(l.cfg.ShmSize)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("invalid --shm-size %q", l.cfg.ShmSize)
+		}
+		fsMounts = append(fsMounts, apptainerConfig.FSMount{
+			Type:        apptainerConfig.FSTypeTmpfs,
+			Destination: "/dev/shm",
+			Size:        size,
+			Mode:        "1777",
+		})
 	}
+	l.engineConfig.SetFSMounts(fsMounts)
 
 	if fakerootPath != "" {
 		l.engineConfig.SetFakerootPath(fakerootPath)
@@ -664,6 +975,34 @@ func (l *Launcher) setBinds(fakerootPath string) error {
 	return nil
 }
 
+// setFakerootDB prunes the database of the fakeroot command given with
+// --fakeroot-db and binds it in the container, when the fakeroot command
+// is used with a sandbox image.
+func (l *Launcher) setFakerootDB(image, fakerootPath string) error {
+	if l.cfg.FakerootDB == "" {
+		return nil
+	}
+	if fakerootPath == "" {
+		sylog.Warningf("--fakeroot-db is only used with --fakeroot when the fakeroot command is used, ignoring it")
+		return nil
+	}
+	if fi, err := os.Stat(image); err != nil || !fi.IsDir() {
+		sylog.Warningf("--fakeroot-db is only used with sandbox images, ignoring it")
+		return nil
+	}
+
+	db, err := filepath.Abs(l.cfg.FakerootDB)
+	if err != nil {
+		return fmt.Errorf("while getting absolute path of %s: %w", l.cfg.FakerootDB, err)
+	}
+	if err := fakeroot.PrepareFakeDB(db, image); err != nil {
+		return err
+	}
+	l.engineConfig.SetFakerootDB(db)
+	l.cfg.BindPaths = append(l.cfg.BindPaths, db+":"+fakeroot.FakeDB)
+	return nil
+}
+
 // setFuseMounts sets engine configuration for requested FUSE mounts.
 func (l *Launcher) setFuseMounts() error {
 	if len(l.cfg.FuseMount) > 0 {
@@ -780,6 +1119,10 @@ func (l *Launcher) SetGPUConfig() error {
 		l.cfg.Nvidia = true
 	}
 
+	if !l.cfg.Nvidia && (l.cfg.GPUs != "" || l.cfg.NvCaps != "") {
+		sylog.Warningf("--gpus and --nv-caps have no effect without --nv or --nvccli")
+	}
+
 	if l.cfg.Rocm {
 		err := l.setRocmConfig()
 		// This is currently unnecessary, but useful for not missing future errors
@@ -807,15 +1150,17 @@ func (l *Launcher) SetGPUConfig() error {
 
 // setNvCCLIConfig sets up EngineConfig entries for NVIDIA GPU configuration via nvidia-container-cli.
 func (l *Launcher) setNvCCLIConfig() (err error) {
-	sylog.Debugf("Using nvidia-container-cli for GPU setup")
-	l.engineConfig.SetNvCCLI(true)
+	if err := l.setNvSelection(); err != nil {
+		return err
+	}
 
+	contained := l.cfg.Contain || l.cfg.ContainAll
 	if os.Getenv("NVIDIA_VISIBLE_DEVICES") == "" {
-		if l.cfg.Contain || l.cfg.ContainAll {
+		if contained {
 			// When we use --contain we don't mount the NV devices by default in the nvidia-container-cli flow,
-			// they must be mounted via specifying with`NVIDIA_VISIBLE_DEVICES`. This differs from the legacy
+			// they must be selected with --gpus or `NVIDIA_VISIBLE_DEVICES`. This differs from the legacy
 			// flow which mounts all GPU devices, always... so warn the user.
-			sylog.Warningf("When using nvidia-container-cli with --contain NVIDIA_VISIBLE_DEVICES must be set or no GPUs will be available in container.")
+			sylog.Warningf("When using nvidia-container-cli with --contain --gpus or NVIDIA_VISIBLE_DEVICES must be set or no GPUs will be available in container.")
 		} else {
 			// In non-contained mode set NVIDIA_VISIBLE_DEVICES="all" by default, so MIGs are available.
 			// Otherwise there is a difference vs legacy GPU binding. See Issue sylabs/singularity#471.
@@ -831,6 +1176,21 @@ func (l *Launcher) setNvCCLIConfig() (err error) {
 			nvCCLIEnv = append(nvCCLIEnv, e)
 		}
 	}
+
+	// A CDI specification generated by nvidia-ctk lists the driver files and
+	// devices, which are then bound without calling nvidia-container-cli.
+	if spec := gpu.FindCDISpec(gpu.NvidiaCDIKind); spec != nil {
+		return l.setNvCDIConfig(spec, os.Getenv("NVIDIA_VISIBLE_DEVICES"))
+	}
+	// With --contain the files and devices listed by nvidia-container-cli
+	// are bound explicitly, rather than mounted from the host filesystem
+	// into the container by the configure operation.
+	if contained {
+		return l.setNvCCLIListConfig(nvCCLIEnv)
+	}
+
+	sylog.Debugf("Using nvidia-container-cli for GPU setup")
+	l.engineConfig.SetNvCCLI(true)
 	l.engineConfig.SetNvCCLIEnv(nvCCLIEnv)
 
 	if !l.cfg.Writable && !l.cfg.WritableTmpfs {
@@ -841,17 +1201,143 @@ func (l *Launcher) setNvCCLIConfig() (err error) {
 	return nil
 }
 
+// setNvSelection applies --gpus and --nv-caps to the NVIDIA_ env vars read
+// by nvidia-container-cli, which are also set in the container as with the
+// NVIDIA container runtime.
+func (l *Launcher) setNvSelection() error {
+	if l.cfg.GPUs != "" {
+		devices, err := gpu.ParseGPUs(l.cfg.GPUs)
+		if err != nil {
+			return fmt.Errorf("invalid --gpus: %w", err)
+		}
+		os.Setenv("NVIDIA_VISIBLE_DEVICES", devices)
+	}
+	if l.cfg.NvCaps != "" {
+		caps, err := gpu.ParseNvCaps(l.cfg.NvCaps)
+		if err != nil {
+			return fmt.Errorf("invalid --nv-caps: %w", err)
+		}
+		os.Setenv("NVIDIA_DRIVER_CAPABILITIES", caps)
+	}
+	return nil
+}
+
+// setNvCCLIListConfig sets up EngineConfig entries to bind the files and
+// devices listed by nvidia-container-cli for the selected GPUs.
+func (l *Launcher) setNvCCLIListConfig(nvCCLIEnv []string) error {
+	sylog.Debugf("Using files listed by nvidia-container-cli for GPU setup")
+	files, err := gpu.NVCLIList(nvCCLIEnv)
+	if err != nil {
+		return err
+	}
+	l.addGPUBinds(files.Libraries, files.Binaries, files.Files, "nvccli")
+	l.addGPUDevices(files.Devices, "flag: --nvccli")
+	return nil
+}
+
+// setNvCDIConfig sets up EngineConfig entries to bind the files and devices
+// of the selected GPUs described by a CDI specification. Libraries are bound
+// into /.singularity.d/libs like the legacy binds, the hooks updating the
+// ld cache of the container are then not needed and aren't run.
+func (l *Launcher) setNvCDIConfig(spec *gpu.CDISpec, devices string) error {
+	sylog.Debugf("Using CDI specification %s for GPU setup", spec.Path)
+	edits, err := spec.Edits(devices)
+	if err != nil {
+		return err
+	}
+	origin := "cdi: " + spec.Path
+
+	if l.gpuFiles == nil {
+		l.gpuFiles = make(map[string]string)
+	}
+	for _, m := range edits.Mounts {
+		if _, ok := l.gpuFiles[m.HostPath]; ok {
+			continue
+		}
+		l.gpuFiles[m.HostPath] = origin
+		if strings.Contains(filepath.Base(m.HostPath), ".so") {
+			l.engineConfig.AppendLibrariesPath(m.HostPath)
+			continue
+		}
+		dst := m.ContainerPath
+		if dst == "" {
+			dst = m.HostPath
+		}
+		l.engineConfig.AppendFilesPath(m.HostPath + ":" + dst)
+	}
+
+	devs := make([]string, 0, len(edits.DeviceNodes))
+	for _, d := range edits.DeviceNodes {
+		devs = append(devs, d.HostDevice())
+	}
+	l.addGPUDevices(devs, origin)
+
+	for _, e := range edits.Env {
+		k, v, _ := strings.Cut(e, "=")
+		l.setGPUEnv(k, v, origin)
+	}
+	for _, h := range edits.Hooks {
+		sylog.Debugf("Not running %s hook %s %v of %s", h.HookName, h.Path, h.Args, spec.Path)
+	}
+	return nil
+}
+
+// addGPUDevices adds the GPU devices to bind into a staged /dev, once.
+func (l *Launcher) addGPUDevices(devs []string, origin string) {
+	current := l.engineConfig.GetGPUDevices()
+	for _, dev := range devs {
+		if slice.ContainsString(current, dev) {
+			continue
+		}
+		current = append(current, dev)
+		if l.gpuFiles == nil {
+			l.gpuFiles = make(map[string]string)
+		}
+		l.gpuFiles[dev] = origin
+	}
+	l.engineConfig.SetGPUDevices(current)
+}
+
+// setGPUEnv sets a variable in the container for the GPU setup, unless set
+// with --env, --env-file or APPTAINERENV_.
+func (l *Launcher) setGPUEnv(key, value, origin string) {
+	if l.gpuEnv == nil {
+		l.gpuEnv = make(map[string]originEnvVar)
+	}
+	l.gpuEnv[key] = originEnvVar{value: value, origin: origin}
+}
+
 // setNvLegacyConfig sets up EngineConfig entries for NVIDIA GPU configuration via direct binds of configured bins/libs.
 func (l *Launcher) setNVLegacyConfig() error {
 	sylog.Debugf("Using legacy binds for nv GPU setup")
 	l.engineConfig.SetNvLegacy(true)
+	if l.cfg.GPUs != "" {
+		devices, err := gpu.ParseGPUs(l.cfg.GPUs)
+		if err != nil {
+			return fmt.Errorf("invalid --gpus: %w", err)
+		}
+		if strings.Contains(devices, ":") {
+			return fmt.Errorf("MIG devices can only be selected with --nvccli")
+		}
+		// all the devices are still bound, CUDA only uses the selected ones
+		switch devices {
+		case "all":
+		case "none":
+			l.setGPUEnv("CUDA_VISIBLE_DEVICES", "", "flag: --gpus")
+		default:
+			l.setGPUEnv("CUDA_VISIBLE_DEVICES", devices, "flag: --gpus")
+		}
+	}
+	if l.cfg.NvCaps != "" {
+		sylog.Warningf("--nv-caps requires nvidia-container-cli (--nvccli), ignoring")
+	}
 	gpuConfFile := filepath.Join(buildcfg.APPTAINER_CONFDIR, "nvliblist.conf")
 	// bind persistenced socket if found
 	ipcs, err := gpu.NvidiaIpcsPath()
 	if err != nil {
 		sylog.Warningf("While finding nv ipcs: %v", err)
 	}
-	libs, bins, err := gpu.NvidiaPaths(gpuConfFile)
+	libs, bins, err := gpu.NvidiaPaths(gpuConfFile, l.cfg.GPUCacheDir)
 	if err != nil {
 		sylog.Warningf("While finding nv bind points: %v", err)
 	}
@@ -864,7 +1350,7 @@ func (l *Launcher) setRocmConfig() error {
 	sylog.Debugf("Using rocm GPU setup")
 	l.engineConfig.SetRocm(true)
 	gpuConfFile := filepath.Join(buildcfg.APPTAINER_CONFDIR, "rocmliblist.conf")
-	libs, bins, err := gpu.RocmPaths(gpuConfFile)
+	libs, bins, err := gpu.RocmPaths(gpuConfFile, l.cfg.GPUCacheDir)
 	if err != nil {
 		sylog.Warningf("While finding ROCm bind points: %v", err)
 	}
@@ -874,6 +1360,15 @@ func (l *Launcher) setRocmConfig() error {
 
 // addGPUBinds adds EngineConfig entries to bind the provided list of libs, bins, ipc files.
 func (l *Launcher) addGPUBinds(libs, bins, ipcs []string, gpuPlatform string) {
+	if l.gpuFiles == nil {
+		l.gpuFiles = make(map[string]string)
+	}
+	for _, list := range [][]string{libs, bins, ipcs} {
+		for _, f := range list {
+			l.gpuFiles[f] = "flag: --" + gpuPlatform
+		}
+	}
+
 	files := make([]string, len(bins)+len(ipcs))
 	if len(files) == 0 {
 		sylog.Warningf("Could not find any %s files on this host!", gpuPlatform)
@@ -907,24 +1402,41 @@ func (l *Launcher) setNamespaces() {
 		sylog.Infof("Setting --net (required by --network-args)")
 		l.cfg.Namespaces.Net = true
 	}
+	if !l.cfg.Namespaces.Net && l.cfg.NetworkArgsFile != "" {
+		sylog.Infof("Setting --net (required by --network-args-file)")
+		l.cfg.Namespaces.Net = true
+	}
+	if !l.cfg.Namespaces.Net && (l.cfg.InstanceIP != "" || l.cfg.InstanceMAC != "") {
+		sylog.Infof("Setting --net (required by --ip and --mac)")
+		l.cfg.Namespaces.Net = true
+	}
+	if !l.cfg.Namespaces.Net && len(l.cfg.Publish) != 0 {
+		sylog.Infof("Setting --net (required by --publish)")
+		l.cfg.Namespaces.Net = true
+	}
 	if l.cfg.Namespaces.Net {
 		if l.cfg.Network == "" {
 			l.cfg.Network = "bridge"
 			l.engineConfig.SetNetwork(l.cfg.Network)
 		}
-		if l.cfg.Fakeroot && l.cfg.Network != "none" {
+		if l.cfg.Fakeroot && l.cfg.Network != "none" && !rootless.IsBackend(l.cfg.Network) {
 			// unprivileged installation could not use fakeroot
 			// network because it requires a setuid installation
-			// so we fallback to none
+			// so we fallback to none, the published ports are then
+			// forwarded by the rootless network backend
 			if buildcfg.APPTAINER_SUID_INSTALL == 0 || !l.engineConfig.File.AllowSetuid {
-				sylog.Warningf(
-					"fakeroot with unprivileged installation or 'allow setuid = no' " +
-						"could not use 'fakeroot' network, fallback to 'none' network",
-				)
+				if len(l.cfg.Publish) == 0 {
+					sylog.Warningf(
+						"fakeroot with unprivileged installation or 'allow setuid = no' " +
+							"could not use 'fakeroot' network, fallback to 'none' network",
+					)
+				}
 				l.engineConfig.SetNetwork("none")
 			}
 		}
 		l.generator.AddOrReplaceLinuxNamespace("network", "")
+	} else if l.cfg.NoLoopback {
+		sylog.Warningf("--no-loopback has no effect without a network namespace")
 	}
 	if l.cfg.Namespaces.UTS {
 		l.generator.AddOrReplaceLinuxNamespace("uts", "")
@@ -945,8 +1457,60 @@ func (l *Launcher) setNamespaces() {
 	}
 }
 
+// setReadOnlyRoot validates the read-only root options and sets them in the
+// engine configuration. The 'enforce read only root' directive forces a
+// read-only root for unprivileged users.
+func (l *Launcher) setReadOnlyRoot() error {
+	if l.engineConfig.File.EnforceReadOnlyRoot && l.uid != 0 && !l.cfg.ReadOnlyRoot {
+		sylog.Verbosef("Read-only root enforced by configuration")
+		l.cfg.ReadOnlyRoot = true
+	}
+
+	if !l.cfg.ReadOnlyRoot {
+		if len(l.cfg.WritablePaths) > 0 {
+			return fmt.Errorf("--writable-path requires --read-only-root")
+		}
+		return nil
+	}
+
+	if l.cfg.Writable {
+		return fmt.Errorf("--writable can't be used with a read-only root")
+	}
+	if l.cfg.WritableTmpfs && len(l.cfg.WritablePaths) == 0 {
+		sylog.Warningf("--writable-tmpfs has no effect with a read-only root, use --writable-path to select writable paths")
+	}
+
+	for _, p := range l.cfg.WritablePaths {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("writable path %s is not an absolute path", p)
+		}
+		if filepath.Clean(p) == "/" {
+			return fmt.Errorf("the container root can't be a writable path with a read-only root")
+		}
+	}
+
+	l.engineConfig.SetReadOnlyRoot(true)
+	l.engineConfig.SetWritablePaths(l.cfg.WritablePaths)
+	return nil
+}
+
 // setEnvVars sets the environment for the container, from the host environment, glads, env-file.
-func (l *Launcher) setEnvVars(ctx context.Context, args []string) error {
+func (l *Launcher) setEnvVars(ctx context.Context, args []string, useSuid bool) error {
+	if err := env.CheckPatterns(l.cfg.PreserveEnv); err != nil {
+		return fmt.Errorf("invalid --preserve-env: %w", err)
+	}
+	if err := env.CheckPatterns(l.cfg.UnsetEnv); err != nil {
+		return fmt.Errorf("invalid --unset-env: %w", err)
+	}
+	if len(l.cfg.PreserveEnv) > 0 && !l.cfg.CleanEnv {
+		sylog.Warningf("--preserve-env has no effect without --cleanenv, host environment variables are already passed")
+	}
+
+	l.envOrigins = make(map[string]string)
+	for k := range l.cfg.Env {
+		l.envOrigins[k] = "flag: --env"
+	}
+
 	if l.cfg.EnvFile != "" {
 		currentEnv := append(
 			os.Environ(),
@@ -983,7 +1547,46 @@ func (l *Launcher) setEnvVars(ctx context.Context, args []string) error {
 				sylog.Warningf("Ignore environment variable %s from %s: override from --env", e[0], l.cfg.EnvFile)
 			} else {
 				l.cfg.Env[e[0]] = e[1]
+				l.envOrigins[e[0]] = "flag: --env-file"
+			}
+		}
+	}
+	// variables set for the GPUs and the host credentials, unless
+	// overridden by --env, --env-file or APPTAINERENV_
+	for _, vars := range []map[string]originEnvVar{l.gpuEnv, l.credentialEnv} {
+		for key, e := range vars {
+			if _, ok := l.cfg.Env[key]; ok {
+				continue
+			}
+			if _, ok := os.LookupEnv(env.ApptainerEnvPrefix + key); ok {
+				continue
+			}
+			if l.cfg.Env == nil {
+				l.cfg.Env = make(map[string]string)
 			}
+			l.cfg.Env[key] = e.value
+			l.envOrigins[key] = e.origin
+		}
+	}
+	// keep host locale variables with --cleanenv --keep-locale, unless
+	// overridden by --env, --env-file or APPTAINERENV_
+	if l.cfg.CleanEnv && l.cfg.KeepLocale {
+		for _, e := range os.Environ() {
+			key, value, _ := strings.Cut(e, "=")
+			if !env.IsLocaleKey(key) {
+				continue
+			}
+			if _, ok := l.cfg.Env[key]; ok {
+				continue
+			}
+			if _, ok := os.LookupEnv(env.ApptainerEnvPrefix + key); ok {
+				continue
+			}
+			if l.cfg.Env == nil {
+				l.cfg.Env = make(map[string]string)
+			}
+			l.cfg.Env[key] = value
+			l.envOrigins[key] = "flag: --keep-locale"
 		}
 	}
 	// process --env and --env-file variables for injection
@@ -998,9 +1601,36 @@ func (l *Launcher) setEnvVars(ctx context.Context, args []string) error {
 	}
 	// Copy and cache environment
 	environment := os.Environ()
+	// the host TZ doesn't apply when the container timezone is set,
+	// TZ is then set in the container by the engine unless overridden
+	// by --env, --env-file or APPTAINERENV_TZ
+	if l.engineConfig.GetTimezone() != "" {
+		for i := 0; i < len(environment); i++ {
+			if strings.HasPrefix(environment[i], "TZ=") {
+				environment = append(environment[:i], environment[i+1:]...)
+				i--
+			}
+		}
+	}
+	// the variables allowed by the administrator survive a clean
+	// environment with the setuid workflow, as well as the variables
+	// preserved with --preserve-env
+	var allowlist []string
+	if useSuid {
+		allowlist = append(allowlist, l.engineConfig.File.SuidEnvAllowlist...)
+	}
+	allowlist = append(allowlist, l.cfg.PreserveEnv...)
 	// Clean environment
-	apptainerEnv := env.SetContainerEnv(l.generator, environment, l.cfg.CleanEnv, l.engineConfig.GetHomeDest())
+	apptainerEnv := env.SetContainerEnv(l.generator, environment, l.cfg.CleanEnv, allowlist, l.cfg.UnsetEnv, l.engineConfig.GetHomeDest())
 	l.engineConfig.SetApptainerEnv(apptainerEnv)
+	// the variables defined by the image are removed by the engine
+	l.engineConfig.SetUnsetEnv(l.cfg.UnsetEnv)
+
+	if sylog.GetLevel() >= int(sylog.VerboseLevel) {
+		for _, e := range l.planEnv(useSuid) {
+			sylog.Verbosef("Environment variable %s set from %s", e.Name, e.Origin)
+		}
+	}
 	return nil
 }
 
@@ -1036,13 +1666,28 @@ func (l *Launcher) setCgroups(instanceName string) error {
 		l.engineConfig.SetDbusSessionBusAddress(os.Getenv("DBUS_SESSION_BUS_ADDRESS"))
 	}
 
+	mode := l.cfg.CgroupsMode
+	if mode == "" {
+		mode = l.engineConfig.File.CgroupsMode
+	}
+	switch mode {
+	case cgroups.ModeCreate:
+	case cgroups.ModeJoinJob:
+		return l.setJobCgroup(instanceName)
+	case cgroups.ModeNone:
+		sylog.Debugf("Not setting up a cgroup with cgroups mode %s", mode)
+		return nil
+	default:
+		return fmt.Errorf("invalid cgroups mode %q, must be one of %s, %s or %s", mode, cgroups.ModeCreate, cgroups.ModeJoinJob, cgroups.ModeNone)
+	}
+
 	if l.cfg.CGroupsJSON != "" {
 		// Handle cgroups configuration (parsed from file or flags in CLI).
 		l.engineConfig.SetCgroupsJSON(l.cfg.CGroupsJSON)
 		return nil
 	}
 
-	if instanceName == "" {
+	if instanceName == "" || l.nested {
 		return nil
 	}
 
@@ -1073,10 +1718,56 @@ func (l *Launcher) setCgroups(instanceName string) error {
 	return nil
 }
 
+// setJobCgroup sets up the container cgroup beneath the cgroup of the job
+// apptainer is started in, when the job cgroup is delegated to the user.
+// Otherwise no cgroup is created, and the stats of an instance are those of
+// the job cgroup it stays in.
+func (l *Launcher) setJobCgroup(instanceName string) error {
+	cgJSON := l.cfg.CGroupsJSON
+	if cgJSON == "" && instanceName != "" && !l.nested {
+		// an instance always uses a cgroup if possible, to enable stats
+		var err error
+		cg := cgroups.Config{}
+		if cgJSON, err = cg.MarshalJSON(); err != nil {
+			return err
+		}
+	}
+	if cgJSON == "" {
+		sylog.Debugf("No resource limits, not setting up a job cgroup")
+		return nil
+	}
+	resources, err := cgroups.UnmarshalJSONResources(cgJSON)
+	if err != nil {
+		return fmt.Errorf("while loading cgroups spec: %w", err)
+	}
+
+	group, err := cgroups.CurrentGroup()
+	if err == nil {
+		err = cgroups.CheckJobDelegation(group, resources)
+	}
+	if err != nil {
+		sylog.Infof("Not creating a container cgroup beneath the job cgroup: %v", err)
+		if l.cfg.CGroupsJSON != "" {
+			sylog.Warningf("Resource limits will not be applied to the container")
+		}
+		if instanceName != "" && group != "" {
+			// the instance stays in the job cgroup, its stats are the job ones
+			l.engineConfig.SetJobCgroup(group)
+		}
+		return nil
+	}
+
+	sylog.Infof("Creating the container cgroup beneath the job cgroup %s", group)
+	l.engineConfig.SetCgroupsJSON(cgJSON)
+	l.engineConfig.SetJobCgroup(group)
+	return nil
+}
+
 // PrepareImage performs any image preparation required before execution.
-// This is currently limited to extraction or FUSE mount when using the user namespace,
-// and activating any image driver plugins that might handle the image mount.
-func (l *Launcher) prepareImage(c context.Context, insideUserNs bool, image string) error {
+// This is currently limited to extraction of tar archives, extraction or FUSE mount
+// when using the user namespace, and activating any image driver plugins that might
+// handle the image mount.
+func (l *Launcher) prepareImage(c context.Context, insideUserNs, useSuid bool, image string) error {
 	// initialize internal image drivers
 	var desiredFeatures imgutil.DriverFeature
 	if fs.IsFile(image) {
@@ -1084,6 +1775,11 @@ func (l *Launcher) prepareImage(c context.Context, insideUserNs bool, image stri
 	}
 	driver.InitImageDrivers(true, l.cfg.Namespaces.User || insideUserNs, l.engineConfig.File, desiredFeatures)
 
+	// tar archives are extracted to a sandbox, whatever the workflow
+	if fs.IsFile(image) && l.rootfsType(image) == imgutil.TAR {
+		return l.prepareArchiveImage(l.engineConfig.GetImage())
+	}
+
 	// convert image file to sandbox if either it was requested by
 	// `--unsquash` or if we are inside of a user namespace and there's
 	// no image driver.
@@ -1113,38 +1809,211 @@ func (l *Launcher) prepareImage(c context.Context, insideUserNs bool, image stri
 					convert = false
 				}
 			}
+			if err := l.checkImageMountDriver(image, &convert); err != nil {
+				return err
+			}
 		}
 
 		if convert {
+			if err := l.checkConvertSignerPolicy(c, image, useSuid); err != nil {
+				return err
+			}
 			unsquashfsPath, err := bin.FindBin("unsquashfs")
 			if err != nil {
 				sylog.Fatalf("while extracting %s: %s", image, err)
 			}
-			sylog.Infof("Converting SIF file to temporary sandbox...")
-			rootfsDir, imageDir, err := convertImage(image, unsquashfsPath, l.cfg.TmpDir)
+			// a dry run plans the container of an empty sandbox
+			if !l.cfg.DryRun {
+				sylog.Infof("Converting SIF file to temporary sandbox...")
+			}
+			rootfsDir, imageDir, err := convertImage(image, unsquashfsPath, l.cfg.TmpDir, l.cfg.TmpDirCandidates, !l.cfg.DryRun)
 			if err != nil {
 				sylog.Fatalf("while extracting %s: %s", image, err)
 			}
 			l.engineConfig.SetImage(imageDir)
+			l.engineConfig.SetImageConverted(image)
 			l.engineConfig.SetDeleteTempDir(rootfsDir)
 			l.generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "CONTAINER", imageDir)
-			// if '--disable-cache' flag, then remove original SIF after converting to sandbox
-			if l.cfg.CacheDisabled {
-				sylog.Debugf("Removing tmp image: %s", image)
-				err := os.Remove(image)
-				if err != nil {
-					return fmt.Errorf("unable to remove tmp image: %s: %w", image, err)
+			// if '--disable-cache' flag, or the image was read from stdin, then remove
+			// original SIF after converting to sandbox
+			if (l.cfg.CacheDisabled || l.cfg.DeleteImageDir != "") && !l.cfg.DryRun {
+				if err := l.removeConvertedImage(image, rootfsDir); err != nil {
+					return err
 				}
 			}
+		} else if err := l.prepareLimitedFsImage(image, l.cfg.Namespaces.User || insideUserNs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConvertSignerPolicy refuses to convert the image file to a sandbox
+// if it would be refused by the signer policy of apptainer.conf. The engine
+// checks the policy against the image file the sandbox is converted from,
+// and in setuid mode against the sandbox too, as it's writable by the user.
+func (l *Launcher) checkConvertSignerPolicy(ctx context.Context, image string, useSuid bool) error {
+	if !l.engineConfig.File.RequireSignedImages {
+		return nil
+	}
+	img, err := imgutil.Init(image, false)
+	if err != nil {
+		return fmt.Errorf("could not open image %s: %s", image, err)
+	}
+	defer img.File.Close()
+
+	err = syecl.CheckSignerPolicy(ctx, l.engineConfig.File.TrustedSigners, l.engineConfig.File.AllowUnsignedFormats, img, useSuid)
+	if err == nil && useSuid {
+		policy, perr := syecl.NewSignerPolicy(l.engineConfig.File.TrustedSigners, l.engineConfig.File.AllowUnsignedFormats)
+		if perr != nil {
+			err = perr
+		} else if !policy.AllowsUnsigned(imgutil.SANDBOX) {
+			err = fmt.Errorf("the sandbox converted from the image is not allowed unsigned in setuid mode")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("image %s refused by the signer policy of %s: %s", image, buildcfg.APPTAINER_CONF_FILE, err)
+	}
+	return nil
+}
+
+// removeConvertedImage removes the temporary image file converted to the
+// sandbox in rootfsDir. With the signer policy of apptainer.conf the engine
+// checks the image file, which is then removed on exit instead: with the
+// temporary image directory, or moved to rootfsDir.
+func (l *Launcher) removeConvertedImage(image, rootfsDir string) error {
+	if !l.engineConfig.File.RequireSignedImages {
+		sylog.Debugf("Removing tmp image: %s", image)
+		if err := os.Remove(image); err != nil {
+			return fmt.Errorf("unable to remove tmp image: %s: %w", image, err)
+		}
+		return nil
+	}
+	if l.cfg.DeleteImageDir != "" {
+		return nil
+	}
+	moved := filepath.Join(rootfsDir, filepath.Base(image))
+	if err := os.Rename(image, moved); err != nil {
+		sylog.Warningf("Keeping tmp image %s for the signer policy, could not move it to %s: %s", image, rootfsDir, err)
+		return nil
+	}
+	sylog.Debugf("Moved tmp image %s to %s, removed on exit", image, moved)
+	l.engineConfig.SetImageConverted(moved)
+	return nil
+}
+
+// prepareLimitedFsImage handles the image files stored on a FUSE filesystem
+// without memory mapping support, which can't reliably back a loop device.
+// Without the setuid starter squashfuse reads them like any other image,
+// otherwise the images up to the 'image copy max size' of apptainer.conf
+// are copied to a temporary directory and run from there.
+func (l *Launcher) prepareLimitedFsImage(image string, unprivileged bool) error {
+	limited, err := fs.IsLimitedFs(image)
+	if err != nil {
+		sylog.Debugf("Could not check the filesystem of image %s: %s", image, err)
+		return nil
+	}
+	if !limited {
+		return nil
+	}
+	if unprivileged {
+		sylog.Verbosef("Image %s is on a FUSE filesystem without memory mapping support, mounting it with squashfuse", image)
+		return nil
+	}
+
+	if l.cfg.Writable {
+		return fmt.Errorf("image %s is on a FUSE filesystem without memory mapping support, it can't be used with --writable", image)
+	}
+	fi, err := os.Stat(image)
+	if err != nil {
+		return err
+	}
+	maxSize := l.engineConfig.File.ImageCopyMaxSize
+	if fi.Size() > int64(maxSize)<<20 {
+		return fmt.Errorf("image %s is on a FUSE filesystem without memory mapping support and is larger than the 'image copy max size' of %d MiB set in apptainer.conf: use --userns, or copy the image to a local filesystem", image, maxSize)
+	}
+	// a dry run plans the container of the image itself, the copy
+	// being of the same type
+	if l.cfg.DryRun {
+		sylog.Verbosef("Image %s would be copied to a temporary directory", image)
+		return nil
+	}
+
+	tmpDir, err := fs.ChooseTmpDir(l.cfg.TmpDir, l.cfg.TmpDirCandidates, fi.Size())
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp(tmpDir, "image-")
+	if err != nil {
+		return fmt.Errorf("could not create temporary directory: %w", err)
+	}
+	imageCopy := filepath.Join(dir, filepath.Base(image))
+	sylog.Infof("Image is on a FUSE filesystem without memory mapping support, copying it to %s...", tmpDir)
+	if err := fs.CopyFile(image, imageCopy, 0o600); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("while copying image %s: %w", image, err)
+	}
+	l.engineConfig.SetImage(imageCopy)
+	l.engineConfig.SetDeleteTempDir(dir)
+	return nil
+}
+
+// checkImageMountDriver applies the 'image mount driver' policy to the
+// decision of converting an image file to a sandbox when running without
+// the setuid starter.
+func (l *Launcher) checkImageMountDriver(image string, convert *bool) error {
+	// a plugin image driver takes precedence over the policy
+	if d := l.engineConfig.File.ImageDriver; d != "" && d != driver.DriverName {
+		return nil
+	}
+	switch policy := l.engineConfig.File.ImageMountDriver; policy {
+	case "kernel", "fuse2fs":
+		if policy == "fuse2fs" && l.rootfsType(image) == imgutil.EXT3 {
+			return nil
+		}
+		// squashfuse is not allowed, the kernel can't mount
+		// images in a user namespace
+		sylog.Debugf("Image mount driver %s doesn't allow squashfuse, converting image", policy)
+		*convert = true
+	case "squashfuse":
+		if *convert {
+			return fmt.Errorf("'image mount driver = squashfuse' is set in apptainer.conf but squashfuse is not available")
 		}
 	}
 	return nil
 }
 
+// rootfsType returns the type of the root filesystem partition of
+// the image file, as found by checkImage if the image was checked.
+func (l *Launcher) rootfsType(filename string) uint32 {
+	if l.rootfs != nil {
+		return l.rootfs.Type
+	}
+	return rootfsType(filename)
+}
+
+// rootfsType returns the type of the root filesystem partition of
+// the image file, or 0 if it can't be determined.
+func rootfsType(filename string) uint32 {
+	img, err := imgutil.Init(filename, false)
+	if err != nil {
+		return 0
+	}
+	defer img.File.Close()
+
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		return 0
+	}
+	return part.Type
+}
+
 // starterInteractive executes the starter binary to run an image interactively, given the supplied engineConfig
 func (l *Launcher) starterInteractive(loadOverlay bool, useSuid bool, cfg *config.Common) error {
+	l.registerContainer(os.Getpid())
+
 	err := starter.Exec(
-		"Apptainer runtime parent",
+		registry.ProcName,
 		cfg,
 		starter.UseSuid(useSuid),
 		starter.LoadOverlayModule(loadOverlay),
@@ -1152,6 +2021,24 @@ func (l *Launcher) starterInteractive(loadOverlay bool, useSuid bool, cfg *confi
 	return err
 }
 
+// registerContainer registers the container in the user runtime directory,
+// pid being the starter process, which replaces the current process unless
+// a pseudo-terminal is proxied.
+func (l *Launcher) registerContainer(pid int) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if !l.engineConfig.File.RegisterContainers || runtimeDir == "" || l.nested {
+		return
+	}
+	e := &registry.Entry{
+		Pid:     pid,
+		Image:   l.engineConfig.GetImage(),
+		Started: time.Now(),
+	}
+	if err := registry.Register(runtimeDir, e); err != nil {
+		sylog.Debugf("Could not register container: %s", err)
+	}
+}
+
 // starterInstance executes the starter binary to run an instance given the supplied engineConfig
 func (l *Launcher) starterInstance(loadOverlay bool, insideUserNs bool, name string, useSuid bool, cfg *config.Common) error {
 	pu, err := user.GetPwUID(l.uid)
@@ -1254,9 +2141,10 @@ func hidepidProc() bool {
 }
 
 // convertImage extracts the image found at filename to directory dir within a temporary directory
-// tempDir. If the unsquashfs binary is not located, the binary at unsquashfsPath is used. It is
-// the caller's responsibility to remove rootfsDir when no longer needed.
-func convertImage(filename string, unsquashfsPath string, tmpDir string) (rootfsDir string, imageDir string, err error) {
+// tempDir, or within the first of candidates with enough space if any. If the unsquashfs binary is
+// not located, the binary at unsquashfsPath is used. Without extract, the directory is left empty
+// for a dry run. It is the caller's responsibility to remove rootfsDir when no longer needed.
+func convertImage(filename string, unsquashfsPath string, tmpDir string, candidates []string, extract bool) (rootfsDir string, imageDir string, err error) {
 	img, err := imgutil.Init(filename, false)
 	if err != nil {
 		return "", "", fmt.Errorf("could not open image %s: %s", filename, err)
@@ -1281,6 +2169,11 @@ func convertImage(filename string, unsquashfsPath string, tmpDir string) (rootfs
 		return "", "", fmt.Errorf("not a squashfs root filesystem")
 	}
 
+	tmpDir, err = fs.ChooseTmpDir(tmpDir, candidates, int64(part.Size)*fs.ExtractFactor)
+	if err != nil {
+		return "", "", err
+	}
+
 	// create a reader for rootfs partition
 	reader, err := imgutil.NewPartitionReader(img, "", 0)
 	if err != nil {
@@ -1290,6 +2183,7 @@ func convertImage(filename string, unsquashfsPath string, tmpDir string) (rootfs
 	if !s.HasUnsquashfs() && unsquashfsPath != "" {
 		s.UnsquashfsPath = unsquashfsPath
 	}
+	s.TmpDir = tmpDir
 
 	// create temporary sandbox
 	rootfsDir, err = os.MkdirTemp(tmpDir, "rootfs-")
@@ -1321,6 +2215,9 @@ func convertImage(filename string, unsquashfsPath string, tmpDir string) (rootfs
 	}
 
 	// extract root filesystem
+	if !extract {
+		return rootfsDir, imageDir, nil
+	}
 	if err := s.ExtractAll(reader, imageDir); err != nil {
 		return "", "", fmt.Errorf("root filesystem extraction failed: %s", err)
 	}
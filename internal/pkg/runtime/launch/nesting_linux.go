@@ -0,0 +1,47 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launch
+
+import (
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/util/nesting"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// adaptToNesting selects options compatible with running inside another
+// container, where the setuid starter and the subuid mappings can't be
+// used, the cgroup hierarchy isn't ours and /proc may be masked. The
+// requested options which can't be honored are dropped with a warning.
+func (l *Launcher) adaptToNesting(env *nesting.Environment) {
+	if !env.Nested() {
+		return
+	}
+	l.nested = true
+
+	var adaptations []string
+
+	if l.uid != 0 && (env.UserNS || env.NoSuid) && buildcfg.APPTAINER_SUID_INSTALL == 1 && !l.cfg.Namespaces.User && !l.cfg.Fakeroot {
+		l.cfg.Namespaces.User = true
+		adaptations = append(adaptations, "using a user namespace as the setuid starter is unusable")
+	}
+	if l.uid != 0 && env.UserNS && l.cfg.Fakeroot && !l.cfg.IgnoreSubuid {
+		l.cfg.IgnoreSubuid = true
+		adaptations = append(adaptations, "using a root-mapped namespace or the fakeroot command for --fakeroot as subuid mappings are unusable")
+	}
+	if l.cfg.CGroupsJSON != "" {
+		l.cfg.CGroupsJSON = ""
+		sylog.Warningf("Ignoring the requested resource limits, the cgroup hierarchy belongs to the outer container (disable with --no-nesting-autodetect)")
+	}
+	if env.ProcMasked && l.cfg.Namespaces.PID {
+		l.cfg.Namespaces.PID = false
+		sylog.Warningf("Not using the requested PID namespace, a new /proc can't be mounted over the masked /proc (disable with --no-nesting-autodetect)")
+	}
+
+	env.Report(adaptations)
+}
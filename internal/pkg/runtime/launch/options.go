@@ -21,6 +21,7 @@ package launch
 
 import (
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci/generate"
+	imgutil "github.com/apptainer/apptainer/pkg/image"
 	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
 	"github.com/apptainer/apptainer/pkg/util/cryptkey"
 )
@@ -33,12 +34,20 @@ type launchOptions struct {
 	Writable bool
 	// WriteableTmpfs applies an ephemeral writable overlay to the container.
 	WritableTmpfs bool
+	// ReadOnlyRoot keeps the container root filesystem read-only, even with a writable overlay.
+	ReadOnlyRoot bool
+	// WritablePaths lists container paths remaining writable with ReadOnlyRoot.
+	WritablePaths []string
 	// OverlayPaths holds paths to image or directory overlays to be applied.
 	OverlayPaths []string
 	// Scratchdir lists paths into the container to be mounted from a temporary location on the host.
 	ScratchDirs []string
 	// WorkDir is the parent path for scratch directories, and contained home/tmp on the host.
 	WorkDir string
+	// SessionDir is the host directory where a disk backed session directory is created.
+	SessionDir string
+	// SessionDirSize is the size in MiB of the session directory memory filesystem.
+	SessionDirSize int
 
 	// HomeDir is the home directory to mount into the container, or a src:dst pair.
 	HomeDir string
@@ -54,6 +63,8 @@ type launchOptions struct {
 	FuseMount []string
 	// Mounts lists paths to bind from host to container, from the docker compatible `--mount` flag (CSV format).
 	Mounts []string
+	// ShmSize is the size of a private /dev/shm tmpfs, e.g. 8g.
+	ShmSize string
 	// NoMount is a list of automatic / configured mounts to disable.
 	NoMount []string
 
@@ -61,6 +72,11 @@ type launchOptions struct {
 	Nvidia bool
 	// NcCCLI sets NVIDIA GPU support to use the nvidia-container-cli.
 	NvCCLI bool
+	// GPUs selects the NVIDIA GPUs and MIG devices made available, e.g.
+	// 0,1 or mig:0:1.
+	GPUs string
+	// NvCaps selects the NVIDIA driver capabilities, e.g. compute,video.
+	NvCaps string
 	// NoNvidia disables NVIDIA GPU support when set default in apptainer.conf.
 	NoNvidia bool
 	// Rocm enables Rocm GPU support.
@@ -77,6 +93,13 @@ type launchOptions struct {
 	EnvFile string
 	// CleanEnv starts the container with a clean environment, excluding host env vars.
 	CleanEnv bool
+	// KeepLocale keeps the host locale environment variables with CleanEnv.
+	KeepLocale bool
+	// PreserveEnv are glob patterns of host env vars kept with CleanEnv.
+	PreserveEnv []string
+	// UnsetEnv are glob patterns of env vars removed from the container,
+	// after all other sources.
+	UnsetEnv []string
 	// NoEval instructs Apptainer not to shell evaluate args and env vars.
 	NoEval bool
 
@@ -87,10 +110,30 @@ type launchOptions struct {
 	Network string
 	// NetworkArgs are argument to pass to the CNI plugin that will configure networking when Network is set.
 	NetworkArgs []string
+	// NetworkArgsFile is the path of a JSON file holding capability arguments to pass to the CNI plugins.
+	NetworkArgsFile string
+	// Publish is the list of container ports published on the host, as hostPort:containerPort[/protocol].
+	Publish []string
 	// Hostname is the hostname to set in the container (infers/requires UTS namespace).
 	Hostname string
+	// Domainname is the domainname to set in the container (infers/requires UTS namespace).
+	Domainname string
 	// DNS is the comma separated list of DNS servers to be set in the container's resolv.conf.
 	DNS string
+	// DNSSearch is the comma separated list of search domains to be set in the container's resolv.conf.
+	DNSSearch string
+	// DNSOptions is the comma separated list of resolver options to be set in the container's resolv.conf.
+	DNSOptions string
+	// Timezone is the container timezone, an Area/City zone name or "host".
+	Timezone string
+	// TimeOffsets is the comma separated list of clock=offset offsets of
+	// the monotonic and boottime clocks in a new time namespace.
+	TimeOffsets string
+	// FakeTime is the RFC3339 date the realtime clock starts from in the
+	// container, through libfaketime.
+	FakeTime string
+	// NoLoopback leaves the loopback interface down in a new network namespace.
+	NoLoopback bool
 
 	// AddCaps is the list of capabilities to Add to the container process.
 	AddCaps string
@@ -104,11 +147,25 @@ type launchOptions struct {
 	NoPrivs bool
 	// SecurityOpts is the list of security options (selinux, apparmor, seccomp) to apply.
 	SecurityOpts []string
+	// SecurityCredentials lists the host credentials bound in the
+	// container (krb5, munge, ssh-agent), overriding the 'security
+	// credentials' directive if set.
+	SecurityCredentials []string
 	// NoUmask disables propagation of the host umask into the container, using a default 0022.
 	NoUmask bool
+	// Umask is the octal umask of the container process, overriding the
+	// 'container umask' directive and the host umask if set.
+	Umask string
+	// Groups selects the supplementary groups of the container process:
+	// keep, none, or a comma separated list of group names or IDs. It
+	// overrides the 'container groups' directive if set.
+	Groups string
 
 	// CGroupsJSON is a JSON format cgroups resource limit specification to apply.
 	CGroupsJSON string
+	// CgroupsMode selects where the container cgroup is set up, overriding
+	// the 'cgroups mode' of apptainer.conf.
+	CgroupsMode string
 
 	// ConfigFile is an alternate apptainer.conf that will be used by unprivileged installations only.
 	ConfigFile string
@@ -122,8 +179,35 @@ type launchOptions struct {
 	Fakeroot bool
 	// Boot enables execution of /sbin/init on startup of an instance container.
 	Boot bool
+	// InstanceScript is the container script executed by an instance, "start"
+	// for the startscript or "run" for the runscript.
+	InstanceScript string
+	// InstanceLogMaxSize is the size in bytes at which instance log files
+	// are rotated, overriding the 'instance log max size' directive if not
+	// negative.
+	InstanceLogMaxSize int64
+	// InstanceLogMaxFiles is the number of rotated instance log files kept.
+	InstanceLogMaxFiles int
+	// InstanceIP is the IP address of an instance on its first network.
+	InstanceIP string
+	// InstanceMAC is the hardware address of an instance on its first network.
+	InstanceMAC string
+	// NotifyDir is the host directory holding the readiness notification
+	// socket of an instance.
+	NotifyDir string
+	// SocketsPath is the container directory where the sockets directory
+	// of an instance is bound.
+	SocketsPath string
+	// JoinSockets is the name of an instance whose sockets directory is
+	// bound in the container.
+	JoinSockets string
 	// NoInit disables shim process when PID namespace is used.
 	NoInit bool
+	// Pty allocates a pseudo-terminal for the container process.
+	Pty bool
+	// NoPty disables the pseudo-terminal allocated by default when the
+	// standard input and output are terminals.
+	NoPty bool
 	// Contain starts the container with minimal /dev and empty home/tmp mounts.
 	Contain bool
 	// ContainAll infers Contain, and adds PID, IPC namespaces, and CleanEnv.
@@ -141,6 +225,18 @@ type launchOptions struct {
 	// userns flows we will need to delete the redundant temporary pulled image after
 	// conversion to sandbox.
 	CacheDisabled bool
+	// GPUCacheDir holds the host GPU files resolved for --nv and --rocm,
+	// they aren't cached if empty.
+	GPUCacheDir string
+	// RootfsCacheDir holds the root filesystems extracted from the tar
+	// archives run as images, they aren't cached if empty.
+	RootfsCacheDir string
+	// DeleteImageDir is a temporary directory holding the image, such as an
+	// image read from stdin, deleted when the container exits.
+	DeleteImageDir string
+	// SquashfuseThreads is the number of threads used by squashfuse to
+	// mount images, overriding the 'squashfuse threads' directive.
+	SquashfuseThreads int
 
 	DMTCPLaunch       string
 	DMTCPRestart      string
@@ -148,9 +244,24 @@ type launchOptions struct {
 	IgnoreSubuid      bool
 	IgnoreFakerootCmd bool
 	IgnoreUserns      bool
-	UseBuildConfig    bool
-	TmpDir            string
-	Underlay          bool // whether prefer underlay over overlay
+	// FakerootDB is the database file keeping the ownership and
+	// permissions faked by the fakeroot command across runs.
+	FakerootDB string
+
+	// DryRun prints the planned container configuration instead of running the container.
+	DryRun bool
+	// DryRunJSON prints the planned container configuration in JSON format.
+	DryRunJSON bool
+
+	// NoNestingAutodetect disables the adaptation of options when
+	// running inside another container.
+	NoNestingAutodetect bool
+	UseBuildConfig      bool
+	TmpDir              string
+	// TmpDirCandidates are the temporary directories tried in order
+	// for an image conversion instead of TmpDir.
+	TmpDirCandidates []string
+	Underlay         bool // whether prefer underlay over overlay
 }
 
 type Launcher struct {
@@ -159,6 +270,39 @@ type Launcher struct {
 	cfg          launchOptions
 	engineConfig *apptainerConfig.EngineConfig
 	generator    *generate.Generator
+	// rootfs is the root filesystem partition of the image,
+	// found when the image is checked before the launch.
+	rootfs *imgutil.Section
+	// nested is set when running inside another container
+	// with nesting autodetection enabled.
+	nested bool
+	// pluginBinds maps the destinations of the bind mounts added
+	// by plugins to the plugin names.
+	pluginBinds map[string]string
+	// gpuFiles maps the host files and devices bound for the GPUs to
+	// their flag or CDI specification.
+	gpuFiles map[string]string
+	// gpuEnv holds the container variables set for the GPUs.
+	gpuEnv map[string]originEnvVar
+	// credentialEnv holds the container variables set for the host
+	// credentials bound with --security-credentials.
+	credentialEnv map[string]originEnvVar
+	// credentialFiles maps the host files and sockets bound for the
+	// credentials to their flag or directive.
+	credentialFiles map[string]string
+	// socketsBinds maps the sources of the instance sockets directory
+	// binds to their flag.
+	socketsBinds map[string]string
+	// envOrigins maps the environment variables set by --env,
+	// --env-file and --keep-locale to their origin.
+	envOrigins map[string]string
+}
+
+// originEnvVar is the value of a container variable set for the GPUs or
+// the host credentials, with its origin.
+type originEnvVar struct {
+	value  string
+	origin string
 }
 
 // Namespaces holds flags for the optional (non-mount) namespaces that can be
@@ -189,6 +333,16 @@ func OptWritableTmpfs(b bool) Option {
 	}
 }
 
+// OptReadOnlyRoot keeps the container root filesystem read-only, even with a
+// writable overlay, except for the writable paths.
+func OptReadOnlyRoot(b bool, writablePaths []string) Option {
+	return func(lo *launchOptions) error {
+		lo.ReadOnlyRoot = b
+		lo.WritablePaths = writablePaths
+		return nil
+	}
+}
+
 // OptOverlayPaths sets overlay images and directories to apply to the container.
 func OptOverlayPaths(op []string) Option {
 	return func(lo *launchOptions) error {
@@ -213,6 +367,16 @@ func OptWorkDir(wd string) Option {
 	}
 }
 
+// OptSessionDir sets the host directory where a disk backed session directory
+// is created, and the size in MiB of the session directory memory filesystem.
+func OptSessionDir(dir string, size int) Option {
+	return func(lo *launchOptions) error {
+		lo.SessionDir = dir
+		lo.SessionDirSize = size
+		return nil
+	}
+}
+
 // OptHome sets the home directory configuration for the container.
 //
 // homeDir is the path or src:dst to bind mount.
@@ -241,6 +405,15 @@ func OptMounts(binds []string, mounts []string, fuseMounts []string) Option {
 	}
 }
 
+// OptShmSize mounts a private /dev/shm tmpfs of the given size, in a
+// docker compatible format, e.g. 8g.
+func OptShmSize(size string) Option {
+	return func(lo *launchOptions) error {
+		lo.ShmSize = size
+		return nil
+	}
+}
+
 // OptNoMount disables the specified bind mounts.
 func OptNoMount(nm []string) Option {
 	return func(lo *launchOptions) error {
@@ -260,6 +433,16 @@ func OptNvidia(nv bool, nvccli bool) Option {
 	}
 }
 
+// OptGPUs selects the NVIDIA GPUs made available, and the driver capabilities
+// set up by nvidia-container-cli.
+func OptGPUs(gpus, caps string) Option {
+	return func(lo *launchOptions) error {
+		lo.GPUs = gpus
+		lo.NvCaps = caps
+		return nil
+	}
+}
+
 // OptNoNvidia disables NVIDIA GPU support, even if enabled via apptainer.conf.
 func OptNoNvidia(b bool) Option {
 	return func(lo *launchOptions) error {
@@ -306,6 +489,34 @@ func OptEnv(env map[string]string, envFile string, clean bool) Option {
 	}
 }
 
+// OptPreserveEnv keeps the host environment variables matching the glob
+// patterns when the environment is cleaned.
+func OptPreserveEnv(patterns []string) Option {
+	return func(lo *launchOptions) error {
+		lo.PreserveEnv = patterns
+		return nil
+	}
+}
+
+// OptUnsetEnv removes the environment variables matching the glob patterns
+// from the container, after the host environment, the image environment,
+// --env, --env-file and APPTAINERENV_ variables are applied.
+func OptUnsetEnv(patterns []string) Option {
+	return func(lo *launchOptions) error {
+		lo.UnsetEnv = patterns
+		return nil
+	}
+}
+
+// OptKeepLocale keeps the host LANG, LANGUAGE and LC_* environment variables
+// when the environment is cleaned.
+func OptKeepLocale(b bool) Option {
+	return func(lo *launchOptions) error {
+		lo.KeepLocale = b
+		return nil
+	}
+}
+
 // OptNoEval disables shell evaluation of args and env vars.
 func OptNoEval(b bool) Option {
 	return func(lo *launchOptions) error {
@@ -334,6 +545,24 @@ func OptNetwork(network string, args []string) Option {
 	}
 }
 
+// OptNetworkArgsFile sets the path of a JSON file holding the capability
+// arguments to pass to the CNI plugins, per network.
+func OptNetworkArgsFile(path string) Option {
+	return func(lo *launchOptions) error {
+		lo.NetworkArgsFile = path
+		return nil
+	}
+}
+
+// OptPublish publishes container ports on the host, as
+// hostPort:containerPort[/protocol].
+func OptPublish(ports []string) Option {
+	return func(lo *launchOptions) error {
+		lo.Publish = ports
+		return nil
+	}
+}
+
 // OptHostname sets a hostname for the container (infers/requires UTS namespace).
 func OptHostname(h string) Option {
 	return func(lo *launchOptions) error {
@@ -342,6 +571,14 @@ func OptHostname(h string) Option {
 	}
 }
 
+// OptDomainname sets a domainname for the container (infers/requires UTS namespace).
+func OptDomainname(d string) Option {
+	return func(lo *launchOptions) error {
+		lo.Domainname = d
+		return nil
+	}
+}
+
 // OptDNS sets a DNS entry for the container resolv.conf.
 func OptDNS(d string) Option {
 	return func(lo *launchOptions) error {
@@ -350,6 +587,50 @@ func OptDNS(d string) Option {
 	}
 }
 
+// OptDNSSearch sets the search domains and resolver options for the
+// container resolv.conf.
+func OptDNSSearch(search, options string) Option {
+	return func(lo *launchOptions) error {
+		lo.DNSSearch = search
+		lo.DNSOptions = options
+		return nil
+	}
+}
+
+// OptTimezone sets the container timezone, an Area/City zone name or "host".
+func OptTimezone(tz string) Option {
+	return func(lo *launchOptions) error {
+		lo.Timezone = tz
+		return nil
+	}
+}
+
+// OptTimeOffsets sets the offsets of the monotonic and boottime clocks in
+// a new time namespace, as a comma separated list of clock=offset.
+func OptTimeOffsets(offsets string) Option {
+	return func(lo *launchOptions) error {
+		lo.TimeOffsets = offsets
+		return nil
+	}
+}
+
+// OptFakeTime sets the RFC3339 date the realtime clock starts from in the
+// container, through libfaketime.
+func OptFakeTime(date string) Option {
+	return func(lo *launchOptions) error {
+		lo.FakeTime = date
+		return nil
+	}
+}
+
+// OptNoLoopback leaves the loopback interface down in a new network namespace.
+func OptNoLoopback(b bool) Option {
+	return func(lo *launchOptions) error {
+		lo.NoLoopback = b
+		return nil
+	}
+}
+
 // OptCaps sets capabilities to add and drop.
 func OptCaps(add, drop string) Option {
 	return func(lo *launchOptions) error {
@@ -391,6 +672,14 @@ func OptSecurity(s []string) Option {
 	}
 }
 
+// OptSecurityCredentials sets the host credentials bound in the container.
+func OptSecurityCredentials(c []string) Option {
+	return func(lo *launchOptions) error {
+		lo.SecurityCredentials = c
+		return nil
+	}
+}
+
 // OptNoUmask disables propagation of the host umask into the container, using a default 0022.
 func OptNoUmask(b bool) Option {
 	return func(lo *launchOptions) error {
@@ -399,6 +688,22 @@ func OptNoUmask(b bool) Option {
 	}
 }
 
+// OptUmask sets the octal umask of the container process.
+func OptUmask(mask string) Option {
+	return func(lo *launchOptions) error {
+		lo.Umask = mask
+		return nil
+	}
+}
+
+// OptGroups selects the supplementary groups of the container process.
+func OptGroups(groups string) Option {
+	return func(lo *launchOptions) error {
+		lo.Groups = groups
+		return nil
+	}
+}
+
 // OptCgroupsJSON sets a Cgroups resource limit configuration to apply to the container.
 func OptCgroupsJSON(cj string) Option {
 	return func(lo *launchOptions) error {
@@ -407,6 +712,14 @@ func OptCgroupsJSON(cj string) Option {
 	}
 }
 
+// OptCgroupsMode sets where the container cgroup is set up: create, join-job or none.
+func OptCgroupsMode(mode string) Option {
+	return func(lo *launchOptions) error {
+		lo.CgroupsMode = mode
+		return nil
+	}
+}
+
 // OptConfigFile specifies an alternate apptainer.conf that will be used by unprivileged installations only.
 func OptConfigFile(c string) Option {
 	return func(lo *launchOptions) error {
@@ -439,6 +752,63 @@ func OptFakeroot(b bool) Option {
 	}
 }
 
+// OptInstanceScript sets the container script executed by an instance,
+// "start" for the startscript or "run" for the runscript.
+func OptInstanceScript(script string) Option {
+	return func(lo *launchOptions) error {
+		lo.InstanceScript = script
+		return nil
+	}
+}
+
+// OptInstanceLogRotation sets the size in bytes at which instance log files
+// are rotated, a negative size uses the 'instance log max size' directive,
+// and the number of rotated log files kept.
+func OptInstanceLogRotation(maxSize int64, maxFiles int) Option {
+	return func(lo *launchOptions) error {
+		lo.InstanceLogMaxSize = maxSize
+		lo.InstanceLogMaxFiles = maxFiles
+		return nil
+	}
+}
+
+// OptInstanceAddress sets the IP and hardware addresses of an instance on
+// its first network.
+func OptInstanceAddress(ip, mac string) Option {
+	return func(lo *launchOptions) error {
+		lo.InstanceIP = ip
+		lo.InstanceMAC = mac
+		return nil
+	}
+}
+
+// OptNotifyDir sets the host directory holding the readiness notification
+// socket of an instance, bound in the container with NOTIFY_SOCKET set.
+func OptNotifyDir(dir string) Option {
+	return func(lo *launchOptions) error {
+		lo.NotifyDir = dir
+		return nil
+	}
+}
+
+// OptSocketsPath sets the container directory where the sockets
+// directory of an instance is bound.
+func OptSocketsPath(path string) Option {
+	return func(lo *launchOptions) error {
+		lo.SocketsPath = path
+		return nil
+	}
+}
+
+// OptJoinSockets sets the name of an instance whose sockets directory is
+// bound read-write in the container.
+func OptJoinSockets(name string) Option {
+	return func(lo *launchOptions) error {
+		lo.JoinSockets = name
+		return nil
+	}
+}
+
 // OptBoot enables execution of /sbin/init on startup of an instance container.
 func OptBoot(b bool) Option {
 	return func(lo *launchOptions) error {
@@ -447,6 +817,17 @@ func OptBoot(b bool) Option {
 	}
 }
 
+// OptPty sets whether a pseudo-terminal is allocated for the container
+// process, pty forcing it and noPty disabling the default allocation when
+// the standard input and output are terminals.
+func OptPty(pty, noPty bool) Option {
+	return func(lo *launchOptions) error {
+		lo.Pty = pty
+		lo.NoPty = noPty
+		return nil
+	}
+}
+
 // OptNoInit disables shim process when PID namespace is used.
 func OptNoInit(b bool) Option {
 	return func(lo *launchOptions) error {
@@ -495,6 +876,24 @@ func OptCacheDisabled(b bool) Option {
 	}
 }
 
+// OptGPUCacheDir sets the directory caching the host GPU files resolved
+// for --nv and --rocm.
+func OptGPUCacheDir(dir string) Option {
+	return func(lo *launchOptions) error {
+		lo.GPUCacheDir = dir
+		return nil
+	}
+}
+
+// OptRootfsCacheDir sets the directory caching the root filesystems
+// extracted from tar archives.
+func OptRootfsCacheDir(dir string) Option {
+	return func(lo *launchOptions) error {
+		lo.RootfsCacheDir = dir
+		return nil
+	}
+}
+
 // OptDMTCPLaunch
 func OptDMTCPLaunch(a string) Option {
 	return func(lo *launchOptions) error {
@@ -535,6 +934,14 @@ func OptIgnoreFakerootCmd(b bool) Option {
 	}
 }
 
+// OptFakerootDB sets the database file of the fakeroot command.
+func OptFakerootDB(path string) Option {
+	return func(lo *launchOptions) error {
+		lo.FakerootDB = path
+		return nil
+	}
+}
+
 // OptIgnoreUserns
 func OptIgnoreUserns(b bool) Option {
 	return func(lo *launchOptions) error {
@@ -543,6 +950,34 @@ func OptIgnoreUserns(b bool) Option {
 	}
 }
 
+// OptSquashfuseThreads sets the number of threads used by squashfuse to
+// mount images, overriding the 'squashfuse threads' directive.
+func OptSquashfuseThreads(n int) Option {
+	return func(lo *launchOptions) error {
+		lo.SquashfuseThreads = n
+		return nil
+	}
+}
+
+// OptNoNestingAutodetect disables the adaptation of options when running
+// inside another container.
+func OptNoNestingAutodetect(b bool) Option {
+	return func(lo *launchOptions) error {
+		lo.NoNestingAutodetect = b
+		return nil
+	}
+}
+
+// OptDryRun prints the planned container configuration, in JSON format if
+// formatJSON is set, instead of running the container.
+func OptDryRun(b bool, formatJSON bool) Option {
+	return func(lo *launchOptions) error {
+		lo.DryRun = b
+		lo.DryRunJSON = formatJSON
+		return nil
+	}
+}
+
 // OptUseBuildConfig
 func OptUseBuildConfig(b bool) Option {
 	return func(lo *launchOptions) error {
@@ -551,6 +986,19 @@ func OptUseBuildConfig(b bool) Option {
 	}
 }
 
+// DeleteImageDirEnv passes the temporary directory holding the image to
+// the command re-executed in a root-mapped user namespace, which deletes it.
+const DeleteImageDirEnv = "_APPTAINER_DELETE_IMAGE_DIR"
+
+// OptDeleteImageDir sets a temporary directory holding the image, which
+// is deleted when the container exits.
+func OptDeleteImageDir(dir string) Option {
+	return func(lo *launchOptions) error {
+		lo.DeleteImageDir = dir
+		return nil
+	}
+}
+
 // OptTmpDir
 func OptTmpDir(a string) Option {
 	return func(lo *launchOptions) error {
@@ -559,6 +1007,15 @@ func OptTmpDir(a string) Option {
 	}
 }
 
+// OptTmpDirCandidates sets the temporary directories tried in order for
+// an image conversion, the first one with enough space is used.
+func OptTmpDirCandidates(candidates []string) Option {
+	return func(lo *launchOptions) error {
+		lo.TmpDirCandidates = candidates
+		return nil
+	}
+}
+
 // OptUnderlay
 func OptUnderlay(b bool) Option {
 	return func(lo *launchOptions) error {
@@ -0,0 +1,162 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launch
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/plugin"
+	"github.com/apptainer/apptainer/internal/pkg/util/starter"
+	clicallback "github.com/apptainer/apptainer/pkg/plugin/callback/cli"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// launchConfig returns a copy of the container configuration mutable by
+// the plugins.
+func (l *Launcher) launchConfig(image string) *clicallback.Launch {
+	lc := &clicallback.Launch{
+		Image: image,
+		Binds: append([]apptainerConfig.BindPath(nil), l.engineConfig.GetBindPath()...),
+		Env:   make(map[string]string),
+	}
+	for k, v := range l.engineConfig.GetApptainerEnv() {
+		lc.Env[k] = v
+	}
+	if l.generator.Config.Linux != nil {
+		for _, ns := range l.generator.Config.Linux.Namespaces {
+			lc.Namespaces = append(lc.Namespaces, string(ns.Type))
+		}
+	}
+	return lc
+}
+
+// hasBind returns whether the bind mount b is in binds.
+func hasBind(binds []apptainerConfig.BindPath, b apptainerConfig.BindPath) bool {
+	for _, bind := range binds {
+		if reflect.DeepEqual(bind, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// launchRemovals returns the descriptions of the bind mounts, environment
+// variables and namespaces of before removed or modified in after.
+func launchRemovals(before, after *clicallback.Launch) []string {
+	var removals []string
+
+	for _, b := range before.Binds {
+		if !hasBind(after.Binds, b) {
+			removals = append(removals, fmt.Sprintf("bind mount %s:%s", b.Source, b.Destination))
+		}
+	}
+	for k, v := range before.Env {
+		if av, ok := after.Env[k]; !ok || av != v {
+			removals = append(removals, fmt.Sprintf("environment variable %s", k))
+		}
+	}
+	for _, ns := range before.Namespaces {
+		found := false
+		for _, a := range after.Namespaces {
+			if a == ns {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removals = append(removals, fmt.Sprintf("%s namespace", ns))
+		}
+	}
+
+	return removals
+}
+
+// applyLaunchConfig sets the container configuration mutated by a plugin
+// from the configuration before.
+func (l *Launcher) applyLaunchConfig(before, after *clicallback.Launch) error {
+	has := func(namespaces []string, ns string) bool {
+		for _, n := range namespaces {
+			if n == ns {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, ns := range after.Namespaces {
+		if has(before.Namespaces, ns) {
+			continue
+		}
+		switch specs.LinuxNamespaceType(ns) {
+		case specs.UserNamespace:
+			return fmt.Errorf("the user namespace can't be added")
+		case specs.NetworkNamespace, specs.PIDNamespace, specs.IPCNamespace, specs.UTSNamespace, specs.CgroupNamespace:
+			l.generator.AddOrReplaceLinuxNamespace(specs.LinuxNamespaceType(ns), "")
+		default:
+			return fmt.Errorf("unsupported namespace %q", ns)
+		}
+	}
+	for _, ns := range before.Namespaces {
+		if has(after.Namespaces, ns) {
+			continue
+		}
+		if ns == string(specs.UserNamespace) {
+			return fmt.Errorf("the user namespace can't be removed")
+		}
+		l.generator.RemoveLinuxNamespace(specs.LinuxNamespaceType(ns))
+	}
+
+	l.engineConfig.SetBindPath(after.Binds)
+	l.engineConfig.SetApptainerEnv(after.Env)
+	return nil
+}
+
+// runLaunchCallbacks executes the plugin callbacks mutating the container
+// configuration, in order of plugin priority. Any plugin error, and any
+// removal when not allowed by the 'allow plugin removals' directive,
+// aborts the container launch.
+func (l *Launcher) runLaunchCallbacks(image string) error {
+	callbackType := (clicallback.LaunchConfig)(nil)
+	entries, err := plugin.LoadCallbackEntries(callbackType)
+	if err != nil {
+		return fmt.Errorf("while loading plugin callbacks '%T': %w", callbackType, err)
+	}
+
+	for _, e := range entries {
+		before := l.launchConfig(image)
+		after := l.launchConfig(image)
+
+		if err := e.Callback.(clicallback.LaunchConfig)(after); err != nil {
+			return fmt.Errorf("plugin %s: %w", e.Plugin, err)
+		}
+		if removals := launchRemovals(before, after); len(removals) > 0 {
+			if !l.engineConfig.File.AllowPluginRemovals {
+				return starter.PolicyDenied(fmt.Errorf("plugin %s: removal of %s not allowed by configuration", e.Plugin, strings.Join(removals, ", ")))
+			}
+			sylog.Debugf("Plugin %s removed %s", e.Plugin, strings.Join(removals, ", "))
+		}
+		if err := l.applyLaunchConfig(before, after); err != nil {
+			return fmt.Errorf("plugin %s: %w", e.Plugin, err)
+		}
+		for _, b := range after.Binds {
+			if !hasBind(before.Binds, b) {
+				if l.pluginBinds == nil {
+					l.pluginBinds = make(map[string]string)
+				}
+				l.pluginBinds[b.Destination] = e.Plugin
+			}
+		}
+	}
+
+	return nil
+}
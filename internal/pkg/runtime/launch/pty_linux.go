@@ -0,0 +1,182 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	osignal "os/signal"
+	"syscall"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/runtime/registry"
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
+	"github.com/apptainer/apptainer/internal/pkg/util/starter"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// ptyDrainTimeout is how long the output of the pseudo-terminal is still
+// copied once the container exited, processes left in the background may
+// keep it open.
+const ptyDrainTimeout = time.Second
+
+// ptySignals are the signals received by apptainer which are forwarded to
+// the foreground process group of the pseudo-terminal.
+var ptySignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// setPty sets whether a pseudo-terminal is allocated for the container
+// process: with --pty, or by default when the standard input and output
+// are the terminal of a foreground job, unless --no-pty is set.
+func (l *Launcher) setPty(instanceName string) error {
+	if l.cfg.Pty && l.cfg.NoPty {
+		return fmt.Errorf("--pty and --no-pty can't be used together")
+	}
+	if instanceName != "" || l.cfg.NoPty {
+		return nil
+	}
+	if l.cfg.Pty {
+		if !term.IsTerminal(0) {
+			return fmt.Errorf("--pty requires a terminal on standard input")
+		}
+		l.engineConfig.SetPty(true)
+		return nil
+	}
+	if !term.IsTerminal(0) || !term.IsTerminal(1) {
+		return nil
+	}
+	// a background job would be stopped when setting the terminal in
+	// raw mode
+	pgrp, err := unix.IoctlGetInt(0, unix.TIOCGPGRP)
+	if err != nil || pgrp != unix.Getpgrp() {
+		sylog.Debugf("Not in the foreground of the terminal, not allocating a pseudo-terminal")
+		return nil
+	}
+	l.engineConfig.SetPty(true)
+	return nil
+}
+
+// starterPty executes the starter binary to run an image interactively
+// with a pseudo-terminal as standard streams. The pseudo-terminal is
+// proxied to the terminal of the caller, set in raw mode, until the
+// container exits, then the terminal is restored and the caller exits
+// with the container status.
+func (l *Launcher) starterPty(loadOverlay bool, useSuid bool, cfg *config.Common) error {
+	master, slave, err := pty.Open()
+	if err != nil {
+		return fmt.Errorf("while allocating pseudo-terminal: %w", err)
+	}
+	defer master.Close()
+	// Fd puts the master side in blocking mode, it's called before the
+	// proxying goroutines read from it
+	masterFd := int(master.Fd())
+
+	if err := pty.InheritSize(os.Stdin, master); err != nil {
+		sylog.Debugf("Could not set pseudo-terminal size: %s", err)
+	}
+
+	// the standard error stays separate when it's redirected
+	var stderr io.Writer = os.Stderr
+	if term.IsTerminal(2) {
+		stderr = slave
+	}
+
+	state, err := term.MakeRaw(0)
+	if err != nil {
+		slave.Close()
+		return fmt.Errorf("while setting terminal in raw mode: %w", err)
+	}
+	// the terminal is restored however the container exits
+	restore := func() {
+		if err := term.Restore(0, state); err != nil {
+			sylog.Debugf("Could not restore terminal: %s", err)
+		}
+	}
+	defer restore()
+
+	signals := make(chan os.Signal, 8)
+	osignal.Notify(signals, append(ptySignals, syscall.SIGWINCH)...)
+	defer osignal.Stop(signals)
+
+	cmd, err := starter.Start(
+		registry.ProcName,
+		cfg,
+		starter.UseSuid(useSuid),
+		starter.LoadOverlayModule(loadOverlay),
+		starter.WithStdin(slave),
+		starter.WithStdout(slave),
+		starter.WithStderr(stderr),
+	)
+	// the master side returns EIO once the container processes closed
+	// their descriptors of the slave side
+	slave.Close()
+	if err != nil {
+		return err
+	}
+	l.registerContainer(cmd.Process.Pid)
+
+	go func() {
+		for s := range signals {
+			if s == syscall.SIGWINCH {
+				if err := pty.InheritSize(os.Stdin, master); err != nil {
+					sylog.Debugf("Could not set pseudo-terminal size: %s", err)
+				}
+				continue
+			}
+			forwardPtySignal(masterFd, cmd.Process, s.(syscall.Signal))
+		}
+	}()
+
+	go io.Copy(master, os.Stdin)
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(os.Stdout, master)
+		close(copied)
+	}()
+
+	err = cmd.Wait()
+	select {
+	case <-copied:
+	case <-time.After(ptyDrainTimeout):
+	}
+	restore()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(signalutil.ExitCode(exitErr.Sys().(syscall.WaitStatus)))
+	}
+	return err
+}
+
+// forwardPtySignal sends sig to the foreground process group of the
+// pseudo-terminal, which is the container process or a job it started,
+// or to the starter if there's none.
+func forwardPtySignal(masterFd int, proc *os.Process, sig syscall.Signal) {
+	pgrp, err := unix.IoctlGetInt(masterFd, unix.TIOCGPGRP)
+	if err == nil && pgrp > 0 {
+		if err := unix.Kill(-pgrp, sig); err == nil {
+			return
+		}
+	}
+	sylog.Debugf("Forwarding signal %s to starter", sig)
+	proc.Signal(sig)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launch
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// selfTimeNs is the time namespace of the current process, only present
+// with kernels supporting time namespaces (Linux 5.6 or later).
+const selfTimeNs = "/proc/self/ns/time"
+
+// setTime sets the time namespace requested with --time-offset, and the
+// offset of the realtime clock applied by libfaketime with --faketime, the
+// time namespace not virtualizing the realtime clock.
+func (l *Launcher) setTime() error {
+	if l.cfg.FakeTime != "" {
+		date, err := time.Parse(time.RFC3339, l.cfg.FakeTime)
+		if err != nil {
+			return fmt.Errorf("invalid --faketime date %q, an RFC3339 date like 2006-01-02T15:04:05Z is expected", l.cfg.FakeTime)
+		}
+		offset := time.Until(date).Round(time.Second)
+		sylog.Debugf("Offsetting the realtime clock by %s in the container", offset)
+		l.engineConfig.SetFakeTime(fmt.Sprintf("%+d", int64(offset/time.Second)))
+	}
+
+	if l.cfg.TimeOffsets == "" {
+		return nil
+	}
+	if l.engineConfig.GetInstanceJoin() {
+		return fmt.Errorf("--time-offset can't be used to join an instance, the time namespace of the instance is joined")
+	}
+	if _, err := os.Stat(selfTimeNs); err != nil {
+		return fmt.Errorf("--time-offset requires a time namespace, not supported by this kernel (Linux 5.6 or later is required)")
+	}
+
+	offsets, err := parseTimeOffsets(l.cfg.TimeOffsets)
+	if err != nil {
+		return fmt.Errorf("invalid --time-offset: %w", err)
+	}
+	l.generator.AddOrReplaceLinuxNamespace(specs.TimeNamespace, "")
+	for clock, offset := range offsets {
+		// the nanoseconds of the offsets written to the kernel are positive
+		secs, nsecs := offset/time.Second, offset%time.Second
+		if nsecs < 0 {
+			secs--
+			nsecs += time.Second
+		}
+		l.generator.SetLinuxTimeOffset(clock, int64(secs), uint32(nsecs))
+	}
+	return nil
+}
+
+// parseTimeOffsets parses a comma separated list of clock=offset, the clock
+// being monotonic or boottime and the offset a signed number of seconds or
+// a duration like +24h.
+func parseTimeOffsets(spec string) (map[string]time.Duration, error) {
+	offsets := make(map[string]time.Duration)
+	for _, o := range strings.Split(spec, ",") {
+		clock, value, ok := strings.Cut(strings.TrimSpace(o), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not in the clock=offset format", o)
+		}
+		if clock != "monotonic" && clock != "boottime" {
+			return nil, fmt.Errorf("clock %q not supported, use monotonic or boottime", clock)
+		}
+		var offset time.Duration
+		if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+			offset = time.Duration(secs) * time.Second
+		} else if d, err := time.ParseDuration(value); err == nil {
+			offset = d
+		} else {
+			return nil, fmt.Errorf("offset %q of clock %s is neither a number of seconds nor a duration", value, clock)
+		}
+		offsets[clock] = offset
+	}
+	return offsets, nil
+}
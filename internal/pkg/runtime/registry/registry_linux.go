@@ -0,0 +1,117 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package registry records the containers started with exec, run, shell
+// and test in the user runtime directory, so they can be listed along
+// with instances. A registration is a single small file named after the
+// pid of the starter process, it is garbage collected once this process
+// is gone.
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// ProcName is the process name of the starter running a container
+// started with exec, run, shell or test.
+const ProcName = "Apptainer runtime parent"
+
+// registryPath is the registry directory relative to a runtime directory.
+const registryPath = "apptainer/containers"
+
+// Entry is the registration of a running container.
+type Entry struct {
+	Path string `json:"-"`
+	// Pid is the pid of the starter process, the container processes
+	// are its descendants
+	Pid     int       `json:"pid"`
+	Image   string    `json:"image"`
+	Started time.Time `json:"started"`
+}
+
+// Dir returns the registry directory in the runtime directory.
+func Dir(runtimeDir string) string {
+	return filepath.Join(runtimeDir, registryPath)
+}
+
+// Register writes the registration of the container run by the process
+// e.Pid in the registry of the runtime directory.
+func Register(runtimeDir string, e *Entry) error {
+	dir := Dir(runtimeDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("while creating registry directory: %w", err)
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// write then rename so a reader never sees a partial registration
+	e.Path = filepath.Join(dir, strconv.Itoa(e.Pid)+".json")
+	tmp := e.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("while writing registration: %w", err)
+	}
+	if err := os.Rename(tmp, e.Path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("while writing registration: %w", err)
+	}
+	return nil
+}
+
+// List returns the registrations of the running containers in the
+// registry of the runtime directory, registrations of exited containers
+// are deleted.
+func List(runtimeDir string) ([]*Entry, error) {
+	files, err := filepath.Glob(filepath.Join(Dir(runtimeDir), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, len(files))
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		e := &Entry{Path: file}
+		if err := json.Unmarshal(b, e); err != nil || !isRunning(e.Pid) {
+			sylog.Debugf("Deleting stale container registration %s", file)
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				sylog.Debugf("Could not delete %s: %s", file, err)
+			}
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// isRunning returns whether pid is a starter process running a container,
+// a reused pid doesn't match the starter process name.
+func isRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	d, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(string(d), ProcName)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package registry
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	runtimeDir := t.TempDir()
+
+	// a process named like a starter process
+	cmd := exec.Command("sleep", "60")
+	cmd.Args[0] = ProcName
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("while starting process: %s", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	running := &Entry{Pid: cmd.Process.Pid, Image: "/tmp/running.sif", Started: time.Now()}
+	if err := Register(runtimeDir, running); err != nil {
+		t.Fatalf("while registering container: %s", err)
+	}
+	// a pid not matching a starter process
+	exited := &Entry{Pid: os.Getpid(), Image: "/tmp/exited.sif", Started: time.Now()}
+	if err := Register(runtimeDir, exited); err != nil {
+		t.Fatalf("while registering container: %s", err)
+	}
+	corrupted := filepath.Join(Dir(runtimeDir), "1.json")
+	if err := os.WriteFile(corrupted, []byte("{"), 0o600); err != nil {
+		t.Fatalf("while writing %s: %s", corrupted, err)
+	}
+
+	entries, err := List(runtimeDir)
+	if err != nil {
+		t.Fatalf("while listing containers: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d containers, want 1", len(entries))
+	}
+	if entries[0].Pid != running.Pid || entries[0].Image != running.Image {
+		t.Errorf("got container %+v, want %+v", entries[0], running)
+	}
+
+	for _, path := range []string{exited.Path, corrupted} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("stale registration %s not deleted", path)
+		}
+	}
+}
+
+func TestListNoRegistry(t *testing.T) {
+	entries, err := List(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d containers, want 0", len(entries))
+	}
+}
@@ -48,6 +48,22 @@ func OptSignEntitySelector(f sypgp.EntitySelector) SignOpt {
 	}
 }
 
+// OptSignWithGPGAgent specifies the key keyID of the GnuPG keyring be used to generate
+// signature(s), the signature operation being delegated to gpg-agent so the private key never
+// leaves it.
+func OptSignWithGPGAgent(keyID string) SignOpt {
+	return func(s *signer) error {
+		e, err := sypgp.GPGAgentEntity(keyID)
+		if err != nil {
+			return err
+		}
+
+		s.opts = append(s.opts, integrity.OptSignWithEntity(e))
+
+		return nil
+	}
+}
+
 // OptSignGroup specifies that a signature be applied to cover all objects in the group with the
 // specified groupID. This may be called multiple times to add multiple group signatures.
 func OptSignGroup(groupID uint32) SignOpt {
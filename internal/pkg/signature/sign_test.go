@@ -13,14 +13,20 @@ import (
 	"context"
 	"crypto"
 	"errors"
+	"fmt"
 	"io"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/apptainer/apptainer/pkg/sypgp"
+	"github.com/apptainer/container-key-client/client"
 	"github.com/apptainer/sif/v2/pkg/integrity"
+	"github.com/apptainer/sif/v2/pkg/sif"
 	"github.com/sigstore/sigstore/pkg/cryptoutils"
 	"github.com/sigstore/sigstore/pkg/signature"
 )
@@ -154,3 +160,70 @@ func TestSign(t *testing.T) {
 		})
 	}
 }
+
+// newGPGKey creates a GnuPG home with a new RSA signing key without
+// passphrase, and returns its fingerprint.
+func newGPGKey(t *testing.T) string {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found")
+	}
+	t.Setenv("GNUPGHOME", t.TempDir())
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+	})
+
+	uid := "Test <test@apptainer.org>"
+	gen := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", uid, "rsa2048", "sign", "never")
+	if out, err := gen.CombinedOutput(); err != nil {
+		t.Fatalf("could not generate GnuPG key: %v: %s", err, out)
+	}
+	out, err := exec.Command("gpg", "--batch", "--with-colons", "--list-keys", uid).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Split(line, ":"); fields[0] == "fpr" {
+			return fields[9]
+		}
+	}
+	t.Fatalf("no fingerprint found for %s", uid)
+	return ""
+}
+
+func TestSignWithGPGAgent(t *testing.T) {
+	fingerprint := newGPGKey(t)
+
+	path, err := tempFileFrom(filepath.Join("..", "..", "..", "test", "images", "one-group.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	if err := Sign(context.Background(), path, OptSignWithGPGAgent(fingerprint)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the signature is verified with the public key of the GnuPG keyring
+	e, err := sypgp.GPGAgentEntity(fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(mockHKP{e: e})
+	defer s.Close()
+
+	verified := false
+	cb := func(f *sif.FileImage, r integrity.VerifyResult) bool {
+		verified = r.Error() == nil && fmt.Sprintf("%X", r.Entity().PrimaryKey.Fingerprint) == fingerprint
+		return false
+	}
+	if err := Verify(context.Background(), path, OptVerifyWithPGP(client.OptBaseURL(s.URL)), OptVerifyCallback(cb)); err != nil {
+		t.Fatalf("unexpected verification error: %v", err)
+	}
+	if !verified {
+		t.Errorf("signature of key %s not verified", fingerprint)
+	}
+
+	if err := Sign(context.Background(), path, OptSignWithGPGAgent("unknown@apptainer.org")); err == nil {
+		t.Errorf("unexpected success signing with an unknown key")
+	}
+}
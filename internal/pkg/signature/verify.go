@@ -43,6 +43,7 @@ type verifier struct {
 	svs           []signature.Verifier
 	pgp           bool
 	pgpOpts       []client.Option
+	pgpRemote     string
 	groupIDs      []uint32
 	objectIDs     []uint32
 	all           bool
@@ -97,6 +98,16 @@ func OptVerifyWithPGP(opts ...client.Option) VerifyOpt {
 	}
 }
 
+// OptVerifyWithRemoteKeyring restricts the PGP key material to the local public keyring and to
+// the keyring of the remote name, the keys retrieved from the keyserver being stored in the
+// latter.
+func OptVerifyWithRemoteKeyring(name string) VerifyOpt {
+	return func(v *verifier) error {
+		v.pgpRemote = name
+		return nil
+	}
+}
+
 // OptVerifyWithOCSP subjects the x509 certificate chains to online revocation checks,
 // before the leaf certificate is deemed as trusted for validating the signature.
 func OptVerifyWithOCSP() VerifyOpt {
@@ -223,7 +234,13 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 	// Add PGP key material, if applicable.
 	if v.pgp {
 		var kr openpgp.KeyRing
-		if v.pgpOpts != nil {
+		if v.pgpRemote != "" {
+			rkr, err := sypgp.NewRemoteKeyRing(ctx, v.pgpRemote, v.pgpOpts...)
+			if err != nil {
+				return nil, err
+			}
+			kr = rkr
+		} else if v.pgpOpts != nil {
 			hkr, err := sypgp.NewHybridKeyRing(ctx, v.pgpOpts...)
 			if err != nil {
 				return nil, err
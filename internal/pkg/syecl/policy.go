@@ -0,0 +1,224 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package syecl
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/sypgp"
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// unsignedFormats maps the image formats which can be allowed to run
+// without signature to their image type.
+var unsignedFormats = map[string]int{
+	"sandbox":  image.SANDBOX,
+	"squashfs": image.SQUASHFS,
+	"ext3":     image.EXT3,
+	"tar":      image.TAR,
+}
+
+// SignerPolicy describes the signer policy of apptainer.conf, requiring
+// the images to be signed by trusted signers to run.
+type SignerPolicy struct {
+	// Fingerprints are the fingerprints of the trusted signers, whose keys
+	// are read from the global keyring.
+	Fingerprints []string
+	// KeyDirs are the directories holding the keys of additional trusted
+	// signers.
+	KeyDirs []string
+	// UnsignedTypes are the image types allowed to run without signature.
+	UnsignedTypes []int
+}
+
+// NewSignerPolicy returns the signer policy of the trusted signers, either
+// fingerprints or @ prefixed key directories, and of the image formats
+// allowed to run without signature.
+func NewSignerPolicy(trustedSigners, allowUnsignedFormats []string) (*SignerPolicy, error) {
+	p := &SignerPolicy{}
+
+	for _, s := range trustedSigners {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "":
+		case strings.HasPrefix(s, "@"):
+			dir := strings.TrimPrefix(s, "@")
+			if !filepath.IsAbs(dir) {
+				return nil, fmt.Errorf("trusted keys directory %s must be an absolute path", dir)
+			}
+			p.KeyDirs = append(p.KeyDirs, dir)
+		default:
+			fp := strings.ReplaceAll(s, " ", "")
+			if decoded, err := hex.DecodeString(fp); err != nil || len(decoded) != 20 {
+				return nil, fmt.Errorf("trusted signer %s is not a 40 chars hex fingerprint", s)
+			}
+			p.Fingerprints = append(p.Fingerprints, strings.ToUpper(fp))
+		}
+	}
+
+	for _, f := range allowUnsignedFormats {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		t, ok := unsignedFormats[f]
+		if !ok {
+			return nil, fmt.Errorf("unsigned format %s not supported, use sandbox, squashfs, ext3 or tar", f)
+		}
+		p.UnsignedTypes = append(p.UnsignedTypes, t)
+	}
+
+	return p, nil
+}
+
+// readKeyFile returns the keys of the binary or ASCII armored key file path.
+func readKeyFile(path string) (openpgp.EntityList, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(b)); err == nil {
+		return el, nil
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(b))
+}
+
+// TrustedKeyRing returns the keys of the trusted signers, read from the
+// global keyring kr and from the key directories.
+func (p *SignerPolicy) TrustedKeyRing(kr openpgp.EntityList) (openpgp.EntityList, error) {
+	var trusted openpgp.EntityList
+
+	for _, fp := range p.Fingerprints {
+		found := false
+		for _, e := range kr {
+			if strings.EqualFold(fp, hex.EncodeToString(e.PrimaryKey.Fingerprint)) {
+				trusted = append(trusted, e)
+				found = true
+				break
+			}
+		}
+		if !found {
+			sylog.Warningf("Trusted signer %s not found in the global keyring", fp)
+		}
+	}
+
+	for _, dir := range p.KeyDirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("while reading trusted keys directory: %v", err)
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			el, err := readKeyFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("while reading trusted key %s: %v", path, err)
+			}
+			trusted = append(trusted, el...)
+		}
+	}
+
+	return trusted, nil
+}
+
+// AllowsUnsigned returns whether images of type t can run unsigned.
+func (p *SignerPolicy) AllowsUnsigned(t int) bool {
+	for _, u := range p.UnsignedTypes {
+		if u == t {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckSignerPolicy checks that the image img is signed by one of the
+// trusted signers of the configuration, or has a format allowed to run
+// unsigned. In setuid mode the trusted key directories must be owned by
+// root.
+func CheckSignerPolicy(ctx context.Context, trustedSigners, allowUnsignedFormats []string, img *image.Image, suid bool) error {
+	policy, err := NewSignerPolicy(trustedSigners, allowUnsignedFormats)
+	if err != nil {
+		return err
+	}
+
+	// trusted keys must not be writable by users in setuid mode
+	if suid {
+		for _, dir := range policy.KeyDirs {
+			if !fs.IsOwner(dir, 0) {
+				return fmt.Errorf("%s must be owned by root", dir)
+			}
+		}
+	}
+
+	var global openpgp.EntityList
+	if len(policy.Fingerprints) > 0 {
+		keyring := sypgp.NewHandle(buildcfg.APPTAINER_CONFDIR, sypgp.GlobalHandleOpt())
+		global, err = keyring.LoadPubKeyring()
+		if err != nil {
+			return fmt.Errorf("while obtaining global keyring: %s", err)
+		}
+	}
+
+	trusted, err := policy.TrustedKeyRing(global)
+	if err != nil {
+		return err
+	}
+	return policy.Check(ctx, img, trusted)
+}
+
+// Check checks that the image img can run according to the policy: SIF
+// images must be signed by one of the trusted signers of trusted, the keys
+// embedded in the image being ignored, and the other formats must be
+// allowed to run unsigned.
+func (p *SignerPolicy) Check(ctx context.Context, img *image.Image, trusted openpgp.EntityList) error {
+	if img.Type != image.SIF {
+		if p.AllowsUnsigned(img.Type) {
+			return nil
+		}
+		return fmt.Errorf("image format of %s can't be signed and is not allowed unsigned", img.Path)
+	}
+
+	if len(trusted) == 0 {
+		return fmt.Errorf("no trusted signer key available")
+	}
+
+	f, err := sif.LoadContainer(img.File,
+		sif.OptLoadWithFlag(os.O_RDONLY),
+		sif.OptLoadWithCloseOnUnload(false),
+	)
+	if err != nil {
+		return err
+	}
+	defer f.UnloadContainer()
+
+	v, unvalidatedFingerprints, err := verifyImage(ctx, f, trusted, false)
+	if err != nil {
+		return err
+	}
+
+	egroup := &Execgroup{ListMode: "whitelist"}
+	for _, e := range trusted {
+		egroup.KeyFPs = append(egroup.KeyFPs, hex.EncodeToString(e.PrimaryKey.Fingerprint))
+	}
+	_, err = checkWhiteList(v, egroup, unvalidatedFingerprints)
+	return err
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package syecl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/pkg/image"
+)
+
+func TestNewSignerPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		signers []string
+		formats []string
+		wantErr bool
+	}{
+		{name: "Empty"},
+		{name: "Valid", signers: []string{KeyFP1, "@/etc/apptainer/trusted-keys.d"}, formats: []string{"sandbox", "squashfs", "tar"}},
+		{name: "BadFingerprint", signers: []string{"F34371D0"}, wantErr: true},
+		{name: "RelativeKeyDir", signers: []string{"@trusted-keys.d"}, wantErr: true},
+		{name: "BadFormat", formats: []string{"oci"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSignerPolicy(tt.signers, tt.formats); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignerPolicyCheck(t *testing.T) {
+	dirPath, err := filepath.Abs(filepath.Join("..", "..", "..", "test", "images"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := filepath.Join(dirPath, "one-group-signed-pgp.sif")
+	unsigned := filepath.Join(dirPath, "one-group.sif")
+
+	keyDir := t.TempDir()
+	key, err := os.ReadFile(filepath.Join("..", "..", "..", "test", "keys", "pgp-public.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(keyDir, "pgp-public.asc"), key, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		signers []string
+		formats []string
+		typ     int
+		path    string
+		wantErr bool
+	}{
+		{name: "TrustedFingerprint", typ: image.SIF, signers: []string{KeyFP1}, path: signed},
+		{name: "TrustedKeyDir", typ: image.SIF, signers: []string{"@" + keyDir}, path: signed},
+		{name: "UntrustedSigner", typ: image.SIF, signers: []string{KeyFP2}, path: signed, wantErr: true},
+		{name: "NoTrustedSigner", typ: image.SIF, path: signed, wantErr: true},
+		{name: "Unsigned", typ: image.SIF, signers: []string{KeyFP1}, path: unsigned, wantErr: true},
+		{name: "SandboxRefused", typ: image.SANDBOX, signers: []string{KeyFP1}, path: dirPath, wantErr: true},
+		{name: "SandboxAllowed", typ: image.SANDBOX, signers: []string{KeyFP1}, formats: []string{"sandbox"}, path: dirPath},
+		{name: "TarRefused", typ: image.TAR, signers: []string{KeyFP1}, formats: []string{"sandbox"}, path: unsigned, wantErr: true},
+		{name: "TarAllowed", typ: image.TAR, signers: []string{KeyFP1}, formats: []string{"tar"}, path: unsigned},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewSignerPolicy(tt.signers, tt.formats)
+			if err != nil {
+				t.Fatal(err)
+			}
+			trusted, err := p.TrustedKeyRing(openpgp.EntityList{getTestEntity(t)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			img := &image.Image{Path: tt.path, Type: tt.typ, File: f}
+
+			if err := p.Check(context.Background(), img, trusted); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
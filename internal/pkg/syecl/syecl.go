@@ -208,42 +208,12 @@ func checkBlackList(v *integrity.Verifier, egroup *Execgroup) (ok bool, err erro
 	return true, nil
 }
 
-func shouldRun(ctx context.Context, ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (ok bool, err error) {
-	var egroup *Execgroup
-
-	// look what execgroup a container is part of
-	for _, v := range ecl.ExecGroups {
-		if filepath.Dir(fp.Name()) == v.DirPath {
-			egroup = &v
-			break
-		}
-	}
-	// go back at it and this time look for an empty dirpath execgroup to fallback into
-	if egroup == nil {
-		for _, v := range ecl.ExecGroups {
-			if v.DirPath == "" {
-				egroup = &v
-				break
-			}
-		}
-	}
-
-	if egroup == nil {
-		return false, fmt.Errorf("%s not part of any execgroup", fp.Name())
-	}
-
-	f, err := sif.LoadContainer(fp,
-		sif.OptLoadWithFlag(os.O_RDONLY),
-		sif.OptLoadWithCloseOnUnload(false),
-	)
-	if err != nil {
-		return false, err
-	}
-	defer f.UnloadContainer()
-
-	// Collect unvalidated signature fingerprints via an integrity.VerifyCallback
-	// to allow whitelist or whitestrict checks to ensure all required signatures
-	// have been validated.
+// verifyImage validates the signatures of the image f with the keys of kr,
+// and returns its verifier along with the fingerprints of the signatures
+// which could not be validated, to allow whitelist or whitestrict checks to
+// ensure all required signatures have been validated.
+func verifyImage(ctx context.Context, f *sif.FileImage, kr openpgp.KeyRing, legacy bool) (*integrity.Verifier, [][]byte, error) {
+	// Collect unvalidated signature fingerprints via an integrity.VerifyCallback.
 	unvalidatedFingerprints := make([][]byte, 0)
 	verifyCallback := func(r integrity.VerifyResult) (ignoreError bool) {
 		var sigerr *integrity.SignatureNotValidError
@@ -268,23 +238,64 @@ func shouldRun(ctx context.Context, ecl *EclConfig, fp *os.File, kr openpgp.KeyR
 		integrity.OptVerifyWithKeyRing(kr),
 		integrity.OptVerifyCallback(verifyCallback),
 	}
-	if ecl.Legacy {
+	if legacy {
 		// Legacy behavior is to verify the primary partition only.
 		od, err := f.GetDescriptor(sif.WithPartitionType(sif.PartPrimSys))
 		if err != nil {
-			return false, fmt.Errorf("get primary system partition: %v", err)
+			return nil, nil, fmt.Errorf("get primary system partition: %v", err)
 		}
 		opts = append(opts, integrity.OptVerifyLegacy(), integrity.OptVerifyObject(od.ID()))
 	}
 
 	v, err := integrity.NewVerifier(f, opts...)
 	if err != nil {
-		return false, err
+		return nil, nil, err
 	}
 
 	// Validate signature.
 	if err := v.Verify(); err != nil {
-		return false, fmt.Errorf("image signature not valid: %v", err)
+		return nil, nil, fmt.Errorf("image signature not valid: %v", err)
+	}
+
+	return v, unvalidatedFingerprints, nil
+}
+
+func shouldRun(ctx context.Context, ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (ok bool, err error) {
+	var egroup *Execgroup
+
+	// look what execgroup a container is part of
+	for _, v := range ecl.ExecGroups {
+		if filepath.Dir(fp.Name()) == v.DirPath {
+			egroup = &v
+			break
+		}
+	}
+	// go back at it and this time look for an empty dirpath execgroup to fallback into
+	if egroup == nil {
+		for _, v := range ecl.ExecGroups {
+			if v.DirPath == "" {
+				egroup = &v
+				break
+			}
+		}
+	}
+
+	if egroup == nil {
+		return false, fmt.Errorf("%s not part of any execgroup", fp.Name())
+	}
+
+	f, err := sif.LoadContainer(fp,
+		sif.OptLoadWithFlag(os.O_RDONLY),
+		sif.OptLoadWithCloseOnUnload(false),
+	)
+	if err != nil {
+		return false, err
+	}
+	defer f.UnloadContainer()
+
+	v, unvalidatedFingerprints, err := verifyImage(ctx, f, kr, ecl.Legacy)
+	if err != nil {
+		return false, err
 	}
 
 	// Check fingerprints against policy.
@@ -265,6 +265,15 @@ func Filesystem(t *testing.T, fs string) {
 	}
 }
 
+// TimeNamespace checks that the kernel supports time namespaces
+// (Linux 5.6 or later), if not the current test is skipped with a
+// message.
+func TimeNamespace(t *testing.T) {
+	if _, err := os.Stat("/proc/self/ns/time"); err != nil {
+		t.Skipf("time namespace seems not supported by the kernel")
+	}
+}
+
 // Command checks if the provided command is found
 // in one the path defined in the PATH environment variable,
 // if not found the current test is skipped with a message.
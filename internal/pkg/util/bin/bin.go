@@ -53,8 +53,10 @@ func FindBin(name string) (path string, err error) {
 		"newuidmap",
 		"nvidia-container-cli",
 		"pacstrap",
+		"pasta",
 		"rpm",
 		"rpmkeys",
+		"slirp4netns",
 		"squashfuse",
 		"squashfuse_ll",
 		"SUSEConnect",
@@ -10,6 +10,9 @@
 package env
 
 import (
+	"fmt"
+	"path"
+	"regexp"
 	"strings"
 
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci/generate"
@@ -42,8 +45,45 @@ var alwaysOmitKeys = map[string]bool{
 	"LD_LIBRARY_PATH":     true,
 }
 
+// envPatternRe matches the names and glob patterns accepted by
+// --preserve-env and --unset-env.
+var envPatternRe = regexp.MustCompile(`^[A-Za-z0-9_*?!\[\]-]+$`)
+
 type envKeyMap = map[string]string
 
+// CheckPatterns checks that patterns are environment variable names or
+// glob patterns of names.
+func CheckPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if !envPatternRe.MatchString(p) {
+			return fmt.Errorf("%q is not a variable name or a glob pattern of names", p)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("%q is not a valid glob pattern: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// MatchPatterns returns if key matches one of the glob patterns.
+func MatchPatterns(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if match, _ := path.Match(pattern, key); match {
+			return true
+		}
+	}
+	return false
+}
+
+// mustUnset returns if key matches one of the unset glob patterns. HOME
+// and PATH are always set in the container.
+func mustUnset(key string, unset []string) bool {
+	if key == "HOME" || key == "PATH" {
+		return false
+	}
+	return MatchPatterns(key, unset)
+}
+
 // setKeyIfNotAlreadyOverridden sets a value for key if not already overridden
 func setKeyIfNotAlreadyOverridden(g *generate.Generator, envKeys envKeyMap, prefixedKey, key, value string) {
 	if oldValue, ok := envKeys[key]; ok {
@@ -60,7 +100,8 @@ func setKeyIfNotAlreadyOverridden(g *generate.Generator, envKeys envKeyMap, pref
 }
 
 // overridesForContainerEnv sets all environment variables which have overrides.
-func overridesForContainerEnv(g *generate.Generator, hostEnvs []string) envKeyMap {
+// Overrides of variables matching an unset glob pattern are skipped.
+func overridesForContainerEnv(g *generate.Generator, hostEnvs []string, unset []string) envKeyMap {
 	envKeys := make(envKeyMap)
 	for _, prefix := range ApptainerEnvPrefixes {
 		for _, env := range hostEnvs {
@@ -79,6 +120,10 @@ func overridesForContainerEnv(g *generate.Generator, hostEnvs []string) envKeyMa
 						case "PATH":
 							setKeyIfNotAlreadyOverridden(g, envKeys, e[0], "SING_USER_DEFINED_PATH", e[1])
 						default:
+							if mustUnset(key, unset) {
+								sylog.Verbosef("Not forwarding %s environment variable: unset by --unset-env", e[0])
+								continue
+							}
 							if permitted, ok := alwaysOmitKeys[key]; ok && !permitted {
 								sylog.Warningf("Overriding %s environment variable with %s is not permitted", key, e[0])
 								continue
@@ -125,16 +170,20 @@ func warnDeprecatedEnvUsage(hostEnvs []string) {
 }
 
 // SetContainerEnv cleans environment variables before running the container.
-func SetContainerEnv(g *generate.Generator, hostEnvs []string, cleanEnv bool, homeDest string) map[string]string {
+// The variables matching a glob pattern of allowlist are passed to the
+// container even when cleanEnv is set. The variables matching a glob pattern
+// of unset are neither passed from the host nor overridden, whatever their
+// source, except HOME and PATH.
+func SetContainerEnv(g *generate.Generator, hostEnvs []string, cleanEnv bool, allowlist, unset []string, homeDest string) map[string]string {
 	// allow override with APPTAINERENV_LANG
-	if cleanEnv {
+	if cleanEnv && !mustUnset("LANG", unset) {
 		g.SetProcessEnv("LANG", "C")
 	}
 
 	// process overrides first, order of prefix within the slice of prefixes
 	// determines the precedence between various prefixes
 	warnDeprecatedEnvUsage(hostEnvs)
-	envKeys := overridesForContainerEnv(g, hostEnvs)
+	envKeys := overridesForContainerEnv(g, hostEnvs, unset)
 
 EnvKeys:
 	for _, env := range hostEnvs {
@@ -161,8 +210,13 @@ EnvKeys:
 			}
 		}
 
+		if mustUnset(e[0], unset) {
+			sylog.Verbosef("Not forwarding %s environment variable: unset by --unset-env", e[0])
+			continue EnvKeys
+		}
+
 		// non prefixed environment variables
-		if mustAddToHostEnv(e[0], cleanEnv) {
+		if mustAddToHostEnv(e[0], cleanEnv, allowlist) {
 			if value, ok := envKeys[e[0]]; ok {
 				if value != e[1] {
 					sylog.Warningf("Environment variable %s already has value [%s], will not forward new value [%s] from parent process environment", e[0], value, e[1])
@@ -187,10 +241,13 @@ EnvKeys:
 
 // mustAddToHostEnv processes given key and returns if the environment
 // variable should be added to the container or not.
-func mustAddToHostEnv(key string, cleanEnv bool) bool {
+func mustAddToHostEnv(key string, cleanEnv bool, allowlist []string) bool {
 	if _, ok := alwaysPassKeys[key]; ok {
 		return true
 	}
+	if _, ok := alwaysOmitKeys[key]; !ok && cleanEnv && MatchPatterns(key, allowlist) {
+		return true
+	}
 	if _, ok := alwaysOmitKeys[key]; ok || cleanEnv {
 		return false
 	}
@@ -32,6 +32,8 @@ func TestSetContainerEnv(t *testing.T) {
 	tt := []struct {
 		name            string
 		cleanEnv        bool
+		allowlist       []string
+		unset           []string
 		homeDest        string
 		env             []string
 		processEnv      map[string]string
@@ -181,6 +183,30 @@ func TestSetContainerEnv(t *testing.T) {
 				"Not forwarding APPTAINER_NAME environment variable",
 			},
 		},
+		{
+			name:      "clean envs with allowlist",
+			cleanEnv:  true,
+			allowlist: []string{"SLURM_*", "KRB5CCNAME"},
+			homeDest:  "/home/tester",
+			env: []string{
+				"HOME=/home/john",
+				"PS1=test",
+				"SLURM_JOB_ID=42",
+				"SLURM_NTASKS=4",
+				"KRB5CCNAME=FILE:/tmp/krb5cc_1000",
+				"KRB5_CONFIG=/etc/krb5.conf",
+				"CLEANENV=TRUE",
+			},
+			resultEnv: []string{
+				"LANG=C",
+				"SLURM_JOB_ID=42",
+				"SLURM_NTASKS=4",
+				"KRB5CCNAME=FILE:/tmp/krb5cc_1000",
+				"HOME=/home/tester",
+				"PATH=" + DefaultPath,
+			},
+			apptainerEnv: map[string]string{},
+		},
 		{
 			name:     "always pass keys",
 			cleanEnv: true,
@@ -744,7 +770,7 @@ func TestSetContainerEnv(t *testing.T) {
 					sylog.SetWriter(oldWriter)
 					sylog.SetLevel(oldLevel, true)
 				}()
-				senv = SetContainerEnv(generator, tc.env, tc.cleanEnv, tc.homeDest)
+				senv = SetContainerEnv(generator, tc.env, tc.cleanEnv, tc.allowlist, tc.unset, tc.homeDest)
 			}()
 			for _, requiredOutput := range tc.outputNeeded {
 				if !strings.Contains(output.String(), requiredOutput) {
@@ -766,6 +792,100 @@ func TestSetContainerEnv(t *testing.T) {
 	}
 }
 
+// TestSetContainerEnvPrecedence checks the value of FOO in the container
+// for the combinations of its sources, from the lowest to the highest
+// precedence: the host, --cleanenv with --preserve-env, APPTAINERENV_ (also
+// set by --env and --env-file) and --unset-env. An empty want means that FOO
+// is not set.
+func TestSetContainerEnvPrecedence(t *testing.T) {
+	tests := []struct {
+		name      string
+		host      bool
+		override  bool
+		cleanEnv  bool
+		allowlist []string
+		unset     []string
+		wantHost  string
+		wantEnv   string
+	}{
+		{name: "host", host: true, wantHost: "host"},
+		{name: "host cleanenv", host: true, cleanEnv: true},
+		{name: "host cleanenv preserve", host: true, cleanEnv: true, allowlist: []string{"FOO"}, wantHost: "host"},
+		{name: "host cleanenv preserve glob", host: true, cleanEnv: true, allowlist: []string{"F*"}, wantHost: "host"},
+		{name: "host cleanenv preserve other", host: true, cleanEnv: true, allowlist: []string{"BAR"}},
+		{name: "host unset", host: true, unset: []string{"FOO"}},
+		{name: "host unset glob", host: true, unset: []string{"FO?"}},
+		{name: "host cleanenv preserve unset", host: true, cleanEnv: true, allowlist: []string{"FOO"}, unset: []string{"FOO"}},
+		{name: "override", override: true, wantEnv: "override"},
+		{name: "override cleanenv", override: true, cleanEnv: true, wantEnv: "override"},
+		{name: "override unset", override: true, unset: []string{"FOO"}},
+		{name: "host override", host: true, override: true, wantEnv: "override"},
+		{name: "host override cleanenv preserve", host: true, override: true, cleanEnv: true, allowlist: []string{"FOO"}, wantEnv: "override"},
+		{name: "host override unset", host: true, override: true, unset: []string{"F*"}},
+		{name: "host override unset other", host: true, override: true, unset: []string{"BAR"}, wantEnv: "override"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hostEnv []string
+			if tt.host {
+				hostEnv = append(hostEnv, "FOO=host")
+			}
+			if tt.override {
+				hostEnv = append(hostEnv, ApptainerEnvPrefix+"FOO=override")
+			}
+
+			ociConfig := &oci.Config{}
+			generator := generate.New(&ociConfig.Spec)
+			senv := SetContainerEnv(generator, hostEnv, tt.cleanEnv, tt.allowlist, tt.unset, "/home/tester")
+
+			gotHost := ""
+			for _, e := range ociConfig.Process.Env {
+				if v, ok := strings.CutPrefix(e, "FOO="); ok {
+					gotHost = v
+				}
+			}
+			if gotHost != tt.wantHost {
+				t.Errorf("got FOO=%q from the host, want %q", gotHost, tt.wantHost)
+			}
+			if senv["FOO"] != tt.wantEnv {
+				t.Errorf("got FOO=%q from overrides, want %q", senv["FOO"], tt.wantEnv)
+			}
+		})
+	}
+}
+
+func TestSetContainerEnvUnsetDefaults(t *testing.T) {
+	ociConfig := &oci.Config{}
+	generator := generate.New(&ociConfig.Spec)
+	SetContainerEnv(generator, []string{"HOME=/root", "LANG=en_US.UTF-8"}, true, nil, []string{"*"}, "/home/tester")
+
+	want := []string{"HOME=/home/tester", "PATH=" + DefaultPath}
+	if !equal(t, ociConfig.Process.Env, want) {
+		t.Errorf("unexpected envs:\n want: %v\ngot: %v", want, ociConfig.Process.Env)
+	}
+}
+
+func TestCheckPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		wantErr  bool
+	}{
+		{patterns: []string{"FOO", "SLURM_*", "http_proxy", "LC_[A-Z]*", "A?"}},
+		{patterns: []string{"FOO BAR"}, wantErr: true},
+		{patterns: []string{"FOO;rm"}, wantErr: true},
+		{patterns: []string{"$(id)"}, wantErr: true},
+		{patterns: []string{"FOO["}, wantErr: true},
+		{patterns: []string{""}, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := CheckPatterns(tt.patterns)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckPatterns(%q) returned %v, want error %t", tt.patterns, err, tt.wantErr)
+		}
+	}
+}
+
 // equal tells whether a and b contain the same elements in the
 // same order. A nil argument is equivalent to an empty slice.
 func equal(t *testing.T, a, b []string) bool {
@@ -86,6 +86,12 @@ func GetenvLegacy(key, legacyKey string) string {
 	return val
 }
 
+// IsLocaleKey returns whether key is a locale environment variable
+// (LANG, LANGUAGE or LC_*).
+func IsLocaleKey(key string) bool {
+	return key == "LANG" || key == "LANGUAGE" || strings.HasPrefix(key, "LC_")
+}
+
 // TrimApptainerKey returns the key without APPTAINER_ prefix.
 func TrimApptainerKey(key string) string {
 	return strings.TrimPrefix(key, ApptainerPrefixes[0])
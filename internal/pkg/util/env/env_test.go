@@ -72,6 +72,22 @@ func TestSetFromList(t *testing.T) {
 	}
 }
 
+func TestIsLocaleKey(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	for _, key := range []string{"LANG", "LANGUAGE", "LC_ALL", "LC_TIME"} {
+		if !IsLocaleKey(key) {
+			t.Errorf("%s should be a locale key", key)
+		}
+	}
+	for _, key := range []string{"LANGS", "LC", "PATH", "APPTAINERENV_LANG"} {
+		if IsLocaleKey(key) {
+			t.Errorf("%s should not be a locale key", key)
+		}
+	}
+}
+
 func TestTrimApptainerKey(t *testing.T) {
 	test.DropPrivilege(t)
 	defer test.ResetPrivilege(t)
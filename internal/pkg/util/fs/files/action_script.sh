@@ -28,55 +28,14 @@ alias fg="unsupported_builtin fg"
 alias bg="unsupported_builtin bg"
 
 clear_env() {
-    local IFS=$'\n'
-
-    # disable globbing as __exported_env__ may contain
-    # wildcard evaluated by shell. It can cause serious
-    # performance issue when the current directory contains
-    # a lot of files/directories, see:
-    # https://github.com/apptainer/singularity/issues/5389
-    set -o noglob
-
-    for e in ${__exported_env__}; do
-        key=${e%%=*}
-        case "${key}" in
-        PWD|HOME|OPTIND|UID|GID|SINGULARITY_APPNAME|SINGULARITY_SHELL)
-            ;;
-        APPTAINER_NAME|APPTAINER_CONTAINER|APPTAINER_INSTANCE)
-            readonly "${key}"
-            ;;
-        *)
-            unset "${key}"
-            ;;
-        esac
-    done
-
-    set +o noglob
+    eval "$(clearenv "${__exported_env__}")"
 }
 
 restore_env() {
-    local IFS=$'\n'
-
-    # disable globbing as __exported_env__ and the export
-    # statement below may contain wildcard evaluated by shell.
-    # It can cause serious performance issue when the current
-    # directory contains a lot of files/directories, see:
-    # https://github.com/apptainer/singularity/issues/5389
-    set -o noglob
-
     # restore environment variables which haven't been
     # defined by docker or virtual file above, empty
     # variables are also unset
-    for e in ${__exported_env__}; do
-        key=${e%%=*}
-        if ! test -v "${key}"; then
-            export "${e//'\u000A'/$IFS}"
-        elif test -z "${!key}"; then
-            unset "${key}"
-        fi
-    done
-
-    set +o noglob
+    eval "$(restoreenv "${__exported_env__}")"
 }
 
 clear_env
@@ -131,6 +90,10 @@ fi
 shopt -u expand_aliases
 restore_env
 
+# remove the variables matching --unset-env, after all other
+# environment sources
+source "/.unset-apptainer-env.sh"
+
 # See https://github.com/apptainer/singularity/issues/5340
 # If there is no .singularity.d then a custom PS1 wasn't set.
 # If we were called through a script and PS1 is empty this
@@ -154,6 +117,24 @@ fi
 export APPTAINER_ENVIRONMENT="${APPTAINER_ENVIRONMENT:-/.singularity.d/env/91-environment.sh}"
 export SINGULARITY_ENVIRONMENT=${APPTAINER_ENVIRONMENT}
 
+# fail early with the list of the available apps when the app set
+# with --app doesn't exist, images built by Singularity 2 may provide
+# a default singularity app used for any app name
+if test -n "${SINGULARITY_APPNAME:-}" -a ! -d "/scif/apps/${SINGULARITY_APPNAME:-}/scif" -a ! -d "/scif/apps/singularity/scif"; then
+    __apps__=""
+    for __app__ in /scif/apps/*; do
+        if test -d "${__app__}/scif"; then
+            __apps__="${__apps__:+${__apps__}, }${__app__##*/}"
+        fi
+    done
+    if test -z "${__apps__}"; then
+        sylog error "No app ${SINGULARITY_APPNAME:-} in container: the container has no apps"
+    else
+        sylog error "No app ${SINGULARITY_APPNAME:-} in container: available apps are ${__apps__}"
+    fi
+    exit 1
+fi
+
 sylog debug "Running action command ${__apptainer_cmd__}"
 
 case "${__apptainer_cmd__}" in
@@ -176,10 +157,10 @@ run)
     if test -n "${SINGULARITY_APPNAME:-}"; then
         if test -x "/scif/apps/${SINGULARITY_APPNAME:-}/scif/runscript"; then
             exec "/scif/apps/${SINGULARITY_APPNAME:-}/scif/runscript" "$@"
-		elif test -x "/scif/apps/singularity/scif/test"; then
-            exec "/scif/apps/singularity/scif/test" "$@"
+        elif test -x "/scif/apps/singularity/scif/runscript"; then
+            exec "/scif/apps/singularity/scif/runscript" "$@"
         fi
-        sylog error "no runscript for contained app: ${SINGULARITY_APPNAME:-}"
+        sylog error "No runscript for contained app: ${SINGULARITY_APPNAME:-}"
         exit 1
     elif test -x "/.singularity.d/runscript"; then
         exec "/.singularity.d/runscript" "$@"
@@ -196,7 +177,7 @@ test)
     if test -n "${SINGULARITY_APPNAME:-}"; then
         if test -x "/scif/apps/${SINGULARITY_APPNAME:-}/scif/test"; then
             exec "/scif/apps/${SINGULARITY_APPNAME:-}/scif/test" "$@"
-		elif test -x "/scif/apps/singularity/scif/test"; then
+        elif test -x "/scif/apps/singularity/scif/test"; then
             exec "/scif/apps/singularity/scif/test" "$@"
         fi
         sylog error "No tests for contained app: ${SINGULARITY_APPNAME:-}"
@@ -211,8 +192,8 @@ start)
     if test -n "${SINGULARITY_APPNAME:-}"; then
         if test -x "/scif/apps/${SINGULARITY_APPNAME:-}/scif/startscript"; then
             exec "/scif/apps/${SINGULARITY_APPNAME:-}/scif/startscript" "$@"
-		elif test -x "/scif/apps/singularity/scif/test"; then
-            exec "/scif/apps/singularity/scif/test" "$@"
+        elif test -x "/scif/apps/singularity/scif/startscript"; then
+            exec "/scif/apps/singularity/scif/startscript" "$@"
         fi
         sylog error "No startscript for contained app: ${SINGULARITY_APPNAME:-}"
         exit 1
@@ -12,6 +12,8 @@ package files
 import (
 	"bytes"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/apptainer/apptainer/internal/pkg/test"
@@ -68,6 +70,67 @@ func TestHostname(t *testing.T) {
 	}
 }
 
+func TestHosts(t *testing.T) {
+	base := []byte("127.0.0.1 localhost\n127.0.1.1 host.example.org host\n::1 localhost\n")
+
+	tests := []struct {
+		name       string
+		hostname   string
+		domainname string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:     "hostname",
+			hostname: "mycontainer",
+			want:     "127.0.1.1\tmycontainer\n127.0.0.1 localhost\n::1 localhost\n",
+		},
+		{
+			name:       "domainname",
+			hostname:   "mycontainer",
+			domainname: "example.com",
+			want:       "127.0.1.1\tmycontainer.example.com mycontainer\n127.0.0.1 localhost\n::1 localhost\n",
+		},
+		{
+			name:     "qualified hostname",
+			hostname: "mycontainer.example.com",
+			want:     "127.0.1.1\tmycontainer.example.com mycontainer\n127.0.0.1 localhost\n::1 localhost\n",
+		},
+		{
+			name:    "no hostname",
+			wantErr: true,
+		},
+		{
+			name:     "bad hostname",
+			hostname: "bad|hostname",
+			wantErr:  true,
+		},
+		{
+			name:       "bad domainname",
+			hostname:   "mycontainer",
+			domainname: "bad_domain",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := Hosts(base, tt.hostname, tt.domainname)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("should have failed with hostname %q and domainname %q", tt.hostname, tt.domainname)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("Hosts returns %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
+
 func TestResolvConf(t *testing.T) {
 	test.DropPrivilege(t)
 	defer test.ResetPrivilege(t)
@@ -88,3 +151,121 @@ func TestResolvConf(t *testing.T) {
 		t.Errorf("ResolvConf returns a bad content")
 	}
 }
+
+func TestDNSConfig(t *testing.T) {
+	host := ParseResolvConf([]byte(`# generated
+nameserver 192.168.1.1
+nameserver fd00::1
+domain example.com
+search old.example.com
+search example.com corp.example.com
+options ndots:2
+options edns0
+`))
+	want := DNSConfig{
+		Nameservers: []string{"192.168.1.1", "fd00::1"},
+		Domain:      "example.com",
+		Search:      []string{"example.com", "corp.example.com"},
+		Options:     []string{"ndots:2", "edns0"},
+	}
+	if !reflect.DeepEqual(host, want) {
+		t.Fatalf("got %+v, want %+v", host, want)
+	}
+
+	cni := DNSConfig{
+		Nameservers: []string{"10.22.0.1", "192.168.1.1"},
+		Search:      []string{"cni.local", "example.com"},
+	}
+	merged := MergeDNS(cni, host)
+	content, err := merged.Content()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	wantContent := `nameserver 10.22.0.1
+nameserver 192.168.1.1
+nameserver fd00::1
+domain example.com
+search cni.local example.com corp.example.com
+options ndots:2 edns0
+`
+	if string(content) != wantContent {
+		t.Errorf("got content:\n%s\nwant:\n%s", content, wantContent)
+	}
+
+	if _, err := (DNSConfig{Nameservers: []string{"dns.example.com"}}).Content(); err == nil {
+		t.Errorf("unexpected success with a bad nameserver")
+	}
+	if !(DNSConfig{}).Empty() || cni.Empty() {
+		t.Errorf("unexpected empty configuration")
+	}
+}
+
+func TestLocaltime(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir := t.TempDir()
+
+	defer func(z, l string) {
+		hostZoneinfoDir, hostLocaltime = z, l
+	}(hostZoneinfoDir, hostLocaltime)
+
+	hostZoneinfoDir = filepath.Join(dir, "zoneinfo")
+	hostLocaltime = filepath.Join(dir, "localtime")
+
+	tzif := []byte("TZif2 fake content")
+	if err := os.MkdirAll(filepath.Join(hostZoneinfoDir, "Europe"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hostZoneinfoDir, "Europe", "Paris"), tzif, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hostZoneinfoDir, "notzif"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(hostZoneinfoDir, "Europe", "Paris"), hostLocaltime); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tz := range []string{"", "/etc/passwd", "../passwd", "Europe/../../passwd", "Europe", "Mars/Olympus"} {
+		if _, err := ResolveTimezone(tz); err == nil {
+			t.Errorf("should have failed with timezone %q", tz)
+		}
+	}
+
+	zone, err := ResolveTimezone("Europe/Paris")
+	if err != nil || zone != "Europe/Paris" {
+		t.Errorf("unexpected zone %q: %v", zone, err)
+	}
+	zone, err = ResolveTimezone(TimezoneHost)
+	if err != nil || zone != "Europe/Paris" {
+		t.Errorf("unexpected host zone %q: %v", zone, err)
+	}
+	content, err := Localtime(zone)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !bytes.Equal(content, tzif) {
+		t.Errorf("Localtime returns a bad content")
+	}
+	if _, err := Localtime("notzif"); err == nil {
+		t.Errorf("should have failed with a non timezone information file")
+	}
+
+	// host localtime not linked to the timezone database
+	if err := os.Remove(hostLocaltime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hostLocaltime, tzif, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	zone, err = ResolveTimezone(TimezoneHost)
+	if err != nil || zone != TimezoneHost {
+		t.Errorf("unexpected host zone %q: %v", zone, err)
+	}
+	content, err = Localtime(zone)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !bytes.Equal(content, tzif) {
+		t.Errorf("Localtime returns a bad content")
+	}
+}
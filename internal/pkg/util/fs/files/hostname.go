@@ -10,8 +10,11 @@
 package files
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/apptainer/apptainer/pkg/sylog"
 )
@@ -32,3 +35,48 @@ func Hostname(hostname string) (content []byte, err error) {
 	content = append(content, line...)
 	return content, nil
 }
+
+// hostnameAddress is the address the hostname is mapped to in the hosts file,
+// as done by Debian, instead of a network interface address.
+const hostnameAddress = "127.0.1.1"
+
+// Hosts creates a hosts content from content, with a first line mapping
+// 127.0.1.1 to the hostname qualified by domainname, if not empty, and to
+// the short hostname. The 127.0.1.1 lines of content are removed, the first
+// line matching a name being the one resolving the hostname.
+func Hosts(content []byte, hostname, domainname string) ([]byte, error) {
+	sylog.Verbosef("Creating hosts content\n")
+	if hostname == "" {
+		return nil, fmt.Errorf("no hostname provided")
+	}
+	r := regexp.MustCompile(hostRegex)
+	if !r.MatchString(hostname) {
+		return nil, fmt.Errorf("%s is not a valid hostname", hostname)
+	}
+	fqdn := hostname
+	if domainname != "" {
+		if !r.MatchString(domainname) {
+			return nil, fmt.Errorf("%s is not a valid domain name", domainname)
+		}
+		fqdn = hostname + "." + domainname
+	}
+	names := fqdn
+	if short, _, _ := strings.Cut(hostname, "."); short != fqdn {
+		names += " " + short
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\t%s\n", hostnameAddress, names)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] == hostnameAddress {
+			continue
+		}
+		b.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("while reading hosts content: %s", err)
+	}
+	return b.Bytes(), nil
+}
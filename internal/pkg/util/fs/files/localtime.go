@@ -0,0 +1,104 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+const (
+	// TimezoneHost is the timezone value selecting the host timezone.
+	TimezoneHost = "host"
+	// ZoneinfoDir is the directory holding the timezone database.
+	ZoneinfoDir = "/usr/share/zoneinfo"
+)
+
+// host paths, variables to allow testing
+var (
+	hostZoneinfoDir = ZoneinfoDir
+	hostLocaltime   = "/etc/localtime"
+)
+
+// ResolveTimezone returns the zone name corresponding to tz, which is
+// either an Area/City zone name or TimezoneHost. For the host timezone,
+// the zone name is taken from the /etc/localtime symlink, TimezoneHost
+// is returned when /etc/localtime isn't a link to the timezone database.
+func ResolveTimezone(tz string) (string, error) {
+	if tz != TimezoneHost {
+		if _, err := zoneFile(tz); err != nil {
+			return "", err
+		}
+		return tz, nil
+	}
+
+	target, err := filepath.EvalSymlinks(hostLocaltime)
+	if err != nil {
+		return "", fmt.Errorf("while resolving host timezone: %s", err)
+	}
+	dir, err := filepath.EvalSymlinks(hostZoneinfoDir)
+	if err == nil {
+		if zone, err := filepath.Rel(dir, target); err == nil && validZone(zone) {
+			sylog.Debugf("Host timezone is %s", zone)
+			return zone, nil
+		}
+	}
+	sylog.Debugf("No zone name found for host timezone %s", target)
+	return TimezoneHost, nil
+}
+
+// Localtime returns the content of the zoneinfo file of the zone returned
+// by ResolveTimezone.
+func Localtime(zone string) (content []byte, err error) {
+	sylog.Verbosef("Creating localtime content\n")
+	path := hostLocaltime
+	if zone != TimezoneHost {
+		path, err = zoneFile(zone)
+		if err != nil {
+			return nil, err
+		}
+	}
+	content, err = os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// only accept timezone information files
+	if !bytes.HasPrefix(content, []byte("TZif")) {
+		return nil, fmt.Errorf("%s is not a timezone information file", path)
+	}
+	return content, nil
+}
+
+// zoneFile returns the host zoneinfo file path of zone.
+func zoneFile(zone string) (string, error) {
+	if !validZone(zone) {
+		return "", fmt.Errorf("%q is not a valid timezone name", zone)
+	}
+	path := filepath.Join(hostZoneinfoDir, zone)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("timezone %s not found in %s", zone, hostZoneinfoDir)
+	}
+	if !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a timezone information file", path)
+	}
+	return path, nil
+}
+
+func validZone(zone string) bool {
+	return zone != "" && zone != "." &&
+		!filepath.IsAbs(zone) &&
+		filepath.Clean(zone) == zone &&
+		zone != ".." && !strings.HasPrefix(zone, "../")
+}
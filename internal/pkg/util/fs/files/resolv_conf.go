@@ -10,24 +10,106 @@
 package files
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"net"
+	"strings"
 
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/slice"
 )
 
+// DNSConfig is the resolver configuration held by a resolv.conf file.
+type DNSConfig struct {
+	Nameservers []string
+	Domain      string
+	Search      []string
+	Options     []string
+}
+
+// Empty returns whether the configuration has no entry.
+func (c DNSConfig) Empty() bool {
+	return len(c.Nameservers) == 0 && c.Domain == "" && len(c.Search) == 0 && len(c.Options) == 0
+}
+
+// ParseResolvConf returns the resolver configuration of the resolv.conf
+// content, comments and unknown keywords are ignored.
+func ParseResolvConf(content []byte) DNSConfig {
+	var c DNSConfig
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			c.Nameservers = append(c.Nameservers, fields[1])
+		case "domain":
+			c.Domain = fields[1]
+		case "search":
+			// the last search line wins
+			c.Search = fields[1:]
+		case "options":
+			c.Options = append(c.Options, fields[1:]...)
+		}
+	}
+	return c
+}
+
+// MergeDNS returns the configuration with the entries of first followed
+// by the ones of second not already in first. The domain of second is
+// only used if first has none.
+func MergeDNS(first, second DNSConfig) DNSConfig {
+	merge := func(a, b []string) []string {
+		merged := append([]string{}, a...)
+		for _, v := range b {
+			if !slice.ContainsString(merged, v) {
+				merged = append(merged, v)
+			}
+		}
+		return merged
+	}
+	c := DNSConfig{
+		Nameservers: merge(first.Nameservers, second.Nameservers),
+		Domain:      first.Domain,
+		Search:      merge(first.Search, second.Search),
+		Options:     merge(first.Options, second.Options),
+	}
+	if c.Domain == "" {
+		c.Domain = second.Domain
+	}
+	return c
+}
+
+// Content returns the resolv.conf content of the configuration, the
+// nameservers must be IP addresses.
+func (c DNSConfig) Content() ([]byte, error) {
+	var b bytes.Buffer
+	for _, ip := range c.Nameservers {
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("dns ip %s is not a valid IP address", ip)
+		}
+		fmt.Fprintf(&b, "nameserver %s\n", ip)
+	}
+	if c.Domain != "" {
+		fmt.Fprintf(&b, "domain %s\n", c.Domain)
+	}
+	if len(c.Search) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(c.Search, " "))
+	}
+	if len(c.Options) > 0 {
+		fmt.Fprintf(&b, "options %s\n", strings.Join(c.Options, " "))
+	}
+	return b.Bytes(), nil
+}
+
 // ResolvConf creates a resolv.conf content with provided dns list and returns it
 func ResolvConf(dns []string) (content []byte, err error) {
 	sylog.Verbosef("Creating resolv.conf content\n")
 	if len(dns) == 0 {
 		return content, fmt.Errorf("no dns ip provided")
 	}
-	for _, ip := range dns {
-		if net.ParseIP(ip) == nil {
-			return content, fmt.Errorf("dns ip %s is not a valid IP address", ip)
-		}
-		line := fmt.Sprintf("nameserver %s\n", ip)
-		content = append(content, line...)
-	}
-	return content, nil
+	return DNSConfig{Nameservers: dns}.Content()
 }
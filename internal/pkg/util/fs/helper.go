@@ -347,7 +347,7 @@ func CopyFile(from, to string, mode os.FileMode) (err error) {
 	}
 	defer srcFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
+	err = copyData(dstFile, srcFile)
 	if err != nil {
 		return fmt.Errorf("could not copy file: %v", err)
 	}
@@ -385,7 +385,7 @@ func CopyFileAtomic(from, to string, mode os.FileMode) (err error) {
 	}
 	defer srcFile.Close()
 
-	_, err = io.Copy(tmpFile, srcFile)
+	err = copyData(tmpFile, srcFile)
 	if err != nil {
 		return fmt.Errorf("could not copy file: %v", err)
 	}
@@ -400,6 +400,83 @@ func CopyFileAtomic(from, to string, mode os.FileMode) (err error) {
 	return nil
 }
 
+// CloneFile makes the empty file dst share the data of src with a
+// reflink. It fails if the filesystem doesn't support reflinks, or if the
+// files aren't on the same filesystem. As the data is copied on write, the
+// files can then be modified independently.
+func CloneFile(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
+
+// copyData copies the content of src to the empty file dst, with a reflink
+// when the filesystem supports it.
+func copyData(dst, src *os.File) error {
+	if err := CloneFile(dst, src); err == nil {
+		return nil
+	}
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+// Methods used by ShareFile to share the content of a file.
+const (
+	ShareReflink  = "reflink"
+	ShareHardlink = "hardlink"
+	ShareCopy     = "copy"
+)
+
+// ShareFile creates the file to with the content of the file from, with a
+// reflink when the filesystem supports it, or else a hard link, or else a
+// copy. A hard link shares the file itself, so ShareFile must only be used
+// for files never modified in place, like content-addressed blobs. It
+// returns the method used to share the file. The file to must not exist.
+func ShareFile(from, to string) (string, error) {
+	srcFile, err := os.Open(from)
+	if err != nil {
+		return "", fmt.Errorf("could not open file to share: %v", err)
+	}
+	defer srcFile.Close()
+	fi, err := srcFile.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	tmpFile, err := MakeTmpFile(filepath.Dir(to), "tmp-share-", fi.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+	if err := CloneFile(tmpFile, srcFile); err == nil {
+		if err := tmpFile.Close(); err != nil {
+			return "", err
+		}
+		if err := os.Link(tmpFile.Name(), to); err != nil {
+			return "", fmt.Errorf("could not create %s: %v", to, err)
+		}
+		return ShareReflink, nil
+	}
+
+	if err := os.Link(from, to); err == nil {
+		return ShareHardlink, nil
+	} else if os.IsExist(err) {
+		return "", fmt.Errorf("could not create %s: %v", to, err)
+	}
+
+	if err := copyData(tmpFile, srcFile); err != nil {
+		return "", fmt.Errorf("could not copy file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Link(tmpFile.Name(), to); err != nil {
+		return "", fmt.Errorf("could not create %s: %v", to, err)
+	}
+	return ShareCopy, nil
+}
+
 // IsReadable returns true if the file that is passed in
 // is readable by the user (note: uid is checked, not euid).
 func IsReadable(path string) bool {
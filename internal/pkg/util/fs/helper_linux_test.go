@@ -552,6 +552,36 @@ func TestCopyFileAtomic(t *testing.T) {
 	testCopyFileFunc(t, CopyFileAtomic)
 }
 
+func TestShareFile(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from")
+	if err := os.WriteFile(from, []byte("blob"), 0o444); err != nil {
+		t.Fatal(err)
+	}
+
+	to := filepath.Join(dir, "to")
+	how, err := ShareFile(from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, err := os.ReadFile(to); err != nil || string(b) != "blob" {
+		t.Errorf("unexpected content %q of shared file: %v", b, err)
+	}
+	fi, _ := os.Stat(from)
+	ti, _ := os.Stat(to)
+	if linked := os.SameFile(fi, ti); linked != (how == ShareHardlink) {
+		t.Errorf("file shared with %s, but hard-linked: %v", how, linked)
+	}
+
+	// an existing file isn't replaced
+	if _, err := ShareFile(from, to); err == nil {
+		t.Errorf("unexpected success sharing to an existing file")
+	}
+}
+
 func TestIsWritable(t *testing.T) {
 	test.EnsurePrivilege(t)
 
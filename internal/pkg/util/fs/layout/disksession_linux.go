@@ -0,0 +1,169 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package layout
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+const (
+	diskSessionPrefix    = "apptainer-session-"
+	diskSessionTmpPrefix = ".apptainer-session-"
+)
+
+// DiskSession is a private directory created on disk and used as the
+// backing store of a session directory instead of a memory filesystem.
+// The directory is locked for the lifetime of the process which created
+// it, a directory found unlocked is considered stale and is removed by
+// the next call to NewDiskSession with the same parent directory.
+type DiskSession struct {
+	Path string
+	lock *os.File
+}
+
+// NewDiskSession removes stale session directories left in parent by
+// processes which didn't exit cleanly and creates a new locked session
+// directory with 0700 permissions.
+func NewDiskSession(parent string) (*DiskSession, error) {
+	if !filepath.IsAbs(parent) {
+		return nil, fmt.Errorf("session directory %s is not an absolute path", parent)
+	}
+	fi, err := os.Stat(parent)
+	if err != nil {
+		return nil, fmt.Errorf("while checking session directory %s: %s", parent, err)
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("session directory %s is not a directory", parent)
+	}
+
+	for _, stale := range CleanStaleDiskSessions(parent) {
+		sylog.Verbosef("Removed stale session directory %s", stale)
+	}
+
+	// the directory is created and locked under a temporary name
+	// so a concurrent cleanup can't remove it before it's locked
+	tmp, err := os.MkdirTemp(parent, diskSessionTmpPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("while creating session directory in %s: %s", parent, err)
+	}
+	if err := os.Chmod(tmp, 0o700); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("while setting session directory permissions: %s", err)
+	}
+
+	lock, err := lockDir(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	path := filepath.Join(parent, diskSessionPrefix+strings.TrimPrefix(filepath.Base(tmp), diskSessionTmpPrefix))
+	if err := os.Rename(tmp, path); err != nil {
+		lock.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("while renaming session directory %s: %s", tmp, err)
+	}
+
+	return &DiskSession{Path: path, lock: lock}, nil
+}
+
+// PlannedDiskSession returns the session directory NewDiskSession would
+// create in parent, without creating it, the random part of its name
+// being replaced by '*'. The returned session can't be removed.
+func PlannedDiskSession(parent string) *DiskSession {
+	return &DiskSession{Path: filepath.Join(parent, diskSessionPrefix+"*")}
+}
+
+// Remove deletes the session directory and releases its lock.
+func (d *DiskSession) Remove() error {
+	defer d.lock.Close()
+	return removeDir(d.Path)
+}
+
+// CleanStaleDiskSessions removes the session directories owned by the
+// current user in parent which are not locked anymore, and returns the
+// list of removed directories.
+func CleanStaleDiskSessions(parent string) []string {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		sylog.Debugf("Could not read session directory %s: %s", parent, err)
+		return nil
+	}
+
+	removed := make([]string, 0)
+	uid := uint32(os.Geteuid())
+
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() {
+			continue
+		}
+		if !strings.HasPrefix(name, diskSessionPrefix) && !strings.HasPrefix(name, diskSessionTmpPrefix) {
+			continue
+		}
+		path := filepath.Join(parent, name)
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); !ok || st.Uid != uid {
+			continue
+		}
+		lock, err := lockDir(path)
+		if err != nil {
+			// still in use by a running container
+			continue
+		}
+		err = removeDir(path)
+		lock.Close()
+		if err != nil {
+			sylog.Debugf("Could not remove stale session directory %s: %s", path, err)
+			continue
+		}
+		removed = append(removed, path)
+	}
+
+	return removed
+}
+
+// lockDir takes a non-blocking exclusive lock on the directory path.
+func lockDir(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_DIRECTORY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("while opening session directory %s: %s", path, err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("while locking session directory %s: %s", path, err)
+	}
+	return f, nil
+}
+
+// removeDir removes path and its content, it restores write permission
+// on directories to not be stopped by read-only directories created
+// by the container.
+func removeDir(path string) error {
+	if err := os.RemoveAll(path); err == nil {
+		return nil
+	}
+	//nolint:errcheck
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			os.Chmod(p, 0o700)
+		}
+		return nil
+	})
+	return os.RemoveAll(path)
+}
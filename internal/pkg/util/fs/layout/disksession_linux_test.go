@@ -0,0 +1,95 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package layout
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewDiskSession(t *testing.T) {
+	parent := t.TempDir()
+
+	if _, err := NewDiskSession("relative/path"); err == nil {
+		t.Errorf("unexpected success with a relative path")
+	}
+	if _, err := NewDiskSession(filepath.Join(parent, "missing")); err == nil {
+		t.Errorf("unexpected success with a non-existent directory")
+	}
+
+	session, err := NewDiskSession(parent)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !strings.HasPrefix(filepath.Base(session.Path), diskSessionPrefix) {
+		t.Errorf("unexpected session directory name %s", session.Path)
+	}
+	fi, err := os.Stat(session.Path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o700 {
+		t.Errorf("unexpected session directory permissions %o", perm)
+	}
+
+	// a locked session directory must not be considered stale
+	if removed := CleanStaleDiskSessions(parent); len(removed) != 0 {
+		t.Errorf("locked session directory removed: %v", removed)
+	}
+
+	if err := session.Remove(); err != nil {
+		t.Errorf("unexpected error while removing session directory: %s", err)
+	}
+	if _, err := os.Stat(session.Path); !os.IsNotExist(err) {
+		t.Errorf("session directory %s still exists", session.Path)
+	}
+}
+
+func TestCleanStaleDiskSessions(t *testing.T) {
+	parent := t.TempDir()
+
+	// simulate a session directory left by a killed process,
+	// with a read-only directory created by the container
+	stale := filepath.Join(parent, diskSessionPrefix+"stale")
+	readOnly := filepath.Join(stale, "final", "ro")
+	if err := os.MkdirAll(readOnly, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(readOnly, "file"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(readOnly, 0o500); err != nil {
+		t.Fatal(err)
+	}
+
+	// unrelated directory must be left untouched
+	other := filepath.Join(parent, "other")
+	if err := os.Mkdir(other, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := NewDiskSession(parent)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer session.Remove()
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale session directory %s still exists", stale)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("unrelated directory %s removed: %s", other, err)
+	}
+	if _, err := os.Stat(session.Path); err != nil {
+		t.Errorf("session directory %s doesn't exist: %s", session.Path, err)
+	}
+}
@@ -35,6 +35,7 @@ type file struct {
 
 type dir struct {
 	created bool
+	path    string
 	mode    os.FileMode
 	uid     int
 	gid     int
@@ -166,7 +167,7 @@ func (m *Manager) createParentDir(path string) {
 		p += "/" + s
 		if s != "" {
 			if _, ok := m.entries[p]; !ok {
-				d := &dir{mode: m.DirMode, uid: uid, gid: gid}
+				d := &dir{path: p, mode: m.DirMode, uid: uid, gid: gid}
 				m.entries[p] = d
 				m.dirs = append(m.dirs, d)
 				// check if the parent directory is part of the overridden
@@ -203,7 +204,7 @@ func (m *Manager) SetRootPath(path string) error {
 	if m.FileMode == 0o000 {
 		m.FileMode = fileMode
 	}
-	d := &dir{mode: m.DirMode, uid: os.Getuid(), gid: os.Getgid()}
+	d := &dir{path: "/", mode: m.DirMode, uid: os.Getuid(), gid: os.Getgid()}
 	m.entries["/"] = d
 	m.dirs = append(m.dirs, d)
 	return nil
@@ -329,27 +330,20 @@ func (m *Manager) sync() error {
 	oldmask := m.VFS.Umask(0)
 	defer m.VFS.Umask(oldmask)
 
+	// directories are created in a single pass, parent directories
+	// being always added before their children
 	for _, d := range m.dirs[1:] {
 		if d.created {
 			continue
 		}
-		path := ""
-		for p, e := range m.entries {
-			if e == d {
-				path = m.rootPath + p
-				for _, ovDir := range m.ovDirs[p] {
-					if _, err := m.VFS.Stat(ovDir); err != nil {
-						if err := m.VFS.Mkdir(ovDir, m.DirMode); err != nil {
-							return fmt.Errorf("failed to create %s directory: %s", ovDir, err)
-						}
-					}
+		path := m.rootPath + d.path
+		for _, ovDir := range m.ovDirs[d.path] {
+			if _, err := m.VFS.Stat(ovDir); err != nil {
+				if err := m.VFS.Mkdir(ovDir, m.DirMode); err != nil {
+					return fmt.Errorf("failed to create %s directory: %s", ovDir, err)
 				}
-				break
 			}
 		}
-		if path == "" {
-			continue
-		}
 		if d.mode != m.DirMode {
 			if err := m.VFS.Mkdir(path, d.mode); err != nil {
 				if !os.IsExist(err) {
@@ -26,17 +26,36 @@ const (
 // Session directory layout manager
 type Session struct {
 	*Manager
-	Layer layer
+	Layer Layer
 }
 
 // Layer describes a layer interface added on top of session layout
-type layer interface {
+type Layer interface {
 	Add(*Session, *mount.System) error
 	Dir() string
 }
 
 // NewSession creates and returns a session directory layout manager
-func NewSession(path string, fstype string, size int, system *mount.System, layer layer) (*Session, error) {
+func NewSession(path string, fstype string, size int, system *mount.System, layer Layer) (*Session, error) {
+	options := "mode=1777"
+	if size > 0 {
+		options = fmt.Sprintf("mode=1777,size=%dm", size)
+	}
+	return newSession(path, system, layer, func() error {
+		return system.Points.AddFS(mount.SessionTag, path, fstype, syscall.MS_NOSUID, options)
+	})
+}
+
+// NewDiskBackedSession creates and returns a session directory layout
+// manager where the session directory is bind mounted from the host
+// directory source instead of being a memory filesystem
+func NewDiskBackedSession(path string, source string, system *mount.System, layer Layer) (*Session, error) {
+	return newSession(path, system, layer, func() error {
+		return system.Points.AddBind(mount.SessionTag, source, path, syscall.MS_NOSUID)
+	})
+}
+
+func newSession(path string, system *mount.System, layer Layer, addSessionMount func() error) (*Session, error) {
 	manager := &Manager{VFS: DefaultVFS}
 	session := &Session{Manager: manager}
 
@@ -49,12 +68,7 @@ func NewSession(path string, fstype string, size int, system *mount.System, laye
 	if err := manager.AddDir(finalDir); err != nil {
 		return nil, err
 	}
-	options := "mode=1777"
-	if size > 0 {
-		options = fmt.Sprintf("mode=1777,size=%dm", size)
-	}
-	err := system.Points.AddFS(mount.SessionTag, path, fstype, syscall.MS_NOSUID, options)
-	if err != nil {
+	if err := addSessionMount(); err != nil {
 		return nil, err
 	}
 	if err := system.RunAfterTag(mount.SessionTag, session.createLayout); err != nil {
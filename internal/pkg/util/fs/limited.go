@@ -0,0 +1,47 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// fuseMagic is the statfs type of the FUSE filesystems.
+const fuseMagic = 0x65735546
+
+// IsLimitedFs reports whether the file path is stored on a FUSE filesystem
+// without support for shared memory mappings, like the s3fs or rclone
+// mounts of object stores, serving the file with direct I/O only. Such
+// files can't reliably back a loop device, but can be read by squashfuse.
+func IsLimitedFs(path string) (bool, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false, err
+	}
+	if int64(st.Type) != fuseMagic {
+		return false, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	b, err := unix.Mmap(int(f.Fd()), 0, os.Getpagesize(), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		sylog.Debugf("Shared memory mapping of %s on a FUSE filesystem failed: %v", path, err)
+		return true, nil
+	}
+	unix.Munmap(b)
+	return false, nil
+}
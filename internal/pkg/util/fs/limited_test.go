@@ -0,0 +1,35 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsLimitedFs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "image.sif")
+	if err := os.WriteFile(file, []byte("image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the mounts of the FUSE filesystems are covered by the e2e tests
+	limited, err := IsLimitedFs(file)
+	if err != nil {
+		t.Fatalf("unexpected error for %s: %s", file, err)
+	}
+	if limited {
+		t.Errorf("%s reported on a limited filesystem", file)
+	}
+
+	if _, err := IsLimitedFs(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("unexpected success for a missing file")
+	}
+}
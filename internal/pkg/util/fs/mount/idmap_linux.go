@@ -0,0 +1,79 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mount
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// IDMapTree returns a file descriptor of a detached ID-mapped bind mount
+// of source, which can be attached with move_mount, where uid and gid on
+// disk are mapped to themselves and no other id is mapped: files can only
+// be created through the mount by uid and gid, like the root user of a
+// fakeroot container, and files owned by other ids appear owned by the
+// overflow ids. It requires a kernel 5.12 or later, a filesystem supporting
+// ID-mapped mounts and CAP_SYS_ADMIN in the initial user namespace.
+func IDMapTree(source string, uid, gid int) (int, error) {
+	usernsFd, err := idmapUserNamespace(uid, gid)
+	if err != nil {
+		return -1, err
+	}
+	defer unix.Close(usernsFd)
+
+	treeFd, err := unix.OpenTree(unix.AT_FDCWD, source, unix.OPEN_TREE_CLONE|unix.OPEN_TREE_CLOEXEC)
+	if err != nil {
+		return -1, fmt.Errorf("could not clone mount of %s: %w", source, err)
+	}
+
+	attr := &unix.MountAttr{
+		Attr_set:  unix.MOUNT_ATTR_IDMAP,
+		Userns_fd: uint64(usernsFd),
+	}
+	if err := unix.MountSetattr(treeFd, "", unix.AT_EMPTY_PATH, attr); err != nil {
+		unix.Close(treeFd)
+		return -1, fmt.Errorf("could not set id mapping of %s: %w", source, err)
+	}
+	return treeFd, nil
+}
+
+// idmapUserNamespace returns a file descriptor of a user namespace
+// mapping only uid and gid to themselves, held by a child process stopped
+// before its execution with ptrace, and killed once the namespace is open.
+func idmapUserNamespace(uid, gid int) (int, error) {
+	// the tracer of the child is the calling thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	proc, err := os.StartProcess("/proc/self/exe", []string{"idmap"}, &os.ProcAttr{
+		Sys: &syscall.SysProcAttr{
+			Cloneflags:  syscall.CLONE_NEWUSER,
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}},
+			Ptrace:      true,
+		},
+	})
+	if err != nil {
+		return -1, fmt.Errorf("could not create id mapping user namespace: %w", err)
+	}
+	defer func() {
+		_ = proc.Kill()
+		_, _ = proc.Wait()
+	}()
+
+	fd, err := unix.Open(fmt.Sprintf("/proc/%d/ns/user", proc.Pid), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("could not open id mapping user namespace: %w", err)
+	}
+	return fd, nil
+}
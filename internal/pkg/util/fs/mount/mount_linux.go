@@ -171,7 +171,7 @@ var authorizedFS = map[string]fsContext{
 	"fuse":    {false},
 }
 
-var internalOptions = []string{"loop", "offset", "sizelimit", "key", "skip-on-error"}
+var internalOptions = []string{"loop", "offset", "sizelimit", "key", "skip-on-error", "idmap"}
 
 // Point describes a mount point.
 type Point struct {
@@ -183,6 +183,9 @@ type Point struct {
 type Points struct {
 	context string
 	points  map[AuthorizedTag]PointList
+	// dests indexes the mount point destinations of each tag, to
+	// check for duplicated mount points in constant time
+	dests map[AuthorizedTag]map[string]struct{}
 }
 
 const pathSeparator = string(os.PathSeparator)
@@ -370,6 +373,16 @@ func SkipOnError(options []string) bool {
 	return false
 }
 
+// IDMap returns whether the idmap internal option is set for the mount
+func IDMap(options []string) bool {
+	for _, opt := range options {
+		if opt == "idmap" {
+			return true
+		}
+	}
+	return false
+}
+
 // HasRemountFlag checks if remount flag is set or not.
 func HasRemountFlag(flags uintptr) bool {
 	return flags&syscall.MS_REMOUNT != 0
@@ -388,6 +401,22 @@ func (p *Points) init() {
 	if p.points == nil {
 		p.points = make(map[AuthorizedTag]PointList)
 	}
+	if p.dests == nil {
+		p.dests = make(map[AuthorizedTag]map[string]struct{})
+		for tag := range p.points {
+			p.reindex(tag)
+		}
+	}
+}
+
+// reindex rebuilds the destination index of tag after mount points
+// removal.
+func (p *Points) reindex(tag AuthorizedTag) {
+	dests := make(map[string]struct{}, len(p.points[tag]))
+	for _, point := range p.points[tag] {
+		dests[point.Destination] = struct{}{}
+	}
+	p.dests[tag] = dests
 }
 
 func (p *Points) add(tag AuthorizedTag, source string, dest string, fstype string, flags uintptr, options string) error {
@@ -408,14 +437,7 @@ func (p *Points) add(tag AuthorizedTag, source string, dest string, fstype strin
 		return fmt.Errorf("tag %s is not a recognized tag", tag)
 	}
 	if !HasRemountFlag(flags) && !HasPropagationFlag(flags) {
-		present := false
-		for _, point := range p.points[tag] {
-			if point.Destination == dest {
-				present = true
-				break
-			}
-		}
-		if present {
+		if _, present := p.dests[tag][dest]; present {
 			return ErrMountExists
 		}
 
@@ -472,6 +494,10 @@ func (p *Points) add(tag AuthorizedTag, source string, dest string, fstype strin
 		},
 		InternalOptions: internalOpts,
 	})
+	if p.dests[tag] == nil {
+		p.dests[tag] = make(map[string]struct{})
+	}
+	p.dests[tag][dest] = struct{}{}
 	return nil
 }
 
@@ -520,6 +546,7 @@ func (p *Points) RemoveAll() {
 	p.init()
 	for tag := range p.points {
 		p.points[tag] = nil
+		p.dests[tag] = nil
 	}
 }
 
@@ -532,6 +559,7 @@ func (p *Points) RemoveByDest(dest string) {
 				p.points[tag] = append(p.points[tag][:d], p.points[tag][d+1:]...)
 			}
 		}
+		p.reindex(tag)
 	}
 }
 
@@ -544,6 +572,7 @@ func (p *Points) RemoveBySource(source string) {
 				p.points[tag] = append(p.points[tag][:d], p.points[tag][d+1:]...)
 			}
 		}
+		p.reindex(tag)
 	}
 }
 
@@ -551,6 +580,87 @@ func (p *Points) RemoveBySource(source string) {
 func (p *Points) RemoveByTag(tag AuthorizedTag) {
 	p.init()
 	p.points[tag] = nil
+	p.dests[tag] = nil
+}
+
+// RemoveRedundantBinds removes the read-only bind mounts of tag binding a
+// source to the same destination, for which isFile returns true, when the
+// closest parent bind mount is also a read-only bind mount of a source to
+// the same destination exposing them already. It returns the destinations
+// of the removed bind mounts.
+func (p *Points) RemoveRedundantBinds(tag AuthorizedTag, isFile func(path string) bool) []string {
+	p.init()
+
+	// identity reports for each bind mount destination if it's a
+	// read-only bind mount of the same source without idmap or
+	// mount propagation
+	identity := make(map[string]bool, len(p.points[tag]))
+	dests := make([]string, 0, len(p.points[tag]))
+	for _, point := range p.points[tag] {
+		flags, _ := ConvertOptions(point.Options)
+		if point.Source == "" {
+			if !HasRemountFlag(flags) && HasPropagationFlag(flags) {
+				identity[point.Destination] = false
+			}
+			continue
+		} else if flags&syscall.MS_BIND == 0 {
+			continue
+		}
+		identity[point.Destination] = point.Source == point.Destination &&
+			flags&syscall.MS_RDONLY != 0 && !IDMap(point.InternalOptions)
+		dests = append(dests, point.Destination)
+	}
+
+	// sorting on the path components places bind mounts just after
+	// their parent bind mounts, the closest one of each bind mount
+	// is then found with a stack in a single pass
+	sort.Slice(dests, func(i, j int) bool {
+		return pathLess(filepath.Clean(dests[i]), filepath.Clean(dests[j]))
+	})
+
+	removed := make(map[string]struct{})
+	parents := make([]string, 0)
+	for _, dest := range dests {
+		clean := filepath.Clean(dest)
+		for len(parents) > 0 {
+			parent := strings.TrimSuffix(filepath.Clean(parents[len(parents)-1]), pathSeparator)
+			if strings.HasPrefix(clean, parent+pathSeparator) {
+				break
+			}
+			parents = parents[:len(parents)-1]
+		}
+		if len(parents) > 0 && identity[dest] && identity[parents[len(parents)-1]] && isFile(dest) {
+			removed[dest] = struct{}{}
+			continue
+		}
+		parents = append(parents, dest)
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	points := p.points[tag][:0]
+	for _, point := range p.points[tag] {
+		if _, ok := removed[point.Destination]; !ok {
+			points = append(points, point)
+		}
+	}
+	p.points[tag] = points
+	p.reindex(tag)
+
+	list := make([]string, 0, len(removed))
+	for _, dest := range dests {
+		if _, ok := removed[dest]; ok {
+			list = append(list, dest)
+		}
+	}
+	return list
+}
+
+// pathLess compares the paths a and b component by component, so that a
+// path is always followed by the paths nested in it.
+func pathLess(a, b string) bool {
+	return strings.ReplaceAll(a, pathSeparator, "\x00") < strings.ReplaceAll(b, pathSeparator, "\x00")
 }
 
 // Import imports a mount point list
@@ -281,6 +281,26 @@ func TestBind(t *testing.T) {
 	if !hasBind {
 		t.Errorf("option rbind not applied for /mnt")
 	}
+
+	// duplicated destinations are detected until the mount point removal
+	if err := points.AddBind(UserbindsTag, "/opt", "/mnt", syscall.MS_BIND); err != ErrMountExists {
+		t.Errorf("got error %v for a duplicated destination, want %v", err, ErrMountExists)
+	}
+	if err := points.AddBind(HomeTag, "/opt", "/mnt", syscall.MS_BIND); err != nil {
+		t.Errorf("unexpected error for a destination of another tag: %s", err)
+	}
+	points.RemoveByDest("/mnt")
+	if err := points.AddBind(UserbindsTag, "/opt", "/mnt", syscall.MS_BIND); err != nil {
+		t.Errorf("unexpected error after removal of /mnt: %s", err)
+	}
+	points.RemoveBySource("/opt")
+	if err := points.AddBind(UserbindsTag, "/", "/mnt", syscall.MS_BIND); err != nil {
+		t.Errorf("unexpected error after removal of /opt: %s", err)
+	}
+	points.RemoveByTag(UserbindsTag)
+	if err := points.AddBind(UserbindsTag, "/opt", "/mnt", syscall.MS_BIND); err != nil {
+		t.Errorf("unexpected error after removal of the tag: %s", err)
+	}
 }
 
 func TestRemount(t *testing.T) {
@@ -317,6 +337,111 @@ func TestAddPropagation(t *testing.T) {
 	points.RemoveAll()
 }
 
+func TestRemoveRedundantBinds(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	const ro = syscall.MS_BIND | syscall.MS_REC | syscall.MS_RDONLY
+
+	type bind struct {
+		source      string
+		dest        string
+		flags       uintptr
+		propagation uintptr
+	}
+
+	tests := []struct {
+		name    string
+		binds   []bind
+		removed []string
+	}{
+		{
+			name: "NestedReadOnlyFiles",
+			binds: []bind{
+				{source: "/data/ref/file.fa", dest: "/data/ref/file.fa", flags: ro},
+				{source: "/data", dest: "/data", flags: ro},
+				{source: "/data/other.fa", dest: "/data/other.fa", flags: ro},
+			},
+			removed: []string{"/data/other.fa", "/data/ref/file.fa"},
+		},
+		{
+			name: "NotNested",
+			binds: []bind{
+				{source: "/data", dest: "/data", flags: ro},
+				{source: "/data-ref/file.fa", dest: "/data-ref/file.fa", flags: ro},
+				{source: "/datafile.fa", dest: "/datafile.fa", flags: ro},
+			},
+		},
+		{
+			name: "ClosestParentDifferentSource",
+			binds: []bind{
+				{source: "/data", dest: "/data", flags: ro},
+				{source: "/scratch/ref", dest: "/data/ref", flags: ro},
+				{source: "/data/ref/file.fa", dest: "/data/ref/file.fa", flags: ro},
+			},
+		},
+		{
+			name: "ReadWrite",
+			binds: []bind{
+				{source: "/data", dest: "/data", flags: syscall.MS_BIND},
+				{source: "/data/file.fa", dest: "/data/file.fa", flags: ro},
+				{source: "/other", dest: "/other", flags: ro},
+				{source: "/other/file.fa", dest: "/other/file.fa", flags: syscall.MS_BIND},
+			},
+		},
+		{
+			name: "Propagation",
+			binds: []bind{
+				{source: "/data", dest: "/data", flags: ro},
+				{source: "/data/file.fa", dest: "/data/file.fa", flags: ro, propagation: syscall.MS_SLAVE},
+			},
+		},
+		{
+			name: "Directory",
+			binds: []bind{
+				{source: "/data", dest: "/data", flags: ro},
+				{source: "/data/dir", dest: "/data/dir", flags: ro},
+			},
+		},
+	}
+
+	isFile := func(path string) bool {
+		return path != "/data/dir"
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := &Points{}
+			for _, b := range tt.binds {
+				if err := points.AddBind(UserbindsTag, b.source, b.dest, b.flags); err != nil {
+					t.Fatalf("while adding bind %s: %s", b.dest, err)
+				}
+				if err := points.AddRemount(UserbindsTag, b.dest, b.flags); err != nil {
+					t.Fatalf("while adding remount %s: %s", b.dest, err)
+				}
+				if b.propagation != 0 {
+					if err := points.AddPropagation(UserbindsTag, b.dest, b.propagation); err != nil {
+						t.Fatalf("while adding propagation %s: %s", b.dest, err)
+					}
+				}
+			}
+
+			removed := points.RemoveRedundantBinds(UserbindsTag, isFile)
+			if fmt.Sprint(removed) != fmt.Sprint(tt.removed) {
+				t.Fatalf("unexpected removed binds: got %v instead of %v", removed, tt.removed)
+			}
+			for _, dest := range removed {
+				if len(points.GetByDest(dest)) != 0 {
+					t.Errorf("mount points of %s are still present", dest)
+				}
+				if err := points.AddBind(UserbindsTag, dest, dest, ro); err != nil {
+					t.Errorf("unexpected error while adding back %s: %s", dest, err)
+				}
+			}
+		})
+	}
+}
+
 //nolint:maintidx
 func TestImport(t *testing.T) {
 	test.DropPrivilege(t)
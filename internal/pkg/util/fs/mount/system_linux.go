@@ -78,10 +78,7 @@ func (b *System) MountAll() error {
 				return fmt.Errorf("hook function for tag %s returns error: %s", tag, err)
 			}
 		}
-		if authorizedTags[tag].sortedMount {
-			b.Points.GetByTag(tag).Sort()
-		}
-		for _, point := range b.Points.GetByTag(tag) {
+		for _, point := range b.pointsOf(tag) {
 			if b.Mount != nil {
 				if err := b.Mount(&point, b); err != nil {
 					return fmt.Errorf("mount %s->%s error: %s", point.Source, point.Destination, err)
@@ -96,3 +93,22 @@ func (b *System) MountAll() error {
 	}
 	return nil
 }
+
+// EachPoint calls fn for every registered mount point in the order
+// followed by MountAll, hook functions are not called.
+func (b *System) EachPoint(fn func(AuthorizedTag, Point)) {
+	for _, tag := range GetTagList() {
+		for _, point := range b.pointsOf(tag) {
+			fn(tag, point)
+		}
+	}
+}
+
+// pointsOf returns the mount points of tag list, sorted when
+// required by the tag.
+func (b *System) pointsOf(tag AuthorizedTag) PointList {
+	if authorizedTags[tag].sortedMount {
+		b.Points.GetByTag(tag).Sort()
+	}
+	return b.Points.GetByTag(tag)
+}
@@ -85,3 +85,32 @@ func TestSystem(t *testing.T) {
 		t.Errorf("mountFn wasn't executed")
 	}
 }
+
+func TestSystemEachPoint(t *testing.T) {
+	points := &Points{}
+
+	points.AddBind(UserbindsTag, "/opt", "/opt/data/sub", syscall.MS_BIND)
+	points.AddBind(UserbindsTag, "/opt", "/opt/data", syscall.MS_BIND)
+	points.AddBind(BindsTag, "/etc/hosts", "/etc/hosts", syscall.MS_BIND)
+	points.AddFS(SessionTag, "/session", "tmpfs", syscall.MS_NOSUID, "")
+
+	hook := false
+	system := &System{Points: points}
+	system.RunBeforeTag(BindsTag, func(*System) error {
+		hook = true
+		return nil
+	})
+
+	var dests []string
+	system.EachPoint(func(tag AuthorizedTag, point Point) {
+		dests = append(dests, string(tag)+":"+point.Destination)
+	})
+
+	want := []string{"sessiondir:/session", "binds:/etc/hosts", "userbinds:/opt/data", "userbinds:/opt/data/sub"}
+	if fmt.Sprint(dests) != fmt.Sprint(want) {
+		t.Errorf("unexpected mount point order %v instead of %v", dests, want)
+	}
+	if hook {
+		t.Errorf("hook function was executed")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package overlay
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// Overlay drivers used without the setuid starter, in the order they are
+// probed by 'overlay driver = auto'.
+const (
+	// DriverAuto probes the drivers in order.
+	DriverAuto = "auto"
+	// DriverKernel is the kernel overlayfs mounted in a user namespace.
+	DriverKernel = "kernel"
+	// DriverFuse is fuse-overlayfs, run by the image driver.
+	DriverFuse = "fuse"
+	// DriverSquashfuseBind doesn't mount an overlay: the binds are done
+	// on top of the image mounted by squashfuse with the underlay, which
+	// only works for read-only stacks.
+	DriverSquashfuseBind = "squashfuse+bind"
+)
+
+// bootIDFile holds a random identifier changing at each boot.
+const bootIDFile = "/proc/sys/kernel/random/boot_id"
+
+// Stack describes the overlay requested for a container, to select the
+// driver mounting it.
+type Stack struct {
+	// Layers is true when overlay images or a writable layer must be
+	// combined with the image.
+	Layers bool
+	// FuseOverlay is true when fuse-overlayfs is available through the
+	// image driver.
+	FuseOverlay bool
+	// Underlay is true when the underlay is enabled by configuration.
+	Underlay bool
+	// CacheFile is the file caching the kernel check until the next
+	// boot, if not empty.
+	CacheFile string
+}
+
+type driver struct {
+	name  string
+	probe func(s Stack) error
+}
+
+var drivers = []driver{
+	{DriverKernel, probeKernel},
+	{DriverFuse, probeFuse},
+	{DriverSquashfuseBind, probeSquashfuseBind},
+}
+
+// SelectDriver returns the first usable overlay driver for the stack
+// allowed by the preference, the value of the 'overlay driver' directive.
+// The squashfuse+bind driver isn't an overlay and is always allowed for
+// read-only stacks. When no driver is usable, the returned error lists
+// why each driver was rejected.
+func SelectDriver(preference string, s Stack) (string, error) {
+	var rejected []string
+	for _, d := range drivers {
+		if preference != DriverAuto && preference != d.name && d.name != DriverSquashfuseBind {
+			rejected = append(rejected, fmt.Sprintf("%s: not selected by 'overlay driver = %s'", d.name, preference))
+			continue
+		}
+		err := d.probe(s)
+		if err == nil {
+			sylog.Debugf("Using %s overlay driver", d.name)
+			return d.name, nil
+		}
+		sylog.Debugf("Overlay driver %s rejected: %s", d.name, err)
+		rejected = append(rejected, fmt.Sprintf("%s: %s", d.name, err))
+	}
+	return "", fmt.Errorf("no overlay driver usable:\n  %s", strings.Join(rejected, "\n  "))
+}
+
+func probeKernel(s Stack) error {
+	return CheckRootlessCached(s.CacheFile)
+}
+
+func probeFuse(s Stack) error {
+	if !s.FuseOverlay {
+		return errors.New("fuse-overlayfs not found")
+	}
+	if err := unix.Access("/dev/fuse", unix.R_OK|unix.W_OK); err != nil {
+		return fmt.Errorf("/dev/fuse not accessible: %w", err)
+	}
+	return nil
+}
+
+func probeSquashfuseBind(s Stack) error {
+	if s.Layers {
+		return errors.New("only usable without overlay images and writable layers")
+	}
+	if !s.Underlay {
+		return errors.New("underlay disabled by configuration ('enable underlay = no')")
+	}
+	return nil
+}
+
+// CheckRootlessCached is CheckRootless with its result cached in
+// cacheFile until the next boot. The cache is ignored if cacheFile is
+// empty.
+func CheckRootlessCached(cacheFile string) error {
+	bootID, err := os.ReadFile(bootIDFile)
+	if err != nil || cacheFile == "" {
+		return CheckRootless()
+	}
+	id := strings.TrimSpace(string(bootID))
+
+	if b, err := os.ReadFile(cacheFile); err == nil {
+		if cachedID, result, ok := strings.Cut(strings.TrimSpace(string(b)), " "); ok && cachedID == id {
+			sylog.Debugf("Using rootless overlay check result cached in %s", cacheFile)
+			if result == "supported" {
+				return nil
+			}
+			return ErrNoRootlessOverlay
+		}
+	}
+
+	err = CheckRootless()
+	if err != nil && err != ErrNoRootlessOverlay {
+		// don't cache unexpected errors
+		return err
+	}
+	result := "supported"
+	if err != nil {
+		result = "unsupported"
+	}
+	if werr := writeCache(cacheFile, id+" "+result+"\n"); werr != nil {
+		sylog.Debugf("Could not cache rootless overlay check result: %s", werr)
+	}
+	return err
+}
+
+// writeCache replaces the content of the cache file atomically.
+func writeCache(cacheFile, content string) error {
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(cacheFile), filepath.Base(cacheFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), cacheFile)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelectDriver(t *testing.T) {
+	bootID, err := os.ReadFile(bootIDFile)
+	if err != nil {
+		t.Skipf("could not read %s: %s", bootIDFile, err)
+	}
+	id := strings.TrimSpace(string(bootID))
+
+	// cache the kernel check result so the tests don't depend on the
+	// kernel support of unprivileged overlay
+	cacheFile := filepath.Join(t.TempDir(), "overlay-rootless-check")
+	setKernel := func(supported bool) {
+		result := "unsupported"
+		if supported {
+			result = "supported"
+		}
+		if err := os.WriteFile(cacheFile, []byte(id+" "+result+"\n"), 0o644); err != nil {
+			t.Fatalf("could not write %s: %s", cacheFile, err)
+		}
+	}
+	_, fuseErr := os.Stat("/dev/fuse")
+
+	tests := []struct {
+		name           string
+		preference     string
+		kernel         bool
+		stack          Stack
+		needFuse       bool
+		expectedDriver string
+		expectedErrs   []string
+	}{
+		{
+			name:           "auto kernel",
+			preference:     DriverAuto,
+			kernel:         true,
+			stack:          Stack{Layers: true, FuseOverlay: true},
+			expectedDriver: DriverKernel,
+		},
+		{
+			name:           "auto fuse",
+			preference:     DriverAuto,
+			stack:          Stack{Layers: true, FuseOverlay: true},
+			needFuse:       true,
+			expectedDriver: DriverFuse,
+		},
+		{
+			name:           "auto squashfuse+bind",
+			preference:     DriverAuto,
+			stack:          Stack{Underlay: true},
+			expectedDriver: DriverSquashfuseBind,
+		},
+		{
+			name:       "auto none",
+			preference: DriverAuto,
+			stack:      Stack{Layers: true, Underlay: true},
+			expectedErrs: []string{
+				"kernel: " + ErrNoRootlessOverlay.Error(),
+				"fuse: fuse-overlayfs not found",
+				"squashfuse+bind: only usable without overlay images",
+			},
+		},
+		{
+			name:           "kernel skips fuse",
+			preference:     DriverKernel,
+			stack:          Stack{FuseOverlay: true, Underlay: true},
+			expectedDriver: DriverSquashfuseBind,
+		},
+		{
+			name:           "fuse skips kernel",
+			preference:     DriverFuse,
+			kernel:         true,
+			stack:          Stack{Layers: true, FuseOverlay: true},
+			needFuse:       true,
+			expectedDriver: DriverFuse,
+		},
+		{
+			name:       "kernel none",
+			preference: DriverKernel,
+			stack:      Stack{Layers: true, FuseOverlay: true},
+			expectedErrs: []string{
+				"kernel: " + ErrNoRootlessOverlay.Error(),
+				"fuse: not selected by 'overlay driver = kernel'",
+				"squashfuse+bind: only usable without overlay images",
+			},
+		},
+		{
+			name:       "underlay disabled",
+			preference: DriverAuto,
+			stack:      Stack{},
+			expectedErrs: []string{
+				"squashfuse+bind: underlay disabled by configuration",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.needFuse && fuseErr != nil {
+				t.Skipf("/dev/fuse not available: %s", fuseErr)
+			}
+			setKernel(tt.kernel)
+			tt.stack.CacheFile = cacheFile
+
+			d, err := SelectDriver(tt.preference, tt.stack)
+			if len(tt.expectedErrs) > 0 {
+				if err == nil {
+					t.Fatalf("unexpected success, selected driver %s", d)
+				}
+				for _, e := range tt.expectedErrs {
+					if !strings.Contains(err.Error(), e) {
+						t.Errorf("error %q doesn't contain %q", err, e)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if d != tt.expectedDriver {
+				t.Errorf("unexpected driver %s, expected %s", d, tt.expectedDriver)
+			}
+		})
+	}
+}
+
+func TestCheckRootlessCached(t *testing.T) {
+	if _, err := os.Stat(bootIDFile); err != nil {
+		t.Skipf("could not read %s: %s", bootIDFile, err)
+	}
+	cacheFile := filepath.Join(t.TempDir(), "cache", "overlay-rootless-check")
+
+	// a cache from a previous boot is ignored and replaced
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cacheFile, []byte("previous-boot supported\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := CheckRootlessCached(cacheFile)
+	if err != nil && err != ErrNoRootlessOverlay {
+		t.Skipf("rootless overlay check failed: %s", err)
+	}
+	b, rerr := os.ReadFile(cacheFile)
+	if rerr != nil {
+		t.Fatalf("cache file not written: %s", rerr)
+	}
+	if strings.HasPrefix(string(b), "previous-boot") {
+		t.Fatalf("cache from a previous boot not replaced: %q", b)
+	}
+
+	// the cached result is returned
+	if cerr := CheckRootlessCached(cacheFile); cerr != err {
+		t.Errorf("cached result %v differs from %v", cerr, err)
+	}
+}
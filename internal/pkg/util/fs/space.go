@@ -0,0 +1,99 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	units "github.com/docker/go-units"
+	"golang.org/x/sys/unix"
+)
+
+// ExtractFactor is the factor applied to the compressed size of an image
+// to estimate the temporary space needed to extract it.
+const ExtractFactor = 3
+
+// AvailableSpace returns the space available to unprivileged users in the
+// filesystem containing dir.
+func AvailableSpace(dir string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * st.Bsize, nil
+}
+
+// SpaceError is returned when no temporary directory has the space
+// required by an operation.
+type SpaceError struct {
+	// Dir is the temporary directory checked, empty if the tmpdir
+	// candidates of the configuration were checked.
+	Dir        string
+	Candidates []string
+	Required   int64
+	Available  int64
+}
+
+func (e *SpaceError) Error() string {
+	if e.Dir == "" {
+		return fmt.Sprintf("not enough space in any of the tmpdir candidates %s, about %s required: set APPTAINER_TMPDIR to a directory with enough free space",
+			strings.Join(e.Candidates, ", "), units.BytesSize(float64(e.Required)))
+	}
+	return fmt.Sprintf("not enough space in temporary directory %s, about %s required and %s available: set APPTAINER_TMPDIR to a directory with enough free space",
+		e.Dir, units.BytesSize(float64(e.Required)), units.BytesSize(float64(e.Available)))
+}
+
+// ChooseTmpDir returns the temporary directory to use for an operation
+// needing about required bytes of temporary space. Without candidates, dir
+// is returned if it has enough space available, otherwise the first of the
+// existing candidates, with environment variables expanded, having enough
+// space is returned. A SpaceError is returned if there's no such directory.
+// The space of a directory is not checked if required is unknown (zero).
+func ChooseTmpDir(dir string, candidates []string, required int64) (string, error) {
+	if required <= 0 {
+		return dir, nil
+	}
+	sylog.Verbosef("Estimated temporary space required: %s", units.BytesSize(float64(required)))
+
+	if len(candidates) == 0 {
+		avail, err := AvailableSpace(dir)
+		if err != nil {
+			sylog.Debugf("Could not get available space in %s: %s", dir, err)
+			return dir, nil
+		} else if avail < required {
+			return "", &SpaceError{Dir: dir, Required: required, Available: avail}
+		}
+		sylog.Verbosef("Using temporary directory %s (%s available)", dir, units.BytesSize(float64(avail)))
+		return dir, nil
+	}
+
+	expanded := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		c = os.ExpandEnv(c)
+		expanded = append(expanded, c)
+		if !IsDir(c) {
+			sylog.Debugf("Skipping tmpdir candidate %s: not a directory", c)
+			continue
+		}
+		avail, err := AvailableSpace(c)
+		if err != nil {
+			sylog.Debugf("Skipping tmpdir candidate %s: %s", c, err)
+			continue
+		} else if avail < required {
+			sylog.Verbosef("Skipping tmpdir candidate %s: %s available", c, units.BytesSize(float64(avail)))
+			continue
+		}
+		sylog.Verbosef("Using tmpdir candidate %s (%s available)", c, units.BytesSize(float64(avail)))
+		return c, nil
+	}
+	return "", &SpaceError{Candidates: expanded, Required: required}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChooseTmpDir(t *testing.T) {
+	small := t.TempDir()
+	large := t.TempDir()
+	missing := filepath.Join(small, "missing")
+	t.Setenv("TMPDIR_TEST_LARGE", large)
+
+	avail, err := AvailableSpace(large)
+	if err != nil {
+		t.Fatalf("could not get available space in %s: %s", large, err)
+	}
+	// the directories share the same filesystem, the space required
+	// beyond the available space is used to skip a candidate
+	tooLarge := avail * 1024
+
+	tests := []struct {
+		name       string
+		dir        string
+		candidates []string
+		required   int64
+		want       string
+		candErr    bool
+	}{
+		{
+			name:     "unknown size",
+			dir:      small,
+			required: 0,
+			want:     small,
+		},
+		{
+			name:     "enough space",
+			dir:      small,
+			required: 1,
+			want:     small,
+		},
+		{
+			name:     "not enough space",
+			dir:      small,
+			required: tooLarge,
+		},
+		{
+			name:       "first candidate",
+			dir:        small,
+			candidates: []string{"$TMPDIR_TEST_LARGE", small},
+			required:   1,
+			want:       large,
+		},
+		{
+			name:       "missing candidate",
+			dir:        small,
+			candidates: []string{missing, "${TMPDIR_TEST_LARGE}"},
+			required:   1,
+			want:       large,
+		},
+		{
+			name:       "no candidate",
+			dir:        small,
+			candidates: []string{missing, "$TMPDIR_TEST_LARGE"},
+			required:   tooLarge,
+			candErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ChooseTmpDir(tt.dir, tt.candidates, tt.required)
+			if tt.want != "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				} else if dir != tt.want {
+					t.Fatalf("unexpected directory %s instead of %s", dir, tt.want)
+				}
+				return
+			}
+
+			var spaceErr *SpaceError
+			if !errors.As(err, &spaceErr) {
+				t.Fatalf("unexpected error for a directory without enough space: %v", err)
+			}
+			if !strings.Contains(err.Error(), "APPTAINER_TMPDIR") {
+				t.Errorf("APPTAINER_TMPDIR not mentioned in error: %s", err)
+			}
+			if tt.candErr {
+				if !strings.Contains(err.Error(), missing+", "+large) {
+					t.Errorf("candidates not named in error: %s", err)
+				}
+			} else if spaceErr.Dir != tt.dir || spaceErr.Available <= 0 {
+				t.Errorf("unexpected error %+v", spaceErr)
+			}
+		})
+	}
+}
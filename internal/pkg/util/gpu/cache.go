@@ -0,0 +1,206 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package gpu
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/paths"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// platform describes a GPU platform whose host libraries and binaries,
+// listed in a configuration file, are bound into the container. The
+// resolved files are cached until the driver, the configuration file or
+// the ld cache change.
+type platform struct {
+	// name of the platform, naming its cache file
+	name string
+	// driverVersion returns the version of the host driver, an empty
+	// string if it's not loaded
+	driverVersion func() string
+}
+
+var (
+	nvidiaPlatform = platform{name: "nvidia", driverVersion: nvidiaDriverVersion}
+	rocmPlatform   = platform{name: "rocm", driverVersion: rocmDriverVersion}
+)
+
+var (
+	nvidiaVersionFile = "/sys/module/nvidia/version"
+	amdgpuVersionFile = "/sys/module/amdgpu/version"
+	kernelReleaseFile = "/proc/sys/kernel/osrelease"
+)
+
+// boundLibsDir holds the libraries bound by a parent container, which are
+// inherited by paths.Resolve.
+var boundLibsDir = "/.singularity.d/libs"
+
+// readVersion returns the trimmed content of a version file, empty if it
+// can't be read.
+func readVersion(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// nvidiaDriverVersion returns the version of the loaded NVIDIA kernel
+// module.
+func nvidiaDriverVersion() string {
+	return readVersion(nvidiaVersionFile)
+}
+
+// rocmDriverVersion returns the version of the loaded amdgpu kernel module,
+// the module shipped with the kernel has no version and is upgraded with
+// the kernel.
+func rocmDriverVersion() string {
+	if v := readVersion(amdgpuVersionFile); v != "" {
+		return v
+	}
+	if k := readVersion(kernelReleaseFile); k != "" {
+		return "kernel " + k
+	}
+	return ""
+}
+
+// resolveKey identifies the state the files of a platform were resolved
+// from.
+type resolveKey struct {
+	Driver        string `json:"driver"`
+	ConfigFile    string `json:"configFile"`
+	ConfigModTime int64  `json:"configModTime"`
+	ConfigSize    int64  `json:"configSize"`
+	LdCacheTime   int64  `json:"ldCacheModTime"`
+	LdCacheSize   int64  `json:"ldCacheSize"`
+	Arch          string `json:"arch"`
+	Path          string `json:"path"`
+}
+
+// resolvedFiles are the files of a platform resolved from the state
+// identified by Key.
+type resolvedFiles struct {
+	Key       resolveKey `json:"key"`
+	Libraries []string   `json:"libraries"`
+	Binaries  []string   `json:"binaries"`
+}
+
+// newResolveKey returns the key of the files of the platform listed in
+// configFilePath.
+func (p platform) newResolveKey(configFilePath string) (resolveKey, error) {
+	fi, err := os.Stat(configFilePath)
+	if err != nil {
+		return resolveKey{}, err
+	}
+	key := resolveKey{
+		Driver:        p.driverVersion(),
+		ConfigFile:    configFilePath,
+		ConfigModTime: fi.ModTime().UnixNano(),
+		ConfigSize:    fi.Size(),
+		Arch:          runtime.GOARCH,
+		// binaries are looked up in PATH
+		Path: os.Getenv("PATH"),
+	}
+	if fi, err := os.Stat(paths.LdCacheFile()); err == nil {
+		key.LdCacheTime = fi.ModTime().UnixNano()
+		key.LdCacheSize = fi.Size()
+	}
+	return key, nil
+}
+
+// resolve returns the libraries and binaries of the platform listed in
+// configFilePath. The resolved files are cached in cacheDir, unless empty,
+// and taken from there while the driver version, the configuration file
+// and the ld cache are unchanged and the files still exist.
+func (p platform) resolve(configFilePath, cacheDir string) ([]string, []string, error) {
+	files, err := gpuliblist(configFilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read %s: %v", filepath.Base(configFilePath), err)
+	}
+
+	// the libraries inherited from a parent container aren't cached
+	if _, err := os.Stat(boundLibsDir); err == nil {
+		cacheDir = ""
+	}
+	if cacheDir == "" {
+		return paths.Resolve(files)
+	}
+
+	key, err := p.newResolveKey(configFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	cacheFile := filepath.Join(cacheDir, p.name+".json")
+	if r, ok := loadResolvedFiles(cacheFile, key); ok {
+		sylog.Debugf("Using %s files resolved for driver %q from %s", p.name, key.Driver, cacheFile)
+		return r.Libraries, r.Binaries, nil
+	}
+
+	libs, bins, err := paths.Resolve(files)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := resolvedFiles{Key: key, Libraries: libs, Binaries: bins}
+	if err := storeResolvedFiles(cacheFile, r); err != nil {
+		sylog.Debugf("Could not cache %s files: %s", p.name, err)
+	}
+	return libs, bins, nil
+}
+
+// loadResolvedFiles returns the files cached in cacheFile if they were
+// resolved from the state identified by key and all still exist.
+func loadResolvedFiles(cacheFile string, key resolveKey) (resolvedFiles, bool) {
+	var r resolvedFiles
+	b, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return r, false
+	}
+	if err := json.Unmarshal(b, &r); err != nil || r.Key != key {
+		return r, false
+	}
+	for _, list := range [][]string{r.Libraries, r.Binaries} {
+		for _, f := range list {
+			if _, err := os.Stat(f); err != nil {
+				return r, false
+			}
+		}
+	}
+	return r, true
+}
+
+// storeResolvedFiles atomically writes the resolved files to cacheFile.
+func storeResolvedFiles(cacheFile string, r resolvedFiles) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(cacheFile)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "tmp_"+filepath.Base(cacheFile))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), cacheFile)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build linux
+
+package gpu
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlatformResolve(t *testing.T) {
+	tmp := t.TempDir()
+	boundLibsDir = filepath.Join(tmp, "nonexistent")
+	defer func() { boundLibsDir = "/.singularity.d/libs" }()
+
+	// the binaries are resolved from a fake PATH
+	binDir := filepath.Join(tmp, "bin")
+	if err := os.Mkdir(binDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tool := filepath.Join(binDir, "gpu-smi")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+
+	configFile := filepath.Join(tmp, "gpuliblist.conf")
+	if err := os.WriteFile(configFile, []byte("gpu-smi\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	version := "1.0"
+	p := platform{name: "test", driverVersion: func() string { return version }}
+	cacheDir := filepath.Join(tmp, "cache")
+	cacheFile := filepath.Join(cacheDir, "test.json")
+
+	resolve := func() []string {
+		t.Helper()
+		_, bins, err := p.resolve(configFile, cacheDir)
+		if err != nil {
+			t.Fatalf("resolve() error = %v", err)
+		}
+		return bins
+	}
+	// poison overwrites the cached binaries, to tell when the cache is used
+	poison := func() {
+		t.Helper()
+		key, err := p.newResolveKey(configFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storeResolvedFiles(cacheFile, resolvedFiles{Key: key, Binaries: []string{configFile}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := resolve(), []string{tool}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolve() = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(cacheFile); err != nil {
+		t.Fatalf("resolved files not cached: %s", err)
+	}
+
+	poison()
+	if got, want := resolve(), []string{configFile}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cached resolve() = %v, want %v", got, want)
+	}
+
+	// a driver upgrade invalidates the cache
+	poison()
+	version = "2.0"
+	if got, want := resolve(), []string{tool}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resolve() after driver upgrade = %v, want %v", got, want)
+	}
+
+	// a modified configuration file invalidates the cache
+	poison()
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(configFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resolve(), []string{tool}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resolve() after configuration change = %v, want %v", got, want)
+	}
+
+	// a missing cached file invalidates the cache
+	key, err := p.newResolveKey(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone := filepath.Join(tmp, "gone")
+	if err := storeResolvedFiles(cacheFile, resolvedFiles{Key: key, Binaries: []string{gone}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resolve(), []string{tool}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resolve() with missing cached file = %v, want %v", got, want)
+	}
+
+	// no cache is written without a cache directory
+	if err := os.RemoveAll(cacheDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p.resolve(configFile, ""); err != nil {
+		t.Fatalf("resolve() error = %v", err)
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Errorf("cache directory created without caching")
+	}
+}
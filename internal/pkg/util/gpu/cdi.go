@@ -0,0 +1,177 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package gpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"gopkg.in/yaml.v3"
+)
+
+// NvidiaCDIKind is the kind of the CDI specifications of NVIDIA GPUs, as
+// generated by nvidia-ctk cdi generate.
+const NvidiaCDIKind = "nvidia.com/gpu"
+
+// cdiSpecDirs are the directories holding the CDI specifications, in
+// increasing priority.
+var cdiSpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+// CDISpec is a Container Device Interface specification, see
+// https://github.com/cncf-tags/container-device-interface/blob/main/SPEC.md.
+// Only the fields applying to the containers run by Apptainer are decoded.
+type CDISpec struct {
+	// Path is the file the specification was read from.
+	Path           string      `yaml:"-"`
+	Version        string      `yaml:"cdiVersion"`
+	Kind           string      `yaml:"kind"`
+	Devices        []CDIDevice `yaml:"devices"`
+	ContainerEdits CDIEdits    `yaml:"containerEdits"`
+}
+
+// CDIDevice is a device of a CDI specification.
+type CDIDevice struct {
+	Name           string   `yaml:"name"`
+	ContainerEdits CDIEdits `yaml:"containerEdits"`
+}
+
+// CDIEdits are the changes made to a container to access a device.
+type CDIEdits struct {
+	Env         []string        `yaml:"env"`
+	DeviceNodes []CDIDeviceNode `yaml:"deviceNodes"`
+	Mounts      []CDIMount      `yaml:"mounts"`
+	Hooks       []CDIHook       `yaml:"hooks"`
+}
+
+// CDIDeviceNode is a device node of the host created in the container.
+type CDIDeviceNode struct {
+	Path     string `yaml:"path"`
+	HostPath string `yaml:"hostPath"`
+}
+
+// HostDevice returns the path of the device node on the host.
+func (d CDIDeviceNode) HostDevice() string {
+	if d.HostPath != "" {
+		return d.HostPath
+	}
+	return d.Path
+}
+
+// CDIMount is a host file or directory bound into the container.
+type CDIMount struct {
+	HostPath      string   `yaml:"hostPath"`
+	ContainerPath string   `yaml:"containerPath"`
+	Options       []string `yaml:"options"`
+}
+
+// CDIHook is a hook run while creating the container.
+type CDIHook struct {
+	HookName string   `yaml:"hookName"`
+	Path     string   `yaml:"path"`
+	Args     []string `yaml:"args"`
+}
+
+// FindCDISpec returns the CDI specification of the devices of kind found in
+// the CDI specification directories, nil if there's none. Like the CDI
+// registry, the specifications of /var/run/cdi take precedence over those of
+// /etc/cdi, and the last file in lexical order of a directory wins. Invalid
+// specifications are ignored with a warning.
+func FindCDISpec(kind string) *CDISpec {
+	var found *CDISpec
+	for _, dir := range cdiSpecDirs {
+		var files []string
+		for _, ext := range []string{"*.yaml", "*.json"} {
+			matches, _ := filepath.Glob(filepath.Join(dir, ext))
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			spec, err := readCDISpec(f)
+			if err != nil {
+				sylog.Warningf("Ignoring CDI specification: %s", err)
+				continue
+			}
+			if spec.Kind == kind {
+				found = spec
+			}
+		}
+	}
+	return found
+}
+
+// readCDISpec reads a CDI specification in YAML or JSON, JSON being a
+// subset of YAML.
+func readCDISpec(path string) (*CDISpec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := &CDISpec{Path: path}
+	if err := yaml.Unmarshal(b, spec); err != nil {
+		return nil, fmt.Errorf("while parsing %s: %w", path, err)
+	}
+	if spec.Kind == "" {
+		return nil, fmt.Errorf("%s: no kind", path)
+	}
+	return spec, nil
+}
+
+// Edits returns the changes to make to a container to access the named
+// devices, the changes common to all the devices of the specification
+// coming first. The devices are selected with a NVIDIA_VISIBLE_DEVICES
+// value: all selects all the devices, unless the specification has a device
+// named all, none and void select none.
+func (s *CDISpec) Edits(devices string) (CDIEdits, error) {
+	edits := CDIEdits{
+		Env:         append([]string{}, s.ContainerEdits.Env...),
+		DeviceNodes: append([]CDIDeviceNode{}, s.ContainerEdits.DeviceNodes...),
+		Mounts:      append([]CDIMount{}, s.ContainerEdits.Mounts...),
+		Hooks:       append([]CDIHook{}, s.ContainerEdits.Hooks...),
+	}
+	var names []string
+	switch devices {
+	case "", "none", "void":
+	case "all":
+		if _, ok := s.device("all"); ok {
+			names = []string{"all"}
+			break
+		}
+		for _, d := range s.Devices {
+			names = append(names, d.Name)
+		}
+	default:
+		names = strings.Split(devices, ",")
+	}
+
+	for _, name := range names {
+		d, ok := s.device(name)
+		if !ok {
+			return CDIEdits{}, fmt.Errorf("no device %q in CDI specification %s", name, s.Path)
+		}
+		edits.Env = append(edits.Env, d.ContainerEdits.Env...)
+		edits.DeviceNodes = append(edits.DeviceNodes, d.ContainerEdits.DeviceNodes...)
+		edits.Mounts = append(edits.Mounts, d.ContainerEdits.Mounts...)
+		edits.Hooks = append(edits.Hooks, d.ContainerEdits.Hooks...)
+	}
+	return edits, nil
+}
+
+// device returns the device of the specification with name.
+func (s *CDISpec) device(name string) (CDIDevice, bool) {
+	for _, d := range s.Devices {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return CDIDevice{}, false
+}
@@ -0,0 +1,145 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package gpu
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// withCDISpecDirs sets the CDI specification directories for a test.
+func withCDISpecDirs(t *testing.T, dirs ...string) {
+	old := cdiSpecDirs
+	cdiSpecDirs = dirs
+	t.Cleanup(func() { cdiSpecDirs = old })
+}
+
+func TestFindCDISpec(t *testing.T) {
+	etc := filepath.Join("testdata", "cdi", "etc")
+	run := filepath.Join("testdata", "cdi", "run")
+
+	tests := []struct {
+		name     string
+		dirs     []string
+		kind     string
+		wantPath string
+	}{
+		{name: "Etc", dirs: []string{etc}, kind: NvidiaCDIKind, wantPath: filepath.Join(etc, "nvidia.yaml")},
+		// the JSON specification of the run directory takes precedence
+		{name: "Run", dirs: []string{etc, run}, kind: NvidiaCDIKind, wantPath: filepath.Join(run, "nvidia.json")},
+		{name: "OtherKind", dirs: []string{etc, run}, kind: "vendor.com/device", wantPath: filepath.Join(run, "vendor.yaml")},
+		{name: "None", dirs: []string{etc}, kind: "vendor.com/device"},
+		{name: "NoDir", dirs: []string{filepath.Join("testdata", "cdi", "nonexistent")}, kind: NvidiaCDIKind},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withCDISpecDirs(t, tt.dirs...)
+			spec := FindCDISpec(tt.kind)
+			if tt.wantPath == "" {
+				if spec != nil {
+					t.Errorf("FindCDISpec() = %s, want none", spec.Path)
+				}
+				return
+			}
+			if spec == nil {
+				t.Fatalf("FindCDISpec() found no specification, want %s", tt.wantPath)
+			}
+			if spec.Path != tt.wantPath {
+				t.Errorf("FindCDISpec() = %s, want %s", spec.Path, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestCDISpecEdits(t *testing.T) {
+	spec, err := readCDISpec(filepath.Join("testdata", "cdi", "etc", "nvidia.yaml"))
+	if err != nil {
+		t.Fatalf("readCDISpec() error = %v", err)
+	}
+
+	common := []string{"/dev/nvidia-modeset", "/dev/nvidia-uvm", "/dev/nvidia-uvm-tools", "/dev/nvidiactl"}
+	tests := []struct {
+		name        string
+		devices     string
+		wantDevices []string
+		wantErr     bool
+	}{
+		{
+			name:        "None",
+			devices:     "none",
+			wantDevices: common,
+		},
+		{
+			name:        "Index",
+			devices:     "1",
+			wantDevices: append(common, "/dev/nvidia1", "/dev/dri/card2", "/dev/dri/renderD129"),
+		},
+		{
+			name:        "MIG",
+			devices:     "0:0",
+			wantDevices: append(common, "/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap12", "/dev/nvidia-caps/nvidia-cap13"),
+		},
+		{
+			name:    "All",
+			devices: "all",
+			wantDevices: append(common,
+				"/dev/nvidia0", "/dev/nvidia1", "/dev/dri/card1", "/dev/dri/renderD128", "/dev/dri/card2", "/dev/dri/renderD129",
+			),
+		},
+		{
+			name:    "Unknown",
+			devices: "0,2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits, err := spec.Edits(tt.devices)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Edits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var devices []string
+			for _, d := range edits.DeviceNodes {
+				devices = append(devices, d.HostDevice())
+			}
+			if !reflect.DeepEqual(devices, tt.wantDevices) {
+				t.Errorf("Edits() device nodes = %v, want %v", devices, tt.wantDevices)
+			}
+			if len(edits.Mounts) != 3 || len(edits.Hooks) != 1 {
+				t.Errorf("Edits() gave %d mounts and %d hooks, want 3 and 1", len(edits.Mounts), len(edits.Hooks))
+			}
+			if want := []string{"NVIDIA_VISIBLE_DEVICES=void"}; !reflect.DeepEqual(edits.Env, want) {
+				t.Errorf("Edits() env = %v, want %v", edits.Env, want)
+			}
+		})
+	}
+
+	// the device edits are not added to the common edits of the specification
+	if len(spec.ContainerEdits.DeviceNodes) != len(common) {
+		t.Errorf("Edits() modified the specification")
+	}
+}
+
+func TestCDIDeviceNodeHostDevice(t *testing.T) {
+	spec, err := readCDISpec(filepath.Join("testdata", "cdi", "run", "nvidia.json"))
+	if err != nil {
+		t.Fatalf("readCDISpec() error = %v", err)
+	}
+	edits, err := spec.Edits("0")
+	if err != nil {
+		t.Fatalf("Edits() error = %v", err)
+	}
+	if len(edits.DeviceNodes) != 1 || edits.DeviceNodes[0].HostDevice() != "/dev/nvidia3" {
+		t.Errorf("Edits() device nodes = %+v, want /dev/nvidia3", edits.DeviceNodes)
+	}
+}
@@ -10,10 +10,12 @@
 package gpu
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -102,12 +104,6 @@ func NVCLIConfigure(nvidiaEnv []string, rootfs string, userNS bool) error {
 		return fmt.Errorf("/usr/bin not writable in the container")
 	}
 
-	// Translate the passed in NVIDIA_ env vars to option flags
-	flags, err := NVCLIEnvToFlags(nvidiaEnv)
-	if err != nil {
-		return err
-	}
-
 	// The --ldconfig flag is constructed here, as the specified binary
 	// will be called as root in the set-uid flow, so the user should not
 	// be able to influence it from the CLI code.
@@ -120,16 +116,11 @@ func NVCLIConfigure(nvidiaEnv []string, rootfs string, userNS bool) error {
 	if !userNS && !fs.IsOwner(ldConfig, 0) {
 		return errLdconfigInsecure
 	}
-	flags = append(flags, "--ldconfig=@"+ldConfig)
 
-	nccArgs := []string{"configure"}
-	// If we are running in a user namespace specify --user as a global flag,
-	// or nvidia-container-cli will fail.
-	if userNS {
-		nccArgs = []string{"--user", "configure"}
+	nccArgs, err := NVCLIConfigureArgs(nvidiaEnv, ldConfig, rootfs, userNS)
+	if err != nil {
+		return err
 	}
-	nccArgs = append(nccArgs, flags...)
-	nccArgs = append(nccArgs, rootfs)
 
 	sylog.Debugf("nvidia-container-cli binary: %q args: %q", nvCCLIPath, nccArgs)
 
@@ -151,11 +142,192 @@ func NVCLIConfigure(nvidiaEnv []string, rootfs string, userNS bool) error {
 		cmd.SysProcAttr = &syscall.SysProcAttr{}
 	}
 	cmd.SysProcAttr.AmbientCaps = nVCLIAmbientCaps
-	stdoutStderr, err := cmd.CombinedOutput()
+	_, err = runNVCLI(cmd)
+	return err
+}
+
+// NVCLIConfigureArgs returns the arguments of the nvidia-container-cli
+// configure operation setting up the GPUs selected by the passed in NVIDIA_
+// env vars in rootfs, ldconfig being the path of the host ldconfig.
+func NVCLIConfigureArgs(nvidiaEnv []string, ldconfig, rootfs string, userNS bool) ([]string, error) {
+	// Translate the passed in NVIDIA_ env vars to option flags
+	flags, err := NVCLIEnvToFlags(nvidiaEnv)
+	if err != nil {
+		return nil, err
+	}
+	flags = append(flags, "--ldconfig=@"+ldconfig)
+
+	nccArgs := []string{"configure"}
+	// If we are running in a user namespace specify --user as a global flag,
+	// or nvidia-container-cli will fail.
+	if userNS {
+		nccArgs = []string{"--user", "configure"}
+	}
+	nccArgs = append(nccArgs, flags...)
+	return append(nccArgs, rootfs), nil
+}
+
+// NVCLIFiles are the host files and devices nvidia-container-cli injects
+// into a container.
+type NVCLIFiles struct {
+	// Libraries are the driver libraries.
+	Libraries []string
+	// Binaries are the driver binaries, bound into /usr/bin.
+	Binaries []string
+	// Files are the IPC sockets and other files bound at the same path.
+	Files []string
+	// Devices are the device nodes.
+	Devices []string
+}
+
+// NVCLIList calls out to the nvidia-container-cli list operation as the
+// calling user, returning the files that the configure operation would
+// inject into a container for the passed in NVIDIA_ env vars. They can then
+// be bound explicitly when the host filesystem isn't visible to the
+// configure operation.
+func NVCLIList(nvidiaEnv []string) (NVCLIFiles, error) {
+	nvCCLIPath, err := bin.FindBin("nvidia-container-cli")
+	if err != nil {
+		return NVCLIFiles{}, err
+	}
+	args, err := NVCLIListArgs(nvidiaEnv, os.Geteuid() != 0)
+	if err != nil {
+		return NVCLIFiles{}, err
+	}
+
+	sylog.Debugf("nvidia-container-cli binary: %q args: %q", nvCCLIPath, args)
+
+	cmd := exec.Command(nvCCLIPath, args...)
+	cmd.Env = append(os.Environ(), "PATH="+env.DefaultPath)
+	out, err := runNVCLI(cmd)
 	if err != nil {
-		return fmt.Errorf("nvidia-container-cli failed with %v: %s", err, stdoutStderr)
+		return NVCLIFiles{}, err
 	}
-	return nil
+	return parseNVCLIList(out), nil
+}
+
+// NVCLIListArgs returns the arguments of the nvidia-container-cli list
+// operation for the passed in NVIDIA_ env vars, --user being required to
+// run it as an unprivileged user.
+func NVCLIListArgs(nvidiaEnv []string, user bool) ([]string, error) {
+	flags, err := NVCLIEnvToFlags(nvidiaEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"list"}
+	if user {
+		args = []string{"--user", "list"}
+	}
+	args = append(args, "--libraries", "--binaries", "--ipcs")
+	// only the device selection and compat32 apply to the list operation
+	for _, f := range flags {
+		if strings.HasPrefix(f, "--device=") ||
+			strings.HasPrefix(f, "--mig-config=") ||
+			strings.HasPrefix(f, "--mig-monitor=") ||
+			f == "--compat32" {
+			args = append(args, f)
+		}
+	}
+	return args, nil
+}
+
+// parseNVCLIList sorts the paths printed by the nvidia-container-cli list
+// operation.
+func parseNVCLIList(out []byte) NVCLIFiles {
+	var files NVCLIFiles
+	for _, line := range strings.Split(string(out), "\n") {
+		path := strings.TrimSpace(line)
+		if !strings.HasPrefix(path, "/") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(path, "/dev/"):
+			files.Devices = append(files.Devices, path)
+		case strings.Contains(filepath.Base(path), ".so"):
+			files.Libraries = append(files.Libraries, path)
+		case strings.HasPrefix(path, "/run/") || strings.HasPrefix(path, "/var/run/"):
+			files.Files = append(files.Files, path)
+		default:
+			files.Binaries = append(files.Binaries, path)
+		}
+	}
+	return files
+}
+
+// runNVCLI runs nvidia-container-cli, returning its standard output. The
+// error includes its standard error, holding the reason of the failure.
+func runNVCLI(cmd *exec.Cmd) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return nil, fmt.Errorf("nvidia-container-cli failed with %v: %s", err, msg)
+	}
+	if stderr.Len() > 0 {
+		sylog.Debugf("nvidia-container-cli: %s", strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// ParseGPUs translates a --gpus selection into a NVIDIA_VISIBLE_DEVICES
+// value. The selection is all, none, or a comma separated list of GPU
+// indexes, GPU or MIG UUIDs, and MIG devices given as mig:<gpu>:<instance>.
+func ParseGPUs(gpus string) (string, error) {
+	switch gpus {
+	case "all", "none":
+		return gpus, nil
+	case "":
+		return "", fmt.Errorf("no GPU selected")
+	}
+
+	devices := strings.Split(gpus, ",")
+	for i, d := range devices {
+		switch {
+		case isIndex(d):
+		case strings.HasPrefix(d, "GPU-") || strings.HasPrefix(d, "MIG-"):
+		case strings.HasPrefix(d, "mig:"):
+			gpu, instance, ok := strings.Cut(strings.TrimPrefix(d, "mig:"), ":")
+			if !ok || !isIndex(gpu) || !isIndex(instance) {
+				return "", fmt.Errorf("invalid MIG device %q, expected mig:<gpu>:<instance>", d)
+			}
+			devices[i] = gpu + ":" + instance
+		default:
+			return "", fmt.Errorf("invalid GPU %q, expected an index, a UUID or mig:<gpu>:<instance>", d)
+		}
+	}
+	return strings.Join(devices, ","), nil
+}
+
+// isIndex returns true if s is a device index.
+func isIndex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseNvCaps checks a --nv-caps comma separated list of driver
+// capabilities, returning it as a NVIDIA_DRIVER_CAPABILITIES value.
+func ParseNvCaps(caps string) (string, error) {
+	if caps == "all" {
+		return caps, nil
+	}
+	for _, c := range strings.Split(caps, ",") {
+		if !slice.ContainsString(nVDriverCapabilities, c) {
+			return "", fmt.Errorf("unknown driver capability %q, expected all or one of %s", c, strings.Join(nVDriverCapabilities, ","))
+		}
+	}
+	return caps, nil
 }
 
 // NVCLIEnvToFlags reads the passed in NVIDIA_ environment variables supported
@@ -192,6 +364,10 @@ func NVCLIEnvToFlags(nvidiaEnv []string) (flags []string, err error) {
 			defaultDriverCaps = false
 			caps := strings.Split(pair[1], ",")
 
+			if pair[1] == "all" {
+				caps = nVDriverCapabilities
+			}
+
 			for _, capability := range caps {
 				if slice.ContainsString(nVDriverCapabilities, capability) {
 					flags = append(flags, "--"+capability)
@@ -14,19 +14,14 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/apptainer/apptainer/internal/pkg/util/paths"
 	"github.com/apptainer/apptainer/pkg/sylog"
 )
 
 // NvidiaPaths returns a list of Nvidia libraries/binaries that should be
-// mounted into the container in order to use Nvidia GPUs
-func NvidiaPaths(configFilePath string) ([]string, []string, error) {
-	nvidiaFiles, err := gpuliblist(configFilePath)
-	if err != nil {
-		return nil, nil, fmt.Errorf("could not read %s: %v", filepath.Base(configFilePath), err)
-	}
-
-	return paths.Resolve(nvidiaFiles)
+// mounted into the container in order to use Nvidia GPUs, cached in
+// cacheDir unless empty
+func NvidiaPaths(configFilePath, cacheDir string) ([]string, []string, error) {
+	return nvidiaPlatform.resolve(configFilePath, cacheDir)
 }
 
 // NvidiaIpcsPath returns a list of nvidia driver ipcs.
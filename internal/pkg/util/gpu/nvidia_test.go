@@ -132,6 +132,22 @@ func TestNVCLIEnvToFlags(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "all-caps",
+			env: []string{
+				"NVIDIA_DRIVER_CAPABILITIES=all",
+			},
+			wantFlags: []string{
+				"--no-cgroups",
+				"--compute",
+				"--compat32",
+				"--graphics",
+				"--utility",
+				"--video",
+				"--display",
+			},
+			wantErr: false,
+		},
 		{
 			name: "disable-require",
 			env: []string{
@@ -163,3 +179,147 @@ func TestNVCLIEnvToFlags(t *testing.T) {
 		})
 	}
 }
+
+func TestParseGPUs(t *testing.T) {
+	tests := []struct {
+		gpus    string
+		want    string
+		wantErr bool
+	}{
+		{gpus: "all", want: "all"},
+		{gpus: "none", want: "none"},
+		{gpus: "0", want: "0"},
+		{gpus: "0,1", want: "0,1"},
+		{gpus: "mig:0:1", want: "0:1"},
+		{gpus: "1,mig:0:1", want: "1,0:1"},
+		{gpus: "GPU-8e5b0a3c-2b3a-4d1e-9f45-1c2d3e4f5a6b", want: "GPU-8e5b0a3c-2b3a-4d1e-9f45-1c2d3e4f5a6b"},
+		{gpus: "MIG-5c89852c-d268-c3f3-1b07-005d5ae1dc3f", want: "MIG-5c89852c-d268-c3f3-1b07-005d5ae1dc3f"},
+		{gpus: "", wantErr: true},
+		{gpus: "0,", wantErr: true},
+		{gpus: "all,0", wantErr: true},
+		{gpus: "gpu0", wantErr: true},
+		{gpus: "mig:0", wantErr: true},
+		{gpus: "mig:a:1", wantErr: true},
+		{gpus: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.gpus, func(t *testing.T) {
+			got, err := ParseGPUs(tt.gpus)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGPUs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseGPUs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNvCaps(t *testing.T) {
+	tests := []struct {
+		caps    string
+		wantErr bool
+	}{
+		{caps: "all"},
+		{caps: "compute"},
+		{caps: "compute,video,utility"},
+		{caps: "", wantErr: true},
+		{caps: "compute,", wantErr: true},
+		{caps: "compute,all", wantErr: true},
+		{caps: "gpu", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.caps, func(t *testing.T) {
+			got, err := ParseNvCaps(tt.caps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNvCaps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.caps {
+				t.Errorf("ParseNvCaps() = %q, want %q", got, tt.caps)
+			}
+		})
+	}
+}
+
+func TestNVCLIConfigureArgs(t *testing.T) {
+	env := []string{
+		"NVIDIA_VISIBLE_DEVICES=0,1:0",
+		"NVIDIA_DRIVER_CAPABILITIES=compute,video",
+	}
+	tests := []struct {
+		name   string
+		userNS bool
+		want   []string
+	}{
+		{
+			name: "Root",
+			want: []string{
+				"configure", "--no-cgroups", "--device=0,1:0", "--compute", "--video",
+				"--ldconfig=@/sbin/ldconfig", "/rootfs",
+			},
+		},
+		{
+			name:   "UserNamespace",
+			userNS: true,
+			want: []string{
+				"--user", "configure", "--no-cgroups", "--device=0,1:0", "--compute", "--video",
+				"--ldconfig=@/sbin/ldconfig", "/rootfs",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NVCLIConfigureArgs(env, "/sbin/ldconfig", "/rootfs", tt.userNS)
+			if err != nil {
+				t.Fatalf("NVCLIConfigureArgs() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NVCLIConfigureArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NVCLIConfigureArgs([]string{"NVIDIA_DRIVER_CAPABILITIES=gpu"}, "/sbin/ldconfig", "/rootfs", false); err == nil {
+		t.Errorf("NVCLIConfigureArgs() unexpected success with invalid capability")
+	}
+}
+
+func TestNVCLIListArgs(t *testing.T) {
+	env := []string{
+		"NVIDIA_VISIBLE_DEVICES=0:1",
+		"NVIDIA_DRIVER_CAPABILITIES=compute,compat32",
+		"NVIDIA_REQUIRE_CUDA=cuda>=11.0",
+	}
+	want := []string{"--user", "list", "--libraries", "--binaries", "--ipcs", "--device=0:1", "--compat32"}
+	got, err := NVCLIListArgs(env, true)
+	if err != nil {
+		t.Fatalf("NVCLIListArgs() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NVCLIListArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestParseNVCLIList(t *testing.T) {
+	out := []byte(`/dev/nvidiactl
+/dev/nvidia-uvm
+/dev/nvidia0
+/usr/bin/nvidia-smi
+/usr/bin/nvidia-persistenced
+/usr/lib/x86_64-linux-gnu/libnvidia-ml.so.535.104.05
+/usr/lib/x86_64-linux-gnu/libcuda.so.535.104.05
+/run/nvidia-persistenced/socket
+`)
+	want := NVCLIFiles{
+		Libraries: []string{
+			"/usr/lib/x86_64-linux-gnu/libnvidia-ml.so.535.104.05",
+			"/usr/lib/x86_64-linux-gnu/libcuda.so.535.104.05",
+		},
+		Binaries: []string{"/usr/bin/nvidia-smi", "/usr/bin/nvidia-persistenced"},
+		Files:    []string{"/run/nvidia-persistenced/socket"},
+		Devices:  []string{"/dev/nvidiactl", "/dev/nvidia-uvm", "/dev/nvidia0"},
+	}
+	if got := parseNVCLIList(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNVCLIList() = %+v, want %+v", got, want)
+	}
+}
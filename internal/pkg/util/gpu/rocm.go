@@ -10,22 +10,14 @@
 package gpu
 
 import (
-	"fmt"
 	"os"
-	"path/filepath"
-
-	"github.com/apptainer/apptainer/internal/pkg/util/paths"
 )
 
 // RocmPaths returns a list of rocm libraries/binaries that should be
-// mounted into the container in order to use AMD GPUs
-func RocmPaths(configFilePath string) ([]string, []string, error) {
-	rocmFiles, err := gpuliblist(configFilePath)
-	if err != nil {
-		return nil, nil, fmt.Errorf("could not read %s: %v", filepath.Base(configFilePath), err)
-	}
-
-	return paths.Resolve(rocmFiles)
+// mounted into the container in order to use AMD GPUs, cached in cacheDir
+// unless empty
+func RocmPaths(configFilePath, cacheDir string) ([]string, []string, error) {
+	return rocmPlatform.resolve(configFilePath, cacheDir)
 }
 
 // RocmDevices returns a list of /dev entries required for ROCm functionality.
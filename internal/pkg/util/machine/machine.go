@@ -290,10 +290,13 @@ func canEmulate(arch string) bool {
 	return false
 }
 
-// CompatibleWith returns if the current machine architecture is
-// compatible or can run via emulation the architecture passed in
-// argument.
-func CompatibleWith(arch string) bool {
+// EmulationHint explains how to run the binaries of another architecture
+// on the current machine.
+const EmulationHint = "install qemu-user-static and register its interpreters in /proc/sys/fs/binfmt_misc with the F (fix binary) flag"
+
+// nativelyCompatible returns if the current machine architecture can
+// natively run the architecture passed in argument.
+func nativelyCompatible(arch string) bool {
 	currentArch := runtime.GOARCH
 
 	if currentArch == arch {
@@ -306,5 +309,18 @@ func CompatibleWith(arch string) bool {
 		}
 	}
 
-	return canEmulate(arch)
+	return false
+}
+
+// CompatibleWith returns if the current machine architecture is
+// compatible or can run via emulation the architecture passed in
+// argument.
+func CompatibleWith(arch string) bool {
+	return nativelyCompatible(arch) || canEmulate(arch)
+}
+
+// Emulated returns if the architecture passed in argument runs on the
+// current machine only via binfmt_misc emulation.
+func Emulated(arch string) bool {
+	return !nativelyCompatible(arch) && canEmulate(arch)
 }
@@ -0,0 +1,94 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package nesting detects when apptainer is running inside another
+// container, where some of its features can't work as on a host.
+package nesting
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/namespaces"
+	"golang.org/x/sys/unix"
+)
+
+// paths and checks used during detection, variables to allow testing
+var (
+	procSysDir  = "/proc/sys"
+	starterSuid = filepath.Join(buildcfg.LIBEXECDIR, "apptainer/bin/starter-suid")
+
+	insideUserNamespace = func() bool {
+		inside, _ := namespaces.IsInsideUserNamespace(os.Getpid())
+		return inside
+	}
+)
+
+// Environment describes the container apptainer is nested in.
+type Environment struct {
+	// Reasons lists the evidences of nesting found.
+	Reasons []string
+	// ProcMasked is true when /proc/sys is masked or read-only,
+	// preventing a fresh proc filesystem from being mounted.
+	ProcMasked bool
+	// UserNS is true when running inside a user namespace, where
+	// neither the setuid starter nor the subuid mappings can be used.
+	UserNS bool
+	// NoSuid is true when the setuid starter is on a nosuid mount.
+	NoSuid bool
+}
+
+// Nested returns whether apptainer is running inside a container.
+func (e *Environment) Nested() bool {
+	return len(e.Reasons) > 0
+}
+
+// Detect looks for evidences from the kernel that apptainer is running
+// inside an apptainer, docker or podman container. Environment variables
+// and files any user can create are not trusted, as options requested by
+// the user are dropped in a nested environment.
+func Detect() *Environment {
+	e := &Environment{}
+
+	if insideUserNamespace() {
+		e.UserNS = true
+		e.Reasons = append(e.Reasons, "running in a user namespace")
+	}
+
+	var st unix.Statfs_t
+	if err := unix.Statfs(procSysDir, &st); err != nil {
+		sylog.Debugf("Could not check %s: %s", procSysDir, err)
+	} else if st.Type != unix.PROC_SUPER_MAGIC {
+		e.ProcMasked = true
+		e.Reasons = append(e.Reasons, procSysDir+" is masked")
+	} else if st.Flags&unix.ST_RDONLY != 0 {
+		e.ProcMasked = true
+		e.Reasons = append(e.Reasons, procSysDir+" is read-only")
+	}
+
+	if err := unix.Statfs(starterSuid, &st); err == nil && st.Flags&unix.ST_NOSUID != 0 {
+		e.NoSuid = true
+		e.Reasons = append(e.Reasons, starterSuid+" is on a nosuid mount")
+	}
+
+	return e
+}
+
+// Report logs a single summary of the adaptations made because
+// apptainer is running inside a container.
+func (e *Environment) Report(adaptations []string) {
+	reasons := strings.Join(e.Reasons, ", ")
+	if len(adaptations) == 0 {
+		sylog.Verbosef("Running inside a container (%s), no adaptation required", reasons)
+		return
+	}
+	sylog.Infof("Running inside a container (%s), adapting: %s (disable with --no-nesting-autodetect)", reasons, strings.Join(adaptations, "; "))
+}
@@ -0,0 +1,110 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package nesting
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+
+	defer func(p, s string, u func() bool) {
+		procSysDir, starterSuid, insideUserNamespace = p, s, u
+	}(procSysDir, starterSuid, insideUserNamespace)
+
+	// the environment variables and files any user can create are ignored
+	t.Setenv("APPTAINER_CONTAINER", "/image.sif")
+	t.Setenv("SINGULARITY_CONTAINER", "/image.sif")
+
+	tests := []struct {
+		name        string
+		userNS      bool
+		procSysDir  string
+		starterSuid string
+		nested      bool
+		procMasked  bool
+	}{
+		{
+			name:        "Host",
+			procSysDir:  "/proc",
+			starterSuid: filepath.Join(dir, "starter-suid"),
+			nested:      false,
+		},
+		{
+			name:        "UserNamespace",
+			userNS:      true,
+			procSysDir:  "/proc",
+			starterSuid: filepath.Join(dir, "starter-suid"),
+			nested:      true,
+		},
+		{
+			name:        "MaskedProc",
+			procSysDir:  dir,
+			starterSuid: filepath.Join(dir, "starter-suid"),
+			nested:      true,
+			procMasked:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			procSysDir = tt.procSysDir
+			starterSuid = tt.starterSuid
+			insideUserNamespace = func() bool { return tt.userNS }
+
+			env := Detect()
+			if env.Nested() != tt.nested {
+				t.Errorf("unexpected nested value %v (reasons: %v)", env.Nested(), env.Reasons)
+			}
+			if env.ProcMasked != tt.procMasked {
+				t.Errorf("unexpected masked /proc value %v", env.ProcMasked)
+			}
+			if env.UserNS != tt.userNS {
+				t.Errorf("unexpected user namespace value %v", env.UserNS)
+			}
+			if env.NoSuid {
+				t.Errorf("unexpected nosuid starter")
+			}
+		})
+	}
+}
+
+func TestDetectNosuidStarter(t *testing.T) {
+	defer func(p, s string, u func() bool) {
+		procSysDir, starterSuid, insideUserNamespace = p, s, u
+	}(procSysDir, starterSuid, insideUserNamespace)
+
+	procSysDir = "/proc"
+	insideUserNamespace = func() bool { return false }
+
+	b, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		t.Fatalf("while reading mounts: %s", err)
+	}
+	starterSuid = ""
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 3 && strings.Contains(","+fields[3]+",", ",nosuid,") {
+			starterSuid = fields[1]
+			break
+		}
+	}
+	if starterSuid == "" {
+		t.Skip("no nosuid mount found")
+	}
+
+	env := Detect()
+	if !env.Nested() || !env.NoSuid {
+		t.Errorf("setuid starter on nosuid mount %s not detected (reasons: %v)", starterSuid, env.Reasons)
+	}
+}
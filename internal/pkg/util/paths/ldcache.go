@@ -0,0 +1,215 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package paths
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// The ld cache formats written by glibc ldconfig, see elf/cache.c and
+// sysdeps/generic/dl-cache.h in the glibc sources. The old format is only
+// written by the ldconfig of glibc < 2.32 by default, followed by the new
+// format in the same file (compat format).
+const (
+	ldCacheOldMagic = "ld.so-1.7.0"
+	ldCacheNewMagic = "glibc-ld.so.cache1.1"
+
+	// old header: magic[11], nlibs uint32
+	ldCacheOldHeaderSize = 16
+	// old entry: flags int32, key uint32, value uint32
+	ldCacheOldEntrySize = 12
+	// new header: magic[17], version[3], nlibs uint32, len_strings uint32,
+	// flags uint8, padding[3], extension_offset uint32, unused[3] uint32
+	ldCacheNewHeaderSize = 48
+	// new entry: flags int32, key uint32, value uint32, osversion uint32,
+	// hwcap uint64
+	ldCacheNewEntrySize = 24
+
+	// flags of the new header giving the byte order
+	ldCacheEndianLittle = 2
+	ldCacheEndianBig    = 3
+
+	// entry flags identifying the libraries of the host architecture
+	ldCacheFlagTypeMask     = 0x00ff
+	ldCacheFlagELF          = 0x0001
+	ldCacheFlagELFLibc6     = 0x0003
+	ldCacheFlagRequiredMask = 0xff00
+)
+
+// ldCacheRequiredFlags maps the Go architectures to the ld cache flags
+// required for their libraries, the architectures without flags use the
+// bare ELF and libc6 types.
+var ldCacheRequiredFlags = map[string]uint32{
+	"386":      0x0000,
+	"amd64":    0x0300,
+	"arm":      0x0900,
+	"arm64":    0x0a00,
+	"loong64":  0x1200,
+	"mips64":   0x0700,
+	"mips64le": 0x0700,
+	"ppc64":    0x0500,
+	"ppc64le":  0x0500,
+	"riscv64":  0x1000,
+	"s390x":    0x0400,
+}
+
+// nativeByteOrder returns the byte order of the host, used by the ld
+// caches not recording it.
+func nativeByteOrder() binary.ByteOrder {
+	switch runtime.GOARCH {
+	case "mips", "mips64", "ppc64", "s390x", "sparc64":
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// ldCacheEntry is a library listed in the ld cache.
+type ldCacheEntry struct {
+	name  string
+	path  string
+	flags uint32
+}
+
+// readLdCache returns the libraries of the host architecture listed in
+// the ld cache file, like ldconfigCache does with the ldconfig output.
+func readLdCache(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseLdCache(b)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing %s: %w", path, err)
+	}
+	required, ok := ldCacheRequiredFlags[runtime.GOARCH]
+	return ldCacheLibraries(entries, required, ok), nil
+}
+
+// ldCacheLibraries maps the library names to the path of their first,
+// highest priority, entry. When filter is true, only the entries with
+// the required flags of the host architecture are considered.
+func ldCacheLibraries(entries []ldCacheEntry, required uint32, filter bool) map[string]string {
+	libs := make(map[string]string, len(entries))
+	for _, e := range entries {
+		if filter {
+			if t := e.flags & ldCacheFlagTypeMask; t != ldCacheFlagELF && t != ldCacheFlagELFLibc6 {
+				continue
+			}
+			if e.flags&ldCacheFlagRequiredMask != required {
+				continue
+			}
+		}
+		if _, ok := libs[e.name]; !ok {
+			libs[e.name] = e.path
+		}
+	}
+	return libs
+}
+
+// parseLdCache returns the entries of an ld cache in the old, new or
+// compat format, in the cache order.
+func parseLdCache(b []byte) ([]ldCacheEntry, error) {
+	if bytes.HasPrefix(b, []byte(ldCacheNewMagic)) {
+		return parseLdCacheNew(b)
+	}
+	if !bytes.HasPrefix(b, []byte(ldCacheOldMagic)) || len(b) < ldCacheOldHeaderSize {
+		return nil, fmt.Errorf("unknown ld cache format")
+	}
+
+	order := nativeByteOrder()
+	nlibs := uint64(order.Uint32(b[12:16]))
+	stringsStart := ldCacheOldHeaderSize + nlibs*ldCacheOldEntrySize
+	if stringsStart > uint64(len(b)) {
+		return nil, fmt.Errorf("truncated ld cache")
+	}
+
+	// the new format follows the old entries in the compat format,
+	// aligned on 8 bytes
+	newStart := (stringsStart + 7) &^ 7
+	if newStart < uint64(len(b)) && bytes.HasPrefix(b[newStart:], []byte(ldCacheNewMagic)) {
+		return parseLdCacheNew(b[newStart:])
+	}
+
+	entries := make([]ldCacheEntry, 0, nlibs)
+	for i := uint64(0); i < nlibs; i++ {
+		off := ldCacheOldHeaderSize + i*ldCacheOldEntrySize
+		e, err := ldCacheEntryAt(b, stringsStart, order, b[off:off+ldCacheOldEntrySize])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseLdCacheNew returns the entries of an ld cache in the new format,
+// its string offsets are relative to the start of the header.
+func parseLdCacheNew(b []byte) ([]ldCacheEntry, error) {
+	if len(b) < ldCacheNewHeaderSize {
+		return nil, fmt.Errorf("truncated ld cache")
+	}
+
+	order := nativeByteOrder()
+	switch b[28] {
+	case ldCacheEndianLittle:
+		order = binary.LittleEndian
+	case ldCacheEndianBig:
+		order = binary.BigEndian
+	}
+
+	nlibs := uint64(order.Uint32(b[20:24]))
+	if ldCacheNewHeaderSize+nlibs*ldCacheNewEntrySize > uint64(len(b)) {
+		return nil, fmt.Errorf("truncated ld cache")
+	}
+
+	entries := make([]ldCacheEntry, 0, nlibs)
+	for i := uint64(0); i < nlibs; i++ {
+		off := ldCacheNewHeaderSize + i*ldCacheNewEntrySize
+		e, err := ldCacheEntryAt(b, 0, order, b[off:off+ldCacheNewEntrySize])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// ldCacheEntryAt decodes the flags, key and value fields starting the
+// entry, the key and value being offsets of strings from base.
+func ldCacheEntryAt(b []byte, base uint64, order binary.ByteOrder, entry []byte) (ldCacheEntry, error) {
+	name, err := ldCacheString(b, base+uint64(order.Uint32(entry[4:8])))
+	if err != nil {
+		return ldCacheEntry{}, err
+	}
+	path, err := ldCacheString(b, base+uint64(order.Uint32(entry[8:12])))
+	if err != nil {
+		return ldCacheEntry{}, err
+	}
+	return ldCacheEntry{
+		name:  name,
+		path:  path,
+		flags: order.Uint32(entry[0:4]),
+	}, nil
+}
+
+// ldCacheString returns the NUL terminated string at offset off.
+func ldCacheString(b []byte, off uint64) (string, error) {
+	if off >= uint64(len(b)) {
+		return "", fmt.Errorf("invalid string offset %d in ld cache", off)
+	}
+	end := bytes.IndexByte(b[off:], 0)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string in ld cache")
+	}
+	return string(b[off : off+uint64(end)]), nil
+}
@@ -0,0 +1,213 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build linux
+
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// readLdconfigOutput returns the entries listed in a file holding the
+// output of ldconfig -p for an ld cache, in the same order.
+func readLdconfigOutput(t *testing.T, path string) []ldCacheEntry {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("while reading %s: %s", path, err)
+	}
+	r := regexp.MustCompile(`(?m)^\s*(\S+)\s*\(.*\)\s*=>\s*(.*)$`)
+	var entries []ldCacheEntry
+	for _, m := range r.FindAllSubmatch(b, -1) {
+		entries = append(entries, ldCacheEntry{name: string(m[1]), path: string(m[2])})
+	}
+	return entries
+}
+
+// The fixtures are the ld cache of a Debian 12 x86_64 host, using the
+// new format written by glibc >= 2.32, and the ld cache of a host with
+// x86_64 and i386 NVIDIA and ROCm libraries written by ldconfig in the new,
+// compat (glibc < 2.32 default, e.g. RHEL 8 and Ubuntu 20.04) and old
+// formats, plus the new format of a big endian host. The .ldconfig files
+// hold the output of ldconfig -p for the caches.
+func TestParseLdCache(t *testing.T) {
+	tests := []struct {
+		cache    string
+		ldconfig string
+	}{
+		{cache: "debian-12-x86_64.cache", ldconfig: "debian-12-x86_64.ldconfig"},
+		{cache: "multiarch-new.cache", ldconfig: "multiarch.ldconfig"},
+		{cache: "multiarch-compat.cache", ldconfig: "multiarch.ldconfig"},
+		{cache: "multiarch-old.cache", ldconfig: "multiarch.ldconfig"},
+		{cache: "multiarch-new-be.cache", ldconfig: "multiarch.ldconfig"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cache, func(t *testing.T) {
+			b, err := os.ReadFile(filepath.Join("testdata", "ldcache", tt.cache))
+			if err != nil {
+				t.Fatalf("while reading fixture: %s", err)
+			}
+			entries, err := parseLdCache(b)
+			if err != nil {
+				t.Fatalf("parseLdCache() error = %v", err)
+			}
+			want := readLdconfigOutput(t, filepath.Join("testdata", "ldcache", tt.ldconfig))
+			if len(entries) != len(want) {
+				t.Fatalf("parseLdCache() gave %d entries, want %d", len(entries), len(want))
+			}
+			for i := range entries {
+				if entries[i].name != want[i].name || entries[i].path != want[i].path {
+					t.Errorf("entry %d = %s => %s, want %s => %s", i, entries[i].name, entries[i].path, want[i].name, want[i].path)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLdCacheInvalid(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "ldcache", "multiarch-new.cache"))
+	if err != nil {
+		t.Fatalf("while reading fixture: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: nil},
+		{name: "Unknown", data: []byte("not an ld cache")},
+		{name: "TruncatedHeader", data: b[:ldCacheNewHeaderSize-1]},
+		{name: "TruncatedEntries", data: b[:ldCacheNewHeaderSize+ldCacheNewEntrySize]},
+		{name: "TruncatedStrings", data: b[:len(b)-200]},
+		{name: "TruncatedOld", data: []byte(ldCacheOldMagic + "\x00\xff\xff\x00\x00")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseLdCache(tt.data); err == nil {
+				t.Errorf("parseLdCache() unexpected success")
+			}
+		})
+	}
+}
+
+func TestLdCacheLibraries(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "ldcache", "multiarch-compat.cache"))
+	if err != nil {
+		t.Fatalf("while reading fixture: %s", err)
+	}
+	entries, err := parseLdCache(b)
+	if err != nil {
+		t.Fatalf("parseLdCache() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		required uint32
+		filter   bool
+		want     map[string]string
+	}{
+		{
+			name:     "amd64",
+			required: ldCacheRequiredFlags["amd64"],
+			filter:   true,
+			want: map[string]string{
+				"libz.so.1":             "/usr/lib/x86_64-linux-gnu/libz.so.1",
+				"libnvidia-ml.so.1":     "/usr/lib64/nvidia/libnvidia-ml.so.1",
+				"libhsa-runtime64.so.1": "/opt/rocm/lib/libhsa-runtime64.so.1",
+				"libcuda.so.1":          "/usr/lib64/nvidia/libcuda.so.1",
+				"libamdhip64.so.5":      "/opt/rocm/lib/libamdhip64.so.5",
+				"libEGL_nvidia.so.0":    "/usr/lib64/nvidia/libEGL_nvidia.so.0",
+			},
+		},
+		{
+			name:     "386",
+			required: ldCacheRequiredFlags["386"],
+			filter:   true,
+			want: map[string]string{
+				"libnvidia-ml.so.1": "/usr/lib/i386-linux-gnu/libnvidia-ml.so.1",
+				"libcuda.so.1":      "/usr/lib/i386-linux-gnu/libcuda.so.1",
+			},
+		},
+		{
+			name:     "arm64",
+			required: ldCacheRequiredFlags["arm64"],
+			filter:   true,
+			want:     map[string]string{},
+		},
+		{
+			name: "Unfiltered",
+			want: map[string]string{
+				"libz.so.1":             "/usr/lib/x86_64-linux-gnu/libz.so.1",
+				"libnvidia-ml.so.1":     "/usr/lib64/nvidia/libnvidia-ml.so.1",
+				"libhsa-runtime64.so.1": "/opt/rocm/lib/libhsa-runtime64.so.1",
+				"libcuda.so.1":          "/usr/lib64/nvidia/libcuda.so.1",
+				"libamdhip64.so.5":      "/opt/rocm/lib/libamdhip64.so.5",
+				"libEGL_nvidia.so.0":    "/usr/lib64/nvidia/libEGL_nvidia.so.0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ldCacheLibraries(entries, tt.required, tt.filter)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ldCacheLibraries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadLdCache(t *testing.T) {
+	if _, err := os.Stat(ldCacheFile); err != nil {
+		t.Skipf("no ld cache: %s", err)
+	}
+	got, err := readLdCache(ldCacheFile)
+	if err != nil {
+		t.Fatalf("readLdCache() error = %v", err)
+	}
+	want, err := ldconfigCache()
+	if err != nil {
+		t.Skipf("could not run ldconfig: %s", err)
+	}
+	// the ldconfig output includes the libraries of other architectures,
+	// listed first on multiarch hosts
+	for name, path := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("readLdCache() %s => %s not listed by ldconfig", name, path)
+		}
+	}
+	if len(got) == 0 {
+		t.Errorf("readLdCache() gave no results")
+	}
+}
+
+// BenchmarkReadLdCache measures the parsing of the system ld cache done
+// once per process by the library resolution, without ldconfig.
+func BenchmarkReadLdCache(b *testing.B) {
+	if _, err := os.Stat(ldCacheFile); err != nil {
+		b.Skipf("no ld cache: %s", err)
+	}
+	for i := 0; i < b.N; i++ {
+		if _, err := readLdCache(ldCacheFile); err != nil {
+			b.Fatalf("readLdCache() error = %v", err)
+		}
+	}
+}
+
+// BenchmarkLdconfigCache measures the ldconfig execution used when the
+// system ld cache can't be parsed.
+func BenchmarkLdconfigCache(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := ldconfigCache(); err != nil {
+			b.Skipf("could not run ldconfig: %s", err)
+		}
+	}
+}
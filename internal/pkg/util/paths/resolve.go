@@ -17,6 +17,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -148,12 +150,72 @@ func Resolve(fileList []string) ([]string, []string, error) {
 	return libraries, binaries, nil
 }
 
-// ldcache retrieves a map of <library>.so[.version] to its absolute path using
+// ldCacheFile is the system ld cache, parsed directly or read by ldconfig,
+// its modification time and size are used to invalidate cached results.
+var ldCacheFile = "/etc/ld.so.cache"
+
+// LdCacheFile returns the path of the system ld cache.
+func LdCacheFile() string {
+	return ldCacheFile
+}
+
+var ldCacheState struct {
+	sync.Mutex
+	modTime time.Time
+	size    int64
+	entries map[string]string
+}
+
+// ldCache returns the system ld cache entries, the ld cache is only read
+// again if the ld cache file changed since the previous call, with
+// ldconfig when it can't be parsed. The entries are only kept by the
+// current process: parsing the ld cache is faster than decoding a copy
+// of the entries stored in the user cache directory, and the files
+// resolved for --nv and --rocm are already cached there by the gpu package.
+func ldCache() (map[string]string, error) {
+	fi, statErr := os.Stat(ldCacheFile)
+
+	ldCacheState.Lock()
+	defer ldCacheState.Unlock()
+
+	if statErr == nil && ldCacheState.entries != nil &&
+		fi.ModTime().Equal(ldCacheState.modTime) && fi.Size() == ldCacheState.size {
+		return copyLdCache(ldCacheState.entries), nil
+	}
+
+	entries, err := readLdCache(ldCacheFile)
+	if err != nil {
+		// musl and other C libraries have no ld cache
+		sylog.Debugf("Could not read ld cache, using ldconfig: %s", err)
+		entries, err = ldconfigCache()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ldCacheState.entries = nil
+	if statErr == nil {
+		ldCacheState.modTime = fi.ModTime()
+		ldCacheState.size = fi.Size()
+		ldCacheState.entries = entries
+	}
+	return copyLdCache(entries), nil
+}
+
+func copyLdCache(entries map[string]string) map[string]string {
+	c := make(map[string]string, len(entries))
+	for k, v := range entries {
+		c[k] = v
+	}
+	return c
+}
+
+// ldconfigCache retrieves a map of <library>.so[.version] to its absolute path using
 // the system ld cache via `ldconfig -p`. We only take the first instance of
 // each <library>.so[.version] from `ldconfig -p` output. I.E. if `ldconfig -p`
 // lists three variants of libEGL.so.1 that are in different locations, we only
 // report the first, highest priority, variant.
-func ldCache() (map[string]string, error) {
+func ldconfigCache() (map[string]string, error) {
 	// walk through the ldconfig output and add entries which contain the filenames
 	// returned by nvidia-container-cli OR the nvliblist.conf file contents
 	ldconfig, err := bin.FindBin("ldconfig")
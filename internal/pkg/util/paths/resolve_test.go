@@ -17,6 +17,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 var testLibList = []string{"libc.so", "echo"}
@@ -51,6 +52,47 @@ func TestLdCache(t *testing.T) {
 	t.Error("ldCache() result did not include expected ld-linux entry")
 }
 
+func TestLdCacheInvalidation(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "ld.so.cache")
+	if err := os.WriteFile(cacheFile, []byte("cache"), 0o644); err != nil {
+		t.Fatalf("while writing %s: %s", cacheFile, err)
+	}
+
+	origCacheFile := ldCacheFile
+	ldCacheFile = cacheFile
+	defer func() {
+		ldCacheFile = origCacheFile
+		ldCacheState.entries = nil
+	}()
+
+	if _, err := ldCache(); err != nil {
+		t.Fatalf("ldCache() error = %v", err)
+	}
+
+	// replace cached entries, they must be returned while the cache
+	// file is unchanged
+	ldCacheState.entries = map[string]string{"libfake.so": "/fake/libfake.so"}
+	gotCache, err := ldCache()
+	if err != nil {
+		t.Fatalf("ldCache() error = %v", err)
+	}
+	if !reflect.DeepEqual(gotCache, ldCacheState.entries) {
+		t.Errorf("ldCache() = %v, want cached entries", gotCache)
+	}
+
+	mtime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(cacheFile, mtime, mtime); err != nil {
+		t.Fatalf("while changing %s times: %s", cacheFile, err)
+	}
+	gotCache, err = ldCache()
+	if err != nil {
+		t.Fatalf("ldCache() error = %v", err)
+	}
+	if _, ok := gotCache["libfake.so"]; ok {
+		t.Errorf("ldCache() returned stale entries after cache file update")
+	}
+}
+
 func TestSoLinks(t *testing.T) {
 	// Test link structure:
 	// a.so.1.2 -> a.so.1 -> a.so (file)
@@ -39,3 +39,89 @@ func EscapeDoubleQuotes(s string) string {
 func EscapeSingleQuotes(s string) string {
 	return strings.Replace(s, `'`, `'"'"'`, -1)
 }
+
+// isSafeWord returns true if s only holds characters never interpreted
+// by the shell in a word.
+func isSafeWord(s string) bool {
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("@%+=:,./_-", c):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Quote returns s quoted as a single shell word, read back by the shell
+// as s without any expansion, like the %q format of the bash printf
+// builtin. Unlike printf, the POSIX single quotes are used for any value,
+// newlines and other control characters are kept as is.
+func Quote(s string) string {
+	if isSafeWord(s) {
+		return s
+	}
+	return `'` + EscapeSingleQuotes(s) + `'`
+}
+
+// QuoteExpand returns s double quoted as a single shell word. The shell
+// still performs the parameter expansions and command substitutions of s
+// and consumes one level of backslash escaping, but the quotes and
+// backslashes of s can't end the word.
+func QuoteExpand(s string) string {
+	var b strings.Builder
+
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 == len(s) {
+				// a trailing backslash would escape the closing quote
+				b.WriteString(`\\`)
+			} else {
+				b.WriteByte(c)
+				b.WriteByte(s[i+1])
+				i++
+			}
+		case '"':
+			b.WriteString(`\"`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// EscapeNewlines escapes the backslashes and newlines of s, so that it
+// holds on a single line and is restored by UnescapeNewlines.
+func EscapeNewlines(s string) string {
+	if !strings.ContainsAny(s, "\\\n") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+// UnescapeNewlines returns the string escaped by EscapeNewlines.
+func UnescapeNewlines(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
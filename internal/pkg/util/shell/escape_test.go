@@ -9,7 +9,14 @@
 
 package shell
 
-import "testing"
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/shell/interpreter"
+)
 
 func TestArgsQuoted(t *testing.T) {
 	quoteTests := []struct {
@@ -93,3 +100,115 @@ func TestEscapeSingleQuotes(t *testing.T) {
 		})
 	}
 }
+
+// quoteCorpus holds values which broke the environment scripts.
+var quoteCorpus = []string{
+	"",
+	"plain",
+	"with space",
+	"line1\nline2",
+	"trailing newline\n",
+	"\n",
+	`single ' quote`,
+	`double " quote`,
+	`'"'"'`,
+	`back\slash`,
+	`trailing\`,
+	`\n literal`,
+	`\u000A`,
+	"$HOME ${HOME} $(id) `id`",
+	"-leading-dash",
+	"--",
+	"unicode é ✓ 世界",
+	"tab\tand\rreturn",
+	"glob * ? [a]",
+	"; rm -rf / #",
+	"a=b",
+	strings.Repeat("long 'value' \"with\" \\ and\n", 1024),
+}
+
+func TestQuote(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skipf("sh not found: %s", err)
+	}
+
+	for _, value := range quoteCorpus {
+		quoted := Quote(value)
+
+		cmd := exec.Command(sh)
+		cmd.Stdin = strings.NewReader("X=" + quoted + "\nprintf '%s' \"$X\"\n")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Errorf("sh failed for %q quoted as %s: %s", value, quoted, err)
+		} else if string(out) != value {
+			t.Errorf("sh read %q quoted as %s as %q", value, quoted, out)
+		}
+
+		env, err := interpreter.EvaluateEnv(context.Background(), []byte("export X="+quoted), nil, nil)
+		if err != nil {
+			t.Errorf("interpreter failed for %q quoted as %s: %s", value, quoted, err)
+			continue
+		}
+		found := false
+		for _, e := range env {
+			if strings.HasPrefix(e, "X=") {
+				found = true
+				if e[2:] != value {
+					t.Errorf("interpreter read %q quoted as %s as %q", value, quoted, e[2:])
+				}
+			}
+		}
+		if !found {
+			t.Errorf("X not exported for %q quoted as %s", value, quoted)
+		}
+	}
+}
+
+func TestQuoteExpand(t *testing.T) {
+	quoteTests := []struct {
+		input    string
+		expected string
+	}{
+		{`plain`, `plain`},
+		{`double " quote`, `double " quote`},
+		{`single ' quote`, `single ' quote`},
+		{"line1\nline2", "line1\nline2"},
+		{`trailing\`, `trailing\`},
+		{`escaped \$HOME`, `escaped $HOME`},
+		{`escaped \"`, `escaped "`},
+		{`$HOME`, "/home/test"},
+		{`${HOME}/bin`, "/home/test/bin"},
+	}
+
+	for _, test := range quoteTests {
+		t.Run(test.input, func(t *testing.T) {
+			script := "export X=" + QuoteExpand(test.input)
+			env, err := interpreter.EvaluateEnv(context.Background(), []byte(script), nil, []string{"HOME=/home/test"})
+			if err != nil {
+				t.Fatalf("unexpected error for %s: %s", script, err)
+			}
+			for _, e := range env {
+				if strings.HasPrefix(e, "X=") {
+					if e[2:] != test.expected {
+						t.Errorf("got %q, expected %q", e[2:], test.expected)
+					}
+					return
+				}
+			}
+			t.Errorf("X not exported by %s", script)
+		})
+	}
+}
+
+func TestEscapeNewlines(t *testing.T) {
+	for _, value := range quoteCorpus {
+		escaped := EscapeNewlines(value)
+		if strings.Contains(escaped, "\n") {
+			t.Errorf("newline left in %q", escaped)
+		}
+		if got := UnescapeNewlines(escaped); got != value {
+			t.Errorf("got %q, expected %q", got, value)
+		}
+	}
+}
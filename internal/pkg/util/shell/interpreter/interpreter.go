@@ -22,6 +22,7 @@ import (
 	"syscall"
 	"time"
 
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
 	"mvdan.cc/sh/v3/expand"
 	"mvdan.cc/sh/v3/interp"
 	"mvdan.cc/sh/v3/syntax"
@@ -76,7 +77,7 @@ func defaultExecHandler(ctx context.Context, args []string) error {
 				c := strings.Join(args, " ")
 				return fmt.Errorf("command %q was killed after %s timeout", c, execTimeout)
 			}
-			return interp.NewExitStatus(uint8(status.ExitStatus()))
+			return interp.NewExitStatus(uint8(signalutil.ExitCode(status)))
 		}
 		return interp.NewExitStatus(1)
 	case *exec.Error:
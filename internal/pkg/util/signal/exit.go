@@ -0,0 +1,23 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package signal
+
+import "syscall"
+
+// ExitCode returns the exit code passed on for a process with the wait
+// status: the exit code of the process, or 128 plus the number of the
+// signal which killed it, like the shell does. The exit codes from 241
+// to 255 are reserved for the failures of Apptainer itself, see the
+// internal/pkg/util/starter package.
+func ExitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
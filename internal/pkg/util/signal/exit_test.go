@@ -0,0 +1,48 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package signal
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   int
+	}{
+		{"Success", "exit 0", 0},
+		{"Failure", "exit 3", 3},
+		{"HighCode", "exit 200", 200},
+		{"SIGTERM", "kill -TERM $$", 128 + int(syscall.SIGTERM)},
+		{"SIGKILL", "kill -KILL $$", 128 + int(syscall.SIGKILL)},
+		{"SIGINT", "trap - INT; kill -INT $$", 128 + int(syscall.SIGINT)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := exec.Command("/bin/sh", "-c", tt.script).Run()
+
+			var status syscall.WaitStatus
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				status = exitErr.Sys().(syscall.WaitStatus)
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := ExitCode(status); got != tt.want {
+				t.Errorf("got exit code %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
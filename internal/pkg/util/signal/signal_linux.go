@@ -20,6 +20,7 @@ void raiseSignal(int sig) {
 import "C"
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -76,3 +77,15 @@ func Raise(sig unix.Signal) {
 	// let's proceed with C
 	C.raiseSignal(C.int(int(sig)))
 }
+
+// IgnoreEINTR calls fn until it returns an error other than EINTR, for
+// the system calls not restarted after a signal was handled, like when
+// a job scheduler broadcasts signals to the container processes.
+func IgnoreEINTR(fn func() error) error {
+	for {
+		err := fn()
+		if !errors.Is(err, unix.EINTR) {
+			return err
+		}
+	}
+}
@@ -10,6 +10,8 @@
 package signal
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"golang.org/x/sys/unix"
@@ -77,3 +79,30 @@ func TestConvert(t *testing.T) {
 		}
 	}
 }
+
+func TestIgnoreEINTR(t *testing.T) {
+	calls := 0
+	err := IgnoreEINTR(func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("while reading: %w", unix.EINTR)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if calls != 3 {
+		t.Errorf("got %d calls, want 3", calls)
+	}
+
+	calls = 0
+	err = IgnoreEINTR(func() error {
+		calls++
+		return unix.EBADF
+	})
+	if !errors.Is(err, unix.EBADF) {
+		t.Errorf("got error %v, want %v", err, unix.EBADF)
+	} else if calls != 1 {
+		t.Errorf("got %d calls, want 1", calls)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package starter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"syscall"
+
+	signalutil "github.com/apptainer/apptainer/internal/pkg/util/signal"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// Stage is the stage of the container startup reporting a failure.
+type Stage string
+
+// Failure stages reported by the starter C code and by the engine, the
+// exit codes of the namespace and capabilities stages must match those
+// of cmd/starter/c/include/message.h.
+const (
+	StageNamespace    Stage = "namespace"
+	StageCapabilities Stage = "capabilities"
+	StageConfig       Stage = "config"
+	StageMount        Stage = "mount"
+	StageCreate       Stage = "create"
+	StageStart        Stage = "start"
+)
+
+var stageExitCodes = map[Stage]int{
+	StageNamespace:    246,
+	StageCapabilities: 245,
+	StageConfig:       244,
+	StageMount:        243,
+	StageCreate:       242,
+	StageStart:        241,
+}
+
+// Class is the class of a failure that scripts can tell apart by its exit
+// code, whatever the stage or the command failing.
+type Class string
+
+// Failure classes, with the exit codes documented in the help of the
+// commands.
+const (
+	// ClassNotFound is the class of the image references that don't exist.
+	ClassNotFound Class = "not-found"
+	// ClassUnauthorized is the class of the credentials missing or rejected
+	// by a library, a registry or a server.
+	ClassUnauthorized Class = "unauthorized"
+	// ClassPolicy is the class of the images and operations denied by the
+	// site policy.
+	ClassPolicy Class = "policy"
+)
+
+var classExitCodes = map[Class]int{
+	ClassNotFound:     247,
+	ClassUnauthorized: 248,
+	ClassPolicy:       249,
+}
+
+// ExitCode returns the exit code of a failure of class c, or 255 for an
+// unknown class.
+func (c Class) ExitCode() int {
+	if code, ok := classExitCodes[c]; ok {
+		return code
+	}
+	return 255
+}
+
+// ErrPolicyDenied is matched by the errors of the images and operations
+// denied by the site policy, like the limit container and allow container
+// directives of apptainer.conf, the signer policy or the ECL.
+var ErrPolicyDenied = errors.New("denied by policy")
+
+// policyError marks an error as matching ErrPolicyDenied, keeping its
+// message unchanged.
+type policyError struct {
+	err error
+}
+
+func (e *policyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *policyError) Unwrap() error {
+	return e.err
+}
+
+func (e *policyError) Is(target error) bool {
+	return target == ErrPolicyDenied
+}
+
+// PolicyDenied returns err marked as matching ErrPolicyDenied.
+func PolicyDenied(err error) error {
+	return &policyError{err: err}
+}
+
+// ExitCode returns the exit code of a failure at stage, or 255 for an
+// unknown stage.
+func (s Stage) ExitCode() int {
+	if code, ok := stageExitCodes[s]; ok {
+		return code
+	}
+	return 255
+}
+
+// Record is a machine-readable error record reported by a failing stage
+// of the container startup.
+type Record struct {
+	Stage   Stage  `json:"stage,omitempty"`
+	Class   Class  `json:"class,omitempty"`
+	Code    int    `json:"code,omitempty"`
+	Errno   int    `json:"errno"`
+	Errname string `json:"errname,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+	// Hint is the actionable message of a well-known record
+	Hint string `json:"hint,omitempty"`
+}
+
+// ExitCode returns the exit code of the class of a record, or of the stage
+// of a record reporting a system error, or 255 like for any other fatal
+// error, so the validation errors of the configuration keep their exit
+// code.
+func (r Record) ExitCode() int {
+	if r.Class != "" {
+		return r.Class.ExitCode()
+	}
+	if r.Errno == 0 {
+		return 255
+	}
+	return r.Stage.ExitCode()
+}
+
+// errname returns the symbolic name of the error number of the record.
+func (r Record) errname() string {
+	if r.Errname != "" {
+		return r.Errname
+	}
+	if r.Errno == 0 {
+		return ""
+	}
+	return unix.ErrnoName(syscall.Errno(r.Errno))
+}
+
+// Translate returns an actionable message for a well-known record, or an
+// empty string.
+func Translate(r Record) string {
+	errname := r.errname()
+
+	switch r.Stage {
+	case StageMount:
+		target := "mount"
+		if r.Path != "" {
+			target = "mounting " + r.Path
+		}
+		switch syscall.Errno(r.Errno) {
+		case syscall.EACCES, syscall.EPERM:
+			return fmt.Sprintf("%s failed: %s — check `mount hostfs` and bind path configuration", target, errname)
+		case syscall.ENOENT:
+			return fmt.Sprintf("%s failed: %s — check that the source and destination of the bind path exist", target, errname)
+		case syscall.ENOTDIR:
+			return fmt.Sprintf("%s failed: %s — the source and destination of the bind path must be both directories or both files", target, errname)
+		case syscall.ENODEV:
+			return fmt.Sprintf("%s failed: %s — the filesystem type is not supported by the kernel", target, errname)
+		}
+	case StageNamespace:
+		switch syscall.Errno(r.Errno) {
+		case syscall.EPERM, syscall.EACCES:
+			if r.Path != "" {
+				return fmt.Sprintf("joining namespace %s failed: %s — check that the instance is owned by you and still running", r.Path, errname)
+			}
+			return fmt.Sprintf("namespace creation failed: %s — check that user namespaces are enabled or use the setuid installation", errname)
+		case syscall.EINVAL, syscall.ENOSPC:
+			return fmt.Sprintf("namespace creation failed: %s — check the user.max_*_namespaces sysctl values", errname)
+		case syscall.ENOENT:
+			if r.Path != "" {
+				return fmt.Sprintf("joining namespace %s failed: %s — the instance is not running anymore", r.Path, errname)
+			}
+		}
+	case StageCapabilities:
+		switch syscall.Errno(r.Errno) {
+		case syscall.EPERM, syscall.EINVAL:
+			return fmt.Sprintf("applying container privileges failed: %s — check the capabilities granted with `apptainer capability` and the --add-caps/--drop-caps options", errname)
+		}
+	}
+	return ""
+}
+
+// NewRecord returns the error record of err for stage, about path if not
+// empty. The error number of the record is the underlying syscall.Errno of
+// err, if any, and its class is ClassPolicy if err matches ErrPolicyDenied.
+func NewRecord(stage Stage, path string, err error) Record {
+	r := Record{
+		Stage:   stage,
+		Path:    path,
+		Message: err.Error(),
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		r.Errno = int(errno)
+		r.Errname = r.errname()
+	}
+	if errors.Is(err, ErrPolicyDenied) {
+		r.Class = ClassPolicy
+	}
+	return r
+}
+
+// Output returns the line printed for the record, the record as JSON with
+// its hint and exit code if jsonOutput is set, or else the hint of a
+// well-known record.
+func (r Record) Output(jsonOutput bool) string {
+	r.Hint = Translate(r)
+	if !jsonOutput {
+		return r.Hint
+	}
+	r.Code = r.ExitCode()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return r.Hint
+	}
+	return string(data)
+}
+
+// reportFd is the file descriptor where error records are written.
+var reportFd = -1
+
+// SetReportFd sets the file descriptor where Report writes error records.
+func SetReportFd(fd int) {
+	reportFd = fd
+}
+
+// Report writes the error record of err for stage, about path if not
+// empty, when a report file descriptor is set.
+func Report(stage Stage, path string, err error) {
+	if reportFd < 0 || err == nil {
+		return
+	}
+	data, err := json.Marshal(NewRecord(stage, path, err))
+	if err != nil {
+		sylog.Debugf("Failed to marshal error record: %s", err)
+		return
+	}
+	err = signalutil.IgnoreEINTR(func() error {
+		_, err := unix.Write(reportFd, append(data, '\n'))
+		return err
+	})
+	if err != nil {
+		sylog.Debugf("Failed to write error record: %s", err)
+	}
+}
+
+// ReadRecords reads the error records available on the non-blocking file
+// descriptor fd, in their reporting order.
+func ReadRecords(fd int) ([]Record, error) {
+	var buf bytes.Buffer
+
+	data := make([]byte, 4096)
+	for {
+		n, err := unix.Read(fd, data)
+		if n > 0 {
+			buf.Write(data[:n])
+		}
+		if err == unix.EAGAIN || (err == nil && n == 0) {
+			break
+		} else if err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("while reading error records: %s", err)
+		}
+	}
+	return ParseRecords(buf.Bytes())
+}
+
+// ParseRecords parses the error records of data, one JSON record per line.
+func ParseRecords(data []byte) ([]Record, error) {
+	var records []Record
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			return records, fmt.Errorf("while decoding error record %q: %s", line, err)
+		}
+		r.Errname = r.errname()
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
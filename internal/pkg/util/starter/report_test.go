@@ -0,0 +1,172 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package starter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name   string
+		record Record
+		want   string
+	}{
+		{
+			name:   "mount permission denied",
+			record: Record{Stage: StageMount, Errno: int(syscall.EACCES), Path: "/cvmfs"},
+			want:   "mounting /cvmfs failed: EACCES — check `mount hostfs` and bind path configuration",
+		},
+		{
+			name:   "mount not a directory",
+			record: Record{Stage: StageMount, Errno: int(syscall.ENOTDIR), Path: "/data"},
+			want:   "mounting /data failed: ENOTDIR — the source and destination of the bind path must be both directories or both files",
+		},
+		{
+			name:   "namespace join",
+			record: Record{Stage: StageNamespace, Errno: int(syscall.EPERM), Path: "/proc/42/ns/net"},
+			want:   "joining namespace /proc/42/ns/net failed: EPERM — check that the instance is owned by you and still running",
+		},
+		{
+			name:   "namespace creation",
+			record: Record{Stage: StageNamespace, Errno: int(syscall.ENOSPC)},
+			want:   "namespace creation failed: ENOSPC — check the user.max_*_namespaces sysctl values",
+		},
+		{
+			name:   "capabilities",
+			record: Record{Stage: StageCapabilities, Errno: int(syscall.EPERM)},
+			want:   "applying container privileges failed: EPERM — check the capabilities granted with `apptainer capability` and the --add-caps/--drop-caps options",
+		},
+		{
+			name:   "unknown errno",
+			record: Record{Stage: StageMount, Errno: int(syscall.EIO), Path: "/cvmfs"},
+		},
+		{
+			name:   "no errno",
+			record: Record{Stage: StageConfig, Message: "bad configuration"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Translate(tt.record); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordExitCode(t *testing.T) {
+	tests := []struct {
+		record Record
+		want   int
+	}{
+		{Record{Stage: StageNamespace, Errno: int(syscall.EPERM)}, 246},
+		{Record{Stage: StageCapabilities, Errno: int(syscall.EPERM)}, 245},
+		{Record{Stage: StageConfig, Errno: int(syscall.ENOENT)}, 244},
+		{Record{Stage: StageMount, Errno: int(syscall.EACCES)}, 243},
+		{Record{Stage: StageCreate, Errno: int(syscall.EACCES)}, 242},
+		{Record{Stage: StageStart, Errno: int(syscall.ENOENT)}, 241},
+		{Record{Stage: "unknown", Errno: int(syscall.EPERM)}, 255},
+		// validation errors keep the exit code of fatal errors
+		{Record{Stage: StageConfig}, 255},
+		// the class takes precedence over the stage
+		{Record{Stage: StageConfig, Class: ClassPolicy}, 249},
+		{Record{Class: ClassNotFound}, 247},
+		{Record{Class: ClassUnauthorized}, 248},
+		{Record{Class: "unknown"}, 255},
+	}
+
+	for _, tt := range tests {
+		if got := tt.record.ExitCode(); got != tt.want {
+			t.Errorf("unexpected exit code for %+v: got %d, want %d", tt.record, got, tt.want)
+		}
+	}
+}
+
+func TestReportReadRecords(t *testing.T) {
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		t.Fatalf("failed to create pipe: %s", err)
+	}
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+
+	SetReportFd(p[1])
+	defer SetReportFd(-1)
+
+	// a record written by the starter C code
+	cRecord := `{"stage":"namespace","errno":1,"path":"/proc/42/ns/\"net\"","message":"Failed to enter in network namespace: Operation not permitted"}` + "\n"
+	if _, err := unix.Write(p[1], []byte(cRecord)); err != nil {
+		t.Fatalf("failed to write record: %s", err)
+	}
+	mountErr := &os.PathError{Op: "mount", Path: "/cvmfs", Err: syscall.EACCES}
+	Report(StageMount, "/cvmfs", fmt.Errorf("while mounting: %w", mountErr))
+	Report(StageCreate, "", errors.New("container creation failed"))
+	Report(StageConfig, "", fmt.Errorf("while loading image: %w", PolicyDenied(errors.New("image prohibited by ECL"))))
+	Report(StageStart, "", nil)
+
+	records, err := ReadRecords(p[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []Record{
+		{Stage: StageNamespace, Errno: 1, Errname: "EPERM", Path: `/proc/42/ns/"net"`, Message: "Failed to enter in network namespace: Operation not permitted"},
+		{Stage: StageMount, Errno: int(syscall.EACCES), Errname: "EACCES", Path: "/cvmfs", Message: "while mounting: mount /cvmfs: permission denied"},
+		{Stage: StageCreate, Message: "container creation failed"},
+		{Stage: StageConfig, Class: ClassPolicy, Message: "while loading image: image prohibited by ECL"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d: %+v", len(records), len(want), records)
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Errorf("record %d: got %+v, want %+v", i, records[i], want[i])
+		}
+	}
+
+	// nothing left to read
+	records, err = ReadRecords(p[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(records) != 0 {
+		t.Fatalf("unexpected records %+v", records)
+	}
+}
+
+func TestRecordOutput(t *testing.T) {
+	r := Record{Stage: StageMount, Errno: int(syscall.EACCES), Path: "/cvmfs", Message: "permission denied"}
+
+	if got, want := r.Output(false), Translate(r); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	out := r.Output(true)
+	for _, s := range []string{`"stage":"mount"`, `"code":243`, `"errno":13`, `"path":"/cvmfs"`, `"hint":"mounting /cvmfs failed`} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%s not found in JSON output %s", s, out)
+		}
+	}
+	records, err := ParseRecords([]byte(out))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(records) != 1 || records[0].Errname != "EACCES" {
+		t.Fatalf("unexpected records %+v", records)
+	}
+
+	if _, err := ParseRecords([]byte("not a record\n")); err == nil {
+		t.Errorf("unexpected success while parsing an invalid record")
+	}
+}
@@ -24,6 +24,16 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// jsonErrors is set to print the error records of the container startup
+// failures as JSON.
+var jsonErrors bool
+
+// SetJSONErrors sets if the starter prints the error records of the
+// container startup failures as JSON rather than as actionable messages.
+func SetJSONErrors(enable bool) {
+	jsonErrors = enable
+}
+
 // CommandOp represents a function type passed to Exec/Run allowing
 // to customize the starter command execution.
 type CommandOp func(*Command)
@@ -101,9 +111,22 @@ func Exec(name string, config *config.Common, ops ...CommandOp) error {
 // Run executes the starter binary and returns once starter
 // finished its execution.
 func Run(name string, config *config.Common, ops ...CommandOp) error {
+	cmd, err := Start(name, config, ops...)
+	if err != nil {
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("while running %s: %w", cmd.Path, err)
+	}
+	return nil
+}
+
+// Start starts the starter binary and returns its command, without
+// waiting for it to finish. The caller must wait for the command.
+func Start(name string, config *config.Common, ops ...CommandOp) (*exec.Cmd, error) {
 	c := new(Command)
 	if err := c.init(config, ops...); err != nil {
-		return fmt.Errorf("while initializing starter command: %s", err)
+		return nil, fmt.Errorf("while initializing starter command: %s", err)
 	}
 
 	cmd := exec.Command(c.path)
@@ -117,10 +140,10 @@ func Run(name string, config *config.Common, ops ...CommandOp) error {
 	cmd.Stdout = c.stdout
 	cmd.Stderr = c.stderr
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("while running %s: %s", c.path, err)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("while running %s: %w", c.path, err)
 	}
-	return nil
+	return cmd, nil
 }
 
 // copyConfigToEnv checks that the current stack size is big enough
@@ -199,7 +222,7 @@ func copyConfigToEnv(data []byte) ([]string, error) {
 	)
 }
 
-func (c *Command) init(config *config.Common, ops ...CommandOp) error {
+func (c *Command) init(cfg *config.Common, ops ...CommandOp) error {
 	c.path = filepath.Join(buildcfg.LIBEXECDIR, "apptainer/bin/starter")
 
 	for _, op := range ops {
@@ -212,7 +235,13 @@ func (c *Command) init(config *config.Common, ops ...CommandOp) error {
 		return fmt.Errorf("%s not found, please check your installation", c.path)
 	}
 
-	data, err := json.Marshal(config)
+	if jsonErrors {
+		cfg.JSONErrors = true
+	}
+	cfg.SchemaVersion = config.SchemaVersion
+	cfg.Version = buildcfg.PACKAGE_VERSION
+
+	data, err := json.Marshal(cfg)
 	if err != nil {
 		return fmt.Errorf("while marshaling config: %s", err)
 	}
@@ -25,6 +25,10 @@ const (
 	HTTPS = "https"
 	// Oras is the keyword for an oras ref
 	Oras = "oras"
+	// FTP is the keyword for ftp ref
+	FTP = "ftp"
+	// SFTP is the keyword for sftp ref
+	SFTP = "sftp"
 )
 
 // validURIs contains a list of known uris
@@ -38,6 +42,8 @@ var validURIs = map[string]bool{
 	"oci-archive":    true,
 	"http":           true,
 	"https":          true,
+	"ftp":            true,
+	"sftp":           true,
 	"oras":           true,
 }
 
@@ -69,8 +75,11 @@ func GetName(uri string) string {
 	ref = strings.TrimLeft(ref, "/")    // Trim leading "/" characters
 	refSplit := strings.Split(ref, "/") // Split ref into parts
 
-	if transport == HTTP || transport == HTTPS {
+	if transport == HTTP || transport == HTTPS || transport == FTP || transport == SFTP {
 		imageName := refSplit[len(refSplit)-1]
+		// drop a checksum fragment and a query
+		imageName, _, _ = strings.Cut(imageName, "#")
+		imageName, _, _ = strings.Cut(imageName, "?")
 		return imageName
 	}
 
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	osuser "os/user"
 	"strconv"
+	"sync"
 	"syscall"
 	"unsafe"
 )
@@ -54,6 +55,10 @@ static int mygetgrnam_r(const char *name, struct group *grp,
 	char *buf, size_t buflen, struct group **result) {
  return getgrnam_r(name, grp, buf, buflen, result);
 }
+
+static char *mygrmem(struct group *grp, int i) {
+ return grp->gr_mem[i];
+}
 */
 import "C"
 
@@ -203,9 +208,54 @@ func buildGroup(grp *C.struct_group) *Group {
 		GID:  uint32(grp.gr_gid),
 		Name: C.GoString(grp.gr_name),
 	}
+	for i := 0; grp.gr_mem != nil; i++ {
+		member := C.mygrmem(grp, C.int(i))
+		if member == nil {
+			break
+		}
+		g.Members = append(g.Members, C.GoString(member))
+	}
 	return g
 }
 
+// entMutex serializes the enumerations of the user and group databases
+// because getpwent and getgrent are not reentrant.
+var entMutex sync.Mutex
+
+func allUsers() []*User {
+	entMutex.Lock()
+	defer entMutex.Unlock()
+
+	C.setpwent()
+	defer C.endpwent()
+
+	var users []*User
+	for {
+		pwd := C.getpwent()
+		if pwd == nil {
+			return users
+		}
+		users = append(users, buildUser(pwd))
+	}
+}
+
+func allGroups() []*Group {
+	entMutex.Lock()
+	defer entMutex.Unlock()
+
+	C.setgrent()
+	defer C.endgrent()
+
+	var groups []*Group
+	for {
+		grp := C.getgrent()
+		if grp == nil {
+			return groups
+		}
+		groups = append(groups, buildGroup(grp))
+	}
+}
+
 type bufferKind C.int
 
 const (
@@ -25,8 +25,9 @@ type User struct {
 
 // Group represents a Unix group information.
 type Group struct {
-	Name string
-	GID  uint32
+	Name    string
+	GID     uint32
+	Members []string
 }
 
 // GetPwUID returns a pointer to User structure associated with user uid.
@@ -49,6 +50,18 @@ func GetGrNam(name string) (*Group, error) {
 	return lookupGroup(name)
 }
 
+// GetAllPw returns the users of the user database, which doesn't include
+// the users of network databases with enumeration disabled.
+func GetAllPw() []*User {
+	return allUsers()
+}
+
+// GetAllGr returns the groups of the group database, which doesn't
+// include the groups of network databases with enumeration disabled.
+func GetAllGr() []*Group {
+	return allGroups()
+}
+
 // Current returns a pointer to User structure associated with current user.
 func Current() (*User, error) {
 	return current()
@@ -40,6 +40,21 @@ CLEANFILES += $(apptainer)
 INSTALLFILES += $(apptainer_INSTALL) $(singularity_INSTALL)
 ALL += $(apptainer)
 
+# plugin SDK, the sources apptainer was built from, to compile plugins
+# with a go.mod outside of the source tree
+plugin_sdk_INSTALL := $(DESTDIR)$(LIBEXECDIR)/apptainer/plugin-sdk
+.PHONY: install-plugin-sdk
+install-plugin-sdk: $(apptainer_build_config)
+	@echo " INSTALL" $(plugin_sdk_INSTALL)
+	$(V)rm -rf $(plugin_sdk_INSTALL)
+	$(V)umask 0022 && mkdir -p $(plugin_sdk_INSTALL)
+	$(V)cd $(SOURCEDIR) && install -m 0644 go.mod go.sum LICENSE.md $(plugin_sdk_INSTALL)
+	$(V)cd $(SOURCEDIR) && find cmd internal pkg -type f \
+		\( -name '*.go' -o -name '*.[ch]' \) ! -name '*_test.go' | \
+		while read f; do \
+			install -D -m 0644 $$f $(plugin_sdk_INSTALL)/$$f || exit 1; \
+		done
+
 
 # bash_completion files
 bash_completion1 :=  $(BUILDDIR)/bash-completion/completions/apptainer
@@ -66,6 +66,32 @@ $(sessiondir_INSTALL):
 INSTALLFILES += $(sessiondir_INSTALL)
 
 
+# registry of the instances started at boot
+instances_enabled_INSTALL := $(DESTDIR)$(LOCALSTATEDIR)/apptainer/instances-enabled
+$(instances_enabled_INSTALL):
+	@echo " INSTALL" $@
+	$(V)umask 0077 && mkdir -p $@
+
+INSTALLFILES += $(instances_enabled_INSTALL)
+
+
+# systemd unit starting the instances enabled at boot
+instances_unit := $(BUILDDIR)/apptainer-instances.service
+$(instances_unit): $(SOURCEDIR)/etc/systemd/apptainer-instances.service.in
+	@echo " GEN $@"
+	$(V)sed -e 's|@BINDIR@|$(BINDIR)|g' $< > $@
+
+instances_unit_INSTALL := $(DESTDIR)$(PREFIX)/lib/systemd/system/apptainer-instances.service
+$(instances_unit_INSTALL): $(instances_unit)
+	@echo " INSTALL" $@
+	$(V)umask 0022 && mkdir -p $(@D)
+	$(V)install -m 0644 $< $@
+
+CLEANFILES += $(instances_unit)
+INSTALLFILES += $(instances_unit_INSTALL)
+ALL += $(instances_unit)
+
+
 # run-singularity script
 run_singularity := $(SOURCEDIR)/scripts/run-singularity
 
@@ -12,6 +12,7 @@ package image
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -38,6 +39,8 @@ const (
 	RAW
 	// GOCRYPTFS constant for encrypted gocryptfs format
 	GOCRYPTFSSQUASHFS
+	// TAR constant for tar archive format
+	TAR
 )
 
 type Usage uint8
@@ -107,6 +110,7 @@ var registeredFormats = []struct {
 	{"sif", &sifFormat{}},
 	{"squashfs", &squashfsFormat{}},
 	{"ext3", &ext3Format{}},
+	{"tar", &tarFormat{}},
 }
 
 // format describes the interface that an image format type must implement.
@@ -124,6 +128,7 @@ type Section struct {
 	ID           uint32 `json:"id"`
 	Type         uint32 `json:"type"`
 	AllowedUsage Usage  `json:"allowed_usage"`
+	Arch         string `json:"arch,omitempty"`
 }
 
 // Image describes an image object, an image is composed of one
@@ -143,6 +148,24 @@ type Image struct {
 	Usage      Usage     `json:"usage"`
 }
 
+// FormatName returns the name of the image format: sif, sandbox, squashfs,
+// ext3, or tar, tar.gz and tar.zst for the tar archives.
+func (i *Image) FormatName() string {
+	switch i.Type {
+	case SIF:
+		return "sif"
+	case SANDBOX:
+		return "sandbox"
+	case SQUASHFS:
+		return "squashfs"
+	case EXT3:
+		return "ext3"
+	case TAR:
+		return archiveFormat(i)
+	}
+	return "unknown"
+}
+
 // ReInit fills in the File object if needed.  This function should be
 // called after passing an image object between processes using JSON
 func (i *Image) ReInit() {
@@ -385,6 +408,19 @@ func Init(path string, writable bool) (*Image, error) {
 		Usage: RootFsUsage,
 	}
 
+	// the image file is opened once per open mode and reused across
+	// format probes, formats read their header from the file start
+	var file *os.File
+	var fileinfo os.FileInfo
+	openMode := -1
+
+	closeFile := func() {
+		if file != nil {
+			_ = file.Close()
+			file = nil
+		}
+	}
+
 	for _, rf := range registeredFormats {
 		sylog.Debugf("Check for %s image format", rf.name)
 
@@ -400,15 +436,26 @@ func Init(path string, writable bool) (*Image, error) {
 			}
 		}
 
-		img.File, err = os.OpenFile(resolvedPath, mode, 0)
-		if err != nil {
-			continue
-		}
-		fileinfo, err := img.File.Stat()
-		if err != nil {
-			_ = img.File.Close()
-			return nil, err
+		if file != nil && mode == openMode {
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				closeFile()
+				return nil, err
+			}
+		} else {
+			closeFile()
+			openMode = mode
+			file, err = os.OpenFile(resolvedPath, mode, 0)
+			if err != nil {
+				file = nil
+				continue
+			}
+			fileinfo, err = file.Stat()
+			if err != nil {
+				closeFile()
+				return nil, err
+			}
 		}
+		img.File = file
 
 		// readOnlyFilesystemError is allowed here and passed back
 		// to the caller because there is basically no error with
@@ -417,10 +464,9 @@ func Init(path string, writable bool) (*Image, error) {
 		initErr := rf.format.initializer(img, fileinfo)
 		if _, ok := initErr.(debugError); ok {
 			sylog.Debugf("%s format initializer returned: %v", rf.name, initErr)
-			_ = img.File.Close()
 			continue
 		} else if initErr != nil && !IsReadOnlyFilesytem(initErr) {
-			_ = img.File.Close()
+			closeFile()
 			return nil, initErr
 		}
 
@@ -434,12 +480,15 @@ func Init(path string, writable bool) (*Image, error) {
 		img.Fd = img.File.Fd()
 
 		if err := rf.format.lock(img); err != nil {
-			_ = img.File.Close()
+			closeFile()
 			return nil, err
 		}
 
 		return img, initErr
 	}
 
+	closeFile()
+	img.File = nil
+
 	return nil, ErrUnknownFormat
 }
@@ -104,7 +104,7 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 		// has persistent emulation enabled in /proc/sys/fs/binfmt_misc to
 		// be able to execute container process correctly
 		if goArch != "unknown" && !machine.CompatibleWith(goArch) {
-			return fmt.Errorf("the image's architecture (%s) could not run on the host's (%s)", goArch, runtime.GOARCH)
+			return fmt.Errorf("the image's architecture (%s) could not run on the host's (%s), to run it with emulation %s", goArch, runtime.GOARCH, machine.EmulationHint)
 		}
 
 		groupID = desc.GroupID()
@@ -117,12 +117,13 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 				Name:         RootFs,
 				Type:         htype,
 				AllowedUsage: RootFsUsage,
+				Arch:         goArch,
 			},
 		}
 	}
 
 	fimg.WithDescriptors(func(desc sif.Descriptor) bool {
-		if fstype, ptype, _, err := desc.PartitionMetadata(); err == nil {
+		if fstype, ptype, goArch, err := desc.PartitionMetadata(); err == nil {
 			// exclude partitions that are not types data or overlay
 			if ptype != sif.PartData && ptype != sif.PartOverlay {
 				return false
@@ -152,6 +153,7 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 				Name:         desc.Name(),
 				Type:         htype,
 				AllowedUsage: usage,
+				Arch:         goArch,
 			}
 			img.Partitions = append(img.Partitions, partition)
 			img.Usage |= usage
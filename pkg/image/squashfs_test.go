@@ -156,6 +156,11 @@ func TestSquashfsCompression(t *testing.T) {
 			path: "./testdata/squashfs.lzo",
 			comp: "lzo",
 		},
+		{
+			name: "version 4 header zstd comp",
+			path: "./testdata/squashfs.zstd",
+			comp: "zstd",
+		},
 	}
 
 	for _, tt := range tests {
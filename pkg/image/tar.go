@@ -0,0 +1,128 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	tarBlockSize   = 512
+	tarMagicOffset = 257
+	tarMagic       = "ustar"
+	gzipMagic      = "\x1f\x8b"
+	zstdMagic      = "\x28\xb5\x2f\xfd"
+)
+
+// tarFormat is a tar archive of a root filesystem, uncompressed or
+// compressed with gzip or zstd. The archive can't be mounted, it's
+// extracted to a sandbox before running.
+type tarFormat struct{}
+
+// archiveCompression returns the compression of the archive starting with
+// b: gzip, zstd or an empty string if not compressed.
+func archiveCompression(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte(gzipMagic)):
+		return "gzip"
+	case bytes.HasPrefix(b, []byte(zstdMagic)):
+		return "zstd"
+	}
+	return ""
+}
+
+// NewArchiveReader returns a reader of the uncompressed tar archive read
+// from r, the compression being detected from the magic number of the
+// archive.
+func NewArchiveReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	b, _ := br.Peek(len(zstdMagic))
+
+	switch archiveCompression(b) {
+	case "gzip":
+		return gzip.NewReader(br)
+	case "zstd":
+		d, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return io.NopCloser(br), nil
+}
+
+// archiveFormat returns the name of the format of the tar archive img.
+func archiveFormat(img *Image) string {
+	b := make([]byte, len(zstdMagic))
+	if _, err := img.File.ReadAt(b, 0); err != nil {
+		return "tar"
+	}
+	switch archiveCompression(b) {
+	case "gzip":
+		return "tar.gz"
+	case "zstd":
+		return "tar.zst"
+	}
+	return "tar"
+}
+
+func (f *tarFormat) initializer(img *Image, fileinfo os.FileInfo) error {
+	if fileinfo.IsDir() {
+		return debugError("not a tar archive")
+	}
+	r, err := NewArchiveReader(img.File)
+	if err != nil {
+		return debugErrorf("can't read archive: %v", err)
+	}
+	defer r.Close()
+
+	b := make([]byte, tarBlockSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return debugErrorf("can't read first tar header: %v", err)
+	}
+	if !bytes.HasPrefix(b[tarMagicOffset:], []byte(tarMagic)) {
+		return debugError("not a tar archive")
+	}
+
+	img.Type = TAR
+	img.Partitions = []Section{
+		{
+			Offset:       0,
+			Size:         uint64(fileinfo.Size()),
+			ID:           1,
+			Type:         TAR,
+			Name:         RootFs,
+			AllowedUsage: RootFsUsage,
+		},
+	}
+
+	if img.Writable {
+		img.Writable = false
+
+		return &readOnlyFilesystemError{
+			"could not set " + img.Path + " image writable: tar archives are run read-only",
+		}
+	}
+
+	return nil
+}
+
+func (f *tarFormat) openMode(writable bool) int {
+	return os.O_RDONLY
+}
+
+func (f *tarFormat) lock(img *Image) error {
+	return nil
+}
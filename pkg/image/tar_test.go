@@ -0,0 +1,124 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// createArchive creates a tar archive of a single file, compressed with
+// compression if not empty.
+func createArchive(t *testing.T, compression string) string {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	content := []byte("#!/bin/sh\n")
+	if err := tw.WriteHeader(&tar.Header{Name: "bin/sh", Mode: 0o755, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write(content)
+	tw.Close()
+
+	var out bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case "gzip":
+		w = gzip.NewWriter(&out)
+	case "zstd":
+		zw, err := zstd.NewWriter(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	}
+	if w != nil {
+		w.Write(buf.Bytes())
+		w.Close()
+	} else {
+		out = buf
+	}
+
+	path := filepath.Join(t.TempDir(), "rootfs")
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTarInitializer(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		format      string
+	}{
+		{name: "tar", format: "tar"},
+		{name: "gzip", compression: "gzip", format: "tar.gz"},
+		{name: "zstd", compression: "zstd", format: "tar.zst"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := createArchive(t, tt.compression)
+
+			img, err := Init(path, false)
+			if err != nil {
+				t.Fatalf("unexpected error for %s archive: %s", tt.name, err)
+			}
+			defer img.File.Close()
+			if img.Type != TAR {
+				t.Fatalf("image type %d, want %d", img.Type, TAR)
+			}
+			if f := img.FormatName(); f != tt.format {
+				t.Errorf("format %s, want %s", f, tt.format)
+			}
+
+			img.File.Seek(0, io.SeekStart)
+			r, err := NewArchiveReader(img.File)
+			if err != nil {
+				t.Fatalf("unexpected error reading %s archive: %s", tt.name, err)
+			}
+			defer r.Close()
+			hdr, err := tar.NewReader(r).Next()
+			if err != nil {
+				t.Fatalf("unexpected error reading %s archive: %s", tt.name, err)
+			}
+			if hdr.Name != "bin/sh" {
+				t.Errorf("first entry %s, want bin/sh", hdr.Name)
+			}
+		})
+	}
+
+	// initializer must fail if writable is true
+	img, err := Init(createArchive(t, "gzip"), true)
+	if !IsReadOnlyFilesytem(err) {
+		t.Errorf("unexpected error for writable archive: %v", err)
+	}
+	if img != nil {
+		img.File.Close()
+	}
+
+	// gzip compressed data which is not a tar archive
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(make([]byte, 2048))
+	zw.Close()
+	path := filepath.Join(t.TempDir(), "data.gz")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Init(path, false); err != ErrUnknownFormat {
+		t.Errorf("unexpected error for compressed data: %v", err)
+	}
+}
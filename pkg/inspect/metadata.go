@@ -9,6 +9,8 @@
 
 package inspect
 
+import "encoding/json"
+
 // ContainerType defines the container type (used by default).
 const ContainerType = "container"
 
@@ -32,6 +34,12 @@ type Attributes struct {
 	Helpfile    string                    `json:"helpfile,omitempty"`
 	Deffile     string                    `json:"deffile,omitempty"`
 	Startscript string                    `json:"startscript,omitempty"`
+	// OCIConfig is the configuration of the OCI image the container was
+	// built from
+	OCIConfig json.RawMessage `json:"ociConfig,omitempty"`
+	// ImageFormat is the format of the image: sif, sandbox, squashfs, ext3,
+	// tar, tar.gz, tar.zst, or oci for an OCI image uri
+	ImageFormat string `json:"imageFormat,omitempty"`
 }
 
 // Data holds the container metadata attributes.
@@ -63,3 +71,66 @@ func NewMetadata() *Metadata {
 	format.Attributes.Apps = make(map[string]*AppAttributes)
 	return format
 }
+
+// RemoteType defines the type of the metadata of a remote image, fetched
+// from its registry or library without pulling the image.
+const RemoteType = "remote"
+
+// RemoteLayer describes a layer of a remote OCI image, or the SIF file of
+// a remote SIF image.
+type RemoteLayer struct {
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType,omitempty"`
+	Size      int64  `json:"size"`
+}
+
+// RemoteObject describes a data object of the descriptor table of a
+// remote SIF image.
+type RemoteObject struct {
+	ID   uint32 `json:"id"`
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+	Size int64  `json:"size"`
+	// Arch is the architecture of a partition
+	Arch string `json:"arch,omitempty"`
+}
+
+// RemoteAttributes describes the metadata of a remote image.
+type RemoteAttributes struct {
+	Source string `json:"source"`
+	// Digest is the manifest digest of an OCI image, or the digest of the
+	// SIF file of a SIF image
+	Digest       string        `json:"digest"`
+	Size         int64         `json:"size"`
+	Architecture string        `json:"architecture,omitempty"`
+	Layers       []RemoteLayer `json:"layers"`
+	// Objects is the descriptor table of a SIF image
+	Objects    []RemoteObject    `json:"objects,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Env        []string          `json:"env,omitempty"`
+	Entrypoint []string          `json:"entrypoint,omitempty"`
+	Cmd        []string          `json:"cmd,omitempty"`
+	// Environment and Runscript are the ones of a SIF image built by
+	// Apptainer
+	Environment map[string]string `json:"environment,omitempty"`
+	Runscript   string            `json:"runscript,omitempty"`
+}
+
+// RemoteData holds the remote image metadata attributes.
+type RemoteData struct {
+	Attributes RemoteAttributes `json:"attributes"`
+}
+
+// RemoteMetadata describes the JSON format of the metadata of a remote
+// image.
+type RemoteMetadata struct {
+	RemoteData `json:"data"`
+	Type       string `json:"type"`
+}
+
+// NewRemoteMetadata returns the metadata of the remote image attrs.
+func NewRemoteMetadata(attrs *RemoteAttributes) *RemoteMetadata {
+	m := &RemoteMetadata{Type: RemoteType}
+	m.Attributes = *attrs
+	return m
+}
@@ -0,0 +1,138 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// LoopbackInterface is the name of the loopback interface present
+// in every network namespace.
+const LoopbackInterface = "lo"
+
+// AuditInterface describes a network interface found while auditing
+// a network namespace.
+type AuditInterface struct {
+	Name string `json:"name"`
+	Up   bool   `json:"up"`
+}
+
+// Audit reports network interfaces and routes found in the network
+// namespace of the calling process.
+type Audit struct {
+	Interfaces []AuditInterface `json:"interfaces"`
+	Routes     []string         `json:"routes"`
+}
+
+// ForeignInterfaces returns the name of any interface other than
+// the loopback interface.
+func (a *Audit) ForeignInterfaces() []string {
+	var names []string
+	for _, i := range a.Interfaces {
+		if i.Name != LoopbackInterface {
+			names = append(names, i.Name)
+		}
+	}
+	return names
+}
+
+// AuditNamespace lists the network interfaces and routes of the network
+// namespace the calling thread currently belongs to. Everything is queried
+// through netlink so it doesn't depend on /proc or /sys being mounted.
+func AuditNamespace() (*Audit, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("while listing network interfaces: %s", err)
+	}
+
+	audit := &Audit{
+		Interfaces: make([]AuditInterface, 0, len(ifaces)),
+		Routes:     make([]string, 0),
+	}
+	names := make(map[int]string, len(ifaces))
+
+	for _, i := range ifaces {
+		names[i.Index] = i.Name
+		audit.Interfaces = append(audit.Interfaces, AuditInterface{
+			Name: i.Name,
+			Up:   i.Flags&net.FlagUp != 0,
+		})
+	}
+
+	for _, family := range []int{syscall.AF_INET, syscall.AF_INET6} {
+		routes, err := listRoutes(family, names)
+		if err != nil {
+			return nil, err
+		}
+		audit.Routes = append(audit.Routes, routes...)
+	}
+
+	return audit, nil
+}
+
+// listRoutes returns a textual representation of the main table routes
+// for the given address family.
+func listRoutes(family int, names map[int]string) ([]string, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, family)
+	if err != nil {
+		return nil, fmt.Errorf("while querying routes: %s", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing routes: %s", err)
+	}
+
+	routes := make([]string, 0)
+
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWROUTE || len(m.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+		rtm := (*syscall.RtMsg)(unsafe.Pointer(&m.Data[0]))
+		if rtm.Table != syscall.RT_TABLE_MAIN {
+			continue
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing route attributes: %s", err)
+		}
+
+		dst := "default"
+		dev := ""
+		via := ""
+
+		for _, a := range attrs {
+			switch a.Attr.Type {
+			case syscall.RTA_DST:
+				dst = fmt.Sprintf("%s/%d", net.IP(a.Value), rtm.Dst_len)
+			case syscall.RTA_GATEWAY:
+				via = net.IP(a.Value).String()
+			case syscall.RTA_OIF:
+				if len(a.Value) >= 4 {
+					index := int(*(*uint32)(unsafe.Pointer(&a.Value[0])))
+					dev = names[index]
+				}
+			}
+		}
+
+		route := dst
+		if via != "" {
+			route += " via " + via
+		}
+		if dev != "" {
+			route += " dev " + dev
+		}
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
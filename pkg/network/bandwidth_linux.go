@@ -0,0 +1,195 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// rateUnits are the multipliers of the rate and burst units, in bits, as
+// understood by tc.
+var rateUnits = []struct {
+	suffix string
+	name   string
+	factor uint64
+}{
+	{"gbit", "Gbit", 1000 * 1000 * 1000},
+	{"mbit", "Mbit", 1000 * 1000},
+	{"kbit", "Kbit", 1000},
+	{"bit", "bit", 1},
+}
+
+// minBurst is the smallest burst set by default for a rate, the size of an
+// ethernet frame in bits.
+const minBurst = 1500 * 8
+
+// ParseRate parses a rate in bits per second, or a burst in bits, with an
+// optional unit among bit, kbit, mbit and gbit, e.g. 10Mbit.
+func ParseRate(value string) (uint64, error) {
+	number := value
+	factor := uint64(1)
+	lower := strings.ToLower(value)
+	for _, u := range rateUnits {
+		if strings.HasSuffix(lower, u.suffix) {
+			number = value[:len(value)-len(u.suffix)]
+			factor = u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseUint(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a rate, expected a number with an optional bit, kbit, mbit or gbit unit", value)
+	}
+	return n * factor, nil
+}
+
+// FormatRate returns the rate in bits per second, or the burst in bits, in
+// the largest unit dividing it.
+func FormatRate(bits uint64) string {
+	for _, u := range rateUnits {
+		if bits >= u.factor && bits%u.factor == 0 {
+			return strconv.FormatUint(bits/u.factor, 10) + u.name
+		}
+	}
+	return strconv.FormatUint(bits, 10) + "bit"
+}
+
+// defaultBurst returns the burst set along with rate when none is given,
+// 100ms worth of traffic.
+func defaultBurst(rate uint64) uint64 {
+	if burst := rate / 10; burst > minBurst {
+		return burst
+	}
+	return minBurst
+}
+
+// parseBandwidth sets the limits of the bandwidth network argument value,
+// of the form ingress:<rate>[/<burst>][,egress:<rate>[/<burst>]], in b.
+// The burst defaults to 100ms worth of traffic.
+func parseBandwidth(value string, b *BandwidthEntry) error {
+	for _, limit := range strings.Split(value, ",") {
+		direction, spec, ok := strings.Cut(limit, ":")
+		if !ok {
+			return fmt.Errorf("%s is not of the form ingress:<rate>[/<burst>] or egress:<rate>[/<burst>]", limit)
+		}
+		rateSpec, burstSpec, hasBurst := strings.Cut(spec, "/")
+		rate, err := ParseRate(rateSpec)
+		if err != nil {
+			return err
+		}
+		burst := defaultBurst(rate)
+		if hasBurst {
+			if burst, err = ParseRate(burstSpec); err != nil {
+				return err
+			}
+		}
+		switch direction {
+		case "ingress":
+			b.IngressRate, b.IngressBurst = rate, burst
+		case "egress":
+			b.EgressRate, b.EgressBurst = rate, burst
+		default:
+			return fmt.Errorf("unknown direction %s, expected ingress or egress", direction)
+		}
+	}
+	return nil
+}
+
+// bandwidthMax are the maximum limits set by the administrator in the
+// configuration of the bandwidth plugin of a network, the limits requested
+// for a container are clamped to them, and they apply when none is
+// requested.
+type bandwidthMax struct {
+	IngressRate  uint64 `json:"maxIngressRate,omitempty"`
+	IngressBurst uint64 `json:"maxIngressBurst,omitempty"`
+	EgressRate   uint64 `json:"maxEgressRate,omitempty"`
+	EgressBurst  uint64 `json:"maxEgressBurst,omitempty"`
+}
+
+// bandwidthMax returns the maximum limits set in the configuration of the
+// bandwidth plugin of the network at index idx.
+func (m *Setup) bandwidthMax(idx int) (bandwidthMax, error) {
+	var ceiling bandwidthMax
+	for _, plugin := range m.networkConfList[idx].Plugins {
+		if plugin.Network.Type != "bandwidth" {
+			continue
+		}
+		if err := json.Unmarshal(plugin.Bytes, &ceiling); err != nil {
+			return ceiling, fmt.Errorf("while reading the bandwidth maximums of network %s: %s", m.networks[idx], err)
+		}
+		break
+	}
+	return ceiling, nil
+}
+
+// clampLimit returns the requested limit value of a direction clamped to
+// ceiling, the ceiling applying when no limit is requested.
+func (m *Setup) clampLimit(idx int, name string, value, ceiling uint64) uint64 {
+	if ceiling == 0 || (value != 0 && value <= ceiling) {
+		return value
+	}
+	if value != 0 {
+		sylog.Warningf("The %s %s requested on network %s exceeds the maximum %s set by the administrator, using the maximum",
+			name, FormatRate(value), m.networks[idx], FormatRate(ceiling))
+	}
+	return ceiling
+}
+
+// clampBurst returns the burst of a direction limited to rate clamped to
+// ceiling, or the default burst of rate if none is set.
+func (m *Setup) clampBurst(idx int, name string, rate, burst, ceiling uint64) uint64 {
+	if rate == 0 {
+		return 0
+	}
+	if burst = m.clampLimit(idx, name, burst, ceiling); burst == 0 {
+		burst = defaultBurst(rate)
+	}
+	return burst
+}
+
+// limitBandwidth clamps the bandwidth limits requested for the network at
+// index idx to the maximums set by the administrator.
+func (m *Setup) limitBandwidth(idx int) error {
+	if !m.hasCapability(idx, "bandwidth") {
+		return nil
+	}
+	ceiling, err := m.bandwidthMax(idx)
+	if err != nil {
+		return err
+	}
+	if ceiling == (bandwidthMax{}) {
+		return nil
+	}
+
+	b, _ := m.runtimeConf[idx].CapabilityArgs["bandwidth"].(BandwidthEntry)
+	b.IngressRate = m.clampLimit(idx, "ingress rate", b.IngressRate, ceiling.IngressRate)
+	b.EgressRate = m.clampLimit(idx, "egress rate", b.EgressRate, ceiling.EgressRate)
+	// the plugin requires a burst along with a rate, and only then
+	b.IngressBurst = m.clampBurst(idx, "ingress burst", b.IngressRate, b.IngressBurst, ceiling.IngressBurst)
+	b.EgressBurst = m.clampBurst(idx, "egress burst", b.EgressRate, b.EgressBurst, ceiling.EgressBurst)
+	m.runtimeConf[idx].CapabilityArgs["bandwidth"] = b
+	return nil
+}
+
+// GetBandwidth returns the bandwidth limits set for the container on
+// network, and whether any is set.
+func (m *Setup) GetBandwidth(network string) (BandwidthEntry, bool) {
+	for i := range m.networks {
+		if m.networks[i] == network {
+			b, ok := m.runtimeConf[i].CapabilityArgs["bandwidth"].(BandwidthEntry)
+			return b, ok && b != (BandwidthEntry{})
+		}
+	}
+	return BandwidthEntry{}, false
+}
@@ -0,0 +1,139 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"strings"
+	"testing"
+)
+
+const limitedConf = `{
+	"cniVersion": "1.0.0",
+	"name": "limited",
+	"plugins": [
+		{
+			"type": "bridge",
+			"ipam": {
+				"type": "host-local",
+				"subnet": "10.25.0.0/16"
+			}
+		},
+		{
+			"type": "bandwidth",
+			"capabilities": {"bandwidth": true},
+			"maxIngressRate": 20000000,
+			"maxEgressRate": 10000000,
+			"maxEgressBurst": 500000
+		}
+	]
+}`
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    uint64
+		wantErr bool
+	}{
+		{value: "1000", want: 1000},
+		{value: "64bit", want: 64},
+		{value: "10Kbit", want: 10000},
+		{value: "10Mbit", want: 10000000},
+		{value: "2gbit", want: 2000000000},
+		{value: "10MB", wantErr: true},
+		{value: "Mbit", wantErr: true},
+		{value: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unexpected error for %s: %v", tt.value, err)
+		} else if got != tt.want {
+			t.Errorf("got %d for %s, want %d", got, tt.value, tt.want)
+		}
+	}
+
+	for bits, want := range map[uint64]string{10000000: "10Mbit", 1500: "1500bit", 2000: "2Kbit", 3000000000: "3Gbit"} {
+		if got := FormatRate(bits); got != want {
+			t.Errorf("got %s for %d, want %s", got, bits, want)
+		}
+	}
+}
+
+func TestSetArgsBandwidth(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    string
+		args    []string
+		want    BandwidthEntry
+		wantErr string
+	}{
+		{
+			name: "Shorthand",
+			conf: dualStackConf,
+			args: []string{"bandwidth=ingress:10Mbit,egress:5Mbit/100Kbit"},
+			want: BandwidthEntry{IngressRate: 10000000, IngressBurst: 1000000, EgressRate: 5000000, EgressBurst: 100000},
+		},
+		{
+			name: "ShorthandMergedWithRates",
+			conf: dualStackConf,
+			args: []string{"egressRate=2000000;egressBurst=200000", "bandwidth=ingress:1kbit"},
+			want: BandwidthEntry{IngressRate: 1000, IngressBurst: minBurst, EgressRate: 2000000, EgressBurst: 200000},
+		},
+		{
+			name:    "BadDirection",
+			conf:    dualStackConf,
+			args:    []string{"bandwidth=inbound:10Mbit"},
+			wantErr: "unknown direction inbound",
+		},
+		{
+			name:    "BadRate",
+			conf:    dualStackConf,
+			args:    []string{"bandwidth=ingress:10MB"},
+			wantErr: "10MB is not a rate",
+		},
+		{
+			name:    "NoCapability",
+			conf:    ipv4Conf,
+			args:    []string{"bandwidth=ingress:10Mbit"},
+			wantErr: "ipv4 network doesn't have bandwidth capability",
+		},
+		{
+			name: "MaximumsApplyByDefault",
+			conf: limitedConf,
+			want: BandwidthEntry{IngressRate: 20000000, IngressBurst: 2000000, EgressRate: 10000000, EgressBurst: 500000},
+		},
+		{
+			name: "Clamped",
+			conf: limitedConf,
+			args: []string{"bandwidth=ingress:5Mbit,egress:50Mbit/5Mbit"},
+			want: BandwidthEntry{IngressRate: 5000000, IngressBurst: 500000, EgressRate: 10000000, EgressBurst: 500000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup := newTestSetup(t, tt.conf)
+			err := setup.SetArgs(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			name := setup.networks[0]
+			got, ok := setup.GetBandwidth(name)
+			if !ok || got != tt.want {
+				t.Errorf("got bandwidth %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
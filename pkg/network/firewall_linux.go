@@ -0,0 +1,155 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/slice"
+	"github.com/coreos/go-iptables/iptables"
+)
+
+// defaultAdminChain is the iptables chain of the filter table where the
+// firewall plugin jumps for the rules of the administrator.
+const defaultAdminChain = "CNI-ADMIN"
+
+// firewallAdmin is the configuration of the firewall plugin of a network,
+// along with the iptables rules set by the administrator in its admin
+// chain, as iptables rule specifications without the table and chain.
+type firewallAdmin struct {
+	Backend     string   `json:"backend"`
+	AdminChain  string   `json:"iptablesAdminChainName"`
+	AdminRules  []string `json:"adminRules"`
+	AdminRules6 []string `json:"adminRules6"`
+}
+
+// ruleCommandOptions are the iptables options selecting the table, the
+// chain or the command, which are set by apptainer for the admin rules.
+var ruleCommandOptions = []string{
+	"-t", "--table",
+	"-A", "--append",
+	"-C", "--check",
+	"-D", "--delete",
+	"-I", "--insert",
+	"-R", "--replace",
+	"-L", "--list",
+	"-S", "--list-rules",
+	"-F", "--flush",
+	"-Z", "--zero",
+	"-N", "--new-chain",
+	"-X", "--delete-chain",
+	"-P", "--policy",
+	"-E", "--rename-chain",
+}
+
+// parseAdminRule returns the arguments of the iptables rule specification
+// rule, which must not select a table, a chain or a command.
+func parseAdminRule(rule string) ([]string, error) {
+	spec := strings.Fields(rule)
+	if len(spec) == 0 {
+		return nil, fmt.Errorf("empty admin rule")
+	}
+	for _, arg := range spec {
+		if slice.ContainsString(ruleCommandOptions, arg) {
+			return nil, fmt.Errorf("admin rule %q must not use %s, the rules are appended to the admin chain of the filter table", rule, arg)
+		}
+	}
+	return spec, nil
+}
+
+// firewallAdmin returns the admin rules configuration of the firewall
+// plugin of the network at index idx, or nil if it has no admin rules.
+func (m *Setup) firewallAdmin(idx int) (*firewallAdmin, error) {
+	for _, plugin := range m.networkConfList[idx].Plugins {
+		if plugin.Network.Type != "firewall" {
+			continue
+		}
+		fw := &firewallAdmin{}
+		if err := json.Unmarshal(plugin.Bytes, fw); err != nil {
+			return nil, fmt.Errorf("while reading the firewall configuration of network %s: %s", m.networks[idx], err)
+		}
+		if len(fw.AdminRules) == 0 && len(fw.AdminRules6) == 0 {
+			return nil, nil
+		}
+		if fw.Backend != "" && fw.Backend != "iptables" {
+			return nil, fmt.Errorf("admin rules of network %s require the iptables firewall backend", m.networks[idx])
+		}
+		if fw.AdminChain == "" {
+			fw.AdminChain = defaultAdminChain
+		}
+		for _, rule := range append(fw.AdminRules, fw.AdminRules6...) {
+			if _, err := parseAdminRule(rule); err != nil {
+				return nil, fmt.Errorf("network %s: %s", m.networks[idx], err)
+			}
+		}
+		return fw, nil
+	}
+	return nil, nil
+}
+
+// checkFirewallAdmin checks the admin rules of the firewall plugins of
+// the networks.
+func (m *Setup) checkFirewallAdmin() error {
+	for i := range m.networkConfList {
+		if _, err := m.firewallAdmin(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFirewallAdminRules appends the admin rules of the firewall plugins of
+// the networks to their admin chain, unless they are already there. The
+// rules are shared by the containers of the networks and are left in place
+// when a container is removed.
+func (m *Setup) setFirewallAdminRules() error {
+	for i := range m.networkConfList {
+		fw, err := m.firewallAdmin(i)
+		if err != nil {
+			return err
+		} else if fw == nil {
+			continue
+		}
+		families := []struct {
+			proto iptables.Protocol
+			rules []string
+		}{
+			{iptables.ProtocolIPv4, fw.AdminRules},
+			{iptables.ProtocolIPv6, fw.AdminRules6},
+		}
+		for _, f := range families {
+			if len(f.rules) == 0 {
+				continue
+			}
+			ipt, err := iptables.NewWithProtocol(f.proto)
+			if err != nil {
+				return fmt.Errorf("while setting the admin rules of network %s: %s", m.networks[i], err)
+			}
+			// the chain is created by the firewall plugin
+			if exists, err := ipt.ChainExists("filter", fw.AdminChain); err != nil {
+				return err
+			} else if !exists {
+				if err := ipt.NewChain("filter", fw.AdminChain); err != nil {
+					return err
+				}
+			}
+			for _, rule := range f.rules {
+				spec, _ := parseAdminRule(rule)
+				if err := ipt.AppendUnique("filter", fw.AdminChain, spec...); err != nil {
+					return fmt.Errorf("while appending admin rule %q of network %s: %s", rule, m.networks[i], err)
+				}
+				sylog.Debugf("Admin rule %q of network %s set in chain %s", rule, m.networks[i], fw.AdminChain)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func firewallConf(firewall string) string {
+	return `{
+		"cniVersion": "1.0.0",
+		"name": "guarded",
+		"plugins": [
+			{
+				"type": "bridge",
+				"ipam": {"type": "host-local", "subnet": "10.26.0.0/16"}
+			},
+			` + firewall + `
+		]
+	}`
+}
+
+func TestFirewallAdmin(t *testing.T) {
+	tests := []struct {
+		name     string
+		firewall string
+		want     *firewallAdmin
+		wantErr  string
+	}{
+		{
+			name:     "NoRules",
+			firewall: `{"type": "firewall"}`,
+		},
+		{
+			name:     "DefaultChain",
+			firewall: `{"type": "firewall", "adminRules": ["-d 169.254.169.254/32 -j DROP"]}`,
+			want: &firewallAdmin{
+				AdminChain: defaultAdminChain,
+				AdminRules: []string{"-d 169.254.169.254/32 -j DROP"},
+			},
+		},
+		{
+			name:     "CustomChain",
+			firewall: `{"type": "firewall", "backend": "iptables", "iptablesAdminChainName": "SITE-ADMIN", "adminRules6": ["-d fd00::/8 -j REJECT"]}`,
+			want: &firewallAdmin{
+				Backend:     "iptables",
+				AdminChain:  "SITE-ADMIN",
+				AdminRules6: []string{"-d fd00::/8 -j REJECT"},
+			},
+		},
+		{
+			name:     "FirewalldBackend",
+			firewall: `{"type": "firewall", "backend": "firewalld", "adminRules": ["-j DROP"]}`,
+			wantErr:  "require the iptables firewall backend",
+		},
+		{
+			name:     "ChainSelected",
+			firewall: `{"type": "firewall", "adminRules": ["-A FORWARD -j ACCEPT"]}`,
+			wantErr:  "must not use -A",
+		},
+		{
+			name:     "TableSelected",
+			firewall: `{"type": "firewall", "adminRules": ["-t nat -j MASQUERADE"]}`,
+			wantErr:  "must not use -t",
+		},
+		{
+			name:     "EmptyRule",
+			firewall: `{"type": "firewall", "adminRules": [" "]}`,
+			wantErr:  "empty admin rule",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup := newTestSetup(t, firewallConf(tt.firewall))
+			fw, err := setup.firewallAdmin(0)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if err := setup.checkFirewallAdmin(); err == nil {
+					t.Errorf("unexpected success of the admin rules check")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(fw, tt.want) {
+				t.Errorf("got %+v, want %+v", fw, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
+)
+
+// ipv6DefaultRoute and ipv4DefaultRoute are the destinations of the
+// default routes in the host-local IPAM configuration.
+const (
+	ipv4DefaultRoute = "0.0.0.0/0"
+	ipv6DefaultRoute = "::/0"
+)
+
+// ipv6Paths are the files checked to know if IPv6 is enabled on the host.
+var ipv6Paths = struct {
+	ifInet6    string
+	disableAll string
+}{
+	ifInet6:    "/proc/net/if_inet6",
+	disableAll: "/proc/sys/net/ipv6/conf/all/disable_ipv6",
+}
+
+// IPv6Enabled returns whether IPv6 is enabled on the host, it's not when
+// the kernel is booted with ipv6.disable=1 or IPv6 is disabled on all the
+// interfaces.
+func IPv6Enabled() bool {
+	if _, err := os.Stat(ipv6Paths.ifInet6); err != nil {
+		return false
+	}
+	b, err := os.ReadFile(ipv6Paths.disableAll)
+	return err != nil || strings.TrimSpace(string(b)) != "1"
+}
+
+// isIPv6CIDR returns whether the value v is an IPv6 CIDR.
+func isIPv6CIDR(v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	ip, _, err := net.ParseCIDR(s)
+	return err == nil && ip.To4() == nil
+}
+
+// isIPv6RangeSet returns whether the host-local range set v is an IPv6
+// one, all the ranges of a set belong to the same address family.
+func isIPv6RangeSet(v interface{}) bool {
+	set, ok := v.([]interface{})
+	if !ok || len(set) == 0 {
+		return false
+	}
+	r, ok := set[0].(map[string]interface{})
+	return ok && isIPv6CIDR(r["subnet"])
+}
+
+// hostLocalRanges returns the range sets of the host-local IPAM
+// configuration ipam, converting a single subnet configuration to a range
+// set.
+func hostLocalRanges(ipam map[string]interface{}) []interface{} {
+	if ranges, ok := ipam["ranges"].([]interface{}); ok {
+		return ranges
+	}
+	subnet, ok := ipam["subnet"]
+	if !ok {
+		return nil
+	}
+	r := map[string]interface{}{"subnet": subnet}
+	for _, k := range []string{"rangeStart", "rangeEnd", "gateway"} {
+		if v, ok := ipam[k]; ok {
+			r[k] = v
+			delete(ipam, k)
+		}
+	}
+	delete(ipam, "subnet")
+	return []interface{}{[]interface{}{r}}
+}
+
+// removeIPv6 removes the IPv6 range sets and routes of the host-local IPAM
+// configuration ipam, it returns whether the configuration changed.
+func removeIPv6(ipam map[string]interface{}) bool {
+	changed := false
+
+	ranges := hostLocalRanges(ipam)
+	v4 := make([]interface{}, 0, len(ranges))
+	for _, set := range ranges {
+		if !isIPv6RangeSet(set) {
+			v4 = append(v4, set)
+		}
+	}
+	// an IPv6 only configuration is left as is
+	if len(v4) != len(ranges) && len(v4) > 0 {
+		changed = true
+		ranges = v4
+	}
+	if ranges != nil {
+		ipam["ranges"] = ranges
+	}
+
+	if routes, ok := ipam["routes"].([]interface{}); ok && len(v4) > 0 {
+		v4Routes := make([]interface{}, 0, len(routes))
+		for _, r := range routes {
+			if route, ok := r.(map[string]interface{}); ok && isIPv6CIDR(route["dst"]) {
+				changed = true
+				continue
+			}
+			v4Routes = append(v4Routes, r)
+		}
+		ipam["routes"] = v4Routes
+	}
+
+	return changed
+}
+
+// setIPv6Subnet sets the IPv6 subnet of the host-local IPAM configuration
+// ipam, replacing the IPv6 range set if any, or adding one along with an
+// IPv6 default route if there's an IPv4 one.
+func setIPv6Subnet(ipam map[string]interface{}, subnet string) {
+	ranges := hostLocalRanges(ipam)
+	set := []interface{}{map[string]interface{}{"subnet": subnet}}
+
+	replaced := false
+	for i := range ranges {
+		if isIPv6RangeSet(ranges[i]) {
+			ranges[i] = set
+			replaced = true
+			break
+		}
+	}
+	ipam["ranges"] = ranges
+	if replaced {
+		return
+	}
+	ipam["ranges"] = append(ranges, set)
+
+	routes, _ := ipam["routes"].([]interface{})
+	hasDefault := false
+	for _, r := range routes {
+		if route, ok := r.(map[string]interface{}); ok && route["dst"] == ipv4DefaultRoute {
+			hasDefault = true
+		}
+		if route, ok := r.(map[string]interface{}); ok && route["dst"] == ipv6DefaultRoute {
+			return
+		}
+	}
+	if hasDefault {
+		ipam["routes"] = append(routes, map[string]interface{}{"dst": ipv6DefaultRoute})
+	}
+}
+
+// editHostLocalIPAM calls fn with the host-local IPAM configurations of the
+// plugins of the network at index idx, then rebuilds the network
+// configuration list if fn changed one of them. It returns whether the
+// network uses the host-local IPAM plugin.
+func (m *Setup) editHostLocalIPAM(idx int, fn func(ipam map[string]interface{}) bool) (bool, error) {
+	list := m.networkConfList[idx]
+
+	raw := make(map[string]interface{})
+	if err := json.Unmarshal(list.Bytes, &raw); err != nil {
+		return false, fmt.Errorf("while decoding network %s configuration: %s", list.Name, err)
+	}
+	plugins, _ := raw["plugins"].([]interface{})
+
+	found, changed := false, false
+	for _, p := range plugins {
+		plugin, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		ipam, ok := plugin["ipam"].(map[string]interface{})
+		if !ok || ipam["type"] != "host-local" {
+			continue
+		}
+		found = true
+		if fn(ipam) {
+			changed = true
+		}
+	}
+	if !changed {
+		return found, nil
+	}
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return found, err
+	}
+	newList, err := libcni.ConfListFromBytes(b)
+	if err != nil {
+		return found, fmt.Errorf("while updating network %s configuration: %s", list.Name, err)
+	}
+	m.networkConfList[idx] = newList
+	return found, nil
+}
+
+// SetIPv6Subnet sets the IPv6 subnet of the addresses allocated by the
+// host-local IPAM plugin of network, replacing the configured one or adding
+// it to an IPv4 only network. With the subnet "none", IPv6 is disabled on
+// the network instead.
+func (m *Setup) SetIPv6Subnet(network, subnet string) error {
+	if subnet != "none" && !isIPv6CIDR(subnet) {
+		return fmt.Errorf("%s is not an IPv6 subnet", subnet)
+	}
+
+	for i, name := range m.networks {
+		if name != network {
+			continue
+		}
+		found, err := m.editHostLocalIPAM(i, func(ipam map[string]interface{}) bool {
+			if subnet == "none" {
+				return removeIPv6(ipam)
+			}
+			setIPv6Subnet(ipam, subnet)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("network %s doesn't use the host-local IPAM plugin", network)
+		}
+		return nil
+	}
+	return fmt.Errorf("network %s wasn't specified in --network option", network)
+}
+
+// DisableIPv6 removes the IPv6 address ranges and routes from the
+// host-local IPAM configuration of the networks, along with the IPv6
+// ranges set with the ipRange network argument, so that the containers
+// only get IPv4 addresses. IPv6 only networks are left unchanged. It
+// returns the names of the networks changed.
+func (m *Setup) DisableIPv6() ([]string, error) {
+	changed := make([]string, 0)
+
+	for i, name := range m.networks {
+		networkChanged := false
+		_, err := m.editHostLocalIPAM(i, func(ipam map[string]interface{}) bool {
+			networkChanged = removeIPv6(ipam) || networkChanged
+			return networkChanged
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if sets, ok := m.runtimeConf[i].CapabilityArgs["ipRanges"].([]allocator.RangeSet); ok {
+			v4 := make([]allocator.RangeSet, 0, len(sets))
+			for _, set := range sets {
+				if len(set) > 0 && set[0].Subnet.IP.To4() == nil {
+					continue
+				}
+				v4 = append(v4, set)
+			}
+			if len(v4) > 0 && len(v4) != len(sets) {
+				m.runtimeConf[i].CapabilityArgs["ipRanges"] = v4
+				networkChanged = true
+			}
+		}
+
+		if networkChanged {
+			changed = append(changed, name)
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,341 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types"
+	cnitypes "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
+)
+
+const (
+	dualStackConf = `{
+		"cniVersion": "1.0.0",
+		"name": "dual",
+		"plugins": [
+			{
+				"type": "bridge",
+				"capabilities": {"ipRanges": true},
+				"ipam": {
+					"type": "host-local",
+					"ranges": [
+						[{"subnet": "10.22.0.0/16"}],
+						[{"subnet": "fd00:10:22::/64"}]
+					],
+					"routes": [{"dst": "0.0.0.0/0"}, {"dst": "::/0"}]
+				}
+			},
+			{
+				"type": "bandwidth",
+				"capabilities": {"bandwidth": true}
+			}
+		]
+	}`
+	ipv4Conf = `{
+		"cniVersion": "1.0.0",
+		"name": "ipv4",
+		"plugins": [
+			{
+				"type": "bridge",
+				"ipam": {
+					"type": "host-local",
+					"subnet": "10.23.0.0/16",
+					"rangeStart": "10.23.0.10",
+					"routes": [{"dst": "0.0.0.0/0"}]
+				}
+			}
+		]
+	}`
+	ipv6Conf = `{
+		"cniVersion": "1.0.0",
+		"name": "ipv6",
+		"plugins": [
+			{
+				"type": "bridge",
+				"ipam": {
+					"type": "host-local",
+					"subnet": "fd00:10:24::/64",
+					"routes": [{"dst": "::/0"}]
+				}
+			}
+		]
+	}`
+)
+
+// newTestSetup returns a setup for the network configuration lists confs.
+func newTestSetup(t *testing.T, confs ...string) *Setup {
+	lists := make([]*libcni.NetworkConfigList, len(confs))
+	for i, c := range confs {
+		var err error
+		if lists[i], err = libcni.ConfListFromBytes([]byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setup, err := NewSetupFromConfig(lists, "test", "/proc/self/ns/net", &CNIPath{Conf: "/conf", Plugin: "/plugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return setup
+}
+
+// testIPAM returns the IPAM configuration of the first plugin of the
+// network at index idx of the setup.
+func testIPAM(t *testing.T, setup *Setup, idx int) map[string]interface{} {
+	var conf struct {
+		Plugins []struct {
+			IPAM map[string]interface{} `json:"ipam"`
+		} `json:"plugins"`
+	}
+	if err := json.Unmarshal(setup.networkConfList[idx].Bytes, &conf); err != nil {
+		t.Fatal(err)
+	}
+	// the plugin configurations must be updated along with the list
+	var ipam map[string]interface{}
+	if err := json.Unmarshal(setup.networkConfList[idx].Plugins[0].Bytes, &struct {
+		IPAM *map[string]interface{} `json:"ipam"`
+	}{&ipam}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ipam, conf.Plugins[0].IPAM) {
+		t.Fatalf("plugin configuration %v doesn't match the list one %v", ipam, conf.Plugins[0].IPAM)
+	}
+	return ipam
+}
+
+func TestIPv6Enabled(t *testing.T) {
+	orig := ipv6Paths
+	t.Cleanup(func() { ipv6Paths = orig })
+
+	dir := t.TempDir()
+	ipv6Paths.ifInet6 = filepath.Join(dir, "if_inet6")
+	ipv6Paths.disableAll = filepath.Join(dir, "disable_ipv6")
+
+	if IPv6Enabled() {
+		t.Errorf("IPv6 enabled without if_inet6")
+	}
+	if err := os.WriteFile(ipv6Paths.ifInet6, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !IPv6Enabled() {
+		t.Errorf("IPv6 disabled with if_inet6")
+	}
+	if err := os.WriteFile(ipv6Paths.disableAll, []byte("1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if IPv6Enabled() {
+		t.Errorf("IPv6 enabled with disable_ipv6 set")
+	}
+}
+
+func TestSetIPv6Subnet(t *testing.T) {
+	setup := newTestSetup(t, dualStackConf, ipv4Conf, ipv6Conf)
+
+	// the IPv6 range of a dual-stack network is replaced
+	if err := setup.SetIPv6Subnet("dual", "fd00:99::/64"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ipam := testIPAM(t, setup, 0)
+	want := []interface{}{
+		[]interface{}{map[string]interface{}{"subnet": "10.22.0.0/16"}},
+		[]interface{}{map[string]interface{}{"subnet": "fd00:99::/64"}},
+	}
+	if !reflect.DeepEqual(ipam["ranges"], want) {
+		t.Errorf("got ranges %v, want %v", ipam["ranges"], want)
+	}
+
+	// an IPv6 range is added to an IPv4 only network, along with the
+	// default route
+	if err := setup.SetIPv6Subnet("ipv4", "fd00:99::/64"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ipam = testIPAM(t, setup, 1)
+	want = []interface{}{
+		[]interface{}{map[string]interface{}{"subnet": "10.23.0.0/16", "rangeStart": "10.23.0.10"}},
+		[]interface{}{map[string]interface{}{"subnet": "fd00:99::/64"}},
+	}
+	if !reflect.DeepEqual(ipam["ranges"], want) {
+		t.Errorf("got ranges %v, want %v", ipam["ranges"], want)
+	}
+	wantRoutes := []interface{}{
+		map[string]interface{}{"dst": "0.0.0.0/0"},
+		map[string]interface{}{"dst": "::/0"},
+	}
+	if !reflect.DeepEqual(ipam["routes"], wantRoutes) {
+		t.Errorf("got routes %v, want %v", ipam["routes"], wantRoutes)
+	}
+
+	// none removes the IPv6 range
+	if err := setup.SetIPv6Subnet("dual", "none"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ipam = testIPAM(t, setup, 0)
+	if ranges := ipam["ranges"].([]interface{}); len(ranges) != 1 {
+		t.Errorf("IPv6 range not removed: %v", ranges)
+	}
+
+	if err := setup.SetIPv6Subnet("dual", "10.99.0.0/16"); err == nil {
+		t.Errorf("unexpected success with an IPv4 subnet")
+	}
+	if err := setup.SetIPv6Subnet("unknown", "fd00:99::/64"); err == nil {
+		t.Errorf("unexpected success with an unknown network")
+	}
+}
+
+func TestDisableIPv6(t *testing.T) {
+	setup := newTestSetup(t, dualStackConf, ipv4Conf, ipv6Conf)
+	if err := setup.SetArgs([]string{"dual:ipRange=10.22.1.0/24;ipRange=fd00:10:22:1::/64"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	changed, err := setup.DisableIPv6()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(changed, []string{"dual"}) {
+		t.Errorf("got changed networks %v, want [dual]", changed)
+	}
+
+	ipam := testIPAM(t, setup, 0)
+	wantRanges := []interface{}{
+		[]interface{}{map[string]interface{}{"subnet": "10.22.0.0/16"}},
+	}
+	if !reflect.DeepEqual(ipam["ranges"], wantRanges) {
+		t.Errorf("got ranges %v, want %v", ipam["ranges"], wantRanges)
+	}
+	wantRoutes := []interface{}{map[string]interface{}{"dst": "0.0.0.0/0"}}
+	if !reflect.DeepEqual(ipam["routes"], wantRoutes) {
+		t.Errorf("got routes %v, want %v", ipam["routes"], wantRoutes)
+	}
+	sets := setup.runtimeConf[0].CapabilityArgs["ipRanges"].([]allocator.RangeSet)
+	if len(sets) != 1 || sets[0][0].Subnet.IP.To4() == nil {
+		t.Errorf("IPv6 ipRange not removed: %v", sets)
+	}
+
+	// the IPv6 only network is left as is
+	ipam = testIPAM(t, setup, 2)
+	if ipam["subnet"] != "fd00:10:24::/64" {
+		t.Errorf("IPv6 only network changed: %v", ipam)
+	}
+}
+
+func TestSetArgsDualStack(t *testing.T) {
+	setup := newTestSetup(t, dualStackConf)
+
+	args := []string{
+		"ipRange=10.22.1.0/24;ipRange=fd00:10:22:1::/64",
+		"portmap=[::1]:8080:80/tcp;portmap=127.0.0.1:8081:81/udp",
+		"ingressRate=1000000;ingressBurst=100000;egressRate=2000000;egressBurst=200000",
+		"IP=10.22.1.5,fd00:10:22:1::5",
+	}
+	// portmap isn't a capability of the network
+	if err := setup.SetArgs(args); err == nil {
+		t.Errorf("unexpected success without the portMappings capability")
+	}
+
+	setup = newTestSetup(t, dualStackConf)
+	if err := setup.SetArgs(append(args[:1:1], args[2:]...)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	capArgs := setup.runtimeConf[0].CapabilityArgs
+	if sets := capArgs["ipRanges"].([]allocator.RangeSet); len(sets) != 2 {
+		t.Errorf("got %d range sets, want 2", len(sets))
+	}
+	wantBandwidth := BandwidthEntry{IngressRate: 1000000, IngressBurst: 100000, EgressRate: 2000000, EgressBurst: 200000}
+	if bw := capArgs["bandwidth"]; !reflect.DeepEqual(bw, wantBandwidth) {
+		t.Errorf("got bandwidth %v, want %v", bw, wantBandwidth)
+	}
+	cniArgs := setup.runtimeConf[0].Args
+	if cniArgs[len(cniArgs)-1] != [2]string{"IP", "10.22.1.5,fd00:10:22:1::5"} {
+		t.Errorf("unexpected CNI arguments %v", cniArgs)
+	}
+
+	if err := setup.SetArgs([]string{"ingressRate=fast"}); err == nil {
+		t.Errorf("unexpected success with an invalid rate")
+	}
+}
+
+func TestParsePortMapHostIP(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    PortMapEntry
+		wantErr bool
+	}{
+		{value: "8080/tcp", want: PortMapEntry{HostPort: 8080, ContainerPort: 8080, Protocol: "tcp"}},
+		{value: "127.0.0.1:8080:80/tcp", want: PortMapEntry{HostPort: 8080, ContainerPort: 80, Protocol: "tcp", HostIP: "127.0.0.1"}},
+		{value: "[::1]:8080:80/udp", want: PortMapEntry{HostPort: 8080, ContainerPort: 80, Protocol: "udp", HostIP: "::1"}},
+		{value: "[fd00::1]:8080/tcp", want: PortMapEntry{HostPort: 8080, ContainerPort: 8080, Protocol: "tcp", HostIP: "fd00::1"}},
+		{value: "::1:8080:80/tcp", wantErr: true},
+		{value: "[127.0.0.1]:8080:80/tcp", wantErr: true},
+		{value: "[::1:8080:80/tcp", wantErr: true},
+		{value: "localhost:8080:80/tcp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		pm, err := ParsePortMap(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unexpected error for %s: %v", tt.value, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if pm != tt.want {
+			t.Errorf("got %+v for %s, want %+v", pm, tt.value, tt.want)
+		}
+		// the string form parses back to the same port mapping
+		if back, err := ParsePortMap(pm.String()); err != nil || back != pm {
+			t.Errorf("%s doesn't parse back to %+v: %+v %v", pm, tt.want, back, err)
+		}
+	}
+}
+
+func TestGetDNS(t *testing.T) {
+	setup := newTestSetup(t, dualStackConf, ipv4Conf, ipv6Conf)
+	setup.result = []types.Result{
+		&cnitypes.Result{
+			CNIVersion: "1.0.0",
+			DNS: types.DNS{
+				Nameservers: []string{"10.22.0.1"},
+				Domain:      "dual.local",
+				Search:      []string{"dual.local"},
+			},
+		},
+		nil,
+		&cnitypes.Result{
+			CNIVersion: "1.0.0",
+			DNS: types.DNS{
+				Nameservers: []string{"fd00:10:24::1", "10.22.0.1"},
+				Domain:      "ipv6.local",
+				Search:      []string{"ipv6.local"},
+				Options:     []string{"ndots:1"},
+			},
+		},
+	}
+
+	dns, err := setup.GetDNS()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := types.DNS{
+		Nameservers: []string{"10.22.0.1", "fd00:10:24::1"},
+		Domain:      "dual.local",
+		Search:      []string{"dual.local", "ipv6.local"},
+		Options:     []string{"ndots:1"},
+	}
+	if !reflect.DeepEqual(dns, want) {
+		t.Errorf("got DNS %+v, want %+v", dns, want)
+	}
+}
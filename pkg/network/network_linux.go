@@ -11,9 +11,12 @@ package network
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -22,6 +25,8 @@ import (
 	"golang.org/x/sys/unix"
 
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/slice"
 	"github.com/containernetworking/cni/libcni"
 	"github.com/containernetworking/cni/pkg/types"
 	cnitypes "github.com/containernetworking/cni/pkg/types/100"
@@ -44,6 +49,11 @@ const (
 type CNIPath struct {
 	Conf   string
 	Plugin string
+	// UserConf is the directory of the networks created by the user,
+	// consulted for the networks not found in Conf
+	UserConf string
+	// UserID is the user owning the networks of UserConf
+	UserID int
 }
 
 // Setup contains network installation setup
@@ -58,6 +68,14 @@ type Setup struct {
 	envPath         string
 }
 
+// Network holds a CNI network configuration list of a setup along with
+// the runtime configuration passed to its plugins, holding the CNI_ARGS
+// and capability arguments (IP, MAC, port mappings...).
+type Network struct {
+	Config  *libcni.NetworkConfigList
+	Runtime *libcni.RuntimeConf
+}
+
 // PortMapEntry describes a port mapping between host and container
 type PortMapEntry struct {
 	HostPort      int    `json:"hostPort"`
@@ -66,6 +84,138 @@ type PortMapEntry struct {
 	HostIP        string `json:"hostIP,omitempty"`
 }
 
+// BandwidthEntry describes the bandwidth limits of a container, rates
+// are in bits per second and bursts in bits
+type BandwidthEntry struct {
+	IngressRate  uint64 `json:"ingressRate,omitempty"`
+	IngressBurst uint64 `json:"ingressBurst,omitempty"`
+	EgressRate   uint64 `json:"egressRate,omitempty"`
+	EgressBurst  uint64 `json:"egressBurst,omitempty"`
+}
+
+// String returns the port mapping in the [hostIP:]hostPort:containerPort/protocol
+// form of the portmap network argument, an IPv6 host IP is enclosed in
+// brackets.
+func (e PortMapEntry) String() string {
+	ports := fmt.Sprintf("%d:%d/%s", e.HostPort, e.ContainerPort, e.Protocol)
+	if e.HostIP == "" {
+		return ports
+	}
+	if strings.Contains(e.HostIP, ":") {
+		return "[" + e.HostIP + "]:" + ports
+	}
+	return e.HostIP + ":" + ports
+}
+
+// parsePort parses the port p, named "name" in errors.
+func parsePort(p, name string) (int, error) {
+	n, err := strconv.ParseUint(p, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("can't convert %s port '%s': %s", name, p, err)
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("%s port must be greater than 0 and less than 65535", name)
+	}
+	return int(n), nil
+}
+
+// parsePortMap parses a port mapping of the form
+// [hostIP:]hostPort[:containerPort]/protocol, an IPv6 host IP is
+// enclosed in brackets. It also returns whether the container port was
+// set.
+func parsePortMap(value string) (PortMapEntry, bool, error) {
+	pm := PortMapEntry{}
+
+	splittedPort := strings.SplitN(value, "/", 2)
+	if len(splittedPort) != 2 {
+		return pm, false, fmt.Errorf("badly formatted portmap argument '%s', must be of form portmap=[hostIP:]hostPort:containerPort/protocol", value)
+	}
+	pm.Protocol = splittedPort[1]
+	if pm.Protocol != "tcp" && pm.Protocol != "udp" {
+		return pm, false, fmt.Errorf("only tcp and udp protocol can be specified")
+	}
+
+	spec := splittedPort[0]
+	if strings.HasPrefix(spec, "[") {
+		end := strings.Index(spec, "]:")
+		if end < 0 {
+			return pm, false, fmt.Errorf("portmap IPv6 host IP is badly formatted, must be enclosed in brackets")
+		}
+		pm.HostIP, spec = spec[1:end], spec[end+2:]
+		if ip := net.ParseIP(pm.HostIP); ip == nil || ip.To4() != nil {
+			return pm, false, fmt.Errorf("invalid portmap IPv6 host IP '%s'", pm.HostIP)
+		}
+	}
+	ports := strings.Split(spec, ":")
+	if len(ports) == 3 && pm.HostIP == "" {
+		pm.HostIP, ports = ports[0], ports[1:]
+		if ip := net.ParseIP(pm.HostIP); ip == nil || ip.To4() == nil {
+			return pm, false, fmt.Errorf("invalid portmap IPv4 host IP '%s', an IPv6 one must be enclosed in brackets", pm.HostIP)
+		}
+	}
+	if len(ports) != 1 && len(ports) != 2 {
+		return pm, false, fmt.Errorf("portmap port argument is badly formatted")
+	}
+
+	var err error
+	if pm.HostPort, err = parsePort(ports[0], "host"); err != nil {
+		return pm, false, err
+	}
+	if len(ports) == 1 {
+		pm.ContainerPort = pm.HostPort
+		return pm, false, nil
+	}
+	if pm.ContainerPort, err = parsePort(ports[1], "container"); err != nil {
+		return pm, false, err
+	}
+	return pm, true, nil
+}
+
+// ParsePortMap parses a port mapping of the form
+// [hostIP:]hostPort[:containerPort]/protocol, the container port defaults
+// to the host port. An IPv6 host IP is enclosed in brackets.
+func ParsePortMap(value string) (PortMapEntry, error) {
+	pm, _, err := parsePortMap(value)
+	return pm, err
+}
+
+// ParsePublish parses a port published with --publish, of the form
+// [hostIP:]hostPort:containerPort[/protocol], the protocol defaults to tcp.
+func ParsePublish(value string) (PortMapEntry, error) {
+	if !strings.Contains(value, "/") {
+		value += "/tcp"
+	}
+	pm, hasContainerPort, err := parsePortMap(value)
+	if err == nil && !hasContainerPort {
+		err = fmt.Errorf("badly formatted published port '%s', must be of form [hostIP:]hostPort:containerPort[/protocol]", value)
+	}
+	return pm, err
+}
+
+// CheckHostPort checks that the host port of the port mapping e is
+// not already in use.
+func CheckHostPort(e PortMapEntry) error {
+	var err error
+	addr := net.JoinHostPort(e.HostIP, strconv.Itoa(e.HostPort))
+	if e.Protocol == "udp" {
+		var c net.PacketConn
+		if c, err = net.ListenPacket("udp", addr); err == nil {
+			return c.Close()
+		}
+	} else {
+		var l net.Listener
+		if l, err = net.Listen("tcp", addr); err == nil {
+			return l.Close()
+		}
+	}
+	// privileged ports can't be checked by users, but may still be
+	// published by the portmap plugin
+	if errors.Is(err, unix.EACCES) {
+		return nil
+	}
+	return fmt.Errorf("host port %d/%s is not available: %s", e.HostPort, e.Protocol, err)
+}
+
 // GetAllNetworkConfigList lists configured networks in configuration path directory
 // provided by cniPath
 func GetAllNetworkConfigList(cniPath *CNIPath) ([]*libcni.NetworkConfigList, error) {
@@ -124,7 +274,7 @@ func NewSetup(networks []string, containerID string, netNS string, cniPath *CNIP
 	for i, network := range networks {
 		var err error
 
-		networkConfList[i], err = libcni.LoadConfList(cniPath.Conf, network)
+		networkConfList[i], _, err = cniPath.LoadNetwork(network)
 		if err != nil {
 			return nil, err
 		}
@@ -187,8 +337,8 @@ func parseArg(arg string) ([][2]string, error) {
 	pairs := strings.Split(arg, ";")
 	for _, pair := range pairs {
 		keyVal := strings.Split(pair, "=")
-		if len(keyVal) != 2 {
-			return nil, fmt.Errorf("invalid argument: %s", pair)
+		if len(keyVal) != 2 || keyVal[0] == "" {
+			return nil, fmt.Errorf("invalid network argument '%s', must be of form KEY=value", pair)
 		}
 		argList = append(argList, [2]string{keyVal[0], keyVal[1]})
 	}
@@ -200,15 +350,7 @@ func parseArg(arg string) ([][2]string, error) {
 func (m *Setup) SetCapability(network string, capName string, args interface{}) error {
 	for i := range m.networks {
 		if m.networks[i] == network {
-			hasCap := false
-			for _, plugin := range m.networkConfList[i].Plugins {
-				if plugin.Network.Capabilities[capName] {
-					hasCap = true
-					break
-				}
-			}
-
-			if !hasCap {
+			if !m.hasCapability(i, capName) {
 				return fmt.Errorf("%s network doesn't have %s capability", network, capName)
 			}
 
@@ -222,9 +364,12 @@ func (m *Setup) SetCapability(network string, capName string, args interface{})
 					args,
 				)
 			case []allocator.Range:
-				if m.runtimeConf[i].CapabilityArgs[capName] == nil {
-					m.runtimeConf[i].CapabilityArgs[capName] = []allocator.RangeSet{args}
-				}
+				// each range set is a separate address family or
+				// subnet, the container gets an address from each
+				sets, _ := m.runtimeConf[i].CapabilityArgs[capName].([]allocator.RangeSet)
+				m.runtimeConf[i].CapabilityArgs[capName] = append(sets, args)
+			case BandwidthEntry:
+				m.runtimeConf[i].CapabilityArgs[capName] = args
 			}
 		}
 	}
@@ -245,6 +390,8 @@ func (m *Setup) SetArgs(args []string) error {
 		m.runtimeConf[i].Args = append(m.runtimeConf[i].Args, [2]string{"IgnoreUnknown", "1"})
 	}
 
+	bandwidth := make(map[string]*BandwidthEntry)
+
 	for _, arg := range args {
 		var splitted []string
 		networkName := ""
@@ -263,14 +410,14 @@ func (m *Setup) SetArgs(args []string) error {
 		} else {
 			networkName = splitted[0]
 		}
-		hasNetwork := false
-		for _, network := range m.networks {
+		idx := -1
+		for i, network := range m.networks {
 			if network == networkName {
-				hasNetwork = true
+				idx = i
 				break
 			}
 		}
-		if !hasNetwork {
+		if idx < 0 {
 			return fmt.Errorf("network %s wasn't specified in --network option", networkName)
 		}
 		argList, err := parseArg(splitted[n])
@@ -281,65 +428,72 @@ func (m *Setup) SetArgs(args []string) error {
 			key := kv[0]
 			value := kv[1]
 			if key == "portmap" {
-				pm := &PortMapEntry{}
-
-				splittedPort := strings.SplitN(value, "/", 2)
-				if len(splittedPort) != 2 {
-					return fmt.Errorf("badly formatted portmap argument '%s', must be of form portmap=hostPort:containerPort/protocol", value)
+				pm, err := ParsePortMap(value)
+				if err != nil {
+					return argError(key, value, err)
 				}
-				pm.Protocol = splittedPort[1]
-				if pm.Protocol != "tcp" && pm.Protocol != "udp" {
-					return fmt.Errorf("only tcp and udp protocol can be specified")
+				if err := m.SetCapability(networkName, "portMappings", pm); err != nil {
+					return err
 				}
-				ports := strings.Split(splittedPort[0], ":")
-				if len(ports) != 1 && len(ports) != 2 {
-					return fmt.Errorf("portmap port argument is badly formatted")
+			} else if bw, ok := bandwidthArgs[key]; ok {
+				if bandwidth[networkName] == nil {
+					// start from the limits of the network arguments file
+					b, _ := m.runtimeConf[idx].CapabilityArgs["bandwidth"].(BandwidthEntry)
+					bandwidth[networkName] = &b
 				}
-				if n, err := strconv.ParseUint(ports[0], 0, 16); err == nil {
-					pm.HostPort = int(n)
-					if pm.HostPort <= 0 || pm.HostPort > 65535 {
-						return fmt.Errorf("host port must be greater than 0 and less than 65535")
-					}
-				} else {
-					return fmt.Errorf("can't convert host port '%s': %s", ports[0], err)
+				n, err := strconv.ParseUint(value, 10, 64)
+				if err != nil {
+					return argError(key, value, err)
 				}
-				if len(ports) == 2 {
-					if n, err := strconv.ParseUint(ports[1], 0, 16); err == nil {
-						pm.ContainerPort = int(n)
-						if pm.ContainerPort <= 0 || pm.ContainerPort > 65535 {
-							return fmt.Errorf("container port must be greater than 0 and less than 65535")
-						}
-					} else {
-						return fmt.Errorf("can't convert container port '%s': %s", ports[1], err)
-					}
-				} else {
-					pm.ContainerPort = pm.HostPort
+				*bw(bandwidth[networkName]) = n
+			} else if key == "bandwidth" {
+				if bandwidth[networkName] == nil {
+					b, _ := m.runtimeConf[idx].CapabilityArgs["bandwidth"].(BandwidthEntry)
+					bandwidth[networkName] = &b
 				}
-				if err := m.SetCapability(networkName, "portMappings", *pm); err != nil {
-					return err
+				if err := parseBandwidth(value, bandwidth[networkName]); err != nil {
+					return argError(key, value, err)
 				}
 			} else if key == "ipRange" {
 				ipRange := make([]allocator.Range, 1)
 				_, subnet, err := net.ParseCIDR(value)
 				if err != nil {
-					return err
+					return argError(key, value, err)
 				}
 				ipRange[0].Subnet = types.IPNet(*subnet)
 				if err := m.SetCapability(networkName, "ipRanges", ipRange); err != nil {
 					return err
 				}
 			} else {
-				for i := range m.networks {
-					if m.networks[i] == networkName {
-						m.runtimeConf[i].Args = append(m.runtimeConf[i].Args, kv)
-					}
+				if err := m.checkArg(idx, key, value); err != nil {
+					return err
 				}
+				m.runtimeConf[idx].Args = append(m.runtimeConf[idx].Args, kv)
 			}
 		}
 	}
+	for networkName, bw := range bandwidth {
+		if err := m.SetCapability(networkName, "bandwidth", *bw); err != nil {
+			return err
+		}
+	}
+	for i := range m.networks {
+		if err := m.limitBandwidth(i); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// bandwidthArgs are the network arguments setting the fields of the
+// bandwidth capability.
+var bandwidthArgs = map[string]func(*BandwidthEntry) *uint64{
+	"ingressRate":  func(b *BandwidthEntry) *uint64 { return &b.IngressRate },
+	"ingressBurst": func(b *BandwidthEntry) *uint64 { return &b.IngressBurst },
+	"egressRate":   func(b *BandwidthEntry) *uint64 { return &b.EgressRate },
+	"egressBurst":  func(b *BandwidthEntry) *uint64 { return &b.EgressBurst },
+}
+
 // GetNetworkIP returns IP associated with a configured network, if network
 // is empty, the function returns IP for the first configured network
 func (m *Setup) GetNetworkIP(network string, version string) (net.IP, error) {
@@ -356,7 +510,7 @@ func (m *Setup) GetNetworkIP(network string, version string) (net.IP, error) {
 			}
 			for _, ipResult := range res.IPs {
 				is4 := ipResult.Address.IP.To4() != nil
-				if (is4 && version == "4") || version == "6" {
+				if (is4 && version == "4") || (!is4 && version == "6") {
 					return ipResult.Address.IP, nil
 				}
 			}
@@ -367,6 +521,50 @@ func (m *Setup) GetNetworkIP(network string, version string) (net.IP, error) {
 	return nil, fmt.Errorf("no IP found for network %s", network)
 }
 
+// GetDNS returns the DNS configuration returned by the plugins of the
+// networks added to the container, the entries of the networks being
+// merged in order. The domain is the first one returned.
+func (m *Setup) GetDNS() (types.DNS, error) {
+	var dns types.DNS
+	merge := func(list []string, values []string) []string {
+		for _, v := range values {
+			if !slice.ContainsString(list, v) {
+				list = append(list, v)
+			}
+		}
+		return list
+	}
+	for _, result := range m.result {
+		if result == nil {
+			continue
+		}
+		res, err := cnitypes.NewResultFromResult(result)
+		if err != nil {
+			return dns, fmt.Errorf("could not convert result: %v", err)
+		}
+		dns.Nameservers = merge(dns.Nameservers, res.DNS.Nameservers)
+		dns.Search = merge(dns.Search, res.DNS.Search)
+		dns.Options = merge(dns.Options, res.DNS.Options)
+		if dns.Domain == "" {
+			dns.Domain = res.DNS.Domain
+		}
+	}
+	return dns, nil
+}
+
+// GetNameservers returns the DNS servers returned by the plugins of the
+// networks added to the container, IPv4 and IPv6 ones alike.
+func (m *Setup) GetNameservers() ([]string, error) {
+	dns, err := m.GetDNS()
+	if err != nil {
+		return nil, err
+	}
+	if dns.Nameservers == nil {
+		return []string{}, nil
+	}
+	return dns.Nameservers, nil
+}
+
 // GetNetworkInterface returns container network interface associated
 // with a network, if network is empty, the function returns interface
 // for the first configured network
@@ -384,6 +582,67 @@ func (m *Setup) GetNetworkInterface(network string) (string, error) {
 	return "", fmt.Errorf("no interface found for network %s", network)
 }
 
+// GetNetworkMAC returns the hardware address of the container interface
+// on a configured network.
+func (m *Setup) GetNetworkMAC(network string) (string, error) {
+	for i := 0; i < len(m.networkConfList); i++ {
+		if m.networkConfList[i].Name != network || i >= len(m.result) || m.result[i] == nil {
+			continue
+		}
+		res, err := cnitypes.NewResultFromResult(m.result[i])
+		if err != nil {
+			return "", fmt.Errorf("could not convert result: %v", err)
+		}
+		for _, iface := range res.Interfaces {
+			if iface.Sandbox != "" && iface.Name == m.runtimeConf[i].IfName {
+				return iface.Mac, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no hardware address found for network %s", network)
+}
+
+// hostLocalDataDir is the default directory where the host-local IPAM
+// plugin stores the addresses allocated on each network.
+const hostLocalDataDir = "/var/lib/cni/networks"
+
+// IPAllocated returns whether the address ip is allocated to a container
+// on network by its host-local IPAM plugin. The addresses allocated by
+// other IPAM plugins are not known.
+func (m *Setup) IPAllocated(network string, ip net.IP) (bool, error) {
+	for i := 0; i < len(m.networkConfList); i++ {
+		if m.networkConfList[i].Name != network {
+			continue
+		}
+		for _, plugin := range m.networkConfList[i].Plugins {
+			var conf struct {
+				IPAM struct {
+					Type    string `json:"type"`
+					DataDir string `json:"dataDir"`
+				} `json:"ipam"`
+			}
+			if err := json.Unmarshal(plugin.Bytes, &conf); err != nil {
+				return false, fmt.Errorf("while decoding network %s configuration: %s", network, err)
+			}
+			if conf.IPAM.Type != "host-local" {
+				continue
+			}
+			dataDir := conf.IPAM.DataDir
+			if dataDir == "" {
+				dataDir = hostLocalDataDir
+			}
+			_, err := os.Stat(filepath.Join(dataDir, network, ip.String()))
+			if err == nil {
+				return true, nil
+			} else if !os.IsNotExist(err) {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("network %s wasn't specified in --network option", network)
+}
+
 // SetPortProtection provides a basic mechanism to prevent port hijacking
 func (m *Setup) SetPortProtection(network string, lowPort int) error {
 	idx := -1
@@ -402,38 +661,135 @@ func (m *Setup) SetPortProtection(network string, lowPort int) error {
 		return nil
 	}
 	for _, e := range entries {
-		sockProt := unix.IPPROTO_TCP
-		sockType := unix.SOCK_STREAM
-
 		if e.HostPort <= lowPort {
 			return fmt.Errorf("not authorized to map port under %d", lowPort)
 		}
-		if e.Protocol == "udp" {
-			sockProt = unix.IPPROTO_UDP
-			sockType = unix.SOCK_DGRAM
+		// the port is also mapped for IPv6, unless bound to an IPv4
+		// host IP
+		ip := net.ParseIP(e.HostIP)
+		if ip == nil || ip.To4() != nil {
+			if err := protectPort(e, unix.AF_INET, ip); err != nil {
+				return err
+			}
 		}
-		fd, err := unix.Socket(unix.AF_INET, sockType, sockProt)
+		if (ip == nil || ip.To4() == nil) && IPv6Enabled() {
+			if err := protectPort(e, unix.AF_INET6, ip); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// protectPort holds the host port of the port mapping e for the address
+// family, on the host IP ip if set.
+func protectPort(e PortMapEntry, family int, ip net.IP) error {
+	sockProt := unix.IPPROTO_TCP
+	sockType := unix.SOCK_STREAM
+	if e.Protocol == "udp" {
+		sockProt = unix.IPPROTO_UDP
+		sockType = unix.SOCK_DGRAM
+	}
+
+	fd, err := unix.Socket(family, sockType, sockProt)
+	if err != nil {
+		return fmt.Errorf("failed to create %s socket on port %d: %s", e.Protocol, e.HostPort, err)
+	}
+	err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	if err != nil {
+		return fmt.Errorf("failed to set reuseport for %s socket on port %d: %s", e.Protocol, e.HostPort, err)
+	}
+
+	var sockAddr unix.Sockaddr
+	if family == unix.AF_INET6 {
+		// don't overlap with the IPv4 socket
+		err = unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, 1)
 		if err != nil {
-			return fmt.Errorf("failed to create %s socket on port %d: %s", e.Protocol, e.HostPort, err)
+			return fmt.Errorf("failed to set IPv6 only for %s socket on port %d: %s", e.Protocol, e.HostPort, err)
 		}
-		err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		addr := &unix.SockaddrInet6{Port: e.HostPort}
+		copy(addr.Addr[:], ip.To16())
+		sockAddr = addr
+	} else {
+		addr := &unix.SockaddrInet4{Port: e.HostPort}
+		copy(addr.Addr[:], ip.To4())
+		sockAddr = addr
+	}
+
+	err = unix.Bind(fd, sockAddr)
+	if err != nil {
+		return fmt.Errorf("failed to bind %s socket on port %d: %s", e.Protocol, e.HostPort, err)
+	}
+	if sockType == unix.SOCK_STREAM {
+		err = unix.Listen(fd, 1)
 		if err != nil {
-			return fmt.Errorf("failed to set reuseport for %s socket on port %d: %s", e.Protocol, e.HostPort, err)
+			return fmt.Errorf("failed to listen on %s socket port %d: %s", e.Protocol, e.HostPort, err)
 		}
-		sockAddr := &unix.SockaddrInet4{
-			Port: e.HostPort,
+	}
+	return nil
+}
+
+// Networks returns the network configurations of the setup, in the order
+// they are added to the container.
+func (m *Setup) Networks() []Network {
+	networks := make([]Network, len(m.networkConfList))
+	for i := range m.networkConfList {
+		networks[i] = Network{
+			Config:  m.networkConfList[i],
+			Runtime: m.runtimeConf[i],
 		}
-		err = unix.Bind(fd, sockAddr)
-		if err != nil {
-			return fmt.Errorf("failed to bind %s socket on port %d: %s", e.Protocol, e.HostPort, err)
+	}
+	return networks
+}
+
+// SetNetworks replaces the network configurations of the setup. A network
+// without runtime configuration gets the container ID and network namespace
+// of the setup, with the next free interface name.
+func (m *Setup) SetNetworks(networks []Network) error {
+	names := make([]string, len(networks))
+	confList := make([]*libcni.NetworkConfigList, len(networks))
+	runtimeConf := make([]*libcni.RuntimeConf, len(networks))
+
+	ifNames := make(map[string]bool)
+	for i, n := range networks {
+		if n.Config == nil || n.Config.Name == "" {
+			return fmt.Errorf("network %d has no configuration or name", i)
 		}
-		if sockType == unix.SOCK_STREAM {
-			err = unix.Listen(fd, 1)
-			if err != nil {
-				return fmt.Errorf("failed to listen on %s socket port %d: %s", e.Protocol, e.HostPort, err)
+		for _, name := range names[:i] {
+			if name == n.Config.Name {
+				return fmt.Errorf("network %s is configured more than once", name)
 			}
 		}
+		names[i] = n.Config.Name
+		confList[i] = n.Config
+		runtimeConf[i] = n.Runtime
+		if n.Runtime != nil {
+			ifNames[n.Runtime.IfName] = true
+		}
+	}
+
+	ifIndex := 0
+	for i := range runtimeConf {
+		if runtimeConf[i] != nil {
+			continue
+		}
+		for ifNames[fmt.Sprintf("eth%d", ifIndex)] {
+			ifIndex++
+		}
+		ifName := fmt.Sprintf("eth%d", ifIndex)
+		ifNames[ifName] = true
+		runtimeConf[i] = &libcni.RuntimeConf{
+			ContainerID:    m.containerID,
+			NetNS:          m.netNS,
+			IfName:         ifName,
+			CapabilityArgs: make(map[string]interface{}),
+			Args:           [][2]string{{"IgnoreUnknown", "1"}},
+		}
 	}
+
+	m.networks = names
+	m.networkConfList = confList
+	m.runtimeConf = runtimeConf
 	return nil
 }
 
@@ -469,6 +825,9 @@ func (m *Setup) command(ctx context.Context, command string) error {
 	defer cancel()
 
 	if command == "ADD" {
+		if err := m.checkFirewallAdmin(); err != nil {
+			return err
+		}
 		m.result = make([]types.Result, len(m.networkConfList))
 		for i := 0; i < len(m.networkConfList); i++ {
 			var err error
@@ -481,6 +840,15 @@ func (m *Setup) command(ctx context.Context, command string) error {
 				return err
 			}
 		}
+		// the container must not be reachable without the admin rules
+		if err := m.setFirewallAdminRules(); err != nil {
+			for j := len(m.networkConfList) - 1; j >= 0; j-- {
+				if err := config.DelNetworkList(ctx, m.networkConfList[j], m.runtimeConf[j]); err != nil {
+					sylog.Warningf("While removing network %s: %s", m.networks[j], err)
+				}
+			}
+			return err
+		}
 	} else if command == "DEL" {
 		for i := 0; i < len(m.networkConfList); i++ {
 			if err := config.DelNetworkList(ctx, m.networkConfList[i], m.runtimeConf[i]); err != nil {
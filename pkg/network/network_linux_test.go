@@ -20,6 +20,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"syscall"
 	"testing"
@@ -27,6 +28,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/test"
 	"github.com/containernetworking/cni/libcni"
+	"golang.org/x/sys/unix"
 )
 
 var confFiles = []struct {
@@ -274,10 +276,20 @@ func testSetArgs(setup *Setup, t *testing.T) {
 			success: true,
 		},
 		{
-			desc:    "Any arg",
-			args:    []string{"test-bridge:any=test"},
+			desc:    "bad IP arg",
+			args:    []string{"test-bridge:IP=10.1.1"},
+			success: false,
+		},
+		{
+			desc:    "MAC arg",
+			args:    []string{"test-bridge:MAC=c2:11:22:33:44:55"},
 			success: true,
 		},
+		{
+			desc:    "unknown arg",
+			args:    []string{"test-bridge:any=test"},
+			success: false,
+		},
 	}
 	for _, a := range testArgs {
 		err := setup.SetArgs(a.args)
@@ -513,6 +525,63 @@ func testBadBridge(nsPath string, cniPath *CNIPath, stdin io.WriteCloser, stdout
 	return nil
 }
 
+func TestSetNetworks(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	cniPath := &CNIPath{
+		Conf:   defaultCNIConfPath,
+		Plugin: defaultCNIPluginPath,
+	}
+	setup, err := NewSetup([]string{"test-bridge"}, "testing", "/proc/self/net/ns", cniPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := setup.SetArgs([]string{"IP=10.111.111.10"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	appended, err := libcni.ConfListFromBytes([]byte(`{"cniVersion": "1.0.0", "name": "appended", "plugins": [{"type": "loopback"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// prepend a new network to the existing one, keeping its runtime
+	// configuration
+	networks := setup.Networks()
+	if len(networks) != 1 || networks[0].Config.Name != "test-bridge" {
+		t.Fatalf("unexpected networks %v", networks)
+	}
+	networks = append([]Network{{Config: appended}}, networks...)
+	if err := setup.SetNetworks(networks); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	networks = setup.Networks()
+	if networks[0].Config.Name != "appended" || networks[1].Config.Name != "test-bridge" {
+		t.Errorf("networks not reordered")
+	}
+	if ifName := networks[0].Runtime.IfName; ifName != "eth1" {
+		t.Errorf("got interface %s for the new network, want eth1", ifName)
+	}
+	if networks[0].Runtime.ContainerID != "testing" {
+		t.Errorf("runtime configuration of the new network not initialized")
+	}
+	if ifName, err := setup.GetNetworkInterface("test-bridge"); err != nil || ifName != "eth0" {
+		t.Errorf("got interface %s (%v) for test-bridge, want eth0", ifName, err)
+	}
+	args := networks[1].Runtime.Args
+	if args[len(args)-1] != [2]string{"IP", "10.111.111.10"} {
+		t.Errorf("runtime arguments of test-bridge not kept: %v", args)
+	}
+
+	if err := setup.SetNetworks(append(networks, Network{Config: appended})); err == nil {
+		t.Errorf("unexpected success with a duplicate network")
+	}
+	if err := setup.SetNetworks([]Network{{}}); err == nil {
+		t.Errorf("unexpected success with a network without configuration")
+	}
+}
+
 func TestAddDelNetworks(t *testing.T) {
 	test.EnsurePrivilege(t)
 
@@ -597,6 +666,117 @@ func TestAddDelNetworks(t *testing.T) {
 	}
 }
 
+func TestAuditNamespace(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	type result struct {
+		audit *Audit
+		err   error
+	}
+	ch := make(chan result, 1)
+
+	// audit a fresh network namespace from a dedicated thread, the
+	// thread is not unlocked so it will be discarded once done
+	go func() {
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			ch <- result{err: err}
+			return
+		}
+		audit, err := AuditNamespace()
+		ch <- result{audit: audit, err: err}
+	}()
+
+	r := <-ch
+	if r.err != nil {
+		t.Fatalf("unexpected error: %s", r.err)
+	}
+	if len(r.audit.Interfaces) != 1 || r.audit.Interfaces[0].Name != LoopbackInterface {
+		t.Errorf("unexpected interfaces in new network namespace: %v", r.audit.Interfaces)
+	}
+	if r.audit.Interfaces[0].Up {
+		t.Errorf("loopback interface is unexpectedly up")
+	}
+	if len(r.audit.Routes) != 0 {
+		t.Errorf("unexpected routes in new network namespace: %v", r.audit.Routes)
+	}
+	if foreign := r.audit.ForeignInterfaces(); len(foreign) != 0 {
+		t.Errorf("unexpected foreign interfaces: %v", foreign)
+	}
+}
+
+func TestParsePublish(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "8080:80", want: "8080:80/tcp"},
+		{spec: "8080:80/tcp", want: "8080:80/tcp"},
+		{spec: "5353:53/udp", want: "5353:53/udp"},
+		{spec: "8080", wantErr: true},
+		{spec: "8080/tcp", wantErr: true},
+		{spec: "8080:80/sctp", wantErr: true},
+		{spec: "0:80", wantErr: true},
+		{spec: "8080:70000", wantErr: true},
+		{spec: "http:80", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		pm, err := ParsePublish(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unexpected error for %s: %v", tt.spec, err)
+		} else if err == nil && pm.String() != tt.want {
+			t.Errorf("got %s for %s, want %s", pm, tt.spec, tt.want)
+		}
+	}
+}
+
+func TestIPAllocated(t *testing.T) {
+	dataDir := t.TempDir()
+	conf := fmt.Sprintf(`{
+		"cniVersion": "1.0.0",
+		"name": "alloc",
+		"plugins": [
+			{
+				"type": "bridge",
+				"ipam": {
+					"type": "host-local",
+					"subnet": "10.24.0.0/16",
+					"dataDir": %q
+				}
+			}
+		]
+	}`, dataDir)
+	list, err := libcni.ConfListFromBytes([]byte(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup, err := NewSetupFromConfig([]*libcni.NetworkConfigList{list}, "test", "/proc/self/ns/net", &CNIPath{Conf: "/conf", Plugin: "/plugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip := net.ParseIP("10.24.0.5")
+	if used, err := setup.IPAllocated("alloc", ip); err != nil || used {
+		t.Errorf("got %v (%v) for a free address, want false", used, err)
+	}
+	// the host-local plugin stores the container ID in a file named
+	// after the address
+	if err := os.MkdirAll(filepath.Join(dataDir, "alloc"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "alloc", ip.String()), []byte("1234"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if used, err := setup.IPAllocated("alloc", ip); err != nil || !used {
+		t.Errorf("got %v (%v) for an allocated address, want true", used, err)
+	}
+	if _, err := setup.IPAllocated("unknown", ip); err == nil {
+		t.Errorf("unexpected success with an unknown network")
+	}
+}
+
 func TestMain(m *testing.M) {
 	var err error
 
@@ -0,0 +1,413 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/apptainer/apptainer/pkg/util/slice"
+	"github.com/containernetworking/cni/libcni"
+)
+
+// BridgeDriver is the only driver of the networks created with
+// CreateNetwork, a bridge with host-local addresses.
+const BridgeDriver = "bridge"
+
+// networkNameRegexp matches the names of the networks created with
+// CreateNetwork.
+var networkNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// reservedNetworks are the values of --network which don't select a CNI
+// network.
+var reservedNetworks = []string{"none", "pasta", "slirp4netns"}
+
+// NetworkSpec describes a network created with CreateNetwork.
+type NetworkSpec struct {
+	Name    string `json:"name"`
+	Driver  string `json:"driver"`
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway,omitempty"`
+	// Internal networks have no default route nor masquerading, the
+	// containers only reach each other
+	Internal    bool   `json:"internal"`
+	IPv6Subnet  string `json:"ipv6Subnet,omitempty"`
+	IPv6Gateway string `json:"ipv6Gateway,omitempty"`
+}
+
+// userRange is a range of the host-local IPAM of a created network.
+type userRange struct {
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// userRoute is a route of the host-local IPAM of a created network.
+type userRoute struct {
+	Dst string `json:"dst"`
+}
+
+// userIPAM is the host-local IPAM configuration of a created network.
+type userIPAM struct {
+	Type   string        `json:"type"`
+	Ranges [][]userRange `json:"ranges"`
+	Routes []userRoute   `json:"routes,omitempty"`
+}
+
+// userPlugin holds the keys of the plugins of a created network, the
+// configuration of a network created by a user is decoded into it and
+// rejected if it holds any other key.
+type userPlugin struct {
+	Type         string          `json:"type"`
+	Bridge       string          `json:"bridge,omitempty"`
+	IsGateway    bool            `json:"isGateway,omitempty"`
+	IPMasq       bool            `json:"ipMasq,omitempty"`
+	IPAM         *userIPAM       `json:"ipam,omitempty"`
+	Capabilities map[string]bool `json:"capabilities,omitempty"`
+	SNAT         *bool           `json:"snat,omitempty"`
+}
+
+// userConfList is the configuration of a created network.
+type userConfList struct {
+	CNIVersion string       `json:"cniVersion"`
+	Name       string       `json:"name"`
+	Plugins    []userPlugin `json:"plugins"`
+}
+
+// UserBridgeName returns the name of the bridge of the network name
+// created by the user uid, unique among users and short enough for an
+// interface name.
+func UserBridgeName(name string, uid int) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%s", uid, name)
+	return fmt.Sprintf("apt%08x", h.Sum32())
+}
+
+// parseSubnet parses the subnet and the optional gateway of a network of
+// the IP family of ipv6.
+func parseSubnet(subnet, gateway string, ipv6 bool) (*net.IPNet, error) {
+	ip, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a subnet: %s", subnet, err)
+	}
+	if !ip.Equal(ipnet.IP) {
+		return nil, fmt.Errorf("%s is not a subnet, did you mean %s?", subnet, ipnet)
+	}
+	if (ip.To4() == nil) != ipv6 {
+		if ipv6 {
+			return nil, fmt.Errorf("%s is not an IPv6 subnet", subnet)
+		}
+		return nil, fmt.Errorf("%s is not an IPv4 subnet", subnet)
+	}
+	if gateway != "" {
+		gw := net.ParseIP(gateway)
+		if gw == nil {
+			return nil, fmt.Errorf("%s is not an IP address", gateway)
+		}
+		if !ipnet.Contains(gw) || gw.Equal(ipnet.IP) {
+			return nil, fmt.Errorf("gateway %s is not an address of subnet %s", gateway, subnet)
+		}
+	}
+	return ipnet, nil
+}
+
+// subnets returns the subnets of the spec, once checked.
+func (s NetworkSpec) subnets() ([]*net.IPNet, error) {
+	if !networkNameRegexp.MatchString(s.Name) {
+		return nil, fmt.Errorf("%q is not a valid network name, it must only contain letters, digits, '.', '_' and '-'", s.Name)
+	}
+	if slice.ContainsString(reservedNetworks, s.Name) {
+		return nil, fmt.Errorf("%s is a reserved network name", s.Name)
+	}
+	if s.Driver != BridgeDriver {
+		return nil, fmt.Errorf("unknown network driver %q, only %s is supported", s.Driver, BridgeDriver)
+	}
+	if s.Subnet == "" {
+		return nil, fmt.Errorf("a subnet is required")
+	}
+	ipnet, err := parseSubnet(s.Subnet, s.Gateway, false)
+	if err != nil {
+		return nil, err
+	}
+	subnets := []*net.IPNet{ipnet}
+	if s.IPv6Subnet != "" {
+		ipnet, err := parseSubnet(s.IPv6Subnet, s.IPv6Gateway, true)
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, ipnet)
+	} else if s.IPv6Gateway != "" {
+		return nil, fmt.Errorf("an IPv6 gateway requires an IPv6 subnet")
+	}
+	return subnets, nil
+}
+
+// confList returns the configuration of the network described by the spec
+// for the user uid.
+func (s NetworkSpec) confList(uid int) userConfList {
+	ipam := &userIPAM{
+		Type:   "host-local",
+		Ranges: [][]userRange{{{Subnet: s.Subnet, Gateway: s.Gateway}}},
+	}
+	if !s.Internal {
+		ipam.Routes = []userRoute{{Dst: "0.0.0.0/0"}}
+	}
+	if s.IPv6Subnet != "" {
+		ipam.Ranges = append(ipam.Ranges, []userRange{{Subnet: s.IPv6Subnet, Gateway: s.IPv6Gateway}})
+		if !s.Internal {
+			ipam.Routes = append(ipam.Routes, userRoute{Dst: "::/0"})
+		}
+	}
+	snat := true
+	return userConfList{
+		CNIVersion: "1.0.0",
+		Name:       s.Name,
+		Plugins: []userPlugin{
+			{
+				Type:      "bridge",
+				Bridge:    UserBridgeName(s.Name, uid),
+				IsGateway: !s.Internal,
+				IPMasq:    !s.Internal,
+				IPAM:      ipam,
+			},
+			{Type: "firewall"},
+			{Type: "portmap", Capabilities: map[string]bool{"portMappings": true}, SNAT: &snat},
+			{Type: "bandwidth", Capabilities: map[string]bool{"bandwidth": true}},
+		},
+	}
+}
+
+// NetworkSubnets returns the subnets of the host-local IPAM of the plugins
+// of a network.
+func NetworkSubnets(conf *libcni.NetworkConfigList) []*net.IPNet {
+	var subnets []*net.IPNet
+	for _, plugin := range conf.Plugins {
+		ipam := struct {
+			IPAM struct {
+				Subnet string        `json:"subnet"`
+				Ranges [][]userRange `json:"ranges"`
+			} `json:"ipam"`
+		}{}
+		if err := json.Unmarshal(plugin.Bytes, &ipam); err != nil {
+			continue
+		}
+		cidrs := []string{ipam.IPAM.Subnet}
+		for _, set := range ipam.IPAM.Ranges {
+			for _, r := range set {
+				cidrs = append(cidrs, r.Subnet)
+			}
+		}
+		for _, cidr := range cidrs {
+			if _, ipnet, err := net.ParseCIDR(cidr); err == nil {
+				subnets = append(subnets, ipnet)
+			}
+		}
+	}
+	return subnets
+}
+
+// overlaps returns whether the subnets a and b share addresses.
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// CreateNetwork writes the configuration of the network described by spec
+// for the user uid in the directory dir, and returns its path. The network
+// must not be one of the existing networks, nor share addresses with them.
+func CreateNetwork(dir string, spec NetworkSpec, uid int, existing []*libcni.NetworkConfigList) (string, error) {
+	subnets, err := spec.subnets()
+	if err != nil {
+		return "", err
+	}
+	for _, conf := range existing {
+		if conf.Name == spec.Name {
+			return "", fmt.Errorf("network %s already exists", spec.Name)
+		}
+		for _, other := range NetworkSubnets(conf) {
+			for _, subnet := range subnets {
+				if overlaps(subnet, other) {
+					return "", fmt.Errorf("subnet %s overlaps with subnet %s of network %s", subnet, other, conf.Name)
+				}
+			}
+		}
+	}
+
+	b, err := json.MarshalIndent(spec.confList(uid), "", "    ")
+	if err != nil {
+		return "", err
+	}
+	if _, err := libcni.ConfListFromBytes(b); err != nil {
+		return "", fmt.Errorf("while generating the configuration of network %s: %s", spec.Name, err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("while creating %s: %s", dir, err)
+	}
+	path := filepath.Join(dir, spec.Name+".conflist")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("while writing the configuration of network %s: %s", spec.Name, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return "", fmt.Errorf("while writing the configuration of network %s: %s", spec.Name, err)
+	}
+	return path, nil
+}
+
+// ReadNetworkSpec returns the spec of a network created with
+// CreateNetwork, an error is returned for any other network.
+func ReadNetworkSpec(conf *libcni.NetworkConfigList) (NetworkSpec, error) {
+	var c userConfList
+	dec := json.NewDecoder(bytes.NewReader(conf.Bytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return NetworkSpec{}, fmt.Errorf("network %s was not created with 'apptainer network create': %s", conf.Name, err)
+	}
+	for _, p := range c.Plugins {
+		if p.Type == "bridge" && p.IPAM != nil && len(p.IPAM.Ranges) > 0 && len(p.IPAM.Ranges[0]) == 1 {
+			spec := NetworkSpec{
+				Name:     c.Name,
+				Driver:   BridgeDriver,
+				Subnet:   p.IPAM.Ranges[0][0].Subnet,
+				Gateway:  p.IPAM.Ranges[0][0].Gateway,
+				Internal: !p.IPMasq,
+			}
+			if len(p.IPAM.Ranges) > 1 && len(p.IPAM.Ranges[1]) == 1 {
+				spec.IPv6Subnet = p.IPAM.Ranges[1][0].Subnet
+				spec.IPv6Gateway = p.IPAM.Ranges[1][0].Gateway
+			}
+			return spec, nil
+		}
+	}
+	return NetworkSpec{}, fmt.Errorf("network %s was not created with 'apptainer network create'", conf.Name)
+}
+
+// ValidateUserNetwork checks that the configuration of a network created
+// by the user uid is the one generated by CreateNetwork for its spec, as
+// it is used with privileges.
+func ValidateUserNetwork(conf *libcni.NetworkConfigList, uid int) error {
+	spec, err := ReadNetworkSpec(conf)
+	if err != nil {
+		return err
+	}
+	if _, err := spec.subnets(); err != nil {
+		return fmt.Errorf("network %s: %s", conf.Name, err)
+	}
+	var got, want interface{}
+	b, err := json.Marshal(spec.confList(uid))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &want); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(conf.Bytes, &got); err != nil {
+		return err
+	}
+	if !jsonEqual(got, want) {
+		return fmt.Errorf("network %s was modified since its creation with 'apptainer network create'", conf.Name)
+	}
+	return nil
+}
+
+// jsonEqual returns whether the decoded JSON values a and b are equal.
+func jsonEqual(a, b interface{}) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ja, jb)
+}
+
+// findNetworkFile returns the path of the configuration file of the
+// network name in the directory dir.
+func findNetworkFile(dir, name string) (string, error) {
+	files, err := libcni.ConfFiles(dir, []string{".conf", ".json", ".conflist"})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		var conf struct {
+			Name string `json:"name"`
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if err := json.Unmarshal(b, &conf); err == nil && conf.Name == name {
+			return file, nil
+		}
+	}
+	return "", libcni.NotFoundError{Dir: dir, Name: name}
+}
+
+// RemoveNetwork removes the configuration file of the network name from
+// the directory dir, only the networks created with CreateNetwork are
+// removed.
+func RemoveNetwork(dir, name string) error {
+	conf, err := libcni.LoadConfList(dir, name)
+	if err != nil {
+		return err
+	}
+	if _, err := ReadNetworkSpec(conf); err != nil {
+		return err
+	}
+	path, err := findNetworkFile(dir, name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// LoadNetwork loads the configuration of the network name from the
+// directory of cniPath, or else from its user directory, and returns
+// whether it was found in the user directory. A network of the user
+// directory must be the one generated by CreateNetwork.
+func (p *CNIPath) LoadNetwork(name string) (*libcni.NetworkConfigList, bool, error) {
+	conf, err := libcni.LoadConfList(p.Conf, name)
+	if err == nil || p.UserConf == "" {
+		return conf, false, err
+	}
+	var notFound libcni.NotFoundError
+	var noConfig libcni.NoConfigsFoundError
+	if !errors.As(err, &notFound) && !errors.As(err, &noConfig) {
+		return nil, false, err
+	}
+	if _, statErr := os.Stat(p.UserConf); statErr != nil {
+		return nil, false, err
+	}
+	conf, err = libcni.LoadConfList(p.UserConf, name)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := ValidateUserNetwork(conf, p.UserID); err != nil {
+		return nil, false, err
+	}
+	return conf, true, nil
+}
+
+// IsUserNetwork returns whether the network name is found in the user
+// directory of cniPath only.
+func (p *CNIPath) IsUserNetwork(name string) bool {
+	_, user, err := p.LoadNetwork(name)
+	return err == nil && user
+}
@@ -0,0 +1,188 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/cni/libcni"
+)
+
+func TestCreateNetwork(t *testing.T) {
+	existing, err := libcni.ConfListFromBytes([]byte(bridgeConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		spec    NetworkSpec
+		wantErr string
+	}{
+		{
+			name: "Good",
+			spec: NetworkSpec{Name: "mynet", Driver: BridgeDriver, Subnet: "10.88.1.0/24", Gateway: "10.88.1.254"},
+		},
+		{
+			name: "GoodIPv6Internal",
+			spec: NetworkSpec{Name: "backend", Driver: BridgeDriver, Subnet: "10.88.2.0/24", IPv6Subnet: "fd00:10:88:2::/64", Internal: true},
+		},
+		{
+			name:    "Exists",
+			spec:    NetworkSpec{Name: "bridge", Driver: BridgeDriver, Subnet: "10.88.3.0/24"},
+			wantErr: "network bridge already exists",
+		},
+		{
+			name:    "Overlap",
+			spec:    NetworkSpec{Name: "overlap", Driver: BridgeDriver, Subnet: "10.22.128.0/24"},
+			wantErr: "subnet 10.22.128.0/24 overlaps with subnet 10.22.0.0/16 of network bridge",
+		},
+		{
+			name:    "OverlapIPv6",
+			spec:    NetworkSpec{Name: "overlap", Driver: BridgeDriver, Subnet: "10.88.3.0/24", IPv6Subnet: "fd00:10:22::/48"},
+			wantErr: "overlaps with subnet fd00:10:22::/64 of network bridge",
+		},
+		{
+			name:    "BadName",
+			spec:    NetworkSpec{Name: "my/net", Driver: BridgeDriver, Subnet: "10.88.3.0/24"},
+			wantErr: "is not a valid network name",
+		},
+		{
+			name:    "ReservedName",
+			spec:    NetworkSpec{Name: "none", Driver: BridgeDriver, Subnet: "10.88.3.0/24"},
+			wantErr: "none is a reserved network name",
+		},
+		{
+			name:    "BadDriver",
+			spec:    NetworkSpec{Name: "mynet", Driver: "macvlan", Subnet: "10.88.3.0/24"},
+			wantErr: "unknown network driver",
+		},
+		{
+			name:    "NoSubnet",
+			spec:    NetworkSpec{Name: "mynet", Driver: BridgeDriver},
+			wantErr: "a subnet is required",
+		},
+		{
+			name:    "HostBits",
+			spec:    NetworkSpec{Name: "mynet", Driver: BridgeDriver, Subnet: "10.88.3.1/24"},
+			wantErr: "did you mean 10.88.3.0/24?",
+		},
+		{
+			name:    "GatewayOutside",
+			spec:    NetworkSpec{Name: "mynet", Driver: BridgeDriver, Subnet: "10.88.3.0/24", Gateway: "10.88.4.1"},
+			wantErr: "gateway 10.88.4.1 is not an address of subnet 10.88.3.0/24",
+		},
+		{
+			name:    "IPv6AsIPv4",
+			spec:    NetworkSpec{Name: "mynet", Driver: BridgeDriver, Subnet: "fd00::/64"},
+			wantErr: "is not an IPv4 subnet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "network")
+			path, err := CreateNetwork(dir, tt.spec, 1000, []*libcni.NetworkConfigList{existing})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			conf, err := libcni.ConfListFromFile(path)
+			if err != nil {
+				t.Fatalf("could not load the created network: %s", err)
+			}
+			if err := ValidateUserNetwork(conf, 1000); err != nil {
+				t.Errorf("unexpected validation error: %s", err)
+			}
+			spec, err := ReadNetworkSpec(conf)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			} else if spec != tt.spec {
+				t.Errorf("got spec %+v, want %+v", spec, tt.spec)
+			}
+			if _, err := CreateNetwork(dir, tt.spec, 1000, nil); err == nil {
+				t.Errorf("unexpected success overwriting the network")
+			}
+
+			if err := RemoveNetwork(dir, tt.spec.Name); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("network not removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadUserNetwork(t *testing.T) {
+	systemDir := t.TempDir()
+	userDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(systemDir, "00_bridge.conflist"), []byte(bridgeConf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	spec := NetworkSpec{Name: "mynet", Driver: BridgeDriver, Subnet: "10.88.1.0/24"}
+	path, err := CreateNetwork(userDir, spec, 1000, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// a network of the user doesn't shadow the network of the system
+	shadow := NetworkSpec{Name: "bridge", Driver: BridgeDriver, Subnet: "10.88.2.0/24"}
+	if _, err := CreateNetwork(userDir, shadow, 1000, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cniPath := &CNIPath{Conf: systemDir, UserConf: userDir, UserID: 1000}
+	if conf, user, err := cniPath.LoadNetwork("bridge"); err != nil || user || len(NetworkSubnets(conf)) != 2 {
+		t.Errorf("network of the system not loaded first: user=%v err=%v", user, err)
+	}
+	if !cniPath.IsUserNetwork("mynet") {
+		t.Errorf("network of the user not found")
+	}
+	if _, _, err := cniPath.LoadNetwork("unknown"); err == nil {
+		t.Errorf("unexpected success loading an unknown network")
+	}
+
+	// the networks of the user are ignored without a user directory
+	if _, _, err := (&CNIPath{Conf: systemDir}).LoadNetwork("mynet"); err == nil {
+		t.Errorf("unexpected success loading a network of the user")
+	}
+	// the bridge of the network belongs to the user who created it
+	if _, _, err := (&CNIPath{Conf: systemDir, UserConf: userDir, UserID: 1001}).LoadNetwork("mynet"); err == nil {
+		t.Errorf("unexpected success loading the network of another user")
+	}
+
+	// a modified network is refused
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := strings.Replace(string(b), UserBridgeName("mynet", 1000), "docker0", 1)
+	if err := os.WriteFile(path, []byte(modified), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cniPath.LoadNetwork("mynet"); err == nil || !strings.Contains(err.Error(), "was modified since its creation") {
+		t.Errorf("got error %v, want modified network error", err)
+	}
+	extra := strings.Replace(string(b), `"type": "host-local"`, `"type": "host-local", "dataDir": "/etc"`, 1)
+	if err := os.WriteFile(path, []byte(extra), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cniPath.LoadNetwork("mynet"); err == nil || !strings.Contains(err.Error(), "was not created with") {
+		t.Errorf("got error %v, want unknown key error", err)
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/slice"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
+)
+
+// argSchema describes a network argument consumed by the bundled CNI
+// plugins.
+type argSchema struct {
+	// plugins are the plugin types consuming the argument.
+	plugins []string
+	// syntax is the expected syntax of the argument, shown in errors.
+	syntax string
+	// check validates the value of the argument.
+	check func(value string) error
+}
+
+// ignoreUnknownArg is the CNI argument telling the plugins to ignore the
+// arguments they don't consume.
+const ignoreUnknownArg = "IgnoreUnknown"
+
+// argSchemas are the network arguments of the bundled CNI plugins, the
+// portmap, ipRange and bandwidth ones are set as capability arguments,
+// the others are passed in CNI_ARGS.
+var argSchemas = map[string]argSchema{
+	"portmap": {
+		plugins: []string{"portmap"},
+		syntax:  "portmap=[hostIP:]hostPort[:containerPort]/protocol",
+		check: func(value string) error {
+			_, err := ParsePortMap(value)
+			return err
+		},
+	},
+	"ipRange": {
+		plugins: []string{"host-local"},
+		syntax:  "ipRange=<subnet>, e.g. ipRange=10.22.1.0/24",
+		check:   checkCIDR,
+	},
+	"ingressRate": {
+		plugins: []string{"bandwidth"},
+		syntax:  "ingressRate=<bits per second>",
+		check:   checkUint,
+	},
+	"ingressBurst": {
+		plugins: []string{"bandwidth"},
+		syntax:  "ingressBurst=<bits>",
+		check:   checkUint,
+	},
+	"egressRate": {
+		plugins: []string{"bandwidth"},
+		syntax:  "egressRate=<bits per second>",
+		check:   checkUint,
+	},
+	"egressBurst": {
+		plugins: []string{"bandwidth"},
+		syntax:  "egressBurst=<bits>",
+		check:   checkUint,
+	},
+	"bandwidth": {
+		plugins: []string{"bandwidth"},
+		syntax:  "bandwidth=ingress:<rate>[/<burst>][,egress:<rate>[/<burst>]], e.g. bandwidth=ingress:10Mbit,egress:5Mbit",
+		check: func(value string) error {
+			return parseBandwidth(value, &BandwidthEntry{})
+		},
+	},
+	"IP": {
+		plugins: []string{"host-local", "static"},
+		syntax:  "IP=<address>[,<address>...], e.g. IP=10.22.0.5 or IP=192.168.1.5/24 for the static IPAM plugin",
+		check:   checkIPs,
+	},
+	"GATEWAY": {
+		plugins: []string{"static"},
+		syntax:  "GATEWAY=<address>[,<address>...]",
+		check:   checkIPs,
+	},
+	"MAC": {
+		plugins: []string{"bridge", "macvlan", "tuning"},
+		syntax:  "MAC=<hardware address>, e.g. MAC=c2:11:22:33:44:55",
+		check: func(value string) error {
+			mac, err := net.ParseMAC(value)
+			if err == nil && len(mac) != 6 {
+				return fmt.Errorf("%s is not an ethernet address", value)
+			}
+			return err
+		},
+	},
+}
+
+// bundledPlugins are the plugin types of the CNI plugins distributed along
+// with apptainer, whose arguments are validated. The arguments of networks
+// using other plugins are passed as is.
+var bundledPlugins = []string{
+	"bandwidth",
+	"bridge",
+	"dhcp",
+	"dummy",
+	"firewall",
+	"host-device",
+	"host-local",
+	"ipvlan",
+	"loopback",
+	"macvlan",
+	"portmap",
+	"ptp",
+	"sbr",
+	"static",
+	"tap",
+	"tuning",
+	"vlan",
+	"vrf",
+}
+
+// checkCIDR checks that value is an IP subnet.
+func checkCIDR(value string) error {
+	_, _, err := net.ParseCIDR(value)
+	return err
+}
+
+// checkUint checks that value is an unsigned integer.
+func checkUint(value string) error {
+	_, err := strconv.ParseUint(value, 10, 64)
+	return err
+}
+
+// checkIPs checks that value is a comma separated list of IP addresses,
+// with an optional prefix length.
+func checkIPs(value string) error {
+	for _, ip := range strings.Split(value, ",") {
+		if net.ParseIP(ip) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(ip); err != nil {
+			return fmt.Errorf("%s is not an IP address", ip)
+		}
+	}
+	return nil
+}
+
+// argError returns the error for the malformed value of the network
+// argument key, with its expected syntax.
+func argError(key, value string, err error) error {
+	return fmt.Errorf("invalid network argument %s=%s: %s, expected %s", key, value, err, argSchemas[key].syntax)
+}
+
+// pluginTypes returns the types of the plugins, and of their IPAM
+// plugins, of the network at index idx.
+func (m *Setup) pluginTypes(idx int) []string {
+	var pluginTypes []string
+	for _, p := range m.networkConfList[idx].Plugins {
+		pluginTypes = append(pluginTypes, p.Network.Type)
+		if p.Network.IPAM.Type != "" {
+			pluginTypes = append(pluginTypes, p.Network.IPAM.Type)
+		}
+	}
+	return pluginTypes
+}
+
+// supportedArgs returns the syntax of the network arguments consumed by
+// the plugins pluginTypes.
+func supportedArgs(pluginTypes []string) []string {
+	var args []string
+	for _, schema := range argSchemas {
+		for _, p := range schema.plugins {
+			if slice.ContainsString(pluginTypes, p) {
+				args = append(args, schema.syntax)
+				break
+			}
+		}
+	}
+	sort.Strings(args)
+	return args
+}
+
+// checkArg checks that the network argument key=value is consumed by one
+// of the plugins of the network at index idx, with a valid value. The
+// check is skipped for networks using plugins not bundled with
+// apptainer, which may consume any argument.
+func (m *Setup) checkArg(idx int, key, value string) error {
+	if key == ignoreUnknownArg {
+		return nil
+	}
+
+	pluginTypes := m.pluginTypes(idx)
+	for _, p := range pluginTypes {
+		if !slice.ContainsString(bundledPlugins, p) {
+			sylog.Debugf("Network %s uses the third-party plugin %s, not validating network argument %s", m.networks[idx], p, key)
+			return nil
+		}
+	}
+
+	schema, ok := argSchemas[key]
+	if !ok {
+		supported := supportedArgs(pluginTypes)
+		if len(supported) == 0 {
+			return fmt.Errorf("unknown network argument %s, the plugins of network %s don't take any argument", key, m.networks[idx])
+		}
+		return fmt.Errorf("unknown network argument %s, the plugins of network %s take: %s", key, m.networks[idx], strings.Join(supported, "; "))
+	}
+
+	consumed := false
+	for _, p := range schema.plugins {
+		if slice.ContainsString(pluginTypes, p) {
+			consumed = true
+			break
+		}
+	}
+	if !consumed {
+		return fmt.Errorf("network argument %s is not supported by network %s, it requires one of the plugins %s", key, m.networks[idx], strings.Join(schema.plugins, ", "))
+	}
+
+	if err := schema.check(value); err != nil {
+		return argError(key, value, err)
+	}
+	return nil
+}
+
+// CapabilityArgs are the capability arguments passed to the plugins of
+// networks, indexed by network name then capability name, as read from a
+// network arguments file.
+type CapabilityArgs map[string]map[string]json.RawMessage
+
+// ReadCapabilityArgs reads the capability arguments of the JSON file at
+// path, of the form:
+//
+//	{
+//	  "bridge": {
+//	    "portMappings": [{"hostPort": 8080, "containerPort": 80, "protocol": "tcp"}],
+//	    "bandwidth": {"ingressRate": 1000000, "ingressBurst": 100000}
+//	  }
+//	}
+//
+// The arguments of the capabilities known to apptainer (portMappings,
+// ipRanges, bandwidth, mac and ips) are validated.
+func ReadCapabilityArgs(path string) (CapabilityArgs, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	args := make(CapabilityArgs)
+	if err := json.Unmarshal(b, &args); err != nil {
+		return nil, fmt.Errorf("while decoding %s: %s", path, err)
+	}
+	for network, caps := range args {
+		for capName, raw := range caps {
+			if _, err := decodeCapability(capName, raw); err != nil {
+				return nil, fmt.Errorf("in %s: invalid %s capability arguments of network %s: %s", path, capName, network, err)
+			}
+		}
+	}
+	return args, nil
+}
+
+// decodeCapability decodes the arguments raw of the capability capName,
+// the arguments of unknown capabilities are returned as is.
+func decodeCapability(capName string, raw json.RawMessage) (interface{}, error) {
+	decode := func(v interface{}) error {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		return dec.Decode(v)
+	}
+
+	switch capName {
+	case "portMappings":
+		var ports []PortMapEntry
+		if err := decode(&ports); err != nil {
+			return nil, err
+		}
+		for _, p := range ports {
+			if p.Protocol != "tcp" && p.Protocol != "udp" {
+				return nil, fmt.Errorf("only tcp and udp protocol can be specified")
+			}
+			if p.HostPort <= 0 || p.HostPort > 65535 || p.ContainerPort <= 0 || p.ContainerPort > 65535 {
+				return nil, fmt.Errorf("ports must be greater than 0 and less than 65535")
+			}
+			if p.HostIP != "" && net.ParseIP(p.HostIP) == nil {
+				return nil, fmt.Errorf("%s is not an IP address", p.HostIP)
+			}
+		}
+		return ports, nil
+	case "ipRanges":
+		var sets []allocator.RangeSet
+		if err := decode(&sets); err != nil {
+			return nil, err
+		}
+		for i := range sets {
+			if err := sets[i].Canonicalize(); err != nil {
+				return nil, err
+			}
+		}
+		return sets, nil
+	case "bandwidth":
+		var bw BandwidthEntry
+		if err := decode(&bw); err != nil {
+			return nil, err
+		}
+		return bw, nil
+	case "mac":
+		var mac string
+		if err := decode(&mac); err != nil {
+			return nil, err
+		}
+		if _, err := net.ParseMAC(mac); err != nil {
+			return nil, err
+		}
+		return mac, nil
+	case "ips":
+		var ips []string
+		if err := decode(&ips); err != nil {
+			return nil, err
+		}
+		if err := checkIPs(strings.Join(ips, ",")); err != nil {
+			return nil, err
+		}
+		return ips, nil
+	}
+	sylog.Debugf("Passing the arguments of the unknown capability %s as is", capName)
+	return raw, nil
+}
+
+// hasCapability returns whether a plugin of the network at index idx
+// has the capability capName.
+func (m *Setup) hasCapability(idx int, capName string) bool {
+	for _, plugin := range m.networkConfList[idx].Plugins {
+		if plugin.Network.Capabilities[capName] {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCapabilityArgs sets the capability arguments args, read with
+// ReadCapabilityArgs, of the networks. It must be called before SetArgs,
+// which appends the port mappings and IP ranges of the network arguments
+// to the ones set here.
+func (m *Setup) SetCapabilityArgs(args CapabilityArgs) error {
+	for network, caps := range args {
+		idx := -1
+		for i := range m.networks {
+			if m.networks[i] == network {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("network %s wasn't specified in --network option", network)
+		}
+		for capName, raw := range caps {
+			if !m.hasCapability(idx, capName) {
+				return fmt.Errorf("%s network doesn't have %s capability", network, capName)
+			}
+			v, err := decodeCapability(capName, raw)
+			if err != nil {
+				return fmt.Errorf("invalid %s capability arguments of network %s: %s", capName, network, err)
+			}
+			m.runtimeConf[idx].CapabilityArgs[capName] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
+)
+
+const (
+	bridgeConf = `{
+		"cniVersion": "1.0.0",
+		"name": "bridge",
+		"plugins": [
+			{
+				"type": "bridge",
+				"capabilities": {"ipRanges": true},
+				"ipam": {
+					"type": "host-local",
+					"ranges": [[{"subnet": "10.22.0.0/16"}], [{"subnet": "fd00:10:22::/64"}]]
+				}
+			},
+			{
+				"type": "portmap",
+				"capabilities": {"portMappings": true}
+			},
+			{
+				"type": "bandwidth",
+				"capabilities": {"bandwidth": true}
+			}
+		]
+	}`
+	ipvlanConf = `{
+		"cniVersion": "1.0.0",
+		"name": "ipvlan",
+		"plugins": [
+			{
+				"type": "ipvlan",
+				"master": "eth0",
+				"ipam": {
+					"type": "static",
+					"addresses": [{"address": "192.168.1.1/24"}]
+				}
+			},
+			{
+				"type": "tuning"
+			}
+		]
+	}`
+	ptpConf = `{
+		"cniVersion": "1.0.0",
+		"name": "ptp",
+		"plugins": [
+			{
+				"type": "ptp",
+				"ipam": {
+					"type": "host-local",
+					"subnet": "10.23.0.0/16"
+				}
+			},
+			{
+				"type": "firewall"
+			}
+		]
+	}`
+	thirdPartyConf = `{
+		"cniVersion": "1.0.0",
+		"name": "custom",
+		"plugins": [
+			{
+				"type": "custom-bridge",
+				"capabilities": {"portMappings": true}
+			}
+		]
+	}`
+)
+
+func TestSetArgsValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name: "GoodArgs",
+			args: []string{
+				"bridge:IP=10.22.0.5,fd00:10:22::5;portmap=8080:80/tcp",
+				"ipvlan:IP=192.168.1.5/24;GATEWAY=192.168.1.254;MAC=c2:11:22:33:44:55",
+				"ptp:IP=10.23.0.5",
+				"IgnoreUnknown=1",
+			},
+		},
+		{
+			name:    "UnknownKey",
+			args:    []string{"bridge:portmp=8080:80/tcp"},
+			wantErr: "unknown network argument portmp, the plugins of network bridge take: ",
+		},
+		{
+			name:    "UnknownKeyNoArgs",
+			args:    []string{"ipvlan:ipRange=10.1.0.0/16;any=1"},
+			wantErr: "ipvlan network doesn't have ipRanges capability",
+		},
+		{
+			name:    "MalformedPortMap",
+			args:    []string{"bridge:portmap=8080-80/tcp"},
+			wantErr: "expected portmap=[hostIP:]hostPort[:containerPort]/protocol",
+		},
+		{
+			name:    "MalformedIPRange",
+			args:    []string{"bridge:ipRange=10.22.1.0"},
+			wantErr: "invalid network argument ipRange=10.22.1.0",
+		},
+		{
+			name:    "MalformedRate",
+			args:    []string{"bridge:egressRate=1M"},
+			wantErr: "expected egressRate=<bits per second>",
+		},
+		{
+			name:    "MalformedIP",
+			args:    []string{"ptp:IP=10.23.0"},
+			wantErr: "10.23.0 is not an IP address",
+		},
+		{
+			name:    "MalformedMAC",
+			args:    []string{"ipvlan:MAC=c2:11:22"},
+			wantErr: "expected MAC=<hardware address>",
+		},
+		{
+			name:    "UnsupportedKey",
+			args:    []string{"ptp:MAC=c2:11:22:33:44:55"},
+			wantErr: "network argument MAC is not supported by network ptp, it requires one of the plugins bridge, macvlan, tuning",
+		},
+		{
+			name:    "UnsupportedGateway",
+			args:    []string{"ptp:GATEWAY=10.23.0.1"},
+			wantErr: "it requires one of the plugins static",
+		},
+		{
+			name:    "MissingCapability",
+			args:    []string{"ptp:ingressRate=1000"},
+			wantErr: "ptp network doesn't have bandwidth capability",
+		},
+		{
+			name:    "MissingValue",
+			args:    []string{"bridge:IP=10.22.0.5;MAC"},
+			wantErr: "invalid network argument 'MAC', must be of form KEY=value",
+		},
+		{
+			name: "ThirdPartyPlugin",
+			args: []string{"custom:anything=goes;portmap=8080:80/tcp"},
+		},
+		{
+			name:    "ThirdPartyPluginPortMap",
+			args:    []string{"custom:portmap=8080/sctp"},
+			wantErr: "only tcp and udp protocol can be specified",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup := newTestSetup(t, bridgeConf, ipvlanConf, ptpConf, thirdPartyConf)
+
+			err := setup.SetArgs(tt.args)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %s", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("unexpected success, want error %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("got error %q, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCapabilityArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "Good",
+			content: `{"dual": {
+				"ipRanges": [[{"subnet": "10.22.1.0/24"}], [{"subnet": "fd00:10:22:1::/64"}]],
+				"bandwidth": {"ingressRate": 1000000, "ingressBurst": 100000}
+			}}`,
+		},
+		{
+			name:    "BadJSON",
+			content: `{"dual": [`,
+			wantErr: true,
+		},
+		{
+			name:    "UnknownField",
+			content: `{"dual": {"bandwidth": {"ingresRate": 1000000}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "BadRange",
+			content: `{"dual": {"ipRanges": [[{"subnet": "10.22.1.0/24", "rangeStart": "10.23.0.1"}]]}}`,
+			wantErr: true,
+		},
+		{
+			name:    "BadPortMapping",
+			content: `{"dual": {"portMappings": [{"hostPort": 8080, "containerPort": 0, "protocol": "tcp"}]}}`,
+			wantErr: true,
+		},
+		{
+			name:    "BadMAC",
+			content: `{"dual": {"mac": "c2:11"}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "args.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadCapabilityArgs(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "args.json")
+	content := `{"dual": {
+		"ipRanges": [[{"subnet": "10.22.1.0/24"}]],
+		"bandwidth": {"ingressRate": 1000000, "ingressBurst": 100000}
+	}}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args, err := ReadCapabilityArgs(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	setup := newTestSetup(t, dualStackConf, ptpConf)
+	if err := setup.SetCapabilityArgs(args); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// the network arguments are merged with the file ones
+	if err := setup.SetArgs([]string{"dual:ipRange=fd00:10:22:1::/64;egressRate=2000000"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	capArgs := setup.runtimeConf[0].CapabilityArgs
+	if sets := capArgs["ipRanges"]; len(sets.([]allocator.RangeSet)) != 2 {
+		t.Errorf("got range sets %v, want 2", sets)
+	}
+	wantBandwidth := BandwidthEntry{IngressRate: 1000000, IngressBurst: 100000, EgressRate: 2000000}
+	if bw := capArgs["bandwidth"]; !reflect.DeepEqual(bw, wantBandwidth) {
+		t.Errorf("got bandwidth %v, want %v", bw, wantBandwidth)
+	}
+
+	// the capabilities must be declared by the network plugins
+	if err := setup.SetCapabilityArgs(CapabilityArgs{"ptp": args["dual"]}); err == nil {
+		t.Errorf("unexpected success without the capabilities")
+	}
+	if err := setup.SetCapabilityArgs(CapabilityArgs{"unknown": args["dual"]}); err == nil {
+		t.Errorf("unexpected success with an unknown network")
+	}
+}
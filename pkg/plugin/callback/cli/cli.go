@@ -10,8 +10,12 @@
 package cli
 
 import (
+	"context"
+
 	"github.com/apptainer/apptainer/pkg/cmdline"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
 	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/spf13/cobra"
 )
 
 // Command callback allows to add/modify commands and/or flags.
@@ -26,3 +30,70 @@ type Command func(*cmdline.CommandManager)
 // allows plugins to modify/alter runtime engine configuration. This
 // is the place to inject custom binds.
 type ApptainerEngineConfig func(*config.Common)
+
+// CommandPreRun callback allows to act on the command being executed.
+// This callback is called in cmd/internal/cli/apptainer.go once the
+// command line is parsed and the command to execute is resolved, and
+// allows plugins to read or modify the flags of any command, like the
+// flags they registered with the Command callback. Returning an error
+// aborts the command.
+type CommandPreRun func(cmd *cobra.Command, args []string) error
+
+// LaunchConfig callback allows to mutate the container configuration.
+// This callback is called in internal/pkg/runtime/launch/launcher_linux.go
+// just before the configuration is passed to the starter, and allows
+// plugins to add bind mounts, environment variables and namespaces to
+// the container. Removals are only applied when allowed by the
+// 'allow plugin removals' directive of apptainer.conf. Returning an
+// error aborts the container launch.
+type LaunchConfig func(*Launch) error
+
+// Launch describes the container configuration mutable by the
+// LaunchConfig callback.
+type Launch struct {
+	// Image is the path of the container image, read-only.
+	Image string
+	// Binds are the bind mounts of the container.
+	Binds []apptainerConfig.BindPath
+	// Env are the environment variables set in the container, taking
+	// precedence over those of the image.
+	Env map[string]string
+	// Namespaces are the types of the namespaces of the container, as
+	// defined by the OCI runtime specification (network, pid, ipc,
+	// uts...). The user namespace can't be added or removed.
+	Namespaces []string
+}
+
+// ImageURIHandler callback allows to handle the image references of a
+// custom URI scheme, like mystore://project/image:tag.
+// This callback is called in cmd/internal/cli when an image reference
+// with a URI scheme not handled by apptainer is passed to the pull, push,
+// build, run, exec, shell, test and instance start commands, or used as
+// the bootstrap agent of a definition file. The URI schemes handled by
+// apptainer can't be overridden.
+type ImageURIHandler func() URIHandler
+
+// URIHandler handles the image references of a URI scheme. The errors
+// returned are reported to the user as is.
+type URIHandler interface {
+	// Scheme returns the URI scheme handled, without "://".
+	Scheme() string
+	// Resolve returns the digest of the image referenced by ref, in the
+	// algorithm:hex form. The images are cached by digest.
+	Resolve(ctx context.Context, ref string) (string, error)
+	// Fetch downloads the image referenced by ref, resolved to digest,
+	// to the local file dest, either a SIF image or an OCI archive, and
+	// reports the progress of the download with progress.
+	Fetch(ctx context.Context, ref, digest, dest string, progress Progress) error
+}
+
+// URIPusher is implemented by the URI handlers supporting push.
+type URIPusher interface {
+	// Push uploads the SIF image src to ref, and reports the progress of
+	// the upload with progress.
+	Push(ctx context.Context, src, ref string, progress Progress) error
+}
+
+// Progress reports that done bytes out of total were transferred, total
+// being negative if unknown.
+type Progress func(done, total int64)
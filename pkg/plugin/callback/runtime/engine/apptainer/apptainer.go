@@ -13,6 +13,7 @@ import (
 	"os"
 	"syscall"
 
+	"github.com/apptainer/apptainer/pkg/network"
 	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
 )
 
@@ -36,3 +37,40 @@ type PostStartProcess func(config *config.Common, pid int) error
 // This callback is called in:
 // - internal/pkg/runtime/engine/apptainer/container_linux.go
 type RegisterImageDriver func(unprivileged bool) error
+
+// NetworkContainer holds the metadata of the container passed to the
+// NetworkConfig callback.
+type NetworkContainer struct {
+	// UID and User are the ID and name of the user running the container.
+	UID  int
+	User string
+	// Image is the path of the container image.
+	Image string
+	// Instance is the name of the instance, empty when the container
+	// doesn't run as an instance.
+	Instance string
+}
+
+// NetworkSetup holds the CNI networks of a container passed to the
+// NetworkConfig callback.
+type NetworkSetup struct {
+	// Command is the CNI command about to be executed, ADD or DEL.
+	Command string
+	// Container holds the metadata of the container.
+	Container NetworkContainer
+	// Networks holds the networks requested with --network, with their
+	// runtime configuration set from --network-args, in order. They can
+	// be modified, reordered or appended.
+	Networks []network.Network
+}
+
+// NetworkConfig callback is called in the master process after the
+// parsing of the --network and --network-args options, before the CNI
+// ADD command, and again before the CNI DEL command with the networks
+// passed to ADD, so that the teardown of the networks matches their
+// setup. An error aborts the container setup for ADD, and is reported
+// for DEL. Callbacks are called in order of plugin priority.
+// This callback is called in:
+// - internal/pkg/runtime/engine/apptainer/container_linux.go
+// - internal/pkg/runtime/engine/apptainer/cleanup_linux.go
+type NetworkConfig func(setup *NetworkSetup) error
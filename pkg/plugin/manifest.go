@@ -27,4 +27,10 @@ type Manifest struct {
 	Version string `json:"version"`
 	// Description describes the plugin.
 	Description string `json:"description"`
+	// Priority orders the callbacks of the plugins registered for the
+	// same hook: callbacks of plugins with a lower priority are called
+	// first, so those of plugins with a higher priority see and can
+	// override their changes. Plugins with the same priority are called
+	// in the order they are loaded.
+	Priority int `json:"priority,omitempty"`
 }
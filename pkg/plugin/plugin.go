@@ -61,6 +61,20 @@ type Plugin struct {
 	// to store configuration files/data needed by a
 	// plugin.
 	Install func(string) error
+	// Config is an optional pointer to a structure holding
+	// the plugin configuration, initialized with its default
+	// values. The plugin configuration files are decoded into
+	// it with its yaml struct tags before any callback is
+	// called, unknown keys are rejected. If it implements
+	// ConfigValidator, the decoded configuration is validated
+	// with its Validate method.
+	Config interface{}
+}
+
+// ConfigValidator is implemented by the plugin configurations
+// requiring a validation beyond the types of their fields.
+type ConfigValidator interface {
+	Validate() error
 }
 
 // Callback defines a plugin callback. Available callbacks are
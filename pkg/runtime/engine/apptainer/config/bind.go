@@ -29,6 +29,27 @@ var bindOptions = map[string]bool{
 	"rw":        flagOption,
 	"image-src": valueOption,
 	"id":        valueOption,
+	"idmap":     flagOption,
+	"private":   flagOption,
+	"rprivate":  flagOption,
+	"shared":    flagOption,
+	"rshared":   flagOption,
+	"slave":     flagOption,
+	"rslave":    flagOption,
+}
+
+// BindPropagations lists the mount propagation options valid in bind
+// specifications.
+var BindPropagations = []string{"private", "rprivate", "shared", "rshared", "slave", "rslave"}
+
+// IsBindPropagation returns true if option is a mount propagation option.
+func IsBindPropagation(option string) bool {
+	for _, p := range BindPropagations {
+		if p == option {
+			return true
+		}
+	}
+	return false
 }
 
 // BindPath stores a parsed bind path specification. Source and Destination
@@ -66,6 +87,22 @@ func (b *BindPath) Readonly() bool {
 	return b.Options != nil && b.Options["ro"] != nil
 }
 
+// IDMap returns true if the idmap option was set for a BindPath.
+func (b *BindPath) IDMap() bool {
+	return b.Options != nil && b.Options["idmap"] != nil
+}
+
+// Propagation returns the mount propagation option set for a BindPath, or
+// an empty string if none was set.
+func (b *BindPath) Propagation() string {
+	for _, p := range BindPropagations {
+		if b.Options != nil && b.Options[p] != nil {
+			return p
+		}
+	}
+	return ""
+}
+
 // ParseBindPath parses a an array of strings each specifying one or
 // more (comma separated) bind paths in src[:dst[:options]] format, and
 // returns all encountered bind paths as a slice. Options may be simple
@@ -196,10 +233,17 @@ func ParseBindPath(paths []string) ([]BindPath, error) {
 	return binds, nil
 }
 
+// splitByColon is the splitBy regular expression for ':', compiled
+// once as it's used for every bind path.
+var splitByColon = regexp.MustCompile(`(?m)([^\\]:)`)
+
 func splitBy(str string, sep byte) []string {
 	var list []string
 
-	re := regexp.MustCompile(fmt.Sprintf(`(?m)([^\\]%c)`, sep))
+	re := splitByColon
+	if sep != ':' {
+		re = regexp.MustCompile(fmt.Sprintf(`(?m)([^\\]%c)`, sep))
+	}
 	cursor := 0
 
 	indexes := re.FindAllStringIndex(str, -1)
@@ -252,6 +296,16 @@ func newBindPath(bind string) (BindPath, error) {
 				return bp, fmt.Errorf("%s is not a valid bind option", value)
 			}
 		}
+
+		propagations := 0
+		for _, p := range BindPropagations {
+			if bp.Options[p] != nil {
+				propagations++
+			}
+		}
+		if propagations > 1 {
+			return bp, fmt.Errorf("only one mount propagation option can be set for bind path %q", bind)
+		}
 	}
 
 	return bp, nil
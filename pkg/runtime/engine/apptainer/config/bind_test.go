@@ -78,6 +78,46 @@ func TestParseBindPath(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:      "srcDstRWIDMap",
+			bindpaths: []string{"/opt:/other:rw,idmap"},
+			want: []BindPath{
+				{
+					Source:      "/opt",
+					Destination: "/other",
+					Options: map[string]*BindOption{
+						"rw":    {},
+						"idmap": {},
+					},
+				},
+			},
+		},
+		{
+			name:      "srcDstPropagation",
+			bindpaths: []string{"/cvmfs:/cvmfs:rshared,/opt:/other:ro,rslave"},
+			want: []BindPath{
+				{
+					Source:      "/cvmfs",
+					Destination: "/cvmfs",
+					Options: map[string]*BindOption{
+						"rshared": {},
+					},
+				},
+				{
+					Source:      "/opt",
+					Destination: "/other",
+					Options: map[string]*BindOption{
+						"ro":     {},
+						"rslave": {},
+					},
+				},
+			},
+		},
+		{
+			name:      "srcDstPropagationMultiple",
+			bindpaths: []string{"/cvmfs:/cvmfs:rshared,rslave"},
+			wantErr:   true,
+		},
 		{
 			name:      "srcDstROMultiple",
 			bindpaths: []string{"/opt:/other:ro,/tmp:/other2:ro"},
@@ -10,6 +10,7 @@
 package apptainer
 
 import (
+	"encoding/json"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -84,49 +85,73 @@ type JSONConfig struct {
 	ScratchDir            []string          `json:"scratchdir,omitempty"`
 	OverlayImage          []string          `json:"overlayImage,omitempty"`
 	NetworkArgs           []string          `json:"networkArgs,omitempty"`
+	PublishPorts          []string          `json:"publishPorts,omitempty"`
 	Security              []string          `json:"security,omitempty"`
 	FilesPath             []string          `json:"filesPath,omitempty"`
 	LibrariesPath         []string          `json:"librariesPath,omitempty"`
 	FuseMount             []FuseMount       `json:"fuseMount,omitempty"`
 	ImageList             []image.Image     `json:"imageList,omitempty"`
 	BindPath              []BindPath        `json:"bindpath,omitempty"`
+	FSMounts              []FSMount         `json:"fsMounts,omitempty"`
 	ApptainerEnv          map[string]string `json:"apptainerEnv,omitempty"`
+	UnsetEnv              []string          `json:"unsetEnv,omitempty"`
 	UnixSocketPair        [2]int            `json:"unixSocketPair,omitempty"`
 	OpenFd                []int             `json:"openFd,omitempty"`
 	TargetGID             []int             `json:"targetGID,omitempty"`
+	ReplaceGroups         bool              `json:"replaceGroups,omitempty"`
+	Groups                []int             `json:"groups,omitempty"`
 	Image                 string            `json:"image"`
 	ImageArg              string            `json:"imageArg"`
+	ImageArchive          string            `json:"imageArchive,omitempty"`
+	ImageConverted        string            `json:"imageConverted,omitempty"`
 	Workdir               string            `json:"workdir,omitempty"`
 	ConfigDir             string            `json:"configdir,omitempty"`
 	CgroupsJSON           string            `json:"cgroupsJSON,omitempty"`
+	JobCgroup             string            `json:"jobCgroup,omitempty"`
 	HomeSource            string            `json:"homedir,omitempty"`
 	HomeDest              string            `json:"homeDest,omitempty"`
 	Command               string            `json:"command,omitempty"`
 	Shell                 string            `json:"shell,omitempty"`
 	FakerootPath          string            `json:"fakerootPath,omitempty"`
+	FakerootDB            string            `json:"fakerootDB,omitempty"`
 	TmpDir                string            `json:"tmpdir,omitempty"`
 	AddCaps               string            `json:"addCaps,omitempty"`
 	DropCaps              string            `json:"dropCaps,omitempty"`
 	Hostname              string            `json:"hostname,omitempty"`
+	Domainname            string            `json:"domainname,omitempty"`
 	Network               string            `json:"network,omitempty"`
 	DNS                   string            `json:"dns,omitempty"`
+	Timezone              string            `json:"timezone,omitempty"`
+	FakeTime              string            `json:"fakeTime,omitempty"`
+	NoLoopback            bool              `json:"noLoopback,omitempty"`
 	Cwd                   string            `json:"cwd,omitempty"`
 	SessionLayer          string            `json:"sessionLayer,omitempty"`
+	SessionDir            string            `json:"sessionDir,omitempty"`
+	SessionDirSize        int               `json:"sessionDirSize,omitempty"`
+	SquashfuseThreads     int               `json:"squashfuseThreads,omitempty"`
 	ConfigurationFile     string            `json:"configurationFile,omitempty"`
 	UseBuildConfig        bool              `json:"useBuildConfig,omitempty"`
 	EncryptionKey         []byte            `json:"encryptionKey,omitempty"`
 	TargetUID             int               `json:"targetUID,omitempty"`
 	WritableImage         bool              `json:"writableImage,omitempty"`
 	WritableTmpfs         bool              `json:"writableTmpfs,omitempty"`
+	ReadOnlyRoot          bool              `json:"readOnlyRoot,omitempty"`
+	WritablePaths         []string          `json:"writablePaths,omitempty"`
 	Contain               bool              `json:"container,omitempty"`
 	NvLegacy              bool              `json:"nvLegacy,omitempty"`
 	NvCCLI                bool              `json:"nvCCLI,omitempty"`
 	NvCCLIEnv             []string          `json:"NvCCLIEnv,omitempty"`
 	Rocm                  bool              `json:"rocm,omitempty"`
+	GPUDevices            []string          `json:"gpuDevices,omitempty"`
 	CustomHome            bool              `json:"customHome,omitempty"`
 	Instance              bool              `json:"instance,omitempty"`
 	InstanceJoin          bool              `json:"instanceJoin,omitempty"`
 	BootInstance          bool              `json:"bootInstance,omitempty"`
+	InstanceScript        string            `json:"instanceScript,omitempty"`
+	InstanceLogMaxSize    int64             `json:"instanceLogMaxSize,omitempty"`
+	InstanceLogMaxFiles   int               `json:"instanceLogMaxFiles,omitempty"`
+	InstanceSocketsDir    string            `json:"instanceSocketsDir,omitempty"`
+	InstanceSocketsMount  string            `json:"instanceSocketsMount,omitempty"`
 	RunPrivileged         bool              `json:"runPrivileged,omitempty"`
 	AllowSUID             bool              `json:"allowSUID,omitempty"`
 	KeepPrivs             bool              `json:"keepPrivs,omitempty"`
@@ -141,10 +166,12 @@ type JSONConfig struct {
 	NoCwd                 bool              `json:"noCwd,omitempty"`
 	SkipBinds             []string          `json:"skipBinds,omitempty"`
 	NoInit                bool              `json:"noInit,omitempty"`
+	Pty                   bool              `json:"pty,omitempty"`
 	Fakeroot              bool              `json:"fakeroot,omitempty"`
 	SignalPropagation     bool              `json:"signalPropagation,omitempty"`
 	RestoreUmask          bool              `json:"restoreUmask,omitempty"`
 	DeleteTempDir         string            `json:"deleteTempDir,omitempty"`
+	DeleteImageDir        string            `json:"deleteImageDir,omitempty"`
 	Umask                 int               `json:"umask,omitempty"`
 	DMTCPConfig           DMTCPConfig       `json:"dmtcpConfig,omitempty"`
 	XdgRuntimeDir         string            `json:"xdgRuntimeDir,omitempty"`
@@ -153,6 +180,21 @@ type JSONConfig struct {
 	Underlay              bool              `json:"underlay,omitempty"`
 	UserInfo              UserInfo          `json:"userInfo,omitempty"`
 	WritableOverlay       bool              `json:"writableOverlay,omitempty"`
+	OverlayIDMap          bool              `json:"overlayIDMap,omitempty"`
+	OverlayDriver         string            `json:"overlayDriver,omitempty"`
+
+	// NetworkCapabilityArgs are the capability arguments of the networks
+	// read from the --network-args-file file, indexed by network name then
+	// capability name.
+	NetworkCapabilityArgs map[string]map[string]json.RawMessage `json:"networkCapabilityArgs,omitempty"`
+	// InstanceIP and InstanceMAC are the addresses requested for an
+	// instance on its first network.
+	InstanceIP  string `json:"instanceIP,omitempty"`
+	InstanceMAC string `json:"instanceMAC,omitempty"`
+	// DNSSearch and DNSOptions are the comma separated search domains and
+	// resolver options of the container resolv.conf.
+	DNSSearch  string `json:"dnsSearch,omitempty"`
+	DNSOptions string `json:"dnsOptions,omitempty"`
 }
 
 // SetImage sets the container image path to be used by EngineConfig.JSON.
@@ -175,6 +217,31 @@ func (e *EngineConfig) GetImageArg() string {
 	return e.JSON.ImageArg
 }
 
+// SetImageArchive sets the path of the tar archive the container image
+// sandbox was extracted from.
+func (e *EngineConfig) SetImageArchive(path string) {
+	e.JSON.ImageArchive = path
+}
+
+// GetImageArchive returns the path of the tar archive the container image
+// sandbox was extracted from, an empty string if the image isn't extracted
+// from an archive.
+func (e *EngineConfig) GetImageArchive() string {
+	return e.JSON.ImageArchive
+}
+
+// SetImageConverted sets the path of the image file the container image
+// sandbox was converted from.
+func (e *EngineConfig) SetImageConverted(path string) {
+	e.JSON.ImageConverted = path
+}
+
+// GetImageConverted returns the path of the image file the container image
+// sandbox was converted from, an empty string if the image isn't converted.
+func (e *EngineConfig) GetImageConverted() string {
+	return e.JSON.ImageConverted
+}
+
 // SetEncryptionKey sets the key for the image's system partition.
 func (e *EngineConfig) SetEncryptionKey(key []byte) {
 	e.JSON.EncryptionKey = key
@@ -255,6 +322,16 @@ func (e *EngineConfig) GetRocm() bool {
 	return e.JSON.Rocm
 }
 
+// SetGPUDevices sets the GPU device nodes bound into a staged /dev.
+func (e *EngineConfig) SetGPUDevices(devices []string) {
+	e.JSON.GPUDevices = devices
+}
+
+// GetGPUDevices returns the GPU device nodes bound into a staged /dev.
+func (e *EngineConfig) GetGPUDevices() []string {
+	return e.JSON.GPUDevices
+}
+
 // SetWorkdir sets a work directory path.
 func (e *EngineConfig) SetWorkdir(name string) {
 	e.JSON.Workdir = name
@@ -326,6 +403,16 @@ func (e *EngineConfig) GetBindPath() []BindPath {
 	return e.JSON.BindPath
 }
 
+// SetFSMounts sets the tmpfs and devpts filesystems to mount into container.
+func (e *EngineConfig) SetFSMounts(mounts []FSMount) {
+	e.JSON.FSMounts = mounts
+}
+
+// GetFSMounts retrieves the tmpfs and devpts filesystems to mount.
+func (e *EngineConfig) GetFSMounts() []FSMount {
+	return e.JSON.FSMounts
+}
+
 // SetCommand sets action command to execute.
 func (e *EngineConfig) SetCommand(command string) {
 	e.JSON.Command = command
@@ -356,6 +443,16 @@ func (e *EngineConfig) GetFakerootPath() string {
 	return e.JSON.FakerootPath
 }
 
+// SetFakerootDB sets the database file of the fakeroot command
+func (e *EngineConfig) SetFakerootDB(path string) {
+	e.JSON.FakerootDB = path
+}
+
+// GetFakerootDB retrieves the database file of the fakeroot command
+func (e *EngineConfig) GetFakerootDB() string {
+	return e.JSON.FakerootDB
+}
+
 // SetTmpDir sets temporary directory path.
 func (e *EngineConfig) SetTmpDir(name string) {
 	e.JSON.TmpDir = name
@@ -396,6 +493,44 @@ func (e *EngineConfig) GetBootInstance() bool {
 	return e.JSON.BootInstance
 }
 
+// SetInstanceScript sets the container script executed as main instance
+// process, "start" for the startscript or "run" for the runscript.
+func (e *EngineConfig) SetInstanceScript(script string) {
+	e.JSON.InstanceScript = script
+}
+
+// GetInstanceScript returns the container script executed as main
+// instance process.
+func (e *EngineConfig) GetInstanceScript() string {
+	return e.JSON.InstanceScript
+}
+
+// SetInstanceLogRotation sets the size in bytes at which the instance log
+// files are rotated and the number of rotated files kept.
+func (e *EngineConfig) SetInstanceLogRotation(maxSize int64, maxFiles int) {
+	e.JSON.InstanceLogMaxSize = maxSize
+	e.JSON.InstanceLogMaxFiles = maxFiles
+}
+
+// GetInstanceLogRotation returns the size in bytes at which the instance
+// log files are rotated and the number of rotated files kept.
+func (e *EngineConfig) GetInstanceLogRotation() (int64, int) {
+	return e.JSON.InstanceLogMaxSize, e.JSON.InstanceLogMaxFiles
+}
+
+// SetInstanceSockets sets the host directory shared by the instance to
+// exchange unix sockets and the container directory where it's bound.
+func (e *EngineConfig) SetInstanceSockets(dir, mount string) {
+	e.JSON.InstanceSocketsDir = dir
+	e.JSON.InstanceSocketsMount = mount
+}
+
+// GetInstanceSockets returns the host directory shared by the instance to
+// exchange unix sockets and the container directory where it's bound.
+func (e *EngineConfig) GetInstanceSockets() (string, string) {
+	return e.JSON.InstanceSocketsDir, e.JSON.InstanceSocketsMount
+}
+
 // SetAddCaps sets bounding/effective/permitted/inheritable/ambient capabilities to add.
 func (e *EngineConfig) SetAddCaps(caps string) {
 	e.JSON.AddCaps = caps
@@ -426,6 +561,16 @@ func (e *EngineConfig) GetHostname() string {
 	return e.JSON.Hostname
 }
 
+// SetDomainname sets domainname to use in containee.JSON.
+func (e *EngineConfig) SetDomainname(domainname string) {
+	e.JSON.Domainname = domainname
+}
+
+// GetDomainname retrieves domainname to use in containee.JSON.
+func (e *EngineConfig) GetDomainname() string {
+	return e.JSON.Domainname
+}
+
 // SetAllowSUID sets allow-suid flag to allow to run setuid binary inside containee.JSON.
 func (e *EngineConfig) SetAllowSUID(allow bool) {
 	e.JSON.AllowSUID = allow
@@ -556,6 +701,18 @@ func (e *EngineConfig) GetNoInit() bool {
 	return e.JSON.NoInit
 }
 
+// SetPty sets if the standard streams of the container process are a
+// pseudo-terminal allocated for it, which becomes its controlling terminal.
+func (e *EngineConfig) SetPty(val bool) {
+	e.JSON.Pty = val
+}
+
+// GetPty returns if the standard streams of the container process are a
+// pseudo-terminal allocated for it.
+func (e *EngineConfig) GetPty() bool {
+	return e.JSON.Pty
+}
+
 // SetNetwork sets a list of commas separated networks to configure inside container.
 func (e *EngineConfig) SetNetwork(network string) {
 	e.JSON.Network = network
@@ -576,6 +733,42 @@ func (e *EngineConfig) GetNetworkArgs() []string {
 	return e.JSON.NetworkArgs
 }
 
+// SetNetworkCapabilityArgs sets the capability arguments to pass to CNI
+// plugins, indexed by network name then capability name.
+func (e *EngineConfig) SetNetworkCapabilityArgs(args map[string]map[string]json.RawMessage) {
+	e.JSON.NetworkCapabilityArgs = args
+}
+
+// GetNetworkCapabilityArgs retrieves the capability arguments passed to CNI
+// plugins.
+func (e *EngineConfig) GetNetworkCapabilityArgs() map[string]map[string]json.RawMessage {
+	return e.JSON.NetworkCapabilityArgs
+}
+
+// SetInstanceAddress sets the IP and hardware addresses requested for an
+// instance on its first network.
+func (e *EngineConfig) SetInstanceAddress(ip, mac string) {
+	e.JSON.InstanceIP = ip
+	e.JSON.InstanceMAC = mac
+}
+
+// GetInstanceAddress retrieves the IP and hardware addresses requested
+// for an instance on its first network.
+func (e *EngineConfig) GetInstanceAddress() (string, string) {
+	return e.JSON.InstanceIP, e.JSON.InstanceMAC
+}
+
+// SetPublishPorts sets the container ports published on the host, as
+// hostPort:containerPort/protocol.
+func (e *EngineConfig) SetPublishPorts(ports []string) {
+	e.JSON.PublishPorts = ports
+}
+
+// GetPublishPorts retrieves the container ports published on the host.
+func (e *EngineConfig) GetPublishPorts() []string {
+	return e.JSON.PublishPorts
+}
+
 // SetDNS sets a commas separated list of DNS servers to add in resolv.conf.
 func (e *EngineConfig) SetDNS(dns string) {
 	e.JSON.DNS = dns
@@ -586,6 +779,75 @@ func (e *EngineConfig) GetDNS() string {
 	return e.JSON.DNS
 }
 
+// SetDNSSearch sets the commas separated lists of search domains and
+// resolver options to add in resolv.conf.
+func (e *EngineConfig) SetDNSSearch(search, options string) {
+	e.JSON.DNSSearch = search
+	e.JSON.DNSOptions = options
+}
+
+// GetDNSSearch retrieves the lists of search domains and resolver options.
+func (e *EngineConfig) GetDNSSearch() (string, string) {
+	return e.JSON.DNSSearch, e.JSON.DNSOptions
+}
+
+// SetTimezone sets the container timezone zone name, or "host" to use
+// the host /etc/localtime file.
+func (e *EngineConfig) SetTimezone(tz string) {
+	e.JSON.Timezone = tz
+}
+
+// GetTimezone retrieves the container timezone.
+func (e *EngineConfig) GetTimezone() string {
+	return e.JSON.Timezone
+}
+
+// SetFakeTime sets the offset of the realtime clock applied by libfaketime
+// in the container, in the relative format of FAKETIME.
+func (e *EngineConfig) SetFakeTime(offset string) {
+	e.JSON.FakeTime = offset
+}
+
+// GetFakeTime retrieves the offset of the realtime clock applied by
+// libfaketime in the container.
+func (e *EngineConfig) GetFakeTime() string {
+	return e.JSON.FakeTime
+}
+
+// SetNoLoopback sets whether the loopback interface is left down
+// in a newly created network namespace.
+func (e *EngineConfig) SetNoLoopback(noLoopback bool) {
+	e.JSON.NoLoopback = noLoopback
+}
+
+// GetNoLoopback returns whether the loopback interface is left down
+// in a newly created network namespace.
+func (e *EngineConfig) GetNoLoopback() bool {
+	return e.JSON.NoLoopback
+}
+
+// SetSessionDir sets the host directory where a disk backed
+// session directory is created.
+func (e *EngineConfig) SetSessionDir(dir string) {
+	e.JSON.SessionDir = dir
+}
+
+// GetSessionDir returns the host directory where a disk backed
+// session directory is created.
+func (e *EngineConfig) GetSessionDir() string {
+	return e.JSON.SessionDir
+}
+
+// SetSessionDirSize sets the requested session directory size in MiB.
+func (e *EngineConfig) SetSessionDirSize(size int) {
+	e.JSON.SessionDirSize = size
+}
+
+// GetSessionDirSize returns the requested session directory size in MiB.
+func (e *EngineConfig) GetSessionDirSize() int {
+	return e.JSON.SessionDirSize
+}
+
 // SetImageList sets image list containing opened images.
 func (e *EngineConfig) SetImageList(list []image.Image) {
 	e.JSON.ImageList = list
@@ -632,6 +894,42 @@ func (e *EngineConfig) GetWritableTmpfs() bool {
 	return e.JSON.WritableTmpfs
 }
 
+// SetReadOnlyRoot sets whether the container root filesystem is kept
+// read-only even with a writable overlay.
+func (e *EngineConfig) SetReadOnlyRoot(readOnly bool) {
+	e.JSON.ReadOnlyRoot = readOnly
+}
+
+// GetReadOnlyRoot returns if the container root filesystem is kept
+// read-only even with a writable overlay.
+func (e *EngineConfig) GetReadOnlyRoot() bool {
+	return e.JSON.ReadOnlyRoot
+}
+
+// SetWritablePaths sets the container paths remaining writable with a
+// read-only root filesystem.
+func (e *EngineConfig) SetWritablePaths(paths []string) {
+	e.JSON.WritablePaths = paths
+}
+
+// GetWritablePaths returns the container paths remaining writable with
+// a read-only root filesystem.
+func (e *EngineConfig) GetWritablePaths() []string {
+	return e.JSON.WritablePaths
+}
+
+// SetSquashfuseThreads sets the number of threads used by squashfuse
+// to mount images.
+func (e *EngineConfig) SetSquashfuseThreads(n int) {
+	e.JSON.SquashfuseThreads = n
+}
+
+// GetSquashfuseThreads returns the number of threads used by squashfuse
+// to mount images.
+func (e *EngineConfig) GetSquashfuseThreads() int {
+	return e.JSON.SquashfuseThreads
+}
+
 // SetSecurity sets security feature arguments.
 func (e *EngineConfig) SetSecurity(security []string) {
 	e.JSON.Security = security
@@ -652,6 +950,18 @@ func (e *EngineConfig) GetCgroupsJSON() string {
 	return e.JSON.CgroupsJSON
 }
 
+// SetJobCgroup sets the cgroup of the job apptainer runs in, relative to
+// the cgroup mount point. The container cgroup is created beneath it when
+// a cgroups configuration is set, otherwise the container stays in it.
+func (e *EngineConfig) SetJobCgroup(group string) {
+	e.JSON.JobCgroup = group
+}
+
+// GetJobCgroup returns the cgroup of the job apptainer runs in.
+func (e *EngineConfig) GetJobCgroup() string {
+	return e.JSON.JobCgroup
+}
+
 // SetTargetUID sets target UID to execute the container process as user ID.
 func (e *EngineConfig) SetTargetUID(uid int) {
 	e.JSON.TargetUID = uid
@@ -672,6 +982,19 @@ func (e *EngineConfig) GetTargetGID() []int {
 	return e.JSON.TargetGID
 }
 
+// SetGroups sets the supplementary groups of the container process,
+// replacing the groups of the user.
+func (e *EngineConfig) SetGroups(gids []int) {
+	e.JSON.ReplaceGroups = true
+	e.JSON.Groups = gids
+}
+
+// GetGroups returns the supplementary groups of the container process,
+// and whether they replace the groups of the user.
+func (e *EngineConfig) GetGroups() ([]int, bool) {
+	return e.JSON.Groups, e.JSON.ReplaceGroups
+}
+
 // ConcatenateSliceDeduplicate concatenates two string slices and returns a string slice without duplicated entries.
 func ConcatenateSliceDeduplicate(first []string, second []string) []string {
 	dedup := make(map[string]struct{})
@@ -742,6 +1065,19 @@ func (e *EngineConfig) SetDeleteTempDir(dir string) {
 	e.JSON.DeleteTempDir = dir
 }
 
+// GetDeleteImageDir returns the path of the temporary directory containing
+// the image file, such as an image read from stdin, which must be deleted
+// after use. If no deletion is required, the empty string is returned.
+func (e *EngineConfig) GetDeleteImageDir() string {
+	return e.JSON.DeleteImageDir
+}
+
+// SetDeleteImageDir sets dir as the path of the temporary directory
+// containing the image file, which must be deleted after use.
+func (e *EngineConfig) SetDeleteImageDir(dir string) {
+	e.JSON.DeleteImageDir = dir
+}
+
 // SetSignalPropagation sets if engine must propagate signals from
 // master process -> container process when PID namespace is disabled
 // or from master process -> appinit process -> container
@@ -840,6 +1176,18 @@ func (e *EngineConfig) GetApptainerEnv() map[string]string {
 	return e.JSON.ApptainerEnv
 }
 
+// SetUnsetEnv sets the glob patterns of the environment variables
+// removed from the container after all other environment sources.
+func (e *EngineConfig) SetUnsetEnv(patterns []string) {
+	e.JSON.UnsetEnv = patterns
+}
+
+// GetUnsetEnv returns the glob patterns of the environment variables
+// removed from the container after all other environment sources.
+func (e *EngineConfig) GetUnsetEnv() []string {
+	return e.JSON.UnsetEnv
+}
+
 // SetConfigurationFile sets the apptainer configuration file to
 // use instead of the default one.
 func (e *EngineConfig) SetConfigurationFile(filename string) {
@@ -942,3 +1290,27 @@ func (e *EngineConfig) SetWritableOverlay(writableOverlay bool) {
 func (e *EngineConfig) GetWritableOverlay() bool {
 	return e.JSON.WritableOverlay
 }
+
+// SetOverlayIDMap sets whether the writable overlay directory is
+// mounted as an ID-mapped mount
+func (e *EngineConfig) SetOverlayIDMap(idmap bool) {
+	e.JSON.OverlayIDMap = idmap
+}
+
+// GetOverlayIDMap gets the value of whether the writable overlay
+// directory is mounted as an ID-mapped mount
+func (e *EngineConfig) GetOverlayIDMap() bool {
+	return e.JSON.OverlayIDMap
+}
+
+// SetOverlayDriver sets the driver selected to mount the overlay in a
+// user namespace
+func (e *EngineConfig) SetOverlayDriver(driver string) {
+	e.JSON.OverlayDriver = driver
+}
+
+// GetOverlayDriver gets the driver selected to mount the overlay in a
+// user namespace
+func (e *EngineConfig) GetOverlayDriver() string {
+	return e.JSON.OverlayDriver
+}
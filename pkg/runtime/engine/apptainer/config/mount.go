@@ -8,9 +8,38 @@ package apptainer
 import (
 	"encoding/csv"
 	"fmt"
+	"path/filepath"
+	"strconv"
 	"strings"
+
+	units "github.com/docker/go-units"
+)
+
+// Filesystem types mounted with --mount, besides binds.
+const (
+	FSTypeTmpfs  = "tmpfs"
+	FSTypeDevpts = "devpts"
 )
 
+// FSMount describes a filesystem mounted in the container with --mount,
+// a tmpfs or a new devpts instance.
+type FSMount struct {
+	Type        string `json:"type"`
+	Destination string `json:"destination"`
+	// Size is the size limit of a tmpfs in bytes, 0 for the default
+	Size int64 `json:"size,omitempty"`
+	// Mode is the octal mode of the tmpfs root directory, or of the
+	// devpts PTYs
+	Mode string `json:"mode,omitempty"`
+	// PtmxMode is the octal mode of the devpts ptmx device
+	PtmxMode string `json:"ptmxMode,omitempty"`
+	// UID and GID own the tmpfs root directory, or the devpts PTYs,
+	// the container user when unset
+	UID      *int `json:"uid,omitempty"`
+	GID      *int `json:"gid,omitempty"`
+	Readonly bool `json:"readonly,omitempty"`
+}
+
 // ParseMountString converts a --mount string into one or more BindPath structs.
 //
 // Our intention is to support common docker --mount strings, but have
@@ -27,71 +56,206 @@ import (
 //
 //	type=bind,source=/opt,destination=/other,rw
 //
-// We only support type=bind at present, so assume this if type is missing and
-// error for other types.
+// Only type=bind mounts are returned, assumed when type is missing, use
+// ParseMounts to get the tmpfs and devpts mounts too.
 func ParseMountString(mount string) (bindPaths []BindPath, err error) {
+	bindPaths, fsMounts, err := ParseMounts(mount)
+	if err != nil {
+		return []BindPath{}, err
+	}
+	if len(fsMounts) > 0 {
+		return []BindPath{}, fmt.Errorf("unsupported mount type %q, only 'bind' is supported", fsMounts[0].Type)
+	}
+	return bindPaths, nil
+}
+
+// ParseMounts converts a --mount string, in the ParseMountString format,
+// into the BindPath structs of its bind mounts and the FSMount structs of
+// its tmpfs and devpts mounts, e.g.:
+//
+//	type=tmpfs,destination=/dev/shm,size=8g,mode=1777
+//	type=devpts,destination=/dev/pts,newinstance
+func ParseMounts(mount string) (bindPaths []BindPath, fsMounts []FSMount, err error) {
 	r := strings.NewReader(mount)
 	c := csv.NewReader(r)
+	// mounts of different types have different numbers of fields
+	c.FieldsPerRecord = -1
 	records, err := c.ReadAll()
 	if err != nil {
-		return []BindPath{}, fmt.Errorf("error parsing mount: %v", err)
+		return []BindPath{}, nil, fmt.Errorf("error parsing mount: %v", err)
 	}
 
 	for _, r := range records {
-		bp := BindPath{
-			Options: map[string]*BindOption{},
+		switch t := mountType(r); t {
+		case "bind":
+			bp, err := parseBindMount(r)
+			if err != nil {
+				return []BindPath{}, nil, err
+			}
+			bindPaths = append(bindPaths, bp)
+		case FSTypeTmpfs, FSTypeDevpts:
+			fm, err := parseFSMount(t, r)
+			if err != nil {
+				return []BindPath{}, nil, err
+			}
+			fsMounts = append(fsMounts, fm)
+		default:
+			return []BindPath{}, nil, fmt.Errorf("unsupported mount type %q, only 'bind', 'tmpfs' and 'devpts' are supported", t)
 		}
+	}
+
+	return bindPaths, fsMounts, nil
+}
 
-		for _, f := range r {
-			kv := strings.SplitN(f, "=", 2)
-			key := kv[0]
-			val := ""
-			if len(kv) > 1 {
-				val = kv[1]
-			}
-
-			switch key {
-			// TODO - Eventually support volume and tmpfs? Requires structural changes to engine mount functionality.
-			case "type":
-				if val != "bind" {
-					return []BindPath{}, fmt.Errorf("unsupported mount type %q, only 'bind' is supported", val)
-				}
-			case "source", "src":
-				if val == "" {
-					return []BindPath{}, fmt.Errorf("mount source cannot be empty")
-				}
-				bp.Source = val
-			case "destination", "dst", "target":
-				if val == "" {
-					return []BindPath{}, fmt.Errorf("mount destination cannot be empty")
-				}
-				bp.Destination = val
-			case "ro", "readonly":
-				bp.Options["ro"] = &BindOption{}
-			// Apptainer only - directory inside an image file source to mount from
-			case "image-src":
-				if val == "" {
-					return []BindPath{}, fmt.Errorf("img-src cannot be empty")
-				}
-				bp.Options["image-src"] = &BindOption{Value: val}
-			// Apptainer only - id of the descriptor in a SIF image source to mount from
-			case "id":
-				if val == "" {
-					return []BindPath{}, fmt.Errorf("id cannot be empty")
-				}
-				bp.Options["id"] = &BindOption{Value: val}
-			case "bind-propagation":
-				return []BindPath{}, fmt.Errorf("bind-propagation not supported for individual mounts, check apptainer.conf for global setting")
-			default:
-				return []BindPath{}, fmt.Errorf("invalid key %q in mount specification", key)
+// mountType returns the type of the mount record, bind if unset.
+func mountType(r []string) string {
+	t := "bind"
+	for _, f := range r {
+		if key, val, _ := strings.Cut(f, "="); key == "type" {
+			t = val
+		}
+	}
+	return t
+}
+
+func parseBindMount(r []string) (BindPath, error) {
+	bp := BindPath{
+		Options: map[string]*BindOption{},
+	}
+
+	for _, f := range r {
+		kv := strings.SplitN(f, "=", 2)
+		key := kv[0]
+		val := ""
+		if len(kv) > 1 {
+			val = kv[1]
+		}
+
+		switch key {
+		case "type":
+		case "source", "src":
+			if val == "" {
+				return bp, fmt.Errorf("mount source cannot be empty")
+			}
+			bp.Source = val
+		case "destination", "dst", "target":
+			if val == "" {
+				return bp, fmt.Errorf("mount destination cannot be empty")
 			}
+			bp.Destination = val
+		case "ro", "readonly":
+			bp.Options["ro"] = &BindOption{}
+		// Apptainer only - directory inside an image file source to mount from
+		case "image-src":
+			if val == "" {
+				return bp, fmt.Errorf("img-src cannot be empty")
+			}
+			bp.Options["image-src"] = &BindOption{Value: val}
+		// Apptainer only - id of the descriptor in a SIF image source to mount from
+		case "id":
+			if val == "" {
+				return bp, fmt.Errorf("id cannot be empty")
+			}
+			bp.Options["id"] = &BindOption{Value: val}
+		// mount propagation of the bind, from the host to the container
+		case "bind-propagation":
+			if !IsBindPropagation(val) {
+				return bp, fmt.Errorf("invalid bind-propagation %q, must be one of %s", val, strings.Join(BindPropagations, ", "))
+			}
+			bp.Options[val] = &BindOption{}
+		default:
+			return bp, fmt.Errorf("invalid key %q in mount specification", key)
 		}
+	}
+
+	if bp.Source == "" || bp.Destination == "" {
+		return bp, fmt.Errorf("mounts must specify a source and a destination")
+	}
+	return bp, nil
+}
 
-		if bp.Source == "" || bp.Destination == "" {
-			return []BindPath{}, fmt.Errorf("mounts must specify a source and a destination")
+func parseFSMount(fstype string, r []string) (FSMount, error) {
+	m := FSMount{Type: fstype}
+
+	for _, f := range r {
+		key, val, _ := strings.Cut(f, "=")
+
+		switch key {
+		case "type":
+		case "source", "src":
+			return m, fmt.Errorf("%s mounts have no source", fstype)
+		case "destination", "dst", "target":
+			if val == "" {
+				return m, fmt.Errorf("mount destination cannot be empty")
+			}
+			m.Destination = val
+		case "ro", "readonly":
+			m.Readonly = true
+		case "size", "tmpfs-size":
+			if fstype != FSTypeTmpfs {
+				return m, fmt.Errorf("%s is only supported by tmpfs mounts", key)
+			}
+			size, err := units.RAMInBytes(val)
+			if err != nil || size <= 0 {
+				return m, fmt.Errorf("invalid tmpfs size %q", val)
+			}
+			m.Size = size
+		case "mode", "tmpfs-mode":
+			if key == "tmpfs-mode" && fstype != FSTypeTmpfs {
+				return m, fmt.Errorf("%s is only supported by tmpfs mounts", key)
+			}
+			mode, err := parseMode(val)
+			if err != nil {
+				return m, err
+			}
+			m.Mode = mode
+		case "ptmxmode":
+			if fstype != FSTypeDevpts {
+				return m, fmt.Errorf("%s is only supported by devpts mounts", key)
+			}
+			mode, err := parseMode(val)
+			if err != nil {
+				return m, err
+			}
+			m.PtmxMode = mode
+		case "uid", "gid":
+			id, err := strconv.Atoi(val)
+			if err != nil || id < 0 {
+				return m, fmt.Errorf("invalid %s %q", key, val)
+			}
+			if key == "uid" {
+				m.UID = &id
+			} else {
+				m.GID = &id
+			}
+		// devpts mounts are always a new instance
+		case "newinstance":
+			if fstype != FSTypeDevpts {
+				return m, fmt.Errorf("%s is only supported by devpts mounts", key)
+			}
+		default:
+			return m, fmt.Errorf("invalid key %q in %s mount specification", key, fstype)
 		}
-		bindPaths = append(bindPaths, bp)
 	}
 
-	return bindPaths, nil
+	if m.Destination == "" {
+		return m, fmt.Errorf("%s mounts must specify a destination", fstype)
+	}
+	if !filepath.IsAbs(m.Destination) {
+		return m, fmt.Errorf("%s mount destination %s must be an absolute path", fstype, m.Destination)
+	}
+	m.Destination = filepath.Clean(m.Destination)
+	if m.Destination == "/" {
+		return m, fmt.Errorf("%s can't be mounted on /", fstype)
+	}
+	return m, nil
+}
+
+// parseMode parses an octal file mode, returned without leading zeros.
+func parseMode(val string) (string, error) {
+	mode, err := strconv.ParseUint(val, 8, 32)
+	if err != nil || mode > 0o7777 {
+		return "", fmt.Errorf("invalid mode %q, must be an octal mode like 1777", val)
+	}
+	return strconv.FormatUint(mode, 8), nil
 }
@@ -196,7 +196,21 @@ func TestParseMountString(t *testing.T) {
 		},
 		{
 			name:        "bindpropagation",
-			mountString: "type=bind,source=/opt,destination=/opt,bind-propagation=shared",
+			mountString: "type=bind,source=/cvmfs,destination=/cvmfs,bind-propagation=rslave",
+			want: []BindPath{
+				{
+					Source:      "/cvmfs",
+					Destination: "/cvmfs",
+					Options: map[string]*BindOption{
+						"rslave": {},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:        "bindpropagationInvalid",
+			mountString: "type=bind,source=/opt,destination=/opt,bind-propagation=unbindable",
 			want:        []BindPath{},
 			wantErr:     true,
 		},
@@ -243,3 +257,125 @@ func TestParseMountString(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMounts(t *testing.T) {
+	uid := 1000
+	gid := 0
+	tests := []struct {
+		name        string
+		mountString string
+		wantBinds   []BindPath
+		wantFS      []FSMount
+		wantErr     bool
+	}{
+		{
+			name:        "tmpfsShm",
+			mountString: "type=tmpfs,dst=/dev/shm,size=8g,mode=1777",
+			wantFS: []FSMount{
+				{Type: FSTypeTmpfs, Destination: "/dev/shm", Size: 8 << 30, Mode: "1777"},
+			},
+		},
+		{
+			name:        "tmpfsOwner",
+			mountString: "type=tmpfs,target=/scratch/,tmpfs-size=512m,tmpfs-mode=0700,uid=1000,gid=0,ro",
+			wantFS: []FSMount{
+				{Type: FSTypeTmpfs, Destination: "/scratch", Size: 512 << 20, Mode: "700", UID: &uid, GID: &gid, Readonly: true},
+			},
+		},
+		{
+			name:        "devpts",
+			mountString: "type=devpts,dst=/dev/pts,newinstance,ptmxmode=0666,mode=620",
+			wantFS: []FSMount{
+				{Type: FSTypeDevpts, Destination: "/dev/pts", Mode: "620", PtmxMode: "666"},
+			},
+		},
+		{
+			name:        "mixed",
+			mountString: "type=bind,source=/opt,destination=/opt\ntype=tmpfs,destination=/tmp",
+			wantBinds: []BindPath{
+				{Source: "/opt", Destination: "/opt", Options: map[string]*BindOption{}},
+			},
+			wantFS: []FSMount{
+				{Type: FSTypeTmpfs, Destination: "/tmp"},
+			},
+		},
+		{
+			name:        "tmpfsSource",
+			mountString: "type=tmpfs,source=/opt,destination=/tmp",
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsNoDest",
+			mountString: "type=tmpfs,size=1g",
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsRelativeDest",
+			mountString: "type=tmpfs,dst=tmp",
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsRoot",
+			mountString: "type=tmpfs,dst=/",
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsBadSize",
+			mountString: "type=tmpfs,dst=/tmp,size=big",
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsBadMode",
+			mountString: "type=tmpfs,dst=/tmp,mode=17777",
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsNonOctalMode",
+			mountString: "type=tmpfs,dst=/tmp,mode=999",
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsBadUID",
+			mountString: "type=tmpfs,dst=/tmp,uid=-1",
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsPtmxmode",
+			mountString: "type=tmpfs,dst=/tmp,ptmxmode=0666",
+			wantErr:     true,
+		},
+		{
+			name:        "devptsSize",
+			mountString: "type=devpts,dst=/dev/pts,size=1g",
+			wantErr:     true,
+		},
+		{
+			name:        "volume",
+			mountString: "type=volume,dst=/data",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binds, fsMounts, err := ParseMounts(tt.mountString)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMounts() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(binds, tt.wantBinds) {
+				t.Errorf("ParseMounts() binds = %v, want %v", binds, tt.wantBinds)
+			}
+			if !reflect.DeepEqual(fsMounts, tt.wantFS) {
+				t.Errorf("ParseMounts() fs mounts = %+v, want %+v", fsMounts, tt.wantFS)
+			}
+		})
+	}
+
+	// ParseMountString only accepts binds
+	if _, err := ParseMountString("type=tmpfs,dst=/tmp"); err == nil {
+		t.Errorf("ParseMountString() unexpected success with a tmpfs mount")
+	}
+}
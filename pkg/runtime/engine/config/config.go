@@ -15,9 +15,21 @@ import (
 	"github.com/apptainer/apptainer/pkg/plugin"
 )
 
+// SchemaVersion is the version of the schema of the serialized engine
+// configuration passed from the CLI to the starter. Its major version must
+// be increased by any change an older starter can't decode correctly, new
+// fields are ignored by an older starter with the same major version.
+const SchemaVersion = "1.0"
+
 // Common provides the basis for all engine configs. Anything that can not be
 // properly described through the OCI config can be stored as a generic JSON []byte.
 type Common struct {
+	// SchemaVersion is the schema version of the serialized configuration,
+	// configurations produced before versioning have an empty value.
+	SchemaVersion string `json:"schemaVersion,omitempty"`
+	// Version is the version of the CLI which produced the configuration.
+	Version string `json:"version,omitempty"`
+
 	EngineName  string `json:"engineName"`
 	ContainerID string `json:"containerID"`
 	// EngineConfig is the raw JSON representation of the Engine's underlying config.
@@ -25,6 +37,10 @@ type Common struct {
 
 	// PluginConfig is the JSON raw representation of the plugin configurations.
 	PluginConfig map[string]json.RawMessage `json:"plugin"`
+
+	// JSONErrors prints the error records of the container startup failures
+	// as JSON rather than as actionable messages.
+	JSONErrors bool `json:"jsonErrors,omitempty"`
 }
 
 // GetPluginConfig retrieves the configuration for the corresponding plugin.
@@ -31,6 +31,10 @@ const (
 	RemoteConfFile         = "remote.yaml"
 	RemoteCache            = "remote-cache"
 	DockerConfFile         = "docker-config.json"
+	PluginStateFile        = "plugins.json"
+	PluginConfDir          = "plugins"
+	NetworkConfDir         = "network"
+	UploadStateDir         = "uploads"
 	apptainerDir           = ".apptainer"
 	legacyDir              = ".singularity"
 	defaultLocalKeyDirName = "keys" // defaultLocalKeyDirName represents the default local key storage folder name
@@ -92,6 +96,30 @@ func DockerConf() string {
 	return filepath.Join(ConfigDir(), DockerConfFile)
 }
 
+// PluginState returns the path of the file holding the plugins
+// enabled or disabled by the user.
+func PluginState() string {
+	return filepath.Join(ConfigDir(), PluginStateFile)
+}
+
+// PluginConf returns the directory holding the configuration files
+// of the plugins set by the user.
+func PluginConf() string {
+	return filepath.Join(ConfigDir(), PluginConfDir)
+}
+
+// NetworkConf returns the directory holding the configuration files
+// of the networks created by the user.
+func NetworkConf() string {
+	return filepath.Join(ConfigDir(), NetworkConfDir)
+}
+
+// UploadState returns the directory holding the state of the
+// interrupted library uploads of the user, to resume them.
+func UploadState() string {
+	return filepath.Join(ConfigDir(), UploadStateDir)
+}
+
 // ConfigDirForUsername returns the directory where the apptainer
 // configuration and data for the specified username is located.
 func ConfigDirForUsername(username string) (string, error) {
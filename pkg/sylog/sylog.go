@@ -100,6 +100,13 @@ func Fatalf(format string, a ...interface{}) {
 	os.Exit(255)
 }
 
+// Exitf is equivalent to Fatalf, exiting with code instead of 255. Code that
+// may be imported by other projects should NOT use Exitf.
+func Exitf(code int, format string, a ...interface{}) {
+	writef(FatalLevel, format, a...)
+	os.Exit(code)
+}
+
 // Errorf writes an ERROR level message to the log but does not exit. This
 // should be called when an error is being returned to the calling thread
 func Errorf(format string, a ...interface{}) {
@@ -44,6 +44,12 @@ func Fatalf(format string, a ...interface{}) {
 	os.Exit(255)
 }
 
+// Exitf is a dummy function exiting with code. This
+// function must not be used in public packages.
+func Exitf(code int, format string, a ...interface{}) {
+	os.Exit(code)
+}
+
 // Errorf is a dummy function doing nothing.
 func Errorf(format string, a ...interface{}) {}
 
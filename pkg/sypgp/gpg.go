@@ -0,0 +1,145 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+var (
+	// gpgCommand is the GnuPG command.
+	gpgCommand = "gpg"
+	// gpgconfCommand is the GnuPG configuration command.
+	gpgconfCommand = "gpgconf"
+)
+
+// runCommand runs the command name with args and the standard input stdin,
+// and returns its standard output.
+func runCommand(stdin io.Reader, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s %s failed: %v: %s", name, strings.Join(args, " "), err, msg)
+		}
+		return nil, fmt.Errorf("%s %s failed: %v", name, strings.Join(args, " "), err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// runGPG runs gpg with args and the standard input stdin. Without batch,
+// the passphrase prompts of the secret keys go through the pinentry of
+// gpg-agent.
+func runGPG(stdin io.Reader, batch bool, args ...string) ([]byte, error) {
+	if batch {
+		args = append([]string{"--batch"}, args...)
+	}
+	return runCommand(stdin, gpgCommand, args...)
+}
+
+// gpgEntities returns the keys keyID of the GnuPG keyring, with their
+// secret keys if secret is true.
+func gpgEntities(keyID string, secret bool) (openpgp.EntityList, error) {
+	args := []string{"--export", keyID}
+	if secret {
+		args = []string{"--export-secret-keys", keyID}
+	}
+	out, err := runGPG(nil, !secret, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no key %s found in the GnuPG keyring", keyID)
+	}
+	el, err := openpgp.ReadKeyRing(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("while reading keys exported by GnuPG: %v", err)
+	}
+	return el, nil
+}
+
+// ImportGPGKey imports the key keyID of the GnuPG keyring into the
+// keyring. Only the public key is imported, unless secret is true.
+func (keyring *Handle) ImportGPGKey(keyID string, secret, setNewPassword bool) error {
+	if err := keyring.PathsCheck(); err != nil {
+		return err
+	}
+
+	el, err := gpgEntities(keyID, secret)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range el {
+		if secret && e.PrivateKey != nil {
+			if err := keyring.importPrivateKey(e, setNewPassword); err != nil {
+				return err
+			}
+			fmt.Printf("Key with fingerprint %X successfully added to the private keyring\n",
+				e.PrivateKey.Fingerprint)
+		}
+
+		if err := keyring.importPublicKey(e); err != nil {
+			return err
+		}
+		fmt.Printf("Key with fingerprint %X successfully added to the public keyring\n",
+			e.PrimaryKey.Fingerprint)
+	}
+
+	return nil
+}
+
+// ExportGPGKey exports the key with the given fingerprint from the keyring
+// to the GnuPG keyring, with its secret key if secret is true.
+func (keyring *Handle) ExportGPGKey(fingerprint string, secret bool) error {
+	if err := keyring.PathsCheck(); err != nil {
+		return err
+	}
+
+	path := keyring.PublicPath()
+	if secret {
+		path = keyring.SecretPath()
+	}
+	el, err := loadKeyring(path)
+	if err != nil {
+		return fmt.Errorf("unable to load keyring: %v", err)
+	}
+	e := findKeyByFingerprint(el, strings.ToUpper(fingerprint))
+	if e == nil {
+		return fmt.Errorf("no key with fingerprint %s found in the keyring", fingerprint)
+	}
+
+	var buf bytes.Buffer
+	if secret {
+		// the key stays encrypted, gpg-agent asks its passphrase
+		err = e.SerializePrivateWithoutSigning(&buf, nil)
+	} else {
+		err = e.Serialize(&buf)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to serialize key: %v", err)
+	}
+
+	if _, err := runGPG(&buf, !secret, "--import"); err != nil {
+		return err
+	}
+	fmt.Printf("Key with fingerprint %X successfully exported to the GnuPG keyring\n", e.PrimaryKey.Fingerprint)
+
+	return nil
+}
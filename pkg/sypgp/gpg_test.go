@@ -0,0 +1,147 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// newGPGKey creates a GnuPG home with a new RSA signing key without
+// passphrase, and returns its fingerprint.
+func newGPGKey(t *testing.T, uid string) string {
+	if _, err := exec.LookPath(gpgCommand); err != nil {
+		t.Skipf("%s not found", gpgCommand)
+	}
+	t.Setenv("GNUPGHOME", t.TempDir())
+	t.Cleanup(func() {
+		exec.Command(gpgconfCommand, "--kill", "gpg-agent").Run()
+	})
+
+	if _, err := runGPG(nil, true, "--passphrase", "", "--quick-gen-key", uid, "rsa2048", "sign", "never"); err != nil {
+		t.Fatalf("could not generate GnuPG key: %v", err)
+	}
+	out, err := runGPG(nil, true, "--with-colons", "--list-keys", uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Split(line, ":"); fields[0] == "fpr" {
+			return fields[9]
+		}
+	}
+	t.Fatalf("no fingerprint found for %s", uid)
+	return ""
+}
+
+func TestGPGImportExport(t *testing.T) {
+	fingerprint := newGPGKey(t, "Test <test@apptainer.org>")
+	keyring := NewHandle(t.TempDir())
+
+	if err := keyring.ImportGPGKey(fingerprint, false, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pub, err := keyring.LoadPubKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findKeyByFingerprint(pub, fingerprint) == nil {
+		t.Errorf("key %s not imported in the public keyring", fingerprint)
+	}
+	// the private key stays in the GnuPG keyring
+	priv, err := keyring.LoadPrivKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(priv) != 0 {
+		t.Errorf("private key imported without secret")
+	}
+
+	if err := keyring.ImportGPGKey("unknown@apptainer.org", false, false); err == nil {
+		t.Errorf("unexpected success importing an unknown key")
+	}
+
+	// export a key of the keyring to GnuPG
+	e, err := keyring.genKeyPair(GenKeyPairOptions{Name: "Other", Email: "other@apptainer.org", KeyLength: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.appendPubKey(e); err != nil {
+		t.Fatal(err)
+	}
+	other := fmt.Sprintf("%x", e.PrimaryKey.Fingerprint)
+	if err := keyring.ExportGPGKey(other, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := runGPG(nil, true, "--list-keys", other); err != nil {
+		t.Errorf("key not exported to GnuPG: %v", err)
+	}
+}
+
+func TestGPGAgentEntity(t *testing.T) {
+	fingerprint := newGPGKey(t, "Test <test@apptainer.org>")
+
+	e, err := GPGAgentEntity(fingerprint)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint); got != fingerprint {
+		t.Errorf("got key %s, want %s", got, fingerprint)
+	}
+
+	// the detached signature by gpg-agent is verified with the public key
+	message := []byte("signed by gpg-agent")
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, e, bytes.NewReader(message), &packet.Config{DefaultHash: crypto.SHA256}); err != nil {
+		t.Fatalf("unexpected error signing: %v", err)
+	}
+	signer, err := openpgp.CheckDetachedSignature(openpgp.EntityList{e}, bytes.NewReader(message), &sig, nil)
+	if err != nil {
+		t.Fatalf("signature not verified: %v", err)
+	}
+	if signer.PrimaryKey.KeyId != e.PrimaryKey.KeyId {
+		t.Errorf("unexpected signer %X", signer.PrimaryKey.Fingerprint)
+	}
+}
+
+func TestRSASignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		sexp    string
+		want    string
+		wantErr bool
+	}{
+		{name: "Valid", sexp: "(7:sig-val(3:rsa(1:s4:\x01\x02\x03\x04)))", want: "\x01\x02\x03\x04"},
+		{name: "NotRSA", sexp: "(7:sig-val(5:ecdsa(1:r1:\x01)(1:s1:\x02)))", wantErr: true},
+		{name: "Truncated", sexp: "(7:sig-val(3:rsa(1:s8:\x01\x02", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rsaSignature([]byte(tt.sexp))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got signature %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := string(assuanUnescape("a%25b%0Ac")); got != "a%b\nc" {
+		t.Errorf("unexpected unescaped data %q", got)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// agentHashAlgos are the libgcrypt identifiers of the hash algorithms,
+// used by the SETHASH command of gpg-agent.
+var agentHashAlgos = map[crypto.Hash]int{
+	crypto.SHA1:   2,
+	crypto.SHA256: 8,
+	crypto.SHA384: 9,
+	crypto.SHA512: 10,
+	crypto.SHA224: 11,
+}
+
+// agentSigner is a crypto.Signer delegating the signature operations to
+// gpg-agent, the private key never leaving the agent.
+type agentSigner struct {
+	pub     *rsa.PublicKey
+	keygrip string
+	socket  string
+}
+
+// Public returns the public key of the signer.
+func (s *agentSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs digest with the key held by gpg-agent, which asks its
+// passphrase through its pinentry if needed.
+func (s *agentSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	algo, ok := agentHashAlgos[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("hash algorithm %v not supported by gpg-agent", opts.HashFunc())
+	}
+
+	conn, err := net.Dial("unix", s.socket)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to gpg-agent: %v", err)
+	}
+	defer conn.Close()
+
+	c := &assuanConn{conn: conn, r: bufio.NewReader(conn)}
+	// greeting of the agent
+	if _, err := c.response(); err != nil {
+		return nil, err
+	}
+
+	// the pinentry is displayed on the terminal or display of the user
+	var cmds []string
+	for option, value := range pinentryOptions() {
+		cmds = append(cmds, fmt.Sprintf("OPTION %s=%s", option, value))
+	}
+	cmds = append(cmds,
+		"SIGKEY "+s.keygrip,
+		fmt.Sprintf("SETHASH %d %X", algo, digest),
+	)
+	for _, cmd := range cmds {
+		if _, err := c.command(cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := c.command("PKSIGN")
+	if err != nil {
+		return nil, err
+	}
+	return rsaSignature(data)
+}
+
+// pinentryOptions returns the options of gpg-agent locating the terminal
+// and display of the user for its pinentry.
+func pinentryOptions() map[string]string {
+	options := make(map[string]string)
+
+	tty := os.Getenv("GPG_TTY")
+	if tty == "" {
+		if name, err := os.Readlink("/proc/self/fd/0"); err == nil && strings.HasPrefix(name, "/dev/") {
+			tty = name
+		}
+	}
+	if tty != "" {
+		options["ttyname"] = tty
+	}
+	if term := os.Getenv("TERM"); term != "" {
+		options["ttytype"] = term
+	}
+	if display := os.Getenv("DISPLAY"); display != "" {
+		options["display"] = display
+	}
+	return options
+}
+
+// assuanConn is a connection to gpg-agent with the Assuan protocol.
+type assuanConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// command sends the command cmd, and returns the data of its response.
+func (c *assuanConn) command(cmd string) ([]byte, error) {
+	if _, err := fmt.Fprintf(c.conn, "%s\n", cmd); err != nil {
+		return nil, fmt.Errorf("could not send command to gpg-agent: %v", err)
+	}
+	return c.response()
+}
+
+// response reads a response until its final OK or ERR line, answering the
+// inquiries of the agent with no data.
+func (c *assuanConn) response() ([]byte, error) {
+	var data []byte
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("could not read response of gpg-agent: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "OK" || strings.HasPrefix(line, "OK "):
+			return data, nil
+		case strings.HasPrefix(line, "ERR "):
+			return nil, fmt.Errorf("gpg-agent: %s", strings.TrimPrefix(line, "ERR "))
+		case strings.HasPrefix(line, "D "):
+			data = append(data, assuanUnescape(line[2:])...)
+		case strings.HasPrefix(line, "INQUIRE "):
+			if _, err := fmt.Fprintf(c.conn, "END\n"); err != nil {
+				return nil, fmt.Errorf("could not answer gpg-agent: %v", err)
+			}
+		}
+		// status and comment lines are ignored
+	}
+}
+
+// assuanUnescape decodes the percent-escaped data of an Assuan data line.
+func assuanUnescape(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b = append(b, byte(v))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, s[i])
+	}
+	return b
+}
+
+// rsaSignature returns the RSA signature of the canonical S-expression
+// (sig-val (rsa (s <signature>))) returned by gpg-agent.
+func rsaSignature(sexp []byte) ([]byte, error) {
+	const prefix = "(3:rsa(1:s"
+	i := bytes.Index(sexp, []byte(prefix))
+	if i < 0 {
+		return nil, fmt.Errorf("unexpected signature returned by gpg-agent")
+	}
+	rest := sexp[i+len(prefix):]
+	n := bytes.IndexByte(rest, ':')
+	if n < 0 {
+		return nil, fmt.Errorf("malformed signature returned by gpg-agent")
+	}
+	size, err := strconv.Atoi(string(rest[:n]))
+	if err != nil || size <= 0 || n+1+size > len(rest) {
+		return nil, fmt.Errorf("malformed signature returned by gpg-agent")
+	}
+	return rest[n+1 : n+1+size], nil
+}
+
+// gpgKeygrip returns the keygrip of the key with the given fingerprint,
+// identifying it in gpg-agent.
+func gpgKeygrip(fingerprint string) (string, error) {
+	out, err := runGPG(nil, true, "--with-colons", "--with-keygrip", "--list-keys", fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	found := false
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 10 {
+			continue
+		}
+		switch fields[0] {
+		case "fpr":
+			found = strings.EqualFold(fields[9], fingerprint)
+		case "grp":
+			if found {
+				return fields[9], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no keygrip found for key %s", fingerprint)
+}
+
+// GPGAgentEntity returns the entity of the key keyID of the GnuPG keyring,
+// whose signature operations are delegated to gpg-agent: the private key
+// never leaves the agent, which asks its passphrase through its pinentry.
+// Only RSA primary keys are supported.
+func GPGAgentEntity(keyID string) (*openpgp.Entity, error) {
+	el, err := gpgEntities(keyID, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(el) != 1 {
+		return nil, fmt.Errorf("%d keys match %s in the GnuPG keyring, use the key fingerprint", len(el), keyID)
+	}
+	e := el[0]
+
+	pub, ok := e.PrimaryKey.PublicKey.(*rsa.PublicKey)
+	if !ok || !e.PrimaryKey.PubKeyAlgo.CanSign() {
+		return nil, fmt.Errorf("key %X is not an RSA signing key, not supported with gpg-agent", e.PrimaryKey.Fingerprint)
+	}
+
+	fingerprint := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+	keygrip, err := gpgKeygrip(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := runCommand(nil, gpgconfCommand, "--launch", "gpg-agent"); err != nil {
+		return nil, err
+	}
+	out, err := runCommand(nil, gpgconfCommand, "--list-dirs", "agent-socket")
+	if err != nil {
+		return nil, err
+	}
+
+	e.PrivateKey = &packet.PrivateKey{
+		PublicKey: *e.PrimaryKey,
+		PrivateKey: &agentSigner{
+			pub:     pub,
+			keygrip: keygrip,
+			socket:  strings.TrimSpace(string(out)),
+		},
+	}
+	return e, nil
+}
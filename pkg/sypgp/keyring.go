@@ -22,9 +22,20 @@ import (
 	"github.com/apptainer/container-key-client/client"
 )
 
-// PublicKeyRing retrieves the Apptainer public KeyRing.
+// PublicKeyRing retrieves the Apptainer public KeyRing, along with the
+// keys of the keyring of the LegacyRemote namespace.
 func PublicKeyRing() (openpgp.KeyRing, error) {
-	return NewHandle("").LoadPubKeyring()
+	keyring := NewHandle("")
+
+	local, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := keyring.loadRemotePubKeyring(LegacyRemote)
+	if err != nil {
+		return nil, err
+	}
+	return append(local, legacy...), nil
 }
 
 // hybridKeyRing is keyring made up of a local keyring as well as a keyserver. The type satisfies
@@ -33,6 +44,7 @@ type hybridKeyRing struct {
 	local openpgp.KeyRing // Local keyring.
 	ctx   context.Context //nolint:containedctx // Context, for use when retrieving keys remotely.
 	c     *client.Client  // Keyserver client.
+	store *Handle         // Keyring storing the keys retrieved remotely, if not nil.
 }
 
 // NewHybridKeyRing returns a keyring backed by both the local public keyring and the configured
@@ -71,6 +83,7 @@ func (kr *hybridKeyRing) KeysById(id uint64) []openpgp.Key {
 		sylog.Warningf("failed to get key material: %v", err)
 		return nil
 	}
+	kr.storeEntities(el)
 	return el.KeysById(id)
 }
 
@@ -89,6 +102,7 @@ func (kr *hybridKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []openpgp.
 		sylog.Warningf("failed to get key material: %v", err)
 		return nil
 	}
+	kr.storeEntities(el)
 	return el.KeysByIdUsage(id, requiredUsage)
 }
 
@@ -112,6 +126,33 @@ func (kr *hybridKeyRing) remoteEntitiesByID(id uint64) (openpgp.EntityList, erro
 	return openpgp.ReadArmoredKeyRing(strings.NewReader(kt))
 }
 
+// storeEntities stores the entities el retrieved from the keyserver in the
+// store keyring, if any.
+func (kr *hybridKeyRing) storeEntities(el openpgp.EntityList) {
+	if kr.store == nil {
+		return
+	}
+	if err := ensureDirPrivate(kr.store.path); err != nil {
+		sylog.Warningf("could not store key material in %s: %v", kr.store.path, err)
+		return
+	}
+	stored, err := loadKeyring(kr.store.PublicPath())
+	if err != nil {
+		sylog.Warningf("could not load keyring %s: %v", kr.store.PublicPath(), err)
+		return
+	}
+	for _, e := range el {
+		if findEntityByFingerprint(stored, e.PrimaryKey.Fingerprint) != nil {
+			continue
+		}
+		if err := kr.store.appendPubKey(e); err != nil {
+			sylog.Warningf("could not store key %X in %s: %v", e.PrimaryKey.Fingerprint, kr.store.PublicPath(), err)
+			return
+		}
+		sylog.Verbosef("Key %X stored in %s", e.PrimaryKey.Fingerprint, kr.store.PublicPath())
+	}
+}
+
 type multiKeyRing struct {
 	keyrings []openpgp.KeyRing
 }
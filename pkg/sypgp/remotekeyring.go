@@ -0,0 +1,171 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/container-key-client/client"
+)
+
+const (
+	// LegacyRemote is the namespace of the public keys of the keyring
+	// predating the keyrings of the remotes.
+	LegacyRemote = "legacy"
+
+	// RemotesDir is the directory of the keyrings of the remotes.
+	RemotesDir = "remotes"
+)
+
+// RemoteHandle returns the handle of the keyring holding the public keys
+// fetched from the keyserver of the remote name.
+func (keyring *Handle) RemoteHandle(name string) (*Handle, error) {
+	if keyring.global {
+		return nil, fmt.Errorf("the global keyring has no remote keyrings")
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) {
+		return nil, fmt.Errorf("invalid remote name %q", name)
+	}
+	return NewHandle(filepath.Join(keyring.path, RemotesDir, name)), nil
+}
+
+// RemoteNames returns the names of the remotes having a keyring.
+func (keyring *Handle) RemoteNames() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(keyring.path, RemotesDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// MigrateLegacyKeyring moves the public keys of a keyring predating the
+// keyrings of the remotes to the keyring of the LegacyRemote namespace,
+// still consulted to verify images until the keys are removed from it.
+// Nothing is done once the directory of the remote keyrings exists.
+func (keyring *Handle) MigrateLegacyKeyring() error {
+	if keyring.global {
+		return nil
+	}
+
+	remotes := filepath.Join(keyring.path, RemotesDir)
+	if _, err := os.Stat(remotes); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := keyring.PathsCheck(); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(keyring.PublicPath())
+	if err != nil || fi.Size() == 0 {
+		return os.Mkdir(remotes, 0o700)
+	}
+
+	legacy, err := keyring.RemoteHandle(LegacyRemote)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(legacy.path, 0o700); err != nil {
+		return err
+	}
+	if err := os.Rename(keyring.PublicPath(), legacy.PublicPath()); err != nil {
+		return fmt.Errorf("while moving public keys to the %s remote keyring: %v", LegacyRemote, err)
+	}
+	sylog.Infof("Public keys of %s moved to the %q remote keyring %s", keyring.path, LegacyRemote, legacy.PublicPath())
+	return nil
+}
+
+// loadRemotePubKeyring returns the public keys of the keyring of the
+// remote name, or an empty keyring if it doesn't exist.
+func (keyring *Handle) loadRemotePubKeyring(name string) (openpgp.EntityList, error) {
+	h, err := keyring.RemoteHandle(name)
+	if err != nil {
+		return nil, err
+	}
+	return loadKeyring(h.PublicPath())
+}
+
+// NewRemoteKeyRing returns a keyring backed by the local public keyring,
+// the keyring of the remote name and the legacy keyring and, if opts are
+// supplied, by the keyserver of the remote, whose keys are then stored in
+// the keyring of the remote.
+func NewRemoteKeyRing(ctx context.Context, name string, opts ...client.Option) (openpgp.KeyRing, error) {
+	keyring := NewHandle("")
+
+	local, err := PublicKeyRing()
+	if err != nil {
+		return nil, err
+	}
+	rkr, err := keyring.loadRemotePubKeyring(name)
+	if err != nil {
+		return nil, err
+	}
+	kr := NewMultiKeyRing(local, rkr)
+
+	if opts == nil {
+		return kr, nil
+	}
+
+	c, err := client.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	store, err := keyring.RemoteHandle(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hybridKeyRing{
+		local: kr,
+		ctx:   ctx,
+		c:     c,
+		store: store,
+	}, nil
+}
+
+// KeyringOf returns the name of the local keyring holding the public key
+// id: "local" for the local public keyring, "legacy" for the legacy
+// keyring, or the name of the remote whose keyring holds it. An empty
+// string is returned if the key is in none of them.
+func KeyringOf(remote string, id uint64) string {
+	keyring := NewHandle("")
+
+	if el, err := keyring.LoadPubKeyring(); err == nil && len(el.KeysById(id)) > 0 {
+		return "local"
+	}
+	names := []string{LegacyRemote}
+	if remote != "" && remote != LegacyRemote {
+		names = append([]string{remote}, names...)
+	}
+	for _, name := range names {
+		if el, err := keyring.loadRemotePubKeyring(name); err == nil && len(el.KeysById(id)) > 0 {
+			return name
+		}
+	}
+	return ""
+}
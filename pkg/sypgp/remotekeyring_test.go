@@ -0,0 +1,136 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/container-key-client/client"
+)
+
+func TestRemoteHandle(t *testing.T) {
+	keyring := NewHandle("/keys")
+
+	h, err := keyring.RemoteHandle("library")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "/keys/remotes/library/pgp-public"; h.PublicPath() != want {
+		t.Errorf("got path %s, want %s", h.PublicPath(), want)
+	}
+
+	for _, name := range []string{"", ".", "..", "a/b"} {
+		if _, err := keyring.RemoteHandle(name); err == nil {
+			t.Errorf("unexpected success for remote name %q", name)
+		}
+	}
+	if _, err := NewHandle("/keys", GlobalHandleOpt()).RemoteHandle("library"); err == nil {
+		t.Errorf("unexpected success for the global keyring")
+	}
+}
+
+func TestMigrateLegacyKeyring(t *testing.T) {
+	dir := t.TempDir()
+	keyring := NewHandle(dir)
+
+	if err := keyring.appendPubKey(testEntity); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.MigrateLegacyKeyring(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the public keys are moved to the legacy keyring
+	el, err := loadKeyring(keyring.PublicPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 0 {
+		t.Errorf("got %d keys in the local keyring, want none", len(el))
+	}
+	legacy, err := keyring.loadRemotePubKeyring(LegacyRemote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(legacy) != 1 || findEntityByFingerprint(legacy, testEntity.PrimaryKey.Fingerprint) == nil {
+		t.Errorf("key not moved to the legacy keyring")
+	}
+
+	// the migration is done only once
+	if err := keyring.appendPubKey(testEntity); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.MigrateLegacyKeyring(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if el, _ := loadKeyring(keyring.PublicPath()); len(el) != 1 {
+		t.Errorf("got %d keys in the local keyring, want 1", len(el))
+	}
+
+	names, err := keyring.RemoteNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{LegacyRemote}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got remotes %v, want %v", names, want)
+	}
+}
+
+func TestRemoteKeyRing(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("APPTAINER_KEYSDIR", dir)
+
+	ms := &mockPKSLookup{code: http.StatusOK, el: openpgp.EntityList{testEntity}}
+	srv := httptest.NewTLSServer(ms)
+	defer srv.Close()
+
+	kr, err := NewRemoteKeyRing(context.Background(), "library",
+		client.OptBaseURL(srv.URL),
+		client.OptHTTPClient(srv.Client()),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	id := testEntity.PrimaryKey.KeyId
+	if KeyringOf("library", id) != "" {
+		t.Fatalf("key unexpectedly found in a local keyring")
+	}
+	if keys := kr.KeysById(id); len(keys) == 0 {
+		t.Fatalf("key not retrieved from the keyserver")
+	}
+
+	// the key retrieved is stored in the keyring of the remote only
+	if got := KeyringOf("library", id); got != "library" {
+		t.Errorf("got keyring %q, want library", got)
+	}
+	if got := KeyringOf("other", id); got != "" {
+		t.Errorf("got keyring %q for another remote, want none", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, RemotesDir, "library", PublicFile)); err != nil {
+		t.Errorf("remote keyring not created: %v", err)
+	}
+
+	// without keyserver, only the local keyrings are consulted
+	ms.code = http.StatusNotFound
+	kr, err = NewRemoteKeyRing(context.Background(), "other")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys := kr.KeysById(id); len(keys) != 0 {
+		t.Errorf("key of another remote keyring unexpectedly found")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// sourcesSuffix is the suffix of the file recording the sources of the
+// keys of a public keyring, next to it.
+const sourcesSuffix = ".sources"
+
+// KeySource describes where a public key of the keyring was fetched from.
+type KeySource struct {
+	Keyserver string    `json:"keyserver"`
+	Fetched   time.Time `json:"fetched"`
+}
+
+// sourcesPath returns the path of the file recording the sources of the
+// public keys.
+func (keyring *Handle) sourcesPath() string {
+	return keyring.PublicPath() + sourcesSuffix
+}
+
+// KeySources returns the sources of the public keys fetched from a
+// keyserver, indexed by their fingerprint in upper case hexadecimal.
+func (keyring *Handle) KeySources() (map[string]KeySource, error) {
+	sources := make(map[string]KeySource)
+	b, err := os.ReadFile(keyring.sourcesPath())
+	if os.IsNotExist(err) {
+		return sources, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &sources); err != nil {
+		return nil, fmt.Errorf("while parsing %s: %v", keyring.sourcesPath(), err)
+	}
+	return sources, nil
+}
+
+// SetKeySource records the keyserver the public key with the given
+// fingerprint was fetched from, or removes its record if keyserver is
+// empty.
+func (keyring *Handle) SetKeySource(fingerprint []byte, keyserver string) error {
+	sources, err := keyring.KeySources()
+	if err != nil {
+		return err
+	}
+	fp := fmt.Sprintf("%X", fingerprint)
+	if keyserver == "" {
+		if _, ok := sources[fp]; !ok {
+			return nil
+		}
+		delete(sources, fp)
+	} else {
+		sources[fp] = KeySource{Keyserver: keyserver, Fetched: time.Now().UTC()}
+	}
+
+	b, err := json.MarshalIndent(sources, "", "\t")
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0o600)
+	if keyring.global {
+		mode = os.FileMode(0o644)
+	}
+	f, err := createOrTruncateFile(keyring.sourcesPath(), mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// keySource returns the keyserver a key was fetched from, or an empty
+// string if unknown.
+func keySource(sources map[string]KeySource, fingerprint []byte) string {
+	return sources[fmt.Sprintf("%X", fingerprint)].Keyserver
+}
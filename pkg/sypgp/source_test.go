@@ -0,0 +1,45 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"testing"
+)
+
+func TestKeySources(t *testing.T) {
+	keyring := NewHandle(t.TempDir())
+	fp := []byte{0xde, 0xad, 0xbe, 0xef}
+
+	sources, err := keyring.KeySources()
+	if err != nil || len(sources) != 0 {
+		t.Fatalf("unexpected sources %v: %v", sources, err)
+	}
+
+	if err := keyring.SetKeySource(fp, "https://keys.example.com"); err != nil {
+		t.Fatalf("failed to set key source: %v", err)
+	}
+	sources, err = keyring.KeySources()
+	if err != nil {
+		t.Fatalf("failed to read key sources: %v", err)
+	}
+	if src := keySource(sources, fp); src != "https://keys.example.com" {
+		t.Errorf("unexpected source %q of DEADBEEF", src)
+	}
+	if sources["DEADBEEF"].Fetched.IsZero() {
+		t.Errorf("fetch time of DEADBEEF not recorded")
+	}
+
+	if err := keyring.SetKeySource(fp, ""); err != nil {
+		t.Fatalf("failed to remove key source: %v", err)
+	}
+	sources, err = keyring.KeySources()
+	if err != nil || len(sources) != 0 {
+		t.Errorf("unexpected sources after removal %v: %v", sources, err)
+	}
+}
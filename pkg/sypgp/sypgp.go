@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
@@ -93,6 +94,12 @@ type GenKeyPairOptions struct {
 	Comment   string
 	Password  string
 	KeyLength int
+	// Algorithm is the public key algorithm of the key: rsa, the
+	// default, ed25519, nistp256 or nistp384.
+	Algorithm string
+	// Lifetime is the validity period of the key, 0 for a key which
+	// never expires.
+	Lifetime time.Duration
 }
 
 func (e *KeyExistsError) Error() string {
@@ -293,9 +300,14 @@ func printEntity(w io.Writer, index int, e *openpgp.Entity) {
 	fmt.Fprintf(w, "   L: %d\n", bits)
 }
 
-func printEntities(w io.Writer, entities openpgp.EntityList) {
+// printEntities pretty prints entities to w, with the keyserver they were
+// fetched from if known from sources
+func printEntities(w io.Writer, entities openpgp.EntityList, sources map[string]KeySource) {
 	for i, e := range entities {
 		printEntity(w, i, e)
+		if src := keySource(sources, e.PrimaryKey.Fingerprint); src != "" {
+			fmt.Fprintf(w, "   S: %s\n", src)
+		}
 		fmt.Fprint(w, "   --------\n")
 	}
 }
@@ -312,7 +324,11 @@ func (keyring *Handle) PrintPubKeyring() error {
 		return err
 	}
 
-	printEntities(os.Stdout, pubEntlist)
+	sources, err := keyring.KeySources()
+	if err != nil {
+		sylog.Warningf("Could not read the sources of the public keys: %v", err)
+	}
+	printEntities(os.Stdout, pubEntlist, sources)
 
 	return nil
 }
@@ -324,7 +340,7 @@ func (keyring *Handle) PrintPrivKeyring() error {
 		return err
 	}
 
-	printEntities(os.Stdout, privEntlist)
+	printEntities(os.Stdout, privEntlist, nil)
 
 	return nil
 }
@@ -502,7 +518,17 @@ func (keyring *Handle) RemovePubKey(toDelete string) error {
 
 	sylog.Verbosef("Updating local keyring: %v", keyring.PublicPath())
 
-	return keyring.storePubKeyring(newKeyList)
+	if err := keyring.storePubKeyring(newKeyList); err != nil {
+		return err
+	}
+	for _, e := range elist {
+		if compareKeyEntity(e, strings.TrimPrefix(toDelete, "0x")) {
+			if err := keyring.SetKeySource(e.PrimaryKey.Fingerprint, ""); err != nil {
+				sylog.Warningf("Could not remove the source of the key: %v", err)
+			}
+		}
+	}
+	return nil
 }
 
 // RemovePrivKey will delete a private key matching toDelete
@@ -526,9 +552,69 @@ func (keyring *Handle) RemovePrivKey(toDelete string) error {
 	return keyring.storePrivKeyring(newKeyList)
 }
 
+// keyAlgorithms maps the algorithm names of the generated keys to their
+// public key algorithm and curve.
+var keyAlgorithms = map[string]struct {
+	algo  packet.PublicKeyAlgorithm
+	curve packet.Curve
+}{
+	"rsa":      {packet.PubKeyAlgoRSA, ""},
+	"ed25519":  {packet.PubKeyAlgoEdDSA, packet.Curve25519},
+	"nistp256": {packet.PubKeyAlgoECDSA, packet.CurveNistP256},
+	"nistp384": {packet.PubKeyAlgoECDSA, packet.CurveNistP384},
+}
+
+// lifetimeUnits are the units of the key lifetimes parsed by ParseKeyLifetime.
+var lifetimeUnits = map[byte]time.Duration{
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'm': 30 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+// ParseKeyLifetime parses the key lifetime s, a number of days, weeks,
+// months or years like 2y, or never and 0 for a key which never expires.
+func ParseKeyLifetime(s string) (time.Duration, error) {
+	if s == "" || s == "0" || s == "never" {
+		return 0, nil
+	}
+	unit, ok := lifetimeUnits[s[len(s)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid key lifetime %q: expecting a number followed by d, w, m or y", s)
+	}
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid key lifetime %q: expecting a number followed by d, w, m or y", s)
+	}
+	if float64(n)*unit.Seconds() > math.MaxUint32 {
+		return 0, fmt.Errorf("key lifetime %q too long", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// KeyExpiry returns the expiry time of the key e, or the zero time if it
+// never expires.
+func KeyExpiry(e *openpgp.Entity) time.Time {
+	id := e.PrimaryIdentity()
+	if id == nil || id.SelfSignature == nil || id.SelfSignature.KeyLifetimeSecs == nil || *id.SelfSignature.KeyLifetimeSecs == 0 {
+		return time.Time{}
+	}
+	return e.PrimaryKey.CreationTime.Add(time.Duration(*id.SelfSignature.KeyLifetimeSecs) * time.Second)
+}
+
 func (keyring *Handle) genKeyPair(opts GenKeyPairOptions) (*openpgp.Entity, error) {
 	conf := &packet.Config{RSABits: opts.KeyLength, DefaultHash: crypto.SHA384}
 
+	if opts.Algorithm != "" {
+		ka, ok := keyAlgorithms[opts.Algorithm]
+		if !ok {
+			return nil, fmt.Errorf("key algorithm %s not supported, use rsa, ed25519, nistp256 or nistp384", opts.Algorithm)
+		}
+		conf.Algorithm = ka.algo
+		conf.Curve = ka.curve
+	}
+	conf.KeyLifetimeSecs = uint32(opts.Lifetime / time.Second)
+
 	entity, err := openpgp.NewEntity(opts.Name, opts.Comment, opts.Email, conf)
 	if err != nil {
 		return nil, err
@@ -600,7 +686,7 @@ func selectPubKey(el openpgp.EntityList) (*openpgp.Entity, error) {
 	if len(el) == 0 {
 		return nil, ErrEmptyKeyring
 	}
-	printEntities(os.Stdout, el)
+	printEntities(os.Stdout, el, nil)
 
 	n, err := interactive.AskNumberInRange(0, len(el)-1, "Enter # of public key to use : ")
 	if err != nil {
@@ -615,7 +701,7 @@ func SelectPrivKey(el openpgp.EntityList) (*openpgp.Entity, error) {
 	if len(el) == 0 {
 		return nil, ErrEmptyKeyring
 	}
-	printEntities(os.Stdout, el)
+	printEntities(os.Stdout, el, nil)
 
 	n, err := interactive.AskNumberInRange(0, len(el)-1, "Enter # of private key to use : ")
 	if err != nil {
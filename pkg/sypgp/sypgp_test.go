@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/armor"
@@ -433,7 +434,7 @@ func TestPrintEntities(t *testing.T) {
 
 	var b bytes.Buffer
 
-	printEntities(&b, entities)
+	printEntities(&b, entities, nil)
 
 	if actual := b.String(); actual != expected {
 		t.Errorf("Unexpected output from printEntities: expecting %q, got %q",
@@ -469,6 +470,17 @@ func TestGenKeyPair(t *testing.T) {
 			encrypted: true,
 			shallPass: true,
 		},
+		{
+			name:      "valid case, ed25519 with expiry",
+			options:   GenKeyPairOptions{Name: "teste", Email: "test@my.info", Algorithm: "ed25519", Lifetime: 48 * time.Hour},
+			encrypted: false,
+			shallPass: true,
+		},
+		{
+			name:      "invalid algorithm",
+			options:   GenKeyPairOptions{Name: "teste", Email: "test@my.info", Algorithm: "dsa"},
+			shallPass: false,
+		},
 	}
 
 	// Create a temporary directory to store the keyring
@@ -491,6 +503,45 @@ func TestGenKeyPair(t *testing.T) {
 			} else if e.PrivateKey.Encrypted != tt.encrypted {
 				t.Fatalf("expected encrypted: %t got: %t", tt.encrypted, e.PrivateKey.Encrypted)
 			}
+
+			expiry := KeyExpiry(e)
+			if tt.options.Lifetime == 0 && !expiry.IsZero() {
+				t.Fatalf("unexpected expiry %v", expiry)
+			} else if tt.options.Lifetime != 0 && !expiry.Equal(e.PrimaryKey.CreationTime.Add(tt.options.Lifetime)) {
+				t.Fatalf("expected expiry after %v got: %v", tt.options.Lifetime, expiry)
+			}
+		})
+	}
+}
+
+func TestParseKeyLifetime(t *testing.T) {
+	tests := []struct {
+		lifetime string
+		want     time.Duration
+		wantErr  bool
+	}{
+		{lifetime: "", want: 0},
+		{lifetime: "never", want: 0},
+		{lifetime: "0", want: 0},
+		{lifetime: "30d", want: 30 * 24 * time.Hour},
+		{lifetime: "2w", want: 14 * 24 * time.Hour},
+		{lifetime: "6m", want: 180 * 24 * time.Hour},
+		{lifetime: "2y", want: 730 * 24 * time.Hour},
+		{lifetime: "2", wantErr: true},
+		{lifetime: "0y", wantErr: true},
+		{lifetime: "y", wantErr: true},
+		{lifetime: "1000y", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lifetime, func(t *testing.T) {
+			got, err := ParseKeyLifetime(tt.lifetime)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
@@ -10,7 +10,9 @@
 package apptainerconf
 
 import (
+	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -41,6 +43,42 @@ func ApplyBuildConfig(config *File) {
 	config.MountDevPts = false
 }
 
+// suidEnvDenylist lists the environment variables which can't be matched
+// by a pattern of the suid env allowlist directive.
+var suidEnvDenylist = []string{
+	"LD_PRELOAD",
+	"LD_LIBRARY_PATH",
+	"LD_AUDIT",
+	"LD_DEBUG",
+	"LD_BIND_NOW",
+	"PATH",
+	"APPTAINERENV_PATH",
+	"APPTAINERENV_PREPEND_PATH",
+	"APPTAINERENV_APPEND_PATH",
+	"SINGULARITYENV_PATH",
+	"SINGULARITYENV_PREPEND_PATH",
+	"SINGULARITYENV_APPEND_PATH",
+}
+
+// checkSuidEnvAllowlist returns an error if a pattern of the suid env
+// allowlist directive is invalid or matches a dangerous variable.
+func checkSuidEnvAllowlist(patterns []string) error {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "LD_") {
+			return fmt.Errorf("pattern %q of directive 'suid env allowlist' matches dynamic linker variables", pattern)
+		}
+		for _, name := range suidEnvDenylist {
+			match, err := path.Match(pattern, name)
+			if err != nil {
+				return fmt.Errorf("bad pattern %q for directive 'suid env allowlist': %s", pattern, err)
+			} else if match {
+				return fmt.Errorf("pattern %q of directive 'suid env allowlist' matches the %s variable which is not allowed", pattern, name)
+			}
+		}
+	}
+	return nil
+}
+
 // SetBinaryPath sets the value of the binary path, substituting the
 // user's $PATH plus ":" for "$PATH:" in BinaryPath.  If nonSuid is true,
 // then SuidBinaryPath gets the same value as BinaryPath, otherwise
@@ -87,6 +125,8 @@ type File struct {
 	MountHome                 bool     `default:"yes" authorized:"yes,no" directive:"mount home"`
 	MountTmp                  bool     `default:"yes" authorized:"yes,no" directive:"mount tmp"`
 	MountHostfs               bool     `default:"no" authorized:"yes,no" directive:"mount hostfs"`
+	MountLocaltime            bool     `default:"no" authorized:"yes,no" directive:"mount localtime"`
+	EnforceReadOnlyRoot       bool     `default:"no" authorized:"yes,no" directive:"enforce read only root"`
 	UserBindControl           bool     `default:"yes" authorized:"yes,no" directive:"user bind control"`
 	EnableFusemount           bool     `default:"yes" authorized:"yes,no" directive:"enable fusemount"`
 	EnableUnderlay            bool     `default:"yes" authorized:"yes,no" directive:"enable underlay"`
@@ -96,6 +136,7 @@ type File struct {
 	AllowContainerSquashfs    bool     `default:"yes" authorized:"yes,no" directive:"allow container squashfs"`
 	AllowContainerExtfs       bool     `default:"yes" authorized:"yes,no" directive:"allow container extfs"`
 	AllowContainerDir         bool     `default:"yes" authorized:"yes,no" directive:"allow container dir"`
+	AllowContainerTar         bool     `default:"yes" authorized:"yes,no" directive:"allow container tar"`
 	AllowSetuidMountEncrypted bool     `default:"yes" authorized:"yes,no" directive:"allow setuid-mount encrypted"`
 	AllowSetuidMountSquashfs  bool     `default:"yes" authorized:"yes,no" directive:"allow setuid-mount squashfs"`
 	AllowSetuidMountExtfs     bool     `default:"no" authorized:"yes,no" directive:"allow setuid-mount extfs"`
@@ -105,6 +146,7 @@ type File struct {
 	SharedLoopDevices         bool     `default:"no" authorized:"yes,no" directive:"shared loop devices"`
 	MaxLoopDevices            uint     `default:"256" directive:"max loop devices"`
 	SessiondirMaxSize         uint     `default:"64" directive:"sessiondir max size"`
+	MaxTmpfsSize              uint     `default:"0" directive:"max tmpfs size"`
 	MountDev                  string   `default:"yes" authorized:"yes,no,minimal" directive:"mount dev"`
 	EnableOverlay             string   `default:"try" authorized:"yes,no,try,driver" directive:"enable overlay"`
 	BindPath                  []string `default:"/etc/localtime,/etc/hosts" directive:"bind path"`
@@ -118,16 +160,42 @@ type File struct {
 	MemoryFSType              string   `default:"tmpfs" authorized:"tmpfs,ramfs" directive:"memory fs type"`
 	CniConfPath               string   `directive:"cni configuration path"`
 	CniPluginPath             string   `directive:"cni plugin path"`
+	BridgeIPv6Subnet          string   `directive:"bridge ipv6 subnet"`
+	RootlessNetworkBackend    string   `default:"auto" authorized:"auto,pasta,slirp4netns" directive:"rootless network backend"`
+	ContainerDNSPolicy        string   `default:"cni-first" authorized:"cni-first,cni-only,host-only" directive:"container dns policy"`
+	ContainerUmask            string   `directive:"container umask"`
+	ContainerGroups           string   `default:"keep" directive:"container groups"`
+	ContainerHostname         string   `directive:"container hostname"`
 	BinaryPath                string   `default:"$PATH:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin" directive:"binary path"`
 	// SuidBinaryPath is hidden; it is not referenced below, and overwritten
-	SuidBinaryPath      string `directive:"suidbinary path"`
-	MksquashfsProcs     uint   `default:"0" directive:"mksquashfs procs"`
-	MksquashfsMem       string `directive:"mksquashfs mem"`
-	ImageDriver         string `directive:"image driver"`
-	DownloadConcurrency uint   `default:"3" directive:"download concurrency"`
-	DownloadPartSize    uint   `default:"5242880" directive:"download part size"`
-	DownloadBufferSize  uint   `default:"32768" directive:"download buffer size"`
-	SystemdCgroups      bool   `default:"yes" authorized:"yes,no" directive:"systemd cgroups"`
+	SuidBinaryPath       string   `directive:"suidbinary path"`
+	MksquashfsProcs      uint     `default:"0" directive:"mksquashfs procs"`
+	MksquashfsMem        string   `directive:"mksquashfs mem"`
+	TmpDirCandidates     []string `directive:"tmpdir candidates"`
+	ImageDriver          string   `directive:"image driver"`
+	AllowPluginRemovals  bool     `default:"no" authorized:"yes,no" directive:"allow plugin removals"`
+	ImageMountDriver     string   `default:"auto" authorized:"auto,kernel,squashfuse,fuse2fs" directive:"image mount driver"`
+	OverlayDriver        string   `default:"auto" authorized:"auto,kernel,fuse" directive:"overlay driver"`
+	SquashfuseThreads    uint     `default:"0" directive:"squashfuse threads"`
+	ImageCopyMaxSize     uint     `default:"2048" directive:"image copy max size"`
+	DownloadConcurrency  uint     `default:"3" directive:"download concurrency"`
+	DownloadPartSize     uint     `default:"5242880" directive:"download part size"`
+	DownloadBufferSize   uint     `default:"32768" directive:"download buffer size"`
+	SystemdCgroups       bool     `default:"yes" authorized:"yes,no" directive:"systemd cgroups"`
+	AllowCgroupsFailure  bool     `default:"no" authorized:"yes,no" directive:"allow cgroups failure"`
+	CgroupsMode          string   `default:"create" authorized:"create,join-job,none" directive:"cgroups mode"`
+	RegisterContainers   bool     `default:"yes" authorized:"yes,no" directive:"register containers"`
+	InstanceLogMaxSize   uint     `default:"0" directive:"instance log max size"`
+	CacheMaxSize         uint     `default:"0" directive:"cache max size"`
+	RemoteCABundle       []string `directive:"remote ca bundle"`
+	RequireSignedImages  bool     `default:"no" authorized:"yes,no" directive:"require signed images"`
+	TrustedSigners       []string `directive:"trusted signers"`
+	AllowUnsignedFormats []string `directive:"allow unsigned formats"`
+	SuidEnvAllowlist     []string `directive:"suid env allowlist"`
+	SecurityCredentials  []string `directive:"security credentials"`
+	// BindPropagation maps host paths to the default mount propagation
+	// of the binds located under them
+	BindPropagation map[string]string `authorized:"private,rprivate,shared,rshared,slave,rslave" directive:"bind propagation"`
 }
 
 // NOTE: if you think that we may want to change the default for any
@@ -185,6 +253,34 @@ config passwd = {{ if eq .ConfigPasswd true }}yes{{ else }}no{{ end }}
 # group entries for the calling user.
 config group = {{ if eq .ConfigGroup true }}yes{{ else }}no{{ end }}
 
+# CONTAINER UMASK: [STRING]
+# DEFAULT: Undefined
+# The octal umask set for the container process.  By default the umask of
+# the calling user is kept.  Users can override it with the --umask option,
+# and --no-umask sets 0022.
+#container umask = 0022
+{{ if ne .ContainerUmask "" }}container umask = {{ .ContainerUmask }}{{ end }}
+
+# CONTAINER GROUPS: [STRING]
+# DEFAULT: keep
+# The supplementary groups of the container process: 'keep' keeps all the
+# groups of the calling user, 'none' drops them, and a comma separated list
+# of group names or IDs keeps only those of the calling user.  Root can set
+# any group in the setuid workflow.  The groups can't be dropped in an
+# unprivileged user namespace, where this directive is ignored.  Users can
+# override it with the --groups option.
+container groups = {{ .ContainerGroups }}
+
+# CONTAINER HOSTNAME: [STRING]
+# DEFAULT: Undefined
+# Force the hostname of all containers, run in a UTS namespace with matching
+# /etc/hostname and /etc/hosts files.  In the pattern %u is replaced by the
+# name of the calling user, %h by the short hostname of the host and %% by
+# a percent sign.  The --hostname option is ignored when set, while
+# --domainname still qualifies the hostname.
+#container hostname = %u-container
+{{ if ne .ContainerHostname "" }}container hostname = {{ .ContainerHostname }}{{ end }}
+
 # CONFIG RESOLV_CONF: [BOOL]
 # DEFAULT: yes
 # If there is a bind point within the container, use the host's
@@ -239,6 +335,21 @@ mount tmp = {{ if eq .MountTmp true }}yes{{ else }}no{{ end }}
 # those into the container?
 mount hostfs = {{ if eq .MountHostfs true }}yes{{ else }}no{{ end }}
 
+# MOUNT LOCALTIME: [BOOL]
+# DEFAULT: no
+# Should the host timezone be set in the container by binding the host's
+# zoneinfo file over /etc/localtime and setting TZ? This is equivalent to
+# always using --tz host, an explicit --tz option takes precedence.
+mount localtime = {{ if eq .MountLocaltime true }}yes{{ else }}no{{ end }}
+
+# ENFORCE READ ONLY ROOT: [BOOL]
+# DEFAULT: no
+# Should containers started by unprivileged users always have a read-only
+# root filesystem, as with --read-only-root? Only the paths requested with
+# --writable-path are then writable through a writable overlay, and
+# --writable is rejected.
+enforce read only root = {{ if eq .EnforceReadOnlyRoot true }}yes{{ else }}no{{ end }}
+
 # BIND PATH: [STRING]
 # DEFAULT: Undefined
 # Define a list of files/directories that should be made available from within
@@ -291,6 +402,21 @@ enable underlay = {{ if eq .EnableUnderlay true }}yes{{ else }}no{{ end }}
 # show up in the container.
 mount slave = {{ if eq .MountSlave true }}yes{{ else }}no{{ end }}
 
+# BIND PROPAGATION: [STRING]
+# DEFAULT: Undefined
+# Set the default mount propagation of the binds whose source is the given
+# host path or is located under it, when the bind doesn't set one, one of
+# private, rprivate, shared, rshared, slave or rslave. With rslave, file
+# systems mounted on the host under the path after the container started,
+# like autofs mounts, show up in the container. This requires 'mount slave'
+# to be enabled for slave and shared propagations. Mounts done in the
+# container never propagate to the host.
+#bind propagation /cvmfs = rslave
+{{ range $path, $mode := .BindPropagation }}
+{{- if ne $path "" -}}
+bind propagation {{$path}} = {{$mode}}
+{{ end -}}
+{{ end }}
 # SESSIONDIR MAXSIZE: [STRING]
 # DEFAULT: 64
 # This specifies how large the default sessiondir should be (in MB). It will
@@ -299,6 +425,14 @@ mount slave = {{ if eq .MountSlave true }}yes{{ else }}no{{ end }}
 # it will also affect users of "--writable-tmpfs".
 sessiondir max size = {{ .SessiondirMaxSize }}
 
+# MAX TMPFS SIZE: [INT]
+# DEFAULT: 0
+# This specifies the maximum size (in MiB) of the tmpfs filesystems non-root
+# users mount with "--mount type=tmpfs" or "--shm-size". Larger sizes are
+# clamped to this value, and tmpfs mounts without a size get this size rather
+# than the kernel default of half the memory. 0 means no limit.
+max tmpfs size = {{ .MaxTmpfsSize }}
+
 # LIMIT CONTAINER OWNERS: [STRING]
 # DEFAULT: NULL
 # Only allow containers to be used that are owned by a given user. If this
@@ -350,6 +484,11 @@ allow container encrypted = {{ if eq .AllowContainerEncrypted true }}yes{{ else
 allow container squashfs = {{ if eq .AllowContainerSquashfs true }}yes{{ else }}no{{ end }}
 allow container extfs = {{ if eq .AllowContainerExtfs true }}yes{{ else }}no{{ end }}
 allow container dir = {{ if eq .AllowContainerDir true }}yes{{ else }}no{{ end }}
+#
+# Allow use of tar, tar.gz and tar.zst archives of a root filesystem, which
+# are extracted to a sandbox in the user's cache and run read-only. The
+# extracted sandbox is subject to the sandbox limits as well.
+allow container tar = {{ if eq .AllowContainerTar true }}yes{{ else }}no{{ end }}
 
 # ALLOW SETUID-MOUNT ${TYPE}: [BOOL]
 # DEFAULT: yes, except no for extfs
@@ -461,6 +600,41 @@ memory fs type = {{ .MemoryFSType }}
 #cni plugin path =
 {{ if ne .CniPluginPath "" }}cni plugin path = {{ .CniPluginPath }}{{ end }}
 
+# BRIDGE IPV6 SUBNET: [STRING]
+# DEFAULT: Undefined
+# Sets the IPv6 subnet of the addresses given to the containers on the
+# bundled bridge network, overriding the one of its CNI configuration, or
+# adds one to an IPv4 only configuration. Set to 'none' to only give IPv4
+# addresses. When IPv6 is disabled on the host, the containers only get
+# IPv4 addresses regardless.
+#bridge ipv6 subnet = fd00:10:22::/64
+{{ if ne .BridgeIPv6Subnet "" }}bridge ipv6 subnet = {{ .BridgeIPv6Subnet }}{{ end }}
+
+# ROOTLESS NETWORK BACKEND: [auto/pasta/slirp4netns]
+# DEFAULT: auto
+# Selects the user mode network used to publish the ports of a container
+# with --publish, when the user isn't permitted to use a CNI network and the
+# container runs in a user namespace:
+# - auto: use pasta if found, slirp4netns otherwise.
+# - pasta: use pasta, falling back to slirp4netns with a warning.
+# - slirp4netns: only use slirp4netns.
+# The host ports are forwarded by the backend, running as the user. A backend
+# can also be selected for a container with --network pasta or
+# --network slirp4netns.
+rootless network backend = {{ .RootlessNetworkBackend }}
+
+# CONTAINER DNS POLICY: [cni-first/cni-only/host-only]
+# DEFAULT: cni-first
+# Selects how the DNS configuration returned by the CNI plugins of the
+# container networks, its nameservers, domain, search domains and options, is
+# written to the container resolv.conf, along with the host one or the one
+# set with --dns, --dns-search and --dns-option:
+# - cni-first: the CNI entries come first, followed by the host ones.
+# - cni-only: only the CNI entries are used, if the plugins returned any.
+# - host-only: the CNI entries are ignored.
+# This requires 'config resolv_conf = yes'.
+container dns policy = {{ .ContainerDNSPolicy }}
+
 # BINARY PATH: [STRING]
 # DEFAULT: $PATH:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin
 # Colon-separated list of directories to search for many binaries.  May include
@@ -489,6 +663,20 @@ mksquashfs procs = {{ .MksquashfsProcs }}
 # mksquashfs mem = 1G
 {{ if ne .MksquashfsMem "" }}mksquashfs mem = {{ .MksquashfsMem }}{{ end }}
 
+# TMPDIR CANDIDATES: [STRING]
+# DEFAULT: NULL
+# Comma-separated list of temporary directories, in order of preference, to
+# use for builds, pulls and image conversions when the temporary directory
+# isn't set with APPTAINER_TMPDIR. The first directory with enough space for
+# the estimated size of the extracted image is used. Environment variables
+# like $USER are expanded, and missing directories are skipped. When unset,
+# the default temporary directory is used and the command fails early if
+# it doesn't have enough space.
+#tmpdir candidates = /tmp, /scratch/$USER, /var/tmp
+{{ range $index, $dir := .TmpDirCandidates }}
+{{- if eq $index 0 }}tmpdir candidates = {{ else }}, {{ end }}{{$dir}}
+{{- end }}
+
 # SHARED LOOP DEVICES: [BOOL]
 # DEFAULT: no
 # Allow to share same images associated with loop devices to minimize loop
@@ -507,6 +695,69 @@ shared loop devices = {{ if eq .SharedLoopDevices true }}yes{{ else }}no{{ end }
 # the run-time will abort.
 image driver = {{ .ImageDriver }}
 
+# ALLOW PLUGIN REMOVALS: [BOOL]
+# DEFAULT: no
+# Plugins can add bind mounts, environment variables and namespaces to the
+# container configuration just before the container starts. This option
+# also allows them to remove the bind mounts, environment variables and
+# namespaces requested by the user or set by this configuration, otherwise
+# the container doesn't start when a plugin attempts to remove them.
+allow plugin removals = {{ if eq .AllowPluginRemovals true }}yes{{ else }}no{{ end }}
+
+# IMAGE MOUNT DRIVER: [STRING]
+# DEFAULT: auto
+# This option selects how image filesystems are mounted when running without
+# the setuid starter (for example with --userns or in a non-setuid
+# installation).  With the setuid starter the kernel is always used.
+# - auto: squashfs images are mounted with squashfuse and extfs images with
+#   fuse2fs when they are installed, otherwise SIF images are extracted to a
+#   temporary sandbox.
+# - kernel: never use FUSE to mount image filesystems, SIF images are always
+#   extracted to a temporary sandbox.
+# - squashfuse: mount squashfs images with squashfuse only, and fail when it
+#   is not installed instead of extracting the image.  extfs images are not
+#   mounted with fuse2fs.
+# - fuse2fs: mount extfs images with fuse2fs only, squashfs images are
+#   extracted to a temporary sandbox.
+# This option is ignored when 'image driver' selects a plugin image driver.
+image mount driver = {{ .ImageMountDriver }}
+
+# OVERLAY DRIVER: [auto/kernel/fuse]
+# DEFAULT: auto
+# This option selects how the overlay of the container is mounted when
+# running without the setuid starter (for example with --userns, --fakeroot
+# or in a non-setuid installation).  With the setuid starter the kernel is
+# always used.
+# - auto: the kernel overlayfs is used if it supports unprivileged mounts,
+#   otherwise fuse-overlayfs if it is installed, otherwise, when there is no
+#   overlay image nor writable layer, the binds are done on top of the
+#   image (mounted by squashfuse) with the underlay.
+# - kernel: only use the kernel overlayfs.
+# - fuse: only use fuse-overlayfs.
+# The result of the kernel overlayfs check is cached until the next boot.
+# 'enable overlay = driver' selects fuse.
+overlay driver = {{ .OverlayDriver }}
+
+# SQUASHFUSE THREADS: [UINT]
+# DEFAULT: 0
+# This option sets the number of threads used by squashfuse to serve an
+# image mount.  The default of 0 keeps the squashfuse default, 1 forces the
+# single-threaded mode, and a larger value enables the multi-threaded mode
+# when the installed squashfuse supports it.  Users can override it with
+# the --squashfuse-threads option.
+squashfuse threads = {{ .SquashfuseThreads }}
+
+# IMAGE COPY MAX SIZE: [UINT]
+# DEFAULT: 2048
+# This option sets the maximum size in MiB of the image files copied to a
+# temporary directory before running them with the setuid starter, when
+# they are stored on a FUSE filesystem without memory mapping support (like
+# the s3fs or rclone mounts of object stores) which can't back a loop
+# device.  Larger images fail to run with the setuid starter, and must be
+# run with --userns, where squashfuse reads them.  Set it to 0 to never copy
+# the images.
+image copy max size = {{ .ImageCopyMaxSize }}
+
 # DOWNLOAD CONCURRENCY: [UINT]
 # DEFAULT: 3
 # This option specifies how many concurrent streams when downloading (pulling)
@@ -530,4 +781,118 @@ download buffer size = {{ .DownloadBufferSize }}
 # Whether to use systemd to manage container cgroups. Required for rootless cgroups
 # functionality. 'no' will manage cgroups directly via cgroupfs.
 systemd cgroups = {{ if eq .SystemdCgroups true }}yes{{ else }}no{{ end }}
+
+# ALLOW CGROUPS FAILURE: [BOOL]
+# DEFAULT: no
+# Whether a container is still started, with a warning, when the cgroup
+# requested with resource limit options or --apply-cgroups can't be set up.
+# With 'no' the container launch is aborted instead of running unconfined.
+allow cgroups failure = {{ if eq .AllowCgroupsFailure true }}yes{{ else }}no{{ end }}
+
+# CGROUPS MODE: [create/join-job/none]
+# DEFAULT: create
+# Where the cgroup of a container is set up, the --cgroups option overriding
+# this default:
+# - create: create a new cgroup for resource limits, and for instances to
+#   report stats, with the cgroups manager selected above.
+# - join-job: create the container cgroup beneath the cgroup apptainer is
+#   started in, e.g. the cgroup of a Slurm job step, when it is delegated to
+#   the user. Otherwise no cgroup is created, resource limits are not
+#   applied, and instance stats are reported from the job cgroup.
+# - none: never set up a cgroup, resource limits are ignored.
+cgroups mode = {{ .CgroupsMode }}
+
+# REGISTER CONTAINERS: [BOOL]
+# DEFAULT: yes
+# Whether containers started with exec, run, shell and test are registered
+# with a small file in the user's XDG_RUNTIME_DIR, so they are listed by
+# 'apptainer top' along with instances.
+register containers = {{ if eq .RegisterContainers true }}yes{{ else }}no{{ end }}
+
+# INSTANCE LOG MAX SIZE: [UINT]
+# DEFAULT: 0
+# Default maximum size in MiB of the standard output and error log files of
+# instances. When a log file reaches this size, its content is moved to a
+# rotated file (<name>.out.1, <name>.out.2, ...) and the log file is truncated.
+# Users can override it with the --log-max-size option of instance start.
+# 0 disables the rotation of instance log files.
+instance log max size = {{ .InstanceLogMaxSize }}
+
+# CACHE MAX SIZE: [UINT]
+# DEFAULT: 0
+# Maximum size in MiB of the image cache of each user. When adding an entry
+# to the cache would make it larger, the least recently used entries are
+# removed until the new entry fits, skipping the entries in use by other
+# pulls or builds, and the pull fails if the new entry alone is larger.
+# Users can override it with the APPTAINER_CACHE_MAX_SIZE environment
+# variable. 0 means no limit.
+cache max size = {{ .CacheMaxSize }}
+
+# REMOTE CA BUNDLE: [STRING]
+# DEFAULT: NULL
+# Comma-separated list of files holding PEM-encoded CA certificates trusted,
+# in addition to the system ones, by the clients of the library, keyserver
+# and registry services of the remote endpoints. Use this for a site-wide
+# certificate authority rather than adding it to the system trust store.
+#remote ca bundle = /etc/pki/site/ca.pem
+{{ range $index, $path := .RemoteCABundle }}
+{{- if eq $index 0 }}remote ca bundle = {{ else }}, {{ end }}{{$path}}
+{{- end }}
+
+# REQUIRE SIGNED IMAGES: [BOOL]
+# DEFAULT: no
+# Only run SIF images with valid signatures of all their object groups by
+# one of the trusted signers, for exec, run, shell and instance start. The
+# keys embedded in the images are never used to verify them. Images in
+# other formats are refused, unless allowed below.
+require signed images = {{ if eq .RequireSignedImages true }}yes{{ else }}no{{ end }}
+
+# TRUSTED SIGNERS: [STRING]
+# DEFAULT: NULL
+# Comma-separated list of the fingerprints of the trusted signers, whose
+# public keys are read from the global keyring. An entry starting with @
+# is a directory whose files hold the public keys of additional trusted
+# signers, in binary or ASCII armored format.
+#trusted signers = F34371D0ACD5D09EB9BD853A80600A5FA11BBD29, @/etc/apptainer/trusted-keys.d
+{{ range $index, $signer := .TrustedSigners }}
+{{- if eq $index 0 }}trusted signers = {{ else }}, {{ end }}{{$signer}}
+{{- end }}
+
+# ALLOW UNSIGNED FORMATS: [STRING]
+# DEFAULT: NULL
+# Comma-separated list of the image formats without signatures still
+# allowed to run when signed images are required: sandbox, squashfs,
+# ext3 and/or tar. A tar archive is run from the sandbox it's extracted
+# to, so both sandbox and tar must be allowed to run it.
+#allow unsigned formats = sandbox
+{{ range $index, $format := .AllowUnsignedFormats }}
+{{- if eq $index 0 }}allow unsigned formats = {{ else }}, {{ end }}{{$format}}
+{{- end }}
+
+# SUID ENV ALLOWLIST: [STRING]
+# DEFAULT: NULL
+# Comma-separated list of glob patterns of the host environment variables
+# still passed to the container with --cleanenv or --containall when using
+# the setuid workflow. The variables only reach the container environment,
+# the setuid starter always runs with an empty environment. Patterns
+# matching variables affecting the dynamic linker or the search path, like
+# LD_* or PATH, are rejected.
+#suid env allowlist = SLURM_*, KRB5CCNAME
+{{ range $index, $pattern := .SuidEnvAllowlist }}
+{{- if eq $index 0 }}suid env allowlist = {{ else }}, {{ end }}{{$pattern}}
+{{- end }}
+
+# SECURITY CREDENTIALS: [STRING]
+# DEFAULT: NULL
+# Comma-separated list of the host credentials bound by default in the
+# containers, the --security-credentials option overriding this default:
+# - krb5: the Kerberos credential cache of KRB5CCNAME, or the KCM socket.
+# - munge: the munge daemon socket, e.g. to submit Slurm jobs.
+# - ssh-agent: the SSH agent socket of SSH_AUTH_SOCK.
+# A credential is only bound when owned by the container user, and a
+# warning is printed when it's missing.
+#security credentials = krb5, munge
+{{ range $index, $cred := .SecurityCredentials }}
+{{- if eq $index 0 }}security credentials = {{ else }}, {{ end }}{{$cred}}
+{{- end }}
 `
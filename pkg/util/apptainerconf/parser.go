@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -24,7 +25,9 @@ import (
 // holding directives mapped to their respective values.
 type Directives map[string][]string
 
-var parserReg = regexp.MustCompile(`(?m)^\s*([a-zA-Z _-]+)[[:blank:]]*=[[:blank:]]*(.*)$`)
+// parserReg matches a directive line, some directives like 'bind propagation'
+// take a path argument before the equal sign.
+var parserReg = regexp.MustCompile(`(?m)^\s*([a-zA-Z _-]+?)(?:[[:blank:]]+(/[^=\n]*?))?[[:blank:]]*=[[:blank:]]*(.*)$`)
 
 // GetDirectives parses configuration directives from reader
 // and returns a directive map with associated values.
@@ -43,7 +46,12 @@ func GetDirectives(reader io.Reader) (Directives, error) {
 	for _, match := range parserReg.FindAllSubmatch(data, -1) {
 		if match != nil {
 			key := strings.TrimSpace(string(match[1]))
-			val := strings.TrimSpace(string(match[2]))
+			val := strings.TrimSpace(string(match[3]))
+			// a directive path argument is stored with its value
+			// in path=value format
+			if arg := strings.TrimSpace(string(match[2])); arg != "" && val != "" {
+				val = arg + "=" + val
+			}
 			if val != "" {
 				directives[key] = append(directives[key], val)
 			}
@@ -155,6 +163,31 @@ func GetConfig(directives Directives) (*File, error) {
 				return nil, fmt.Errorf("value authorized for directive '%s' are %s", dir, authorized)
 			}
 			valueField.SetString(value[0])
+		case reflect.Map:
+			m := make(map[string]string, len(value))
+			for _, val := range value {
+				i := strings.LastIndex(val, "=")
+				if i <= 0 {
+					return nil, fmt.Errorf("directive '%s' requires a path argument, got %q", dir, val)
+				}
+				path := filepath.Clean(strings.TrimSpace(val[:i]))
+				v := strings.TrimSpace(val[i+1:])
+				if !filepath.IsAbs(path) {
+					return nil, fmt.Errorf("path %q of directive '%s' must be absolute", path, dir)
+				}
+				found := false
+				for _, a := range authorized {
+					if a == v {
+						found = true
+						break
+					}
+				}
+				if !found && len(authorized) > 0 {
+					return nil, fmt.Errorf("value authorized for directive '%s' are %s", dir, authorized)
+				}
+				m[path] = v
+			}
+			valueField.Set(reflect.ValueOf(m))
 		case reflect.Slice:
 			l := len(value)
 			v := reflect.MakeSlice(typeField.Type, l, l)
@@ -169,6 +202,10 @@ func GetConfig(directives Directives) (*File, error) {
 		}
 	}
 
+	if err := checkSuidEnvAllowlist(file.SuidEnvAllowlist); err != nil {
+		return nil, err
+	}
+
 	return file, nil
 }
 
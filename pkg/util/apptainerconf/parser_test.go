@@ -10,10 +10,12 @@
 package apptainerconf
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -120,6 +122,15 @@ func TestGetConfig(t *testing.T) {
 	}
 
 	directives["max loop devices"] = []string{"42"}
+
+	for _, pattern := range []string{"LD_*", "PATH", "*", "L*", "APPTAINERENV_*", "[a"} {
+		directives["suid env allowlist"] = []string{"SLURM_*," + pattern}
+		if _, err := GetConfig(directives); err == nil {
+			t.Errorf("unexpected success while getting config with suid env allowlist pattern %q", pattern)
+		}
+	}
+
+	directives["suid env allowlist"] = []string{"SLURM_*, KRB5CCNAME"}
 	directives["bind path"] = []string{"/etc/hosts"}
 
 	directives["download concurrency"] = []string{"42"}
@@ -151,6 +162,9 @@ func TestGetConfig(t *testing.T) {
 	if config.DownloadBufferSize != 4567 {
 		t.Errorf("bad value for DownloadBufferSize: %v", config.DownloadPartSize)
 	}
+	if !reflect.DeepEqual(config.SuidEnvAllowlist, []string{"SLURM_*", "KRB5CCNAME"}) {
+		t.Errorf("bad value for SuidEnvAllowlist: %v", config.SuidEnvAllowlist)
+	}
 }
 
 func TestHasDirective(t *testing.T) {
@@ -164,3 +178,49 @@ func TestHasDirective(t *testing.T) {
 		t.Errorf("'fake directive' should not be present")
 	}
 }
+
+func TestBindPropagation(t *testing.T) {
+	conf := "bind path = /opt\nbind propagation /cvmfs = rslave\nbind propagation  /data/shared/ = rshared\n"
+
+	directives, err := GetDirectives(strings.NewReader(conf))
+	if err != nil {
+		t.Fatalf("unexpected error while getting directives: %s", err)
+	}
+	config, err := GetConfig(directives)
+	if err != nil {
+		t.Fatalf("unexpected error while getting config: %s", err)
+	}
+	want := map[string]string{"/cvmfs": "rslave", "/data/shared": "rshared"}
+	if !reflect.DeepEqual(config.BindPropagation, want) {
+		t.Errorf("got bind propagation %v, want %v", config.BindPropagation, want)
+	}
+	if !reflect.DeepEqual(config.BindPath, []string{"/opt"}) {
+		t.Errorf("got bind path %v, want [/opt]", config.BindPath)
+	}
+
+	var b bytes.Buffer
+	if err := Generate(&b, "", config); err != nil {
+		t.Fatalf("failed to generate configuration: %s", err)
+	}
+	directives, err = GetDirectives(&b)
+	if err != nil {
+		t.Fatalf("unexpected error while getting generated directives: %s", err)
+	}
+	generated, err := GetConfig(directives)
+	if err != nil {
+		t.Fatalf("unexpected error while getting generated config: %s", err)
+	}
+	if !reflect.DeepEqual(generated.BindPropagation, want) {
+		t.Errorf("got generated bind propagation %v, want %v", generated.BindPropagation, want)
+	}
+
+	for _, bad := range []string{"bind propagation /cvmfs = unbindable", "bind propagation = rslave", "bind propagation = cvmfs=rslave"} {
+		directives, err := GetDirectives(strings.NewReader(bad))
+		if err != nil {
+			t.Fatalf("unexpected error while getting directives: %s", err)
+		}
+		if _, err := GetConfig(directives); err == nil {
+			t.Errorf("unexpected success while getting config with %q", bad)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// bootIDFile contains a random ID generated at each boot of the host.
+const bootIDFile = "/proc/sys/kernel/random/boot_id"
+
+// StaleFileAge is the time after which a lock file not refreshed by its
+// holder is considered stale, e.g. when held by a process of a dead host.
+const StaleFileAge = time.Minute
+
+// fileHeartbeat is the interval at which a lock file is refreshed by its
+// holder.
+var fileHeartbeat = 10 * time.Second
+
+// FileHolder identifies the process holding a lock file.
+type FileHolder struct {
+	Hostname string
+	PID      int
+	// BootID is the boot ID of the host of the process, empty if unknown.
+	BootID string
+}
+
+// String returns a description of the holder for error messages.
+func (h FileHolder) String() string {
+	return fmt.Sprintf("process %d on host %s", h.PID, h.Hostname)
+}
+
+// HeldError is returned when a lock file is held by another process.
+type HeldError struct {
+	Path string
+	// Holder is the process holding the lock file, nil if unknown.
+	Holder *FileHolder
+}
+
+func (e *HeldError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("%s is held by another process", e.Path)
+	}
+	return fmt.Sprintf("%s is held by %s", e.Path, e.Holder)
+}
+
+// File is an exclusive lock file. Unlike flock locks, which are local to
+// a host or not supported on some network and parallel filesystems, a lock
+// file is held by its creation, so it protects from concurrent use by
+// processes of different hosts sharing a NFS, Lustre or GPFS filesystem.
+// The lock file records the hostname, process ID and boot ID of its holder
+// and is refreshed while held, a lock file held by a dead process of this
+// host, by a process of a previous boot of this host, or not refreshed for
+// StaleFileAge is broken.
+type File struct {
+	path  string
+	owner os.FileInfo
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// TryFile creates the lock file path and returns it, or returns a
+// HeldError if it's held by another process.
+func TryFile(path string) (*File, error) {
+	self := currentHolder()
+
+	// the lock file is created complete with a hard link, like the
+	// shadow-utils locks, so that its holder is always readable and the
+	// creation is exclusive even on filesystems without a reliable O_EXCL
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return nil, fmt.Errorf("could not create lock file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = fmt.Fprintf(tmp, "%s %d %s\n", self.Hostname, self.PID, self.BootID)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not write %s: %v", tmp.Name(), err)
+	}
+
+	for {
+		err := os.Link(tmp.Name(), path)
+		if errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOTSUP) {
+			// no hard links on this filesystem
+			err = createExclusive(path, tmp.Name())
+		}
+		if err == nil {
+			return holdFile(path)
+		} else if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("could not create %s: %v", path, err)
+		}
+
+		current, holder, stale := fileIsStale(path, self)
+		if current == nil {
+			// released meanwhile
+			continue
+		} else if stale {
+			if holder != nil {
+				sylog.Warningf("Breaking stale lock file %s held by %s", path, holder)
+			} else {
+				sylog.Warningf("Breaking stale lock file %s", path)
+			}
+			breakFile(path, current)
+			continue
+		}
+		return nil, &HeldError{Path: path, Holder: holder}
+	}
+}
+
+// createExclusive creates the lock file path with O_EXCL and the content
+// of the file tmp.
+func createExclusive(path, tmp string) error {
+	b, err := os.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// holdFile refreshes the modification time of the lock file path created
+// by this process until it is unlocked.
+func holdFile(path string) (*File, error) {
+	owner, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &File{
+		path:  path,
+		owner: owner,
+		done:  make(chan struct{}),
+	}
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(fileHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.done:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				// errors are ignored, the lock is broken by another
+				// process if not refreshed
+				_ = os.Chtimes(path, now, now)
+			}
+		}
+	}()
+
+	return l, nil
+}
+
+// Path returns the path of the lock file.
+func (l *File) Path() string {
+	return l.path
+}
+
+// Unlock stops refreshing the lock file and removes it, unless it was
+// broken and is now held by another process.
+func (l *File) Unlock() {
+	l.once.Do(func() {
+		close(l.done)
+		l.wg.Wait()
+		breakFile(l.path, l.owner)
+	})
+}
+
+// ReadFileHolder returns the holder recorded in the lock file path.
+func ReadFileHolder(path string) (*FileHolder, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// the boot ID is missing from the lock files of older versions
+	fields := strings.Fields(string(b))
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, fmt.Errorf("invalid lock file %s", path)
+	}
+	pid, err := strconv.Atoi(fields[1])
+	if err != nil || pid <= 0 {
+		return nil, fmt.Errorf("invalid process ID in lock file %s", path)
+	}
+	h := &FileHolder{Hostname: fields[0], PID: pid}
+	if len(fields) == 3 {
+		h.BootID = fields[2]
+	}
+	return h, nil
+}
+
+// currentHolder returns the holder identifying this process.
+func currentHolder() FileHolder {
+	hostname, _ := os.Hostname()
+	bootID, _ := os.ReadFile(bootIDFile)
+	return FileHolder{
+		Hostname: hostname,
+		PID:      os.Getpid(),
+		BootID:   strings.TrimSpace(string(bootID)),
+	}
+}
+
+// fileIsStale returns the current lock file path, if any, its holder if
+// known, and if it is stale for the process self: not refreshed for
+// StaleFileAge, or held by a process of self's host which is dead or
+// from a previous boot.
+func fileIsStale(path string, self FileHolder) (os.FileInfo, *FileHolder, bool) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	holder, _ := ReadFileHolder(path)
+	if time.Since(fi.ModTime()) > StaleFileAge {
+		return fi, holder, true
+	}
+	if holder == nil || holder.Hostname != self.Hostname {
+		return fi, holder, false
+	}
+	if holder.BootID != "" && self.BootID != "" && holder.BootID != self.BootID {
+		return fi, holder, true
+	}
+	return fi, holder, unix.Kill(holder.PID, 0) == unix.ESRCH
+}
+
+// breakFile removes the lock file path, unless it was released and
+// created meanwhile by another holder.
+func breakFile(path string, holder os.FileInfo) {
+	fi, err := os.Stat(path)
+	if err != nil || !os.SameFile(fi, holder) {
+		return
+	}
+	_ = os.Remove(path)
+}
@@ -0,0 +1,178 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.lock")
+
+	l, err := TryFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	self := currentHolder()
+	holder, err := ReadFileHolder(path)
+	if err != nil {
+		t.Fatalf("unexpected error while reading holder: %v", err)
+	} else if *holder != self {
+		t.Errorf("unexpected holder: got %+v instead of %+v", *holder, self)
+	}
+
+	_, err = TryFile(path)
+	var held *HeldError
+	if !errors.As(err, &held) {
+		t.Fatalf("unexpected error for a held lock file: %v", err)
+	}
+	if held.Holder == nil || *held.Holder != self {
+		t.Errorf("unexpected holder: %v", held.Holder)
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("process %d on host %s", self.PID, self.Hostname)) {
+		t.Errorf("holder not named in error: %s", err)
+	}
+
+	l.Unlock()
+	l.Unlock()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("lock file not removed")
+	}
+
+	l, err = TryFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error for a released lock file: %v", err)
+	}
+	// a lock file broken and created by another process is not removed
+	other := path + ".other"
+	if err := os.WriteFile(other, []byte("otherhost 1 boot\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(other, path); err != nil {
+		t.Fatal(err)
+	}
+	l.Unlock()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("lock file of another process removed")
+	}
+}
+
+func TestTryFileStale(t *testing.T) {
+	self := currentHolder()
+	if self.BootID == "" {
+		t.Skipf("no boot ID in %s", bootIDFile)
+	}
+
+	tests := []struct {
+		name   string
+		holder string
+		age    time.Duration
+		stale  bool
+	}{
+		{
+			// a process ID above the maximum is never alive
+			name:   "dead process",
+			holder: fmt.Sprintf("%s %d %s", self.Hostname, 1<<30, self.BootID),
+			stale:  true,
+		},
+		{
+			name:   "dead process without boot ID",
+			holder: fmt.Sprintf("%s %d", self.Hostname, 1<<30),
+			stale:  true,
+		},
+		{
+			// the process ID may have been reused after a reboot
+			name:   "previous boot",
+			holder: fmt.Sprintf("%s %d %s", self.Hostname, self.PID, "previous-boot"),
+			stale:  true,
+		},
+		{
+			name:   "dead host",
+			holder: "otherhost 1 otherboot",
+			age:    2 * StaleFileAge,
+			stale:  true,
+		},
+		{
+			name:   "live host",
+			holder: "otherhost 1 otherboot",
+		},
+		{
+			name:   "live process",
+			holder: fmt.Sprintf("%s %d %s", self.Hostname, self.PID, self.BootID),
+		},
+		{
+			name:   "invalid",
+			holder: "invalid",
+		},
+		{
+			name:   "invalid not refreshed",
+			holder: "invalid",
+			age:    2 * StaleFileAge,
+			stale:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image.lock")
+			if err := os.WriteFile(path, []byte(tt.holder+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			modTime := time.Now().Add(-tt.age)
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+
+			l, err := TryFile(path)
+			if tt.stale {
+				if err != nil {
+					t.Fatalf("stale lock file not broken: %v", err)
+				}
+				l.Unlock()
+				return
+			}
+			var held *HeldError
+			if !errors.As(err, &held) {
+				t.Fatalf("unexpected error for a held lock file: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileHeartbeat(t *testing.T) {
+	defer func(heartbeat time.Duration) {
+		fileHeartbeat = heartbeat
+	}(fileHeartbeat)
+	fileHeartbeat = 10 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "image.lock")
+	l, err := TryFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Unlock()
+
+	modTime := time.Now().Add(-2 * StaleFileAge)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		time.Sleep(fileHeartbeat)
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) < StaleFileAge {
+			return
+		}
+	}
+	t.Errorf("lock file not refreshed")
+}